@@ -1,10 +1,19 @@
 """Anthropic Claude LLM adapter."""
 import json
-from typing import Any, AsyncIterator, Dict, List, Optional
+from typing import Any, AsyncIterator, Dict, List, Optional, Tuple
 
 import httpx
 
-from reliapi.adapters.llm.base import LLMAdapter
+from reliapi.adapters.llm.base import LLMAdapter, TranslationError, parse_data_url, provider_meta, split_system
+
+# Anthropic stop_reason values as OpenAI finish_reason
+FINISH_REASONS = {
+    "end_turn": "stop",
+    "stop_sequence": "stop",
+    "max_tokens": "length",
+    "tool_use": "tool_calls",
+    "refusal": "content_filter",
+}
 
 
 class AnthropicAdapter(LLMAdapter):
@@ -17,6 +26,8 @@ class AnthropicAdapter(LLMAdapter):
         "claude-3-haiku-20240307": {"prompt": 0.25, "completion": 1.25},
         "claude-3-5-sonnet-20241022": {"prompt": 3.0, "completion": 15.0},
     }
+
+    RESPONSE_FIELDS = ("content",)
     
     def prepare_request(
         self,
@@ -27,12 +38,23 @@ class AnthropicAdapter(LLMAdapter):
         top_p: Optional[float] = None,
         stop: Optional[List[str]] = None,
         stream: bool = False,
+        tools: Optional[List[Dict[str, Any]]] = None,
+        tool_choice: Optional[Any] = None,
+        response_format: Optional[Dict[str, Any]] = None,
         **kwargs,
     ) -> Dict[str, Any]:
-        """Prepare Anthropic request payload."""
+        """Prepare Anthropic request payload.
+
+        OpenAI-style tool calls and tool messages become tool_use and
+        tool_result blocks, and response_format, which Anthropic lacks, a
+        system instruction. System messages go in the top-level system
+        field, and consecutive messages of one role are merged, as Anthropic
+        requires turns to alternate starting with the user.
+        """
+        system, conversation = split_system(messages, "Anthropic")
         payload = {
             "model": model,
-            "messages": messages,
+            "messages": _alternate(_anthropic_messages([msg for _, msg in conversation]), conversation),
             "max_tokens": max_tokens or 1024,
         }
         
@@ -44,9 +66,31 @@ class AnthropicAdapter(LLMAdapter):
             payload["stop_sequences"] = stop
         if stream:
             payload["stream"] = True
+        if tools:
+            payload["tools"] = []
+            for tool in tools:
+                function = tool["function"]
+                definition = {
+                    "name": function["name"],
+                    "input_schema": function.get("parameters") or {"type": "object", "properties": {}},
+                }
+                if function.get("description"):
+                    definition["description"] = function["description"]
+                payload["tools"].append(definition)
+        if tool_choice is not None:
+            payload["tool_choice"] = _anthropic_tool_choice(tool_choice, tools)
+        instruction = _format_instruction(response_format)
+        system = "\n\n".join(text for text in (system, instruction) if text)
+        if system:
+            payload["system"] = system
         
         return payload
     
+    def supports_json_schema(self, model: str) -> bool:
+        """Anthropic has no structured outputs: a json_schema response_format
+        is only ever asked for in the system prompt."""
+        return False
+
     def supports_streaming(self) -> bool:
         """Anthropic supports streaming."""
         return True
@@ -62,11 +106,11 @@ class AnthropicAdapter(LLMAdapter):
         """Stream chat completion from Anthropic.
         
         Anthropic uses SSE format with event types:
-        - message_start: Initial message metadata
+        - message_start: Initial message metadata (input token usage)
         - content_block_start: Start of content block
         - content_block_delta: Delta text chunks
         - content_block_stop: End of content block
-        - message_delta: Message-level deltas (usage, etc.)
+        - message_delta: Message-level deltas (output token usage, etc.)
         - message_stop: End of message
         """
         url = f"{base_url.rstrip('/')}{api_path}"
@@ -114,18 +158,21 @@ class AnthropicAdapter(LLMAdapter):
                                     }]
                                 }
                         
-                        # Yield message_delta for usage information
-                        elif current_event_type == "message_delta":
-                            usage = chunk_data.get("usage", {})
-                            if usage:
-                                # Yield usage in OpenAI-like format
-                                yield {
-                                    "_usage_only": True,
-                                    "usage": {
-                                        "prompt_tokens": usage.get("input_tokens", 0),
-                                        "completion_tokens": usage.get("output_tokens", 0),
-                                    }
-                                }
+                        # Yield the usage of message_start (input tokens) and
+                        # message_delta (output tokens so far), in OpenAI-like
+                        # format with only the counts the event carries
+                        elif current_event_type in ("message_start", "message_delta"):
+                            if current_event_type == "message_start":
+                                usage = chunk_data.get("message", {}).get("usage") or {}
+                            else:
+                                usage = chunk_data.get("usage") or {}
+                            counts = {}
+                            if "input_tokens" in usage:
+                                counts["prompt_tokens"] = usage["input_tokens"]
+                            if current_event_type == "message_delta" and "output_tokens" in usage:
+                                counts["completion_tokens"] = usage["output_tokens"]
+                            if counts:
+                                yield {"_usage_only": True, "usage": counts}
                         
                         # Yield message_stop for finish reason
                         elif current_event_type == "message_stop":
@@ -151,14 +198,37 @@ class AnthropicAdapter(LLMAdapter):
         
         # Anthropic returns content as list of blocks
         text_content = ""
+        tool_calls = []
         for block in content:
             if block.get("type") == "text":
                 text_content += block.get("text", "")
+            elif block.get("type") == "tool_use":
+                tool_calls.append({
+                    "id": block.get("id", ""),
+                    "type": "function",
+                    "function": {
+                        "name": block.get("name", ""),
+                        "arguments": json.dumps(block.get("input") or {}),
+                    },
+                })
         
-        return {
+        stop_reason = response.get("stop_reason") or "end_turn"
+        result = {
             "content": text_content,
             "role": "assistant",
-            "finish_reason": response.get("stop_reason", "stop"),
+            "finish_reason": FINISH_REASONS.get(stop_reason, stop_reason),
+            "provider_meta": provider_meta(response, ["id", "model", "stop_reason", "stop_sequence"]),
+        }
+        if tool_calls:
+            result["tool_calls"] = tool_calls
+        return result
+    
+    def parse_usage(self, response: Dict[str, Any]) -> Dict[str, int]:
+        """Anthropic reports input_tokens and output_tokens."""
+        usage = response.get("usage") or {}
+        return {
+            "prompt_tokens": usage.get("input_tokens", 0),
+            "completion_tokens": usage.get("output_tokens", 0),
         }
     
     def get_cost_usd(
@@ -176,3 +246,124 @@ class AnthropicAdapter(LLMAdapter):
         completion_cost = (completion_tokens / 1_000_000) * pricing["completion"]
         return prompt_cost + completion_cost
 
+
+
+def _anthropic_content(parts: List[Dict[str, Any]]) -> List[Dict[str, Any]]:
+    """Translate OpenAI content parts to Anthropic text and image blocks."""
+    blocks: List[Dict[str, Any]] = []
+    for part in parts:
+        if part.get("type") != "image_url":
+            blocks.append(part)
+            continue
+        url = part["image_url"]["url"]
+        data_url = parse_data_url(url)
+        if data_url:
+            source = {"type": "base64", "media_type": data_url[0], "data": data_url[1]}
+        else:
+            source = {"type": "url", "url": url}
+        blocks.append({"type": "image", "source": source})
+    return blocks
+
+
+def _anthropic_messages(messages: List[Dict[str, Any]]) -> List[Dict[str, Any]]:
+    """Translate OpenAI-style tool calls, tool results and image parts to
+    Anthropic blocks.
+
+    Other messages are passed as they are. Consecutive tool results go in
+    one user message, as Anthropic expects for parallel calls.
+    """
+    out: List[Dict[str, Any]] = []
+    for msg in messages:
+        if isinstance(msg.get("content"), list):
+            out.append({**msg, "content": _anthropic_content(msg["content"])})
+        elif msg.get("role") == "assistant" and msg.get("tool_calls"):
+            blocks: List[Dict[str, Any]] = []
+            if msg.get("content"):
+                blocks.append({"type": "text", "text": msg["content"]})
+            for call in msg["tool_calls"]:
+                function = call.get("function") or {}
+                arguments = function.get("arguments") or "{}"
+                blocks.append({
+                    "type": "tool_use",
+                    "id": call.get("id", ""),
+                    "name": function.get("name", ""),
+                    "input": json.loads(arguments) if isinstance(arguments, str) else arguments,
+                })
+            out.append({"role": "assistant", "content": blocks})
+        elif msg.get("role") == "tool":
+            result = {
+                "type": "tool_result",
+                "tool_use_id": msg.get("tool_call_id", ""),
+                "content": msg.get("content", ""),
+            }
+            previous = out[-1] if out else None
+            if previous and previous["role"] == "user" and isinstance(previous["content"], list) and all(
+                block.get("type") == "tool_result" for block in previous["content"]
+            ):
+                previous["content"].append(result)
+            else:
+                out.append({"role": "user", "content": [result]})
+        else:
+            out.append(msg)
+    return out
+
+
+def _alternate(
+    messages: List[Dict[str, Any]], conversation: List[Tuple[int, Dict[str, Any]]]
+) -> List[Dict[str, Any]]:
+    """Merge consecutive Anthropic messages of one role into one.
+
+    conversation is the request's non-system messages with their indexes,
+    to name the offending one when the conversation doesn't start with the
+    user.
+    """
+    if not messages:
+        raise TranslationError("messages", "Anthropic needs at least one user message besides system messages")
+    if messages[0]["role"] != "user":
+        raise TranslationError(
+            f"messages[{conversation[0][0]}]", "Anthropic conversations must start with a user message"
+        )
+    out: List[Dict[str, Any]] = []
+    for msg in messages:
+        if out and out[-1]["role"] == msg["role"]:
+            out[-1] = {**out[-1], "content": _blocks(out[-1]["content"]) + _blocks(msg["content"])}
+        else:
+            out.append(msg)
+    return out
+
+
+def _blocks(content: Any) -> List[Dict[str, Any]]:
+    """Anthropic message content as a list of blocks."""
+    if isinstance(content, list):
+        return content
+    return [{"type": "text", "text": content or ""}]
+
+
+def _anthropic_tool_choice(tool_choice: Any, tools: Optional[List[Dict[str, Any]]]) -> Dict[str, Any]:
+    """Translate an OpenAI tool_choice to Anthropic's."""
+    if tool_choice == "none":
+        return {"type": "none"}
+    if not tools:
+        raise TranslationError("tool_choice", "Anthropic needs tools for any tool_choice but \"none\"")
+    if isinstance(tool_choice, dict):
+        name = (tool_choice.get("function") or {}).get("name")
+        if name not in {tool["function"]["name"] for tool in tools}:
+            raise TranslationError("tool_choice.function.name", f"no tool named {name!r} is offered")
+        return {"type": "tool", "name": name}
+    choices = {"auto": "auto", "required": "any"}
+    if tool_choice not in choices:
+        raise TranslationError(
+            "tool_choice", f"Anthropic supports \"none\", \"auto\", \"required\" or a function, not {tool_choice!r}"
+        )
+    return {"type": choices[tool_choice]}
+
+
+def _format_instruction(response_format: Optional[Dict[str, Any]]) -> Optional[str]:
+    """Describe an OpenAI response_format as a system instruction."""
+    if not response_format or response_format.get("type") == "text":
+        return None
+    instruction = "Respond with a single JSON object and nothing else: no prose, no code fences."
+    if response_format.get("type") == "json_schema":
+        schema = (response_format.get("json_schema") or {}).get("schema", {})
+        instruction += f" The object must match this JSON Schema: {json.dumps(schema, sort_keys=True)}"
+    return instruction
@@ -0,0 +1,87 @@
+"""Azure OpenAI LLM adapter."""
+from typing import Any, Dict, List, Optional
+from urllib.parse import quote
+
+from reliapi.adapters.llm.base import TranslationError
+from reliapi.adapters.llm.openai import OpenAIAdapter
+
+
+class UnknownDeploymentError(TranslationError):
+    """A model an Azure OpenAI target has no deployment for. deployments
+    lists the models that have one."""
+
+    def __init__(self, model: str, deployments: List[str]):
+        available = ", ".join(deployments) or "none"
+        super().__init__("model", f"no Azure OpenAI deployment for model '{model}' (deployments: {available})")
+        self.model = model
+        self.deployments = deployments
+
+
+class AzureOpenAIAdapter(OpenAIAdapter):
+    """Azure OpenAI API adapter.
+
+    Requests and responses are OpenAI's, except that the model is chosen by
+    the deployment in the URL (see azure_api_path) rather than by the body.
+    A completion Azure's content filter stopped has finish_reason
+    "content_filter" and a null content, normalized to "".
+    """
+
+    # Pricing per 1M tokens, global standard deployments (as of 2024)
+    PRICING = {
+        "gpt-4": {"prompt": 30.0, "completion": 60.0},
+        "gpt-4-turbo": {"prompt": 10.0, "completion": 30.0},
+        "gpt-4o": {"prompt": 2.5, "completion": 10.0},
+        "gpt-4o-mini": {"prompt": 0.15, "completion": 0.6},
+        "gpt-35-turbo": {"prompt": 0.5, "completion": 1.5},
+        "gpt-3.5-turbo": {"prompt": 0.5, "completion": 1.5},
+    }
+
+    def prepare_request(
+        self,
+        messages: List[Dict[str, str]],
+        model: str,
+        max_tokens: Optional[int] = None,
+        temperature: Optional[float] = None,
+        top_p: Optional[float] = None,
+        stop: Optional[List[str]] = None,
+        stream: bool = False,
+        tools: Optional[List[Dict[str, Any]]] = None,
+        tool_choice: Optional[Any] = None,
+        response_format: Optional[Dict[str, Any]] = None,
+        **kwargs,
+    ) -> Dict[str, Any]:
+        """Prepare an OpenAI payload without its model, which the deployment picks."""
+        payload = super().prepare_request(
+            messages, model, max_tokens, temperature, top_p, stop, stream, tools, tool_choice, response_format, **kwargs
+        )
+        del payload["model"]
+        return payload
+
+    def prepare_embeddings_request(
+        self,
+        inputs: List[str],
+        model: str,
+        dimensions: Optional[int] = None,
+        input_type: Optional[str] = None,
+    ) -> Dict[str, Any]:
+        """Prepare an OpenAI embeddings payload without its model."""
+        payload = super().prepare_embeddings_request(inputs, model, dimensions, input_type)
+        del payload["model"]
+        return payload
+
+
+def azure_deployment(llm_config: Dict[str, Any], model: str) -> str:
+    """The deployment serving model on an Azure OpenAI target (its
+    llm.azure.deployments), or UnknownDeploymentError."""
+    deployments = (llm_config.get("azure") or {}).get("deployments") or {}
+    deployment = deployments.get(model)
+    if not deployment:
+        raise UnknownDeploymentError(model, sorted(deployments))
+    return deployment
+
+
+def azure_api_path(llm_config: Dict[str, Any], deployment: str, operation: str = "chat/completions") -> str:
+    """The path of operation on deployment, api-version included, under an
+    Azure OpenAI resource endpoint such as https://myres.openai.azure.com."""
+    api_version = (llm_config.get("azure") or {}).get("api_version", "")
+    return f"/openai/deployments/{quote(deployment, safe='')}/{operation}?api-version={quote(api_version, safe='')}"
@@ -1,10 +1,56 @@
 """Base LLM adapter interface."""
+import json
 from abc import ABC, abstractmethod
-from typing import Any, AsyncIterator, Dict, List, Optional
+from typing import Any, AsyncIterator, Dict, List, Optional, Tuple
+
+
+class TranslationError(ValueError):
+    """A request the adapter can't express in its provider's format.
+
+    field is the path of the offending request field, e.g. "tool_choice"
+    or "messages[2].content".
+    """
+
+    def __init__(self, field: str, message: str):
+        super().__init__(f"{field}: {message}")
+        self.field = field
+
+
+class UnsupportedParameterError(TranslationError):
+    """A request parameter the provider takes but the requested model
+    doesn't, such as a json_schema response_format on a model without
+    structured outputs."""
+
+    def __init__(self, field: str, model: str, message: str):
+        super().__init__(field, message)
+        self.model = model
+
+
+class ModelLimitsError(TranslationError):
+    """A request outside what its model accepts, such as a max_tokens over
+    its output limit (see core.model_capabilities). issues lists each
+    offending field with its message and allowed range."""
+
+    def __init__(self, model: str, issues: List[Dict[str, Any]]):
+        super().__init__(issues[0]["field"], "; ".join(issue["message"] for issue in issues))
+        self.model = model
+        self.issues = issues
 
 
 class LLMAdapter(ABC):
     """Base class for LLM provider adapters."""
+
+    # Whether the provider stops billing a request the proxy cancels, such as
+    # the losing backup of a hedged request. None of the supported providers
+    # promise that for non-streaming calls.
+    BILLS_CANCELED_REQUESTS = True
+
+    # Whether the provider returns token logprobs for the logprobs and
+    # top_logprobs of prepare_request
+    RETURNS_LOGPROBS = False
+
+    # Fields of which every successful completion response has one
+    RESPONSE_FIELDS: Tuple[str, ...] = ("choices",)
     
     @abstractmethod
     def prepare_request(
@@ -16,9 +62,18 @@ class LLMAdapter(ABC):
         top_p: Optional[float] = None,
         stop: Optional[List[str]] = None,
         stream: bool = False,
+        tools: Optional[List[Dict[str, Any]]] = None,
+        tool_choice: Optional[Any] = None,
+        response_format: Optional[Dict[str, Any]] = None,
         **kwargs,
     ) -> Dict[str, Any]:
-        """Prepare provider-specific request payload."""
+        """Prepare provider-specific request payload.
+
+        messages, tools, tool_choice and response_format are in OpenAI's
+        format (see app/schemas.py LLMProxyRequest); adapters translate them
+        for their provider, and raise TranslationError for what it can't
+        express.
+        """
         pass
     
     @abstractmethod
@@ -29,13 +84,36 @@ class LLMAdapter(ABC):
         {
             "content": str,           # Text content (required)
             "role": str,              # "assistant" (required, default "assistant")
-            "finish_reason": str,     # "stop", "length", "error", etc. (required)
+            "finish_reason": str,     # OpenAI's "stop", "length", "tool_calls",
+                                      # "content_filter", or "error" (required)
+            "tool_calls": list,       # Function calls as OpenAI tool_calls, with
+                                      # arguments a JSON string (only when the
+                                      # model made any)
+            "provider_meta": dict,    # Provider metadata such as id and served
+                                      # model snapshot (optional, see provider_meta)
         }
         
         All adapters must return the same structure for consistency.
         """
         pass
+
+    def parse_usage(self, response: Dict[str, Any]) -> Dict[str, int]:
+        """Return the prompt_tokens and completion_tokens of a completion
+        response (OpenAI format by default)."""
+        usage = response.get("usage") or {}
+        return {
+            "prompt_tokens": usage.get("prompt_tokens", 0),
+            "completion_tokens": usage.get("completion_tokens", 0),
+        }
     
+    def supports_json_schema(self, model: str) -> bool:
+        """Whether model constrains its output to a json_schema response_format.
+
+        Override in subclasses whose provider, or some of its models, lack
+        structured outputs.
+        """
+        return True
+
     @abstractmethod
     def get_cost_usd(
         self,
@@ -71,3 +149,150 @@ class LLMAdapter(ABC):
         """
         raise NotImplementedError("Streaming not supported for this provider")
 
+    # Embedding model pricing per 1M input tokens
+    EMBEDDING_PRICING: Dict[str, float] = {}
+
+    def supports_embeddings(self) -> bool:
+        """Check if adapter supports embeddings.
+
+        Override in subclasses whose provider has an embeddings endpoint.
+        """
+        return False
+
+    def prepare_embeddings_request(
+        self,
+        inputs: List[str],
+        model: str,
+        dimensions: Optional[int] = None,
+        input_type: Optional[str] = None,
+    ) -> Dict[str, Any]:
+        """Prepare an embeddings request payload.
+
+        The default is the OpenAI format, which Mistral shares. OpenAI and
+        Mistral models embed queries and documents alike, so input_type is
+        ignored. Raises ValueError for options the provider does not support.
+        """
+        payload: Dict[str, Any] = {"model": model, "input": inputs, "encoding_format": "float"}
+        if dimensions is not None:
+            payload["dimensions"] = dimensions
+        return payload
+
+    def parse_embeddings_response(self, response: Dict[str, Any]) -> Dict[str, Any]:
+        """Parse an embeddings response (OpenAI format by default).
+
+        Returns {"embeddings": [vector per input, in input order],
+        "prompt_tokens": int}.
+        """
+        items = sorted(response.get("data", []), key=lambda item: item.get("index", 0))
+        return {
+            "embeddings": [item["embedding"] for item in items],
+            "prompt_tokens": response.get("usage", {}).get("prompt_tokens", 0),
+        }
+
+    def get_embedding_cost_usd(self, model: str, tokens: int) -> Optional[float]:
+        """Calculate the cost of embedding tokens input tokens, if priced."""
+        price = self.EMBEDDING_PRICING.get(model)
+        if price is None:
+            return None
+        return (tokens / 1_000_000) * price
+
+
+def normalize_tool_calls(tool_calls: Optional[List[Dict[str, Any]]]) -> List[Dict[str, Any]]:
+    """Normalize OpenAI-style tool calls, encoding object arguments as JSON.
+
+    Mistral may return arguments as an object where OpenAI sends a string.
+    """
+    normalized = []
+    for call in tool_calls or []:
+        function = call.get("function") or {}
+        arguments = function.get("arguments")
+        if not isinstance(arguments, str):
+            arguments = json.dumps(arguments if arguments is not None else {})
+        normalized.append({
+            "id": call.get("id", ""),
+            "type": call.get("type", "function"),
+            "function": {"name": function.get("name", ""), "arguments": arguments},
+        })
+    return normalized
+
+
+def normalize_logprobs(logprobs: Optional[Dict[str, Any]]) -> List[Dict[str, Any]]:
+    """The token logprobs of an OpenAI choice or stream chunk as a list of
+    {token, logprob, top_logprobs}, without the tokens' bytes."""
+    normalized = []
+    for entry in (logprobs or {}).get("content") or []:
+        token = {"token": entry.get("token", ""), "logprob": entry.get("logprob", 0.0)}
+        top = entry.get("top_logprobs")
+        if top:
+            token["top_logprobs"] = [{"token": t.get("token", ""), "logprob": t.get("logprob", 0.0)} for t in top]
+        normalized.append(token)
+    return normalized
+
+
+def json_mode_shim(
+    messages: List[Dict[str, Any]], response_format: Dict[str, Any]
+) -> Tuple[List[Dict[str, Any]], Dict[str, Any]]:
+    """Ask for a json_schema response_format in JSON mode instead, for
+    models without structured outputs: a json_object response_format, with
+    the schema as a system instruction after the leading system messages.
+
+    The model is asked for the schema, not constrained to it; validate the
+    output (output_schema) where it matters.
+    """
+    schema = (response_format.get("json_schema") or {}).get("schema", {})
+    instruction = {
+        "role": "system",
+        "content": f"Respond with a JSON object matching this JSON Schema: {json.dumps(schema, sort_keys=True)}",
+    }
+    index = 0
+    while index < len(messages) and messages[index].get("role") == "system":
+        index += 1
+    return messages[:index] + [instruction] + messages[index:], {"type": "json_object"}
+
+
+def parse_data_url(url: str) -> Optional[Tuple[str, str]]:
+    """Split a base64 data URL into its media type and base64 data.
+
+    Returns None for other URLs.
+    """
+    if not url.startswith("data:"):
+        return None
+    media_type, sep, data = url[len("data:"):].partition(";base64,")
+    if not sep:
+        return None
+    return media_type, data
+
+
+def provider_meta(response: Dict[str, Any], fields: List[str]) -> Dict[str, Any]:
+    """Pick provider metadata fields (id, served model, ...) from a raw response.
+
+    Fields that are absent or null are left out, so clients can tell "not
+    reported" from an empty value.
+    """
+    return {name: response[name] for name in fields if response.get(name) is not None}
+
+
+def split_system(
+    messages: List[Dict[str, Any]], provider: str
+) -> Tuple[Optional[str], List[Tuple[int, Dict[str, Any]]]]:
+    """Split OpenAI-style messages into the text of their system messages,
+    for providers that take it outside the conversation, and the rest with
+    their indexes in messages.
+
+    System messages are joined in order wherever they appear. Raises
+    TranslationError for a system message with other than text parts.
+    """
+    system: List[str] = []
+    conversation: List[Tuple[int, Dict[str, Any]]] = []
+    for index, msg in enumerate(messages):
+        if msg.get("role") != "system":
+            conversation.append((index, msg))
+            continue
+        content = msg.get("content") or ""
+        if isinstance(content, list):
+            if any(part.get("type") != "text" for part in content):
+                raise TranslationError(f"messages[{index}].content", f"{provider} system prompts take text only")
+            content = "".join(part.get("text", "") for part in content)
+        if content:
+            system.append(content)
+    return "\n\n".join(system) or None, conversation
@@ -2,7 +2,9 @@
 from typing import Optional
 
 from reliapi.adapters.llm.anthropic import AnthropicAdapter
+from reliapi.adapters.llm.azure_openai import AzureOpenAIAdapter
 from reliapi.adapters.llm.base import LLMAdapter
+from reliapi.adapters.llm.gemini import GeminiAdapter
 from reliapi.adapters.llm.mistral import MistralAdapter
 from reliapi.adapters.llm.openai import OpenAIAdapter
 
@@ -13,6 +15,8 @@ def get_adapter(provider: str) -> Optional[LLMAdapter]:
         "openai": OpenAIAdapter(),
         "anthropic": AnthropicAdapter(),
         "mistral": MistralAdapter(),
+        "gemini": GeminiAdapter(),
+        "azure_openai": AzureOpenAIAdapter(),
     }
     return adapters.get(provider.lower())
 
@@ -20,11 +24,15 @@ def get_adapter(provider: str) -> Optional[LLMAdapter]:
 def detect_provider(base_url: str) -> Optional[str]:
     """Detect provider from base URL."""
     base_url_lower = base_url.lower()
-    if "openai.com" in base_url_lower:
+    if "openai.azure.com" in base_url_lower:
+        return "azure_openai"
+    elif "openai.com" in base_url_lower:
         return "openai"
     elif "anthropic.com" in base_url_lower:
         return "anthropic"
     elif "mistral.ai" in base_url_lower:
         return "mistral"
+    elif "generativelanguage.googleapis.com" in base_url_lower:
+        return "gemini"
     return None
 
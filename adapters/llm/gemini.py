@@ -0,0 +1,277 @@
+"""Google Gemini LLM adapter."""
+import json
+from typing import Any, Dict, List, Optional, Tuple
+
+from reliapi.adapters.llm.base import LLMAdapter, TranslationError, parse_data_url, split_system
+
+# Gemini finishReason values as OpenAI finish_reason
+FINISH_REASONS = {
+    "STOP": "stop",
+    "MAX_TOKENS": "length",
+    "SAFETY": "content_filter",
+    "RECITATION": "content_filter",
+    "BLOCKLIST": "content_filter",
+    "PROHIBITED_CONTENT": "content_filter",
+    "SPII": "content_filter",
+}
+
+# Gemini takes at most this many stop sequences
+MAX_STOP_SEQUENCES = 5
+
+
+class GeminiAdapter(LLMAdapter):
+    """Google Gemini generateContent API adapter.
+
+    The model is part of the path (see services._llm_api_path), not the
+    payload.
+    """
+
+    # Pricing per 1M tokens (prompts up to 128K tokens, as of 2025)
+    PRICING = {
+        "gemini-1.5-pro": {"prompt": 1.25, "completion": 5.0},
+        "gemini-1.5-flash": {"prompt": 0.075, "completion": 0.3},
+        "gemini-2.0-flash": {"prompt": 0.1, "completion": 0.4},
+    }
+
+    # A prompt Gemini blocked only has promptFeedback
+    RESPONSE_FIELDS = ("candidates", "promptFeedback")
+
+    def prepare_request(
+        self,
+        messages: List[Dict[str, str]],
+        model: str,
+        max_tokens: Optional[int] = None,
+        temperature: Optional[float] = None,
+        top_p: Optional[float] = None,
+        stop: Optional[List[str]] = None,
+        stream: bool = False,
+        tools: Optional[List[Dict[str, Any]]] = None,
+        tool_choice: Optional[Any] = None,
+        response_format: Optional[Dict[str, Any]] = None,
+        **kwargs,
+    ) -> Dict[str, Any]:
+        """Prepare Gemini request payload.
+
+        System messages become systemInstruction, assistant turns the model
+        role, tool calls and tool messages functionCall and functionResponse
+        parts, and sampling parameters generationConfig. Consecutive
+        messages of one role are merged into one turn.
+        """
+        system, conversation = split_system(messages, "Gemini")
+        payload: Dict[str, Any] = {"contents": _gemini_contents(conversation)}
+        if system:
+            payload["systemInstruction"] = {"parts": [{"text": system}]}
+
+        config: Dict[str, Any] = {}
+        if max_tokens is not None:
+            config["maxOutputTokens"] = max_tokens
+        if temperature is not None:
+            config["temperature"] = temperature
+        if top_p is not None:
+            config["topP"] = top_p
+        if stop is not None:
+            if len(stop) > MAX_STOP_SEQUENCES:
+                raise TranslationError("stop", f"Gemini takes at most {MAX_STOP_SEQUENCES} stop sequences")
+            config["stopSequences"] = stop
+        if response_format and response_format.get("type") != "text":
+            config["responseMimeType"] = "application/json"
+            if response_format.get("type") == "json_schema":
+                # responseJsonSchema takes JSON Schema as is, where
+                # responseSchema only takes Gemini's OpenAPI subset
+                config["responseJsonSchema"] = (response_format.get("json_schema") or {}).get("schema", {})
+        if config:
+            payload["generationConfig"] = config
+
+        if tools:
+            declarations = []
+            for tool in tools:
+                function = tool["function"]
+                declaration = {"name": function["name"]}
+                if function.get("description"):
+                    declaration["description"] = function["description"]
+                if function.get("parameters"):
+                    declaration["parameters"] = function["parameters"]
+                declarations.append(declaration)
+            payload["tools"] = [{"functionDeclarations": declarations}]
+        if tool_choice is not None:
+            payload["toolConfig"] = {"functionCallingConfig": _gemini_tool_choice(tool_choice, tools)}
+        return payload
+
+    def parse_response(self, response: Dict[str, Any]) -> Dict[str, Any]:
+        """Parse Gemini response to normalized format.
+
+        A prompt Gemini blocked has no candidates and finishes with
+        content_filter. Function calls have no ID unless Gemini gives one, so
+        they are numbered.
+        """
+        meta = {
+            name: response[field]
+            for name, field in (("id", "responseId"), ("model", "modelVersion"))
+            if response.get(field) is not None
+        }
+        candidates = response.get("candidates") or []
+        if not candidates:
+            block_reason = (response.get("promptFeedback") or {}).get("blockReason")
+            if block_reason:
+                meta["block_reason"] = block_reason
+            return {
+                "content": "",
+                "role": "assistant",
+                "finish_reason": "content_filter" if block_reason else "error",
+                "provider_meta": meta,
+            }
+
+        candidate = candidates[0]
+        text_content = ""
+        tool_calls = []
+        for part in (candidate.get("content") or {}).get("parts") or []:
+            if "text" in part and not part.get("thought"):
+                text_content += part["text"]
+            elif "functionCall" in part:
+                call = part["functionCall"]
+                tool_calls.append({
+                    "id": call.get("id") or f"call_{len(tool_calls)}",
+                    "type": "function",
+                    "function": {"name": call.get("name", ""), "arguments": json.dumps(call.get("args") or {})},
+                })
+
+        reason = candidate.get("finishReason") or "STOP"
+        meta["finishReason"] = reason
+        for field in ("safetyRatings", "citationMetadata"):
+            if candidate.get(field) is not None:
+                meta[field] = candidate[field]
+        finish_reason = FINISH_REASONS.get(reason, reason.lower())
+        if tool_calls and finish_reason == "stop":
+            finish_reason = "tool_calls"
+        result = {
+            "content": text_content,
+            "role": "assistant",
+            "finish_reason": finish_reason,
+            "provider_meta": meta,
+        }
+        if tool_calls:
+            result["tool_calls"] = tool_calls
+        return result
+
+    def parse_usage(self, response: Dict[str, Any]) -> Dict[str, int]:
+        """Gemini reports usageMetadata token counts."""
+        usage = response.get("usageMetadata") or {}
+        return {
+            "prompt_tokens": usage.get("promptTokenCount", 0),
+            "completion_tokens": usage.get("candidatesTokenCount", 0),
+        }
+
+    def get_cost_usd(
+        self,
+        model: str,
+        prompt_tokens: int,
+        completion_tokens: int,
+    ) -> Optional[float]:
+        """Calculate cost in USD."""
+        pricing = self.PRICING.get(model)
+        if not pricing:
+            return None
+
+        prompt_cost = (prompt_tokens / 1_000_000) * pricing["prompt"]
+        completion_cost = (completion_tokens / 1_000_000) * pricing["completion"]
+        return prompt_cost + completion_cost
+
+
+def _gemini_parts(content: Any, index: int) -> List[Dict[str, Any]]:
+    """Translate OpenAI message content to Gemini text and inlineData parts.
+
+    Gemini only fetches images it hosts, so other image URLs must be sent
+    as data URLs.
+    """
+    if not isinstance(content, list):
+        return [{"text": content}] if content else []
+    parts: List[Dict[str, Any]] = []
+    for position, part in enumerate(content):
+        if part.get("type") == "text":
+            parts.append({"text": part.get("text", "")})
+            continue
+        field = f"messages[{index}].content[{position}]"
+        if part.get("type") != "image_url":
+            raise TranslationError(f"{field}.type", f"Gemini doesn't take {part.get('type')!r} parts")
+        data_url = parse_data_url(part["image_url"]["url"])
+        if not data_url:
+            raise TranslationError(f"{field}.image_url.url", "Gemini takes images as base64 data URLs only")
+        parts.append({"inlineData": {"mimeType": data_url[0], "data": data_url[1]}})
+    return parts
+
+
+def _gemini_contents(conversation: List[Tuple[int, Dict[str, Any]]]) -> List[Dict[str, Any]]:
+    """Translate OpenAI-style messages, with their request indexes, to
+    Gemini contents.
+
+    Tool results are matched to the call they answer by tool_call_id, as
+    Gemini's functionResponse names the function instead.
+    """
+    if not conversation:
+        raise TranslationError("messages", "Gemini needs at least one message besides system messages")
+    call_names: Dict[str, str] = {}
+    contents: List[Dict[str, Any]] = []
+    for index, msg in conversation:
+        role = msg.get("role")
+        if role == "assistant":
+            turn_role = "model"
+            parts = _gemini_parts(msg.get("content"), index)
+            for call in msg.get("tool_calls") or []:
+                function = call.get("function") or {}
+                arguments = function.get("arguments") or "{}"
+                call_names[call.get("id", "")] = function.get("name", "")
+                parts.append({
+                    "functionCall": {
+                        "name": function.get("name", ""),
+                        "args": json.loads(arguments) if isinstance(arguments, str) else arguments,
+                    }
+                })
+        elif role == "tool":
+            turn_role = "user"
+            name = call_names.get(msg.get("tool_call_id", ""))
+            if name is None:
+                raise TranslationError(
+                    f"messages[{index}].tool_call_id", "doesn't match a tool call of an earlier assistant message"
+                )
+            parts = [{"functionResponse": {"name": name, "response": _tool_response(msg.get("content"))}}]
+        elif role == "user":
+            turn_role = "user"
+            parts = _gemini_parts(msg.get("content"), index)
+        else:
+            raise TranslationError(f"messages[{index}].role", f"Gemini doesn't take {role!r} messages")
+        if contents and contents[-1]["role"] == turn_role:
+            contents[-1]["parts"].extend(parts)
+        else:
+            contents.append({"role": turn_role, "parts": parts})
+    return contents
+
+
+def _tool_response(content: Any) -> Dict[str, Any]:
+    """A tool message's content as the object functionResponse takes."""
+    if isinstance(content, str):
+        try:
+            decoded = json.loads(content)
+        except ValueError:
+            decoded = None
+        if isinstance(decoded, dict):
+            return decoded
+    return {"content": content}
+
+
+def _gemini_tool_choice(tool_choice: Any, tools: Optional[List[Dict[str, Any]]]) -> Dict[str, Any]:
+    """Translate an OpenAI tool_choice to Gemini's functionCallingConfig."""
+    if tool_choice == "none":
+        return {"mode": "NONE"}
+    if not tools:
+        raise TranslationError("tool_choice", "Gemini needs tools for any tool_choice but \"none\"")
+    if isinstance(tool_choice, dict):
+        name = (tool_choice.get("function") or {}).get("name")
+        if name not in {tool["function"]["name"] for tool in tools}:
+            raise TranslationError("tool_choice.function.name", f"no tool named {name!r} is offered")
+        return {"mode": "ANY", "allowedFunctionNames": [name]}
+    modes = {"auto": "AUTO", "required": "ANY"}
+    if tool_choice not in modes:
+        raise TranslationError(
+            "tool_choice", f"Gemini supports \"none\", \"auto\", \"required\" or a function, not {tool_choice!r}"
+        )
+    return {"mode": modes[tool_choice]}
@@ -4,7 +4,7 @@ from typing import Any, AsyncIterator, Dict, List, Optional
 
 import httpx
 
-from reliapi.adapters.llm.base import LLMAdapter
+from reliapi.adapters.llm.base import LLMAdapter, normalize_tool_calls, provider_meta
 
 
 class MistralAdapter(LLMAdapter):
@@ -16,6 +16,10 @@ class MistralAdapter(LLMAdapter):
         "mistral-medium-latest": {"prompt": 2.7, "completion": 8.1},
         "mistral-small-latest": {"prompt": 0.2, "completion": 0.6},
     }
+    # Embedding pricing per 1M input tokens
+    EMBEDDING_PRICING = {
+        "mistral-embed": 0.1,
+    }
     
     def prepare_request(
         self,
@@ -26,12 +30,18 @@ class MistralAdapter(LLMAdapter):
         top_p: Optional[float] = None,
         stop: Optional[List[str]] = None,
         stream: bool = False,
+        tools: Optional[List[Dict[str, Any]]] = None,
+        tool_choice: Optional[Any] = None,
+        response_format: Optional[Dict[str, Any]] = None,
         **kwargs,
     ) -> Dict[str, Any]:
-        """Prepare Mistral request payload."""
+        """Prepare Mistral request payload.
+
+        Image parts carry their URL as a plain string, as Mistral expects.
+        """
         payload = {
             "model": model,
-            "messages": messages,
+            "messages": [_mistral_message(msg) for msg in messages],
         }
         
         if max_tokens is not None:
@@ -44,6 +54,13 @@ class MistralAdapter(LLMAdapter):
             payload["stop"] = stop
         if stream:
             payload["stream"] = True
+        if tools:
+            payload["tools"] = tools
+        if tool_choice is not None:
+            # Mistral calls "required" "any"
+            payload["tool_choice"] = "any" if tool_choice == "required" else tool_choice
+        if response_format is not None:
+            payload["response_format"] = response_format
         
         return payload
     
@@ -124,11 +141,16 @@ class MistralAdapter(LLMAdapter):
         choice = choices[0]
         message = choice.get("message", {})
         
-        return {
-            "content": message.get("content", ""),
+        result = {
+            "content": message.get("content") or "",
             "role": message.get("role", "assistant"),
             "finish_reason": choice.get("finish_reason", "stop"),
+            "provider_meta": provider_meta(response, ["id", "model"]),
         }
+        tool_calls = normalize_tool_calls(message.get("tool_calls"))
+        if tool_calls:
+            result["tool_calls"] = tool_calls
+        return result
     
     def get_cost_usd(
         self,
@@ -145,3 +167,30 @@ class MistralAdapter(LLMAdapter):
         completion_cost = (completion_tokens / 1_000_000) * pricing["completion"]
         return prompt_cost + completion_cost
 
+    def supports_embeddings(self) -> bool:
+        """Mistral serves /embeddings."""
+        return True
+
+    def prepare_embeddings_request(
+        self,
+        inputs: List[str],
+        model: str,
+        dimensions: Optional[int] = None,
+        input_type: Optional[str] = None,
+    ) -> Dict[str, Any]:
+        """Mistral embeddings have a fixed size."""
+        if dimensions is not None:
+            raise ValueError("Mistral embeddings do not support dimensions")
+        return super().prepare_embeddings_request(inputs, model, input_type=input_type)
+
+
+def _mistral_message(msg: Dict[str, Any]) -> Dict[str, Any]:
+    """Flatten OpenAI image_url objects in a message to Mistral's URL strings."""
+    content = msg.get("content")
+    if not isinstance(content, list):
+        return msg
+    parts = [
+        {"type": "image_url", "image_url": part["image_url"]["url"]} if part.get("type") == "image_url" else part
+        for part in content
+    ]
+    return {**msg, "content": parts}
@@ -4,7 +4,7 @@ from typing import Any, AsyncIterator, Dict, List, Optional
 
 import httpx
 
-from reliapi.adapters.llm.base import LLMAdapter
+from reliapi.adapters.llm.base import LLMAdapter, normalize_logprobs, normalize_tool_calls, provider_meta
 
 
 class OpenAIAdapter(LLMAdapter):
@@ -18,6 +18,17 @@ class OpenAIAdapter(LLMAdapter):
         "gpt-4o-mini": {"prompt": 0.15, "completion": 0.6},
         "gpt-3.5-turbo": {"prompt": 0.5, "completion": 1.5},
     }
+    # Prefixes of the models older than structured outputs, besides gpt-4
+    # itself; later ones, and unknown models such as those of
+    # OpenAI-compatible servers, are assumed to have them
+    NO_JSON_SCHEMA_PREFIXES = ("gpt-3.5-", "gpt-4-", "gpt-4o-2024-05-13", "o1-preview", "o1-mini")
+    RETURNS_LOGPROBS = True
+    # Embedding pricing per 1M input tokens
+    EMBEDDING_PRICING = {
+        "text-embedding-3-small": 0.02,
+        "text-embedding-3-large": 0.13,
+        "text-embedding-ada-002": 0.10,
+    }
     
     def prepare_request(
         self,
@@ -28,6 +39,9 @@ class OpenAIAdapter(LLMAdapter):
         top_p: Optional[float] = None,
         stop: Optional[List[str]] = None,
         stream: bool = False,
+        tools: Optional[List[Dict[str, Any]]] = None,
+        tool_choice: Optional[Any] = None,
+        response_format: Optional[Dict[str, Any]] = None,
         **kwargs,
     ) -> Dict[str, Any]:
         """Prepare OpenAI request payload."""
@@ -46,9 +60,25 @@ class OpenAIAdapter(LLMAdapter):
             payload["stop"] = stop
         if stream:
             payload["stream"] = True
+            # Ask for the final usage frame, so streams are billed exactly
+            payload["stream_options"] = {"include_usage": True}
+        if tools:
+            payload["tools"] = tools
+        if tool_choice is not None:
+            payload["tool_choice"] = tool_choice
+        if response_format is not None:
+            payload["response_format"] = response_format
+        if kwargs.get("logprobs"):
+            payload["logprobs"] = True
+            if kwargs.get("top_logprobs") is not None:
+                payload["top_logprobs"] = kwargs["top_logprobs"]
         
         return payload
     
+    def supports_json_schema(self, model: str) -> bool:
+        """Structured outputs came with gpt-4o-2024-08-06."""
+        return model != "gpt-4" and not model.startswith(self.NO_JSON_SCHEMA_PREFIXES)
+
     def supports_streaming(self) -> bool:
         """OpenAI supports streaming."""
         return True
@@ -124,11 +154,19 @@ class OpenAIAdapter(LLMAdapter):
         choice = choices[0]
         message = choice.get("message", {})
         
-        return {
-            "content": message.get("content", ""),
+        result = {
+            "content": message.get("content") or "",
             "role": message.get("role", "assistant"),
             "finish_reason": choice.get("finish_reason", "stop"),
+            "provider_meta": provider_meta(response, ["id", "model", "system_fingerprint"]),
         }
+        tool_calls = normalize_tool_calls(message.get("tool_calls"))
+        if tool_calls:
+            result["tool_calls"] = tool_calls
+        logprobs = normalize_logprobs(choice.get("logprobs"))
+        if logprobs:
+            result["logprobs"] = logprobs
+        return result
     
     def get_cost_usd(
         self,
@@ -145,3 +183,7 @@ class OpenAIAdapter(LLMAdapter):
         completion_cost = (completion_tokens / 1_000_000) * pricing["completion"]
         return prompt_cost + completion_cost
 
+    def supports_embeddings(self) -> bool:
+        """OpenAI serves /embeddings."""
+        return True
+
@@ -7,21 +7,29 @@ This module contains:
 - Configuration initialization
 """
 import hashlib
+import hmac
 import logging
 import os
 from dataclasses import dataclass, field
+from datetime import timezone
 from typing import Any, Dict, List, Optional, Tuple
 
 from fastapi import HTTPException, Request
 
 from reliapi.config.loader import ConfigLoader
-from reliapi.core.cache import Cache
+from reliapi.core.budget_alerts import DEFAULT_THRESHOLDS, BudgetAlertConfig
+from reliapi.core.cache import Cache, CacheTier
 from reliapi.core.client_profile import ClientProfile, ClientProfileManager
+from reliapi.core.conversations import ConversationStore
 from reliapi.core.errors import ErrorCode
 from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.jobs import JobStore
+from reliapi.core.key_limits import KeyLimits
 from reliapi.core.key_pool import KeyPoolManager, ProviderKey
+from reliapi.core.maintenance import MaintenanceMode
 from reliapi.core.rate_limiter import RateLimiter
 from reliapi.core.rate_scheduler import RateScheduler
+from reliapi.core.request_signing import DEFAULT_MAX_SKEW_S, RequestVerifier
 from reliapi.integrations.rapidapi import RapidAPIClient
 from reliapi.integrations.rapidapi_tenant import RapidAPITenantManager
 from reliapi.metrics.prometheus import rapidapi_tier_cache_total
@@ -51,6 +59,11 @@ class AppState:
     client_profile_manager: Optional[ClientProfileManager] = None
     rapidapi_client: Optional[RapidAPIClient] = None
     rapidapi_tenant_manager: Optional[RapidAPITenantManager] = None
+    jobs: Optional[JobStore] = None
+    conversations: Optional[ConversationStore] = None
+    request_verifier: Optional[RequestVerifier] = None
+    compression_dictionaries: Dict[str, bytes] = field(default_factory=dict)
+    maintenance: Optional[MaintenanceMode] = None
 
 
 # Global application state instance
@@ -215,6 +228,61 @@ def verify_api_key(request: Request) -> Tuple[Optional[str], Optional[str], str]
     return api_key, None, tier
 
 
+def is_admin_key(request: Request) -> bool:
+    """Whether X-API-Key is the admin key (RELIAPI_ADMIN_KEY)."""
+    api_key = request.headers.get("X-API-Key")
+    admin_key = os.getenv("RELIAPI_ADMIN_KEY")
+    return bool(api_key and admin_key and hmac.compare_digest(api_key, admin_key))
+
+
+def verify_admin_key(request: Request) -> str:
+    """Verify that the request carries the admin API key.
+
+    The admin key is configured with the RELIAPI_ADMIN_KEY environment
+    variable. If it is unset, admin operations are disabled.
+
+    Returns:
+        The admin API key.
+
+    Raises:
+        HTTPException: 401 if X-API-Key is missing, 403 if it is not the admin key.
+    """
+    api_key = request.headers.get("X-API-Key")
+    if not api_key:
+        raise HTTPException(
+            status_code=401,
+            detail={
+                "success": False,
+                "error": {
+                    "type": "client_error",
+                    "code": ErrorCode.UNAUTHORIZED.value,
+                    "message": "Missing X-API-Key header",
+                    "retryable": False,
+                    "target": None,
+                    "status_code": 401,
+                },
+            },
+        )
+
+    admin_key = os.getenv("RELIAPI_ADMIN_KEY")
+    if not admin_key or not hmac.compare_digest(api_key, admin_key):
+        raise HTTPException(
+            status_code=403,
+            detail={
+                "success": False,
+                "error": {
+                    "type": "client_error",
+                    "code": ErrorCode.FORBIDDEN.value,
+                    "message": "Admin API key required",
+                    "retryable": False,
+                    "target": None,
+                    "status_code": 403,
+                },
+            },
+        )
+    return api_key
+
+
 def detect_client_profile(
     request: Request,
     tenant: Optional[str] = None
@@ -250,6 +318,87 @@ def detect_client_profile(
     return "default"
 
 
+def get_budget_cap(tenant: Optional[str] = None) -> Optional[float]:
+    """Get the monthly LLM budget cap that applies to a tenant.
+
+    Args:
+        tenant: Tenant name, or None for requests outside multi-tenant mode
+
+    Returns:
+        Cap in USD, or None if no budget is configured
+    """
+    state = get_app_state()
+    if not state.config_loader:
+        return None
+    return state.config_loader.get_monthly_budget_usd(tenant)
+
+
+def get_latency_route(name: str) -> Optional[Dict[str, Any]]:
+    """Get the latency route an auto:<name> target names.
+
+    Args:
+        name: Route name, without the auto: prefix
+
+    Returns:
+        The route's config, or None if no route has that name
+    """
+    state = get_app_state()
+    if not state.config_loader:
+        return None
+    return (state.config_loader.get_latency_routes() or {}).get(name)
+
+
+def get_key_limits(api_key: Optional[str]) -> Optional[KeyLimits]:
+    """Get the budget and rate limit configured for an API key.
+
+    Args:
+        api_key: The caller's X-API-Key
+
+    Returns:
+        The key's limits, or None if it has no api_keys entry
+    """
+    state = get_app_state()
+    if not state.config_loader:
+        return None
+    found = state.config_loader.get_api_key_limits(api_key)
+    if not found:
+        return None
+    name, key_config = found
+    return KeyLimits(
+        name=name,
+        monthly_budget_usd=key_config.get("monthly_budget_usd"),
+        rate_limit_rpm=key_config.get("rate_limit_rpm"),
+        alert_thresholds=tuple(key_config["alert_thresholds"]) if key_config.get("alert_thresholds") else None,
+        test=bool(key_config.get("test")),
+        faults=key_config.get("faults"),
+    )
+
+
+def get_budget_alerts() -> BudgetAlertConfig:
+    """Get the budget alert thresholds and where alerts are delivered.
+
+    Returns:
+        The budget_alerts config, or the default thresholds without delivery
+    """
+    state = get_app_state()
+    alerts = (state.config_loader.get_budget_alerts() if state.config_loader else None) or {}
+    webhook_url = alerts.get("webhook_url")
+    return BudgetAlertConfig(
+        thresholds=tuple(alerts.get("thresholds") or DEFAULT_THRESHOLDS),
+        webhook_url=webhook_url,
+        webhook_secret=get_webhook_secret() if webhook_url else None,
+    )
+
+
+def get_webhook_secret() -> Optional[str]:
+    """Get the secret webhooks are signed with, from RELIAPI_WEBHOOK_SECRET.
+
+    Returns:
+        The secret, or None if webhooks are not configured
+    """
+    return os.getenv("RELIAPI_WEBHOOK_SECRET") or None
+
+
 def get_account_id(api_key: Optional[str]) -> str:
     """Generate account ID from API key hash.
 
@@ -418,6 +567,97 @@ def init_client_profile_manager(config_loader: ConfigLoader) -> ClientProfileMan
     return ClientProfileManager(profiles)
 
 
+def init_request_verifier(config_loader: ConfigLoader) -> Optional[RequestVerifier]:
+    """Initialize the RequestVerifier of signed requests from configuration.
+
+    Args:
+        config_loader: Configuration loader
+
+    Returns:
+        RequestVerifier, or None if request signing is not configured
+    """
+    signing_config = config_loader.get_request_signing()
+    if not signing_config:
+        return None
+
+    def resolve(value: str) -> Optional[str]:
+        return os.getenv(value[4:]) if value.startswith("env:") else value
+
+    keys: Dict[str, Tuple[str, str]] = {}
+    for key_id, key_config in (signing_config.get("keys") or {}).items():
+        secret = resolve(key_config.get("secret", ""))
+        api_key = resolve(key_config.get("api_key", ""))
+        if not secret or not api_key:
+            logger.debug(f"Skipping signing key {key_id}: secret or api_key not set")
+            continue
+        keys[key_id] = (secret, api_key)
+
+    return RequestVerifier(keys, signing_config.get("max_skew_s", DEFAULT_MAX_SKEW_S))
+
+
+def init_maintenance(config_loader: ConfigLoader) -> Optional[MaintenanceMode]:
+    """Initialize maintenance mode from configuration.
+
+    Args:
+        config_loader: Configuration loader
+
+    Returns:
+        MaintenanceMode, or None unless maintenance is enabled
+    """
+    maintenance_config = config_loader.get_maintenance() or {}
+    if not maintenance_config.get("enabled"):
+        return None
+    defaults = MaintenanceMode()
+    return MaintenanceMode(
+        read_only=bool(maintenance_config.get("read_only", False)),
+        retry_after_s=int(maintenance_config.get("retry_after_s", defaults.retry_after_s)),
+        message=maintenance_config.get("message") or defaults.message,
+    )
+
+
+def init_compression_dictionaries(config_loader: ConfigLoader) -> Dict[str, bytes]:
+    """Load the zstd dictionaries of compressed request bodies from configuration.
+
+    Args:
+        config_loader: Configuration loader
+
+    Returns:
+        Dictionary contents by id; empty if compression is not configured
+    """
+    compression_config = config_loader.get_compression() or {}
+    dictionaries: Dict[str, bytes] = {}
+    for dict_id, path in (compression_config.get("dictionaries") or {}).items():
+        try:
+            with open(path, "rb") as f:
+                dictionaries[dict_id] = f.read()
+        except OSError as e:
+            logger.warning(f"Skipping compression dictionary {dict_id}: {e}")
+    return dictionaries
+
+
+def init_cache(redis_url: str, config_loader: ConfigLoader) -> Cache:
+    """Initialize the response cache, reading legacy LLM cache keys until
+    cache_keys.legacy_read_until (naive times are UTC), with the tiers of
+    cache_storage.
+
+    Args:
+        redis_url: Redis connection URL
+        config_loader: Configuration loader
+    """
+    legacy_read_until = (config_loader.get_cache_keys() or {}).get("legacy_read_until")
+    if legacy_read_until is not None and legacy_read_until.tzinfo is None:
+        legacy_read_until = legacy_read_until.replace(tzinfo=timezone.utc)
+    storage = config_loader.get_cache_storage() or {}
+    large = storage.get("large")
+    return Cache(
+        redis_url,
+        key_prefix="reliapi",
+        legacy_keys_until=legacy_read_until.timestamp() if legacy_read_until else None,
+        hot_tier=CacheTier(**(storage.get("hot") or {})),
+        large_tier=CacheTier(**large) if large is not None else None,
+    )
+
+
 def init_key_pool_manager(config_loader: ConfigLoader) -> Optional[KeyPoolManager]:
     """Initialize KeyPoolManager from configuration.
 
@@ -2,16 +2,18 @@
 
 This is the main application module that:
 - Initializes the FastAPI application
-- Configures middleware (CORS, exception handling)
+- Configures middleware (CORS, trace context, compression, exception handling)
 - Registers all route handlers
+- Serves the checked-in OpenAPI document at /openapi.json
 - Manages application lifespan (startup/shutdown)
 """
 import logging
 import os
 import traceback
 from contextlib import asynccontextmanager
-from typing import List
+from typing import Any, Dict, List
 
+import yaml
 from fastapi import FastAPI, Request, status
 from fastapi.middleware.cors import CORSMiddleware
 from fastapi.responses import JSONResponse
@@ -19,15 +21,27 @@ from fastapi.responses import JSONResponse
 from reliapi.app.dependencies import (
     ConfigValidationError,
     get_app_state,
+    init_cache,
     init_client_profile_manager,
+    init_compression_dictionaries,
+    init_maintenance,
     init_key_pool_manager,
+    init_request_verifier,
     validate_startup_config,
 )
+from reliapi.app.services import set_max_tag_values
 from reliapi.config.loader import ConfigLoader
-from reliapi.core.cache import Cache
+from reliapi.core.conversations import ConversationStore
 from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.jobs import JobStore
 from reliapi.core.rate_limiter import RateLimiter
 from reliapi.core.rate_scheduler import RateScheduler
+from reliapi.core.target_registry import stamp_versions
+from reliapi.core.usage import DEFAULT_MAX_TAG_VALUES
+from reliapi.core.compression import CompressionMiddleware
+from reliapi.core.maintenance import MaintenanceMiddleware
+from reliapi.core.request_signing import RequestSigningMiddleware
+from reliapi.core.tracing import TraceContextMiddleware
 from reliapi.integrations.rapidapi import RapidAPIClient
 from reliapi.integrations.rapidapi_tenant import RapidAPITenantManager
 
@@ -62,7 +76,7 @@ async def lifespan(app: FastAPI):
     logger.info(f"Loading configuration from {config_path}")
     state.config_loader = ConfigLoader(config_path)
     state.config_loader.load()
-    state.targets = state.config_loader.get_targets()
+    state.targets = stamp_versions(state.config_loader.get_targets())
 
     # Validate configuration (fail fast on invalid config)
     strict_validation = os.getenv("RELIAPI_STRICT_CONFIG", "true").lower() == "true"
@@ -79,9 +93,14 @@ async def lifespan(app: FastAPI):
         raise
 
     logger.info(f"Initializing Redis connection: {redis_url}")
-    state.cache = Cache(redis_url, key_prefix="reliapi")
+    state.cache = init_cache(redis_url, state.config_loader)
     state.idempotency = IdempotencyManager(redis_url, key_prefix="reliapi")
     state.rate_limiter = RateLimiter(redis_url, key_prefix="reliapi")
+    state.jobs = JobStore(state.cache.client, key_prefix="reliapi")
+    state.conversations = ConversationStore(
+        state.cache.client, key_prefix="reliapi", **(state.config_loader.get_conversations() or {})
+    )
+    set_max_tag_values((state.config_loader.get_usage() or {}).get("max_tag_values", DEFAULT_MAX_TAG_VALUES))
 
     # Initialize RapidAPI client
     state.rapidapi_client = RapidAPIClient(
@@ -114,6 +133,21 @@ async def lifespan(app: FastAPI):
     await state.rate_scheduler.start_cleanup_task()
     logger.info("Rate scheduler initialized with memory management")
 
+    # Initialize verification of signed requests
+    state.request_verifier = init_request_verifier(state.config_loader)
+    if state.request_verifier:
+        logger.info(f"Request signing enabled with {len(state.request_verifier.keys)} keys")
+
+    # Maintenance mode, for upgrades (see core/maintenance.py)
+    state.maintenance = init_maintenance(state.config_loader)
+    if state.maintenance:
+        logger.warning(f"Maintenance mode enabled (read_only={state.maintenance.read_only})")
+
+    # Load zstd dictionaries of compressed request bodies
+    state.compression_dictionaries = init_compression_dictionaries(state.config_loader)
+    if state.compression_dictionaries:
+        logger.info(f"Loaded {len(state.compression_dictionaries)} compression dictionaries")
+
     # Initialize client profile manager
     state.client_profile_manager = init_client_profile_manager(state.config_loader)
     logger.info("Client profile manager initialized")
@@ -151,15 +185,55 @@ def create_app() -> FastAPI:
     # Configure CORS middleware
     _configure_cors(app)
 
+    # Make incoming traceparent/tracestate available for upstream forwarding
+    app.add_middleware(TraceContextMiddleware)
+
+    # Refuse requests during maintenance (see core/maintenance.py)
+    app.add_middleware(MaintenanceMiddleware, get_mode=lambda: get_app_state().maintenance)
+
+    # Decode gzip/zstd request bodies and gzip responses (see core/compression.py)
+    app.add_middleware(
+        CompressionMiddleware, get_dictionaries=lambda: get_app_state().compression_dictionaries
+    )
+
+    # Verify HMAC-signed requests over the body as sent, so outermost
+    # (see core/request_signing.py)
+    app.add_middleware(RequestSigningMiddleware, get_verifier=lambda: get_app_state().request_verifier)
+
     # Register exception handlers
     _register_exception_handlers(app)
 
     # Register routes
     _register_routes(app)
 
+    _configure_openapi(app)
+
     return app
 
 
+OPENAPI_SPEC_PATH = os.path.join(os.path.dirname(os.path.dirname(os.path.abspath(__file__))), "openapi", "openapi.yaml")
+
+
+def load_openapi_spec(path: str = OPENAPI_SPEC_PATH) -> Dict[str, Any]:
+    """Load the OpenAPI document clients are generated from."""
+    with open(path) as f:
+        return yaml.safe_load(f)
+
+
+def _configure_openapi(app: FastAPI) -> None:
+    """Serve openapi/openapi.yaml at /openapi.json instead of the generated
+    schema, so the document the Go wire types are generated from is the one
+    the proxy publishes. tests/test_openapi.py keeps it in step with the
+    request and response models."""
+
+    def openapi() -> Dict[str, Any]:
+        if app.openapi_schema is None:
+            app.openapi_schema = load_openapi_spec()
+        return app.openapi_schema
+
+    app.openapi = openapi
+
+
 def _configure_cors(app: FastAPI) -> None:
     """Configure CORS middleware with production security."""
     cors_origins_env = os.getenv("CORS_ORIGINS", "*")
@@ -192,7 +266,7 @@ def _configure_cors(app: FastAPI) -> None:
         allow_credentials=True,
         allow_methods=["*"],
         allow_headers=["*"],
-        expose_headers=["X-Request-ID", "X-RateLimit-Remaining", "X-RateLimit-Reset"],
+        expose_headers=["X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"],
     )
 
 
@@ -265,13 +339,37 @@ def _register_exception_handlers(app: FastAPI) -> None:
 def _register_routes(app: FastAPI) -> None:
     """Register all route handlers."""
     # Import and register core routes
-    from reliapi.app.routes import health, proxy, rapidapi
+    from reliapi.app.routes import (
+        audit,
+        budget,
+        cache,
+        conversations,
+        events,
+        health,
+        jobs,
+        proxy,
+        rapidapi,
+        replay,
+        targets,
+        templates,
+        usage,
+    )
 
     app.include_router(health.router)
     
     # v1 API routes (canonical)
     app.include_router(proxy.router, prefix="/v1")
     app.include_router(rapidapi.router, prefix="/v1")
+    app.include_router(cache.router, prefix="/v1")
+    app.include_router(targets.router, prefix="/v1")
+    app.include_router(budget.router, prefix="/v1")
+    app.include_router(jobs.router, prefix="/v1")
+    app.include_router(conversations.router, prefix="/v1")
+    app.include_router(usage.router, prefix="/v1")
+    app.include_router(audit.router, prefix="/v1")
+    app.include_router(replay.router, prefix="/v1")
+    app.include_router(templates.router, prefix="/v1")
+    app.include_router(events.router, prefix="/v1")
     
     # Legacy routes (deprecated - will be removed in 6 months)
     app.include_router(proxy.router, deprecated=True, tags=["Legacy"])
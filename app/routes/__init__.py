@@ -5,6 +5,7 @@ This package contains all route handlers organized by domain:
 Core routes:
 - health: Health check and monitoring endpoints
 - proxy: HTTP and LLM proxy endpoints
+- cache: Cache invalidation endpoints
 - rapidapi: RapidAPI integration endpoints
 
 Business routes:
@@ -14,6 +15,6 @@ Business routes:
 - calculators: ROI/pricing calculators
 - dashboard: Admin dashboard
 """
-from reliapi.app.routes import health, proxy, rapidapi
+from reliapi.app.routes import cache, health, proxy, rapidapi
 
-__all__ = ["health", "proxy", "rapidapi"]
+__all__ = ["cache", "health", "proxy", "rapidapi"]
@@ -0,0 +1,122 @@
+"""Audit record endpoints.
+
+This module provides:
+- GET /audit/{request_id} - Audit record of one proxied request
+- GET /audit - Audit records of the caller's tenant in a time range, paginated
+"""
+import time
+import uuid
+from datetime import datetime, timezone
+from typing import Optional, Tuple
+
+from fastapi import APIRouter, HTTPException, Query, Request
+from fastapi.responses import JSONResponse
+
+from reliapi.app.dependencies import is_admin_key, verify_api_key
+from reliapi.app.schemas import MetaResponse, SuccessResponse
+from reliapi.app.services import AUDIT_MAX_PAGE_SIZE, AUDIT_PAGE_SIZE, audit_record, audit_search
+from reliapi.core.audit import RETENTION
+from reliapi.core.errors import ErrorCode
+
+router = APIRouter(tags=["Audit"])
+
+
+def _client_error(status_code: int, code: ErrorCode, message: str) -> HTTPException:
+    return HTTPException(
+        status_code=status_code,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": code.value,
+                "message": message,
+                "retryable": False,
+                "status_code": status_code,
+            },
+        },
+    )
+
+
+def _caller(http_request: Request) -> Tuple[Optional[str], bool]:
+    """Tenant of the caller and whether it holds the admin key, which sees
+    every tenant's records with their bodies."""
+    if is_admin_key(http_request):
+        return None, True
+    _, tenant, _ = verify_api_key(http_request)
+    return tenant, False
+
+
+def _as_utc(moment: datetime) -> datetime:
+    return moment.replace(tzinfo=timezone.utc) if moment.tzinfo is None else moment
+
+
+def _respond(data: dict, start_time: float) -> JSONResponse:
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+    result = SuccessResponse(
+        success=True,
+        data=data,
+        meta=MetaResponse(
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+@router.get(
+    "/audit/{request_id}",
+    summary="Get the audit record of a request",
+    description=(
+        "Return what was recorded for a proxied request, by the request_id of its response: "
+        "who called, the target, the outcome and every upstream attempt with its URL, status "
+        "and timing. Under a target's audit capture 'full' the attempts also carry the "
+        "request and response bodies, cut to max_body_bytes and redacted with the target's "
+        "redaction patterns; bodies are only returned to the admin key. Records are kept for "
+        "7 days per ReliAPI instance; streamed responses are not recorded."
+    ),
+)
+async def get_audit_record(request_id: str, http_request: Request) -> JSONResponse:
+    """Audit record of one request."""
+    start_time = time.time()
+    tenant, admin = _caller(http_request)
+    record = audit_record(request_id, tenant, admin)
+    if record is None:
+        raise _client_error(404, ErrorCode.NOT_FOUND, f"No audit record for request '{request_id}'")
+    return _respond(record, start_time)
+
+
+@router.get(
+    "/audit",
+    summary="Search audit records",
+    description=(
+        "List the audit records of the caller's tenant created between from and to "
+        "(default: the last 7 days), oldest first, optionally only those of one target. "
+        "The admin key searches every tenant and sees captured bodies. Pass next_cursor "
+        "back as cursor, with the same query, for the next page."
+    ),
+)
+async def search_audit_records(
+    http_request: Request,
+    from_: Optional[datetime] = Query(None, alias="from"),
+    to: Optional[datetime] = Query(None),
+    target: Optional[str] = Query(None),
+    limit: int = Query(AUDIT_PAGE_SIZE, ge=1, le=AUDIT_MAX_PAGE_SIZE),
+    cursor: Optional[str] = Query(None),
+) -> JSONResponse:
+    """Audit records of the caller's tenant."""
+    start_time = time.time()
+    tenant, admin = _caller(http_request)
+
+    now = datetime.now(timezone.utc)
+    start = _as_utc(from_) if from_ else now - RETENTION
+    end = _as_utc(to) if to else now
+    if end <= start:
+        raise _client_error(400, ErrorCode.BAD_REQUEST, "'to' must be after 'from'")
+    try:
+        page = audit_search(tenant, start, end, target, limit, cursor, admin)
+    except ValueError as e:
+        raise _client_error(400, ErrorCode.BAD_REQUEST, str(e))
+    return _respond(page, start_time)
@@ -0,0 +1,154 @@
+"""Budget and cost estimation endpoints.
+
+This module provides:
+- GET /budget - LLM spend of the caller's tenant this month against its cap
+- GET /budget/alerts - Budget thresholds the caller's tenant and API key crossed this month
+- POST /estimate - Estimated tokens and cost of an LLM request, without sending it
+"""
+import time
+import uuid
+
+from fastapi import APIRouter, HTTPException, Request
+from fastapi.responses import JSONResponse
+
+from reliapi.adapters.llm.base import TranslationError
+from reliapi.app.dependencies import get_app_state, get_budget_cap, get_key_limits, verify_api_key
+from reliapi.app.routes.conversations import conversation_messages
+from reliapi.app.routes.templates import apply_template
+from reliapi.app.schemas import LLMProxyRequest, MetaResponse, SuccessResponse
+from reliapi.app.services import budget_alerts, budget_status, estimate_llm_cost
+from reliapi.core.errors import ErrorCode
+
+router = APIRouter(tags=["Budget"])
+
+
+@router.get(
+    "/budget",
+    summary="Get the caller's LLM budget",
+    description=(
+        "Report the LLM spend of the caller's tenant in the current calendar month (UTC), "
+        "the monthly_budget_usd cap and what remains of it, and when spend resets. "
+        "cap_usd and remaining_usd are null when no monthly budget is configured. "
+        "reserved_usd is the estimated cost held by requests in flight, which requests are checked "
+        "against too; overshoots counts the requests that cost more than their estimate reserved, "
+        "and overshoot_usd the excess. Spend is tracked per ReliAPI instance."
+    ),
+)
+async def get_budget(http_request: Request) -> JSONResponse:
+    """Monthly budget status of the caller's tenant."""
+    start_time = time.time()
+    _, tenant, _ = verify_api_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    result = SuccessResponse(
+        success=True,
+        data=budget_status(tenant, get_budget_cap(tenant)),
+        meta=MetaResponse(
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+@router.get(
+    "/budget/alerts",
+    summary="List the caller's budget alerts",
+    description=(
+        "List the budget alerts that fired this calendar month (UTC) for the caller's tenant "
+        "budget and its API key's budget, oldest first. An alert fires once per month when "
+        "spend crosses one of the budget_alerts thresholds, and reports the spend, the cap and "
+        "the spend projected for the end of the month at the trailing 7-day run rate. The "
+        "same payload is delivered to budget_alerts.webhook_url as a budget.threshold_reached "
+        "event. Alerts are kept per ReliAPI instance."
+    ),
+)
+async def get_budget_alerts(http_request: Request) -> JSONResponse:
+    """This month's budget alerts of the caller."""
+    start_time = time.time()
+    api_key, tenant, _ = verify_api_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    result = SuccessResponse(
+        success=True,
+        data={"alerts": budget_alerts(tenant, get_key_limits(api_key))},
+        meta=MetaResponse(
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+def _client_error(status_code: int, code: ErrorCode, message: str, target: str) -> HTTPException:
+    return HTTPException(
+        status_code=status_code,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": code.value,
+                "message": message,
+                "retryable": False,
+                "target": target,
+                "status_code": status_code,
+            },
+        },
+    )
+
+
+@router.post(
+    "/estimate",
+    summary="Estimate the cost of an LLM request",
+    description=(
+        "Take a /proxy/llm request body and return its approximate prompt tokens, the "
+        "max_tokens it would be sent with, and the cost range per the target's pricing: "
+        "from the prompt alone (cost_min_usd) to the prompt plus every completion token "
+        "(cost_max_usd). cost_estimate_usd is the figure hard caps, max_cost_usd and the "
+        "monthly budget are checked against. Nothing is sent upstream."
+    ),
+)
+async def post_estimate(request: LLMProxyRequest, http_request: Request) -> JSONResponse:
+    """Cost estimate of an LLM request."""
+    start_time = time.time()
+    _, tenant, _ = verify_api_key(http_request)
+    apply_template(request)
+    conversation_messages(request, tenant)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    target_config = get_app_state().targets.get(request.target)
+    if not target_config:
+        raise _client_error(404, ErrorCode.NOT_FOUND, f"Target '{request.target}' not found", request.target)
+    if not target_config.get("llm"):
+        raise _client_error(
+            400, ErrorCode.INVALID_TARGET, f"Target '{request.target}' is not configured for LLM", request.target
+        )
+
+    try:
+        estimate = estimate_llm_cost(
+            request.target, target_config, request.messages, request.model, request.max_tokens
+        )
+    except TranslationError as e:
+        raise _client_error(400, ErrorCode.BAD_REQUEST, str(e), request.target)
+    result = SuccessResponse(
+        success=True,
+        data=estimate,
+        meta=MetaResponse(
+            target=request.target,
+            provider=estimate["provider"],
+            model=estimate["model"],
+            cost_estimate_usd=estimate["cost_estimate_usd"],
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
@@ -0,0 +1,508 @@
+"""Cache management endpoints.
+
+This module provides:
+- DELETE /cache - Remove a single cached response
+- DELETE /cache/targets/{target} - Purge every cached response of a target (admin)
+- GET /cache/stats - Entries, bytes and evictions of each cache tier (admin)
+- GET /cache/hot - The caller's most used cache entries, with the requests to replay them
+- POST /cache/warm - Precompute a list of requests into the cache in the background
+- GET /cache/warm/{job_id} - Progress and per-item outcome of a cache warming job
+"""
+import hashlib
+import json
+import logging
+import time
+import uuid
+from typing import Any, Dict, Optional
+
+from fastapi import APIRouter, HTTPException, Query, Request
+from fastapi.responses import JSONResponse
+
+from reliapi.app.dependencies import (
+    detect_client_profile,
+    get_app_state,
+    get_budget_alerts,
+    get_budget_cap,
+    get_key_limits,
+    verify_admin_key,
+    verify_api_key,
+)
+from reliapi.app.routes.proxy import (
+    _check_api_key_format,
+    _cached_filter,
+    _check_credential,
+    _check_key_rate_limit,
+    _check_llm_free_tier_restrictions,
+    _check_response_filter,
+    _rate_limit_headers,
+    _resolve_alias,
+)
+from reliapi.app.routes.templates import apply_template
+from reliapi.app.schemas import (
+    CacheInvalidateRequest,
+    CacheWarmRequest,
+    HTTPProxyRequest,
+    LLMProxyRequest,
+    MetaResponse,
+    SuccessResponse,
+)
+from reliapi.app.services import resolve_http_cache_key, resolve_llm_cache_key, submit_cache_warm
+from reliapi.core.cache import HOT_KEYS_MAX
+from reliapi.core.errors import ErrorCode
+from reliapi.core.jobs import public_warm_job
+
+logger = logging.getLogger(__name__)
+
+router = APIRouter(tags=["Cache"])
+
+
+@router.delete(
+    "/cache",
+    summary="Invalidate a cached response",
+    description=(
+        "Remove one cached response, identified by the cache key from a previous "
+        "response's meta.cache_key or by the original request body. "
+        "Only entries of the caller's tenant are affected."
+    ),
+)
+async def invalidate_cache(
+    request: CacheInvalidateRequest,
+    http_request: Request,
+) -> JSONResponse:
+    """Remove a single cache entry."""
+    state = get_app_state()
+    start_time = time.time()
+
+    # Verify API key and resolve tenant/tier
+    api_key, tenant, _ = verify_api_key(http_request)
+    key_limits = get_key_limits(api_key)
+
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    target = None
+    cache_key = request.cache_key
+    legacy_key = None
+    if request.http is not None:
+        target = request.http.target
+        cache_key = resolve_http_cache_key(
+            target_name=request.http.target,
+            method=request.http.method,
+            path=request.http.path,
+            headers=request.http.headers,
+            query=request.http.query,
+            body=request.http.body,
+            targets=state.targets,
+            cache_key=request.http.cache_key,
+            cache_vary=request.http.cache_vary,
+            cached_filter=_cached_filter(request.http),
+            raw_passthrough=request.http.raw_passthrough,
+            key_id=key_limits.name if key_limits else None,
+            tenant=tenant,
+        )
+    elif request.llm is not None:
+        target = request.llm.target
+        llm_key_args = dict(
+            target_name=request.llm.target,
+            messages=request.llm.messages,
+            model=request.llm.model,
+            max_tokens=request.llm.max_tokens,
+            temperature=request.llm.temperature,
+            top_p=request.llm.top_p,
+            stop=request.llm.stop,
+            targets=state.targets,
+            cache_key=request.llm.cache_key,
+            cache_vary=request.llm.cache_vary,
+            **request.llm.tool_args(),
+            **request.llm.logprobs_args(),
+            output_schema=request.llm.output_args()["output_schema"],
+            cached_filter=_cached_filter(request.llm),
+            raw_passthrough=request.llm.raw_passthrough,
+            strict=request.llm.strict,
+        )
+        cache_key = resolve_llm_cache_key(**llm_key_args)
+        # An entry cached before canonical keys may still be served
+        legacy_key = resolve_llm_cache_key(**llm_key_args, legacy=True)
+
+    removed = 0
+    if cache_key and state.cache:
+        removed = state.cache.delete_key(cache_key, tenant=tenant, legacy_key_hash=legacy_key)
+
+    result = SuccessResponse(
+        success=True,
+        data={"removed": removed, "cache_key": cache_key},
+        meta=MetaResponse(
+            target=target,
+            cache_key=cache_key,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+@router.delete(
+    "/cache/targets/{target}",
+    summary="Purge a target's cache",
+    description=(
+        "Remove every cached response of a target across all tenants. "
+        "Requires the admin API key (RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def invalidate_target_cache(
+    target: str,
+    http_request: Request,
+) -> JSONResponse:
+    """Purge all cache entries of a target."""
+    state = get_app_state()
+    start_time = time.time()
+
+    verify_admin_key(http_request)
+
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    removed = state.cache.invalidate_target(target) if state.cache else 0
+    logger.info(f"Cache purge: target={target}, removed={removed}, request_id={request_id}")
+
+    result = SuccessResponse(
+        success=True,
+        data={"removed": removed},
+        meta=MetaResponse(
+            target=target,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+@router.get(
+    "/cache/stats",
+    summary="Get cache statistics",
+    description=(
+        "Report, per cache tier, the entries and bytes cached, the entries admitted and the tier's "
+        "bounds, with evictions by cause: max_entries or max_bytes of the tier, target_max_entries "
+        "of a target's cache.max_entries, and expired. rejected.too_large counts responses no tier "
+        "admitted. Counts cover all tenants and every ReliAPI instance sharing the Redis. "
+        "Requires the admin API key (RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def get_cache_stats(http_request: Request) -> JSONResponse:
+    """Statistics of the cache tiers."""
+    state = get_app_state()
+    start_time = time.time()
+
+    verify_admin_key(http_request)
+
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+    if state.cache:
+        stats = state.cache.stats()
+    else:
+        stats = {"enabled": False, "tiers": {}, "evictions": {}, "rejected": {}}
+
+    result = SuccessResponse(
+        success=True,
+        data=stats,
+        meta=MetaResponse(
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+@router.get(
+    "/cache/hot",
+    summary="List the most used cache entries",
+    description=(
+        "List the caller's most used cache entries, most used first, each with its cache key, "
+        "kind (http or llm), the request body it answers, its use count and its cached size "
+        "in bytes. Replaying a request with cache_mode only_if_cached returns the entry without "
+        "calling the upstream, which is how clients warm a local cache on startup. Uses are "
+        "counted for the most used keys of each tenant only, and entries no longer cached are "
+        "left out. Only entries of the caller's tenant are listed."
+    ),
+)
+async def get_hot_keys(
+    http_request: Request,
+    limit: int = Query(100, ge=1, le=HOT_KEYS_MAX, description="Most entries to list"),
+) -> JSONResponse:
+    """The tenant's most used cache entries."""
+    state = get_app_state()
+    start_time = time.time()
+
+    _, tenant, _ = verify_api_key(http_request)
+
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+    items = state.cache.hot_keys(limit, tenant=tenant) if state.cache else []
+
+    result = SuccessResponse(
+        success=True,
+        data={"items": items},
+        meta=MetaResponse(
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+def _warm_http_args(request: HTTPProxyRequest) -> Dict[str, Any]:
+    """handle_http_proxy arguments of a warmed /proxy/http body, as proxy_http passes them."""
+    return dict(
+        cache_mode=request.cache_mode.value,
+        target_name=request.target,
+        method=request.method,
+        path=request.path,
+        headers=request.headers,
+        query=request.query,
+        body=request.body,
+        body_encoding=request.body_encoding,
+        response_headers=request.response_headers,
+        if_none_match=request.if_none_match,
+        follow_redirects=request.follow_redirects,
+        max_redirects=request.max_redirects,
+        timeout_ms=request.timeout_ms,
+        idempotency_key=request.idempotency_key,
+        idempotency_ttl_s=request.idempotency_ttl_s,
+        max_response_bytes=request.max_response_bytes,
+        truncate_response=request.truncate_response,
+        cached_filter=_cached_filter(request),
+        raw_passthrough=request.raw_passthrough,
+        cache_ttl=request.cache,
+        cache_key=request.cache_key,
+        cache_vary=request.cache_vary,
+        retry=request.retry.model_dump() if request.retry else None,
+    )
+
+
+def _warm_llm_args(request: LLMProxyRequest, targets: Dict[str, Dict]) -> Dict[str, Any]:
+    """handle_llm_proxy_with_fallbacks arguments of a warmed /proxy/llm body,
+    as proxy_llm passes them, at batch priority."""
+    alias = _resolve_alias(request.target, request.model, targets, request.idempotency_key)
+    return dict(
+        cache_mode=request.cache_mode.value,
+        fallbacks=[f.model_dump() for f in request.fallbacks or []],
+        fallback_response=request.fallback_response.model_dump() if request.fallback_response else None,
+        target_name=alias.target if alias else request.target,
+        messages=request.messages,
+        model=alias.model if alias else request.model,
+        max_tokens=request.max_tokens,
+        temperature=request.temperature,
+        top_p=request.top_p,
+        stop=request.stop,
+        stream=False,
+        idempotency_key=request.idempotency_key,
+        idempotency_ttl_s=request.idempotency_ttl_s,
+        cached_filter=_cached_filter(request),
+        raw_passthrough=request.raw_passthrough,
+        strict=request.strict,
+        cache_ttl=request.cache,
+        cache_key=request.cache_key,
+        cache_vary=request.cache_vary,
+        retry=request.retry.model_dump() if request.retry else None,
+        max_cost_usd=request.max_cost_usd,
+        timeout_ms=request.timeout_ms,
+        hedge=request.hedge.model_dump() if request.hedge else None,
+        cache_semantic=request.cache_semantic.model_dump() if request.cache_semantic else None,
+        context_policy=request.context_policy.model_dump() if request.context_policy else None,
+        priority="batch",
+        queue_timeout_ms=request.queue_timeout_ms,
+        max_wait_ms=request.max_wait_ms,
+        **request.tool_args(),
+        **request.logprobs_args(),
+        **request.output_args(),
+    )
+
+
+def _warm_job_not_found(job_id: str) -> HTTPException:
+    return HTTPException(
+        status_code=404,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": ErrorCode.NOT_FOUND.value,
+                "message": f"Cache warming job '{job_id}' not found",
+                "retryable": False,
+                "status_code": 404,
+            },
+        },
+    )
+
+
+@router.post(
+    "/cache/warm",
+    summary="Warm the cache",
+    description=(
+        "Precompute up to 500 /proxy/http (GET or HEAD) and /proxy/llm requests into the cache, "
+        "in the background and at batch priority, e.g. before a launch. Items already cached are "
+        "skipped and reported as cached. Items count against the API key's rate limit and the "
+        "budget caps like the same requests sent directly; max_cost_usd caps the job's own spend. "
+        "Answers 202 with the job, whose progress is at GET /cache/warm/{job_id}."
+    ),
+)
+async def warm_cache(
+    request: CacheWarmRequest,
+    http_request: Request,
+) -> JSONResponse:
+    """Queue a cache warming job."""
+    state = get_app_state()
+    targets = state.targets
+    start_time = time.time()
+
+    api_key, tenant, tier = verify_api_key(http_request)
+    _check_api_key_format(api_key)
+    key_limits = get_key_limits(api_key)
+
+    if state.jobs is None:
+        raise HTTPException(
+            status_code=503,
+            detail={
+                "type": "internal_error",
+                "code": ErrorCode.INTERNAL_ERROR.value,
+                "message": "Cache warming is unavailable: the job store is not configured.",
+            },
+        )
+
+    items = []
+    for index, item in enumerate(request.items):
+        http, llm = item.http, item.llm
+        if llm is not None:
+            apply_template(llm)
+            # Every item counts against Free tier limits like a single request
+            _check_llm_free_tier_restrictions(http_request, llm, api_key, tier)
+        target = http.target if http is not None else llm.target
+        target_config = targets.get(target)
+        error: Optional[str] = None
+        if target_config is None:
+            error = f"target '{target}' does not exist"
+        elif not target_config.get("cache", {}).get("enabled", True):
+            error = f"target '{target}' has caching disabled"
+        elif llm is not None and not target_config.get("llm"):
+            error = f"target '{target}' is not an LLM target"
+        if error:
+            raise HTTPException(
+                status_code=400,
+                detail={
+                    "type": "client_error",
+                    "code": ErrorCode.BAD_REQUEST.value,
+                    "message": f"items[{index}]: {error}",
+                },
+            )
+        credential = (http or llm).credential
+        _check_credential(targets, target, credential)
+        field = "http" if http is not None else "llm"
+        _check_response_filter((http or llm).response_filter, f"items[{index}].{field}.response_filter")
+        if http is not None:
+            kind, args = "http", _warm_http_args(http)
+            args.update(key_id=key_limits.name if key_limits else None)
+        else:
+            kind, args = "llm", _warm_llm_args(llm, targets)
+            args.update(budget_cap_usd=get_budget_cap(tenant), key_limits=key_limits)
+        items.append({"kind": kind, "target": target, "credential": credential, "args": args})
+    rate = _check_key_rate_limit(key_limits, len(items))
+
+    common = dict(
+        targets=targets,
+        cache=state.cache,
+        idempotency=state.idempotency,
+        tenant=tenant,
+        tier=tier,
+        key_pool_manager=state.key_pool_manager,
+        rate_scheduler=state.rate_scheduler,
+        client_profile_name=detect_client_profile(http_request, tenant=tenant),
+        client_profile_manager=state.client_profile_manager,
+    )
+    for item in items:
+        item["args"].update(common)
+
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+    request_hash = hashlib.sha256(
+        json.dumps(request.model_dump(mode="json"), sort_keys=True).encode()
+    ).hexdigest()
+    job = submit_cache_warm(
+        state.jobs,
+        request_hash,
+        items,
+        request.max_parallel,
+        request.max_cost_usd,
+        tenant=tenant,
+        api_key=api_key,
+        budget_cap_usd=get_budget_cap(tenant),
+        key_limits=key_limits,
+        alert_config=get_budget_alerts(),
+    )
+    if job is None:
+        raise HTTPException(
+            status_code=503,
+            detail={
+                "type": "internal_error",
+                "code": ErrorCode.INTERNAL_ERROR.value,
+                "message": "Could not store the job; try again.",
+            },
+        )
+
+    result = SuccessResponse(
+        success=True,
+        data=public_warm_job(job),
+        meta=MetaResponse(
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        status_code=202,
+        headers={
+            "X-Request-ID": request_id,
+            "Location": f"/v1/cache/warm/{job['job_id']}",
+            **_rate_limit_headers(rate),
+        },
+    )
+
+
+@router.get(
+    "/cache/warm/{job_id}",
+    summary="Get a cache warming job",
+    description=(
+        "Report the status of a cache warming job and the outcome of each item: pending, "
+        "warmed (fetched and cached), cached (already cached, skipped), failed (with its error) "
+        "or aborted (not run once max_cost_usd was spent), with the job's total cost. "
+        "Jobs are visible to the tenant that submitted them and kept for 24 hours."
+    ),
+)
+async def get_warm_job(job_id: str, http_request: Request) -> JSONResponse:
+    """Progress of a cache warming job."""
+    start_time = time.time()
+    _, tenant, _ = verify_api_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    state = get_app_state()
+    job = state.jobs.get(job_id, tenant) if state.jobs else None
+    if job is None or job.get("kind") != "cache_warm":
+        raise _warm_job_not_found(job_id)
+
+    result = SuccessResponse(
+        success=True,
+        data=public_warm_job(job),
+        meta=MetaResponse(
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
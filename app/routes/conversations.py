@@ -0,0 +1,177 @@
+"""Conversation endpoints.
+
+This module provides:
+- GET /conversations/{conversation_id} - The stored history of a conversation
+- DELETE /conversations/{conversation_id} - Forget a conversation
+
+Turns are added by POST /proxy/llm with conversation_id and append_messages
+(see core.conversations).
+"""
+import logging
+import time
+import uuid
+from typing import Any, Dict, List, Optional
+
+from fastapi import APIRouter, HTTPException, Request
+from fastapi.responses import JSONResponse
+
+from reliapi.app.dependencies import get_app_state, verify_api_key
+from reliapi.app.schemas import LLMProxyRequest, MetaResponse, SuccessResponse
+from reliapi.core.conversations import (
+    ConversationConflictError,
+    ConversationStore,
+    ConversationTurn,
+    history,
+    public_conversation,
+)
+from reliapi.core.cost_estimator import CostEstimator
+from reliapi.core.errors import ErrorCode
+from reliapi.core.redaction import redact_messages
+
+logger = logging.getLogger(__name__)
+
+router = APIRouter(tags=["Conversations"])
+
+
+def _client_error(status_code: int, code: ErrorCode, message: str) -> HTTPException:
+    return HTTPException(
+        status_code=status_code,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": code.value,
+                "message": message,
+                "retryable": code == ErrorCode.CONVERSATION_CONFLICT,
+                "status_code": status_code,
+            },
+        },
+    )
+
+
+def _store() -> ConversationStore:
+    state = get_app_state()
+    if state.conversations is None:
+        state.conversations = ConversationStore()
+    return state.conversations
+
+
+def _not_found(conversation_id: str) -> HTTPException:
+    return _client_error(404, ErrorCode.NOT_FOUND, f"Conversation '{conversation_id}' not found")
+
+
+def conversation_messages(request: LLMProxyRequest, tenant: Optional[str]) -> None:
+    """Set the messages of a conversation_id request to its stored history
+    and append_messages, without starting a turn (for estimates)."""
+    if request.conversation_id is None:
+        return
+    record = _store().get(request.conversation_id, tenant)
+    request.messages = history(record) + request.append_messages
+
+
+def begin_conversation(request: LLMProxyRequest, tenant: Optional[str]) -> Optional[ConversationTurn]:
+    """Start the turn of a conversation_id request, setting its messages to
+    the history and append_messages.
+
+    Raises a 409 CONVERSATION_CONFLICT while another turn of the
+    conversation runs.
+    """
+    if request.conversation_id is None:
+        return None
+    try:
+        turn = _store().begin(request.conversation_id, tenant)
+    except ConversationConflictError as e:
+        raise _client_error(409, ErrorCode.CONVERSATION_CONFLICT, str(e))
+    request.messages = turn.messages + request.append_messages
+    return turn
+
+
+def finish_conversation(
+    turn: Optional[ConversationTurn],
+    request: LLMProxyRequest,
+    result: Optional[Any],
+    target_config: Dict[str, Any],
+    model: Optional[str],
+) -> None:
+    """Store a successful turn's appended messages and reply, redacted under
+    the target's rules, and report the history's tokens; then let the
+    next turn run. Dry runs and failures (result None when the request
+    raised) store nothing."""
+    if turn is None:
+        return
+    store = _store()
+    try:
+        if result is None or not result.success or request.dry_run or not result.data:
+            return
+        if result.meta.idempotent_hit:
+            # The turn was stored when the key's first request ran
+            return
+        reply: Dict[str, Any] = {"role": "assistant", "content": result.data.get("content") or ""}
+        if result.data.get("tool_calls"):
+            reply["tool_calls"] = result.data["tool_calls"]
+        messages: List[Dict[str, Any]] = request.append_messages + [reply]
+        redaction = target_config.get("redaction")
+        if redaction and redaction.get("enabled", True):
+            messages = redact_messages(messages, redaction).messages
+        model = model or (target_config.get("llm") or {}).get("default_model")
+        tokens = CostEstimator.count_tokens(turn.messages + messages, model)
+        record = store.commit(turn, messages, tokens)
+        if record is not None:
+            result.meta.conversation_tokens = record["tokens"]
+    finally:
+        store.release(turn)
+
+
+def _respond(data: Dict[str, Any], start_time: float) -> JSONResponse:
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+    result = SuccessResponse(
+        success=True,
+        data=data,
+        meta=MetaResponse(
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+@router.get(
+    "/conversations/{conversation_id}",
+    summary="Get a conversation",
+    description=(
+        "Return the history the proxy keeps for a conversation_id: its messages, oldest "
+        "first and redacted under the target's rules, the turns stored and dropped past "
+        "the max_turns bound, the estimated prompt tokens, and when it expires. "
+        "Conversations are visible to the tenant that started them."
+    ),
+)
+async def get_conversation(conversation_id: str, http_request: Request) -> JSONResponse:
+    """The stored history of a conversation."""
+    start_time = time.time()
+    _, tenant, _ = verify_api_key(http_request)
+    store = _store()
+    record = store.get(conversation_id, tenant)
+    if record is None:
+        raise _not_found(conversation_id)
+    return _respond(public_conversation(record, store.ttl_s), start_time)
+
+
+@router.delete(
+    "/conversations/{conversation_id}",
+    summary="Delete a conversation",
+    description=(
+        "Forget a conversation's history. A later request with its conversation_id starts "
+        "a new one; a turn in flight while it is deleted is not stored."
+    ),
+)
+async def delete_conversation(conversation_id: str, http_request: Request) -> JSONResponse:
+    """Forget a conversation."""
+    start_time = time.time()
+    _, tenant, _ = verify_api_key(http_request)
+    if not _store().delete(conversation_id, tenant):
+        raise _not_found(conversation_id)
+    logger.info(f"Conversation deleted: conversation_id={conversation_id}")
+    return _respond({"conversation_id": conversation_id, "deleted": True}, start_time)
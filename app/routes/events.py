@@ -0,0 +1,101 @@
+"""Event stream endpoint.
+
+This module provides:
+- GET /events - Budget, circuit and target events as a server-sent event stream
+"""
+import json
+from typing import AsyncIterator, Optional
+
+from fastapi import APIRouter, HTTPException, Query, Request
+from fastapi.responses import StreamingResponse
+
+from reliapi.app.dependencies import get_key_limits, verify_api_key
+from reliapi.app.services import get_event_bus
+from reliapi.core.errors import ErrorCode
+from reliapi.core.events import EVENTS_GAP
+
+router = APIRouter(tags=["Events"])
+
+# A comment line is sent this often on an idle stream, so proxies in
+# between don't close it.
+HEARTBEAT_S = 15.0
+
+
+def _client_error(status_code: int, code: ErrorCode, message: str) -> HTTPException:
+    return HTTPException(
+        status_code=status_code,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": code.value,
+                "message": message,
+                "retryable": False,
+                "status_code": status_code,
+            },
+        },
+    )
+
+
+def _frame(event_id: Optional[int], event_type: str, data: dict) -> str:
+    lines = f"id: {event_id}\n" if event_id is not None else ""
+    return f"{lines}event: {event_type}\ndata: {json.dumps(data)}\n\n"
+
+
+async def _stream(request: Request, last_id: int, tenant: str, key_name: Optional[str]) -> AsyncIterator[str]:
+    bus = get_event_bus()
+    # Reconnecting clients wait this long, in milliseconds, before retrying
+    yield "retry: 1000\n\n"
+    while not await request.is_disconnected():
+        events, gap, newest_id = bus.since(last_id, tenant, key_name)
+        if gap:
+            yield _frame(None, EVENTS_GAP, {"from_id": gap[0], "to_id": gap[1]})
+        for event in events:
+            yield _frame(
+                event["id"],
+                event["type"],
+                {"id": event["id"], "type": event["type"], "created_at": event["created_at"], "data": event["data"]},
+            )
+        if newest_id != last_id and (not events or events[-1]["id"] != newest_id):
+            # Events of other tenants were skipped: a frame of just an id
+            # moves the client's Last-Event-ID past them
+            yield f"id: {newest_id}\n\n"
+        last_id = newest_id
+        await bus.wait(last_id, HEARTBEAT_S)
+        if bus.last_id == last_id:
+            yield ": heartbeat\n\n"
+
+
+@router.get(
+    "/events",
+    summary="Subscribe to events",
+    description=(
+        "Stream events as server-sent events: budget.threshold_reached when the caller's "
+        "tenant or API key crosses a budget alert threshold, circuit.opened and circuit.closed "
+        "as target circuit breakers change state, and target.changed when a target is "
+        "created, updated or removed. Each event's id is a sequence number; reconnect with "
+        "the last one seen in Last-Event-ID (or last_event_id) to resume right after it. The "
+        "last 1000 events are kept for that; a subscriber further behind first gets an "
+        "events.gap event with the ids it missed. Events are kept per ReliAPI instance."
+    ),
+)
+async def get_events(
+    http_request: Request,
+    last_event_id: Optional[int] = Query(None, ge=0, description="Id of the last event received"),
+) -> StreamingResponse:
+    """Server-sent events of the caller's tenant and API key."""
+    api_key, tenant, _ = verify_api_key(http_request)
+    header = http_request.headers.get("Last-Event-ID")
+    if header is not None:
+        try:
+            last_event_id = int(header)
+        except ValueError:
+            raise _client_error(400, ErrorCode.BAD_REQUEST, "Last-Event-ID must be an event id")
+        if last_event_id < 0:
+            raise _client_error(400, ErrorCode.BAD_REQUEST, "Last-Event-ID must be an event id")
+    key_limits = get_key_limits(api_key)
+    return StreamingResponse(
+        _stream(http_request, last_event_id or 0, tenant or "default", key_limits.name if key_limits else None),
+        media_type="text/event-stream",
+        headers={"Cache-Control": "no-cache", "X-Accel-Buffering": "no"},
+    )
@@ -1,16 +1,18 @@
 """Health check and monitoring endpoints.
 
 This module provides:
-- GET /health - Basic health check
+- GET /health - Basic health check, with the version and features clients probe
 - GET /healthz - Kubernetes-style health check
-- GET /readyz - Readiness check
+- GET /readyz - Readiness check: cache store reachable and config loaded
 - GET /livez - Liveness check
 - GET /metrics - Prometheus metrics
 """
 import logging
+import time
+from typing import Dict, List, Optional
 
 from fastapi import APIRouter, HTTPException, Request
-from fastapi.responses import Response
+from fastapi.responses import JSONResponse, Response
 from prometheus_client import CONTENT_TYPE_LATEST, generate_latest
 from pydantic import BaseModel
 
@@ -21,11 +23,17 @@ logger = logging.getLogger(__name__)
 router = APIRouter(tags=["Health"])
 
 
+# Features clients check for before relying on them (the Go client's
+# ServerCapabilities). Proxies predating this list are told apart by version.
+FEATURES = ["async_jobs", "target_purge", "http_stream"]
+
+
 class HealthResponse(BaseModel):
     """Health check response model."""
 
     status: str
     version: str = "1.0.7"
+    features: List[str] = FEATURES
 
 
 class StatusResponse(BaseModel):
@@ -34,6 +42,21 @@ class StatusResponse(BaseModel):
     status: str
 
 
+class ComponentStatus(BaseModel):
+    """Status of one dependency of the proxy."""
+
+    status: str
+    latency_ms: Optional[int] = None
+    detail: Optional[str] = None
+
+
+class ReadinessResponse(BaseModel):
+    """Readiness check response model."""
+
+    status: str
+    components: Dict[str, ComponentStatus]
+
+
 def _check_health_rate_limit(request: Request, prefix: str) -> None:
     """Check rate limit for health endpoints.
 
@@ -83,11 +106,38 @@ async def healthz(request: Request) -> StatusResponse:
     return StatusResponse(status="healthy")
 
 
-@router.get("/readyz", response_model=StatusResponse)
-async def readyz(request: Request) -> StatusResponse:
-    """Readiness check endpoint with optional rate limiting."""
+def _cache_status() -> ComponentStatus:
+    cache = get_app_state().cache
+    if not cache:
+        return ComponentStatus(status="error", detail="cache not initialized")
+    start = time.monotonic()
+    if not cache.ping():
+        return ComponentStatus(status="error", detail="Redis is unreachable")
+    return ComponentStatus(status="ok", latency_ms=int((time.monotonic() - start) * 1000))
+
+
+def _config_status() -> ComponentStatus:
+    state = get_app_state()
+    if not state.config_loader or state.config_loader.config is None:
+        return ComponentStatus(status="error", detail="config not loaded")
+    return ComponentStatus(status="ok", detail=f"{len(state.targets)} targets")
+
+
+@router.get(
+    "/readyz",
+    response_model=ReadinessResponse,
+    responses={503: {"model": ReadinessResponse, "description": "A component is not ready"}},
+)
+async def readyz(request: Request) -> JSONResponse:
+    """Readiness check: the cache store answers and the config is loaded.
+
+    Answers 503 with the same component statuses when one is not ok.
+    """
     _check_health_rate_limit(request, "readyz")
-    return StatusResponse(status="ready")
+    components = {"cache": _cache_status(), "config": _config_status()}
+    ready = all(c.status == "ok" for c in components.values())
+    result = ReadinessResponse(status="ready" if ready else "not_ready", components=components)
+    return JSONResponse(content=result.model_dump(), status_code=200 if ready else 503)
 
 
 @router.get("/livez", response_model=StatusResponse)
@@ -0,0 +1,103 @@
+"""Async job endpoints.
+
+This module provides:
+- GET /jobs - Jobs of the caller's tenant, paginated
+- GET /jobs/{job_id} - Status and result of a job submitted with POST /proxy/llm?mode=async
+"""
+import time
+import uuid
+from typing import Optional
+
+from fastapi import APIRouter, HTTPException, Query, Request
+from fastapi.responses import JSONResponse
+
+from reliapi.app.dependencies import get_app_state, verify_api_key
+from reliapi.app.schemas import MetaResponse, SuccessResponse
+from reliapi.app.services import JOBS_MAX_PAGE_SIZE, JOBS_PAGE_SIZE, job_search
+from reliapi.core.errors import ErrorCode
+from reliapi.core.jobs import JobStatus, JobStore, public_job
+
+router = APIRouter(tags=["Jobs"])
+
+
+def _client_error(status_code: int, code: ErrorCode, message: str) -> HTTPException:
+    return HTTPException(
+        status_code=status_code,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": code.value,
+                "message": message,
+                "retryable": False,
+                "status_code": status_code,
+            },
+        },
+    )
+
+
+def _respond(data: dict, start_time: float) -> JSONResponse:
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+    result = SuccessResponse(
+        success=True,
+        data=data,
+        meta=MetaResponse(
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+@router.get(
+    "/jobs",
+    summary="List async jobs",
+    description=(
+        "List the jobs the caller's tenant submitted with POST /proxy/llm?mode=async in the "
+        "last 24 hours, oldest first by created_at and job_id, optionally only those in one "
+        "status. Pass next_cursor back as cursor, with the same status, for the next page; "
+        "jobs that expire in between are skipped."
+    ),
+)
+async def list_jobs(
+    http_request: Request,
+    status: Optional[JobStatus] = Query(None),
+    limit: int = Query(JOBS_PAGE_SIZE, ge=1, le=JOBS_MAX_PAGE_SIZE),
+    cursor: Optional[str] = Query(None),
+) -> JSONResponse:
+    """Jobs of the caller's tenant."""
+    start_time = time.time()
+    _, tenant, _ = verify_api_key(http_request)
+
+    jobs = get_app_state().jobs or JobStore()
+    try:
+        page = job_search(jobs, tenant, status.value if status else None, limit, cursor)
+    except ValueError as e:
+        raise _client_error(400, ErrorCode.BAD_REQUEST, str(e))
+    return _respond(page, start_time)
+
+
+@router.get(
+    "/jobs/{job_id}",
+    summary="Get an async job",
+    description=(
+        "Report the status of a job submitted with POST /proxy/llm?mode=async: queued, "
+        "running, succeeded or failed. Once it has finished, data.result holds the "
+        "ReliAPIResponse the request would have returned synchronously, and "
+        "data.callback_delivered whether its callback_url accepted the job.completed event. "
+        "Jobs are visible to the tenant that submitted them and kept for 24 hours."
+    ),
+)
+async def get_job(job_id: str, http_request: Request) -> JSONResponse:
+    """Status and result of an async job."""
+    start_time = time.time()
+    _, tenant, _ = verify_api_key(http_request)
+
+    state = get_app_state()
+    job = state.jobs.get(job_id, tenant) if state.jobs else None
+    if job is None:
+        raise _client_error(404, ErrorCode.NOT_FOUND, f"Job '{job_id}' not found")
+    return _respond(public_job(job), start_time)
@@ -2,29 +2,93 @@
 
 This module provides:
 - POST /proxy/http - Universal HTTP proxy with reliability features
-- POST /proxy/llm - LLM proxy with idempotency and budget control
+- POST /proxy/graphql - GraphQL operations with query-aware caching
+- POST /proxy/embeddings - Embeddings with per-input caching and cost tracking
+- POST /proxy/llm - LLM proxy with idempotency and budget control (mode=async queues a job)
+- POST /proxy/llm/batch - Multiple LLM requests in one call
 """
+import asyncio
+import hashlib
+import json
 import logging
+import math
+import os
+import random
+import time
 import uuid
-from typing import Dict, Optional
+from datetime import datetime, timezone
+from typing import Any, AsyncIterator, Dict, Literal, Optional, Tuple, Union
 
-from fastapi import APIRouter, HTTPException, Request
-from fastapi.responses import JSONResponse, StreamingResponse
+from fastapi import APIRouter, HTTPException, Query, Request
+from fastapi.responses import JSONResponse, Response, StreamingResponse
 
 from reliapi.app.dependencies import (
     detect_client_profile,
     get_account_id,
     get_app_state,
+    get_budget_alerts,
+    get_budget_cap,
+    get_key_limits,
+    get_latency_route,
+    get_webhook_secret,
     verify_api_key,
 )
-from reliapi.app.schemas import HTTPProxyRequest, LLMProxyRequest
+from reliapi.app.schemas import (
+    EmbeddingsRequest,
+    ErrorResponse,
+    GraphQLProxyRequest,
+    HTTPProxyRequest,
+    LLMBatchRequest,
+    LLMProxyRequest,
+    MetaResponse,
+    SuccessResponse,
+    UpstreamRateLimitMeta,
+)
+from reliapi.app.routes.conversations import begin_conversation, finish_conversation
+from reliapi.app.routes.templates import apply_template, stamp_template
 from reliapi.app.services import (
+    MAX_TIMEOUT_MS,
+    apply_response_filter,
+    raw_response_body,
+    budget_remaining,
+    comparison_meta,
+    check_budget_alerts,
+    check_credential,
+    check_key_rate_limit,
+    handle_embeddings_proxy,
+    handle_graphql_proxy,
     handle_http_proxy,
-    handle_llm_proxy,
+    handle_http_proxy_stream,
+    handle_llm_batch,
+    handle_llm_proxy_with_fallbacks,
     handle_llm_stream_generator,
+    handle_with_cache_mode,
+    injected_error,
+    metered_stream,
+    record_audit,
+    record_hot_key,
+    record_usage,
+    route_by_latency,
+    stamp_idempotency_expiry,
+    stamp_target_version,
+    submit_llm_job,
+    usage_tags,
 )
+from reliapi.core.audit import capture_attempts
+from reliapi.core.credentials import CredentialError, select_credentials
+from reliapi.core.errors import ErrorCode
+from reliapi.core.faults import FaultPlan, FaultSpecError, corrupt_json, parse_faults, roll
 from reliapi.core.free_tier_restrictions import FreeTierRestrictions
+from reliapi.core.jobs import public_job
+from reliapi.core.latency_routing import RouteChoice, route_name
+from reliapi.core.key_limits import KeyLimits, RateLimitStatus
+from reliapi.core.model_aliases import AliasResolution, UnknownAliasError, resolve_alias
+from reliapi.core.replay import current_replay
+from reliapi.core.response_filter import FilterSyntaxError, parse_response_filter
 from reliapi.core.security import SecurityManager
+from reliapi.core.target_registry import check_base_url
+from reliapi.core.transformations import track_transformations
+from reliapi.core.upstream_limits import UpstreamRateLimit, track_rate_limit
 from reliapi.integrations.routellm import (
     apply_routellm_overrides,
     extract_routellm_decision,
@@ -57,6 +121,211 @@ def _check_api_key_format(api_key: Optional[str]) -> None:
             )
 
 
+def _caller(http_request: Request) -> Tuple[Optional[str], Optional[str], str]:
+    """API key, tenant and tier of a request (see verify_api_key).
+
+    A replay (POST /replay) runs with the admin key for the tenant of the
+    request replayed, so it is billed and budgeted as one of its requests.
+    """
+    replay = current_replay()
+    if replay is not None:
+        return http_request.headers.get("X-API-Key"), replay.tenant, "enterprise"
+    return verify_api_key(http_request)
+
+
+def _replayable(request: Union[HTTPProxyRequest, LLMProxyRequest]) -> Dict[str, Any]:
+    """The JSON of a proxy request as audit records keep it for replays:
+    the fields the caller set, with a multipart body as the body it was
+    encoded to and a template's messages left to be rendered again from
+    its pinned version."""
+    exclude = {"multipart", "body_base64"} if isinstance(request, HTTPProxyRequest) else set()
+    if isinstance(request, LLMProxyRequest) and request.template is not None:
+        exclude.add("messages")
+    return request.model_dump(mode="json", exclude_unset=True, exclude=exclude)
+
+
+def _rate_limit_headers(rate: Optional[RateLimitStatus]) -> Dict[str, str]:
+    """X-RateLimit-* headers of an API key's rate limit window."""
+    if not rate:
+        return {}
+    return {
+        "X-RateLimit-Limit": str(rate.limit),
+        "X-RateLimit-Remaining": str(rate.remaining),
+        "X-RateLimit-Reset": str(rate.reset_at),
+    }
+
+
+def _check_key_rate_limit(key_limits: Optional[KeyLimits], requests: int = 1) -> Optional[RateLimitStatus]:
+    """Count the request against the API key's rate_limit_rpm.
+
+    Raises:
+        HTTPException: 429 once the key has used its requests this minute
+    """
+    rate = check_key_rate_limit(key_limits, requests)
+    if rate and not rate.allowed:
+        retry_after = max(rate.reset_at - int(time.time()), 1)
+        raise HTTPException(
+            status_code=429,
+            detail={
+                "success": False,
+                "error": {
+                    "type": "rate_limit_error",
+                    "code": ErrorCode.RATE_LIMIT_RELIAPI.value,
+                    "message": (
+                        f"API key '{key_limits.name}' exceeded its rate limit of "
+                        f"{rate.limit} requests per minute"
+                    ),
+                    "retryable": True,
+                    "target": None,
+                    "status_code": 429,
+                    "retry_after_s": retry_after,
+                    "details": {"api_key_name": key_limits.name},
+                },
+            },
+            headers={**_rate_limit_headers(rate), "Retry-After": str(retry_after)},
+        )
+    return rate
+
+
+def _stamp_key_quota(
+    meta: MetaResponse,
+    key_limits: Optional[KeyLimits],
+    rate: Optional[RateLimitStatus],
+    tenant: Optional[str] = None,
+    budget_cap_usd: Optional[float] = None,
+) -> None:
+    """Report what is left of the API key's budget and rate limit in meta,
+    and of the tenant's budget_cap_usd once it is nearly spent."""
+    meta.budget_remaining_usd = budget_remaining(tenant, budget_cap_usd, key_limits)
+    if rate:
+        meta.rate_limit_remaining = rate.remaining
+
+
+def _check_budget_alerts(tenant: Optional[str], key_limits: Optional[KeyLimits]) -> None:
+    """Fire the budget alerts the spend of a response crossed."""
+    check_budget_alerts(tenant, get_budget_cap(tenant), key_limits, get_budget_alerts())
+
+
+async def _alerting_stream(
+    events: AsyncIterator[str], tenant: Optional[str], key_limits: Optional[KeyLimits]
+) -> AsyncIterator[str]:
+    """Relay a metered stream, then fire the budget alerts its spend crossed."""
+    try:
+        async for event in events:
+            yield event
+    finally:
+        _check_budget_alerts(tenant, key_limits)
+
+
+# Fault injection: the faults to inject, and the faults that were
+FAULT_HEADER = "X-ReliAPI-Fault"
+FAULT_INJECTED_HEADER = "X-ReliAPI-Fault-Injected"
+
+
+async def _inject_faults(
+    request: Request, key_limits: Optional[KeyLimits], stream: bool = False
+) -> Optional[FaultPlan]:
+    """Draw the faults of the X-ReliAPI-Fault header, or else of the key's
+    faults, and wait out their latency.
+
+    The header is rejected with FORBIDDEN for production keys: in production
+    (ENVIRONMENT=production), all keys but those configured with test: true.
+    """
+    header = request.headers.get(FAULT_HEADER)
+    test_key = bool(key_limits and key_limits.test)
+    if header is not None and not test_key and os.getenv("ENVIRONMENT", "").lower() == "production":
+        raise HTTPException(
+            status_code=403,
+            detail={
+                "type": "client_error",
+                "code": ErrorCode.FORBIDDEN.value,
+                "message": f"{FAULT_HEADER} is only accepted for test keys in production",
+            },
+        )
+    spec = header if header is not None else (key_limits.faults if test_key else None)
+    if not spec:
+        return None
+    try:
+        faults = parse_faults(spec)
+    except FaultSpecError as e:
+        raise _bad_request(f"{FAULT_HEADER}: {e}")
+    fault = roll(faults, stream=stream)
+    if fault and fault.latency_ms:
+        await asyncio.sleep(fault.latency_ms / 1000)
+    return fault
+
+
+def _proxy_response(
+    result: Union[SuccessResponse, ErrorResponse],
+    status_code: int,
+    headers: Dict[str, str],
+    fault: Optional[FaultPlan] = None,
+    raw: Optional[bytes] = None,
+) -> Response:
+    """The JSON response of a proxy request, reporting its faults, with the
+    body cut if a corrupt fault fired. raw, the JSON raw_response_body
+    returned, is sent as data without being parsed and serialized again."""
+    if fault:
+        headers[FAULT_INJECTED_HEADER] = fault.label
+    if raw is not None:
+        meta = json.dumps(result.meta.model_dump(mode="json"), ensure_ascii=False, separators=(",", ":"))
+        response = Response(
+            content=b'{"success":true,"data":' + raw + b',"meta":' + meta.encode() + b"}",
+            status_code=status_code,
+            headers=headers,
+            media_type="application/json",
+        )
+    else:
+        response = JSONResponse(content=result.model_dump(), status_code=status_code, headers=headers)
+    if fault and fault.corrupt:
+        return Response(
+            content=corrupt_json(response.body), status_code=status_code, headers=headers, media_type="application/json"
+        )
+    return response
+
+
+async def _faulted_stream(
+    events: AsyncIterator[str], fault: FaultPlan, target: str, request_id: str
+) -> AsyncIterator[str]:
+    """Relay an LLM stream with its faults: an error event instead of the
+    stream, or the stream ended after the chunks of a truncate fault,
+    without its done event. The meta event reports the faults."""
+    if fault.error:
+        error = injected_error(fault.error, target, request_id).error
+        error_data = {
+            "code": error.code,
+            "message": error.message,
+            "upstream_status": error.status_code,
+            "fault_injected": fault.label,
+        }
+        yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
+        return
+    chunks = 0
+    async for event in events:
+        if event.startswith("event: meta\n"):
+            meta_data = json.loads(event.split("data: ", 1)[1])
+            meta_data["fault_injected"] = fault.label
+            event = f"event: meta\ndata: {json.dumps(meta_data)}\n\n"
+        elif fault.truncate and "event: chunk\n" in event:
+            if chunks == fault.truncate.after_chunks:
+                await events.aclose()
+                return
+            chunks += 1
+        yield event
+
+
+async def _truncated(chunks: AsyncIterator[bytes], count: int) -> AsyncIterator[bytes]:
+    """Relay the first count chunks of a raw stream."""
+    if count:
+        sent = 0
+        async for chunk in chunks:
+            yield chunk
+            sent += 1
+            if sent == count:
+                break
+    await chunks.aclose()
+
+
 def _check_free_tier_rate_limits(
     request: Request,
     api_key: Optional[str],
@@ -348,24 +617,30 @@ def _check_llm_free_tier_restrictions(
     description=(
         "Universal HTTP proxy endpoint for any HTTP API. "
         "Supports retries, circuit breaker, cache, and idempotency. "
-        "Use this endpoint to add reliability layers to any HTTP API call."
+        "Use this endpoint to add reliability layers to any HTTP API call. "
+        "Set stream_response=true to relay large upstream bodies as a raw stream."
     ),
 )
 async def proxy_http(
     request: HTTPProxyRequest,
     http_request: Request,
-) -> JSONResponse:
+):
     """Universal HTTP proxy endpoint for any HTTP API."""
     state = get_app_state()
+    # The request runs against the targets as they are now, even if the
+    # /targets API replaces them while it is in flight.
+    targets = state.targets
 
     # Verify API key and resolve tenant/tier
-    api_key, tenant, tier = verify_api_key(http_request)
+    api_key, tenant, tier = _caller(http_request)
 
     # Validate API key format
     _check_api_key_format(api_key)
 
     # Check rate limits for free tier
     _check_free_tier_rate_limits(http_request, api_key, tier, endpoint="http")
+    key_limits = get_key_limits(api_key)
+    rate = _check_key_rate_limit(key_limits)
 
     # Generate request ID
     request_id = f"req_{uuid.uuid4().hex[:16]}"
@@ -373,33 +648,348 @@ async def proxy_http(
     # Detect client profile
     client_profile_name = detect_client_profile(http_request, tenant=tenant)
 
-    result = await handle_http_proxy(
-        target_name=request.target,
-        method=request.method,
-        path=request.path,
-        headers=request.headers,
-        query=request.query,
-        body=request.body,
-        idempotency_key=request.idempotency_key,
-        cache_ttl=request.cache,
-        targets=state.targets,
-        cache=state.cache,
-        idempotency=state.idempotency,
-        key_pool_manager=state.key_pool_manager,
-        rate_scheduler=state.rate_scheduler,
-        client_profile_name=client_profile_name,
-        client_profile_manager=state.client_profile_manager,
-        request_id=request_id,
-        tenant=tenant,
-        tier=tier,
+    _check_credential(targets, request.target, request.credential)
+    _check_response_filter(request.response_filter)
+    timeout_ms = _deadline_timeout_ms(http_request, request.timeout_ms, targets.get(request.target))
+    stream = request.stream_response and not request.dry_run
+    fault = await _inject_faults(http_request, key_limits, stream=stream) if not request.dry_run else None
+    tags = usage_tags(tenant, request.tags)
+    if stream:
+        return await _proxy_http_stream(
+            request, targets, request_id, api_key, tenant, tier, rate, timeout_ms, fault, tags
+        )
+
+    created_at = datetime.now(timezone.utc)
+    with capture_attempts((targets.get(request.target) or {}).get("audit")) as attempts, select_credentials(
+        request.credential, request.idempotency_key, tenant
+    ) as credential, track_rate_limit() as rate_limit, track_transformations() as transformations:
+        if fault and fault.error:
+            result = injected_error(fault.error, request.target, request_id)
+        else:
+            result = await handle_with_cache_mode(
+                handle_http_proxy,
+                kind="http",
+                cache_mode=request.cache_mode.value,
+                target_name=request.target,
+                method=request.method,
+                path=request.path,
+                headers=request.headers,
+                query=request.query,
+                body=request.body,
+                body_encoding=request.body_encoding,
+                response_headers=request.response_headers,
+                if_none_match=request.if_none_match,
+                follow_redirects=request.follow_redirects,
+                max_redirects=request.max_redirects,
+                timeout_ms=timeout_ms,
+                idempotency_key=request.idempotency_key,
+                idempotency_ttl_s=request.idempotency_ttl_s,
+                max_response_bytes=request.max_response_bytes,
+                truncate_response=request.truncate_response,
+                dry_run=request.dry_run,
+                multipart=request.multipart is not None,
+                cached_filter=_cached_filter(request),
+                raw_passthrough=request.raw_passthrough,
+                key_id=key_limits.name if key_limits else None,
+                cache_ttl=request.cache,
+                cache_key=request.cache_key,
+                cache_vary=request.cache_vary,
+                retry=request.retry.model_dump() if request.retry else None,
+                targets=targets,
+                cache=state.cache,
+                idempotency=state.idempotency,
+                key_pool_manager=state.key_pool_manager,
+                rate_scheduler=state.rate_scheduler,
+                client_profile_name=client_profile_name,
+                client_profile_manager=state.client_profile_manager,
+                request_id=request_id,
+                tenant=tenant,
+                tier=tier,
+            )
+    raw = raw_response_body(result, request.raw_passthrough, "http")
+    stamp_target_version(result.meta, targets)
+    stamp_idempotency_expiry(result.meta, state.idempotency, request.idempotency_key, tenant)
+    result.meta.credential_name = credential.used
+    result.meta.tags = tags
+    result.meta.transformations_applied = transformations.names or None
+    _stamp_replay(result.meta)
+    _stamp_upstream_rate_limit(result.meta, rate_limit.last)
+    if fault:
+        result.meta.fault_injected = fault.label
+    else:
+        record_usage(result, "http", tenant, api_key, key_limits)
+        record_hot_key(state.cache, result, "http", _replayable(request), tenant)
+    record_audit(
+        result, "http", request.target, targets, tenant, api_key, attempts, created_at,
+        method=request.method, path=request.path, request=_replayable(request),
     )
+    _stamp_key_quota(result.meta, key_limits, rate, tenant, get_budget_cap(tenant))
 
     # Record usage for RapidAPI tracking
-    if state.rapidapi_client and api_key:
+    if state.rapidapi_client and api_key and not fault:
+        await state.rapidapi_client.record_usage(
+            api_key=api_key,
+            endpoint="/proxy/http",
+            latency_ms=result.meta.duration_ms,
+            status="success" if result.success else "error",
+        )
+        rapidapi_tier_distribution.labels(tier=tier).inc()
+    apply_response_filter(result, request.response_filter, "http")
+
+    status_code = 200 if result.success else (result.error.status_code or 500)
+    return _proxy_response(
+        result,
+        status_code,
+        {
+            "X-Request-ID": request_id,
+            "X-Cache-Hit": str(result.meta.cache_hit).lower(),
+            "X-Retries": str(result.meta.retries),
+            "X-Duration-MS": str(result.meta.duration_ms),
+            **_rate_limit_headers(rate),
+        },
+        fault,
+        raw,
+    )
+
+
+async def _proxy_http_stream(
+    request: HTTPProxyRequest,
+    targets: Dict[str, Dict],
+    request_id: str,
+    api_key: Optional[str],
+    tenant: Optional[str],
+    tier: str,
+    rate: Optional[RateLimitStatus] = None,
+    timeout_ms: Optional[int] = None,
+    fault: Optional[FaultPlan] = None,
+    tags: Optional[Dict[str, str]] = None,
+):
+    """Relay the upstream response of a stream_response request, with the
+    timeout_ms proxy_http derived from the caller's deadline, counting it
+    under tags.
+
+    The upstream status and headers are passed through, with the request's
+    meta in X-ReliAPI-* headers. Failures before the upstream answers use the
+    usual JSON error envelope, without those headers. A truncate fault cuts
+    the body after its chunks.
+    """
+    state = get_app_state()
+    key_limits = get_key_limits(api_key)
+    if fault and fault.error:
+        result = injected_error(fault.error, request.target, request_id)
+        result.meta.fault_injected = fault.label
+        return _proxy_response(
+            result, result.error.status_code, {"X-Request-ID": request_id, **_rate_limit_headers(rate)}, fault
+        )
+    with select_credentials(
+        request.credential, request.idempotency_key, tenant
+    ) as credential, track_rate_limit() as rate_limit, track_transformations() as transformations:
+        result = await handle_http_proxy_stream(
+            target_name=request.target,
+            method=request.method,
+            path=request.path,
+            headers=request.headers,
+            query=request.query,
+            body=request.body,
+            body_encoding=request.body_encoding,
+            follow_redirects=request.follow_redirects,
+            max_redirects=request.max_redirects,
+            timeout_ms=timeout_ms,
+            cache_ttl=request.cache,
+            cache_key=request.cache_key,
+            cache_vary=request.cache_vary,
+            retry=request.retry.model_dump() if request.retry else None,
+            targets=targets,
+            cache=state.cache,
+            key_pool_manager=state.key_pool_manager,
+            rate_scheduler=state.rate_scheduler,
+            request_id=request_id,
+            tenant=tenant,
+            key_id=key_limits.name if key_limits else None,
+        )
+    stamp_target_version(result.meta, targets)
+    result.meta.credential_name = credential.used
+    result.meta.tags = tags
+    result.meta.transformations_applied = transformations.names or None
+    _stamp_upstream_rate_limit(result.meta, rate_limit.last)
+    if not fault:
+        record_usage(result, "http", tenant, api_key)
+
+    if state.rapidapi_client and api_key and not fault:
         await state.rapidapi_client.record_usage(
             api_key=api_key,
             endpoint="/proxy/http",
             latency_ms=result.meta.duration_ms,
+            status="error" if isinstance(result, ErrorResponse) else "success",
+        )
+        rapidapi_tier_distribution.labels(tier=tier).inc()
+
+    if isinstance(result, ErrorResponse):
+        return JSONResponse(
+            content=result.model_dump(),
+            status_code=result.error.status_code or 500,
+            headers={"X-Request-ID": request_id, **_rate_limit_headers(rate)},
+        )
+
+    headers = dict(result.headers)
+    headers.update({
+        "X-ReliAPI-Request-ID": request_id,
+        "X-ReliAPI-Target": request.target,
+        "X-ReliAPI-Cache-Hit": str(result.meta.cache_hit).lower(),
+        "X-ReliAPI-Retries": str(result.meta.retries),
+        "X-ReliAPI-Duration-Ms": str(result.meta.duration_ms),
+        **_rate_limit_headers(rate),
+    })
+    if result.meta.target_version is not None:
+        headers["X-ReliAPI-Target-Version"] = str(result.meta.target_version)
+    if result.meta.credential_name:
+        headers["X-ReliAPI-Credential"] = result.meta.credential_name
+    if result.meta.transformations_applied:
+        headers["X-ReliAPI-Transformations"] = ",".join(result.meta.transformations_applied)
+    if result.meta.upstream_rate_limit:
+        headers["X-ReliAPI-Upstream-RateLimit-Remaining"] = str(result.meta.upstream_rate_limit.remaining)
+        headers["X-ReliAPI-Upstream-RateLimit-Reset"] = result.meta.upstream_rate_limit.reset_at
+    chunks = result.chunks
+    if fault:
+        headers[FAULT_INJECTED_HEADER] = fault.label
+        if fault.truncate:
+            chunks = _truncated(chunks, fault.truncate.after_chunks)
+    return StreamingResponse(chunks, status_code=result.status_code, headers=headers)
+
+
+@router.post(
+    "/proxy/graphql",
+    summary="Proxy GraphQL request",
+    description=(
+        "Send a GraphQL operation to a target's GraphQL endpoint with retries, circuit breaker "
+        "and idempotency. Queries are cached by their normalized document and variables; "
+        "mutations are never cached. Errors the upstream reports next to data are returned in "
+        "data.errors rather than failing the request."
+    ),
+)
+async def proxy_graphql(
+    request: GraphQLProxyRequest,
+    http_request: Request,
+) -> JSONResponse:
+    """GraphQL proxy endpoint."""
+    state = get_app_state()
+    targets = state.targets
+
+    api_key, tenant, tier = verify_api_key(http_request)
+    _check_api_key_format(api_key)
+    _check_free_tier_rate_limits(http_request, api_key, tier, endpoint="http")
+    key_limits = get_key_limits(api_key)
+    rate = _check_key_rate_limit(key_limits)
+
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+    client_profile_name = detect_client_profile(http_request, tenant=tenant)
+
+    created_at = datetime.now(timezone.utc)
+    with capture_attempts((targets.get(request.target) or {}).get("audit")) as attempts:
+        result = await handle_graphql_proxy(
+            target_name=request.target,
+            query=request.query,
+            operation_name=request.operation_name,
+            variables=request.variables,
+            path=request.path,
+            headers=request.headers,
+            idempotency_key=request.idempotency_key,
+            cache_ttl=request.cache,
+            retry=request.retry.model_dump() if request.retry else None,
+            targets=targets,
+            cache=state.cache,
+            idempotency=state.idempotency,
+            key_pool_manager=state.key_pool_manager,
+            rate_scheduler=state.rate_scheduler,
+            client_profile_name=client_profile_name,
+            client_profile_manager=state.client_profile_manager,
+            request_id=request_id,
+            tenant=tenant,
+        )
+    stamp_target_version(result.meta, targets)
+    record_usage(result, "graphql", tenant, api_key, key_limits)
+    record_audit(
+        result, "graphql", request.target, targets, tenant, api_key, attempts, created_at,
+        method="POST", path=request.path,
+    )
+    _stamp_key_quota(result.meta, key_limits, rate, tenant, get_budget_cap(tenant))
+
+    if state.rapidapi_client and api_key:
+        await state.rapidapi_client.record_usage(
+            api_key=api_key,
+            endpoint="/proxy/graphql",
+            latency_ms=result.meta.duration_ms,
+            status="success" if result.success else "error",
+        )
+        rapidapi_tier_distribution.labels(tier=tier).inc()
+
+    status_code = 200 if result.success else (result.error.status_code or 500)
+    return JSONResponse(
+        content=result.model_dump(),
+        status_code=status_code,
+        headers={
+            "X-Request-ID": request_id,
+            "X-Cache-Hit": str(result.meta.cache_hit).lower(),
+            "X-Retries": str(result.meta.retries),
+            "X-Duration-MS": str(result.meta.duration_ms),
+            **_rate_limit_headers(rate),
+        },
+    )
+
+
+@router.post(
+    "/proxy/embeddings",
+    summary="Proxy embeddings request",
+    description=(
+        "Embed one text or a batch through an LLM target with retries, circuit breaker and "
+        "idempotency. Each input is cached on its own: data.cache_hits flags the inputs served "
+        "from the cache, and only the others are sent upstream and billed in meta.cost_usd."
+    ),
+)
+async def proxy_embeddings(
+    request: EmbeddingsRequest,
+    http_request: Request,
+) -> JSONResponse:
+    """Embeddings proxy endpoint."""
+    state = get_app_state()
+    targets = state.targets
+
+    api_key, tenant, tier = verify_api_key(http_request)
+    _check_api_key_format(api_key)
+    _check_free_tier_rate_limits(http_request, api_key, tier, endpoint="http")
+    key_limits = get_key_limits(api_key)
+    rate = _check_key_rate_limit(key_limits)
+
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    created_at = datetime.now(timezone.utc)
+    with capture_attempts((targets.get(request.target) or {}).get("audit")) as attempts:
+        result = await handle_embeddings_proxy(
+            target_name=request.target,
+            inputs=request.input,
+            model=request.model,
+            dimensions=request.dimensions,
+            input_type=request.input_type,
+            idempotency_key=request.idempotency_key,
+            cache_ttl=request.cache,
+            retry=request.retry.model_dump() if request.retry else None,
+            targets=targets,
+            cache=state.cache,
+            idempotency=state.idempotency,
+            key_pool_manager=state.key_pool_manager,
+            request_id=request_id,
+            tenant=tenant,
+        )
+    stamp_target_version(result.meta, targets)
+    record_usage(result, "embeddings", tenant, api_key, key_limits)
+    record_audit(result, "embeddings", request.target, targets, tenant, api_key, attempts, created_at)
+    _stamp_key_quota(result.meta, key_limits, rate, tenant, get_budget_cap(tenant))
+
+    if state.rapidapi_client and api_key:
+        await state.rapidapi_client.record_usage(
+            api_key=api_key,
+            endpoint="/proxy/embeddings",
+            latency_ms=result.meta.duration_ms,
             status="success" if result.success else "error",
         )
         rapidapi_tier_distribution.labels(tier=tier).inc()
@@ -413,6 +1003,7 @@ async def proxy_http(
             "X-Cache-Hit": str(result.meta.cache_hit).lower(),
             "X-Retries": str(result.meta.retries),
             "X-Duration-MS": str(result.meta.duration_ms),
+            **_rate_limit_headers(rate),
         },
     )
 
@@ -424,24 +1015,41 @@ async def proxy_http(
         "LLM proxy endpoint with idempotency, budget caps, and caching. "
         "Make idempotent LLM API calls with predictable costs. "
         "Supports OpenAI, Anthropic, and Mistral providers. "
-        "Set stream=true for Server-Sent Events (SSE) streaming."
+        "Set stream=true for Server-Sent Events (SSE) streaming, or mode=async to queue "
+        "long generations as a job polled at GET /jobs/{job_id}."
     ),
 )
 async def proxy_llm(
     request: LLMProxyRequest,
     http_request: Request,
+    mode: Literal["sync", "async"] = Query(
+        "sync",
+        description=(
+            "async queues the request as a job and answers 202 with its job_id at once; "
+            "poll GET /jobs/{job_id} or set callback_url for the result."
+        ),
+    ),
 ):
     """LLM proxy endpoint with idempotency and budget control."""
     state = get_app_state()
+    targets = state.targets
 
     # Verify API key and resolve tenant/tier
-    api_key, tenant, tier = verify_api_key(http_request)
+    api_key, tenant, tier = _caller(http_request)
 
     # Validate API key format
     _check_api_key_format(api_key)
+    apply_template(request)
+
+    if mode == "async":
+        await _check_async_llm_request(request)
+    elif request.callback_url:
+        raise _bad_request("callback_url is only used with mode=async")
 
     # Check LLM-specific free tier restrictions
     _check_llm_free_tier_restrictions(http_request, request, api_key, tier)
+    key_limits = get_key_limits(api_key)
+    rate = _check_key_rate_limit(key_limits)
 
     # Generate request ID
     request_id = f"req_{uuid.uuid4().hex[:16]}"
@@ -449,14 +1057,16 @@ async def proxy_llm(
     # Extract RouteLLM routing decision from headers
     routellm_decision = extract_routellm_decision(dict(http_request.headers))
 
-    # Apply RouteLLM overrides to target and model
-    resolved_target = request.target
-    resolved_model = request.model
+    # Route an auto: target and resolve a model alias, then apply RouteLLM
+    # overrides to target and model
+    resolved_target, resolved_model, route, alias = _resolve_target(
+        request.target, request.model, targets, request.idempotency_key, tenant
+    )
     if routellm_decision and routellm_decision.has_override:
         resolved_target, resolved_model = apply_routellm_overrides(
             request.target,
             request.model,
-            state.targets,
+            targets,
             routellm_decision,
         )
 
@@ -476,8 +1086,16 @@ async def proxy_llm(
 
         routellm_metrics.record_decision(routellm_decision)
 
-    # Handle streaming requests
-    if request.stream:
+    _check_credential(targets, resolved_target, request.credential)
+    _check_response_filter(request.response_filter)
+    timeout_ms = _deadline_timeout_ms(http_request, request.timeout_ms, targets.get(resolved_target))
+    fault = None
+    if mode == "sync" and not request.dry_run:
+        fault = await _inject_faults(http_request, key_limits, stream=bool(request.stream))
+    tags = usage_tags(tenant, request.tags)
+
+    # Handle streaming requests (a dry run answers in JSON either way)
+    if request.stream and not request.dry_run:
         generator = handle_llm_stream_generator(
             target_name=resolved_target,
             messages=request.messages,
@@ -487,13 +1105,30 @@ async def proxy_llm(
             top_p=request.top_p,
             stop=request.stop,
             idempotency_key=request.idempotency_key,
+            idempotency_ttl_s=request.idempotency_ttl_s,
             cache_ttl=request.cache,
-            targets=state.targets,
+            targets=targets,
             cache=state.cache,
             idempotency=state.idempotency,
             request_id=request_id,
             tenant=tenant,
             tier=tier,
+            max_cost_usd=request.max_cost_usd,
+            budget_cap_usd=get_budget_cap(tenant),
+            key_limits=key_limits,
+            timeout_ms=timeout_ms,
+            context_policy=request.context_policy.model_dump() if request.context_policy else None,
+            priority=request.priority,
+            queue_timeout_ms=request.queue_timeout_ms,
+            max_wait_ms=request.max_wait_ms,
+            alias=alias.alias if alias else None,
+            routed_to=route.target if route else None,
+            template_name=request.template.name if request.template else None,
+            template_version=request.template.version if request.template else None,
+            api_key=api_key,
+            tags=tags,
+            strict=request.strict,
+            **request.logprobs_args(),
         )
 
         # Build response headers including RouteLLM correlation
@@ -501,21 +1136,35 @@ async def proxy_llm(
             "X-Request-ID": request_id,
             "Cache-Control": "no-cache",
             "Connection": "keep-alive",
+            **_rate_limit_headers(rate),
         }
         if routellm_decision:
             response_headers.update(routellm_decision.to_response_headers())
 
+        events = _credential_stream(generator, request.credential, request.idempotency_key, tenant)
+        if fault:
+            # Not metered: faulted streams stay out of usage reporting
+            events = _faulted_stream(events, fault, resolved_target, request_id)
+            response_headers[FAULT_INJECTED_HEADER] = fault.label
+        else:
+            stream_model = resolved_model or (targets.get(resolved_target) or {}).get("llm", {}).get("default_model")
+            events = metered_stream(events, resolved_target, stream_model, tenant, api_key, key_limits, tags)
         return StreamingResponse(
-            generator,
+            _alerting_stream(events, tenant, key_limits),
             media_type="text/event-stream",
             headers=response_headers,
         )
 
     # Detect client profile
     client_profile_name = detect_client_profile(http_request, tenant=tenant)
+    # Take the conversation's turn (async requests were rejected above)
+    turn = begin_conversation(request, tenant)
 
     # Handle non-streaming requests
-    result = await handle_llm_proxy(
+    call_args = dict(
+        cache_mode=request.cache_mode.value,
+        fallbacks=[f.model_dump() for f in request.fallbacks or []],
+        fallback_response=request.fallback_response.model_dump() if request.fallback_response else None,
         target_name=resolved_target,
         messages=request.messages,
         model=resolved_model,
@@ -525,8 +1174,30 @@ async def proxy_llm(
         stop=request.stop,
         stream=False,
         idempotency_key=request.idempotency_key,
+        idempotency_ttl_s=request.idempotency_ttl_s,
+        dry_run=request.dry_run,
+        include_raw=request.include_raw,
+        cached_filter=_cached_filter(request),
+        raw_passthrough=request.raw_passthrough,
+        strict=request.strict,
         cache_ttl=request.cache,
-        targets=state.targets,
+        cache_key=request.cache_key,
+        cache_vary=request.cache_vary,
+        retry=request.retry.model_dump() if request.retry else None,
+        max_cost_usd=request.max_cost_usd,
+        budget_cap_usd=get_budget_cap(tenant),
+        key_limits=key_limits,
+        timeout_ms=request.timeout_ms,
+        hedge=request.hedge.model_dump() if request.hedge else None,
+        cache_semantic=request.cache_semantic.model_dump() if request.cache_semantic else None,
+        context_policy=request.context_policy.model_dump() if request.context_policy else None,
+        priority=request.priority,
+        queue_timeout_ms=request.queue_timeout_ms,
+        max_wait_ms=request.max_wait_ms,
+        **request.tool_args(),
+        **request.logprobs_args(),
+        **request.output_args(),
+        targets=targets,
         cache=state.cache,
         idempotency=state.idempotency,
         request_id=request_id,
@@ -537,9 +1208,61 @@ async def proxy_llm(
         client_profile_name=client_profile_name,
         client_profile_manager=state.client_profile_manager,
     )
+    if mode == "async":
+        # The job outlives the caller's deadline
+        return _submit_llm_job(request, call_args, request_id, api_key, rate, tags)
+    call_args["timeout_ms"] = timeout_ms
+
+    comparison = None
+    if request.compare and not request.dry_run and not (fault and fault.error) and random.random() < (request.compare_sample_rate or 1.0):
+        variant_args, variant_template = _compare_args(request, call_args, targets)
+        # Started before the primary's audit capture, credential choice and
+        # rate limit tracking, so the variant's calls don't count in them. A
+        # named credential belongs to the primary's target.
+        credential_name = request.credential if variant_args["target_name"] == resolved_target else None
+        comparison = asyncio.create_task(
+            _run_comparison(variant_args, credential_name, tenant, api_key, key_limits, tags)
+        )
+
+    created_at = datetime.now(timezone.utc)
+    with capture_attempts((targets.get(resolved_target) or {}).get("audit")) as attempts, select_credentials(
+        request.credential, request.idempotency_key, tenant
+    ) as credential, track_rate_limit() as rate_limit:
+        if fault and fault.error:
+            result = injected_error(fault.error, resolved_target, request_id)
+        else:
+            try:
+                result = await handle_with_cache_mode(handle_llm_proxy_with_fallbacks, kind="llm", **call_args)
+            except BaseException:
+                finish_conversation(turn, request, None, {}, None)
+                raise
+    raw = raw_response_body(result, request.raw_passthrough, "llm")
+    finish_conversation(turn, request, result, targets.get(resolved_target) or {}, resolved_model)
+    if comparison is not None:
+        result.meta.comparison = comparison_meta(result, await comparison, variant_template)
+    stamp_target_version(result.meta, targets)
+    stamp_idempotency_expiry(result.meta, state.idempotency, request.idempotency_key, tenant)
+    result.meta.credential_name = credential.used
+    result.meta.tags = tags
+    _stamp_replay(result.meta)
+    _stamp_upstream_rate_limit(result.meta, rate_limit.last)
+    if fault:
+        result.meta.fault_injected = fault.label
+    else:
+        record_usage(result, "llm", tenant, api_key, key_limits)
+        record_hot_key(state.cache, result, "llm", _replayable(request), tenant)
+    record_audit(
+        result, "llm", resolved_target, targets, tenant, api_key, attempts, created_at,
+        request=_replayable(request),
+    )
+    _check_budget_alerts(tenant, key_limits)
+    _stamp_key_quota(result.meta, key_limits, rate, tenant, call_args["budget_cap_usd"])
+    _stamp_alias(result.meta, alias)
+    _stamp_route(result.meta, route)
+    stamp_template(result.meta, request)
 
     # Record usage for RapidAPI tracking
-    if state.rapidapi_client and api_key:
+    if state.rapidapi_client and api_key and not fault:
         cost_usd = (
             result.data.usage.estimated_cost_usd
             if result.success and result.data and result.data.usage
@@ -560,6 +1283,7 @@ async def proxy_llm(
         result.meta.routellm_route_name = routellm_decision.route_name
         result.meta.routellm_provider_override = routellm_decision.provider
         result.meta.routellm_model_override = routellm_decision.model
+    apply_response_filter(result, request.response_filter, "llm")
 
     # Build response headers including RouteLLM correlation
     response_headers: Dict[str, str] = {
@@ -567,13 +1291,470 @@ async def proxy_llm(
         "X-Cache-Hit": str(result.meta.cache_hit).lower(),
         "X-Retries": str(result.meta.retries),
         "X-Duration-MS": str(result.meta.duration_ms),
+        **_rate_limit_headers(rate),
     }
     if routellm_decision:
         response_headers.update(routellm_decision.to_response_headers())
 
+    if not result.success and result.error.code == ErrorCode.QUEUE_FULL.value:
+        response_headers["Retry-After"] = str(math.ceil(result.error.retry_after_s or 1))
+
     status_code = 200 if result.success else (result.error.status_code or 500)
+    return _proxy_response(result, status_code, response_headers, fault, raw)
+
+
+def _bad_request(message: str, code: ErrorCode = ErrorCode.BAD_REQUEST) -> HTTPException:
+    return HTTPException(
+        status_code=400,
+        detail={"type": "client_error", "code": code.value, "message": message},
+    )
+
+
+def _resolve_alias(
+    target: str, model: Optional[str], targets: Dict[str, Dict], idempotency_key: Optional[str]
+) -> Optional[AliasResolution]:
+    """Resolve model through the target's model aliases, rejecting unknown "alias:" names."""
+    try:
+        return resolve_alias(target, model, targets, idempotency_key)
+    except UnknownAliasError as e:
+        raise _bad_request(str(e))
+
+
+def _resolve_target(
+    target: str, model: Optional[str], targets: Dict[str, Dict], idempotency_key: Optional[str], tenant: Optional[str]
+) -> Tuple[str, Optional[str], Optional[RouteChoice], Optional[AliasResolution]]:
+    """The target and model an LLM request goes to, and the latency route
+    and model alias that sent it there.
+
+    An "auto:<name>" target is first routed to a candidate of the latency
+    route, with the candidate's model, if it names one; unknown routes are
+    rejected. The model then resolves through the aliases of that target.
+    """
+    route = None
+    name = route_name(target)
+    if name is not None:
+        route_config = get_latency_route(name)
+        if route_config is None:
+            raise _bad_request(f"No latency route '{name}'")
+        route = route_by_latency(name, route_config, targets, idempotency_key, tenant)
+        target, model = route.target, route.model or model
+    alias = _resolve_alias(target, model, targets, idempotency_key)
+    if alias:
+        target, model = alias.target, alias.model
+    return target, model, route, alias
+
+
+def _compare_args(
+    request: LLMProxyRequest, call_args: Dict[str, Any], targets: Dict[str, Dict]
+) -> Tuple[Dict[str, Any], Optional[Dict[str, Any]]]:
+    """The handle_llm_proxy_with_fallbacks arguments of the variant of a
+    request sent with compare, and the template ({name, version}) its
+    messages were rendered from.
+
+    The variant runs at batch priority, without fallbacks, and is cached
+    unfiltered under its own key.
+    """
+    compare = request.compare
+    target = compare.target or call_args["target_name"]
+    model = compare.model
+    if model is None and target == call_args["target_name"]:
+        model = call_args["model"]
+    alias = _resolve_alias(target, model, targets, request.idempotency_key)
+    if alias:
+        target, model = alias.target, alias.model
+    if target not in targets:
+        raise _bad_request(f"compare.target: unknown target '{target}'")
+
+    messages, template = call_args["messages"], None
+    if compare.template:
+        ref = compare.template.model_copy()
+        if not ref.variables and request.template:
+            ref.variables = request.template.variables
+        variant = request.model_copy(update={"template": ref})
+        apply_template(variant)
+        messages, template = variant.messages, {"name": ref.name, "version": ref.version}
+
+    key = request.idempotency_key
+    args = dict(
+        call_args,
+        target_name=target,
+        model=model,
+        messages=messages,
+        fallbacks=[],
+        fallback_response=None,
+        priority="batch",
+        idempotency_key=f"{key}:compare" if key else None,
+        cached_filter=None,
+        include_raw=False,
+        request_id=f"{call_args['request_id']}_compare",
+    )
+    return args, template
+
+
+async def _run_comparison(
+    args: Dict[str, Any],
+    credential: Optional[str],
+    tenant: Optional[str],
+    api_key: Optional[str],
+    key_limits: Optional[KeyLimits],
+    tags: Optional[Dict[str, str]] = None,
+) -> Union[SuccessResponse, ErrorResponse]:
+    """Run the variant of a request sent with compare and charge it like
+    any other call, under the primary's tags."""
+    with select_credentials(credential, args["idempotency_key"], tenant):
+        result = await handle_with_cache_mode(handle_llm_proxy_with_fallbacks, kind="llm", **args)
+    result.meta.tags = tags
+    record_usage(result, "llm", tenant, api_key, key_limits)
+    return result
+
+
+def _check_response_filter(expression: Optional[str], field: str = "response_filter") -> None:
+    """Reject a response_filter that doesn't parse, with the position of the error."""
+    if expression is None:
+        return
+    try:
+        parse_response_filter(expression)
+    except FilterSyntaxError as e:
+        raise HTTPException(
+            status_code=400,
+            detail={
+                "success": False,
+                "error": {
+                    "type": "client_error",
+                    "code": ErrorCode.BAD_REQUEST.value,
+                    "message": f"Invalid {field}: {e}",
+                    "retryable": False,
+                    "target": None,
+                    "status_code": 400,
+                    "details": {"field": field, "position": e.position},
+                },
+            },
+        )
+
+
+def _cached_filter(request: Any) -> Optional[str]:
+    """The filter a request's responses are cached under (filter_before_cache)."""
+    return request.response_filter if request.filter_before_cache else None
+
+
+# Time the caller has left for a request, as the Go client forwards it
+DEADLINE_HEADER = "X-ReliAPI-Deadline-Ms"
+
+
+def _deadline_timeout_ms(
+    http_request: Request, timeout_ms: Optional[int], target_config: Optional[Dict]
+) -> Optional[int]:
+    """The timeout_ms a request runs with: its own, shortened to the caller's
+    deadline from the X-ReliAPI-Deadline-Ms header. A deadline past the
+    target's max_timeout_ms is cut to it rather than rejected."""
+    header = http_request.headers.get(DEADLINE_HEADER)
+    if header is None:
+        return timeout_ms
+    try:
+        deadline_ms = int(header)
+    except ValueError:
+        deadline_ms = 0
+    if deadline_ms < 1:
+        raise HTTPException(
+            status_code=400,
+            detail={
+                "type": "client_error",
+                "code": ErrorCode.BAD_REQUEST.value,
+                "message": f"{DEADLINE_HEADER} must be a positive number of milliseconds",
+            },
+        )
+    deadline_ms = min(deadline_ms, (target_config or {}).get("max_timeout_ms") or MAX_TIMEOUT_MS)
+    return deadline_ms if timeout_ms is None else min(timeout_ms, deadline_ms)
+
+
+def _check_credential(targets: Dict[str, Dict], target: str, credential: Optional[str]) -> None:
+    """Reject a pinned credential the target doesn't have or has disabled."""
+    if credential is None or target not in targets:
+        return
+    try:
+        check_credential(target, targets[target], credential)
+    except CredentialError as e:
+        raise _bad_request(str(e), ErrorCode.UNKNOWN_CREDENTIAL)
+
+
+async def _credential_stream(
+    events: AsyncIterator[str], credential: Optional[str], idempotency_key: Optional[str], tenant: Optional[str]
+) -> AsyncIterator[str]:
+    """Relay a stream whose upstream call picks its credential as it starts."""
+    with select_credentials(credential, idempotency_key, tenant):
+        async for event in events:
+            yield event
+
+
+def _stamp_alias(meta: MetaResponse, alias: Optional[AliasResolution]) -> None:
+    """Report where a model alias sent the request."""
+    if alias:
+        meta.resolved_target = alias.target
+        meta.resolved_model = alias.model
+
+
+def _stamp_route(meta: MetaResponse, route: Optional[RouteChoice]) -> None:
+    """Report the candidate a latency route sent the request to."""
+    if route:
+        meta.routed_to = route.target
+
+
+def _stamp_replay(meta: MetaResponse) -> None:
+    """Report the request a replay re-ran."""
+    replay = current_replay()
+    if replay is not None:
+        meta.replay_of = replay.request_id
+
+
+def _stamp_upstream_rate_limit(meta: MetaResponse, limit: Optional[UpstreamRateLimit]) -> None:
+    """Report the rate limit the upstream answered the request with."""
+    if limit:
+        meta.upstream_rate_limit = UpstreamRateLimitMeta(
+            remaining=limit.remaining,
+            reset_at=datetime.fromtimestamp(limit.reset_at, timezone.utc).isoformat(),
+        )
+
+
+async def _check_async_llm_request(request: LLMProxyRequest) -> None:
+    """Reject mode=async requests that can't run as a job."""
+    if request.stream:
+        raise _bad_request("Streaming is not supported for async requests.", ErrorCode.STREAMING_UNSUPPORTED)
+    if request.dry_run:
+        raise _bad_request("dry_run is not supported for async requests.")
+    if request.compare:
+        raise _bad_request("compare is not supported for async requests.")
+    if request.raw_passthrough:
+        raise _bad_request("raw_passthrough is not supported for async requests.")
+    if request.conversation_id:
+        raise _bad_request("conversation_id is not supported for async requests.")
+    if not get_app_state().jobs:
+        raise _bad_request("Async requests are not available on this instance.")
+    if request.callback_url:
+        if not get_webhook_secret():
+            raise _bad_request("callback_url requires RELIAPI_WEBHOOK_SECRET to be configured.")
+        error = await check_base_url(request.callback_url, field="callback_url")
+        if error:
+            raise _bad_request(error)
+
+
+def _submit_llm_job(
+    request: LLMProxyRequest,
+    call_args: Dict[str, Any],
+    request_id: str,
+    api_key: Optional[str],
+    rate: Optional[RateLimitStatus] = None,
+    tags: Optional[Dict[str, str]] = None,
+) -> JSONResponse:
+    """Queue a mode=async request and answer 202 with its job.
+
+    Resubmitting an idempotency_key returns its existing job (meta.idempotent_hit);
+    with a different request body it is an IDEMPOTENCY_CONFLICT.
+    """
+    start_time = time.time()
+    request_hash = hashlib.sha256(
+        json.dumps(request.model_dump(mode="json"), sort_keys=True).encode()
+    ).hexdigest()
+    job, created = submit_llm_job(
+        get_app_state().jobs,
+        request_hash,
+        request.callback_url,
+        get_webhook_secret(),
+        api_key=api_key,
+        alert_config=get_budget_alerts(),
+        credential=request.credential,
+        response_filter=request.response_filter,
+        tags=tags,
+        **call_args,
+    )
+    if job is None:
+        raise HTTPException(
+            status_code=503,
+            detail={
+                "type": "internal_error",
+                "code": ErrorCode.INTERNAL_ERROR.value,
+                "message": "Could not store the job; try again.",
+            },
+        )
+    if not created and job["request_hash"] != request_hash:
+        raise HTTPException(
+            status_code=409,
+            detail={
+                "type": "client_error",
+                "code": ErrorCode.IDEMPOTENCY_CONFLICT.value,
+                "message": f"Idempotency key '{request.idempotency_key}' was used for a different request.",
+            },
+        )
+
+    result = SuccessResponse(
+        success=True,
+        data=public_job(job),
+        meta=MetaResponse(
+            target=request.target,
+            tags=tags,
+            idempotent_hit=not created,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
     return JSONResponse(
         content=result.model_dump(),
-        status_code=status_code,
-        headers=response_headers,
+        status_code=202,
+        headers={
+            "X-Request-ID": request_id,
+            "Location": f"/v1/jobs/{job['job_id']}",
+            **_rate_limit_headers(rate),
+        },
+    )
+
+
+@router.post(
+    "/proxy/llm/batch",
+    summary="Proxy a batch of LLM requests",
+    description=(
+        "Run up to 500 non-streaming LLM requests in one call. "
+        "Each item gets the same idempotency, caching, budget caps and fallbacks "
+        "as /proxy/llm and is reported individually; meta carries the aggregate cost."
+    ),
+)
+async def proxy_llm_batch(
+    request: LLMBatchRequest,
+    http_request: Request,
+) -> JSONResponse:
+    """Batch LLM proxy endpoint."""
+    state = get_app_state()
+    targets = state.targets
+
+    # Verify API key and resolve tenant/tier
+    api_key, tenant, tier = verify_api_key(http_request)
+
+    # Validate API key format
+    _check_api_key_format(api_key)
+
+    for index, item in enumerate(request.requests):
+        if item.stream:
+            raise HTTPException(
+                status_code=400,
+                detail={
+                    "type": "client_error",
+                    "code": "STREAMING_UNSUPPORTED",
+                    "message": "Streaming is not supported in batch requests.",
+                },
+            )
+        if item.compare:
+            raise _bad_request(f"requests[{index}].compare: compare is not supported in batch requests.")
+        if item.raw_passthrough:
+            raise _bad_request(
+                f"requests[{index}].raw_passthrough: raw_passthrough is not supported in batch requests."
+            )
+        if item.conversation_id:
+            raise _bad_request(
+                f"requests[{index}].conversation_id: conversation_id is not supported in batch requests."
+            )
+        _check_response_filter(item.response_filter, f"requests[{index}].response_filter")
+        apply_template(item)
+        # Every item counts against Free tier limits like a single request
+        _check_llm_free_tier_restrictions(http_request, item, api_key, tier)
+    # ... and against the API key's rate limit
+    key_limits = get_key_limits(api_key)
+    rate = _check_key_rate_limit(key_limits, len(request.requests))
+
+    # Generate request ID
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    # Detect client profile
+    client_profile_name = detect_client_profile(http_request, tenant=tenant)
+
+    resolutions = [
+        _resolve_target(item.target, item.model, targets, item.idempotency_key, tenant) for item in request.requests
+    ]
+    batch = await handle_llm_batch(
+        items=[
+            {
+                "fallbacks": [f.model_dump() for f in item.fallbacks or []],
+                "fallback_response": item.fallback_response.model_dump() if item.fallback_response else None,
+                "target_name": item_target,
+                "messages": item.messages,
+                "model": item_model,
+                "max_tokens": item.max_tokens,
+                "temperature": item.temperature,
+                "top_p": item.top_p,
+                "stop": item.stop,
+                "stream": False,
+                "idempotency_key": item.idempotency_key,
+                "idempotency_ttl_s": item.idempotency_ttl_s,
+                "dry_run": item.dry_run,
+                "include_raw": item.include_raw,
+                "cached_filter": _cached_filter(item),
+                "strict": item.strict,
+                "cache_ttl": item.cache,
+                "cache_key": item.cache_key,
+                "cache_vary": item.cache_vary,
+                "cache_mode": item.cache_mode.value,
+                "retry": item.retry.model_dump() if item.retry else None,
+                "max_cost_usd": item.max_cost_usd,
+                "timeout_ms": _deadline_timeout_ms(
+                    http_request, item.timeout_ms, targets.get(item_target)
+                ),
+                "hedge": item.hedge.model_dump() if item.hedge else None,
+                "cache_semantic": item.cache_semantic.model_dump() if item.cache_semantic else None,
+                "context_policy": item.context_policy.model_dump() if item.context_policy else None,
+                "priority": item.priority,
+                "queue_timeout_ms": item.queue_timeout_ms,
+                "max_wait_ms": item.max_wait_ms,
+                **item.tool_args(),
+                **item.logprobs_args(),
+                **item.output_args(),
+            }
+            for item, (item_target, item_model, _, _) in zip(request.requests, resolutions)
+        ],
+        max_parallel=request.max_parallel,
+        fail_fast=request.fail_fast,
+        request_id=request_id,
+        targets=targets,
+        cache=state.cache,
+        idempotency=state.idempotency,
+        tenant=tenant,
+        tier=tier,
+        budget_cap_usd=get_budget_cap(tenant),
+        key_limits=key_limits,
+        key_pool_manager=state.key_pool_manager,
+        rate_scheduler=state.rate_scheduler,
+        client_profile_name=client_profile_name,
+        client_profile_manager=state.client_profile_manager,
+    )
+    for item, item_request, (_, _, route, alias) in zip(batch.results, request.requests, resolutions):
+        _stamp_alias(item.meta, alias)
+        _stamp_route(item.meta, route)
+        stamp_template(item.meta, item_request)
+        stamp_target_version(item.meta, targets)
+        stamp_idempotency_expiry(item.meta, state.idempotency, item_request.idempotency_key, tenant)
+        item.meta.tags = usage_tags(tenant, item_request.tags)
+        record_usage(item, "llm", tenant, api_key, key_limits)
+        apply_response_filter(item, item_request.response_filter, "llm")
+    _check_budget_alerts(tenant, key_limits)
+    # Every item reports the quota left once the whole batch is charged
+    budget_cap_usd = get_budget_cap(tenant)
+    for item in batch.results:
+        _stamp_key_quota(item.meta, key_limits, rate, tenant, budget_cap_usd)
+
+    # Record usage for RapidAPI tracking (one entry per item)
+    if state.rapidapi_client and api_key:
+        for item in batch.results:
+            await state.rapidapi_client.record_usage(
+                api_key=api_key,
+                endpoint="/proxy/llm",
+                latency_ms=item.meta.duration_ms,
+                status="success" if item.success else "error",
+                cost_usd=item.meta.cost_usd or 0.0,
+            )
+        rapidapi_tier_distribution.labels(tier=tier).inc()
+
+    return JSONResponse(
+        content=batch.model_dump(),
+        status_code=200,
+        headers={
+            "X-Request-ID": request_id,
+            "X-Duration-MS": str(batch.meta.duration_ms),
+            **_rate_limit_headers(rate),
+        },
     )
@@ -0,0 +1,83 @@
+"""Replay endpoint.
+
+This module provides:
+- POST /replay/{request_id} - Run an audited proxy request again (admin key)
+
+The request is taken from its audit record (see core.replay) and sent
+through the same route as the original, /proxy/llm or /proxy/http.
+"""
+from contextlib import nullcontext
+from typing import Optional
+
+from fastapi import APIRouter, HTTPException, Request
+from fastapi.responses import Response
+from pydantic import ValidationError
+
+from reliapi.app.dependencies import verify_admin_key
+from reliapi.app.routes.proxy import proxy_http, proxy_llm
+from reliapi.app.schemas import HTTPProxyRequest, LLMProxyRequest, ReplayRequest
+from reliapi.app.services import audit_record
+from reliapi.core.cache import skip_cache_reads
+from reliapi.core.errors import ErrorCode
+from reliapi.core.replay import ReplayUnavailable, replay_body, replaying
+
+router = APIRouter(tags=["Audit"])
+
+
+def _client_error(status_code: int, code: ErrorCode, message: str) -> HTTPException:
+    return HTTPException(
+        status_code=status_code,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": code.value,
+                "message": message,
+                "retryable": False,
+                "status_code": status_code,
+            },
+        },
+    )
+
+
+@router.post(
+    "/replay/{request_id}",
+    summary="Replay a request",
+    description=(
+        "Run a proxied request again from its audit record, optionally with another model, "
+        "temperature or target, and return its response like /proxy/llm or /proxy/http would, "
+        "with meta.replay_of set to request_id. Admin key only. The request must have been "
+        "recorded under its target's audit capture 'full'; requests that weren't, conversation "
+        "turns and /proxy/http requests whose recorded body was redacted fail with "
+        "REPLAY_UNAVAILABLE. A replay runs for the original request's tenant and is billed and "
+        "budgeted as its requests are. It never reuses the original's idempotency key, and it "
+        "isn't served from the cache unless allow_cache is set."
+    ),
+)
+async def replay_request(
+    request_id: str,
+    http_request: Request,
+    overrides: Optional[ReplayRequest] = None,
+) -> Response:
+    """Replay an audited request."""
+    verify_admin_key(http_request)
+    overrides = overrides or ReplayRequest()
+    record = audit_record(request_id, None, admin=True)
+    if record is None:
+        raise _client_error(404, ErrorCode.NOT_FOUND, f"No audit record for request '{request_id}'")
+    try:
+        body = replay_body(record, overrides.model, overrides.temperature, overrides.target)
+        proxy_request = (LLMProxyRequest if record["kind"] == "llm" else HTTPProxyRequest).model_validate(body)
+    except ReplayUnavailable as e:
+        raise _client_error(409, ErrorCode.REPLAY_UNAVAILABLE, f"Request '{request_id}' can't be replayed: {e}")
+    except ValidationError as e:
+        raise _client_error(
+            409, ErrorCode.REPLAY_UNAVAILABLE, f"Request '{request_id}' can't be replayed: it is no longer valid: {e}"
+        )
+    except ValueError as e:
+        raise _client_error(400, ErrorCode.BAD_REQUEST, str(e))
+
+    with replaying(request_id, record["tenant"]), nullcontext() if overrides.allow_cache else skip_cache_reads():
+        if isinstance(proxy_request, LLMProxyRequest):
+            return await proxy_llm(proxy_request, http_request, mode="sync")
+        return await proxy_http(proxy_request, http_request)
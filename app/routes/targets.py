@@ -0,0 +1,487 @@
+"""Target management and inspection endpoints.
+
+This module provides:
+- GET /targets - List targets with their config versions (admin)
+- GET /models - The model capability table requests are validated against
+- PUT /targets/{target} - Register or replace a target (admin)
+- DELETE /targets/{target} - Remove a target (admin)
+- GET /targets/{target}/circuit - Circuit breaker state of a target
+- POST /targets/{target}/circuit/reset - Close a target's circuit breaker (admin)
+- GET /targets/{target}/stats - LLM requests in flight to a target and waiting for it, or
+  the per-candidate latency table of an auto:<name> latency route
+- GET /targets/{target}/check - Probe a target's upstream for reachability, latency and TLS expiry
+- GET /targets/{target}/ratelimit - The rate limits a target's upstream last reported
+- GET /targets/{target}/credentials - A target's named credentials and their health (admin)
+- PUT /targets/{target}/credentials/{name} - Add or replace a named credential (admin)
+- POST /targets/{target}/credentials/{name}/disable - Take a credential out of rotation (admin)
+- POST /targets/{target}/credentials/{name}/enable - Put a credential back in rotation (admin)
+"""
+import logging
+import re
+import time
+import uuid
+from datetime import datetime, timezone
+from typing import Any, Dict, Optional
+
+from fastapi import APIRouter, HTTPException, Request
+from fastapi.responses import JSONResponse
+
+from reliapi.app.dependencies import get_app_state, get_latency_route, verify_admin_key, verify_api_key
+from reliapi.app.schemas import CredentialRequest, MetaResponse, SuccessResponse
+from reliapi.app.services import (
+    add_credential,
+    check_target,
+    circuit_status,
+    credential_status,
+    latency_route_stats,
+    reset_circuit,
+    set_credential_disabled,
+    target_changed,
+    target_stats,
+    upstream_rate_limits,
+)
+from reliapi.config.schema import TargetConfig
+from reliapi.core.errors import ErrorCode
+from reliapi.core.latency_routing import route_name
+from reliapi.core.model_capabilities import table as capability_table
+from reliapi.core.target_registry import VERSION_KEY, check_base_url, delete_target, upsert_target
+
+logger = logging.getLogger(__name__)
+
+router = APIRouter(tags=["Targets"])
+
+_TARGET_NAME = re.compile(r"^[A-Za-z0-9_.-]{1,64}$")
+
+
+def _target_not_found(target: str) -> HTTPException:
+    return HTTPException(
+        status_code=404,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": ErrorCode.NOT_FOUND.value,
+                "message": f"Target '{target}' not found",
+                "retryable": False,
+                "target": None,
+                "status_code": 404,
+            },
+        },
+    )
+
+
+def _target_config(target: str) -> Dict[str, Any]:
+    """Return a target's config or raise a 404."""
+    target_config = get_app_state().targets.get(target)
+    if not target_config:
+        raise _target_not_found(target)
+    return target_config
+
+
+def _invalid_target(target: str, message: str) -> HTTPException:
+    return HTTPException(
+        status_code=400,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": ErrorCode.INVALID_TARGET.value,
+                "message": message,
+                "retryable": False,
+                "target": target,
+                "status_code": 400,
+            },
+        },
+    )
+
+
+def _target_entry(name: str, target_config: Dict[str, Any]) -> Dict[str, Any]:
+    config = {k: v for k, v in target_config.items() if k != VERSION_KEY}
+    return {"name": name, "version": target_config.get(VERSION_KEY), "config": config}
+
+
+def _success(data: Dict[str, Any], request_id: str, start_time: float, target: Optional[str] = None) -> JSONResponse:
+    result = SuccessResponse(
+        success=True,
+        data=data,
+        meta=MetaResponse(
+            target=target,
+            target_version=data.get("version"),
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+def _isoformat(ts: Optional[float]) -> Optional[str]:
+    if ts is None:
+        return None
+    return datetime.fromtimestamp(ts, tz=timezone.utc).isoformat()
+
+
+def _circuit_response(target: str, snapshot: Dict[str, Any], request_id: str, start_time: float) -> JSONResponse:
+    data = dict(snapshot)
+    data["last_failure_at"] = _isoformat(snapshot["last_failure_at"])
+    data["next_probe_at"] = _isoformat(snapshot["next_probe_at"])
+    data["breakers"] = [
+        {
+            **breaker,
+            "last_failure_at": _isoformat(breaker["last_failure_at"]),
+            "next_probe_at": _isoformat(breaker["next_probe_at"]),
+        }
+        for breaker in snapshot["breakers"]
+    ]
+    result = SuccessResponse(
+        success=True,
+        data=data,
+        meta=MetaResponse(
+            target=target,
+            circuit_state=snapshot["state"],
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+@router.get(
+    "/targets",
+    summary="List targets",
+    description=(
+        "List the configured targets, sorted by name, with the version of each one's "
+        "config. Requires the admin API key (RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def list_targets(http_request: Request) -> JSONResponse:
+    """List targets and their configs."""
+    start_time = time.time()
+    verify_admin_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    targets = get_app_state().targets
+    entries = [_target_entry(name, targets[name]) for name in sorted(targets)]
+    return _success({"targets": entries}, request_id, start_time)
+
+
+@router.get(
+    "/models",
+    summary="Get the model capability table",
+    description=(
+        "The context window, output token limit, tool, image and json_schema support, "
+        "sampling parameters and temperature range of known models, matched by their "
+        "longest prefix, which LLM requests are checked against before they are sent. "
+        "targets holds, for targets with llm.models, the capabilities of the models they "
+        "override or add, which take precedence for requests to those targets."
+    ),
+)
+async def get_models(http_request: Request) -> JSONResponse:
+    """The model capability table and the targets' overrides."""
+    start_time = time.time()
+    verify_api_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    targets = get_app_state().targets
+    overrides = {
+        name: capability_table(config["llm"]["models"])
+        for name, config in sorted(targets.items())
+        if (config.get("llm") or {}).get("models")
+    }
+    return _success({"models": capability_table(), "targets": overrides}, request_id, start_time)
+
+
+@router.put(
+    "/targets/{target}",
+    summary="Register or replace a target",
+    description=(
+        "Add a target, or replace its whole config, without restarting the proxy. "
+        "The base URL must not resolve to a private, loopback or link-local address "
+        "unless allow_private_network is set. The target's version is bumped on every "
+        "change; requests already in flight finish with the config they started with. "
+        "Changes are kept in memory only. Requires the admin API key (RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def put_target(target: str, config: TargetConfig, http_request: Request) -> JSONResponse:
+    """Register or replace a target."""
+    start_time = time.time()
+    verify_admin_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    if not _TARGET_NAME.match(target):
+        raise _invalid_target(
+            target, "Target names are 1-64 letters, digits, '_', '.' or '-'"
+        )
+    error = await check_base_url(config.base_url, config.allow_private_network)
+    if error:
+        raise _invalid_target(target, error)
+
+    # No await between reading and publishing the mapping, so concurrent
+    # updates cannot lose each other's changes.
+    state = get_app_state()
+    created = target not in state.targets
+    state.targets, stored = upsert_target(state.targets, target, config.model_dump(exclude_none=True))
+    logger.info(
+        f"Target {'created' if created else 'updated'}: target={target}, "
+        f"version={stored[VERSION_KEY]}, request_id={request_id}"
+    )
+    target_changed(target, stored[VERSION_KEY])
+    data = _target_entry(target, stored)
+    data["created"] = created
+    return _success(data, request_id, start_time, target=target)
+
+
+@router.delete(
+    "/targets/{target}",
+    summary="Remove a target",
+    description=(
+        "Remove a target. New requests for it fail with NOT_FOUND; requests already in "
+        "flight finish normally. Requires the admin API key (RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def delete_target_route(target: str, http_request: Request) -> JSONResponse:
+    """Remove a target."""
+    start_time = time.time()
+    verify_admin_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    target_config = _target_config(target)
+    state = get_app_state()
+    state.targets = delete_target(state.targets, target)
+    logger.info(f"Target deleted: target={target}, request_id={request_id}")
+    target_changed(target, target_config.get(VERSION_KEY), deleted=True)
+    return _success(
+        {"name": target, "version": target_config.get(VERSION_KEY), "deleted": True},
+        request_id,
+        start_time,
+        target=target,
+    )
+
+
+@router.get(
+    "/targets/{target}/circuit",
+    summary="Get a target's circuit breaker state",
+    description=(
+        "Report whether the target's circuit breaker is closed, half-open (failures "
+        "recorded but below the threshold) or open, with its failure count, the last "
+        "failure, when an open circuit lets the next request through, and its thresholds. "
+        "breakers lists the sub-breakers of a target with a model or credential circuit "
+        "scope, each with its key; the target's state is open when any of them is."
+    ),
+)
+async def get_circuit(target: str, http_request: Request) -> JSONResponse:
+    """Circuit breaker status of a target."""
+    start_time = time.time()
+    verify_api_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    snapshot = circuit_status(target, _target_config(target))
+    return _circuit_response(target, snapshot, request_id, start_time)
+
+
+@router.post(
+    "/targets/{target}/circuit/reset",
+    summary="Reset a target's circuit breaker",
+    description=(
+        "Close the target's circuit breakers and clear their failures, e.g. after fixing "
+        "credentials. Requires the admin API key (RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def post_circuit_reset(target: str, http_request: Request) -> JSONResponse:
+    """Close a target's circuit breaker."""
+    start_time = time.time()
+    verify_admin_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    target_config = _target_config(target)
+    reset_circuit(target, target_config)
+    logger.info(f"Circuit reset: target={target}, request_id={request_id}")
+    return _circuit_response(target, circuit_status(target, target_config), request_id, start_time)
+
+
+@router.get(
+    "/targets/{target}/stats",
+    summary="Get a target's in-flight requests",
+    description=(
+        "Report the LLM requests in flight to the target, those waiting for a slot under "
+        "its max_concurrency or a turn in its queue, and the requests that found no free "
+        "slot in time since the proxy started. For an auto:<name> latency route, report "
+        "each candidate's observed P50 and P95 latency, health, expected share of the "
+        "route's requests and the requests routed to it. Counts are per proxy instance."
+    ),
+)
+async def get_stats(target: str, http_request: Request) -> JSONResponse:
+    """In-flight and waiting requests of a target, or a latency route's candidates."""
+    start_time = time.time()
+    verify_api_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    name = route_name(target)
+    if name is not None:
+        route = get_latency_route(name)
+        if route is None:
+            raise _target_not_found(target)
+        stats = latency_route_stats(name, route, get_app_state().targets)
+    else:
+        stats = target_stats(target, _target_config(target))
+    return _success(stats, request_id, start_time, target=target)
+
+
+@router.get(
+    "/targets/{target}/check",
+    summary="Check a target's upstream",
+    description=(
+        "Send a lightweight request with the target's credentials to its upstream (GET /models "
+        "for LLM targets, HEAD on the base URL otherwise) and report its status: ok, "
+        "auth_failed (401/403), degraded (5xx) or unreachable, with the latency and when the "
+        "upstream's TLS certificate expires. The probe is not cached, charged to a budget or "
+        "counted in usage, and does not affect the circuit breaker. A target is probed at "
+        "most every 30 seconds; checks in between return the last result with cached=true."
+    ),
+)
+async def get_check(target: str, http_request: Request) -> JSONResponse:
+    """Reachability of a target's upstream."""
+    start_time = time.time()
+    verify_api_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    result = await check_target(target, _target_config(target), get_app_state().key_pool_manager)
+    return _success(result, request_id, start_time, target=target)
+
+
+@router.get(
+    "/targets/{target}/ratelimit",
+    summary="Get a target's upstream rate limits",
+    description=(
+        "Report the rate limit the target's upstream last returned in its X-RateLimit, "
+        "RateLimit, provider-specific or Retry-After headers, per named credential or key "
+        "pool key: the limit, requests remaining and when it resets. While none remain, "
+        "requests are held until the reset, up to the target's upstream_rate_limit.max_wait_ms. "
+        "Limits are per proxy instance and empty until the upstream has reported one."
+    ),
+)
+async def get_ratelimit(target: str, http_request: Request) -> JSONResponse:
+    """Upstream rate limits of a target."""
+    start_time = time.time()
+    verify_api_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    _target_config(target)
+    limits = upstream_rate_limits(target)
+    for limit in limits:
+        limit["reset_at"] = _isoformat(limit["reset_at"])
+        limit["updated_at"] = _isoformat(limit["updated_at"])
+    return _success({"target": target, "limits": limits}, request_id, start_time, target=target)
+
+
+def _credentials_response(target: str, target_config: Dict[str, Any], request_id: str, start_time: float) -> JSONResponse:
+    credentials = credential_status(target, target_config)
+    for credential in credentials:
+        credential["cooldown_until"] = _isoformat(credential["cooldown_until"])
+    return _success({"target": target, "credentials": credentials}, request_id, start_time, target=target)
+
+
+def _credential_not_found(target: str, name: str) -> HTTPException:
+    return HTTPException(
+        status_code=404,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": ErrorCode.NOT_FOUND.value,
+                "message": f"Target '{target}' has no credential '{name}'",
+                "retryable": False,
+                "target": target,
+                "status_code": 404,
+            },
+        },
+    )
+
+
+@router.get(
+    "/targets/{target}/credentials",
+    summary="List a target's credentials",
+    description=(
+        "List the target's named credentials, without their keys: those configured and "
+        "those added at runtime, with their weight and whether each is active, cooling down "
+        "after repeated 401/429 answers, or disabled. Requires the admin API key "
+        "(RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def list_credentials(target: str, http_request: Request) -> JSONResponse:
+    """Named credentials of a target."""
+    start_time = time.time()
+    verify_admin_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    return _credentials_response(target, _target_config(target), request_id, start_time)
+
+
+@router.put(
+    "/targets/{target}/credentials/{name}",
+    summary="Add a credential to a target",
+    description=(
+        "Add a named credential to the target's rotation, or replace one, without restarting "
+        "the proxy. It starts enabled and healthy. Runtime credentials are kept in memory only. "
+        "Requires the admin API key (RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def put_credential(target: str, name: str, credential: CredentialRequest, http_request: Request) -> JSONResponse:
+    """Add or replace a named credential."""
+    start_time = time.time()
+    verify_admin_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    target_config = _target_config(target)
+    if not _TARGET_NAME.match(name):
+        raise _invalid_target(target, "Credential names are 1-64 letters, digits, '_', '.' or '-'")
+    add_credential(target, name, credential.api_key, credential.weight)
+    logger.info(f"Credential added: target={target}, name={name}, request_id={request_id}")
+    return _credentials_response(target, target_config, request_id, start_time)
+
+
+async def _set_disabled(target: str, name: str, disabled: bool, http_request: Request) -> JSONResponse:
+    start_time = time.time()
+    verify_admin_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    target_config = _target_config(target)
+    if not any(c["name"] == name for c in credential_status(target, target_config)):
+        raise _credential_not_found(target, name)
+    set_credential_disabled(target, name, disabled)
+    logger.info(
+        f"Credential {'disabled' if disabled else 'enabled'}: target={target}, name={name}, request_id={request_id}"
+    )
+    return _credentials_response(target, target_config, request_id, start_time)
+
+
+@router.post(
+    "/targets/{target}/credentials/{name}/disable",
+    summary="Disable a target's credential",
+    description=(
+        "Take a credential out of the target's rotation, e.g. one being revoked. Requests "
+        "pinning it are rejected with UNKNOWN_CREDENTIAL until it is enabled again. Requires "
+        "the admin API key (RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def post_credential_disable(target: str, name: str, http_request: Request) -> JSONResponse:
+    """Take a credential out of rotation."""
+    return await _set_disabled(target, name, True, http_request)
+
+
+@router.post(
+    "/targets/{target}/credentials/{name}/enable",
+    summary="Enable a target's credential",
+    description=(
+        "Put a disabled credential back in the target's rotation. Requires the admin API key "
+        "(RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def post_credential_enable(target: str, name: str, http_request: Request) -> JSONResponse:
+    """Put a credential back in rotation."""
+    return await _set_disabled(target, name, False, http_request)
@@ -0,0 +1,144 @@
+"""Prompt template endpoints.
+
+This module provides:
+- PUT /templates/{name} - Store a new version of a prompt template (admin)
+- GET /templates/{name} - A prompt template, its latest version or a given one
+"""
+import logging
+import re
+import time
+import uuid
+from typing import Any, Dict, Optional
+
+from fastapi import APIRouter, HTTPException, Query, Request
+from fastapi.responses import JSONResponse
+
+from reliapi.app.dependencies import verify_admin_key, verify_api_key
+from reliapi.app.schemas import LLMProxyRequest, MetaResponse, SuccessResponse, TemplateRequest
+from reliapi.app.services import get_template, put_template, render_template
+from reliapi.core.errors import ErrorCode
+from reliapi.core.templates import TemplateVariablesError
+
+logger = logging.getLogger(__name__)
+
+router = APIRouter(tags=["Templates"])
+
+_TEMPLATE_NAME = re.compile(r"^[A-Za-z0-9_.-]{1,64}$")
+
+
+def _client_error(
+    status_code: int, code: ErrorCode, message: str, details: Optional[Dict[str, Any]] = None
+) -> HTTPException:
+    return HTTPException(
+        status_code=status_code,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": code.value,
+                "message": message,
+                "retryable": False,
+                "status_code": status_code,
+                "details": details,
+            },
+        },
+    )
+
+
+def _not_found(name: str, version: Optional[int]) -> HTTPException:
+    what = f"Template '{name}'" if version is None else f"Version {version} of template '{name}'"
+    return _client_error(404, ErrorCode.NOT_FOUND, f"{what} not found")
+
+
+def apply_template(request: LLMProxyRequest) -> None:
+    """Render the messages of a request that names a template in place.
+
+    Raises a 404 for an unknown template or version, and a 400
+    INVALID_TEMPLATE_VARIABLES listing the missing and unknown variables.
+    """
+    ref = request.template
+    if ref is None:
+        return
+    try:
+        rendered = render_template(ref.name, ref.version, ref.variables)
+    except TemplateVariablesError as e:
+        raise _client_error(
+            400,
+            ErrorCode.INVALID_TEMPLATE_VARIABLES,
+            str(e),
+            {"missing": e.missing, "unexpected": e.unexpected},
+        )
+    if rendered is None:
+        raise _not_found(ref.name, ref.version)
+    template, request.messages = rendered
+    # Pin the version so the meta reports the one rendered
+    ref.version = template["version"]
+
+
+def stamp_template(meta: MetaResponse, request: LLMProxyRequest) -> None:
+    """Report the template a request's messages were rendered from."""
+    if request.template:
+        meta.template_name = request.template.name
+        meta.template_version = request.template.version
+
+
+def _respond(data: Dict[str, Any], start_time: float) -> JSONResponse:
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+    result = SuccessResponse(
+        success=True,
+        data=data,
+        meta=MetaResponse(
+            template_name=data["name"],
+            template_version=data["version"],
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
+
+
+@router.put(
+    "/templates/{name}",
+    summary="Store a prompt template",
+    description=(
+        "Store messages with {{variable}} placeholders as the next version of a prompt "
+        "template, starting at 1. Earlier versions stay available to requests that pin "
+        "one. Templates are kept in memory only. Requires the admin API key "
+        "(RELIAPI_ADMIN_KEY)."
+    ),
+)
+async def put_template_route(name: str, template: TemplateRequest, http_request: Request) -> JSONResponse:
+    """Store a new version of a prompt template."""
+    start_time = time.time()
+    verify_admin_key(http_request)
+    if not _TEMPLATE_NAME.match(name):
+        raise _client_error(400, ErrorCode.BAD_REQUEST, "Template names are 1-64 letters, digits, '_', '.' or '-'")
+
+    stored = put_template(name, [m.model_dump() for m in template.messages], template.description)
+    logger.info(f"Template stored: name={name}, version={stored['version']}")
+    return _respond(stored, start_time)
+
+
+@router.get(
+    "/templates/{name}",
+    summary="Get a prompt template",
+    description=(
+        "Return the latest version of a prompt template, or the given version, with its "
+        "messages and the variables a request must set."
+    ),
+)
+async def get_template_route(
+    name: str,
+    http_request: Request,
+    version: Optional[int] = Query(None, ge=1),
+) -> JSONResponse:
+    """A version of a prompt template."""
+    start_time = time.time()
+    verify_api_key(http_request)
+    template = get_template(name, version)
+    if template is None:
+        raise _not_found(name, version)
+    return _respond(template, start_time)
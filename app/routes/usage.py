@@ -0,0 +1,122 @@
+"""Usage reporting endpoints.
+
+This module provides:
+- GET /usage - Request counts, tokens and spend of the caller's tenant, grouped and paginated
+"""
+import csv
+import io
+import time
+import uuid
+from datetime import datetime, timezone
+from typing import List, Optional
+
+from fastapi import APIRouter, HTTPException, Query, Request
+from fastapi.responses import JSONResponse, Response
+
+from reliapi.app.dependencies import verify_api_key
+from reliapi.app.schemas import MetaResponse, SuccessResponse
+from reliapi.app.services import USAGE_MAX_PAGE_SIZE, USAGE_PAGE_SIZE, usage_report
+from reliapi.core.budget import month_bounds
+from reliapi.core.errors import ErrorCode
+from reliapi.core.usage import GROUP_BY_FIELDS, UsageCounts, is_group_by_field
+
+router = APIRouter(tags=["Usage"])
+
+# Counter columns of a CSV report, after the group_by columns.
+_COUNTER_COLUMNS = list(UsageCounts.__dataclass_fields__)
+
+
+def _bad_request(message: str) -> HTTPException:
+    return HTTPException(
+        status_code=400,
+        detail={
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": ErrorCode.BAD_REQUEST.value,
+                "message": message,
+                "retryable": False,
+                "status_code": 400,
+            },
+        },
+    )
+
+
+def _parse_group_by(group_by: Optional[str]) -> List[str]:
+    fields = [f.strip() for f in (group_by or "").split(",") if f.strip()]
+    unknown = [f for f in fields if not is_group_by_field(f)]
+    if unknown:
+        raise _bad_request(
+            f"Cannot group usage by {', '.join(unknown)}; use {', '.join(GROUP_BY_FIELDS)} or tag.<key>"
+        )
+    return list(dict.fromkeys(fields))
+
+
+def _as_utc(moment: datetime) -> datetime:
+    return moment.replace(tzinfo=timezone.utc) if moment.tzinfo is None else moment
+
+
+def _csv_report(report: dict) -> str:
+    out = io.StringIO()
+    writer = csv.DictWriter(out, fieldnames=report["group_by"] + _COUNTER_COLUMNS, lineterminator="\n")
+    writer.writeheader()
+    writer.writerows(report["rows"])
+    return out.getvalue()
+
+
+@router.get(
+    "/usage",
+    summary="Get the caller's usage",
+    description=(
+        "Report the requests, tokens and cost of the caller's tenant between from and to "
+        "(default: the current calendar month, UTC), widened to whole hours. group_by is a "
+        "comma-separated list of target, model, api_key_prefix, kind and tag.<key>, the "
+        "value of a request tag, null for requests without it; without it the report is a "
+        "single row. Cache and idempotency hits are counted apart from "
+        "billable_requests and carry no tokens or cost. Embedded tokens are counted as "
+        "embedding_tokens, apart from prompt_tokens. Pass next_cursor back as cursor, with "
+        "the same query, for the next page. With Accept: text/csv the page is returned as CSV and the cursor "
+        "in the X-Next-Cursor header. Usage is tracked per ReliAPI instance."
+    ),
+)
+async def get_usage(
+    http_request: Request,
+    from_: Optional[datetime] = Query(None, alias="from"),
+    to: Optional[datetime] = Query(None),
+    group_by: Optional[str] = Query(None),
+    limit: int = Query(USAGE_PAGE_SIZE, ge=1, le=USAGE_MAX_PAGE_SIZE),
+    cursor: Optional[str] = Query(None),
+) -> Response:
+    """Usage report of the caller's tenant."""
+    start_time = time.time()
+    _, tenant, _ = verify_api_key(http_request)
+    request_id = f"req_{uuid.uuid4().hex[:16]}"
+
+    now = datetime.now(timezone.utc)
+    start = _as_utc(from_) if from_ else month_bounds(now)[0]
+    end = _as_utc(to) if to else now
+    if end <= start:
+        raise _bad_request("'to' must be after 'from'")
+    try:
+        report = usage_report(tenant, start, end, _parse_group_by(group_by), limit, cursor)
+    except ValueError as e:
+        raise _bad_request(str(e))
+
+    if "text/csv" in http_request.headers.get("accept", ""):
+        headers = {"X-Request-ID": request_id}
+        if report["next_cursor"]:
+            headers["X-Next-Cursor"] = report["next_cursor"]
+        return Response(content=_csv_report(report), media_type="text/csv", headers=headers)
+
+    result = SuccessResponse(
+        success=True,
+        data=report,
+        meta=MetaResponse(
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+    return JSONResponse(
+        content=result.model_dump(),
+        headers={"X-Request-ID": request_id},
+    )
@@ -5,10 +5,22 @@ This module provides Pydantic models for:
 - LLM proxy requests and responses
 - Error and metadata structures
 """
+import base64
+import binascii
 from enum import Enum
 from typing import Any, Dict, List, Literal, Optional, Union
 
-from pydantic import BaseModel, Field, field_validator
+from pydantic import BaseModel, Field, field_validator, model_validator
+
+from reliapi.core.json_schema import SchemaError, check_schema
+from reliapi.core.multipart import MAX_MULTIPART_BYTES, encode_multipart
+from reliapi.core.query import normalize_query
+from reliapi.core.usage import validate_tags
+
+# Request fields that may be listed in cache_vary. Target and method (HTTP) or
+# target and model (LLM) always participate in the cache key.
+HTTP_CACHE_VARY_FIELDS = {"path", "query", "headers", "body"}
+LLM_CACHE_VARY_FIELDS = {"messages", "max_tokens", "temperature", "top_p", "stop"}
 
 
 class HTTPMethod(str, Enum):
@@ -29,6 +41,7 @@ class MessageRole(str, Enum):
     SYSTEM = "system"
     USER = "user"
     ASSISTANT = "assistant"
+    TOOL = "tool"
 
 
 class CostPolicy(str, Enum):
@@ -37,6 +50,17 @@ class CostPolicy(str, Enum):
     NONE = "none"
     SOFT_CAP_THROTTLED = "soft_cap_throttled"
     HARD_CAP_REJECTED = "hard_cap_rejected"
+    MAX_COST_REJECTED = "max_cost_rejected"
+    BUDGET_REJECTED = "budget_rejected"
+
+
+class CacheMode(str, Enum):
+    """Cache read modes."""
+
+    STANDARD = "standard"
+    STALE_WHILE_REVALIDATE = "stale_while_revalidate"
+    STALE_IF_ERROR = "stale_if_error"
+    ONLY_IF_CACHED = "only_if_cached"
 
 
 class ErrorSource(str, Enum):
@@ -53,6 +77,40 @@ class ChatMessage(BaseModel):
     content: str = Field(..., description="Message content")
 
 
+class MultipartPart(BaseModel):
+    """One part of a multipart/form-data request body."""
+
+    name: str = Field(..., min_length=1, description="Form field name")
+    filename: Optional[str] = Field(None, description="File name, for file parts")
+    content_type: Optional[str] = Field(None, description="Content-Type of the part, e.g. image/png")
+    value: Optional[str] = Field(None, description="Text value of a plain form field")
+    data_base64: Optional[str] = Field(None, description="Contents of a file part as base64")
+
+    @model_validator(mode="after")
+    def validate_data(self) -> "MultipartPart":
+        """A part carries exactly one of value and data_base64."""
+        if (self.value is None) == (self.data_base64 is None):
+            raise ValueError(f"multipart part '{self.name}' must set exactly one of value and data_base64")
+        if self.data_base64 is not None:
+            try:
+                base64.b64decode(self.data_base64, validate=True)
+            except binascii.Error as e:
+                raise ValueError(f"multipart part '{self.name}' data_base64 is not valid base64: {e}") from None
+        return self
+
+    def data(self) -> bytes:
+        """The part's contents."""
+        if self.data_base64 is not None:
+            return base64.b64decode(self.data_base64)
+        return (self.value or "").encode()
+
+
+class MultipartBody(BaseModel):
+    """A multipart/form-data body the proxy encodes for the upstream."""
+
+    parts: List[MultipartPart] = Field(..., min_length=1, description="Parts, in order")
+
+
 class HTTPProxyRequest(BaseModel):
     """Request schema for POST /proxy/http.
 
@@ -77,11 +135,34 @@ class HTTPProxyRequest(BaseModel):
         None, description="HTTP headers to include in request"
     )
     query: Optional[Dict[str, Any]] = Field(
-        None, description="Query parameters (e.g., {'page': 1, 'limit': 10})"
+        None,
+        description=(
+            "Query parameters (e.g., {'page': 1, 'tag': ['a', 'b']}). Values are strings, "
+            "numbers, booleans, null or flat lists of those; nested objects are rejected."
+        ),
+    )
+    query_array_format: Literal["repeat", "comma", "bracket"] = Field(
+        "repeat",
+        description="How list query values are sent: tag=a&tag=b, tag=a,b or tag[]=a&tag[]=b",
     )
     body: Optional[str] = Field(
         None, description="Request body as JSON string (for POST/PUT/PATCH)"
     )
+    body_encoding: Literal["utf8", "base64"] = Field(
+        "utf8",
+        description="How body is encoded: utf8 text, or base64 for binary uploads",
+    )
+    multipart: Optional[MultipartBody] = Field(
+        None,
+        description=(
+            "multipart/form-data body built by the proxy, boundary included; replaces body. "
+            f"At most {MAX_MULTIPART_BYTES} bytes decoded. Multipart requests are never cached."
+        ),
+    )
+    body_base64: Optional[str] = Field(
+        None,
+        description="Binary request body as base64; shorthand for body with body_encoding=base64",
+    )
     idempotency_key: Optional[str] = Field(
         None,
         description=(
@@ -89,6 +170,21 @@ class HTTPProxyRequest(BaseModel):
             "Concurrent requests with same key execute once."
         ),
     )
+    credential: Optional[str] = Field(
+        None,
+        description=(
+            "Name of the target credential to send, overriding rotation. Unknown or "
+            "disabled names are rejected with UNKNOWN_CREDENTIAL."
+        ),
+    )
+    idempotency_ttl_s: Optional[int] = Field(
+        None,
+        gt=0,
+        description=(
+            "Seconds the idempotency key is honored (default: the response's cache TTL); "
+            "at most the target's idempotency_max_ttl_s"
+        ),
+    )
     cache: Optional[int] = Field(
         None,
         ge=0,
@@ -97,6 +193,160 @@ class HTTPProxyRequest(BaseModel):
             "Only applies to GET/HEAD requests."
         ),
     )
+    cache_key: Optional[str] = Field(
+        None,
+        min_length=1,
+        max_length=256,
+        description=(
+            "Explicit cache key. Replaces the request-derived key; "
+            "target and method still participate."
+        ),
+    )
+    cache_vary: Optional[List[str]] = Field(
+        None,
+        description=(
+            "Request fields that participate in the cache key "
+            "(any of: path, query, headers, body). Ignored if cache_key is set."
+        ),
+    )
+    cache_mode: CacheMode = Field(
+        CacheMode.STANDARD,
+        description=(
+            "standard: expired entries are misses. stale_while_revalidate: serve an "
+            "expired entry immediately and refresh it in the background. "
+            "stale_if_error: serve an expired entry only if the upstream call fails. "
+            "only_if_cached: serve a fresh entry or fail with CACHE_MISS, never calling the upstream. "
+            "Only applies to GET/HEAD requests."
+        ),
+    )
+    retry: Optional[RetryPolicy] = Field(
+        None, description="Retry policy for this request, overriding the target's retry_matrix"
+    )
+    if_none_match: Optional[str] = Field(
+        None,
+        description=(
+            "ETag(s) the caller already has. If the response's ETag matches (weak comparison), "
+            "data is empty and meta.not_modified is set."
+        ),
+    )
+    response_headers: Optional[List[str]] = Field(
+        None,
+        description=(
+            "Upstream response headers to return in meta.upstream_headers "
+            "(e.g., ['ETag', 'Link']), or ['*'] for all. Hop-by-hop headers are never returned."
+        ),
+    )
+    follow_redirects: Optional[bool] = Field(
+        None,
+        description=(
+            "Follow upstream redirects, overriding the target's follow_redirects. "
+            "Unfollowed 3xx responses are returned as they are, with their Location header."
+        ),
+    )
+    max_redirects: Optional[int] = Field(
+        None, ge=0, le=20, description="Most redirects to follow, overriding the target's max_redirects"
+    )
+    timeout_ms: Optional[int] = Field(
+        None,
+        gt=0,
+        le=300000,
+        description=(
+            "Deadline for the upstream call in milliseconds, retries included, up to the "
+            "target's max_timeout_ms. Fails with UPSTREAM_TIMEOUT when it passes."
+        ),
+    )
+    stream_response: bool = Field(
+        False,
+        description=(
+            "Relay the upstream body as a raw chunked stream instead of the JSON envelope, "
+            "with meta in X-ReliAPI-* response headers. For large downloads."
+        ),
+    )
+    max_response_bytes: Optional[int] = Field(
+        None,
+        gt=0,
+        description=(
+            "Largest upstream body to return, overriding the target's max_response_bytes. "
+            "Larger bodies fail with RESPONSE_TOO_LARGE unless truncate_response is set."
+        ),
+    )
+    truncate_response: bool = Field(
+        False,
+        description=(
+            "Return the first max_response_bytes of a larger body, with meta.truncated set, "
+            "instead of failing. Truncated responses are never cached."
+        ),
+    )
+    dry_run: bool = Field(
+        False,
+        description=(
+            "Validate the request, check budgets and compute its cache key without calling "
+            "the upstream: data is null and meta.dry_run is set. Nothing is charged or cached."
+        ),
+    )
+    response_filter: Optional[str] = Field(
+        None,
+        max_length=2048,
+        description=(
+            "Fields of the upstream JSON body to return, dropping the rest, as comma-separated "
+            "paths such as 'items[*].id, next' (see core.response_filter). "
+            "meta.original_bytes and meta.filtered_bytes report the savings."
+        ),
+    )
+    filter_before_cache: bool = Field(
+        False,
+        description=(
+            "Cache the filtered body instead of the full one, under a key of its own. "
+            "Saves cache memory, but the entry only serves requests with the same response_filter."
+        ),
+    )
+    raw_passthrough: bool = Field(
+        False,
+        description=(
+            "Return the upstream body byte for byte as data, instead of the {status_code, headers, body} "
+            "object: as it is if it is JSON, else as a base64 string (meta.response_encoding). The "
+            "status and headers are in meta.upstream_status and meta.upstream_headers. Cached and "
+            "replayed responses keep the bytes too. Not supported with response_filter or stream_response."
+        ),
+    )
+    tags: Optional[Dict[str, str]] = Field(
+        None,
+        description=(
+            "Labels the request's usage and cost are attributed to, e.g. {\"feature\": \"search\"}: "
+            "at most 10, keys of letters, digits, '_' and '-'. GET /usage groups by them as "
+            "group_by=tag.<key>; meta.tags echoes the tags the request was counted under."
+        ),
+    )
+
+    @field_validator("tags")
+    @classmethod
+    def validate_tags(cls, v: Optional[Dict[str, str]]) -> Optional[Dict[str, str]]:
+        """Bound the number and size of tags."""
+        return validate_tags(v) if v is not None else v
+
+    @field_validator("cache_vary")
+    @classmethod
+    def validate_cache_vary(cls, v: Optional[List[str]]) -> Optional[List[str]]:
+        """Validate cache_vary only names known request fields."""
+        if v is not None:
+            unknown = set(v) - HTTP_CACHE_VARY_FIELDS
+            if unknown:
+                raise ValueError(
+                    f"Invalid cache_vary fields: {sorted(unknown)}. "
+                    f"Must be among {sorted(HTTP_CACHE_VARY_FIELDS)}"
+                )
+        return v
+
+    @field_validator("response_headers")
+    @classmethod
+    def validate_response_headers(cls, v: Optional[List[str]]) -> Optional[List[str]]:
+        """Lower-case header names; "*" selects every header."""
+        if v is not None:
+            names = [name.strip().lower() for name in v]
+            if any(not name for name in names):
+                raise ValueError("response_headers must not contain empty names")
+            return names
+        return v
 
     @field_validator("method")
     @classmethod
@@ -108,6 +358,339 @@ class HTTPProxyRequest(BaseModel):
             raise ValueError(f"Invalid HTTP method: {v}. Must be one of {valid_methods}")
         return v
 
+    @model_validator(mode="after")
+    def normalize_query(self) -> "HTTPProxyRequest":
+        """Bring query values into their canonical form (see core/query.py).
+
+        Normalizing here keeps the upstream URL, cache keys and cache
+        invalidation in agreement about what a query means.
+        """
+        self.query = normalize_query(self.query, self.query_array_format)
+        return self
+
+    @model_validator(mode="after")
+    def normalize_body(self) -> "HTTPProxyRequest":
+        """Fold body_base64 into body and check base64 bodies decode."""
+        if self.body_base64 is not None:
+            if self.body is not None:
+                raise ValueError("Set body or body_base64, not both")
+            self.body = self.body_base64
+            self.body_encoding = "base64"
+            self.body_base64 = None
+        if self.body_encoding == "base64" and self.body is not None:
+            try:
+                base64.b64decode(self.body, validate=True)
+            except binascii.Error as e:
+                raise ValueError(f"body is not valid base64: {e}") from None
+        return self
+
+    @model_validator(mode="after")
+    def encode_multipart_body(self) -> "HTTPProxyRequest":
+        """Encode multipart into body and its Content-Type header."""
+        if self.multipart is None:
+            return self
+        if self.body is not None:
+            raise ValueError("Set body or multipart, not both")
+        if self.method not in ("POST", "PUT", "PATCH"):
+            raise ValueError("multipart requires method POST, PUT or PATCH")
+        parts = [(p.name, p.filename, p.content_type, p.data()) for p in self.multipart.parts]
+        size = sum(len(data) for _, _, _, data in parts)
+        if size > MAX_MULTIPART_BYTES:
+            raise ValueError(f"multipart body is {size} bytes, more than the {MAX_MULTIPART_BYTES} allowed")
+        body, content_type = encode_multipart(parts)
+        headers = {k: v for k, v in (self.headers or {}).items() if k.lower() != "content-type"}
+        headers["Content-Type"] = content_type
+        self.headers = headers
+        self.body = base64.b64encode(body).decode()
+        self.body_encoding = "base64"
+        return self
+
+    @model_validator(mode="after")
+    def validate_stream_response(self) -> "HTTPProxyRequest":
+        """Streamed responses are never stored, so they can't be replayed."""
+        if self.stream_response:
+            if self.idempotency_key is not None:
+                raise ValueError("idempotency_key is not supported with stream_response")
+            if self.cache_mode != CacheMode.STANDARD:
+                raise ValueError("stream_response requires cache_mode 'standard'")
+            if self.max_response_bytes is not None or self.truncate_response:
+                raise ValueError("max_response_bytes and truncate_response are not supported with stream_response")
+            if self.response_filter is not None:
+                raise ValueError("response_filter is not supported with stream_response")
+        return self
+
+    @model_validator(mode="after")
+    def validate_raw_passthrough(self) -> "HTTPProxyRequest":
+        """A raw body is sent untouched, so it can't be filtered or streamed."""
+        if self.raw_passthrough:
+            if self.response_filter is not None:
+                raise ValueError("response_filter is not supported with raw_passthrough")
+            if self.stream_response:
+                raise ValueError("raw_passthrough is not supported with stream_response")
+        return self
+
+
+class RetryPolicy(BaseModel):
+    """Per-request retry policy overriding the target's retry_matrix."""
+
+    max_attempts: int = Field(
+        ...,
+        ge=1,
+        le=10,
+        description="Upstream calls in total, including the first; 1 disables retries",
+    )
+    backoff_ms: int = Field(
+        1000, ge=0, description="Delay before the first retry, doubled for each further retry"
+    )
+    max_backoff_ms: int = Field(60000, ge=0, description="Upper bound for a single retry delay")
+    retry_on: List[int] = Field(
+        default_factory=lambda: [429, 500, 502, 503, 504],
+        description="Upstream statuses to retry; network errors and timeouts are always retried",
+    )
+
+    @field_validator("retry_on")
+    @classmethod
+    def validate_retry_on(cls, v: List[int]) -> List[int]:
+        """Validate retry_on only lists HTTP error statuses."""
+        invalid = [code for code in v if not 400 <= code <= 599]
+        if invalid:
+            raise ValueError(f"retry_on must list 4xx/5xx statuses, got {invalid}")
+        return v
+
+
+class HedgePolicy(BaseModel):
+    """Backup requests for a latency-critical LLM call."""
+
+    delay_ms: int = Field(
+        ..., ge=1, le=60000, description="Wait before each backup request while no answer has arrived"
+    )
+    max_hedges: int = Field(1, ge=1, le=3, description="Most backup requests sent in addition to the first")
+
+
+class SemanticCacheConfig(BaseModel):
+    """Serving cached LLM answers to differently worded prompts."""
+
+    threshold: float = Field(
+        ..., gt=0, lt=1, description="Cosine similarity a cached prompt must exceed to be served"
+    )
+    embedding_model: Optional[str] = Field(
+        None, description="Model that embeds the prompts; defaults to the target's embedding_model"
+    )
+
+
+class ContextPolicy(BaseModel):
+    """What to do with a message history over a prompt token budget."""
+
+    max_prompt_tokens: int = Field(..., ge=1, description="Most prompt tokens to send, counted for the target model")
+    strategy: Literal["error", "truncate_oldest", "truncate_middle"] = Field(
+        "error",
+        description=(
+            "error: reject the request with CONTEXT_LENGTH_EXCEEDED. truncate_oldest: drop the "
+            "oldest messages first. truncate_middle: drop messages closest to the middle of the "
+            "conversation first. System messages and the last user message are never dropped."
+        ),
+    )
+
+
+class GraphQLProxyRequest(BaseModel):
+    """Request schema for POST /proxy/graphql.
+
+    Queries are cached by their normalized document and variables, so
+    formatting and field or variable order don't split the cache; mutations
+    are never cached but may use an idempotency key.
+    """
+
+    target: str = Field(..., description="Target name from config.yaml")
+    query: str = Field(..., min_length=1, description="GraphQL document")
+    operation_name: Optional[str] = Field(
+        None, description="Operation to execute; required if the document has several"
+    )
+    variables: Optional[Dict[str, Any]] = Field(None, description="Values of the operation's variables")
+    path: str = Field("/graphql", description="Path of the target's GraphQL endpoint")
+    headers: Optional[Dict[str, str]] = Field(None, description="HTTP headers to include in request")
+    idempotency_key: Optional[str] = Field(
+        None, description="Idempotency key; concurrent requests with the same key execute once"
+    )
+    cache: Optional[int] = Field(
+        None, ge=0, description="Cache TTL in seconds (overrides config default). Only applies to queries."
+    )
+    retry: Optional[RetryPolicy] = Field(
+        None, description="Retry policy for this request, overriding the target's retry_matrix"
+    )
+
+
+class EmbeddingsRequest(BaseModel):
+    """Request schema for POST /proxy/embeddings.
+
+    Inputs are cached one by one, so a batch where most inputs were
+    embedded before only pays for the rest.
+    """
+
+    target: str = Field(..., description="LLM target name from config.yaml")
+    input: Union[str, List[str]] = Field(..., description="Text or list of texts to embed")
+    model: Optional[str] = Field(
+        None, description="Embedding model (defaults to the target's embedding_model)"
+    )
+    dimensions: Optional[int] = Field(None, ge=1, description="Size of the vectors, if the model supports it")
+    input_type: Optional[Literal["query", "document"]] = Field(
+        None,
+        description="Whether the inputs are search queries or the documents searched, for models "
+        "that embed them differently; others ignore it",
+    )
+    idempotency_key: Optional[str] = Field(
+        None, description="Idempotency key; concurrent requests with the same key execute once"
+    )
+    cache: Optional[int] = Field(None, ge=0, description="Cache TTL in seconds (overrides config default)")
+    retry: Optional[RetryPolicy] = Field(
+        None, description="Retry policy for this request, overriding the target's retry_matrix"
+    )
+
+    @field_validator("input")
+    @classmethod
+    def validate_input(cls, v: Union[str, List[str]]) -> List[str]:
+        """Normalize a single text to a list and reject empty input."""
+        inputs = [v] if isinstance(v, str) else v
+        if not inputs:
+            raise ValueError("input must not be empty")
+        if any(not text for text in inputs):
+            raise ValueError("input must not contain empty strings")
+        return inputs
+
+
+class FallbackTarget(BaseModel):
+    """Fallback entry for POST /proxy/llm."""
+
+    target: str = Field(..., description="LLM target name to fall back to")
+    model: Optional[str] = Field(
+        None,
+        description="Model to use on the fallback target (uses its default if omitted)",
+    )
+
+
+class FallbackResponse(BaseModel):
+    """Static completion for POST /proxy/llm to return when every target fails."""
+
+    content: str = Field(..., min_length=1, description="Text of the static completion")
+    finish_reason: str = Field("stop", description="finish_reason of the static completion")
+
+
+def _validate_content_parts(index: int, parts: List[Any]) -> None:
+    """Check a multimodal content array in OpenAI's format.
+
+    Parts are {"type": "text", "text"} or {"type": "image_url", "image_url":
+    {"url", "detail"?}}, where url is http(s) or a base64 data URL.
+    """
+    if not parts:
+        raise ValueError(f"messages[{index}]: content must not be an empty list")
+    for j, part in enumerate(parts):
+        where = f"messages[{index}].content[{j}]"
+        kind = part.get("type") if isinstance(part, dict) else None
+        if kind == "text":
+            if not isinstance(part.get("text"), str):
+                raise ValueError(f"{where}: text must be a string")
+        elif kind == "image_url":
+            image = part.get("image_url")
+            url = image.get("url") if isinstance(image, dict) else None
+            if not isinstance(url, str) or not url.startswith(("https://", "http://", "data:image/")):
+                raise ValueError(f"{where}: image_url.url must be an http(s) URL or an image data URL")
+            if url.startswith("data:") and ";base64," not in url:
+                raise ValueError(f"{where}: image data URLs must be base64")
+            if image.get("detail") not in (None, "low", "high", "auto"):
+                raise ValueError(f"{where}: image_url.detail must be low, high or auto")
+        else:
+            raise ValueError(f"{where}: type must be text or image_url")
+
+
+class ToolFunction(BaseModel):
+    """Function a model may call, in OpenAI's format."""
+
+    name: str = Field(
+        ..., min_length=1, max_length=64, pattern=r"^[A-Za-z0-9_-]+$", description="Function name"
+    )
+    description: Optional[str] = Field(None, description="What the function does, for the model")
+    parameters: Optional[Dict[str, Any]] = Field(
+        None, description="JSON Schema of the function's arguments"
+    )
+
+
+class ToolDefinition(BaseModel):
+    """Tool offered to the model. Only function tools exist."""
+
+    type: Literal["function"] = Field("function", description="Tool type")
+    function: ToolFunction = Field(..., description="The function")
+
+
+class ResponseFormat(BaseModel):
+    """Output format requested from the model, in OpenAI's format."""
+
+    type: Literal["text", "json_object", "json_schema"] = Field(..., description="Output format")
+    json_schema: Optional[Dict[str, Any]] = Field(
+        None, description="{name, schema, strict} for type json_schema"
+    )
+
+    @model_validator(mode="after")
+    def validate_json_schema(self) -> "ResponseFormat":
+        """json_schema is given exactly for type json_schema."""
+        if (self.type == "json_schema") != (self.json_schema is not None):
+            raise ValueError("json_schema is required for, and only allowed with, type json_schema")
+        return self
+
+
+class TemplateMessage(BaseModel):
+    """Message of a prompt template; content may hold {{variable}} placeholders."""
+
+    role: Literal["system", "user", "assistant"] = Field(..., description="Message role")
+    content: str = Field(..., description="Message text with {{variable}} placeholders")
+
+
+class TemplateRequest(BaseModel):
+    """Request schema for PUT /templates/{name}."""
+
+    messages: List[TemplateMessage] = Field(..., min_length=1, description="Messages of the template")
+    description: Optional[str] = Field(None, max_length=1024, description="What the template is for")
+
+
+class CredentialRequest(BaseModel):
+    """Request schema for PUT /targets/{target}/credentials/{name}."""
+
+    api_key: str = Field(..., min_length=1, description="API key sent upstream")
+    weight: float = Field(1.0, gt=0, description="Share of requests relative to the target's other credentials")
+
+
+class TemplateRef(BaseModel):
+    """Prompt template an LLM request is rendered from."""
+
+    name: str = Field(..., min_length=1, description="Template name")
+    version: Optional[int] = Field(None, ge=1, description="Template version (default: the latest)")
+    variables: Dict[str, str] = Field(
+        default_factory=dict,
+        description="Values of the template's placeholders; missing and unknown names are rejected",
+    )
+
+
+class CompareConfig(BaseModel):
+    """Variant of an LLM request run alongside it to compare their answers.
+
+    Fields left unset are the request's own; a model of another target
+    defaults to that target's default_model.
+    """
+
+    target: Optional[str] = Field(None, description="Target of the variant")
+    model: Optional[str] = Field(None, description="Model of the variant; aliases are resolved")
+    template: Optional[TemplateRef] = Field(
+        None,
+        description=(
+            "Template the variant's messages are rendered from. Without variables it "
+            "takes those of the request's template."
+        ),
+    )
+
+    @model_validator(mode="after")
+    def validate_variant(self) -> "CompareConfig":
+        if self.target is None and self.model is None and self.template is None:
+            raise ValueError("compare needs a target, model or template")
+        return self
+
 
 class LLMProxyRequest(BaseModel):
     """Request schema for POST /proxy/llm.
@@ -124,21 +707,55 @@ class LLMProxyRequest(BaseModel):
 
     target: str = Field(
         ...,
-        description="LLM target name from config.yaml (e.g., 'openai', 'anthropic')",
+        description=(
+            "LLM target name from config.yaml (e.g., 'openai', 'anthropic'), or 'auto:<name>' "
+            "for a latency route, sent to the fastest healthy of its candidates "
+            "(meta.routed_to)"
+        ),
     )
-    messages: List[Dict[str, str]] = Field(
-        ...,
+    messages: Optional[List[Dict[str, Any]]] = Field(
+        None,
         min_length=1,
         description=(
             "Messages list with 'role' and 'content' "
-            "(e.g., [{'role': 'user', 'content': 'Hello'}])"
+            "(e.g., [{'role': 'user', 'content': 'Hello'}]). Assistant messages may "
+            "carry tool_calls, and tool messages answer one by tool_call_id. "
+            "Required unless template or conversation_id is set."
+        ),
+    )
+    conversation_id: Optional[str] = Field(
+        None,
+        min_length=1,
+        max_length=128,
+        pattern=r"^[A-Za-z0-9_.:-]+$",
+        description=(
+            "Continue a conversation whose history the proxy keeps (GET /conversations/{id}): "
+            "append_messages are sent after it and, with the reply, stored as its next turn "
+            "once the request succeeds. An unknown ID starts a conversation. A request while "
+            "another turn of it runs fails with CONVERSATION_CONFLICT; meta.conversation_tokens "
+            "estimates the stored history's prompt tokens."
+        ),
+    )
+    append_messages: Optional[List[Dict[str, Any]]] = Field(
+        None,
+        min_length=1,
+        description="The new messages of a conversation_id request, in place of messages",
+    )
+    template: Optional[TemplateRef] = Field(
+        None,
+        description=(
+            "Render the messages from a stored prompt template (PUT /templates/{name}) "
+            "instead of sending them; meta.template_name and meta.template_version report "
+            "the template used."
         ),
     )
     model: Optional[str] = Field(
         None,
         description=(
             "Model name (e.g., 'gpt-4o-mini', 'claude-3-haiku'). "
-            "Uses default from config if not specified."
+            "Uses default from config if not specified. A name of one of the target's "
+            "model_aliases, or 'alias:<name>', is resolved to the alias's target and model "
+            "(meta.resolved_target, meta.resolved_model)."
         ),
     )
     max_tokens: Optional[int] = Field(
@@ -163,39 +780,613 @@ class LLMProxyRequest(BaseModel):
     stop: Optional[List[str]] = Field(
         None, description="Stop sequences (e.g., ['\\n', 'END'])"
     )
+    max_cost_usd: Optional[float] = Field(
+        None,
+        ge=0.0,
+        description=(
+            "Reject the request with BUDGET_EXCEEDED if its estimated cost (model pricing and "
+            "max_tokens) exceeds this. An estimate equal to it is allowed; models without "
+            "pricing are not checked."
+        ),
+    )
     stream: bool = Field(
         False,
         description=(
             "Streaming mode. If true, returns Server-Sent Events (SSE) stream. "
-            "If false or omitted, returns standard JSON response."
+            "If false or omitted, returns standard JSON response. Streamed and plain "
+            "requests share cache entries; a hit is replayed as a stream."
         ),
     )
-    idempotency_key: Optional[str] = Field(
-        None,
+    dry_run: bool = Field(
+        False,
         description=(
-            "Idempotency key for request coalescing. "
-            "Use same key for duplicate requests to avoid duplicate LLM calls."
+            "Validate the request, check budgets and compute its cache key and cost estimate without calling "
+            "the upstream: data is null and meta.dry_run is set. Nothing is charged or cached."
         ),
     )
-    cache: Optional[int] = Field(
+    include_raw: bool = Field(
+        False,
+        description=(
+            "Return the provider's response as it was, before it was normalized to the OpenAI-like "
+            "shape, in meta.raw_provider_response. Not set on cache hits, idempotent replays or streams."
+        ),
+    )
+    response_filter: Optional[str] = Field(
         None,
-        ge=0,
+        max_length=2048,
         description=(
-            "Cache TTL in seconds (overrides config default). "
-            "Cached responses return instantly without LLM call."
+            "Fields of data to return, dropping the rest, as comma-separated paths such as "
+            "'content, usage' (see core.response_filter). Not supported with stream. "
+            "meta.original_bytes and meta.filtered_bytes report the savings."
         ),
     )
-
-
-class TokenUsage(BaseModel):
-    """Token usage statistics for LLM responses."""
-
-    prompt_tokens: int = Field(..., ge=0, description="Number of tokens in the prompt")
-    completion_tokens: int = Field(
-        ..., ge=0, description="Number of tokens in the completion"
+    filter_before_cache: bool = Field(
+        False,
+        description=(
+            "Cache the filtered data instead of the full one, under a key of its own. "
+            "Saves cache memory, but the entry only serves requests with the same response_filter."
+        ),
     )
-    total_tokens: int = Field(..., ge=0, description="Total tokens used")
-    estimated_cost_usd: Optional[float] = Field(
+    raw_passthrough: bool = Field(
+        False,
+        description=(
+            "Return the provider's response body byte for byte as data, instead of the normalized "
+            "completion: as it is if it is JSON, else as a base64 string (meta.response_encoding). "
+            "Cached and replayed responses keep the bytes too. Not supported with stream, "
+            "response_filter, compare, mode=async or in batches."
+        ),
+    )
+    strict: bool = Field(
+        True,
+        description=(
+            "Reject a request outside what its model accepts, such as a max_tokens over its output "
+            "limit or a temperature for a model without one, with MODEL_LIMITS_EXCEEDED listing each "
+            "field and its allowed range (details.issues). When false, max_tokens and temperature are "
+            "clamped and unsupported sampling parameters dropped instead, as meta.adjustments reports; "
+            "what can't be fixed, like a prompt over the context window, still fails. See GET /models."
+        ),
+    )
+    compare: Optional[CompareConfig] = Field(
+        None,
+        description=(
+            "Also run this variant of the request, at batch priority, and report its answer, cost, "
+            "latency and similarity to the primary in meta.comparison. data is the primary's. "
+            "Both legs are charged. Not supported with stream or mode=async."
+        ),
+    )
+    compare_sample_rate: Optional[float] = Field(
+        None,
+        gt=0,
+        le=1,
+        description="Fraction of requests the comparison runs for (default: all)",
+    )
+    idempotency_key: Optional[str] = Field(
+        None,
+        description=(
+            "Idempotency key for request coalescing. "
+            "Use same key for duplicate requests to avoid duplicate LLM calls."
+        ),
+    )
+    credential: Optional[str] = Field(
+        None,
+        description=(
+            "Name of the target credential to send, overriding rotation. Unknown or "
+            "disabled names are rejected with UNKNOWN_CREDENTIAL. Fallback targets "
+            "without it rotate as usual."
+        ),
+    )
+    idempotency_ttl_s: Optional[int] = Field(
+        None,
+        gt=0,
+        description=(
+            "Seconds the idempotency key is honored (default: the response's cache TTL); "
+            "at most the target's idempotency_max_ttl_s"
+        ),
+    )
+    cache: Optional[int] = Field(
+        None,
+        ge=0,
+        description=(
+            "Cache TTL in seconds (overrides config default). "
+            "Cached responses return instantly without LLM call."
+        ),
+    )
+    cache_key: Optional[str] = Field(
+        None,
+        min_length=1,
+        max_length=256,
+        description=(
+            "Explicit cache key. Replaces the request-derived key; "
+            "target and model still participate, so changing either busts the cache."
+        ),
+    )
+    cache_vary: Optional[List[str]] = Field(
+        None,
+        description=(
+            "Request fields that participate in the cache key (any of: messages, "
+            "max_tokens, temperature, top_p, stop), e.g. to ignore temperature "
+            "jitter. Ignored if cache_key is set."
+        ),
+    )
+    cache_mode: CacheMode = Field(
+        CacheMode.STANDARD,
+        description=(
+            "standard: expired entries are misses. stale_while_revalidate: serve an "
+            "expired entry immediately and refresh it in the background. "
+            "stale_if_error: serve an expired entry only if the upstream call fails "
+            "after retries. only_if_cached: serve a fresh entry or fail with CACHE_MISS, "
+            "never calling the upstream. Ignored for streaming."
+        ),
+    )
+    cache_semantic: Optional[SemanticCacheConfig] = Field(
+        None,
+        description=(
+            "On an exact cache miss, serve the recent cached answer whose final user message "
+            "is most similar to this one, if above threshold. Only entries of the same target, "
+            "model, system prompt, temperature and tools match. Embedding the message is billed "
+            "like an embeddings request. Not supported for streaming."
+        ),
+    )
+    fallbacks: Optional[List[FallbackTarget]] = Field(
+        None,
+        max_length=5,
+        description=(
+            "Targets to try in order when the primary fails with a retryable "
+            "upstream error (429, 5xx, circuit open). Never used for 4xx errors. "
+            "Ignored for streaming and Free tier."
+        ),
+    )
+    fallback_response: Optional[FallbackResponse] = Field(
+        None,
+        description=(
+            "Static completion returned when the primary and every fallback fail with a "
+            "retryable error, overriding the target's fallback_response. It costs nothing, "
+            "is never cached, and reports the failure in meta.upstream_error. Ignored for streaming."
+        ),
+    )
+    retry: Optional[RetryPolicy] = Field(
+        None,
+        description=(
+            "Retry policy for this request, overriding the target's retry_matrix. "
+            "Applies to each target of the fallback chain. Ignored for streaming."
+        ),
+    )
+    tools: Optional[List[ToolDefinition]] = Field(
+        None,
+        max_length=128,
+        description=(
+            "Functions the model may call, in OpenAI's format; translated for Anthropic "
+            "targets. Calls are returned in data.tool_calls. Not supported for streaming."
+        ),
+    )
+    tool_choice: Optional[Union[Literal["auto", "none", "required"], Dict[str, Any]]] = Field(
+        None,
+        description=(
+            "auto, none, required, or {'type': 'function', 'function': {'name': ...}} "
+            "to force one function"
+        ),
+    )
+    response_format: Optional[ResponseFormat] = Field(
+        None,
+        description=(
+            "Output format: text, json_object or json_schema, whose schema models with "
+            "structured outputs are constrained to (see response_format_fallback for the "
+            "others). Anthropic targets get json_object as a system instruction."
+        ),
+    )
+    response_format_fallback: Literal["error", "json_mode"] = Field(
+        "error",
+        description=(
+            "What to do with a json_schema response_format for a model without structured "
+            "outputs, such as Anthropic's or gpt-4-turbo: fail with UNSUPPORTED_PARAMETER "
+            "naming the model (error), or ask for a JSON object with the schema in the "
+            "system prompt (json_mode)"
+        ),
+    )
+    logprobs: Optional[bool] = Field(
+        None,
+        description=(
+            "Return the log probability of each generated token, as data.logprobs (per chunk "
+            "when streaming). Only models that support it take it; others fail with "
+            "MODEL_LIMITS_EXCEEDED."
+        ),
+    )
+    top_logprobs: Optional[int] = Field(
+        None,
+        ge=0,
+        le=20,
+        description="With logprobs, how many of the likeliest alternatives to return at each token",
+    )
+
+    timeout_ms: Optional[int] = Field(
+        None,
+        gt=0,
+        le=300000,
+        description=(
+            "Deadline for the upstream call in milliseconds, retries included, up to the "
+            "target's max_timeout_ms. Fails with UPSTREAM_TIMEOUT when it passes. For "
+            "streaming it bounds each wait for the next chunk."
+        ),
+    )
+    hedge: Optional[HedgePolicy] = Field(
+        None,
+        description=(
+            "Send identical backup requests after delay_ms and use the first answer; the others "
+            "are canceled. Requires an idempotency_key or a target with caching enabled. "
+            "Not supported for streaming."
+        ),
+    )
+    priority: Literal["interactive", "default", "batch"] = Field(
+        "default",
+        description=(
+            "Priority class in the target's queue when its rate budget is exhausted: interactive "
+            "requests go before default ones, and default before batch."
+        ),
+    )
+    queue_timeout_ms: Optional[int] = Field(
+        None,
+        gt=0,
+        le=300000,
+        description=(
+            "How long to wait in the target's queue, instead of its queue.timeout_ms. Fails with "
+            "QUEUE_FULL when it passes."
+        ),
+    )
+    max_wait_ms: Optional[int] = Field(
+        None,
+        gt=0,
+        le=300000,
+        description=(
+            "How long to wait for a slot under the target's max_concurrency, instead of its "
+            "concurrency_wait_ms. Fails with CONCURRENCY_LIMIT when it passes."
+        ),
+    )
+    context_policy: Optional[ContextPolicy] = Field(
+        None,
+        description=(
+            "Fit the messages to max_prompt_tokens before sending, instead of letting the provider "
+            "reject an oversized prompt. What was dropped is reported in meta.trimmed_messages."
+        ),
+    )
+    callback_url: Optional[str] = Field(
+        None,
+        max_length=2048,
+        description=(
+            "With mode=async, URL that receives a signed job.completed event with the result "
+            "when the job finishes. Must be a public http(s) URL."
+        ),
+    )
+
+    output_schema: Optional[Dict[str, Any]] = Field(
+        None,
+        description="JSON Schema the completion content must match; used when validate_output is set",
+    )
+    validate_output: bool = Field(
+        False,
+        description=(
+            "Validate the completion content against output_schema. Invalid output is never "
+            "cached; it fails with OUTPUT_VALIDATION_FAILED unless a repair attempt succeeds."
+        ),
+    )
+    repair_attempts: int = Field(
+        0,
+        ge=0,
+        le=3,
+        description=(
+            "Times to re-prompt the model with the validation errors before failing. Each "
+            "attempt is a billed upstream call."
+        ),
+    )
+    tags: Optional[Dict[str, str]] = Field(
+        None,
+        description=(
+            "Labels the request's usage and cost are attributed to, e.g. {\"feature\": \"search\"}: "
+            "at most 10, keys of letters, digits, '_' and '-'. GET /usage groups by them as "
+            "group_by=tag.<key>; meta.tags echoes the tags the request was counted under."
+        ),
+    )
+
+    def tool_args(self) -> Dict[str, Any]:
+        """tools, tool_choice, response_format and its fallback as
+        handle_llm_proxy takes them."""
+        response_format = self.response_format
+        return {
+            "tools": [tool.model_dump(exclude_none=True) for tool in self.tools] if self.tools else None,
+            "tool_choice": self.tool_choice,
+            "response_format": response_format.model_dump(exclude_none=True) if response_format else None,
+            "response_format_fallback": self.response_format_fallback,
+        }
+
+    def logprobs_args(self) -> Dict[str, Any]:
+        """logprobs and top_logprobs as handle_llm_proxy takes them."""
+        return {"logprobs": self.logprobs, "top_logprobs": self.top_logprobs}
+
+    def output_args(self) -> Dict[str, Any]:
+        """Output validation settings as handle_llm_proxy takes them: an
+        output_schema only when validate_output is set."""
+        return {
+            "output_schema": self.output_schema if self.validate_output else None,
+            "repair_attempts": self.repair_attempts,
+        }
+
+    @field_validator("messages")
+    @classmethod
+    def validate_messages(cls, v: Optional[List[Dict[str, Any]]]) -> Optional[List[Dict[str, Any]]]:
+        """Content is text or, for user messages, text and image parts; only
+        assistant messages may hold tool_calls instead."""
+        for i, msg in enumerate(v or []):
+            content = msg.get("content")
+            tool_calls = msg.get("tool_calls")
+            if tool_calls is not None:
+                if msg.get("role") != "assistant" or not isinstance(tool_calls, list):
+                    raise ValueError(f"messages[{i}]: tool_calls must be a list on an assistant message")
+                if content is None:
+                    continue
+            if isinstance(content, list) and msg.get("role") == "user":
+                _validate_content_parts(i, content)
+            elif not isinstance(content, str):
+                raise ValueError(f"messages[{i}]: content must be a string")
+            for key, value in msg.items():
+                if key not in ("content", "tool_calls") and not isinstance(value, str):
+                    raise ValueError(f"messages[{i}]: {key} must be a string")
+        return v
+
+    @field_validator("tool_choice")
+    @classmethod
+    def validate_tool_choice(cls, v: Any) -> Any:
+        """A dict tool_choice names the function it forces."""
+        if isinstance(v, dict):
+            function = v.get("function")
+            if v.get("type") != "function" or not isinstance(function, dict) or not function.get("name"):
+                raise ValueError(
+                    "tool_choice must be auto, none, required or "
+                    "{'type': 'function', 'function': {'name': ...}}"
+                )
+        return v
+
+    @model_validator(mode="after")
+    def validate_template(self) -> "LLMProxyRequest":
+        """Messages are sent or rendered from a template, not both."""
+        if (self.messages is None) == (self.template is None) and self.conversation_id is None:
+            raise ValueError("Exactly one of messages and template is required")
+        return self
+
+    @model_validator(mode="after")
+    def validate_conversation(self) -> "LLMProxyRequest":
+        """A conversation turn appends to the stored history, once the whole reply is in."""
+        if (self.conversation_id is None) != (self.append_messages is None):
+            raise ValueError("conversation_id and append_messages are set together")
+        if self.conversation_id is not None:
+            if self.messages is not None or self.template is not None:
+                raise ValueError("conversation_id takes append_messages instead of messages or template")
+            if self.stream:
+                raise ValueError("conversation_id is not supported for streaming requests")
+            if self.compare is not None:
+                raise ValueError("compare is not supported with conversation_id")
+        return self
+
+    @model_validator(mode="after")
+    def validate_tools(self) -> "LLMProxyRequest":
+        """Tools can't be streamed, and a forced function must be offered."""
+        if self.tools and self.stream:
+            raise ValueError("tools are not supported for streaming requests")
+        if isinstance(self.tool_choice, dict):
+            name = self.tool_choice["function"]["name"]
+            if name not in {tool.function.name for tool in self.tools or []}:
+                raise ValueError(f"tool_choice names function '{name}', which is not in tools")
+        return self
+
+    @model_validator(mode="after")
+    def validate_logprobs(self) -> "LLMProxyRequest":
+        """Alternatives come with the logprobs of the tokens they're for."""
+        if self.top_logprobs is not None and not self.logprobs:
+            raise ValueError("top_logprobs requires logprobs")
+        return self
+
+    @model_validator(mode="after")
+    def validate_output_schema(self) -> "LLMProxyRequest":
+        """validate_output needs a usable schema and a complete, text answer."""
+        if not self.validate_output:
+            return self
+        if self.output_schema is None:
+            raise ValueError("validate_output requires output_schema")
+        try:
+            check_schema(self.output_schema)
+        except SchemaError as e:
+            raise ValueError(f"output_schema: {e}") from e
+        if self.stream:
+            raise ValueError("validate_output is not supported for streaming requests")
+        if self.tools:
+            raise ValueError("validate_output can't be combined with tools")
+        return self
+
+    @model_validator(mode="after")
+    def validate_hedge(self) -> "LLMProxyRequest":
+        """Backup requests race whole completions, which a stream can't do."""
+        if self.hedge and self.stream:
+            raise ValueError("hedge is not supported for streaming requests")
+        return self
+
+    @model_validator(mode="after")
+    def validate_compare(self) -> "LLMProxyRequest":
+        """A comparison reports a whole answer, which a stream never has."""
+        if self.compare is not None and self.stream:
+            raise ValueError("compare is not supported for streaming requests")
+        return self
+
+    @model_validator(mode="after")
+    def validate_response_filter(self) -> "LLMProxyRequest":
+        """Filters select fields of the whole data, which a stream sends in pieces."""
+        if self.response_filter is not None and self.stream:
+            raise ValueError("response_filter is not supported for streaming requests")
+        return self
+
+    @model_validator(mode="after")
+    def validate_raw_passthrough(self) -> "LLMProxyRequest":
+        """The provider's body is sent untouched and whole."""
+        if self.raw_passthrough:
+            if self.stream:
+                raise ValueError("raw_passthrough is not supported for streaming requests")
+            if self.response_filter is not None:
+                raise ValueError("response_filter is not supported with raw_passthrough")
+            if self.compare is not None:
+                raise ValueError("compare is not supported with raw_passthrough")
+        return self
+
+    @model_validator(mode="after")
+    def validate_cache_semantic(self) -> "LLMProxyRequest":
+        """Streams are never served from the cache."""
+        if self.cache_semantic and self.stream:
+            raise ValueError("cache_semantic is not supported for streaming requests")
+        return self
+
+    @model_validator(mode="after")
+    def validate_callback_url(self) -> "LLMProxyRequest":
+        """Only async jobs call back, and those never stream."""
+        if self.callback_url and self.stream:
+            raise ValueError("callback_url is not supported for streaming requests")
+        return self
+
+    @field_validator("cache_vary")
+    @classmethod
+    def validate_cache_vary(cls, v: Optional[List[str]]) -> Optional[List[str]]:
+        """Validate cache_vary only names known request fields."""
+        if v is not None:
+            unknown = set(v) - LLM_CACHE_VARY_FIELDS
+            if unknown:
+                raise ValueError(
+                    f"Invalid cache_vary fields: {sorted(unknown)}. "
+                    f"Must be among {sorted(LLM_CACHE_VARY_FIELDS)}"
+                )
+        return v
+
+    @field_validator("tags")
+    @classmethod
+    def validate_tags(cls, v: Optional[Dict[str, str]]) -> Optional[Dict[str, str]]:
+        """Bound the number and size of tags."""
+        return validate_tags(v) if v is not None else v
+
+
+class LLMBatchRequest(BaseModel):
+    """Request schema for POST /proxy/llm/batch.
+
+    Runs several non-streaming LLM requests in one call. Each item is handled
+    exactly like POST /proxy/llm (idempotency, cache, budget caps, fallbacks)
+    and reported individually, in request order.
+    """
+
+    requests: List[LLMProxyRequest] = Field(
+        ..., min_length=1, max_length=500, description="LLM requests to run"
+    )
+    max_parallel: int = Field(
+        8, ge=1, le=64, description="Maximum number of items processed concurrently"
+    )
+    fail_fast: bool = Field(
+        False,
+        description=(
+            "Stop starting new items after the first failure. "
+            "Items not started are reported with code BATCH_ABORTED."
+        ),
+    )
+
+
+class CacheInvalidateRequest(BaseModel):
+    """Request schema for DELETE /cache.
+
+    Identify the entry either by the cache key echoed in meta.cache_key or by
+    the original /proxy/http or /proxy/llm request body. Only entries of the
+    caller's tenant are removed.
+    """
+
+    cache_key: Optional[str] = Field(
+        None, description="Cache key hash from a previous response's meta.cache_key"
+    )
+    http: Optional[HTTPProxyRequest] = Field(
+        None, description="Original /proxy/http request body"
+    )
+    llm: Optional[LLMProxyRequest] = Field(
+        None, description="Original /proxy/llm request body"
+    )
+
+    @model_validator(mode="after")
+    def validate_single_ref(self) -> "CacheInvalidateRequest":
+        """Validate that exactly one way of identifying the entry is given."""
+        given = [v for v in (self.cache_key, self.http, self.llm) if v is not None]
+        if len(given) != 1:
+            raise ValueError("Exactly one of cache_key, http or llm must be set")
+        if self.llm is not None and self.llm.conversation_id is not None:
+            raise ValueError("A conversation turn's entry is identified by its meta.cache_key")
+        return self
+
+
+class CacheWarmItem(BaseModel):
+    """A request to precompute into the cache: a /proxy/http or a /proxy/llm body."""
+
+    http: Optional[HTTPProxyRequest] = Field(None, description="/proxy/http request body (GET or HEAD)")
+    llm: Optional[LLMProxyRequest] = Field(None, description="/proxy/llm request body")
+
+    @model_validator(mode="after")
+    def validate_single_request(self) -> "CacheWarmItem":
+        """Validate that exactly one request is given, and that it can be cached."""
+        if (self.http is None) == (self.llm is None):
+            raise ValueError("Exactly one of http or llm must be set")
+        if self.http is not None:
+            if self.http.method.upper() not in ("GET", "HEAD"):
+                raise ValueError("Only GET and HEAD responses are cached")
+            if self.http.stream_response or self.http.dry_run:
+                raise ValueError("stream_response and dry_run can't be warmed")
+        elif self.llm.stream or self.llm.dry_run or self.llm.conversation_id:
+            raise ValueError("stream, dry_run and conversation_id can't be warmed")
+        return self
+
+
+class CacheWarmRequest(BaseModel):
+    """Request schema for POST /cache/warm.
+
+    The items run in the background at batch priority, are stored in the
+    cache as the same requests sent to /proxy/http or /proxy/llm would be,
+    and count against the same budget caps and rate limits. Items already
+    cached are skipped. Progress is polled at GET /cache/warm/{job_id}.
+    """
+
+    items: List[CacheWarmItem] = Field(..., min_length=1, max_length=500, description="Requests to warm")
+    max_parallel: int = Field(4, ge=1, le=64, description="Maximum number of items run concurrently")
+    max_cost_usd: Optional[float] = Field(
+        None,
+        gt=0,
+        description=(
+            "Cost ceiling of the job. LLM items whose estimate exceeds what is left of it fail with "
+            "BUDGET_EXCEEDED, and once it is spent the items not started are aborted."
+        ),
+    )
+
+
+class ReplayRequest(BaseModel):
+    """Request schema for POST /replay/{request_id}: overrides of the replayed request."""
+
+    model: Optional[str] = Field(None, description="Model to replay an LLM request with")
+    temperature: Optional[float] = Field(
+        None, ge=0.0, le=2.0, description="Sampling temperature to replay an LLM request with"
+    )
+    target: Optional[str] = Field(None, description="Target to send the replay to")
+    allow_cache: bool = Field(
+        False,
+        description=(
+            "Let the replay be served from the cache. By default it always goes upstream, "
+            "refreshing the entry it would have read."
+        ),
+    )
+
+
+class TokenUsage(BaseModel):
+    """Token usage statistics for LLM responses."""
+
+    prompt_tokens: int = Field(..., ge=0, description="Number of tokens in the prompt")
+    completion_tokens: int = Field(
+        ..., ge=0, description="Number of tokens in the completion"
+    )
+    total_tokens: int = Field(..., ge=0, description="Total tokens used")
+    estimated_cost_usd: Optional[float] = Field(
         None, ge=0, description="Estimated cost in USD"
     )
 
@@ -209,6 +1400,14 @@ class LLMResponseData(BaseModel):
     finish_reason: Optional[str] = Field(
         None, description="Reason for completion (stop, length, etc.)"
     )
+    tool_calls: Optional[List[Dict[str, Any]]] = Field(
+        None,
+        description="Function calls requested by the model, as {id, type, function: {name, arguments}}",
+    )
+    logprobs: Optional[List[Dict[str, Any]]] = Field(
+        None,
+        description="With logprobs, each generated token as {token, logprob, top_logprobs}",
+    )
 
 
 class ErrorDetail(BaseModel):
@@ -235,17 +1434,183 @@ class ErrorDetail(BaseModel):
     )
 
 
+class UpstreamRateLimitMeta(BaseModel):
+    """Upstream rate limit reported with a response."""
+
+    remaining: int = Field(..., ge=0, description="Requests the credential has left before the reset")
+    reset_at: str = Field(..., description="When the upstream's limit resets (ISO 8601)")
+
+
+class ComparisonMeta(BaseModel):
+    """The variant leg of a request sent with compare."""
+
+    target: Optional[str] = Field(None, description="Target that answered the variant")
+    model: Optional[str] = Field(None, description="Model of the variant")
+    template_name: Optional[str] = Field(None, description="Template the variant was rendered from")
+    template_version: Optional[int] = Field(None, description="Version of that template")
+    success: bool = Field(..., description="Whether the variant succeeded")
+    content: Optional[str] = Field(None, description="The variant's completion")
+    finish_reason: Optional[str] = Field(None, description="Why the variant's completion ended")
+    usage: Optional[Dict[str, Any]] = Field(None, description="The variant's token usage")
+    cost_usd: Optional[float] = Field(None, description="What the variant cost; 0 when cached")
+    duration_ms: int = Field(0, description="How long the variant took")
+    cache_hit: bool = Field(False, description="Whether the variant was served from the cache")
+    cache_key: Optional[str] = Field(None, description="Cache key of the variant")
+    similarity: Optional[float] = Field(
+        None,
+        ge=0,
+        le=1,
+        description="Token-level similarity of the two completions, 1 for identical; null unless both succeeded",
+    )
+    error: Optional[ErrorDetail] = Field(None, description="Why the variant failed")
+
+
 class MetaResponse(BaseModel):
     """Metadata in response."""
 
     target: Optional[str] = Field(None, description="Target name")
     provider: Optional[str] = Field(None, description="Provider name (for LLM)")
     model: Optional[str] = Field(None, description="Model name (for LLM)")
+    deployment: Optional[str] = Field(
+        None, description="Azure OpenAI deployment the model was served by, from the target's llm.azure.deployments"
+    )
     cache_hit: bool = Field(False, description="Whether response was from cache")
+    cache_stored: Optional[bool] = Field(
+        None,
+        description=(
+            "Whether the response was admitted to the cache; false when it was too large for every "
+            "cache tier. Null when it wasn't offered to the cache"
+        ),
+    )
+    cache_key: Optional[str] = Field(
+        None, description="Resolved cache key hash, for debugging unexpected misses"
+    )
     idempotent_hit: bool = Field(
         False, description="Whether response was from idempotency cache"
     )
+    stale: bool = Field(
+        False, description="Whether a cached response past its TTL was served"
+    )
+    cache_age_s: Optional[int] = Field(
+        None, ge=0, description="Age of the cached response in seconds (cache hits only)"
+    )
+    revalidation_error: Optional[ErrorDetail] = Field(
+        None,
+        description="Upstream error that caused a stale response to be served (stale_if_error)",
+    )
     retries: int = Field(0, ge=0, description="Number of retries")
+    attempts: Optional[int] = Field(
+        None, ge=0, description="Upstream calls made, including retries"
+    )
+    retry_delays_ms: Optional[List[int]] = Field(
+        None, description="Delay before each retry in milliseconds"
+    )
+    attempts_skipped_for_deadline: Optional[int] = Field(
+        None, ge=0, description="Retries not made because they couldn't finish before the request's deadline"
+    )
+    circuit_state: Optional[str] = Field(
+        None, description="Circuit breaker state when it caused the error (open)"
+    )
+    circuit_key: Optional[str] = Field(
+        None,
+        description=(
+            "Circuit breaker that governed the request: the target, or <target>:model=<model> "
+            "and <target>:credential=<name> under a model or credential circuit scope"
+        ),
+    )
+    target_version: Optional[int] = Field(
+        None, ge=1, description="Version of the target config the request ran with"
+    )
+    response_encoding: Optional[str] = Field(
+        None,
+        description=(
+            "How a /proxy/http data.body is encoded: utf8, or base64 for binary responses; "
+            "with raw_passthrough, how data itself is"
+        ),
+    )
+    raw_passthrough: Optional[bool] = Field(
+        None, description="Whether data is the upstream body as it was sent, with raw_passthrough"
+    )
+    revalidated: bool = Field(
+        False,
+        description="Whether an expired cache entry was revalidated with the upstream (304) and reused",
+    )
+    not_modified: bool = Field(
+        False,
+        description="Whether the response matched the request's if_none_match; data is then empty",
+    )
+    upstream_status: Optional[int] = Field(
+        None, description="Status code of the upstream response (for /proxy/http)"
+    )
+    upstream_headers: Optional[Dict[str, List[str]]] = Field(
+        None,
+        description=(
+            "Upstream response headers named in the request's response_headers, "
+            "lower-cased, with every value of repeated headers"
+        ),
+    )
+    redirect_chain: Optional[List[str]] = Field(
+        None,
+        description="URLs requested when upstream redirects were followed: the original, then each redirect",
+    )
+    idempotency_first_seen_at: Optional[str] = Field(
+        None, description="When the idempotency key was first used (ISO 8601), on idempotent hits"
+    )
+    idempotency_replay_count: Optional[int] = Field(
+        None, ge=1, description="How many times the idempotency key has been replayed, this replay included"
+    )
+    idempotency_ttl_s: Optional[int] = Field(
+        None, ge=1, description="Seconds the idempotency key is honored from its first use"
+    )
+    truncated: Optional[bool] = Field(
+        None, description="The upstream body was cut to max_response_bytes (truncate_response)"
+    )
+    dry_run: Optional[bool] = Field(
+        None, description="The request was a dry_run: validated and priced, but not sent upstream"
+    )
+    cache_entry_exists: Optional[bool] = Field(
+        None, description="Whether a fresh cache entry exists for the request's cache_key (dry runs only)"
+    )
+    upstream_request: Optional[Dict[str, Any]] = Field(
+        None,
+        description=(
+            "The request a /proxy/http dry run would send upstream, once the target's transformation "
+            "rules applied: method, url, headers, query and body (dry runs only)"
+        ),
+    )
+    transformations_applied: Optional[List[str]] = Field(
+        None,
+        description=(
+            "Transformation rules of the target applied to the request and response, e.g. "
+            "header:X-Tenant, path_rule:0, path_prefix, request_body, response_extract"
+        ),
+    )
+    replay_of: Optional[str] = Field(
+        None, description="The request_id of the request this response replayed (POST /replay)"
+    )
+    original_content_length: Optional[int] = Field(
+        None, ge=0, description="Content-Length the upstream declared for a truncated body, if any"
+    )
+    original_bytes: Optional[int] = Field(
+        None, ge=0, description="Size of the data (for HTTP, the body) response_filter was applied to, as JSON"
+    )
+    filtered_bytes: Optional[int] = Field(
+        None, ge=0, description="Size of the data (for HTTP, the body) once response_filter was applied, as JSON"
+    )
+    comparison: Optional[ComparisonMeta] = Field(
+        None, description="The variant leg of a request sent with compare, when it was sampled"
+    )
+    fault_injected: Optional[str] = Field(
+        None,
+        description="Faults injected into the request, comma-separated, e.g. latency_2000ms; such requests are left out of usage reporting",
+    )
+    tags: Optional[Dict[str, str]] = Field(
+        None,
+        description="Tags the request's usage was counted under; values past the proxy's distinct-value limit read ~0 to ~f",
+    )
+    idempotency_expires_at: Optional[str] = Field(
+        None, description="When the idempotency key expires and the request would run again (ISO 8601)"
+    )
     duration_ms: int = Field(..., ge=0, description="Request duration in milliseconds")
     request_id: str = Field(..., description="Request ID")
     trace_id: Optional[str] = Field(None, description="Trace ID")
@@ -257,7 +1622,10 @@ class MetaResponse(BaseModel):
     )
     cost_policy_applied: Optional[str] = Field(
         None,
-        description="Cost policy applied: none, soft_cap_throttled, hard_cap_rejected",
+        description=(
+            "Cost policy applied: none, soft_cap_throttled, hard_cap_rejected, "
+            "max_cost_rejected, budget_rejected, key_budget_rejected"
+        ),
     )
     max_tokens_reduced: Optional[bool] = Field(
         None,
@@ -268,12 +1636,113 @@ class MetaResponse(BaseModel):
     original_max_tokens: Optional[int] = Field(
         None, description="Original max_tokens before reduction (for LLM)"
     )
+    adjustments: Optional[List[Dict[str, Any]]] = Field(
+        None,
+        description=(
+            "Changes fitting a request with strict=false to its model: each has the field, its "
+            "requested value (from), the action (clamped, with the value sent as to, or dropped) "
+            "and the reason"
+        ),
+    )
+    conversation_tokens: Optional[int] = Field(
+        None,
+        description="Estimated prompt tokens of a conversation's stored history after this turn",
+    )
     fallback_used: Optional[bool] = Field(
         None, description="Whether fallback was used"
     )
     fallback_target: Optional[str] = Field(
         None, description="Fallback target name if used"
     )
+    fallback_served: Optional[bool] = Field(
+        None, description="Whether the static fallback_response was served in place of a failed upstream call"
+    )
+    upstream_error: Optional[ErrorDetail] = Field(
+        None, description="Upstream error the static fallback_response was served for"
+    )
+    served_by: Optional[str] = Field(
+        None, description="Target that actually served the response (for LLM)"
+    )
+    credential_name: Optional[str] = Field(
+        None, description="Named target credential the upstream call was made with"
+    )
+    upstream_rate_limit: Optional[UpstreamRateLimitMeta] = Field(
+        None, description="Rate limit the upstream reported to that credential, if it did"
+    )
+    raw_provider_response: Optional[Dict[str, Any]] = Field(
+        None, description="The provider's response before normalization, with include_raw (for LLM)"
+    )
+    validation_attempts: Optional[int] = Field(
+        None,
+        ge=0,
+        description="Completions validated against output_schema, including repairs (for LLM)",
+    )
+    output_valid: Optional[bool] = Field(
+        None, description="Whether the final completion matched output_schema (for LLM)"
+    )
+    hedged: Optional[bool] = Field(
+        None, description="Whether a backup request was sent under the request's hedge policy (for LLM)"
+    )
+    hedge_winner: Optional[int] = Field(
+        None, ge=0, description="Request whose answer was used: 0 for the first, n for the nth backup"
+    )
+    hedge_cost_usd: Optional[float] = Field(
+        None,
+        ge=0,
+        description=(
+            "Part of cost_usd spent on backup requests whose answer was not used, estimated from "
+            "the used answer for requests the provider bills despite cancellation"
+        ),
+    )
+    semantic_cache_hit: Optional[bool] = Field(
+        None, description="Whether the cached answer was found by prompt similarity under cache_semantic (for LLM)"
+    )
+    semantic_similarity: Optional[float] = Field(
+        None, description="Cosine similarity of the served cached prompt to this one (for LLM)"
+    )
+    trimmed_messages: Optional[int] = Field(
+        None, ge=0, description="Messages dropped under the request's context_policy (for LLM)"
+    )
+    prompt_tokens_after_trim: Optional[int] = Field(
+        None, ge=0, description="Estimated prompt tokens of the messages sent under context_policy (for LLM)"
+    )
+    redactions_applied: Optional[int] = Field(
+        None, ge=0, description="Values replaced with placeholders under the target's redaction config (for LLM)"
+    )
+    queue_wait_ms: Optional[int] = Field(
+        None, ge=0, description="Time spent waiting in the target's priority queue (for LLM)"
+    )
+    concurrency_wait_ms: Optional[int] = Field(
+        None, ge=0, description="Time spent waiting for a slot under the target's max_concurrency (for LLM)"
+    )
+    resolved_target: Optional[str] = Field(
+        None, description="Target a model alias resolved the request to (for LLM)"
+    )
+    routed_to: Optional[str] = Field(
+        None, description="Candidate target an auto:<name> latency route sent the request to (for LLM)"
+    )
+    resolved_model: Optional[str] = Field(
+        None, description="Model a model alias resolved the request to (for LLM)"
+    )
+    template_name: Optional[str] = Field(
+        None, description="Prompt template the messages were rendered from (for LLM)"
+    )
+    template_version: Optional[int] = Field(
+        None, description="Version of the prompt template used (for LLM)"
+    )
+    budget_remaining_usd: Optional[float] = Field(
+        None,
+        ge=0,
+        description=(
+            "What is left of the API key's monthly_budget_usd after this request, and of the "
+            "tenant's monthly budget once 80% of it is spent; the smaller of the two with both"
+        ),
+    )
+    rate_limit_remaining: Optional[int] = Field(
+        None,
+        ge=0,
+        description="Requests the API key may still make in the current minute (api_keys only)",
+    )
     # RouteLLM correlation fields
     routellm_decision_id: Optional[str] = Field(
         None, description="RouteLLM routing decision ID for correlation"
@@ -289,11 +1758,42 @@ class MetaResponse(BaseModel):
     )
 
 
+class BatchMetaResponse(BaseModel):
+    """Aggregate metadata for a batch response."""
+
+    request_id: str = Field(..., description="Batch request ID")
+    duration_ms: int = Field(..., ge=0, description="Batch duration in milliseconds")
+    total: int = Field(..., ge=0, description="Number of items in the batch")
+    succeeded: int = Field(0, ge=0, description="Number of successful items")
+    failed: int = Field(0, ge=0, description="Number of failed items (including aborted)")
+    aborted: int = Field(0, ge=0, description="Number of items skipped by fail_fast")
+    cache_hits: int = Field(0, ge=0, description="Number of items served from cache")
+    cost_usd: float = Field(0.0, ge=0, description="Total actual cost in USD")
+
+
+class LLMBatchItemResult(BaseModel):
+    """Result of a single batch item."""
+
+    index: int = Field(..., ge=0, description="Index of the originating request")
+    success: bool = Field(..., description="Success flag")
+    data: Optional[Dict[str, Any]] = Field(None, description="Response data on success")
+    error: Optional[ErrorDetail] = Field(None, description="Error details on failure")
+    meta: MetaResponse = Field(..., description="Item metadata")
+
+
+class LLMBatchResponse(BaseModel):
+    """Response format for POST /proxy/llm/batch."""
+
+    success: bool = Field(..., description="True if every item succeeded")
+    results: List[LLMBatchItemResult] = Field(..., description="Per-item results in request order")
+    meta: BatchMetaResponse = Field(..., description="Batch metadata")
+
+
 class SuccessResponse(BaseModel):
     """Success response format."""
 
     success: Literal[True] = Field(True, description="Success flag")
-    data: Dict[str, Any] = Field(..., description="Response data")
+    data: Optional[Dict[str, Any]] = Field(..., description="Response data (null for dry runs)")
     meta: MetaResponse = Field(..., description="Response metadata")
 
 
@@ -1,25 +1,88 @@
 """Service layer for ReliAPI endpoints."""
+import asyncio
+import base64
+import binascii
+import fnmatch
 import hashlib
 import json
+import math
+import re
+import ssl
+import threading
 import time
 from dataclasses import dataclass, field
-from typing import Any, AsyncIterator, Dict, List, Optional, Set, Union, Tuple
+from datetime import datetime, timedelta, timezone
+from typing import Any, AsyncIterator, Awaitable, Callable, Dict, List, Optional, Set, Union, Tuple
+from urllib.parse import urlsplit
 
 import httpx
 
+from reliapi.adapters.llm.base import (
+    ModelLimitsError,
+    TranslationError,
+    UnsupportedParameterError,
+    json_mode_shim,
+    normalize_logprobs,
+    parse_data_url,
+)
+from reliapi.adapters.llm.azure_openai import UnknownDeploymentError, azure_api_path, azure_deployment
 from reliapi.adapters.llm.factory import detect_provider, get_adapter
-from reliapi.app.schemas import ErrorDetail, ErrorResponse, MetaResponse, SuccessResponse
-from reliapi.core.cache import Cache
+from reliapi.app.schemas import (
+    BatchMetaResponse,
+    CacheMode,
+    ComparisonMeta,
+    ErrorDetail,
+    ErrorResponse,
+    LLMBatchItemResult,
+    LLMBatchResponse,
+    MetaResponse,
+    SuccessResponse,
+)
+from reliapi.core.audit import CAPTURE_FULL, DEFAULT_MAX_BODY_BYTES, AuditLog, final_attempt
+from reliapi.core.budget import BudgetHolds, BudgetLedger, month_bounds
+from reliapi.core.budget_alerts import REMAINING_THRESHOLD, BudgetAlertConfig, BudgetAlertLog
+from reliapi.core.cache import Cache, make_cache_key_hash
+from reliapi.core.cache_key import canonical_cache_key, llm_cache_document
 from reliapi.core.circuit_breaker import CircuitBreaker
+from reliapi.core.compare import token_similarity
+from reliapi.core.concurrency import DEFAULT_CONCURRENCY_WAIT_MS, ConcurrencyLimitError, TargetConcurrency
 from reliapi.core.cost_estimator import CostEstimator
 from reliapi.core.errors import ErrorCode, UpstreamStatus
-from reliapi.core.http_client import UpstreamHTTPClient
+from reliapi.core.faults import Fault
+from reliapi.core.graphql import GraphQLSyntaxError, parse_operation
+from reliapi.core.http_client import (
+    CircuitOpenError,
+    DeadlineTooShortError,
+    UpstreamHTTPClient,
+    UpstreamTimeoutError,
+    circuit_upstream,
+)
 from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.jobs import JobStatus, JobStore, WarmItemStatus, public_job
+from reliapi.core.json_schema import validate_json_output
 from reliapi.core.client_profile import ClientProfileManager
+from reliapi.core.context import ContextTooLongError, trim_messages
+from reliapi.core.credentials import CredentialRegistry, select_credentials
+from reliapi.core.key_limits import KeyLimits, KeyRateLimiter, RateLimitStatus
 from reliapi.core.key_pool import KeyPoolManager, ProviderKey, MAX_KEY_SWITCHES
+from reliapi.core.latency import LatencyTracker
+from reliapi.core.latency_routing import LatencyRouter, RouteChoice
 from reliapi.core.logging import structured_logger
+from reliapi.core.model_capabilities import ModelCapabilities, fit_request, lookup as lookup_capabilities
+from reliapi.core.priority_queue import DEFAULT_QUEUE_TIMEOUT_MS, QueueFullError, TargetQueues
 from reliapi.core.rate_scheduler import RateScheduler
-from reliapi.core.retry import RetryMatrix
+from reliapi.core.redaction import Redactor, redact_messages
+from reliapi.core.replay import replay_section
+from reliapi.core.response_filter import parse_response_filter, payload_size
+from reliapi.core.retry import RequestRetryPolicy, RetryMatrix, RetryStats
+from reliapi.core.target_registry import target_version
+from reliapi.core.templates import TemplateRegistry, render
+from reliapi.core.tracing import trace_headers
+from reliapi.core.transformations import record_applied, transform_request, transform_response
+from reliapi.core.upstream_limits import DEFAULT_MAX_WAIT_MS, RateLimitPacer, UpstreamRateLimits
+from reliapi.core.usage import UsageLedger, api_key_prefix, hour_start
+from reliapi.core.events import CIRCUIT_CLOSED, CIRCUIT_OPENED, TARGET_CHANGED, EventBus
+from reliapi.core.webhooks import BUDGET_THRESHOLD_REACHED, JOB_COMPLETED, deliver_webhook, make_event
 from reliapi.metrics.prometheus import (
     budget_events_total,
     cache_hits_total,
@@ -104,14 +167,16 @@ def _log_and_metric_http_request(
     error_code: Optional[str] = None,
     upstream_status: Optional[int] = None,
     tenant: Optional[str] = None,
+    stream: bool = False,
 ):
     """Helper to update metrics and log HTTP request."""
     # Normalize tenant for metrics (use "default" if None)
     tenant_label = tenant or "default"
+    stream_label = "true" if stream else "false"
     
     # Update unified metrics
-    requests_total.labels(target=target_name, kind="http", stream="false", outcome=outcome, tenant=tenant_label).inc()
-    request_latency_ms.labels(target=target_name, kind="http", stream="false", tenant=tenant_label).observe(latency_ms)
+    requests_total.labels(target=target_name, kind="http", stream=stream_label, outcome=outcome, tenant=tenant_label).inc()
+    request_latency_ms.labels(target=target_name, kind="http", stream=stream_label, tenant=tenant_label).observe(latency_ms)
     
     if cache_hit:
         cache_hits_total.labels(target=target_name, kind="http", tenant=tenant_label).inc()
@@ -137,7 +202,7 @@ def _log_and_metric_http_request(
         request_id=request_id,
         target=target_name,
         kind="http",
-        stream=False,
+        stream=stream,
         path=path,
         outcome=outcome,
         error_code=error_code,
@@ -195,6 +260,8 @@ def _log_and_metric_llm_request(
     
     if cost_usd and cost_usd > 0:
         llm_cost_usd_total.labels(target=target_name, tenant=tenant_label).inc(cost_usd)
+        if not (cache_hit or idempotent_hit):
+            _budget_ledger.record(tenant, cost_usd)
     
     # Log request
     structured_logger.log_request(
@@ -215,6 +282,18 @@ def _log_and_metric_llm_request(
     )
 
 
+def _auth_header(target_config: Dict[str, Any], auth_config: Dict[str, Any]) -> Tuple[str, str]:
+    """Header and prefix a target's API key goes in, by its auth config: by
+    default Authorization with "Bearer ", or Azure OpenAI's api-key, which
+    takes the key as it is."""
+    azure = (target_config.get("llm") or {}).get("provider") == "azure_openai"
+    header = auth_config.get("header") or ("api-key" if azure else "Authorization")
+    prefix = auth_config.get("prefix")
+    if prefix is None:
+        prefix = "" if azure and header.lower() == "api-key" else "Bearer "
+    return header, prefix
+
+
 def _get_auth_from_key_pool_or_fallback(
     provider: str,
     key_pool_manager: Optional[KeyPoolManager],
@@ -230,10 +309,11 @@ def _get_auth_from_key_pool_or_fallback(
     if key_pool_manager and key_pool_manager.has_pool(provider):
         selected_key = key_pool_manager.select_key(provider)
         if selected_key:
+            header, prefix = _auth_header(target_config, {})
             auth = {
                 "type": "api_key",
-                "header": "Authorization",
-                "prefix": "Bearer ",
+                "header": header,
+                "prefix": prefix,
                 "api_key": selected_key.key,
             }
             return auth, selected_key, "pool"
@@ -247,10 +327,11 @@ def _get_auth_from_key_pool_or_fallback(
         if env_var:
             api_key = os.getenv(env_var)
             if api_key:
+                header, prefix = _auth_header(target_config, auth_config)
                 auth = {
                     "type": "api_key",
-                    "header": auth_config.get("header", "Authorization"),
-                    "prefix": auth_config.get("prefix", "Bearer "),
+                    "header": header,
+                    "prefix": prefix,
                     "api_key": api_key,
                 }
     elif auth_config.get("type") == "api_key":
@@ -265,124 +346,2795 @@ def _get_auth_from_key_pool_or_fallback(
     return auth, None, "targets.auth"
 
 
-def create_http_client(
-    target_config: Dict[str, Any],
+def _cache_key_override(
+    scope: Dict[str, Any],
+    fields: Dict[str, Any],
+    cache_key: Optional[str],
+    cache_vary: Optional[List[str]],
+) -> Optional[Dict[str, Any]]:
+    """Build cache key data for requests with cache_key or cache_vary.
+
+    scope is always part of the key (target plus method or model), so an
+    explicit key cannot leak responses across targets or models. Returns None
+    when the default request-derived key should be used.
+    """
+    if cache_key is not None:
+        return {**scope, "cache_key": cache_key}
+    if cache_vary is not None:
+        return {**scope, "vary": {name: fields.get(name) for name in sorted(set(cache_vary))}}
+    return None
+
+
+def _image_digest(data: str) -> str:
+    """Hash the bytes of base64 image data, ignoring padding and line breaks.
+
+    Invalid base64 is returned as it is; the provider rejects it.
+    """
+    encoded = "".join(data.split()).rstrip("=")
+    try:
+        decoded = base64.b64decode(encoded + "=" * (-len(encoded) % 4), validate=True)
+    except (binascii.Error, ValueError):
+        return data
+    return "sha256:" + hashlib.sha256(decoded).hexdigest()
+
+
+def _image_url_key(url: str) -> str:
+    """Key a data URL by its image bytes; other URLs are kept."""
+    data_url = parse_data_url(url)
+    if not data_url:
+        return url
+    return f"data:{data_url[0]};{_image_digest(data_url[1])}"
+
+
+def _hash_images(value: Any) -> Any:
+    """Replace base64 images in messages or a payload with hashes of their bytes.
+
+    Used for cache keys, so encodings of one image that differ only in
+    padding share an entry, and keys don't grow with the image. Covers
+    OpenAI image_url parts (object or Mistral's string form) and Anthropic
+    base64 image sources.
+    """
+    if isinstance(value, list):
+        return [_hash_images(item) for item in value]
+    if not isinstance(value, dict):
+        return value
+    out = {key: _hash_images(item) for key, item in value.items()}
+    image = value.get("image_url")
+    if value.get("type") == "image_url" and isinstance(image, str):
+        out["image_url"] = _image_url_key(image)
+    elif value.get("type") == "image_url" and isinstance(image, dict) and isinstance(image.get("url"), str):
+        out["image_url"] = {**image, "url": _image_url_key(image["url"])}
+    elif value.get("type") == "base64" and isinstance(value.get("data"), str):
+        out["data"] = _image_digest(value["data"])
+    return out
+
+
+def _has_images(messages: List[Dict[str, Any]]) -> bool:
+    """Whether any message has an image part."""
+    return any(
+        isinstance(part, dict) and part.get("type") in ("image_url", "image")
+        for message in messages
+        if isinstance(message.get("content"), list)
+        for part in message["content"]
+    )
+
+
+def _llm_api_path(provider: str, model: str, llm_config: Optional[Dict[str, Any]] = None) -> str:
+    """Return the chat completion path for an LLM provider and model; for
+    azure_openai, that of the model's deployment in llm_config."""
+    if provider == "azure_openai":
+        return azure_api_path(llm_config or {}, azure_deployment(llm_config or {}, model))
+    if provider == "anthropic":
+        return "/messages"
+    if provider == "gemini":
+        return f"/models/{model}:generateContent"
+    return "/chat/completions"  # OpenAI, Mistral and default
+
+
+@dataclass
+class LLMRequestPlan:
+    """Upstream request and cache key derived from an LLM proxy request."""
+    model: str
+    max_tokens: Optional[int]
+    temperature: Optional[float]
+    provider: Optional[str]
+    adapter: Any = None
+    # top_p and stop as sent, None if dropped for the model
+    top_p: Optional[float] = None
+    stop: Optional[List[str]] = None
+    # Estimate for the requested max_tokens (checked against the hard cap)
+    requested_cost_estimate_usd: Optional[float] = None
+    # Estimate for max_tokens after soft cap throttling
+    cost_estimate_usd: Optional[float] = None
+    # max_tokens before the soft cap reduced it; None if not reduced
+    original_max_tokens: Optional[int] = None
+    api_path: Optional[str] = None
+    # Body sent upstream
+    payload_bytes: Optional[bytes] = None
+    # Body the cache key is derived from: the payload with images hashed
+    cache_key_bytes: Optional[bytes] = None
+    cache_override: Optional[Dict[str, Any]] = None
+    # Hash of the request's canonical document (core.cache_key)
+    cache_key: Optional[str] = None
+    # Key derived from cache_key_bytes, as before canonical keys; still read
+    # during the cache's legacy key window
+    legacy_cache_key: Optional[str] = None
+    # What an entry must share with the request to be served for it
+    cache_scope: Optional[Dict[str, Any]] = None
+    # messages and response_format as sent upstream, after any JSON mode
+    # shim for a json_schema response_format (see _structured_output)
+    upstream_messages: Optional[List[Dict[str, Any]]] = None
+    upstream_response_format: Optional[Dict[str, Any]] = None
+    # Changes fitting a non-strict request to its model, as meta.adjustments
+    adjustments: List[Dict[str, Any]] = field(default_factory=list)
+    # Azure OpenAI deployment serving the model, as meta.deployment
+    deployment: Optional[str] = None
+
+
+def _structured_output(
+    adapter: Any,
+    llm_config: Dict[str, Any],
+    capabilities: Optional[ModelCapabilities],
+    model: str,
+    messages: List[Dict[str, Any]],
+    response_format: Optional[Dict[str, Any]],
+    fallback: str,
+) -> Tuple[List[Dict[str, Any]], Optional[Dict[str, Any]]]:
+    """messages and response_format to send for a request, given whether its
+    model has structured outputs.
+
+    A json_schema response_format goes to models with structured outputs as
+    it is. The target's llm.structured_outputs says whether its model has
+    them; unset, the model's capabilities do, and for models without any the
+    adapter knows the provider's. For other models
+    it is asked for in JSON mode with the schema in the prompt when fallback
+    is "json_mode" (see json_mode_shim), and rejected with
+    UnsupportedParameterError otherwise.
+    """
+    if not response_format or response_format.get("type") != "json_schema":
+        return messages, response_format
+    supported = llm_config.get("structured_outputs")
+    if supported is None and capabilities is not None:
+        supported = capabilities.supports_json_schema
+    if supported is None:
+        supported = adapter.supports_json_schema(model)
+    if supported:
+        return messages, response_format
+    if fallback == "json_mode":
+        return json_mode_shim(messages, response_format)
+    raise UnsupportedParameterError(
+        "response_format",
+        model,
+        f"{model} has no structured outputs for a json_schema response_format; "
+        "set response_format_fallback to json_mode to ask for the schema in JSON mode instead",
+    )
+
+
+def _plan_llm_request(
     target_name: str,
-    key_pool_manager: Optional[KeyPoolManager] = None,
-    provider: Optional[str] = None,
-) -> Tuple[UpstreamHTTPClient, Optional[ProviderKey], str]:
-    """Create HTTP client for target."""
+    target_config: Dict[str, Any],
+    messages: List[Dict[str, str]],
+    model: Optional[str],
+    max_tokens: Optional[int],
+    temperature: Optional[float],
+    top_p: Optional[float],
+    stop: Optional[List[str]],
+    requested_target: Optional[str] = None,
+    cache_key: Optional[str] = None,
+    cache_vary: Optional[List[str]] = None,
+    tools: Optional[List[Dict[str, Any]]] = None,
+    tool_choice: Optional[Any] = None,
+    response_format: Optional[Dict[str, Any]] = None,
+    response_format_fallback: str = "error",
+    output_schema: Optional[Dict[str, Any]] = None,
+    redaction_digest: Optional[str] = None,
+    cached_filter: Optional[str] = None,
+    raw_passthrough: bool = False,
+    strict: bool = True,
+    logprobs: Optional[bool] = None,
+    top_logprobs: Optional[int] = None,
+) -> LLMRequestPlan:
+    """Apply an LLM target's limits to a request and derive its cache key.
+
+    This is the single place the upstream payload and cache key of an LLM
+    request are computed, so handle_llm_proxy, cache invalidation and stale
+    cache modes always agree on the key. Without a provider or adapter only
+    the limited model parameters are set.
+
+    requested_target is the target the client originally asked for when this
+    call serves a fallback; it is mixed into the cache key so fallback
+    responses are never returned for a direct request to either target.
+    A hash of tools, tool_choice and response_format is part of the key's
+    scope, so an explicit cache_key or cache_vary never serves a plain-text
+    answer to a request expecting a tool call; a json_schema
+    response_format the model lacks structured outputs for is sent as
+    response_format_fallback says (see _structured_output), keyed as it was
+    requested. An output_schema is scoped the same way, so only output validated against that schema is served
+    to a validating request. Base64 images are keyed by the hash of their
+    bytes (see _hash_images). messages are already redacted; the
+    redaction_digest of the values replaced (see _redact_prompt) is part of
+    the key and its scope, so a redacted prompt only shares an entry with
+    requests for other values when the target allows it. Responses cached
+    filtered by a cached_filter are keyed and scoped by it too, and those
+    kept with the provider's body for raw_passthrough by that, and those
+    with token logprobs by the top_logprobs asked for. The key hashes the
+    request's canonical document (core.cache_key); legacy_cache_key is the
+    one derived from the payload before canonical keys.
+
+    A request its model can't take, by the model's capabilities (see
+    core.model_capabilities; the target's llm.models override them), raises
+    ModelLimitsError. Unless strict, max_tokens and temperature are first
+    clamped to the model's limits and unsupported sampling parameters
+    dropped, as plan.adjustments records; the key is still the requested
+    values'. A model an azure_openai target has no deployment for raises
+    UnknownDeploymentError, and logprobs for a model the table lacks on a
+    provider that returns none UnsupportedParameterError.
+    """
+    llm_config = target_config.get("llm", {})
+    final_model = model or llm_config.get("default_model", "gpt-4")
+    final_max_tokens = max_tokens
+    if final_max_tokens is None:
+        final_max_tokens = llm_config.get("max_tokens")
+    elif llm_config.get("max_tokens"):
+        final_max_tokens = min(final_max_tokens, llm_config["max_tokens"])
+
+    final_temperature = temperature
+    if final_temperature is None:
+        final_temperature = llm_config.get("temperature")
+    elif llm_config.get("temperature") is not None:
+        final_temperature = min(final_temperature, llm_config["temperature"])
+
+    # Check the request against what the model accepts
+    capabilities = lookup_capabilities(final_model, llm_config.get("models"))
+    adjustments: List[Dict[str, Any]] = []
+    sent_top_p, sent_stop = top_p, stop
+    if capabilities is not None:
+        fit = fit_request(
+            capabilities,
+            final_model,
+            CostEstimator.count_tokens(messages, final_model),
+            {
+                "max_tokens": final_max_tokens, "temperature": final_temperature, "top_p": top_p, "stop": stop,
+                "tools": tools, "logprobs": logprobs, "top_logprobs": top_logprobs,
+            },
+            strict=strict,
+            has_images=_has_images(messages),
+        )
+        if fit.issues:
+            raise ModelLimitsError(final_model, [issue.to_dict() for issue in fit.issues])
+        adjustments = fit.adjustments
+        final_max_tokens, final_temperature = fit.values["max_tokens"], fit.values["temperature"]
+        sent_top_p, sent_stop = fit.values["top_p"], fit.values["stop"]
+
+    # Get provider (explicit in config or auto-detect)
     base_url = target_config["base_url"]
-    timeout_ms = target_config.get("timeout_ms", 20000)
-    timeout_s = timeout_ms / 1000.0
-    
-    # Circuit breaker
-    circuit_config = target_config.get("circuit", {})
-    circuit_breaker = CircuitBreaker(
-        failures_to_open=circuit_config.get("error_threshold", 5),
-        open_ttl_s=circuit_config.get("cooldown_s", 60),
+    provider = llm_config.get("provider") or detect_provider(base_url)
+    plan = LLMRequestPlan(
+        model=final_model,
+        max_tokens=final_max_tokens,
+        temperature=final_temperature,
+        provider=provider,
+        top_p=sent_top_p,
+        stop=sent_stop,
+        adjustments=adjustments,
     )
-    
-    # Retry matrix
-    retry_config = target_config.get("retry_matrix", {})
-    retry_matrix = {}
-    for error_class, policy in retry_config.items():
-        retry_matrix[error_class] = RetryMatrix(
-            attempts=policy.get("attempts", 3),
-            backoff=policy.get("backoff", "exp-jitter"),
-            base_s=policy.get("base_s", 1.0),
-            max_s=policy.get("max_s", 60.0),
-        )
-    
-    # Auth: use key pool if available, otherwise fallback to targets.auth
     if not provider:
-        # Try to detect provider from target config
-        llm_config = target_config.get("llm", {})
-        provider = llm_config.get("provider")
-    
-    auth, selected_key, auth_source = _get_auth_from_key_pool_or_fallback(
-        provider or target_name,
-        key_pool_manager,
-        target_config,
+        return plan
+    if provider == "azure_openai":
+        plan.deployment = azure_deployment(llm_config, final_model)
+
+    # Estimate cost before making request
+    plan.requested_cost_estimate_usd = plan.cost_estimate_usd = CostEstimator.estimate_from_messages(
+        provider, final_model, messages, final_max_tokens
     )
-    
-    client = UpstreamHTTPClient(
-        base_url=base_url,
-        timeout_s=timeout_s,
-        retry_matrix=retry_matrix,
-        circuit_breaker=circuit_breaker,
-        auth=auth,
+
+    # Check soft cost cap (throttle by reducing max_tokens)
+    soft_cost_cap = llm_config.get("soft_cost_cap_usd")
+    estimate = plan.requested_cost_estimate_usd
+    if soft_cost_cap and estimate and estimate > soft_cost_cap:
+        # Auto-reduce max_tokens to fit soft cap
+        reduction_factor = soft_cost_cap / estimate
+        plan.original_max_tokens = final_max_tokens
+        plan.max_tokens = int(final_max_tokens * reduction_factor * 0.9)  # 0.9 for safety margin
+        # Re-estimate with reduced tokens
+        plan.cost_estimate_usd = CostEstimator.estimate_from_messages(
+            provider, final_model, messages, plan.max_tokens
+        )
+
+    plan.adapter = get_adapter(provider)
+    if not plan.adapter:
+        return plan
+    if logprobs and capabilities is None and not plan.adapter.RETURNS_LOGPROBS:
+        raise UnsupportedParameterError("logprobs", final_model, f"{provider} targets return no logprobs")
+
+    # Prepare request payload
+    plan.upstream_messages, plan.upstream_response_format = _structured_output(
+        plan.adapter, llm_config, capabilities, final_model, messages, response_format, response_format_fallback
     )
-    
-    return client, selected_key, auth_source
+    payload = plan.adapter.prepare_request(
+        messages=plan.upstream_messages,
+        model=final_model,
+        max_tokens=plan.max_tokens,
+        temperature=final_temperature,
+        top_p=plan.top_p,
+        stop=plan.stop,
+        stream=False,  # Non-streaming path
+        tools=tools,
+        tool_choice=tool_choice,
+        response_format=plan.upstream_response_format,
+        logprobs=logprobs,
+        top_logprobs=top_logprobs,
+    )
+
+    # Determine API endpoint based on provider
+    plan.api_path = _llm_api_path(provider, final_model, llm_config)
 
+    plan.payload_bytes = json.dumps(payload).encode()
 
-async def handle_http_proxy(
+    # Build the legacy cache key
+    key_payload = _hash_images(payload)
+    key_extras: Dict[str, Any] = {}
+    if requested_target and requested_target != target_name:
+        key_extras["requested_target"] = requested_target
+    if redaction_digest:
+        key_extras["redacted"] = redaction_digest
+    if cached_filter:
+        key_extras["response_filter"] = cached_filter
+    if raw_passthrough:
+        key_extras["raw_passthrough"] = True
+    if key_extras:
+        cache_key_body = json.dumps({"payload": key_payload, **key_extras}, sort_keys=True)
+    else:
+        cache_key_body = json.dumps(key_payload, sort_keys=True)
+    plan.cache_key_bytes = cache_key_body.encode()
+
+    # Resolve cache key. Target and model are always in scope so an explicit
+    # cache_key never serves one model's answer for another.
+    cache_scope = {"target": target_name, "model": final_model}
+    if requested_target and requested_target != target_name:
+        cache_scope["requested_target"] = requested_target
+    if tools or tool_choice is not None or response_format is not None:
+        tooling = json.dumps([tools, tool_choice, response_format], sort_keys=True)
+        cache_scope["tools"] = hashlib.sha256(tooling.encode()).hexdigest()
+    if output_schema is not None:
+        schema = json.dumps(output_schema, sort_keys=True)
+        cache_scope["output_schema"] = hashlib.sha256(schema.encode()).hexdigest()
+    if redaction_digest:
+        cache_scope["redacted"] = redaction_digest
+    if cached_filter:
+        cache_scope["response_filter"] = cached_filter
+    if raw_passthrough:
+        cache_scope["raw_passthrough"] = True
+    if logprobs:
+        cache_scope["logprobs"] = True if top_logprobs is None else top_logprobs
+    plan.cache_scope = cache_scope
+    plan.cache_override = _cache_key_override(
+        scope=cache_scope,
+        fields={
+            "messages": _hash_images(messages),
+            "max_tokens": max_tokens,
+            "temperature": temperature,
+            "top_p": top_p,
+            "stop": stop,
+        },
+        cache_key=cache_key,
+        cache_vary=cache_vary,
+    )
+    plan.legacy_cache_key = make_cache_key_hash(
+        "POST", base_url + plan.api_path, None, plan.cache_key_bytes, None, plan.cache_override
+    )
+    document = llm_cache_document(
+        requested_target or target_name,
+        final_model,
+        _hash_images(messages),
+        max_tokens=max_tokens,
+        temperature=temperature,
+        top_p=top_p,
+        stop=stop,
+        tools=tools,
+        tool_choice=tool_choice,
+        response_format=response_format,
+        output_schema=output_schema,
+        cache_key=cache_key,
+        cache_vary=cache_vary,
+    )
+    if requested_target and requested_target != target_name:
+        document["served_by"] = target_name
+    if redaction_digest:
+        document["redacted"] = redaction_digest
+    if cached_filter:
+        document["response_filter"] = cached_filter
+    if raw_passthrough:
+        document["raw_passthrough"] = True
+    if logprobs:
+        document["logprobs"] = cache_scope["logprobs"]
+    plan.cache_key = canonical_cache_key(document)
+    return plan
+
+
+@dataclass
+class SemanticQuery:
+    """The embedded prompt of a request with cache_semantic."""
+    # Hash of what cached entries must share with the request to match
+    scope: str
+    embedding: List[float]
+
+
+def _final_user_text(messages: List[Dict[str, Any]]) -> Optional[str]:
+    """Text of the last user message; None if it has no text or holds other parts."""
+    for message in reversed(messages):
+        if message.get("role") != "user":
+            continue
+        content = message.get("content")
+        if isinstance(content, list):
+            if any(part.get("type") != "text" for part in content):
+                return None
+            content = "\n".join(part.get("text", "") for part in content)
+        return content or None
+    return None
+
+
+def _semantic_scope(plan: LLMRequestPlan, messages: List[Dict[str, Any]], embedding_model: Optional[str]) -> str:
+    """Hash the semantic cache scope of a planned request.
+
+    On top of the exact cache scope (target, model, tools, output schema),
+    entries must share the system prompt, the sampling temperature and the
+    embedding model, since vectors of different models aren't comparable.
+    """
+    system = [m.get("content") for m in messages if m.get("role") == "system"]
+    scope = {
+        **(plan.cache_scope or {}),
+        "system": hashlib.sha256(json.dumps(system, sort_keys=True).encode()).hexdigest(),
+        "temperature": plan.temperature,
+        "embedding_model": embedding_model,
+    }
+    return hashlib.sha256(json.dumps(scope, sort_keys=True).encode()).hexdigest()
+
+
+def _cosine_similarity(a: List[float], b: List[float]) -> float:
+    """Cosine similarity of two vectors; 0 for vectors of different sizes or zero length."""
+    if len(a) != len(b):
+        return 0.0
+    norm = math.sqrt(sum(x * x for x in a)) * math.sqrt(sum(y * y for y in b))
+    if not norm:
+        return 0.0
+    return sum(x * y for x, y in zip(a, b)) / norm
+
+
+def _semantic_cache_match(
+    cache: Cache, query: SemanticQuery, threshold: float, tenant: Optional[str]
+) -> Optional[Tuple[str, Dict[str, Any], float]]:
+    """Find the cached entry whose prompt is most similar to the query's.
+
+    Returns (cache key hash, cached value, similarity) for the best fresh
+    entry above threshold, or None.
+    """
+    scored = sorted(
+        (
+            (_cosine_similarity(query.embedding, embedding), key)
+            for key, embedding in cache.semantic_candidates(query.scope, tenant)
+        ),
+        reverse=True,
+    )
+    for similarity, key in scored:
+        if similarity <= threshold:
+            return None
+        entry = cache.get_entry(key, tenant)
+        if entry and not entry["stale"]:
+            return key, entry["value"], similarity
+    return None
+
+
+async def _semantic_query(
+    plan: LLMRequestPlan,
+    messages: List[Dict[str, Any]],
+    embedding_model: Optional[str],
+    **embed_args: Any,
+) -> Optional[SemanticQuery]:
+    """Embed the request's final user message on its own target.
+
+    embed_args are passed on to handle_embeddings_proxy. Returns None when
+    there is no text to embed or embedding failed; the request then only
+    uses the exact-match cache.
+    """
+    text = _final_user_text(messages)
+    if not text:
+        return None
+    result = await handle_embeddings_proxy(
+        inputs=[text], model=embedding_model, dimensions=None, idempotency_key=None, cache_ttl=None, **embed_args
+    )
+    if not result.success:
+        logger.warning(
+            f"Semantic cache embedding failed for {embed_args.get('target_name')}: {result.error.message}"
+        )
+        return None
+    embedding_model = embedding_model or result.meta.model
+    return SemanticQuery(scope=_semantic_scope(plan, messages, embedding_model), embedding=result.data["embeddings"][0])
+
+
+# Budget, circuit and target events pushed to GET /events subscribers.
+_events = EventBus()
+
+
+def get_event_bus() -> EventBus:
+    """Return the process-wide bus of GET /events."""
+    return _events
+
+
+def target_changed(target_name: str, version: Optional[int], deleted: bool = False) -> None:
+    """Publish a target.changed event for a target created, updated or removed."""
+    _events.publish(TARGET_CHANGED, {"target": target_name, "version": version, "deleted": deleted})
+
+
+# Circuit breakers by target name. A breaker must outlive the request that
+# trips it, otherwise an open circuit is never observed by the next one.
+_circuit_breakers: Dict[str, CircuitBreaker] = {}
+_circuit_breakers_lock = threading.Lock()
+
+
+def get_circuit_breaker(target_name: str, circuit_config: Dict[str, Any]) -> CircuitBreaker:
+    """Return the process-wide circuit breaker of a target.
+
+    The breaker is replaced (and its state reset) if the target's circuit
+    settings changed since it was created. Its circuits opening and closing
+    are published as circuit.opened and circuit.closed events.
+    """
+    failures_to_open = circuit_config.get("error_threshold", 5)
+    open_ttl_s = circuit_config.get("cooldown_s", 60)
+    with _circuit_breakers_lock:
+        breaker = _circuit_breakers.get(target_name)
+        if breaker is None or (breaker.failures_to_open, breaker.open_ttl_s) != (
+            failures_to_open,
+            open_ttl_s,
+        ):
+            breaker = CircuitBreaker(
+                failures_to_open=failures_to_open,
+                open_ttl_s=open_ttl_s,
+                on_change=lambda upstream, state: _circuit_changed(target_name, upstream, state),
+            )
+            _circuit_breakers[target_name] = breaker
+        return breaker
+
+
+def _circuit_scope_key(
+    target_config: Dict[str, Any], model: Optional[str] = None, credential: Optional[str] = None
+) -> Optional[str]:
+    """The sub-breaker of a call to a target under its circuit.scope.
+
+    A "model" scope gives each model its own breaker and a "credential" scope
+    each named credential; None is the breaker of the whole target, which
+    also covers calls without a model or credential, such as /proxy/http.
+    """
+    scope = (target_config.get("circuit") or {}).get("scope", "target")
+    if scope == "model" and model:
+        return f"model={model}"
+    if scope == "credential" and credential:
+        return f"credential={credential}"
+    return None
+
+
+def circuit_key(target_name: str, circuit_scope_key: Optional[str] = None) -> str:
+    """The name of a sub-breaker of a target, reported as meta.circuit_key."""
+    return f"{target_name}:{circuit_scope_key}" if circuit_scope_key else target_name
+
+
+def circuit_open(target_name: str, target_config: Dict[str, Any], model: Optional[str] = None) -> bool:
+    """Whether an LLM call to a target with model, or else its default
+    model, would fail on an open circuit.
+
+    Under a "credential" scope that is when the breakers of all its named
+    credentials are open, as a call may be made with any of them.
+    """
+    model = model or (target_config.get("llm") or {}).get("default_model", "gpt-4")
+    breaker = get_circuit_breaker(target_name, target_config.get("circuit", {}))
+    base_url = target_config["base_url"]
+    if (target_config.get("circuit") or {}).get("scope") == "credential":
+        names = [c["name"] for c in _credentials.credentials(target_name, target_config)]
+        if names:
+            return all(
+                breaker.is_open(circuit_upstream(base_url, _circuit_scope_key(target_config, credential=name)))
+                for name in names
+            )
+    return breaker.is_open(circuit_upstream(base_url, _circuit_scope_key(target_config, model=model)))
+
+
+def _circuit_changed(target_name: str, upstream: str, state: str) -> None:
+    _events.publish(
+        CIRCUIT_OPENED if state == "open" else CIRCUIT_CLOSED,
+        {"target": target_name, "circuit_key": circuit_key(target_name, upstream.partition("#")[2])},
+    )
+
+
+def circuit_status(target_name: str, target_config: Dict[str, Any]) -> Dict[str, Any]:
+    """Return the circuit breaker snapshot of a target's upstream.
+
+    breakers lists the snapshots of its sub-breakers, each with its key. The
+    target's own state is the worst of theirs: open when any is open.
+    """
+    breaker = get_circuit_breaker(target_name, target_config.get("circuit", {}))
+    base_url = target_config["base_url"].rstrip("/")
+    upstreams = [base_url] + [u for u in breaker.upstreams() if u.startswith(base_url + "#")]
+    breakers = [
+        {"key": circuit_key(target_name, upstream.partition("#")[2]), **breaker.snapshot(upstream)}
+        for upstream in upstreams
+    ]
+    states = {b["state"] for b in breakers}
+    probes = [b["next_probe_at"] for b in breakers if b["next_probe_at"] is not None]
+    failures = [b["last_failure_at"] for b in breakers if b["last_failure_at"] is not None]
+    return {
+        "state": next(s for s in ("open", "half-open", "closed") if s in states),
+        "scope": (target_config.get("circuit") or {}).get("scope", "target"),
+        "failure_count": sum(b["failure_count"] for b in breakers),
+        "last_failure_at": max(failures, default=None),
+        "next_probe_at": min(probes, default=None),
+        "failures_to_open": breaker.failures_to_open,
+        "open_ttl_s": breaker.open_ttl_s,
+        "breakers": breakers,
+    }
+
+
+def reset_circuit(target_name: str, target_config: Dict[str, Any]) -> None:
+    """Close a target's circuit breakers, e.g. after fixing its credentials."""
+    breaker = get_circuit_breaker(target_name, target_config.get("circuit", {}))
+    base_url = target_config["base_url"].rstrip("/")
+    for upstream in breaker.upstreams():
+        if upstream == base_url or upstream.startswith(base_url + "#"):
+            breaker.reset(upstream)
+
+
+# Monthly LLM spend by tenant, checked against monthly_budget_usd.
+_budget_ledger = BudgetLedger()
+
+
+def budget_status(tenant: Optional[str], cap_usd: Optional[float]) -> Dict[str, Any]:
+    """Return a tenant's spend this month against its monthly cap."""
+    now = datetime.now(timezone.utc)
+    period_start, reset_at = month_bounds(now)
+    spent = _budget_ledger.spent(tenant, now)
+    overshoots, overshoot_usd = _budget_ledger.overshoot(tenant)
+    return {
+        "tenant": tenant,
+        "spent_usd": spent,
+        "cap_usd": cap_usd,
+        "remaining_usd": max(cap_usd - spent, 0.0) if cap_usd is not None else None,
+        "reserved_usd": _budget_ledger.reserved(tenant),
+        "overshoots": overshoots,
+        "overshoot_usd": overshoot_usd,
+        "period_start": period_start.isoformat(),
+        "reset_at": reset_at.isoformat(),
+    }
+
+
+# Monthly LLM spend and requests per minute by API key name, checked
+# against the api_keys limits.
+_key_budget_ledger = BudgetLedger()
+_key_rate_limiter = KeyRateLimiter()
+
+# LLM requests waiting for a turn under their target's rate budget.
+_target_queues = TargetQueues()
+
+# LLM requests in flight to each target, held to its max_concurrency.
+_target_concurrency = TargetConcurrency()
+
+
+def target_stats(target_name: str, target_config: Dict[str, Any]) -> Dict[str, Any]:
+    """Return the LLM requests in flight to a target and waiting for it."""
+    limiter = _target_concurrency.get(target_name, target_config.get("max_concurrency"))
+    queue = _target_queues.get(target_name, target_config.get("queue"))
+    return {
+        "target": target_name,
+        **limiter.snapshot(),
+        "queued": queue.waiting if queue else 0,
+    }
+
+
+# A target is probed at most once per interval; checks in between get the
+# last result, so health checks can't hammer an upstream.
+TARGET_CHECK_INTERVAL_S = 30.0
+TARGET_CHECK_TIMEOUT_S = 5.0
+
+# Last probe of each target by base URL: (monotonic time, result).
+_target_checks: Dict[Tuple[str, str], Tuple[float, Dict[str, Any]]] = {}
+
+
+async def check_target(
     target_name: str,
-    method: str,
-    path: str,
-    headers: Optional[Dict[str, str]],
-    query: Optional[Dict[str, Any]],
-    body: Optional[str],
-    idempotency_key: Optional[str],
-    cache_ttl: Optional[int],
-    targets: Dict[str, Dict],
-    cache: Cache,
-    idempotency: IdempotencyManager,
-    request_id: str,
-    tenant: Optional[str] = None,
+    target_config: Dict[str, Any],
     key_pool_manager: Optional[KeyPoolManager] = None,
-    rate_scheduler: Optional[RateScheduler] = None,
-    client_profile_name: Optional[str] = None,
-    client_profile_manager: Optional[ClientProfileManager] = None,
-) -> Union[SuccessResponse, ErrorResponse]:
-    """Handle HTTP proxy request."""
-    start_time = time.time()
-    retries = 0
-    # Use KeySwitchState for proper tracking across request lifecycle
-    key_switch_state = KeySwitchState()
-    
-    # Get target config
-    target_config = targets.get(target_name)
-    if not target_config:
-        return ErrorResponse(
-            success=False,
-            error=ErrorDetail(
-                type="client_error",
-                code=ErrorCode.NOT_FOUND.value,
-                message=f"Target '{target_name}' not found",
-                retryable=False,
-                target=None,
-                status_code=404,
-            ),
-            meta=MetaResponse(
-                target=None,
-                cache_hit=False,
-                retries=0,
-                duration_ms=0,
-                request_id=request_id,
-                trace_id=None,
-            ),
-        )
-    
-    # Build full URL
+) -> Dict[str, Any]:
+    """Probe a target's upstream with its credentials.
+
+    LLM targets are sent GET /models, other targets HEAD on their base URL.
+    The probe bypasses the cache, budgets, usage and the circuit breaker.
+    Within TARGET_CHECK_INTERVAL_S of the last probe the result is reused
+    (cached: true).
+    """
     base_url = target_config["base_url"].rstrip("/")
-    full_url = f"{base_url}{path}"
-    
-    # Prepare body
-    body_bytes = body.encode() if body else None
-    
-    # Check cache for GET/HEAD
-    cache_hit = False
-    if method.upper() in ["GET", "HEAD"]:
-        cache_config = target_config.get("cache", {})
-        if cache_config.get("enabled", True):
-            ttl = cache_ttl or cache_config.get("ttl_s", 3600)
-            cached = cache.get(method, full_url, headers, body_bytes, query, tenant=tenant)
-            if cached:
-                cache_hit = True
-                duration_ms = int((time.time() - start_time) * 1000)
-                # Update metrics and log
+    key = (target_name, base_url)
+    last = _target_checks.get(key)
+    if last and time.monotonic() - last[0] < TARGET_CHECK_INTERVAL_S:
+        return {**last[1], "cached": True}
+
+    llm_config = target_config.get("llm") or {}
+    method, url = ("GET", f"{base_url}/models") if llm_config else ("HEAD", base_url)
+    if llm_config.get("provider") == "azure_openai":
+        url = f"{base_url}/openai/models?api-version={(llm_config.get('azure') or {}).get('api_version', '')}"
+    auth, _, _ = _get_auth_from_key_pool_or_fallback(
+        llm_config.get("provider") or target_name, key_pool_manager, target_config
+    )
+    headers = {}
+    if auth.get("type") == "api_key" and auth.get("api_key"):
+        headers[auth.get("header", "Authorization")] = f"{auth.get('prefix', '')}{auth['api_key']}"
+
+    result: Dict[str, Any] = {
+        "target": target_name,
+        "status": "ok",
+        "method": method,
+        "url": url,
+        "status_code": None,
+        "latency_ms": None,
+        "tls_expires_at": None,
+        "tls_days_remaining": None,
+        "error": None,
+        "checked_at": datetime.now(timezone.utc).isoformat(),
+        "cached": False,
+    }
+    start = time.monotonic()
+    try:
+        async with httpx.AsyncClient(timeout=TARGET_CHECK_TIMEOUT_S) as client:
+            response = await client.request(method, url, headers=headers)
+        result["latency_ms"] = int((time.monotonic() - start) * 1000)
+        result["status_code"] = response.status_code
+        if response.status_code in (401, 403):
+            result["status"] = "auth_failed"
+        elif response.status_code >= 500:
+            result["status"] = "degraded"
+    except httpx.HTTPError as e:
+        result["status"] = "unreachable"
+        result["error"] = str(e) or type(e).__name__
+
+    parts = urlsplit(base_url)
+    if parts.scheme == "https" and result["status"] != "unreachable":
+        try:
+            expires_at = await _tls_expiry(parts.hostname, parts.port or 443)
+            result["tls_expires_at"] = expires_at.isoformat()
+            result["tls_days_remaining"] = (expires_at - datetime.now(timezone.utc)).days
+        except (OSError, asyncio.TimeoutError, ValueError, KeyError, TypeError) as e:
+            result["error"] = f"TLS check failed: {e}"
+
+    _target_checks[key] = (time.monotonic(), result)
+    return result
+
+
+async def _tls_expiry(host: str, port: int) -> datetime:
+    """When the certificate host serves on port expires."""
+    context = ssl.create_default_context()
+    _, writer = await asyncio.wait_for(
+        asyncio.open_connection(host, port, ssl=context, server_hostname=host),
+        TARGET_CHECK_TIMEOUT_S,
+    )
+    try:
+        cert = writer.get_extra_info("peercert")
+    finally:
+        writer.close()
+    return datetime.fromtimestamp(ssl.cert_time_to_seconds(cert["notAfter"]), tz=timezone.utc)
+
+
+def key_budget_remaining(key_limits: Optional[KeyLimits]) -> Optional[float]:
+    """Return what is left of an API key's monthly budget, None without one."""
+    if not key_limits or key_limits.monthly_budget_usd is None:
+        return None
+    return max(key_limits.monthly_budget_usd - _key_budget_ledger.spent(key_limits.name), 0.0)
+
+
+def budget_remaining(
+    tenant: Optional[str], budget_cap_usd: Optional[float], key_limits: Optional[KeyLimits]
+) -> Optional[float]:
+    """Return what is left of the budgets a response reports, None for neither.
+
+    An API key's budget is always reported; the tenant's monthly budget once
+    its spend crosses REMAINING_THRESHOLD of the cap. With both, the smaller
+    remainder is the one that stops requests first.
+    """
+    remaining = key_budget_remaining(key_limits)
+    if budget_cap_usd:
+        spent = _budget_ledger.spent(tenant)
+        if spent >= REMAINING_THRESHOLD * budget_cap_usd:
+            tenant_remaining = max(budget_cap_usd - spent, 0.0)
+            remaining = tenant_remaining if remaining is None else min(remaining, tenant_remaining)
+    return remaining
+
+
+# Budget alerts that fired this month, and their webhook deliveries in
+# flight, referenced so they aren't garbage-collected mid-send.
+_budget_alerts = BudgetAlertLog()
+_alert_deliveries: Set["asyncio.Task[bool]"] = set()
+
+
+def check_budget_alerts(
+    tenant: Optional[str],
+    budget_cap_usd: Optional[float],
+    key_limits: Optional[KeyLimits],
+    config: BudgetAlertConfig,
+) -> List[Dict[str, Any]]:
+    """Fire the alerts of the tenant's and the API key's budgets that their
+    spend crossed since the last check.
+
+    Alerts are delivered to config.webhook_url as budget.threshold_reached
+    events in the background, and published to the GET /events subscribers
+    of the tenant, or of the API key for its budget. Returns the alerts fired.
+    """
+    now = datetime.now(timezone.utc)
+    fired = []
+    if budget_cap_usd:
+        fired += _budget_alerts.check(
+            tenant,
+            None,
+            _budget_ledger.spent(tenant, now),
+            budget_cap_usd,
+            _budget_ledger.projected(tenant, now),
+            _budget_ledger.run_rate(tenant, now),
+            config.thresholds,
+            now,
+        )
+    if key_limits and key_limits.monthly_budget_usd:
+        fired += _budget_alerts.check(
+            tenant,
+            key_limits.name,
+            _key_budget_ledger.spent(key_limits.name, now),
+            key_limits.monthly_budget_usd,
+            _key_budget_ledger.projected(key_limits.name, now),
+            _key_budget_ledger.run_rate(key_limits.name, now),
+            key_limits.alert_thresholds or config.thresholds,
+            now,
+        )
+    for alert in fired:
+        logger.warning(
+            f"Budget alert: tenant={tenant or 'default'}, api_key={alert['api_key']}, "
+            f"threshold={alert['threshold']}, spent=${alert['spent_usd']:.4f} of ${alert['cap_usd']:.4f}"
+        )
+        _events.publish(BUDGET_THRESHOLD_REACHED, alert, tenant=tenant or "default", api_key=alert["api_key"])
+        if config.webhook_url and config.webhook_secret:
+            event = make_event(BUDGET_THRESHOLD_REACHED, alert)
+            task = asyncio.create_task(deliver_webhook(config.webhook_url, event, config.webhook_secret))
+            _alert_deliveries.add(task)
+            task.add_done_callback(_alert_deliveries.discard)
+    return fired
+
+
+def budget_alerts(tenant: Optional[str], key_limits: Optional[KeyLimits]) -> List[Dict[str, Any]]:
+    """Return this month's alerts of the tenant's budget and the API key's."""
+    return _budget_alerts.list(tenant, key_limits.name if key_limits else None)
+
+
+def check_key_rate_limit(key_limits: Optional[KeyLimits], requests: int = 1) -> Optional[RateLimitStatus]:
+    """Count requests against an API key's rate_limit_rpm, None without one."""
+    if not key_limits or not key_limits.rate_limit_rpm:
+        return None
+    return _key_rate_limiter.hit(key_limits.name, key_limits.rate_limit_rpm, requests)
+
+
+# Request counts, tokens and spend for GET /usage.
+_usage_ledger = UsageLedger()
+
+# Rows per page of a usage report, by default and at most.
+USAGE_PAGE_SIZE = 100
+USAGE_MAX_PAGE_SIZE = 1000
+
+
+def set_max_tag_values(max_tag_values: int) -> None:
+    """Set how many distinct values of a tag key each tenant's usage is counted under."""
+    _usage_ledger.max_tag_values = max_tag_values
+
+
+def usage_tags(tenant: Optional[str], tags: Optional[Dict[str, str]]) -> Optional[Dict[str, str]]:
+    """The tags a request is counted under, for its meta.tags; see UsageLedger.bound_tags."""
+    return _usage_ledger.bound_tags(tenant, tags)
+
+
+def record_usage(
+    result: Any,
+    kind: str,
+    tenant: Optional[str],
+    api_key: Optional[str],
+    key_limits: Optional[KeyLimits] = None,
+) -> None:
+    """Count a proxy response, batch item or streamed HTTP result in the usage
+    report, under the target that served it and its meta.tags, and charge its
+    cost to the API key's budget. The tokens of embeddings are counted as
+    embedding_tokens, apart from chat tokens. Dry runs are not counted."""
+    meta = result.meta
+    if getattr(meta, "dry_run", None):
+        return
+    data = getattr(result, "data", None)
+    usage = data.get("usage") if isinstance(data, dict) else getattr(data, "usage", None)
+    if usage is not None and not isinstance(usage, dict):
+        usage = usage.model_dump()
+    usage = usage or {}
+    embedding_tokens = 0
+    if kind == "embeddings" and isinstance(data, dict):
+        embedding_tokens = data.get("prompt_tokens") or 0
+    _usage_ledger.record(
+        tenant,
+        api_key_prefix(api_key),
+        meta.served_by or meta.target,
+        meta.model,
+        kind,
+        cache_hit=meta.cache_hit,
+        idempotent_hit=meta.idempotent_hit,
+        # Streamed HTTP responses have no success flag; they only fail as ErrorResponse
+        success=getattr(result, "success", True),
+        prompt_tokens=usage.get("prompt_tokens") or 0,
+        completion_tokens=usage.get("completion_tokens") or 0,
+        embedding_tokens=embedding_tokens,
+        cost_usd=meta.cost_usd or 0.0,
+        tags=getattr(meta, "tags", None),
+    )
+    # Like monthly_budget_usd, key budgets cap LLM spend
+    if key_limits and kind == "llm" and meta.cost_usd and not (meta.cache_hit or meta.idempotent_hit):
+        _key_budget_ledger.record(key_limits.name, meta.cost_usd)
+
+
+def record_hot_key(
+    cache: Optional[Cache], result: Any, kind: str, request: Dict[str, Any], tenant: Optional[str]
+) -> None:
+    """Count a successful response with a cache key towards the tenant's
+    GET /cache/hot listing, with the request JSON it answered. Dry runs are
+    not counted."""
+    meta = result.meta
+    if cache is None or not getattr(result, "success", False) or meta.dry_run or not meta.cache_key:
+        return
+    cache.record_use(meta.cache_key, kind, request, tenant=tenant)
+
+
+async def metered_stream(
+    events: AsyncIterator[str],
+    target_name: str,
+    model: Optional[str],
+    tenant: Optional[str],
+    api_key: Optional[str],
+    key_limits: Optional[KeyLimits] = None,
+    tags: Optional[Dict[str, str]] = None,
+) -> AsyncIterator[str]:
+    """Relay the SSE events of handle_llm_stream_generator, counting the
+    stream in the usage report under tags, and its cost against the API
+    key's budget, when its done or error event passes. The meta event
+    reports the tags."""
+    async for event in events:
+        if tags and event.startswith("event: meta\n"):
+            meta_data = json.loads(event.split("data: ", 1)[1])
+            meta_data["tags"] = tags
+            event = f"event: meta\ndata: {json.dumps(meta_data)}\n\n"
+        if event.startswith(("event: done\n", "event: error\n")):
+            data = json.loads(event.split("data: ", 1)[1])
+            _record_stream_usage(
+                data, target_name, model, tenant, api_key, key_limits,
+                success=event.startswith("event: done"), tags=tags,
+            )
+        yield event
+
+
+def _record_stream_usage(
+    data: Dict[str, Any],
+    target_name: str,
+    model: Optional[str],
+    tenant: Optional[str],
+    api_key: Optional[str],
+    key_limits: Optional[KeyLimits],
+    success: bool = True,
+    tags: Optional[Dict[str, str]] = None,
+) -> None:
+    """Count a stream's done or error event data, or the usage of an aborted
+    stream, in the usage report and against the API key's budget."""
+    usage = data.get("usage") or {}
+    _usage_ledger.record(
+        tenant,
+        api_key_prefix(api_key),
+        target_name,
+        model,
+        "llm",
+        cache_hit=bool(data.get("cache_hit")),
+        success=success,
+        prompt_tokens=usage.get("prompt_tokens") or 0,
+        completion_tokens=usage.get("completion_tokens") or 0,
+        cost_usd=data.get("cost_usd") or 0.0,
+        tags=tags,
+    )
+    if key_limits and data.get("cost_usd"):
+        _key_budget_ledger.record(key_limits.name, data["cost_usd"])
+
+
+def _page_cursor(after: List[Any], query: str) -> str:
+    token = json.dumps({"after": after, "query": query}).encode()
+    return base64.urlsafe_b64encode(token).decode().rstrip("=")
+
+
+def _paginate(
+    items: List[Any],
+    sort_key: Callable[[Any], List[Any]],
+    limit: int,
+    cursor: Optional[str],
+    query: str,
+) -> Tuple[List[Any], Optional[str]]:
+    """Return the page of items, sorted by sort_key, that follows cursor, and
+    the cursor of the next page (None on the last).
+
+    Cursors hold the sort key of the last item of their page rather than an
+    offset, so pages stay in place when items are added or dropped between
+    requests, the item a cursor points at included. ValueError if cursor is
+    malformed or was issued for another query.
+    """
+    start = 0
+    if cursor:
+        try:
+            decoded = json.loads(base64.urlsafe_b64decode(cursor + "=" * (-len(cursor) % 4)))
+            after = decoded["after"]
+            cursor_query = decoded["query"]
+        except (ValueError, KeyError, TypeError, binascii.Error):
+            raise ValueError("cursor is not valid")
+        if cursor_query != query or not isinstance(after, list):
+            raise ValueError("cursor belongs to a different query; start again without it")
+        try:
+            start = next((i for i, item in enumerate(items) if sort_key(item) > after), len(items))
+        except TypeError:
+            raise ValueError("cursor is not valid")
+    page = items[start:start + limit]
+    more = start + len(page) < len(items)
+    return page, _page_cursor(sort_key(page[-1]), query) if more else None
+
+
+def usage_report(
+    tenant: Optional[str],
+    start: datetime,
+    end: datetime,
+    group_by: List[str],
+    limit: int = USAGE_PAGE_SIZE,
+    cursor: Optional[str] = None,
+) -> Dict[str, Any]:
+    """Return a page of a tenant's usage in [start, end), grouped by group_by.
+
+    The range is widened to whole hours. next_cursor continues the same
+    report and is None on the last page; a cursor from another report raises
+    ValueError.
+    """
+    start = hour_start(start)
+    if end != hour_start(end):
+        end = hour_start(end) + timedelta(hours=1)
+    query = hashlib.sha256(
+        json.dumps([tenant, start.isoformat(), end.isoformat(), group_by]).encode()
+    ).hexdigest()[:16]
+    rows = _usage_ledger.report(tenant, start, end, group_by)
+    # The order UsageLedger.report sorts rows in
+    page, next_cursor = _paginate(
+        rows, lambda r: [[r[f] is not None, r[f] or ""] for f in group_by], limit, cursor, query,
+    )
+    return {
+        "tenant": tenant,
+        "from": start.isoformat(),
+        "to": end.isoformat(),
+        "group_by": group_by,
+        "rows": page,
+        "next_cursor": next_cursor,
+    }
+
+
+# Audit records for GET /audit.
+_audit_log = AuditLog()
+
+# Records per page of an audit search, by default and at most.
+AUDIT_PAGE_SIZE = 100
+AUDIT_MAX_PAGE_SIZE = 1000
+
+
+def record_audit(
+    result: Any,
+    kind: str,
+    target_name: str,
+    targets: Dict[str, Dict[str, Any]],
+    tenant: Optional[str],
+    api_key: Optional[str],
+    attempts: Optional[List[Dict[str, Any]]],
+    created_at: datetime,
+    method: Optional[str] = None,
+    path: Optional[str] = None,
+    request: Optional[Dict[str, Any]] = None,
+) -> None:
+    """Keep the audit record of a proxy response with the upstream attempts
+    captured for it; attempts is None when the target isn't audited.
+
+    Captured bodies go through the target's redaction patterns, so HTTP
+    bodies are redacted like LLM prompts are before they're sent. Under
+    capture "full", request, the JSON of the proxy request, is kept too for
+    POST /replay (see core.replay). Dry runs are not recorded.
+    """
+    meta = result.meta
+    if attempts is None or getattr(meta, "dry_run", None):
+        return
+    target_config = targets.get(target_name) or {}
+    audit = target_config.get("audit") or {}
+    redaction = target_config.get("redaction")
+    redactor = None
+    if redaction and redaction.get("enabled", True):
+        # One redactor per record, so a value has the same placeholder in every body
+        redactor = Redactor(redaction)
+        for attempt in attempts:
+            for side in ("request", "response"):
+                if attempt.get(side) and attempt[side]["body"]:
+                    attempt[side] = {**attempt[side], "body": redactor.redact(attempt[side]["body"])}
+    replay = None
+    if audit.get("capture") == CAPTURE_FULL and request is not None:
+        replay = replay_section(kind, request, redactor, audit.get("max_body_bytes", DEFAULT_MAX_BODY_BYTES))
+    error = getattr(result, "error", None)
+    _audit_log.store({
+        "request_id": meta.request_id,
+        "created_at": created_at.isoformat(),
+        "tenant": tenant,
+        "api_key_prefix": api_key_prefix(api_key),
+        "kind": kind,
+        "target": target_name,
+        "served_by": meta.served_by or meta.target,
+        "model": meta.model,
+        "method": method,
+        "path": path,
+        "success": getattr(result, "success", True),
+        "error_code": error.code if error else None,
+        "cache_hit": bool(meta.cache_hit),
+        "idempotent_hit": bool(meta.idempotent_hit),
+        "duration_ms": meta.duration_ms,
+        "cost_usd": meta.cost_usd,
+        "capture": audit.get("capture"),
+        "attempts": attempts,
+        "final_attempt": final_attempt(attempts),
+        "replay": replay,
+    })
+
+
+def _audit_view(record: Dict[str, Any], bodies: bool) -> Dict[str, Any]:
+    """record as returned to a caller; bodies, and the request kept for
+    replays, are only shown to the admin key."""
+    if bodies or record["capture"] != CAPTURE_FULL:
+        return record
+    return {
+        **record,
+        "replay": None,
+        "bodies_omitted": True,
+        "attempts": [
+            {k: v for k, v in attempt.items() if k not in ("request", "response")}
+            for attempt in record["attempts"]
+        ],
+    }
+
+
+def audit_record(request_id: str, tenant: Optional[str], admin: bool = False) -> Optional[Dict[str, Any]]:
+    """Return the audit record of request_id, None if there is none or it is
+    another tenant's. admin sees every tenant's records, with their bodies."""
+    record = _audit_log.get(request_id)
+    if record is None or (not admin and record["tenant"] != tenant):
+        return None
+    return _audit_view(record, admin)
+
+
+def audit_search(
+    tenant: Optional[str],
+    start: datetime,
+    end: datetime,
+    target: Optional[str] = None,
+    limit: int = AUDIT_PAGE_SIZE,
+    cursor: Optional[str] = None,
+    admin: bool = False,
+) -> Dict[str, Any]:
+    """Return a page of a tenant's audit records created in [start, end),
+    oldest first, optionally only those of target.
+
+    admin searches every tenant's records and sees their bodies.
+    next_cursor continues the same search and is None on the last page; a
+    cursor from another search raises ValueError.
+    """
+    query = hashlib.sha256(
+        json.dumps(["audit", None if admin else tenant, start.isoformat(), end.isoformat(), target]).encode()
+    ).hexdigest()[:16]
+    records = _audit_log.search(tenant, start, end, target, all_tenants=admin)
+    page, next_cursor = _paginate(
+        records, lambda r: [r["created_at"], r["request_id"]], limit, cursor, query,
+    )
+    return {
+        "from": start.isoformat(),
+        "to": end.isoformat(),
+        "target": target,
+        "records": [_audit_view(r, admin) for r in page],
+        "next_cursor": next_cursor,
+    }
+
+
+# Jobs per page of GET /jobs, by default and at most.
+JOBS_PAGE_SIZE = 100
+JOBS_MAX_PAGE_SIZE = 1000
+
+
+def job_search(
+    jobs: JobStore,
+    tenant: Optional[str],
+    status: Optional[str] = None,
+    limit: int = JOBS_PAGE_SIZE,
+    cursor: Optional[str] = None,
+) -> Dict[str, Any]:
+    """Return a page of a tenant's async LLM jobs, oldest first, optionally
+    only those in status.
+
+    next_cursor continues the same listing and is None on the last page; a
+    cursor from another listing raises ValueError.
+    """
+    query = hashlib.sha256(json.dumps(["jobs", tenant, status]).encode()).hexdigest()[:16]
+    records = [j for j in jobs.list(tenant) if status is None or j["status"] == status]
+    page, next_cursor = _paginate(
+        records, lambda j: [j["created_at"], j["job_id"]], limit, cursor, query,
+    )
+    return {
+        "status": status,
+        "jobs": [public_job(j) for j in page],
+        "next_cursor": next_cursor,
+    }
+
+
+# Prompt templates by name, every version kept.
+_templates = TemplateRegistry()
+
+
+def put_template(name: str, messages: List[Dict[str, str]], description: Optional[str] = None) -> Dict[str, Any]:
+    """Store the next version of a prompt template."""
+    return _templates.put(name, messages, description)
+
+
+def get_template(name: str, version: Optional[int] = None) -> Optional[Dict[str, Any]]:
+    """Return a version of a prompt template, its latest without one."""
+    return _templates.get(name, version)
+
+
+def render_template(
+    name: str, version: Optional[int], variables: Dict[str, str]
+) -> Optional[Tuple[Dict[str, Any], List[Dict[str, str]]]]:
+    """Return a template and its messages rendered with variables, None if
+    there is no such template or version.
+
+    Raises core.templates.TemplateVariablesError when variables don't name
+    exactly the template's placeholders.
+    """
+    template = _templates.get(name, version)
+    if template is None:
+        return None
+    return template, render(template, variables)
+
+
+# Upstream credentials added at runtime, and the health of all of them.
+_credentials = CredentialRegistry()
+
+
+def check_credential(target_name: str, target_config: Dict[str, Any], name: str) -> None:
+    """Check that a request may pin credential name of a target.
+
+    Raises core.credentials.CredentialError if the target has no such
+    credential or has disabled it.
+    """
+    _credentials.check_pin(target_name, target_config, name)
+
+
+def add_credential(target_name: str, name: str, api_key: str, weight: float = 1.0) -> None:
+    """Add a named credential to a target's rotation, or replace it."""
+    _credentials.add(target_name, name, api_key, weight)
+
+
+def set_credential_disabled(target_name: str, name: str, disabled: bool) -> None:
+    """Take a target's credential out of rotation, or put it back."""
+    _credentials.set_disabled(target_name, name, disabled)
+
+
+def credential_status(target_name: str, target_config: Dict[str, Any]) -> List[Dict[str, Any]]:
+    """A target's credentials, without their keys, and whether they are
+    active, cooling down or disabled."""
+    return _credentials.status(target_name, target_config)
+
+
+# The upstream rate limits reported to each target's credentials.
+_upstream_limits = UpstreamRateLimits()
+
+
+# The latency of each target's upstream attempts, which deadlines are
+# checked against (see core.latency).
+_latencies = LatencyTracker()
+
+# Candidate choices of the latency routes, by those latencies.
+_latency_router = LatencyRouter(_latencies)
+
+
+def _route_candidate_healthy(targets: Dict[str, Dict], target_name: str, model: Optional[str]) -> bool:
+    """Whether a latency route candidate exists and its circuit is closed."""
+    target_config = targets.get(target_name)
+    return bool(target_config) and not circuit_open(target_name, target_config, model)
+
+
+def route_by_latency(
+    name: str,
+    route: Dict[str, Any],
+    targets: Dict[str, Dict],
+    idempotency_key: Optional[str] = None,
+    tenant: Optional[str] = None,
+) -> RouteChoice:
+    """Pick the candidate of latency route name for a request (see
+    core.latency_routing); candidates that aren't targets count as
+    unhealthy."""
+    return _latency_router.choose(
+        name, route, lambda target, model: _route_candidate_healthy(targets, target, model), idempotency_key, tenant
+    )
+
+
+def latency_route_stats(name: str, route: Dict[str, Any], targets: Dict[str, Dict]) -> Dict[str, Any]:
+    """The per-candidate latency table of latency route name."""
+    return _latency_router.stats(name, route, lambda target, model: _route_candidate_healthy(targets, target, model))
+
+
+def upstream_rate_limits(target_name: str) -> List[Dict[str, Any]]:
+    """The rate limits a target's upstream last reported, one per
+    credential or pool key."""
+    return _upstream_limits.status(target_name)
+
+
+def _credential_auth(target_config: Dict[str, Any], api_key: str) -> Dict[str, Any]:
+    """Auth sending a credential in the header of the target's auth config."""
+    auth_config = target_config.get("auth") or {}
+    header, _ = _auth_header(target_config, auth_config)
+    prefix = auth_config.get("prefix")
+    if prefix is None:
+        prefix = "Bearer " if header == "Authorization" else ""
+    return {"type": "api_key", "header": header, "prefix": prefix, "api_key": api_key}
+
+
+def estimate_llm_cost(
+    target_name: str,
+    target_config: Dict[str, Any],
+    messages: List[Dict[str, Any]],
+    model: Optional[str],
+    max_tokens: Optional[int],
+) -> Dict[str, Any]:
+    """Estimate the cost of an LLM request without sending it.
+
+    Model and max_tokens are resolved as handle_llm_proxy would, including
+    config limits and soft cap throttling. The range runs from the prompt
+    alone to the prompt plus max_completion_tokens at the adapter's pricing;
+    cost_estimate_usd is the figure budget caps are checked against. Cost
+    fields are None for models without pricing, and cost_max_usd also when
+    max_tokens is unbounded.
+    """
+    plan = _plan_llm_request(target_name, target_config, messages, model, max_tokens, None, None, None)
+    prompt_tokens = CostEstimator.count_tokens(messages, plan.model)
+    adapter = plan.adapter or (get_adapter(plan.provider) if plan.provider else None)
+    cost_min = cost_max = None
+    if adapter:
+        cost_min = adapter.get_cost_usd(plan.model, prompt_tokens, 0)
+        if cost_min is not None and plan.max_tokens:
+            cost_max = adapter.get_cost_usd(plan.model, prompt_tokens, plan.max_tokens)
+    return {
+        "target": target_name,
+        "provider": plan.provider,
+        "model": plan.model,
+        "prompt_tokens": prompt_tokens,
+        "max_completion_tokens": plan.max_tokens,
+        "cost_min_usd": cost_min,
+        "cost_max_usd": cost_max,
+        "cost_estimate_usd": plan.cost_estimate_usd,
+        "max_tokens_reduced": plan.original_max_tokens is not None,
+    }
+
+
+def _budget_rejection(
+    cost_estimate_usd: Optional[float],
+    max_cost_usd: Optional[float],
+    budget_cap_usd: Optional[float],
+    tenant: Optional[str],
+    key_limits: Optional[KeyLimits] = None,
+    holds: Optional[BudgetHolds] = None,
+) -> Optional[Tuple[str, str, Dict[str, Any]]]:
+    """Check an estimate against the request's max_cost_usd, the tenant's
+    monthly budget and the API key's budget (key_limits).
+
+    Returns (cost policy, message, error details) if the request must be
+    rejected; _budget_error_code gives its error code. An estimate equal to
+    a ceiling passes; requests without an estimate (unknown pricing) are
+    never rejected. The budgets are checked against the estimates reserved
+    by requests in flight as well as the month's spend; with holds, a
+    request that passes reserves its estimate on them until holds is
+    released.
+    """
+    if cost_estimate_usd is None:
+        return None
+    if max_cost_usd is not None and cost_estimate_usd > max_cost_usd:
+        return (
+            "max_cost_rejected",
+            f"Estimated cost ${cost_estimate_usd:.6f} exceeds max_cost_usd ${max_cost_usd:.6f}",
+            {"cost_estimate_usd": cost_estimate_usd, "max_cost_usd": max_cost_usd},
+        )
+    held = holds if holds is not None else BudgetHolds()
+    try:
+        if budget_cap_usd is not None:
+            reservation = _budget_ledger.reserve(tenant, cost_estimate_usd, budget_cap_usd)
+            if reservation is None:
+                status = budget_status(tenant, budget_cap_usd)
+                held.release()
+                return (
+                    "budget_rejected",
+                    (
+                        f"Estimated cost ${cost_estimate_usd:.6f} exceeds the remaining monthly budget "
+                        f"${max(status['remaining_usd'] - status['reserved_usd'], 0.0):.6f}"
+                        + _reserved_note(status["reserved_usd"])
+                    ),
+                    {
+                        "cost_estimate_usd": cost_estimate_usd,
+                        "budget_cap_usd": budget_cap_usd,
+                        "spent_usd": status["spent_usd"],
+                        "reserved_usd": status["reserved_usd"],
+                        "reset_at": status["reset_at"],
+                    },
+                )
+            held.add(_budget_ledger, reservation)
+        if key_limits and key_limits.monthly_budget_usd is not None:
+            cap = key_limits.monthly_budget_usd
+            reservation = _key_budget_ledger.reserve(key_limits.name, cost_estimate_usd, cap)
+            if reservation is None:
+                spent = _key_budget_ledger.spent(key_limits.name)
+                reserved = _key_budget_ledger.reserved(key_limits.name)
+                held.release()
+                return (
+                    "key_budget_rejected",
+                    (
+                        f"Estimated cost ${cost_estimate_usd:.6f} exceeds the remaining monthly budget "
+                        f"${max(cap - spent - reserved, 0.0):.6f} of API key '{key_limits.name}'"
+                        + _reserved_note(reserved)
+                    ),
+                    {
+                        "cost_estimate_usd": cost_estimate_usd,
+                        "api_key_name": key_limits.name,
+                        "key_budget_cap_usd": cap,
+                        "spent_usd": spent,
+                        "reserved_usd": reserved,
+                        "reset_at": month_bounds(datetime.now(timezone.utc))[1].isoformat(),
+                    },
+                )
+            held.add(_key_budget_ledger, reservation)
+    finally:
+        if holds is None:
+            held.release()
+    return None
+
+
+def _reserved_note(reserved_usd: float) -> str:
+    """The part of a budget rejection's message about requests in flight."""
+    if reserved_usd <= 0:
+        return ""
+    return f", with ${reserved_usd:.6f} more reserved by requests in flight"
+
+
+def _budget_error_code(policy: str) -> ErrorCode:
+    """Error code of a _budget_rejection: the API key's own budget is told
+    apart from the tenant's and the request's ceilings."""
+    return ErrorCode.KEY_BUDGET_EXCEEDED if policy == "key_budget_rejected" else ErrorCode.BUDGET_EXCEEDED
+
+
+# Content types whose bodies /proxy/http returns as text. Anything else
+# (images, PDFs, application/octet-stream, ...) is binary.
+_TEXT_CONTENT_TYPES = {
+    "application/json",
+    "application/xml",
+    "application/javascript",
+    "application/x-www-form-urlencoded",
+    "application/x-ndjson",
+    "application/graphql",
+    "application/yaml",
+}
+
+
+def _request_body_bytes(body: Optional[str], body_encoding: str = "utf8") -> Optional[bytes]:
+    """Bytes of a /proxy/http request body sent as text or base64."""
+    if not body:
+        return None
+    if body_encoding == "base64":
+        return base64.b64decode(body)
+    return body.encode()
+
+
+def _is_binary_body(content_type: Optional[str], content: bytes) -> bool:
+    """Whether a response body must be base64-encoded to survive JSON."""
+    media_type = (content_type or "").split(";", 1)[0].strip().lower()
+    textual = (
+        not media_type
+        or media_type.startswith("text/")
+        or media_type in _TEXT_CONTENT_TYPES
+        or media_type.endswith(("+json", "+xml"))
+    )
+    if not textual:
+        return True
+    try:
+        content.decode()
+    except UnicodeDecodeError:
+        return True
+    return False
+
+
+def _http_response_data(
+    status_code: int, headers: Dict[str, str], content: bytes, raw: bool = False
+) -> Dict[str, Any]:
+    """Build the {status_code, headers, body} data of a /proxy/http result.
+
+    JSON bodies are parsed and other text is wrapped as {"raw": text}. Binary
+    bodies (a non-text content type, or bytes that are not UTF-8) are sent
+    as a base64 string with body_encoding "base64", so they arrive unchanged.
+    With raw (raw_passthrough) text bodies, empty ones included, are kept as
+    the text itself with body_encoding "raw"; see raw_response_body.
+    """
+    data: Dict[str, Any] = {"status_code": status_code, "headers": headers}
+    if content and _is_binary_body(_header(headers, "content-type"), content):
+        data["body"] = base64.b64encode(content).decode("ascii")
+        data["body_encoding"] = "base64"
+    elif raw:
+        data["body"] = content.decode()
+        data["body_encoding"] = "raw"
+    elif not content:
+        data["body"] = {}
+    else:
+        text = content.decode()
+        try:
+            data["body"] = json.loads(text)
+        except ValueError:
+            data["body"] = {"raw": text}
+    return data
+
+
+async def _read_http_body(
+    response: httpx.Response, limit: Optional[int], truncate: bool
+) -> Tuple[Optional[bytes], bool]:
+    """Read the body of a /proxy/http upstream response, at most limit bytes.
+
+    Returns the body and whether it was cut short. A body over limit is cut
+    to its first limit bytes when truncate is set; otherwise it is not kept
+    and the body is None. With a limit the response must have been
+    requested with stream=True; it is closed once read.
+    """
+    if limit is None:
+        return await response.aread(), False
+    try:
+        declared = response.headers.get("content-length")
+        if not truncate and declared and declared.isdigit() and int(declared) > limit:
+            return None, False
+        chunks: List[bytes] = []
+        size = 0
+        async for chunk in response.aiter_bytes():
+            if size + len(chunk) > limit:
+                if not truncate:
+                    return None, False
+                chunks.append(chunk[: limit - size])
+                return b"".join(chunks), True
+            chunks.append(chunk)
+            size += len(chunk)
+        return b"".join(chunks), False
+    finally:
+        await response.aclose()
+
+
+def _content_length(response: httpx.Response) -> Optional[int]:
+    declared = response.headers.get("content-length")
+    return int(declared) if declared and declared.isdigit() else None
+
+
+def _response_too_large(
+    response: httpx.Response,
+    target_name: str,
+    limit: int,
+    retry_stats: RetryStats,
+    request_id: str,
+    start_time: float,
+) -> ErrorResponse:
+    """RESPONSE_TOO_LARGE for an upstream body over max_response_bytes."""
+    details: Dict[str, Any] = {"max_response_bytes": limit, "upstream_status": response.status_code}
+    content_length = _content_length(response)
+    if content_length is not None:
+        details["content_length"] = content_length
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="response_too_large",
+            code=ErrorCode.RESPONSE_TOO_LARGE.value,
+            message=f"Upstream response is larger than max_response_bytes {limit}",
+            retryable=False,
+            target=target_name,
+            status_code=502,
+            details=details,
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            cache_hit=False,
+            idempotent_hit=False,
+            **_retry_meta(retry_stats),
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+            trace_id=None,
+        ),
+    )
+
+
+def _header(headers: Dict[str, str], name: str) -> Optional[str]:
+    for key, value in headers.items():
+        if key.lower() == name:
+            return value
+    return None
+
+
+# Headers that describe a single connection rather than the response.
+_HOP_BY_HOP_HEADERS = {
+    "connection", "keep-alive", "proxy-authenticate", "proxy-authorization",
+    "te", "trailer", "transfer-encoding", "upgrade",
+}
+
+
+def _upstream_header_lists(headers: httpx.Headers) -> Dict[str, List[str]]:
+    """Every end-to-end upstream header, lower-cased, with all its values.
+
+    Stored with a /proxy/http result as "upstream_headers", so cache and
+    idempotent hits can answer any request's response_headers.
+    """
+    hop_by_hop = set(_HOP_BY_HOP_HEADERS)
+    for value in headers.get_list("connection"):
+        hop_by_hop.update(token.strip().lower() for token in value.split(","))
+    lists: Dict[str, List[str]] = {}
+    for name, value in headers.multi_items():
+        name = name.lower()
+        if name not in hop_by_hop:
+            lists.setdefault(name, []).append(value)
+    return lists
+
+
+def _upstream_meta(data: Dict[str, Any], response_headers: Optional[List[str]]) -> Dict[str, Any]:
+    """MetaResponse fields describing the upstream response behind data."""
+    fields: Dict[str, Any] = {"upstream_status": data.get("status_code")}
+    if response_headers:
+        # Entries stored before upstream_headers existed only have headers
+        lists = data.get("upstream_headers")
+        if lists is None:
+            lists = {
+                k.lower(): [v] for k, v in data.get("headers", {}).items()
+                if k.lower() not in _HOP_BY_HOP_HEADERS
+            }
+        if "*" in response_headers:
+            fields["upstream_headers"] = dict(lists)
+        else:
+            fields["upstream_headers"] = {name: lists[name] for name in response_headers if name in lists}
+    if data.get("redirect_chain"):
+        fields["redirect_chain"] = data["redirect_chain"]
+    if data.get("truncated"):
+        fields["truncated"] = True
+        fields["original_content_length"] = data.get("original_content_length")
+    return fields
+
+
+def _redirect_limit(
+    target_config: Dict[str, Any],
+    follow_redirects: Optional[bool] = None,
+    max_redirects: Optional[int] = None,
+) -> int:
+    """Number of upstream redirects a /proxy/http request follows.
+
+    The request's follow_redirects and max_redirects override the target's
+    (default: redirects are not followed, and at most 5 when they are).
+    0 means 3xx responses are returned as they are.
+    """
+    if follow_redirects is None:
+        follow_redirects = target_config.get("follow_redirects", False)
+    if not follow_redirects:
+        return 0
+    if max_redirects is None:
+        max_redirects = target_config.get("max_redirects", 5)
+    return max_redirects
+
+
+def _redirect_chain(response: httpx.Response) -> List[str]:
+    """URLs requested to get response: the original and each redirect."""
+    return [str(hop.url) for hop in response.history] + [str(response.url)]
+
+
+def _etag_matches(condition: str, etag: Optional[str]) -> bool:
+    """Weak comparison of an If-None-Match list against an ETag.
+
+    W/"x" and "x" match each other, as If-None-Match requires (RFC 9110
+    13.1.2), so upstreams that only send weak ETags still revalidate.
+    """
+    if not etag:
+        return False
+    if condition.strip() == "*":
+        return True
+    opaque = _opaque_etag(etag)
+    return any(_opaque_etag(tag) == opaque for tag in condition.split(","))
+
+
+def _opaque_etag(tag: str) -> str:
+    tag = tag.strip()
+    return tag[2:] if tag.startswith("W/") else tag
+
+
+def _cache_validators(data: Dict[str, Any]) -> Dict[str, str]:
+    """Conditional request headers that revalidate a cached result."""
+    headers = data.get("headers", {})
+    validators = {}
+    etag = _header(headers, "etag")
+    if etag:
+        validators["If-None-Match"] = etag
+    last_modified = _header(headers, "last-modified")
+    if last_modified:
+        validators["If-Modified-Since"] = last_modified
+    return validators
+
+
+def _revalidates(response_etag: Optional[str], data: Dict[str, Any]) -> bool:
+    """Whether a 304 answers the validators of the cached result data."""
+    cached_etag = _header(data.get("headers", {}), "etag")
+    return not response_etag or not cached_etag or _etag_matches(response_etag, cached_etag)
+
+
+def _http_stale_ttl(data: Dict[str, Any], cache_config: Dict[str, Any], stale_ttl_s: int) -> int:
+    """How long past its TTL a /proxy/http result stays cached.
+
+    Results with an ETag or Last-Modified are kept for the target's
+    stale_ttl_s in every cache mode, so an expired entry is revalidated with
+    a conditional request instead of refetched.
+    """
+    if _cache_validators(data):
+        return max(stale_ttl_s, cache_config.get("stale_ttl_s", 86400))
+    return stale_ttl_s
+
+
+def _not_modified_meta(data: Dict[str, Any], response_headers: Optional[List[str]]) -> Dict[str, Any]:
+    """MetaResponse fields answering a request's if_none_match with 304."""
+    fields = _upstream_meta(data, response_headers)
+    fields.update(not_modified=True, upstream_status=304)
+    return fields
+
+
+def _public_http_data(data: Dict[str, Any]) -> Dict[str, Any]:
+    """data of a /proxy/http result without what only the proxy keeps."""
+    return {
+        k: v for k, v in data.items()
+        if k not in (
+            "upstream_headers", "redirect_chain", "truncated", "original_content_length", "response_extracted"
+        )
+    }
+
+
+def _transform_response(transformation: Optional[Dict[str, Any]], data: Dict[str, Any]) -> None:
+    """Apply a target's response_extract to /proxy/http result data, marking
+    data so the cache and idempotent hits it is served as report it too."""
+    if transform_response(transformation, data):
+        data["response_extracted"] = True
+    _record_response_transform(data)
+
+
+def _record_response_transform(data: Dict[str, Any]) -> None:
+    """Record the response transformation stored data went through."""
+    if data.get("response_extracted"):
+        record_applied(["response_extract"])
+
+
+def _http_cached_data(cached: Dict[str, Any]) -> Dict[str, Any]:
+    """Result data of a cached /proxy/http response."""
+    data = {
+        "status_code": cached.get("status_code", 200),
+        "headers": cached.get("headers", {}),
+        "body": cached.get("body", {}),
+    }
+    if cached.get("body_encoding"):
+        data["body_encoding"] = cached["body_encoding"]
+    return data
+
+
+def _response_encoding(data: Dict[str, Any]) -> str:
+    return data.get("body_encoding", "utf8")
+
+
+def _filtered_cache_entry(data: Dict[str, Any], cached_filter: Optional[str], kind: str) -> Dict[str, Any]:
+    """The data of a response as cached under cached_filter (see
+    apply_response_filter): a /proxy/http result with its body filtered,
+    or filtered LLM data."""
+    if not cached_filter:
+        return data
+    selection = parse_response_filter(cached_filter)
+    if kind != "http":
+        return selection.apply(data)
+    if data.get("body_encoding") == "base64":
+        return data
+    return {**data, "body": selection.apply(data.get("body"))}
+
+
+def _filtered_cache_override(
+    cache_override: Optional[Dict[str, Any]],
+    cached_filter: Optional[str],
+    method: str,
+    full_url: str,
+    headers: Optional[Dict[str, str]],
+    body_bytes: Optional[bytes],
+    query: Optional[Dict[str, Any]],
+) -> Optional[Dict[str, Any]]:
+    """Key data of a /proxy/http request whose response is cached filtered:
+    its own key plus the filter, so filtered entries never serve requests
+    for the full body or another filter."""
+    if not cached_filter:
+        return cache_override
+    derived = make_cache_key_hash(method, full_url, headers, body_bytes, query, cache_override)
+    return {"key": derived, "response_filter": cached_filter}
+
+
+def _raw_cache_override(
+    cache_override: Optional[Dict[str, Any]],
+    raw_passthrough: bool,
+    method: str,
+    full_url: str,
+    headers: Optional[Dict[str, str]],
+    body_bytes: Optional[bytes],
+    query: Optional[Dict[str, Any]],
+) -> Optional[Dict[str, Any]]:
+    """Key data of a /proxy/http request with raw_passthrough: its own key
+    marked raw, as its entries keep the upstream body as text (see
+    _http_response_data)."""
+    if not raw_passthrough:
+        return cache_override
+    derived = make_cache_key_hash(method, full_url, headers, body_bytes, query, cache_override)
+    return {"key": derived, "raw_passthrough": True}
+
+
+def raw_response_body(result: Any, raw_passthrough: bool, kind: str) -> Optional[bytes]:
+    """Take the upstream body a successful raw_passthrough result keeps out of
+    its data, leaving the data as it is without raw_passthrough.
+
+    For kind "http" that is the text of body_encoding "raw" (see
+    _http_response_data); for "llm" the provider's response in the data's
+    raw_body. With raw_passthrough the bytes to send as data are returned:
+    the body itself if it is JSON, else a JSON string of its base64
+    (meta.response_encoding "base64"), and meta.raw_passthrough is set.
+    Results without a kept body, such as static fallbacks, idempotent
+    replays of a request without raw_passthrough, or not-modified /proxy/http
+    responses, return None and are sent as usual.
+    """
+    data = getattr(result, "data", None)
+    if not getattr(result, "success", False) or not isinstance(data, dict):
+        return None
+    if kind == "http" and data.get("body_encoding") == "base64":
+        if not raw_passthrough:
+            return None
+        result.meta.raw_passthrough = True
+        result.meta.response_encoding = "base64"
+        return json.dumps(data["body"]).encode()
+    if kind == "http":
+        if data.get("body_encoding") != "raw":
+            return None
+        text = data["body"]
+        result.data = _http_response_data(data["status_code"], data.get("headers", {}), text.encode())
+        result.meta.response_encoding = _response_encoding(result.data)
+    else:
+        text = data.get("raw_body")
+        if text is None:
+            return None
+        result.data = {k: v for k, v in data.items() if k != "raw_body"}
+    if not raw_passthrough:
+        return None
+    result.meta.raw_passthrough = True
+    if _is_json_text(text):
+        result.meta.response_encoding = "utf8"
+        return text.encode()
+    result.meta.response_encoding = "base64"
+    return json.dumps(base64.b64encode(text.encode()).decode("ascii")).encode()
+
+
+def _llm_raw_body(response_body: bytes, validation: Optional["OutputValidation"]) -> str:
+    """The provider response kept for raw_passthrough: the body as it was
+    sent, or that of the repair whose output passed validation."""
+    if validation and validation.raw:
+        return json.dumps(validation.raw)
+    return response_body.decode()
+
+
+def _is_json_text(text: str) -> bool:
+    """Whether text is a JSON document that can be sent as it is, without
+    the NaN and Infinity json.loads also takes."""
+    def reject(constant: str) -> None:
+        raise ValueError(constant)
+
+    try:
+        json.loads(text, parse_constant=reject)
+    except ValueError:
+        return False
+    return True
+
+
+def apply_response_filter(result: Any, response_filter: Optional[str], kind: str) -> None:
+    """Keep only the fields response_filter selects of a successful result's
+    data, or of its upstream body for kind "http", and report the sizes
+    before and after in meta.original_bytes and meta.filtered_bytes.
+
+    response_filter must parse (see core.response_filter). Failures, dry
+    runs, not-modified responses and binary bodies are left as they are.
+    """
+    data = getattr(result, "data", None)
+    if not response_filter or not getattr(result, "success", False) or not isinstance(data, dict):
+        return
+    selection = parse_response_filter(response_filter)
+    if kind == "http":
+        if "body" not in data or data.get("body_encoding") == "base64":
+            return
+        original = data["body"]
+        filtered = selection.apply(original)
+        result.data = {**data, "body": filtered}
+    else:
+        original = data
+        filtered = result.data = selection.apply(data)
+    result.meta.original_bytes = payload_size(original)
+    result.meta.filtered_bytes = payload_size(filtered)
+
+
+def injected_error(fault: Fault, target_name: str, request_id: str) -> ErrorResponse:
+    """The error an error fault answers with, as ReliAPI would raise it."""
+    status_code, error_type, retryable = fault.error()
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type=error_type,
+            code=fault.error_code,
+            message=f"Injected fault: {fault.error_code}",
+            retryable=retryable,
+            target=target_name,
+            status_code=status_code,
+            source="reliapi",
+            retry_after_s=1.0 if status_code == 429 else None,
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            cache_hit=False,
+            retries=0,
+            duration_ms=0,
+            request_id=request_id,
+            trace_id=None,
+        ),
+    )
+
+
+def comparison_meta(
+    primary: Union[SuccessResponse, ErrorResponse],
+    variant: Union[SuccessResponse, ErrorResponse],
+    template: Optional[Dict[str, Any]] = None,
+) -> ComparisonMeta:
+    """meta.comparison of a request sent with compare: variant's leg, the
+    template it was rendered from ({name, version}), and how similar its
+    completion is to primary's."""
+    data = variant.data if variant.success and isinstance(variant.data, dict) else {}
+    similarity = None
+    if data and primary.success and isinstance(primary.data, dict):
+        similarity = token_similarity(primary.data.get("content") or "", data.get("content") or "")
+    return ComparisonMeta(
+        target=variant.meta.served_by or variant.meta.target,
+        model=variant.meta.model,
+        template_name=(template or {}).get("name"),
+        template_version=(template or {}).get("version"),
+        success=variant.success,
+        content=data.get("content"),
+        finish_reason=data.get("finish_reason"),
+        usage=data.get("usage"),
+        cost_usd=variant.meta.cost_usd,
+        duration_ms=variant.meta.duration_ms,
+        cache_hit=variant.meta.cache_hit,
+        cache_key=variant.meta.cache_key,
+        similarity=similarity,
+        error=None if variant.success else variant.error,
+    )
+
+
+def _target_rule_violation(target_config: Dict[str, Any], method: str, path: str) -> Optional[str]:
+    """Check a /proxy/http call against the target's allowed_methods and
+    allowed_paths. Returns the reason it is not allowed, or None."""
+    allowed_methods = target_config.get("allowed_methods")
+    if allowed_methods is not None and method.upper() not in allowed_methods:
+        return f"Method {method.upper()} is not allowed for this target"
+    allowed_paths = target_config.get("allowed_paths")
+    if allowed_paths is not None:
+        bare_path = path.split("?", 1)[0]
+        if not any(fnmatch.fnmatchcase(bare_path, pattern) for pattern in allowed_paths):
+            return f"Path {bare_path} is not allowed for this target"
+    return None
+
+
+# The largest timeout_ms of a target without max_timeout_ms
+MAX_TIMEOUT_MS = 300000
+
+
+def _timeout_rejection(
+    target_config: Dict[str, Any], target_name: str, timeout_ms: Optional[int], request_id: str, start_time: float
+) -> Optional[ErrorResponse]:
+    """BAD_REQUEST for a timeout_ms above the target's max_timeout_ms."""
+    max_timeout_ms = target_config.get("max_timeout_ms") or MAX_TIMEOUT_MS
+    if timeout_ms is None or timeout_ms <= max_timeout_ms:
+        return None
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="client_error",
+            code=ErrorCode.BAD_REQUEST.value,
+            message=f"timeout_ms {timeout_ms} exceeds the target's max_timeout_ms {max_timeout_ms}",
+            retryable=False,
+            target=target_name,
+            status_code=400,
+            details={"timeout_ms": timeout_ms, "max_timeout_ms": max_timeout_ms},
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            cache_hit=False,
+            retries=0,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+            trace_id=None,
+        ),
+    )
+
+
+DEFAULT_IDEMPOTENCY_MAX_TTL_S = 7 * 24 * 3600
+
+
+def _idempotency_ttl_rejection(
+    target_config: Dict[str, Any],
+    target_name: str,
+    idempotency_ttl_s: Optional[int],
+    request_id: str,
+    start_time: float,
+) -> Optional[ErrorResponse]:
+    """BAD_REQUEST for an idempotency_ttl_s above the target's idempotency_max_ttl_s."""
+    max_ttl_s = target_config.get("idempotency_max_ttl_s") or DEFAULT_IDEMPOTENCY_MAX_TTL_S
+    if idempotency_ttl_s is None or idempotency_ttl_s <= max_ttl_s:
+        return None
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="client_error",
+            code=ErrorCode.BAD_REQUEST.value,
+            message=f"idempotency_ttl_s {idempotency_ttl_s} exceeds the target's idempotency_max_ttl_s {max_ttl_s}",
+            retryable=False,
+            target=target_name,
+            status_code=400,
+            details={"idempotency_ttl_s": idempotency_ttl_s, "idempotency_max_ttl_s": max_ttl_s},
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            cache_hit=False,
+            retries=0,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+            trace_id=None,
+        ),
+    )
+
+
+def _idempotency_ttl(
+    target_config: Dict[str, Any], idempotency_ttl_s: Optional[int], cache_ttl: Optional[int]
+) -> int:
+    """Seconds an idempotency key is honored: the request's idempotency_ttl_s,
+    or else the response's cache TTL, so replays and cache hits agree."""
+    if idempotency_ttl_s:
+        return idempotency_ttl_s
+    cache_config = target_config.get("cache", {})
+    return cache_ttl or cache_config.get("ttl_s", 3600) if cache_config.get("enabled", True) else 3600
+
+
+def stamp_idempotency_expiry(
+    meta: MetaResponse, idempotency: IdempotencyManager, idempotency_key: Optional[str], tenant: Optional[str]
+) -> None:
+    """Set the idempotency TTL and expiry of a response that registered
+    idempotency_key; replays already carry them (see record_replay)."""
+    if not idempotency_key or meta.cache_hit or meta.idempotent_hit:
+        return
+    for name, value in idempotency.expiry_meta(idempotency_key, tenant=tenant).items():
+        setattr(meta, name, value)
+
+
+def _dry_run_response(
+    cache_entry_exists: bool, request_id: str, start_time: float, **meta_fields: Any
+) -> SuccessResponse:
+    """Answer a dry_run request with what it resolved to and no data.
+
+    Handlers return it once validation, budget checks, the cache key and
+    the cost estimate are done, before the cache, idempotency or upstream
+    are touched; the route stamps the target version as for other answers.
+    """
+    return SuccessResponse(
+        success=True,
+        data=None,
+        meta=MetaResponse(
+            **meta_fields,
+            dry_run=True,
+            cache_entry_exists=cache_entry_exists,
+            cache_hit=False,
+            idempotent_hit=False,
+            retries=0,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+            trace_id=None,
+        ),
+    )
+
+
+def _trim_context(
+    messages: List[Dict[str, Any]],
+    model: str,
+    context_policy: Optional[Dict[str, Any]],
+) -> Tuple[List[Dict[str, Any]], Dict[str, Any]]:
+    """Fit messages to a context_policy (schemas.ContextPolicy).
+
+    Returns the messages to send and the meta fields reporting the trim,
+    none without a policy. Raises ContextTooLongError as trim_messages does.
+    """
+    if not context_policy:
+        return messages, {}
+    trim = trim_messages(messages, model, context_policy["max_prompt_tokens"], context_policy["strategy"])
+    return trim.messages, {"trimmed_messages": trim.trimmed_messages, "prompt_tokens_after_trim": trim.prompt_tokens}
+
+
+def _redact_prompt(
+    messages: List[Dict[str, Any]],
+    target_config: Dict[str, Any],
+) -> Tuple[List[Dict[str, Any]], Optional[str], Dict[str, Any]]:
+    """Apply a target's redaction config (see core.redaction).
+
+    Returns the messages to send, the digest of the redacted values to key
+    the cache with (None when there were none or the config shares entries
+    across values), and the meta fields reporting the redaction, none
+    without a config.
+    """
+    config = target_config.get("redaction")
+    if not config or not config.get("enabled", True):
+        return messages, None, {}
+    result = redact_messages(messages, config)
+    digest = None if config.get("share_cache_entries") else result.digest
+    return result.messages, digest, {"redactions_applied": result.applied}
+
+
+def _context_rejection(
+    e: ContextTooLongError, target_name: str, model: str, request_id: str, start_time: float
+) -> ErrorResponse:
+    """CONTEXT_LENGTH_EXCEEDED for a prompt that doesn't fit its context_policy."""
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="client_error",
+            code=ErrorCode.CONTEXT_LENGTH_EXCEEDED.value,
+            message=str(e),
+            retryable=False,
+            target=target_name,
+            status_code=400,
+            details={"prompt_tokens": e.prompt_tokens, "max_prompt_tokens": e.max_prompt_tokens},
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            model=model,
+            cache_hit=False,
+            retries=0,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+            trace_id=None,
+        ),
+    )
+
+
+def _translation_error(
+    e: TranslationError, target_name: str, provider: Optional[str], model: str, request_id: str, start_time: float
+) -> ErrorResponse:
+    """BAD_REQUEST for a request the target's provider can't express,
+    UNSUPPORTED_PARAMETER, naming the model, for one the model can't, or
+    MODEL_LIMITS_EXCEEDED, listing each offending field with its allowed
+    range, for one outside the model's capabilities. A model without an
+    Azure OpenAI deployment is a BAD_REQUEST listing those there are."""
+    if isinstance(e, UnknownDeploymentError):
+        available = ", ".join(e.deployments) or "none"
+        code = ErrorCode.BAD_REQUEST
+        message = f"Target '{target_name}' has no Azure OpenAI deployment for model '{e.model}' (deployments: {available})"
+        details = {"field": e.field, "model": e.model, "deployments": e.deployments}
+    elif isinstance(e, ModelLimitsError):
+        reasons = "; ".join(issue["message"] for issue in e.issues)
+        code, message = ErrorCode.MODEL_LIMITS_EXCEEDED, f"Request outside what {e.model} accepts: {reasons}"
+        details = {"model": e.model, "issues": e.issues}
+    elif isinstance(e, UnsupportedParameterError):
+        code, message, details = ErrorCode.UNSUPPORTED_PARAMETER, str(e), {"field": e.field, "model": e.model}
+    else:
+        code, message, details = ErrorCode.BAD_REQUEST, f"Can't translate the request for {provider}: {e}", {"field": e.field}
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="client_error",
+            code=code.value,
+            message=message,
+            retryable=False,
+            target=target_name,
+            status_code=400,
+            details=details,
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            provider=provider,
+            model=model,
+            cache_hit=False,
+            retries=0,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+            trace_id=None,
+        ),
+    )
+
+
+def _request_error_detail(e: httpx.RequestError, target_name: str) -> ErrorDetail:
+    """ErrorDetail for a network failure, for the request's timeout_ms passing,
+    or for a deadline too short to call the upstream at all."""
+    if isinstance(e, DeadlineTooShortError):
+        return ErrorDetail(
+            type="client_error",
+            code=ErrorCode.DEADLINE_TOO_SHORT.value,
+            message=str(e),
+            retryable=False,
+            target=target_name,
+            status_code=400,
+            details={"deadline_ms": int(e.deadline_s * 1000), "p50_latency_ms": int(e.expected_s * 1000)},
+        )
+    if isinstance(e, UpstreamTimeoutError):
+        return ErrorDetail(
+            type="upstream_error",
+            code=ErrorCode.UPSTREAM_TIMEOUT.value,
+            message=str(e),
+            retryable=True,
+            target=target_name,
+            status_code=504,
+            details={"timeout_ms": int(e.timeout_s * 1000), "attempts_completed": e.attempts_completed},
+        )
+    return ErrorDetail(
+        type="upstream_error",
+        code=ErrorCode.NETWORK_ERROR.value,
+        message=f"Network error: {str(e)}",
+        retryable=True,
+        target=target_name,
+        status_code=502,
+    )
+
+
+def stamp_target_version(meta: MetaResponse, targets: Dict[str, Dict]) -> None:
+    """Set meta.target_version from the targets mapping a request ran with."""
+    meta.target_version = target_version(targets, meta.served_by or meta.target)
+
+
+def _retry_meta(stats: RetryStats) -> Dict[str, Any]:
+    """MetaResponse fields describing the upstream attempts of a request."""
+    return {
+        "retries": max(stats.attempts - 1, 0),
+        "attempts": stats.attempts or None,
+        "retry_delays_ms": list(stats.delays_ms) if stats.attempts else None,
+        "attempts_skipped_for_deadline": stats.skipped_for_deadline or None,
+    }
+
+
+def create_http_client(
+    target_config: Dict[str, Any],
+    target_name: str,
+    key_pool_manager: Optional[KeyPoolManager] = None,
+    provider: Optional[str] = None,
+    request_timeout_ms: Optional[int] = None,
+    model: Optional[str] = None,
+) -> Tuple[UpstreamHTTPClient, Optional[ProviderKey], str]:
+    """Create HTTP client for target.
+
+    request_timeout_ms bounds each request made with the client, retries
+    included; a single upstream call may then run until that deadline even
+    when the target's timeout_ms is shorter. Against the target's observed
+    P50 latency, a deadline too short for one attempt fails the request
+    before the upstream is called, and retries that can't finish in time
+    are skipped. A target with named
+    credentials authenticates with one picked for the request's
+    select_credentials choice (see core.credentials), whose health every
+    upstream status updates; auth_source is then "credential". Calls are
+    paced by the rate limit the upstream reports to that credential or pool
+    key (see core.upstream_limits) unless upstream_rate_limit disables it.
+    Upstream failures count against the sub-breaker of model or of that
+    credential when the target's circuit.scope asks for one (see
+    circuit_status); the client's circuit_key names it.
+    """
+    base_url = target_config["base_url"]
+    timeout_ms = max(target_config.get("timeout_ms", 20000), request_timeout_ms or 0)
+    timeout_s = timeout_ms / 1000.0
+    
+    # Circuit breaker (shared across requests so failures accumulate)
+    circuit_breaker = get_circuit_breaker(target_name, target_config.get("circuit", {}))
+    
+    # Retry matrix
+    retry_config = target_config.get("retry_matrix", {})
+    retry_matrix = {}
+    for error_class, policy in retry_config.items():
+        retry_matrix[error_class] = RetryMatrix(
+            attempts=policy.get("attempts", 3),
+            backoff=policy.get("backoff", "exp-jitter"),
+            base_s=policy.get("base_s", 1.0),
+            max_s=policy.get("max_s", 60.0),
+        )
+    
+    # Auth: use key pool if available, otherwise fallback to targets.auth
+    if not provider:
+        # Try to detect provider from target config
+        llm_config = target_config.get("llm", {})
+        provider = llm_config.get("provider")
+    
+    # Named credentials of the target win over the key pool
+    on_status = None
+    credential = _credentials.choose(target_name, target_config)
+    if credential:
+        auth, selected_key, auth_source = _credential_auth(target_config, credential["api_key"]), None, "credential"
+
+        def on_status(status_code: int) -> None:
+            _credentials.record(target_name, credential["name"], status_code)
+    else:
+        auth, selected_key, auth_source = _get_auth_from_key_pool_or_fallback(
+            provider or target_name,
+            key_pool_manager,
+            target_config,
+        )
+
+    pacer = None
+    pacing = target_config.get("upstream_rate_limit") or {}
+    if pacing.get("enabled", True):
+        pacer = RateLimitPacer(
+            _upstream_limits,
+            target_name,
+            credential["name"] if credential else selected_key.id if selected_key else None,
+            pacing.get("max_wait_ms", DEFAULT_MAX_WAIT_MS) / 1000.0,
+        )
+
+    client = UpstreamHTTPClient(
+        base_url=base_url,
+        timeout_s=timeout_s,
+        retry_matrix=retry_matrix,
+        circuit_breaker=circuit_breaker,
+        auth=auth,
+        forward_trace_context=bool(target_config.get("forward_trace_context")),
+        allow_private_network=bool(target_config.get("allow_private_network")),
+        deadline_s=request_timeout_ms / 1000.0 if request_timeout_ms else None,
+        on_status=on_status,
+        pacer=pacer,
+        expected_attempt_s=_latencies.p50(target_name),
+        on_latency=lambda latency_s: _latencies.observe(target_name, latency_s),
+        circuit_key=_circuit_scope_key(target_config, model, credential["name"] if credential else None),
+    )
+    
+    return client, selected_key, auth_source
+
+
+def _may_switch_key(
+    key_pool_manager: KeyPoolManager,
+    key_switch_state: KeySwitchState,
+    selected_key: ProviderKey,
+    retry_policy: Optional[RequestRetryPolicy],
+) -> bool:
+    """Whether a failed call may be repeated with another pool key.
+
+    A key switch calls the upstream again, so it is off when the request's
+    retry policy allows a single attempt.
+    """
+    if retry_policy is not None and retry_policy.max_attempts <= 1:
+        return False
+    return key_pool_manager.has_pool(selected_key.provider) and key_switch_state.can_switch()
+
+
+async def _check_key_rate_limit(
+    rate_scheduler: Optional[RateScheduler],
+    selected_key: Optional[ProviderKey],
+    tenant: Optional[str],
+    target_name: str,
+    request_id: str,
+    start_time: float,
+) -> Optional[ErrorResponse]:
+    """Check the rate scheduler for the selected provider key.
+
+    Returns the RATE_LIMIT_RELIAPI error to answer with, or None if the
+    request may proceed.
+    """
+    if not (rate_scheduler and selected_key):
+        return None
+    # Get rate limit config from key pool
+    provider_key_qps = None
+    if selected_key.qps_limit:
+        provider_key_qps = float(selected_key.qps_limit)
+
+    allowed, retry_after_s, limiting_bucket = await rate_scheduler.check_rate_limit(
+        provider_key_id=selected_key.id,
+        tenant=tenant,
+        provider_key_qps=provider_key_qps,
+    )
+    if allowed:
+        return None
+
+    rate_scheduler_429_total.labels(source="reliapi").inc()
+    duration_ms = int((time.time() - start_time) * 1000)
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="rate_limit",
+            code=ErrorCode.RATE_LIMIT_RELIAPI.value,
+            message=f"Rate limit exceeded ({limiting_bucket})",
+            retryable=True,
+            source="reliapi",
+            retry_after_s=retry_after_s,
+            target=target_name,
+            status_code=429,
+            provider_key_status=selected_key.status,
+            hint="Upstream provider is being protected",
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            cache_hit=False,
+            idempotent_hit=False,
+            retries=0,
+            duration_ms=duration_ms,
+            request_id=request_id,
+            trace_id=None,
+        ),
+    )
+
+
+def _queue_full_response(
+    error: QueueFullError,
+    target_name: str,
+    provider: Optional[str],
+    model: Optional[str],
+    request_id: str,
+    start_time: float,
+) -> ErrorResponse:
+    """The QUEUE_FULL error of a request the target's queue turned away."""
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="rate_limit",
+            code=ErrorCode.QUEUE_FULL.value,
+            message=str(error),
+            retryable=True,
+            source="reliapi",
+            retry_after_s=error.retry_after_s,
+            target=target_name,
+            status_code=429,
+            hint="Retry later, or raise the request's priority or queue_timeout_ms",
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            provider=provider,
+            model=model,
+            retries=0,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+
+
+def _budget_rejection_response(
+    rejection: Tuple[str, str, Dict[str, Any]],
+    target_name: str,
+    provider: Optional[str],
+    model: Optional[str],
+    max_tokens: Optional[int],
+    request_id: str,
+    start_time: float,
+    tenant: Optional[str],
+    cost_estimate_usd: Optional[float],
+    max_tokens_reduced: bool,
+    original_max_tokens: Optional[int],
+) -> ErrorResponse:
+    """The BUDGET_EXCEEDED or KEY_BUDGET_EXCEEDED error of a _budget_rejection."""
+    policy, message, details = rejection
+    error_code = _budget_error_code(policy)
+    duration_ms = int((time.time() - start_time) * 1000)
+    budget_events_total.labels(target=target_name, event=policy, tenant=tenant or "default").inc()
+    _log_and_metric_llm_request(
+        request_id=request_id,
+        target_name=target_name,
+        provider=provider,
+        model=model,
+        stream=False,
+        outcome="error",
+        latency_ms=duration_ms,
+        cache_hit=False,
+        idempotent_hit=False,
+        error_code=error_code.value,
+        upstream_status=400,
+        tenant=tenant,
+    )
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="budget_error",
+            code=error_code.value,
+            message=message,
+            retryable=False,
+            target=target_name,
+            status_code=400,
+            details={**details, "model": model, "max_tokens": max_tokens},
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            provider=provider,
+            model=model,
+            cache_hit=False,
+            idempotent_hit=False,
+            retries=0,
+            duration_ms=duration_ms,
+            request_id=request_id,
+            trace_id=None,
+            cost_estimate_usd=cost_estimate_usd,
+            cost_policy_applied=policy,
+            max_tokens_reduced=max_tokens_reduced,
+            original_max_tokens=original_max_tokens,
+        ),
+    )
+
+
+def _concurrency_limit_response(
+    error: ConcurrencyLimitError,
+    target_name: str,
+    provider: Optional[str],
+    model: Optional[str],
+    request_id: str,
+    start_time: float,
+) -> ErrorResponse:
+    """The CONCURRENCY_LIMIT error of a request that found no free slot in time."""
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="concurrency_limit",
+            code=ErrorCode.CONCURRENCY_LIMIT.value,
+            message=str(error),
+            retryable=True,
+            source="reliapi",
+            target=target_name,
+            status_code=429,
+            hint="Retry later, or raise the request's max_wait_ms or the target's max_concurrency",
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            provider=provider,
+            model=model,
+            retries=0,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+
+
+async def handle_http_proxy(
+    target_name: str,
+    method: str,
+    path: str,
+    headers: Optional[Dict[str, str]],
+    query: Optional[Dict[str, Any]],
+    body: Optional[str],
+    idempotency_key: Optional[str],
+    cache_ttl: Optional[int],
+    targets: Dict[str, Dict],
+    cache: Cache,
+    idempotency: IdempotencyManager,
+    request_id: str,
+    tenant: Optional[str] = None,
+    key_pool_manager: Optional[KeyPoolManager] = None,
+    rate_scheduler: Optional[RateScheduler] = None,
+    client_profile_name: Optional[str] = None,
+    client_profile_manager: Optional[ClientProfileManager] = None,
+    cache_key: Optional[str] = None,
+    cache_vary: Optional[List[str]] = None,
+    stale_ttl_s: int = 0,
+    retry: Optional[Dict[str, Any]] = None,
+    body_encoding: str = "utf8",
+    response_headers: Optional[List[str]] = None,
+    if_none_match: Optional[str] = None,
+    follow_redirects: Optional[bool] = None,
+    max_redirects: Optional[int] = None,
+    timeout_ms: Optional[int] = None,
+    idempotency_ttl_s: Optional[int] = None,
+    max_response_bytes: Optional[int] = None,
+    truncate_response: bool = False,
+    dry_run: bool = False,
+    multipart: bool = False,
+    cached_filter: Optional[str] = None,
+    raw_passthrough: bool = False,
+    key_id: Optional[str] = None,
+) -> Union[SuccessResponse, ErrorResponse]:
+    """Handle HTTP proxy request.
+
+    retry is the request's retry policy (schemas.RetryPolicy), overriding the
+    target's retry_matrix; with max_attempts=1 the upstream is called once.
+    body is sent as UTF-8 text, or decoded from base64 when body_encoding is
+    "base64". Binary response bodies come back base64-encoded (see
+    _http_response_data). The upstream headers named in response_headers
+    (lower-case, or "*") are returned in meta.upstream_headers, from cache
+    and idempotent hits as well.
+
+    Expired GET/HEAD entries with an ETag or Last-Modified are revalidated
+    with a conditional upstream request: a 304 reuses the cached body and
+    refreshes its TTL (meta.revalidated), a 200 replaces it. When the
+    response's ETag matches if_none_match, data is empty and
+    meta.not_modified is set.
+
+    follow_redirects and max_redirects override the target's redirect policy
+    (see _redirect_limit); the URLs of followed redirects are returned in
+    meta.redirect_chain. An unfollowed 3xx is returned like any other
+    response, with its Location header.
+
+    timeout_ms bounds the upstream call, retries included; when it passes
+    the request fails with UPSTREAM_TIMEOUT (see _request_error_detail).
+
+    idempotency_key is honored for idempotency_ttl_s seconds (see
+    _idempotency_ttl), up to the target's idempotency_max_ttl_s; a replay
+    after that calls the upstream again.
+
+    Upstream bodies over max_response_bytes (default: the target's
+    max_response_bytes, unlimited without one) fail with RESPONSE_TOO_LARGE,
+    or with truncate_response come back cut to that size with
+    meta.truncated set. Truncated responses are never cached.
+
+    A dry_run returns once the request is validated and its cache key
+    resolved (see _dry_run_response).
+
+    multipart marks a body encoded from the request's multipart parts
+    (schemas.HTTPProxyRequest.encode_multipart_body); such uploads are never
+    cached.
+
+    With a cached_filter (a response_filter sent with filter_before_cache)
+    responses are cached with their body filtered by it, under a key of
+    their own (see _filtered_cache_override). The response itself is not
+    filtered; see apply_response_filter.
+
+    With raw_passthrough the upstream body is kept as the text it was sent
+    as (body_encoding "raw"), in the cache and idempotency store too, under
+    a key of its own (see _raw_cache_override); raw_response_body takes it
+    out of the result.
+
+    The target's transformation rules (core.transformations) rewrite the
+    request once it passed allowed_methods and allowed_paths, before its
+    cache key is resolved, and the body of JSON responses before they are
+    cached; key_id is the name of the caller's API key, for header
+    templates. Applied rules are recorded for track_transformations, and
+    a dry_run returns the transformed request in meta.upstream_request.
+    """
+    start_time = time.time()
+    retry_policy = RequestRetryPolicy.from_dict(retry)
+    retry_stats = RetryStats()
+    # Use KeySwitchState for proper tracking across request lifecycle
+    key_switch_state = KeySwitchState()
+    
+    # Get target config
+    target_config = targets.get(target_name)
+    if not target_config:
+        return ErrorResponse(
+            success=False,
+            error=ErrorDetail(
+                type="client_error",
+                code=ErrorCode.NOT_FOUND.value,
+                message=f"Target '{target_name}' not found",
+                retryable=False,
+                target=None,
+                status_code=404,
+            ),
+            meta=MetaResponse(
+                target=None,
+                cache_hit=False,
+                retries=0,
+                duration_ms=0,
+                request_id=request_id,
+                trace_id=None,
+            ),
+        )
+    
+    rule_violation = _target_rule_violation(target_config, method, path)
+    if rule_violation:
+        return ErrorResponse(
+            success=False,
+            error=ErrorDetail(
+                type="client_error",
+                code=ErrorCode.NOT_ALLOWED.value,
+                message=rule_violation,
+                retryable=False,
+                target=target_name,
+                status_code=403,
+            ),
+            meta=MetaResponse(
+                target=target_name,
+                cache_hit=False,
+                retries=0,
+                duration_ms=int((time.time() - start_time) * 1000),
+                request_id=request_id,
+                trace_id=None,
+            ),
+        )
+    timeout_rejection = _timeout_rejection(target_config, target_name, timeout_ms, request_id, start_time)
+    if timeout_rejection:
+        return timeout_rejection
+    ttl_rejection = _idempotency_ttl_rejection(target_config, target_name, idempotency_ttl_s, request_id, start_time)
+    if ttl_rejection:
+        return ttl_rejection
+    idempotency_ttl = _idempotency_ttl(target_config, idempotency_ttl_s, cache_ttl)
+    response_limit = max_response_bytes or target_config.get("max_response_bytes")
+
+    # From here on the request is the one sent upstream; headers are those
+    # it is keyed by, without per-request ones
+    transformation = target_config.get("transformation")
+    transformed = transform_request(
+        transformation, method, path, headers, body, body_encoding,
+        {"request_id": request_id, "key_id": key_id, "tenant": tenant, "target": target_name},
+    )
+    record_applied(transformed.applied)
+    path, headers, body = transformed.path, transformed.key_headers, transformed.body
+
+    # Build full URL
+    base_url = target_config["base_url"].rstrip("/")
+    full_url = f"{base_url}{path}"
+    
+    # Prepare body
+    body_bytes = _request_body_bytes(body, body_encoding)
+
+    # Responses fetched under another redirect policy than the target's own
+    # are not cached: the cache key does not include the policy
+    redirect_limit = _redirect_limit(target_config, follow_redirects, max_redirects)
+    cacheable = (
+        method.upper() in ["GET", "HEAD"]
+        and redirect_limit == _redirect_limit(target_config)
+        and not multipart
+    )
+    
+    # Resolve cache key (explicit cache_key / cache_vary replace the derived key)
+    cache_override = _cache_key_override(
+        scope={"target": target_name, "method": method.upper()},
+        fields={"path": path, "query": query, "headers": headers, "body": body},
+        cache_key=cache_key,
+        cache_vary=cache_vary,
+    )
+    cache_override = _filtered_cache_override(
+        cache_override, cached_filter, method, full_url, headers, body_bytes, query
+    )
+    cache_override = _raw_cache_override(
+        cache_override, raw_passthrough, method, full_url, headers, body_bytes, query
+    )
+    resolved_cache_key = None
+    if cacheable:
+        resolved_cache_key = make_cache_key_hash(
+            method, full_url, headers, body_bytes, query, cache_override
+        )
+
+    if dry_run:
+        cache_entry_exists = bool(
+            cacheable
+            and target_config.get("cache", {}).get("enabled", True)
+            and cache.get(method, full_url, headers, body_bytes, query, tenant=tenant, key_override=cache_override)
+        )
+        return _dry_run_response(
+            cache_entry_exists, request_id, start_time, target=target_name, cache_key=resolved_cache_key,
+            upstream_request={
+                "method": method.upper(),
+                "url": full_url,
+                "headers": transformed.headers or {},
+                "query": query,
+                "body": body,
+            },
+        )
+    
+    # Check cache for GET/HEAD
+    cache_hit = False
+    if cacheable:
+        cache_config = target_config.get("cache", {})
+        if cache_config.get("enabled", True):
+            ttl = cache_ttl or cache_config.get("ttl_s", 3600)
+            cached = cache.get(
+                method, full_url, headers, body_bytes, query, tenant=tenant, key_override=cache_override
+            )
+            if cached:
+                cache_hit = True
+                duration_ms = int((time.time() - start_time) * 1000)
+                # Update metrics and log
                 _log_and_metric_http_request(
                     request_id=request_id,
                     target_name=target_name,
@@ -397,15 +3149,22 @@ async def handle_http_proxy(
                 cache_hits_total.labels(target=target_name, kind="http", tenant=tenant or "default").inc()
                 http_requests_total.labels(target=target_name, status="success").inc()
                 latency_ms.labels(target=target_name, status="success").observe(duration_ms)
+                data = _http_cached_data(cached)
+                _record_response_transform(cached)
+                if if_none_match and _etag_matches(if_none_match, _header(data["headers"], "etag")):
+                    data, upstream_fields = {}, _not_modified_meta(cached, response_headers)
+                else:
+                    upstream_fields = {
+                        "response_encoding": _response_encoding(data),
+                        **_upstream_meta(cached, response_headers),
+                    }
                 return SuccessResponse(
                     success=True,
-                    data={
-                        "status_code": cached.get("status_code", 200),
-                        "headers": cached.get("headers", {}),
-                        "body": cached.get("body", {}),
-                    },
+                    data=data,
                     meta=MetaResponse(
+                        cache_key=resolved_cache_key,
                         target=target_name,
+                        **upstream_fields,
                         cache_hit=True,
                         idempotent_hit=False,
                         retries=0,
@@ -415,10 +3174,27 @@ async def handle_http_proxy(
                     ),
                 )
     
+    # Revalidate an expired entry instead of refetching it, and pass the
+    # caller's own condition on
+    stale_data: Optional[Dict[str, Any]] = None
+    conditional_headers: Dict[str, str] = {}
+    if resolved_cache_key and target_config.get("cache", {}).get("enabled", True):
+        entry = cache.get_entry(resolved_cache_key, tenant=tenant)
+        if entry and entry["stale"]:
+            conditional_headers = _cache_validators(entry["value"])
+            if conditional_headers:
+                stale_data = entry["value"]
+    if if_none_match:
+        own = conditional_headers.get("If-None-Match")
+        conditional_headers["If-None-Match"] = f"{own}, {if_none_match}" if own else if_none_match
+    upstream_request_headers = (
+        {**(transformed.headers or {}), **conditional_headers} if conditional_headers else transformed.headers
+    )
+
     # Handle idempotency for POST/PUT/PATCH
     if idempotency_key and method.upper() in ["POST", "PUT", "PATCH"]:
         is_new, existing_id, existing_hash = idempotency.register_request(
-            idempotency_key, method, full_url, headers, body_bytes, request_id, tenant=tenant
+            idempotency_key, method, full_url, headers, body_bytes, request_id, tenant=tenant, ttl_s=idempotency_ttl
         )
         
         if not is_new:
@@ -450,6 +3226,7 @@ async def handle_http_proxy(
             existing_result = idempotency.get_result(idempotency_key, tenant=tenant)
             if existing_result:
                 duration_ms = int((time.time() - start_time) * 1000)
+                _record_response_transform(existing_result)
                 _log_and_metric_http_request(
                     request_id=request_id,
                     target_name=target_name,
@@ -462,11 +3239,15 @@ async def handle_http_proxy(
                 )
                 return SuccessResponse(
                     success=True,
-                    data=existing_result,
+                    data=_public_http_data(existing_result),
                     meta=MetaResponse(
+                        cache_key=resolved_cache_key,
                         target=target_name,
+                        response_encoding=_response_encoding(existing_result),
+                        **_upstream_meta(existing_result, response_headers),
                         cache_hit=False,
                         idempotent_hit=True,
+                        **idempotency.record_replay(idempotency_key, tenant=tenant),
                         retries=0,
                         duration_ms=duration_ms,
                         request_id=request_id,
@@ -490,6 +3271,7 @@ async def handle_http_proxy(
                 existing_result = idempotency.get_result(idempotency_key, tenant=tenant)
                 if existing_result:
                     duration_ms = int((time.time() - start_time) * 1000)
+                    _record_response_transform(existing_result)
                     _log_and_metric_http_request(
                         request_id=request_id,
                         target_name=target_name,
@@ -502,11 +3284,15 @@ async def handle_http_proxy(
                     )
                     return SuccessResponse(
                         success=True,
-                        data=existing_result,
+                        data=_public_http_data(existing_result),
                         meta=MetaResponse(
+                            cache_key=resolved_cache_key,
                             target=target_name,
+                            response_encoding=_response_encoding(existing_result),
+                            **_upstream_meta(existing_result, response_headers),
                             cache_hit=False,
                             idempotent_hit=True,
+                            **idempotency.record_replay(idempotency_key, tenant=tenant),
                             retries=0,
                             duration_ms=duration_ms,
                             request_id=request_id,
@@ -518,77 +3304,117 @@ async def handle_http_proxy(
     
     # Create HTTP client (with key pool support)
     client, selected_key, auth_source = create_http_client(
-        target_config, target_name, key_pool_manager=key_pool_manager
+        target_config, target_name, key_pool_manager=key_pool_manager, request_timeout_ms=timeout_ms
     )
     
     # Check rate limits before request
-    if rate_scheduler and selected_key:
-        # Get rate limit config from key pool
-        provider_key_qps = None
-        if selected_key.qps_limit:
-            provider_key_qps = float(selected_key.qps_limit)
-        
-        allowed, retry_after_s, limiting_bucket = await rate_scheduler.check_rate_limit(
-            provider_key_id=selected_key.id,
-            tenant=tenant,
-            provider_key_qps=provider_key_qps,
+    rate_limited = await _check_key_rate_limit(
+        rate_scheduler, selected_key, tenant, target_name, request_id, start_time
+    )
+    if rate_limited:
+        return rate_limited
+    
+    try:
+        # Make request
+        response = await client.request(
+            method=method,
+            path=path,
+            headers=upstream_request_headers,
+            body=body_bytes,
+            params=query,
+            retry_policy=retry_policy,
+            retry_stats=retry_stats,
+            max_redirects=redirect_limit,
+            stream=response_limit is not None,
         )
-        
-        if not allowed:
-            rate_scheduler_429_total.labels(source="reliapi").inc()
-            duration_ms = int((time.time() - start_time) * 1000)
-            provider_key_status = selected_key.status if selected_key else None
-            return ErrorResponse(
-                success=False,
-                error=ErrorDetail(
-                    type="rate_limit",
-                    code=ErrorCode.RATE_LIMIT_RELIAPI.value,
-                    message=f"Rate limit exceeded ({limiting_bucket})",
-                    retryable=True,
-                    source="reliapi",
-                    retry_after_s=retry_after_s,
-                    target=target_name,
-                    status_code=429,
-                    provider_key_status=provider_key_status,
-                    hint="Upstream provider is being protected",
-                ),
-                meta=MetaResponse(
-                    target=target_name,
-                    cache_hit=False,
-                    idempotent_hit=False,
-                    retries=0,
-                    duration_ms=duration_ms,
+        response_body, truncated = await _read_http_body(response, response_limit, truncate_response)
+        if response_body is None:
+            if idempotency_key:
+                idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+            _log_and_metric_http_request(
+                request_id=request_id,
+                target_name=target_name,
+                path=path,
+                outcome="error",
+                latency_ms=int((time.time() - start_time) * 1000),
+                cache_hit=False,
+                idempotent_hit=False,
+                error_code=ErrorCode.RESPONSE_TOO_LARGE.value,
+                upstream_status=response.status_code,
+                tenant=tenant,
+            )
+            return _response_too_large(response, target_name, response_limit, retry_stats, request_id, start_time)
+
+        if response.status_code == 304 and conditional_headers:
+            revalidated = stale_data is not None and _revalidates(response.headers.get("etag"), stale_data)
+            if revalidated or if_none_match:
+                cache_config = target_config.get("cache", {})
+                cache_stored = None
+                if revalidated:
+                    # The cached body is still current: keep it for another TTL
+                    cache_stored = cache.set(
+                        method, full_url, headers, body_bytes,
+                        stale_data,
+                        ttl_s=cache_ttl or cache_config.get("ttl_s", 3600),
+                        query=query,
+                        tenant=tenant,
+                        key_override=cache_override,
+                        target=target_name,
+                        stale_ttl_s=_http_stale_ttl(stale_data, cache_config, stale_ttl_s),
+                        max_entries=cache_config.get("max_entries"),
+                    )
+                    data = _http_cached_data(stale_data)
+                    _record_response_transform(stale_data)
+                    upstream_fields = {
+                        "response_encoding": _response_encoding(data),
+                        **_upstream_meta(stale_data, response_headers),
+                    }
+                    if if_none_match and _etag_matches(if_none_match, _header(data["headers"], "etag")):
+                        data, upstream_fields = {}, _not_modified_meta(stale_data, response_headers)
+                else:
+                    # The upstream matched the caller's own condition
+                    not_modified_data = {"status_code": 304, "upstream_headers": _upstream_header_lists(response.headers)}
+                    data, upstream_fields = {}, _not_modified_meta(not_modified_data, response_headers)
+                if selected_key and key_pool_manager:
+                    key_pool_manager.record_success(selected_key.id)
+                duration_ms = int((time.time() - start_time) * 1000)
+                _log_and_metric_http_request(
                     request_id=request_id,
-                    trace_id=None,
-                ),
-            )
-    
-    try:
-        # Make request
-        response = await client.request(
-            method=method,
-            path=path,
-            headers=headers,
-            body=body_bytes,
-            params=query,
-        )
-        
-        # Read response
-        response_body = await response.aread()
+                    target_name=target_name,
+                    path=path,
+                    outcome="success",
+                    latency_ms=duration_ms,
+                    cache_hit=revalidated,
+                    idempotent_hit=False,
+                    tenant=tenant,
+                )
+                return SuccessResponse(
+                    success=True,
+                    data=data,
+                    meta=MetaResponse(
+                        cache_key=resolved_cache_key,
+                        target=target_name,
+                        **upstream_fields,
+                        cache_hit=revalidated,
+                        cache_stored=cache_stored,
+                        revalidated=revalidated,
+                        idempotent_hit=False,
+                        **_retry_meta(retry_stats),
+                        duration_ms=duration_ms,
+                        request_id=request_id,
+                        trace_id=None,
+                    ),
+                )
+
         response_status = response.status_code
-        response_headers = dict(response.headers)
-        
-        # Parse body
-        try:
-            body_json = json.loads(response_body.decode()) if response_body else {}
-        except:
-            body_json = {"raw": response_body.decode() if response_body else ""}
-        
-        result_data = {
-            "status_code": response_status,
-            "headers": response_headers,
-            "body": body_json,
-        }
+        result_data = _http_response_data(response_status, dict(response.headers), response_body, raw=raw_passthrough)
+        _transform_response(transformation, result_data)
+        result_data["upstream_headers"] = _upstream_header_lists(response.headers)
+        if response.history:
+            result_data["redirect_chain"] = _redirect_chain(response)
+        if truncated:
+            result_data["truncated"] = True
+            result_data["original_content_length"] = _content_length(response)
         
         # Update key pool health on success
         if selected_key and key_pool_manager:
@@ -602,26 +3428,26 @@ async def handle_http_proxy(
             status_value = {"active": 0, "degraded": 1, "exhausted": 2, "banned": 3}.get(selected_key.status, 0)
             key_pool_status.labels(provider_key_id=selected_key.id, status=selected_key.status).observe(status_value)
         
-        # Store in cache
-        if method.upper() in ["GET", "HEAD"] and response_status < 400:
+        # Store in cache (a truncated body is not the upstream's response)
+        cache_stored = None
+        if cacheable and response_status < 400 and not truncated:
             cache_config = target_config.get("cache", {})
             if cache_config.get("enabled", True):
                 ttl = cache_ttl or cache_config.get("ttl_s", 3600)
-                cache.set(
+                cache_stored = cache.set(
                     method, full_url, headers, body_bytes,
-                    {
-                        "status_code": response_status,
-                        "headers": response_headers,
-                        "body": body_json,
-                    },
+                    _filtered_cache_entry(result_data, cached_filter, "http"),
                     ttl_s=ttl,
                     query=query,
                     tenant=tenant,
+                    key_override=cache_override,
+                    target=target_name,
+                    stale_ttl_s=_http_stale_ttl(result_data, cache_config, stale_ttl_s),
+                    max_entries=cache_config.get("max_entries"),
                 )
         
-        # Store idempotency result (use same TTL as cache for consistency)
+        # Store idempotency result for as long as the key is registered
         if idempotency_key:
-            idempotency_ttl = cache_ttl or cache_config.get("ttl_s", 3600) if cache_config.get("enabled", True) else 3600
             idempotency.store_result(idempotency_key, result_data, ttl_s=idempotency_ttl, tenant=tenant)
             idempotency.clear_in_progress(idempotency_key, tenant=tenant)
         
@@ -641,12 +3467,16 @@ async def handle_http_proxy(
         latency_ms.labels(target=target_name, status="success").observe(duration_ms)
         return SuccessResponse(
             success=True,
-            data=result_data,
+            data=_public_http_data(result_data),
             meta=MetaResponse(
+                cache_key=resolved_cache_key,
                 target=target_name,
+                response_encoding=_response_encoding(result_data),
+                **_upstream_meta(result_data, response_headers),
                 cache_hit=False,
+                cache_stored=cache_stored,
                 idempotent_hit=False,
-                retries=retries,
+                **_retry_meta(retry_stats),
                 duration_ms=duration_ms,
                 request_id=request_id,
                 trace_id=None,
@@ -679,7 +3509,7 @@ async def handle_http_proxy(
             key_switch_state.provider = selected_key.provider
             key_switch_state.used_keys.add(selected_key.id)
             
-            if retryable and key_pool_manager.has_pool(selected_key.provider) and key_switch_state.can_switch():
+            if retryable and _may_switch_key(key_pool_manager, key_switch_state, selected_key, retry_policy):
                     # Select new key, excluding recently used keys
                     new_key = key_pool_manager.select_key(
                         selected_key.provider, 
@@ -699,6 +3529,8 @@ async def handle_http_proxy(
                         }
                         # Update client auth
                         client.auth = new_auth
+                        if client.pacer is not None:
+                            client.pacer.credential = new_key.id
                         selected_key = new_key
                         
                         # Retry request (this is a simple retry, not full retry logic)
@@ -706,26 +3538,33 @@ async def handle_http_proxy(
                             response = await client.request(
                                 method=method,
                                 path=path,
-                                headers=headers,
+                                headers=upstream_request_headers,
                                 body=body_bytes,
                                 params=query,
+                                max_redirects=redirect_limit,
+                                stream=response_limit is not None,
                             )
                             # If successful, continue with normal flow
-                            response_body = await response.aread()
+                            response_body, truncated = await _read_http_body(
+                                response, response_limit, truncate_response
+                            )
+                            if response_body is None:
+                                if idempotency_key:
+                                    idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+                                return _response_too_large(
+                                    response, target_name, response_limit, retry_stats, request_id, start_time
+                                )
                             response_status = response.status_code
-                            response_headers = dict(response.headers)
-                            
-                            # Parse body
-                            try:
-                                body_json = json.loads(response_body.decode()) if response_body else {}
-                            except:
-                                body_json = {"raw": response_body.decode() if response_body else ""}
-                            
-                            result_data = {
-                                "status_code": response_status,
-                                "headers": response_headers,
-                                "body": body_json,
-                            }
+                            result_data = _http_response_data(
+                                response_status, dict(response.headers), response_body, raw=raw_passthrough
+                            )
+                            _transform_response(transformation, result_data)
+                            result_data["upstream_headers"] = _upstream_header_lists(response.headers)
+                            if response.history:
+                                result_data["redirect_chain"] = _redirect_chain(response)
+                            if truncated:
+                                result_data["truncated"] = True
+                                result_data["original_content_length"] = _content_length(response)
                             
                             # Update key pool health on success
                             if selected_key and key_pool_manager:
@@ -737,25 +3576,25 @@ async def handle_http_proxy(
                                 ).inc()
                             
                             # Store in cache
-                            if method.upper() in ["GET", "HEAD"] and response_status < 400:
+                            cache_stored = None
+                            if cacheable and response_status < 400 and not truncated:
                                 cache_config = target_config.get("cache", {})
                                 if cache_config.get("enabled", True):
                                     ttl = cache_ttl or cache_config.get("ttl_s", 3600)
-                                    cache.set(
+                                    cache_stored = cache.set(
                                         method, full_url, headers, body_bytes,
-                                        {
-                                            "status_code": response_status,
-                                            "headers": response_headers,
-                                            "body": body_json,
-                                        },
+                                        _filtered_cache_entry(result_data, cached_filter, "http"),
                                         ttl_s=ttl,
                                         query=query,
                                         tenant=tenant,
+                                        key_override=cache_override,
+                                        target=target_name,
+                                        stale_ttl_s=_http_stale_ttl(result_data, cache_config, stale_ttl_s),
+                                        max_entries=cache_config.get("max_entries"),
                                     )
                             
                             # Store idempotency result
                             if idempotency_key:
-                                idempotency_ttl = cache_ttl or cache_config.get("ttl_s", 3600) if cache_config.get("enabled", True) else 3600
                                 idempotency.store_result(idempotency_key, result_data, ttl_s=idempotency_ttl, tenant=tenant)
                                 idempotency.clear_in_progress(idempotency_key, tenant=tenant)
                             
@@ -775,12 +3614,16 @@ async def handle_http_proxy(
                             
                             return SuccessResponse(
                                 success=True,
-                                data=result_data,
+                                data=_public_http_data(result_data),
                                 meta=MetaResponse(
+                                    cache_key=resolved_cache_key,
                                     target=target_name,
+                                    response_encoding=_response_encoding(result_data),
+                                    **_upstream_meta(result_data, response_headers),
                                     cache_hit=False,
+                                    cache_stored=cache_stored,
                                     idempotent_hit=False,
-                                    retries=retries,
+                                    **_retry_meta(retry_stats),
                                     duration_ms=duration_ms,
                                     request_id=request_id,
                                     trace_id=None,
@@ -818,45 +3661,413 @@ async def handle_http_proxy(
         return ErrorResponse(
             success=False,
             error=ErrorDetail(
-                type=error_type,
-                code=error_code.value,
-                message=f"Upstream returned {e.response.status_code}",
-                retryable=retryable,
+                type=error_type,
+                code=error_code.value,
+                message=f"Upstream returned {e.response.status_code}",
+                retryable=retryable,
+                target=target_name,
+                status_code=e.response.status_code,
+            ),
+            meta=MetaResponse(
+                target=target_name,
+                cache_hit=False,
+                idempotent_hit=False,
+                **_retry_meta(retry_stats),
+                duration_ms=duration_ms,
+                request_id=request_id,
+                trace_id=None,
+            ),
+        )
+        
+    except httpx.RequestError as e:
+        # Network/timeout error
+        if idempotency_key:
+            idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+        
+        # Update key pool health on network error
+        if selected_key and key_pool_manager and not isinstance(e, DeadlineTooShortError):
+            key_pool_manager.record_error(selected_key.id, "network", None)
+            key_pool_requests_total.labels(
+                provider_key_id=selected_key.id,
+                provider=selected_key.provider,
+                status="error",
+            ).inc()
+            key_pool_errors_total.labels(
+                provider_key_id=selected_key.id,
+                error_type="network",
+            ).inc()
+        
+        duration_ms = int((time.time() - start_time) * 1000)
+        error = _request_error_detail(e, target_name)
+        upstream_status_norm = UpstreamStatus.normalize(error.status_code)
+        _log_and_metric_http_request(
+            request_id=request_id,
+            target_name=target_name,
+            path=path,
+            outcome="error",
+            latency_ms=duration_ms,
+            cache_hit=False,
+            idempotent_hit=False,
+            error_code=error.code,
+            upstream_status=error.status_code,  # Actual status for logs
+            tenant=tenant,
+        )
+        # Legacy metrics
+        http_requests_total.labels(target=target_name, status="error").inc()
+        errors_total.labels(
+            target=target_name,
+            kind="http",
+            error_code=error.code,
+            upstream_status=upstream_status_norm,
+        ).inc()
+        latency_ms.labels(target=target_name, status="error").observe(duration_ms)
+        return ErrorResponse(
+            success=False,
+            error=error,
+            meta=MetaResponse(
+                target=target_name,
+                cache_hit=False,
+                **_retry_meta(retry_stats),
+                duration_ms=duration_ms,
+                request_id=request_id,
+                trace_id=None,
+            ),
+        )
+        
+    except CircuitOpenError:
+        # Upstream circuit is open - fail fast without calling it
+        if idempotency_key:
+            idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+        
+        duration_ms = int((time.time() - start_time) * 1000)
+        error_code = ErrorCode.CIRCUIT_OPEN
+        upstream_status_norm = UpstreamStatus.SERVICE_UNAVAILABLE.value
+        _log_and_metric_http_request(
+            request_id=request_id,
+            target_name=target_name,
+            path=path,
+            outcome="error",
+            latency_ms=duration_ms,
+            cache_hit=False,
+            idempotent_hit=False,
+            error_code=error_code.value,
+            upstream_status=503,
+            tenant=tenant,
+        )
+        # Legacy metrics
+        http_requests_total.labels(target=target_name, status="error").inc()
+        errors_total.labels(
+            target=target_name,
+            kind="http",
+            error_code=error_code.value,
+            upstream_status=upstream_status_norm,
+        ).inc()
+        latency_ms.labels(target=target_name, status="error").observe(duration_ms)
+        return ErrorResponse(
+            success=False,
+            error=ErrorDetail(
+                type="upstream_error",
+                code=error_code.value,
+                message=f"Circuit breaker open for target '{target_name}'",
+                retryable=True,
+                target=target_name,
+                status_code=503,
+            ),
+            meta=MetaResponse(
+                target=target_name,
+                circuit_state="open",
+                cache_hit=False,
+                **_retry_meta(retry_stats),
+                duration_ms=duration_ms,
+                request_id=request_id,
+                trace_id=None,
+            ),
+        )
+        
+    except Exception as e:
+        # Other errors
+        if idempotency_key:
+            idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+        
+        duration_ms = int((time.time() - start_time) * 1000)
+        error_code = ErrorCode.INTERNAL_ERROR
+        upstream_status_norm = UpstreamStatus.INTERNAL_SERVER_ERROR.value
+        _log_and_metric_http_request(
+            request_id=request_id,
+            target_name=target_name,
+            path=path,
+            outcome="error",
+            latency_ms=duration_ms,
+            cache_hit=False,
+            idempotent_hit=False,
+            error_code=error_code.value,
+            upstream_status=500,  # Actual status for logs
+            tenant=tenant,
+        )
+        # Legacy metrics
+        http_requests_total.labels(target=target_name, status="error").inc()
+        errors_total.labels(
+            target=target_name,
+            kind="http",
+            error_code=error_code.value,
+            upstream_status=upstream_status_norm,
+        ).inc()
+        latency_ms.labels(target=target_name, status="error").observe(duration_ms)
+        return ErrorResponse(
+            success=False,
+            error=ErrorDetail(
+                type="internal_error",
+                code=error_code.value,
+                message=f"Internal error: {str(e)}",
+                retryable=True,
+                target=target_name,
+                status_code=500,
+            ),
+            meta=MetaResponse(
+                target=target_name,
+                cache_hit=False,
+                **_retry_meta(retry_stats),
+                duration_ms=duration_ms,
+                request_id=request_id,
+                trace_id=None,
+            ),
+        )
+        
+    finally:
+        await client.close()
+
+
+# Response headers that describe a body encoding aiter_bytes() has already
+# undone; never relayed by streamed /proxy/http, like hop-by-hop headers.
+_UNRELAYED_HEADERS = _HOP_BY_HOP_HEADERS | {"content-length", "content-encoding"}
+
+
+@dataclass
+class HTTPStreamResult:
+    """An upstream response that /proxy/http relays as it arrives.
+
+    chunks yields the (decoded) upstream body and must be consumed or closed;
+    it releases the upstream connection when done. meta describes the request
+    up to the upstream's headers.
+    """
+    status_code: int
+    headers: Dict[str, str]
+    chunks: AsyncIterator[bytes]
+    meta: MetaResponse
+
+
+def _relayed_headers(headers: httpx.Headers) -> Dict[str, str]:
+    # Upstream headers must not pass for the proxy's own X-ReliAPI-* metadata.
+    return {
+        k: v for k, v in headers.items()
+        if k.lower() not in _UNRELAYED_HEADERS and not k.lower().startswith("x-reliapi-")
+    }
+
+
+async def handle_http_proxy_stream(
+    target_name: str,
+    method: str,
+    path: str,
+    headers: Optional[Dict[str, str]],
+    query: Optional[Dict[str, Any]],
+    body: Optional[str],
+    cache_ttl: Optional[int],
+    targets: Dict[str, Dict],
+    cache: Cache,
+    request_id: str,
+    tenant: Optional[str] = None,
+    key_pool_manager: Optional[KeyPoolManager] = None,
+    rate_scheduler: Optional[RateScheduler] = None,
+    cache_key: Optional[str] = None,
+    cache_vary: Optional[List[str]] = None,
+    retry: Optional[Dict[str, Any]] = None,
+    body_encoding: str = "utf8",
+    follow_redirects: Optional[bool] = None,
+    max_redirects: Optional[int] = None,
+    timeout_ms: Optional[int] = None,
+    key_id: Optional[str] = None,
+) -> Union[HTTPStreamResult, ErrorResponse]:
+    """Handle a /proxy/http request with stream_response.
+
+    Like handle_http_proxy, but the upstream body is relayed chunk by chunk
+    instead of being buffered into data, so its size is not bounded by
+    memory. Retries and the circuit breaker cover the request up to the
+    upstream's headers; idempotency keys are not supported (the schema
+    rejects them). GET/HEAD responses are cached, under keys separate from
+    buffered requests, only if the whole body fits in the target's
+    cache.stream_max_bytes (0, the default, disables it). Redirects follow
+    the same policy as handle_http_proxy, and timeout_ms bounds the wait for
+    the upstream's headers. The target's request transformations apply as
+    for handle_http_proxy; response_extract does not, the body being relayed
+    as it comes.
+    """
+    start_time = time.time()
+    retry_policy = RequestRetryPolicy.from_dict(retry)
+    retry_stats = RetryStats()
+
+    target_config = targets.get(target_name)
+    if not target_config:
+        return ErrorResponse(
+            success=False,
+            error=ErrorDetail(
+                type="client_error",
+                code=ErrorCode.NOT_FOUND.value,
+                message=f"Target '{target_name}' not found",
+                retryable=False,
+                target=None,
+                status_code=404,
+            ),
+            meta=MetaResponse(target=None, duration_ms=0, request_id=request_id),
+        )
+
+    rule_violation = _target_rule_violation(target_config, method, path)
+    if rule_violation:
+        return ErrorResponse(
+            success=False,
+            error=ErrorDetail(
+                type="client_error",
+                code=ErrorCode.NOT_ALLOWED.value,
+                message=rule_violation,
+                retryable=False,
                 target=target_name,
-                status_code=e.response.status_code,
+                status_code=403,
             ),
             meta=MetaResponse(
                 target=target_name,
-                cache_hit=False,
-                idempotent_hit=False,
-                retries=retries,
-                duration_ms=duration_ms,
+                duration_ms=int((time.time() - start_time) * 1000),
                 request_id=request_id,
-                trace_id=None,
             ),
         )
-        
+    timeout_rejection = _timeout_rejection(target_config, target_name, timeout_ms, request_id, start_time)
+    if timeout_rejection:
+        return timeout_rejection
+
+    transformed = transform_request(
+        target_config.get("transformation"), method, path, headers, body, body_encoding,
+        {"request_id": request_id, "key_id": key_id, "tenant": tenant, "target": target_name},
+    )
+    record_applied(transformed.applied)
+    path, headers, body = transformed.path, transformed.key_headers, transformed.body
+
+    base_url = target_config["base_url"].rstrip("/")
+    full_url = f"{base_url}{path}"
+    body_bytes = _request_body_bytes(body, body_encoding)
+    redirect_limit = _redirect_limit(target_config, follow_redirects, max_redirects)
+
+    # Cached streamed bodies are kept apart from buffered /proxy/http results,
+    # which hold parsed JSON rather than the upstream's bytes.
+    cache_config = target_config.get("cache", {})
+    max_cached = cache_config.get("stream_max_bytes", 0) if cache_config.get("enabled", True) else 0
+    stream_key_override = None
+    resolved_cache_key = None
+    if (
+        max_cached > 0
+        and method.upper() in ["GET", "HEAD"]
+        and redirect_limit == _redirect_limit(target_config)
+    ):
+        cache_override = _cache_key_override(
+            scope={"target": target_name, "method": method.upper()},
+            fields={"path": path, "query": query, "headers": headers, "body": body},
+            cache_key=cache_key,
+            cache_vary=cache_vary,
+        )
+        stream_key_override = {
+            "stream_response": True,
+            "key": make_cache_key_hash(method, full_url, headers, body_bytes, query, cache_override),
+        }
+        resolved_cache_key = make_cache_key_hash(
+            method, full_url, headers, body_bytes, query, stream_key_override
+        )
+        cached = cache.get(
+            method, full_url, headers, body_bytes, query, tenant=tenant, key_override=stream_key_override
+        )
+        if cached:
+            duration_ms = int((time.time() - start_time) * 1000)
+            _log_and_metric_http_request(
+                request_id=request_id,
+                target_name=target_name,
+                path=path,
+                outcome="success",
+                latency_ms=duration_ms,
+                cache_hit=True,
+                idempotent_hit=False,
+                tenant=tenant,
+                stream=True,
+            )
+            content = base64.b64decode(cached["body"]) if cached.get("body") else b""
+
+            async def cached_chunks() -> AsyncIterator[bytes]:
+                yield content
+
+            return HTTPStreamResult(
+                status_code=cached.get("status_code", 200),
+                headers=cached.get("headers", {}),
+                chunks=cached_chunks(),
+                meta=MetaResponse(
+                    cache_key=resolved_cache_key,
+                    target=target_name,
+                    cache_hit=True,
+                    duration_ms=duration_ms,
+                    request_id=request_id,
+                ),
+            )
+
+    client, selected_key, auth_source = create_http_client(
+        target_config, target_name, key_pool_manager=key_pool_manager, request_timeout_ms=timeout_ms
+    )
+    rate_limited = await _check_key_rate_limit(
+        rate_scheduler, selected_key, tenant, target_name, request_id, start_time
+    )
+    if rate_limited:
+        await client.close()
+        return rate_limited
+
+    error: Optional[ErrorDetail] = None
+    circuit_state = None
+    # Key pool health: (error type, status) of a failure the key is blamed for
+    key_error: Optional[Tuple[str, Optional[int]]] = None
+    try:
+        response = await client.request(
+            method=method,
+            path=path,
+            headers=transformed.headers,
+            body=body_bytes,
+            params=query,
+            retry_policy=retry_policy,
+            retry_stats=retry_stats,
+            stream=True,
+            max_redirects=redirect_limit,
+        )
+    except httpx.HTTPStatusError as e:
+        status = e.response.status_code
+        key_error = ("429" if status == 429 else "5xx", status)
+        error = ErrorDetail(
+            type="upstream_error",
+            code=ErrorCode.from_http_status(status).value,
+            message=f"Upstream returned {status}",
+            retryable=status >= 500 or status == 429,
+            target=target_name,
+            status_code=status,
+        )
+    except CircuitOpenError:
+        circuit_state = "open"
+        error = ErrorDetail(
+            type="upstream_error",
+            code=ErrorCode.CIRCUIT_OPEN.value,
+            message=f"Circuit breaker open for target '{target_name}'",
+            retryable=True,
+            target=target_name,
+            status_code=503,
+        )
     except httpx.RequestError as e:
-        # Network/timeout error
-        if idempotency_key:
-            idempotency.clear_in_progress(idempotency_key, tenant=tenant)
-        
-        # Update key pool health on network error
-        if selected_key and key_pool_manager:
-            key_pool_manager.record_error(selected_key.id, "network", None)
-            key_pool_requests_total.labels(
-                provider_key_id=selected_key.id,
-                provider=selected_key.provider,
-                status="error",
-            ).inc()
-            key_pool_errors_total.labels(
-                provider_key_id=selected_key.id,
-                error_type="network",
-            ).inc()
-        
-        duration_ms = int((time.time() - start_time) * 1000)
-        error_code = ErrorCode.NETWORK_ERROR
-        upstream_status_norm = UpstreamStatus.BAD_GATEWAY.value
+        key_error = None if isinstance(e, DeadlineTooShortError) else ("network", None)
+        error = _request_error_detail(e, target_name)
+
+    duration_ms = int((time.time() - start_time) * 1000)
+    if error:
+        await client.close()
+        if selected_key and key_pool_manager and key_error:
+            key_pool_manager.record_error(selected_key.id, *key_error)
         _log_and_metric_http_request(
             request_id=request_id,
             target_name=target_name,
@@ -865,91 +4076,812 @@ async def handle_http_proxy(
             latency_ms=duration_ms,
             cache_hit=False,
             idempotent_hit=False,
-            error_code=error_code.value,
-            upstream_status=502,  # Actual status for logs
+            error_code=error.code,
+            upstream_status=error.status_code,
             tenant=tenant,
+            stream=True,
         )
-        # Legacy metrics
-        http_requests_total.labels(target=target_name, status="error").inc()
-        errors_total.labels(
-            target=target_name,
-            kind="http",
-            error_code=error_code.value,
-            upstream_status=upstream_status_norm,
-        ).inc()
-        latency_ms.labels(target=target_name, status="error").observe(duration_ms)
         return ErrorResponse(
             success=False,
-            error=ErrorDetail(
-                type="upstream_error",
-                code=error_code.value,
-                message=f"Network error: {str(e)}",
-                retryable=True,
-                target=target_name,
-                status_code=502,
-            ),
+            error=error,
             meta=MetaResponse(
                 target=target_name,
-                cache_hit=False,
-                retries=retries,
+                circuit_state=circuit_state,
+                **_retry_meta(retry_stats),
                 duration_ms=duration_ms,
                 request_id=request_id,
-                trace_id=None,
             ),
         )
-        
-    except Exception as e:
-        # Other errors
+
+    if selected_key and key_pool_manager:
+        key_pool_manager.record_success(selected_key.id)
+    _log_and_metric_http_request(
+        request_id=request_id,
+        target_name=target_name,
+        path=path,
+        outcome="success",
+        latency_ms=duration_ms,
+        cache_hit=False,
+        idempotent_hit=False,
+        tenant=tenant,
+        stream=True,
+    )
+    relayed_headers = _relayed_headers(response.headers)
+    cacheable = stream_key_override is not None and response.status_code < 400
+
+    async def relay() -> AsyncIterator[bytes]:
+        # Only bodies that fit in stream_max_bytes are kept for the cache
+        buffered: Optional[List[bytes]] = [] if cacheable else None
+        size = 0
+        try:
+            async for chunk in response.aiter_bytes():
+                if buffered is not None:
+                    size += len(chunk)
+                    if size > max_cached:
+                        buffered = None
+                    else:
+                        buffered.append(chunk)
+                yield chunk
+        finally:
+            await response.aclose()
+            await client.close()
+        if buffered is not None:
+            cache.set(
+                method, full_url, headers, body_bytes,
+                {
+                    "status_code": response.status_code,
+                    "headers": relayed_headers,
+                    "body": base64.b64encode(b"".join(buffered)).decode("ascii"),
+                    "body_encoding": "base64",
+                },
+                ttl_s=cache_ttl or cache_config.get("ttl_s", 3600),
+                query=query,
+                tenant=tenant,
+                key_override=stream_key_override,
+                target=target_name,
+                max_entries=cache_config.get("max_entries"),
+            )
+
+    return HTTPStreamResult(
+        status_code=response.status_code,
+        headers=relayed_headers,
+        chunks=relay(),
+        meta=MetaResponse(
+            cache_key=resolved_cache_key,
+            target=target_name,
+            cache_hit=False,
+            **_retry_meta(retry_stats),
+            duration_ms=duration_ms,
+            request_id=request_id,
+        ),
+    )
+
+
+def _graphql_error(
+    code: ErrorCode, message: str, status_code: int, target_name: str, request_id: str, start_time: float
+) -> ErrorResponse:
+    error_type = "client_error" if status_code < 500 else "upstream_error"
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type=error_type,
+            code=code.value,
+            message=message,
+            retryable=False,
+            source="reliapi" if status_code < 500 else "upstream",
+            target=target_name,
+            status_code=status_code,
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+
+
+async def handle_graphql_proxy(
+    target_name: str,
+    query: str,
+    operation_name: Optional[str],
+    variables: Optional[Dict[str, Any]],
+    path: str,
+    headers: Optional[Dict[str, str]],
+    idempotency_key: Optional[str],
+    cache_ttl: Optional[int],
+    targets: Dict[str, Dict],
+    cache: Cache,
+    idempotency: IdempotencyManager,
+    request_id: str,
+    tenant: Optional[str] = None,
+    key_pool_manager: Optional[KeyPoolManager] = None,
+    rate_scheduler: Optional[RateScheduler] = None,
+    client_profile_name: Optional[str] = None,
+    client_profile_manager: Optional[ClientProfileManager] = None,
+    retry: Optional[Dict[str, Any]] = None,
+) -> Union[SuccessResponse, ErrorResponse]:
+    """Handle a /proxy/graphql request.
+
+    The operation is POSTed to the target's path as {query, operationName,
+    variables} through handle_http_proxy, so it gets the same retries,
+    circuit breaker and idempotency. Queries are cached under a key built
+    from the normalized document and canonical variables (core/graphql.py);
+    mutations never are, and subscriptions are rejected. data is the
+    GraphQL result ({data, errors, extensions}): errors the upstream reports
+    alongside data do not fail the request, but such results are not cached.
+    """
+    start_time = time.time()
+    try:
+        operation, normalized_query = parse_operation(query, operation_name)
+    except GraphQLSyntaxError as e:
+        return _graphql_error(
+            ErrorCode.BAD_REQUEST, f"Invalid GraphQL document: {e}", 400, target_name, request_id, start_time
+        )
+    if operation == "subscription":
+        return _graphql_error(
+            ErrorCode.BAD_REQUEST, "GraphQL subscriptions are not supported", 400, target_name, request_id, start_time
+        )
+
+    target_config = targets.get(target_name) or {}
+    cache_config = target_config.get("cache", {})
+    cacheable = operation == "query" and bool(target_config) and cache_config.get("enabled", True)
+    full_url = f"{target_config.get('base_url', '').rstrip('/')}{path}"
+    cache_override = {
+        "graphql": normalized_query,
+        "operation_name": operation_name,
+        "variables": variables or {},
+    }
+    resolved_cache_key = make_cache_key_hash("POST", full_url, key_override=cache_override) if cacheable else None
+    if cacheable:
+        cached = cache.get(
+            "POST", full_url, None, None, None, allow_post=True, tenant=tenant, key_override=cache_override
+        )
+        if cached:
+            duration_ms = int((time.time() - start_time) * 1000)
+            _log_and_metric_http_request(
+                request_id=request_id,
+                target_name=target_name,
+                path=path,
+                outcome="success",
+                latency_ms=duration_ms,
+                cache_hit=True,
+                idempotent_hit=False,
+                tenant=tenant,
+            )
+            cache_hits_total.labels(target=target_name, kind="graphql", tenant=tenant or "default").inc()
+            return SuccessResponse(
+                success=True,
+                data=cached["result"],
+                meta=MetaResponse(
+                    cache_key=resolved_cache_key,
+                    target=target_name,
+                    upstream_status=cached.get("status_code"),
+                    cache_hit=True,
+                    duration_ms=duration_ms,
+                    request_id=request_id,
+                ),
+            )
+
+    payload: Dict[str, Any] = {"query": query}
+    if operation_name is not None:
+        payload["operationName"] = operation_name
+    if variables is not None:
+        payload["variables"] = variables
+    result = await handle_http_proxy(
+        target_name=target_name,
+        method="POST",
+        path=path,
+        headers={"Content-Type": "application/json", "Accept": "application/json", **(headers or {})},
+        query=None,
+        body=json.dumps(payload),
+        idempotency_key=idempotency_key,
+        cache_ttl=cache_ttl,
+        targets=targets,
+        cache=cache,
+        idempotency=idempotency,
+        request_id=request_id,
+        tenant=tenant,
+        key_pool_manager=key_pool_manager,
+        rate_scheduler=rate_scheduler,
+        client_profile_name=client_profile_name,
+        client_profile_manager=client_profile_manager,
+        retry=retry,
+    )
+    if not result.success:
+        return result
+
+    status_code = result.data.get("status_code")
+    body = result.data.get("body")
+    if not isinstance(body, dict) or not ("data" in body or "errors" in body):
+        return _graphql_error(
+            ErrorCode.PROVIDER_ERROR,
+            f"Upstream returned {status_code} without a GraphQL result",
+            502,
+            target_name,
+            request_id,
+            start_time,
+        )
+    graphql_result = {k: body[k] for k in ("data", "errors", "extensions") if k in body}
+
+    if cacheable and status_code < 400 and not body.get("errors"):
+        result.meta.cache_stored = cache.set(
+            "POST", full_url, None, None,
+            {"status_code": status_code, "result": graphql_result},
+            ttl_s=cache_ttl or cache_config.get("ttl_s", 3600),
+            allow_post=True,
+            tenant=tenant,
+            key_override=cache_override,
+            target=target_name,
+            max_entries=cache_config.get("max_entries"),
+        )
+
+    result.meta.cache_key = resolved_cache_key
+    result.meta.response_encoding = None
+    return SuccessResponse(success=True, data=graphql_result, meta=result.meta)
+
+
+def _embeddings_error(
+    code: ErrorCode,
+    message: str,
+    status_code: int,
+    target_name: str,
+    request_id: str,
+    start_time: float,
+    provider: Optional[str] = None,
+    model: Optional[str] = None,
+    retryable: bool = False,
+) -> ErrorResponse:
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="client_error" if status_code < 500 else "upstream_error",
+            code=code.value,
+            message=message,
+            retryable=retryable,
+            source="reliapi" if status_code < 500 else "upstream",
+            target=target_name,
+            status_code=status_code,
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            provider=provider,
+            model=model,
+            duration_ms=int((time.time() - start_time) * 1000),
+            request_id=request_id,
+        ),
+    )
+
+
+async def handle_embeddings_proxy(
+    target_name: str,
+    inputs: List[str],
+    model: Optional[str],
+    dimensions: Optional[int],
+    idempotency_key: Optional[str],
+    cache_ttl: Optional[int],
+    targets: Dict[str, Dict],
+    cache: Cache,
+    idempotency: IdempotencyManager,
+    request_id: str,
+    tenant: Optional[str] = None,
+    key_pool_manager: Optional[KeyPoolManager] = None,
+    retry: Optional[Dict[str, Any]] = None,
+    input_type: Optional[str] = None,
+) -> Union[SuccessResponse, ErrorResponse]:
+    """Handle a /proxy/embeddings request.
+
+    Each input is cached on its own, keyed by target, model, dimensions,
+    input_type and text, so only the inputs missing from the cache are sent upstream, in
+    one request and once each however often they repeat. data holds a
+    vector per input, in input order, and a cache_hits flag per input;
+    meta.cost_usd is the cost of the upstream request alone, which is also
+    what the tenant's budget is charged.
+    """
+    start_time = time.time()
+    retry_policy = RequestRetryPolicy.from_dict(retry)
+    retry_stats = RetryStats()
+
+    target_config = targets.get(target_name)
+    if not target_config:
+        return _embeddings_error(
+            ErrorCode.NOT_FOUND, f"Target '{target_name}' not found", 404, target_name, request_id, start_time
+        )
+    llm_config = target_config.get("llm") or {}
+    provider = llm_config.get("provider") or detect_provider(target_config.get("base_url", ""))
+    adapter = get_adapter(provider) if provider else None
+    if not llm_config or not adapter or not adapter.supports_embeddings():
+        return _embeddings_error(
+            ErrorCode.INVALID_TARGET,
+            f"Target '{target_name}' is not configured for embeddings",
+            400,
+            target_name,
+            request_id,
+            start_time,
+            provider=provider,
+        )
+    model = model or llm_config.get("embedding_model")
+    if not model:
+        return _embeddings_error(
+            ErrorCode.BAD_REQUEST,
+            f"No model given and target '{target_name}' has no embedding_model",
+            400,
+            target_name,
+            request_id,
+            start_time,
+            provider=provider,
+        )
+    try:
+        adapter.prepare_embeddings_request(inputs[:1], model, dimensions, input_type)
+    except ValueError as e:
+        return _embeddings_error(
+            ErrorCode.BAD_REQUEST, str(e), 400, target_name, request_id, start_time, provider=provider, model=model
+        )
+
+    base_url = target_config["base_url"].rstrip("/")
+    api_path = "/embeddings"
+    if provider == "azure_openai":
+        try:
+            deployment = azure_deployment(llm_config, model)
+        except UnknownDeploymentError as e:
+            return _embeddings_error(
+                ErrorCode.BAD_REQUEST, str(e), 400, target_name, request_id, start_time, provider=provider, model=model
+            )
+        api_path = azure_api_path(llm_config, deployment, "embeddings")
+    full_url = base_url + api_path
+    cache_config = target_config.get("cache", {})
+    cache_enabled = cache_config.get("enabled", True)
+    ttl = cache_ttl or cache_config.get("ttl_s", 3600)
+
+    def item_key(text: str) -> Dict[str, Any]:
+        key = {"target": target_name, "model": model, "dimensions": dimensions, "embedding": text}
+        # Keys of entries cached before input_type existed stay valid
+        if input_type:
+            key["input_type"] = input_type
+        return key
+
+    vectors: Dict[str, List[float]] = {}
+    # Whether every embedding computed was cached; None when none was
+    cache_stored: Optional[bool] = None
+    if cache_enabled:
+        for text in dict.fromkeys(inputs):
+            cached = cache.get(
+                "POST", full_url, None, None, None, allow_post=True, tenant=tenant, key_override=item_key(text)
+            )
+            if cached:
+                vectors[text] = cached["embedding"]
+    cache_hits = [text in vectors for text in inputs]
+    misses = [text for text in dict.fromkeys(inputs) if text not in vectors]
+
+    body_fields: Dict[str, Any] = {"model": model, "input": inputs, "dimensions": dimensions}
+    if input_type:
+        body_fields["input_type"] = input_type
+    request_body = json.dumps(body_fields, sort_keys=True).encode()
+    if idempotency_key and misses:
+        is_new, existing_id, existing_hash = idempotency.register_request(
+            idempotency_key, "POST", full_url, None, request_body, request_id, tenant=tenant
+        )
+        if not is_new:
+            if existing_hash != idempotency.make_request_hash("POST", full_url, None, request_body):
+                return _embeddings_error(
+                    ErrorCode.IDEMPOTENCY_CONFLICT,
+                    f"Idempotency key '{idempotency_key}' used with different request",
+                    409,
+                    target_name,
+                    request_id,
+                    start_time,
+                    provider=provider,
+                    model=model,
+                )
+            existing_result = idempotency.get_result(idempotency_key, tenant=tenant)
+            while not existing_result and idempotency.is_in_progress(idempotency_key, tenant=tenant):
+                if time.time() - start_time > 30:
+                    break
+                await asyncio.sleep(0.1)
+                existing_result = idempotency.get_result(idempotency_key, tenant=tenant)
+            if existing_result:
+                duration_ms = int((time.time() - start_time) * 1000)
+                _log_and_metric_llm_request(
+                    request_id=request_id,
+                    target_name=target_name,
+                    provider=provider,
+                    model=model,
+                    stream=False,
+                    outcome="success",
+                    latency_ms=duration_ms,
+                    cache_hit=False,
+                    idempotent_hit=True,
+                    cost_usd=existing_result.get("cost_usd"),
+                    tenant=tenant,
+                )
+                return SuccessResponse(
+                    success=True,
+                    data=existing_result.get("data", {}),
+                    meta=MetaResponse(
+                        target=target_name,
+                        provider=provider,
+                        model=model,
+                        idempotent_hit=True,
+                        **idempotency.record_replay(idempotency_key, tenant=tenant),
+                        duration_ms=duration_ms,
+                        request_id=request_id,
+                        cost_usd=existing_result.get("cost_usd"),
+                    ),
+                )
+        idempotency.mark_in_progress(idempotency_key, tenant=tenant)
+
+    def failure(code: ErrorCode, message: str, status: int, retryable: bool) -> ErrorResponse:
         if idempotency_key:
             idempotency.clear_in_progress(idempotency_key, tenant=tenant)
-        
-        duration_ms = int((time.time() - start_time) * 1000)
-        error_code = ErrorCode.INTERNAL_ERROR
-        upstream_status_norm = UpstreamStatus.INTERNAL_SERVER_ERROR.value
-        _log_and_metric_http_request(
+        _log_and_metric_llm_request(
             request_id=request_id,
             target_name=target_name,
-            path=path,
+            provider=provider,
+            model=model,
+            stream=False,
             outcome="error",
-            latency_ms=duration_ms,
+            latency_ms=int((time.time() - start_time) * 1000),
             cache_hit=False,
             idempotent_hit=False,
-            error_code=error_code.value,
-            upstream_status=500,  # Actual status for logs
+            error_code=code.value,
+            upstream_status=status,
             tenant=tenant,
         )
-        # Legacy metrics
-        http_requests_total.labels(target=target_name, status="error").inc()
-        errors_total.labels(
-            target=target_name,
-            kind="http",
-            error_code=error_code.value,
-            upstream_status=upstream_status_norm,
-        ).inc()
-        latency_ms.labels(target=target_name, status="error").observe(duration_ms)
-        return ErrorResponse(
-            success=False,
-            error=ErrorDetail(
-                type="internal_error",
-                code=error_code.value,
-                message=f"Internal error: {str(e)}",
-                retryable=True,
-                target=target_name,
-                status_code=500,
-            ),
-            meta=MetaResponse(
-                target=target_name,
-                cache_hit=False,
-                retries=retries,
-                duration_ms=duration_ms,
-                request_id=request_id,
-                trace_id=None,
-            ),
+        error = _embeddings_error(
+            code, message, status, target_name, request_id, start_time,
+            provider=provider, model=model, retryable=retryable,
         )
-        
-    finally:
+        for name, value in _retry_meta(retry_stats).items():
+            setattr(error.meta, name, value)
+        return error
+
+    prompt_tokens = 0
+    cost_usd: Optional[float] = 0.0
+    if misses:
+        client, selected_key, _ = create_http_client(
+            target_config, target_name, key_pool_manager=key_pool_manager, provider=provider, model=model
+        )
+        try:
+            response = await client.request(
+                method="POST",
+                path=api_path,
+                headers={"Content-Type": "application/json"},
+                body=json.dumps(adapter.prepare_embeddings_request(misses, model, dimensions, input_type)).encode(),
+                params=None,
+                retry_policy=retry_policy,
+                retry_stats=retry_stats,
+            )
+            response_body = await response.aread()
+        except CircuitOpenError:
+            await client.close()
+            return failure(ErrorCode.CIRCUIT_OPEN, f"Circuit breaker open for target '{target_name}'", 503, True)
+        except httpx.RequestError as e:
+            await client.close()
+            if selected_key and key_pool_manager:
+                key_pool_manager.record_error(selected_key.id, "network", None)
+            return failure(ErrorCode.NETWORK_ERROR, f"Network error: {str(e)}", 502, True)
         await client.close()
 
+        status = response.status_code
+        if status >= 400:
+            if selected_key and key_pool_manager:
+                error_type_str = "429" if status == 429 else ("5xx" if status >= 500 else "other")
+                key_pool_manager.record_error(selected_key.id, error_type_str, status)
+            return failure(
+                ErrorCode.from_http_status(status), f"Upstream returned {status}", status,
+                status >= 500 or status == 429,
+            )
+        try:
+            parsed = adapter.parse_embeddings_response(json.loads(response_body.decode()))
+            if len(parsed["embeddings"]) != len(misses):
+                raise ValueError(f"got {len(parsed['embeddings'])} embeddings for {len(misses)} inputs")
+        except (ValueError, KeyError, TypeError) as e:
+            return failure(ErrorCode.PROVIDER_ERROR, f"Invalid embeddings response from {provider}: {e}", 502, False)
+        if selected_key and key_pool_manager:
+            key_pool_manager.record_success(selected_key.id)
+
+        prompt_tokens = parsed["prompt_tokens"]
+        cost_usd = adapter.get_embedding_cost_usd(model, prompt_tokens)
+        for text, vector in zip(misses, parsed["embeddings"]):
+            vectors[text] = vector
+            if cache_enabled:
+                stored = cache.set(
+                    "POST", full_url, None, None,
+                    {"embedding": vector},
+                    ttl_s=ttl,
+                    allow_post=True,
+                    tenant=tenant,
+                    key_override=item_key(text),
+                    target=target_name,
+                    max_entries=cache_config.get("max_entries"),
+                )
+                cache_stored = stored and cache_stored is not False
+
+    result_data = {
+        "embeddings": [vectors[text] for text in inputs],
+        "cache_hits": cache_hits,
+        "prompt_tokens": prompt_tokens,
+    }
+    if idempotency_key and misses:
+        idempotency.store_result(
+            idempotency_key,
+            {"data": result_data, "cost_usd": cost_usd},
+            ttl_s=ttl if cache_enabled else 3600,
+            tenant=tenant,
+        )
+        idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+
+    duration_ms = int((time.time() - start_time) * 1000)
+    _log_and_metric_llm_request(
+        request_id=request_id,
+        target_name=target_name,
+        provider=provider,
+        model=model,
+        stream=False,
+        outcome="success",
+        latency_ms=duration_ms,
+        cache_hit=not misses,
+        idempotent_hit=False,
+        cost_usd=cost_usd,
+        tenant=tenant,
+    )
+    return SuccessResponse(
+        success=True,
+        data=result_data,
+        meta=MetaResponse(
+            target=target_name,
+            provider=provider,
+            model=model,
+            cache_hit=not misses,
+            cache_stored=cache_stored,
+            **_retry_meta(retry_stats),
+            duration_ms=duration_ms,
+            request_id=request_id,
+            cost_usd=cost_usd,
+        ),
+    )
+
+
+@dataclass
+class HedgeOutcome:
+    """What the requests of a hedged LLM call did."""
+    # Index of the request whose response was used: 0 is the first
+    winner: int = 0
+    # Backup requests sent
+    hedges: int = 0
+    # Requests canceled while in flight, and requests that answered after
+    # the winner; the latter were billed whatever the provider
+    canceled: int = 0
+    answered_late: int = 0
+
+    def losers_billed(self, bills_canceled: bool) -> int:
+        return self.answered_late + (self.canceled if bills_canceled else 0)
+
+
+async def _hedged_request(
+    client: UpstreamHTTPClient,
+    path: str,
+    body: bytes,
+    hedge: Dict[str, Any],
+    retry_policy: Optional[RequestRetryPolicy],
+    retry_stats: RetryStats,
+) -> Tuple[httpx.Response, HedgeOutcome]:
+    """POST body, sending a backup request each hedge["delay_ms"] without an
+    answer, up to hedge["max_hedges"] of them, and return the first response.
+
+    A request that fails (after its own retries) starts the next backup at
+    once; the error of the last one is raised when all of them fail. The
+    requests still in flight are canceled. retry_stats is set to the
+    winner's.
+    """
+    delay_s = hedge["delay_ms"] / 1000.0
+    max_requests = 1 + hedge.get("max_hedges", 1)
+    tasks: List["asyncio.Task[httpx.Response]"] = []
+    stats: List[RetryStats] = []
+    outcome = HedgeOutcome()
+
+    def launch() -> None:
+        stats.append(RetryStats())
+        tasks.append(asyncio.ensure_future(client.request(
+            method="POST",
+            path=path,
+            headers={"Content-Type": "application/json"},
+            body=body,
+            params=None,
+            retry_policy=retry_policy,
+            retry_stats=stats[-1],
+        )))
+
+    launch()
+    pending = set(tasks)
+    last_error: Optional[BaseException] = None
+    try:
+        while pending:
+            can_hedge = len(tasks) < max_requests
+            done, pending = await asyncio.wait(
+                pending, timeout=delay_s if can_hedge else None, return_when=asyncio.FIRST_COMPLETED
+            )
+            winners = [t for t in tasks if t in done and t.exception() is None]
+            if winners:
+                outcome.winner = tasks.index(winners[0])
+                outcome.answered_late = len(winners) - 1
+                for late in winners[1:]:
+                    await late.result().aclose()
+                retry_stats.attempts = stats[outcome.winner].attempts
+                retry_stats.delays_ms = stats[outcome.winner].delays_ms
+                return winners[0].result(), outcome
+            for failed in done:
+                last_error = failed.exception()
+            if can_hedge:
+                # No answer within the delay, or a request failed
+                launch()
+                pending.add(tasks[-1])
+        raise last_error
+    finally:
+        outcome.hedges = len(tasks) - 1
+        for task in pending:
+            task.cancel()
+            outcome.canceled += 1
+        if pending:
+            await asyncio.gather(*pending, return_exceptions=True)
+
+
+REPAIR_PROMPT = (
+    "Your previous reply does not match the required JSON Schema:\n{errors}\n"
+    "Reply again with only the corrected JSON value: no prose, no code fences."
+)
+
+
+@dataclass
+class OutputValidation:
+    """Outcome of validating an LLM completion against a request's output_schema."""
+    # The last completion, as adapter.parse_response returned it
+    normalized: Dict[str, Any]
+    # Totals over every attempt, repairs included: each was billed
+    prompt_tokens: int
+    completion_tokens: int
+    attempts: int
+    errors: List[Dict[str, str]]
+    # Provider response of the last completion, if it was a repair
+    raw: Optional[Dict[str, Any]] = None
+
+    @property
+    def valid(self) -> bool:
+        return not self.errors
+
+
+async def _validate_llm_output(
+    client: UpstreamHTTPClient,
+    plan: LLMRequestPlan,
+    messages: List[Dict[str, Any]],
+    top_p: Optional[float],
+    stop: Optional[List[str]],
+    response_format: Optional[Dict[str, Any]],
+    output_schema: Dict[str, Any],
+    repair_attempts: int,
+    normalized: Dict[str, Any],
+    prompt_tokens: int,
+    completion_tokens: int,
+    retry_policy: RequestRetryPolicy,
+    retry_stats: RetryStats,
+) -> OutputValidation:
+    """Validate a completion's content against output_schema, re-prompting
+    the model with the violations up to repair_attempts times.
+
+    A repair call that fails or returns an unusable response ends the
+    repairs; the outcome then reports the last completion's violations.
+    """
+    _, errors = validate_json_output(normalized.get("content"), output_schema)
+    outcome = OutputValidation(normalized, prompt_tokens, completion_tokens, 1, errors)
+    conversation = list(messages)
+    for _ in range(repair_attempts):
+        if outcome.valid:
+            break
+        conversation += [
+            {"role": "assistant", "content": outcome.normalized.get("content") or ""},
+            {"role": "user", "content": REPAIR_PROMPT.format(
+                errors="\n".join(f"- {e['path']}: {e['message']}" for e in outcome.errors)
+            )},
+        ]
+        payload = plan.adapter.prepare_request(
+            messages=conversation,
+            model=plan.model,
+            max_tokens=plan.max_tokens,
+            temperature=plan.temperature,
+            top_p=top_p,
+            stop=stop,
+            stream=False,
+            response_format=response_format,
+        )
+        response = await client.request(
+            method="POST",
+            path=plan.api_path,
+            headers={"Content-Type": "application/json"},
+            body=json.dumps(payload).encode(),
+            params=None,
+            retry_policy=retry_policy,
+            retry_stats=retry_stats,
+        )
+        body = await response.aread()
+        if response.status_code >= 400:
+            break
+        try:
+            response_json = json.loads(body.decode()) if body else {}
+            repaired = plan.adapter.parse_response(response_json)
+        except (ValueError, KeyError, TypeError):
+            break
+        usage = plan.adapter.parse_usage(response_json)
+        outcome.prompt_tokens += usage["prompt_tokens"]
+        outcome.completion_tokens += usage["completion_tokens"]
+        outcome.normalized = repaired
+        outcome.raw = response_json
+        outcome.attempts += 1
+        _, outcome.errors = validate_json_output(repaired.get("content"), output_schema)
+    return outcome
+
+
+def _output_validation_error(
+    validation: OutputValidation,
+    content: str,
+    cost_usd: Optional[float],
+    target_name: str,
+    provider: Optional[str],
+    model: str,
+    served_model: str,
+    request_id: str,
+    tenant: Optional[str],
+    start_time: float,
+    retry_stats: RetryStats,
+) -> ErrorResponse:
+    """Log and build the OUTPUT_VALIDATION_FAILED error for invalid output.
+
+    The attempts were billed, so their cost is recorded and returned.
+    """
+    duration_ms = int((time.time() - start_time) * 1000)
+    error_code = ErrorCode.OUTPUT_VALIDATION_FAILED
+    _log_and_metric_llm_request(
+        request_id=request_id,
+        target_name=target_name,
+        provider=provider,
+        model=served_model,
+        stream=False,
+        outcome="error",
+        latency_ms=duration_ms,
+        cache_hit=False,
+        idempotent_hit=False,
+        cost_usd=cost_usd,
+        error_code=error_code.value,
+        upstream_status=200,
+        tenant=tenant,
+    )
+    llm_requests_total.labels(target=target_name, provider=provider, status="error").inc()
+    latency_ms.labels(target=target_name, status="error").observe(duration_ms)
+    attempts = validation.attempts
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="output_validation_error",
+            code=error_code.value,
+            message=f"Completion does not match output_schema after {attempts} attempt{'s' if attempts != 1 else ''}",
+            retryable=False,
+            target=target_name,
+            status_code=422,
+            details={"errors": validation.errors, "attempts": attempts, "content": content},
+        ),
+        meta=MetaResponse(
+            target=target_name,
+            provider=provider,
+            model=model,
+            cache_hit=False,
+            **_retry_meta(retry_stats),
+            duration_ms=duration_ms,
+            request_id=request_id,
+            trace_id=None,
+            cost_usd=cost_usd,
+            validation_attempts=attempts,
+            output_valid=False,
+        ),
+    )
+
 
 async def handle_llm_proxy(
     target_name: str,
@@ -972,10 +4904,95 @@ async def handle_llm_proxy(
     rate_scheduler: Optional[RateScheduler] = None,
     client_profile_name: Optional[str] = None,
     client_profile_manager: Optional[ClientProfileManager] = None,
+    requested_target: Optional[str] = None,
+    cache_key: Optional[str] = None,
+    cache_vary: Optional[List[str]] = None,
+    stale_ttl_s: int = 0,
+    retry: Optional[Dict[str, Any]] = None,
+    max_cost_usd: Optional[float] = None,
+    budget_cap_usd: Optional[float] = None,
+    key_limits: Optional[KeyLimits] = None,
+    tools: Optional[List[Dict[str, Any]]] = None,
+    tool_choice: Optional[Any] = None,
+    response_format: Optional[Dict[str, Any]] = None,
+    response_format_fallback: str = "error",
+    output_schema: Optional[Dict[str, Any]] = None,
+    repair_attempts: int = 0,
+    timeout_ms: Optional[int] = None,
+    hedge: Optional[Dict[str, Any]] = None,
+    cache_semantic: Optional[Dict[str, Any]] = None,
+    context_policy: Optional[Dict[str, Any]] = None,
+    idempotency_ttl_s: Optional[int] = None,
+    dry_run: bool = False,
+    include_raw: bool = False,
+    priority: str = "default",
+    queue_timeout_ms: Optional[int] = None,
+    max_wait_ms: Optional[int] = None,
+    cached_filter: Optional[str] = None,
+    raw_passthrough: bool = False,
+    strict: bool = True,
+    logprobs: Optional[bool] = None,
+    top_logprobs: Optional[int] = None,
 ) -> Union[SuccessResponse, ErrorResponse]:
-    """Handle LLM proxy request."""
+    """Handle LLM proxy request.
+
+    requested_target is the target the client originally asked for when this
+    call serves a fallback; it is mixed into the cache key so fallback
+    responses are never returned for a direct request to either target.
+    stale_ttl_s keeps cache writes readable by stale cache modes (see
+    handle_with_cache_mode) for that long past their TTL. retry is the
+    request's retry policy, as for handle_http_proxy. Requests whose cost
+    estimate exceeds max_cost_usd, or the rest of the tenant's monthly
+    budget_cap_usd, are rejected with BUDGET_EXCEEDED, and those exceeding
+    the rest of the API key's budget (key_limits) with KEY_BUDGET_EXCEEDED.
+    tools, tool_choice and response_format are in OpenAI's format; function
+    calls the model makes are returned in data.tool_calls. A json_schema
+    response_format for a model without structured outputs is asked for in
+    JSON mode when response_format_fallback is "json_mode", and fails with
+    UNSUPPORTED_PARAMETER otherwise (see _structured_output). With an
+    output_schema the completion content must be JSON matching it: the
+    model is re-prompted with the violations up to repair_attempts times,
+    and output that is still invalid fails with OUTPUT_VALIDATION_FAILED
+    and is never cached.
+    timeout_ms bounds each upstream call, retries included, as for
+    handle_http_proxy. With a hedge policy (schemas.HedgePolicy) backup
+    requests race the first one (see _hedged_request); that is only allowed
+    when an idempotency key or the cache makes the answer reusable, and
+    losing requests the provider bills anyway are added to cost_usd and
+    broken out in meta.hedge_cost_usd. With cache_semantic
+    (schemas.SemanticCacheConfig) an exact cache miss embeds the final user
+    message and serves the most similar recent entry of the same scope
+    (see _semantic_scope) above the threshold, flagged by
+    meta.semantic_cache_hit; the response of a miss is indexed for later
+    lookups. A context_policy (schemas.ContextPolicy) fits the messages to
+    its token budget before anything else (see core.context.trim_messages),
+    so the cache key and cost estimate are those of the trimmed prompt; a
+    prompt that can't fit fails with CONTEXT_LENGTH_EXCEEDED. A dry_run
+    returns after the budget checks with the cache key and cost estimate
+    (see _dry_run_response). Over the rate budget of a target with a queue
+    config, requests that miss the cache wait their turn by priority (see
+    core.priority_queue), up to queue_timeout_ms or the target's
+    queue.timeout_ms, and report the wait in meta.queue_wait_ms; a full
+    queue or a wait running out fails with QUEUE_FULL. Under a target's
+    max_concurrency the upstream call also waits for a free slot (see
+    core.concurrency), up to max_wait_ms or the target's
+    concurrency_wait_ms, reported in meta.concurrency_wait_ms; a wait
+    running out fails with CONCURRENCY_LIMIT. Requests are translated to
+    the provider's format by its adapter, and ones it can't express fail
+    with BAD_REQUEST naming the field (see _translation_error); with
+    include_raw the provider's response is also returned as it was, in
+    meta.raw_provider_response. With a cached_filter responses are cached
+    filtered by it, as for handle_http_proxy. With raw_passthrough the
+    provider's response body is also kept, unparsed, in data.raw_body, in
+    the cache and idempotency store too (see raw_response_body). A request
+    outside what its model accepts fails with MODEL_LIMITS_EXCEEDED, or
+    unless strict, is fitted to the model as meta.adjustments reports (see
+    _plan_llm_request). With logprobs the tokens' log probabilities, and
+    top_logprobs alternatives for each, are returned in data.logprobs.
+    """
     start_time = time.time()
-    retries = 0
+    retry_policy = RequestRetryPolicy.from_dict(retry)
+    retry_stats = RetryStats()
     # Use KeySwitchState for proper tracking across request lifecycle
     key_switch_state = KeySwitchState()
     
@@ -1034,37 +5051,87 @@ async def handle_llm_proxy(
                 trace_id=None,
             ),
         )
+    timeout_rejection = _timeout_rejection(target_config, target_name, timeout_ms, request_id, start_time)
+    if timeout_rejection:
+        return timeout_rejection
+    ttl_rejection = _idempotency_ttl_rejection(target_config, target_name, idempotency_ttl_s, request_id, start_time)
+    if ttl_rejection:
+        return ttl_rejection
+    idempotency_ttl = _idempotency_ttl(target_config, idempotency_ttl_s, cache_ttl)
+    if hedge and not idempotency_key and not target_config.get("cache", {}).get("enabled", True):
+        return ErrorResponse(
+            success=False,
+            error=ErrorDetail(
+                type="client_error",
+                code=ErrorCode.BAD_REQUEST.value,
+                message="hedge requires an idempotency_key or a target with caching enabled",
+                retryable=False,
+                target=target_name,
+                status_code=400,
+            ),
+            meta=MetaResponse(
+                target=target_name,
+                cache_hit=False,
+                retries=0,
+                duration_ms=int((time.time() - start_time) * 1000),
+                request_id=request_id,
+                trace_id=None,
+            ),
+        )
+    # Fit the history to the prompt budget before it is priced or keyed
+    requested_model = model or llm_config.get("default_model", "gpt-4")
+    try:
+        messages, trim_fields = _trim_context(messages, requested_model, context_policy)
+    except ContextTooLongError as e:
+        return _context_rejection(e, target_name, requested_model, request_id, start_time)
+    messages, redaction_digest, redaction_fields = _redact_prompt(messages, target_config)
+    prompt_fields = {**trim_fields, **redaction_fields}
     
-    # Apply config limits
-    final_model = model or llm_config.get("default_model", "gpt-4")
-    final_max_tokens = max_tokens
-    if final_max_tokens is None:
-        final_max_tokens = llm_config.get("max_tokens")
-    elif llm_config.get("max_tokens"):
-        final_max_tokens = min(final_max_tokens, llm_config["max_tokens"])
-    
-    final_temperature = temperature
-    if final_temperature is None:
-        final_temperature = llm_config.get("temperature")
-    elif llm_config.get("temperature") is not None:
-        final_temperature = min(final_temperature, llm_config["temperature"])
-    
-    # Get provider (explicit in config or auto-detect)
+    # Apply config limits, budget throttling and payload preparation
+    try:
+        plan = _plan_llm_request(
+            target_name,
+            target_config,
+            messages,
+            model,
+            max_tokens,
+            temperature,
+            top_p,
+            stop,
+            requested_target=requested_target,
+            cache_key=cache_key,
+            cache_vary=cache_vary,
+            tools=tools,
+            tool_choice=tool_choice,
+            response_format=response_format,
+            response_format_fallback=response_format_fallback,
+            output_schema=output_schema,
+            redaction_digest=redaction_digest,
+            cached_filter=cached_filter,
+            raw_passthrough=raw_passthrough,
+            strict=strict,
+            logprobs=logprobs,
+            top_logprobs=top_logprobs,
+        )
+    except TranslationError as e:
+        provider = llm_config.get("provider") or detect_provider(target_config["base_url"])
+        return _translation_error(e, target_name, provider, requested_model, request_id, start_time)
+    if plan.adjustments:
+        prompt_fields["adjustments"] = plan.adjustments
+    if plan.deployment:
+        prompt_fields["deployment"] = plan.deployment
+    final_model = plan.model
     base_url = target_config["base_url"]
-    provider = llm_config.get("provider") or detect_provider(base_url)
+    provider = plan.provider
     
-    # Budget control: estimate cost and check caps
-    cost_estimate_usd = None
+    # Budget control: check caps against the estimate for the requested max_tokens
+    cost_estimate_usd = plan.requested_cost_estimate_usd
     cost_policy_applied = "none"
-    max_tokens_reduced = False
-    original_max_tokens = None
+    max_tokens_reduced = plan.original_max_tokens is not None
+    original_max_tokens = plan.original_max_tokens
+    requested_max_tokens = original_max_tokens if max_tokens_reduced else plan.max_tokens
     
     if provider:
-        # Estimate cost before making request
-        cost_estimate_usd = CostEstimator.estimate_from_messages(
-            provider, final_model, messages, final_max_tokens
-        )
-        
         # Check hard cost cap (reject if exceeded)
         hard_cost_cap = llm_config.get("hard_cost_cap_usd")
         if hard_cost_cap and cost_estimate_usd and cost_estimate_usd > hard_cost_cap:
@@ -1099,7 +5166,7 @@ async def handle_llm_proxy(
                         "cost_estimate_usd": cost_estimate_usd,
                         "hard_cost_cap_usd": hard_cost_cap,
                         "model": final_model,
-                        "max_tokens": final_max_tokens,
+                        "max_tokens": requested_max_tokens,
                     },
                 ),
                 meta=MetaResponse(
@@ -1117,20 +5184,17 @@ async def handle_llm_proxy(
                 ),
             )
         
-        # Check soft cost cap (throttle by reducing max_tokens)
-        soft_cost_cap = llm_config.get("soft_cost_cap_usd")
-        if soft_cost_cap and cost_estimate_usd and cost_estimate_usd > soft_cost_cap:
-            # Auto-reduce max_tokens to fit soft cap
-            reduction_factor = soft_cost_cap / cost_estimate_usd
-            original_max_tokens = final_max_tokens
-            final_max_tokens = int(final_max_tokens * reduction_factor * 0.9)  # 0.9 for safety margin
-            max_tokens_reduced = True
+        # Soft cost cap: max_tokens was reduced to fit it
+        if max_tokens_reduced:
             cost_policy_applied = "soft_cap_throttled"
             budget_events_total.labels(target=target_name, event="soft_cap", tenant=tenant or "default").inc()
-            
-            # Re-estimate with reduced tokens
-            cost_estimate_usd = CostEstimator.estimate_from_messages(
-                provider, final_model, messages, final_max_tokens
+        cost_estimate_usd = plan.cost_estimate_usd
+
+        rejection = _budget_rejection(cost_estimate_usd, max_cost_usd, budget_cap_usd, tenant, key_limits)
+        if rejection:
+            return _budget_rejection_response(
+                rejection, target_name, provider, final_model, plan.max_tokens, request_id, start_time, tenant,
+                cost_estimate_usd, max_tokens_reduced, original_max_tokens,
             )
     
     if not provider:
@@ -1157,7 +5221,7 @@ async def handle_llm_proxy(
             ),
         )
     
-    adapter = get_adapter(provider)
+    adapter = plan.adapter
     if not adapter:
         return ErrorResponse(
             success=False,
@@ -1181,37 +5245,63 @@ async def handle_llm_proxy(
             ),
         )
     
-    # Prepare request payload
-    payload = adapter.prepare_request(
-        messages=messages,
-        model=final_model,
-        max_tokens=final_max_tokens,
-        temperature=final_temperature,
-        top_p=top_p,
-        stop=stop,
-        stream=False,  # Non-streaming path
-    )
-    
-    # Determine API endpoint based on provider
-    if provider == "openai":
-        api_path = "/chat/completions"
-    elif provider == "anthropic":
-        api_path = "/messages"
-    elif provider == "mistral":
-        api_path = "/chat/completions"
-    else:
-        api_path = "/chat/completions"  # Default
-    
-    # Build cache key
-    cache_key_body = json.dumps(payload, sort_keys=True)
-    cache_key_bytes = cache_key_body.encode()
+    api_path = plan.api_path
+    payload_bytes = plan.payload_bytes
+    cache_key_bytes = plan.cache_key_bytes
+    resolved_cache_key = plan.cache_key
+    cache_config = target_config.get("cache", {})
+
+    if dry_run:
+        cache_entry_exists = bool(
+            cache_config.get("enabled", True)
+            and cache.get(
+                "POST", base_url + api_path, None, None, None, allow_post=True, tenant=tenant,
+                cache_key_hash=resolved_cache_key, legacy_key_hash=plan.legacy_cache_key,
+            )
+        )
+        return _dry_run_response(
+            cache_entry_exists,
+            request_id,
+            start_time,
+            target=target_name,
+            provider=provider,
+            model=final_model,
+            cache_key=resolved_cache_key,
+            cost_estimate_usd=cost_estimate_usd,
+            cost_policy_applied=cost_policy_applied,
+            max_tokens_reduced=max_tokens_reduced or None,
+            original_max_tokens=original_max_tokens,
+            **prompt_fields,
+        )
     
     # Check cache
     cache_hit = False
-    cache_config = target_config.get("cache", {})
+    semantic_query = None
     if cache_config.get("enabled", True):
         ttl = cache_ttl or cache_config.get("ttl_s", 3600)
-        cached = cache.get("POST", base_url + api_path, None, cache_key_bytes, None, allow_post=True, tenant=tenant)
+        cached = cache.get(
+            "POST", base_url + api_path, None, None, None, allow_post=True, tenant=tenant,
+            cache_key_hash=resolved_cache_key, legacy_key_hash=plan.legacy_cache_key,
+        )
+        # Exact matches take priority; only a miss is looked up by meaning
+        semantic_match = None
+        if not cached and cache_semantic:
+            semantic_query = await _semantic_query(
+                plan,
+                messages,
+                cache_semantic.get("embedding_model"),
+                target_name=target_name,
+                targets=targets,
+                cache=cache,
+                idempotency=idempotency,
+                request_id=request_id,
+                tenant=tenant,
+                key_pool_manager=key_pool_manager,
+            )
+            if semantic_query:
+                semantic_match = _semantic_cache_match(cache, semantic_query, cache_semantic["threshold"], tenant)
+                if semantic_match:
+                    resolved_cache_key, cached, _ = semantic_match
         if cached:
             cache_hit = True
             duration_ms = int((time.time() - start_time) * 1000)
@@ -1238,6 +5328,7 @@ async def handle_llm_proxy(
                     success=True,
                     data=cached.get("body", {}),
                     meta=MetaResponse(
+                        cache_key=resolved_cache_key,
                         target=target_name,
                         provider=provider,
                         model=final_model,
@@ -1247,6 +5338,9 @@ async def handle_llm_proxy(
                         request_id=request_id,
                         trace_id=None,
                         cost_usd=cached.get("cost_usd"),
+                        semantic_cache_hit=True if semantic_match else None,
+                        semantic_similarity=semantic_match[2] if semantic_match else None,
+                        **prompt_fields,
                     ),
                 )
     
@@ -1254,7 +5348,7 @@ async def handle_llm_proxy(
     if idempotency_key:
         full_url = f"{base_url}{api_path}"
         is_new, existing_id, existing_hash = idempotency.register_request(
-            idempotency_key, "POST", full_url, None, cache_key_bytes, request_id, tenant=tenant
+            idempotency_key, "POST", full_url, None, cache_key_bytes, request_id, tenant=tenant, ttl_s=idempotency_ttl
         )
         
         if not is_new:
@@ -1305,16 +5399,22 @@ async def handle_llm_proxy(
                     success=True,
                     data=existing_result.get("data", {}),
                     meta=MetaResponse(
+                        cache_key=resolved_cache_key,
                         target=target_name,
                         provider=provider,
                         model=final_model,
                         cache_hit=False,
                         idempotent_hit=True,
+                        **idempotency.record_replay(idempotency_key, tenant=tenant),
                         retries=0,
                         duration_ms=duration_ms,
                         request_id=request_id,
                         trace_id=None,
                         cost_usd=cost_usd,
+                        fallback_used=existing_result.get("fallback_used"),
+                        fallback_target=existing_result.get("served_by"),
+                        served_by=existing_result.get("served_by"),
+                        **prompt_fields,
                     ),
                 )
             
@@ -1352,28 +5452,52 @@ async def handle_llm_proxy(
                         success=True,
                         data=existing_result.get("data", {}),
                         meta=MetaResponse(
+                            cache_key=resolved_cache_key,
                             target=target_name,
                             provider=provider,
                             model=final_model,
                             cache_hit=False,
                             idempotent_hit=True,
+                            **idempotency.record_replay(idempotency_key, tenant=tenant),
                             retries=0,
                             duration_ms=duration_ms,
                             request_id=request_id,
                             trace_id=None,
                             cost_usd=cost_usd,
+                            fallback_used=existing_result.get("fallback_used"),
+                            fallback_target=existing_result.get("served_by"),
+                            served_by=existing_result.get("served_by"),
+                            **prompt_fields,
                         ),
                     )
         
         idempotency.mark_in_progress(idempotency_key, tenant=tenant)
     
+    # Over the target's rate budget the request waits for its turn
+    queue_config = target_config.get("queue")
+    queue = _target_queues.get(target_name, queue_config)
+    if queue:
+        wait_ms = queue_timeout_ms or queue_config.get("timeout_ms", DEFAULT_QUEUE_TIMEOUT_MS)
+        try:
+            waited_s = await queue.admit(priority, wait_ms / 1000.0)
+        except QueueFullError as e:
+            if idempotency_key:
+                idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+            return _queue_full_response(e, target_name, provider, final_model, request_id, start_time)
+        prompt_fields = {**prompt_fields, "queue_wait_ms": int(waited_s * 1000)}
+
     # Create HTTP client
     # Get provider for key pool selection
     provider = llm_config.get("provider") or detect_provider(target_config.get("base_url", ""))
     
     # Create HTTP client (with key pool support)
     client, selected_key, auth_source = create_http_client(
-        target_config, target_name, key_pool_manager=key_pool_manager, provider=provider
+        target_config,
+        target_name,
+        key_pool_manager=key_pool_manager,
+        provider=provider,
+        request_timeout_ms=timeout_ms,
+        model=final_model,
     )
     
     # Get client profile and apply limits
@@ -1429,6 +5553,7 @@ async def handle_llm_proxy(
                 ),
                 meta=MetaResponse(
                     target=target_name,
+                    circuit_key=circuit_key(target_name, client.circuit_key),
                     provider=provider,
                     model=final_model,
                     cache_hit=False,
@@ -1440,15 +5565,50 @@ async def handle_llm_proxy(
                 ),
             )
     
+    # Under the target's max_concurrency the call waits for a free slot
+    limiter = _target_concurrency.get(target_name, target_config.get("max_concurrency"))
+    wait_ms = max_wait_ms or target_config.get("concurrency_wait_ms", DEFAULT_CONCURRENCY_WAIT_MS)
     try:
-        # Make request
-        response = await client.request(
-            method="POST",
-            path=api_path,
-            headers={"Content-Type": "application/json"},
-            body=cache_key_bytes,
-            params=None,
+        waited_s = await limiter.acquire(wait_ms / 1000.0)
+    except ConcurrencyLimitError as e:
+        await client.close()
+        if idempotency_key:
+            idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+        return _concurrency_limit_response(e, target_name, provider, final_model, request_id, start_time)
+    if limiter.limit:
+        prompt_fields = {**prompt_fields, "concurrency_wait_ms": int(waited_s * 1000)}
+
+    # The estimate is held against the budgets until the cost is recorded,
+    # so concurrent requests can't each pass against the same remainder
+    budget_holds = BudgetHolds()
+    rejection = _budget_rejection(cost_estimate_usd, None, budget_cap_usd, tenant, key_limits, budget_holds)
+    if rejection:
+        limiter.release()
+        await client.close()
+        if idempotency_key:
+            idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+        return _budget_rejection_response(
+            rejection, target_name, provider, final_model, plan.max_tokens, request_id, start_time, tenant,
+            cost_estimate_usd, max_tokens_reduced, original_max_tokens,
         )
+
+    hedge_outcome = None
+    try:
+        # Make request
+        if hedge:
+            response, hedge_outcome = await _hedged_request(
+                client, api_path, payload_bytes, hedge, retry_policy, retry_stats
+            )
+        else:
+            response = await client.request(
+                method="POST",
+                path=api_path,
+                headers={"Content-Type": "application/json"},
+                body=payload_bytes,
+                params=None,
+                retry_policy=retry_policy,
+                retry_stats=retry_stats,
+            )
         
         # Read response
         response_body = await response.aread()
@@ -1480,6 +5640,9 @@ async def handle_llm_proxy(
                     fallback_llm_config = fallback_config.get("llm", {})
                     if not fallback_llm_config:
                         continue
+                    # Nor one whose breaker for the model is open
+                    if circuit_open(fallback_target_name, fallback_config, model):
+                        continue
                     
                     # Try fallback target
                     try:
@@ -1500,6 +5663,18 @@ async def handle_llm_proxy(
                             request_id=request_id,
                             tenant=tenant,
                             tier=tier,  # Pass tier to fallback handler
+                            requested_target=requested_target or target_name,
+                            cache_key=cache_key,
+                            cache_vary=cache_vary,
+                            stale_ttl_s=stale_ttl_s,
+                            retry=retry,
+                            tools=tools,
+                            tool_choice=tool_choice,
+                            response_format=response_format,
+                            response_format_fallback=response_format_fallback,
+                            output_schema=output_schema,
+                            repair_attempts=repair_attempts,
+                            strict=strict,
                         )
                         
                         if fallback_result.success:
@@ -1532,7 +5707,7 @@ async def handle_llm_proxy(
                 key_switch_state.used_keys.add(selected_key.id)
                 
                 retryable_error = response_status >= 500 or response_status == 429
-                if retryable_error and key_pool_manager.has_pool(selected_key.provider) and key_switch_state.can_switch():
+                if retryable_error and _may_switch_key(key_pool_manager, key_switch_state, selected_key, retry_policy):
                     # Select new key, excluding recently used keys
                     new_key = key_pool_manager.select_key(
                         selected_key.provider,
@@ -1551,6 +5726,8 @@ async def handle_llm_proxy(
                             "api_key": new_key.key,
                         }
                         client.auth = new_auth
+                        if client.pacer is not None:
+                            client.pacer.credential = new_key.id
                         selected_key = new_key
                         
                         # Retry request
@@ -1559,7 +5736,7 @@ async def handle_llm_proxy(
                                 method="POST",
                                 path=api_path,
                                 headers={"Content-Type": "application/json"},
-                                body=cache_key_bytes,
+                                body=payload_bytes,
                                 params=None,
                             )
                             
@@ -1570,8 +5747,10 @@ async def handle_llm_proxy(
                             if response_status < 400:
                                 response_json = json.loads(response_body.decode()) if response_body else {}
                                 
-                                if not response_json or "choices" not in response_json:
-                                    raise ValueError(f"Invalid response format from {provider}: missing 'choices' field")
+                                if not any(field in response_json for field in adapter.RESPONSE_FIELDS):
+                                    raise ValueError(
+                                        f"Invalid response format from {provider}: missing '{adapter.RESPONSE_FIELDS[0]}' field"
+                                    )
                                 
                                 normalized_response = adapter.parse_response(response_json)
                                 
@@ -1588,10 +5767,23 @@ async def handle_llm_proxy(
                                     ).inc()
                                 
                                 # Calculate cost
-                                usage = response_json.get("usage", {})
-                                prompt_tokens = usage.get("prompt_tokens", 0)
-                                completion_tokens = usage.get("completion_tokens", 0)
+                                usage = adapter.parse_usage(response_json)
+                                prompt_tokens = usage["prompt_tokens"]
+                                completion_tokens = usage["completion_tokens"]
+                                validation = None
+                                if output_schema is not None:
+                                    validation = await _validate_llm_output(
+                                        client, plan, plan.upstream_messages, plan.top_p, plan.stop,
+                                        plan.upstream_response_format, output_schema,
+                                        repair_attempts, normalized_response, prompt_tokens, completion_tokens,
+                                        retry_policy, retry_stats,
+                                    )
+                                    normalized_response = validation.normalized
+                                    response_json = validation.raw or response_json
+                                    prompt_tokens = validation.prompt_tokens
+                                    completion_tokens = validation.completion_tokens
                                 cost_usd = adapter.get_cost_usd(final_model, prompt_tokens, completion_tokens)
+                                budget_holds.cost_usd = cost_usd
                                 
                                 result_data = {
                                     "content": normalized_response.get("content", ""),
@@ -1603,25 +5795,42 @@ async def handle_llm_proxy(
                                         "total_tokens": prompt_tokens + completion_tokens,
                                     },
                                 }
+                                if normalized_response.get("tool_calls"):
+                                    result_data["tool_calls"] = normalized_response["tool_calls"]
+                                if normalized_response.get("logprobs"):
+                                    result_data["logprobs"] = normalized_response["logprobs"]
+                                if raw_passthrough:
+                                    result_data["raw_body"] = _llm_raw_body(response_body, validation)
+                                if validation and not validation.valid:
+                                    if idempotency_key:
+                                        idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+                                    return _output_validation_error(
+                                        validation, result_data["content"], cost_usd, target_name, provider,
+                                        final_model, final_model, request_id, tenant, start_time, retry_stats,
+                                    )
                                 
                                 # Store in cache
+                                cache_stored = None
                                 if cache_config.get("enabled", True):
                                     ttl = cache_ttl or cache_config.get("ttl_s", 3600)
-                                    cache.set(
-                                        "POST", base_url + api_path, None, cache_key_bytes,
+                                    cache_stored = cache.set(
+                                        "POST", base_url + api_path, None, None,
                                         {
-                                            "body": result_data,
+                                            "body": _filtered_cache_entry(result_data, cached_filter, "llm"),
                                             "cost_usd": cost_usd,
                                         },
                                         ttl_s=ttl,
                                         query=None,
                                         allow_post=True,
                                         tenant=tenant,
+                                        cache_key_hash=resolved_cache_key,
+                                        target=target_name,
+                                        stale_ttl_s=stale_ttl_s,
+                                        max_entries=cache_config.get("max_entries"),
                                     )
                                 
                                 # Store idempotency result
                                 if idempotency_key:
-                                    idempotency_ttl = cache_ttl or cache_config.get("ttl_s", 3600) if cache_config.get("enabled", True) else 3600
                                     idempotency.store_result(
                                         idempotency_key,
                                         {
@@ -1654,12 +5863,15 @@ async def handle_llm_proxy(
                                     success=True,
                                     data=result_data,
                                     meta=MetaResponse(
+                                        cache_key=resolved_cache_key,
                                         target=target_name,
+                                        circuit_key=circuit_key(target_name, client.circuit_key),
                                         provider=provider,
                                         model=final_model,
                                         cache_hit=False,
+                                        cache_stored=cache_stored,
                                         idempotent_hit=False,
-                                        retries=retries,
+                                        **_retry_meta(retry_stats),
                                         duration_ms=duration_ms,
                                         request_id=request_id,
                                         trace_id=None,
@@ -1668,6 +5880,10 @@ async def handle_llm_proxy(
                                         cost_policy_applied=cost_policy_applied,
                                         max_tokens_reduced=max_tokens_reduced if max_tokens_reduced else None,
                                         original_max_tokens=original_max_tokens if max_tokens_reduced else None,
+                                        validation_attempts=validation.attempts if validation else None,
+                                        output_valid=True if validation else None,
+                                        raw_provider_response=response_json if include_raw else None,
+                                        **prompt_fields,
                                     ),
                                 )
                         except Exception:
@@ -1716,10 +5932,11 @@ async def handle_llm_proxy(
                 ),
                 meta=MetaResponse(
                     target=target_name,
+                    circuit_key=circuit_key(target_name, client.circuit_key),
                     provider=provider,
                     model=final_model,
                     cache_hit=False,
-                    retries=retries,
+                    **_retry_meta(retry_stats),
                     duration_ms=duration_ms,
                     request_id=request_id,
                     trace_id=None,
@@ -1730,8 +5947,8 @@ async def handle_llm_proxy(
         response_json = json.loads(response_body.decode()) if response_body else {}
         
         # Validate response has required fields
-        if not response_json or "choices" not in response_json:
-            raise ValueError(f"Invalid response format from {provider}: missing 'choices' field")
+        if not any(field in response_json for field in adapter.RESPONSE_FIELDS):
+            raise ValueError(f"Invalid response format from {provider}: missing '{adapter.RESPONSE_FIELDS[0]}' field")
         
         normalized_response = adapter.parse_response(response_json)
         
@@ -1752,10 +5969,33 @@ async def handle_llm_proxy(
             key_pool_status.labels(provider_key_id=selected_key.id, status=selected_key.status).observe(status_value)
         
         # Calculate cost
-        usage = response_json.get("usage", {})
-        prompt_tokens = usage.get("prompt_tokens", 0)
-        completion_tokens = usage.get("completion_tokens", 0)
+        usage = adapter.parse_usage(response_json)
+        prompt_tokens = usage["prompt_tokens"]
+        completion_tokens = usage["completion_tokens"]
+        hedge_fields: Dict[str, Any] = {}
+        if hedge_outcome:
+            # The losing requests were identical, so the winner's cost stands
+            # in for the ones the provider bills
+            winner_cost = adapter.get_cost_usd(final_model, prompt_tokens, completion_tokens) or 0.0
+            hedge_fields = {
+                "hedged": hedge_outcome.hedges > 0,
+                "hedge_winner": hedge_outcome.winner,
+                "hedge_cost_usd": winner_cost * hedge_outcome.losers_billed(adapter.BILLS_CANCELED_REQUESTS),
+            }
+        validation = None
+        if output_schema is not None:
+            validation = await _validate_llm_output(
+                client, plan, plan.upstream_messages, plan.top_p, plan.stop, plan.upstream_response_format, output_schema,
+                repair_attempts,
+                normalized_response, prompt_tokens, completion_tokens, retry_policy, retry_stats,
+            )
+            normalized_response = validation.normalized
+            response_json = validation.raw or response_json
+            prompt_tokens, completion_tokens = validation.prompt_tokens, validation.completion_tokens
         cost_usd = adapter.get_cost_usd(final_model, prompt_tokens, completion_tokens)
+        if hedge_fields.get("hedge_cost_usd"):
+            cost_usd = (cost_usd or 0.0) + hedge_fields["hedge_cost_usd"]
+        budget_holds.cost_usd = cost_usd
         
         result_data = {
             "content": normalized_response.get("content", ""),
@@ -1767,25 +6007,51 @@ async def handle_llm_proxy(
                 "total_tokens": prompt_tokens + completion_tokens,
             },
         }
+        if normalized_response.get("tool_calls"):
+            result_data["tool_calls"] = normalized_response["tool_calls"]
+        if normalized_response.get("logprobs"):
+            result_data["logprobs"] = normalized_response["logprobs"]
+        provider_meta = normalized_response.get("provider_meta")
+        if provider_meta:
+            result_data["provider_meta"] = provider_meta
+        if raw_passthrough:
+            result_data["raw_body"] = _llm_raw_body(response_body, validation)
+        # Spend is logged against the snapshot that served the request;
+        # pricing stays keyed by the configured model.
+        served_model = (provider_meta or {}).get("model") or final_model
+        
+        if validation and not validation.valid:
+            if idempotency_key:
+                idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+            return _output_validation_error(
+                validation, result_data["content"], cost_usd, target_name, provider, final_model,
+                served_model, request_id, tenant, start_time, retry_stats,
+            )
         
         # Store in cache
+        cache_stored = None
         if cache_config.get("enabled", True):
             ttl = cache_ttl or cache_config.get("ttl_s", 3600)
-            cache.set(
-                "POST", base_url + api_path, None, cache_key_bytes,
+            cache_stored = cache.set(
+                "POST", base_url + api_path, None, None,
                 {
-                    "body": result_data,
+                    "body": _filtered_cache_entry(result_data, cached_filter, "llm"),
                     "cost_usd": cost_usd,
                 },
                 ttl_s=ttl,
                 query=None,
                 allow_post=True,
                 tenant=tenant,
+                cache_key_hash=resolved_cache_key,
+                target=target_name,
+                stale_ttl_s=stale_ttl_s,
+                max_entries=cache_config.get("max_entries"),
             )
+            if semantic_query:
+                cache.add_semantic_entry(semantic_query.scope, resolved_cache_key, semantic_query.embedding, ttl, tenant)
         
-        # Store idempotency result (use same TTL as cache for consistency)
+        # Store idempotency result for as long as the key is registered
         if idempotency_key:
-            idempotency_ttl = cache_ttl or cache_config.get("ttl_s", 3600) if cache_config.get("enabled", True) else 3600
             idempotency.store_result(
                 idempotency_key,
                 {
@@ -1802,7 +6068,7 @@ async def handle_llm_proxy(
             request_id=request_id,
             target_name=target_name,
             provider=provider,
-            model=final_model,
+            model=served_model,
             stream=False,
             outcome="success",
             latency_ms=duration_ms,
@@ -1819,12 +6085,15 @@ async def handle_llm_proxy(
             success=True,
             data=result_data,
             meta=MetaResponse(
+                cache_key=resolved_cache_key,
                 target=target_name,
+                circuit_key=circuit_key(target_name, client.circuit_key),
                 provider=provider,
                 model=final_model,
                 cache_hit=False,
+                cache_stored=cache_stored,
                 idempotent_hit=False,
-                retries=retries,
+                **_retry_meta(retry_stats),
                 duration_ms=duration_ms,
                 request_id=request_id,
                 trace_id=None,
@@ -1833,6 +6102,11 @@ async def handle_llm_proxy(
                 cost_policy_applied=cost_policy_applied,
                 max_tokens_reduced=max_tokens_reduced if max_tokens_reduced else None,
                 original_max_tokens=original_max_tokens if max_tokens_reduced else None,
+                validation_attempts=validation.attempts if validation else None,
+                output_valid=True if validation else None,
+                raw_provider_response=response_json if include_raw else None,
+                **hedge_fields,
+                **prompt_fields,
             ),
         )
         
@@ -1841,7 +6115,7 @@ async def handle_llm_proxy(
             idempotency.clear_in_progress(idempotency_key, tenant=tenant)
         
         # Update key pool health on network error
-        if selected_key and key_pool_manager:
+        if selected_key and key_pool_manager and not isinstance(e, DeadlineTooShortError):
             key_pool_manager.record_error(selected_key.id, "network", None)
             key_pool_requests_total.labels(
                 provider_key_id=selected_key.id,
@@ -1854,8 +6128,55 @@ async def handle_llm_proxy(
             ).inc()
         
         duration_ms = int((time.time() - start_time) * 1000)
-        error_code = ErrorCode.NETWORK_ERROR
-        upstream_status_norm = UpstreamStatus.BAD_GATEWAY.value
+        error = _request_error_detail(e, target_name)
+        upstream_status_norm = UpstreamStatus.normalize(error.status_code)
+        _log_and_metric_llm_request(
+            request_id=request_id,
+            target_name=target_name,
+            provider=provider,
+            model=final_model,
+            stream=False,
+            outcome="error",
+            latency_ms=duration_ms,
+            cache_hit=False,
+            idempotent_hit=False,
+            error_code=error.code,
+            upstream_status=error.status_code,  # Actual status for logs
+            tenant=tenant,
+        )
+        # Legacy metrics
+        llm_requests_total.labels(target=target_name, provider=provider, status="error").inc()
+        errors_total.labels(
+            target=target_name,
+            kind="llm",
+            error_code=error.code,
+            upstream_status=upstream_status_norm,
+        ).inc()
+        latency_ms.labels(target=target_name, status="error").observe(duration_ms)
+        return ErrorResponse(
+            success=False,
+            error=error,
+            meta=MetaResponse(
+                target=target_name,
+                circuit_key=circuit_key(target_name, client.circuit_key),
+                provider=provider,
+                model=final_model,
+                cache_hit=False,
+                idempotent_hit=False,
+                **_retry_meta(retry_stats),
+                duration_ms=duration_ms,
+                request_id=request_id,
+                trace_id=None,
+            ),
+        )
+        
+    except CircuitOpenError:
+        if idempotency_key:
+            idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+        
+        duration_ms = int((time.time() - start_time) * 1000)
+        error_code = ErrorCode.CIRCUIT_OPEN
+        upstream_status_norm = UpstreamStatus.SERVICE_UNAVAILABLE.value
         _log_and_metric_llm_request(
             request_id=request_id,
             target_name=target_name,
@@ -1867,7 +6188,7 @@ async def handle_llm_proxy(
             cache_hit=False,
             idempotent_hit=False,
             error_code=error_code.value,
-            upstream_status=502,  # Actual status for logs
+            upstream_status=503,
             tenant=tenant,
         )
         # Legacy metrics
@@ -1884,78 +6205,948 @@ async def handle_llm_proxy(
             error=ErrorDetail(
                 type="upstream_error",
                 code=error_code.value,
-                message=f"Network error: {str(e)}",
+                message=f"Circuit breaker open for target '{target_name}'",
+                retryable=True,
+                target=target_name,
+                status_code=503,
+            ),
+            meta=MetaResponse(
+                target=target_name,
+                circuit_key=circuit_key(target_name, client.circuit_key),
+                circuit_state="open",
+                provider=provider,
+                model=final_model,
+                cache_hit=False,
+                idempotent_hit=False,
+                **_retry_meta(retry_stats),
+                duration_ms=duration_ms,
+                request_id=request_id,
+                trace_id=None,
+            ),
+        )
+        
+    except Exception as e:
+        if idempotency_key:
+            idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+        
+        duration_ms = int((time.time() - start_time) * 1000)
+        error_code = ErrorCode.INTERNAL_ERROR
+        upstream_status_norm = UpstreamStatus.INTERNAL_SERVER_ERROR.value
+        _log_and_metric_llm_request(
+            request_id=request_id,
+            target_name=target_name,
+            provider=provider,
+            model=final_model,
+            stream=False,
+            outcome="error",
+            latency_ms=duration_ms,
+            cache_hit=False,
+            idempotent_hit=False,
+            error_code=error_code.value,
+            upstream_status=500,  # Actual status for logs
+            tenant=tenant,
+        )
+        # Legacy metrics
+        llm_requests_total.labels(target=target_name, provider=provider, status="error").inc()
+        errors_total.labels(
+            target=target_name,
+            kind="llm",
+            error_code=error_code.value,
+            upstream_status=upstream_status_norm,
+        ).inc()
+        latency_ms.labels(target=target_name, status="error").observe(duration_ms)
+        return ErrorResponse(
+            success=False,
+            error=ErrorDetail(
+                type="internal_error",
+                code=error_code.value,
+                message=f"Internal error: {str(e)}",
+                retryable=True,
+                target=target_name,
+                status_code=500,
+            ),
+            meta=MetaResponse(
+                target=target_name,
+                circuit_key=circuit_key(target_name, client.circuit_key),
+                provider=provider,
+                model=final_model,
+                cache_hit=False,
+                **_retry_meta(retry_stats),
+                duration_ms=duration_ms,
+                request_id=request_id,
+                trace_id=None,
+            ),
+        )
+        
+    finally:
+        budget_holds.release()
+        limiter.release()
+        await client.close()
+
+
+def _is_fallback_eligible(result: Union[SuccessResponse, ErrorResponse]) -> bool:
+    """Return True if a failed LLM result may be retried on a fallback target.
+
+    Only retryable upstream failures qualify (429, 5xx, open circuit); 4xx
+    errors such as budget rejections or bad requests never fall through.
+    """
+    if result.success:
+        return False
+    status = result.error.status_code or 500
+    return status == 429 or status >= 500
+
+
+async def handle_llm_proxy_with_fallbacks(
+    fallbacks: Optional[List[Dict[str, Optional[str]]]],
+    fallback_response: Optional[Dict[str, Any]] = None,
+    **kwargs: Any,
+) -> Union[SuccessResponse, ErrorResponse]:
+    """Handle LLM proxy request with a client-supplied fallback chain.
+
+    The primary target is tried first with the caller's idempotency key. On a
+    retryable failure each fallback is tried in order under a derived key
+    (``<key>:fallback:<target>``), and a fallback success is also stored under
+    the original key so a client retry replays it instead of calling the
+    primary again. meta.served_by always names the target that answered.
+
+    When the whole chain fails with a retryable error, fallback_response, or
+    else the primary target's fallback_response, is served in its place (see
+    _static_fallback). A leg is skipped while the breaker of its model is
+    open (see circuit_open).
+    """
+    target_name = kwargs["target_name"]
+    idempotency_key = kwargs.get("idempotency_key")
+    idempotency: IdempotencyManager = kwargs["idempotency"]
+    tenant = kwargs.get("tenant")
+
+    result = await handle_llm_proxy(**kwargs)
+
+    # Free tier: No chaining fallbacks (>1 provider)
+    if fallbacks and kwargs.get("tier", "free") != "free" and _is_fallback_eligible(result):
+        for fallback in fallbacks:
+            fallback_target_name = fallback.get("target")
+            if not fallback_target_name or fallback_target_name == target_name:
+                continue
+            fallback_config = (kwargs.get("targets") or {}).get(fallback_target_name)
+            if fallback_config and circuit_open(fallback_target_name, fallback_config, fallback.get("model")):
+                # The leg's breaker for its model is open; it would fail fast
+                continue
+            fallback_kwargs = dict(kwargs)
+            fallback_kwargs.update(
+                target_name=fallback_target_name,
+                model=fallback.get("model"),
+                idempotency_key=(
+                    f"{idempotency_key}:fallback:{fallback_target_name}"
+                    if idempotency_key
+                    else None
+                ),
+                requested_target=target_name,
+            )
+            fallback_result = await handle_llm_proxy(**fallback_kwargs)
+            if fallback_result.success:
+                fallback_result.meta.fallback_used = True
+                fallback_result.meta.fallback_target = fallback_target_name
+                fallback_result.meta.served_by = fallback_target_name
+                if idempotency_key:
+                    # Replay the fallback answer for retries of the whole chain
+                    idempotency.store_result(
+                        idempotency_key,
+                        {
+                            "data": fallback_result.data,
+                            "cost_usd": fallback_result.meta.cost_usd,
+                            "fallback_used": True,
+                            "served_by": fallback_target_name,
+                        },
+                        ttl_s=kwargs.get("cache_ttl") or 3600,
+                        tenant=tenant,
+                    )
+                return fallback_result
+            result = fallback_result
+            if not _is_fallback_eligible(fallback_result):
+                break
+
+    if _is_fallback_eligible(result):
+        static = fallback_response or ((kwargs.get("targets") or {}).get(target_name) or {}).get("fallback_response")
+        if static:
+            return _static_fallback(result, static)
+
+    if result.success and not result.meta.served_by:
+        result.meta.served_by = result.meta.fallback_target or result.meta.target
+    return result
+
+
+def _static_fallback(failed: ErrorResponse, static: Dict[str, Any]) -> SuccessResponse:
+    """A fallback_response standing in for a failed LLM request.
+
+    It is shaped like a completion, costs nothing and reports the failure in
+    meta.upstream_error. Nothing is cached or stored under the idempotency
+    key, and the circuit breaker keeps the failure, so the next request
+    tries the upstream again.
+    """
+    logger.warning(
+        f"Serving static fallback response: target={failed.meta.target}, "
+        f"code={failed.error.code}, request_id={failed.meta.request_id}"
+    )
+    return SuccessResponse(
+        success=True,
+        data={
+            "content": static["content"],
+            "role": "assistant",
+            "finish_reason": static.get("finish_reason") or "stop",
+            "usage": {"prompt_tokens": 0, "completion_tokens": 0, "total_tokens": 0},
+        },
+        meta=failed.meta.model_copy(update={
+            "cost_usd": 0.0,
+            "cache_hit": False,
+            "fallback_served": True,
+            "upstream_error": failed.error,
+        }),
+    )
+
+
+async def handle_llm_batch(
+    items: List[Dict[str, Any]],
+    max_parallel: int,
+    fail_fast: bool,
+    request_id: str,
+    **common: Any,
+) -> LLMBatchResponse:
+    """Handle a batch of LLM proxy requests.
+
+    Each item holds the per-request arguments of handle_llm_proxy_with_fallbacks
+    (plus ``fallbacks`` and ``cache_mode``); ``common`` holds the shared ones (targets, cache,
+    tenant, ...). At most max_parallel items run at once. With fail_fast, items
+    that have not started when the first failure is seen are reported as
+    BATCH_ABORTED instead of being sent upstream.
+    """
+    start_time = time.time()
+    semaphore = asyncio.Semaphore(max_parallel)
+    aborted = asyncio.Event()
+    results: List[Optional[Union[SuccessResponse, ErrorResponse]]] = [None] * len(items)
+
+    async def run_item(index: int, item: Dict[str, Any]) -> None:
+        item_request_id = f"{request_id}_{index}"
+        async with semaphore:
+            if aborted.is_set():
+                results[index] = ErrorResponse(
+                    success=False,
+                    error=ErrorDetail(
+                        type="batch_error",
+                        code=ErrorCode.BATCH_ABORTED.value,
+                        message="Batch aborted after an earlier item failed (fail_fast)",
+                        retryable=True,
+                        target=item.get("target_name"),
+                        status_code=424,
+                        source="reliapi",
+                    ),
+                    meta=MetaResponse(
+                        target=item.get("target_name"),
+                        duration_ms=0,
+                        request_id=item_request_id,
+                    ),
+                )
+                return
+            result = await handle_with_cache_mode(
+                handle_llm_proxy_with_fallbacks,
+                kind="llm",
+                request_id=item_request_id,
+                **item,
+                **common,
+            )
+            if fail_fast and not result.success:
+                aborted.set()
+            results[index] = result
+
+    await asyncio.gather(*(run_item(i, item) for i, item in enumerate(items)))
+
+    item_results: List[LLMBatchItemResult] = []
+    succeeded = failed = aborted_count = cache_hits = 0
+    cost_usd = 0.0
+    for index, result in enumerate(results):
+        if result.success:
+            succeeded += 1
+            item_results.append(
+                LLMBatchItemResult(index=index, success=True, data=result.data, meta=result.meta)
+            )
+        else:
+            failed += 1
+            if result.error.code == ErrorCode.BATCH_ABORTED.value:
+                aborted_count += 1
+            item_results.append(
+                LLMBatchItemResult(index=index, success=False, error=result.error, meta=result.meta)
+            )
+        if result.meta.cache_hit:
+            cache_hits += 1
+        # Cache and idempotency hits did not call upstream, so they cost nothing
+        if result.meta.cost_usd and not (result.meta.cache_hit or result.meta.idempotent_hit):
+            cost_usd += result.meta.cost_usd
+
+    return LLMBatchResponse(
+        success=failed == 0,
+        results=item_results,
+        meta=BatchMetaResponse(
+            request_id=request_id,
+            duration_ms=int((time.time() - start_time) * 1000),
+            total=len(items),
+            succeeded=succeeded,
+            failed=failed,
+            aborted=aborted_count,
+            cache_hits=cache_hits,
+            cost_usd=round(cost_usd, 6),
+        ),
+    )
+
+
+# Async jobs in flight, referenced so they aren't garbage-collected mid-run.
+_running_jobs: Set["asyncio.Task[Dict[str, Any]]"] = set()
+
+
+def submit_llm_job(
+    jobs: JobStore,
+    request_hash: str,
+    callback_url: Optional[str],
+    webhook_secret: Optional[str],
+    api_key: Optional[str] = None,
+    alert_config: Optional[BudgetAlertConfig] = None,
+    credential: Optional[str] = None,
+    response_filter: Optional[str] = None,
+    tags: Optional[Dict[str, str]] = None,
+    **kwargs: Any,
+) -> Tuple[Optional[Dict[str, Any]], bool]:
+    """Queue an LLM request as an async job and start running it.
+
+    kwargs are the handle_with_cache_mode arguments of the request. A repeated
+    idempotency_key returns the job it was first submitted with, which is not
+    run again. Returns JobStore.create's (job, created).
+    """
+    job, created = jobs.create(
+        kwargs.get("tenant"), request_hash, kwargs.get("idempotency_key"), callback_url
+    )
+    if created:
+        task = asyncio.create_task(
+            run_llm_job(
+                jobs,
+                job,
+                webhook_secret,
+                api_key=api_key,
+                alert_config=alert_config,
+                credential=credential,
+                response_filter=response_filter,
+                tags=tags,
+                **kwargs,
+            )
+        )
+        _running_jobs.add(task)
+        task.add_done_callback(_running_jobs.discard)
+    return job, created
+
+
+async def run_llm_job(
+    jobs: JobStore,
+    job: Dict[str, Any],
+    webhook_secret: Optional[str],
+    api_key: Optional[str] = None,
+    alert_config: Optional[BudgetAlertConfig] = None,
+    credential: Optional[str] = None,
+    response_filter: Optional[str] = None,
+    tags: Optional[Dict[str, str]] = None,
+    **kwargs: Any,
+) -> Dict[str, Any]:
+    """Run a queued job and record its ReliAPIResponse.
+
+    When the job has a callback_url the finished job is then delivered to it as
+    a signed job.completed event, and callback_delivered records the outcome.
+    The job counts in the usage report under api_key and tags, and its spend fires
+    budget alerts per alert_config. credential pins the target's named
+    credential and response_filter selects the fields kept, as for the
+    synchronous request. Returns the final job record.
+    """
+    job = jobs.update(job, status=JobStatus.RUNNING.value)
+    try:
+        with select_credentials(credential, kwargs.get("idempotency_key"), kwargs.get("tenant")) as choice:
+            result = await handle_with_cache_mode(handle_llm_proxy_with_fallbacks, kind="llm", **kwargs)
+        stamp_target_version(result.meta, kwargs["targets"])
+        result.meta.credential_name = choice.used
+    except Exception as e:
+        logger.exception(f"Job {job['job_id']} failed: {e}")
+        result = ErrorResponse(
+            success=False,
+            error=ErrorDetail(
+                type="internal_error",
+                code=ErrorCode.INTERNAL_ERROR.value,
+                message="Job failed unexpectedly",
                 retryable=True,
+                target=kwargs.get("target_name"),
+                status_code=500,
+                source="reliapi",
+            ),
+            meta=MetaResponse(target=kwargs.get("target_name"), duration_ms=0, request_id=kwargs["request_id"]),
+        )
+
+    result.meta.tags = tags
+    record_usage(result, "llm", kwargs.get("tenant"), api_key, kwargs.get("key_limits"))
+    if alert_config:
+        check_budget_alerts(kwargs.get("tenant"), kwargs.get("budget_cap_usd"), kwargs.get("key_limits"), alert_config)
+    apply_response_filter(result, response_filter, "llm")
+    status = JobStatus.SUCCEEDED if result.success else JobStatus.FAILED
+    job = jobs.update(job, status=status.value, completed_at=time.time(), result=result.model_dump())
+    if job["callback_url"] and webhook_secret:
+        event = make_event(JOB_COMPLETED, {"job_id": job["job_id"], "status": job["status"], "result": job["result"]})
+        delivered = await deliver_webhook(job["callback_url"], event, webhook_secret)
+        job = jobs.update(job, callback_delivered=delivered)
+    return job
+
+
+def submit_cache_warm(
+    jobs: JobStore,
+    request_hash: str,
+    items: List[Dict[str, Any]],
+    max_parallel: int,
+    max_cost_usd: Optional[float] = None,
+    **kwargs: Any,
+) -> Optional[Dict[str, Any]]:
+    """Queue a cache warming job and start running it.
+
+    items are {"kind": "http" or "llm", "target": name, "args": handler
+    arguments, "credential": pinned credential}; kwargs are run_cache_warm's.
+    Returns the job, or None if it could not be stored.
+    """
+    job, _ = jobs.create(kwargs.get("tenant"), request_hash)
+    if job is None:
+        return None
+    job = jobs.update(
+        job,
+        kind="cache_warm",
+        max_cost_usd=max_cost_usd,
+        cost_usd=0.0,
+        items=[
+            {
+                "index": index,
+                "kind": item["kind"],
+                "target": item["target"],
+                "status": WarmItemStatus.PENDING.value,
+                "cache_key": None,
+                "cost_usd": None,
+                "error": None,
+            }
+            for index, item in enumerate(items)
+        ],
+    )
+    task = asyncio.create_task(run_cache_warm(jobs, job, items, max_parallel, max_cost_usd, **kwargs))
+    _running_jobs.add(task)
+    task.add_done_callback(_running_jobs.discard)
+    return job
+
+
+async def run_cache_warm(
+    jobs: JobStore,
+    job: Dict[str, Any],
+    items: List[Dict[str, Any]],
+    max_parallel: int,
+    max_cost_usd: Optional[float] = None,
+    tenant: Optional[str] = None,
+    api_key: Optional[str] = None,
+    budget_cap_usd: Optional[float] = None,
+    key_limits: Optional[KeyLimits] = None,
+    alert_config: Optional[BudgetAlertConfig] = None,
+) -> Dict[str, Any]:
+    """Run the items of a cache warming job and record each one's outcome.
+
+    Items run as handle_with_cache_mode would run the request, including its
+    budget checks and usage recording, at most max_parallel at once. A cache
+    hit is reported as cached and costs nothing. LLM items may cost at most
+    what is left of max_cost_usd when they start (see handle_llm_proxy's
+    max_cost_usd); once it is spent, items not started are aborted. Items
+    already running finish, so the total may end up above it. The job fails
+    if any item failed or was aborted. Returns the final job record.
+    """
+    job = jobs.update(job, status=JobStatus.RUNNING.value)
+    semaphore = asyncio.Semaphore(max_parallel)
+    spent = 0.0
+
+    def record(index: int, **fields: Any) -> None:
+        nonlocal job
+        outcomes = list(job["items"])
+        outcomes[index] = {**outcomes[index], **fields}
+        job = jobs.update(job, items=outcomes, cost_usd=round(spent, 6))
+
+    async def run_item(index: int, item: Dict[str, Any]) -> None:
+        nonlocal spent
+        async with semaphore:
+            if max_cost_usd is not None and spent >= max_cost_usd:
+                record(index, status=WarmItemStatus.ABORTED.value)
+                return
+            args = {**item["args"], "request_id": f"{job['job_id']}_{index}"}
+            handler = handle_http_proxy
+            if item["kind"] == "llm":
+                handler = handle_llm_proxy_with_fallbacks
+                if max_cost_usd is not None:
+                    left = max_cost_usd - spent
+                    args["max_cost_usd"] = min(args.get("max_cost_usd") or left, left)
+            try:
+                with select_credentials(item.get("credential"), args.get("idempotency_key"), tenant):
+                    result = await handle_with_cache_mode(handler, kind=item["kind"], **args)
+            except Exception as e:
+                logger.exception(f"Cache warm {job['job_id']} item {index} failed: {e}")
+                result = ErrorResponse(
+                    success=False,
+                    error=ErrorDetail(
+                        type="internal_error",
+                        code=ErrorCode.INTERNAL_ERROR.value,
+                        message="Item failed unexpectedly",
+                        retryable=True,
+                        target=item["target"],
+                        status_code=500,
+                        source="reliapi",
+                    ),
+                    meta=MetaResponse(target=item["target"], duration_ms=0, request_id=args["request_id"]),
+                )
+            record_usage(result, item["kind"], tenant, api_key, key_limits if item["kind"] == "llm" else None)
+            cost = 0.0
+            if result.meta.cost_usd and not (result.meta.cache_hit or result.meta.idempotent_hit):
+                cost = result.meta.cost_usd
+            spent += cost
+            if result.meta.cache_hit:
+                status = WarmItemStatus.CACHED
+            else:
+                status = WarmItemStatus.WARMED if result.success else WarmItemStatus.FAILED
+            record(
+                index,
+                status=status.value,
+                cache_key=result.meta.cache_key,
+                cost_usd=round(cost, 6),
+                error=None if result.success else result.error.model_dump(),
+            )
+
+    await asyncio.gather(*(run_item(i, item) for i, item in enumerate(items)))
+    if alert_config:
+        check_budget_alerts(tenant, budget_cap_usd, key_limits, alert_config)
+    done = (WarmItemStatus.WARMED.value, WarmItemStatus.CACHED.value)
+    status = JobStatus.SUCCEEDED if all(item["status"] in done for item in job["items"]) else JobStatus.FAILED
+    return jobs.update(job, status=status.value, completed_at=time.time())
+
+
+def resolve_http_cache_key(
+    target_name: str,
+    method: str,
+    path: str,
+    headers: Optional[Dict[str, str]],
+    query: Optional[Dict[str, Any]],
+    body: Optional[str],
+    targets: Dict[str, Dict],
+    cache_key: Optional[str] = None,
+    cache_vary: Optional[List[str]] = None,
+    body_encoding: str = "utf8",
+    cached_filter: Optional[str] = None,
+    raw_passthrough: bool = False,
+    key_id: Optional[str] = None,
+    tenant: Optional[str] = None,
+) -> Optional[str]:
+    """Return the cache key hash handle_http_proxy uses for a request.
+
+    The request is transformed by the target's transformation rules first;
+    key_id and tenant are their template values.
+
+    Returns None if the target is unknown or the method is not cacheable.
+    """
+    target_config = targets.get(target_name)
+    if not target_config or method.upper() not in ["GET", "HEAD"]:
+        return None
+    transformed = transform_request(
+        target_config.get("transformation"), method, path, headers, body, body_encoding,
+        {"key_id": key_id, "tenant": tenant, "target": target_name},
+    )
+    path, headers, body = transformed.path, transformed.key_headers, transformed.body
+    full_url = f"{target_config['base_url'].rstrip('/')}{path}"
+    body_bytes = _request_body_bytes(body, body_encoding)
+    cache_override = _cache_key_override(
+        scope={"target": target_name, "method": method.upper()},
+        fields={"path": path, "query": query, "headers": headers, "body": body},
+        cache_key=cache_key,
+        cache_vary=cache_vary,
+    )
+    cache_override = _filtered_cache_override(
+        cache_override, cached_filter, method, full_url, headers, body_bytes, query
+    )
+    cache_override = _raw_cache_override(
+        cache_override, raw_passthrough, method, full_url, headers, body_bytes, query
+    )
+    return make_cache_key_hash(method, full_url, headers, body_bytes, query, cache_override)
+
+
+def resolve_llm_cache_key(
+    target_name: str,
+    messages: List[Dict[str, str]],
+    model: Optional[str],
+    max_tokens: Optional[int],
+    temperature: Optional[float],
+    top_p: Optional[float],
+    stop: Optional[List[str]],
+    targets: Dict[str, Dict],
+    cache_key: Optional[str] = None,
+    cache_vary: Optional[List[str]] = None,
+    requested_target: Optional[str] = None,
+    tools: Optional[List[Dict[str, Any]]] = None,
+    tool_choice: Optional[Any] = None,
+    response_format: Optional[Dict[str, Any]] = None,
+    response_format_fallback: str = "error",
+    output_schema: Optional[Dict[str, Any]] = None,
+    legacy: bool = False,
+    cached_filter: Optional[str] = None,
+    raw_passthrough: bool = False,
+    strict: bool = True,
+    logprobs: Optional[bool] = None,
+    top_logprobs: Optional[int] = None,
+) -> Optional[str]:
+    """Return the cache key hash handle_llm_proxy uses for a request, or
+    with legacy the one it used before canonical keys.
+
+    Returns None if the target is unknown or not an LLM target, or its
+    provider or model can't take the request, which is then never cached.
+    """
+    target_config = targets.get(target_name)
+    if not target_config or not target_config.get("llm"):
+        return None
+    messages, redaction_digest, _ = _redact_prompt(messages, target_config)
+    try:
+        plan = _plan_llm_request(
+            target_name, target_config, messages, model, max_tokens, temperature, top_p, stop,
+            requested_target=requested_target, cache_key=cache_key, cache_vary=cache_vary,
+            tools=tools, tool_choice=tool_choice, response_format=response_format,
+            response_format_fallback=response_format_fallback, output_schema=output_schema, redaction_digest=redaction_digest, cached_filter=cached_filter,
+            raw_passthrough=raw_passthrough, strict=strict, logprobs=logprobs, top_logprobs=top_logprobs,
+        )
+    except TranslationError:
+        return None
+    return plan.legacy_cache_key if legacy else plan.cache_key
+
+
+# Background refreshes started by stale_while_revalidate. Held here so the
+# tasks are not garbage-collected before they finish.
+_background_refreshes: Set["asyncio.Task[None]"] = set()
+
+
+async def handle_with_cache_mode(
+    handler: Callable[..., Awaitable[Union[SuccessResponse, ErrorResponse]]],
+    kind: str,
+    cache_mode: str = CacheMode.STANDARD.value,
+    **kwargs: Any,
+) -> Union[SuccessResponse, ErrorResponse]:
+    """Run a proxy handler under a stale cache mode.
+
+    handler is handle_http_proxy (kind "http") or handle_llm_proxy_with_fallbacks
+    (kind "llm"), called with kwargs. In the stale modes cache writes are kept
+    stale_ttl_s past their TTL, and:
+
+    - stale_while_revalidate serves an expired entry immediately and refreshes
+      it in the background. A Redis lock makes sure only one refresh per entry
+      runs at a time, however many clients hit it.
+    - stale_if_error calls the upstream and serves the expired entry only if
+      the call fails with a retryable error (429, 5xx) after retries, with the
+      error in meta.revalidation_error.
+
+    only_if_cached serves a fresh entry from the cache directly and fails
+    every other request with CACHE_MISS, so that the upstream is never
+    called. Otherwise standard mode, uncacheable requests, cache misses and
+    fresh hits go straight to handler.
+    """
+    if cache_mode == CacheMode.STANDARD.value or kwargs.get("dry_run"):
+        return await handler(**kwargs)
+
+    target_name = kwargs["target_name"]
+    targets: Dict[str, Dict] = kwargs["targets"]
+    cache: Cache = kwargs["cache"]
+    tenant = kwargs.get("tenant")
+    request_id = kwargs["request_id"]
+    start_time = time.time()
+    only_if_cached = cache_mode == CacheMode.ONLY_IF_CACHED.value
+
+    async def miss() -> Union[SuccessResponse, ErrorResponse]:
+        if not only_if_cached:
+            return await handler(**kwargs)
+        return ErrorResponse(
+            success=False,
+            error=ErrorDetail(
+                type="client_error",
+                code=ErrorCode.CACHE_MISS.value,
+                message="No fresh cache entry for the request and cache_mode is only_if_cached",
+                retryable=False,
                 target=target_name,
-                status_code=502,
+                status_code=404,
+                source="reliapi",
             ),
             meta=MetaResponse(
                 target=target_name,
-                provider=provider,
-                model=final_model,
-                cache_hit=False,
-                idempotent_hit=False,
-                retries=retries,
-                duration_ms=duration_ms,
+                duration_ms=int((time.time() - start_time) * 1000),
                 request_id=request_id,
-                trace_id=None,
             ),
         )
-        
-    except Exception as e:
-        if idempotency_key:
-            idempotency.clear_in_progress(idempotency_key, tenant=tenant)
-        
-        duration_ms = int((time.time() - start_time) * 1000)
-        error_code = ErrorCode.INTERNAL_ERROR
-        upstream_status_norm = UpstreamStatus.INTERNAL_SERVER_ERROR.value
-        _log_and_metric_llm_request(
-            request_id=request_id,
+
+    target_config = targets.get(target_name) or {}
+    cache_config = target_config.get("cache", {})
+    if not cache_config.get("enabled", True):
+        return await miss()
+
+    if kind == "http":
+        cache_key_hash = resolve_http_cache_key(
             target_name=target_name,
-            provider=provider,
-            model=final_model,
-            stream=False,
-            outcome="error",
-            latency_ms=duration_ms,
-            cache_hit=False,
-            idempotent_hit=False,
-            error_code=error_code.value,
-            upstream_status=500,  # Actual status for logs
+            method=kwargs["method"],
+            path=kwargs["path"],
+            headers=kwargs.get("headers"),
+            query=kwargs.get("query"),
+            body=kwargs.get("body"),
+            targets=targets,
+            cache_key=kwargs.get("cache_key"),
+            cache_vary=kwargs.get("cache_vary"),
+            body_encoding=kwargs.get("body_encoding", "utf8"),
+            cached_filter=kwargs.get("cached_filter"),
+            raw_passthrough=kwargs.get("raw_passthrough", False),
+            key_id=kwargs.get("key_id"),
             tenant=tenant,
         )
-        # Legacy metrics
-        llm_requests_total.labels(target=target_name, provider=provider, status="error").inc()
-        errors_total.labels(
-            target=target_name,
-            kind="llm",
-            error_code=error_code.value,
-            upstream_status=upstream_status_norm,
-        ).inc()
-        latency_ms.labels(target=target_name, status="error").observe(duration_ms)
-        return ErrorResponse(
-            success=False,
-            error=ErrorDetail(
-                type="internal_error",
-                code=error_code.value,
-                message=f"Internal error: {str(e)}",
-                retryable=True,
-                target=target_name,
-                status_code=500,
-            ),
+        legacy_key_hash = None
+        meta_fields: Dict[str, Any] = {"target": target_name}
+    elif target_config.get("llm"):
+        # Entries are keyed by the trimmed prompt; one that can't fit is
+        # rejected by the handler
+        model = kwargs.get("model") or target_config["llm"].get("default_model", "gpt-4")
+        try:
+            messages, _ = _trim_context(kwargs["messages"], model, kwargs.get("context_policy"))
+        except ContextTooLongError:
+            return await miss()
+        messages, redaction_digest, _ = _redact_prompt(messages, target_config)
+        try:
+            plan = _plan_llm_request(
+                target_name,
+                target_config,
+                messages,
+                kwargs.get("model"),
+                kwargs.get("max_tokens"),
+                kwargs.get("temperature"),
+                kwargs.get("top_p"),
+                kwargs.get("stop"),
+                requested_target=kwargs.get("requested_target"),
+                cache_key=kwargs.get("cache_key"),
+                cache_vary=kwargs.get("cache_vary"),
+                tools=kwargs.get("tools"),
+                tool_choice=kwargs.get("tool_choice"),
+                response_format=kwargs.get("response_format"),
+                response_format_fallback=kwargs.get("response_format_fallback", "error"),
+                output_schema=kwargs.get("output_schema"),
+                redaction_digest=redaction_digest,
+                cached_filter=kwargs.get("cached_filter"),
+                raw_passthrough=kwargs.get("raw_passthrough", False),
+                strict=kwargs.get("strict", True),
+                logprobs=kwargs.get("logprobs"),
+                top_logprobs=kwargs.get("top_logprobs"),
+            )
+        except TranslationError:
+            # Rejected by the handler, like a prompt that can't fit
+            return await miss()
+        cache_key_hash, legacy_key_hash = plan.cache_key, plan.legacy_cache_key
+        meta_fields = {
+            "target": target_name,
+            "provider": plan.provider,
+            "model": plan.model,
+            "served_by": target_name,
+            "adjustments": plan.adjustments or None,
+        }
+    else:
+        cache_key_hash = legacy_key_hash = None
+    if not cache_key_hash:
+        return await miss()
+
+    if not only_if_cached:
+        kwargs["stale_ttl_s"] = cache_config.get("stale_ttl_s", 86400)
+    entry = cache.get_entry(cache_key_hash, tenant=tenant, legacy_key_hash=legacy_key_hash)
+    if entry is None:
+        return await miss()
+
+    def cached_response(revalidation_error: Optional[ErrorDetail] = None) -> SuccessResponse:
+        cached = entry["value"]
+        encoding_fields: Dict[str, Any] = {}
+        if kind == "http":
+            data = _http_cached_data(cached)
+            _record_response_transform(cached)
+            if_none_match = kwargs.get("if_none_match")
+            if if_none_match and _etag_matches(if_none_match, _header(data["headers"], "etag")):
+                data = {}
+                encoding_fields.update(_not_modified_meta(cached, kwargs.get("response_headers")))
+            else:
+                encoding_fields["response_encoding"] = _response_encoding(data)
+                encoding_fields.update(_upstream_meta(cached, kwargs.get("response_headers")))
+        else:
+            data = cached.get("body", {})
+        cache_hits_total.labels(target=target_name, kind=kind, tenant=tenant or "default").inc()
+        return SuccessResponse(
+            success=True,
+            data=data,
             meta=MetaResponse(
-                target=target_name,
-                provider=provider,
-                model=final_model,
-                cache_hit=False,
-                retries=retries,
-                duration_ms=duration_ms,
+                **meta_fields,
+                **encoding_fields,
+                cache_key=cache_key_hash,
+                cache_hit=True,
+                stale=entry["stale"],
+                cache_age_s=entry["age_s"],
+                revalidation_error=revalidation_error,
+                retries=0,
+                duration_ms=int((time.time() - start_time) * 1000),
                 request_id=request_id,
-                trace_id=None,
+                cost_usd=cached.get("cost_usd"),
             ),
         )
-        
+
+    if only_if_cached:
+        return await miss() if entry["stale"] else cached_response()
+    # Fresh entries are served by the handler's own cache lookup
+    if not entry["stale"]:
+        return await handler(**kwargs)
+
+    if cache_mode == CacheMode.STALE_WHILE_REVALIDATE.value:
+        if cache.acquire_refresh_lock(cache_key_hash, tenant=tenant):
+            task = asyncio.create_task(
+                _refresh_stale_entry(handler, cache_key_hash, dict(kwargs))
+            )
+            _background_refreshes.add(task)
+            task.add_done_callback(_background_refreshes.discard)
+        return cached_response()
+
+    # stale_if_error: a stale entry also beats a static fallback_response
+    result = await handler(**kwargs)
+    if result.success and result.meta.fallback_served:
+        error = result.meta.upstream_error
+    elif _is_fallback_eligible(result):
+        error = result.error
+    else:
+        return result
+    logger.warning(
+        f"Serving stale cache entry after upstream failure: target={target_name}, "
+        f"code={error.code}, request_id={request_id}"
+    )
+    return cached_response(revalidation_error=error)
+
+
+async def _refresh_stale_entry(
+    handler: Callable[..., Awaitable[Union[SuccessResponse, ErrorResponse]]],
+    cache_key_hash: str,
+    kwargs: Dict[str, Any],
+) -> None:
+    """Re-run a request whose stale entry was served, rewriting the entry."""
+    cache: Cache = kwargs["cache"]
+    tenant = kwargs.get("tenant")
+    # A refresh is a new upstream call, not a replay of the client's request
+    kwargs["idempotency_key"] = None
+    kwargs["request_id"] = f"{kwargs['request_id']}_refresh"
+    try:
+        result = await handler(**kwargs)
+        if not result.success:
+            logger.warning(
+                f"Background cache refresh failed: target={kwargs['target_name']}, "
+                f"code={result.error.code}, request_id={kwargs['request_id']}"
+            )
+    except Exception as e:
+        logger.warning(f"Background cache refresh error: {e}", exc_info=True)
     finally:
-        await client.close()
+        cache.release_refresh_lock(cache_key_hash, tenant=tenant)
+
+
+def _sse_chunk_event(index: int, delta: str, logprobs: Optional[List[Dict[str, Any]]] = None) -> str:
+    """Format a content chunk as an SSE event, with the logprobs of its
+    tokens when the request asked for them.
+
+    The index is sent both as the SSE id and in the payload so clients can
+    drop chunks duplicated, and reorder chunks shuffled, by intermediaries.
+    """
+    data: Dict[str, Any] = {"index": index, "delta": delta, "finish_reason": None}
+    if logprobs:
+        data["logprobs"] = logprobs
+    payload = json.dumps(data)
+    return f"id: {index}\nevent: chunk\ndata: {payload}\n\n"
+
+
+def _usage_counts(usage: Dict[str, Any]) -> Dict[str, int]:
+    """The token counts a provider usage frame reports."""
+    return {name: usage[name] for name in ("prompt_tokens", "completion_tokens") if usage.get(name) is not None}
+
+
+def _stream_usage(
+    adapter: Any,
+    model: str,
+    messages: List[Dict[str, Any]],
+    content: str,
+    reported: Dict[str, int],
+) -> Dict[str, Any]:
+    """Usage and cost of a stream, from the counts its usage frames reported.
+
+    Counts the provider didn't report, all of them when it sent no usage
+    frame and the completion of a stream abandoned before its last frame,
+    are estimated from messages and the content streamed, and
+    cost_estimated is set.
+    """
+    prompt_tokens = reported.get("prompt_tokens")
+    completion_tokens = reported.get("completion_tokens")
+    estimated = prompt_tokens is None or completion_tokens is None
+    if prompt_tokens is None:
+        prompt_tokens = CostEstimator.count_tokens(messages, model)
+    if completion_tokens is None:
+        completion_tokens = CostEstimator.count_text_tokens(content, model)
+    return {
+        "usage": {
+            "prompt_tokens": prompt_tokens,
+            "completion_tokens": completion_tokens,
+            "total_tokens": prompt_tokens + completion_tokens,
+        },
+        "cost_usd": adapter.get_cost_usd(model, prompt_tokens, completion_tokens),
+        "cost_estimated": estimated,
+    }
+
+
+_REPLAY_TOKEN = re.compile(r"\s*\S+")
+
+
+def _replay_chunks(content: str, chunk_tokens: int) -> List[str]:
+    """Split a cached completion into deltas of chunk_tokens tokens each.
+
+    Tokens are approximated by words with their leading whitespace, so the
+    deltas join back to content. chunk_tokens of 0 keeps it in one delta.
+    """
+    if chunk_tokens <= 0 or not content:
+        return [content] if content else []
+    words = _REPLAY_TOKEN.findall(content)
+    trailing = content[sum(len(w) for w in words):]
+    chunks = ["".join(words[i:i + chunk_tokens]) for i in range(0, len(words), chunk_tokens)]
+    if trailing:
+        chunks[-1:] = [(chunks[-1] if chunks else "") + trailing]
+    return chunks
+
+
+async def _replay_cached_stream(
+    cached: Dict[str, Any], meta_data: Dict[str, Any], cache_config: Dict[str, Any]
+) -> AsyncIterator[str]:
+    """Send a cached completion as the events of a live stream.
+
+    The entry may have been written by a streamed or a plain request. The
+    deltas follow cache.stream_replay_chunk_tokens with
+    cache.stream_replay_delay_ms between them, so UIs render a replay like
+    a live answer; the done event reports cache_hit and costs nothing.
+    The entry's logprobs, which don't split along the deltas, come with
+    the last one.
+    """
+    body = cached.get("body", {})
+    yield f"event: meta\ndata: {json.dumps(meta_data)}\n\n"
+    delay_s = cache_config.get("stream_replay_delay_ms", 0) / 1000.0
+    chunks = _replay_chunks(body.get("content") or "", cache_config.get("stream_replay_chunk_tokens", 0))
+    for index, delta in enumerate(chunks):
+        if index and delay_s:
+            await asyncio.sleep(delay_s)
+        yield _sse_chunk_event(index, delta, body.get("logprobs") if index == len(chunks) - 1 else None)
+    done_data = {
+        "finish_reason": body.get("finish_reason") or "stop",
+        "usage": body.get("usage", {}),
+        "cost_usd": 0.0,
+        "cache_hit": True,
+    }
+    yield f"event: done\ndata: {json.dumps(done_data)}\n\n"
 
 
 async def handle_llm_stream_generator(
@@ -1972,12 +7163,55 @@ async def handle_llm_stream_generator(
     cache: Cache,
     idempotency: IdempotencyManager,
     request_id: str,
+    tenant: Optional[str] = None,
+    tier: str = "free",
+    max_cost_usd: Optional[float] = None,
+    budget_cap_usd: Optional[float] = None,
+    key_limits: Optional[KeyLimits] = None,
+    timeout_ms: Optional[int] = None,
+    context_policy: Optional[Dict[str, Any]] = None,
+    idempotency_ttl_s: Optional[int] = None,
+    priority: str = "default",
+    queue_timeout_ms: Optional[int] = None,
+    max_wait_ms: Optional[int] = None,
+    alias: Optional[str] = None,
+    routed_to: Optional[str] = None,
+    template_name: Optional[str] = None,
+    template_version: Optional[int] = None,
+    api_key: Optional[str] = None,
+    tags: Optional[Dict[str, str]] = None,
+    strict: bool = True,
+    logprobs: Optional[bool] = None,
+    top_logprobs: Optional[int] = None,
 ) -> AsyncIterator[str]:
-    """Handle LLM streaming request - yields SSE events."""
+    """Handle LLM streaming request - yields SSE events.
+
+    Budget checks, context_policy, the target's queue and max_concurrency
+    match handle_llm_proxy; a rejection is an error event, and the trim and
+    waits are reported in the meta event. The slot is held until the
+    stream ends. alias names the model alias the route resolved target_name
+    and model from, reported as resolved_target and resolved_model,
+    routed_to the candidate a latency route picked, and template_name and
+    template_version the prompt template the route rendered the messages
+    from.
+    A cached completion, written by a streamed or a plain request, is
+    replayed without queueing (see _replay_cached_stream); a completed
+    stream is cached under the key a plain request would use.
+    The done event's usage and cost_usd come from the provider's usage
+    frames, estimated where it sent none (see _stream_usage). A stream the
+    client abandons is charged for what was generated so far, against
+    api_key and tags in the usage report.
+    timeout_ms replaces the target's timeout_ms as the longest wait for the
+    upstream's next chunk; when it passes before the first one, the error
+    event is UPSTREAM_TIMEOUT. With logprobs each chunk event carries the
+    logprobs of its tokens, as OpenAI streams them.
+    """
     import json
     
     start_time = time.time()
     stream_started = False
+    limiter = None
+    budget_holds = BudgetHolds()
     
     try:
         # Get target config
@@ -2001,6 +7235,25 @@ async def handle_llm_stream_generator(
             }
             yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
             return
+        timeout_rejection = _timeout_rejection(target_config, target_name, timeout_ms, request_id, start_time)
+        if timeout_rejection:
+            error_data = {
+                "code": timeout_rejection.error.code,
+                "message": timeout_rejection.error.message,
+                "upstream_status": 400,
+            }
+            yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
+            return
+
+        ttl_rejection = _idempotency_ttl_rejection(target_config, target_name, idempotency_ttl_s, request_id, start_time)
+        if ttl_rejection:
+            error_data = {
+                "code": ttl_rejection.error.code,
+                "message": ttl_rejection.error.message,
+                "upstream_status": 400,
+            }
+            yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
+            return
         
         # Apply config limits
         final_model = model or llm_config.get("default_model", "gpt-4")
@@ -2103,6 +7356,18 @@ async def handle_llm_stream_generator(
             )
             return
         
+        try:
+            messages, trim_fields = _trim_context(messages, final_model, context_policy)
+        except ContextTooLongError as e:
+            error_data = {
+                "code": ErrorCode.CONTEXT_LENGTH_EXCEEDED.value,
+                "message": str(e),
+                "upstream_status": 400,
+            }
+            yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
+            return
+        messages, redaction_digest, redaction_fields = _redact_prompt(messages, target_config)
+        
         # Budget control: estimate cost and check caps
         cost_estimate_usd = None
         cost_policy_applied = "none"
@@ -2141,6 +7406,8 @@ async def handle_llm_stream_generator(
                 "details": {
                     "cost_estimate_usd": cost_estimate_usd,
                     "hard_cost_cap_usd": hard_cost_cap,
+                    "model": final_model,
+                    "max_tokens": final_max_tokens,
                 },
             }
             yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
@@ -2160,6 +7427,111 @@ async def handle_llm_stream_generator(
             cost_estimate_usd = CostEstimator.estimate_from_messages(
                 provider, final_model, messages, final_max_tokens
             )
+
+        # Held until the stream ends and its cost is recorded
+        rejection = _budget_rejection(
+            cost_estimate_usd, max_cost_usd, budget_cap_usd, tenant, key_limits, budget_holds
+        )
+        if rejection:
+            policy, message, details = rejection
+            error_code = _budget_error_code(policy)
+            duration_ms = int((time.time() - start_time) * 1000)
+            budget_events_total.labels(target=target_name, event=policy, tenant=tenant or "default").inc()
+            _log_and_metric_llm_request(
+                request_id=request_id,
+                target_name=target_name,
+                provider=provider,
+                model=final_model,
+                stream=True,
+                outcome="error",
+                latency_ms=duration_ms,
+                cache_hit=False,
+                idempotent_hit=False,
+                error_code=error_code.value,
+                upstream_status=400,
+                tenant=tenant,
+            )
+            error_data = {
+                "code": error_code.value,
+                "message": message,
+                "upstream_status": 400,
+                "details": {**details, "model": final_model, "max_tokens": final_max_tokens},
+            }
+            yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
+            return
+
+        meta_data = {
+            "target": target_name,
+            "provider": provider,
+            "model": final_model,
+            "request_id": request_id,
+            "cost_estimate_usd": cost_estimate_usd,
+            "cost_policy_applied": cost_policy_applied,
+            "max_tokens_reduced": max_tokens_reduced if max_tokens_reduced else None,
+            "original_max_tokens": original_max_tokens if max_tokens_reduced else None,
+            "target_version": target_config.get("version"),
+            **trim_fields,
+            **redaction_fields,
+        }
+        if alias:
+            meta_data.update(resolved_target=target_name, resolved_model=final_model)
+        if routed_to:
+            meta_data["routed_to"] = routed_to
+        if template_name:
+            meta_data.update(template_name=template_name, template_version=template_version)
+
+        # Entries are keyed like those of handle_llm_proxy, so streamed and
+        # plain requests are served from each other's completions
+        try:
+            plan = _plan_llm_request(
+                target_name, target_config, messages, model, max_tokens, temperature, top_p, stop,
+                redaction_digest=redaction_digest, strict=strict, logprobs=logprobs, top_logprobs=top_logprobs,
+            )
+        except TranslationError as e:
+            error = _translation_error(e, target_name, provider, final_model, request_id, start_time).error
+            error_data = {
+                "code": error.code,
+                "message": error.message,
+                "field": e.field,
+                "upstream_status": 400,
+            }
+            if isinstance(e, ModelLimitsError):
+                error_data["details"] = error.details
+            yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
+            return
+        # Unless strict, fitted to the model
+        if plan.adjustments:
+            final_max_tokens, final_temperature, top_p, stop = plan.max_tokens, plan.temperature, plan.top_p, plan.stop
+            meta_data["adjustments"] = plan.adjustments
+        if plan.deployment:
+            meta_data["deployment"] = plan.deployment
+        cache_config = target_config.get("cache", {})
+        if cache_config.get("enabled", True):
+            cached = cache.get(
+                "POST", base_url + plan.api_path, None, None, None, allow_post=True, tenant=tenant,
+                cache_key_hash=plan.cache_key, legacy_key_hash=plan.legacy_cache_key,
+            )
+            if cached:
+                async for event in _replay_cached_stream(cached, {**meta_data, "cache_key": plan.cache_key}, cache_config):
+                    yield event
+                duration_ms = int((time.time() - start_time) * 1000)
+                _log_and_metric_llm_request(
+                    request_id=request_id,
+                    target_name=target_name,
+                    provider=provider,
+                    model=final_model,
+                    stream=True,
+                    outcome="success",
+                    latency_ms=duration_ms,
+                    cache_hit=True,
+                    idempotent_hit=False,
+                    cost_usd=0.0,
+                    tenant=tenant,
+                )
+                cache_hits_total.labels(target=target_name, kind="llm", tenant=tenant or "default").inc()
+                llm_requests_total.labels(target=target_name, provider=provider, status="success").inc()
+                latency_ms.labels(target=target_name, status="success").observe(duration_ms)
+                return
         
         # Handle idempotency for streaming (MVP: simple check)
         if idempotency_key:
@@ -2171,7 +7543,8 @@ async def handle_llm_stream_generator(
             }, sort_keys=True).encode()
             
             is_new, existing_id, existing_hash = idempotency.register_request(
-                idempotency_key, "POST", full_url, None, cache_key_bytes, request_id, tenant=tenant
+                idempotency_key, "POST", full_url, None, cache_key_bytes, request_id, tenant=tenant,
+                ttl_s=_idempotency_ttl(target_config, idempotency_ttl_s, cache_ttl),
             )
             
             if not is_new:
@@ -2210,18 +7583,47 @@ async def handle_llm_stream_generator(
                     return
             
             idempotency.mark_in_progress(idempotency_key, tenant=tenant)
+
+        queue_fields: Dict[str, Any] = {}
+        queue_config = target_config.get("queue")
+        queue = _target_queues.get(target_name, queue_config)
+        if queue:
+            wait_ms = queue_timeout_ms or queue_config.get("timeout_ms", DEFAULT_QUEUE_TIMEOUT_MS)
+            try:
+                waited_s = await queue.admit(priority, wait_ms / 1000.0)
+            except QueueFullError as e:
+                if idempotency_key:
+                    idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+                error_data = {
+                    "code": ErrorCode.QUEUE_FULL.value,
+                    "message": str(e),
+                    "upstream_status": 429,
+                    "retry_after_s": e.retry_after_s,
+                }
+                yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
+                return
+            queue_fields["queue_wait_ms"] = int(waited_s * 1000)
+
+        slot_limiter = _target_concurrency.get(target_name, target_config.get("max_concurrency"))
+        wait_ms = max_wait_ms or target_config.get("concurrency_wait_ms", DEFAULT_CONCURRENCY_WAIT_MS)
+        try:
+            waited_s = await slot_limiter.acquire(wait_ms / 1000.0)
+        except ConcurrencyLimitError as e:
+            if idempotency_key:
+                idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+            error_data = {
+                "code": ErrorCode.CONCURRENCY_LIMIT.value,
+                "message": str(e),
+                "upstream_status": 429,
+            }
+            yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
+            return
+        limiter = slot_limiter
+        if limiter.limit:
+            queue_fields["concurrency_wait_ms"] = int(waited_s * 1000)
         
         # Send meta event
-        meta_data = {
-            "target": target_name,
-            "provider": provider,
-            "model": final_model,
-            "request_id": request_id,
-            "cost_estimate_usd": cost_estimate_usd,
-            "cost_policy_applied": cost_policy_applied,
-            "max_tokens_reduced": max_tokens_reduced if max_tokens_reduced else None,
-            "original_max_tokens": original_max_tokens if max_tokens_reduced else None,
-        }
+        meta_data.update(queue_fields)
         yield f"event: meta\ndata: {json.dumps(meta_data)}\n\n"
         
         # Prepare request payload
@@ -2233,17 +7635,12 @@ async def handle_llm_stream_generator(
             top_p=top_p,
             stop=stop,
             stream=True,
+            logprobs=logprobs,
+            top_logprobs=top_logprobs,
         )
         
         # Determine API endpoint
-        if provider == "openai":
-            api_path = "/chat/completions"
-        elif provider == "anthropic":
-            api_path = "/messages"
-        elif provider == "mistral":
-            api_path = "/chat/completions"
-        else:
-            api_path = "/chat/completions"
+        api_path = _llm_api_path(provider, final_model, llm_config)
         
         # Create HTTP client with auth
         auth_config = target_config.get("auth", {})
@@ -2254,40 +7651,47 @@ async def handle_llm_stream_generator(
             if env_var:
                 api_key = os.getenv(env_var)
                 if api_key:
-                    headers["Authorization"] = f"Bearer {api_key}"
+                    header, prefix = _auth_header(target_config, auth_config)
+                    headers[header] = f"{prefix}{api_key}"
+        if target_config.get("forward_trace_context"):
+            headers.update(trace_headers())
         
         # Create httpx client for streaming
-        timeout_s = target_config.get("timeout_ms", 20000) / 1000.0
+        timeout_s = (timeout_ms or target_config.get("timeout_ms", 20000)) / 1000.0
         async with httpx.AsyncClient(timeout=timeout_s) as client:
             try:
                 # Stream from provider
                 accumulated_content = ""
+                accumulated_logprobs: List[Dict[str, Any]] = []
+                chunk_index = 0
                 finish_reason = None
-                prompt_tokens = 0
-                completion_tokens = 0
+                # Counts from the provider's usage frames
+                reported_usage: Dict[str, int] = {}
                 
                 async for chunk in adapter.stream_chat(
                     client, base_url, api_path, payload, headers
                 ):
                     stream_started = True
                     
-                    # Parse OpenAI chunk format
-                    if provider == "openai":
+                    # Parse OpenAI chunk format, Azure OpenAI's as well
+                    if provider in ("openai", "azure_openai"):
                         # Check if this is a usage-only chunk (sent after [DONE])
                         if chunk.get("_usage_only"):
                             usage = chunk.get("usage", {})
                             if usage:
-                                prompt_tokens = usage.get("prompt_tokens", 0)
-                                completion_tokens = usage.get("completion_tokens", 0)
+                                reported_usage.update(_usage_counts(usage))
                             continue
                         
                         choices = chunk.get("choices", [])
                         if choices:
                             delta = choices[0].get("delta", {})
                             content_delta = delta.get("content", "")
+                            chunk_logprobs = normalize_logprobs(choices[0].get("logprobs"))
                             if content_delta:
                                 accumulated_content += content_delta
-                                yield f"event: chunk\ndata: {json.dumps({'delta': content_delta, 'finish_reason': None})}\n\n"
+                                accumulated_logprobs += chunk_logprobs
+                                yield _sse_chunk_event(chunk_index, content_delta, chunk_logprobs)
+                                chunk_index += 1
                             
                             # Check for finish reason
                             if choices[0].get("finish_reason"):
@@ -2296,8 +7700,7 @@ async def handle_llm_stream_generator(
                         # Get usage if available in regular chunk (some providers include it)
                         usage = chunk.get("usage", {})
                         if usage:
-                            prompt_tokens = usage.get("prompt_tokens", 0)
-                            completion_tokens = usage.get("completion_tokens", 0)
+                            reported_usage.update(_usage_counts(usage))
                     
                     # Parse Anthropic chunk format
                     elif provider == "anthropic":
@@ -2305,8 +7708,7 @@ async def handle_llm_stream_generator(
                         if chunk.get("_usage_only"):
                             usage = chunk.get("usage", {})
                             if usage:
-                                prompt_tokens = usage.get("prompt_tokens", 0)
-                                completion_tokens = usage.get("completion_tokens", 0)
+                                reported_usage.update(_usage_counts(usage))
                             continue
                         
                         choices = chunk.get("choices", [])
@@ -2315,7 +7717,8 @@ async def handle_llm_stream_generator(
                             content_delta = delta.get("content", "")
                             if content_delta:
                                 accumulated_content += content_delta
-                                yield f"event: chunk\ndata: {json.dumps({'delta': content_delta, 'finish_reason': None})}\n\n"
+                                yield _sse_chunk_event(chunk_index, content_delta)
+                                chunk_index += 1
                             
                             # Check for finish reason
                             if choices[0].get("finish_reason"):
@@ -2324,8 +7727,7 @@ async def handle_llm_stream_generator(
                         # Get usage if available
                         usage = chunk.get("usage", {})
                         if usage:
-                            prompt_tokens = usage.get("prompt_tokens", 0)
-                            completion_tokens = usage.get("completion_tokens", 0)
+                            reported_usage.update(_usage_counts(usage))
                     
                     # Parse Mistral chunk format (similar to OpenAI)
                     elif provider == "mistral":
@@ -2333,8 +7735,7 @@ async def handle_llm_stream_generator(
                         if chunk.get("_usage_only"):
                             usage = chunk.get("usage", {})
                             if usage:
-                                prompt_tokens = usage.get("prompt_tokens", 0)
-                                completion_tokens = usage.get("completion_tokens", 0)
+                                reported_usage.update(_usage_counts(usage))
                             continue
                         
                         choices = chunk.get("choices", [])
@@ -2343,7 +7744,8 @@ async def handle_llm_stream_generator(
                             content_delta = delta.get("content", "")
                             if content_delta:
                                 accumulated_content += content_delta
-                                yield f"event: chunk\ndata: {json.dumps({'delta': content_delta, 'finish_reason': None})}\n\n"
+                                yield _sse_chunk_event(chunk_index, content_delta)
+                                chunk_index += 1
                             
                             # Check for finish reason
                             if choices[0].get("finish_reason"):
@@ -2352,36 +7754,29 @@ async def handle_llm_stream_generator(
                         # Get usage if available
                         usage = chunk.get("usage", {})
                         if usage:
-                            prompt_tokens = usage.get("prompt_tokens", 0)
-                            completion_tokens = usage.get("completion_tokens", 0)
+                            reported_usage.update(_usage_counts(usage))
                 
                 # Calculate final cost
-                cost_usd = adapter.get_cost_usd(final_model, prompt_tokens, completion_tokens)
-                
-                # Send done event
-                done_data = {
-                    "finish_reason": finish_reason or "stop",
-                    "usage": {
-                        "prompt_tokens": prompt_tokens,
-                        "completion_tokens": completion_tokens,
-                        "total_tokens": prompt_tokens + completion_tokens,
-                    },
-                    "cost_usd": cost_usd,
-                }
-                yield f"event: done\ndata: {json.dumps(done_data)}\n\n"
+                stream_usage = _stream_usage(adapter, final_model, messages, accumulated_content, reported_usage)
+                cost_usd = stream_usage["cost_usd"]
+                budget_holds.cost_usd = cost_usd
                 
-                # Store in cache and idempotency (final completion only)
-                cache_config = target_config.get("cache", {})
+                # Store in cache (final completion only), in the shape of a
+                # plain request's response data, so the done event can tell
+                # whether it was admitted
+                cache_stored = None
                 if cache_config.get("enabled", True):
                     ttl = cache_ttl or cache_config.get("ttl_s", 3600)
                     result_data = {
                         "content": accumulated_content,
                         "role": "assistant",
                         "finish_reason": finish_reason or "stop",
-                        "usage": done_data["usage"],
+                        "usage": stream_usage["usage"],
                     }
-                    cache.set(
-                        "POST", base_url + api_path, None, json.dumps(payload, sort_keys=True).encode(),
+                    if accumulated_logprobs:
+                        result_data["logprobs"] = accumulated_logprobs
+                    cache_stored = cache.set(
+                        "POST", base_url + plan.api_path, None, None,
                         {
                             "body": result_data,
                             "cost_usd": cost_usd,
@@ -2390,19 +7785,34 @@ async def handle_llm_stream_generator(
                         query=None,
                         allow_post=True,
                         tenant=tenant,
+                        cache_key_hash=plan.cache_key,
+                        target=target_name,
+                        max_entries=cache_config.get("max_entries"),
                     )
+
+                # Send done event
+                done_data = {
+                    "finish_reason": finish_reason or "stop",
+                    **stream_usage,
+                    "cache_hit": False,
+                    "cache_stored": cache_stored,
+                }
+                yield f"event: done\ndata: {json.dumps(done_data)}\n\n"
                 
                 if idempotency_key:
-                    idempotency_ttl = cache_ttl or cache_config.get("ttl_s", 3600) if cache_config.get("enabled", True) else 3600
+                    idempotency_ttl = _idempotency_ttl(target_config, idempotency_ttl_s, cache_ttl)
+                    stored_data = {
+                        "content": accumulated_content,
+                        "role": "assistant",
+                        "finish_reason": finish_reason or "stop",
+                        "usage": done_data["usage"],
+                    }
+                    if accumulated_logprobs:
+                        stored_data["logprobs"] = accumulated_logprobs
                     idempotency.store_result(
                         idempotency_key,
                         {
-                            "data": {
-                                "content": accumulated_content,
-                                "role": "assistant",
-                                "finish_reason": finish_reason or "stop",
-                                "usage": done_data["usage"],
-                            },
+                            "data": stored_data,
                             "cost_usd": cost_usd,
                         },
                         ttl_s=idempotency_ttl,
@@ -2490,6 +7900,16 @@ async def handle_llm_stream_generator(
                         "upstream_status": 502,
                     }
                     yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
+                elif timeout_ms and isinstance(e, httpx.TimeoutException):
+                    error_code_enum = ErrorCode.UPSTREAM_TIMEOUT
+                    upstream_status_norm = UpstreamStatus.GATEWAY_TIMEOUT.value
+                    error_data = {
+                        "code": error_code_enum.value,
+                        "message": f"Upstream did not answer within {timeout_ms} ms",
+                        "upstream_status": 504,
+                        "details": {"timeout_ms": timeout_ms, "attempts_completed": 0},
+                    }
+                    yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
                 else:
                     error_code_enum = ErrorCode.NETWORK_ERROR
                     upstream_status_norm = UpstreamStatus.BAD_GATEWAY.value
@@ -2565,6 +7985,32 @@ async def handle_llm_stream_generator(
                     upstream_status=upstream_status_norm,
                 ).inc()
                 latency_ms.labels(target=target_name, status="error").observe(duration_ms)
+
+            except (GeneratorExit, asyncio.CancelledError):
+                # The client went away mid-stream: charge what was generated
+                # up to here, as no done event will carry it
+                stream_usage = _stream_usage(adapter, final_model, messages, accumulated_content, reported_usage)
+                budget_holds.cost_usd = stream_usage["cost_usd"]
+                if idempotency_key:
+                    idempotency.clear_in_progress(idempotency_key, tenant=tenant)
+                _log_and_metric_llm_request(
+                    request_id=request_id,
+                    target_name=target_name,
+                    provider=provider,
+                    model=final_model,
+                    stream=True,
+                    outcome="aborted",
+                    latency_ms=int((time.time() - start_time) * 1000),
+                    cache_hit=False,
+                    idempotent_hit=False,
+                    cost_usd=stream_usage["cost_usd"],
+                    tenant=tenant,
+                )
+                _record_stream_usage(
+                    {**stream_usage, "aborted": True}, target_name, final_model, tenant, api_key, key_limits,
+                    tags=tags,
+                )
+                raise
     
     except Exception as e:
         # Catch-all for any errors before stream starts
@@ -2576,3 +8022,7 @@ async def handle_llm_stream_generator(
             "upstream_status": 500,
         }
         yield f"event: error\ndata: {json.dumps(error_data)}\n\n"
+    finally:
+        budget_holds.release()
+        if limiter:
+            limiter.release()
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+func (c *cli) budget(args []string) error {
+	var opts common
+	if err := parse(c.flags("budget", &opts), args); err != nil {
+		return err
+	}
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	status, err := client.Budget(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return c.printJSON(status)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	if status.Tenant != "" {
+		fmt.Fprintf(w, "tenant\t%s\n", status.Tenant)
+	}
+	fmt.Fprintf(w, "spent\t$%.4f\n", status.SpentUSD)
+	if status.CapUSD != nil {
+		fmt.Fprintf(w, "cap\t$%.4f\n", *status.CapUSD)
+		fmt.Fprintf(w, "remaining\t$%.4f\n", *status.RemainingUSD)
+	} else {
+		fmt.Fprintf(w, "cap\tnone\n")
+	}
+	fmt.Fprintf(w, "period\t%s to %s\n", status.PeriodStart.Format(time.RFC3339), status.ResetAt.Format(time.RFC3339))
+	return w.Flush()
+}
+
+// parseTime accepts an RFC 3339 time or a date, which is midnight UTC.
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+func (c *cli) usage(args []string) error {
+	var (
+		opts             common
+		from, to, groups string
+	)
+	fs := c.flags("usage", &opts)
+	fs.StringVar(&from, "from", "", "start of the report, RFC 3339 or YYYY-MM-DD; the start of the month when empty")
+	fs.StringVar(&to, "to", "", "end of the report, RFC 3339 or YYYY-MM-DD; now when empty")
+	fs.StringVar(&groups, "group-by", "", "comma-separated dimensions: target, model, api_key_prefix, kind")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	var q reliapi.UsageQuery
+	for _, bound := range []struct {
+		name, value string
+		t           *time.Time
+	}{{"from", from, &q.From}, {"to", to, &q.To}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseTime(bound.value)
+		if err != nil {
+			return c.flagError(fs, "--%s %q is not a time", bound.name, bound.value)
+		}
+		*bound.t = t
+	}
+	if groups != "" {
+		q.GroupBy = strings.Split(groups, ",")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	rows, err := client.AllUsage(ctx, q)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return c.printJSON(rows)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	header := append([]string(nil), q.GroupBy...)
+	header = append(header, "requests", "billable", "cache hits", "errors", "prompt tokens", "completion tokens", "embedding tokens", "cost")
+	fmt.Fprintln(w, strings.Join(header, "\t")+"\t")
+	for _, row := range rows {
+		var cells []string
+		for _, dim := range q.GroupBy {
+			cells = append(cells, dimension(row, dim))
+		}
+		cells = append(cells,
+			fmt.Sprint(row.Requests), fmt.Sprint(row.BillableRequests), fmt.Sprint(row.CacheHits), fmt.Sprint(row.Errors),
+			fmt.Sprint(row.PromptTokens), fmt.Sprint(row.CompletionTokens), fmt.Sprint(row.EmbeddingTokens), fmt.Sprintf("$%.4f", row.CostUSD))
+		fmt.Fprintln(w, strings.Join(cells, "\t")+"\t")
+	}
+	return w.Flush()
+}
+
+// dimension returns the value of the grouping dimension dim of row.
+func dimension(row reliapi.UsageRow, dim string) string {
+	var v *string
+	switch dim {
+	case reliapi.UsageByTarget:
+		v = row.Target
+	case reliapi.UsageByModel:
+		v = row.Model
+	case reliapi.UsageByAPIKeyPrefix:
+		v = row.APIKeyPrefix
+	case reliapi.UsageByKind:
+		v = row.Kind
+	}
+	if v == nil {
+		return "-"
+	}
+	return *v
+}
+
+func (c *cli) targetsList(args []string) error {
+	var opts common
+	if err := parse(c.flags("targets list", &opts), args); err != nil {
+		return err
+	}
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	targets, err := client.ListTargets(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return c.printJSON(targets)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tBASE URL\tPROVIDER\tMODEL")
+	for _, t := range targets {
+		provider, model := "-", "-"
+		if llm := t.Config.LLM; llm != nil {
+			provider, model = llm.Provider, llm.DefaultModel
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", t.Name, t.Version, t.Config.BaseURL, provider, model)
+	}
+	return w.Flush()
+}
+
+func (c *cli) cachePurge(args []string) error {
+	var (
+		opts        common
+		key, target string
+	)
+	fs := c.flags("cache purge", &opts)
+	fs.StringVar(&key, "key", "", "cache key of one response, from a response's meta")
+	fs.StringVar(&target, "target", "", "purge every cached response of this target (admin key)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if (key == "") == (target == "") {
+		return c.flagError(fs, "set exactly one of --key and --target")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	removed := 0
+	if key != "" {
+		// Removing an entry that is not cached is not an error, so the
+		// count is unknown
+		err = client.InvalidateCache(ctx, reliapi.CacheRef{Key: key})
+		removed = -1
+	} else {
+		removed, err = client.InvalidateTarget(ctx, target)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		out := map[string]interface{}{}
+		if removed >= 0 {
+			out["removed"] = removed
+		}
+		return c.printJSON(out)
+	}
+	if removed >= 0 {
+		fmt.Fprintf(c.stdout, "removed %d cached responses\n", removed)
+	} else {
+		fmt.Fprintln(c.stdout, "purged")
+	}
+	return nil
+}
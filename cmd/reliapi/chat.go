@@ -0,0 +1,607 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"github.com/KikuAI-Lab/reliapi/reliapi/reliapitest"
+)
+
+const chatHelp = `Type a message to send it, or """ on a line of its own to start and end
+one of several lines. Commands:
+  /model [name|off]     show or set the model; off is the target's default
+  /target [name]        show or set the target
+  /temp [t|off]         show or set the temperature
+  /cache [seconds|off]  show or set the cache TTL; 0 bypasses the cache
+  /system [text|off]    show or set the system message
+  /save <file>          save the session
+  /load <file>          resume a saved session
+  /cost                 show the cost of each turn and the total
+  /clear                forget the history
+  /retry                send the last message again, bypassing the cache
+  /exit                 leave (as does end of input)
+`
+
+// multiLine starts and ends a message of several lines.
+const multiLine = `"""`
+
+// chatSession is the state of a chat session, as /save writes it.
+type chatSession struct {
+	Target      string   `json:"target"`
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Cache       *int     `json:"cache,omitempty"`
+	System      string   `json:"system,omitempty"`
+	// ConversationID is set for sessions whose history the proxy keeps.
+	ConversationID string `json:"conversation_id,omitempty"`
+	// Messages are the user messages and replies so far, without System.
+	Messages []reliapi.ChatMessage `json:"messages"`
+	// Turns are the requests sent, retried ones included.
+	Turns []chatTurn `json:"turns"`
+}
+
+type chatTurn struct {
+	CostUSD          float64 `json:"cost_usd"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CacheHit         bool    `json:"cache_hit,omitempty"`
+}
+
+func (s *chatSession) totalCost() float64 {
+	var total float64
+	for _, turn := range s.Turns {
+		total += turn.CostUSD
+	}
+	return total
+}
+
+// lineReader reads the lines typed into a chat: a term.Terminal, with
+// line editing and history, or plainLines.
+type lineReader interface {
+	ReadLine() (string, error)
+	SetPrompt(prompt string)
+}
+
+// plainLines reads lines from input that is not a terminal, writing the
+// prompt before each.
+type plainLines struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+	prompt  string
+}
+
+func (p *plainLines) ReadLine() (string, error) {
+	fmt.Fprint(p.out, p.prompt)
+	if !p.scanner.Scan() {
+		if err := p.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return p.scanner.Text(), nil
+}
+
+func (p *plainLines) SetPrompt(prompt string) { p.prompt = prompt }
+
+// chatREPL is a running chat.
+type chatREPL struct {
+	client  *reliapi.Client
+	in      lineReader
+	out     io.Writer
+	timeout time.Duration
+	stream  bool
+	session chatSession
+	// pending are messages to add to a proxy-kept history with the next
+	// turn: a changed system message, or the saved history of a session
+	// the proxy has forgotten.
+	pending []reliapi.ChatMessage
+}
+
+// chat runs an interactive session. Turns are streamed, with the history
+// held by the session and sent with each of its turns. With
+// --conversation the proxy keeps the history instead (see
+// reliapi.LLMRequest.ConversationID), and replies are printed whole as
+// the proxy doesn't stream conversation turns. --offline runs against a
+// reliapitest mock server.
+func (c *cli) chat(args []string) error {
+	var (
+		opts         common
+		session      chatSession
+		temperature  string
+		cache        optionalInt
+		load         string
+		offline      bool
+		noStream     bool
+		conversation string
+	)
+	fs := c.flags("chat", &opts)
+	fs.StringVar(&session.Target, "target", "", "target to send the requests to (required unless --load or --offline)")
+	fs.StringVar(&session.Model, "model", "", "model; the target's default when empty")
+	fs.StringVar(&session.System, "system", "", "system message")
+	fs.StringVar(&temperature, "temp", "", "sampling temperature")
+	fs.Var(&cache, "cache", "cache TTL in `seconds`; 0 bypasses the cache")
+	fs.StringVar(&conversation, "conversation", "", "`id` of a conversation the proxy keeps the history of, resumed if it exists")
+	fs.StringVar(&load, "load", "", "`file` of a saved session to resume")
+	fs.BoolVar(&offline, "offline", false, "chat with a built-in mock server instead of the deployment")
+	fs.BoolVar(&noStream, "no-stream", false, "print replies whole instead of as they arrive")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if opts.json {
+		return c.flagError(fs, "--json is not supported")
+	}
+	if temperature != "" {
+		t, err := strconv.ParseFloat(temperature, 64)
+		if err != nil {
+			return c.flagError(fs, "--temp %q is not a number", temperature)
+		}
+		session.Temperature = &t
+	}
+	session.Cache = cache.value
+	session.ConversationID = conversation
+	if offline && session.Target == "" {
+		session.Target = "mock"
+	}
+	if session.Target == "" && load == "" {
+		return c.flagError(fs, "--target is required")
+	}
+
+	var client *reliapi.Client
+	if offline {
+		srv := reliapitest.StartMockServer()
+		defer srv.Close()
+		srv.HandleLLM(offlineReply)
+		client = srv.Client(reliapi.WithUserAgent("reliapi-cli"))
+	} else {
+		var err error
+		if client, err = c.client(); err != nil {
+			return err
+		}
+	}
+
+	r := &chatREPL{client: client, out: c.stdout, timeout: opts.timeout, stream: !noStream}
+	if f, ok := c.stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		state, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			return err
+		}
+		defer term.Restore(int(f.Fd()), state)
+		t := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{f, c.stdout}, "")
+		r.in, r.out = t, t
+	} else {
+		r.in = &plainLines{scanner: bufio.NewScanner(c.stdin), out: c.stdout}
+	}
+
+	if load != "" {
+		if err := r.load(load); err != nil {
+			return err
+		}
+	} else {
+		r.session = session
+		if session.ConversationID != "" {
+			r.resume()
+		}
+	}
+	fmt.Fprintf(r.out, "Chatting with %s", r.session.Target)
+	if r.session.Model != "" {
+		fmt.Fprintf(r.out, " (%s)", r.session.Model)
+	}
+	if offline {
+		fmt.Fprint(r.out, ", offline")
+	}
+	fmt.Fprintln(r.out, "; /help lists the commands.")
+	return r.run()
+}
+
+// offlineReply is the mock server's answer in offline mode.
+func offlineReply(req reliapi.LLMRequest) reliapitest.LLMReply {
+	last := req.Messages[len(req.Messages)-1].Content
+	tokens, _ := reliapi.CountTokens(req.Model, req.Messages)
+	return reliapitest.LLMReply{
+		Content: fmt.Sprintf("(offline) You said %q, turn %d.", last, (len(req.Messages)+1)/2),
+		CostUSD: float64(tokens) * 0.000001,
+	}
+}
+
+func (r *chatREPL) run() error {
+	for {
+		r.in.SetPrompt("> ")
+		line, err := r.in.ReadLine()
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(r.out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case line == multiLine:
+			if line, err = r.readBlock(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "/"):
+			if done := r.command(line); done {
+				return nil
+			}
+			continue
+		}
+		r.send(line, false)
+	}
+}
+
+// readBlock reads the lines of a message up to the closing """.
+func (r *chatREPL) readBlock() (string, error) {
+	r.in.SetPrompt("... ")
+	var lines []string
+	for {
+		line, err := r.in.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(line) == multiLine {
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+// command runs a slash command and reports whether the chat ends.
+func (r *chatREPL) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	s := &r.session
+	switch name {
+	case "/exit", "/quit":
+		return true
+	case "/help":
+		fmt.Fprint(r.out, chatHelp)
+	case "/model":
+		switch arg {
+		case "":
+		case "off":
+			s.Model = ""
+		default:
+			s.Model = arg
+		}
+		fmt.Fprintf(r.out, "model: %s\n", orDefault(s.Model))
+	case "/target":
+		if arg != "" {
+			s.Target = arg
+		}
+		fmt.Fprintf(r.out, "target: %s\n", s.Target)
+	case "/temp":
+		switch arg {
+		case "":
+		case "off":
+			s.Temperature = nil
+		default:
+			t, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				fmt.Fprintf(r.out, "/temp: %q is not a number\n", arg)
+				return false
+			}
+			s.Temperature = &t
+		}
+		if s.Temperature == nil {
+			fmt.Fprintln(r.out, "temperature: default")
+		} else {
+			fmt.Fprintf(r.out, "temperature: %g\n", *s.Temperature)
+		}
+	case "/cache":
+		switch arg {
+		case "":
+		case "off":
+			s.Cache = nil
+		default:
+			ttl, err := strconv.Atoi(arg)
+			if err != nil || ttl < 0 {
+				fmt.Fprintf(r.out, "/cache: %q is not a number of seconds\n", arg)
+				return false
+			}
+			s.Cache = &ttl
+		}
+		switch {
+		case s.Cache == nil:
+			fmt.Fprintln(r.out, "cache: default")
+		case *s.Cache == 0:
+			fmt.Fprintln(r.out, "cache: bypassed")
+		default:
+			fmt.Fprintf(r.out, "cache: %ds\n", *s.Cache)
+		}
+	case "/system":
+		switch arg {
+		case "":
+		case "off":
+			s.System = ""
+		default:
+			s.System = arg
+			if s.ConversationID != "" {
+				r.pending = append(r.pending, reliapi.ChatMessage{Role: "system", Content: arg})
+			}
+		}
+		fmt.Fprintf(r.out, "system: %s\n", orNone(s.System))
+	case "/save":
+		if arg == "" {
+			fmt.Fprintln(r.out, "/save: a file is required")
+			return false
+		}
+		if err := r.save(arg); err != nil {
+			fmt.Fprintf(r.out, "/save: %v\n", err)
+			return false
+		}
+		fmt.Fprintf(r.out, "saved %d messages to %s\n", len(s.Messages), arg)
+	case "/load":
+		if arg == "" {
+			fmt.Fprintln(r.out, "/load: a file is required")
+			return false
+		}
+		if err := r.load(arg); err != nil {
+			fmt.Fprintf(r.out, "/load: %v\n", err)
+		}
+	case "/cost":
+		for i, turn := range s.Turns {
+			fmt.Fprintf(r.out, "turn %d: $%.6f, %d prompt + %d completion tokens", i+1, turn.CostUSD, turn.PromptTokens, turn.CompletionTokens)
+			if turn.CacheHit {
+				fmt.Fprint(r.out, ", cache hit")
+			}
+			fmt.Fprintln(r.out)
+		}
+		fmt.Fprintf(r.out, "total: $%.6f over %d turns\n", s.totalCost(), len(s.Turns))
+	case "/clear":
+		r.clear()
+	case "/retry":
+		r.retry()
+	default:
+		fmt.Fprintf(r.out, "unknown command %s; /help lists them\n", name)
+	}
+	return false
+}
+
+func orDefault(model string) string {
+	if model == "" {
+		return "target default"
+	}
+	return model
+}
+
+func orNone(system string) string {
+	if system == "" {
+		return "none"
+	}
+	return system
+}
+
+// send sends content as the next turn and prints the reply. The history
+// only grows when the turn succeeds.
+func (r *chatREPL) send(content string, bypassCache bool) {
+	s := &r.session
+	user := reliapi.ChatMessage{Role: "user", Content: content}
+	req := reliapi.LLMRequest{Target: s.Target, Model: s.Model, Temperature: s.Temperature, Cache: s.Cache}
+	if bypassCache {
+		req.Cache = new(int)
+	}
+	conversation := s.ConversationID != ""
+	if conversation {
+		req.ConversationID = &s.ConversationID
+		req.AppendMessages = append(append([]reliapi.ChatMessage(nil), r.pending...), user)
+	} else {
+		if s.System != "" {
+			req.Messages = append(req.Messages, reliapi.ChatMessage{Role: "system", Content: s.System})
+		}
+		req.Messages = append(append(req.Messages, s.Messages...), user)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	var (
+		reply string
+		turn  chatTurn
+		rate  float64
+		err   error
+	)
+	if r.stream && !conversation {
+		reply, turn, rate, err = r.streamTurn(ctx, req)
+	} else {
+		reply, turn, err = r.turn(ctx, req)
+	}
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %s\n", strings.TrimPrefix(err.Error(), "reliapi: "))
+		return
+	}
+
+	if conversation {
+		s.Messages = append(s.Messages, r.pending...)
+		r.pending = nil
+	}
+	s.Messages = append(s.Messages, user, reliapi.ChatMessage{Role: "assistant", Content: reply})
+	s.Turns = append(s.Turns, turn)
+	status := fmt.Sprintf("$%.6f, total $%.6f, %d tokens", turn.CostUSD, s.totalCost(), turn.CompletionTokens)
+	if rate > 0 {
+		status += fmt.Sprintf(" at %.1f tok/s", rate)
+	}
+	if turn.CacheHit {
+		status += ", cache hit"
+	}
+	fmt.Fprintf(r.out, "[%s]\n", status)
+}
+
+// turn sends req and prints the whole reply.
+func (r *chatREPL) turn(ctx context.Context, req reliapi.LLMRequest) (string, chatTurn, error) {
+	resp, err := r.client.ProxyLLM(ctx, req)
+	if err != nil {
+		return "", chatTurn{}, err
+	}
+	completion, err := resp.Completion()
+	if err != nil {
+		return "", chatTurn{}, err
+	}
+	if len(completion.Choices) == 0 {
+		return "", chatTurn{}, reliapi.ErrNoChoices
+	}
+	reply := completion.Choices[0].Message.Content
+	fmt.Fprintln(r.out, reply)
+	return reply, newChatTurn(resp.Meta, completion.Usage), nil
+}
+
+// streamTurn sends req as a stream, printing the reply as it arrives, and
+// returns the rate it arrived at in tokens per second.
+func (r *chatREPL) streamTurn(ctx context.Context, req reliapi.LLMRequest) (string, chatTurn, float64, error) {
+	s, err := r.client.ProxyLLMStream(ctx, req)
+	if err != nil {
+		return "", chatTurn{}, 0, err
+	}
+	defer s.Close()
+	var (
+		reply strings.Builder
+		first time.Time
+	)
+	for {
+		chunk, err := s.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(r.out)
+			return "", chatTurn{}, 0, err
+		}
+		if first.IsZero() {
+			first = time.Now()
+		}
+		reply.WriteString(chunk.Delta)
+		fmt.Fprint(r.out, chunk.Delta)
+	}
+	fmt.Fprintln(r.out)
+	usage := s.Usage()
+	var rate float64
+	if elapsed := time.Since(first); !first.IsZero() && elapsed > 0 {
+		rate = float64(usage.CompletionTokens) / elapsed.Seconds()
+	}
+	return reply.String(), newChatTurn(s.Meta(), usage), rate, nil
+}
+
+func newChatTurn(meta reliapi.Meta, usage reliapi.Usage) chatTurn {
+	turn := chatTurn{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens, CacheHit: meta.CacheHit}
+	if meta.CostUSD != nil {
+		turn.CostUSD = *meta.CostUSD
+	}
+	return turn
+}
+
+// retry drops the last reply and sends the message it answered again.
+func (r *chatREPL) retry() {
+	s := &r.session
+	if s.ConversationID != "" {
+		fmt.Fprintln(r.out, "/retry: the proxy has stored the last turn of the conversation")
+		return
+	}
+	n := len(s.Messages)
+	if n < 2 {
+		fmt.Fprintln(r.out, "/retry: nothing to retry")
+		return
+	}
+	last, reply := s.Messages[n-2], s.Messages[n-1]
+	s.Messages = slices.Clip(s.Messages[:n-2])
+	r.send(last.Content, true)
+	if len(s.Messages) == n-2 {
+		// The retry failed; keep the reply that was there
+		s.Messages = append(s.Messages, last, reply)
+	}
+}
+
+// clear forgets the history; the proxy's, for a conversation it keeps.
+func (r *chatREPL) clear() {
+	s := &r.session
+	if s.ConversationID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		defer cancel()
+		var apiErr *reliapi.APIError
+		if err := r.client.DeleteConversation(ctx, s.ConversationID); err != nil && !(errors.As(err, &apiErr) && apiErr.Code == reliapi.CodeNotFound) {
+			fmt.Fprintf(r.out, "/clear: %s\n", strings.TrimPrefix(err.Error(), "reliapi: "))
+			return
+		}
+		r.pending = nil
+		if s.System != "" {
+			r.pending = []reliapi.ChatMessage{{Role: "system", Content: s.System}}
+		}
+	}
+	s.Messages = nil
+	fmt.Fprintln(r.out, "history cleared")
+}
+
+func (r *chatREPL) save(path string) error {
+	raw, err := json.MarshalIndent(r.session, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o600)
+}
+
+// load resumes the session saved in path. A conversation the proxy keeps
+// is resumed from the proxy's history, or from the saved one when the
+// proxy has forgotten it.
+func (r *chatREPL) load(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var session chatSession
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return fmt.Errorf("%s is not a saved session: %w", path, err)
+	}
+	if session.Target == "" {
+		return fmt.Errorf("%s has no target", path)
+	}
+	r.session, r.pending = session, nil
+	if session.ConversationID != "" {
+		r.resume()
+		return nil
+	}
+	fmt.Fprintf(r.out, "loaded %d messages from %s\n", len(session.Messages), path)
+	return nil
+}
+
+// resume fetches the history of the session's conversation from the
+// proxy. An unknown one starts with the session's system message and any
+// messages it already has.
+func (r *chatREPL) resume() {
+	s := &r.session
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	conv, err := r.client.GetConversation(ctx, s.ConversationID)
+	if err == nil {
+		s.Messages = conv.Messages
+		fmt.Fprintf(r.out, "resumed conversation %s: %d turns\n", s.ConversationID, conv.Turns)
+		return
+	}
+	var apiErr *reliapi.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != reliapi.CodeNotFound {
+		fmt.Fprintf(r.out, "conversation %s: %s\n", s.ConversationID, strings.TrimPrefix(err.Error(), "reliapi: "))
+		return
+	}
+	if s.System != "" && (len(s.Messages) == 0 || s.Messages[0].Role != "system") {
+		r.pending = append(r.pending, reliapi.ChatMessage{Role: "system", Content: s.System})
+	}
+	r.pending = append(r.pending, s.Messages...)
+	s.Messages = nil
+	if len(r.pending) > 0 && len(s.Turns) > 0 {
+		fmt.Fprintf(r.out, "conversation %s has expired; its saved history is sent with the next message\n", s.ConversationID)
+	}
+}
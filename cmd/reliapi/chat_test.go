@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"github.com/KikuAI-Lab/reliapi/reliapi/reliapitest"
+)
+
+// echoServer is a mock server whose replies repeat the last message.
+func echoServer(t *testing.T) *reliapitest.MockServer {
+	srv := reliapitest.NewMockServer(t)
+	srv.HandleLLM(func(req reliapi.LLMRequest) reliapitest.LLMReply {
+		return reliapitest.LLMReply{Content: "echo: " + req.Messages[len(req.Messages)-1].Content, CostUSD: 0.001}
+	})
+	return srv
+}
+
+// llmRequests are the LLM requests srv received.
+func llmRequests(t *testing.T, srv *reliapitest.MockServer) []reliapi.LLMRequest {
+	t.Helper()
+	var reqs []reliapi.LLMRequest
+	for _, r := range srv.Requests() {
+		if r.Path != "/v1/proxy/llm" {
+			continue
+		}
+		var req reliapi.LLMRequest
+		if err := json.Unmarshal(r.Body, &req); err != nil {
+			t.Fatal(err)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+func contents(msgs []reliapi.ChatMessage) []string {
+	var out []string
+	for _, m := range msgs {
+		out = append(out, m.Role+": "+m.Content)
+	}
+	return out
+}
+
+func TestChat(t *testing.T) {
+	srv := echoServer(t)
+	file := filepath.Join(t.TempDir(), "session.json")
+	script := strings.Join([]string{
+		"/help",
+		"/model gpt-4o-mini",
+		"/temp 0.5",
+		"/temp warm",
+		"/cache 60",
+		"/system Be brief.",
+		"Hello",
+		`"""`,
+		"line one",
+		"line two",
+		`"""`,
+		"/retry",
+		"/cost",
+		"/save " + file,
+		"/clear",
+		"/model off",
+		"/temp off",
+		"/cache 0",
+		"/system off",
+		"After clear",
+		"/load " + file,
+		"/target",
+		"/target anthropic",
+		"Resumed",
+		"/bogus",
+		"/exit",
+		"never sent",
+	}, "\n")
+	code, stdout, stderr := runCLI(t, srv.URL, script, "chat", "--target", "openai")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	for _, want := range []string{
+		"Chatting with openai; /help lists the commands.",
+		"/retry                send the last message again",
+		"model: gpt-4o-mini",
+		"temperature: 0.5",
+		`/temp: "warm" is not a number`,
+		"cache: 60s",
+		"system: Be brief.",
+		"echo: Hello\n[$0.001000, total $0.001000, 2 tokens at ",
+		"echo: line one\nline two\n",
+		"... ",
+		"[$0.001000, total $0.003000, ",
+		"turn 3: $0.001000, ",
+		"total: $0.003000 over 3 turns",
+		"saved 4 messages to " + file,
+		"history cleared",
+		"model: target default",
+		"temperature: default",
+		"cache: bypassed",
+		"system: none",
+		"loaded 4 messages from " + file,
+		"target: openai",
+		"target: anthropic",
+		"unknown command /bogus; /help lists them",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout lacks %q:\n%s", want, stdout)
+		}
+	}
+	if strings.Contains(stdout, "never sent") {
+		t.Error("read past /exit")
+	}
+
+	reqs := llmRequests(t, srv)
+	if len(reqs) != 5 {
+		t.Fatalf("%d requests", len(reqs))
+	}
+	first := reqs[0]
+	if first.Target != "openai" || first.Model != "gpt-4o-mini" || *first.Temperature != 0.5 || *first.Cache != 60 || first.Stream == nil || !*first.Stream {
+		t.Errorf("first request = %+v", first)
+	}
+	want := []string{"system: Be brief.", "user: Hello", "assistant: echo: Hello", "user: line one\nline two"}
+	if got := contents(reqs[1].Messages); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("second request messages = %q", got)
+	}
+	// /retry sends the same history again, bypassing the cache
+	if got := contents(reqs[2].Messages); strings.Join(got, "|") != strings.Join(want, "|") || *reqs[2].Cache != 0 {
+		t.Errorf("retried request = %q, cache %v", got, reqs[2].Cache)
+	}
+	if after := reqs[3]; len(after.Messages) != 1 || after.Model != "" || after.Temperature != nil || *after.Cache != 0 {
+		t.Errorf("request after /clear = %+v", after)
+	}
+	// /load brings back the settings and history saved
+	if resumed := reqs[4]; resumed.Target != "anthropic" || resumed.Model != "gpt-4o-mini" || len(resumed.Messages) != 6 || resumed.Messages[5].Content != "Resumed" {
+		t.Errorf("resumed request = %+v", resumed)
+	}
+
+	var saved chatSession
+	raw, err := os.ReadFile(file)
+	if err != nil || json.Unmarshal(raw, &saved) != nil {
+		t.Fatalf("saved session: %s, %v", raw, err)
+	}
+	if saved.Target != "openai" || saved.System != "Be brief." || len(saved.Messages) != 4 || len(saved.Turns) != 3 || saved.Turns[0].CompletionTokens != 2 {
+		t.Errorf("saved session = %+v", saved)
+	}
+
+	// The session file can also be loaded at start
+	code, stdout, stderr = runCLI(t, srv.URL, "/cost\n", "chat", "--load", file)
+	if code != 0 || !strings.Contains(stdout, "loaded 4 messages") || !strings.Contains(stdout, "total: $0.003000 over 3 turns") {
+		t.Errorf("exit %d, stdout = %q, stderr = %q", code, stdout, stderr)
+	}
+}
+
+func TestChatNoStream(t *testing.T) {
+	srv := echoServer(t)
+	code, stdout, stderr := runCLI(t, srv.URL, "Hi\n/clear\nHi\n/retry\n/load missing.json\n/save\n", "chat", "--target", "openai", "--no-stream")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	for _, want := range []string{"echo: Hi\n[$0.001000, total $0.001000, 2 tokens]", "total $0.002000, 2 tokens, cache hit]", "/load: open missing.json", "/save: a file is required"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout lacks %q:\n%s", want, stdout)
+		}
+	}
+	reqs := llmRequests(t, srv)
+	if len(reqs) != 3 || reqs[0].Stream != nil {
+		t.Errorf("requests = %+v", reqs)
+	}
+
+	// A failed turn leaves the history as it was
+	srv.FailNext(1, &reliapi.APIError{StatusCode: 502, Type: "upstream_error", Code: reliapi.CodeServerError, Message: "boom"})
+	code, stdout, _ = runCLI(t, srv.URL, "First\nSecond\n/cost\n", "chat", "--target", "openai", "--no-stream")
+	if code != 0 || !strings.Contains(stdout, "error: 502 ") || !strings.Contains(stdout, "total: $0.001000 over 1 turns") {
+		t.Errorf("exit %d, stdout = %q", code, stdout)
+	}
+	if reqs := llmRequests(t, srv); len(reqs[len(reqs)-1].Messages) != 1 {
+		t.Errorf("messages after a failed turn = %+v", reqs[len(reqs)-1].Messages)
+	}
+}
+
+func TestChatConversation(t *testing.T) {
+	srv := echoServer(t)
+	file := filepath.Join(t.TempDir(), "session.json")
+	code, stdout, stderr := runCLI(t, srv.URL, "One\nTwo\n/retry\n/save "+file+"\n", "chat", "--target", "openai", "--system", "Be brief.", "--conversation", "conv_1")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "echo: Two\n") || !strings.Contains(stdout, "/retry: the proxy has stored the last turn") {
+		t.Errorf("stdout = %q", stdout)
+	}
+	reqs := llmRequests(t, srv)
+	if len(reqs) != 2 || *reqs[1].ConversationID != "conv_1" || len(reqs[1].Messages) != 0 || reqs[1].Stream != nil {
+		t.Fatalf("requests = %+v", reqs)
+	}
+	// The system message goes with the first turn only
+	if got := contents(reqs[0].AppendMessages); len(got) != 2 || got[0] != "system: Be brief." {
+		t.Errorf("first turn appends %q", got)
+	}
+	if got := contents(reqs[1].AppendMessages); len(got) != 1 || got[0] != "user: Two" {
+		t.Errorf("second turn appends %q", got)
+	}
+
+	// Loading the session resumes the proxy's history
+	code, stdout, _ = runCLI(t, srv.URL, "Three\n/clear\nFour\n", "chat", "--load", file)
+	if code != 0 || !strings.Contains(stdout, "resumed conversation conv_1: 2 turns") || !strings.Contains(stdout, "history cleared") {
+		t.Errorf("exit %d, stdout = %q", code, stdout)
+	}
+	reqs = llmRequests(t, srv)
+	if got := contents(reqs[2].AppendMessages); len(got) != 1 || got[0] != "user: Three" {
+		t.Errorf("resumed turn appends %q", got)
+	}
+	// /clear deleted the conversation, so the next turn starts it over
+	if got := contents(reqs[3].AppendMessages); len(got) != 2 || got[0] != "system: Be brief." || got[1] != "user: Four" {
+		t.Errorf("turn after /clear appends %q", got)
+	}
+
+	// A conversation the proxy has forgotten is sent again from the file
+	srv = echoServer(t)
+	code, stdout, _ = runCLI(t, srv.URL, "Five\n", "chat", "--load", file)
+	if code != 0 || !strings.Contains(stdout, "conversation conv_1 has expired") {
+		t.Errorf("exit %d, stdout = %q", code, stdout)
+	}
+	if reqs := llmRequests(t, srv); len(reqs) != 1 || len(reqs[0].AppendMessages) != 6 {
+		t.Errorf("requests = %+v", reqs)
+	}
+}
+
+func TestChatOffline(t *testing.T) {
+	code, stdout, stderr := runCLI(t, "http://127.0.0.1:1", "Hello\n/cost\n", "chat", "--offline")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	for _, want := range []string{"Chatting with mock, offline", `(offline) You said "Hello", turn 1.`, "over 1 turns"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout lacks %q:\n%s", want, stdout)
+		}
+	}
+}
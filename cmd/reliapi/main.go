@@ -0,0 +1,260 @@
+// Command reliapi makes ad-hoc calls through a ReliAPI deployment and
+// inspects its budget, usage, targets and cache.
+//
+// Usage:
+//
+//	reliapi <command> [flags]
+//
+// The commands are:
+//
+//	llm           send an LLM request (--target, --model, --message, --stream, ...)
+//	              or run a past one again (--replay, admin key)
+//	http          send an HTTP request (--target, --method, --path, --query, ...)
+//	              or run a past one again (--replay, admin key)
+//	budget        show this month's spend against the budget cap
+//	usage         show a usage report (--from, --to, --group-by)
+//	targets list  list the proxy's targets (admin key)
+//	cache purge   remove cached responses (--key, or --target with the admin key)
+//	chat          chat interactively (--target, --model, --conversation, --offline, ...)
+//
+// The deployment is RELIAPI_URL (default https://reliapi.kikuai.dev) and the
+// key RELIAPI_API_KEY, or RAPIDAPI_KEY when that is unset.
+//
+// Results go to stdout, pretty-printed, or as JSON with --json. Response
+// meta (cache hit, cost, request ID) goes to stderr, so stdout can be piped.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+const usage = `Usage: reliapi <command> [flags]
+
+Commands:
+  llm           send an LLM request
+  http          send an HTTP request through a target
+  budget        show this month's spend against the budget cap
+  usage         show a usage report
+  targets list  list the proxy's targets (admin key)
+  cache purge   remove cached responses
+  chat          chat interactively
+
+Environment:
+  RELIAPI_URL      deployment URL (default ` + reliapi.DefaultBaseURL + `)
+  RELIAPI_API_KEY  API key (falls back to RAPIDAPI_KEY)
+
+Run "reliapi <command> -h" for a command's flags.
+`
+
+// errUsage is returned for invalid command lines, after the problem has
+// been reported.
+var errUsage = errors.New("usage")
+
+// cli is one invocation of the command.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+}
+
+func main() {
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, getenv: os.Getenv}
+	os.Exit(c.run(os.Args[1:]))
+}
+
+// run executes the command line args and returns the exit status: 0 on
+// success, 1 when a request fails and 2 for invalid usage.
+func (c *cli) run(args []string) int {
+	err := c.dispatch(args)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	default:
+		fmt.Fprintf(c.stderr, "reliapi: %s\n", strings.TrimPrefix(err.Error(), "reliapi: "))
+		return 1
+	}
+}
+
+func (c *cli) dispatch(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, usage)
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "llm":
+		return c.llm(args)
+	case "http":
+		return c.http(args)
+	case "budget":
+		return c.budget(args)
+	case "usage":
+		return c.usage(args)
+	case "targets":
+		if len(args) == 0 || args[0] != "list" {
+			return c.usageError("targets: expected \"targets list\"")
+		}
+		return c.targetsList(args[1:])
+	case "cache":
+		if len(args) == 0 || args[0] != "purge" {
+			return c.usageError("cache: expected \"cache purge\"")
+		}
+		return c.cachePurge(args[1:])
+	case "chat":
+		return c.chat(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(c.stdout, usage)
+		return nil
+	default:
+		return c.usageError("unknown command %q", cmd)
+	}
+}
+
+func (c *cli) usageError(format string, args ...interface{}) error {
+	fmt.Fprintf(c.stderr, "reliapi: "+format+"\n\n", args...)
+	fmt.Fprint(c.stderr, usage)
+	return errUsage
+}
+
+// common holds the flags every command takes.
+type common struct {
+	json    bool
+	timeout time.Duration
+}
+
+// flags returns the flag set of the command name, with the common flags
+// registered.
+func (c *cli) flags(name string, opts *common) *flag.FlagSet {
+	fs := flag.NewFlagSet("reliapi "+name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.BoolVar(&opts.json, "json", false, "print the result as JSON")
+	fs.DurationVar(&opts.timeout, "timeout", 2*time.Minute, "give up after this long")
+	return fs
+}
+
+// parse parses args into fs and rejects positional arguments.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// flagError reports an invalid flag value of the command fs.
+func (c *cli) flagError(fs *flag.FlagSet, format string, args ...interface{}) error {
+	fmt.Fprintf(c.stderr, fs.Name()+": "+format+"\n", args...)
+	fs.Usage()
+	return errUsage
+}
+
+func (c *cli) client() (*reliapi.Client, error) {
+	key := c.getenv("RELIAPI_API_KEY")
+	if key == "" {
+		key = c.getenv("RAPIDAPI_KEY")
+	}
+	if key == "" {
+		return nil, errors.New("RELIAPI_API_KEY is not set")
+	}
+	return reliapi.NewClient(c.getenv("RELIAPI_URL"), key, reliapi.WithUserAgent("reliapi-cli"))
+}
+
+// printJSON writes v to stdout as indented JSON.
+func (c *cli) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printJSONLine writes v to stdout as JSON on a single line.
+func (c *cli) printJSONLine(v interface{}) error {
+	return json.NewEncoder(c.stdout).Encode(v)
+}
+
+// printMeta writes the interesting fields of meta to stderr on one line.
+func (c *cli) printMeta(meta reliapi.Meta, idempotencyKey string) {
+	fields := []string{"request_id=" + meta.RequestID}
+	if meta.ReplayOf != "" {
+		fields = append(fields, "replay_of="+meta.ReplayOf)
+	}
+	if meta.ServedBy != "" && meta.ServedBy != meta.Target {
+		fields = append(fields, "served_by="+meta.ServedBy)
+	}
+	if meta.Model != "" {
+		fields = append(fields, "model="+meta.Model)
+	}
+	fields = append(fields, fmt.Sprintf("cache_hit=%t", meta.CacheHit))
+	if meta.IdempotentHit {
+		fields = append(fields, "idempotent_hit=true")
+		if meta.IdempotencyReplayCount > 0 {
+			fields = append(fields, fmt.Sprintf("idempotency_replays=%d", meta.IdempotencyReplayCount))
+		}
+	}
+	if meta.Truncated {
+		fields = append(fields, "truncated=true")
+	}
+	if meta.CostUSD != nil {
+		fields = append(fields, fmt.Sprintf("cost_usd=%.6f", *meta.CostUSD))
+	}
+	if meta.Retries > 0 {
+		fields = append(fields, fmt.Sprintf("retries=%d", meta.Retries))
+	}
+	fields = append(fields, fmt.Sprintf("duration_ms=%d", meta.DurationMs))
+	if idempotencyKey != "" {
+		fields = append(fields, "idempotency_key="+idempotencyKey)
+	}
+	fmt.Fprintln(c.stderr, strings.Join(fields, " "))
+}
+
+// listFlag is a flag that may be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ", ") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// optionalInt is an int flag that records whether it was set.
+type optionalInt struct {
+	value *int
+}
+
+func (o *optionalInt) String() string {
+	if o.value == nil {
+		return ""
+	}
+	return fmt.Sprint(*o.value)
+}
+
+func (o *optionalInt) Set(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", v)
+	}
+	o.value = &n
+	return nil
+}
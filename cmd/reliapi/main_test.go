@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"github.com/KikuAI-Lab/reliapi/reliapi/reliapitest"
+)
+
+// runCLI runs the command line args against the deployment at url and
+// returns the exit status, stdout and stderr.
+func runCLI(t *testing.T, url, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	env := map[string]string{"RELIAPI_URL": url, "RELIAPI_API_KEY": reliapitest.APIKey}
+	c := &cli{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr, getenv: func(k string) string { return env[k] }}
+	code := c.run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestLLM(t *testing.T) {
+	srv := reliapitest.NewMockServer(t)
+	var got reliapi.LLMRequest
+	srv.HandleLLM(func(req reliapi.LLMRequest) reliapitest.LLMReply {
+		got = req
+		return reliapitest.LLMReply{Content: "Paris.", CostUSD: 0.0012}
+	})
+
+	args := []string{"llm", "--target", "openai", "--model", "gpt-4o-mini", "--message", "system: Be brief.", "--message", "-", "--cache", "60", "--idempotency-key", "k1"}
+	code, stdout, stderr := runCLI(t, srv.URL, "Capital of France?", args...)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if stdout != "Paris.\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+	for _, want := range []string{"request_id=req_mock_1", "cache_hit=false", "cost_usd=0.001200", "idempotency_key=k1"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr %q lacks %q", stderr, want)
+		}
+	}
+	if len(got.Messages) != 2 || got.Messages[0].Role != "system" || got.Messages[0].Content != "Be brief." || got.Messages[1].Content != "Capital of France?" {
+		t.Errorf("messages = %+v", got.Messages)
+	}
+	if got.Cache == nil || *got.Cache != 60 || got.IdempotencyKey == nil || *got.IdempotencyKey != "k1" {
+		t.Errorf("request = %+v", got)
+	}
+
+	code, stdout, stderr = runCLI(t, srv.URL, "Capital of France?", append(args, "--json")...)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	var resp reliapi.ReliAPIResponse
+	if err := json.Unmarshal([]byte(stdout), &resp); err != nil {
+		t.Fatalf("stdout is not JSON: %v\n%s", err, stdout)
+	}
+	if !resp.Meta.CacheHit || !strings.Contains(stderr, "cache_hit=true") {
+		t.Errorf("meta = %+v, stderr = %q", resp.Meta, stderr)
+	}
+}
+
+func TestLLMStream(t *testing.T) {
+	srv := reliapitest.NewMockServer(t)
+	srv.HandleLLM(func(reliapi.LLMRequest) reliapitest.LLMReply {
+		return reliapitest.LLMReply{Content: "The capital is Paris."}
+	})
+
+	code, stdout, stderr := runCLI(t, srv.URL, "", "llm", "--target", "openai", "--message", "Capital?", "--stream")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if stdout != "The capital is Paris.\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+	if !strings.Contains(stderr, "completion_tokens=4") {
+		t.Errorf("stderr = %q", stderr)
+	}
+
+	code, stdout, _ = runCLI(t, srv.URL, "", "llm", "--target", "openai", "--message", "Capital?", "--stream", "--json")
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); code != 0 || len(lines) != 4 || !json.Valid([]byte(lines[0])) {
+		t.Errorf("exit %d, stdout = %q", code, stdout)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	srv := reliapitest.NewMockServer(t)
+	var got reliapi.HTTPRequest
+	srv.HandleHTTP(func(req reliapi.HTTPRequest) reliapitest.HTTPReply {
+		got = req
+		return reliapitest.HTTPReply{StatusCode: http.StatusCreated, Body: map[string]int{"id": 7}}
+	})
+
+	code, stdout, stderr := runCLI(t, srv.URL, `{"title":"x"}`, "http", "--target", "api", "--method", "post", "--path", "/posts",
+		"--query", "tag=a", "--query", "tag=b", "--header", "X-Trace: abc", "--body-file", "-")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if strings.TrimSpace(stdout) != `{"id":7}` || !strings.Contains(stderr, "upstream: 201 Created") {
+		t.Errorf("stdout = %q, stderr = %q", stdout, stderr)
+	}
+	if got.Method != "POST" || got.Headers["X-Trace"] != "abc" || got.Body == nil || *got.Body != `{"title":"x"}` {
+		t.Errorf("request = %+v", got)
+	}
+	if tags, _ := got.Query["tag"].([]interface{}); len(tags) != 2 {
+		t.Errorf("query = %v", got.Query)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var got []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/replay/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var overrides reliapi.ReplayOverrides
+		_ = json.NewDecoder(r.Body).Decode(&overrides)
+		got = append(got, r.PathValue("id")+" "+overrides.Target+" "+overrides.Model)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"status_code": 200, "headers": map[string]string{}, "body": map[string]int{"id": 7}},
+			"meta":    map[string]interface{}{"request_id": "req_2", "replay_of": r.PathValue("id")},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	code, stdout, stderr := runCLI(t, srv.URL, "", "http", "--replay", "req_1", "--target", "staging")
+	if code != 0 || strings.TrimSpace(stdout) != `{"id":7}` || !strings.Contains(stderr, "request_id=req_2 replay_of=req_1") {
+		t.Errorf("exit %d, stdout = %q, stderr = %q", code, stdout, stderr)
+	}
+	code, stdout, stderr = runCLI(t, srv.URL, "", "llm", "--replay", "req_3", "--model", "gpt-4o", "--json")
+	if code != 0 || !json.Valid([]byte(stdout)) {
+		t.Errorf("exit %d, stdout = %q, stderr = %q", code, stdout, stderr)
+	}
+	if len(got) != 2 || got[0] != "req_1 staging " || got[1] != "req_3  gpt-4o" {
+		t.Errorf("replays = %q", got)
+	}
+}
+
+func TestAdminCommands(t *testing.T) {
+	var purged string
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, data interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+	}
+	mux.HandleFunc("GET /v1/budget", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"spent_usd": 1.5, "cap_usd": 10, "remaining_usd": 8.5, "period_start": "2026-10-01T00:00:00Z", "reset_at": "2026-11-01T00:00:00Z"})
+	})
+	mux.HandleFunc("GET /v1/usage", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("group_by") != "target" || r.URL.Query().Get("from") != "2026-10-01T00:00:00Z" {
+			t.Errorf("usage query = %s", r.URL.RawQuery)
+		}
+		reply(w, map[string]interface{}{"rows": []map[string]interface{}{{"target": "openai", "requests": 3, "cost_usd": 0.25}}})
+	})
+	mux.HandleFunc("GET /v1/targets", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"targets": []map[string]interface{}{{"name": "openai", "version": 2, "config": map[string]interface{}{"base_url": "https://api.openai.com/v1"}}}})
+	})
+	mux.HandleFunc("DELETE /v1/cache/targets/{target}", func(w http.ResponseWriter, r *http.Request) {
+		purged = r.PathValue("target")
+		reply(w, map[string]interface{}{"removed": 4})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"budget"}, "remaining  $8.5000"},
+		{[]string{"usage", "--group-by", "target", "--from", "2026-10-01"}, "openai"},
+		{[]string{"targets", "list"}, "https://api.openai.com/v1"},
+		{[]string{"cache", "purge", "--target", "openai"}, "removed 4 cached responses"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(t, srv.URL, "", tt.args...)
+		if code != 0 || !strings.Contains(stdout, tt.want) {
+			t.Errorf("%v: exit %d, stdout = %q, stderr = %q", tt.args, code, stdout, stderr)
+		}
+	}
+	if purged != "openai" {
+		t.Errorf("purged %q", purged)
+	}
+
+	code, stdout, _ := runCLI(t, srv.URL, "", "budget", "--json")
+	var status reliapi.BudgetStatus
+	if err := json.Unmarshal([]byte(stdout), &status); code != 0 || err != nil || status.SpentUSD != 1.5 {
+		t.Errorf("exit %d, stdout = %q", code, stdout)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	srv := reliapitest.NewMockServer(t)
+	srv.FailNext(1, &reliapi.APIError{StatusCode: http.StatusPaymentRequired, Type: "budget_error", Code: reliapi.CodeBudgetExceeded, Message: "over budget"})
+
+	tests := []struct {
+		args []string
+		code int
+		want string
+	}{
+		{nil, 2, "Usage: reliapi"},
+		{[]string{"nope"}, 2, `unknown command "nope"`},
+		{[]string{"llm", "--message", "hi"}, 2, "--target and --message are required"},
+		{[]string{"llm", "--replay", "req_1", "--message", "hi"}, 2, "--message can't be used with --replay"},
+		{[]string{"http", "--replay", "req_1", "--path", "/x"}, 2, "--path can't be used with --replay"},
+		{[]string{"cache", "purge"}, 2, "set exactly one of --key and --target"},
+		{[]string{"http", "--target", "api", "--query", "bad"}, 2, `--query "bad" is not name=value`},
+		{[]string{"chat"}, 2, "--target is required"},
+		{[]string{"chat", "--target", "openai", "--json"}, 2, "--json is not supported"},
+		{[]string{"chat", "--target", "openai", "--temp", "warm"}, 2, `--temp "warm" is not a number`},
+		{[]string{"chat", "--load", "missing.json"}, 1, "open missing.json"},
+		{[]string{"llm", "--target", "openai", "--message", "hi"}, 1, "reliapi: 402 BUDGET_EXCEEDED: over budget"},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runCLI(t, srv.URL, "", tt.args...)
+		if code != tt.code || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: exit %d, stderr = %q; want exit %d with %q", tt.args, code, stderr, tt.code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+// parseMessage turns a --message value into a chat message. A "system:",
+// "assistant:" or "user:" prefix sets the role, which defaults to user,
+// and "-" reads the content from stdin.
+func (c *cli) parseMessage(v string) (reliapi.ChatMessage, error) {
+	role := "user"
+	for _, r := range []string{"system", "assistant", "user"} {
+		if rest, ok := strings.CutPrefix(v, r+":"); ok {
+			role, v = r, strings.TrimSpace(rest)
+			break
+		}
+	}
+	if v == "-" {
+		raw, err := io.ReadAll(c.stdin)
+		if err != nil {
+			return reliapi.ChatMessage{}, fmt.Errorf("read stdin: %w", err)
+		}
+		v = string(raw)
+	}
+	return reliapi.ChatMessage{Role: role, Content: v}, nil
+}
+
+func (c *cli) llm(args []string) error {
+	var (
+		opts           common
+		target, model  string
+		messages       listFlag
+		cache          optionalInt
+		maxTokens      optionalInt
+		idempotencyKey string
+		stream         bool
+		replay         string
+	)
+	fs := c.flags("llm", &opts)
+	fs.StringVar(&target, "target", "", "target to send the request to (required)")
+	fs.StringVar(&model, "model", "", "model; the target's default when empty")
+	fs.StringVar(&replay, "replay", "", "`request_id` of a past request to run again (admin key); --target and --model override its own")
+	fs.Var(&messages, "message", "`message` to send, repeatable; prefix with \"system:\" or \"assistant:\" for other roles, \"-\" reads stdin")
+	fs.Var(&cache, "cache", "cache TTL in `seconds`; 0 bypasses the cache")
+	fs.Var(&maxTokens, "max-tokens", "limit on completion `tokens`")
+	fs.StringVar(&idempotencyKey, "idempotency-key", "", "idempotency key of the request")
+	fs.BoolVar(&stream, "stream", false, "print tokens as they arrive")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if replay != "" {
+		if name := flagSetBesides(fs, "replay", "target", "model"); name != "" {
+			return c.flagError(fs, "--%s can't be used with --replay", name)
+		}
+	} else if target == "" || len(messages) == 0 {
+		return c.flagError(fs, "--target and --message are required")
+	}
+
+	req := reliapi.LLMRequest{Target: target, Model: model, Cache: cache.value, MaxTokens: maxTokens.value}
+	for _, v := range messages {
+		msg, err := c.parseMessage(v)
+		if err != nil {
+			return err
+		}
+		req.Messages = append(req.Messages, msg)
+	}
+	if idempotencyKey != "" {
+		req.IdempotencyKey = &idempotencyKey
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	if stream {
+		return c.llmStream(ctx, client, req, opts)
+	}
+
+	var resp *reliapi.ReliAPIResponse
+	if replay != "" {
+		resp, err = client.Replay(ctx, replay, reliapi.ReplayOverrides{Target: target, Model: model})
+	} else {
+		resp, err = client.ProxyLLM(ctx, req)
+	}
+	if err != nil {
+		return err
+	}
+	c.printMeta(resp.Meta, resp.IdempotencyKey)
+	if opts.json {
+		return c.printJSON(resp)
+	}
+	completion, err := resp.Completion()
+	if err != nil {
+		return err
+	}
+	if len(completion.Choices) == 0 {
+		return reliapi.ErrNoChoices
+	}
+	choice := completion.Choices[0]
+	if choice.Message.Content != "" || len(choice.ToolCalls) == 0 {
+		fmt.Fprintln(c.stdout, choice.Message.Content)
+	}
+	for _, call := range choice.ToolCalls {
+		fmt.Fprintf(c.stdout, "tool call %s: %s(%s)\n", call.ID, call.Function.Name, call.Function.Arguments)
+	}
+	return nil
+}
+
+// llmStream prints the deltas of a streamed completion as they arrive, or
+// each chunk as a JSON line with --json.
+func (c *cli) llmStream(ctx context.Context, client *reliapi.Client, req reliapi.LLMRequest, opts common) error {
+	s, err := client.ProxyLLMStream(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for {
+		chunk, err := s.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if !opts.json {
+				fmt.Fprintln(c.stdout)
+			}
+			return err
+		}
+		if opts.json {
+			if err := c.printJSONLine(chunk); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprint(c.stdout, chunk.Delta)
+	}
+	if !opts.json {
+		fmt.Fprintln(c.stdout)
+	}
+	meta := s.Meta()
+	c.printMeta(meta, s.IdempotencyKey())
+	usage := s.Usage()
+	fmt.Fprintf(c.stderr, "prompt_tokens=%d completion_tokens=%d\n", usage.PromptTokens, usage.CompletionTokens)
+	return nil
+}
+
+func (c *cli) http(args []string) error {
+	var (
+		opts           common
+		target, path   string
+		method         string
+		queries        listFlag
+		headers        listFlag
+		bodyFile       string
+		cache          optionalInt
+		idempotencyKey string
+		replay         string
+	)
+	fs := c.flags("http", &opts)
+	fs.StringVar(&target, "target", "", "target to send the request to (required)")
+	fs.StringVar(&replay, "replay", "", "`request_id` of a past request to run again (admin key); --target overrides its own")
+	fs.StringVar(&method, "method", http.MethodGet, "HTTP method")
+	fs.StringVar(&path, "path", "/", "path on the target")
+	fs.Var(&queries, "query", "query parameter as `name=value`, repeatable")
+	fs.Var(&headers, "header", "`header` as \"Name: value\", repeatable")
+	fs.StringVar(&bodyFile, "body-file", "", `file holding the request body; "-" reads stdin`)
+	fs.Var(&cache, "cache", "cache TTL in `seconds`; 0 bypasses the cache")
+	fs.StringVar(&idempotencyKey, "idempotency-key", "", "idempotency key of the request")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if replay != "" {
+		if name := flagSetBesides(fs, "replay", "target"); name != "" {
+			return c.flagError(fs, "--%s can't be used with --replay", name)
+		}
+	} else if target == "" {
+		return c.flagError(fs, "--target is required")
+	}
+
+	req := reliapi.HTTPRequest{Target: target, Method: strings.ToUpper(method), Path: path, Cache: cache.value}
+	if len(queries) > 0 {
+		req.Query = make(map[string]interface{}, len(queries))
+		for _, q := range queries {
+			name, value, ok := strings.Cut(q, "=")
+			if !ok {
+				return c.flagError(fs, "--query %q is not name=value", q)
+			}
+			// Repeated names become a list, sent as repeated parameters
+			switch prev := req.Query[name].(type) {
+			case nil:
+				req.Query[name] = value
+			case string:
+				req.Query[name] = []interface{}{prev, value}
+			case []interface{}:
+				req.Query[name] = append(prev, value)
+			}
+		}
+	}
+	if len(headers) > 0 {
+		req.Headers = make(map[string]string, len(headers))
+		for _, h := range headers {
+			name, value, ok := strings.Cut(h, ":")
+			if !ok {
+				return c.flagError(fs, "--header %q is not \"Name: value\"", h)
+			}
+			req.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	if bodyFile != "" {
+		var raw []byte
+		var err error
+		if bodyFile == "-" {
+			raw, err = io.ReadAll(c.stdin)
+		} else {
+			raw, err = os.ReadFile(bodyFile)
+		}
+		if err != nil {
+			return fmt.Errorf("read body: %w", err)
+		}
+		body := string(raw)
+		req.Body = &body
+	}
+	if idempotencyKey != "" {
+		req.IdempotencyKey = &idempotencyKey
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	var resp *reliapi.ReliAPIResponse
+	if replay != "" {
+		resp, err = client.Replay(ctx, replay, reliapi.ReplayOverrides{Target: target})
+	} else {
+		resp, err = client.ProxyHTTP(ctx, req)
+	}
+	if err != nil {
+		return err
+	}
+	c.printMeta(resp.Meta, resp.IdempotencyKey)
+	if opts.json {
+		return c.printJSON(resp)
+	}
+	upstream, err := reliapi.ToHTTPResponse(resp)
+	if err != nil {
+		return err
+	}
+	defer upstream.Body.Close()
+	fmt.Fprintf(c.stderr, "upstream: %s\n", upstream.Status)
+	if _, err := io.Copy(c.stdout, upstream.Body); err != nil {
+		return err
+	}
+	return nil
+}
+
+// flagSetBesides returns the name of a flag of fs given on the command
+// line other than the common flags and allowed, or "" if there is none.
+func flagSetBesides(fs *flag.FlagSet, allowed ...string) string {
+	var found string
+	fs.Visit(func(f *flag.Flag) {
+		if found != "" || f.Name == "json" || f.Name == "timeout" {
+			return
+		}
+		for _, name := range allowed {
+			if f.Name == name {
+				return
+			}
+		}
+		found = f.Name
+	})
+	return found
+}
@@ -1,7 +1,9 @@
 """YAML configuration loader for routes-based ReliAPI."""
+import hmac
+import os
 import yaml
 from pathlib import Path
-from typing import Any, Dict, List, Optional
+from typing import Any, Dict, List, Optional, Tuple
 
 from reliapi.config.schema import ReliAPIConfig
 
@@ -81,6 +83,65 @@ class ConfigLoader:
         
         return None
 
+    def get_monthly_budget_usd(self, tenant_name: Optional[str]) -> Optional[float]:
+        """Get the monthly LLM budget of a tenant, or the global one without a tenant."""
+        if tenant_name:
+            tenant = self.get_tenant(tenant_name)
+            return tenant.get("monthly_budget_usd") if tenant else None
+        return self.config.get("monthly_budget_usd")
+
+    def get_budget_alerts(self) -> Optional[Dict[str, Any]]:
+        """Get the budget_alerts config, None if it isn't set."""
+        return self.config.get("budget_alerts")
+
+    def get_api_key_limits(self, api_key: Optional[str]) -> Optional[Tuple[str, Dict[str, Any]]]:
+        """Find the api_keys entry of an API key.
+
+        Returns:
+            (name, config) if the key has limits configured, None otherwise
+        """
+        if not api_key:
+            return None
+        for name, key_config in (self.config.get("api_keys") or {}).items():
+            configured = key_config.get("api_key", "")
+            if configured.startswith("env:"):
+                configured = os.getenv(configured[4:]) or ""
+            if configured and hmac.compare_digest(configured.encode(), api_key.encode()):
+                return name, key_config
+        return None
+
+    def get_request_signing(self) -> Optional[Dict[str, Any]]:
+        """Get the request_signing config, None if it isn't set."""
+        return self.config.get("request_signing")
+
+    def get_maintenance(self) -> Optional[Dict[str, Any]]:
+        """Get the maintenance config, None if it isn't set."""
+        return self.config.get("maintenance")
+
+    def get_compression(self) -> Optional[Dict[str, Any]]:
+        """Get the compression config, None if it isn't set."""
+        return self.config.get("compression")
+
+    def get_cache_keys(self) -> Optional[Dict[str, Any]]:
+        """Get the cache_keys config, None if it isn't set."""
+        return self.config.get("cache_keys")
+
+    def get_cache_storage(self) -> Optional[Dict[str, Any]]:
+        """Get the cache_storage config, None if it isn't set."""
+        return self.config.get("cache_storage")
+
+    def get_latency_routes(self) -> Optional[Dict[str, Any]]:
+        """Get the latency routes (virtual auto:<name> targets) by name."""
+        return self.config.get("latency_routes")
+
+    def get_usage(self) -> Optional[Dict[str, Any]]:
+        """Get the usage config, None if it isn't set."""
+        return self.config.get("usage")
+
+    def get_conversations(self) -> Optional[Dict[str, Any]]:
+        """Get the conversations config, None if it isn't set."""
+        return self.config.get("conversations")
+
     def get_provider_key_pools(self) -> Optional[Dict[str, Any]]:
         """Get provider key pools configuration."""
         return self.config.get("provider_key_pools")
@@ -1,7 +1,14 @@
 """Pydantic schemas for ReliAPI configuration validation."""
-from typing import Dict, List, Optional
+import re
+from datetime import datetime
+from typing import Dict, List, Literal, Optional
 
-from pydantic import BaseModel, Field, field_validator
+from pydantic import BaseModel, Field, field_validator, model_validator
+
+from reliapi.core.faults import parse_faults
+from reliapi.core.transformations import check_transformation
+from reliapi.core.conversations import CONVERSATION_MAX_TURNS, CONVERSATION_TTL_S
+from reliapi.core.usage import DEFAULT_MAX_TAG_VALUES
 
 
 class CircuitConfig(BaseModel):
@@ -9,24 +16,195 @@ class CircuitConfig(BaseModel):
     
     error_threshold: int = Field(default=5, gt=0, description="Number of failures before opening circuit")
     cooldown_s: int = Field(default=60, gt=0, description="Seconds before attempting to close circuit")
+    scope: Literal["target", "model", "credential"] = Field(
+        default="target",
+        description=(
+            "What failures are counted per: the whole target, each model, or each named "
+            "credential. Every model or credential then opens and probes its own breaker"
+        ),
+    )
 
 
 class CacheConfig(BaseModel):
     """Cache configuration."""
     
     enabled: bool = Field(default=True, description="Enable caching")
-    ttl_s: int = Field(default=3600, gt=0, description="Time to live in seconds")
+    ttl_s: int = Field(default=3600, gt=0, description="Time to live in seconds of requests that set no cache TTL")
+    max_entries: Optional[int] = Field(
+        default=None,
+        gt=0,
+        description=(
+            "Most entries cached for this target, across tenants; the ones closest to expiring are "
+            "evicted to make room. Unbounded by default"
+        ),
+    )
+    stale_ttl_s: int = Field(
+        default=86400,
+        ge=0,
+        description=(
+            "How long expired entries stay available to stale_while_revalidate / stale_if_error "
+            "requests, and for revalidation of /proxy/http entries with an ETag or Last-Modified"
+        ),
+    )
+    stream_max_bytes: int = Field(
+        default=0,
+        ge=0,
+        description="Largest /proxy/http stream_response body to cache; 0 never caches streamed responses",
+    )
+    stream_replay_chunk_tokens: int = Field(
+        default=0,
+        ge=0,
+        description="Tokens per chunk when a cached LLM completion is replayed as a stream; 0 sends it in one chunk",
+    )
+    stream_replay_delay_ms: int = Field(
+        default=0,
+        ge=0,
+        le=1000,
+        description="Delay between the chunks of a replayed LLM completion",
+    )
+
+
+class RedactionConfig(BaseModel):
+    """Redaction of sensitive values in LLM prompts (see core.redaction)."""
+
+    enabled: bool = Field(default=True, description="Redact prompts sent to this target")
+    patterns: List[str] = Field(
+        default_factory=lambda: ["email", "phone", "credit_card"],
+        description="Built-in patterns to apply: email, phone, credit_card",
+    )
+    custom_patterns: Dict[str, str] = Field(
+        default_factory=dict,
+        description="Extra patterns by placeholder kind, e.g. {customer_id: 'cus_[0-9A-Za-z]{14}'}",
+    )
+    share_cache_entries: bool = Field(
+        default=False,
+        description=(
+            "Let requests that differ only in redacted values share a cache entry; by default a hash "
+            "of the original values is part of the cache key"
+        ),
+    )
+
+    @field_validator("patterns")
+    @classmethod
+    def validate_patterns(cls, v: List[str]) -> List[str]:
+        """Only built-in pattern names are allowed."""
+        unknown = sorted(set(v) - {"email", "phone", "credit_card"})
+        if unknown:
+            raise ValueError(f"Unknown redaction patterns: {', '.join(unknown)}")
+        return v
+
+    @field_validator("custom_patterns")
+    @classmethod
+    def validate_custom_patterns(cls, v: Dict[str, str]) -> Dict[str, str]:
+        """Custom patterns must be valid regular expressions."""
+        for kind, pattern in v.items():
+            try:
+                re.compile(pattern)
+            except re.error as e:
+                raise ValueError(f"Invalid redaction pattern for {kind}: {e}") from e
+        return v
+
+
+class AuditConfig(BaseModel):
+    """Audit capture of requests to a target (see core.audit)."""
+
+    capture: Literal["off", "metadata", "full"] = Field(
+        default="off",
+        description=(
+            "off keeps no records; metadata records each request and its upstream attempts; "
+            "full also keeps the bodies sent and received"
+        ),
+    )
+    max_body_bytes: int = Field(
+        default=65536, gt=0, le=1048576, description="Largest part of each body kept under full capture"
+    )
+
+
+class QueueConfig(BaseModel):
+    """Rate budget of a target, with priority queueing of LLM requests over it (see core.priority_queue)."""
+
+    max_qps: float = Field(..., gt=0, description="LLM requests per second sent to this target")
+    max_queue: int = Field(default=100, gt=0, le=10000, description="Most requests waiting for their turn")
+    timeout_ms: int = Field(
+        default=10000, gt=0, le=300000, description="How long a request waits unless it sets queue_timeout_ms"
+    )
+
+
+class UpstreamRateLimitConfig(BaseModel):
+    """Pacing of a target by the rate limit headers of its responses (see core.upstream_limits)."""
+
+    enabled: bool = Field(default=True, description="Hold requests while the upstream reports none remaining")
+    max_wait_ms: int = Field(
+        default=30000, ge=0, le=300000, description="Longest a request is held for the limit to reset; beyond it, send it anyway"
+    )
+
+
+class ModelCapabilityConfig(BaseModel):
+    """What a model of a target accepts, over the bundled table's entry (see core.model_capabilities).
+
+    Unset fields keep the table's values, or for a model it lacks, such as
+    a self-hosted one, the defaults of ModelCapabilities.
+    """
+
+    context_window: Optional[int] = Field(default=None, gt=0, description="Most prompt plus output tokens")
+    max_output_tokens: Optional[int] = Field(default=None, gt=0, description="Most tokens generated")
+    supports_tools: Optional[bool] = Field(default=None, description="Whether the model takes tools")
+    supports_vision: Optional[bool] = Field(default=None, description="Whether the model takes images")
+    supports_json_schema: Optional[bool] = Field(
+        default=None, description="Whether the model constrains output to a json_schema response_format"
+    )
+    supports_logprobs: Optional[bool] = Field(default=None, description="Whether the model returns token logprobs")
+    parameters: Optional[List[str]] = Field(
+        default=None, description="Sampling parameters accepted, of temperature, top_p and stop"
+    )
+    max_temperature: Optional[float] = Field(default=None, ge=0.0, le=2.0, description="Highest temperature accepted")
+
+    @field_validator("parameters")
+    @classmethod
+    def validate_parameters(cls, v: Optional[List[str]]) -> Optional[List[str]]:
+        unknown = sorted(set(v or []) - {"temperature", "top_p", "stop"})
+        if unknown:
+            raise ValueError(f"Unknown sampling parameters: {', '.join(unknown)}")
+        return v
+
+
+class AzureOpenAIConfig(BaseModel):
+    """Deployments of an Azure OpenAI resource, whose endpoint is the target's base_url (e.g. https://myres.openai.azure.com)."""
+
+    api_version: str = Field(
+        ..., min_length=1, description="api-version of every request, e.g. 2024-10-21 (streamed usage needs 2024-09-01 or later)"
+    )
+    deployments: Dict[str, str] = Field(
+        ..., min_length=1, description="Deployment name by the model requests ask for, e.g. {gpt-4o: prod-gpt4o}"
+    )
 
 
 class LLMConfig(BaseModel):
     """LLM-specific configuration."""
     
-    provider: Optional[str] = Field(default=None, description="Provider name (openai, anthropic, mistral)")
+    provider: Optional[str] = Field(
+        default=None, description="Provider name (openai, anthropic, mistral, gemini, azure_openai)"
+    )
     default_model: Optional[str] = Field(default=None, description="Default model name")
+    embedding_model: Optional[str] = Field(default=None, description="Default model for /proxy/embeddings")
     max_tokens: Optional[int] = Field(default=None, gt=0, description="Maximum tokens limit")
     temperature: Optional[float] = Field(default=None, ge=0.0, le=2.0, description="Temperature limit")
     soft_cost_cap_usd: Optional[float] = Field(default=None, ge=0.0, description="Soft cost cap (throttle if exceeded)")
     hard_cost_cap_usd: Optional[float] = Field(default=None, ge=0.0, description="Hard cost cap (reject if exceeded)")
+    structured_outputs: Optional[bool] = Field(
+        default=None,
+        description=(
+            "Whether the target's models constrain output to a json_schema response_format; "
+            "unset, known for the provider's models, and assumed for unknown ones"
+        ),
+    )
+    models: Optional[Dict[str, ModelCapabilityConfig]] = Field(
+        default=None,
+        description="Capabilities of the target's models by exact name, over the bundled table or for models it lacks",
+    )
+    azure: Optional[AzureOpenAIConfig] = Field(
+        default=None, description="api-version and deployments of an azure_openai provider"
+    )
     
     @field_validator("hard_cost_cap_usd")
     @classmethod
@@ -38,6 +216,13 @@ class LLMConfig(BaseModel):
                 raise ValueError(f"hard_cost_cap_usd ({v}) must be >= soft_cost_cap_usd ({soft_cap})")
         return v
 
+    @model_validator(mode="after")
+    def validate_azure(self) -> "LLMConfig":
+        """An azure_openai provider needs its deployments."""
+        if self.provider == "azure_openai" and self.azure is None:
+            raise ValueError("provider azure_openai needs azure: {api_version, deployments}")
+        return self
+
 
 class RetryPolicyConfig(BaseModel):
     """Retry policy configuration."""
@@ -57,17 +242,197 @@ class AuthConfig(BaseModel):
     prefix: Optional[str] = Field(default=None, description="Header prefix (e.g., 'Bearer ')")
 
 
+class ModelAliasVariant(BaseModel):
+    """A share of an alias's traffic."""
+
+    target: Optional[str] = Field(default=None, description="Target serving the variant (default: the alias's)")
+    model: str = Field(..., description="Model served")
+    weight: float = Field(..., gt=0, le=100, description="Percentage of the alias's requests")
+
+
+class ModelAlias(BaseModel):
+    """A model name remapped to a target and model (see core.model_aliases)."""
+
+    target: Optional[str] = Field(default=None, description="Target serving the alias (default: this one)")
+    model: Optional[str] = Field(default=None, description="Model served when there is no split")
+    split: Optional[List[ModelAliasVariant]] = Field(
+        default=None, description="Variants the requests are split between, by idempotency key"
+    )
+
+    @field_validator("split")
+    @classmethod
+    def validate_split(cls, v: Optional[List[ModelAliasVariant]]) -> Optional[List[ModelAliasVariant]]:
+        """The variants' weights add up to 100."""
+        if v is not None and abs(sum(variant.weight for variant in v) - 100) > 1e-6:
+            raise ValueError("Split weights must add up to 100")
+        return v
+
+    @model_validator(mode="after")
+    def validate_model(self) -> "ModelAlias":
+        """An alias names a model or splits between variants."""
+        if not self.model and not self.split:
+            raise ValueError("A model alias needs a model or a split")
+        return self
+
+
+class CredentialConfig(BaseModel):
+    """A named upstream credential of a target, rotated with the others by weight."""
+
+    name: str = Field(..., pattern=r"^[A-Za-z0-9_.-]{1,64}$", description="Name requests pin it by and Meta reports")
+    api_key: str = Field(..., description="API key (can be 'env:VAR_NAME' for environment variable)")
+    weight: float = Field(default=1.0, gt=0, description="Share of requests relative to the other credentials")
+    disabled: bool = Field(default=False, description="Keep it out of rotation until enabled at runtime")
+
+
+class FallbackResponseConfig(BaseModel):
+    """Static completion served when an LLM target and its fallbacks fail."""
+
+    content: str = Field(..., min_length=1, description="Text of the static completion")
+    finish_reason: str = Field(default="stop", description="finish_reason of the static completion")
+
+
+class PathRuleConfig(BaseModel):
+    """A path rewrite of a target's transformation."""
+
+    match: str = Field(..., min_length=1, description="Regular expression matched against the start of the path")
+    replace: str = Field(..., description="What the match is replaced by, with \\1 or \\g<name> for its groups")
+
+
+class TransformationConfig(BaseModel):
+    """Rewrites of /proxy/http requests to a target and of its responses."""
+
+    headers: Optional[Dict[str, str]] = Field(
+        default=None,
+        description=(
+            "Headers added to every request, replacing the caller's; values may use ${request_id}, "
+            "${key_id}, ${tenant}, ${target} and ${method}"
+        ),
+    )
+    path_rules: Optional[List[PathRuleConfig]] = Field(
+        default=None, description="Path rewrites; the first that matches is applied"
+    )
+    path_prefix: Optional[str] = Field(
+        default=None, description="Put in front of the path, after path_rules, e.g. /api/v2"
+    )
+    request_body: Optional[str] = Field(
+        default=None, description="Template text bodies are wrapped in, with ${body} for the caller's body"
+    )
+    response_extract: Optional[str] = Field(
+        default=None, description="Path of the value JSON response bodies are replaced by, e.g. $.data"
+    )
+
+    @model_validator(mode="after")
+    def validate_rules(self) -> "TransformationConfig":
+        """Templates, regular expressions and the extract path must be valid."""
+        check_transformation(self.model_dump())
+        return self
+
+
 class TargetConfig(BaseModel):
     """Target (upstream) configuration."""
     
     base_url: str = Field(..., description="Base URL for the target")
     timeout_ms: int = Field(default=20000, gt=0, le=300000, description="Request timeout in milliseconds")
+    max_timeout_ms: Optional[int] = Field(
+        default=None,
+        gt=0,
+        le=300000,
+        description="Largest per-request timeout_ms callers may ask for (default: 300000)",
+    )
+    idempotency_max_ttl_s: Optional[int] = Field(
+        default=None,
+        gt=0,
+        description="Largest per-request idempotency_ttl_s callers may ask for (default: 604800, 7 days)",
+    )
+    max_response_bytes: Optional[int] = Field(
+        default=None,
+        gt=0,
+        description="Largest /proxy/http upstream body returned unless a request sets its own (default: unlimited)",
+    )
     circuit: Optional[CircuitConfig] = Field(default_factory=CircuitConfig, description="Circuit breaker config")
     cache: Optional[CacheConfig] = Field(default_factory=CacheConfig, description="Cache config")
     llm: Optional[LLMConfig] = Field(default=None, description="LLM-specific config (if applicable)")
+    redaction: Optional[RedactionConfig] = Field(
+        default=None, description="Redact emails, phone numbers and other sensitive values from LLM prompts"
+    )
+    audit: Optional[AuditConfig] = Field(default=None, description="Audit records of requests to this target")
+    queue: Optional[QueueConfig] = Field(
+        default=None, description="Rate budget for LLM requests, queued by priority when exhausted"
+    )
+    upstream_rate_limit: Optional[UpstreamRateLimitConfig] = Field(
+        default_factory=UpstreamRateLimitConfig, description="Pacing by the upstream's X-RateLimit headers"
+    )
+    max_concurrency: Optional[int] = Field(
+        default=None, gt=0, le=10000, description="Most LLM requests in flight to this target at once (default: unlimited)"
+    )
+    concurrency_wait_ms: int = Field(
+        default=10000, gt=0, le=300000, description="How long a request waits for a slot unless it sets max_wait_ms"
+    )
+    model_aliases: Optional[Dict[str, ModelAlias]] = Field(
+        default=None, description="Model names resolved to a target and model, e.g. {default-small: {model: gpt-4o-mini}}"
+    )
     auth: Optional[AuthConfig] = Field(default=None, description="Authentication config")
+    credentials: Optional[List[CredentialConfig]] = Field(
+        default=None,
+        description=(
+            "Named API keys rotated by weight, sent in auth's header (default: Authorization: Bearer); "
+            "override auth and provider_key_pools"
+        ),
+    )
     fallback_targets: Optional[List[str]] = Field(default=None, description="Fallback target names (planned, not implemented)")
+    fallback_response: Optional[FallbackResponseConfig] = Field(
+        default=None,
+        description=(
+            "Static completion returned, at no cost, when an LLM request fails with a retryable "
+            "error after retries and fallbacks; never cached"
+        ),
+    )
     retry_matrix: Optional[Dict[str, RetryPolicyConfig]] = Field(default=None, description="Retry policies by error class")
+    forward_trace_context: bool = Field(
+        default=False,
+        description="Forward the caller's W3C traceparent/tracestate headers to this target",
+    )
+    allowed_methods: Optional[List[str]] = Field(
+        default=None,
+        description="HTTP methods /proxy/http may use against this target (default: any)",
+    )
+    allowed_paths: Optional[List[str]] = Field(
+        default=None,
+        description="Path patterns (fnmatch, e.g. '/v1/*') /proxy/http may call (default: any)",
+    )
+    allow_private_network: bool = Field(
+        default=False,
+        description=(
+            "Allow a base_url on a private network when registering through the /targets API, "
+            "and /proxy/http redirects to private networks"
+        ),
+    )
+    follow_redirects: bool = Field(
+        default=False,
+        description="Follow upstream redirects for /proxy/http (default: return 3xx responses as they are)",
+    )
+    max_redirects: int = Field(
+        default=5, ge=0, le=20, description="Most redirects to follow when follow_redirects is set"
+    )
+    transformation: Optional[TransformationConfig] = Field(
+        default=None,
+        description="Header injection, path rewrites and body templates applied to /proxy/http requests",
+    )
+
+    @field_validator("allowed_methods")
+    @classmethod
+    def normalize_methods(cls, v: Optional[List[str]]) -> Optional[List[str]]:
+        """Compare methods case-insensitively."""
+        return [m.upper() for m in v] if v is not None else None
+
+    @field_validator("credentials")
+    @classmethod
+    def validate_credentials(cls, v: Optional[List[CredentialConfig]]) -> Optional[List[CredentialConfig]]:
+        """Credential names are unique within a target."""
+        names = [c.name for c in v or []]
+        if len(names) != len(set(names)):
+            raise ValueError("credential names must be unique")
+        return v
 
 
 class RateLimitConfig(BaseModel):
@@ -122,6 +487,238 @@ class TenantConfig(BaseModel):
         default=None,
         description="Client profile name for this tenant (e.g., 'cursor_default')"
     )
+    monthly_budget_usd: Optional[float] = Field(
+        default=None,
+        ge=0.0,
+        description="LLM spend cap per calendar month (UTC). Requests whose estimate would exceed it are rejected"
+    )
+
+
+class ApiKeyConfig(BaseModel):
+    """Limits of one ReliAPI API key, e.g. a key handed to one team.
+
+    They apply to every request made with the key, on top of the limits of
+    its tenant.
+    """
+
+    api_key: str = Field(..., description="API key (can be 'env:VAR_NAME' for environment variable)")
+    monthly_budget_usd: Optional[float] = Field(
+        default=None,
+        ge=0.0,
+        description="LLM spend cap of the key per calendar month (UTC). Requests whose estimate would exceed it are rejected with KEY_BUDGET_EXCEEDED"
+    )
+    rate_limit_rpm: Optional[int] = Field(
+        default=None,
+        ge=1,
+        description="Requests per minute allowed with the key; more are rejected with RATE_LIMIT_RELIAPI"
+    )
+    alert_thresholds: Optional[List[float]] = Field(
+        default=None,
+        description="Fractions of monthly_budget_usd that fire a budget alert, overriding budget_alerts.thresholds for the key"
+    )
+    test: bool = Field(
+        default=False,
+        description="Non-production key: it may inject faults, with faults or the X-ReliAPI-Fault header, even when ENVIRONMENT is production"
+    )
+    faults: Optional[str] = Field(
+        default=None,
+        description="Faults injected into every request of a test key, e.g. 'latency=2000;p=0.5, error=CIRCUIT_OPEN;p=0.1'"
+    )
+
+    @field_validator("alert_thresholds")
+    @classmethod
+    def validate_alert_thresholds(cls, v: Optional[List[float]]) -> Optional[List[float]]:
+        """Thresholds are fractions of the budget."""
+        return _check_thresholds(v) if v is not None else v
+
+    @field_validator("faults")
+    @classmethod
+    def validate_faults(cls, v: Optional[str]) -> Optional[str]:
+        """faults must parse as a fault spec."""
+        if v is not None:
+            parse_faults(v)
+        return v
+
+    @model_validator(mode="after")
+    def validate_test_faults(self) -> "ApiKeyConfig":
+        """Only test keys inject faults."""
+        if self.faults and not self.test:
+            raise ValueError("faults are only allowed on keys with test: true")
+        return self
+
+
+def _check_thresholds(thresholds: List[float]) -> List[float]:
+    if any(not 0 < t <= 1 for t in thresholds):
+        raise ValueError("alert thresholds are fractions of the budget, above 0 and at most 1")
+    return sorted(set(thresholds))
+
+
+class BudgetAlertsConfig(BaseModel):
+    """When monthly budgets fire budget.threshold_reached alerts.
+
+    Alerts apply to the tenant budgets (monthly_budget_usd) and the API key
+    budgets alike; each threshold fires once per calendar month.
+    """
+
+    thresholds: List[float] = Field(
+        default_factory=lambda: [0.5, 0.8, 0.95],
+        min_length=1,
+        description="Fractions of a monthly budget at which an alert fires"
+    )
+    webhook_url: Optional[str] = Field(
+        default=None,
+        description="URL alerts are POSTed to as signed budget.threshold_reached events (needs RELIAPI_WEBHOOK_SECRET)"
+    )
+
+    @field_validator("thresholds")
+    @classmethod
+    def validate_thresholds(cls, v: List[float]) -> List[float]:
+        """Thresholds are fractions of the budget."""
+        return _check_thresholds(v)
+
+
+class SigningKeyConfig(BaseModel):
+    """A shared secret clients sign requests with, and the API key they act as."""
+
+    secret: str = Field(..., description="HMAC secret (can be 'env:VAR_NAME' for environment variable)")
+    api_key: str = Field(
+        ...,
+        description="API key a verified request acts as, resolving its tenant, tier and limits (can be 'env:VAR_NAME')"
+    )
+
+
+class RequestSigningConfig(BaseModel):
+    """HMAC request signing, accepted alongside X-API-Key."""
+
+    max_skew_s: int = Field(
+        default=300,
+        ge=1,
+        le=3600,
+        description="Largest difference, in seconds, between a request's timestamp and the proxy's clock"
+    )
+    keys: Dict[str, SigningKeyConfig] = Field(
+        default_factory=dict,
+        description="Signing keys by the id clients send in X-ReliAPI-Key-Id"
+    )
+
+
+class MaintenanceConfig(BaseModel):
+    """Maintenance mode, for proxy upgrades (see core.maintenance)."""
+
+    enabled: bool = Field(default=False, description="Answer requests with 503 MAINTENANCE")
+    read_only: bool = Field(default=False, description="Keep serving GET requests, refusing only the others")
+    retry_after_s: int = Field(default=60, ge=1, description="When clients should retry, sent as Retry-After")
+    message: str = Field(default="ReliAPI is down for maintenance", description="Message of the MAINTENANCE error")
+
+
+class CompressionConfig(BaseModel):
+    """Compression of request bodies beyond gzip and plain zstd."""
+
+    dictionaries: Dict[str, str] = Field(
+        default_factory=dict,
+        description=(
+            "zstd dictionaries by the id clients send in X-ReliAPI-Zstd-Dictionary, as paths to "
+            "dictionary files (e.g. made by the Go client's TrainDictionary)"
+        )
+    )
+
+
+class CacheKeysConfig(BaseModel):
+    """Migration of LLM cache entries to canonical cache keys."""
+
+    legacy_read_until: Optional[datetime] = Field(
+        default=None,
+        description=(
+            "Until then, LLM cache lookups that miss also try the key derived before canonical keys, "
+            "so entries cached by an earlier version are still served. Without it they are orphaned"
+        )
+    )
+
+
+class CacheTierConfig(BaseModel):
+    """Bounds of a cache tier; unset bounds are unlimited."""
+
+    max_entry_bytes: Optional[int] = Field(default=None, gt=0, description="Largest entry the tier admits")
+    max_entries: Optional[int] = Field(
+        default=None, gt=0, description="Entries the tier holds before its least recently used are evicted"
+    )
+    max_bytes: Optional[int] = Field(
+        default=None, gt=0, description="Bytes the tier holds before its least recently used entries are evicted"
+    )
+
+
+class LatencyRouteCandidate(BaseModel):
+    """A target a latency route may send its requests to."""
+
+    target: str = Field(..., description="Target name")
+    model: Optional[str] = Field(
+        default=None, description="Model sent to it (default: the request's, or the target's default)"
+    )
+
+
+class LatencyRouteConfig(BaseModel):
+    """A virtual "auto:<name>" target routed to its fastest healthy candidate
+    (see core.latency_routing)."""
+
+    candidates: List[LatencyRouteCandidate] = Field(..., min_length=1, description="Targets to route between")
+    metric: Literal["p50", "p95"] = Field(default="p50", description="Observed latency candidates are weighted by")
+    exploration: float = Field(
+        default=0.05, ge=0.0, le=0.5, description="Fraction of requests sent to a random healthy candidate"
+    )
+
+    @field_validator("candidates")
+    @classmethod
+    def validate_candidates(cls, v: List[LatencyRouteCandidate]) -> List[LatencyRouteCandidate]:
+        """Each target is a candidate once."""
+        targets = [candidate.target for candidate in v]
+        if len(set(targets)) != len(targets):
+            raise ValueError("Each target can be a candidate of a route once")
+        return v
+
+
+class CacheStorageConfig(BaseModel):
+    """Admission of responses to the cache, by size, and the capacity of its tiers."""
+
+    hot: CacheTierConfig = Field(
+        default_factory=CacheTierConfig,
+        description="Tier of the entries up to its max_entry_bytes",
+    )
+    large: Optional[CacheTierConfig] = Field(
+        default=None,
+        description=(
+            "Tier of the entries over hot.max_entry_bytes, evicted separately so they can't push out "
+            "small ones. Without it those entries are not cached"
+        ),
+    )
+
+
+class UsageConfig(BaseModel):
+    """Bounds of the usage report (GET /usage)."""
+
+    max_tag_values: int = Field(
+        default=DEFAULT_MAX_TAG_VALUES,
+        ge=1,
+        le=10000,
+        description=(
+            "Distinct values each tenant's tag key is counted under; later values are "
+            "folded into 16 hashed ones (~0 to ~f), so a tag carrying e.g. user IDs can't "
+            "grow the report without bound"
+        )
+    )
+
+
+class ConversationsConfig(BaseModel):
+    """Bounds of the histories kept for LLM requests with a conversation_id."""
+
+    ttl_s: int = Field(
+        default=CONVERSATION_TTL_S, gt=0, description="Seconds a conversation is kept after its last turn"
+    )
+    max_turns: int = Field(
+        default=CONVERSATION_MAX_TURNS,
+        ge=1,
+        le=10000,
+        description="Turns kept per conversation; older ones are dropped, except for their system messages",
+    )
 
 
 class ClientProfileConfig(BaseModel):
@@ -149,6 +746,51 @@ class ReliAPIConfig(BaseModel):
         default=None,
         description="Provider key pools for multi-key support. If present for a provider, overrides targets[provider].auth"
     )
+    monthly_budget_usd: Optional[float] = Field(
+        default=None,
+        ge=0.0,
+        description="LLM spend cap per calendar month (UTC) for requests without a tenant"
+    )
+    api_keys: Optional[Dict[str, ApiKeyConfig]] = Field(
+        default=None,
+        description="Per-key budgets and rate limits, by a name that identifies the key in errors and metrics"
+    )
+    budget_alerts: Optional[BudgetAlertsConfig] = Field(
+        default=None,
+        description="Budget alert thresholds and delivery. Without it alerts fire at 50%, 80% and 95% and are only listed at GET /budget/alerts"
+    )
+    request_signing: Optional[RequestSigningConfig] = Field(
+        default=None,
+        description="Keys of HMAC-signed requests (X-ReliAPI-Signature). Without it signed requests are rejected"
+    )
+    maintenance: Optional[MaintenanceConfig] = Field(
+        default=None,
+        description="Maintenance mode. Without it, or with enabled false, requests are served"
+    )
+    compression: Optional[CompressionConfig] = Field(
+        default=None,
+        description="zstd dictionaries of request bodies. Without it zstd bodies naming a dictionary are rejected with 415"
+    )
+    cache_keys: Optional[CacheKeysConfig] = Field(
+        default=None,
+        description="Migration window of LLM cache keys (see core.cache_key)"
+    )
+    cache_storage: Optional[CacheStorageConfig] = Field(
+        default=None,
+        description="Cache tiers and the size of entries each admits; without it every entry is admitted"
+    )
+    latency_routes: Optional[Dict[str, LatencyRouteConfig]] = Field(
+        default=None,
+        description="Virtual targets, requested as auto:<name>, routed to the fastest healthy of their candidates"
+    )
+    usage: Optional[UsageConfig] = Field(
+        default=None,
+        description="Usage report bounds. Without it each tag key is counted under at most 100 distinct values"
+    )
+    conversations: Optional[ConversationsConfig] = Field(
+        default=None,
+        description="Conversation history bounds. Without it histories are kept 24 hours and up to 100 turns"
+    )
     client_profiles: Optional[Dict[str, ClientProfileConfig]] = Field(
         default=None,
         description="Client profiles for different client types (e.g., cursor_default). Priority: X-Client header > tenant.profile > default"
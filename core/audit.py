@@ -0,0 +1,174 @@
+"""Audit records of proxied requests.
+
+A target's audit config (config.schema.AuditConfig) decides what is kept
+for each request made against it: nothing, the metadata of the request and
+of every upstream attempt, or that plus the bodies sent and received, cut
+to a size cap. Attempts are captured where the upstream call is made
+(core.http_client) into the capture the route opened with
+capture_attempts, so what is recorded is exactly what went over the wire.
+Like the usage ledger, records are process-local: each ReliAPI instance
+keeps those of the traffic it served.
+"""
+import threading
+from contextlib import contextmanager
+from contextvars import ContextVar
+from dataclasses import dataclass, field
+from datetime import datetime, timedelta, timezone
+from typing import Any, Dict, Iterator, List, Optional
+
+# Audit capture levels
+CAPTURE_OFF = "off"
+CAPTURE_METADATA = "metadata"
+CAPTURE_FULL = "full"
+
+# Default cap on each captured body under CAPTURE_FULL.
+DEFAULT_MAX_BODY_BYTES = 64 * 1024
+
+# Most records kept; the oldest are dropped first.
+MAX_RECORDS = 10000
+
+# Records older than this are dropped.
+RETENTION = timedelta(days=7)
+
+
+@dataclass
+class _Capture:
+    bodies: bool
+    max_body_bytes: int
+    attempts: List[Dict[str, Any]] = field(default_factory=list)
+
+
+_capture: ContextVar[Optional[_Capture]] = ContextVar("reliapi_audit_capture", default=None)
+
+
+@contextmanager
+def capture_attempts(config: Optional[Dict[str, Any]]) -> Iterator[Optional[List[Dict[str, Any]]]]:
+    """Collect the upstream attempts made inside the block under config.
+
+    Yields the list the attempts are appended to, or None when config
+    doesn't capture anything.
+    """
+    capture = (config or {}).get("capture", CAPTURE_OFF)
+    if capture == CAPTURE_OFF:
+        yield None
+        return
+    state = _Capture(
+        bodies=capture == CAPTURE_FULL,
+        max_body_bytes=(config or {}).get("max_body_bytes", DEFAULT_MAX_BODY_BYTES),
+    )
+    token = _capture.set(state)
+    try:
+        yield state.attempts
+    finally:
+        _capture.reset(token)
+
+
+def _clip(body: Optional[bytes], max_bytes: int) -> Dict[str, Any]:
+    if body is None:
+        return {"body": None, "body_bytes": 0, "body_truncated": False}
+    if isinstance(body, str):
+        body = body.encode()
+    return {
+        "body": body[:max_bytes].decode("utf-8", errors="replace"),
+        "body_bytes": len(body),
+        "body_truncated": len(body) > max_bytes,
+    }
+
+
+def record_attempt(
+    method: str,
+    url: str,
+    started: datetime,
+    duration_ms: int,
+    status_code: Optional[int] = None,
+    error: Optional[str] = None,
+    request_body: Optional[bytes] = None,
+    response_body: Optional[bytes] = None,
+) -> None:
+    """Add an upstream attempt to the current capture, if there is one.
+
+    Bodies are only kept under CAPTURE_FULL, each cut to the capture's
+    max_body_bytes; body_bytes is the size before the cut.
+    """
+    state = _capture.get()
+    if state is None:
+        return
+    attempt: Dict[str, Any] = {
+        "attempt": len(state.attempts) + 1,
+        "started_at": started.isoformat(),
+        "duration_ms": duration_ms,
+        "method": method,
+        "url": url,
+        "status_code": status_code,
+        "error": error,
+    }
+    if state.bodies:
+        attempt["request"] = _clip(request_body, state.max_body_bytes)
+        attempt["response"] = _clip(response_body, state.max_body_bytes)
+    state.attempts.append(attempt)
+
+
+def final_attempt(attempts: List[Dict[str, Any]]) -> Optional[int]:
+    """Number of the attempt whose response was returned: the last one
+    without an error, else the last one."""
+    for attempt in reversed(attempts):
+        if attempt["error"] is None:
+            return attempt["attempt"]
+    return attempts[-1]["attempt"] if attempts else None
+
+
+class AuditLog:
+    """In-memory audit records, indexed by request ID."""
+
+    def __init__(self, max_records: int = MAX_RECORDS):
+        self._records: Dict[str, Dict[str, Any]] = {}
+        self._max_records = max_records
+        self._lock = threading.Lock()
+
+    def store(self, record: Dict[str, Any], now: Optional[datetime] = None) -> None:
+        """Keep record, which must have request_id and created_at (ISO 8601)."""
+        now = now or datetime.now(timezone.utc)
+        with self._lock:
+            self._records[record["request_id"]] = record
+            cutoff = now - RETENTION
+            # Records are kept in insertion order, so the oldest come first
+            while self._records:
+                oldest = next(iter(self._records.values()))
+                if len(self._records) <= self._max_records and datetime.fromisoformat(oldest["created_at"]) >= cutoff:
+                    break
+                del self._records[oldest["request_id"]]
+
+    def get(self, request_id: str) -> Optional[Dict[str, Any]]:
+        """The record of request_id, if still kept."""
+        with self._lock:
+            return self._records.get(request_id)
+
+    def search(
+        self,
+        tenant: Optional[str],
+        start: datetime,
+        end: datetime,
+        target: Optional[str] = None,
+        all_tenants: bool = False,
+    ) -> List[Dict[str, Any]]:
+        """A tenant's records created in [start, end), oldest first.
+
+        all_tenants returns every tenant's records instead. target matches
+        the requested target or the one that served the request.
+        """
+        with self._lock:
+            records = list(self._records.values())
+        return sorted(
+            (
+                r for r in records
+                if start <= datetime.fromisoformat(r["created_at"]) < end
+                and (all_tenants or r["tenant"] == tenant)
+                and (target is None or target in (r["target"], r.get("served_by")))
+            ),
+            key=lambda r: (r["created_at"], r["request_id"]),
+        )
+
+    def reset(self) -> None:
+        """Forget all records."""
+        with self._lock:
+            self._records.clear()
@@ -0,0 +1,176 @@
+"""Monthly LLM spend tracking for budget caps."""
+import threading
+from collections import defaultdict
+from dataclasses import dataclass
+from datetime import date, datetime, timedelta, timezone
+from typing import Dict, List, Optional, Tuple
+
+# Days of spend the run rate is averaged over.
+RUN_RATE_DAYS = 7
+
+
+def month_bounds(now: datetime) -> Tuple[datetime, datetime]:
+    """Return the start of now's calendar month (UTC) and of the next one."""
+    start = datetime(now.year, now.month, 1, tzinfo=timezone.utc)
+    if now.month == 12:
+        return start, datetime(now.year + 1, 1, 1, tzinfo=timezone.utc)
+    return start, datetime(now.year, now.month + 1, 1, tzinfo=timezone.utc)
+
+
+@dataclass
+class BudgetReservation:
+    """An estimated cost held against a cap while its request is in flight;
+    see BudgetLedger.reserve."""
+
+    name: str
+    amount_usd: float
+
+
+class BudgetLedger:
+    """In-memory per-tenant LLM spend for the current calendar month (UTC).
+
+    Spend resets when a new month starts. The ledger is process-local, like
+    the circuit breakers: each ReliAPI instance enforces caps against the
+    spend it has seen. Spend per day is kept for the trailing RUN_RATE_DAYS
+    across month boundaries, for run_rate.
+
+    Requests hold their estimated cost with reserve while in flight, so
+    concurrent requests are checked against the spend of each other too,
+    and release it once their actual cost is recorded.
+    """
+
+    def __init__(self):
+        self._spent: Dict[str, float] = defaultdict(float)
+        self._period_start: Optional[datetime] = None
+        self._daily: Dict[str, Dict[date, float]] = defaultdict(dict)
+        self._first_day: Dict[str, date] = {}
+        self._reserved: Dict[str, float] = defaultdict(float)
+        self._overshoots: Dict[str, int] = defaultdict(int)
+        self._overshoot_usd: Dict[str, float] = defaultdict(float)
+        self._lock = threading.Lock()
+
+    def _roll(self, now: datetime) -> None:
+        start, _ = month_bounds(now)
+        if self._period_start != start:
+            self._spent.clear()
+            self._period_start = start
+
+    def record(self, tenant: Optional[str], cost_usd: float, now: Optional[datetime] = None) -> None:
+        """Add cost_usd to tenant's spend."""
+        now = now or datetime.now(timezone.utc)
+        with self._lock:
+            self._roll(now)
+            name = tenant or "default"
+            self._spent[name] += cost_usd
+            day = now.date()
+            days = self._daily[name]
+            days[day] = days.get(day, 0.0) + cost_usd
+            for old in [d for d in days if d <= day - timedelta(days=RUN_RATE_DAYS)]:
+                del days[old]
+            self._first_day.setdefault(name, day)
+
+    def reserve(
+        self, tenant: Optional[str], amount_usd: float, cap_usd: float, now: Optional[datetime] = None
+    ) -> Optional[BudgetReservation]:
+        """Hold amount_usd of tenant's cap_usd for a request about to be sent.
+
+        Returns None, holding nothing, when the month's spend and the
+        reservations outstanding leave less than amount_usd of the cap. An
+        amount equal to what is left passes.
+        """
+        now = now or datetime.now(timezone.utc)
+        name = tenant or "default"
+        with self._lock:
+            self._roll(now)
+            if self._spent.get(name, 0.0) + self._reserved.get(name, 0.0) + amount_usd > cap_usd:
+                return None
+            self._reserved[name] += amount_usd
+            return BudgetReservation(name, amount_usd)
+
+    def release(self, reservation: BudgetReservation, cost_usd: Optional[float] = None) -> None:
+        """Release a reservation once its request's actual cost_usd is
+        recorded, or without one when the request failed. A cost above the
+        reservation counts as an overshoot."""
+        with self._lock:
+            left = self._reserved.get(reservation.name, 0.0) - reservation.amount_usd
+            if left > 1e-12:
+                self._reserved[reservation.name] = left
+            else:
+                self._reserved.pop(reservation.name, None)
+            if cost_usd is not None and cost_usd > reservation.amount_usd:
+                self._overshoots[reservation.name] += 1
+                self._overshoot_usd[reservation.name] += cost_usd - reservation.amount_usd
+
+    def reserved(self, tenant: Optional[str]) -> float:
+        """Return the estimated cost tenant's requests in flight hold."""
+        with self._lock:
+            return self._reserved.get(tenant or "default", 0.0)
+
+    def overshoot(self, tenant: Optional[str]) -> Tuple[int, float]:
+        """Return how many of tenant's requests cost more than they reserved,
+        and by how much in total."""
+        with self._lock:
+            name = tenant or "default"
+            return self._overshoots.get(name, 0), self._overshoot_usd.get(name, 0.0)
+
+    def spent(self, tenant: Optional[str], now: Optional[datetime] = None) -> float:
+        """Return tenant's spend in the current month."""
+        now = now or datetime.now(timezone.utc)
+        with self._lock:
+            self._roll(now)
+            return self._spent.get(tenant or "default", 0.0)
+
+    def run_rate(self, tenant: Optional[str], now: Optional[datetime] = None) -> float:
+        """Return tenant's average daily spend over the trailing RUN_RATE_DAYS.
+
+        The days count from the first spend seen, for a ledger younger than
+        that.
+        """
+        now = now or datetime.now(timezone.utc)
+        name = tenant or "default"
+        with self._lock:
+            first_day = self._first_day.get(name)
+            if first_day is None:
+                return 0.0
+            today = now.date()
+            window = min(max((today - first_day).days + 1, 1), RUN_RATE_DAYS)
+            since = today - timedelta(days=window - 1)
+            spent = sum(cost for day, cost in self._daily[name].items() if since <= day <= today)
+            return spent / window
+
+    def projected(self, tenant: Optional[str], now: Optional[datetime] = None) -> float:
+        """Return tenant's spend by the end of the month at its run rate."""
+        now = now or datetime.now(timezone.utc)
+        _, reset_at = month_bounds(now)
+        days_left = (reset_at - now).total_seconds() / 86400
+        return self.spent(tenant, now) + self.run_rate(tenant, now) * days_left
+
+    def reset(self) -> None:
+        """Forget all spend."""
+        with self._lock:
+            self._spent.clear()
+            self._period_start = None
+            self._daily.clear()
+            self._first_day.clear()
+            self._reserved.clear()
+            self._overshoots.clear()
+            self._overshoot_usd.clear()
+
+
+class BudgetHolds:
+    """The reservations one request holds on budget ledgers until its cost
+    is known."""
+
+    def __init__(self):
+        self._held: List[Tuple[BudgetLedger, BudgetReservation]] = []
+        # The request's actual cost, once it has one.
+        self.cost_usd: Optional[float] = None
+
+    def add(self, ledger: BudgetLedger, reservation: BudgetReservation) -> None:
+        self._held.append((ledger, reservation))
+
+    def release(self) -> None:
+        """Release every reservation, against cost_usd if it is set."""
+        held, self._held = self._held, []
+        for ledger, reservation in held:
+            ledger.release(reservation, self.cost_usd)
@@ -0,0 +1,109 @@
+"""Budget alerts: thresholds of a monthly LLM budget, each fired once a month.
+
+A budget is a tenant's monthly_budget_usd (the global one outside
+multi-tenant mode) or an API key's. When spend crosses one of its
+thresholds, fractions of the cap such as 0.8, an alert records the spend,
+the cap and the spend projected for the end of the month at the trailing
+run rate (see BudgetLedger.run_rate). A threshold fires at most once per
+calendar month; several crossed at once fire together. Like the ledgers,
+alerts are process-local and kept in memory only.
+"""
+import threading
+from dataclasses import dataclass
+from datetime import datetime, timezone
+from typing import Any, Dict, List, Optional, Sequence, Tuple
+
+from reliapi.core.budget import month_bounds
+
+DEFAULT_THRESHOLDS = (0.5, 0.8, 0.95)
+
+# From this fraction of a cap on, responses report what remains of it.
+REMAINING_THRESHOLD = 0.8
+
+
+@dataclass(frozen=True)
+class BudgetAlertConfig:
+    """The thresholds budgets alert at and where alerts are delivered."""
+    thresholds: Tuple[float, ...] = DEFAULT_THRESHOLDS
+    # Alerts are POSTed here as budget.threshold_reached events, signed with
+    # webhook_secret, when both are set.
+    webhook_url: Optional[str] = None
+    webhook_secret: Optional[str] = None
+
+
+class BudgetAlertLog:
+    """The budget alerts that fired this month."""
+
+    def __init__(self) -> None:
+        # Alerts by (tenant, api_key name or None), oldest first
+        self._alerts: Dict[Tuple[str, Optional[str]], List[Dict[str, Any]]] = {}
+        self._period_start: Optional[datetime] = None
+        self._lock = threading.Lock()
+
+    def _roll(self, now: datetime) -> None:
+        start, _ = month_bounds(now)
+        if self._period_start != start:
+            self._alerts.clear()
+            self._period_start = start
+
+    def check(
+        self,
+        tenant: Optional[str],
+        api_key_name: Optional[str],
+        spent_usd: float,
+        cap_usd: float,
+        projected_usd: float,
+        run_rate_usd: float,
+        thresholds: Sequence[float] = DEFAULT_THRESHOLDS,
+        now: Optional[datetime] = None,
+    ) -> List[Dict[str, Any]]:
+        """Fire the thresholds spent_usd crossed that haven't fired this month.
+
+        api_key_name is set for a key's budget and None for the tenant's.
+        Returns the alerts fired, lowest threshold first.
+        """
+        now = now or datetime.now(timezone.utc)
+        if cap_usd <= 0:
+            return []
+        period_start, reset_at = month_bounds(now)
+        fired = []
+        with self._lock:
+            self._roll(now)
+            alerts = self._alerts.setdefault((tenant or "default", api_key_name), [])
+            done = {alert["threshold"] for alert in alerts}
+            for threshold in sorted(set(thresholds)):
+                if threshold in done or spent_usd < threshold * cap_usd:
+                    continue
+                alert = {
+                    "tenant": tenant,
+                    "api_key": api_key_name,
+                    "threshold": threshold,
+                    "spent_usd": spent_usd,
+                    "cap_usd": cap_usd,
+                    "projected_usd": projected_usd,
+                    "run_rate_usd_per_day": run_rate_usd,
+                    "period_start": period_start.isoformat(),
+                    "reset_at": reset_at.isoformat(),
+                    "fired_at": now.isoformat(),
+                }
+                alerts.append(alert)
+                fired.append(alert)
+        return fired
+
+    def list(
+        self, tenant: Optional[str], api_key_name: Optional[str] = None, now: Optional[datetime] = None
+    ) -> List[Dict[str, Any]]:
+        """This month's alerts of tenant's budget and, with api_key_name, the key's."""
+        now = now or datetime.now(timezone.utc)
+        with self._lock:
+            self._roll(now)
+            found = list(self._alerts.get((tenant or "default", None), []))
+            if api_key_name:
+                found += self._alerts.get((tenant or "default", api_key_name), [])
+        return sorted(found, key=lambda alert: alert["fired_at"])
+
+    def reset(self) -> None:
+        """Forget all alerts."""
+        with self._lock:
+            self._alerts.clear()
+            self._period_start = None
@@ -2,12 +2,130 @@
 import hashlib
 import json
 import logging
-from typing import Any, Dict, Optional
+import time
+from contextlib import contextmanager
+from contextvars import ContextVar
+from dataclasses import dataclass
+from typing import Any, Dict, Iterator, List, Optional, Tuple
 
 import redis
 
 logger = logging.getLogger(__name__)
 
+# Keys deleted per round trip when purging a target.
+INVALIDATE_BATCH_SIZE = 500
+
+# Bookkeeping fields stored alongside each cached value and stripped on read.
+_CACHED_AT = "_cached_at"
+_FRESH_TTL = "_ttl_s"
+
+# How long a background refresh of a stale entry may hold its lock.
+REFRESH_LOCK_TTL_S = 60
+
+# Most recent entries a semantic cache lookup compares against, per scope.
+SEMANTIC_INDEX_SIZE = 200
+
+# Cache tiers: entries up to the hot tier's max_entry_bytes go to the hot
+# tier, larger ones to the large tier if there is one, and are otherwise
+# not cached. Each tier evicts only its own entries, so large responses
+# can't push out the small, frequently hit ones.
+HOT_TIER = "hot"
+LARGE_TIER = "large"
+
+# Why entries were dropped before their TTL passed, or were never stored.
+EVICTED_MAX_ENTRIES = "max_entries"
+EVICTED_MAX_BYTES = "max_bytes"
+EVICTED_TARGET_MAX_ENTRIES = "target_max_entries"
+EVICTED_EXPIRED = "expired"
+EVICTION_CAUSES = (EVICTED_MAX_ENTRIES, EVICTED_MAX_BYTES, EVICTED_TARGET_MAX_ENTRIES, EVICTED_EXPIRED)
+REJECTED_TOO_LARGE = "too_large"
+
+# Least recently used entries considered per eviction round trip.
+EVICTION_BATCH_SIZE = 100
+
+# Most cache keys whose uses are counted for the hot-key listing, per
+# tenant; the least used beyond it are forgotten.
+HOT_KEYS_MAX = 1000
+
+
+@dataclass(frozen=True)
+class CacheTier:
+    """Bounds of a cache tier; None is unbounded.
+
+    max_entry_bytes is the largest entry the tier admits, max_entries and
+    max_bytes its capacity, kept by evicting its least recently used
+    entries.
+    """
+
+    max_entry_bytes: Optional[int] = None
+    max_entries: Optional[int] = None
+    max_bytes: Optional[int] = None
+
+    def admits(self, size: int) -> bool:
+        return (self.max_entry_bytes is None or size <= self.max_entry_bytes) and (
+            self.max_bytes is None or size <= self.max_bytes
+        )
+
+
+_reads_skipped: ContextVar[bool] = ContextVar("reliapi_cache_reads_skipped", default=False)
+
+
+@contextmanager
+def skip_cache_reads() -> Iterator[None]:
+    """Make every cache lookup inside the block a miss. Responses are still
+    stored, so the block refreshes the entries it would have read."""
+    token = _reads_skipped.set(True)
+    try:
+        yield
+    finally:
+        _reads_skipped.reset(token)
+
+
+def make_cache_key_hash(
+    method: str,
+    url: str,
+    headers: Optional[Dict[str, str]] = None,
+    body: Optional[bytes] = None,
+    query: Optional[Dict[str, Any]] = None,
+    key_override: Optional[Dict[str, Any]] = None,
+) -> str:
+    """Return the tenant-independent hash identifying a cache entry.
+
+    This is the value echoed to clients as meta.cache_key. When key_override
+    is given it replaces the request-derived fields (query, headers, body);
+    method and URL are always part of the key.
+    """
+    if key_override is not None:
+        key_data: Dict[str, Any] = {
+            "method": method.upper(),
+            "url": url,
+            "override": key_override,
+        }
+    else:
+        # Significant headers for caching (exclude auth, trace, etc.)
+        significant_headers = {}
+        if headers:
+            for h in ["Accept", "Accept-Language", "Content-Type"]:
+                if h in headers:
+                    significant_headers[h] = headers[h]
+
+        # Sort query params for consistent keys
+        # json.dumps(sort_keys=True) handles sorting recursively, so we don't need manual sorting here.
+        # We also pass dicts directly to avoid double serialization which is slow.
+        key_data = {
+            "method": method.upper(),
+            "url": url,
+            "query": query or {},
+            "headers": significant_headers,
+        }
+        
+        # For POST/PUT/PATCH with body, include body hash
+        if body and method.upper() in ["POST", "PUT", "PATCH"]:
+            key_data["body_hash"] = hashlib.sha256(body).hexdigest()[:16]
+
+    key_str = json.dumps(key_data, sort_keys=True)
+    return hashlib.sha256(key_str.encode()).hexdigest()
+
 
 class Cache:
     """Universal cache wrapper for HTTP requests.
@@ -16,13 +134,29 @@ class Cache:
     Cache key is based on method, URL, and significant headers.
     """
 
-    def __init__(self, redis_url: str, key_prefix: str = "reliapi"):
+    def __init__(
+        self,
+        redis_url: str,
+        key_prefix: str = "reliapi",
+        legacy_keys_until: Optional[float] = None,
+        hot_tier: Optional[CacheTier] = None,
+        large_tier: Optional[CacheTier] = None,
+    ):
         """
         Args:
             redis_url: Redis connection URL
             key_prefix: Prefix for cache keys
+            legacy_keys_until: Unix time until which lookups that miss also
+                try the request's legacy key (see core.cache_key)
+            hot_tier: Bounds of the tier of small entries (unbounded by default)
+            large_tier: Bounds of the tier of entries the hot tier doesn't
+                admit; without it they are not cached
         """
         self.key_prefix = key_prefix
+        self.legacy_keys_until = legacy_keys_until
+        self.tiers: Dict[str, CacheTier] = {HOT_TIER: hot_tier or CacheTier()}
+        if large_tier is not None:
+            self.tiers[LARGE_TIER] = large_tier
         try:
             self.client = redis.from_url(redis_url, decode_responses=True)
             self.client.ping()
@@ -41,6 +175,8 @@ class Cache:
         body: Optional[bytes] = None,
         query: Optional[Dict[str, Any]] = None,
         tenant: Optional[str] = None,
+        key_override: Optional[Dict[str, Any]] = None,
+        cache_key_hash: Optional[str] = None,
     ) -> str:
         """Generate cache key from request parameters.
         
@@ -48,37 +184,45 @@ class Cache:
         
         Args:
             tenant: Tenant name for multi-tenant isolation (optional)
+            key_override: Explicit key data replacing the request-derived fields (optional)
+            cache_key_hash: Key hash computed by the caller, replacing all of the above
+                but tenant (LLM requests, see core.cache_key)
         """
-        # Significant headers for caching (exclude auth, trace, etc.)
-        significant_headers = {}
-        if headers:
-            for h in ["Accept", "Accept-Language", "Content-Type"]:
-                if h in headers:
-                    significant_headers[h] = headers[h]
+        if cache_key_hash is None:
+            cache_key_hash = make_cache_key_hash(method, url, headers, body, query, key_override)
+        return self._hash_key(cache_key_hash, tenant)
 
-        # Sort query params for consistent keys
-        # json.dumps(sort_keys=True) handles sorting recursively, so we don't need manual sorting here.
-        # We also pass dicts directly to avoid double serialization which is slow.
-        key_data = {
-            "method": method.upper(),
-            "url": url,
-            "query": query or {},
-            "headers": significant_headers,
-        }
-        
-        # For POST/PUT/PATCH with body, include body hash
-        if body and method.upper() in ["POST", "PUT", "PATCH"]:
-            key_data["body_hash"] = hashlib.sha256(body).hexdigest()[:16]
+    def _legacy_readable(self, legacy_key_hash: Optional[str]) -> bool:
+        """Whether a lookup that missed should try legacy_key_hash."""
+        return bool(
+            legacy_key_hash and self.legacy_keys_until is not None and time.time() < self.legacy_keys_until
+        )
 
-        key_str = json.dumps(key_data, sort_keys=True)
-        cache_key_hash = hashlib.sha256(key_str.encode()).hexdigest()
-        
+    def _hash_key(self, cache_key_hash: str, tenant: Optional[str] = None) -> str:
+        """Redis key of the entry with the given cache key hash."""
         # Multi-tenant isolation: include tenant in cache key
         if tenant:
             return f"{self.key_prefix}:tenant:{tenant}:cache:{cache_key_hash}"
         else:
             return f"{self.key_prefix}:cache:{cache_key_hash}"
 
+    @staticmethod
+    def _unpack(raw: str) -> Dict[str, Any]:
+        """Decode a stored entry into {"value", "age_s", "stale"}.
+
+        Entries written before freshness bookkeeping existed are treated as
+        fresh with unknown age.
+        """
+        value = json.loads(raw)
+        cached_at = value.pop(_CACHED_AT, None)
+        fresh_ttl = value.pop(_FRESH_TTL, None)
+        age_s = None
+        stale = False
+        if cached_at is not None:
+            age_s = max(0, int(time.time() - cached_at))
+            stale = fresh_ttl is not None and age_s >= fresh_ttl
+        return {"value": value, "age_s": age_s, "stale": stale}
+
     def get(
         self,
         method: str,
@@ -88,6 +232,9 @@ class Cache:
         query: Optional[Dict[str, Any]] = None,
         allow_post: bool = False,
         tenant: Optional[str] = None,
+        key_override: Optional[Dict[str, Any]] = None,
+        cache_key_hash: Optional[str] = None,
+        legacy_key_hash: Optional[str] = None,
     ) -> Optional[Dict[str, Any]]:
         """Get cached response if available.
         
@@ -98,8 +245,11 @@ class Cache:
             body: Request body (for POST/PUT/PATCH)
             query: Query parameters
             allow_post: Allow caching POST requests (for LLM proxy)
+            key_override: Explicit key data (cache_key / cache_vary requests)
+            cache_key_hash: Key hash computed by the caller (LLM requests)
+            legacy_key_hash: Key tried on a miss during the legacy key window
         """
-        if not self.enabled or not self.client:
+        if not self.enabled or not self.client or _reads_skipped.get():
             return None
 
         # Only cache GET/HEAD by default, or POST if explicitly allowed
@@ -107,12 +257,22 @@ class Cache:
             return None
 
         try:
-            key = self._make_key(method, url, headers, body, query, tenant=tenant)
+            key = self._make_key(
+                method, url, headers, body, query, tenant=tenant, key_override=key_override, cache_key_hash=cache_key_hash
+            )
             cached = self.client.get(key)
+            if not cached and self._legacy_readable(legacy_key_hash):
+                key = self._hash_key(legacy_key_hash, tenant)
+                cached = self.client.get(key)
             if cached:
                 # Edge case: JSON deserialization may fail if cached value is corrupted.
                 # This is handled by the try/except block below.
-                return json.loads(cached)
+                entry = self._unpack(cached)
+                # Entries kept past their TTL for stale modes are misses here
+                if entry["stale"]:
+                    return None
+                self._touch(key)
+                return entry["value"]
         except json.JSONDecodeError as e:
             # Edge case: Cached value is corrupted or not valid JSON.
             # Delete the corrupted key to prevent future errors.
@@ -139,8 +299,16 @@ class Cache:
         query: Optional[Dict[str, Any]] = None,
         allow_post: bool = False,
         tenant: Optional[str] = None,
-    ) -> None:
+        key_override: Optional[Dict[str, Any]] = None,
+        target: Optional[str] = None,
+        stale_ttl_s: int = 0,
+        cache_key_hash: Optional[str] = None,
+        max_entries: Optional[int] = None,
+    ) -> bool:
         """Cache response with TTL.
+
+        The entry goes to the first tier that admits its size, see
+        CacheTier; one no tier admits is not stored.
         
         Args:
             method: HTTP method
@@ -151,16 +319,27 @@ class Cache:
             ttl_s: Time to live in seconds
             query: Query parameters
             allow_post: Allow caching POST requests (for LLM proxy)
+            key_override: Explicit key data (cache_key / cache_vary requests)
+            target: Target name, indexed so the entry can be purged per target
+            stale_ttl_s: Keep the entry this long past ttl_s for stale cache modes
+            cache_key_hash: Key hash computed by the caller (LLM requests)
+            max_entries: Most entries kept for target, across tenants; the
+                ones closest to expiring are evicted to make room
+
+        Returns:
+            Whether the entry was stored.
         """
         if not self.enabled or not self.client:
-            return
+            return False
 
         # Only cache GET/HEAD by default, or POST if explicitly allowed
         if method.upper() not in ["GET", "HEAD"] and not (allow_post and method.upper() == "POST"):
-            return
+            return False
 
         try:
-            key = self._make_key(method, url, headers, body, query, tenant=tenant)
+            key = self._make_key(
+                method, url, headers, body, query, tenant=tenant, key_override=key_override, cache_key_hash=cache_key_hash
+            )
             # Atomic SETEX: sets key, value, and TTL in a single operation
             # This is a single Redis command, so it's guaranteed atomic.
             #
@@ -172,9 +351,438 @@ class Cache:
             # 3. TTL expiration during write: SETEX sets both value and TTL atomically,
             #    so key will have correct TTL even if it expires during the operation.
             # 4. Memory pressure: Redis may evict keys, but this is handled by cache miss logic.
-            self.client.setex(key, ttl_s, json.dumps(value))
+            now = time.time()
+            lifetime_s = ttl_s + max(0, stale_ttl_s)
+            stored = json.dumps({**value, _CACHED_AT: now, _FRESH_TTL: ttl_s})
+            size = len(stored.encode())
+            tier = next((name for name, bounds in self.tiers.items() if bounds.admits(size)), None)
+            if tier is None:
+                self.client.hincrby(self._stats_key(), f"rejected:{REJECTED_TOO_LARGE}", 1)
+                logger.debug(f"Cache set: {size} byte entry not admitted by any tier")
+                return False
+            self.client.setex(key, lifetime_s, stored)
+            if target:
+                # The index is scored by entry expiry: members of expired
+                # entries are pruned on every write, and the index itself
+                # only lives as long as its longest-lived entry.
+                index_key = self._target_index_key(target)
+                self.client.zadd(index_key, {key: now + lifetime_s})
+                self.client.zremrangebyscore(index_key, "-inf", now)
+                self.client.expire(index_key, lifetime_s, nx=True)
+                self.client.expire(index_key, lifetime_s, gt=True)
         except Exception as e:
             logger.warning(f"Cache set error (graceful degradation): {e}", exc_info=True)
+            return False
+
+        try:
+            if target and max_entries:
+                self._cap_target(target, max_entries, key)
+            self._admit(tier, key, size, now, now + lifetime_s)
+        except Exception as e:
+            # The entry is stored; only the tier bookkeeping is behind
+            logger.warning(f"Cache tier bookkeeping error (graceful degradation): {e}", exc_info=True)
+        return True
+
+    def _stats_key(self) -> str:
+        """Redis hash of the cache's byte counts, evictions and rejections."""
+        return f"{self.key_prefix}:cache_stats"
+
+    def _tier_keys(self, tier: str) -> Tuple[str, str, str]:
+        """Redis keys of a tier's entries: scored by last use, scored by
+        expiry, and their sizes."""
+        base = f"{self.key_prefix}:cache_tier:{tier}"
+        return base, f"{base}:expiry", f"{base}:sizes"
+
+    def _touch(self, key: str) -> None:
+        """Mark key as just used, for least recently used eviction."""
+        try:
+            pipe = self.client.pipeline()
+            now = time.time()
+            for tier in self.tiers:
+                pipe.zadd(self._tier_keys(tier)[0], {key: now}, xx=True)
+            pipe.execute()
+        except Exception as e:
+            logger.warning(f"Cache touch error (graceful degradation): {e}", exc_info=True)
+
+    def _unindex(self, keys: List[str], cause: Optional[str] = None) -> None:
+        """Drop keys from the bookkeeping of their tier, counting them as
+        evicted for cause if given."""
+        if not keys:
+            return
+        pipe = self.client.pipeline()
+        for tier in self.tiers:
+            pipe.hmget(self._tier_keys(tier)[2], keys)
+        found = pipe.execute()
+        pipe = self.client.pipeline()
+        for tier, sizes in zip(self.tiers, found):
+            gone = [(key, int(size)) for key, size in zip(keys, sizes) if size is not None]
+            if not gone:
+                continue
+            by_use, by_expiry, sizes_key = self._tier_keys(tier)
+            names = [key for key, _ in gone]
+            pipe.hdel(sizes_key, *names)
+            pipe.zrem(by_use, *names)
+            pipe.zrem(by_expiry, *names)
+            pipe.hincrby(self._stats_key(), f"{tier}:bytes", -sum(size for _, size in gone))
+            if cause:
+                pipe.hincrby(self._stats_key(), f"{tier}:evictions:{cause}", len(gone))
+        pipe.execute()
+
+    def _forget(self, keys: List[str]) -> None:
+        """Unindex deleted entries, which aren't evictions."""
+        try:
+            self._unindex(keys)
+        except Exception as e:
+            logger.warning(f"Cache tier bookkeeping error (graceful degradation): {e}", exc_info=True)
+
+    def _prune_expired(self, tier: str, now: float) -> None:
+        """Unindex the tier's entries Redis expired."""
+        expired = self.client.zrangebyscore(self._tier_keys(tier)[1], "-inf", now)
+        self._unindex(list(expired), EVICTED_EXPIRED)
+
+    def _admit(self, tier: str, key: str, size: int, now: float, expires_at: float) -> None:
+        """Index a stored entry in tier and evict the tier's least recently
+        used entries while it's over capacity.
+
+        Like the rest of the cache this isn't atomic across workers: under
+        concurrent writes a tier may briefly hold a few entries too many.
+        """
+        # An overwritten entry is counted again at its new size, maybe in
+        # the other tier
+        self._unindex([key])
+        self._prune_expired(tier, now)
+        by_use, by_expiry, sizes_key = self._tier_keys(tier)
+        pipe = self.client.pipeline()
+        pipe.hset(sizes_key, key, size)
+        pipe.zadd(by_use, {key: now})
+        pipe.zadd(by_expiry, {key: expires_at})
+        pipe.hincrby(self._stats_key(), f"{tier}:bytes", size)
+        pipe.hincrby(self._stats_key(), f"{tier}:admitted", 1)
+        pipe.zcard(by_use)
+        results = pipe.execute()
+        entries, total_bytes = int(results[-1]), int(results[-3])
+
+        bounds = self.tiers[tier]
+
+        def over() -> Optional[str]:
+            if bounds.max_entries is not None and entries > bounds.max_entries:
+                return EVICTED_MAX_ENTRIES
+            if bounds.max_bytes is not None and total_bytes > bounds.max_bytes:
+                return EVICTED_MAX_BYTES
+            return None
+
+        while over():
+            candidates = [k for k in self.client.zrange(by_use, 0, EVICTION_BATCH_SIZE - 1) if k != key]
+            if not candidates:
+                return
+            sizes = self.client.hmget(sizes_key, candidates)
+            victims: Dict[str, List[str]] = {}
+            for candidate, victim_size in zip(candidates, sizes):
+                cause = over()
+                if cause is None:
+                    break
+                victims.setdefault(cause, []).append(candidate)
+                entries -= 1
+                total_bytes -= int(victim_size or 0)
+            for cause, names in victims.items():
+                self.client.delete(*names)
+                self._unindex(names, cause)
+
+    def _cap_target(self, target: str, max_entries: int, key: str) -> None:
+        """Evict the target's entries closest to expiring beyond max_entries,
+        keeping key."""
+        index_key = self._target_index_key(target)
+        excess = int(self.client.zcard(index_key)) - max_entries
+        if excess <= 0:
+            return
+        victims = [k for k in self.client.zrange(index_key, 0, excess) if k != key][:excess]
+        if victims:
+            self.client.delete(*victims)
+            self.client.zrem(index_key, *victims)
+            self._unindex(victims, EVICTED_TARGET_MAX_ENTRIES)
+
+    def stats(self) -> Dict[str, Any]:
+        """Entries, bytes and bounds of each tier, with evictions by cause
+        and entries not admitted, counted since the stats were last reset.
+
+        Entries Redis evicted itself (maxmemory) are only noticed once their
+        TTL passes.
+        """
+        tiers: Dict[str, Any] = {}
+        evictions = {cause: 0 for cause in EVICTION_CAUSES}
+        rejected = {REJECTED_TOO_LARGE: 0}
+        if not self.enabled or not self.client:
+            return {"enabled": False, "tiers": tiers, "evictions": evictions, "rejected": rejected}
+
+        try:
+            now = time.time()
+            for tier in self.tiers:
+                self._prune_expired(tier, now)
+            counters = self.client.hgetall(self._stats_key())
+            pipe = self.client.pipeline()
+            for tier in self.tiers:
+                pipe.zcard(self._tier_keys(tier)[0])
+            entries = pipe.execute()
+        except Exception as e:
+            logger.warning(f"Cache stats error (graceful degradation): {e}", exc_info=True)
+            return {"enabled": True, "tiers": tiers, "evictions": evictions, "rejected": rejected}
+
+        def counter(field: str) -> int:
+            return int(counters.get(field, 0))
+
+        for (tier, bounds), count in zip(self.tiers.items(), entries):
+            tier_evictions = {cause: counter(f"{tier}:evictions:{cause}") for cause in EVICTION_CAUSES}
+            for cause, n in tier_evictions.items():
+                evictions[cause] += n
+            tiers[tier] = {
+                "entries": int(count),
+                "bytes": max(0, counter(f"{tier}:bytes")),
+                "admitted": counter(f"{tier}:admitted"),
+                "max_entry_bytes": bounds.max_entry_bytes,
+                "max_entries": bounds.max_entries,
+                "max_bytes": bounds.max_bytes,
+                "evictions": tier_evictions,
+            }
+        rejected[REJECTED_TOO_LARGE] = counter(f"rejected:{REJECTED_TOO_LARGE}")
+        return {"enabled": True, "tiers": tiers, "evictions": evictions, "rejected": rejected}
+
+    def _hot_keys(self, tenant: Optional[str] = None) -> Tuple[str, str]:
+        """Redis keys of a tenant's hot-key listing: cache key hashes scored
+        by uses, and the requests that use them."""
+        base = f"{self.key_prefix}:tenant:{tenant}:cache_hot" if tenant else f"{self.key_prefix}:cache_hot"
+        return base, f"{base}:requests"
+
+    def record_use(
+        self, cache_key_hash: str, kind: str, request: Dict[str, Any], tenant: Optional[str] = None
+    ) -> None:
+        """Count a response served or stored under cache_key_hash for the
+        hot-key listing, with the request body it answered, kept to replay
+        the request later. Only the HOT_KEYS_MAX most used keys are kept."""
+        if not self.enabled or not self.client:
+            return
+
+        by_uses, requests = self._hot_keys(tenant)
+        try:
+            pipe = self.client.pipeline()
+            pipe.zincrby(by_uses, 1, cache_key_hash)
+            pipe.hset(requests, cache_key_hash, json.dumps({"kind": kind, "request": request}))
+            pipe.zcard(by_uses)
+            overflow = int(pipe.execute()[-1]) - HOT_KEYS_MAX
+            if overflow > 0:
+                dropped = self.client.zrange(by_uses, 0, overflow - 1)
+                if dropped:
+                    pipe = self.client.pipeline()
+                    pipe.zrem(by_uses, *dropped)
+                    pipe.hdel(requests, *dropped)
+                    pipe.execute()
+        except Exception as e:
+            logger.warning(f"Cache hot-key bookkeeping error (graceful degradation): {e}", exc_info=True)
+
+    def hot_keys(self, limit: int, tenant: Optional[str] = None) -> List[Dict[str, Any]]:
+        """A tenant's most used cache entries, most used first: up to limit
+        of {"cache_key", "kind", "request", "uses", "size_bytes"}. Keys whose
+        entry is no longer cached are forgotten."""
+        if not self.enabled or not self.client or limit <= 0:
+            return []
+
+        by_uses, requests = self._hot_keys(tenant)
+        hot: List[Dict[str, Any]] = []
+        start = 0
+        try:
+            while len(hot) < limit:
+                ranked = self.client.zrevrange(by_uses, start, start + limit - 1, withscores=True)
+                if not ranked:
+                    break
+                start += len(ranked)
+                names = [name for name, _ in ranked]
+                keys = [self._hash_key(name, tenant) for name in names]
+                pipe = self.client.pipeline()
+                pipe.hmget(requests, names)
+                for key in keys:
+                    pipe.exists(key)
+                for tier in self.tiers:
+                    pipe.hmget(self._tier_keys(tier)[2], keys)
+                found = pipe.execute()
+                bodies, exists, tier_sizes = found[0], found[1:1 + len(keys)], found[1 + len(keys):]
+                gone = []
+                for i, ((name, uses), body) in enumerate(zip(ranked, bodies)):
+                    if not exists[i] or body is None:
+                        gone.append(name)
+                        continue
+                    if len(hot) == limit:
+                        continue
+                    recorded = json.loads(body)
+                    size = next((int(sizes[i]) for sizes in tier_sizes if sizes[i] is not None), None)
+                    hot.append({
+                        "cache_key": name,
+                        "kind": recorded["kind"],
+                        "request": recorded["request"],
+                        "uses": int(uses),
+                        "size_bytes": size,
+                    })
+                if gone:
+                    pipe = self.client.pipeline()
+                    pipe.zrem(by_uses, *gone)
+                    pipe.hdel(requests, *gone)
+                    pipe.execute()
+                    start -= len(gone)
+        except Exception as e:
+            logger.warning(f"Cache hot_keys error (graceful degradation): {e}", exc_info=True)
+        return hot
+
+    def _semantic_index_key(self, scope_hash: str, tenant: Optional[str] = None) -> str:
+        """Redis list of the embeddings of a semantic cache scope's recent entries."""
+        if tenant:
+            return f"{self.key_prefix}:tenant:{tenant}:semantic:{scope_hash}"
+        return f"{self.key_prefix}:semantic:{scope_hash}"
+
+    def add_semantic_entry(
+        self,
+        scope_hash: str,
+        cache_key_hash: str,
+        embedding: List[float],
+        ttl_s: int,
+        tenant: Optional[str] = None,
+    ) -> None:
+        """Index the entry cache_key_hash under scope_hash by its prompt's embedding.
+
+        Only the SEMANTIC_INDEX_SIZE most recent entries of a scope are kept,
+        and each is dropped from lookups once its ttl_s has passed.
+        """
+        if not self.enabled or not self.client:
+            return
+
+        try:
+            index_key = self._semantic_index_key(scope_hash, tenant)
+            member = {"key": cache_key_hash, "embedding": embedding, "expires_at": time.time() + ttl_s}
+            self.client.lpush(index_key, json.dumps(member))
+            self.client.ltrim(index_key, 0, SEMANTIC_INDEX_SIZE - 1)
+            self.client.expire(index_key, ttl_s, nx=True)
+            self.client.expire(index_key, ttl_s, gt=True)
+        except Exception as e:
+            logger.warning(f"Cache semantic index error (graceful degradation): {e}", exc_info=True)
+
+    def semantic_candidates(self, scope_hash: str, tenant: Optional[str] = None) -> List[Tuple[str, List[float]]]:
+        """Return (cache key hash, embedding) of the scope's unexpired entries, newest first."""
+        if not self.enabled or not self.client or _reads_skipped.get():
+            return []
+
+        try:
+            members = self.client.lrange(self._semantic_index_key(scope_hash, tenant), 0, -1)
+        except Exception as e:
+            logger.warning(f"Cache semantic lookup error (graceful degradation): {e}", exc_info=True)
+            return []
+        now = time.time()
+        candidates = []
+        for raw in members:
+            try:
+                member = json.loads(raw)
+            except json.JSONDecodeError:
+                continue
+            if member.get("expires_at", 0) > now:
+                candidates.append((member["key"], member["embedding"]))
+        return candidates
+
+    def _target_index_key(self, target: str) -> str:
+        """Redis sorted set of a target's cache keys (all tenants), scored by expiry."""
+        return f"{self.key_prefix}:cache_index:{target}"
+
+    def delete_key(
+        self, cache_key_hash: str, tenant: Optional[str] = None, legacy_key_hash: Optional[str] = None
+    ) -> int:
+        """Delete the entry identified by a cache key hash (meta.cache_key),
+        and the one under legacy_key_hash if given.
+
+        Returns:
+            Number of entries removed.
+        """
+        if not self.enabled or not self.client:
+            return 0
+
+        keys = [self._hash_key(cache_key_hash, tenant)]
+        if legacy_key_hash:
+            keys.append(self._hash_key(legacy_key_hash, tenant))
+        try:
+            removed = int(self.client.delete(*keys))
+        except Exception as e:
+            logger.warning(f"Cache delete error (graceful degradation): {e}", exc_info=True)
+            return 0
+        self._forget(keys)
+        return removed
+
+    def get_entry(
+        self, cache_key_hash: str, tenant: Optional[str] = None, legacy_key_hash: Optional[str] = None
+    ) -> Optional[Dict[str, Any]]:
+        """Look up an entry by cache key hash, including expired ones, and on
+        a miss by legacy_key_hash during the legacy key window.
+
+        Returns:
+            {"value": cached value, "age_s": age in seconds or None,
+            "stale": whether the entry is past its TTL}, or None on a miss.
+        """
+        if not self.enabled or not self.client or _reads_skipped.get():
+            return None
+
+        try:
+            cached = self.client.get(self._hash_key(cache_key_hash, tenant))
+            if not cached and self._legacy_readable(legacy_key_hash):
+                cached = self.client.get(self._hash_key(legacy_key_hash, tenant))
+            if cached:
+                return self._unpack(cached)
+        except Exception as e:
+            logger.warning(f"Cache get_entry error (graceful degradation): {e}", exc_info=True)
+        return None
+
+    def acquire_refresh_lock(self, cache_key_hash: str, tenant: Optional[str] = None) -> bool:
+        """Claim the right to refresh a stale entry.
+
+        Only one caller across all workers gets True until the lock is
+        released or REFRESH_LOCK_TTL_S passes.
+        """
+        if not self.enabled or not self.client:
+            return False
+
+        lock_key = f"{self._hash_key(cache_key_hash, tenant)}:refresh"
+        try:
+            return bool(self.client.set(lock_key, "1", nx=True, ex=REFRESH_LOCK_TTL_S))
+        except Exception as e:
+            logger.warning(f"Cache refresh lock error (graceful degradation): {e}", exc_info=True)
+            return False
+
+    def release_refresh_lock(self, cache_key_hash: str, tenant: Optional[str] = None) -> None:
+        """Release a lock taken with acquire_refresh_lock."""
+        if not self.enabled or not self.client:
+            return
+
+        try:
+            self.client.delete(f"{self._hash_key(cache_key_hash, tenant)}:refresh")
+        except Exception as e:
+            logger.warning(f"Cache refresh unlock error (graceful degradation): {e}", exc_info=True)
+
+    def invalidate_target(self, target: str) -> int:
+        """Delete every entry cached for target, across all tenants.
+
+        Returns:
+            Number of entries removed.
+        """
+        if not self.enabled or not self.client:
+            return 0
+
+        index_key = self._target_index_key(target)
+        removed = 0
+        try:
+            # Delete in batches and only unindex what was deleted, so keys
+            # indexed by concurrent writes are kept for the next round.
+            while True:
+                keys = self.client.zrange(index_key, 0, INVALIDATE_BATCH_SIZE - 1)
+                if not keys:
+                    return removed
+                removed += int(self.client.delete(*keys))
+                self.client.zrem(index_key, *keys)
+                self._forget(keys)
+        except Exception as e:
+            logger.warning(f"Cache invalidate_target error (graceful degradation): {e}", exc_info=True)
+            return removed
 
     def invalidate(self, pattern: str) -> None:
         """Invalidate cache entries matching pattern."""
@@ -189,3 +797,14 @@ class Cache:
             logger.warning(f"Cache invalidate error (graceful degradation): {e}", exc_info=True)
 
 
+
+    def ping(self) -> bool:
+        """Report whether the cache's Redis answers, for readiness checks."""
+        if not self.client:
+            return False
+
+        try:
+            return bool(self.client.ping())
+        except Exception as e:
+            logger.warning(f"Cache ping error: {e}")
+            return False
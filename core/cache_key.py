@@ -0,0 +1,109 @@
+"""Canonical cache keys of LLM requests.
+
+An LLM response is cached under the hash of the request's canonical
+document: the fields of the request body that reach the upstream call
+(target, model, messages, sampling parameters, tools and the output
+schema), so idempotency_key, cache, timeout_ms and the like never split
+an entry. The document is serialized with sorted keys, no insignificant
+whitespace, null members dropped and numbers in one form (1.0 is 1), so
+bodies that differ only in how they were serialized share a key. The Go
+client computes the same key with reliapi.CanonicalCacheKey.
+
+Keys derived the older way, from the serialized upstream payload, can
+still be read during a migration window (Cache.legacy_keys_until) so
+entries cached before the change aren't all orphaned at once.
+"""
+import hashlib
+import json
+import math
+from typing import Any, Dict, List, Optional
+
+# Fields a request's cache_vary may name; cache_key drops them all.
+VARY_FIELDS = ("messages", "max_tokens", "temperature", "top_p", "stop")
+
+
+def _number(value: float) -> str:
+    """A number as the Go client writes it: integral values without a
+    fraction, others in their shortest round-trip form."""
+    if isinstance(value, int):
+        return str(value)
+    if math.isnan(value) or math.isinf(value):
+        raise ValueError(f"{value} is not a JSON number")
+    if value.is_integer() and abs(value) < 1e16:
+        return str(int(value))
+    return repr(value)
+
+
+def canonical_json(value: Any) -> str:
+    """value serialized with sorted keys, compact separators, ASCII-only
+    strings, null object members dropped and numbers normalized."""
+    if value is None:
+        return "null"
+    if isinstance(value, bool):
+        return "true" if value else "false"
+    if isinstance(value, (int, float)):
+        return _number(value)
+    if isinstance(value, str):
+        return json.dumps(value)
+    if isinstance(value, dict):
+        members = (
+            f"{json.dumps(str(key))}:{canonical_json(item)}"
+            for key, item in sorted(value.items(), key=lambda kv: str(kv[0]))
+            if item is not None
+        )
+        return "{" + ",".join(members) + "}"
+    if isinstance(value, (list, tuple)):
+        return "[" + ",".join(canonical_json(item) for item in value) + "]"
+    raise TypeError(f"{type(value).__name__} is not JSON serializable")
+
+
+def llm_cache_document(
+    target: str,
+    model: Optional[str],
+    messages: List[Dict[str, Any]],
+    max_tokens: Optional[int] = None,
+    temperature: Optional[float] = None,
+    top_p: Optional[float] = None,
+    stop: Optional[List[str]] = None,
+    tools: Optional[List[Dict[str, Any]]] = None,
+    tool_choice: Optional[Any] = None,
+    response_format: Optional[Dict[str, Any]] = None,
+    output_schema: Optional[Dict[str, Any]] = None,
+    cache_key: Optional[str] = None,
+    cache_vary: Optional[List[str]] = None,
+) -> Dict[str, Any]:
+    """The fields of an LLM request body its cache key is derived from.
+
+    An explicit cache_key replaces the VARY_FIELDS, and cache_vary keeps
+    only those it names; target, model, tools and the output schema always
+    take part.
+    """
+    document: Dict[str, Any] = {
+        "target": target,
+        "model": model,
+        "tools": tools,
+        "tool_choice": tool_choice,
+        "response_format": response_format,
+        "output_schema": output_schema,
+    }
+    fields = {
+        "messages": messages,
+        "max_tokens": max_tokens,
+        "temperature": temperature,
+        "top_p": top_p,
+        "stop": stop,
+    }
+    if cache_key is not None:
+        document["cache_key"] = cache_key
+    elif cache_vary is not None:
+        vary = sorted(set(cache_vary))
+        document["cache_vary"] = vary
+        document.update({name: fields.get(name) for name in vary})
+    else:
+        document.update(fields)
+    return document
+
+
+def canonical_cache_key(document: Dict[str, Any]) -> str:
+    """The hex SHA-256 of an LLM request's canonical document."""
+    return hashlib.sha256(("llm\n" + canonical_json(document)).encode()).hexdigest()
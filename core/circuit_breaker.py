@@ -2,7 +2,7 @@
 import threading
 import time
 from collections import defaultdict
-from typing import Dict
+from typing import Any, Callable, Dict, List, Optional
 
 
 class CircuitBreaker:
@@ -14,62 +14,113 @@ class CircuitBreaker:
     concurrent requests may update the same upstream's failure count.
     """
 
-    def __init__(self, failures_to_open: int = 3, open_ttl_s: int = 60):
+    def __init__(
+        self,
+        failures_to_open: int = 3,
+        open_ttl_s: int = 60,
+        on_change: Optional[Callable[[str, str], None]] = None,
+    ):
         """
         Args:
             failures_to_open: Number of consecutive failures before opening circuit
             open_ttl_s: Time in seconds before attempting to close circuit again
+            on_change: Called with the upstream and its new state, "open" or
+                "closed", when a circuit opens or an open one closes
         """
         self.failures_to_open = failures_to_open
         self.open_ttl_s = open_ttl_s
+        self.on_change = on_change
         self.failure_counts: Dict[str, int] = defaultdict(int)
         self.opened_at: Dict[str, float] = {}
+        self.last_failure_at: Dict[str, float] = {}
         self._lock = threading.Lock()  # Thread-safe lock for async context
 
+    def _changed(self, upstream: str, state: str) -> None:
+        # Called without the lock held, so on_change may read the breaker
+        if self.on_change:
+            self.on_change(upstream, state)
+
     def record_success(self, upstream: str) -> None:
         """Reset failure count on success."""
         with self._lock:
             self.failure_counts[upstream] = 0
-            if upstream in self.opened_at:
-                del self.opened_at[upstream]
+            closed = self.opened_at.pop(upstream, None) is not None
+        if closed:
+            self._changed(upstream, "closed")
 
     def record_failure(self, upstream: str) -> None:
         """Record a failure and check if circuit should open."""
+        opened = False
         with self._lock:
             self.failure_counts[upstream] += 1
+            self.last_failure_at[upstream] = time.time()
             if self.failure_counts[upstream] >= self.failures_to_open:
+                opened = upstream not in self.opened_at
                 self.opened_at[upstream] = time.time()
+        if opened:
+            self._changed(upstream, "open")
+
+    def _expire(self, upstream: str) -> bool:
+        """Auto-close the circuit of upstream after its TTL; called with the
+        lock held. Returns whether it closed."""
+        opened_time = self.opened_at.get(upstream)
+        if opened_time is None or time.time() - opened_time < self.open_ttl_s:
+            return False
+        self.failure_counts[upstream] = 0
+        del self.opened_at[upstream]
+        return True
 
     def is_open(self, upstream: str) -> bool:
         """Check if circuit is open for upstream."""
         with self._lock:
-            if upstream not in self.opened_at:
-                return False
-
-            opened_time = self.opened_at[upstream]
-            if time.time() - opened_time >= self.open_ttl_s:
-                # Auto-close after TTL
-                self.failure_counts[upstream] = 0
-                del self.opened_at[upstream]
-                return False
-
-            return True
+            closed = self._expire(upstream)
+            is_open = upstream in self.opened_at
+        if closed:
+            self._changed(upstream, "closed")
+        return is_open
 
     def get_state(self, upstream: str) -> str:
         """Get circuit state: 'closed', 'open', or 'half-open'."""
         with self._lock:
-            # Check if circuit is open (inline logic to avoid deadlock)
+            closed = self._expire(upstream)
             if upstream in self.opened_at:
-                opened_time = self.opened_at[upstream]
-                if time.time() - opened_time >= self.open_ttl_s:
-                    # Auto-close after TTL
-                    self.failure_counts[upstream] = 0
-                    del self.opened_at[upstream]
-                else:
-                    return "open"
-            
-            if self.failure_counts[upstream] > 0:
-                return "half-open"
-            return "closed"
+                state = "open"
+            elif self.failure_counts[upstream] > 0:
+                state = "half-open"
+            else:
+                state = "closed"
+        if closed:
+            self._changed(upstream, "closed")
+        return state
+
+    def snapshot(self, upstream: str) -> Dict[str, Any]:
+        """Describe the circuit of upstream for the status endpoint.
 
+        Times are Unix timestamps; next_probe_at is when an open circuit lets
+        the next request through, and None otherwise.
+        """
+        state = self.get_state(upstream)
+        with self._lock:
+            opened_at: Optional[float] = self.opened_at.get(upstream)
+            return {
+                "state": state,
+                "failure_count": self.failure_counts.get(upstream, 0),
+                "last_failure_at": self.last_failure_at.get(upstream),
+                "next_probe_at": opened_at + self.open_ttl_s if opened_at is not None else None,
+                "failures_to_open": self.failures_to_open,
+                "open_ttl_s": self.open_ttl_s,
+            }
+
+    def upstreams(self) -> List[str]:
+        """The upstreams the breaker has tracked, sorted."""
+        with self._lock:
+            return sorted(set(self.failure_counts) | set(self.opened_at) | set(self.last_failure_at))
 
+    def reset(self, upstream: str) -> None:
+        """Close the circuit of upstream and forget its failures."""
+        with self._lock:
+            self.failure_counts[upstream] = 0
+            closed = self.opened_at.pop(upstream, None) is not None
+            self.last_failure_at.pop(upstream, None)
+        if closed:
+            self._changed(upstream, "closed")
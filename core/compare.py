@@ -0,0 +1,22 @@
+"""Similarity of two completions, for A/B comparisons of models and prompts."""
+import re
+from difflib import SequenceMatcher
+
+# Words, and every other non-space character on its own
+_TOKEN = re.compile(r"\w+|[^\w\s]")
+
+
+def tokenize(text: str) -> list:
+    """text as lower-case word and punctuation tokens."""
+    return _TOKEN.findall(text.lower())
+
+
+def token_similarity(a: str, b: str) -> float:
+    """How alike two texts are, from 0 to 1: twice the number of tokens in
+    their longest common runs over the total number of tokens (see
+    difflib.SequenceMatcher.ratio), so word order counts. Two empty texts
+    are identical."""
+    tokens_a, tokens_b = tokenize(a or ""), tokenize(b or "")
+    if not tokens_a and not tokens_b:
+        return 1.0
+    return round(SequenceMatcher(None, tokens_a, tokens_b, autojunk=False).ratio(), 4)
@@ -0,0 +1,246 @@
+"""Compressed request and response bodies.
+
+CompressionMiddleware decodes gzip (and, with the zstandard package, zstd)
+request bodies sent to the proxy endpoints with a Content-Encoding header,
+and gzips JSON responses for clients that send Accept-Encoding: gzip.
+Streamed responses (SSE and raw HTTP streams) are never compressed, since
+compressing them would hold events back until a block fills.
+
+A zstd body may name, in X-ReliAPI-Zstd-Dictionary, the dictionary it was
+compressed with (the compression.dictionaries config). One naming a
+dictionary the proxy doesn't have, or zstd without the zstandard package,
+is answered with 415 so clients fall back to gzip.
+
+A body that does not decode is answered with a 400 BAD_REQUEST envelope
+instead of reaching the route; decoded bodies are capped at
+MAX_DECODED_BYTES so a small compressed body can't expand without bound.
+"""
+import gzip
+import json
+import zlib
+from typing import Callable, Dict, Optional, Tuple
+
+try:
+    import zstandard
+except ImportError:  # pragma: no cover - optional dependency
+    zstandard = None
+
+# Paths (with or without the /v1 prefix) whose request bodies may be
+# compressed.
+COMPRESSED_REQUEST_PATHS = ("/proxy/llm", "/proxy/http")
+
+# Largest request body accepted after decoding.
+MAX_DECODED_BYTES = 128 * 1024 * 1024
+
+# Responses smaller than this are sent uncompressed: gzip would not save
+# enough to pay for itself.
+MIN_RESPONSE_BYTES = 1024
+
+
+# Header naming the zstd dictionary of a request body.
+DICTIONARY_HEADER = b"x-reliapi-zstd-dictionary"
+
+
+class BodyDecodeError(Exception):
+    """A request body that does not match its Content-Encoding."""
+
+    status_code = 400
+
+
+class UnsupportedEncodingError(BodyDecodeError):
+    """A request body in an encoding, or with a dictionary, this deployment
+    can't decode."""
+
+    status_code = 415
+
+
+def decode_body(body: bytes, encoding: str, dictionary: Optional[bytes] = None) -> bytes:
+    """Decode body sent with Content-Encoding encoding, zstd with the
+    contents of dictionary if given."""
+    if encoding == "gzip":
+        decoder = zlib.decompressobj(16 + zlib.MAX_WBITS)
+        try:
+            data = decoder.decompress(body, MAX_DECODED_BYTES + 1)
+        except zlib.error as e:
+            raise BodyDecodeError(f"Request body is not valid gzip: {e}") from None
+        if len(data) > MAX_DECODED_BYTES:
+            raise BodyDecodeError(f"Decoded request body is larger than {MAX_DECODED_BYTES} bytes")
+        if not decoder.eof:
+            raise BodyDecodeError("Request body is not valid gzip: truncated stream")
+        return data
+    if encoding == "zstd":
+        if zstandard is None:
+            raise UnsupportedEncodingError("zstd request bodies are not supported by this deployment")
+        try:
+            if dictionary is not None:
+                decompressor = zstandard.ZstdDecompressor(dict_data=zstandard.ZstdCompressionDict(dictionary))
+            else:
+                decompressor = zstandard.ZstdDecompressor()
+            reader = decompressor.stream_reader(body)
+            data = reader.read(MAX_DECODED_BYTES + 1)
+        except zstandard.ZstdError as e:
+            raise BodyDecodeError(f"Request body is not valid zstd: {e}") from None
+        if len(data) > MAX_DECODED_BYTES:
+            raise BodyDecodeError(f"Decoded request body is larger than {MAX_DECODED_BYTES} bytes")
+        return data
+    raise BodyDecodeError(f"Unsupported Content-Encoding '{encoding}'; use gzip or zstd")
+
+
+def _header(scope, name: bytes) -> Optional[str]:
+    for key, value in scope.get("headers", []):
+        if key.lower() == name:
+            return value.decode("latin-1")
+    return None
+
+
+def _accepts_gzip(accept_encoding: Optional[str]) -> bool:
+    """Whether Accept-Encoding allows gzip (q=0 refuses it)."""
+    for item in (accept_encoding or "").split(","):
+        coding, _, params = item.strip().partition(";")
+        if coding.strip().lower() in ("gzip", "*"):
+            q = params.strip()
+            if not q.startswith("q="):
+                return True
+            try:
+                return float(q[2:]) > 0
+            except ValueError:
+                return False
+    return False
+
+
+def _error_response(scope, message: str, status: int = 400) -> Tuple[dict, bytes]:
+    body = json.dumps(
+        {
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": "BAD_REQUEST",
+                "message": message,
+                "retryable": False,
+                "target": None,
+                "status_code": status,
+            },
+            "meta": {
+                "target": None,
+                "cache_hit": False,
+                "retries": 0,
+                "duration_ms": 0,
+                "request_id": _header(scope, b"x-request-id") or "unknown",
+                "trace_id": _header(scope, b"x-trace-id"),
+            },
+        }
+    ).encode()
+    start = {
+        "type": "http.response.start",
+        "status": status,
+        "headers": [(b"content-type", b"application/json"), (b"content-length", str(len(body)).encode())],
+    }
+    return start, body
+
+
+class CompressionMiddleware:
+    """ASGI middleware decoding request bodies and gzipping responses."""
+
+    def __init__(self, app, get_dictionaries: Optional[Callable[[], Dict[str, bytes]]] = None):
+        self.app = app
+        # Called per request, since dictionaries are loaded at startup
+        self.get_dictionaries = get_dictionaries or dict
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            await self.app(scope, receive, send)
+            return
+
+        encoding = (_header(scope, b"content-encoding") or "identity").strip().lower()
+        if encoding != "identity" and scope["path"].endswith(COMPRESSED_REQUEST_PATHS):
+            chunks = []
+            while True:
+                message = await receive()
+                if message["type"] == "http.disconnect":
+                    return
+                chunks.append(message.get("body", b""))
+                if not message.get("more_body", False):
+                    break
+            try:
+                body = decode_body(b"".join(chunks), encoding, self._dictionary(scope, encoding))
+            except BodyDecodeError as e:
+                start, error = _error_response(scope, str(e), e.status_code)
+                await send(start)
+                await send({"type": "http.response.body", "body": error})
+                return
+            headers = [
+                (k, v) for k, v in scope["headers"] if k.lower() not in (b"content-encoding", b"content-length")
+            ]
+            headers.append((b"content-length", str(len(body)).encode()))
+            scope = {**scope, "headers": headers}
+            receive = _replay(body, receive)
+
+        if not _accepts_gzip(_header(scope, b"accept-encoding")):
+            await self.app(scope, receive, send)
+            return
+        await self.app(scope, receive, _GzipSender(send))
+
+
+    def _dictionary(self, scope, encoding: str) -> Optional[bytes]:
+        """The dictionary a zstd body names, None if it names none."""
+        dict_id = _header(scope, DICTIONARY_HEADER)
+        if encoding != "zstd" or dict_id is None:
+            return None
+        dictionary = self.get_dictionaries().get(dict_id)
+        if dictionary is None:
+            raise UnsupportedEncodingError(f"Unknown zstd dictionary '{dict_id}'")
+        return dictionary
+
+
+def _replay(body: bytes, receive):
+    """A receive delivering the decoded body, then waiting on the client as
+    receive would (streaming responses listen for its disconnect)."""
+    delivered = False
+
+    async def replay():
+        nonlocal delivered
+        if delivered:
+            return await receive()
+        delivered = True
+        return {"type": "http.request", "body": body, "more_body": False}
+
+    return replay
+
+
+class _GzipSender:
+    """Wraps send to gzip a response sent as a single body message."""
+
+    def __init__(self, send):
+        self.send = send
+        self.start = None
+
+    async def __call__(self, message):
+        if message["type"] == "http.response.start":
+            self.start = message
+            return
+        if message["type"] != "http.response.body" or self.start is None:
+            await self.send(message)
+            return
+
+        start, self.start = self.start, None
+        headers = {k.lower(): v for k, v in start.get("headers", [])}
+        body = message.get("body", b"")
+        compressible = (
+            not message.get("more_body", False)
+            and b"content-encoding" not in headers
+            and not headers.get(b"content-type", b"").startswith(b"text/event-stream")
+            and len(body) >= MIN_RESPONSE_BYTES
+        )
+        if not compressible:
+            await self.send(start)
+            await self.send(message)
+            return
+        compressed = gzip.compress(body, compresslevel=6)
+        new_headers = [(k, v) for k, v in start.get("headers", []) if k.lower() != b"content-length"]
+        new_headers += [
+            (b"content-encoding", b"gzip"),
+            (b"content-length", str(len(compressed)).encode()),
+            (b"vary", b"Accept-Encoding"),
+        ]
+        await self.send({**start, "headers": new_headers})
+        await self.send({**message, "body": compressed})
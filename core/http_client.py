@@ -1,11 +1,53 @@
 """Universal HTTP client with retries and circuit breaker."""
+import asyncio
 import time
-from typing import Any, Dict, Optional
+from datetime import datetime, timezone
+from typing import Any, Callable, Dict, Optional
 
 import httpx
 
+from reliapi.core.audit import record_attempt
 from reliapi.core.circuit_breaker import CircuitBreaker
-from reliapi.core.retry import RetryEngine, RetryMatrix
+from reliapi.core.retry import RequestRetryPolicy, RetryEngine, RetryMatrix, RetryStats
+from reliapi.core.target_registry import check_base_url
+from reliapi.core.tracing import trace_headers
+from reliapi.core.upstream_limits import RateLimitPacer
+
+
+class CircuitOpenError(httpx.HTTPError):
+    """Raised when the circuit breaker for an upstream is open."""
+
+
+class UpstreamTimeoutError(httpx.TimeoutException):
+    """Raised when a request's deadline passes before the upstream answers.
+
+    attempts_completed counts the upstream calls that had failed by then;
+    the one in flight, if any, is not included.
+    """
+
+    def __init__(self, timeout_s: float, attempts_completed: int):
+        super().__init__(f"Upstream did not answer within {int(timeout_s * 1000)} ms")
+        self.timeout_s = timeout_s
+        self.attempts_completed = attempts_completed
+
+
+class DeadlineTooShortError(httpx.RequestError):
+    """Raised before any upstream call when a request's deadline is shorter
+    than an attempt usually takes (the target's observed P50 latency)."""
+
+    def __init__(self, deadline_s: float, expected_s: float):
+        super().__init__(
+            f"Deadline of {int(deadline_s * 1000)} ms is shorter than the target's "
+            f"P50 latency of {int(expected_s * 1000)} ms"
+        )
+        self.deadline_s = deadline_s
+        self.expected_s = expected_s
+
+
+def circuit_upstream(base_url: str, circuit_key: Optional[str] = None) -> str:
+    """The circuit breaker upstream of calls to base_url under circuit_key."""
+    base_url = base_url.rstrip("/")
+    return f"{base_url}#{circuit_key}" if circuit_key else base_url
 
 
 class UpstreamHTTPClient:
@@ -18,6 +60,14 @@ class UpstreamHTTPClient:
         retry_matrix: Optional[Dict[str, RetryMatrix]] = None,
         circuit_breaker: Optional[CircuitBreaker] = None,
         auth: Optional[Dict[str, Any]] = None,
+        forward_trace_context: bool = False,
+        allow_private_network: bool = False,
+        deadline_s: Optional[float] = None,
+        on_status: Optional[Callable[[int], None]] = None,
+        pacer: Optional[RateLimitPacer] = None,
+        expected_attempt_s: Optional[float] = None,
+        on_latency: Optional[Callable[[float], None]] = None,
+        circuit_key: Optional[str] = None,
     ):
         """
         Args:
@@ -26,12 +76,31 @@ class UpstreamHTTPClient:
             retry_matrix: Retry policies by error class
             circuit_breaker: Circuit breaker instance
             auth: Authentication config (type, header, prefix, etc.)
+            forward_trace_context: Send the caller's traceparent/tracestate upstream
+            allow_private_network: Follow redirects to hosts on a private network
+            deadline_s: Bound on each request() call, retries and backoff included
+            on_status: Called with the status code of every upstream attempt answered
+            pacer: Holds attempts while the upstream's rate limit is spent
+            expected_attempt_s: How long an attempt usually takes; with deadline_s,
+                requests that can't wait for one fail with DeadlineTooShortError and
+                retries that can't finish in time are skipped
+            on_latency: Called with the duration in seconds of every upstream attempt answered
+            circuit_key: Sub-breaker the calls count against, such as a model; None
+                counts them against base_url as a whole
         """
         self.base_url = base_url.rstrip("/")
         self.timeout_s = timeout_s
         self.retry_engine = RetryEngine(retry_matrix)
         self.circuit_breaker = circuit_breaker or CircuitBreaker()
         self.auth = auth or {}
+        self.forward_trace_context = forward_trace_context
+        self.allow_private_network = allow_private_network
+        self.deadline_s = deadline_s
+        self.on_status = on_status
+        self.pacer = pacer
+        self.expected_attempt_s = expected_attempt_s
+        self.on_latency = on_latency
+        self.circuit_key = circuit_key
         
         # Create HTTP client with connection pooling
         self.client = httpx.AsyncClient(
@@ -43,6 +112,13 @@ class UpstreamHTTPClient:
     def _prepare_headers(self, headers: Optional[Dict[str, str]] = None) -> Dict[str, str]:
         """Prepare headers with authentication."""
         result = headers.copy() if headers else {}
+
+        # Explicit request headers win over the propagated trace context
+        if self.forward_trace_context:
+            present = {k.lower() for k in result}
+            for name, value in trace_headers().items():
+                if name not in present:
+                    result[name] = value
         
         # Add auth header if configured
         if self.auth.get("type") == "api_key":
@@ -61,6 +137,10 @@ class UpstreamHTTPClient:
         headers: Optional[Dict[str, str]] = None,
         body: Optional[bytes] = None,
         params: Optional[Dict[str, Any]] = None,
+        retry_policy: Optional[RequestRetryPolicy] = None,
+        retry_stats: Optional[RetryStats] = None,
+        stream: bool = False,
+        max_redirects: int = 0,
     ) -> httpx.Response:
         """
         Make HTTP request with retries and circuit breaker.
@@ -71,6 +151,12 @@ class UpstreamHTTPClient:
             headers: Request headers
             body: Request body
             params: Query parameters
+            retry_policy: Per-request policy replacing the retry matrix
+            retry_stats: Filled with the attempts made and retry delays
+            stream: Return once the headers arrive, leaving the body unread; the
+                caller must aclose() the response
+            max_redirects: Redirects to follow; 0 returns 3xx responses as they
+                are. Followed hops are in the response's history.
             
         Returns:
             HTTP response
@@ -78,24 +164,46 @@ class UpstreamHTTPClient:
         Raises:
             httpx.HTTPError: On network/HTTP errors
         """
-        upstream_id = f"{self.base_url}"
+        upstream_id = circuit_upstream(self.base_url, self.circuit_key)
         
         # Check circuit breaker
         if self.circuit_breaker.is_open(upstream_id):
-            raise httpx.HTTPError("Circuit breaker is open")
+            raise CircuitOpenError("Circuit breaker is open")
 
         prepared_headers = self._prepare_headers(headers)
         url = f"{self.base_url}{path}"
 
-        async def _make_request():
+        async def _send():
+            if self.pacer is not None:
+                await self.pacer.wait()
             try:
-                response = await self.client.request(
-                    method=method.upper(),
-                    url=url,
-                    headers=prepared_headers,
-                    content=body,
-                    params=params,
-                )
+                if stream:
+                    response = await self.client.send(
+                        self.client.build_request(
+                            method=method.upper(),
+                            url=url,
+                            headers=prepared_headers,
+                            content=body,
+                            params=params,
+                        ),
+                        stream=True,
+                    )
+                    if response.status_code >= 500 or response.status_code == 429:
+                        # Error bodies are small; read them so the connection
+                        # is released before a retry
+                        await response.aread()
+                else:
+                    response = await self.client.request(
+                        method=method.upper(),
+                        url=url,
+                        headers=prepared_headers,
+                        content=body,
+                        params=params,
+                    )
+                if max_redirects:
+                    response = await self._follow_redirects(response, max_redirects, stream)
+                if self.pacer is not None:
+                    self.pacer.observe(response.status_code, response.headers)
                 
                 # Record success/failure
                 if response.is_success:
@@ -120,8 +228,91 @@ class UpstreamHTTPClient:
                 self.circuit_breaker.record_failure(upstream_id)
                 raise
 
-        # Execute with retries
-        response = await self.retry_engine.execute(_make_request)
+        async def _make_request():
+            # Every attempt goes into the audit capture of the request, if any
+            started, clock = datetime.now(timezone.utc), time.monotonic()
+            status_code, error, response_body = None, None, None
+            try:
+                response = await _send()
+                status_code = response.status_code
+                if not stream:
+                    response_body = response.content
+                return response
+            except httpx.HTTPStatusError as e:
+                # Raised for 429 and 5xx, whose bodies have been read
+                status_code, error, response_body = e.response.status_code, str(e), e.response.content
+                raise
+            except BaseException as e:
+                error = str(e) or type(e).__name__
+                raise
+            finally:
+                if status_code is not None and self.on_status:
+                    self.on_status(status_code)
+                if status_code is not None and self.on_latency:
+                    self.on_latency(time.monotonic() - clock)
+                record_attempt(
+                    method.upper(),
+                    str(httpx.URL(url, params=params)),
+                    started,
+                    int((time.monotonic() - clock) * 1000),
+                    status_code=status_code,
+                    error=error,
+                    request_body=body,
+                    response_body=response_body,
+                )
+
+        # Execute with retries, none of them started too late to finish
+        async def _execute(stats: Optional[RetryStats], deadline: Optional[float] = None):
+            budget = dict(deadline=deadline, attempt_s=self.expected_attempt_s or 0.0)
+            if retry_policy is not None:
+                return await RetryEngine(retry_policy.matrix()).execute(
+                    _make_request, error_classifier=retry_policy.classify, stats=stats, **budget
+                )
+            return await self.retry_engine.execute(_make_request, stats=stats, **budget)
+
+        if self.deadline_s is None:
+            return await _execute(retry_stats)
+        if self.expected_attempt_s and self.deadline_s < self.expected_attempt_s:
+            raise DeadlineTooShortError(self.deadline_s, self.expected_attempt_s)
+        stats = retry_stats if retry_stats is not None else RetryStats()
+        started = time.monotonic()
+        try:
+            return await asyncio.wait_for(_execute(stats, started + self.deadline_s), self.deadline_s)
+        except asyncio.TimeoutError:
+            raise UpstreamTimeoutError(self.deadline_s, len(stats.delays_ms)) from None
+        except httpx.TimeoutException as e:
+            # The last attempt's own timeout can fire just before the deadline
+            if time.monotonic() - started < self.deadline_s * 0.99:
+                raise
+            raise UpstreamTimeoutError(self.deadline_s, len(stats.delays_ms)) from e
+
+    async def _follow_redirects(
+        self, response: httpx.Response, max_redirects: int, stream: bool
+    ) -> httpx.Response:
+        """Follow up to max_redirects redirects from response.
+
+        httpx builds each hop (method, body and Authorization handling per
+        RFC 9110); on top of that, the target's own auth header is not sent
+        to another origin. A redirect to another origin is only followed if
+        that origin passes the same check as a target's base_url, so an
+        upstream cannot send the proxy into its own network. A redirect that
+        is not followed, including one past the last allowed hop, is
+        returned as it is.
+        """
+        history = []
+        while response.next_request is not None and len(history) < max_redirects:
+            next_request = response.next_request
+            if not _same_origin(next_request.url, response.request.url):
+                if await check_base_url(str(next_request.url), self.allow_private_network):
+                    break
+                for name in {"Authorization", self.auth.get("header") or "Authorization"}:
+                    if name in next_request.headers:
+                        del next_request.headers[name]
+            if stream:
+                await response.aclose()
+            history.append(response)
+            response = await self.client.send(next_request, stream=stream)
+        response.history = history
         return response
 
     async def close(self):
@@ -129,3 +320,5 @@ class UpstreamHTTPClient:
         await self.client.aclose()
 
 
+def _same_origin(url: httpx.URL, other: httpx.URL) -> bool:
+    return (url.scheme, url.host, url.port) == (other.scheme, other.host, other.port)
@@ -3,6 +3,7 @@ import hashlib
 import json
 import logging
 import time
+from datetime import datetime, timezone
 from typing import Any, Dict, Optional, Tuple
 
 import redis
@@ -40,14 +41,18 @@ class IdempotencyManager:
         headers: Optional[Dict[str, str]] = None,
         body: Optional[bytes] = None,
     ) -> str:
-        """Generate hash of request for comparison."""
+        """Generate hash of request for comparison.
+
+        JSON bodies are hashed in canonical form, so replays that only
+        differ in whitespace or key order are the same request.
+        """
         key_data = {
             "method": method.upper(),
             "url": url,
             "headers": json.dumps(headers or {}, sort_keys=True),
         }
         if body:
-            key_data["body_hash"] = hashlib.sha256(body).hexdigest()
+            key_data["body_hash"] = hashlib.sha256(canonical_body(body)).hexdigest()
         
         key_str = json.dumps(key_data, sort_keys=True)
         return hashlib.sha256(key_str.encode()).hexdigest()
@@ -61,9 +66,13 @@ class IdempotencyManager:
         body: Optional[bytes] = None,
         request_id: Optional[str] = None,
         tenant: Optional[str] = None,
+        ttl_s: int = 3600,
     ) -> Tuple[bool, Optional[str], Optional[str]]:
         """
         Register idempotency key atomically using Redis SETNX.
+
+        The key is honored for ttl_s seconds; after that the same key runs
+        the request again.
         
         Returns:
             (is_new, existing_request_id, existing_request_hash)
@@ -103,7 +112,7 @@ class IdempotencyManager:
             # 1. Concurrent registration: If two requests arrive at the same time with same key,
             #    only one will succeed (was_set=True). The other will get was_set=False and
             #    can then read the existing data. This is the core coalescing behavior.
-            # 2. TTL expiration: The ex=3600 parameter sets TTL atomically, preventing key
+            # 2. TTL expiration: The ex=ttl_s parameter sets TTL atomically, preventing key
             #    from existing without expiration. This ensures keys don't leak memory.
             # 3. Key deletion race: If key is deleted between SET (nx=True) and GET, we treat
             #    it as a new request (return True). This is rare but handled gracefully.
@@ -114,13 +123,14 @@ class IdempotencyManager:
                 "request_id": request_id or f"req_{int(time.time())}_{hashlib.md5(idempotency_key.encode()).hexdigest()[:8]}",
                 "request_hash": request_hash,
                 "created_at": time.time(),
+                "ttl_s": ttl_s,
             }
             data_json = json.dumps(data)
             
             # Atomic SET with NX (only if not exists) and EX (expiration)
             # This is a single Redis command, so it's guaranteed atomic.
             # NX ensures only one request can register, EX sets TTL atomically.
-            was_set = self.client.set(key, data_json, nx=True, ex=3600)
+            was_set = self.client.set(key, data_json, nx=True, ex=ttl_s)
             
             if was_set:
                 # Successfully registered new request
@@ -218,6 +228,58 @@ class IdempotencyManager:
         except Exception as e:
             logger.warning(f"Idempotency store_result error (graceful degradation): {e}", exc_info=True)
 
+    def record_replay(self, idempotency_key: str, tenant: Optional[str] = None) -> Dict[str, Any]:
+        """Count a replay of idempotency_key and return its meta fields.
+
+        Returns idempotency_first_seen_at (when the key was registered, ISO
+        8601) and idempotency_replay_count (replays so far, this one
+        included), plus the expiry_meta fields, or an empty dict when Redis
+        is unavailable.
+        """
+        if not self.enabled or not self.client:
+            return {}
+
+        if tenant:
+            prefix = f"{self.key_prefix}:tenant:{tenant}"
+        else:
+            prefix = self.key_prefix
+        key = f"{prefix}:idempotency:{idempotency_key}"
+        replays_key = f"{prefix}:idempotency_replays:{idempotency_key}"
+        try:
+            count = self.client.incr(replays_key)
+            # The counter lives as long as the registration it counts
+            ttl = self.client.ttl(key)
+            self.client.expire(replays_key, ttl if isinstance(ttl, int) and ttl > 0 else 3600)
+            meta: Dict[str, Any] = {"idempotency_replay_count": int(count)}
+            existing = self.client.get(key)
+            data = json.loads(existing) if existing else {}
+            created_at = data.get("created_at")
+            if created_at is not None:
+                meta["idempotency_first_seen_at"] = _iso(float(created_at))
+            meta.update(_expiry_fields(data))
+            return meta
+        except Exception as e:
+            logger.warning(f"Idempotency record_replay error (graceful degradation): {e}", exc_info=True)
+            return {}
+
+    def expiry_meta(self, idempotency_key: str, tenant: Optional[str] = None) -> Dict[str, Any]:
+        """Return idempotency_ttl_s and idempotency_expires_at (ISO 8601) of
+        a registered idempotency_key, or an empty dict when it is unknown or
+        Redis is unavailable."""
+        if not self.enabled or not self.client:
+            return {}
+
+        if tenant:
+            key = f"{self.key_prefix}:tenant:{tenant}:idempotency:{idempotency_key}"
+        else:
+            key = f"{self.key_prefix}:idempotency:{idempotency_key}"
+        try:
+            existing = self.client.get(key)
+            return _expiry_fields(json.loads(existing)) if existing else {}
+        except Exception as e:
+            logger.warning(f"Idempotency expiry_meta error (graceful degradation): {e}", exc_info=True)
+            return {}
+
     def is_in_progress(self, idempotency_key: str, tenant: Optional[str] = None) -> bool:
         """Check if request with this key is in progress."""
         if not self.enabled or not self.client:
@@ -265,3 +327,31 @@ class IdempotencyManager:
             logger.warning(f"Idempotency clear_in_progress error (graceful degradation): {e}", exc_info=True)
 
 
+
+
+def canonical_body(body: bytes) -> bytes:
+    """Return body re-encoded with sorted keys and no whitespace if it is
+    JSON, and unchanged otherwise."""
+    try:
+        parsed = json.loads(body)
+    except (ValueError, UnicodeDecodeError):
+        return body
+    return json.dumps(parsed, sort_keys=True, separators=(",", ":"), ensure_ascii=False).encode()
+
+
+def _iso(ts: float) -> str:
+    """Format a Unix timestamp as ISO 8601 UTC with a Z suffix."""
+    return datetime.fromtimestamp(ts, tz=timezone.utc).isoformat().replace("+00:00", "Z")
+
+
+def _expiry_fields(data: Dict[str, Any]) -> Dict[str, Any]:
+    """Meta fields for the TTL of a registration record; records written
+    before ttl_s was stored used the old fixed 3600s."""
+    created_at = data.get("created_at")
+    if created_at is None:
+        return {}
+    ttl_s = int(data.get("ttl_s", 3600))
+    return {
+        "idempotency_ttl_s": ttl_s,
+        "idempotency_expires_at": _iso(float(created_at) + ttl_s),
+    }
@@ -0,0 +1,226 @@
+"""Async LLM jobs.
+
+A job is an LLM request submitted with POST /proxy/llm?mode=async. It runs in
+the background of the instance that accepted it, and its record (status, then
+the ReliAPIResponse) is polled at GET /jobs/{id} and listed at GET /jobs.
+Records live in Redis so any
+instance can answer the poll, or in process memory when Redis is unavailable;
+they expire JOB_TTL_S after submission. A job whose instance stops while it
+runs is not resumed.
+
+Cache warming jobs (POST /cache/warm) share the store: their records also
+hold the status of each item they warm (see public_warm_job).
+"""
+import json
+import logging
+import time
+import uuid
+from enum import Enum
+from typing import Any, Dict, List, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+# How long job records, and the idempotency keys pointing at them, are kept.
+JOB_TTL_S = 86400
+
+
+class JobStatus(str, Enum):
+    """Lifecycle of a job; succeeded and failed are final."""
+    QUEUED = "queued"
+    RUNNING = "running"
+    SUCCEEDED = "succeeded"
+    FAILED = "failed"
+
+
+class WarmItemStatus(str, Enum):
+    """Outcome of one item of a cache warming job; pending until it ran."""
+    PENDING = "pending"
+    WARMED = "warmed"  # Sent upstream and stored in the cache
+    CACHED = "cached"  # Already cached, so skipped
+    FAILED = "failed"
+    ABORTED = "aborted"  # Not started: the job's max_cost_usd was spent
+
+
+class JobStore:
+    """Job records keyed by job ID, scoped to the submitting tenant.
+
+    Submissions with an idempotency key map it to their job, so resubmitting
+    the key returns the existing job instead of creating one.
+    """
+
+    def __init__(self, redis_client: Any = None, key_prefix: str = "reliapi", ttl_s: int = JOB_TTL_S):
+        """
+        Args:
+            redis_client: Redis client to store records in; None keeps them in memory
+            key_prefix: Prefix for job keys
+            ttl_s: Lifetime of a record from submission
+        """
+        self.client = redis_client
+        self.key_prefix = key_prefix
+        self.ttl_s = ttl_s
+        # key -> (expires_at, value) when running without Redis
+        self._memory: Dict[str, Tuple[float, str]] = {}
+
+    def _job_key(self, job_id: str) -> str:
+        return f"{self.key_prefix}:job:{job_id}"
+
+    def _index_key(self, tenant: Optional[str]) -> str:
+        if tenant:
+            return f"{self.key_prefix}:tenant:{tenant}:jobs"
+        return f"{self.key_prefix}:jobs"
+
+    def _idempotency_key(self, tenant: Optional[str], idempotency_key: str) -> str:
+        if tenant:
+            return f"{self.key_prefix}:tenant:{tenant}:job_idempotency:{idempotency_key}"
+        return f"{self.key_prefix}:job_idempotency:{idempotency_key}"
+
+    def _get(self, key: str) -> Optional[str]:
+        if self.client is not None:
+            try:
+                return self.client.get(key)
+            except Exception as e:
+                logger.warning(f"Job store read failed for {key}: {e}")
+                return None
+        entry = self._memory.get(key)
+        if entry is None or entry[0] <= time.time():
+            self._memory.pop(key, None)
+            return None
+        return entry[1]
+
+    def _set(self, key: str, value: str, ttl_s: int, nx: bool = False) -> bool:
+        if self.client is not None:
+            try:
+                return bool(self.client.set(key, value, ex=max(1, ttl_s), nx=nx))
+            except Exception as e:
+                logger.warning(f"Job store write failed for {key}: {e}")
+                return False
+        if nx and self._get(key) is not None:
+            return False
+        self._memory[key] = (time.time() + ttl_s, value)
+        return True
+
+    def _remaining_ttl_s(self, job: Dict[str, Any]) -> int:
+        return int(job["created_at"] + self.ttl_s - time.time())
+
+    def create(
+        self,
+        tenant: Optional[str],
+        request_hash: str,
+        idempotency_key: Optional[str] = None,
+        callback_url: Optional[str] = None,
+    ) -> Tuple[Optional[Dict[str, Any]], bool]:
+        """Create a queued job, or find the one submitted with idempotency_key.
+
+        Returns (job, created). created is False when the key was already
+        used; the caller compares job["request_hash"] with request_hash to
+        tell a resubmission from a conflicting request. job is None when the
+        record could not be stored.
+        """
+        job = {
+            "job_id": f"job_{uuid.uuid4().hex}",
+            "kind": "llm",
+            "status": JobStatus.QUEUED.value,
+            "tenant": tenant,
+            "request_hash": request_hash,
+            "callback_url": callback_url,
+            "created_at": time.time(),
+            "completed_at": None,
+            "result": None,
+            "callback_delivered": None,
+        }
+        if idempotency_key:
+            key = self._idempotency_key(tenant, idempotency_key)
+            if not self._set(key, job["job_id"], self.ttl_s, nx=True):
+                existing_id = self._get(key)
+                existing = self.get(existing_id, tenant) if existing_id else None
+                if existing is not None:
+                    return existing, False
+                # The key outlived its job (or was just deleted); take it over
+                self._set(key, job["job_id"], self.ttl_s)
+        if not self._set(self._job_key(job["job_id"]), json.dumps(job), self.ttl_s):
+            return None, False
+        self._add_to_index(job)
+        return job, True
+
+    def _add_to_index(self, job: Dict[str, Any]) -> None:
+        """Add job to its tenant's index, the sorted set list() reads in Redis."""
+        if self.client is None:
+            return
+        key = self._index_key(job["tenant"])
+        try:
+            self.client.zadd(key, {job["job_id"]: job["created_at"]})
+            self.client.expire(key, self.ttl_s)
+        except Exception as e:
+            logger.warning(f"Job store write failed for {key}: {e}")
+
+    def list(self, tenant: Optional[str]) -> List[Dict[str, Any]]:
+        """A tenant's unexpired job records, oldest first by (created_at, job_id).
+
+        Cache warming jobs are left out.
+        """
+        if self.client is not None:
+            key = self._index_key(tenant)
+            try:
+                self.client.zremrangebyscore(key, "-inf", time.time() - self.ttl_s)
+                ids = [i.decode() if isinstance(i, bytes) else i for i in self.client.zrange(key, 0, -1)]
+                raws = self.client.mget([self._job_key(i) for i in ids]) if ids else []
+            except Exception as e:
+                logger.warning(f"Job store read failed for {key}: {e}")
+                return []
+        else:
+            prefix = self._job_key("")
+            raws = [self._get(k) for k in list(self._memory) if k.startswith(prefix)]
+        jobs = [json.loads(raw) for raw in raws if raw is not None]
+        return sorted(
+            (j for j in jobs if j.get("tenant") == tenant and j.get("kind", "llm") == "llm"),
+            key=lambda j: (j["created_at"], j["job_id"]),
+        )
+
+    def get(self, job_id: str, tenant: Optional[str]) -> Optional[Dict[str, Any]]:
+        """Return the job record, or None if it is unknown, expired, or another tenant's."""
+        raw = self._get(self._job_key(job_id))
+        if raw is None:
+            return None
+        job = json.loads(raw)
+        if job.get("tenant") != tenant:
+            return None
+        return job
+
+    def update(self, job: Dict[str, Any], **fields: Any) -> Dict[str, Any]:
+        """Store job with fields changed, keeping its expiry, and return it."""
+        job = {**job, **fields}
+        ttl_s = self._remaining_ttl_s(job)
+        if ttl_s > 0:
+            self._set(self._job_key(job["job_id"]), json.dumps(job), ttl_s)
+        return job
+
+
+def public_job(job: Dict[str, Any]) -> Dict[str, Any]:
+    """The job record as reported by GET /jobs/{id}, without bookkeeping fields."""
+    return {
+        "job_id": job["job_id"],
+        "status": job["status"],
+        "created_at": job["created_at"],
+        "completed_at": job["completed_at"],
+        "result": job["result"],
+        "callback_url": job["callback_url"],
+        "callback_delivered": job["callback_delivered"],
+    }
+
+
+def public_warm_job(job: Dict[str, Any]) -> Dict[str, Any]:
+    """A cache warming job as reported by GET /cache/warm/{id}: its items'
+    outcomes, counted per status, and their total cost."""
+    counts = {status.value: 0 for status in WarmItemStatus}
+    for item in job["items"]:
+        counts[item["status"]] += 1
+    return {
+        "job_id": job["job_id"],
+        "status": job["status"],
+        "created_at": job["created_at"],
+        "completed_at": job["completed_at"],
+        "max_cost_usd": job["max_cost_usd"],
+        "cost_usd": job["cost_usd"],
+        "counts": counts,
+        "items": job["items"],
+    }
@@ -0,0 +1,200 @@
+"""JSON Schema validation of LLM output for /proxy/llm validate_output.
+
+Covers the subset of JSON Schema (draft 2020-12) that structured-output
+schemas use in practice: type, enum, const, properties, required,
+additionalProperties, items, prefixItems, the length, size and range
+keywords, pattern, anyOf, oneOf, allOf, not, and local $ref into $defs or
+definitions. Unknown keywords are ignored, as the specification requires,
+so a schema using them is validated less strictly rather than rejected.
+"""
+import json
+import re
+from typing import Any, Dict, List, Optional, Tuple
+
+_TYPES = {
+    "object": lambda v: isinstance(v, dict),
+    "array": lambda v: isinstance(v, list),
+    "string": lambda v: isinstance(v, str),
+    "boolean": lambda v: isinstance(v, bool),
+    "null": lambda v: v is None,
+    "integer": lambda v: (isinstance(v, int) and not isinstance(v, bool))
+    or (isinstance(v, float) and v.is_integer()),
+    "number": lambda v: isinstance(v, (int, float)) and not isinstance(v, bool),
+}
+
+# Stop collecting after this many violations; a repair prompt needs a few
+MAX_ERRORS = 20
+
+
+class SchemaError(ValueError):
+    """Raised for a schema that can't be used for validation."""
+
+
+def check_schema(schema: Any, root: Any = None) -> None:
+    """Reject schemas that are not objects or booleans, name unknown types,
+    hold invalid patterns or $refs that don't resolve."""
+    root = schema if root is None else root
+    if isinstance(schema, bool):
+        return
+    if not isinstance(schema, dict):
+        raise SchemaError("schema must be an object or a boolean")
+    if "$ref" in schema:
+        _resolve(schema["$ref"], root)
+    types = schema.get("type")
+    for name in types if isinstance(types, list) else [types] if types is not None else []:
+        if name not in _TYPES:
+            raise SchemaError(f"unknown type {name!r}")
+    for key in ("properties", "$defs", "definitions"):
+        for sub in (schema.get(key) or {}).values():
+            check_schema(sub, root)
+    for key in ("items", "additionalProperties", "not"):
+        if key in schema:
+            check_schema(schema[key], root)
+    for key in ("anyOf", "oneOf", "allOf", "prefixItems"):
+        for sub in schema.get(key) or []:
+            check_schema(sub, root)
+    if "pattern" in schema:
+        try:
+            re.compile(schema["pattern"])
+        except re.error as e:
+            raise SchemaError(f"invalid pattern: {e}") from e
+
+
+def validate_json_output(content: str, schema: Any) -> Tuple[Optional[Any], List[Dict[str, str]]]:
+    """Parse content as JSON and validate it against schema.
+
+    Returns the parsed value and the violations, each {"path", "message"}
+    with a JSONPath-like path ("$.items[0].name"). Content that is not JSON
+    is a single violation at "$".
+    """
+    try:
+        value = json.loads(content)
+    except (TypeError, ValueError) as e:
+        return None, [{"path": "$", "message": f"not valid JSON: {e}"}]
+    errors: List[Dict[str, str]] = []
+    _validate(value, schema, "$", schema, errors)
+    return value, errors[:MAX_ERRORS]
+
+
+def _resolve(ref: str, root: Any) -> Any:
+    if not ref.startswith("#"):
+        raise SchemaError(f"only local $ref is supported, got {ref!r}")
+    node = root
+    for token in ref[1:].split("/")[1:]:
+        token = token.replace("~1", "/").replace("~0", "~")
+        if not isinstance(node, dict) or token not in node:
+            raise SchemaError(f"unresolvable $ref {ref!r}")
+        node = node[token]
+    return node
+
+
+def _validate(value: Any, schema: Any, path: str, root: Any, errors: List[Dict[str, str]]) -> None:
+    if len(errors) >= MAX_ERRORS or schema is True:
+        return
+    if schema is False:
+        errors.append({"path": path, "message": "no value is allowed here"})
+        return
+    if not isinstance(schema, dict):
+        return
+
+    def fail(message: str) -> None:
+        errors.append({"path": path, "message": message})
+
+    if "$ref" in schema:
+        _validate(value, _resolve(schema["$ref"], root), path, root, errors)
+
+    types = schema.get("type")
+    if types is not None:
+        names = types if isinstance(types, list) else [types]
+        if not any(_TYPES[name](value) for name in names if name in _TYPES):
+            fail(f"expected {' or '.join(names)}, got {_type_name(value)}")
+            return
+
+    if "enum" in schema and not any(_equal(value, option) for option in schema["enum"]):
+        fail(f"must be one of {json.dumps(schema['enum'])}")
+    if "const" in schema and not _equal(value, schema["const"]):
+        fail(f"must be {json.dumps(schema['const'])}")
+
+    if isinstance(value, str):
+        if "minLength" in schema and len(value) < schema["minLength"]:
+            fail(f"must be at least {schema['minLength']} characters")
+        if "maxLength" in schema and len(value) > schema["maxLength"]:
+            fail(f"must be at most {schema['maxLength']} characters")
+        if "pattern" in schema and not re.search(schema["pattern"], value):
+            fail(f"must match pattern {schema['pattern']!r}")
+
+    if _TYPES["number"](value):
+        if "minimum" in schema and value < schema["minimum"]:
+            fail(f"must be >= {schema['minimum']}")
+        if "maximum" in schema and value > schema["maximum"]:
+            fail(f"must be <= {schema['maximum']}")
+        if "exclusiveMinimum" in schema and value <= schema["exclusiveMinimum"]:
+            fail(f"must be > {schema['exclusiveMinimum']}")
+        if "exclusiveMaximum" in schema and value >= schema["exclusiveMaximum"]:
+            fail(f"must be < {schema['exclusiveMaximum']}")
+
+    if isinstance(value, dict):
+        properties = schema.get("properties") or {}
+        for name in schema.get("required") or []:
+            if name not in value:
+                fail(f"missing required property {name!r}")
+        for name, item in value.items():
+            child = f"{path}.{name}"
+            if name in properties:
+                _validate(item, properties[name], child, root, errors)
+            elif "additionalProperties" in schema:
+                if schema["additionalProperties"] is False:
+                    errors.append({"path": child, "message": "property is not allowed"})
+                else:
+                    _validate(item, schema["additionalProperties"], child, root, errors)
+        if "minProperties" in schema and len(value) < schema["minProperties"]:
+            fail(f"must have at least {schema['minProperties']} properties")
+        if "maxProperties" in schema and len(value) > schema["maxProperties"]:
+            fail(f"must have at most {schema['maxProperties']} properties")
+
+    if isinstance(value, list):
+        prefix = schema.get("prefixItems") or []
+        for i, item in enumerate(value):
+            if i < len(prefix):
+                _validate(item, prefix[i], f"{path}[{i}]", root, errors)
+            elif "items" in schema:
+                _validate(item, schema["items"], f"{path}[{i}]", root, errors)
+        if "minItems" in schema and len(value) < schema["minItems"]:
+            fail(f"must have at least {schema['minItems']} items")
+        if "maxItems" in schema and len(value) > schema["maxItems"]:
+            fail(f"must have at most {schema['maxItems']} items")
+        if schema.get("uniqueItems"):
+            seen = [json.dumps(item, sort_keys=True) for item in value]
+            if len(set(seen)) != len(seen):
+                fail("items must be unique")
+
+    for sub in schema.get("allOf") or []:
+        _validate(value, sub, path, root, errors)
+    if "anyOf" in schema and not any(_matches(value, sub, root) for sub in schema["anyOf"]):
+        fail("must match at least one schema in anyOf")
+    if "oneOf" in schema:
+        matched = sum(_matches(value, sub, root) for sub in schema["oneOf"])
+        if matched != 1:
+            fail(f"must match exactly one schema in oneOf, matched {matched}")
+    if "not" in schema and _matches(value, schema["not"], root):
+        fail("must not match the schema in not")
+
+
+def _matches(value: Any, schema: Any, root: Any) -> bool:
+    errors: List[Dict[str, str]] = []
+    _validate(value, schema, "$", root, errors)
+    return not errors
+
+
+def _equal(a: Any, b: Any) -> bool:
+    """JSON equality: 1 equals 1.0, but true does not equal 1."""
+    if isinstance(a, bool) or isinstance(b, bool):
+        return type(a) is type(b) and a == b
+    return a == b
+
+
+def _type_name(value: Any) -> str:
+    for name in ("null", "boolean", "integer", "number", "string", "array", "object"):
+        if _TYPES[name](value):
+            return name
+    return type(value).__name__
@@ -0,0 +1,67 @@
+"""Per-API-key monthly budgets and requests-per-minute limits.
+
+Keys are configured under api_keys, by a name that identifies them in
+errors, logs and metrics. Like the budget ledger, rate-limit windows are
+process-local: each ReliAPI instance enforces the limits against the
+traffic it has seen.
+"""
+import threading
+import time
+from dataclasses import dataclass
+from typing import Dict, Optional, Tuple
+
+
+@dataclass(frozen=True)
+class KeyLimits:
+    """The limits configured for one API key."""
+    name: str
+    monthly_budget_usd: Optional[float] = None
+    rate_limit_rpm: Optional[int] = None
+    # Budget alert thresholds of the key, instead of budget_alerts.thresholds.
+    alert_thresholds: Optional[Tuple[float, ...]] = None
+    # Non-production key, allowed to inject faults.
+    test: bool = False
+    # Fault spec injected into all of the key's requests.
+    faults: Optional[str] = None
+
+
+@dataclass(frozen=True)
+class RateLimitStatus:
+    """A key's requests-per-minute window after a request was counted."""
+    allowed: bool
+    limit: int
+    remaining: int
+    # Unix time the window ends and the limit resets.
+    reset_at: int
+
+
+class KeyRateLimiter:
+    """Fixed one-minute windows of request counts per key name."""
+
+    def __init__(self):
+        self._windows: Dict[str, Tuple[int, int]] = {}
+        self._lock = threading.Lock()
+
+    def hit(self, name: str, limit: int, requests: int = 1, now: Optional[float] = None) -> RateLimitStatus:
+        """Count requests against name's window, unless they don't all fit in it."""
+        now = time.time() if now is None else now
+        window = int(now // 60) * 60
+        with self._lock:
+            start, count = self._windows.get(name, (window, 0))
+            if start != window:
+                start, count = window, 0
+            allowed = count + requests <= limit
+            if allowed:
+                count += requests
+            self._windows[name] = (start, count)
+        return RateLimitStatus(
+            allowed=allowed,
+            limit=limit,
+            remaining=max(limit - count, 0),
+            reset_at=start + 60,
+        )
+
+    def reset(self) -> None:
+        """Forget all windows."""
+        with self._lock:
+            self._windows.clear()
@@ -0,0 +1,65 @@
+"""Observed upstream latency per target, for deadline-aware retries and
+latency routing (core.latency_routing).
+
+Every answered upstream attempt is recorded under its target, and the
+median of the latest attempts estimates how long the next one takes. A
+request whose deadline is shorter than that fails fast instead of starting
+an attempt it can't wait for, and a retry that can't finish before the
+deadline is skipped. Like the upstream rate limits, the state is
+process-local.
+"""
+import threading
+from collections import deque
+from typing import Deque, Dict, Optional
+
+# Attempts the median is taken over
+WINDOW = 100
+
+# Fewer attempts than this give no estimate
+MIN_SAMPLES = 5
+
+
+class LatencyTracker:
+    """The latest attempt latencies of each target."""
+
+    def __init__(self, window: int = WINDOW, min_samples: int = MIN_SAMPLES) -> None:
+        self.window = window
+        self.min_samples = min_samples
+        self._samples: Dict[str, Deque[float]] = {}
+        self._lock = threading.Lock()
+
+    def observe(self, target: str, latency_s: float) -> None:
+        """Record that an attempt against target took latency_s seconds."""
+        with self._lock:
+            samples = self._samples.get(target)
+            if samples is None:
+                samples = self._samples[target] = deque(maxlen=self.window)
+            samples.append(latency_s)
+
+    def p50(self, target: str) -> Optional[float]:
+        """The median latency of target's latest attempts in seconds, or
+        None until min_samples were recorded."""
+        return self.percentile(target, 0.5)
+
+    def percentile(self, target: str, fraction: float) -> Optional[float]:
+        """The latency below which fraction of target's latest attempts
+        fell, interpolated between samples, in seconds; None until
+        min_samples were recorded."""
+        with self._lock:
+            samples = sorted(self._samples.get(target) or ())
+        if len(samples) < self.min_samples:
+            return None
+        position = (len(samples) - 1) * fraction
+        below = int(position)
+        above = min(below + 1, len(samples) - 1)
+        return samples[below] + (samples[above] - samples[below]) * (position - below)
+
+    def count(self, target: str) -> int:
+        """How many of target's latest attempts are recorded."""
+        with self._lock:
+            return len(self._samples.get(target) or ())
+
+    def reset(self) -> None:
+        """Forget all latencies."""
+        with self._lock:
+            self._samples.clear()
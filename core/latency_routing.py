@@ -0,0 +1,162 @@
+"""Latency routing: virtual "auto:<name>" targets served by their fastest
+healthy candidate.
+
+A latency route (config.schema.LatencyRouteConfig) lists candidate targets,
+usually one model mirrored behind several endpoints. A request for
+"auto:<name>" goes to a candidate picked with a weight of 1 over its
+observed upstream latency (core.latency), the route's P50 or P95, so the
+fastest gets most of the traffic while the others keep being measured. An
+exploration fraction of the requests goes to a candidate picked at random,
+so one that recovered is noticed, and candidates with too few attempts for
+an estimate get the requests until they have one. Candidates whose circuit
+is open are skipped; when all are, the request goes to the first, to fail
+with CIRCUIT_OPEN.
+
+A request with an idempotency key sticks to the candidate it was first
+routed to while that one is healthy, so its retries reach the upstream,
+and the idempotency record, of the first attempt. Like the latencies, the
+choices are process-local; the latest MAX_STICKY are remembered.
+"""
+import random
+import threading
+from collections import Counter, OrderedDict
+from dataclasses import dataclass
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+from reliapi.core.latency import LatencyTracker
+
+ROUTE_PREFIX = "auto:"
+
+# Idempotency keys whose candidate is remembered
+MAX_STICKY = 10000
+
+# The latency each metric routes by, as a percentile
+METRICS = {"p50": 0.5, "p95": 0.95}
+
+
+@dataclass(frozen=True)
+class RouteChoice:
+    """The candidate a latency route sent a request to."""
+
+    route: str
+    target: str
+    model: Optional[str]
+
+
+# Whether a candidate target would take a call for a model
+Healthy = Callable[[str, Optional[str]], bool]
+
+
+class LatencyRouter:
+    """Picks the candidates of latency routes and remembers the picks of
+    idempotency keys."""
+
+    def __init__(
+        self,
+        latencies: LatencyTracker,
+        max_sticky: int = MAX_STICKY,
+        rng: Callable[[], float] = random.random,
+    ) -> None:
+        self.latencies = latencies
+        self.max_sticky = max_sticky
+        self._rng = rng
+        self._sticky: "OrderedDict[Tuple[str, str, str], str]" = OrderedDict()
+        self._routed: Counter = Counter()
+        self._lock = threading.Lock()
+
+    def _latency(self, route: Dict[str, Any], target: str) -> Optional[float]:
+        return self.latencies.percentile(target, METRICS[route.get("metric", "p50")])
+
+    def shares(self, route: Dict[str, Any], healthy: Healthy) -> List[float]:
+        """The expected share of the route's requests of each candidate."""
+        candidates = route["candidates"]
+        up = [healthy(c["target"], c.get("model")) for c in candidates]
+        if not any(up):
+            return [1.0] + [0.0] * (len(candidates) - 1)
+        latencies = [self._latency(route, c["target"]) if ok else None for c, ok in zip(candidates, up)]
+        unmeasured = [ok and latency_s is None for ok, latency_s in zip(up, latencies)]
+        if any(unmeasured):
+            return [1.0 / sum(unmeasured) if u else 0.0 for u in unmeasured]
+        weights = [1.0 / max(latency_s, 1e-6) if ok else 0.0 for ok, latency_s in zip(up, latencies)]
+        exploration = route.get("exploration", 0.05)
+        return [
+            (1 - exploration) * weight / sum(weights) + (exploration / sum(up) if ok else 0.0)
+            for ok, weight in zip(up, weights)
+        ]
+
+    def choose(
+        self,
+        name: str,
+        route: Dict[str, Any],
+        healthy: Healthy,
+        idempotency_key: Optional[str] = None,
+        tenant: Optional[str] = None,
+    ) -> RouteChoice:
+        """Pick the candidate of route name for a request."""
+        candidates = route["candidates"]
+        sticky_key = (name, tenant or "default", idempotency_key) if idempotency_key else None
+        candidate = None
+        with self._lock:
+            target = self._sticky.get(sticky_key) if sticky_key else None
+        if target is not None:
+            candidate = next((c for c in candidates if c["target"] == target), None)
+            if candidate and not healthy(candidate["target"], candidate.get("model")):
+                candidate = None
+        if candidate is None:
+            candidate = self._pick(route, healthy)
+        with self._lock:
+            self._routed[(name, candidate["target"])] += 1
+            if sticky_key:
+                self._sticky[sticky_key] = candidate["target"]
+                self._sticky.move_to_end(sticky_key)
+                while len(self._sticky) > self.max_sticky:
+                    self._sticky.popitem(last=False)
+        return RouteChoice(route=name, target=candidate["target"], model=candidate.get("model"))
+
+    def _pick(self, route: Dict[str, Any], healthy: Healthy) -> Dict[str, Any]:
+        candidates = route["candidates"]
+        shares = self.shares(route, healthy)
+        point = self._rng() * sum(shares)
+        total = 0.0
+        for candidate, share in zip(candidates, shares):
+            total += share
+            if share and point < total:
+                return candidate
+        return next(c for c, share in zip(candidates, shares) if share)
+
+    def stats(self, name: str, route: Dict[str, Any], healthy: Healthy) -> Dict[str, Any]:
+        """The latency table of route name: each candidate's latencies in
+        milliseconds, health, expected share and requests routed to it."""
+        with self._lock:
+            routed = {c["target"]: self._routed[(name, c["target"])] for c in route["candidates"]}
+        rows = []
+        for candidate, share in zip(route["candidates"], self.shares(route, healthy)):
+            target = candidate["target"]
+            p50, p95 = self.latencies.percentile(target, 0.5), self.latencies.percentile(target, 0.95)
+            rows.append({
+                "target": target,
+                "model": candidate.get("model"),
+                "healthy": healthy(target, candidate.get("model")),
+                "samples": self.latencies.count(target),
+                "p50_ms": round(p50 * 1000, 1) if p50 is not None else None,
+                "p95_ms": round(p95 * 1000, 1) if p95 is not None else None,
+                "share": round(share, 4),
+                "routed": routed[target],
+            })
+        return {
+            "route": f"{ROUTE_PREFIX}{name}",
+            "metric": route.get("metric", "p50"),
+            "exploration": route.get("exploration", 0.05),
+            "candidates": rows,
+        }
+
+    def reset(self) -> None:
+        """Forget the sticky choices and routed counts."""
+        with self._lock:
+            self._sticky.clear()
+            self._routed.clear()
+
+
+def route_name(target: str) -> Optional[str]:
+    """The route an "auto:<name>" target names, or None for other targets."""
+    return target[len(ROUTE_PREFIX):] if target.startswith(ROUTE_PREFIX) else None
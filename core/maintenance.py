@@ -0,0 +1,107 @@
+"""Maintenance mode, for proxy upgrades.
+
+While the maintenance config is enabled, MaintenanceMiddleware answers
+requests with a 503 MAINTENANCE envelope whose details say when to retry
+(retry_after_s, also sent as Retry-After) and whether the deployment is
+read_only. A read-only deployment still serves GET requests, so status,
+job results and stats stay available; everything else is refused. The
+X-ReliAPI-Maintenance header carries the mode ("read_only" or "full"), so
+clients can decide whether to retry without parsing the body.
+
+Health and metrics endpoints are always served, so load balancers and
+monitors see the instance as up.
+"""
+import json
+from dataclasses import dataclass
+from typing import Callable, Optional, Tuple
+
+from reliapi.core.errors import ErrorCode
+
+MAINTENANCE_HEADER = b"x-reliapi-maintenance"
+
+# Paths served during maintenance, whatever the method.
+EXEMPT_PATHS = ("/health", "/healthz", "/readyz", "/livez", "/metrics")
+
+DEFAULT_RETRY_AFTER_S = 60
+DEFAULT_MESSAGE = "ReliAPI is down for maintenance"
+
+
+@dataclass
+class MaintenanceMode:
+    """The maintenance config in effect."""
+
+    read_only: bool = False
+    retry_after_s: int = DEFAULT_RETRY_AFTER_S
+    message: str = DEFAULT_MESSAGE
+
+    def refuses(self, method: str, path: str) -> bool:
+        """Whether a request is answered with MAINTENANCE."""
+        if path in EXEMPT_PATHS:
+            return False
+        return not (self.read_only and method in ("GET", "HEAD"))
+
+
+def _header(scope, name: bytes) -> Optional[str]:
+    for key, value in scope.get("headers", []):
+        if key.lower() == name:
+            return value.decode("latin-1")
+    return None
+
+
+def _maintenance_response(scope, mode: MaintenanceMode) -> Tuple[dict, bytes]:
+    body = json.dumps(
+        {
+            "success": False,
+            "error": {
+                "type": "maintenance_error",
+                "code": ErrorCode.MAINTENANCE.value,
+                "message": mode.message,
+                "retryable": True,
+                "target": None,
+                "status_code": 503,
+                "retry_after_s": mode.retry_after_s,
+                "details": {"read_only": mode.read_only},
+            },
+            "meta": {
+                "target": None,
+                "cache_hit": False,
+                "retries": 0,
+                "duration_ms": 0,
+                "request_id": _header(scope, b"x-request-id") or "unknown",
+                "trace_id": _header(scope, b"x-trace-id"),
+            },
+        }
+    ).encode()
+    start = {
+        "type": "http.response.start",
+        "status": 503,
+        "headers": [
+            (b"content-type", b"application/json"),
+            (b"content-length", str(len(body)).encode()),
+            (b"retry-after", str(mode.retry_after_s).encode()),
+            (MAINTENANCE_HEADER, b"read_only" if mode.read_only else b"full"),
+        ],
+    }
+    return start, body
+
+
+class MaintenanceMiddleware:
+    """ASGI middleware refusing requests during maintenance.
+
+    get_mode returns the MaintenanceMode in effect, or None outside
+    maintenance; it is called per request since the config loads after the
+    middleware is installed.
+    """
+
+    def __init__(self, app, get_mode: Callable[[], Optional[MaintenanceMode]]):
+        self.app = app
+        self.get_mode = get_mode
+
+    async def __call__(self, scope, receive, send):
+        mode = self.get_mode() if scope["type"] == "http" else None
+        if mode is None or not mode.refuses(scope["method"], scope["path"]):
+            await self.app(scope, receive, send)
+            return
+        start, body = _maintenance_response(scope, mode)
+        await send(start)
+        await send({"type": "http.response.body", "body": body})
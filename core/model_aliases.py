@@ -0,0 +1,76 @@
+"""Model aliases: stable model names remapped to a target and model on the proxy.
+
+A target's model_aliases (config.schema.ModelAlias) map names such as
+"default-small" to the target and model that serve them, so callers can
+switch models without a redeploy. An LLM request's model resolves through
+the aliases of its target when it is "alias:<name>" or matches an alias
+name. An alias may split its traffic between variants by percentage for
+gradual rollouts; the variant is picked from a hash of the idempotency
+key, so retries of a request land on the same one, and at random without
+a key. Resolution happens before anything else, so cache entries are keyed
+by the resolved model.
+"""
+import hashlib
+import random
+from dataclasses import dataclass
+from typing import Any, Dict, Optional
+
+ALIAS_PREFIX = "alias:"
+
+
+class UnknownAliasError(ValueError):
+    """An "alias:" model named no alias of the target."""
+
+
+@dataclass(frozen=True)
+class AliasResolution:
+    """Where an alias sent a request."""
+
+    alias: str
+    target: str
+    model: Optional[str]
+
+
+def _bucket(alias: str, idempotency_key: Optional[str]) -> float:
+    """A point in [0, 100) picking the variant of a split."""
+    if idempotency_key is None:
+        return random.random() * 100
+    digest = hashlib.sha256(f"{alias}\x00{idempotency_key}".encode()).digest()
+    return int.from_bytes(digest[:8], "big") / 2**64 * 100
+
+
+def resolve_alias(
+    target_name: str,
+    model: Optional[str],
+    targets: Dict[str, Dict[str, Any]],
+    idempotency_key: Optional[str] = None,
+) -> Optional[AliasResolution]:
+    """Resolve model through the aliases of target_name.
+
+    Returns None when model is no alias, and raises UnknownAliasError for an
+    "alias:" name the target doesn't define.
+    """
+    if not model:
+        return None
+    aliases = (targets.get(target_name) or {}).get("model_aliases") or {}
+    name = model[len(ALIAS_PREFIX):] if model.startswith(ALIAS_PREFIX) else model
+    alias = aliases.get(name)
+    if alias is None:
+        if model.startswith(ALIAS_PREFIX):
+            raise UnknownAliasError(f"Target '{target_name}' has no model alias '{name}'")
+        return None
+
+    variant = alias
+    split = alias.get("split")
+    if split:
+        point = _bucket(name, idempotency_key)
+        total = 0.0
+        for variant in split:
+            total += variant["weight"]
+            if point < total:
+                break
+    return AliasResolution(
+        alias=name,
+        target=variant.get("target") or alias.get("target") or target_name,
+        model=variant.get("model") or alias.get("model"),
+    )
@@ -0,0 +1,216 @@
+"""What LLM models accept, for checking requests before they are sent.
+
+An LLM request that a model can't take, such as a temperature for a model
+that has none or a max_tokens over its output limit, fails at the provider
+after a round trip. The capability table lists, for the models of the
+supported providers, the context window, the most output tokens, whether
+tools, images, json_schema structured outputs and token logprobs are
+supported, the
+sampling parameters accepted and the temperature range. Names match by
+their longest prefix in the table, so "gpt-4o-2024-08-06" is "gpt-4o".
+
+A target's llm.models (config.schema.ModelCapabilityConfig) overrides the
+entries of its models, or describes self-hosted ones the table lacks;
+models in neither are not checked. check_request returns what is wrong
+with a request; fit_request also clamps max_tokens and temperature and
+drops unsupported sampling parameters when the request is not strict,
+recording each change. The Go client bundles the same table
+(reliapi.BundledModels), refreshed from GET /models.
+"""
+from dataclasses import asdict, dataclass, field, replace
+from typing import Any, Dict, List, Optional, Tuple
+
+# Sampling parameters a model may not accept
+SAMPLING_PARAMETERS = ("temperature", "top_p", "stop")
+
+
+@dataclass(frozen=True)
+class ModelCapabilities:
+    """What a model accepts. None limits are unknown and not checked."""
+
+    context_window: Optional[int] = None
+    max_output_tokens: Optional[int] = None
+    supports_tools: bool = True
+    supports_vision: bool = False
+    supports_json_schema: bool = True
+    supports_logprobs: bool = False
+    parameters: Tuple[str, ...] = SAMPLING_PARAMETERS
+    max_temperature: float = 2.0
+
+    def to_dict(self) -> Dict[str, Any]:
+        data = asdict(self)
+        data["parameters"] = list(self.parameters)
+        return data
+
+
+_REASONING = ()  # o-series models take none of the sampling parameters
+
+MODEL_CAPABILITIES: Dict[str, ModelCapabilities] = {
+    # OpenAI: logprobs on the gpt models only
+    "gpt-4o": ModelCapabilities(128000, 16384, supports_vision=True, supports_logprobs=True),
+    "gpt-4o-2024-05-13": ModelCapabilities(128000, 4096, supports_vision=True, supports_json_schema=False, supports_logprobs=True),
+    "gpt-4o-mini": ModelCapabilities(128000, 16384, supports_vision=True, supports_logprobs=True),
+    "gpt-4.1": ModelCapabilities(1047576, 32768, supports_vision=True, supports_logprobs=True),
+    "gpt-4-turbo": ModelCapabilities(128000, 4096, supports_vision=True, supports_json_schema=False, supports_logprobs=True),
+    "gpt-4": ModelCapabilities(8192, 8192, supports_json_schema=False, supports_logprobs=True),
+    "gpt-3.5-turbo": ModelCapabilities(16385, 4096, supports_json_schema=False, supports_logprobs=True),
+    "o1": ModelCapabilities(200000, 100000, supports_vision=True, parameters=_REASONING),
+    "o1-mini": ModelCapabilities(128000, 65536, supports_tools=False, supports_json_schema=False, parameters=_REASONING),
+    "o1-preview": ModelCapabilities(128000, 32768, supports_tools=False, supports_json_schema=False, parameters=_REASONING),
+    "o3": ModelCapabilities(200000, 100000, supports_vision=True, parameters=_REASONING),
+    "o3-mini": ModelCapabilities(200000, 100000, parameters=_REASONING),
+    "o4-mini": ModelCapabilities(200000, 100000, supports_vision=True, parameters=_REASONING),
+    # Anthropic: no structured outputs, temperatures up to 1
+    "claude-3-haiku": ModelCapabilities(200000, 4096, supports_vision=True, supports_json_schema=False, max_temperature=1.0),
+    "claude-3-sonnet": ModelCapabilities(200000, 4096, supports_vision=True, supports_json_schema=False, max_temperature=1.0),
+    "claude-3-opus": ModelCapabilities(200000, 4096, supports_vision=True, supports_json_schema=False, max_temperature=1.0),
+    "claude-3-5-haiku": ModelCapabilities(200000, 8192, supports_json_schema=False, max_temperature=1.0),
+    "claude-3-5-sonnet": ModelCapabilities(200000, 8192, supports_vision=True, supports_json_schema=False, max_temperature=1.0),
+    "claude-3-7-sonnet": ModelCapabilities(200000, 64000, supports_vision=True, supports_json_schema=False, max_temperature=1.0),
+    "claude-sonnet-4": ModelCapabilities(200000, 64000, supports_vision=True, supports_json_schema=False, max_temperature=1.0),
+    "claude-opus-4": ModelCapabilities(200000, 32000, supports_vision=True, supports_json_schema=False, max_temperature=1.0),
+    # Mistral: temperatures up to 1.5
+    "mistral-large": ModelCapabilities(128000, max_temperature=1.5),
+    "mistral-small": ModelCapabilities(32000, max_temperature=1.5),
+    "pixtral": ModelCapabilities(128000, supports_vision=True, max_temperature=1.5),
+    # Gemini
+    "gemini-1.5-flash": ModelCapabilities(1048576, 8192, supports_vision=True),
+    "gemini-1.5-pro": ModelCapabilities(2097152, 8192, supports_vision=True),
+    "gemini-2.0-flash": ModelCapabilities(1048576, 8192, supports_vision=True),
+    "gemini-2.5-flash": ModelCapabilities(1048576, 65536, supports_vision=True),
+    "gemini-2.5-pro": ModelCapabilities(1048576, 65536, supports_vision=True),
+}
+
+
+def lookup(model: str, overrides: Optional[Dict[str, Dict[str, Any]]] = None) -> Optional[ModelCapabilities]:
+    """Capabilities of model: its longest prefix in the table, with the
+    fields of overrides[model] (a target's llm.models) set over it. None
+    for a model in neither."""
+    prefix = max((name for name in MODEL_CAPABILITIES if model.startswith(name)), key=len, default=None)
+    capabilities = MODEL_CAPABILITIES.get(prefix) if prefix else None
+    override = (overrides or {}).get(model)
+    if override is None:
+        return capabilities
+    fields = {k: v for k, v in override.items() if v is not None}
+    if "parameters" in fields:
+        fields["parameters"] = tuple(fields["parameters"])
+    return replace(capabilities or ModelCapabilities(), **fields)
+
+
+def table(overrides: Optional[Dict[str, Dict[str, Any]]] = None) -> Dict[str, Dict[str, Any]]:
+    """The capability table as GET /models returns it: the bundled entries,
+    or with a target's overrides, the models they describe."""
+    if overrides is None:
+        return {name: caps.to_dict() for name, caps in sorted(MODEL_CAPABILITIES.items())}
+    return {name: lookup(name, overrides).to_dict() for name in sorted(overrides)}
+
+
+@dataclass
+class Issue:
+    """One way a request exceeds what its model accepts."""
+
+    field: str
+    message: str
+    # The allowed range of a numeric field
+    min: Optional[float] = None
+    max: Optional[float] = None
+    # What fit_request changes a non-strict request's field to: a clamped
+    # value, or None to drop the parameter. Issues without a fix fail
+    # either way.
+    fixable: bool = False
+    fixed_value: Any = None
+
+    def to_dict(self) -> Dict[str, Any]:
+        data = {"field": self.field, "message": self.message}
+        if self.min is not None:
+            data["min"] = self.min
+        if self.max is not None:
+            data["max"] = self.max
+        return data
+
+
+@dataclass
+class FitResult:
+    """A request's fields after fit_request, and what it changed."""
+
+    values: Dict[str, Any]
+    adjustments: List[Dict[str, Any]] = field(default_factory=list)
+    issues: List[Issue] = field(default_factory=list)
+
+
+def check_request(
+    capabilities: ModelCapabilities,
+    model: str,
+    prompt_tokens: int,
+    values: Dict[str, Any],
+    has_images: bool = False,
+) -> List[Issue]:
+    """What is wrong with a request for model, given its prompt's estimated
+    tokens and its max_tokens, temperature, top_p, stop, tools, logprobs and
+    top_logprobs values.
+    A json_schema response_format is left to the proxy's structured output
+    handling, which may fall back to JSON mode."""
+    issues: List[Issue] = []
+    window = capabilities.context_window
+    if window is not None and prompt_tokens >= window:
+        issues.append(Issue("messages", f"Prompt is about {prompt_tokens} tokens, over the {window} of {model}", max=window))
+
+    max_tokens = values.get("max_tokens")
+    if max_tokens is not None:
+        limit = capabilities.max_output_tokens
+        if window is not None and prompt_tokens < window:
+            room = window - prompt_tokens
+            limit = room if limit is None else min(limit, room)
+        if limit is not None and max_tokens > limit:
+            issues.append(Issue(
+                "max_tokens",
+                f"max_tokens {max_tokens} is over the {limit} {model} can generate for this prompt",
+                min=1, max=limit, fixable=True, fixed_value=limit,
+            ))
+
+    for name in SAMPLING_PARAMETERS:
+        if values.get(name) is not None and name not in capabilities.parameters:
+            issues.append(Issue(name, f"{model} does not accept {name}", fixable=True))
+    temperature = values.get("temperature")
+    if temperature is not None and "temperature" in capabilities.parameters and temperature > capabilities.max_temperature:
+        issues.append(Issue(
+            "temperature",
+            f"temperature {temperature} is over the {capabilities.max_temperature} of {model}",
+            min=0, max=capabilities.max_temperature, fixable=True, fixed_value=capabilities.max_temperature,
+        ))
+
+    if values.get("tools") and not capabilities.supports_tools:
+        issues.append(Issue("tools", f"{model} does not support tools"))
+    if has_images and not capabilities.supports_vision:
+        issues.append(Issue("messages", f"{model} does not accept images"))
+    top_logprobs = values.get("top_logprobs")
+    if (values.get("logprobs") or top_logprobs is not None) and not capabilities.supports_logprobs:
+        issues.append(Issue("logprobs", f"{model} does not return logprobs"))
+    return issues
+
+
+def fit_request(
+    capabilities: ModelCapabilities,
+    model: str,
+    prompt_tokens: int,
+    values: Dict[str, Any],
+    strict: bool = True,
+    has_images: bool = False,
+) -> FitResult:
+    """check_request, with the fixable issues of a non-strict request fixed
+    in the returned values: max_tokens and temperature clamped, unsupported
+    sampling parameters dropped. issues holds what is still wrong."""
+    result = FitResult(values=dict(values))
+    for issue in check_request(capabilities, model, prompt_tokens, values, has_images):
+        if strict or not issue.fixable:
+            result.issues.append(issue)
+            continue
+        adjustment = {"field": issue.field, "from": values[issue.field], "reason": issue.message}
+        if issue.fixed_value is None:
+            adjustment["action"] = "dropped"
+        else:
+            adjustment["action"] = "clamped"
+            adjustment["to"] = issue.fixed_value
+        result.values[issue.field] = issue.fixed_value
+        result.adjustments.append(adjustment)
+    return result
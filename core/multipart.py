@@ -0,0 +1,46 @@
+"""multipart/form-data bodies for /proxy/http.
+
+A request's multipart parts are encoded here into the upstream body (RFC
+7578). The boundary is derived from the parts themselves, so the same
+parts always encode to the same bytes: idempotent replays compare equal,
+and the boundary is checked not to occur in any part.
+"""
+import hashlib
+from typing import List, Optional, Tuple
+
+# Largest multipart body, after decoding, that a request may carry.
+MAX_MULTIPART_BYTES = 64 * 1024 * 1024
+
+
+def _quote(value: str) -> str:
+    """Quote a Content-Disposition parameter value."""
+    return '"' + value.replace("\\", "\\\\").replace('"', '\\"').replace("\r", "%0D").replace("\n", "%0A") + '"'
+
+
+def encode_multipart(parts: List[Tuple[str, Optional[str], Optional[str], bytes]]) -> Tuple[bytes, str]:
+    """Encode (name, filename, content_type, data) parts.
+
+    Returns the body and its Content-Type header value.
+    """
+    digest = hashlib.sha256()
+    for name, filename, content_type, data in parts:
+        for field in (name, filename or "", content_type or ""):
+            digest.update(field.encode() + b"\0")
+        digest.update(hashlib.sha256(data).digest())
+    boundary = "reliapi-" + digest.hexdigest()[:32]
+    # A hash-derived boundary practically never occurs in the data; if it
+    # does, rehash until it doesn't
+    while any(boundary.encode() in data for _, _, _, data in parts):
+        boundary = "reliapi-" + hashlib.sha256(boundary.encode()).hexdigest()[:32]
+
+    chunks = []
+    for name, filename, content_type, data in parts:
+        disposition = f"form-data; name={_quote(name)}"
+        if filename is not None:
+            disposition += f"; filename={_quote(filename)}"
+        head = f"--{boundary}\r\nContent-Disposition: {disposition}\r\n"
+        if content_type:
+            head += f"Content-Type: {content_type}\r\n"
+        chunks.append(head.encode() + b"\r\n" + data + b"\r\n")
+    chunks.append(f"--{boundary}--\r\n".encode())
+    return b"".join(chunks), f"multipart/form-data; boundary={boundary}"
@@ -0,0 +1,150 @@
+"""Priority queueing of LLM requests against a target's rate budget.
+
+A target's queue config (config.schema.QueueConfig) caps the requests
+sent to it per second. Requests over the budget wait in a bounded queue
+instead of failing, and are let through as the budget refills in priority
+order: interactive before default before batch, first come first served
+within a class. A full queue turns away the newest of its lowest class to
+make room for a higher one, so bursts of batch traffic can't lock out
+interactive requests. Like the rate scheduler, queues are process-local.
+"""
+import asyncio
+import heapq
+import itertools
+import time
+from typing import Any, Dict, List, Optional, Tuple
+
+# Priority classes, highest first
+PRIORITY_INTERACTIVE = "interactive"
+PRIORITY_DEFAULT = "default"
+PRIORITY_BATCH = "batch"
+PRIORITIES = (PRIORITY_INTERACTIVE, PRIORITY_DEFAULT, PRIORITY_BATCH)
+
+# Default limits of a queue config
+DEFAULT_MAX_QUEUE = 100
+DEFAULT_QUEUE_TIMEOUT_MS = 10000
+
+
+class QueueFullError(Exception):
+    """A request was turned away by a full queue or waited past its timeout."""
+
+    def __init__(self, message: str, retry_after_s: float):
+        super().__init__(message)
+        self.retry_after_s = retry_after_s
+
+
+class TargetQueue:
+    """Admits requests at max_qps, queueing up to max_queue of them."""
+
+    def __init__(self, max_qps: float, max_queue: int = DEFAULT_MAX_QUEUE):
+        self.max_qps = max_qps
+        self.max_queue = max_queue
+        # A second's worth of requests may go at once
+        self._capacity = max(1.0, max_qps)
+        self._tokens = self._capacity
+        self._refilled = time.monotonic()
+        # (rank, seq, future); futures of requests that gave up stay until popped
+        self._heap: List[Tuple[int, int, asyncio.Future]] = []
+        self._seq = itertools.count()
+        self._timer: Optional[asyncio.TimerHandle] = None
+
+    @property
+    def waiting(self) -> int:
+        """Requests in the queue."""
+        return sum(1 for _, _, fut in self._heap if not fut.done())
+
+    def _refill(self) -> None:
+        now = time.monotonic()
+        self._tokens = min(self._capacity, self._tokens + (now - self._refilled) * self.max_qps)
+        self._refilled = now
+
+    def _retry_after(self, position: int) -> float:
+        """Seconds until a request queued behind position others would go."""
+        return round((position + 1 - min(self._tokens, 1.0)) / self.max_qps, 3)
+
+    async def admit(self, priority: str, timeout_s: float) -> float:
+        """Wait for the request's turn and return the seconds waited.
+
+        Raises QueueFullError if the queue has no room for the request's
+        class or its turn doesn't come within timeout_s.
+        """
+        started = time.monotonic()
+        rank = PRIORITIES.index(priority)
+        self._refill()
+        if not any(not fut.done() and r <= rank for r, _, fut in self._heap) and self._tokens >= 1:
+            self._tokens -= 1
+            return 0.0
+
+        waiting = [(r, seq, fut) for r, seq, fut in self._heap if not fut.done()]
+        if len(waiting) >= self.max_queue:
+            r, _, fut = max(waiting)
+            if r <= rank:
+                raise QueueFullError(
+                    f"Queue full ({len(waiting)} requests waiting)", self._retry_after(len(waiting))
+                )
+            # Make room by turning away the newest request of the lowest class
+            fut.set_exception(
+                QueueFullError("Turned away for a higher priority request", self._retry_after(len(waiting)))
+            )
+
+        fut = asyncio.get_running_loop().create_future()
+        heapq.heappush(self._heap, (rank, next(self._seq), fut))
+        if self._timer is None:
+            self._dispatch()
+        try:
+            await asyncio.wait_for(asyncio.shield(fut), timeout_s)
+        except asyncio.TimeoutError:
+            if not fut.done():
+                fut.cancel()
+                ahead = sum(1 for r, _, f in self._heap if not f.done() and r <= rank)
+                raise QueueFullError(
+                    f"No turn within {int(timeout_s * 1000)} ms", self._retry_after(ahead)
+                )
+        except asyncio.CancelledError:
+            fut.cancel()
+            raise
+        # Timed out just as its turn came, or was turned away while waiting
+        fut.result()
+        return time.monotonic() - started
+
+    def _dispatch(self) -> None:
+        """Let queued requests go while the budget allows, and schedule the next round."""
+        self._timer = None
+        self._refill()
+        while self._heap and self._tokens >= 1:
+            _, _, fut = heapq.heappop(self._heap)
+            if fut.done():
+                continue
+            self._tokens -= 1
+            fut.set_result(None)
+        while self._heap and self._heap[0][2].done():
+            heapq.heappop(self._heap)
+        if self._heap and self._timer is None:
+            delay = (1 - self._tokens) / self.max_qps
+            self._timer = asyncio.get_running_loop().call_later(delay, self._dispatch)
+
+
+class TargetQueues:
+    """The queues of the targets with a queue config."""
+
+    def __init__(self) -> None:
+        self._queues: Dict[str, Tuple[Tuple[float, int], TargetQueue]] = {}
+
+    def get(self, target_name: str, config: Optional[Dict[str, Any]]) -> Optional[TargetQueue]:
+        """The queue of target_name under config, None without a rate budget.
+
+        A changed config starts a new queue; requests already waiting in the
+        old one are let through by it.
+        """
+        if not config or not config.get("max_qps"):
+            return None
+        limits = (config["max_qps"], config.get("max_queue", DEFAULT_MAX_QUEUE))
+        entry = self._queues.get(target_name)
+        if entry is None or entry[0] != limits:
+            entry = (limits, TargetQueue(*limits))
+            self._queues[target_name] = entry
+        return entry[1]
+
+    def reset(self) -> None:
+        """Forget all queues."""
+        self._queues.clear()
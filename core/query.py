@@ -0,0 +1,79 @@
+"""Encoding of /proxy/http query parameters.
+
+A query maps parameter names to scalars or flat lists of scalars:
+
+- strings are sent as given (URL-escaped once, by the HTTP client);
+- booleans become "true"/"false" and null becomes an empty value;
+- numbers use their shortest exact decimal form, without exponent, so
+  10 and 10.0 are both "10" and 1e-7 is "0.0000001";
+- lists follow the request's query_array_format: "repeat" (tag=a&tag=b,
+  the default), "comma" (tag=a,b) or "bracket" (tag[]=a&tag[]=b). An empty
+  list sends no parameter.
+
+Nested objects and lists of lists have no agreed encoding and are rejected.
+The Go client applies the same rules (reliapi/query.go).
+"""
+import math
+from decimal import Decimal
+from typing import Any, Dict, List, Optional, Union
+
+ARRAY_FORMATS = ("repeat", "comma", "bracket")
+
+QueryValue = Union[str, List[str]]
+
+
+def format_query_scalar(name: str, value: Any) -> str:
+    """Canonical string form of a scalar query value."""
+    if value is None:
+        return ""
+    if isinstance(value, bool):
+        return "true" if value else "false"
+    if isinstance(value, int):
+        return str(value)
+    if isinstance(value, float):
+        if not math.isfinite(value):
+            raise ValueError(f"query parameter '{name}' must be a finite number")
+        text = format(Decimal(repr(value)), "f")
+        if "." in text:
+            text = text.rstrip("0").rstrip(".")
+        return "0" if text == "-0" else text
+    if isinstance(value, str):
+        return value
+    if isinstance(value, dict):
+        raise ValueError(f"query parameter '{name}' is an object; nested query values are not supported")
+    raise ValueError(f"query parameter '{name}' has unsupported type {type(value).__name__}")
+
+
+def normalize_query(
+    query: Optional[Dict[str, Any]], array_format: str = "repeat"
+) -> Optional[Dict[str, QueryValue]]:
+    """Return query with every value in its canonical string form.
+
+    Lists become lists of strings named and joined per array_format, which
+    the HTTP client sends as repeated parameters. Raises ValueError for
+    values the rules above reject.
+    """
+    if query is None:
+        return None
+    if array_format not in ARRAY_FORMATS:
+        raise ValueError(f"query_array_format must be one of {list(ARRAY_FORMATS)}")
+
+    normalized: Dict[str, QueryValue] = {}
+    for name, value in query.items():
+        if not isinstance(value, (list, tuple)):
+            normalized[name] = format_query_scalar(name, value)
+            continue
+        items = []
+        for item in value:
+            if isinstance(item, (list, tuple)):
+                raise ValueError(f"query parameter '{name}' nests a list; only flat lists are supported")
+            items.append(format_query_scalar(name, item))
+        if not items:
+            continue
+        if array_format == "comma":
+            normalized[name] = ",".join(items)
+        elif array_format == "bracket":
+            normalized[f"{name}[]"] = items
+        else:
+            normalized[name] = items
+    return normalized
@@ -0,0 +1,118 @@
+"""Redaction of sensitive values in LLM prompts.
+
+A target's redaction config (config.schema.RedactionConfig) replaces
+emails, phone numbers, card numbers and any custom patterns in message
+text with numbered placeholders such as "[EMAIL_1]" before the prompt is
+keyed, cached, logged or sent to the provider. Server-side redaction is
+one-way: the provider's answer is returned with the placeholders in it.
+Clients that need the values back redact themselves and keep the mapping
+(the Go client's WithRedactor).
+"""
+import hashlib
+import re
+from dataclasses import dataclass
+from typing import Any, Callable, Dict, List, Optional, Pattern, Tuple
+
+
+def _luhn_valid(number: str) -> bool:
+    """Whether the digits of number pass the Luhn checksum."""
+    digits = [int(c) for c in number if c.isdigit()]
+    total = 0
+    for i, d in enumerate(reversed(digits)):
+        if i % 2:
+            d *= 2
+            if d > 9:
+                d -= 9
+        total += d
+    return total % 10 == 0
+
+
+# Built-in patterns: name -> (placeholder kind, regex, validator). Cards run
+# before phones so a card's digit groups are never taken for a number.
+BUILTIN_PATTERNS: Dict[str, Tuple[str, Pattern[str], Optional[Callable[[str], bool]]]] = {
+    "email": ("EMAIL", re.compile(r"[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}"), None),
+    "credit_card": ("CREDIT_CARD", re.compile(r"\b\d(?:[ -]?\d){12,18}\b"), _luhn_valid),
+    "phone": (
+        "PHONE",
+        re.compile(r"(?:\+[1-9]\d{0,2}[ .-]?)?(?:\(\d{2,4}\)|\b\d{2,4})[ .-]\d{3,4}[ .-]\d{3,4}\b"),
+        None,
+    ),
+}
+
+
+@dataclass
+class RedactionResult:
+    """Redacted messages and what was replaced."""
+    messages: List[Dict[str, Any]]
+    # Values replaced, repeats included
+    applied: int = 0
+    # Hash of the replaced values in order; None when nothing was replaced
+    digest: Optional[str] = None
+
+
+class Redactor:
+    """Replaces matches of a target's patterns within one request.
+
+    The same value gets the same placeholder throughout the request.
+    """
+
+    def __init__(self, config: Dict[str, Any]):
+        names = config.get("patterns") or list(BUILTIN_PATTERNS)
+        self._patterns = [BUILTIN_PATTERNS[name] for name in BUILTIN_PATTERNS if name in names]
+        for kind, pattern in (config.get("custom_patterns") or {}).items():
+            self._patterns.append((re.sub(r"[^A-Z0-9]", "_", kind.upper()), re.compile(pattern), None))
+        self._tokens: Dict[Tuple[str, str], str] = {}
+        self._counts: Dict[str, int] = {}
+        # Values replaced so far, in order, repeats included
+        self.values: List[str] = []
+
+    def redact(self, text: str) -> str:
+        """Replace the matches in text with their placeholders."""
+        for kind, pattern, valid in self._patterns:
+            def replace(m: "re.Match[str]") -> str:
+                value = m.group(0)
+                if valid is not None and not valid(value):
+                    return value
+                self.values.append(value)
+                if (kind, value) not in self._tokens:
+                    self._counts[kind] = self._counts.get(kind, 0) + 1
+                    self._tokens[(kind, value)] = f"[{kind}_{self._counts[kind]}]"
+                return self._tokens[(kind, value)]
+            text = pattern.sub(replace, text)
+        return text
+
+    def redact_messages(self, messages: List[Dict[str, Any]]) -> RedactionResult:
+        """Redact the text content of messages, leaving the originals unchanged."""
+        redacted = []
+        for message in messages:
+            content = message.get("content")
+            if isinstance(content, str):
+                message = {**message, "content": self.redact(content)}
+            elif isinstance(content, list):
+                message = {
+                    **message,
+                    "content": [
+                        {**part, "text": self.redact(part["text"])}
+                        if isinstance(part, dict) and part.get("type") == "text" and isinstance(part.get("text"), str)
+                        else part
+                        for part in content
+                    ],
+                }
+            redacted.append(message)
+
+        digest = hashlib.sha256("\0".join(self.values).encode()).hexdigest() if self.values else None
+        return RedactionResult(messages=redacted, applied=len(self.values), digest=digest)
+
+
+def redact_messages(messages: List[Dict[str, Any]], config: Optional[Dict[str, Any]]) -> RedactionResult:
+    """Redact messages under a target's redaction config; a no-op without one."""
+    if not config or not config.get("enabled", True):
+        return RedactionResult(messages=messages)
+    return Redactor(config).redact_messages(messages)
+
+
+def redact_text(text: str, config: Optional[Dict[str, Any]]) -> str:
+    """Redact text under a target's redaction config; a no-op without one."""
+    if not config or not config.get("enabled", True):
+        return text
+    return Redactor(config).redact(text)
@@ -0,0 +1,154 @@
+"""Replays of audited proxy requests (POST /replay/{request_id}).
+
+Under a target's audit capture "full", the audit record of a /proxy/llm or
+/proxy/http request also keeps the request as the caller sent it
+(replay_section), so that an operator can run it again with the admin key.
+The proxy routes run replays themselves, inside replaying(). A replay acts
+for the tenant of the original request, so it is billed and budgeted like
+any other request of that tenant, and meta.replay_of names the request it
+replayed.
+
+Some stored requests can't be replayed:
+- requests larger than the target's max_body_bytes;
+- conversation turns, since the conversation's history has moved on;
+- /proxy/http requests where redaction replaced values. Their bodies are
+  sent upstream as they are and redacted only in the record, so a replay
+  would send something else.
+LLM prompts are redacted before they are sent, so for those the redacted
+messages are exactly what the provider saw.
+"""
+import json
+from contextlib import contextmanager
+from contextvars import ContextVar
+from dataclasses import dataclass
+from typing import Any, Dict, Iterator, Optional
+
+from reliapi.core.redaction import Redactor
+
+# Proxy routes whose requests can be replayed
+REPLAYABLE_KINDS = frozenset({"llm", "http"})
+
+
+class ReplayUnavailable(Exception):
+    """The stored request can't be replayed; the message says why."""
+
+
+@dataclass(frozen=True)
+class Replay:
+    """A replay in progress: the request replayed and its tenant."""
+
+    request_id: str
+    tenant: Optional[str]
+
+
+_replay: ContextVar[Optional[Replay]] = ContextVar("reliapi_replay", default=None)
+
+
+@contextmanager
+def replaying(request_id: str, tenant: Optional[str]) -> Iterator[Replay]:
+    """Run the proxy requests made inside the block as replays of request_id."""
+    replay = Replay(request_id=request_id, tenant=tenant)
+    token = _replay.set(replay)
+    try:
+        yield replay
+    finally:
+        _replay.reset(token)
+
+
+def current_replay() -> Optional[Replay]:
+    """The replay the current request is, or None."""
+    return _replay.get()
+
+
+def _redact_values(values: Optional[Dict[str, Any]], redactor: Redactor) -> Optional[Dict[str, Any]]:
+    if not values:
+        return values
+    return {
+        k: redactor.redact(v) if isinstance(v, str)
+        else [redactor.redact(i) if isinstance(i, str) else i for i in v] if isinstance(v, list)
+        else v
+        for k, v in values.items()
+    }
+
+
+def replay_section(
+    kind: str, request: Dict[str, Any], redactor: Optional[Redactor], max_body_bytes: int
+) -> Dict[str, Any]:
+    """The replay section of an audit record for request, the JSON of a
+    proxy request: {"request": the request, redacted, or None,
+    "unavailable": why it can't be replayed, or None}."""
+    if kind not in REPLAYABLE_KINDS:
+        return {"request": None, "unavailable": f"{kind} requests can't be replayed"}
+    if request.get("conversation_id") is not None:
+        return {"request": None, "unavailable": "conversation turns can't be replayed"}
+    if redactor is not None:
+        replaced = len(redactor.values)
+        if kind == "llm":
+            request = dict(request)
+            if request.get("messages"):
+                request["messages"] = redactor.redact_messages(request["messages"]).messages
+            if request.get("template"):
+                request["template"] = {
+                    **request["template"],
+                    "variables": _redact_values(request["template"].get("variables"), redactor),
+                }
+        else:
+            request = {
+                **request,
+                "headers": _redact_values(request.get("headers"), redactor),
+                "query": _redact_values(request.get("query"), redactor),
+            }
+            if request.get("body") and request.get("body_encoding", "utf8") == "utf8":
+                request["body"] = redactor.redact(request["body"])
+            if len(redactor.values) > replaced:
+                return {
+                    "request": None,
+                    "unavailable": "redaction replaced values the request sent upstream as they were",
+                }
+    size = len(json.dumps(request, ensure_ascii=False).encode())
+    if size > max_body_bytes:
+        return {
+            "request": None,
+            "unavailable": f"the request was {size} bytes, more than the {max_body_bytes} captured",
+        }
+    return {"request": request, "unavailable": None}
+
+
+def replay_body(
+    record: Dict[str, Any],
+    model: Optional[str] = None,
+    temperature: Optional[float] = None,
+    target: Optional[str] = None,
+) -> Dict[str, Any]:
+    """The proxy request to send for a replay of the request of record,
+    with the overrides applied. It never carries the original's
+    idempotency key, and it is neither streamed nor a dry run.
+
+    Raises:
+        ReplayUnavailable: record holds no replayable request.
+        ValueError: model or temperature is set for an /proxy/http request.
+    """
+    section = record.get("replay")
+    if section is None:
+        if record["kind"] not in REPLAYABLE_KINDS:
+            raise ReplayUnavailable(f"{record['kind']} requests can't be replayed")
+        raise ReplayUnavailable(
+            f"the request was not captured: the audit capture of target '{record['target']}' was not 'full'"
+        )
+    if section["unavailable"]:
+        raise ReplayUnavailable(section["unavailable"])
+    body = {k: v for k, v in section["request"].items() if k not in ("idempotency_key", "idempotency_ttl_s")}
+    if record["kind"] == "llm":
+        body["stream"] = False
+        if model is not None:
+            body["model"] = model
+        if temperature is not None:
+            body["temperature"] = temperature
+    else:
+        if model is not None or temperature is not None:
+            raise ValueError("model and temperature only apply to replays of /proxy/llm requests")
+        body["stream_response"] = False
+    body["dry_run"] = False
+    if target is not None:
+        body["target"] = target
+    return body
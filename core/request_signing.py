@@ -0,0 +1,243 @@
+"""HMAC-signed requests: an alternative to sending a static API key.
+
+A client holding a shared secret signs each request instead of sending
+X-API-Key. It sends the key's id, a Unix timestamp, a random nonce and
+the hex HMAC-SHA256 under the secret of the canonical request:
+
+    METHOD \\n path[?query] \\n sha256hex(body) \\n timestamp \\n nonce
+
+RequestSigningMiddleware verifies the signature over the body as it
+arrived (before CompressionMiddleware decodes it), rejects timestamps
+more than max_skew_s from the proxy's clock, and remembers nonces for
+twice that long so a captured request can't be replayed. A verified
+request continues with the API key configured for its key id in
+X-API-Key, so tenants, tiers and key limits resolve as for that key.
+Requests without a signature pass through unchanged.
+
+Like the budget ledgers, the nonce cache is process-local: behind several
+replicas a replay could still reach one that hasn't seen the nonce.
+"""
+import hashlib
+import heapq
+import hmac
+import json
+import threading
+import time
+from dataclasses import dataclass, field
+from typing import Callable, Dict, List, Optional, Tuple
+
+KEY_ID_HEADER = b"x-reliapi-key-id"
+TIMESTAMP_HEADER = b"x-reliapi-timestamp"
+NONCE_HEADER = b"x-reliapi-nonce"
+SIGNATURE_HEADER = b"x-reliapi-signature"
+
+DEFAULT_MAX_SKEW_S = 300
+
+
+class SignatureError(Exception):
+    """A signed request that does not verify."""
+
+
+def canonical_request(method: str, target: str, body: bytes, timestamp: str, nonce: str) -> bytes:
+    """The string a request's signature covers."""
+    body_hash = hashlib.sha256(body).hexdigest()
+    return f"{method.upper()}\n{target}\n{body_hash}\n{timestamp}\n{nonce}".encode()
+
+
+def sign(secret: str, method: str, target: str, body: bytes, timestamp: str, nonce: str) -> str:
+    """The hex HMAC-SHA256 of a request under secret."""
+    message = canonical_request(method, target, body, timestamp, nonce)
+    return hmac.new(secret.encode(), message, hashlib.sha256).hexdigest()
+
+
+class NonceCache:
+    """Nonces seen within their time to live.
+
+    Expiries are kept in a heap as well, so each add prunes only the nonces
+    that have expired instead of scanning every live one.
+    """
+
+    def __init__(self) -> None:
+        self._expires: Dict[Tuple[str, str], float] = {}
+        self._heap: List[Tuple[float, Tuple[str, str]]] = []
+        self._lock = threading.Lock()
+
+    def add(self, key_id: str, nonce: str, ttl_s: float, now: float) -> bool:
+        """Remember nonce for ttl_s; False if it was already seen."""
+        key = (key_id, nonce)
+        with self._lock:
+            while self._heap and self._heap[0][0] <= now:
+                expires, expired = heapq.heappop(self._heap)
+                # A nonce seen again after it expired has a later entry
+                if self._expires.get(expired) == expires:
+                    del self._expires[expired]
+            if key in self._expires:
+                return False
+            self._expires[key] = now + ttl_s
+            heapq.heappush(self._heap, (now + ttl_s, key))
+            return True
+
+    def __len__(self) -> int:
+        with self._lock:
+            return len(self._expires)
+
+    def reset(self) -> None:
+        """Forget all nonces."""
+        with self._lock:
+            self._expires.clear()
+            self._heap.clear()
+
+
+@dataclass
+class RequestVerifier:
+    """The signing keys, by id, as (secret, API key) pairs."""
+
+    keys: Dict[str, Tuple[str, str]]
+    max_skew_s: int = DEFAULT_MAX_SKEW_S
+    nonces: NonceCache = field(default_factory=NonceCache)
+
+    def verify(
+        self,
+        key_id: Optional[str],
+        timestamp: Optional[str],
+        nonce: Optional[str],
+        signature: str,
+        method: str,
+        target: str,
+        body: bytes,
+        now: Optional[float] = None,
+    ) -> str:
+        """Verify a signed request and return the API key it acts as.
+
+        Raises SignatureError naming what failed.
+        """
+        now = time.time() if now is None else now
+        if not key_id or not timestamp or not nonce:
+            raise SignatureError("Signed requests need X-ReliAPI-Key-Id, X-ReliAPI-Timestamp and X-ReliAPI-Nonce")
+        key = self.keys.get(key_id)
+        if key is None:
+            raise SignatureError(f"Unknown signing key '{key_id}'")
+        try:
+            signed_at = int(timestamp)
+        except ValueError:
+            raise SignatureError("X-ReliAPI-Timestamp must be Unix seconds") from None
+        if abs(now - signed_at) > self.max_skew_s:
+            raise SignatureError(f"Request timestamp is more than {self.max_skew_s}s from the proxy's clock")
+        secret, api_key = key
+        if not hmac.compare_digest(sign(secret, method, target, body, timestamp, nonce), signature):
+            raise SignatureError("Request signature does not match")
+        # After the signature, so unsigned garbage can't fill the cache
+        if not self.nonces.add(key_id, nonce, 2 * self.max_skew_s, now):
+            raise SignatureError("Request nonce was already used")
+        return api_key
+
+
+def _header(scope, name: bytes) -> Optional[str]:
+    for key, value in scope.get("headers", []):
+        if key.lower() == name:
+            return value.decode("latin-1")
+    return None
+
+
+def _target(scope) -> str:
+    path = scope.get("raw_path") or scope["path"].encode()
+    target = path.decode("latin-1")
+    if scope.get("query_string"):
+        target += "?" + scope["query_string"].decode("latin-1")
+    return target
+
+
+def _unauthorized(scope, message: str) -> Tuple[dict, bytes]:
+    body = json.dumps(
+        {
+            "success": False,
+            "error": {
+                "type": "client_error",
+                "code": "UNAUTHORIZED",
+                "message": message,
+                "retryable": False,
+                "target": None,
+                "status_code": 401,
+            },
+            "meta": {
+                "target": None,
+                "cache_hit": False,
+                "retries": 0,
+                "duration_ms": 0,
+                "request_id": _header(scope, b"x-request-id") or "unknown",
+                "trace_id": _header(scope, b"x-trace-id"),
+            },
+        }
+    ).encode()
+    start = {
+        "type": "http.response.start",
+        "status": 401,
+        "headers": [(b"content-type", b"application/json"), (b"content-length", str(len(body)).encode())],
+    }
+    return start, body
+
+
+class RequestSigningMiddleware:
+    """ASGI middleware verifying signed requests.
+
+    get_verifier returns the RequestVerifier of the loaded config, or None
+    when request signing isn't configured; it is called per request since
+    the config loads after the middleware is installed.
+    """
+
+    def __init__(self, app, get_verifier: Callable[[], Optional[RequestVerifier]]):
+        self.app = app
+        self.get_verifier = get_verifier
+
+    async def __call__(self, scope, receive, send):
+        signature = _header(scope, SIGNATURE_HEADER) if scope["type"] == "http" else None
+        if signature is None:
+            await self.app(scope, receive, send)
+            return
+
+        chunks = []
+        while True:
+            message = await receive()
+            if message["type"] == "http.disconnect":
+                return
+            chunks.append(message.get("body", b""))
+            if not message.get("more_body", False):
+                break
+        body = b"".join(chunks)
+
+        verifier = self.get_verifier()
+        try:
+            if verifier is None:
+                raise SignatureError("Request signing is not configured on this proxy")
+            api_key = verifier.verify(
+                _header(scope, KEY_ID_HEADER),
+                _header(scope, TIMESTAMP_HEADER),
+                _header(scope, NONCE_HEADER),
+                signature,
+                scope["method"],
+                _target(scope),
+                body,
+            )
+        except SignatureError as e:
+            start, error = _unauthorized(scope, str(e))
+            await send(start)
+            await send({"type": "http.response.body", "body": error})
+            return
+
+        headers = [(k, v) for k, v in scope["headers"] if k.lower() != b"x-api-key"]
+        headers.append((b"x-api-key", api_key.encode()))
+        await self.app({**scope, "headers": headers}, _replay(body, receive), send)
+
+
+def _replay(body: bytes, receive):
+    """A receive delivering the buffered body, then the client's messages."""
+    delivered = False
+
+    async def replay():
+        nonlocal delivered
+        if delivered:
+            return await receive()
+        delivered = True
+        return {"type": "http.request", "body": body, "more_body": False}
+
+    return replay
@@ -0,0 +1,227 @@
+"""Response filters: field selections that shrink proxied payloads.
+
+A filter is a comma-separated list of paths in a JMESPath-like syntax:
+names joined by dots, [n] for the element at index n of an array (negative
+from the end) and [*] for every element, e.g.
+"choices[0].message.content, usage". Names with other characters than
+letters, digits, "_" and "-" are quoted: "x-request-id".
+
+Applying a filter keeps the selected fields and drops everything else, so
+the result has the shape of the original and decodes into the same types:
+{"a": {"b": 1, "c": 2}, "d": 3} filtered by "a.b" is {"a": {"b": 1}}.
+Arrays keep only their selected elements, in their original order. Paths
+that don't match are left out. Filtering a filtered value again with the
+same filter returns it unchanged.
+"""
+import json
+from dataclasses import dataclass, field
+from typing import Any, Dict, List, Optional, Union
+
+_NAME_CHARS = frozenset("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-")
+
+# A selected field left out of the result
+_MISSING = object()
+
+
+class FilterSyntaxError(ValueError):
+    """A response filter that does not parse; position is the 0-based
+    offset of the character the error was found at."""
+
+    def __init__(self, message: str, position: int):
+        super().__init__(f"{message} at position {position}")
+        self.position = position
+
+
+@dataclass
+class _Selection:
+    """What a filter selects of a value: all of it (whole), or the fields,
+    array elements and every array element (star) that the child
+    selections select of."""
+
+    whole: bool = False
+    names: Dict[str, "_Selection"] = field(default_factory=dict)
+    indexes: Dict[int, "_Selection"] = field(default_factory=dict)
+    star: Optional["_Selection"] = None
+
+    def merge(self, other: "_Selection") -> "_Selection":
+        """The union of two selections, as a new one."""
+        merged = _Selection(whole=self.whole or other.whole)
+        for name in {**self.names, **other.names}:
+            merged.names[name] = _union(self.names.get(name), other.names.get(name))
+        for index in {**self.indexes, **other.indexes}:
+            merged.indexes[index] = _union(self.indexes.get(index), other.indexes.get(index))
+        if self.star or other.star:
+            merged.star = _union(self.star, other.star)
+        return merged
+
+
+def _union(a: Optional[_Selection], b: Optional[_Selection]) -> _Selection:
+    if a is None:
+        return b
+    if b is None:
+        return a
+    return a.merge(b)
+
+
+class ResponseFilter:
+    """A parsed response filter; see parse_response_filter."""
+
+    def __init__(self, expression: str, selection: _Selection):
+        self.expression = expression
+        self._selection = selection
+
+    def apply(self, value: Any) -> Any:
+        """value with only the selected fields kept. A value the filter
+        selects nothing of becomes an empty object or array, or None."""
+        result = _select(value, self._selection)
+        if result is not _MISSING:
+            return result
+        if isinstance(value, dict):
+            return {}
+        if isinstance(value, list):
+            return []
+        return None
+
+
+def _select(value: Any, selection: _Selection) -> Any:
+    if selection.whole:
+        return value
+    if isinstance(value, dict):
+        kept = {}
+        for name, child in selection.names.items():
+            if name in value:
+                selected = _select(value[name], child)
+                if selected is not _MISSING:
+                    kept[name] = selected
+        return kept if kept else _MISSING
+    if isinstance(value, list) and (selection.indexes or selection.star):
+        chosen: Dict[int, _Selection] = {}
+        for index, child in selection.indexes.items():
+            position = index + len(value) if index < 0 else index
+            if 0 <= position < len(value):
+                chosen[position] = _union(chosen.get(position), child)
+        if selection.star:
+            for position in range(len(value)):
+                chosen[position] = _union(chosen.get(position), selection.star)
+        kept_items = []
+        for position in sorted(chosen):
+            selected = _select(value[position], chosen[position])
+            if selected is not _MISSING:
+                kept_items.append(selected)
+        return kept_items if kept_items or selection.star else _MISSING
+    return _MISSING
+
+
+class _Parser:
+    def __init__(self, expression: str):
+        self.text = expression
+        self.pos = 0
+
+    def error(self, message: str) -> FilterSyntaxError:
+        return FilterSyntaxError(message, self.pos)
+
+    def peek(self) -> str:
+        return self.text[self.pos] if self.pos < len(self.text) else ""
+
+    def skip_spaces(self) -> None:
+        while self.peek() and self.peek() in " \t\n":
+            self.pos += 1
+
+    def parse(self) -> _Selection:
+        selection = _Selection()
+        while True:
+            self.skip_spaces()
+            selection = selection.merge(self.path())
+            self.skip_spaces()
+            if not self.peek():
+                return selection
+            if self.peek() != ",":
+                raise self.error(f"expected ',' or the end, found {self.peek()!r}")
+            self.pos += 1
+
+    def path(self) -> _Selection:
+        steps: List[Union[str, int, None]] = []
+        if self.peek() == "[":
+            steps.append(self.bracket())
+        else:
+            steps.append(self.name())
+        while self.peek() in (".", "["):
+            if self.peek() == ".":
+                self.pos += 1
+                steps.append(self.name())
+            else:
+                steps.append(self.bracket())
+        selection = _Selection(whole=True)
+        for step in reversed(steps):
+            parent = _Selection()
+            if step is None:
+                parent.star = selection
+            elif isinstance(step, int):
+                parent.indexes[step] = selection
+            else:
+                parent.names[step] = selection
+            selection = parent
+        return selection
+
+    def name(self) -> str:
+        if self.peek() == '"':
+            return self.quoted_name()
+        start = self.pos
+        while self.peek() and self.peek() in _NAME_CHARS:
+            self.pos += 1
+        if self.pos == start:
+            found = repr(self.peek()) if self.peek() else "the end"
+            raise self.error(f"expected a field name, found {found}")
+        return self.text[start:self.pos]
+
+    def quoted_name(self) -> str:
+        start = self.pos
+        self.pos += 1
+        while self.peek() and self.peek() != '"':
+            self.pos += 2 if self.peek() == "\\" else 1
+        if not self.peek():
+            self.pos = start
+            raise self.error("unterminated quoted name")
+        self.pos += 1
+        try:
+            return json.loads(self.text[start:self.pos])
+        except ValueError:
+            self.pos = start
+            raise self.error("invalid quoted name")
+
+    def bracket(self) -> Optional[int]:
+        """An array step at "[": an index, or None for "*"."""
+        self.pos += 1
+        if self.peek() == "*":
+            self.pos += 1
+            index = None
+        else:
+            start = self.pos
+            if self.peek() == "-":
+                self.pos += 1
+            while self.peek() and self.peek() in "0123456789":
+                self.pos += 1
+            if self.text[start:self.pos] in ("", "-"):
+                self.pos = start
+                found = repr(self.peek()) if self.peek() else "the end"
+                raise self.error(f"expected an index or '*', found {found}")
+            index = int(self.text[start:self.pos])
+        if self.peek() != "]":
+            found = repr(self.peek()) if self.peek() else "the end"
+            raise self.error(f"expected ']', found {found}")
+        self.pos += 1
+        return index
+
+
+def parse_response_filter(expression: str) -> ResponseFilter:
+    """Parse a response filter.
+
+    Raises:
+        FilterSyntaxError: expression is not a valid filter.
+    """
+    return ResponseFilter(expression, _Parser(expression).parse())
+
+
+def payload_size(value: Any) -> int:
+    """The size in bytes of value serialized as compact JSON."""
+    return len(json.dumps(value, separators=(",", ":")).encode())
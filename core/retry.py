@@ -2,7 +2,8 @@
 import asyncio
 import random
 import time
-from typing import Any, Callable, Dict, Optional, TypeVar
+from dataclasses import dataclass, field
+from typing import Any, Callable, Dict, List, Optional, TypeVar
 
 T = TypeVar("T")
 
@@ -58,6 +59,72 @@ class RetryMatrix:
         return delay
 
 
+@dataclass
+class RetryStats:
+    """What a RetryEngine.execute call did: upstream calls, retry delays, and
+    the retries skipped because they couldn't finish before the deadline."""
+
+    attempts: int = 0
+    delays_ms: List[int] = field(default_factory=list)
+    skipped_for_deadline: int = 0
+
+
+class RequestRetryPolicy:
+    """Per-request retry policy overriding a target's retry matrix.
+
+    Unlike the matrix, which is keyed by error class, it retries the listed
+    upstream statuses plus network errors and timeouts, making at most
+    max_attempts upstream calls in total.
+    """
+
+    def __init__(
+        self,
+        max_attempts: int,
+        backoff_ms: int = 1000,
+        max_backoff_ms: int = 60000,
+        retry_on: Optional[List[int]] = None,
+    ):
+        self.max_attempts = max_attempts
+        self.backoff_ms = backoff_ms
+        self.max_backoff_ms = max_backoff_ms
+        self.retry_on = set(retry_on if retry_on is not None else [429, 500, 502, 503, 504])
+
+    @classmethod
+    def from_dict(cls, policy: Optional[Dict[str, Any]]) -> Optional["RequestRetryPolicy"]:
+        """Build a policy from a request's "retry" field, if set."""
+        if not policy:
+            return None
+        return cls(
+            max_attempts=policy["max_attempts"],
+            backoff_ms=policy.get("backoff_ms", 1000),
+            max_backoff_ms=policy.get("max_backoff_ms", 60000),
+            retry_on=policy.get("retry_on"),
+        )
+
+    def matrix(self) -> Dict[str, RetryMatrix]:
+        """Retry matrix applying this policy to every retried error."""
+        return {
+            "override": RetryMatrix(
+                attempts=self.max_attempts,
+                backoff="exp",
+                base_s=self.backoff_ms / 1000.0,
+                max_s=self.max_backoff_ms / 1000.0,
+            )
+        }
+
+    def classify(self, status_code: Optional[int], error: Optional[Exception]) -> str:
+        """Error classifier for RetryEngine.execute."""
+        if status_code is None:
+            response = getattr(error, "response", None)
+            status_code = getattr(response, "status_code", None)
+        if status_code is not None:
+            return "override" if status_code in self.retry_on else "no-retry"
+        error_name = type(error).__name__.lower()
+        if any(name in error_name for name in ("timeout", "timedout", "connect", "network")):
+            return "override"
+        return "no-retry"
+
+
 class RetryEngine:
     """Universal retry engine for HTTP requests."""
 
@@ -97,6 +164,9 @@ class RetryEngine:
         func: Callable[[], Any],
         error_classifier: Optional[Callable[[Optional[int], Optional[Exception]], str]] = None,
         get_retry_after: Optional[Callable[[Exception], Optional[float]]] = None,
+        stats: Optional[RetryStats] = None,
+        deadline: Optional[float] = None,
+        attempt_s: float = 0.0,
     ) -> T:
         """
         Execute function with retries.
@@ -105,6 +175,11 @@ class RetryEngine:
             func: Async function to execute (should return (status_code, result) or raise)
             error_classifier: Optional custom error classifier
             get_retry_after: Optional function to extract Retry-After from exception
+            stats: Optional RetryStats to record attempts and delays into
+            deadline: time.monotonic() by which the call must be done; a retry
+                that would start after its backoff with less than attempt_s
+                left is skipped, along with the ones after it
+            attempt_s: Expected duration of an attempt in seconds
             
         Returns:
             Result from function
@@ -115,7 +190,9 @@ class RetryEngine:
         last_error: Optional[Exception] = None
         last_status: Optional[int] = None
 
-        for attempt in range(1, 10):  # Max 10 attempts across all policies
+        for attempt in range(1, 11):  # Max 10 attempts across all policies
+            if stats is not None:
+                stats.attempts = attempt
             try:
                 result = await func()
                 return result
@@ -151,6 +228,12 @@ class RetryEngine:
 
                 # Calculate delay
                 delay = policy.get_delay(attempt, retry_after=retry_after)
+                if deadline is not None and time.monotonic() + delay + attempt_s > deadline:
+                    if stats is not None:
+                        stats.skipped_for_deadline = policy.attempts - attempt
+                    raise
+                if stats is not None:
+                    stats.delays_ms.append(int(delay * 1000))
                 await asyncio.sleep(delay)
 
         # All retries exhausted
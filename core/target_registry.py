@@ -0,0 +1,93 @@
+"""Runtime registration of upstream targets.
+
+Targets loaded from config.yaml can be added, replaced and removed at runtime
+through the /targets admin API. Changes are copy-on-write: each one publishes
+a new targets mapping, so requests already in flight keep the mapping (and
+target configs) they started with and finish normally. Every target carries a
+version, 1 when loaded and bumped on each update, which responses report as
+meta.target_version. Runtime changes live in memory only and do not survive
+a restart.
+"""
+import asyncio
+import ipaddress
+import socket
+from typing import Any, Dict, Optional, Tuple, Union
+from urllib.parse import urlparse
+
+VERSION_KEY = "version"
+
+
+def stamp_versions(targets: Dict[str, Dict[str, Any]]) -> Dict[str, Dict[str, Any]]:
+    """Return a copy of loaded targets with version 1 assigned to each."""
+    return {name: {**config, VERSION_KEY: 1} for name, config in targets.items()}
+
+
+def upsert_target(
+    targets: Dict[str, Dict[str, Any]], name: str, config: Dict[str, Any]
+) -> Tuple[Dict[str, Dict[str, Any]], Dict[str, Any]]:
+    """Return a new mapping with name set to config, and the stored config.
+
+    The version is one past the replaced target's, or 1 for a new target.
+    """
+    previous = targets.get(name)
+    version = (previous.get(VERSION_KEY) or 1) + 1 if previous else 1
+    stored = {**config, VERSION_KEY: version}
+    return {**targets, name: stored}, stored
+
+
+def delete_target(targets: Dict[str, Dict[str, Any]], name: str) -> Dict[str, Dict[str, Any]]:
+    """Return a new mapping without name."""
+    return {k: v for k, v in targets.items() if k != name}
+
+
+def target_version(targets: Dict[str, Dict[str, Any]], name: Optional[str]) -> Optional[int]:
+    """Version of a target in a mapping, if the target is known."""
+    config = targets.get(name) if name else None
+    return config.get(VERSION_KEY) if config else None
+
+
+def _is_private(ip: Union[ipaddress.IPv4Address, ipaddress.IPv6Address]) -> bool:
+    if isinstance(ip, ipaddress.IPv6Address) and ip.ipv4_mapped:
+        ip = ip.ipv4_mapped
+    return (
+        ip.is_private
+        or ip.is_loopback
+        or ip.is_link_local
+        or ip.is_reserved
+        or ip.is_multicast
+        or ip.is_unspecified
+    )
+
+
+async def check_base_url(
+    base_url: str, allow_private_network: bool = False, field: str = "base_url"
+) -> Optional[str]:
+    """Validate the base URL of a target registered at runtime.
+
+    Returns an error message, or None if the URL is acceptable. Unless
+    allow_private_network is set, the host must resolve only to public
+    addresses, so the proxy cannot be pointed at its own network; a host that
+    does not resolve is rejected for the same reason. field names the URL in
+    the messages, for the other URLs the proxy calls, like job callbacks.
+    """
+    parsed = urlparse(base_url)
+    if parsed.scheme not in ("http", "https") or not parsed.hostname:
+        return f"{field} must be an absolute http(s) URL, got '{base_url}'"
+    if allow_private_network:
+        return None
+
+    host = parsed.hostname
+    try:
+        addresses = [ipaddress.ip_address(host)]
+    except ValueError:
+        try:
+            infos = await asyncio.get_running_loop().getaddrinfo(host, None, type=socket.SOCK_STREAM)
+        except socket.gaierror:
+            return f"{field} host '{host}' does not resolve"
+        addresses = [ipaddress.ip_address(info[4][0].split("%")[0]) for info in infos]
+
+    for ip in addresses:
+        if _is_private(ip):
+            hint = "; set allow_private_network to register internal upstreams" if field == "base_url" else ""
+            return f"{field} host '{host}' resolves to private address {ip}{hint}"
+    return None
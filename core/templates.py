@@ -0,0 +1,94 @@
+"""Prompt templates: versioned messages rendered with variables on the proxy.
+
+A template is a list of messages whose content may hold {{variable}}
+placeholders. Every PUT of a template stores a new version, starting at 1,
+and earlier versions stay available so callers can pin one. Rendering
+needs exactly the template's variables: missing ones and unknown extras
+both fail, listing the names. Like the audit log, templates are
+process-local and kept in memory only.
+"""
+import re
+import threading
+from datetime import datetime, timezone
+from typing import Any, Dict, List, Optional
+
+PLACEHOLDER = re.compile(r"\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}")
+
+
+class TemplateVariablesError(ValueError):
+    """The variables given don't match the template's placeholders."""
+
+    def __init__(self, missing: List[str], unexpected: List[str]):
+        parts = []
+        if missing:
+            parts.append(f"missing variables: {', '.join(missing)}")
+        if unexpected:
+            parts.append(f"unknown variables: {', '.join(unexpected)}")
+        super().__init__("Template " + "; ".join(parts))
+        self.missing = missing
+        self.unexpected = unexpected
+
+
+def template_variables(messages: List[Dict[str, str]]) -> List[str]:
+    """The placeholder names of messages, in order of first use."""
+    names: Dict[str, None] = {}
+    for message in messages:
+        for name in PLACEHOLDER.findall(message["content"]):
+            names.setdefault(name)
+    return list(names)
+
+
+def render(template: Dict[str, Any], variables: Dict[str, str]) -> List[Dict[str, str]]:
+    """The template's messages with its placeholders replaced by variables.
+
+    Raises TemplateVariablesError unless variables names exactly the
+    template's placeholders.
+    """
+    expected = template["variables"]
+    missing = [name for name in expected if name not in variables]
+    unexpected = sorted(set(variables) - set(expected))
+    if missing or unexpected:
+        raise TemplateVariablesError(missing, unexpected)
+    return [
+        {**message, "content": PLACEHOLDER.sub(lambda m: variables[m.group(1)], message["content"])}
+        for message in template["messages"]
+    ]
+
+
+class TemplateRegistry:
+    """Every version of every template."""
+
+    def __init__(self) -> None:
+        self._versions: Dict[str, List[Dict[str, Any]]] = {}
+        self._lock = threading.Lock()
+
+    def put(self, name: str, messages: List[Dict[str, str]], description: Optional[str] = None) -> Dict[str, Any]:
+        """Store messages as the next version of template name and return it."""
+        with self._lock:
+            versions = self._versions.setdefault(name, [])
+            template = {
+                "name": name,
+                "version": len(versions) + 1,
+                "description": description,
+                "messages": [dict(message) for message in messages],
+                "variables": template_variables(messages),
+                "created_at": datetime.now(timezone.utc).isoformat(),
+            }
+            versions.append(template)
+            return template
+
+    def get(self, name: str, version: Optional[int] = None) -> Optional[Dict[str, Any]]:
+        """The given version of template name, its latest without one."""
+        versions = self._versions.get(name)
+        if not versions:
+            return None
+        if version is None:
+            return versions[-1]
+        if 1 <= version <= len(versions):
+            return versions[version - 1]
+        return None
+
+    def reset(self) -> None:
+        """Forget all templates."""
+        with self._lock:
+            self._versions.clear()
@@ -0,0 +1,62 @@
+"""W3C trace context propagation from clients to upstreams.
+
+The proxy does not create spans of its own. It picks up the traceparent and
+tracestate headers of an incoming request and, for targets that set
+forward_trace_context, sends them on with the upstream call so the
+provider's side of the request joins the caller's trace.
+"""
+import re
+from contextvars import ContextVar
+from typing import Dict, Optional
+
+TRACE_HEADERS = ("traceparent", "tracestate")
+
+# version-trace_id-parent_id-flags; all-zero IDs are invalid per the spec.
+_TRACEPARENT_RE = re.compile(r"^[0-9a-f]{2}-(?!0{32})[0-9a-f]{32}-(?!0{16})[0-9a-f]{16}-[0-9a-f]{2}$")
+
+_trace_context: ContextVar[Optional[Dict[str, str]]] = ContextVar("reliapi_trace_context", default=None)
+
+
+def parse_trace_headers(headers: Dict[str, str]) -> Dict[str, str]:
+    """Return the valid trace context headers of a request.
+
+    tracestate is only meaningful alongside a traceparent, so it is dropped
+    when the traceparent is missing or malformed.
+    """
+    lowered = {k.lower(): v for k, v in headers.items()}
+    traceparent = lowered.get("traceparent", "").strip()
+    if not _TRACEPARENT_RE.match(traceparent) or traceparent.startswith("ff"):
+        return {}
+    result = {"traceparent": traceparent}
+    tracestate = lowered.get("tracestate", "").strip()
+    if tracestate:
+        result["tracestate"] = tracestate
+    return result
+
+
+def trace_headers() -> Dict[str, str]:
+    """Trace context headers of the request being handled, if any."""
+    return dict(_trace_context.get() or {})
+
+
+class TraceContextMiddleware:
+    """ASGI middleware that makes a request's trace context available to
+    trace_headers() for the duration of the request, streaming included."""
+
+    def __init__(self, app):
+        self.app = app
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            await self.app(scope, receive, send)
+            return
+        headers = {}
+        for name, value in scope.get("headers", []):
+            key = name.decode("latin-1").lower()
+            if key in TRACE_HEADERS:
+                headers[key] = value.decode("latin-1")
+        token = _trace_context.set(parse_trace_headers(headers))
+        try:
+            await self.app(scope, receive, send)
+        finally:
+            _trace_context.reset(token)
@@ -0,0 +1,230 @@
+"""Per-target request and response transformations for /proxy/http.
+
+A target's transformation section rewrites what the proxy sends upstream
+and what it returns, so callers can use the upstream's API without knowing
+its quirks:
+
+- headers are added to every request, replacing the caller's of the same
+  name. Values are templates: ${request_id}, ${key_id} (the name of the
+  caller's API key), ${tenant}, ${target} and ${method} are replaced by the
+  request's values, or by nothing when it has none.
+- path_rules rewrite the path: the first rule whose regular expression
+  matches the start of the path replaces the match, with \\1 or \\g<name>
+  for its groups. path_prefix is then put in front of the path. The query
+  string is left as it is.
+- request_body wraps a text body in a template, where ${body} is the
+  caller's body: '{"input": ${body}}'. Empty and base64 bodies are sent
+  unchanged.
+- response_extract replaces a JSON response body by the value at a path:
+  "$.data" or "$.result.items[0]". A body without that value is returned
+  whole.
+
+Requests are transformed before their cache key is computed, so the key is
+that of the request sent upstream. Headers templated with ${request_id}
+are sent but left out of the cache key and the idempotency hash, which
+would otherwise differ for every request.
+
+The names of the rules applied to a request are collected for
+meta.transformations_applied (see track_transformations): header:<name>,
+path_rule:<index>, path_prefix, request_body and response_extract.
+"""
+import re
+from contextlib import contextmanager
+from contextvars import ContextVar
+from dataclasses import dataclass, field
+from typing import Any, Dict, Iterator, List, Optional, Union
+
+# The variables header and body templates may use
+TEMPLATE_VARIABLES = frozenset({"request_id", "key_id", "tenant", "target", "method", "body"})
+
+_VARIABLE = re.compile(r"\$\{(\w+)\}")
+_PATH_STEP = re.compile(r"\.([A-Za-z_][\w-]*)|\[(-?\d+)\]")
+
+
+def template_variables(template: str) -> List[str]:
+    """The variables a template uses, in order of appearance."""
+    return _VARIABLE.findall(template)
+
+
+def render_template(template: str, variables: Dict[str, Optional[str]]) -> str:
+    """template with each ${name} replaced by variables[name], or by
+    nothing when that is None or missing."""
+    return _VARIABLE.sub(lambda m: variables.get(m.group(1)) or "", template)
+
+
+def parse_extract_path(path: str) -> List[Union[str, int]]:
+    """The steps of a response_extract path: names and array indexes.
+
+    Raises:
+        ValueError: path is not "$" followed by .name and [index] steps.
+    """
+    if not path.startswith("$"):
+        raise ValueError(f"path {path!r} must start with '$'")
+    steps: List[Union[str, int]] = []
+    pos = 1
+    while pos < len(path):
+        match = _PATH_STEP.match(path, pos)
+        if not match:
+            raise ValueError(f"path {path!r} has an invalid step at position {pos}")
+        name, index = match.groups()
+        steps.append(name if name is not None else int(index))
+        pos = match.end()
+    return steps
+
+
+_MISSING = object()
+
+
+def extract(value: Any, path: str) -> Any:
+    """The value at path (see parse_extract_path) of value, or _MISSING."""
+    for step in parse_extract_path(path):
+        if isinstance(step, str):
+            if not isinstance(value, dict) or step not in value:
+                return _MISSING
+            value = value[step]
+        else:
+            if not isinstance(value, list) or not -len(value) <= step < len(value):
+                return _MISSING
+            value = value[step]
+    return value
+
+
+@dataclass
+class TransformedRequest:
+    """A /proxy/http request once a target's transformations applied.
+
+    headers are sent upstream; key_headers, without the headers templated
+    with ${request_id}, go into the cache key and idempotency hash.
+    """
+
+    path: str
+    headers: Optional[Dict[str, str]]
+    key_headers: Optional[Dict[str, str]]
+    body: Optional[str]
+    applied: List[str] = field(default_factory=list)
+
+
+def _set_header(headers: Dict[str, str], name: str, value: str) -> None:
+    for existing in [k for k in headers if k.lower() == name.lower()]:
+        del headers[existing]
+    headers[name] = value
+
+
+def transform_request(
+    config: Optional[Dict[str, Any]],
+    method: str,
+    path: str,
+    headers: Optional[Dict[str, str]],
+    body: Optional[str],
+    body_encoding: str = "utf8",
+    variables: Optional[Dict[str, Optional[str]]] = None,
+) -> TransformedRequest:
+    """Apply the request side of a target's transformation config.
+
+    variables are the template values other than method and body. A request
+    of a target without transformations comes back unchanged.
+    """
+    request = TransformedRequest(path=path, headers=headers, key_headers=headers, body=body)
+    if not config:
+        return request
+    values = {**(variables or {}), "method": method.upper()}
+
+    if config.get("headers"):
+        sent = dict(headers or {})
+        keyed = dict(headers or {})
+        for name, template in config["headers"].items():
+            value = render_template(template, values)
+            _set_header(sent, name, value)
+            if "request_id" in template_variables(template):
+                for existing in [k for k in keyed if k.lower() == name.lower()]:
+                    del keyed[existing]
+            else:
+                _set_header(keyed, name, value)
+            request.applied.append(f"header:{name}")
+        request.headers, request.key_headers = sent, keyed
+
+    bare_path, sep, query = path.partition("?")
+    for index, rule in enumerate(config.get("path_rules") or []):
+        match = re.match(rule["match"], bare_path)
+        if match:
+            bare_path = match.expand(rule["replace"]) + bare_path[match.end():]
+            request.applied.append(f"path_rule:{index}")
+            break
+    if config.get("path_prefix"):
+        bare_path = config["path_prefix"].rstrip("/") + bare_path
+        request.applied.append("path_prefix")
+    request.path = bare_path + sep + query
+
+    if config.get("request_body") and body and body_encoding == "utf8":
+        request.body = render_template(config["request_body"], {**values, "body": body})
+        request.applied.append("request_body")
+    return request
+
+
+def transform_response(config: Optional[Dict[str, Any]], data: Dict[str, Any]) -> bool:
+    """Apply response_extract to the JSON body of a /proxy/http result data
+    in place. Returns whether the body was replaced."""
+    path = (config or {}).get("response_extract")
+    if not path or data.get("body_encoding"):
+        return False
+    value = extract(data.get("body"), path)
+    if value is _MISSING:
+        return False
+    data["body"] = value
+    return True
+
+
+class _Applied:
+    """The transformations applied to a request."""
+
+    def __init__(self) -> None:
+        self.names: List[str] = []
+
+
+_applied: ContextVar[Optional[_Applied]] = ContextVar("reliapi_transformations", default=None)
+
+
+@contextmanager
+def track_transformations() -> Iterator[_Applied]:
+    """Collect the names of the transformations applied inside the block."""
+    applied = _Applied()
+    token = _applied.set(applied)
+    try:
+        yield applied
+    finally:
+        _applied.reset(token)
+
+
+def record_applied(names: List[str]) -> None:
+    """Add names to the transformations of the tracked request, if any."""
+    applied = _applied.get()
+    if applied is not None:
+        applied.names.extend(n for n in names if n not in applied.names)
+
+
+def check_transformation(config: Dict[str, Any]) -> None:
+    """Check the templates, regular expressions and path of a transformation
+    config.
+
+    Raises:
+        ValueError: a part of config would fail when applied.
+    """
+    for name, template in (config.get("headers") or {}).items():
+        for variable in template_variables(template):
+            if variable not in TEMPLATE_VARIABLES - {"body"}:
+                raise ValueError(f"header {name} uses unknown variable ${{{variable}}}")
+    for index, rule in enumerate(config.get("path_rules") or []):
+        try:
+            re.compile(rule["match"])
+        except re.error as e:
+            raise ValueError(f"path_rules[{index}].match is not a valid regular expression: {e}") from e
+    template = config.get("request_body")
+    if template is not None:
+        variables = template_variables(template)
+        if "body" not in variables:
+            raise ValueError("request_body must use ${body}")
+        for variable in variables:
+            if variable not in TEMPLATE_VARIABLES:
+                raise ValueError(f"request_body uses unknown variable ${{{variable}}}")
+    if config.get("response_extract") is not None:
+        parse_extract_path(config["response_extract"])
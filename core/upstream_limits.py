@@ -0,0 +1,259 @@
+"""Upstream rate limits learned from response headers, and pacing by them.
+
+Every upstream response is checked for rate limit headers: the generic
+X-RateLimit-Limit/Remaining/Reset and RateLimit-* ones, OpenAI's
+x-ratelimit-*-requests and -tokens, Anthropic's anthropic-ratelimit-*, and
+Retry-After on a 429. The latest state is kept per target and credential
+(a named credential or a key pool key). While it reports nothing
+remaining, requests through that credential are held until the reset
+instead of being sent into a certain 429, up to the target's
+upstream_rate_limit.max_wait_ms; a longer wait sends the request anyway.
+Each request sent counts against the remaining requests until the next
+response reports them again, so concurrent requests don't all take the
+last one. Like the rate scheduler, the state is process-local.
+"""
+import asyncio
+import re
+import threading
+import time
+from contextlib import contextmanager
+from contextvars import ContextVar
+from dataclasses import dataclass
+from datetime import datetime
+from email.utils import parsedate_to_datetime
+from typing import Any, Dict, Iterator, List, Mapping, Optional, Tuple
+
+DEFAULT_MAX_WAIT_MS = 30000
+
+# Resets given as plain numbers above this are Unix times, below it seconds.
+_EPOCH_THRESHOLD = 1_000_000_000
+
+_DURATION_PART = re.compile(r"(\d+(?:\.\d+)?)(ms|h|m|s)")
+
+
+@dataclass
+class UpstreamRateLimit:
+    """What a credential has left of its upstream rate limit."""
+
+    remaining: int
+    reset_at: float
+    limit: Optional[int] = None
+    updated_at: float = 0.0
+
+
+def _parse_reset(value: str, now: float) -> Optional[float]:
+    """A reset header as a Unix time: seconds, a Unix time, a duration such
+    as OpenAI's "6m0s" or "20ms", or an RFC 3339 or HTTP date."""
+    value = value.strip()
+    try:
+        number = float(value)
+    except ValueError:
+        pass
+    else:
+        return number if number > _EPOCH_THRESHOLD else now + number
+    parts = _DURATION_PART.findall(value)
+    if parts and "".join(n + u for n, u in parts) == value:
+        scale = {"h": 3600.0, "m": 60.0, "s": 1.0, "ms": 0.001}
+        return now + sum(float(n) * scale[u] for n, u in parts)
+    try:
+        return datetime.fromisoformat(value.replace("Z", "+00:00")).timestamp()
+    except ValueError:
+        pass
+    try:
+        return parsedate_to_datetime(value).timestamp()
+    except (TypeError, ValueError):
+        return None
+
+
+def _int(value: Optional[str]) -> Optional[int]:
+    try:
+        return int(float(value)) if value is not None else None
+    except ValueError:
+        return None
+
+
+# (limit, remaining, reset) header names, most specific first. The first
+# set with a remaining count gives the request limit; token limits only hold
+# requests once they are exhausted.
+_REQUEST_HEADERS = (
+    ("x-ratelimit-limit-requests", "x-ratelimit-remaining-requests", "x-ratelimit-reset-requests"),
+    ("anthropic-ratelimit-requests-limit", "anthropic-ratelimit-requests-remaining", "anthropic-ratelimit-requests-reset"),
+    ("x-ratelimit-limit", "x-ratelimit-remaining", "x-ratelimit-reset"),
+    ("ratelimit-limit", "ratelimit-remaining", "ratelimit-reset"),
+)
+_TOKEN_HEADERS = (
+    ("x-ratelimit-remaining-tokens", "x-ratelimit-reset-tokens"),
+    ("anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-reset"),
+)
+
+
+def parse_rate_limit(
+    status_code: int, headers: Mapping[str, str], now: Optional[float] = None
+) -> Optional[UpstreamRateLimit]:
+    """The rate limit a response reports, None if it reports none."""
+    now = time.time() if now is None else now
+    lower = {k.lower(): v for k, v in headers.items()}
+    state = None
+    for limit_name, remaining_name, reset_name in _REQUEST_HEADERS:
+        remaining = _int(lower.get(remaining_name))
+        if remaining is None:
+            continue
+        reset_at = _parse_reset(lower[reset_name], now) if reset_name in lower else None
+        state = UpstreamRateLimit(
+            remaining=max(0, remaining),
+            reset_at=reset_at if reset_at is not None else now,
+            limit=_int(lower.get(limit_name)),
+            updated_at=now,
+        )
+        break
+    for remaining_name, reset_name in _TOKEN_HEADERS:
+        if _int(lower.get(remaining_name)) == 0 and reset_name in lower:
+            reset_at = _parse_reset(lower[reset_name], now)
+            if reset_at is not None and reset_at > now:
+                state = state or UpstreamRateLimit(remaining=0, reset_at=reset_at, updated_at=now)
+                state.remaining, state.reset_at = 0, max(state.reset_at, reset_at)
+    if status_code == 429 and "retry-after" in lower:
+        reset_at = _parse_reset(lower["retry-after"], now)
+        if reset_at is not None:
+            state = state or UpstreamRateLimit(remaining=0, reset_at=reset_at, updated_at=now)
+            state.remaining, state.reset_at = 0, max(state.reset_at, reset_at)
+    return state
+
+
+class _Tracked:
+    """The rate limit last reported to a request."""
+
+    def __init__(self) -> None:
+        self.last: Optional[UpstreamRateLimit] = None
+
+
+_tracked: ContextVar[Optional[_Tracked]] = ContextVar("reliapi_upstream_rate_limit", default=None)
+
+
+@contextmanager
+def track_rate_limit() -> Iterator[_Tracked]:
+    """Collect the rate limit reported by the upstream calls made inside the
+    block; last is that of the latest response, None if none reported one."""
+    tracked = _Tracked()
+    token = _tracked.set(tracked)
+    try:
+        yield tracked
+    finally:
+        _tracked.reset(token)
+
+
+class UpstreamRateLimits:
+    """The latest rate limit of each target and credential."""
+
+    def __init__(self) -> None:
+        self._limits: Dict[Tuple[str, Optional[str]], UpstreamRateLimit] = {}
+        self._lock = threading.Lock()
+
+    def observe(
+        self,
+        target: str,
+        credential: Optional[str],
+        status_code: int,
+        headers: Mapping[str, str],
+        now: Optional[float] = None,
+    ) -> None:
+        """Record the rate limit an upstream response reports, if any."""
+        state = parse_rate_limit(status_code, headers, now)
+        if state is None:
+            return
+        with self._lock:
+            self._limits[(target, credential)] = state
+        tracked = _tracked.get()
+        if tracked is not None:
+            tracked.last = state
+
+    def _current(self, key: Tuple[str, Optional[str]], now: float) -> Optional[UpstreamRateLimit]:
+        state = self._limits.get(key)
+        if state is None or state.reset_at > now:
+            return state
+        if state.limit is None:
+            del self._limits[key]
+            return None
+        # The window reset; assume it is as long as the one reported, until
+        # a response says otherwise
+        window = max(1.0, state.reset_at - state.updated_at)
+        state = UpstreamRateLimit(remaining=state.limit, reset_at=now + window, limit=state.limit, updated_at=now)
+        self._limits[key] = state
+        return state
+
+    async def acquire(
+        self, target: str, credential: Optional[str], max_wait_s: float = DEFAULT_MAX_WAIT_MS / 1000
+    ) -> float:
+        """Take one of the remaining requests of a credential, waiting for the
+        limit to reset if none remain and it resets within max_wait_s.
+
+        Returns the seconds waited.
+        """
+        waited = 0.0
+        while True:
+            now = time.time()
+            with self._lock:
+                state = self._current((target, credential), now)
+                if state is None or state.remaining > 0:
+                    if state is not None:
+                        state.remaining -= 1
+                    return waited
+                wait = state.reset_at - now
+            if waited + wait > max_wait_s:
+                return waited
+            await asyncio.sleep(wait)
+            waited += wait
+
+    def get(self, target: str, credential: Optional[str] = None) -> Optional[UpstreamRateLimit]:
+        """The current rate limit of a target's credential, None if unknown."""
+        with self._lock:
+            return self._current((target, credential), time.time())
+
+    def status(self, target: str) -> List[Dict[str, Any]]:
+        """The rate limits known for a target, one per credential."""
+        now = time.time()
+        with self._lock:
+            keys = [key for key in self._limits if key[0] == target]
+            result = []
+            for key in keys:
+                state = self._current(key, now)
+                if state is not None:
+                    result.append(
+                        {
+                            "credential": key[1],
+                            "limit": state.limit,
+                            "remaining": state.remaining,
+                            "reset_at": state.reset_at,
+                            "updated_at": state.updated_at,
+                        }
+                    )
+        return sorted(result, key=lambda item: item["credential"] or "")
+
+    def reset(self) -> None:
+        """Forget all rate limits."""
+        with self._lock:
+            self._limits.clear()
+
+
+class RateLimitPacer:
+    """Paces the upstream calls of one client by one credential's rate limit."""
+
+    def __init__(
+        self,
+        limits: UpstreamRateLimits,
+        target: str,
+        credential: Optional[str] = None,
+        max_wait_s: float = DEFAULT_MAX_WAIT_MS / 1000,
+    ) -> None:
+        self.limits = limits
+        self.target = target
+        self.credential = credential
+        self.max_wait_s = max_wait_s
+
+    async def wait(self) -> float:
+        """Hold a call until the credential has a request left; see acquire."""
+        return await self.limits.acquire(self.target, self.credential, self.max_wait_s)
+
+    def observe(self, status_code: int, headers: Mapping[str, str]) -> None:
+        """Record the rate limit reported by a call's response."""
+        self.limits.observe(self.target, self.credential, status_code, headers)
@@ -0,0 +1,217 @@
+"""Request and spend roll-ups for the usage report.
+
+Every proxied request is counted in an hourly bucket per tenant, API key
+prefix, target, model, kind and the tags the caller attributed it to, e.g.
+{"feature": "search"}. Cache and idempotency hits are counted apart
+from billable calls, which are the ones that reached an upstream and carry
+its tokens and cost. Like the budget ledger the counts are process-local:
+each ReliAPI instance reports the traffic it served.
+"""
+import hashlib
+import re
+import threading
+from dataclasses import asdict, dataclass, fields
+from datetime import datetime, timedelta, timezone
+from typing import Dict, Iterable, List, Optional, Set, Tuple
+
+# Dimensions a report can be grouped by, besides tags.
+GROUP_BY_FIELDS = ("target", "model", "api_key_prefix", "kind")
+
+# A report is grouped by the tag "feature" as "tag.feature".
+TAG_GROUP_PREFIX = "tag."
+
+# Bounds of a request's tags.
+MAX_TAGS = 10
+MAX_TAG_VALUE_LEN = 128
+_TAG_KEY = re.compile(r"^[A-Za-z0-9_-]{1,64}$")
+
+# Distinct values a tenant's tag key is counted under, by default. Values
+# past it are folded into TAG_OVERFLOW_BUCKETS hashed values, so a tag
+# carrying e.g. user IDs can't grow the ledger without bound.
+DEFAULT_MAX_TAG_VALUES = 100
+TAG_OVERFLOW_BUCKETS = 16
+
+# Characters of the caller's API key reported as api_key_prefix.
+API_KEY_PREFIX_LEN = 8
+
+# Buckets older than this are dropped.
+RETENTION = timedelta(days=400)
+
+
+def api_key_prefix(api_key: Optional[str]) -> Optional[str]:
+    """The part of an API key usage is reported under; None without a key."""
+    return api_key[:API_KEY_PREFIX_LEN] if api_key else None
+
+
+def validate_tags(tags: Dict[str, str]) -> Dict[str, str]:
+    """Check the tags of a request: at most MAX_TAGS, keys of letters,
+    digits, '_' and '-' up to 64 characters, values up to
+    MAX_TAG_VALUE_LEN. ValueError otherwise."""
+    if len(tags) > MAX_TAGS:
+        raise ValueError(f"at most {MAX_TAGS} tags are allowed")
+    for key, value in tags.items():
+        if not _TAG_KEY.match(key):
+            raise ValueError(f"tag key {key!r} must be 1 to 64 letters, digits, '_' or '-'")
+        if not value or len(value) > MAX_TAG_VALUE_LEN:
+            raise ValueError(f"tag {key!r} must have a value of 1 to {MAX_TAG_VALUE_LEN} characters")
+    return tags
+
+
+def is_group_by_field(name: str) -> bool:
+    """Whether a report can be grouped by name: a GROUP_BY_FIELDS entry or
+    a tag key prefixed with TAG_GROUP_PREFIX."""
+    if name.startswith(TAG_GROUP_PREFIX):
+        return bool(_TAG_KEY.match(name[len(TAG_GROUP_PREFIX):]))
+    return name in GROUP_BY_FIELDS
+
+
+def overflow_tag_value(value: str) -> str:
+    """The hashed value a tag value past the distinct-value limit is counted under."""
+    bucket = int(hashlib.sha256(value.encode()).hexdigest()[:8], 16) % TAG_OVERFLOW_BUCKETS
+    return f"~{bucket:x}"
+
+
+def hour_start(moment: datetime) -> datetime:
+    """Truncate moment to the start of its hour, in UTC."""
+    return moment.astimezone(timezone.utc).replace(minute=0, second=0, microsecond=0)
+
+
+@dataclass
+class UsageCounts:
+    """Counters of a bucket or report row."""
+    requests: int = 0
+    billable_requests: int = 0
+    cache_hits: int = 0
+    idempotent_hits: int = 0
+    errors: int = 0
+    prompt_tokens: int = 0
+    completion_tokens: int = 0
+    # Tokens embedded, apart from the chat tokens above
+    embedding_tokens: int = 0
+    cost_usd: float = 0.0
+
+    def add(self, other: "UsageCounts") -> None:
+        for f in fields(self):
+            setattr(self, f.name, getattr(self, f.name) + getattr(other, f.name))
+
+
+# (hour, tenant, api_key_prefix, target, model, kind, sorted tag items)
+_BucketKey = Tuple[datetime, Optional[str], Optional[str], Optional[str], Optional[str], str, Tuple[Tuple[str, str], ...]]
+
+
+class UsageLedger:
+    """In-memory hourly usage buckets."""
+
+    def __init__(self, max_tag_values: int = DEFAULT_MAX_TAG_VALUES):
+        self._buckets: Dict[_BucketKey, UsageCounts] = {}
+        self._oldest: Optional[datetime] = None
+        self._lock = threading.Lock()
+        self.max_tag_values = max_tag_values
+        # (tenant, tag key) -> values counted so far
+        self._tag_values: Dict[Tuple[Optional[str], str], Set[str]] = {}
+
+    def bound_tags(self, tenant: Optional[str], tags: Optional[Dict[str, str]]) -> Optional[Dict[str, str]]:
+        """The tags a tenant's request is counted under: tags, with values
+        beyond max_tag_values distinct ones for their key replaced by
+        overflow_tag_value. A value keeps its slot once it has one."""
+        if not tags:
+            return None
+        bounded = {}
+        with self._lock:
+            for key, value in sorted(tags.items()):
+                seen = self._tag_values.setdefault((tenant, key), set())
+                if value not in seen and len(seen) >= self.max_tag_values:
+                    value = overflow_tag_value(value)
+                else:
+                    seen.add(value)
+                bounded[key] = value
+        return bounded
+
+    def record(
+        self,
+        tenant: Optional[str],
+        api_key_prefix: Optional[str],
+        target: Optional[str],
+        model: Optional[str],
+        kind: str,
+        cache_hit: bool = False,
+        idempotent_hit: bool = False,
+        success: bool = True,
+        prompt_tokens: int = 0,
+        completion_tokens: int = 0,
+        embedding_tokens: int = 0,
+        cost_usd: float = 0.0,
+        tags: Optional[Dict[str, str]] = None,
+        now: Optional[datetime] = None,
+    ) -> None:
+        """Count one request under tags, as bounded by bound_tags. Hits are
+        never billable, so their tokens and cost are ignored."""
+        now = now or datetime.now(timezone.utc)
+        counts = UsageCounts(
+            requests=1,
+            cache_hits=int(cache_hit),
+            idempotent_hits=int(idempotent_hit and not cache_hit),
+            errors=int(not success),
+        )
+        if not (cache_hit or idempotent_hit):
+            counts.billable_requests = 1
+            counts.prompt_tokens = prompt_tokens or 0
+            counts.completion_tokens = completion_tokens or 0
+            counts.embedding_tokens = embedding_tokens or 0
+            counts.cost_usd = cost_usd or 0.0
+
+        key = (hour_start(now), tenant, api_key_prefix, target, model, kind, tuple(sorted((tags or {}).items())))
+        with self._lock:
+            self._prune(now)
+            self._buckets.setdefault(key, UsageCounts()).add(counts)
+
+    def _prune(self, now: datetime) -> None:
+        cutoff = hour_start(now - RETENTION)
+        if self._oldest is not None and self._oldest >= cutoff:
+            return
+        self._buckets = {k: v for k, v in self._buckets.items() if k[0] >= cutoff}
+        self._oldest = min((k[0] for k in self._buckets), default=None)
+        if self._oldest is None:
+            self._oldest = cutoff
+
+    def report(
+        self,
+        tenant: Optional[str],
+        start: datetime,
+        end: datetime,
+        group_by: Iterable[str],
+    ) -> List[Dict]:
+        """Sum a tenant's buckets whose hour starts in [start, end), grouped by group_by.
+
+        group_by names GROUP_BY_FIELDS and tags ("tag.feature"); requests
+        without a tag are grouped under None. Rows are sorted by their group
+        values, so pages of the same report line up. Without group_by there
+        is a single row, possibly all zeros.
+        """
+        group_by = list(group_by)
+        rows: Dict[Tuple, UsageCounts] = {}
+        with self._lock:
+            for (hour, bucket_tenant, prefix, target, model, kind, tags), counts in self._buckets.items():
+                if bucket_tenant != tenant or not (start <= hour < end):
+                    continue
+                values = {"api_key_prefix": prefix, "target": target, "model": model, "kind": kind}
+                values.update((TAG_GROUP_PREFIX + k, v) for k, v in tags)
+                group = tuple(values.get(name) for name in group_by)
+                rows.setdefault(group, UsageCounts()).add(counts)
+        if not group_by and not rows:
+            rows[()] = UsageCounts()
+
+        report = []
+        for group in sorted(rows, key=lambda g: tuple((v is not None, v or "") for v in g)):
+            row = dict(zip(group_by, group))
+            row.update(asdict(rows[group]))
+            row["cost_usd"] = round(row["cost_usd"], 6)
+            report.append(row)
+        return report
+
+    def reset(self) -> None:
+        """Forget all usage."""
+        with self._lock:
+            self._buckets.clear()
+            self._oldest = None
+            self._tag_values.clear()
@@ -0,0 +1,86 @@
+"""Signed webhook delivery.
+
+Events are POSTed as JSON with an X-ReliAPI-Signature header of the form
+``t=<unix seconds>,v1=<hex>``, where v1 is the HMAC-SHA256, keyed with the
+webhook secret, of ``"<t>." + body``. Receivers recompute it over the raw body
+and reject old timestamps to stop replays.
+"""
+import asyncio
+import hashlib
+import hmac
+import json
+import logging
+import time
+import uuid
+from typing import Any, Dict, Optional
+
+import httpx
+
+logger = logging.getLogger(__name__)
+
+SIGNATURE_HEADER = "X-ReliAPI-Signature"
+
+# Event types
+JOB_COMPLETED = "job.completed"
+BUDGET_THRESHOLD_REACHED = "budget.threshold_reached"
+
+# Delivery attempts per event, and the backoff before the second one (doubled after).
+DELIVERY_ATTEMPTS = 3
+DELIVERY_BACKOFF_S = 1.0
+DELIVERY_TIMEOUT_S = 10.0
+
+
+def sign_payload(secret: str, payload: bytes, timestamp: Optional[int] = None) -> str:
+    """Return the X-ReliAPI-Signature value for payload sent at timestamp (default now)."""
+    if timestamp is None:
+        timestamp = int(time.time())
+    signing_string = f"{timestamp}.".encode() + payload
+    digest = hmac.new(secret.encode(), signing_string, hashlib.sha256).hexdigest()
+    return f"t={timestamp},v1={digest}"
+
+
+def make_event(event_type: str, data: Dict[str, Any]) -> Dict[str, Any]:
+    """Build an event envelope: a unique id, the type, and its payload in data."""
+    return {
+        "id": f"evt_{uuid.uuid4().hex}",
+        "type": event_type,
+        "created_at": int(time.time()),
+        "data": data,
+    }
+
+
+async def deliver_webhook(
+    url: str,
+    event: Dict[str, Any],
+    secret: str,
+    attempts: int = DELIVERY_ATTEMPTS,
+    backoff_s: float = DELIVERY_BACKOFF_S,
+) -> bool:
+    """POST a signed event to url, retrying network errors, 429 and 5xx.
+
+    Each attempt is signed afresh, so a late retry is not rejected as stale.
+    Returns whether the receiver answered 2xx.
+    """
+    payload = json.dumps(event).encode()
+    async with httpx.AsyncClient(timeout=DELIVERY_TIMEOUT_S, follow_redirects=False) as client:
+        for attempt in range(attempts):
+            if attempt:
+                await asyncio.sleep(backoff_s * 2 ** (attempt - 1))
+            headers = {
+                "Content-Type": "application/json",
+                SIGNATURE_HEADER: sign_payload(secret, payload),
+            }
+            try:
+                response = await client.post(url, content=payload, headers=headers)
+            except httpx.HTTPError as e:
+                logger.warning(f"Webhook {event['id']} to {url} failed (attempt {attempt + 1}): {e}")
+                continue
+            if 200 <= response.status_code < 300:
+                return True
+            if response.status_code != 429 and response.status_code < 500:
+                logger.warning(f"Webhook {event['id']} to {url} rejected with {response.status_code}")
+                return False
+            logger.warning(
+                f"Webhook {event['id']} to {url} got {response.status_code} (attempt {attempt + 1})"
+            )
+    return False
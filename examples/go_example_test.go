@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"github.com/KikuAI-Lab/reliapi/reliapi/reliapitest"
+)
+
+// The examples run against an in-process mock of the proxy, so these tests
+// need neither network access nor an API key.
+
+func exampleClient(t *testing.T) (*reliapitest.MockServer, *reliapi.Client) {
+	srv := reliapitest.NewMockServer(t)
+	return srv, srv.Client(reliapi.WithAutoIdempotency(), reliapi.WithRetry(3, time.Millisecond))
+}
+
+func TestHTTPProxyExample(t *testing.T) {
+	srv, client := exampleClient(t)
+	srv.HandleHTTP(func(req reliapi.HTTPRequest) reliapitest.HTTPReply {
+		return reliapitest.HTTPReply{Body: map[string]interface{}{"id": 1, "title": "mock post"}}
+	})
+
+	httpProxyExample(context.Background(), client)
+
+	reqs := srv.Requests()
+	if len(reqs) != 1 || reqs[0].Meta == nil {
+		t.Fatalf("Requests = %+v", reqs)
+	}
+}
+
+func TestLLMProxyExample(t *testing.T) {
+	srv, client := exampleClient(t)
+	srv.HandleLLM(func(req reliapi.LLMRequest) reliapitest.LLMReply {
+		if req.Model != "gpt-4o-mini" || req.MaxTokens == nil || *req.MaxTokens != 100 {
+			t.Errorf("request = %+v", req)
+		}
+		return reliapitest.LLMReply{Content: "Repeating a request has the same effect as sending it once.", CostUSD: 0.00002}
+	})
+
+	llmProxyExample(context.Background(), client)
+
+	if srv.UpstreamCalls() != 1 {
+		t.Errorf("UpstreamCalls = %d, want 1", srv.UpstreamCalls())
+	}
+}
+
+func TestCachingExample(t *testing.T) {
+	srv, client := exampleClient(t)
+
+	cachingExample(context.Background(), client)
+
+	reqs := srv.Requests()
+	if len(reqs) != 2 || reqs[0].Meta.CacheHit || !reqs[1].Meta.CacheHit {
+		t.Fatalf("Requests = %+v, want a miss then a cache hit", reqs)
+	}
+	if srv.UpstreamCalls() != 1 {
+		t.Errorf("UpstreamCalls = %d, want 1", srv.UpstreamCalls())
+	}
+}
+
+func TestErrorHandlingExample(t *testing.T) {
+	srv, client := exampleClient(t)
+	srv.FailNext(1, &reliapi.APIError{
+		StatusCode: http.StatusPaymentRequired,
+		Type:       "budget_error",
+		Code:       reliapi.CodeBudgetExceeded,
+		Message:    "Estimated cost exceeds hard cap",
+	})
+
+	errorHandlingExample(context.Background(), client)
+
+	reqs := srv.Requests()
+	if len(reqs) != 1 || reqs[0].Meta != nil {
+		t.Fatalf("Requests = %+v, want one failed request", reqs)
+	}
+}
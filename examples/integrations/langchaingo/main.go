@@ -0,0 +1,58 @@
+// Command langchaingo runs a langchaingo LLM chain through ReliAPI. The
+// chain is the one from langchaingo's own examples: only the model it is
+// built with changes, from openai.New() to llmadapter.New.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/prompts"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"github.com/KikuAI-Lab/reliapi/reliapi/llmadapter"
+)
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func main() {
+	client, err := reliapi.NewClient(getEnv("RELIAPI_URL", reliapi.DefaultBaseURL),
+		getEnv("RAPIDAPI_KEY", getEnv("RELIAPI_API_KEY", "your-api-key")))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Was: llm, err := openai.New()
+	llm := llmadapter.New(client, "openai", llmadapter.WithModel("gpt-4o-mini"))
+
+	prompt := prompts.NewPromptTemplate(
+		"What is a good name for a company that makes {{.product}}?",
+		[]string{"product"},
+	)
+	chain := chains.NewLLMChain(llm, prompt)
+
+	ctx := context.Background()
+	out, err := chains.Run(ctx, chain, "colorful socks",
+		// The chain's call options reach the model as they would OpenAI's
+		chains.WithMaxTokens(50), chains.WithTemperature(0.7))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(out)
+
+	// Called directly, the model takes llmadapter's options too
+	answer, err := llm.Call(ctx, "Say hello.", llmadapter.WithCache(time.Hour))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(answer)
+}
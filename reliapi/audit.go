@@ -0,0 +1,173 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const auditPath = "/v1/audit"
+
+// AuditRecord is what the proxy recorded of a request to a target with
+// audit capture on (TargetConfig.Audit).
+type AuditRecord struct {
+	RequestID string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Tenant is the caller's tenant; empty outside multi-tenant mode.
+	Tenant       string `json:"tenant"`
+	APIKeyPrefix string `json:"api_key_prefix"`
+	// Kind is the proxy route: "llm", "http", "graphql" or "embeddings".
+	Kind string `json:"kind"`
+	// Target is the target requested; ServedBy the one that answered,
+	// which differs after an LLM fallback.
+	Target   string `json:"target"`
+	ServedBy string `json:"served_by"`
+	Model    string `json:"model"`
+	// Method and Path are set for HTTP and GraphQL requests.
+	Method        string  `json:"method"`
+	Path          string  `json:"path"`
+	Success       bool    `json:"success"`
+	ErrorCode     string  `json:"error_code"`
+	CacheHit      bool    `json:"cache_hit"`
+	IdempotentHit bool    `json:"idempotent_hit"`
+	DurationMs    int     `json:"duration_ms"`
+	CostUSD       float64 `json:"cost_usd"`
+	// Capture is the target's audit capture level when the request ran.
+	Capture string `json:"capture"`
+	// Attempts are the upstream calls made, retries and fallbacks
+	// included; none for cache and idempotency hits.
+	Attempts []AuditAttempt `json:"attempts"`
+	// FinalAttempt is the AuditAttempt.Attempt whose response was
+	// returned; 0 without attempts.
+	FinalAttempt int `json:"final_attempt"`
+	// BodiesOmitted is set when bodies were captured but left out because
+	// the caller isn't using the admin key.
+	BodiesOmitted bool `json:"bodies_omitted"`
+}
+
+// AuditAttempt is one upstream call of an audited request.
+type AuditAttempt struct {
+	// Attempt numbers the calls of the request from 1.
+	Attempt    int       `json:"attempt"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int       `json:"duration_ms"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	// StatusCode is 0 if no response arrived.
+	StatusCode int `json:"status_code"`
+	// Error describes why the attempt failed, a retryable status included.
+	Error string `json:"error"`
+	// Request and Response are set under AuditCaptureFull, for the admin
+	// key only.
+	Request  *AuditBody `json:"request"`
+	Response *AuditBody `json:"response"`
+}
+
+// AuditBody is a captured body, redacted with the target's redaction
+// patterns and cut to TargetAudit.MaxBodyBytes.
+type AuditBody struct {
+	// Body is empty when there was none or it was streamed.
+	Body string `json:"body"`
+	// BodyBytes is the size of the body before it was cut.
+	BodyBytes     int  `json:"body_bytes"`
+	BodyTruncated bool `json:"body_truncated"`
+}
+
+// AuditQuery selects audit records for AuditSearch.
+type AuditQuery struct {
+	// From and To bound when the records were created. A zero From is 7
+	// days ago, as far back as the proxy keeps them, and a zero To is now.
+	From time.Time
+	To   time.Time
+	// Target keeps the records of requests to or served by the target.
+	Target string
+	// Limit is the number of records per page; the proxy defaults to 100
+	// and allows at most 1000.
+	Limit int
+	// Cursor is a previous page's NextCursor or a Pager's Cursor. It is
+	// only valid with the query it was issued for; others fail with
+	// CodeBadRequest.
+	Cursor string
+}
+
+// AuditPage is a page of audit records, oldest first.
+type AuditPage struct {
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+	Target  string        `json:"target"`
+	Records []AuditRecord `json:"records"`
+	// NextCursor fetches the next page as AuditQuery.Cursor; empty on the
+	// last page.
+	NextCursor string `json:"next_cursor"`
+}
+
+// AuditRecord returns the audit record of the request whose response had
+// Meta.RequestID requestID. Records of other tenants, of targets without
+// audit capture and of streamed responses are a 404 *APIError with
+// CodeNotFound. Bodies are only included for the proxy's admin key
+// (RELIAPI_ADMIN_KEY), which also sees every tenant's records. The proxy
+// keeps records for 7 days per instance.
+func (c *Client) AuditRecord(ctx context.Context, requestID string) (*AuditRecord, error) {
+	var record AuditRecord
+	if err := c.getData(ctx, auditPath+"/"+url.PathEscape(requestID), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// AuditSearch returns a page of the audit records of the caller's tenant,
+// or of every tenant for the admin key.
+func (c *Client) AuditSearch(ctx context.Context, q AuditQuery) (*AuditPage, error) {
+	params := url.Values{}
+	if !q.From.IsZero() {
+		params.Set("from", q.From.UTC().Format(time.RFC3339Nano))
+	}
+	if !q.To.IsZero() {
+		params.Set("to", q.To.UTC().Format(time.RFC3339Nano))
+	}
+	if q.Target != "" {
+		params.Set("target", q.Target)
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Cursor != "" {
+		params.Set("cursor", q.Cursor)
+	}
+	path := auditPath
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	var page AuditPage
+	if err := c.getData(ctx, path, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// getData GETs path and decodes the data of the response into out.
+func (c *Client) getData(ctx context.Context, path string, out interface{}) error {
+	resp, raw, err := c.do(ctx, http.MethodGet, path, nil, true)
+	if err != nil {
+		return err
+	}
+	var envelope struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !envelope.Success {
+		return newAPIError(resp, raw)
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	return nil
+}
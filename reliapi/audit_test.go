@@ -0,0 +1,127 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAuditRecord(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("method = %s", r.Method)
+		}
+		if r.URL.Path != auditPath+"/req_1" {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{
+				"detail": map[string]interface{}{
+					"success": false,
+					"error":   map[string]interface{}{"type": "client_error", "code": CodeNotFound, "message": "No audit record", "status_code": 404},
+				},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"request_id": "req_1",
+				"created_at": "2026-10-14T14:03:00.250000+00:00",
+				"tenant":     "acme",
+				"kind":       "llm",
+				"target":     "openai",
+				"served_by":  "openai",
+				"model":      "gpt-4o-mini",
+				"method":     nil,
+				"success":    true,
+				"error_code": nil,
+				"capture":    "full",
+				"attempts": []interface{}{
+					map[string]interface{}{
+						"attempt": 1, "started_at": "2026-10-14T14:03:00.250000+00:00", "duration_ms": 30000,
+						"method": "POST", "url": "https://api.openai.com/v1/chat/completions",
+						"status_code": nil, "error": "ReadTimeout",
+						"request":  map[string]interface{}{"body": `{"messages":[]}`, "body_bytes": 15, "body_truncated": false},
+						"response": map[string]interface{}{"body": nil, "body_bytes": 0, "body_truncated": false},
+					},
+					map[string]interface{}{
+						"attempt": 2, "started_at": "2026-10-14T14:03:31+00:00", "duration_ms": 800,
+						"method": "POST", "url": "https://api.openai.com/v1/chat/completions",
+						"status_code": 200, "error": nil,
+						"request":  map[string]interface{}{"body": `{"messages":[]}`, "body_bytes": 15, "body_truncated": false},
+						"response": map[string]interface{}{"body": `{"id":"chat`, "body_bytes": 900, "body_truncated": true},
+					},
+				},
+				"final_attempt": 2,
+			},
+			"meta": map[string]interface{}{"request_id": "req_audit", "duration_ms": 1},
+		})
+	})
+
+	record, err := c.AuditRecord(context.Background(), "req_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Tenant != "acme" || record.Method != "" || record.Capture != AuditCaptureFull || record.FinalAttempt != 2 || len(record.Attempts) != 2 {
+		t.Fatalf("record = %+v", record)
+	}
+	if !record.CreatedAt.Equal(time.Date(2026, 10, 14, 14, 3, 0, 250e6, time.UTC)) {
+		t.Errorf("CreatedAt = %v", record.CreatedAt)
+	}
+	first, final := record.Attempts[0], record.Attempts[1]
+	if first.StatusCode != 0 || first.Error != "ReadTimeout" || first.Response.Body != "" {
+		t.Errorf("first attempt = %+v", first)
+	}
+	if final.StatusCode != 200 || final.Response == nil || !final.Response.BodyTruncated || final.Response.BodyBytes != 900 {
+		t.Errorf("final attempt = %+v", final)
+	}
+
+	_, err = c.AuditRecord(context.Background(), "req_other")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeNotFound {
+		t.Errorf("unknown request: err = %v", err)
+	}
+}
+
+func TestAuditSearch(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != auditPath {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("from") != "2026-10-14T12:00:00Z" || q.Get("to") != "" || q.Get("target") != "openai" || q.Get("limit") != "2" {
+			t.Errorf("query = %v", q)
+		}
+		next, records := interface{}("p2"), []interface{}{
+			map[string]interface{}{"request_id": "req_1", "created_at": "2026-10-14T14:03:00+00:00", "bodies_omitted": true},
+			map[string]interface{}{"request_id": "req_2", "created_at": "2026-10-14T14:04:00+00:00"},
+		}
+		if q.Get("cursor") == "p2" {
+			next, records = nil, records[:0]
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"from": "2026-10-14T12:00:00+00:00", "to": "2026-10-14T15:00:00+00:00", "target": "openai",
+				"records": records, "next_cursor": next,
+			},
+			"meta": map[string]interface{}{"request_id": "req_audit", "duration_ms": 1},
+		})
+	})
+
+	from := time.Date(2026, 10, 14, 14, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	page, err := c.AuditSearch(context.Background(), AuditQuery{From: from, Target: "openai", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 2 || page.Records[1].RequestID != "req_2" || !page.Records[0].BodiesOmitted || page.NextCursor != "p2" {
+		t.Fatalf("page = %+v", page)
+	}
+	page, err = c.AuditSearch(context.Background(), AuditQuery{From: from, Target: "openai", Limit: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 0 || page.NextCursor != "" {
+		t.Errorf("last page = %+v", page)
+	}
+}
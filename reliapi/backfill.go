@@ -0,0 +1,261 @@
+package reliapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"os"
+	"time"
+)
+
+// defaultBackfillRamp is the ramp of WithCacheBackfill without
+// WithCacheBackfillRamp.
+const defaultBackfillRamp = 30 * time.Second
+
+// CacheBackfillProgress reports a WithCacheBackfill run.
+type CacheBackfillProgress struct {
+	// Listed is the number of entries the proxy listed.
+	Listed int
+	// Stored entries were fetched and stored, Bytes in total.
+	Stored int
+	Bytes  int64
+	// Skipped entries were already stored, would have exceeded the byte
+	// budget, or are of requests the local cache doesn't hold.
+	Skipped int
+	// Missed entries had left the proxy's cache since they were listed.
+	Missed int
+	// Failed entries could not be fetched or stored.
+	Failed int
+	// Done marks the last report of the run. Unsupported is set with it
+	// when the proxy has no hot-key listing, and Err when the listing
+	// failed or the client was closed during the run.
+	Done        bool
+	Unsupported bool
+	Err         error
+}
+
+// CacheBackfillHandler receives the progress of WithCacheBackfill.
+type CacheBackfillHandler func(ctx context.Context, p CacheBackfillProgress)
+
+// cacheBackfill is the WithCacheBackfill configuration and its run.
+type cacheBackfill struct {
+	limit    int
+	maxBytes int64
+	ramp     time.Duration
+	podID    string
+	handler  CacheBackfillHandler
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// WithCacheBackfill fills the WithLocalCache store on startup with up to
+// limit of the responses the proxy serves most often for the client's API
+// key, as listed by HotKeys, so a new process doesn't send them all to the
+// proxy again. Entries are fetched with CacheOnlyIfCached, so the upstream
+// is never called, and kept as though the client had made the requests:
+// under the client's credentials and for each request's Cache TTL. At
+// most maxBytes of responses are stored, and no more entries than a
+// MemoryCache holds; maxBytes <= 0 means no byte bound.
+//
+// A goroutine started by NewClient spreads the fetches over a ramp (see
+// WithCacheBackfillRamp), so that processes starting together don't fetch
+// in step, and reports its progress to the WithCacheBackfillHandler handler
+// after every entry. A proxy without the listing makes it a no-op, with a
+// single report. It does nothing without WithLocalCache; Close stops it.
+func WithCacheBackfill(limit int, maxBytes int64) Option {
+	return func(c *Client) {
+		c.backfill.limit, c.backfill.maxBytes = limit, maxBytes
+	}
+}
+
+// WithCacheBackfillRamp sets the time WithCacheBackfill spreads its fetches
+// over, 30s by default; zero fetches them one after the other. The nth of
+// N entries is fetched (n+φ)/N of the way into the ramp, where φ in [0, 1)
+// is a hash of podID, so processes with different pod IDs are out of step
+// with each other. An empty podID is the hostname, which tells apart the
+// pods of a Kubernetes deployment.
+func WithCacheBackfillRamp(ramp time.Duration, podID string) Option {
+	return func(c *Client) {
+		c.backfill.ramp, c.backfill.podID = ramp, podID
+	}
+}
+
+// WithCacheBackfillHandler sets the receiver of WithCacheBackfill's
+// progress. It is called from the backfill goroutine.
+func WithCacheBackfillHandler(h CacheBackfillHandler) Option {
+	return func(c *Client) {
+		c.backfill.handler = h
+	}
+}
+
+// start runs the backfill in the background.
+func (b *cacheBackfill) start(c *Client) {
+	if b.podID == "" {
+		b.podID, _ = os.Hostname()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel, b.done = cancel, make(chan struct{})
+	go func() {
+		defer close(b.done)
+		b.run(ctx, c)
+	}()
+}
+
+// stop cancels the backfill, if it runs, and waits for it to end.
+func (b *cacheBackfill) stop() {
+	if b.cancel == nil {
+		return
+	}
+	b.cancel()
+	<-b.done
+}
+
+func (b *cacheBackfill) run(ctx context.Context, c *Client) {
+	limit := min(b.limit, hotKeysMax)
+	if m, ok := c.localCache.(*MemoryCache); ok && m.maxEntries > 0 {
+		limit = min(limit, m.maxEntries)
+	}
+	var p CacheBackfillProgress
+	items, err := c.HotKeys(ctx, limit)
+	if isRouteNotFound(err) {
+		p.Done, p.Unsupported = true, true
+		if c.logger != nil {
+			c.logger.LogAttrs(ctx, slog.LevelInfo, "reliapi cache backfill unsupported")
+		}
+		b.report(ctx, p)
+		return
+	}
+	if err != nil {
+		p.Done, p.Err = true, err
+		b.log(ctx, c, p)
+		b.report(ctx, p)
+		return
+	}
+
+	p.Listed = len(items)
+	phase := podPhase(b.podID)
+	started := time.Now()
+	for i, item := range items {
+		if d := rampDelay(b.ramp, phase, i, len(items)) - time.Since(started); d > 0 {
+			if err := c.sleep(ctx, d); err != nil {
+				p.Err = err
+				break
+			}
+		}
+		b.fill(ctx, c, item, &p)
+		b.report(ctx, p)
+	}
+	p.Done = true
+	b.log(ctx, c, p)
+	b.report(ctx, p)
+}
+
+// fill fetches item from the proxy's cache into the local cache, counting
+// the outcome in p.
+func (b *cacheBackfill) fill(ctx context.Context, c *Client, item HotKey, p *CacheBackfillProgress) {
+	if b.maxBytes > 0 && item.SizeBytes != nil && p.Bytes+*item.SizeBytes > b.maxBytes {
+		p.Skipped++
+		return
+	}
+	var (
+		key       string
+		cacheable bool
+		cacheTTL  *int
+		path      string
+		body      interface{}
+	)
+	switch item.Kind {
+	case HotKeyLLM:
+		var req LLMRequest
+		if err := json.Unmarshal(item.Request, &req); err != nil {
+			p.Failed++
+			return
+		}
+		key, cacheable = llmRequestKey(req)
+		req.CacheMode, req.IdempotencyKey = CacheOnlyIfCached, nil
+		cacheTTL, path, body = req.Cache, llmProxyPath, req
+	case HotKeyHTTP:
+		var req HTTPRequest
+		if err := json.Unmarshal(item.Request, &req); err != nil {
+			p.Failed++
+			return
+		}
+		key, cacheable = httpRequestKey(req)
+		req.CacheMode, req.IdempotencyKey = CacheOnlyIfCached, nil
+		cacheTTL, path, body = req.Cache, httpProxyPath, req
+	}
+	if !cacheable {
+		p.Skipped++
+		return
+	}
+	key = c.localKey(ctx, key)
+	if _, ok, _ := c.localCache.Get(key); ok {
+		p.Skipped++
+		return
+	}
+
+	resp, err := c.post(ctx, path, body, true)
+	if err != nil {
+		if hasCode(err, CodeCacheMiss) {
+			p.Missed++
+		} else {
+			p.Failed++
+		}
+		return
+	}
+	defer resp.Release()
+	raw, ttl, ok := localEntry(cacheTTL, resp)
+	switch {
+	case !ok, b.maxBytes > 0 && p.Bytes+int64(len(raw)) > b.maxBytes:
+		p.Skipped++
+	case c.localCache.Set(key, raw, ttl) != nil:
+		p.Failed++
+	default:
+		p.Stored++
+		p.Bytes += int64(len(raw))
+	}
+}
+
+func (b *cacheBackfill) report(ctx context.Context, p CacheBackfillProgress) {
+	if b.handler != nil {
+		b.handler(ctx, p)
+	}
+}
+
+// log records the outcome of a run.
+func (b *cacheBackfill) log(ctx context.Context, c *Client, p CacheBackfillProgress) {
+	if c.logger == nil {
+		return
+	}
+	level := slog.LevelInfo
+	attrs := []slog.Attr{
+		slog.Int("listed", p.Listed),
+		slog.Int("stored", p.Stored),
+		slog.Int64("bytes", p.Bytes),
+		slog.Int("skipped", p.Skipped),
+		slog.Int("missed", p.Missed),
+		slog.Int("failed", p.Failed),
+	}
+	if p.Err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", p.Err.Error()))
+	}
+	c.logger.LogAttrs(context.WithoutCancel(ctx), level, "reliapi cache backfill", attrs...)
+}
+
+// podPhase maps podID to [0, 1) uniformly, pod IDs differing by a digit
+// included.
+func podPhase(podID string) float64 {
+	sum := sha256.Sum256([]byte(podID))
+	return float64(binary.BigEndian.Uint64(sum[:])>>11) / (1 << 53)
+}
+
+// rampDelay is when, from the start of the backfill, the ith of n entries
+// is fetched.
+func rampDelay(ramp time.Duration, phase float64, i, n int) time.Duration {
+	return time.Duration(math.Round(float64(ramp) * (float64(i) + phase) / float64(n)))
+}
@@ -0,0 +1,282 @@
+package reliapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hotKeyProxy is a proxy whose cache holds, per API key, the answers to
+// prompts, listed by GET /v1/cache/hot in the order given. Prompts listed
+// in missing are listed but no longer cached.
+type hotKeyProxy struct {
+	answers map[string][]string // by API key, prompts most used first
+	missing map[string]bool
+	size    int64 // size_bytes of every listed entry
+
+	mu      sync.Mutex
+	limits  []string
+	fetched []string // API key and prompt of each only_if_cached request
+	calls   int      // other proxy requests
+}
+
+func (p *hotKeyProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	apiKey := r.Header.Get("X-API-Key")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r.URL.Path == "/v1/cache/hot" {
+		p.limits = append(p.limits, r.URL.Query().Get("limit"))
+		items := []map[string]interface{}{}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		for i, prompt := range p.answers[apiKey][:min(limit, len(p.answers[apiKey]))] {
+			items = append(items, map[string]interface{}{
+				"cache_key":  "ck-" + prompt,
+				"kind":       HotKeyLLM,
+				"request":    llmReq(prompt),
+				"uses":       100 - i,
+				"size_bytes": p.size,
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"items": items}})
+		return
+	}
+	var req LLMRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	prompt := req.Messages[0].Content
+	if req.CacheMode != CacheOnlyIfCached {
+		p.calls++
+	} else if p.fetched = append(p.fetched, apiKey+" "+prompt); p.missing[prompt] || req.IdempotencyKey != nil {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]interface{}{"type": "client_error", "code": CodeCacheMiss, "message": "no fresh entry"},
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    map[string]interface{}{"content": apiKey + " answers " + prompt},
+		"meta":    map[string]interface{}{"cache_key": "ck-" + prompt, "cache_hit": req.CacheMode == CacheOnlyIfCached},
+	})
+}
+
+// backfilled opens a client on srv filling store, and returns it once its
+// backfill is done, with the progress reports.
+func backfilled(t *testing.T, srv *httptest.Server, apiKey string, store CacheStore, opts ...Option) (*Client, []CacheBackfillProgress) {
+	t.Helper()
+	var reports []CacheBackfillProgress
+	done := make(chan struct{})
+	opts = append([]Option{WithLocalCache(store), WithCacheBackfillRamp(0, "pod-0"), WithCacheBackfillHandler(func(_ context.Context, p CacheBackfillProgress) {
+		reports = append(reports, p)
+		if p.Done {
+			close(done)
+		}
+	})}, opts...)
+	c, err := NewClient(srv.URL, apiKey, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("backfill not done")
+	}
+	return c, reports
+}
+
+func TestCacheBackfill(t *testing.T) {
+	proxy := &hotKeyProxy{
+		answers: map[string][]string{"key-a": {"a1", "a2", "gone", "a3", "a4", "a5"}},
+		missing: map[string]bool{"gone": true},
+	}
+	srv := httptest.NewServer(proxy)
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+
+	// A MemoryCache of 5 bounds the listing
+	c, reports := backfilled(t, srv, "key-a", NewMemoryCache(5), WithCacheBackfill(10, 0))
+	last := reports[len(reports)-1]
+	if len(reports) != 6 || last.Listed != 5 || last.Stored != 4 || last.Missed != 1 || last.Failed+last.Skipped != 0 || last.Bytes == 0 || last.Err != nil {
+		t.Fatalf("%d reports, last %+v", len(reports), last)
+	}
+	if proxy.limits[0] != "5" {
+		t.Errorf("listed with limit %s", proxy.limits[0])
+	}
+	for i, r := range reports[:5] {
+		if r.Done || r.Stored+r.Missed != i+1 {
+			t.Errorf("report %d = %+v", i, r)
+		}
+	}
+
+	// The backfilled answers are local hits, and the others go to the proxy
+	for _, prompt := range []string{"a1", "a4", "gone", "a5"} {
+		resp, err := c.ProxyLLM(ctx, llmReq(prompt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, _ := resp.CompletionText()
+		if hit := prompt == "a1" || prompt == "a4"; resp.Meta.LocalCacheHit != hit || text != "key-a answers "+prompt {
+			t.Errorf("%s: %q, local hit %v", prompt, text, resp.Meta.LocalCacheHit)
+		}
+	}
+	if proxy.calls != 2 {
+		t.Errorf("%d proxy calls", proxy.calls)
+	}
+}
+
+func TestCacheBackfillMaxBytes(t *testing.T) {
+	proxy := &hotKeyProxy{answers: map[string][]string{"key-a": {"a1", "a2", "a3"}}}
+	srv := httptest.NewServer(proxy)
+	t.Cleanup(srv.Close)
+	entry, _ := json.Marshal(&ReliAPIResponse{Success: true, Data: json.RawMessage(`{"content":"key-a answers a1"}`), Meta: Meta{CacheKey: "ck-a1", CacheHit: true}})
+
+	// Two entries fit
+	_, reports := backfilled(t, srv, "key-a", NewMemoryCache(0), WithCacheBackfill(10, int64(2*len(entry)+10)))
+	if last := reports[len(reports)-1]; last.Stored != 2 || last.Skipped != 1 || last.Bytes != int64(2*len(entry)) {
+		t.Errorf("last report = %+v", last)
+	}
+	if len(proxy.fetched) != 3 {
+		t.Errorf("fetched %q", proxy.fetched)
+	}
+
+	// Listed sizes over the budget aren't fetched
+	proxy.size, proxy.fetched = 1<<20, nil
+	_, reports = backfilled(t, srv, "key-a", NewMemoryCache(0), WithCacheBackfill(10, 1<<10))
+	if last := reports[len(reports)-1]; last.Skipped != 3 || last.Stored != 0 || len(proxy.fetched) != 0 {
+		t.Errorf("last report = %+v, fetched %q", last, proxy.fetched)
+	}
+}
+
+func TestCacheBackfillScope(t *testing.T) {
+	proxy := &hotKeyProxy{answers: map[string][]string{"key-a": {"shared", "a1"}, "key-b": {"shared"}}}
+	srv := httptest.NewServer(proxy)
+	t.Cleanup(srv.Close)
+	store := NewMemoryCache(0)
+
+	// Each key fills its own entries, even for the same request
+	a, _ := backfilled(t, srv, "key-a", store, WithCacheBackfill(10, 0))
+	_, reports := backfilled(t, srv, "key-b", store, WithCacheBackfill(10, 0))
+	if last := reports[len(reports)-1]; last.Stored != 1 || last.Skipped != 0 {
+		t.Errorf("key-b: last report = %+v", last)
+	}
+	if got := strings.Join(proxy.fetched, ","); got != "key-a shared,key-a a1,key-b shared" {
+		t.Errorf("fetched %s", got)
+	}
+	// A client restarting on the store has nothing left to fetch
+	_, reports = backfilled(t, srv, "key-a", store, WithCacheBackfill(10, 0))
+	if last := reports[len(reports)-1]; last.Skipped != 2 || len(proxy.fetched) != 3 {
+		t.Errorf("key-a again: last report = %+v", last)
+	}
+
+	c, err := NewClient(srv.URL, "key-c", WithLocalCache(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Client{a, c} {
+		resp, err := c.ProxyLLM(context.Background(), llmReq("shared"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text, _ := resp.CompletionText(); resp.Meta.LocalCacheHit != (c == a) || !strings.HasPrefix(text, c.apiKey+" ") {
+			t.Errorf("%s: %q, local hit %v", c.apiKey, text, resp.Meta.LocalCacheHit)
+		}
+	}
+	if proxy.calls != 1 || len(proxy.limits) != 3 {
+		t.Errorf("%d proxy calls, %d listings", proxy.calls, len(proxy.limits))
+	}
+}
+
+func TestCacheBackfillUnsupported(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+	var logs bytes.Buffer
+	_, reports := backfilled(t, srv, "key-a", NewMemoryCache(0), WithCacheBackfill(10, 0),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	if len(reports) != 1 || !reports[0].Unsupported || reports[0].Err != nil {
+		t.Errorf("reports = %+v", reports)
+	}
+	if out := logs.String(); strings.Count(out, "level=INFO") != 1 || !strings.Contains(out, "reliapi cache backfill unsupported") {
+		t.Errorf("logs = %s", out)
+	}
+
+	// Nothing runs without a local cache
+	closed := make(chan struct{})
+	c, err := NewClient(srv.URL, "key-a", WithCacheBackfill(10, 0), WithCacheBackfillHandler(func(context.Context, CacheBackfillProgress) { close(closed) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	select {
+	case <-closed:
+		t.Error("backfill ran without a local cache")
+	default:
+	}
+}
+
+func TestCacheBackfillRamp(t *testing.T) {
+	// Pod phases spread evenly
+	const pods, buckets = 10000, 10
+	var counts [buckets]int
+	for i := 0; i < pods; i++ {
+		phase := podPhase(fmt.Sprintf("api-7d9f8c6b5-%d", i))
+		if phase < 0 || phase >= 1 {
+			t.Fatalf("phase %g", phase)
+		}
+		counts[int(phase*buckets)]++
+	}
+	for b, n := range counts {
+		if n < pods/buckets*85/100 || n > pods/buckets*115/100 {
+			t.Errorf("bucket %d has %d pods: %v", b, n, counts)
+		}
+	}
+	if podPhase("pod-a") == podPhase("pod-b") {
+		t.Error("pods in step")
+	}
+
+	// Every entry is fetched within its slot of the ramp, in order
+	ramp := time.Minute
+	for _, phase := range []float64{0, 0.5, 0.999} {
+		prev := time.Duration(-1)
+		for i := 0; i < 8; i++ {
+			d := rampDelay(ramp, phase, i, 8)
+			if d < ramp*time.Duration(i)/8 || d >= ramp*time.Duration(i+1)/8 || d <= prev {
+				t.Errorf("phase %g: entry %d at %v", phase, i, d)
+			}
+			prev = d
+		}
+	}
+
+	// The fetches wait for their slots
+	proxy := &hotKeyProxy{answers: map[string][]string{"key-a": {"a1", "a2", "a3", "a4"}}}
+	srv := httptest.NewServer(proxy)
+	t.Cleanup(srv.Close)
+	var slept []time.Duration
+	c, err := NewClient(srv.URL, "key-a", WithLocalCache(NewMemoryCache(0)), WithCacheBackfill(10, 0), WithCacheBackfillRamp(time.Hour, "pod-0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.backfill.stop()
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	c.backfill.run(context.Background(), c)
+	phase := podPhase("pod-0")
+	if len(slept) != 4 {
+		t.Fatalf("slept %v", slept)
+	}
+	for i, d := range slept {
+		if want := rampDelay(time.Hour, phase, i, 4); d > want || d < want-time.Second {
+			t.Errorf("entry %d: slept %v, want %v", i, d, want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// BatchOptions controls how the proxy runs a batch.
+type BatchOptions struct {
+	// MaxParallel caps how many items the proxy processes at once. Zero
+	// uses the proxy default (8); the proxy accepts at most 64.
+	MaxParallel int
+	// FailFast stops the proxy from starting new items after the first
+	// failure. Items that never ran fail with CodeBatchAborted.
+	FailFast bool
+	// TenantID selects the API key the whole call authenticates with, via
+	// WithTenantKeyProvider. The TenantID of individual requests is ignored.
+	TenantID string
+}
+
+// BatchResult is the outcome of one request in a batch. Exactly one of
+// Response and Err is set.
+type BatchResult struct {
+	// Index is the position of the originating request in the slice passed
+	// to ProxyLLMBatch.
+	Index int
+	// Response holds the item's data and its own meta (cache hit, cost).
+	Response *ReliAPIResponse
+	// Err is an *APIError describing the item's failure.
+	Err error
+	// Batch is the aggregate meta of the call, shared by every result.
+	Batch *BatchMeta
+}
+
+// BatchMeta is the batch-level metadata (app/schemas.py BatchMetaResponse).
+type BatchMeta struct {
+	RequestID  string `json:"request_id"`
+	DurationMs int    `json:"duration_ms"`
+	Total      int    `json:"total"`
+	Succeeded  int    `json:"succeeded"`
+	Failed     int    `json:"failed"`
+	Aborted    int    `json:"aborted"`
+	CacheHits  int    `json:"cache_hits"`
+	// CostUSD is the summed actual cost of items that reached an upstream;
+	// cache and idempotency hits do not count.
+	CostUSD float64 `json:"cost_usd"`
+}
+
+type batchRequest struct {
+	Requests    []LLMRequest `json:"requests"`
+	MaxParallel int          `json:"max_parallel,omitempty"`
+	FailFast    bool         `json:"fail_fast"`
+}
+
+type batchResponse struct {
+	Success bool              `json:"success"`
+	Results []batchItemResult `json:"results"`
+	Meta    BatchMeta         `json:"meta"`
+}
+
+type batchItemResult struct {
+	Index   int             `json:"index"`
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   *errorDetail    `json:"error"`
+	Meta    Meta            `json:"meta"`
+}
+
+// ProxyLLMBatch sends reqs to the proxy's batch endpoint in a single call
+// and returns one BatchResult per request, in the order of reqs.
+//
+// Items are independent: each gets its own idempotency key (under
+// WithAutoIdempotency and friends), cache lookup and budget check. Streaming
+// is not supported. When items fail, the results are returned with a
+// *MultiError holding the error of each item; when the call itself fails
+// the error is its own and there are no results. A ctx that ends while the
+// call is in flight marks every item ErrNotCompleted instead.
+func (c *Client) ProxyLLMBatch(ctx context.Context, reqs []LLMRequest, opts BatchOptions) (results []BatchResult, err error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	// The items may name different targets; the call itself has none.
+	ctx, in := c.instrument(ctx, OpProxyLLMBatch, "")
+	defer in.endBatch(reqs, &results, &err)
+	// hooks holds the hook Request of every item whose request hooks ran.
+	var hooks []*Request
+	defer func() {
+		if hooks != nil {
+			err = c.endBatchHooks(ctx, hooks, results, err)
+		}
+	}()
+	ctx, err = c.tenantContext(ctx, opts.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	body := batchRequest{
+		Requests:    make([]LLMRequest, len(reqs)),
+		MaxParallel: opts.MaxParallel,
+		FailFast:    opts.FailFast,
+	}
+	keys := make([]string, len(reqs))
+	vaults := make([]*RedactionVault, len(reqs))
+	retryable := true
+	for i, req := range reqs {
+		req, err := withPromptMessages(req)
+		if err != nil {
+			return nil, fmt.Errorf("reliapi: batch item %d: %w", i, err)
+		}
+		if err := c.checkImages(req.Messages); err != nil {
+			return nil, fmt.Errorf("reliapi: batch item %d: %w", i, err)
+		}
+		itemCtx, req, err := c.guardLLM(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("reliapi: batch item %d: %w", i, err)
+		}
+		if req.Tags, err = c.withTags(req.Tags); err != nil {
+			return nil, fmt.Errorf("reliapi: batch item %d: %w", i, err)
+		}
+		req, vaults[i] = c.redact(req)
+		req.Stream = nil
+		key, err := c.applyIdempotency(&req.IdempotencyKey, req, allowsResend(req.Retry))
+		if err != nil {
+			return nil, err
+		}
+		req.IdempotencyTTL = c.idempotencyTTLSeconds(key, req.IdempotencyTTL)
+		hr, err := c.startHooks(itemCtx, OpProxyLLMBatch, req.Target, &req.IdempotencyKey, req)
+		if err != nil {
+			return nil, err
+		}
+		if hr != nil {
+			if hooks == nil {
+				hooks = make([]*Request, len(reqs))
+			}
+			hooks[i] = hr
+			key = hr.IdempotencyKey
+		}
+		keys[i] = key
+		retryable = retryable && req.IdempotencyKey != nil && allowsResend(req.Retry)
+		body.Requests[i] = req
+	}
+
+	if hooks != nil {
+		ctx = withHookRequest(ctx, batchHookRequest(reqs, hooks))
+	}
+	_, raw, err := c.do(ctx, http.MethodPost, llmBatchPath, body, retryable)
+	if err != nil {
+		if ctx.Err() == nil {
+			return nil, err
+		}
+		return notCompletedBatch(len(reqs), err)
+	}
+	var out batchResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if len(out.Results) != len(reqs) {
+		return nil, fmt.Errorf("reliapi: batch returned %d results for %d requests", len(out.Results), len(reqs))
+	}
+
+	meta := out.Meta
+	results = make([]BatchResult, len(reqs))
+	errs := make([]error, len(reqs))
+	seen := make([]bool, len(reqs))
+	for _, item := range out.Results {
+		if item.Index < 0 || item.Index >= len(reqs) {
+			return nil, fmt.Errorf("reliapi: batch result index %d out of range", item.Index)
+		}
+		if seen[item.Index] {
+			return nil, fmt.Errorf("reliapi: batch returned index %d twice", item.Index)
+		}
+		seen[item.Index] = true
+		res := BatchResult{Index: item.Index, Batch: &meta}
+		if item.Success {
+			res.Response = vaults[item.Index].restoreResponse(&ReliAPIResponse{
+				Success:        true,
+				Data:           item.Data,
+				Meta:           item.Meta,
+				IdempotencyKey: keys[item.Index],
+			})
+		} else {
+			res.Err = withIdempotencyKey(batchItemError(item), keys[item.Index])
+			errs[item.Index] = res.Err
+		}
+		results[item.Index] = res
+	}
+	return results, newMultiError(errs)
+}
+
+// notCompletedBatch marks every item of a batch call cut short by its
+// context with err.
+func notCompletedBatch(n int, err error) ([]BatchResult, error) {
+	results := make([]BatchResult, n)
+	errs := make([]error, n)
+	for i := range results {
+		errs[i] = &notCompletedError{cause: err}
+		results[i] = BatchResult{Index: i, Err: errs[i]}
+	}
+	return results, &MultiError{Errs: errs}
+}
+
+// batchHookRequest is the Request attempt hooks see for the batch call. Its
+// Header merges the headers the items' request hooks added.
+func batchHookRequest(reqs []LLMRequest, hooks []*Request) *Request {
+	call := &Request{Op: OpProxyLLMBatch, Header: make(http.Header), Body: reqs}
+	for _, r := range hooks {
+		for name, values := range r.Header {
+			for _, v := range values {
+				if !slices.Contains(call.Header[name], v) {
+					call.Header[name] = append(call.Header[name], v)
+				}
+			}
+		}
+	}
+	return call
+}
+
+// endBatchHooks runs the response hooks of every item with its own result,
+// or the call's error when there are no results.
+func (c *Client) endBatchHooks(ctx context.Context, hooks []*Request, results []BatchResult, err error) error {
+	var panicErr error
+	for i, r := range hooks {
+		if r == nil {
+			continue
+		}
+		var resp *ReliAPIResponse
+		itemErr := err
+		if results != nil {
+			resp, itemErr = results[i].Response, results[i].Err
+		}
+		if herr := c.runResponseHooks(ctx, r, resp, itemErr); herr != nil && panicErr == nil {
+			panicErr = herr
+		}
+	}
+	return joinHookPanic(err, panicErr)
+}
+
+func batchItemError(item batchItemResult) *APIError {
+	e := &APIError{
+		StatusCode: http.StatusInternalServerError,
+		RequestID:  item.Meta.RequestID,
+	}
+	if item.Error == nil {
+		e.Message = "batch item failed without error detail"
+		return e
+	}
+	if item.Error.StatusCode != nil {
+		e.StatusCode = *item.Error.StatusCode
+	}
+	e.applyDetail(item.Error)
+	return e
+}
@@ -0,0 +1,134 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func batchHandler(t *testing.T, check func(body map[string]interface{}), results []map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/proxy/llm/batch" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if check != nil {
+			check(body)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": false,
+			"results": results,
+			"meta": map[string]interface{}{
+				"request_id": "req_batch", "duration_ms": 12, "total": len(results),
+				"succeeded": 1, "failed": 1, "cache_hits": 1, "cost_usd": 0.003,
+			},
+		})
+	}
+}
+
+var mixedBatchResults = []map[string]interface{}{
+	// Results arrive out of order; Index decides placement.
+	{"index": 1, "success": false, "error": map[string]interface{}{
+		"type": "upstream_error", "code": "SERVER_ERROR", "message": "boom", "retryable": true, "status_code": 502,
+	}, "meta": map[string]interface{}{"request_id": "req_batch_1"}},
+	{"index": 0, "success": true, "data": map[string]interface{}{"content": "positive"},
+		"meta": map[string]interface{}{"request_id": "req_batch_0", "cache_hit": true, "cost_usd": 0.003}},
+}
+
+func TestProxyLLMBatch(t *testing.T) {
+	c := newTestClient(t, batchHandler(t, func(body map[string]interface{}) {
+		reqs, _ := body["requests"].([]interface{})
+		if len(reqs) != 2 || body["max_parallel"] != float64(4) || body["fail_fast"] != false {
+			t.Errorf("unexpected body %v", body)
+		}
+		for _, r := range reqs {
+			if key, _ := r.(map[string]interface{})["idempotency_key"].(string); key == "" {
+				t.Errorf("item without idempotency key: %v", r)
+			}
+		}
+	}, mixedBatchResults), WithAutoIdempotency())
+
+	results, err := c.ProxyLLMBatch(context.Background(), []LLMRequest{llmReq("good"), llmReq("bad")}, BatchOptions{MaxParallel: 4})
+	var multi *MultiError
+	if !errors.As(err, &multi) || !slices.Equal(multi.Failures(), []int{1}) || !slices.Equal(multi.Successes(), []int{0}) {
+		t.Fatalf("ProxyLLMBatch: %v, want item 1 failed", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("len(results) = %d", len(results))
+	}
+
+	ok := results[0]
+	if ok.Index != 0 || ok.Err != nil || ok.Response == nil {
+		t.Fatalf("results[0] = %+v", ok)
+	}
+	if !ok.Response.Meta.CacheHit || ok.Response.Meta.CostUSD == nil || ok.Response.IdempotencyKey == "" {
+		t.Errorf("item meta = %+v", ok.Response.Meta)
+	}
+
+	failed := results[1]
+	var apiErr *APIError
+	if failed.Index != 1 || failed.Response != nil || !errors.As(failed.Err, &apiErr) {
+		t.Fatalf("results[1] = %+v", failed)
+	}
+	if apiErr.StatusCode != 502 || apiErr.Code != CodeServerError || apiErr.RequestID != "req_batch_1" {
+		t.Errorf("item error = %+v", apiErr)
+	}
+
+	if ok.Batch != failed.Batch || ok.Batch.CostUSD != 0.003 || ok.Batch.CacheHits != 1 || ok.Batch.RequestID != "req_batch" {
+		t.Errorf("batch meta = %+v", ok.Batch)
+	}
+}
+
+func TestProxyLLMBatchFailFast(t *testing.T) {
+	results := []map[string]interface{}{
+		mixedBatchResults[1],
+		mixedBatchResults[0],
+		{"index": 2, "success": false, "error": map[string]interface{}{
+			"type": "batch_error", "code": "BATCH_ABORTED", "message": "aborted", "retryable": true, "status_code": 424,
+		}, "meta": map[string]interface{}{"request_id": "req_batch_2"}},
+	}
+	c := newTestClient(t, batchHandler(t, func(body map[string]interface{}) {
+		if body["fail_fast"] != true {
+			t.Errorf("fail_fast not sent: %v", body)
+		}
+	}, results))
+
+	got, err := c.ProxyLLMBatch(context.Background(), []LLMRequest{llmReq("a"), llmReq("b"), llmReq("c")}, BatchOptions{FailFast: true})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeServerError {
+		t.Fatalf("err = %v, want the first item failure", err)
+	}
+	if len(got) != 3 || !hasCode(got[2].Err, CodeBatchAborted) || !IsRetriable(got[2].Err) {
+		t.Errorf("results = %+v", got)
+	}
+}
+
+func TestProxyLLMBatchRejected(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"detail": map[string]interface{}{"type": "client_error", "code": "STREAMING_UNSUPPORTED", "message": "no streaming"},
+		})
+	})
+	_, err := c.ProxyLLMBatch(context.Background(), []LLMRequest{llmReq("a")}, BatchOptions{})
+	if !hasCode(err, CodeStreamingUnsupported) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestProxyLLMBatchDuplicateIndex(t *testing.T) {
+	// Index 1 twice and no index 0
+	results := []map[string]interface{}{mixedBatchResults[0], mixedBatchResults[0]}
+	c := newTestClient(t, batchHandler(t, nil, results))
+	got, err := c.ProxyLLMBatch(context.Background(), []LLMRequest{llmReq("a"), llmReq("b")}, BatchOptions{})
+	if err == nil || got != nil {
+		t.Fatalf("results = %+v, err = %v", got, err)
+	}
+}
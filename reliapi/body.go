@@ -0,0 +1,69 @@
+package reliapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// HTTPRequest.BodyEncoding and Meta.ResponseEncoding values.
+const (
+	// BodyEncodingUTF8 is a body carried as text, the default.
+	BodyEncodingUTF8 = "utf8"
+	// BodyEncodingBase64 is a binary body carried as base64.
+	BodyEncodingBase64 = "base64"
+)
+
+// ErrConflictingBody is returned for an HTTPRequest that sets more than one
+// of Body, BodyBase64, BodyBytes and Multipart.
+var ErrConflictingBody = errors.New("reliapi: HTTPRequest sets more than one of Body, BodyBase64, BodyBytes and Multipart")
+
+// withEncodedBody returns req with BodyBytes encoded into BodyBase64, the
+// form the proxy accepts. Like withPromptMessages, the result is
+// indistinguishable from a request written that way, so both share
+// coalescing and idempotency keys.
+func withEncodedBody(req HTTPRequest) (HTTPRequest, error) {
+	set := 0
+	for _, ok := range []bool{req.Body != nil, req.BodyBase64 != nil, req.BodyBytes != nil, req.Multipart != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return req, ErrConflictingBody
+	}
+	if req.BodyBytes != nil {
+		encoded := base64.StdEncoding.EncodeToString(req.BodyBytes)
+		req.BodyBase64 = &encoded
+		req.BodyBytes = nil
+	}
+	return req, nil
+}
+
+// requestBody returns the bytes of the body hr describes, nil for none.
+func requestBody(hr HTTPRequest) ([]byte, error) {
+	hr, err := withEncodedBody(hr)
+	if err != nil {
+		return nil, err
+	}
+	encoding := hr.BodyEncoding
+	body := hr.Body
+	if hr.BodyBase64 != nil {
+		encoding, body = BodyEncodingBase64, hr.BodyBase64
+	}
+	if body == nil {
+		return nil, nil
+	}
+	switch encoding {
+	case "", BodyEncodingUTF8:
+		return []byte(*body), nil
+	case BodyEncodingBase64:
+		raw, err := base64.StdEncoding.DecodeString(*body)
+		if err != nil {
+			return nil, fmt.Errorf("reliapi: decode base64 body: %w", err)
+		}
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("reliapi: unknown body encoding %q", encoding)
+	}
+}
@@ -0,0 +1,106 @@
+package reliapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"testing"
+)
+
+// binaryEchoProxy answers /proxy/http like the proxy does for an upstream
+// echoing the request body as application/octet-stream.
+func binaryEchoProxy(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := req["body"]; ok {
+			t.Errorf("binary body sent as body")
+		}
+		encoded, _ := req["body_base64"].(string)
+		if _, err := base64.StdEncoding.DecodeString(encoded); err != nil {
+			t.Errorf("body_base64: %v", err)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"status_code":   200,
+				"headers":       map[string]string{"content-type": "application/octet-stream"},
+				"body":          encoded,
+				"body_encoding": "base64",
+			},
+			"meta": map[string]interface{}{"request_id": "req_bin", "response_encoding": "base64"},
+		})
+	}
+}
+
+func TestBinaryBodyRoundTrip(t *testing.T) {
+	payload := make([]byte, 5<<20)
+	rand.New(rand.NewSource(1)).Read(payload)
+	c := newTestClient(t, binaryEchoProxy(t))
+
+	resp, err := c.ProxyHTTP(context.Background(), HTTPRequest{
+		Target:    "storage",
+		Method:    "PUT",
+		Path:      "/objects/blob",
+		Headers:   map[string]string{"Content-Type": "application/octet-stream"},
+		BodyBytes: payload,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta.ResponseEncoding != BodyEncodingBase64 {
+		t.Errorf("ResponseEncoding = %q", resp.Meta.ResponseEncoding)
+	}
+	data := resp.DataMap()
+	if got, ok := data["body"].([]byte); !ok || !bytes.Equal(got, payload) {
+		t.Fatalf("Data[body] is %T, not the payload", data["body"])
+	}
+
+	httpResp, err := ToHTTPResponse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(httpResp.Body)
+	if !bytes.Equal(got, payload) || httpResp.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("ToHTTPResponse body differs (%d bytes, %q)", len(got), httpResp.Header.Get("Content-Type"))
+	}
+}
+
+func TestBinaryBodyDeterministicKey(t *testing.T) {
+	var keys []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			IdempotencyKey string `json:"idempotency_key"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		keys = append(keys, body.IdempotencyKey)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{}})
+	}, WithDeterministicIdempotency())
+
+	for _, b := range [][]byte{{0xff, 0x00}, {0xff, 0x01}} {
+		if _, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: "POST", Path: "/", BodyBytes: b}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys[0] == keys[1] {
+		t.Errorf("different binary bodies share the key %s", keys[0])
+	}
+}
+
+func TestConflictingBody(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request sent")
+	})
+	text := "{}"
+	_, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: "POST", Path: "/", Body: &text, BodyBytes: []byte{1}})
+	if !errors.Is(err, ErrConflictingBody) {
+		t.Fatalf("err = %v, want ErrConflictingBody", err)
+	}
+}
@@ -0,0 +1,208 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	budgetPath       = "/v1/budget"
+	budgetAlertsPath = "/v1/budget/alerts"
+	estimatePath     = "/v1/estimate"
+)
+
+// BudgetStatus is the LLM spend of the caller's tenant in the current
+// calendar month (UTC). The proxy tracks spend per instance, so behind a
+// load balancer each status covers the instance that answered.
+type BudgetStatus struct {
+	// Tenant is the caller's tenant; empty outside multi-tenant mode.
+	Tenant   string  `json:"tenant"`
+	SpentUSD float64 `json:"spent_usd"`
+	// CapUSD is the monthly_budget_usd; nil when no monthly budget is
+	// configured, and RemainingUSD is then nil too.
+	CapUSD       *float64 `json:"cap_usd"`
+	RemainingUSD *float64 `json:"remaining_usd"`
+	// ReservedUSD is the estimated cost of the requests in flight, held
+	// against the cap until their actual cost is known. A request is
+	// rejected when RemainingUSD less ReservedUSD can't cover its estimate.
+	ReservedUSD float64 `json:"reserved_usd"`
+	// Overshoots counts the requests this month that cost more than their
+	// estimate reserved, and OvershootUSD sums the excess: how far past
+	// the cap the spend can get.
+	Overshoots   int       `json:"overshoots"`
+	OvershootUSD float64   `json:"overshoot_usd"`
+	PeriodStart  time.Time `json:"period_start"`
+	// ResetAt is when spend resets, the start of the next month.
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// Budget returns the caller's spend this month against its monthly cap.
+// Requests whose estimate would exceed the remaining budget are rejected
+// with BUDGET_EXCEEDED.
+func (c *Client) Budget(ctx context.Context) (*BudgetStatus, error) {
+	resp, raw, err := c.do(ctx, http.MethodGet, budgetPath, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool         `json:"success"`
+		Data    BudgetStatus `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return &out.Data, nil
+}
+
+// BudgetAlerts returns the budget alerts that fired this month for the
+// caller's tenant and API key, oldest first: the same payloads the proxy
+// delivers as EventBudgetThresholdReached webhooks.
+func (c *Client) BudgetAlerts(ctx context.Context) ([]BudgetThresholdEvent, error) {
+	resp, raw, err := c.do(ctx, http.MethodGet, budgetAlertsPath, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Alerts []BudgetThresholdEvent `json:"alerts"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return out.Data.Alerts, nil
+}
+
+// CostEstimate is the proxy's estimate of an LLM request's cost.
+type CostEstimate struct {
+	Target   string `json:"target"`
+	Provider string `json:"provider"`
+	// Model and MaxCompletionTokens are what the request would be sent
+	// with, after the target's defaults, limits and soft cost cap.
+	Model               string `json:"model"`
+	PromptTokens        int    `json:"prompt_tokens"`
+	MaxCompletionTokens *int   `json:"max_completion_tokens"`
+	// CostMinUSD is the cost of the prompt alone and CostMaxUSD that of the
+	// prompt plus MaxCompletionTokens. Both are nil for models the proxy
+	// has no pricing for, and CostMaxUSD also without a max_tokens limit.
+	CostMinUSD *float64 `json:"cost_min_usd"`
+	CostMaxUSD *float64 `json:"cost_max_usd"`
+	// CostEstimateUSD is the figure the target's hard cap, MaxCostUSD and
+	// the monthly budget are checked against.
+	CostEstimateUSD  *float64 `json:"cost_estimate_usd"`
+	MaxTokensReduced bool     `json:"max_tokens_reduced"`
+}
+
+// EstimateCost returns the estimated tokens and cost of req without
+// sending it upstream. Prompt tokens are approximated like CountTokens.
+func (c *Client) EstimateCost(ctx context.Context, req LLMRequest) (*CostEstimate, error) {
+	req, err := withPromptMessages(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err = c.tenantContext(ctx, req.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	req, _ = c.redact(req)
+	resp, raw, err := c.do(ctx, http.MethodPost, estimatePath, req, true)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool         `json:"success"`
+		Data    CostEstimate `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return &out.Data, nil
+}
+
+// Budget ceilings reported by BudgetRejection.Limit.
+const (
+	// LimitMaxCost is the request's LLMRequest.MaxCostUSD.
+	LimitMaxCost = "max_cost_usd"
+	// LimitHardCap is the target's hard_cost_cap_usd.
+	LimitHardCap = "hard_cost_cap_usd"
+	// LimitMonthlyBudget is the rest of the tenant's monthly budget.
+	LimitMonthlyBudget = "budget_cap_usd"
+	// LimitKeyBudget is the rest of the API key's monthly budget, for
+	// KEY_BUDGET_EXCEEDED.
+	LimitKeyBudget = "key_budget_cap_usd"
+)
+
+// BudgetRejection describes a BUDGET_EXCEEDED or KEY_BUDGET_EXCEEDED
+// rejection.
+type BudgetRejection struct {
+	// CostEstimateUSD is the estimate the proxy rejected; lower MaxTokens
+	// until it fits under LimitUSD.
+	CostEstimateUSD float64
+	// Limit names the ceiling the estimate exceeded, one of the Limit*
+	// constants, and LimitUSD is its value.
+	Limit    string
+	LimitUSD float64
+	// SpentUSD is the month's spend so far, for LimitMonthlyBudget and
+	// LimitKeyBudget.
+	SpentUSD float64
+	// ReservedUSD is the estimated cost of the requests in flight that
+	// was held against the budget besides SpentUSD, for LimitMonthlyBudget
+	// and LimitKeyBudget.
+	ReservedUSD float64
+	// APIKeyName is the name the API key is configured under, for
+	// LimitKeyBudget.
+	APIKeyName string
+	// Model and MaxTokens are what the estimate was computed for.
+	Model     string
+	MaxTokens int
+}
+
+// AsBudgetExceeded returns the details of a BUDGET_EXCEEDED or
+// KEY_BUDGET_EXCEEDED rejection. It reports false for other errors.
+func AsBudgetExceeded(err error) (*BudgetRejection, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !(IsBudgetExceeded(apiErr) || IsKeyBudgetExceeded(apiErr)) {
+		return nil, false
+	}
+	raw, _ := json.Marshal(apiErr.Details)
+	var d struct {
+		CostEstimateUSD float64  `json:"cost_estimate_usd"`
+		MaxCostUSD      *float64 `json:"max_cost_usd"`
+		HardCostCapUSD  *float64 `json:"hard_cost_cap_usd"`
+		BudgetCapUSD    *float64 `json:"budget_cap_usd"`
+		KeyBudgetCapUSD *float64 `json:"key_budget_cap_usd"`
+		APIKeyName      string   `json:"api_key_name"`
+		SpentUSD        float64  `json:"spent_usd"`
+		ReservedUSD     float64  `json:"reserved_usd"`
+		Model           string   `json:"model"`
+		MaxTokens       int      `json:"max_tokens"`
+	}
+	_ = json.Unmarshal(raw, &d)
+
+	r := &BudgetRejection{CostEstimateUSD: d.CostEstimateUSD, SpentUSD: d.SpentUSD, ReservedUSD: d.ReservedUSD, APIKeyName: d.APIKeyName, Model: d.Model, MaxTokens: d.MaxTokens}
+	switch {
+	case d.MaxCostUSD != nil:
+		r.Limit, r.LimitUSD = LimitMaxCost, *d.MaxCostUSD
+	case d.HardCostCapUSD != nil:
+		r.Limit, r.LimitUSD = LimitHardCap, *d.HardCostCapUSD
+	case d.BudgetCapUSD != nil:
+		r.Limit, r.LimitUSD = LimitMonthlyBudget, *d.BudgetCapUSD
+	case d.KeyBudgetCapUSD != nil:
+		r.Limit, r.LimitUSD = LimitKeyBudget, *d.KeyBudgetCapUSD
+	}
+	return r, true
+}
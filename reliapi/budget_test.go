@@ -0,0 +1,295 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/budget" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"tenant":        "acme",
+				"spent_usd":     12.5,
+				"cap_usd":       50.0,
+				"remaining_usd": 37.5,
+				"reserved_usd":  0.75,
+				"overshoots":    2,
+				"overshoot_usd": 0.01,
+				"period_start":  "2026-10-01T00:00:00+00:00",
+				"reset_at":      "2026-11-01T00:00:00+00:00",
+			},
+			"meta": map[string]interface{}{"request_id": "req_budget", "duration_ms": 1},
+		})
+	})
+	got, err := c.Budget(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tenant != "acme" || got.SpentUSD != 12.5 || got.CapUSD == nil || *got.CapUSD != 50 || *got.RemainingUSD != 37.5 {
+		t.Errorf("budget = %+v", got)
+	}
+	if got.ReservedUSD != 0.75 || got.Overshoots != 2 || got.OvershootUSD != 0.01 {
+		t.Errorf("reservations = %v, %d overshoots of $%v", got.ReservedUSD, got.Overshoots, got.OvershootUSD)
+	}
+	if want := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC); !got.ResetAt.Equal(want) {
+		t.Errorf("ResetAt = %v, want %v", got.ResetAt, want)
+	}
+}
+
+func TestBudgetAlerts(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/budget/alerts" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		alert := func(apiKey interface{}, threshold float64) map[string]interface{} {
+			return map[string]interface{}{
+				"tenant": "acme", "api_key": apiKey, "threshold": threshold,
+				"spent_usd": 41.0, "cap_usd": 50.0, "projected_usd": 62.5, "run_rate_usd_per_day": 1.5,
+				"period_start": "2026-10-01T00:00:00+00:00", "reset_at": "2026-11-01T00:00:00+00:00",
+				"fired_at": "2026-10-14T09:30:00+00:00",
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"alerts": []interface{}{alert(nil, 0.8), alert("team-a", 0.5)}},
+			"meta":    map[string]interface{}{"request_id": "req_alerts", "duration_ms": 1},
+		})
+	})
+	got, err := c.BudgetAlerts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("alerts = %+v", got)
+	}
+	tenant, key := got[0], got[1]
+	if tenant.APIKey != "" || tenant.Threshold != 0.8 || tenant.ProjectedUSD != 62.5 || tenant.RunRateUSDPerDay != 1.5 {
+		t.Errorf("tenant alert = %+v", tenant)
+	}
+	if want := time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC); !tenant.FiredAt.Equal(want) {
+		t.Errorf("FiredAt = %v, want %v", tenant.FiredAt, want)
+	}
+	if key.APIKey != "team-a" || key.Threshold != 0.5 || key.Tenant != "acme" {
+		t.Errorf("key alert = %+v", key)
+	}
+}
+
+func TestBudgetWithoutCap(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"tenant": nil, "spent_usd": 0.25, "cap_usd": nil, "remaining_usd": nil,
+				"period_start": "2026-10-01T00:00:00+00:00", "reset_at": "2026-11-01T00:00:00+00:00",
+			},
+			"meta": map[string]interface{}{"request_id": "req_budget", "duration_ms": 1},
+		})
+	})
+	got, err := c.Budget(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CapUSD != nil || got.RemainingUSD != nil || got.SpentUSD != 0.25 {
+		t.Errorf("budget = %+v", got)
+	}
+}
+
+// maxCostHandler rejects requests the way the proxy does: only an estimate
+// strictly above max_cost_usd fails.
+func maxCostHandler(t *testing.T, estimate float64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ceiling, ok := body["max_cost_usd"].(float64)
+		if !ok || estimate <= ceiling {
+			okLLMResponse(w)
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"type":        "budget_error",
+				"code":        "BUDGET_EXCEEDED",
+				"message":     fmt.Sprintf("Estimated cost $%.6f exceeds max_cost_usd $%.6f", estimate, ceiling),
+				"retryable":   false,
+				"target":      "openai",
+				"status_code": 400,
+				"details": map[string]interface{}{
+					"cost_estimate_usd": estimate, "max_cost_usd": ceiling, "model": "gpt-4o-mini", "max_tokens": body["max_tokens"],
+				},
+			},
+			"meta": map[string]interface{}{"request_id": "req_budget", "cost_policy_applied": "max_cost_rejected"},
+		})
+	}
+}
+
+func TestMaxCostUSD(t *testing.T) {
+	// 0.1 + 0.2 is not exactly 0.3 in binary; the ceiling must reach the
+	// proxy with every bit intact for the boundary to hold.
+	tenth := 0.1
+	estimate := tenth + 0.2
+	c := newTestClient(t, maxCostHandler(t, estimate))
+	ctx := context.Background()
+
+	req := llmReq("hi")
+	maxTokens := 4000
+	req.MaxTokens = &maxTokens
+
+	req.MaxCostUSD = &estimate
+	if _, err := c.ProxyLLM(ctx, req); err != nil {
+		t.Fatalf("estimate equal to MaxCostUSD: %v", err)
+	}
+
+	below := 0.3
+	req.MaxCostUSD = &below
+	_, err := c.ProxyLLM(ctx, req)
+	if !IsBudgetExceeded(err) {
+		t.Fatalf("err = %v, want BUDGET_EXCEEDED", err)
+	}
+	got, ok := AsBudgetExceeded(err)
+	if !ok {
+		t.Fatal("AsBudgetExceeded = false")
+	}
+	want := BudgetRejection{CostEstimateUSD: estimate, Limit: LimitMaxCost, LimitUSD: below, Model: "gpt-4o-mini", MaxTokens: 4000}
+	if *got != want {
+		t.Errorf("rejection = %+v, want %+v", *got, want)
+	}
+}
+
+func TestAsBudgetExceeded(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		details map[string]interface{}
+		want    BudgetRejection
+	}{
+		{
+			name:    "hard cap",
+			details: map[string]interface{}{"cost_estimate_usd": 0.1, "hard_cost_cap_usd": 0.05},
+			want:    BudgetRejection{CostEstimateUSD: 0.1, Limit: LimitHardCap, LimitUSD: 0.05},
+		},
+		{
+			name: "monthly budget",
+			details: map[string]interface{}{
+				"cost_estimate_usd": 2.0, "budget_cap_usd": 100.0, "spent_usd": 97.5, "reserved_usd": 1.5,
+				"reset_at": "2026-11-01T00:00:00+00:00",
+			},
+			want: BudgetRejection{CostEstimateUSD: 2, Limit: LimitMonthlyBudget, LimitUSD: 100, SpentUSD: 97.5, ReservedUSD: 1.5},
+		},
+		{
+			name: "key budget",
+			code: CodeKeyBudgetExceeded,
+			details: map[string]interface{}{
+				"cost_estimate_usd": 0.5, "api_key_name": "team-a", "key_budget_cap_usd": 20.0, "spent_usd": 19.75,
+			},
+			want: BudgetRejection{CostEstimateUSD: 0.5, Limit: LimitKeyBudget, LimitUSD: 20, SpentUSD: 19.75, APIKeyName: "team-a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := tt.code
+			if code == "" {
+				code = CodeBudgetExceeded
+			}
+			got, ok := AsBudgetExceeded(&APIError{Code: code, Details: tt.details})
+			if !ok || *got != tt.want {
+				t.Errorf("AsBudgetExceeded = %+v, %v, want %+v", got, ok, tt.want)
+			}
+		})
+	}
+	if _, ok := AsBudgetExceeded(&APIError{Code: CodeCircuitOpen}); ok {
+		t.Error("AsBudgetExceeded(CIRCUIT_OPEN) = true")
+	}
+}
+
+func TestStreamBudgetRejection(t *testing.T) {
+	events := []string{
+		"event: error\ndata: {\"code\": \"BUDGET_EXCEEDED\", \"message\": \"Estimated cost $0.002000 exceeds max_cost_usd $0.001000\", \"upstream_status\": 400, " +
+			"\"details\": {\"cost_estimate_usd\": 0.002, \"max_cost_usd\": 0.001, \"model\": \"gpt-4o-mini\", \"max_tokens\": 100}}\n\n",
+	}
+	c := newTestClient(t, sseHandler(t, events, false))
+	s, err := c.ProxyLLMStream(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_, err = collect(t, s)
+	got, ok := AsBudgetExceeded(err)
+	if !ok || got.CostEstimateUSD != 0.002 || got.Limit != LimitMaxCost || got.MaxTokens != 100 {
+		t.Fatalf("AsBudgetExceeded(%v) = %+v, %v", err, got, ok)
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	for _, s := range loadCostSamples(t) {
+		t.Run(s.Name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/v1/estimate" {
+					t.Errorf("%s %s", r.Method, r.URL.Path)
+				}
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("decode body: %v", err)
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if body["model"] != s.Request.Model {
+					t.Errorf("body = %v", body)
+				}
+				writeJSON(w, http.StatusOK, map[string]interface{}{
+					"success": true,
+					"data":    s.Estimate,
+					"meta":    map[string]interface{}{"request_id": "req_estimate", "duration_ms": 1},
+				})
+			})
+			est, err := c.EstimateCost(context.Background(), s.Request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if est.CostMinUSD == nil || est.CostMaxUSD == nil || est.MaxCompletionTokens == nil {
+				t.Fatalf("estimate = %+v", est)
+			}
+			actual := *s.Response.Meta.CostUSD
+			if actual < *est.CostMinUSD*0.8 || actual > *est.CostMaxUSD {
+				t.Errorf("cost_usd %g outside estimate [%g, %g]", actual, *est.CostMinUSD, *est.CostMaxUSD)
+			}
+			if local, _ := CountTokens(s.Request.Model, s.Request.Messages); local != est.PromptTokens {
+				t.Errorf("CountTokens = %d, proxy estimated %d", local, est.PromptTokens)
+			}
+		})
+	}
+}
+
+func TestKeyBudgetExceeded(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"type": "budget_error", "code": CodeKeyBudgetExceeded, "status_code": 400,
+				"message": "Estimated cost $0.010000 exceeds the remaining monthly budget $0.005000 of API key 'team-a'",
+				"details": map[string]interface{}{"cost_estimate_usd": 0.01, "api_key_name": "team-a", "key_budget_cap_usd": 5.0, "spent_usd": 4.995},
+			},
+			"meta": map[string]interface{}{"request_id": "req_key", "duration_ms": 1},
+		})
+	})
+	_, err := c.ProxyLLM(context.Background(), llmReq("hi"))
+	if !IsKeyBudgetExceeded(err) || IsBudgetExceeded(err) {
+		t.Fatalf("err = %v, want KEY_BUDGET_EXCEEDED only", err)
+	}
+	if got, ok := AsBudgetExceeded(err); !ok || got.APIKeyName != "team-a" || got.Limit != LimitKeyBudget {
+		t.Errorf("AsBudgetExceeded = %+v, %v", got, ok)
+	}
+}
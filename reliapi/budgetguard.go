@@ -0,0 +1,241 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GuardAppliedTag is the tag WithBudgetGuard adds to the requests it
+// rewrites, so UsageByTag shows how often degradation kicked in. Its value
+// names what was changed: "model", "max_tokens" or "model+max_tokens".
+const GuardAppliedTag = "guard_applied"
+
+// ErrBudgetGuardRejected matches a *BudgetGuardRejectedError with errors.Is.
+var ErrBudgetGuardRejected = errors.New("reliapi: budget_guard_rejected")
+
+// BudgetGuardRejectedError is returned, before anything is sent, for a
+// request WithBudgetGuard rejected: its model's BudgetDowngrade has Reject
+// set and none of its tags is one of BudgetGuardConfig.CriticalTags.
+type BudgetGuardRejectedError struct {
+	// Model is the model the request asked for.
+	Model string
+	// RemainingUSD is the budget the guard last saw left.
+	RemainingUSD float64
+}
+
+func (e *BudgetGuardRejectedError) Error() string {
+	return fmt.Sprintf("%v: model %q with $%.4f of budget left", ErrBudgetGuardRejected, e.Model, e.RemainingUSD)
+}
+
+// Is reports whether target is ErrBudgetGuardRejected.
+func (e *BudgetGuardRejectedError) Is(target error) bool {
+	return target == ErrBudgetGuardRejected
+}
+
+// IsBudgetGuardRejected reports whether err is a request WithBudgetGuard
+// rejected.
+func IsBudgetGuardRejected(err error) bool {
+	return errors.Is(err, ErrBudgetGuardRejected)
+}
+
+// BudgetDowngrade is how WithBudgetGuard rewrites a request for one model
+// while the guard is engaged.
+type BudgetDowngrade struct {
+	// Model replaces the request's model, e.g. a cheaper one; empty keeps
+	// it.
+	Model string
+	// MaxTokens caps the request's MaxTokens, setting it when the request
+	// has none; 0 leaves it.
+	MaxTokens int
+	// Reject fails requests without a critical tag with a
+	// *BudgetGuardRejectedError. Critical ones get Model and MaxTokens.
+	Reject bool
+}
+
+// BudgetGuardConfig configures WithBudgetGuard.
+type BudgetGuardConfig struct {
+	// ThresholdUSD engages the guard once the remaining budget is below it.
+	ThresholdUSD float64
+	// ReleaseUSD disengages the guard once the remaining budget is back at
+	// or above it. Keeping it above ThresholdUSD stops the guard flapping on
+	// and off between consecutive requests near the threshold; one below
+	// ThresholdUSD, as when unset, is ThresholdUSD.
+	ReleaseUSD float64
+	// Downgrades maps a model to how its requests are rewritten while the
+	// guard is engaged; the "" entry is for requests naming no model.
+	// Requests for other models are sent as they are.
+	Downgrades map[string]BudgetDowngrade
+	// PollInterval, when positive, makes the guard call Budget before a
+	// request once it has seen no remaining budget for that long, as when
+	// the proxy doesn't report Meta.BudgetRemainingUSD. One request waits
+	// for the poll; a failed poll leaves the guard as it was.
+	PollInterval time.Duration
+	// CriticalTags exempt requests with any of these tags (the client's
+	// WithTags included) from Reject.
+	CriticalTags map[string]string
+}
+
+// GuardRewrite describes how WithBudgetGuard rewrote a call's request; see
+// Request.Guard.
+type GuardRewrite struct {
+	// FromModel and Model are the model the caller asked for and the one
+	// sent; they are equal when only MaxTokens was capped.
+	FromModel, Model string
+	// MaxTokens is the cap applied to the request's MaxTokens, 0 if none.
+	MaxTokens int
+	// RemainingUSD is the budget the guard last saw left.
+	RemainingUSD float64
+}
+
+// WithBudgetGuard degrades LLM requests as the monthly budget runs out. The
+// guard follows the Meta.BudgetRemainingUSD of every response (and polls
+// Budget under PollInterval); while it is below cfg.ThresholdUSD, the
+// requests of ProxyLLM, ProxyLLMStream, ProxyLLMBatch and SubmitLLM are
+// rewritten by cfg.Downgrades before they are sent or cached. A rewritten
+// request carries GuardAppliedTag, which counts toward MaxTags, and hooks
+// see the rewrite in Request.Guard.
+//
+// The guard goes by what the client's own responses report, so one client
+// should serve one API key and tenant. Until it has seen a remaining budget,
+// it is disengaged.
+func WithBudgetGuard(cfg BudgetGuardConfig) Option {
+	return func(c *Client) {
+		cfg.Downgrades = maps.Clone(cfg.Downgrades)
+		cfg.CriticalTags = maps.Clone(cfg.CriticalTags)
+		cfg.ReleaseUSD = max(cfg.ReleaseUSD, cfg.ThresholdUSD)
+		g := &budgetGuard{cfg: cfg}
+		c.budgetGuard = g
+		c.responseHooks = append(c.responseHooks, func(_ context.Context, _ *Request, resp *ReliAPIResponse, _ error) {
+			if resp != nil && resp.Meta.BudgetRemainingUSD != nil {
+				g.observe(*resp.Meta.BudgetRemainingUSD, c.now())
+			}
+		})
+	}
+}
+
+// budgetGuard is the state of WithBudgetGuard.
+type budgetGuard struct {
+	cfg BudgetGuardConfig
+
+	mu      sync.Mutex
+	engaged bool
+	// remaining is the budget last seen at updated; updated is zero until
+	// one was.
+	remaining float64
+	updated   time.Time
+	polling   bool
+}
+
+// observe records remaining as the budget left at now, engaging the guard
+// below the threshold and disengaging it at the release level.
+func (g *budgetGuard) observe(remaining float64, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.remaining, g.updated = remaining, now
+	if g.engaged {
+		g.engaged = remaining < g.cfg.ReleaseUSD
+	} else {
+		g.engaged = remaining < g.cfg.ThresholdUSD
+	}
+}
+
+// pollBudget refreshes g's remaining budget from Budget once PollInterval
+// has passed without one. Concurrent requests don't wait for a poll
+// already running.
+func (c *Client) pollBudget(ctx context.Context, g *budgetGuard) {
+	if g.cfg.PollInterval <= 0 {
+		return
+	}
+	now := c.now()
+	g.mu.Lock()
+	due := !g.polling && now.Sub(g.updated) >= g.cfg.PollInterval
+	if due {
+		g.polling = true
+	}
+	g.mu.Unlock()
+	if !due {
+		return
+	}
+	status, err := c.Budget(ctx)
+	g.mu.Lock()
+	g.polling = false
+	g.mu.Unlock()
+	if err == nil && status.RemainingUSD != nil {
+		g.observe(*status.RemainingUSD, c.now())
+	} else {
+		// Don't poll again on every request while Budget fails
+		g.mu.Lock()
+		g.updated = now
+		g.mu.Unlock()
+	}
+}
+
+type guardRewriteKey struct{}
+
+// guardRewriteFrom returns the rewrite guardLLM recorded in ctx, nil
+// for none.
+func guardRewriteFrom(ctx context.Context) *GuardRewrite {
+	rw, _ := ctx.Value(guardRewriteKey{}).(*GuardRewrite)
+	return rw
+}
+
+// guardLLM applies the client's WithBudgetGuard to req. The returned ctx
+// records the rewrite, if any, for the call's hooks.
+func (c *Client) guardLLM(ctx context.Context, req LLMRequest) (context.Context, LLMRequest, error) {
+	g := c.budgetGuard
+	if g == nil {
+		return ctx, req, nil
+	}
+	c.pollBudget(ctx, g)
+	g.mu.Lock()
+	engaged, remaining := g.engaged, g.remaining
+	g.mu.Unlock()
+	d, ok := g.cfg.Downgrades[req.Model]
+	if !engaged || !ok {
+		return ctx, req, nil
+	}
+	if d.Reject && !c.criticalRequest(req.Tags) {
+		return ctx, req, &BudgetGuardRejectedError{Model: req.Model, RemainingUSD: remaining}
+	}
+
+	rw := &GuardRewrite{FromModel: req.Model, Model: req.Model, RemainingUSD: remaining}
+	var applied []string
+	if d.Model != "" && d.Model != req.Model {
+		req.Model, rw.Model = d.Model, d.Model
+		applied = append(applied, "model")
+	}
+	if d.MaxTokens > 0 && (req.MaxTokens == nil || *req.MaxTokens > d.MaxTokens) {
+		n := d.MaxTokens
+		req.MaxTokens, rw.MaxTokens = &n, n
+		applied = append(applied, "max_tokens")
+	}
+	if applied == nil {
+		return ctx, req, nil
+	}
+	// A copy: the caller's map must not change
+	tags := make(map[string]string, len(req.Tags)+1)
+	maps.Copy(tags, req.Tags)
+	tags[GuardAppliedTag] = strings.Join(applied, "+")
+	req.Tags = tags
+	return context.WithValue(ctx, guardRewriteKey{}, rw), req, nil
+}
+
+// criticalRequest reports whether tags, over the client's WithTags, hold one
+// of the guard's CriticalTags.
+func (c *Client) criticalRequest(tags map[string]string) bool {
+	for key, value := range c.budgetGuard.cfg.CriticalTags {
+		v, ok := tags[key]
+		if !ok {
+			v, ok = c.tags[key]
+		}
+		if ok && v == value {
+			return true
+		}
+	}
+	return false
+}
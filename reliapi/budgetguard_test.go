@@ -0,0 +1,277 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// guardProxy is an LLM proxy reporting the remaining budget it is set to
+// and recording the requests it got.
+type guardProxy struct {
+	mu        sync.Mutex
+	remaining float64
+	budget    *float64
+	sent      []LLMRequest
+	polls     int
+}
+
+func (p *guardProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r.URL.Path == "/v1/budget" {
+		p.polls++
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"spent_usd": 1.0, "cap_usd": 100.0, "remaining_usd": p.remaining},
+		})
+		return
+	}
+	var req LLMRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	p.sent = append(p.sent, req)
+	meta := map[string]interface{}{"request_id": "req_guard"}
+	if p.budget != nil {
+		meta["budget_remaining_usd"] = *p.budget
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    map[string]interface{}{"content": "ok"},
+		"meta":    meta,
+	})
+}
+
+// report makes the proxy's responses report remaining.
+func (p *guardProxy) report(remaining float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.budget = &remaining
+}
+
+func (p *guardProxy) last() LLMRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sent[len(p.sent)-1]
+}
+
+var guardConfig = BudgetGuardConfig{
+	ThresholdUSD: 10,
+	ReleaseUSD:   15,
+	Downgrades: map[string]BudgetDowngrade{
+		"gpt-4o":      {Model: "gpt-4o-mini", MaxTokens: 256},
+		"gpt-4o-mini": {Reject: true},
+	},
+	CriticalTags: map[string]string{"tier": "critical"},
+}
+
+func guardReq(model string) LLMRequest {
+	r := llmReq("hi")
+	r.Model = model
+	return r
+}
+
+func TestBudgetGuardDowngrades(t *testing.T) {
+	p := &guardProxy{}
+	var seen []*GuardRewrite
+	c := newTestClient(t, p.ServeHTTP, WithBudgetGuard(guardConfig),
+		WithResponseHook(func(_ context.Context, r *Request, _ *ReliAPIResponse, _ error) {
+			seen = append(seen, r.Guard)
+		}))
+
+	// Disengaged until a budget was seen
+	p.report(9)
+	if _, err := c.ProxyLLM(context.Background(), guardReq("gpt-4o")); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.last(); got.Model != "gpt-4o" || got.Tags[GuardAppliedTag] != "" {
+		t.Errorf("first request sent as %q, tags %v", got.Model, got.Tags)
+	}
+
+	req := guardReq("gpt-4o")
+	req.Tags = map[string]string{"team": "search"}
+	if _, err := c.ProxyLLM(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	got := p.last()
+	if got.Model != "gpt-4o-mini" || got.MaxTokens == nil || *got.MaxTokens != 256 {
+		t.Errorf("sent model %q, max_tokens %v", got.Model, got.MaxTokens)
+	}
+	if got.Tags[GuardAppliedTag] != "model+max_tokens" || got.Tags["team"] != "search" {
+		t.Errorf("sent tags %v", got.Tags)
+	}
+	if len(req.Tags) != 1 {
+		t.Errorf("caller's tags changed to %v", req.Tags)
+	}
+	want := GuardRewrite{FromModel: "gpt-4o", Model: "gpt-4o-mini", MaxTokens: 256, RemainingUSD: 9}
+	if seen[0] != nil || seen[1] == nil || *seen[1] != want {
+		t.Errorf("hooks saw %+v", seen)
+	}
+
+	// A smaller MaxTokens is kept
+	req = guardReq("gpt-4o")
+	n := 100
+	req.MaxTokens = &n
+	if _, err := c.ProxyLLM(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.last(); *got.MaxTokens != 100 || got.Tags[GuardAppliedTag] != "model" {
+		t.Errorf("sent max_tokens %d, tags %v", *got.MaxTokens, got.Tags)
+	}
+
+	// Models without a downgrade are sent as they are
+	if _, err := c.ProxyLLM(context.Background(), guardReq("claude-3-5-haiku")); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.last(); got.Model != "claude-3-5-haiku" || got.Tags[GuardAppliedTag] != "" {
+		t.Errorf("sent as %q, tags %v", got.Model, got.Tags)
+	}
+}
+
+func TestBudgetGuardRejectsNonCritical(t *testing.T) {
+	p := &guardProxy{}
+	c := newTestClient(t, p.ServeHTTP, WithBudgetGuard(guardConfig))
+	p.report(2.5)
+	if _, err := c.ProxyLLM(context.Background(), guardReq("gpt-4o")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := c.ProxyLLM(context.Background(), guardReq("gpt-4o-mini"))
+	var rejected *BudgetGuardRejectedError
+	if !errors.As(err, &rejected) || !IsBudgetGuardRejected(err) {
+		t.Fatalf("err = %v", err)
+	}
+	if rejected.Model != "gpt-4o-mini" || rejected.RemainingUSD != 2.5 {
+		t.Errorf("rejection = %+v", rejected)
+	}
+	if _, err := c.ProxyLLMStream(context.Background(), guardReq("gpt-4o-mini")); !IsBudgetGuardRejected(err) {
+		t.Errorf("stream err = %v", err)
+	}
+	if _, err := c.SubmitLLM(context.Background(), guardReq("gpt-4o-mini")); !IsBudgetGuardRejected(err) {
+		t.Errorf("submit err = %v", err)
+	}
+	if len(p.sent) != 1 {
+		t.Errorf("%d requests sent", len(p.sent))
+	}
+
+	critical := guardReq("gpt-4o-mini")
+	critical.Tags = map[string]string{"tier": "critical"}
+	if _, err := c.ProxyLLM(context.Background(), critical); err != nil {
+		t.Errorf("critical request: %v", err)
+	}
+	// By the client's tags too
+	c.tags = map[string]string{"tier": "critical"}
+	if _, err := c.ProxyLLM(context.Background(), guardReq("gpt-4o-mini")); err != nil {
+		t.Errorf("request of a critical client: %v", err)
+	}
+}
+
+func TestBudgetGuardHysteresis(t *testing.T) {
+	p := &guardProxy{}
+	c := newTestClient(t, p.ServeHTTP, WithBudgetGuard(guardConfig))
+
+	// Each step reports a remaining budget, then checks the next request
+	for i, step := range []struct {
+		remaining  float64
+		downgraded bool
+	}{
+		{20, false},
+		{10, false}, // at the threshold
+		{9.99, true},
+		{10.01, true}, // back over the threshold isn't enough
+		{9.8, true},
+		{14.99, true},
+		{15, false}, // the release level
+		{12, false}, // between the two, stays off
+		{10.5, false},
+		{9, true},
+	} {
+		p.report(step.remaining)
+		if _, err := c.ProxyLLM(context.Background(), guardReq("gpt-4o")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.ProxyLLM(context.Background(), guardReq("gpt-4o")); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.last().Model == "gpt-4o-mini"; got != step.downgraded {
+			t.Errorf("step %d: at $%v downgraded = %v", i, step.remaining, got)
+		}
+	}
+}
+
+func TestBudgetGuardWithoutRelease(t *testing.T) {
+	p := &guardProxy{}
+	cfg := guardConfig
+	cfg.ReleaseUSD = 0
+	c := newTestClient(t, p.ServeHTTP, WithBudgetGuard(cfg))
+	for _, remaining := range []float64{9, 10} {
+		p.report(remaining)
+		if _, err := c.ProxyLLM(context.Background(), guardReq("gpt-4o")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.ProxyLLM(context.Background(), guardReq("gpt-4o")); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.last().Model; got != "gpt-4o" {
+		t.Errorf("sent %q at the threshold", got)
+	}
+}
+
+func TestBudgetGuardPolls(t *testing.T) {
+	p := &guardProxy{remaining: 3}
+	cfg := guardConfig
+	cfg.PollInterval = time.Minute
+	c := newTestClient(t, p.ServeHTTP, WithBudgetGuard(cfg))
+	now := time.Unix(1792000000, 0)
+	c.now = func() time.Time { return now }
+
+	send := func() LLMRequest {
+		t.Helper()
+		if _, err := c.ProxyLLM(context.Background(), guardReq("gpt-4o")); err != nil {
+			t.Fatal(err)
+		}
+		return p.last()
+	}
+	if got := send(); got.Model != "gpt-4o-mini" || p.polls != 1 {
+		t.Errorf("sent %q after %d polls", got.Model, p.polls)
+	}
+	p.remaining = 50
+	now = now.Add(30 * time.Second)
+	if got := send(); got.Model != "gpt-4o-mini" || p.polls != 1 {
+		t.Errorf("sent %q after %d polls within the interval", got.Model, p.polls)
+	}
+	now = now.Add(30 * time.Second)
+	if got := send(); got.Model != "gpt-4o" || p.polls != 2 {
+		t.Errorf("sent %q after %d polls", got.Model, p.polls)
+	}
+
+	// Responses reporting the budget make polls unneeded
+	p.report(50)
+	send()
+	now = now.Add(59 * time.Second)
+	send()
+	if p.polls != 2 {
+		t.Errorf("%d polls", p.polls)
+	}
+}
+
+func TestBudgetGuardBatchItems(t *testing.T) {
+	var seen []*GuardRewrite
+	c := newTestClient(t, (&guardProxy{}).ServeHTTP, WithBudgetGuard(guardConfig),
+		WithRequestHook(func(_ context.Context, r *Request) {
+			seen = append(seen, r.Guard)
+		}))
+	c.budgetGuard.observe(1, time.Now())
+
+	reqs := []LLMRequest{guardReq("gpt-4o"), guardReq("claude-3-5-haiku"), guardReq("gpt-4o-mini")}
+	if _, err := c.ProxyLLMBatch(context.Background(), reqs, BatchOptions{}); !IsBudgetGuardRejected(err) {
+		t.Fatalf("err = %v", err)
+	}
+	if len(seen) != 2 || seen[0] == nil || seen[0].Model != "gpt-4o-mini" || seen[1] != nil {
+		t.Errorf("hooks saw %+v", seen)
+	}
+}
@@ -0,0 +1,213 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CacheRef identifies one cached response. Set exactly one field: Key is
+// a Meta.CacheKey from an earlier response, or the CanonicalCacheKey of an
+// LLM request; HTTP and LLM are the original request, from which the proxy
+// derives the key the same way it did when caching.
+type CacheRef struct {
+	Key  string
+	HTTP *HTTPRequest
+	LLM  *LLMRequest
+}
+
+type cacheInvalidateRequest struct {
+	CacheKey string       `json:"cache_key,omitempty"`
+	HTTP     *HTTPRequest `json:"http,omitempty"`
+	LLM      *LLMRequest  `json:"llm,omitempty"`
+}
+
+type cacheInvalidateResult struct {
+	Removed int `json:"removed"`
+}
+
+// InvalidateCache removes the cached response identified by ref. Only
+// entries of the caller's tenant are affected. Removing an entry that is
+// not cached is not an error.
+func (c *Client) InvalidateCache(ctx context.Context, ref CacheRef) error {
+	set := 0
+	for _, ok := range []bool{ref.Key != "", ref.HTTP != nil, ref.LLM != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("reliapi: CacheRef must set exactly one of Key, HTTP and LLM")
+	}
+	if ref.LLM != nil {
+		req, err := withPromptMessages(*ref.LLM)
+		if err != nil {
+			return err
+		}
+		// Entries are keyed by the redacted prompt
+		req, _ = c.redact(req)
+		ref.LLM = &req
+	}
+	body := cacheInvalidateRequest{CacheKey: ref.Key, HTTP: ref.HTTP, LLM: ref.LLM}
+	_, err := c.deleteJSON(ctx, cachePath, body)
+	return err
+}
+
+// InvalidateTarget purges every cached response of target, across all
+// tenants, and returns how many entries were removed. It requires the
+// proxy's admin key (RELIAPI_ADMIN_KEY); other keys get a 403 *APIError
+// with CodeForbidden.
+func (c *Client) InvalidateTarget(ctx context.Context, target string) (int, error) {
+	if target == "" {
+		return 0, errors.New("reliapi: target is required")
+	}
+	if err := c.requireFeature(FeatureTargetPurge); err != nil {
+		return 0, err
+	}
+	n, err := c.deleteJSON(ctx, cachePath+"/targets/"+url.PathEscape(target), nil)
+	if err != nil {
+		return 0, c.routeError(ctx, FeatureTargetPurge, err)
+	}
+	return n, nil
+}
+
+// deleteJSON sends a DELETE to path and returns the removed count from the
+// response data. Deletes are idempotent, so they may be retried.
+func (c *Client) deleteJSON(ctx context.Context, path string, body interface{}) (int, error) {
+	resp, raw, err := c.do(ctx, http.MethodDelete, path, body, true)
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Success bool                  `json:"success"`
+		Data    cacheInvalidateResult `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return 0, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return 0, newAPIError(resp, raw)
+	}
+	return out.Data.Removed, nil
+}
+
+// Cache tiers, the keys of CacheStats.Tiers. Responses up to the hot
+// tier's MaxEntryBytes are cached there, larger ones in the large tier if
+// the proxy has one (cache_storage.large), and are otherwise not cached.
+const (
+	CacheTierHot   = "hot"
+	CacheTierLarge = "large"
+)
+
+// Causes of cache evictions, the keys of CacheStats.Evictions and
+// CacheTierStats.Evictions.
+const (
+	EvictedMaxEntries       = "max_entries"
+	EvictedMaxBytes         = "max_bytes"
+	EvictedTargetMaxEntries = "target_max_entries"
+	EvictedExpired          = "expired"
+)
+
+// RejectedTooLarge is the CacheStats.Rejected count of responses no cache
+// tier admitted.
+const RejectedTooLarge = "too_large"
+
+// CacheStats reports the proxy's cache by tier.
+type CacheStats struct {
+	// Enabled is false when the proxy runs without its Redis cache.
+	Enabled bool                      `json:"enabled"`
+	Tiers   map[string]CacheTierStats `json:"tiers"`
+	// Evictions totals the tiers' evictions by cause.
+	Evictions map[string]int64 `json:"evictions"`
+	// Rejected counts responses that were not cached, by reason.
+	Rejected map[string]int64 `json:"rejected"`
+}
+
+// CacheTierStats is one cache tier: its contents, its bounds (nil is
+// unbounded), and the entries admitted and evicted from it.
+type CacheTierStats struct {
+	Entries       int64            `json:"entries"`
+	Bytes         int64            `json:"bytes"`
+	Admitted      int64            `json:"admitted"`
+	MaxEntryBytes *int64           `json:"max_entry_bytes"`
+	MaxEntries    *int64           `json:"max_entries"`
+	MaxBytes      *int64           `json:"max_bytes"`
+	Evictions     map[string]int64 `json:"evictions"`
+}
+
+// CacheStats returns the entries, bytes and evictions of each cache tier,
+// across tenants and the proxy instances sharing its Redis. It requires
+// the proxy's admin key (RELIAPI_ADMIN_KEY); other keys get a 403
+// *APIError with CodeForbidden.
+func (c *Client) CacheStats(ctx context.Context) (*CacheStats, error) {
+	resp, raw, err := c.do(ctx, http.MethodGet, cachePath+"/stats", nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool       `json:"success"`
+		Data    CacheStats `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return &out.Data, nil
+}
+
+// Hot-key kinds, HotKey.Kind.
+const (
+	HotKeyHTTP = "http"
+	HotKeyLLM  = "llm"
+)
+
+// hotKeysMax is the most entries the proxy lists, and counts uses of, per
+// tenant.
+const hotKeysMax = 1000
+
+// HotKey is a cache entry HotKeys lists.
+type HotKey struct {
+	CacheKey string `json:"cache_key"`
+	// Kind is HotKeyHTTP or HotKeyLLM, and Request the HTTPRequest or
+	// LLMRequest the entry answers, as the proxy received it.
+	Kind    string          `json:"kind"`
+	Request json.RawMessage `json:"request"`
+	// Uses counts the responses served or stored under the key.
+	Uses int64 `json:"uses"`
+	// SizeBytes is the entry's size in the proxy's cache, nil if unknown.
+	SizeBytes *int64 `json:"size_bytes"`
+}
+
+// HotKeys returns up to limit (at most 1000) of the proxy's most used
+// cache entries for the caller's tenant, most used first. Resending an
+// entry's Request with CacheOnlyIfCached fetches it without calling the
+// upstream, which is what WithCacheBackfill does. The proxy counts uses of
+// its 1000 most used keys per tenant.
+func (c *Client) HotKeys(ctx context.Context, limit int) ([]HotKey, error) {
+	if limit <= 0 || limit > hotKeysMax {
+		return nil, fmt.Errorf("reliapi: hot keys limit must be in [1, %d], got %d", hotKeysMax, limit)
+	}
+	resp, raw, err := c.do(ctx, http.MethodGet, cachePath+"/hot?limit="+strconv.Itoa(limit), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Items []HotKey `json:"items"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return out.Data.Items, nil
+}
@@ -0,0 +1,159 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestInvalidateCache(t *testing.T) {
+	var got []map[string]interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/v1/cache" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		got = append(got, body)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"removed": 1, "cache_key": "abc"},
+			"meta":    map[string]interface{}{"request_id": "req_cache", "duration_ms": 1},
+		})
+	})
+
+	ctx := context.Background()
+	if err := c.InvalidateCache(ctx, CacheRef{Key: "abc"}); err != nil {
+		t.Fatalf("InvalidateCache(Key): %v", err)
+	}
+	req := llmReq("hello")
+	if err := c.InvalidateCache(ctx, CacheRef{LLM: &req}); err != nil {
+		t.Fatalf("InvalidateCache(LLM): %v", err)
+	}
+	if len(got) != 2 || got[0]["cache_key"] != "abc" || got[0]["llm"] != nil {
+		t.Fatalf("bodies = %v", got)
+	}
+	if llm, _ := got[1]["llm"].(map[string]interface{}); llm["target"] != "openai" || got[1]["cache_key"] != nil {
+		t.Errorf("llm body = %v", got[1])
+	}
+
+	if err := c.InvalidateCache(ctx, CacheRef{Key: "abc", LLM: &req}); err == nil {
+		t.Error("expected an error for an ambiguous CacheRef")
+	}
+	if len(got) != 2 {
+		t.Error("ambiguous CacheRef reached the proxy")
+	}
+}
+
+func TestInvalidateTarget(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.EscapedPath() != "/v1/cache/targets/json%20placeholder" {
+			t.Errorf("%s %s", r.Method, r.URL.EscapedPath())
+		}
+		if body, _ := io.ReadAll(r.Body); len(body) != 0 || r.ContentLength > 0 {
+			t.Errorf("body = %q, want none", body)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			t.Errorf("Content-Type = %q, want none", ct)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"removed": 42},
+			"meta":    map[string]interface{}{"request_id": "req_purge", "duration_ms": 3},
+		})
+	})
+	removed, err := c.InvalidateTarget(context.Background(), "json placeholder")
+	if err != nil || removed != 42 {
+		t.Fatalf("InvalidateTarget = %d, %v", removed, err)
+	}
+}
+
+func TestInvalidateTargetForbidden(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"detail": map[string]interface{}{
+				"success": false,
+				"error": map[string]interface{}{
+					"type": "client_error", "code": "FORBIDDEN", "message": "Admin API key required", "retryable": false,
+				},
+			},
+		})
+	})
+	_, err := c.InvalidateTarget(context.Background(), "jsonplaceholder")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Code != CodeForbidden {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/cache/stats" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"enabled": true,
+				"tiers": map[string]interface{}{
+					"hot": map[string]interface{}{
+						"entries": 3, "bytes": 900, "admitted": 4, "max_entry_bytes": 1024,
+						"max_entries": 3, "max_bytes": nil, "evictions": map[string]interface{}{"max_entries": 1},
+					},
+				},
+				"evictions": map[string]interface{}{"max_entries": 1, "expired": 0},
+				"rejected":  map[string]interface{}{"too_large": 2},
+			},
+			"meta": map[string]interface{}{"request_id": "req_stats", "duration_ms": 1},
+		})
+	})
+	stats, err := c.CacheStats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot := stats.Tiers[CacheTierHot]
+	if !stats.Enabled || hot.Entries != 3 || hot.MaxEntryBytes == nil || *hot.MaxEntryBytes != 1024 || hot.MaxBytes != nil {
+		t.Errorf("stats = %+v", stats)
+	}
+	if hot.Evictions[EvictedMaxEntries] != 1 || stats.Rejected[RejectedTooLarge] != 2 {
+		t.Errorf("evictions = %v, rejected = %v", hot.Evictions, stats.Rejected)
+	}
+}
+
+func TestProxyLLMSemanticCache(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var sent struct {
+			CacheSemantic map[string]interface{} `json:"cache_semantic"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		if sent.CacheSemantic["threshold"] != 0.92 || sent.CacheSemantic["embedding_model"] != "text-embedding-3-small" {
+			t.Errorf("cache_semantic = %v", sent.CacheSemantic)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "Paris."},
+			"meta": map[string]interface{}{
+				"cache_hit": true, "cache_key": "abc", "semantic_cache_hit": true, "semantic_similarity": 0.97,
+			},
+		})
+	})
+
+	req := llmReq("What's the capital of France?")
+	req.CacheSemantic = &SemanticCacheConfig{Threshold: 0.92, EmbeddingModel: "text-embedding-3-small"}
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Meta.CacheHit || !resp.Meta.SemanticCacheHit || resp.Meta.SemanticSimilarity != 0.97 || resp.Meta.CacheKey != "abc" {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+}
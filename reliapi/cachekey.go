@@ -0,0 +1,260 @@
+package reliapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUnpredictableCacheKey is returned by CanonicalCacheKey for a request
+// whose cache key depends on proxy state: a Template, rendered by the
+// proxy, or no Model, when the target's default model is keyed.
+var ErrUnpredictableCacheKey = errors.New("reliapi: cache key depends on the proxy's configuration")
+
+// CanonicalCacheKey returns the key the proxy caches req's response under,
+// the Meta.CacheKey of its response, e.g. to InvalidateCache by key.
+//
+// The key hashes the fields of req that reach the upstream call (Target,
+// Model, Messages, sampling parameters, Tools and, with ValidateOutput,
+// OutputSchema, with FilterBeforeCache, ResponseFilter, and RawPassthrough), serialized canonically: object keys sorted, nulls
+// dropped, numbers in one form, so 1 and 1.0 or reordered fields share a
+// key. IdempotencyKey, Cache, TimeoutMs and other fields that don't change
+// the upstream call are not part of it. CacheKey and CacheVary are honored
+// as by the proxy. Some rewrites of the proxy can't be predicted: a
+// model alias, context trimming or redaction of the prompt configured on
+// the target, and fallback targets, give a response another key.
+func CanonicalCacheKey(req LLMRequest) (string, error) {
+	req, err := withPromptMessages(req)
+	if err != nil {
+		return "", err
+	}
+	if req.Template != nil || req.Model == "" {
+		return "", ErrUnpredictableCacheKey
+	}
+	return canonicalLLMKey(req, true)
+}
+
+// canonicalLLMKey hashes req, whose Prompt was resolved, as
+// CanonicalCacheKey does. Without cacheScope it hashes the request itself,
+// Template included, instead of the CacheKey or CacheVary given.
+func canonicalLLMKey(req LLMRequest, cacheScope bool) (string, error) {
+	doc := map[string]interface{}{"target": req.Target, "model": req.Model}
+	if req.Template != nil {
+		doc["template"] = req.Template
+	}
+	if len(req.Tools) > 0 {
+		doc["tools"] = req.Tools
+	}
+	if req.ToolChoice != nil {
+		doc["tool_choice"] = req.ToolChoice
+	}
+	if req.ResponseFormat != nil {
+		doc["response_format"] = req.ResponseFormat
+	}
+	if req.ValidateOutput && len(req.OutputSchema) > 0 {
+		doc["output_schema"] = req.OutputSchema
+	}
+	if req.FilterBeforeCache && req.ResponseFilter != nil {
+		doc["response_filter"] = *req.ResponseFilter
+	}
+	if req.RawPassthrough {
+		doc["raw_passthrough"] = true
+	}
+	fields := map[string]interface{}{"messages": cacheMessages(req.Messages)}
+	if req.MaxTokens != nil {
+		fields["max_tokens"] = *req.MaxTokens
+	}
+	if req.Temperature != nil {
+		fields["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		fields["top_p"] = *req.TopP
+	}
+	if len(req.Stop) > 0 {
+		fields["stop"] = req.Stop
+	}
+	switch {
+	case !cacheScope:
+		for name, v := range fields {
+			doc[name] = v
+		}
+	case req.CacheKey != nil:
+		doc["cache_key"] = *req.CacheKey
+	case len(req.CacheVary) > 0:
+		vary := sortedUnique(req.CacheVary)
+		doc["cache_vary"] = vary
+		for _, name := range vary {
+			if v, ok := fields[name]; ok {
+				doc[name] = v
+			}
+		}
+	default:
+		for name, v := range fields {
+			doc[name] = v
+		}
+	}
+
+	// Round-trip through JSON so the document is hashed as sent
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("reliapi: encode cache key: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return "", fmt.Errorf("reliapi: encode cache key: %w", err)
+	}
+	var b strings.Builder
+	b.WriteString("llm\n")
+	if err := writeCanonical(&b, value); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func sortedUnique(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// writeCanonical writes v, decoded with UseNumber, the way the proxy
+// serializes cache documents (core/cache_key.py canonical_json).
+func writeCanonical(b *strings.Builder, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		n, err := canonicalNumber(v)
+		if err != nil {
+			return err
+		}
+		b.WriteString(n)
+	case string:
+		writeCanonicalString(b, v)
+	case []interface{}:
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonical(b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k, item := range v {
+			if item != nil {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeCanonicalString(b, k)
+			b.WriteByte(':')
+			if err := writeCanonical(b, v[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return fmt.Errorf("reliapi: encode cache key: unexpected %T", v)
+	}
+	return nil
+}
+
+// canonicalNumber writes integers as they are and other numbers like
+// Python's repr: integral values below 1e16 without a fraction, the rest
+// in their shortest form, with an exponent outside [1e-4, 1e16).
+func canonicalNumber(n json.Number) (string, error) {
+	s := n.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if s == "-0" {
+			return "0", nil
+		}
+		return s, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", fmt.Errorf("reliapi: encode cache key: number %s: %w", s, err)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1e16 {
+		return strconv.FormatFloat(f, 'f', 0, 64), nil
+	}
+	e := strconv.FormatFloat(f, 'e', -1, 64)
+	exp, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:])
+	if exp >= -4 && exp < 16 {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+	return e, nil
+}
+
+// writeCanonicalString writes s as Python's json.dumps does: ASCII only,
+// with \uXXXX escapes (surrogate pairs above U+FFFF).
+func writeCanonicalString(b *strings.Builder, s string) {
+	const hexDigits = "0123456789abcdef"
+	escape := func(r rune) {
+		b.WriteString(`\u`)
+		for shift := 12; shift >= 0; shift -= 4 {
+			b.WriteByte(hexDigits[(r>>uint(shift))&0xf])
+		}
+	}
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			switch {
+			case r >= 0x20 && r <= 0x7e:
+				b.WriteRune(r)
+			case r > 0xffff:
+				r -= 0x10000
+				escape(0xd800 + (r>>10)&0x3ff)
+				escape(0xdc00 + r&0x3ff)
+			default:
+				escape(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
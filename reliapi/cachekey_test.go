@@ -0,0 +1,97 @@
+package reliapi
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCanonicalCacheKey(t *testing.T) {
+	maxTokens, temperature, topP, idem, ttl := 64, 1.0, 0.0001, "idem-1", 60
+	req := LLMRequest{
+		Target: "openai",
+		Model:  "gpt-4o-mini",
+		Messages: []ChatMessage{
+			{Role: "system", Content: "Be brief."},
+			UserMessage("Capital of France? é \U0001F600"),
+		},
+		MaxTokens:   &maxTokens,
+		Temperature: &temperature,
+		TopP:        &topP,
+		Stop:        []string{"\n"},
+	}
+	// Computed by the proxy's core/cache_key.py for the same request
+	const want = "ecf924a2b39ba69c0989dce316e3d70f8491443e51bd232183afce2df0f6e574"
+	got, err := CanonicalCacheKey(req)
+	if err != nil || got != want {
+		t.Fatalf("CanonicalCacheKey = %q, %v; want %q", got, err, want)
+	}
+
+	// Fields that don't reach the upstream call don't change the key
+	same := req
+	same.IdempotencyKey, same.Cache, same.TimeoutMs = &idem, &ttl, &ttl
+	same.Priority = PriorityBatch
+	if got, _ := CanonicalCacheKey(same); got != want {
+		t.Errorf("key with idempotency key and cache TTL = %q", got)
+	}
+
+	tiny := 0.00001
+	vary := req
+	vary.Temperature, vary.MaxTokens = &tiny, nil
+	vary.CacheVary = []string{"messages", "temperature", "messages"}
+	const wantVary = "5e218da50e285c15b654cf0134d2bb4f15a7c6bc90eec597e554bc4bcc765710"
+	if got, _ := CanonicalCacheKey(vary); got != wantVary {
+		t.Errorf("cache_vary key = %q, want %q", got, wantVary)
+	}
+
+	// The schema of a structured output is part of the key
+	keys := map[string]bool{}
+	for _, schema := range []string{`{"type":"object"}`, `{"type":"array"}`} {
+		structured := req
+		structured.ResponseFormat = &ResponseFormat{Type: "json_schema", JSONSchema: &JSONSchemaFormat{
+			Name: "answer", Schema: json.RawMessage(schema),
+		}}
+		key, _ := CanonicalCacheKey(structured)
+		keys[key] = true
+	}
+	if len(keys) != 2 || keys[want] {
+		t.Errorf("json_schema keys = %v", keys)
+	}
+
+	raw := req
+	raw.RawPassthrough = true
+	const wantRaw = "bd485e9ec78f3ef60b8c5afd7435043a9d126b183e51fb44289f3b9b330d6518"
+	if got, _ := CanonicalCacheKey(raw); got != wantRaw {
+		t.Errorf("raw_passthrough key = %q, want %q", got, wantRaw)
+	}
+
+	for _, bad := range []LLMRequest{
+		{Target: "openai", Messages: req.Messages},
+		{Target: "openai", Model: "gpt-4o-mini", Template: &TemplateRef{Name: "greeting", Version: 1}},
+	} {
+		if _, err := CanonicalCacheKey(bad); !errors.Is(err, ErrUnpredictableCacheKey) {
+			t.Errorf("CanonicalCacheKey(%+v) error = %v", bad, err)
+		}
+	}
+}
+
+func TestCanonicalNumber(t *testing.T) {
+	for in, want := range map[string]string{
+		"64":                     "64",
+		"-0":                     "0",
+		"1.0":                    "1",
+		"1e2":                    "100",
+		"-0.0":                   "0",
+		"2.5":                    "2.5",
+		"0.0001":                 "0.0001",
+		"0.000015":               "1.5e-05",
+		"1e16":                   "1e+16",
+		"123456789012345.6":      "123456789012345.6",
+		"12345678901234567890.0": "1.2345678901234567e+19",
+	} {
+		got, err := canonicalNumber(json.Number(in))
+		if err != nil || got != want {
+			t.Errorf("canonicalNumber(%s) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package reliapi
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrDropCallback, returned or wrapped by the handler of NewCallbackHandler,
+// answers the callback 422 so the proxy gives it up instead of retrying it,
+// for results that no redelivery would help with.
+var ErrDropCallback = errors.New("reliapi: drop callback")
+
+// NonceStore remembers the nonces of the callbacks a NewCallbackHandler has
+// handled, so a replayed delivery isn't handled twice. Share one store, such
+// as the Redis one of package redisnonce, between the replicas behind a
+// callback URL. Implementations must be safe for concurrent use.
+type NonceStore interface {
+	// Claim records nonce for ttl and reports whether it was new; false
+	// means it is recorded already.
+	Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+	// Release forgets a claimed nonce, so its redelivery is handled again.
+	Release(ctx context.Context, nonce string) error
+}
+
+// CallbackOptions configures NewCallbackHandler. The zero value verifies
+// with DefaultWebhookTolerance and keeps nonces in memory.
+type CallbackOptions struct {
+	// Tolerance is how far a callback's signature timestamp may be from the
+	// current time; DefaultWebhookTolerance when zero.
+	Tolerance time.Duration
+	// Nonces remembers the callbacks handled, for twice Tolerance: a
+	// replay outside it fails verification anyway. It is a
+	// NewMemoryNonceStore of the handler's own when nil.
+	Nonces NonceStore
+}
+
+// NewCallbackHandler returns an http.Handler for the CallbackURL of jobs
+// submitted with SubmitLLM. It verifies each job.completed callback like
+// VerifyWebhook, claims its event ID in opts.Nonces, and passes the result
+// to handler with the request's context, decoded as JobResult decodes it.
+//
+// Its answers steer the proxy's redelivery, which retries 429 and 5xx and
+// drops any other 4xx:
+//
+//   - 204 when handler returns nil, for a redelivery of a callback already
+//     handled, which doesn't call handler again, and for other events;
+//   - 400 for callbacks that fail verification, as a forged or replayed
+//     one does;
+//   - 422 when handler returns ErrDropCallback;
+//   - 500 when handler returns any other error. The nonce is released, so
+//     the retry is handled;
+//   - 503 when opts.Nonces fails.
+//
+// The proxy gives a delivery 10 seconds; a retry that arrives while the
+// first is still being handled is taken for a redelivery.
+func NewCallbackHandler(secret string, handler func(ctx context.Context, job *JobCompletedEvent) error, opts CallbackOptions) http.Handler {
+	tolerance := opts.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultWebhookTolerance
+	}
+	nonces := opts.Nonces
+	if nonces == nil {
+		nonces = NewMemoryNonceStore()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := readWebhook(w, r)
+		if !ok {
+			return
+		}
+		ev, err := VerifyWebhook(payload, r.Header, secret, WithWebhookTolerance(tolerance))
+		switch {
+		case errors.Is(err, ErrUnknownWebhookEvent):
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case ev.JobCompleted == nil:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case ev.ID == "":
+			http.Error(w, "callback without an id", http.StatusBadRequest)
+			return
+		}
+
+		claimed, err := nonces.Claim(r.Context(), ev.ID, 2*tolerance)
+		if err != nil {
+			http.Error(w, "nonce store unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if !claimed {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err := handler(r.Context(), ev.JobCompleted); err != nil {
+			if errors.Is(err, ErrDropCallback) {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			// Even if the proxy hung up, its retry is to be handled
+			_ = nonces.Release(context.WithoutCancel(r.Context()), ev.ID)
+			http.Error(w, "callback handler failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// readWebhook reads the body of a delivery, answering the request itself
+// if it is not a POST or can't be read.
+func readWebhook(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "unreadable body", http.StatusBadRequest)
+		return nil, false
+	}
+	return payload, true
+}
+
+// MemoryNonceStore is a NonceStore in the memory of one process, the
+// default of NewCallbackHandler.
+type MemoryNonceStore struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	queue   nonceQueue
+	now     func() time.Time
+}
+
+// NewMemoryNonceStore returns an empty MemoryNonceStore.
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{expires: make(map[string]time.Time), now: time.Now}
+}
+
+// Claim implements NonceStore.
+func (s *MemoryNonceStore) Claim(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.expire(now)
+	if _, ok := s.expires[nonce]; ok {
+		return false, nil
+	}
+	at := now.Add(ttl)
+	s.expires[nonce] = at
+	heap.Push(&s.queue, nonceExpiry{nonce: nonce, at: at})
+	return true, nil
+}
+
+// Release implements NonceStore.
+func (s *MemoryNonceStore) Release(_ context.Context, nonce string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Its queue entry goes when it's due
+	delete(s.expires, nonce)
+	return nil
+}
+
+// expire forgets the nonces due by now.
+func (s *MemoryNonceStore) expire(now time.Time) {
+	for len(s.queue) > 0 && !s.queue[0].at.After(now) {
+		e := heap.Pop(&s.queue).(nonceExpiry)
+		// Unless it was released and claimed again since
+		if at, ok := s.expires[e.nonce]; ok && at.Equal(e.at) {
+			delete(s.expires, e.nonce)
+		}
+	}
+}
+
+type nonceExpiry struct {
+	nonce string
+	at    time.Time
+}
+
+// nonceQueue is a heap of nonce expiries, the soonest first.
+type nonceQueue []nonceExpiry
+
+func (q nonceQueue) Len() int            { return len(q) }
+func (q nonceQueue) Less(i, j int) bool  { return q[i].at.Before(q[j].at) }
+func (q nonceQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nonceQueue) Push(x interface{}) { *q = append(*q, x.(nonceExpiry)) }
+func (q *nonceQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
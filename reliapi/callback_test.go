@@ -0,0 +1,219 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func callbackPayload(id string, job JobID) []byte {
+	return []byte(fmt.Sprintf(`{"id": %q, "type": "job.completed", "created_at": 1700000000, "data": {"job_id": %q, "status": "succeeded",
+		"result": {"success": true, "data": {"content": "Done.", "finish_reason": "stop"}, "meta": {"request_id": "req_1"}}}}`, id, job))
+}
+
+type callbackRecorder struct {
+	h    http.Handler
+	jobs []*JobCompletedEvent
+	errs []error // what the handler returns, in turn
+}
+
+func newCallbackRecorder(opts CallbackOptions) *callbackRecorder {
+	c := &callbackRecorder{}
+	c.h = NewCallbackHandler(webhookSecret, func(ctx context.Context, job *JobCompletedEvent) error {
+		c.jobs = append(c.jobs, job)
+		if len(c.errs) == 0 {
+			return nil
+		}
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}, opts)
+	return c
+}
+
+func (c *callbackRecorder) deliver(payload []byte, header http.Header) int {
+	req := httptest.NewRequest(http.MethodPost, "/callbacks/reliapi", strings.NewReader(string(payload)))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	c.h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestCallbackHandler(t *testing.T) {
+	c := newCallbackRecorder(CallbackOptions{})
+	payload := callbackPayload("evt_1", "job_1")
+	if code := c.deliver(payload, signedHeader(payload, webhookSecret, time.Now())); code != http.StatusNoContent || len(c.jobs) != 1 {
+		t.Fatalf("callback: status %d, %d jobs", code, len(c.jobs))
+	}
+	job := c.jobs[0]
+	if text, _ := job.Response.CompletionText(); job.JobID != "job_1" || job.Err != nil || text != "Done." {
+		t.Errorf("job = %+v, content %q", job, text)
+	}
+
+	// Methods other than POST, and other events, don't reach the handler
+	req := httptest.NewRequest(http.MethodGet, "/callbacks/reliapi", nil)
+	rec := httptest.NewRecorder()
+	c.h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d", rec.Code)
+	}
+	other := webhookPayload(EventCircuitOpened, `{"target": "openai"}`)
+	if code := c.deliver(other, signedHeader(other, webhookSecret, time.Now())); code != http.StatusNoContent || len(c.jobs) != 1 {
+		t.Errorf("circuit.opened: status %d, %d jobs", code, len(c.jobs))
+	}
+}
+
+func TestCallbackHandlerBadSignature(t *testing.T) {
+	c := newCallbackRecorder(CallbackOptions{})
+	payload := callbackPayload("evt_1", "job_1")
+	for name, header := range map[string]http.Header{
+		"missing":    {},
+		"malformed":  signatureHeader("v1=zz"),
+		"wrong key":  signedHeader(payload, "whsec_other", time.Now()),
+		"other body": signedHeader(callbackPayload("evt_1", "job_2"), webhookSecret, time.Now()),
+	} {
+		if code := c.deliver(payload, header); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", name, code)
+		}
+	}
+	if len(c.jobs) != 0 {
+		t.Errorf("%d jobs handled", len(c.jobs))
+	}
+	// Rejected callbacks don't claim their nonces
+	if code := c.deliver(payload, signedHeader(payload, webhookSecret, time.Now())); code != http.StatusNoContent || len(c.jobs) != 1 {
+		t.Errorf("valid callback: status %d, %d jobs", code, len(c.jobs))
+	}
+}
+
+func TestCallbackHandlerStaleTimestamp(t *testing.T) {
+	c := newCallbackRecorder(CallbackOptions{Tolerance: time.Minute})
+	payload := callbackPayload("evt_1", "job_1")
+	for _, at := range []time.Time{time.Now().Add(-2 * time.Minute), time.Now().Add(2 * time.Minute)} {
+		if code := c.deliver(payload, signedHeader(payload, webhookSecret, at)); code != http.StatusBadRequest {
+			t.Errorf("signed at %v: status %d", at, code)
+		}
+	}
+	if code := c.deliver(payload, signedHeader(payload, webhookSecret, time.Now().Add(-30*time.Second))); code != http.StatusNoContent {
+		t.Errorf("within the tolerance: status %d", code)
+	}
+	if len(c.jobs) != 1 {
+		t.Errorf("%d jobs handled", len(c.jobs))
+	}
+}
+
+func TestCallbackHandlerDuplicateNonce(t *testing.T) {
+	nonces := NewMemoryNonceStore()
+	c := newCallbackRecorder(CallbackOptions{Nonces: nonces})
+	// Replicas behind the URL share the store
+	replica := newCallbackRecorder(CallbackOptions{Nonces: nonces})
+	payload := callbackPayload("evt_1", "job_1")
+	header := signedHeader(payload, webhookSecret, time.Now())
+	if code := c.deliver(payload, header); code != http.StatusNoContent {
+		t.Fatalf("first delivery: status %d", code)
+	}
+	// Replayed as it was, or re-signed as the proxy redelivers
+	for _, h := range []http.Header{header, signedHeader(payload, webhookSecret, time.Now().Add(time.Second))} {
+		if code := c.deliver(payload, h); code != http.StatusNoContent {
+			t.Errorf("duplicate: status %d", code)
+		}
+		if code := replica.deliver(payload, h); code != http.StatusNoContent {
+			t.Errorf("duplicate at a replica: status %d", code)
+		}
+	}
+	if len(c.jobs) != 1 || len(replica.jobs) != 0 {
+		t.Errorf("handled %d and %d times", len(c.jobs), len(replica.jobs))
+	}
+
+	next := callbackPayload("evt_2", "job_1")
+	if code := c.deliver(next, signedHeader(next, webhookSecret, time.Now())); code != http.StatusNoContent || len(c.jobs) != 2 {
+		t.Errorf("another event: status %d, %d jobs", code, len(c.jobs))
+	}
+}
+
+func TestCallbackHandlerRetrySignaling(t *testing.T) {
+	c := newCallbackRecorder(CallbackOptions{})
+	c.errs = []error{errors.New("database down"), nil}
+	payload := callbackPayload("evt_1", "job_1")
+	if code := c.deliver(payload, signedHeader(payload, webhookSecret, time.Now())); code != http.StatusInternalServerError {
+		t.Errorf("failing handler: status %d", code)
+	}
+	// The proxy's retry is handled, and then only once
+	for i := 0; i < 2; i++ {
+		if code := c.deliver(payload, signedHeader(payload, webhookSecret, time.Now())); code != http.StatusNoContent {
+			t.Errorf("retry %d: status %d", i+1, code)
+		}
+	}
+	if len(c.jobs) != 2 {
+		t.Errorf("%d attempts handled, want 2", len(c.jobs))
+	}
+
+	// A 4xx other than 429 makes the proxy drop it
+	c.errs = []error{fmt.Errorf("job %s unknown: %w", "job_2", ErrDropCallback)}
+	dropped := callbackPayload("evt_2", "job_2")
+	if code := c.deliver(dropped, signedHeader(dropped, webhookSecret, time.Now())); code != http.StatusUnprocessableEntity {
+		t.Errorf("dropped: status %d", code)
+	}
+	if code := c.deliver(dropped, signedHeader(dropped, webhookSecret, time.Now())); code != http.StatusNoContent || len(c.jobs) != 3 {
+		t.Errorf("dropped redelivery: status %d, %d jobs", code, len(c.jobs))
+	}
+}
+
+type failingNonces struct{}
+
+func (failingNonces) Claim(context.Context, string, time.Duration) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func (failingNonces) Release(context.Context, string) error { return nil }
+
+func TestCallbackHandlerNonceStoreDown(t *testing.T) {
+	c := newCallbackRecorder(CallbackOptions{Nonces: failingNonces{}})
+	payload := callbackPayload("evt_1", "job_1")
+	// 503, for the proxy to retry
+	if code := c.deliver(payload, signedHeader(payload, webhookSecret, time.Now())); code != http.StatusServiceUnavailable || len(c.jobs) != 0 {
+		t.Errorf("status %d, %d jobs", code, len(c.jobs))
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryNonceStore()
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+
+	if ok, _ := s.Claim(ctx, "a", time.Minute); !ok {
+		t.Fatal("first claim refused")
+	}
+	if ok, _ := s.Claim(ctx, "a", time.Minute); ok {
+		t.Error("second claim accepted")
+	}
+	s.Claim(ctx, "b", 3*time.Minute)
+
+	now = now.Add(2 * time.Minute)
+	if ok, _ := s.Claim(ctx, "a", time.Minute); !ok {
+		t.Error("expired nonce refused")
+	}
+	if ok, _ := s.Claim(ctx, "b", time.Minute); ok {
+		t.Error("live nonce accepted")
+	}
+
+	// Released and claimed again, it lasts its new ttl
+	_ = s.Release(ctx, "b")
+	if ok, _ := s.Claim(ctx, "b", 10*time.Minute); !ok {
+		t.Error("released nonce refused")
+	}
+	now = now.Add(5 * time.Minute)
+	if ok, _ := s.Claim(ctx, "b", time.Minute); ok {
+		t.Error("reclaimed nonce expired with its first ttl")
+	}
+	if len(s.expires) != 1 {
+		t.Errorf("%d nonces kept, want 1", len(s.expires))
+	}
+}
@@ -0,0 +1,182 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const healthPath = "/health"
+
+// Features of the proxy that not every deployment has, as reported by
+// ServerCapabilities.
+const (
+	// FeatureAsyncJobs is SubmitLLM, JobResult, Jobs and WaitForJob.
+	FeatureAsyncJobs = "async_jobs"
+	// FeatureTargetPurge is InvalidateTarget.
+	FeatureTargetPurge = "target_purge"
+	// FeatureHTTPStream is ProxyHTTPStream, the raw passthrough of
+	// upstream bodies.
+	FeatureHTTPStream = "http_stream"
+)
+
+// featureMinVersions is the first proxy version with each feature, for
+// proxies whose /health lists no features.
+var featureMinVersions = map[string]string{
+	FeatureAsyncJobs:   "1.0.7",
+	FeatureTargetPurge: "1.0.7",
+	FeatureHTTPStream:  "1.0.7",
+}
+
+// ErrNotSupported matches a *NotSupportedError with errors.Is.
+var ErrNotSupported = errors.New("reliapi: not supported by the proxy")
+
+// NotSupportedError is returned by a call needing a feature the proxy
+// doesn't have, such as SubmitLLM against a proxy predating async jobs,
+// instead of the 404 or malformed reply the proxy answered with.
+type NotSupportedError struct {
+	// Feature is the missing feature, one of the Feature* constants.
+	Feature string
+	// MinVersion is the first proxy version with Feature.
+	MinVersion string
+	// ServerVersion is the version the proxy reports.
+	ServerVersion string
+	// Err is the proxy's answer to the call, nil if the call failed before
+	// it was sent because the proxy was already known to lack Feature.
+	Err error
+}
+
+func (e *NotSupportedError) Error() string {
+	if e.ServerVersion != "" && compareVersions(e.ServerVersion, e.MinVersion) >= 0 {
+		// Recent enough, but the deployment doesn't offer it
+		return fmt.Sprintf("%v: %s is not available on proxy %s", ErrNotSupported, e.Feature, e.ServerVersion)
+	}
+	return fmt.Sprintf("%v: %s needs proxy %s or later, it runs %q", ErrNotSupported, e.Feature, e.MinVersion, e.ServerVersion)
+}
+
+// Is reports whether target is ErrNotSupported.
+func (e *NotSupportedError) Is(target error) bool {
+	return target == ErrNotSupported
+}
+
+// Unwrap returns Err.
+func (e *NotSupportedError) Unwrap() error { return e.Err }
+
+// Capabilities is what ServerCapabilities reports of the proxy.
+type Capabilities struct {
+	// Version is the proxy's version, e.g. "1.0.7".
+	Version string `json:"version"`
+	// Features lists the Feature* constants the proxy has; nil for
+	// proxies that predate the list, whose features Supports derives from
+	// Version.
+	Features []string `json:"features"`
+}
+
+// Supports reports whether the proxy has feature.
+func (c Capabilities) Supports(feature string) bool {
+	if c.Features != nil {
+		return slices.Contains(c.Features, feature)
+	}
+	min, ok := featureMinVersions[feature]
+	return ok && c.Version != "" && compareVersions(c.Version, min) >= 0
+}
+
+// ServerCapabilities returns the version and features the proxy reports at
+// /health. The first successful answer is kept for the client's life, so
+// a deployment upgraded under a running client is seen by a new one.
+//
+// Calls needing a feature (FeatureAsyncJobs, FeatureTargetPurge,
+// FeatureHTTPStream) consult it when the proxy answers them with a 404 or
+// a reply of the wrong kind, and return a *NotSupportedError if the
+// proxy lacks the feature; once it is known, they fail with one before
+// anything is sent.
+func (c *Client) ServerCapabilities(ctx context.Context) (Capabilities, error) {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	if c.caps != nil {
+		return *c.caps, nil
+	}
+	_, raw, err := c.do(ctx, http.MethodGet, healthPath, nil, true)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	var caps Capabilities
+	if err := json.Unmarshal(raw, &caps); err != nil {
+		return Capabilities{}, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	c.caps = &caps
+	return caps, nil
+}
+
+// requireFeature fails with a *NotSupportedError when the proxy is already
+// known to lack feature.
+func (c *Client) requireFeature(feature string) error {
+	c.capsMu.Lock()
+	caps := c.caps
+	c.capsMu.Unlock()
+	if caps == nil || caps.Supports(feature) {
+		return nil
+	}
+	return &NotSupportedError{Feature: feature, MinVersion: featureMinVersions[feature], ServerVersion: caps.Version}
+}
+
+// unsupported returns err, the failure of a call needing feature, as a
+// *NotSupportedError if the proxy lacks feature. If its capabilities can't
+// be had, err is returned as it is.
+func (c *Client) unsupported(ctx context.Context, feature string, err error) error {
+	caps, cerr := c.ServerCapabilities(ctx)
+	if cerr != nil || caps.Supports(feature) {
+		return err
+	}
+	return &NotSupportedError{Feature: feature, MinVersion: featureMinVersions[feature], ServerVersion: caps.Version, Err: err}
+}
+
+// routeError is unsupported for an err that is the proxy's 404 or 405 for
+// a path it has no route for, and err for any other.
+func (c *Client) routeError(ctx context.Context, feature string, err error) error {
+	if !isRouteNotFound(err) {
+		return err
+	}
+	return c.unsupported(ctx, feature, err)
+}
+
+// isRouteNotFound reports whether err is the proxy's answer to a path it
+// has no route for: a 404 or 405 outside the error envelope.
+func isRouteNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "" {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusMethodNotAllowed
+}
+
+// compareVersions compares dotted versions numerically, ignoring a leading
+// "v" and any "-" or "+" suffix; missing components count as 0.
+func compareVersions(a, b string) int {
+	parts := func(v string) []string {
+		v = strings.TrimPrefix(v, "v")
+		if i := strings.IndexAny(v, "-+"); i >= 0 {
+			v = v[:i]
+		}
+		return strings.Split(v, ".")
+	}
+	pa, pb := parts(a), parts(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCapabilitiesSupports(t *testing.T) {
+	for _, tt := range []struct {
+		caps Capabilities
+		want bool
+	}{
+		{Capabilities{Version: "1.0.7", Features: []string{FeatureAsyncJobs}}, true},
+		{Capabilities{Version: "2.0.0", Features: []string{}}, false},
+		{Capabilities{Version: "1.0.7"}, true},
+		{Capabilities{Version: "v1.1"}, true},
+		{Capabilities{Version: "1.0.10-rc1"}, true},
+		{Capabilities{Version: "1.0.6"}, false},
+		{Capabilities{}, false},
+	} {
+		if got := tt.caps.Supports(FeatureAsyncJobs); got != tt.want {
+			t.Errorf("%+v supports async jobs = %v", tt.caps, got)
+		}
+	}
+}
+
+func TestServerCapabilitiesCached(t *testing.T) {
+	probes := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != healthPath {
+			http.NotFound(w, r)
+			return
+		}
+		probes++
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "version": "1.0.7", "features": []string{FeatureAsyncJobs}})
+	})
+	for i := 0; i < 2; i++ {
+		caps, err := c.ServerCapabilities(context.Background())
+		if err != nil || caps.Version != "1.0.7" || !caps.Supports(FeatureAsyncJobs) || caps.Supports(FeatureTargetPurge) {
+			t.Fatalf("capabilities = %+v, %v", caps, err)
+		}
+	}
+	if probes != 1 {
+		t.Errorf("%d probes", probes)
+	}
+
+	// A 404 of a supported feature stays as it is
+	_, err := c.JobResult(context.Background(), "job_1")
+	var apiErr *APIError
+	if errors.Is(err, ErrNotSupported) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("err = %v", err)
+	}
+	// An unsupported one fails unsent, since the capabilities are known
+	_, err = c.InvalidateTarget(context.Background(), "openai")
+	var ns *NotSupportedError
+	if !errors.As(err, &ns) || ns.Err != nil || err.Error() != "reliapi: not supported by the proxy: target_purge is not available on proxy 1.0.7" {
+		t.Errorf("err = %v", err)
+	}
+}
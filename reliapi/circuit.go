@@ -0,0 +1,103 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Circuit breaker states reported by CircuitStatus and Meta.CircuitState.
+const (
+	// CircuitClosed means the target has no recorded failures.
+	CircuitClosed = "closed"
+	// CircuitHalfOpen means failures were recorded but fewer than
+	// FailuresToOpen; requests still reach the target.
+	CircuitHalfOpen = "half-open"
+	// CircuitOpen means the proxy rejects requests to the target until
+	// NextProbeTime.
+	CircuitOpen = "open"
+)
+
+// What a target's failures are counted per, TargetCircuit.Scope.
+const (
+	CircuitScopeTarget = "target"
+	// CircuitScopeModel gives each model of the target its own breaker, so
+	// an incident of one model doesn't fail requests for the others.
+	CircuitScopeModel = "model"
+	// CircuitScopeCredential gives each named credential its own breaker.
+	CircuitScopeCredential = "credential"
+)
+
+// CircuitState is the circuit breaker state of a target, or of one of its
+// sub-breakers in Breakers.
+type CircuitState struct {
+	// Key names a sub-breaker as Meta.CircuitKey does; it is empty for
+	// the target itself.
+	Key string `json:"key,omitempty"`
+	// Scope is the target's TargetCircuit.Scope.
+	Scope string `json:"scope,omitempty"`
+	// State of a target with sub-breakers is the worst of theirs: it is
+	// CircuitOpen when any of them is.
+	State        string `json:"state"`
+	FailureCount int    `json:"failure_count"`
+	// LastFailureTime is when the last failure was recorded, nil if none
+	// has been since the circuit last closed.
+	LastFailureTime *time.Time `json:"last_failure_at"`
+	// NextProbeTime is when an open circuit lets the next request through;
+	// nil unless State is CircuitOpen.
+	NextProbeTime  *time.Time `json:"next_probe_at"`
+	FailuresToOpen int        `json:"failures_to_open"`
+	OpenTTLSeconds int        `json:"open_ttl_s"`
+	// Breakers lists the target's sub-breakers, the breaker of the whole
+	// target first.
+	Breakers []CircuitState `json:"breakers,omitempty"`
+}
+
+// CircuitStatus returns the circuit breaker state of target. An unknown
+// target is a 404 *APIError with CodeNotFound.
+func (c *Client) CircuitStatus(ctx context.Context, target string) (*CircuitState, error) {
+	if target == "" {
+		return nil, errors.New("reliapi: target is required")
+	}
+	return c.circuit(ctx, http.MethodGet, circuitPath(target))
+}
+
+// ResetCircuit closes target's circuit breakers and clears their failures,
+// for example after fixing the target's credentials. It requires the
+// proxy's admin key (RELIAPI_ADMIN_KEY); other keys get a 403 *APIError
+// with CodeForbidden.
+func (c *Client) ResetCircuit(ctx context.Context, target string) error {
+	if target == "" {
+		return errors.New("reliapi: target is required")
+	}
+	_, err := c.circuit(ctx, http.MethodPost, circuitPath(target)+"/reset")
+	return err
+}
+
+func circuitPath(target string) string {
+	return "/v1/targets/" + url.PathEscape(target) + "/circuit"
+}
+
+// circuit sends a circuit request and decodes the state it reports. Both
+// the status and the reset are idempotent, so they may be retried.
+func (c *Client) circuit(ctx context.Context, method, path string) (*CircuitState, error) {
+	resp, raw, err := c.do(ctx, method, path, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool         `json:"success"`
+		Data    CircuitState `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return &out.Data, nil
+}
@@ -0,0 +1,115 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitStatus(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.EscapedPath() != "/v1/targets/my%20api/circuit" {
+			t.Errorf("%s %s", r.Method, r.URL.EscapedPath())
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"state":            "open",
+				"failure_count":    5,
+				"last_failure_at":  "2026-10-14T09:30:00.5+00:00",
+				"next_probe_at":    "2026-10-14T09:31:00.5+00:00",
+				"failures_to_open": 5,
+				"open_ttl_s":       60,
+			},
+			"meta": map[string]interface{}{"request_id": "req_circuit", "duration_ms": 1, "circuit_state": "open"},
+		})
+	})
+	got, err := c.CircuitStatus(context.Background(), "my api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != CircuitOpen || got.FailureCount != 5 || got.FailuresToOpen != 5 || got.OpenTTLSeconds != 60 {
+		t.Errorf("state = %+v", got)
+	}
+	if got.LastFailureTime == nil || got.NextProbeTime == nil || got.NextProbeTime.Sub(*got.LastFailureTime) != time.Minute {
+		t.Errorf("times = %v, %v", got.LastFailureTime, got.NextProbeTime)
+	}
+}
+
+func TestCircuitStatusBreakers(t *testing.T) {
+	breaker := func(key, state string, failures int) map[string]interface{} {
+		return map[string]interface{}{
+			"key": key, "state": state, "failure_count": failures, "last_failure_at": nil, "next_probe_at": nil,
+			"failures_to_open": 2, "open_ttl_s": 60,
+		}
+	}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"state": "open", "scope": "model", "failure_count": 2, "failures_to_open": 2, "open_ttl_s": 60,
+				"breakers": []interface{}{
+					breaker("openai", "closed", 0),
+					breaker("openai:model=gpt-4o", "open", 2),
+					breaker("openai:model=gpt-4o-mini", "closed", 0),
+				},
+			},
+			"meta": map[string]interface{}{"request_id": "req_circuit", "duration_ms": 1, "circuit_state": "open"},
+		})
+	})
+	got, err := c.CircuitStatus(context.Background(), "openai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != CircuitOpen || got.Scope != CircuitScopeModel || len(got.Breakers) != 3 {
+		t.Fatalf("state = %+v", got)
+	}
+	if b := got.Breakers[1]; b.Key != "openai:model=gpt-4o" || b.State != CircuitOpen || b.FailureCount != 2 {
+		t.Errorf("breaker = %+v", b)
+	}
+	if b := got.Breakers[2]; b.State != CircuitClosed {
+		t.Errorf("breaker = %+v", b)
+	}
+}
+
+func TestResetCircuit(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/targets/openai/circuit/reset" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"state": "closed", "failure_count": 0, "last_failure_at": nil, "next_probe_at": nil,
+				"failures_to_open": 5, "open_ttl_s": 60,
+			},
+			"meta": map[string]interface{}{"request_id": "req_reset", "duration_ms": 1, "circuit_state": "closed"},
+		})
+	})
+	if err := c.ResetCircuit(context.Background(), "openai"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ResetCircuit(context.Background(), ""); err == nil {
+		t.Error("expected an error for an empty target")
+	}
+}
+
+func TestCircuitStatusUnknownTarget(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"detail": map[string]interface{}{
+				"success": false,
+				"error": map[string]interface{}{
+					"type": "client_error", "code": "NOT_FOUND", "message": "Target 'nope' not found", "retryable": false,
+				},
+			},
+		})
+	})
+	_, err := c.CircuitStatus(context.Background(), "nope")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Code != CodeNotFound {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,574 @@
+// Package reliapi is a Go client for the ReliAPI reliability proxy.
+//
+// A Client wraps the /v1/proxy/http and /v1/proxy/llm endpoints:
+//
+//	client, err := reliapi.NewClient("https://reliapi.kikuai.dev", os.Getenv("RELIAPI_API_KEY"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	resp, err := client.ProxyLLM(ctx, reliapi.LLMRequest{
+//		Target:   "openai",
+//		Model:    "gpt-4o-mini",
+//		Messages: []reliapi.ChatMessage{reliapi.UserMessage("Hello")},
+//	})
+//
+// ProxyHTTPStream relays large /proxy/http bodies without buffering them,
+// ProxyGraphQL sends GraphQL operations with query-aware caching,
+// ProxyEmbeddings embeds text with per-input caching,
+// ProxyLLMStream consumes the LLM endpoint as Server-Sent Events, and
+// ProxyLLMBatch sends many LLM requests in one call. InvalidateCache and
+// InvalidateTarget evict cached responses. CircuitStatus and ResetCircuit
+// inspect and close a target's circuit breaker, and ListTargets,
+// UpsertTarget and DeleteTarget manage the targets themselves. Budget reports the month's
+// LLM spend, and EstimateCost (or CountTokens, offline) predicts a
+// request's cost. Non-2xx responses are returned as *APIError.
+//
+// A Client is safe for concurrent use; share one rather than creating one
+// per call, so calls reuse its pooled connections to the proxy (see
+// WithMaxConnsPerHost and WithIdleConnTimeout).
+//
+// Every method takes a context.Context. Canceling it aborts the in-flight
+// call (including a pending Stream.Recv or retry backoff), and the returned
+// error matches context.Canceled or context.DeadlineExceeded under errors.Is.
+//
+// One Client can serve many proxy tenants: WithRequestAPIKey overrides the
+// API key for a context, and WithTenantKeyProvider maps a request's TenantID
+// to its key. WithHMACAuth signs requests with a shared secret instead of
+// sending the API key.
+//
+// WithMetrics exports Prometheus metrics of the client's calls, WithTracing
+// adds them to OpenTelemetry traces, and WithRequestHook, WithResponseHook
+// and WithAttemptHook run code of your own around every call.
+package reliapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultBaseURL is the hosted ReliAPI endpoint.
+	DefaultBaseURL = "https://reliapi.kikuai.dev"
+
+	defaultTimeout   = 60 * time.Second
+	defaultUserAgent = "reliapi-go"
+
+	httpProxyPath = "/v1/proxy/http"
+	llmProxyPath  = "/v1/proxy/llm"
+	llmBatchPath  = "/v1/proxy/llm/batch"
+	cachePath     = "/v1/cache"
+)
+
+// Client calls a ReliAPI deployment. It is safe for concurrent use, and
+// meant to be shared: create one per proxy and API key, not one per call.
+// Clients keep their connections to the proxy open for reuse, on a
+// transport shared by all clients unless WithTransport, WithMaxConnsPerHost
+// or WithIdleConnTimeout give one its own.
+type Client struct {
+	baseURL    *url.URL
+	apiKey     string
+	httpClient *http.Client
+	userAgent  string
+
+	transport       *http.Transport
+	maxConnsPerHost int
+	idleConnTimeout time.Duration
+
+	idempotency      idempotencyMode
+	onIdempotencyKey func(key string)
+	idempotencyTTL   time.Duration
+
+	replays            *MemoryCache
+	onReplayDivergence ReplayDivergenceHandler
+	strictIdempotency  bool
+
+	retry retryConfig
+	sleep func(ctx context.Context, d time.Duration) error
+
+	coalesce    *coalescer
+	budgetGuard *budgetGuard
+	localCache  CacheStore
+	deltas      bool
+	rateQueue   *rateQueue
+	loopGuard   *loopGuard
+
+	tenantKeys TenantKeyProvider
+
+	hmacKeyID  string
+	hmacSecret []byte
+	now        func() time.Time
+
+	streamReorderWindow int
+	maxImageBytes       int
+	maxResponseBytes    int64
+	compressThreshold   int
+	compressDict        *compressionDictionary
+	redactor            Redactor
+
+	metricsRegisterer prometheus.Registerer
+	metrics           *clientMetrics
+	tracer            trace.Tracer
+
+	logger         *slog.Logger
+	logPromptChars int
+
+	requestHooks  []RequestHook
+	responseHooks []ResponseHook
+	attemptHooks  []AttemptHook
+
+	faults []Fault
+
+	tags map[string]string
+
+	// caps is what ServerCapabilities last got from the proxy, nil until
+	// then
+	capsMu sync.Mutex
+	caps   *Capabilities
+
+	// models is the table ValidateRequest uses once RefreshModels set it
+	models atomic.Pointer[ModelTable]
+
+	offlineDir      string
+	offlineMaxBytes int64
+	offlineHandler  OfflineReplayHandler
+	offline         *offlineQueue
+
+	backfill cacheBackfill
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the *http.Client used for all requests. The client is
+// reused across calls, so configure its Transport for connection pooling;
+// WithTransport, WithMaxConnsPerHost and WithIdleConnTimeout don't apply.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.httpClient = hc
+		}
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent to the proxy.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// NewClient returns a Client for the deployment at baseURL authenticating
+// with apiKey. An empty baseURL selects DefaultBaseURL.
+func NewClient(baseURL, apiKey string, opts ...Option) (*Client, error) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("reliapi: invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("reliapi: base URL must be http or https, got %q", baseURL)
+	}
+
+	defaultHTTPClient := &http.Client{Timeout: defaultTimeout}
+	c := &Client{
+		baseURL:    u,
+		apiKey:     apiKey,
+		httpClient: defaultHTTPClient,
+		userAgent:  defaultUserAgent,
+		retry:      retryConfig{maxAttempts: 1},
+		sleep:      sleepContext,
+		now:        time.Now,
+
+		streamReorderWindow: defaultStreamReorderWindow,
+		maxImageBytes:       DefaultMaxImageBytes,
+		maxResponseBytes:    DefaultMaxResponseBytes,
+
+		backfill: cacheBackfill{ramp: defaultBackfillRamp},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == defaultHTTPClient {
+		defaultHTTPClient.Transport = c.clientTransport()
+	}
+	if c.compressDict != nil {
+		if err := c.compressDict.init(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.metricsRegisterer != nil {
+		if c.metrics, err = newClientMetrics(c.metricsRegisterer); err != nil {
+			return nil, err
+		}
+	}
+	if c.rateQueue != nil {
+		c.rateQueue.metrics = c.metrics
+	}
+	if c.offlineDir != "" {
+		if c.offline, err = openOfflineQueue(c, c.offlineDir, c.offlineMaxBytes); err != nil {
+			return nil, err
+		}
+		c.offline.start()
+	}
+	if c.backfill.limit > 0 && c.localCache != nil {
+		c.backfill.start(c)
+	}
+	return c, nil
+}
+
+// ProxyHTTP forwards req through the proxy's HTTP endpoint.
+func (c *Client) ProxyHTTP(ctx context.Context, req HTTPRequest) (resp *ReliAPIResponse, err error) {
+	if q := c.offlineQueueFor(ctx, req.IdempotencyKey); q != nil {
+		return q.proxyHTTP(ctx, req)
+	}
+	ctx, in := c.instrument(ctx, OpProxyHTTP, req.Target)
+	defer in.endResponse(&resp, &err)
+	ctx, err = c.tenantContext(ctx, req.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Tags, err = c.withTags(req.Tags); err != nil {
+		return nil, err
+	}
+	req, err = withEncodedBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = normalizeQuery(req.Query, req.QueryArrayFormat); err != nil {
+		return nil, err
+	}
+	key, cacheable := httpRequestKey(req)
+	return c.withLocalCache(ctx, key, cacheable, req.IdempotencyKey, req.Cache, func() (*ReliAPIResponse, error) {
+		fetch := func(ctx context.Context) (*ReliAPIResponse, error) {
+			return c.withDeltaBase(ctx, key, cacheable, req, c.proxyHTTP)
+		}
+		if cacheable && c.coalesce != nil {
+			return c.coalesce.do(ctx, c.credentialScope(ctx)+key, fetch)
+		}
+		return fetch(ctx)
+	})
+}
+
+func (c *Client) proxyHTTP(ctx context.Context, req HTTPRequest) (*ReliAPIResponse, error) {
+	key, err := c.applyIdempotency(&req.IdempotencyKey, req, allowsResend(req.Retry) && !isIdempotentHTTP(req))
+	if err != nil {
+		return nil, err
+	}
+	// After the idempotency key, which must not change with the deadline
+	req.IdempotencyTTL = c.idempotencyTTLSeconds(key, req.IdempotencyTTL)
+	req.TimeoutMs = contextTimeoutMs(ctx, req.TimeoutMs)
+	hr, err := c.startHooks(ctx, OpProxyHTTP, req.Target, &req.IdempotencyKey, req)
+	if err != nil {
+		return nil, err
+	}
+	if hr != nil {
+		key = hr.IdempotencyKey
+	}
+	resp, err := c.post(withHookRequest(ctx, hr), httpProxyPath, req, isIdempotentHTTP(req))
+	if resp != nil {
+		resp.IdempotencyKey = key
+	}
+	resp, err = c.checkReplay(ctx, key, resp, err)
+	return resp, withIdempotencyKey(c.endHooks(ctx, hr, resp, err), key)
+}
+
+// ProxyLLM forwards req through the proxy's LLM endpoint.
+func (c *Client) ProxyLLM(ctx context.Context, req LLMRequest) (resp *ReliAPIResponse, err error) {
+	if q := c.offlineQueueFor(ctx, req.IdempotencyKey); q != nil {
+		return q.proxyLLM(ctx, req)
+	}
+	ctx, in := c.instrument(ctx, OpProxyLLM, req.Target)
+	defer in.endResponse(&resp, &err)
+	req, err = withPromptMessages(req)
+	if err != nil {
+		return nil, err
+	}
+	loopHash, err := c.admitLoop(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	in.logPrompts(req.sentMessages())
+	if err = c.checkImages(req.sentMessages()); err != nil {
+		return nil, err
+	}
+	ctx, err = c.tenantContext(ctx, req.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if ctx, req, err = c.guardLLM(ctx, req); err != nil {
+		return nil, err
+	}
+	if req.Tags, err = c.withTags(req.Tags); err != nil {
+		return nil, err
+	}
+	req, vault := c.redact(req)
+	key, cacheable := llmRequestKey(req)
+	resp, err = c.withLocalCache(ctx, key, cacheable, req.IdempotencyKey, req.Cache, func() (*ReliAPIResponse, error) {
+		if cacheable && c.coalesce != nil {
+			return c.coalesce.do(ctx, c.credentialScope(ctx)+key, func(ctx context.Context) (*ReliAPIResponse, error) {
+				return c.proxyLLM(ctx, req)
+			})
+		}
+		return c.proxyLLM(ctx, req)
+	})
+	if resp != nil && c.loopGuard != nil {
+		c.loopGuard.record(loopHash, resp.Meta.RequestID)
+	}
+	return vault.restoreResponse(resp), err
+}
+
+func (c *Client) proxyLLM(ctx context.Context, req LLMRequest) (*ReliAPIResponse, error) {
+	mode := c.idempotency
+	if req.ConversationID != nil && mode == idempotencyDeterministic {
+		// The same AppendMessages may follow any history, so a
+		// conversation turn's body doesn't identify it and gets no
+		// deterministic key.
+		mode = idempotencyManual
+	}
+	key, err := c.applyIdempotencyMode(mode, &req.IdempotencyKey, req, allowsResend(req.Retry))
+	if err != nil {
+		return nil, err
+	}
+	req.IdempotencyTTL = c.idempotencyTTLSeconds(key, req.IdempotencyTTL)
+	req.TimeoutMs = contextTimeoutMs(ctx, req.TimeoutMs)
+	hr, err := c.startHooks(ctx, OpProxyLLM, req.Target, &req.IdempotencyKey, req)
+	if err != nil {
+		return nil, err
+	}
+	if hr != nil {
+		key = hr.IdempotencyKey
+	}
+	resp, err := c.post(withHookRequest(withQueuePriority(ctx, req.Priority), hr), llmProxyPath, req, req.IdempotencyKey != nil && allowsResend(req.Retry))
+	if resp != nil {
+		resp.IdempotencyKey = key
+	}
+	resp, err = c.checkReplay(ctx, key, resp, err)
+	return resp, withIdempotencyKey(c.endHooks(ctx, hr, resp, err), key)
+}
+
+// payload is an encoded request body. open returns a reader of it for
+// each attempt, so it can be sent again on a retry.
+type payload interface {
+	open() (io.ReadCloser, error)
+}
+
+// bytesPayload is a payload held in memory.
+type bytesPayload []byte
+
+func (p bytesPayload) open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(p)), nil
+}
+
+// payloadEncoder is a request body that encodes itself, instead of through
+// json.Marshal; see HTTPRequest.encodePayload.
+type payloadEncoder interface {
+	encodePayload() (payload, error)
+}
+
+// encodePayload encodes body as JSON; a nil body has no payload.
+func encodePayload(body interface{}) (payload, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, nil
+	case payloadEncoder:
+		return b.encodePayload()
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("reliapi: encode request: %w", err)
+	}
+	return bytesPayload(raw), nil
+}
+
+// newRequest builds an authenticated request sending payload, or no body
+// if it is nil, to path.
+func (c *Client) newRequest(ctx context.Context, method, path string, payload payload) (*http.Request, error) {
+	var reqBody io.Reader = http.NoBody
+	switch raw := payload.(type) {
+	case bytesPayload:
+		// A *bytes.Reader lets net/http set the Content-Length
+		reqBody = bytes.NewReader(raw)
+	case gzipPayload:
+		reqBody = bytes.NewReader(raw)
+	case nil:
+	default:
+		r, err := payload.open()
+		if err != nil {
+			return nil, fmt.Errorf("reliapi: build request: %w", err)
+		}
+		reqBody = r
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.endpoint(path), reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("reliapi: build request: %w", err)
+	}
+	if r := c.hookRequest(ctx); r != nil {
+		for name, v := range r.Header {
+			httpReq.Header[name] = append([]string(nil), v...)
+		}
+	}
+	apiKey := c.apiKeyFor(ctx)
+	signed := c.hmacKeyID != "" && apiKey == c.apiKey
+	if signed {
+		apiKey = ""
+	}
+	c.setHeaders(httpReq, apiKey)
+	c.injectTraceContext(httpReq)
+	setDeadlineHeader(ctx, httpReq)
+	c.setFaultHeader(ctx, httpReq)
+	if payload == nil {
+		httpReq.Header.Del("Content-Type")
+	}
+	switch payload.(type) {
+	case gzipPayload:
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	case zstdPayload:
+		httpReq.Header.Set("Content-Encoding", "zstd")
+		httpReq.Header.Set(HeaderCompressionDictionary, c.compressDict.id)
+	}
+	if signed {
+		if err := c.signRequest(httpReq, payload, c.now().Unix()); err != nil {
+			return nil, err
+		}
+	}
+	return httpReq, nil
+}
+
+// post sends body to path and decodes the JSON envelope. retryable reports
+// whether the request may be resent under WithRetry. The response's Data
+// is in a pooled buffer; see ReliAPIResponse.Release.
+func (c *Client) post(ctx context.Context, path string, body interface{}, retryable bool) (*ReliAPIResponse, error) {
+	resp, respBody, compressed, err := c.open(ctx, http.MethodPost, path, body, retryable)
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(resp.Body)
+
+	sizeHint := resp.ContentLength
+	if compressed.r != nil {
+		sizeHint = -1
+	}
+	held, err := c.readPooled(respBody, sizeHint)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	raw := held.buf.Bytes()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// The error keeps a copy of the body, and the buffer goes back
+		err := newAPIError(resp, bytes.Clone(raw))
+		held.release()
+		return nil, err
+	}
+	out := &ReliAPIResponse{held: held}
+	if err := decodeEnvelope(raw, out); err != nil {
+		out.Release()
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		err := newAPIError(resp, bytes.Clone(raw))
+		out.Release()
+		return nil, err
+	}
+	if compressed.n > 0 {
+		out.Meta.CompressedBytes = compressed.n
+		out.Meta.UncompressedBytes = int64(len(raw))
+	}
+	return out, nil
+}
+
+// do sends body to path with method and returns the response with its body
+// read. A nil body sends a request without one. Non-2xx responses are
+// returned as *APIError.
+func (c *Client) do(ctx context.Context, method, path string, body interface{}, retryable bool) (*http.Response, []byte, error) {
+	resp, raw, _, err := c.exchange(ctx, method, path, body, retryable)
+	return resp, raw, err
+}
+
+// exchange is do, also returning the size of the response body as sent
+// when it came compressed (see WithCompression), or 0.
+func (c *Client) exchange(ctx context.Context, method, path string, body interface{}, retryable bool) (*http.Response, []byte, int64, error) {
+	resp, respBody, compressed, err := c.open(ctx, method, path, body, retryable)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	// Drained as well, for a body left unread by an error below
+	defer drainAndClose(resp.Body)
+
+	raw, err := c.readBody(respBody)
+	if err != nil {
+		return nil, nil, 0, contextError(ctx, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, 0, newAPIError(resp, raw)
+	}
+	return resp, raw, compressed.n, nil
+}
+
+// open sends body to path with method and returns the response with a
+// reader over its decompressed body, and the counter of its bytes as sent
+// when it came compressed. The caller closes resp.Body.
+func (c *Client) open(ctx context.Context, method, path string, body interface{}, retryable bool) (*http.Response, io.Reader, *countingReader, error) {
+	payload, err := encodePayload(body)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	resp, err := c.send(ctx, method, path, payload, "application/json", retryable)
+	if err != nil {
+		return nil, nil, nil, contextError(ctx, err)
+	}
+	respBody, compressed, err := decodedBody(resp)
+	if err != nil {
+		drainAndClose(resp.Body)
+		return nil, nil, nil, err
+	}
+	return resp, respBody, compressed, nil
+}
+
+// contextError makes sure an error caused by ctx being canceled or timing out
+// matches context.Canceled / context.DeadlineExceeded under errors.Is, even
+// when the transport reports it as a generic connection failure.
+func contextError(ctx context.Context, err error) error {
+	ctxErr := ctx.Err()
+	if ctxErr == nil || errors.Is(err, ctxErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ctxErr, err)
+}
+
+func (c *Client) endpoint(path string) string {
+	return c.baseURL.String() + path
+}
+
+// setHeaders applies auth and content headers. The proxy reads X-API-Key;
+// RapidAPI-hosted deployments additionally expect X-RapidAPI-Key.
+func (c *Client) setHeaders(req *http.Request, apiKey string) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if apiKey == "" {
+		return
+	}
+	req.Header.Set("X-API-Key", apiKey)
+	if strings.Contains(strings.ToLower(c.baseURL.Host), "rapidapi") {
+		req.Header.Set("X-RapidAPI-Key", apiKey)
+	}
+}
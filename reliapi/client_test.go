@@ -0,0 +1,635 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c, err := NewClient(srv.URL, "test-key", opts...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestNewClientValidatesBaseURL(t *testing.T) {
+	if _, err := NewClient("ftp://example.com", "k"); err == nil {
+		t.Fatal("expected error for non-http scheme")
+	}
+	c, err := NewClient("", "k")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if got := c.endpoint(llmProxyPath); got != DefaultBaseURL+llmProxyPath {
+		t.Fatalf("endpoint = %q", got)
+	}
+}
+
+func TestProxyLLMSendsRequestAndDecodesResponse(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/proxy/llm" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("X-API-Key"); got != "test-key" {
+			t.Errorf("X-API-Key = %q", got)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body["target"] != "openai" || body["model"] != "gpt-4o-mini" {
+			t.Errorf("unexpected body %v", body)
+		}
+		if _, ok := body["temperature"]; ok {
+			t.Errorf("unset temperature should be omitted: %v", body)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "hi", "role": "assistant"},
+			"meta":    map[string]interface{}{"request_id": "req_1", "cache_hit": true, "cost_usd": 0.0012},
+		})
+	})
+
+	resp, err := c.ProxyLLM(context.Background(), LLMRequest{
+		Target:   "openai",
+		Model:    "gpt-4o-mini",
+		Messages: []ChatMessage{UserMessage("hello")},
+	})
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if resp.Meta.RequestID != "req_1" || !resp.Meta.CacheHit {
+		t.Errorf("unexpected meta %+v", resp.Meta)
+	}
+	if resp.Meta.CostUSD == nil || *resp.Meta.CostUSD != 0.0012 {
+		t.Errorf("cost_usd = %v", resp.Meta.CostUSD)
+	}
+	if data := resp.DataMap(); data["content"] != "hi" {
+		t.Errorf("unexpected data %s", resp.Data)
+	}
+}
+
+func TestProxyLLMFallbacks(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Fallbacks []map[string]interface{} `json:"fallbacks"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body.Fallbacks) != 2 || body.Fallbacks[0]["target"] != "anthropic" || body.Fallbacks[0]["model"] != "claude-3-haiku" {
+			t.Errorf("fallbacks = %v", body.Fallbacks)
+		}
+		if _, ok := body.Fallbacks[1]["model"]; ok {
+			t.Errorf("empty model should be omitted: %v", body.Fallbacks[1])
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "hi"},
+			"meta": map[string]interface{}{
+				"request_id": "req_fb", "target": "anthropic", "served_by": "anthropic",
+				"fallback_used": true, "fallback_target": "anthropic",
+			},
+		})
+	})
+
+	resp, err := c.ProxyLLM(context.Background(), LLMRequest{
+		Target:    "openai",
+		Messages:  []ChatMessage{UserMessage("hello")},
+		Fallbacks: []FallbackTarget{{Target: "anthropic", Model: "claude-3-haiku"}, {Target: "mistral"}},
+	})
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if resp.Meta.ServedBy != "anthropic" || !resp.Meta.FallbackUsed {
+		t.Errorf("unexpected meta %+v", resp.Meta)
+	}
+}
+
+func TestProxyLLMFallbackResponse(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Fallback map[string]interface{} `json:"fallback_response"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		if body.Fallback["content"] != "The assistant is busy." {
+			t.Errorf("fallback_response = %v", body.Fallback)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"content": "The assistant is busy.", "role": "assistant", "finish_reason": "stop",
+				"usage": map[string]interface{}{"prompt_tokens": 0, "completion_tokens": 0, "total_tokens": 0},
+			},
+			"meta": map[string]interface{}{
+				"request_id": "req_fs", "target": "openai", "cost_usd": 0.0, "fallback_served": true,
+				"upstream_error": map[string]interface{}{
+					"type": "upstream_error", "code": "CIRCUIT_OPEN", "message": "circuit open",
+					"retryable": true, "status_code": 503, "target": "openai",
+				},
+			},
+		})
+	})
+
+	resp, err := c.ProxyLLM(context.Background(), LLMRequest{
+		Target:   "openai",
+		Messages: []ChatMessage{UserMessage("hello")},
+		Fallback: &FallbackResponse{Content: "The assistant is busy."},
+	})
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if !resp.Meta.FallbackServed || resp.Meta.CostUSD == nil || *resp.Meta.CostUSD != 0 {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+	if e := resp.Meta.UpstreamError; e == nil || e.Code != CodeCircuitOpen || e.StatusCode != 503 {
+		t.Errorf("upstream error = %+v", resp.Meta.UpstreamError)
+	}
+	text, err := resp.CompletionText()
+	if err != nil || text != "The assistant is busy." {
+		t.Errorf("CompletionText = %q, %v", text, err)
+	}
+}
+
+func TestProxyLLMCacheControls(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		vary, _ := body["cache_vary"].([]interface{})
+		if body["cache_key"] != "daily-summary" || len(vary) != 1 || vary[0] != "messages" {
+			t.Errorf("unexpected body %v", body)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{},
+			"meta":    map[string]interface{}{"request_id": "req_c", "cache_hit": true, "cache_key": "3f2a"},
+		})
+	})
+
+	key := "daily-summary"
+	resp, err := c.ProxyLLM(context.Background(), LLMRequest{Target: "openai", CacheKey: &key, CacheVary: []string{"messages"}})
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if resp.Meta.CacheKey != "3f2a" {
+		t.Errorf("cache_key = %q", resp.Meta.CacheKey)
+	}
+}
+
+func TestProxyLLMStaleIfError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body["cache_mode"] != "stale_if_error" {
+			t.Errorf("cache_mode = %v", body["cache_mode"])
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "yesterday's summary"},
+			"meta": map[string]interface{}{
+				"request_id": "req_s", "cache_hit": true, "stale": true, "cache_age_s": 5400,
+				"revalidation_error": map[string]interface{}{
+					"type": "upstream_error", "code": "SERVER_ERROR", "message": "upstream 503",
+					"retryable": true, "status_code": 503, "target": "openai",
+				},
+			},
+		})
+	})
+
+	resp, err := c.ProxyLLM(context.Background(), LLMRequest{Target: "openai", CacheMode: CacheStaleIfError})
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if !resp.Meta.Stale || resp.Meta.CacheAgeSeconds != 5400 {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+	revalErr := resp.Meta.RevalidationError
+	if revalErr == nil || revalErr.StatusCode != 503 || revalErr.Code != CodeServerError || !IsRetriable(revalErr) {
+		t.Errorf("revalidation error = %+v", revalErr)
+	}
+}
+
+func TestProxyLLMPriority(t *testing.T) {
+	var body map[string]interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["priority"] == PriorityBatch {
+			w.Header().Set("Retry-After", "2")
+			writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+				"success": false,
+				"error": map[string]interface{}{
+					"type": "rate_limit", "code": CodeQueueFull, "message": "Queue full (100 requests waiting)",
+					"retryable": true, "status_code": 429, "retry_after_s": 1.5,
+				},
+				"meta": map[string]interface{}{"request_id": "req_q2"},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "Hi"},
+			"meta":    map[string]interface{}{"request_id": "req_q1", "queue_wait_ms": 340},
+		})
+	})
+
+	resp, err := c.ProxyLLM(context.Background(), LLMRequest{Target: "openai", Priority: PriorityInteractive, QueueTimeoutMs: 2000})
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if body["priority"] != "interactive" || body["queue_timeout_ms"] != 2000.0 {
+		t.Errorf("body = %v", body)
+	}
+	if resp.Meta.QueueWaitMs != 340 {
+		t.Errorf("QueueWaitMs = %d", resp.Meta.QueueWaitMs)
+	}
+
+	_, err = c.ProxyLLM(context.Background(), LLMRequest{Target: "openai", Priority: PriorityBatch})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeQueueFull || apiErr.RetryAfter <= 0 || !IsRetriable(err) {
+		t.Errorf("queue full: err = %v", err)
+	}
+}
+
+func TestProxyLLMConcurrencyLimit(t *testing.T) {
+	var body map[string]interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["max_wait_ms"] == nil {
+			writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+				"success": false,
+				"error": map[string]interface{}{
+					"type": "concurrency_limit", "code": CodeConcurrencyLimit, "message": "No free slot within 10000 ms (8 requests in flight)",
+					"retryable": true, "status_code": 429,
+				},
+				"meta": map[string]interface{}{"request_id": "req_c2"},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "Hi"},
+			"meta":    map[string]interface{}{"request_id": "req_c1", "concurrency_wait_ms": 120},
+		})
+	})
+
+	resp, err := c.ProxyLLM(context.Background(), LLMRequest{Target: "openai", MaxWaitMs: 500})
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if body["max_wait_ms"] != 500.0 || resp.Meta.ConcurrencyWaitMs != 120 {
+		t.Errorf("body = %v, ConcurrencyWaitMs = %d", body, resp.Meta.ConcurrencyWaitMs)
+	}
+
+	_, err = c.ProxyLLM(context.Background(), LLMRequest{Target: "openai"})
+	if !IsConcurrencyLimit(err) || !IsRetriable(err) || IsCircuitOpen(err) {
+		t.Errorf("concurrency limit: err = %v", err)
+	}
+}
+
+func TestProxyLLMModelAlias(t *testing.T) {
+	var body map[string]interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "Hi"},
+			"meta": map[string]interface{}{
+				"request_id": "req_a1", "target": "openai", "model": "gpt-4.1-mini",
+				"resolved_target": "openai", "resolved_model": "gpt-4.1-mini",
+			},
+		})
+	})
+
+	resp, err := c.ProxyLLM(context.Background(), LLMRequest{Target: "openai", Model: AliasPrefix + "default-small"})
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if body["model"] != "alias:default-small" {
+		t.Errorf("model = %v", body["model"])
+	}
+	if resp.Meta.ResolvedTarget != "openai" || resp.Meta.ResolvedModel != "gpt-4.1-mini" {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+
+	c = newTestClient(t, sseHandler(t, []string{
+		"event: meta\ndata: {\"target\": \"anthropic\", \"request_id\": \"req_a2\", \"resolved_target\": \"anthropic\", \"resolved_model\": \"claude-3-5-haiku\"}\n\n",
+		"event: done\ndata: {\"finish_reason\": \"stop\"}\n\n",
+	}, false))
+	s, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai", Model: "default-small"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := collect(t, s); !errors.Is(err, io.EOF) {
+		t.Fatal(err)
+	}
+	if s.Meta().ResolvedTarget != "anthropic" || s.Meta().ResolvedModel != "claude-3-5-haiku" {
+		t.Errorf("stream meta = %+v", s.Meta())
+	}
+}
+
+func TestProxyHTTPUsesHTTPEndpoint(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/proxy/http" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"status_code": 200, "body": map[string]interface{}{"id": 1}},
+			"meta":    map[string]interface{}{"request_id": "req_2"},
+		})
+	})
+
+	resp, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "jsonplaceholder", Method: "GET", Path: "/posts/1"})
+	if err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	if resp.Meta.RequestID != "req_2" {
+		t.Errorf("request_id = %q", resp.Meta.RequestID)
+	}
+}
+
+func TestProxyHTTPResponseHeaders(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if want := []interface{}{"ETag", "Link"}; !reflect.DeepEqual(body["response_headers"], want) {
+			t.Errorf("response_headers = %v", body["response_headers"])
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"status_code": 200, "body": map[string]interface{}{}},
+			"meta": map[string]interface{}{
+				"request_id":      "req_h",
+				"upstream_status": 200,
+				"upstream_headers": map[string]interface{}{
+					"etag": []string{`"v1"`},
+					"link": []string{`</items?page=2>; rel="next"`, `</items?page=9>; rel="last"`},
+				},
+			},
+		})
+	})
+
+	resp, err := c.ProxyHTTP(context.Background(), HTTPRequest{
+		Target: "api", Method: "GET", Path: "/items", ResponseHeaders: []string{"ETag", "Link"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta.UpstreamStatus != 200 || len(resp.Meta.UpstreamHeaders["link"]) != 2 {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+	if got := resp.UpstreamHeader("ETag"); got != `"v1"` {
+		t.Errorf("ETag = %q", got)
+	}
+	if got := resp.UpstreamHeader("X-RateLimit-Remaining"); got != "" {
+		t.Errorf("uncaptured header = %q", got)
+	}
+}
+
+func TestProxyHTTPNotModified(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body["if_none_match"] != `W/"v1"` {
+			t.Errorf("if_none_match = %v", body["if_none_match"])
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{},
+			"meta": map[string]interface{}{
+				"request_id": "req_nm", "cache_hit": true, "revalidated": true,
+				"not_modified": true, "upstream_status": 304,
+			},
+		})
+	})
+
+	resp, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: "GET", Path: "/items", IfNoneMatch: `W/"v1"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Meta.NotModified || !resp.Meta.Revalidated || resp.Meta.UpstreamStatus != http.StatusNotModified {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+}
+
+func TestProxyHTTPRedirectPolicy(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		// An explicit zero overrides the target's policy, so it is sent
+		if body["follow_redirects"] != true || body["max_redirects"] != float64(0) {
+			t.Errorf("follow_redirects = %v, max_redirects = %v", body["follow_redirects"], body["max_redirects"])
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"status_code": 302,
+				"headers":     map[string]interface{}{"location": "https://cdn.example.com/items"},
+				"body":        map[string]interface{}{},
+			},
+			"meta": map[string]interface{}{"request_id": "req_r", "upstream_status": 302},
+		})
+	})
+
+	follow, limit := true, 0
+	resp, err := c.ProxyHTTP(context.Background(), HTTPRequest{
+		Target: "api", Method: "GET", Path: "/items", FollowRedirects: &follow, MaxRedirects: &limit,
+	})
+	if err != nil {
+		t.Fatalf("unfollowed redirect returned an error: %v", err)
+	}
+	if resp.Meta.UpstreamStatus != 302 || resp.Meta.RedirectChain != nil {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+
+	var meta Meta
+	if err := json.Unmarshal([]byte(`{"redirect_chain":["https://api.example.com/a","https://cdn.example.com/a"]}`), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.RedirectChain) != 2 || meta.RedirectChain[1] != "https://cdn.example.com/a" {
+		t.Errorf("RedirectChain = %v", meta.RedirectChain)
+	}
+}
+
+func TestRapidAPIHostSendsRapidAPIKey(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{}})
+	}))
+	defer srv.Close()
+
+	// Route a rapidapi-looking host to the test server.
+	transport := &http.Transport{}
+	transport.Proxy = func(*http.Request) (*url.URL, error) { return url.Parse(srv.URL) }
+	c, err := NewClient("http://reliapi.p.rapidapi.com", "rk", WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/"}); err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	if got.Get("X-RapidAPI-Key") != "rk" || got.Get("X-API-Key") != "rk" {
+		t.Errorf("auth headers = %v", got)
+	}
+}
+
+func TestErrorEnvelopeBecomesAPIError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"type":      "budget_error",
+				"code":      "BUDGET_EXCEEDED",
+				"message":   "Estimated cost exceeds hard cap",
+				"retryable": false,
+			},
+			"meta": map[string]interface{}{"request_id": "req_3"},
+		})
+	})
+
+	_, err := c.ProxyLLM(context.Background(), LLMRequest{Target: "openai"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *APIError, got %T %v", err, err)
+	}
+	if apiErr.StatusCode != 400 || apiErr.Code != "BUDGET_EXCEEDED" || apiErr.RequestID != "req_3" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestFastAPIDetailBecomesAPIError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"detail": map[string]interface{}{
+				"success": false,
+				"error":   map[string]interface{}{"type": "client_error", "code": "UNAUTHORIZED", "message": "Invalid API key"},
+			},
+		})
+	})
+
+	_, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "UNAUTHORIZED" || apiErr.StatusCode != 401 {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestNonJSONErrorBody(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "req_gw")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = io.WriteString(w, "<html>bad gateway</html>")
+	})
+
+	_, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *APIError, got %v", err)
+	}
+	if apiErr.StatusCode != 502 || apiErr.RequestID != "req_gw" || apiErr.Message == "" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	block := make(chan struct{})
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.ProxyLLM(ctx, LLMRequest{Target: "openai"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestCancelWhileReadingBody(t *testing.T) {
+	release := make(chan struct{})
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"success": true, "data": {`)
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := c.ProxyHTTP(ctx, HTTPRequest{Target: "t", Method: "GET", Path: "/"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCancelDuringRetryBackoff(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"detail": "down"})
+	}, WithRetry(5, time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := c.ProxyHTTP(ctx, HTTPRequest{Target: "t", Method: "GET", Path: "/"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("cancellation took %v", time.Since(start))
+	}
+}
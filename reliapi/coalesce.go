@@ -0,0 +1,296 @@
+package reliapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// LeaderErrorPolicy decides what coalesced followers receive when the call
+// they are waiting on fails.
+type LeaderErrorPolicy int
+
+const (
+	// ShareLeaderError hands the leader's error to every follower.
+	ShareLeaderError LeaderErrorPolicy = iota
+	// RetryAfterLeaderError makes followers try once more: one of them
+	// becomes the new leader and the rest wait on it. If that call fails as
+	// well, its error is shared.
+	RetryAfterLeaderError
+)
+
+// WithCoalescing makes concurrent identical cacheable requests share one
+// proxy call: the first caller (the leader) sends the request, and callers
+// that arrive while it is in flight (followers) wait and receive its
+// response with Meta.Coalesced set. Followers share a copy of the leader's
+// Data, so treat it as read-only; the leader's Release leaves it as it is.
+//
+// Cacheable requests are non-streaming ProxyLLM calls and GET/HEAD ProxyHTTP
+// calls. Requests are identical when the proxy would derive the same cache
+// key for them: CacheKey and CacheVary are honored, and fields outside the
+// key (idempotency key, Cache TTL, CacheMode, Fallbacks) are ignored, so a
+// follower's response carries the leader's IdempotencyKey. The proxy applies
+// target limits (e.g. a max_tokens cap) before hashing, which the client
+// cannot see; requests that only become identical after those limits are
+// not coalesced.
+//
+// onLeaderError picks what followers get when the leader fails. If the
+// leader's context is canceled, a waiting follower is promoted to leader
+// and sends the request itself.
+func WithCoalescing(onLeaderError LeaderErrorPolicy) Option {
+	return func(c *Client) {
+		c.coalesce = &coalescer{
+			onLeaderError: onLeaderError,
+			flights:       make(map[string]*flight),
+		}
+	}
+}
+
+type coalescer struct {
+	onLeaderError LeaderErrorPolicy
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is one in-progress call. Its fields are written by the leader
+// before done is closed.
+type flight struct {
+	done chan struct{}
+	resp *ReliAPIResponse
+	err  error
+	// abandoned is set when the leader's context ended the call, so the
+	// outcome says nothing about the request itself.
+	abandoned bool
+	// followers counts the callers waiting on the flight. Guarded by
+	// coalescer.mu.
+	followers int
+}
+
+// do runs fn once per key among concurrent callers and returns its result
+// to all of them.
+func (g *coalescer) do(ctx context.Context, key string, fn func(ctx context.Context) (*ReliAPIResponse, error)) (*ReliAPIResponse, error) {
+	retried := false
+	for {
+		g.mu.Lock()
+		f, ok := g.flights[key]
+		if !ok {
+			f = &flight{done: make(chan struct{})}
+			g.flights[key] = f
+			g.mu.Unlock()
+			return g.lead(ctx, key, f, fn)
+		}
+		f.followers++
+		g.mu.Unlock()
+
+		var err error
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-f.done:
+		}
+		g.mu.Lock()
+		f.followers--
+		g.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if f.abandoned {
+			continue
+		}
+		if f.err != nil {
+			if g.onLeaderError == RetryAfterLeaderError && !retried {
+				retried = true
+				continue
+			}
+			return nil, f.err
+		}
+		resp := *f.resp
+		resp.Meta.Coalesced = true
+		return &resp, nil
+	}
+}
+
+func (g *coalescer) lead(ctx context.Context, key string, f *flight, fn func(ctx context.Context) (*ReliAPIResponse, error)) (*ReliAPIResponse, error) {
+	defer close(f.done)
+	defer func() {
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+	}()
+
+	resp, err := fn(ctx)
+	if resp != nil {
+		// Followers copy from their own snapshot, so the leader's caller
+		// may modify or Release resp freely.
+		resp.detach()
+		shared := *resp
+		f.resp = &shared
+	}
+	f.err = err
+	f.abandoned = err != nil && ctx.Err() != nil
+	return resp, err
+}
+
+// coalesceKey identifies a request for coalescing by hashing ident, the
+// fields the proxy derives the request's cache key from.
+func coalesceKey(path string, ident map[string]interface{}) (string, bool) {
+	payload, err := json.Marshal(ident)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(append([]byte(path+"\n"), payload...))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// cacheIdent mirrors the proxy's cache key derivation (app/services.py
+// _cache_key_override): scope always participates; an explicit cache key
+// replaces fields, and cache_vary keeps only the listed ones. An empty
+// cacheVary is omitted from the request body, so like nil it selects the
+// default key.
+func cacheIdent(scope, fields map[string]interface{}, cacheKey *string, cacheVary []string) map[string]interface{} {
+	ident := make(map[string]interface{}, len(scope)+1)
+	for k, v := range scope {
+		ident[k] = v
+	}
+	switch {
+	case cacheKey != nil:
+		ident["cache_key"] = *cacheKey
+	case len(cacheVary) > 0:
+		vary := make(map[string]interface{}, len(cacheVary))
+		for _, name := range cacheVary {
+			vary[name] = fields[name]
+		}
+		ident["vary"] = vary
+	default:
+		ident["fields"] = fields
+	}
+	return ident
+}
+
+// llmCoalesceKey returns the coalescing key of req, or false if req is not
+// coalesced.
+func (c *Client) llmCoalesceKey(req LLMRequest) (string, bool) {
+	if c.coalesce == nil {
+		return "", false
+	}
+	return llmRequestKey(req)
+}
+
+// llmRequestKey hashes the fields the proxy derives req's cache key from,
+// or reports false if req is not cacheable.
+func llmRequestKey(req LLMRequest) (string, bool) {
+	// A comparison may be sampled out, so its response is not the answer
+	// to every identical request.
+	// A conversation turn's prompt is its stored history, which changes
+	// with every turn.
+	if req.DryRun || (req.Stream != nil && *req.Stream) || req.Compare != nil || req.ConversationID != nil {
+		return "", false
+	}
+	scope := map[string]interface{}{"target": req.Target, "model": req.Model}
+	if req.Template != nil {
+		// The latest version of a template may change under the key
+		if req.Template.Version == 0 {
+			return "", false
+		}
+		scope["template"] = req.Template
+	}
+	// The proxy scopes the key by these, so a plain answer is never shared
+	// with a request expecting a tool call.
+	if len(req.Tools) > 0 || req.ToolChoice != nil || req.ResponseFormat != nil {
+		scope["tools"] = []interface{}{req.Tools, req.ToolChoice, req.ResponseFormat}
+	}
+	if req.ValidateOutput && len(req.OutputSchema) > 0 {
+		scope["output_schema"] = req.OutputSchema
+	}
+	// Filtered responses are only shared with requests for the same fields.
+	if req.ResponseFilter != nil {
+		scope["response_filter"] = *req.ResponseFilter
+	}
+	// Raw bodies are kept under keys of their own.
+	if req.RawPassthrough {
+		scope["raw_passthrough"] = true
+	}
+	// A fitted answer, with its Meta.Adjustments, is not one for a request
+	// that must fail instead.
+	if req.Strict != nil && !*req.Strict {
+		scope["strict"] = false
+	}
+	fields := map[string]interface{}{
+		"messages":    cacheMessages(req.Messages),
+		"max_tokens":  req.MaxTokens,
+		"temperature": req.Temperature,
+		"top_p":       req.TopP,
+		"stop":        req.Stop,
+	}
+	return coalesceKey(llmProxyPath, cacheIdent(scope, fields, req.CacheKey, req.CacheVary))
+}
+
+// significantHeaders are the request headers the proxy includes in HTTP
+// cache keys (core/cache.py make_cache_key_hash).
+var significantHeaders = []string{"Accept", "Accept-Language", "Content-Type"}
+
+// httpCoalesceKey returns the coalescing key of req, or false if req is not
+// coalesced.
+func (c *Client) httpCoalesceKey(req HTTPRequest) (string, bool) {
+	if c.coalesce == nil {
+		return "", false
+	}
+	return httpRequestKey(req)
+}
+
+// httpRequestKey is llmRequestKey for an HTTPRequest.
+func httpRequestKey(req HTTPRequest) (string, bool) {
+	method := strings.ToUpper(req.Method)
+	if req.DryRun || req.Multipart != nil || (method != "GET" && method != "HEAD") {
+		return "", false
+	}
+	// The upstream URL, and so the path, is always part of the proxy's key.
+	scope := map[string]interface{}{"target": req.Target, "method": method, "path": req.Path}
+	// Callers capturing different headers, or holding different ETags, get
+	// different responses.
+	if len(req.ResponseHeaders) > 0 {
+		scope["response_headers"] = req.ResponseHeaders
+	}
+	if req.IfNoneMatch != "" {
+		scope["if_none_match"] = req.IfNoneMatch
+	}
+	if req.FollowRedirects != nil {
+		scope["follow_redirects"] = *req.FollowRedirects
+	}
+	if req.MaxRedirects != nil {
+		scope["max_redirects"] = *req.MaxRedirects
+	}
+	if req.ResponseFilter != nil {
+		scope["response_filter"] = *req.ResponseFilter
+	}
+	if req.RawPassthrough {
+		scope["raw_passthrough"] = true
+	}
+	// The proxy keys on the normalized query, so 10 and "10" coalesce.
+	query, _ := normalizeQuery(req.Query, req.QueryArrayFormat)
+	if req.CacheKey == nil && len(req.CacheVary) == 0 {
+		headers := make(map[string]string)
+		for _, h := range significantHeaders {
+			if v, ok := req.Headers[h]; ok {
+				headers[h] = v
+			}
+		}
+		fields := map[string]interface{}{"query": query, "headers": headers}
+		return coalesceKey(httpProxyPath, cacheIdent(scope, fields, nil, nil))
+	}
+	body := req.Body
+	if req.BodyBase64 != nil {
+		body = req.BodyBase64
+	}
+	fields := map[string]interface{}{
+		"path":    req.Path,
+		"query":   query,
+		"headers": req.Headers,
+		"body":    body,
+	}
+	return coalesceKey(httpProxyPath, cacheIdent(scope, fields, req.CacheKey, req.CacheVary))
+}
@@ -0,0 +1,270 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForFollowers blocks until n callers wait on the single in-flight call.
+func waitForFollowers(t *testing.T, c *Client, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.coalesce.mu.Lock()
+		waiting := 0
+		for _, f := range c.coalesce.flights {
+			waiting += f.followers
+		}
+		c.coalesce.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d followers", n)
+}
+
+func okLLMResponse(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    map[string]interface{}{"content": "shared"},
+		"meta":    map[string]interface{}{"request_id": "req_leader"},
+	})
+}
+
+func TestCoalescingSingleUpstreamCall(t *testing.T) {
+	const callers = 100
+	var calls atomic.Int32
+	release := make(chan struct{})
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		okLLMResponse(w)
+	}, WithCoalescing(ShareLeaderError), WithAutoIdempotency())
+
+	var wg sync.WaitGroup
+	results := make([]*ReliAPIResponse, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = c.ProxyLLM(context.Background(), llmReq("same question"))
+		}(i)
+	}
+	waitForFollowers(t, c, callers-1)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("upstream calls = %d, want 1", got)
+	}
+	coalesced := 0
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: %v", i, errs[i])
+		}
+		if results[i].Meta.RequestID != "req_leader" {
+			t.Errorf("caller %d got %+v", i, results[i].Meta)
+		}
+		if results[i].Meta.Coalesced {
+			coalesced++
+		}
+	}
+	if coalesced != callers-1 {
+		t.Errorf("coalesced = %d, want %d", coalesced, callers-1)
+	}
+
+	// Different requests are not coalesced.
+	if _, err := c.ProxyLLM(context.Background(), llmReq("other question")); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+}
+
+func TestCoalescingLeaderError(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		policy    LeaderErrorPolicy
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"share", ShareLeaderError, 1, true},
+		{"retry", RetryAfterLeaderError, 2, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			const callers = 10
+			var calls atomic.Int32
+			release := make(chan struct{})
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					<-release
+					writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+						"success": false,
+						"error":   map[string]interface{}{"type": "upstream_error", "code": "SERVER_ERROR", "message": "boom", "retryable": true},
+						"meta":    map[string]interface{}{"request_id": "req_fail"},
+					})
+					return
+				}
+				okLLMResponse(w)
+			}, WithCoalescing(tt.policy))
+
+			var wg sync.WaitGroup
+			errs := make([]error, callers)
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, errs[i] = c.ProxyLLM(context.Background(), llmReq("q"))
+				}(i)
+			}
+			waitForFollowers(t, c, callers-1)
+			close(release)
+			wg.Wait()
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+			failed := 0
+			for _, err := range errs {
+				if err != nil {
+					if !hasCode(err, CodeServerError) {
+						t.Errorf("err = %v", err)
+					}
+					failed++
+				}
+			}
+			// The leader always sees its own failure.
+			if want := map[bool]int{true: callers, false: 1}[tt.wantErr]; failed != want {
+				t.Errorf("failed callers = %d, want %d", failed, want)
+			}
+		})
+	}
+}
+
+func TestCoalescingPromotesFollowerWhenLeaderCanceled(t *testing.T) {
+	var calls atomic.Int32
+	leaderStarted := make(chan struct{})
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// Drain the body so the server notices the client going away.
+			_, _ = io.Copy(io.Discard, r.Body)
+			close(leaderStarted)
+			<-r.Context().Done()
+			return
+		}
+		okLLMResponse(w)
+	}, WithCoalescing(ShareLeaderError))
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := c.ProxyLLM(leaderCtx, llmReq("q"))
+		leaderErr <- err
+	}()
+	<-leaderStarted
+
+	followerResp := make(chan *ReliAPIResponse, 1)
+	followerErr := make(chan error, 1)
+	go func() {
+		resp, err := c.ProxyLLM(context.Background(), llmReq("q"))
+		followerResp <- resp
+		followerErr <- err
+	}()
+	waitForFollowers(t, c, 1)
+	cancel()
+
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader err = %v, want context.Canceled", err)
+	}
+	resp, err := <-followerResp, <-followerErr
+	if err != nil {
+		t.Fatalf("promoted follower: %v", err)
+	}
+	if resp.Meta.Coalesced {
+		t.Error("promoted follower made its own call but is marked coalesced")
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+}
+
+func TestCoalesceKeyFollowsCacheKey(t *testing.T) {
+	c, err := NewClient("", "k", WithCoalescing(ShareLeaderError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot, cold := 0.9, 0.1
+	a, b := llmReq("q"), llmReq("q")
+	a.Temperature, b.Temperature = &hot, &cold
+
+	keyA, _ := c.llmCoalesceKey(a)
+	keyB, _ := c.llmCoalesceKey(b)
+	if keyA == keyB {
+		t.Error("different temperatures coalesced without cache_vary")
+	}
+
+	// An empty CacheVary is dropped by omitempty; the proxy keys on every field.
+	a.CacheVary = []string{}
+	if keyA, _ = c.llmCoalesceKey(a); keyA == keyB {
+		t.Error("empty cache_vary coalesced different temperatures")
+	}
+
+	a.CacheVary, b.CacheVary = []string{"messages"}, []string{"messages", "messages"}
+	keyA, _ = c.llmCoalesceKey(a)
+	keyB, _ = c.llmCoalesceKey(b)
+	if keyA != keyB {
+		t.Error("cache_vary [messages] requests not coalesced")
+	}
+
+	// Fields outside the cache key do not split requests.
+	ttl, idem := 60, "explicit"
+	b.Cache, b.IdempotencyKey = &ttl, &idem
+	if keyB, _ = c.llmCoalesceKey(b); keyA != keyB {
+		t.Error("cache TTL or idempotency key changed the coalescing key")
+	}
+
+	// The proxy scopes even an explicit key by the tools.
+	a.CacheKey, b.CacheKey = &idem, &idem
+	b.Tools = []ToolDefinition{FunctionTool("lookup", "", nil)}
+	keyA, _ = c.llmCoalesceKey(a)
+	if keyB, _ = c.llmCoalesceKey(b); keyA == keyB {
+		t.Error("requests with tools coalesced with plain ones")
+	}
+
+	get := HTTPRequest{Target: "api", Method: "GET", Path: "/a", Headers: map[string]string{"X-Trace": "1"}}
+	other := get
+	other.Headers = map[string]string{"X-Trace": "2"}
+	k1, _ := c.httpCoalesceKey(get)
+	k2, _ := c.httpCoalesceKey(other)
+	if k1 != k2 {
+		t.Error("insignificant headers split HTTP requests")
+	}
+	other = get
+	other.IfNoneMatch = `W/"v1"`
+	if k3, _ := c.httpCoalesceKey(other); k3 == k1 {
+		t.Error("IfNoneMatch requests coalesced with unconditional ones")
+	}
+	other = get
+	other.RawPassthrough = true
+	if k5, _ := c.httpCoalesceKey(other); k5 == k1 {
+		t.Error("raw passthrough requests coalesced with plain ones")
+	}
+	other = get
+	follow := true
+	other.FollowRedirects = &follow
+	if k4, _ := c.httpCoalesceKey(other); k4 == k1 {
+		t.Error("requests with a redirect policy coalesced with ones using the target's")
+	}
+	if _, ok := c.httpCoalesceKey(HTTPRequest{Target: "api", Method: "POST", Path: "/a"}); ok {
+		t.Error("POST requests must not be coalesced")
+	}
+}
@@ -0,0 +1,46 @@
+package reliapi
+
+// CompareConfig is a variant of an LLMRequest the proxy runs beside it, so
+// two models, targets or prompt templates can be compared on live traffic.
+// Fields left empty are the request's own; a variant on another Target
+// uses that target's default model unless Model is set. At least one field
+// must be set.
+type CompareConfig struct {
+	Target string `json:"target,omitempty"`
+	// Model may be an "alias:" name of the variant's target.
+	Model string `json:"model,omitempty"`
+	// Template renders the variant's messages; without Variables it takes
+	// those of the request's Template.
+	Template *TemplateRef `json:"template,omitempty"`
+}
+
+// Comparison is the variant leg of a request sent with LLMRequest.Compare.
+type Comparison struct {
+	Target          string `json:"target"`
+	Model           string `json:"model"`
+	TemplateName    string `json:"template_name"`
+	TemplateVersion int    `json:"template_version"`
+	// Success reports whether the variant answered; Error says why not.
+	Success      bool   `json:"success"`
+	Content      string `json:"content"`
+	FinishReason string `json:"finish_reason"`
+	Usage        Usage  `json:"usage"`
+	// CostUSD is what the variant was charged, zero for a cache hit.
+	CostUSD    *float64 `json:"cost_usd,omitempty"`
+	DurationMs int      `json:"duration_ms"`
+	// CacheHit and CacheKey are the variant's own: either leg may be
+	// served from the cache without the other.
+	CacheHit bool   `json:"cache_hit"`
+	CacheKey string `json:"cache_key"`
+	// Similarity is how alike the two completions are, token by token,
+	// from 0 to 1 for identical ones. It is nil unless both legs succeeded.
+	Similarity *float64  `json:"similarity,omitempty"`
+	Error      *APIError `json:"error,omitempty"`
+}
+
+// Comparison returns the variant leg of a request sent with
+// LLMRequest.Compare, and false when there is none: the request had no
+// Compare, or CompareSampleRate left it out.
+func (r *ReliAPIResponse) Comparison() (*Comparison, bool) {
+	return r.Meta.Comparison, r.Meta.Comparison != nil
+}
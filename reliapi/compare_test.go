@@ -0,0 +1,91 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestComparison(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		raw, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &body)
+		compare, _ := body["compare"].(map[string]interface{})
+		if compare["model"] != "gpt-4o" || compare["target"] != nil || body["compare_sample_rate"] != 0.25 {
+			t.Errorf("body = %v", body)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "The capital is Paris."},
+			"meta": map[string]interface{}{
+				"request_id": "req_1", "target": "openai", "cache_hit": true,
+				"comparison": map[string]interface{}{
+					"target": "openai", "model": "gpt-4o", "success": true,
+					"content": "The capital is Lyon.", "finish_reason": "stop",
+					"usage":    map[string]interface{}{"prompt_tokens": 4, "completion_tokens": 5, "total_tokens": 9},
+					"cost_usd": 0.002, "duration_ms": 340, "cache_hit": false, "cache_key": "k2",
+					"similarity": 0.8,
+				},
+			},
+		})
+	})
+
+	req := llmReq("capital?")
+	req.Compare = &CompareConfig{Model: "gpt-4o"}
+	req.CompareSampleRate = 0.25
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	cmp, ok := resp.Comparison()
+	if !ok {
+		t.Fatal("no comparison")
+	}
+	if cmp.Model != "gpt-4o" || cmp.Content != "The capital is Lyon." || cmp.Usage.TotalTokens != 9 {
+		t.Errorf("comparison = %+v", cmp)
+	}
+	if cmp.CacheHit || !resp.Meta.CacheHit {
+		t.Errorf("cache hits not reported per leg: %v, %v", resp.Meta.CacheHit, cmp.CacheHit)
+	}
+	if cmp.Similarity == nil || *cmp.Similarity != 0.8 || cmp.CostUSD == nil || *cmp.CostUSD != 0.002 {
+		t.Errorf("similarity = %v, cost = %v", cmp.Similarity, cmp.CostUSD)
+	}
+}
+
+func TestComparisonFailedVariant(t *testing.T) {
+	var resp ReliAPIResponse
+	raw := `{"success": true, "data": {}, "meta": {"request_id": "req_1", "comparison": {
+		"target": "anthropic", "success": false, "duration_ms": 20,
+		"error": {"type": "upstream_error", "code": "UPSTREAM_TIMEOUT", "message": "boom", "retryable": true, "status_code": 504}}}}`
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		t.Fatal(err)
+	}
+	cmp, ok := resp.Comparison()
+	if !ok || cmp.Success || cmp.Similarity != nil {
+		t.Fatalf("comparison = %+v", cmp)
+	}
+	if cmp.Error == nil || cmp.Error.Code != CodeUpstreamTimeout || cmp.Error.StatusCode != 504 {
+		t.Errorf("error = %+v", cmp.Error)
+	}
+	if _, ok := (&ReliAPIResponse{}).Comparison(); ok {
+		t.Error("comparison without Compare")
+	}
+}
+
+func TestCompareNotCoalesced(t *testing.T) {
+	c, err := NewClient("", "k", WithCoalescing(ShareLeaderError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := llmReq("q")
+	if _, ok := c.llmCoalesceKey(req); !ok {
+		t.Fatal("plain request not coalesced")
+	}
+	req.Compare = &CompareConfig{Target: "anthropic"}
+	if _, ok := c.llmCoalesceKey(req); ok {
+		t.Error("compare request coalesced")
+	}
+}
@@ -0,0 +1,293 @@
+package reliapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNoChoices is returned by Completion and CompletionText when the
+// response decodes as a completion but carries no choices.
+var ErrNoChoices = errors.New("reliapi: completion has no choices")
+
+// ChatCompletion is a provider-neutral view of an LLM response.
+type ChatCompletion struct {
+	Model        string
+	Choices      []Choice
+	Usage        Usage
+	FinishReason string
+	// ProviderMeta is the provider's metadata for the response, such as the
+	// served model snapshot.
+	ProviderMeta ProviderMeta
+}
+
+// Choice is one generated alternative. ToolCalls lists the functions the
+// model called, in order; Message holds them too, so it can be appended to
+// the conversation as it is. Logprobs has a TokenLogprob per generated
+// token when the request set LLMRequest.Logprobs.
+type Choice struct {
+	Index        int
+	Message      ChatMessage
+	ToolCalls    []ToolCall
+	FinishReason string
+	Logprobs     []TokenLogprob
+}
+
+// ToolCall is a function call requested by the model. A refusal to call
+// any tool is an answer without ToolCalls.
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall names the function and its JSON-encoded arguments, as the
+// model wrote them: decode Arguments yourself, and expect it to be invalid
+// on occasion.
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Usage reports token counts for a completion.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Completion decodes Data into a ChatCompletion.
+//
+// It understands the proxy's normalized /proxy/llm payload
+// ({content, role, finish_reason, usage}) as well as raw OpenAI
+// chat.completion and text_completion, Anthropic message and Gemini
+// generateContent bodies, either directly in Data or wrapped in a
+// /proxy/http {status_code, headers, body} result.
+func (r *ReliAPIResponse) Completion() (*ChatCompletion, error) {
+	c, err := decodeCompletion(r.Data)
+	if err != nil {
+		return nil, err
+	}
+	if c.Model == "" {
+		c.Model = r.Meta.Model
+	}
+	if len(c.Choices) == 0 {
+		return c, ErrNoChoices
+	}
+	if c.FinishReason == "" {
+		c.FinishReason = c.Choices[0].FinishReason
+	}
+	return c, nil
+}
+
+// CompletionText returns the text of the first choice. A response that only
+// contains tool calls yields "" and a nil error; inspect Completion().Choices
+// for the calls.
+func (r *ReliAPIResponse) CompletionText() (string, error) {
+	c, err := r.Completion()
+	if err != nil {
+		return "", err
+	}
+	return c.Choices[0].text(), nil
+}
+
+// DecodeJSON unmarshals the text of the choice into v, for a request with
+// a "json_object" or "json_schema" ResponseFormat. Output the model cut
+// short or refused to give fails to decode; FinishReason tells them apart.
+func (ch Choice) DecodeJSON(v interface{}) error {
+	if err := json.Unmarshal([]byte(ch.text()), v); err != nil {
+		return fmt.Errorf("reliapi: decode choice %d: %w", ch.Index, err)
+	}
+	return nil
+}
+
+// text is the content of the choice's message, or its text parts joined.
+func (ch Choice) text() string {
+	msg := ch.Message
+	if msg.Content == "" {
+		for _, part := range msg.Parts {
+			if part.Type == "text" {
+				msg.Content += part.Text
+			}
+		}
+	}
+	return msg.Content
+}
+
+// completionPayload is the union of the shapes Completion understands.
+type completionPayload struct {
+	// OpenAI
+	Model   string `json:"model"`
+	Choices []struct {
+		Index   int `json:"index"`
+		Message struct {
+			Role      string          `json:"role"`
+			Content   json.RawMessage `json:"content"`
+			Name      string          `json:"name"`
+			ToolCalls []ToolCall      `json:"tool_calls"`
+		} `json:"message"`
+		// Legacy completions
+		Text         *string       `json:"text"`
+		FinishReason string        `json:"finish_reason"`
+		Logprobs     tokenLogprobs `json:"logprobs"`
+	} `json:"choices"`
+
+	// ReliAPI normalized (content is a string) or Anthropic (content is an
+	// array of blocks).
+	Content      json.RawMessage `json:"content"`
+	Role         string          `json:"role"`
+	FinishReason string          `json:"finish_reason"`
+	StopReason   string          `json:"stop_reason"`
+	// ReliAPI normalized
+	ToolCalls []ToolCall    `json:"tool_calls"`
+	Logprobs  tokenLogprobs `json:"logprobs"`
+
+	Usage struct {
+		Usage
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+
+	// Gemini
+	Candidates []struct {
+		Content struct {
+			Role  string `json:"role"`
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+		Index        int    `json:"index"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+
+	// /proxy/http wrapper
+	StatusCode *int            `json:"status_code"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type anthropicBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text"`
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+func decodeCompletion(raw []byte) (*ChatCompletion, error) {
+	var p completionPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("reliapi: data is not a completion: %w", err)
+	}
+	if p.StatusCode != nil && len(p.Body) > 0 && p.Choices == nil && p.Content == nil {
+		return decodeCompletion(p.Body)
+	}
+
+	c := &ChatCompletion{Model: p.Model, FinishReason: p.FinishReason, ProviderMeta: decodeProviderMeta(raw)}
+	if c.Model == "" {
+		c.Model = c.ProviderMeta.Model
+	}
+	c.Usage = p.Usage.Usage
+	if c.Usage.PromptTokens == 0 && c.Usage.CompletionTokens == 0 {
+		c.Usage.PromptTokens = p.Usage.InputTokens
+		c.Usage.CompletionTokens = p.Usage.OutputTokens
+	}
+	if c.Usage.PromptTokens == 0 && c.Usage.CompletionTokens == 0 {
+		c.Usage.PromptTokens = p.UsageMetadata.PromptTokenCount
+		c.Usage.CompletionTokens = p.UsageMetadata.CandidatesTokenCount
+		c.Usage.TotalTokens = p.UsageMetadata.TotalTokenCount
+	}
+	if c.Usage.TotalTokens == 0 {
+		c.Usage.TotalTokens = c.Usage.PromptTokens + c.Usage.CompletionTokens
+	}
+
+	switch {
+	case p.Choices != nil:
+		for _, ch := range p.Choices {
+			msg := ChatMessage{Role: ch.Message.Role, Name: ch.Message.Name}
+			if err := decodeContent(ch.Message.Content, &msg); err != nil {
+				return nil, err
+			}
+			if ch.Text != nil && ch.Message.Content == nil {
+				msg = ChatMessage{Role: RoleAssistant, Content: *ch.Text}
+			}
+			msg.ToolCalls = ch.Message.ToolCalls
+			c.Choices = append(c.Choices, Choice{
+				Index:        ch.Index,
+				Message:      msg,
+				ToolCalls:    ch.Message.ToolCalls,
+				FinishReason: ch.FinishReason,
+				Logprobs:     ch.Logprobs,
+			})
+		}
+	case p.Candidates != nil:
+		for _, cand := range p.Candidates {
+			msg := ChatMessage{Role: RoleAssistant}
+			for _, part := range cand.Content.Parts {
+				msg.Content += part.Text
+			}
+			c.Choices = append(c.Choices, Choice{Index: cand.Index, Message: msg, FinishReason: cand.FinishReason})
+		}
+	case len(p.Content) > 0 && p.Content[0] == '[':
+		var blocks []anthropicBlock
+		if err := json.Unmarshal(p.Content, &blocks); err != nil {
+			return nil, fmt.Errorf("reliapi: decode content blocks: %w", err)
+		}
+		if len(blocks) == 0 {
+			break
+		}
+		role := p.Role
+		if role == "" {
+			role = RoleAssistant
+		}
+		choice := Choice{Message: ChatMessage{Role: role}, FinishReason: p.StopReason}
+		for _, b := range blocks {
+			switch b.Type {
+			case "text":
+				choice.Message.Content += b.Text
+			case "tool_use":
+				choice.ToolCalls = append(choice.ToolCalls, ToolCall{
+					ID:       b.ID,
+					Type:     "function",
+					Function: FunctionCall{Name: b.Name, Arguments: string(b.Input)},
+				})
+			}
+		}
+		choice.Message.ToolCalls = choice.ToolCalls
+		c.Choices = []Choice{choice}
+		if c.FinishReason == "" {
+			c.FinishReason = p.StopReason
+		}
+	case len(p.Content) > 0:
+		// The proxy's adapters normalize an empty provider response to
+		// {content: "", finish_reason: "error"}.
+		if string(p.Content) == `""` && p.FinishReason == "error" {
+			break
+		}
+		msg := ChatMessage{Role: p.Role}
+		if msg.Role == "" {
+			msg.Role = RoleAssistant
+		}
+		if err := decodeContent(p.Content, &msg); err != nil {
+			return nil, err
+		}
+		msg.ToolCalls = p.ToolCalls
+		c.Choices = []Choice{{Message: msg, ToolCalls: p.ToolCalls, FinishReason: p.FinishReason, Logprobs: p.Logprobs}}
+	}
+	return c, nil
+}
+
+// decodeContent fills msg.Content or msg.Parts from a raw content value.
+func decodeContent(raw json.RawMessage, msg *ChatMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if raw[0] == '[' {
+		return json.Unmarshal(raw, &msg.Parts)
+	}
+	return json.Unmarshal(raw, &msg.Content)
+}
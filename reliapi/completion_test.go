@@ -0,0 +1,434 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func loadFixture(t *testing.T, name string) interface{} {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		t.Fatalf("fixture %s: %v", name, err)
+	}
+	return v
+}
+
+// rawData returns v as the Data of a response.
+func rawData(t *testing.T, v interface{}) json.RawMessage {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestCompletion(t *testing.T) {
+	envelope := func(t *testing.T) *ReliAPIResponse {
+		raw, err := os.ReadFile(filepath.Join("testdata", "reliapi_llm_response.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp ReliAPIResponse
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return &resp
+	}
+
+	tests := []struct {
+		name         string
+		resp         func(t *testing.T) *ReliAPIResponse
+		wantText     string
+		wantModel    string
+		wantFinish   string
+		wantUsage    Usage
+		wantToolCall string
+		wantErr      error
+	}{
+		{
+			name:       "reliapi normalized",
+			resp:       envelope,
+			wantText:   "Idempotency means repeating a request has the same effect as making it once.",
+			wantModel:  "gpt-4o-mini",
+			wantFinish: "stop",
+			wantUsage:  Usage{PromptTokens: 19, CompletionTokens: 16, TotalTokens: 35},
+		},
+		{
+			name: "openai chat completion",
+			resp: func(t *testing.T) *ReliAPIResponse {
+				return &ReliAPIResponse{Data: rawData(t, loadFixture(t, "openai_chat_completion.json"))}
+			},
+			wantText:   "Idempotency means repeating a request has the same effect as making it once.",
+			wantModel:  "gpt-4o-mini-2024-07-18",
+			wantFinish: "stop",
+			wantUsage:  Usage{PromptTokens: 19, CompletionTokens: 16, TotalTokens: 35},
+		},
+		{
+			name: "openai tool calls",
+			resp: func(t *testing.T) *ReliAPIResponse {
+				return &ReliAPIResponse{Data: rawData(t, loadFixture(t, "openai_tool_calls.json"))}
+			},
+			wantText:     "",
+			wantModel:    "gpt-4o-mini-2024-07-18",
+			wantFinish:   "tool_calls",
+			wantUsage:    Usage{PromptTokens: 61, CompletionTokens: 17, TotalTokens: 78},
+			wantToolCall: "get_weather",
+		},
+		{
+			name: "anthropic message",
+			resp: func(t *testing.T) *ReliAPIResponse {
+				return &ReliAPIResponse{Data: rawData(t, loadFixture(t, "anthropic_message.json"))}
+			},
+			wantText:   "A circuit breaker stops calls to a failing dependency until it recovers.",
+			wantModel:  "claude-3-haiku-20240307",
+			wantFinish: "end_turn",
+			wantUsage:  Usage{PromptTokens: 14, CompletionTokens: 18, TotalTokens: 32},
+		},
+		{
+			name: "anthropic tool use",
+			resp: func(t *testing.T) *ReliAPIResponse {
+				return &ReliAPIResponse{Data: rawData(t, loadFixture(t, "anthropic_tool_use.json"))}
+			},
+			wantText:     "Let me check the weather.",
+			wantModel:    "claude-3-5-sonnet-20240620",
+			wantFinish:   "tool_use",
+			wantUsage:    Usage{PromptTokens: 384, CompletionTokens: 52, TotalTokens: 436},
+			wantToolCall: "get_weather",
+		},
+		{
+			name: "openai text completion",
+			resp: func(t *testing.T) *ReliAPIResponse {
+				return &ReliAPIResponse{Data: rawData(t, loadFixture(t, "openai_text_completion.json"))}
+			},
+			wantText:   "Retries are safe when the operation is idempotent.",
+			wantModel:  "gpt-3.5-turbo-instruct",
+			wantFinish: "stop",
+			wantUsage:  Usage{PromptTokens: 8, CompletionTokens: 10, TotalTokens: 18},
+		},
+		{
+			name: "gemini generate content",
+			resp: func(t *testing.T) *ReliAPIResponse {
+				return &ReliAPIResponse{Data: rawData(t, loadFixture(t, "gemini_generate_content.json"))}
+			},
+			wantText:   "Backoff spaces out retries so a struggling server can recover.",
+			wantModel:  "gemini-1.5-flash-002",
+			wantFinish: "STOP",
+			wantUsage:  Usage{PromptTokens: 9, CompletionTokens: 13, TotalTokens: 22},
+		},
+		{
+			name: "openai via http proxy",
+			resp: func(t *testing.T) *ReliAPIResponse {
+				return &ReliAPIResponse{Data: rawData(t, map[string]interface{}{
+					"status_code": 200,
+					"headers":     map[string]interface{}{"content-type": "application/json"},
+					"body":        loadFixture(t, "openai_chat_completion.json"),
+				})}
+			},
+			wantText:   "Idempotency means repeating a request has the same effect as making it once.",
+			wantModel:  "gpt-4o-mini-2024-07-18",
+			wantFinish: "stop",
+			wantUsage:  Usage{PromptTokens: 19, CompletionTokens: 16, TotalTokens: 35},
+		},
+		{
+			name: "openai empty choices",
+			resp: func(t *testing.T) *ReliAPIResponse {
+				return &ReliAPIResponse{Data: rawData(t, loadFixture(t, "openai_empty_choices.json"))}
+			},
+			wantErr: ErrNoChoices,
+		},
+		{
+			name: "reliapi normalized empty",
+			resp: func(t *testing.T) *ReliAPIResponse {
+				return &ReliAPIResponse{Data: json.RawMessage(`{"content": "", "finish_reason": "error"}`)}
+			},
+			wantErr: ErrNoChoices,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.resp(t)
+			text, err := resp.CompletionText()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompletionText: %v", err)
+			}
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+
+			c, err := resp.Completion()
+			if err != nil {
+				t.Fatalf("Completion: %v", err)
+			}
+			if c.Model != tt.wantModel {
+				t.Errorf("model = %q, want %q", c.Model, tt.wantModel)
+			}
+			if c.FinishReason != tt.wantFinish {
+				t.Errorf("finish_reason = %q, want %q", c.FinishReason, tt.wantFinish)
+			}
+			if c.Usage != tt.wantUsage {
+				t.Errorf("usage = %+v, want %+v", c.Usage, tt.wantUsage)
+			}
+			if tt.wantToolCall != "" {
+				calls := c.Choices[0].ToolCalls
+				if len(calls) != 1 || calls[0].Function.Name != tt.wantToolCall {
+					t.Errorf("tool calls = %+v", calls)
+				}
+				if calls[0].Function.Arguments == "" {
+					t.Errorf("tool call arguments missing")
+				}
+			}
+		})
+	}
+}
+
+func TestCompletionToolCalls(t *testing.T) {
+	envelope := func(t *testing.T, name string) *ReliAPIResponse {
+		raw, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp ReliAPIResponse
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return &resp
+	}
+	parallel := []ToolCall{
+		{ID: "call_berlin", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Berlin"}`}},
+		{ID: "call_paris", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+	}
+
+	tests := []struct {
+		name     string
+		resp     *ReliAPIResponse
+		wantText string
+		wantCall []ToolCall
+	}{
+		{
+			name:     "openai parallel",
+			resp:     &ReliAPIResponse{Data: rawData(t, loadFixture(t, "openai_parallel_tool_calls.json"))},
+			wantCall: parallel,
+		},
+		{
+			name:     "reliapi normalized parallel",
+			resp:     envelope(t, "reliapi_llm_tool_calls.json"),
+			wantCall: parallel,
+		},
+		{
+			name:     "openai refusal",
+			resp:     &ReliAPIResponse{Data: rawData(t, loadFixture(t, "openai_tool_refusal.json"))},
+			wantText: "I can only look up the weather for real cities, and Atlantis isn't one.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.resp.Completion()
+			if err != nil {
+				t.Fatal(err)
+			}
+			choice := c.Choices[0]
+			if !reflect.DeepEqual(choice.ToolCalls, tt.wantCall) {
+				t.Errorf("ToolCalls = %+v, want %+v", choice.ToolCalls, tt.wantCall)
+			}
+			// The message can go back into the conversation as it is.
+			if !reflect.DeepEqual(choice.Message.ToolCalls, tt.wantCall) {
+				t.Errorf("Message.ToolCalls = %+v, want %+v", choice.Message.ToolCalls, tt.wantCall)
+			}
+			if choice.Message.Content != tt.wantText {
+				t.Errorf("text = %q, want %q", choice.Message.Content, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestCompletionProviderMeta(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    func(t *testing.T) interface{}
+		want    ProviderMeta
+		wantRaw []string
+	}{
+		{
+			name: "openai",
+			data: func(t *testing.T) interface{} { return loadFixture(t, "openai_chat_completion.json") },
+			want: ProviderMeta{ID: "chatcmpl-9xK2mQ1ZlR7vYwq3", Model: "gpt-4o-mini-2024-07-18", SystemFingerprint: "fp_48196bc67a"},
+		},
+		{
+			name: "anthropic",
+			data: func(t *testing.T) interface{} { return loadFixture(t, "anthropic_stop_sequence.json") },
+			want: ProviderMeta{ID: "msg_01Q8Faay6S7QPTvEUUQARt7h", Model: "claude-3-5-sonnet-20240620", StopSequence: "\n3."},
+		},
+		{
+			name: "gemini",
+			data: func(t *testing.T) interface{} { return loadFixture(t, "gemini_generate_content.json") },
+			want: ProviderMeta{
+				ID:    "8aG2Zq3dLcqn1MkP7Y2W-AQ",
+				Model: "gemini-1.5-flash-002",
+				SafetyRatings: []SafetyRating{
+					{Category: "HARM_CATEGORY_HARASSMENT", Probability: "NEGLIGIBLE"},
+					{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Probability: "LOW"},
+				},
+			},
+		},
+		{
+			// A changed system_fingerprint and an unknown service_tier must
+			// not break decoding.
+			name:    "openai novel fields",
+			data:    func(t *testing.T) interface{} { return loadFixture(t, "openai_novel_fields.json") },
+			want:    ProviderMeta{ID: "chatcmpl-A1b2C3d4E5f6G7h8", Model: "gpt-4o-2024-08-06"},
+			wantRaw: []string{"service_tier", "system_fingerprint"},
+		},
+		{
+			name: "reliapi normalized",
+			data: func(t *testing.T) interface{} {
+				return map[string]interface{}{
+					"content":       "ok",
+					"finish_reason": "stop",
+					"provider_meta": map[string]interface{}{
+						"id":                 "chatcmpl-1",
+						"model":              "gpt-4o-mini-2024-07-18",
+						"system_fingerprint": "fp_1",
+						"logprobs_version":   2,
+					},
+				}
+			},
+			want:    ProviderMeta{ID: "chatcmpl-1", Model: "gpt-4o-mini-2024-07-18", SystemFingerprint: "fp_1"},
+			wantRaw: []string{"logprobs_version"},
+		},
+		{
+			name: "reliapi normalized gemini",
+			data: func(t *testing.T) interface{} {
+				return map[string]interface{}{
+					"content":       "ok",
+					"finish_reason": "stop",
+					"provider_meta": map[string]interface{}{
+						"id":            "resp_1",
+						"model":         "gemini-1.5-flash-002",
+						"finishReason":  "STOP",
+						"safetyRatings": []interface{}{map[string]interface{}{"category": "HARM_CATEGORY_HARASSMENT", "probability": "NEGLIGIBLE"}},
+					},
+				}
+			},
+			want: ProviderMeta{
+				ID:            "resp_1",
+				Model:         "gemini-1.5-flash-002",
+				SafetyRatings: []SafetyRating{{Category: "HARM_CATEGORY_HARASSMENT", Probability: "NEGLIGIBLE"}},
+			},
+			wantRaw: []string{"finishReason"},
+		},
+		{
+			name: "malformed safety ratings",
+			data: func(t *testing.T) interface{} {
+				return map[string]interface{}{
+					"candidates": []interface{}{map[string]interface{}{
+						"content":       map[string]interface{}{"parts": []interface{}{map[string]interface{}{"text": "ok"}}},
+						"safetyRatings": map[string]interface{}{"HARASSMENT": "LOW"},
+					}},
+				}
+			},
+			wantRaw: []string{"safetyRatings"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &ReliAPIResponse{Data: rawData(t, tt.data(t))}
+			c, err := resp.Completion()
+			if err != nil {
+				t.Fatalf("Completion: %v", err)
+			}
+			got := c.ProviderMeta
+			raw := got.Raw
+			got.Raw, got.CitationMetadata = nil, nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProviderMeta = %+v, want %+v", got, tt.want)
+			}
+			var rawKeys []string
+			for k := range raw {
+				rawKeys = append(rawKeys, k)
+			}
+			sort.Strings(rawKeys)
+			if !reflect.DeepEqual(rawKeys, tt.wantRaw) {
+				t.Errorf("Raw keys = %v, want %v", rawKeys, tt.wantRaw)
+			}
+		})
+	}
+}
+
+func TestCompletionProviderMetaCitations(t *testing.T) {
+	resp := &ReliAPIResponse{Data: rawData(t, loadFixture(t, "gemini_generate_content.json"))}
+	c, err := resp.Completion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var citations struct {
+		CitationSources []struct {
+			URI string `json:"uri"`
+		} `json:"citationSources"`
+	}
+	if err := json.Unmarshal(c.ProviderMeta.CitationMetadata, &citations); err != nil {
+		t.Fatalf("CitationMetadata %s: %v", c.ProviderMeta.CitationMetadata, err)
+	}
+	if len(citations.CitationSources) != 1 || citations.CitationSources[0].URI != "https://example.com/backoff" {
+		t.Errorf("citations = %+v", citations)
+	}
+}
+
+func TestCompletionIncludeRaw(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["include_raw"] != true {
+			t.Errorf("include_raw = %v", body["include_raw"])
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "normalized", "finish_reason": "stop"},
+			"meta": map[string]interface{}{
+				"request_id": "req_1", "provider": "gemini",
+				"raw_provider_response": loadFixture(t, "gemini_generate_content.json"),
+			},
+		})
+	})
+	req := LLMRequest{Target: "gemini", Messages: []ChatMessage{UserMessage("hi")}, IncludeRaw: true}
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := resp.CompletionText(); text != "normalized" {
+		t.Errorf("CompletionText = %q", text)
+	}
+	// The raw payload decodes as the provider's own body
+	raw := &ReliAPIResponse{Data: resp.Meta.RawProviderResponse}
+	completion, err := raw.Completion()
+	if err != nil || completion.ProviderMeta.Model != "gemini-1.5-flash-002" {
+		t.Errorf("raw Completion = %+v, %v", completion, err)
+	}
+
+	req.IncludeRaw = false
+	if body, _ := json.Marshal(req); strings.Contains(string(body), "include_raw") {
+		t.Errorf("include_raw sent unset: %s", body)
+	}
+}
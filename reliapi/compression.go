@@ -0,0 +1,111 @@
+package reliapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultCompressionThreshold is the request body size from which
+// WithCompression gzips it when given a threshold of 0.
+const DefaultCompressionThreshold = 1 << 10
+
+// WithCompression gzips request bodies of at least threshold bytes
+// (DefaultCompressionThreshold if 0 or less) and asks the proxy for gzipped
+// JSON responses, which are decompressed before they are decoded; the sizes
+// before and after are on Meta.CompressedBytes and Meta.UncompressedBytes.
+// Only the bodies of ProxyHTTP, ProxyLLM, ProxyLLMStream and SubmitLLM
+// are compressed, the ones the proxy decodes; streamed responses and
+// multipart file uploads never are.
+func WithCompression(threshold int) Option {
+	return func(c *Client) {
+		if threshold <= 0 {
+			threshold = DefaultCompressionThreshold
+		}
+		c.compressThreshold = threshold
+	}
+}
+
+// gzipPayload is a request body already gzipped by compress.
+type gzipPayload []byte
+
+func (p gzipPayload) open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(p)), nil
+}
+
+// compressedPaths are the endpoints whose request bodies the proxy decodes
+// (COMPRESSED_REQUEST_PATHS in core/compression.py); other endpoints would
+// fail to parse a gzipped body.
+var compressedPaths = map[string]bool{httpProxyPath: true, llmProxyPath: true}
+
+// compress returns payload gzipped, or zstd-compressed with the client's
+// dictionary, when compression is on and it is a JSON body over the
+// threshold sent to one of compressedPaths, and payload unchanged otherwise. It runs once per call, so retries resend the same
+// compressed bytes.
+func (c *Client) compress(path string, payload payload) (payload, error) {
+	raw, ok := payload.(bytesPayload)
+	if !ok || c.compressThreshold == 0 || len(raw) < c.compressThreshold {
+		return payload, nil
+	}
+	if p, _, _ := strings.Cut(path, "?"); !compressedPaths[p] {
+		return payload, nil
+	}
+	if d := c.compressDict; d != nil && !d.rejected.Load() {
+		return zstdPayload(d.enc.EncodeAll(raw, nil)), nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, fmt.Errorf("reliapi: compress request: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("reliapi: compress request: %w", err)
+	}
+	return gzipPayload(buf.Bytes()), nil
+}
+
+// setAcceptEncoding asks for a gzipped response to a JSON request when
+// compression is on, and for an unencoded one to a streaming request, which
+// a proxy buffering gzip output would otherwise hold back.
+func (c *Client) setAcceptEncoding(req *http.Request, accept string) {
+	if c.compressThreshold == 0 {
+		return
+	}
+	if accept == "application/json" {
+		req.Header.Set("Accept-Encoding", "gzip")
+	} else {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+}
+
+// decodedBody returns the body of resp, decompressed if the proxy gzipped
+// it. The counter reports the compressed bytes read, 0 if resp wasn't
+// compressed; the client's response size limit applies to the decompressed
+// body. Setting Accept-Encoding ourselves turns off net/http's own
+// transparent decompression, so this is the only place it happens.
+func decodedBody(resp *http.Response) (io.Reader, *countingReader, error) {
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return resp.Body, &countingReader{}, nil
+	}
+	cr := &countingReader{r: resp.Body}
+	zr, err := gzip.NewReader(cr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reliapi: decompress response: %w", err)
+	}
+	return zr, cr, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,148 @@
+package reliapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	big := strings.Repeat("hello ", 500)
+	var gotEncoding, gotAcceptEncoding string
+	var gotReq LLMRequest
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding, gotAcceptEncoding = r.Header.Get("Content-Encoding"), r.Header.Get("Accept-Encoding")
+		body := io.Reader(r.Body)
+		if gotEncoding == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Fatalf("request body: %v", err)
+			}
+			body = zr
+		}
+		if err := json.NewDecoder(body).Decode(&gotReq); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		resp, _ := json.Marshal(map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": big},
+			"meta":    map[string]interface{}{"request_id": "req_1"},
+		})
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(resp)
+		zw.Close()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(buf.Bytes())
+	}, WithCompression(0))
+
+	resp, err := c.ProxyLLM(context.Background(), llmReq(big))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if gotEncoding != "gzip" || gotAcceptEncoding != "gzip" || gotReq.Messages[0].Content != big {
+		t.Errorf("Content-Encoding = %q, Accept-Encoding = %q", gotEncoding, gotAcceptEncoding)
+	}
+	if text, _ := resp.CompletionText(); text != big {
+		t.Errorf("content = %q", text)
+	}
+	if m := resp.Meta; m.CompressedBytes == 0 || m.UncompressedBytes <= m.CompressedBytes {
+		t.Errorf("compressed %d, uncompressed %d", m.CompressedBytes, m.UncompressedBytes)
+	}
+
+	// Small bodies go as they are
+	if _, err := c.ProxyLLM(context.Background(), llmReq("hi")); err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if gotEncoding != "" || gotReq.Messages[0].Content != "hi" {
+		t.Errorf("small body Content-Encoding = %q", gotEncoding)
+	}
+}
+
+func TestCompressionOff(t *testing.T) {
+	var gotEncoding, gotAcceptEncoding string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding, gotAcceptEncoding = r.Header.Get("Content-Encoding"), r.Header.Get("Accept-Encoding")
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"content": "ok"}, "meta": map[string]interface{}{}})
+	})
+	resp, err := c.ProxyLLM(context.Background(), llmReq(strings.Repeat("x", 4096)))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if gotEncoding != "" || gotAcceptEncoding != "gzip" || resp.Meta.CompressedBytes != 0 {
+		// net/http asks for gzip on its own and decodes transparently
+		t.Errorf("Content-Encoding = %q, Accept-Encoding = %q, meta = %+v", gotEncoding, gotAcceptEncoding, resp.Meta)
+	}
+}
+
+func TestCompressionCorruptResponse(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte("not gzip"))
+	}, WithCompression(0))
+	_, err := c.ProxyLLM(context.Background(), llmReq("hi"))
+	if err == nil || !strings.Contains(err.Error(), "decompress response") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestCompressionSkipsStreams(t *testing.T) {
+	var gotEncoding, gotAcceptEncoding string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding, gotAcceptEncoding = r.Header.Get("Content-Encoding"), r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: done\ndata: {}\n\n")
+	}, WithCompression(1))
+	s, err := c.ProxyLLMStream(context.Background(), llmReq("hello"))
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+	if gotAcceptEncoding != "identity" || gotEncoding != "gzip" {
+		t.Errorf("Content-Encoding = %q, Accept-Encoding = %q", gotEncoding, gotAcceptEncoding)
+	}
+}
+
+func TestCompressionOnlyForDecodedPaths(t *testing.T) {
+	big := strings.Repeat("hello ", 500)
+	encodings := map[string]string{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		encodings[r.URL.Path] = r.Header.Get("Content-Encoding")
+		// Like the proxy, only /proxy/llm and /proxy/http bodies are decoded
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"detail": err.Error()})
+			return
+		}
+		switch r.URL.Path {
+		case llmBatchPath:
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"success": true,
+				"results": []interface{}{map[string]interface{}{"index": 0, "success": true, "data": map[string]interface{}{"content": "ok"}}},
+				"meta":    map[string]interface{}{"total": 1, "succeeded": 1},
+			})
+		case embeddingsProxyPath:
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"success": true,
+				"data":    map[string]interface{}{"embeddings": [][]float64{{1}}, "cache_hits": []bool{false}},
+				"meta":    map[string]interface{}{},
+			})
+		}
+	}, WithCompression(0))
+
+	if _, err := c.ProxyLLMBatch(context.Background(), []LLMRequest{llmReq(big)}, BatchOptions{}); err != nil {
+		t.Errorf("ProxyLLMBatch: %v", err)
+	}
+	if _, err := c.ProxyEmbeddings(context.Background(), EmbeddingsRequest{Target: "openai", Input: []string{big}}); err != nil {
+		t.Errorf("ProxyEmbeddings: %v", err)
+	}
+	if encodings[llmBatchPath] != "" || encodings[embeddingsProxyPath] != "" {
+		t.Errorf("Content-Encoding by path = %v", encodings)
+	}
+}
@@ -0,0 +1,111 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const conversationsPath = "/v1/conversations"
+
+// Conversation is the history the proxy keeps for an
+// LLMRequest.ConversationID.
+type Conversation struct {
+	ConversationID string `json:"conversation_id"`
+	// Messages are the stored turns, oldest first: each turn's appended
+	// messages and the assistant's reply, redacted under the target's
+	// redaction rules.
+	Messages []ChatMessage `json:"messages"`
+	// Turns is how many turns Messages holds; DroppedTurns how many older
+	// ones were dropped past the proxy's max_turns, keeping their system
+	// messages.
+	Turns        int `json:"turns"`
+	DroppedTurns int `json:"dropped_turns"`
+	// Tokens is the estimated prompt size of Messages.
+	Tokens int `json:"tokens"`
+	// UpdatedAt is when the last turn was stored; ExpiresAt when the
+	// proxy forgets the conversation unless another turn is added.
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+	ExpiresAt time.Time `json:"-"`
+}
+
+// UnmarshalJSON decodes a conversation of a GET /v1/conversations
+// response, whose times are Unix seconds.
+func (c *Conversation) UnmarshalJSON(data []byte) error {
+	type fields Conversation
+	var raw struct {
+		fields
+		CreatedAt float64 `json:"created_at"`
+		UpdatedAt float64 `json:"updated_at"`
+		ExpiresAt float64 `json:"expires_at"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*c = Conversation(raw.fields)
+	c.CreatedAt, c.UpdatedAt, c.ExpiresAt = unixSeconds(raw.CreatedAt), unixSeconds(raw.UpdatedAt), unixSeconds(raw.ExpiresAt)
+	return nil
+}
+
+// IsConversationConflict reports whether err is a proxy rejection of a
+// request whose conversation had another turn in progress. The turn was
+// not run; it can be sent again once the other one finished.
+func IsConversationConflict(err error) bool {
+	return hasCode(err, CodeConversationConflict)
+}
+
+// GetConversation returns the stored history of the conversation id. An
+// unknown or expired conversation, or another tenant's, is a 404 *APIError
+// with CodeNotFound.
+func (c *Client) GetConversation(ctx context.Context, id string) (*Conversation, error) {
+	if id == "" {
+		return nil, errors.New("reliapi: conversation ID is required")
+	}
+	resp, raw, err := c.do(ctx, http.MethodGet, conversationPath(id), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool         `json:"success"`
+		Data    Conversation `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return &out.Data, nil
+}
+
+// DeleteConversation forgets the conversation id; a later request with
+// its ID starts a new one. An unknown conversation is a 404 *APIError with
+// CodeNotFound.
+func (c *Client) DeleteConversation(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("reliapi: conversation ID is required")
+	}
+	resp, raw, err := c.do(ctx, http.MethodDelete, conversationPath(id), nil, true)
+	if err != nil {
+		return err
+	}
+	var out struct {
+		Success bool `json:"success"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return newAPIError(resp, raw)
+	}
+	return nil
+}
+
+func conversationPath(id string) string {
+	return conversationsPath + "/" + url.PathEscape(id)
+}
@@ -0,0 +1,128 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func turnReq(content string) LLMRequest {
+	id := "chat-1"
+	return LLMRequest{Target: "openai", ConversationID: &id, AppendMessages: []ChatMessage{UserMessage(content)}}
+}
+
+func TestConversationTurn(t *testing.T) {
+	var bodies []map[string]interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		raw, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &body)
+		bodies = append(bodies, body)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "Hello"},
+			"meta":    map[string]interface{}{"conversation_tokens": 42},
+		})
+	}, WithDeterministicIdempotency(), WithRedactor(NewPatternRedactor(EmailPattern)))
+
+	resp, err := c.ProxyLLM(context.Background(), turnReq("I'm ada@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta.ConversationTokens != 42 {
+		t.Errorf("ConversationTokens = %d", resp.Meta.ConversationTokens)
+	}
+	body := bodies[0]
+	appended, _ := body["append_messages"].([]interface{})
+	if body["conversation_id"] != "chat-1" || body["messages"] != nil || len(appended) != 1 {
+		t.Fatalf("body = %v", body)
+	}
+	if content := appended[0].(map[string]interface{})["content"]; content != "I'm [EMAIL_1]" {
+		t.Errorf("appended content = %q", content)
+	}
+	// The same appended messages may be a later turn, so neither coalesced
+	// nor given a key that would replay the first
+	if _, ok := body["idempotency_key"]; ok {
+		t.Errorf("idempotency_key = %v", body["idempotency_key"])
+	}
+	if _, ok := llmRequestKey(turnReq("Hi")); ok {
+		t.Error("conversation turn has a coalescing key")
+	}
+
+	for _, req := range []LLMRequest{
+		{Target: "openai", AppendMessages: []ChatMessage{UserMessage("Hi")}},
+		func() LLMRequest { r := turnReq("Hi"); r.Messages = []ChatMessage{UserMessage("Hi")}; return r }(),
+		func() LLMRequest { r := turnReq("Hi"); r.Template = &TemplateRef{Name: "t"}; return r }(),
+		func() LLMRequest { r := turnReq("Hi"); r.AppendMessages = nil; return r }(),
+	} {
+		if _, err := c.ProxyLLM(context.Background(), req); !errors.Is(err, ErrConversationAndMessages) {
+			t.Errorf("ProxyLLM(%+v) = %v", req, err)
+		}
+	}
+	if len(bodies) != 1 {
+		t.Errorf("requests sent = %d", len(bodies))
+	}
+}
+
+func TestGetConversation(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/v1/conversations/chat%2F1" {
+			t.Errorf("path = %s", r.URL.EscapedPath())
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{
+				"conversation_id": "chat/1",
+				"messages": []interface{}{
+					map[string]interface{}{"role": "user", "content": "Hi"},
+					map[string]interface{}{"role": "assistant", "content": "Hello"},
+				},
+				"turns": 1, "dropped_turns": 2, "tokens": 12,
+				"created_at": 1700000000.0, "updated_at": 1700000060.5, "expires_at": 1700086460.5,
+			}})
+		case http.MethodDelete:
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"success": false, "error": map[string]interface{}{
+				"type": "client_error", "code": CodeNotFound, "message": "Conversation 'chat/1' not found", "status_code": 404,
+			}})
+		}
+	})
+	conv, err := c.GetConversation(context.Background(), "chat/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv.ConversationID != "chat/1" || len(conv.Messages) != 2 || conv.Messages[1].Content != "Hello" ||
+		conv.Turns != 1 || conv.DroppedTurns != 2 || conv.Tokens != 12 {
+		t.Errorf("conversation = %+v", conv)
+	}
+	if !conv.UpdatedAt.Equal(time.UnixMilli(1700000060500)) || conv.ExpiresAt.Sub(conv.UpdatedAt) != 24*time.Hour {
+		t.Errorf("times = %v, %v", conv.UpdatedAt, conv.ExpiresAt)
+	}
+
+	if err := c.DeleteConversation(context.Background(), "chat/1"); !hasCode(err, CodeNotFound) {
+		t.Errorf("DeleteConversation = %v", err)
+	}
+	if _, err := c.GetConversation(context.Background(), ""); err == nil {
+		t.Error("empty ID accepted")
+	}
+}
+
+func TestConversationConflict(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"success": false, "error": map[string]interface{}{
+			"type": "client_error", "code": CodeConversationConflict, "status_code": 409, "retryable": true,
+			"message": "Conversation 'chat-1' has a turn in progress",
+		}})
+	})
+	_, err := c.ProxyLLM(context.Background(), turnReq("Hi"))
+	if !IsConversationConflict(err) || !strings.Contains(err.Error(), "turn in progress") {
+		t.Errorf("err = %v", err)
+	}
+	if IsConversationConflict(errors.New("other")) {
+		t.Error("matched another error")
+	}
+}
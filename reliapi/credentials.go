@@ -0,0 +1,104 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TargetCredential is one of a target's named upstream API keys. Each
+// upstream request picks an enabled credential at random in proportion to
+// Weight; one answered with 401 or 429 three times in a row sits out for a
+// minute. The key is sent in the target's Auth header (Authorization:
+// Bearer without one). LLMRequest.Credential pins a credential by Name.
+type TargetCredential struct {
+	Name string `json:"name"`
+	// APIKey may be "env:VAR" to read the proxy's environment variable.
+	APIKey string `json:"api_key"`
+	// Weight defaults to 1.
+	Weight   float64 `json:"weight,omitempty"`
+	Disabled bool    `json:"disabled,omitempty"`
+}
+
+// Credential statuses reported by CredentialStatus.Status.
+const (
+	CredentialActive      = "active"
+	CredentialCoolingDown = "cooling_down"
+	CredentialDisabled    = "disabled"
+)
+
+// CredentialStatus is the state of a target's named credential on the
+// proxy instance that answered. The key itself is never returned.
+type CredentialStatus struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	// Source is "config" for credentials of the target's config and
+	// "admin" for those added with AddCredential.
+	Source string `json:"source"`
+	// Status is one of the Credential* constants.
+	Status              string `json:"status"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	// CooldownUntil is when a credential cooling down rejoins the rotation.
+	CooldownUntil *time.Time `json:"cooldown_until"`
+}
+
+// Credentials returns target's named credentials and their health. Like
+// AddCredential, DisableCredential and EnableCredential, it requires the
+// proxy's admin key (RELIAPI_ADMIN_KEY); an unknown target is a 404
+// *APIError with CodeNotFound.
+func (c *Client) Credentials(ctx context.Context, target string) ([]CredentialStatus, error) {
+	if target == "" {
+		return nil, errors.New("reliapi: target is required")
+	}
+	return c.credentials(ctx, http.MethodGet, targetPath(target)+"/credentials", nil)
+}
+
+// AddCredential adds a named credential to target's rotation, or replaces
+// the key and weight of one, enabled and healthy; a weight of 0 means 1.
+// It takes effect without restarting the proxy, lives in the proxy's
+// memory only, and returns the target's credentials.
+func (c *Client) AddCredential(ctx context.Context, target, name, apiKey string, weight float64) ([]CredentialStatus, error) {
+	if target == "" || name == "" {
+		return nil, errors.New("reliapi: target and credential name are required")
+	}
+	if weight == 0 {
+		weight = 1
+	}
+	body := map[string]interface{}{"api_key": apiKey, "weight": weight}
+	return c.credentials(ctx, http.MethodPut, credentialPath(target, name), body)
+}
+
+// DisableCredential takes target's credential name out of rotation, e.g.
+// while it is revoked. Requests pinning it fail with CodeUnknownCredential
+// until EnableCredential puts it back. An unknown name is a 404 *APIError
+// with CodeNotFound.
+func (c *Client) DisableCredential(ctx context.Context, target, name string) ([]CredentialStatus, error) {
+	if target == "" || name == "" {
+		return nil, errors.New("reliapi: target and credential name are required")
+	}
+	return c.credentials(ctx, http.MethodPost, credentialPath(target, name)+"/disable", nil)
+}
+
+// EnableCredential puts a disabled credential back in target's rotation.
+func (c *Client) EnableCredential(ctx context.Context, target, name string) ([]CredentialStatus, error) {
+	if target == "" || name == "" {
+		return nil, errors.New("reliapi: target and credential name are required")
+	}
+	return c.credentials(ctx, http.MethodPost, credentialPath(target, name)+"/enable", nil)
+}
+
+func credentialPath(target, name string) string {
+	return targetPath(target) + "/credentials/" + url.PathEscape(name)
+}
+
+func (c *Client) credentials(ctx context.Context, method, path string, body interface{}) ([]CredentialStatus, error) {
+	var out struct {
+		Credentials []CredentialStatus `json:"credentials"`
+	}
+	if err := c.targets(ctx, method, path, body, &out); err != nil {
+		return nil, err
+	}
+	return out.Credentials, nil
+}
@@ -0,0 +1,118 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestProxyLLMCredential(t *testing.T) {
+	var gotCredential interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		gotCredential = body["credential"]
+		if gotCredential == "revoked" {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]interface{}{"code": "UNKNOWN_CREDENTIAL", "message": "Credential 'revoked' of target 'openai' is disabled"},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "hi"},
+			"meta": map[string]interface{}{
+				"request_id": "req_1", "credential_name": "org-b",
+				"upstream_rate_limit": map[string]interface{}{"remaining": 3, "reset_at": "2026-10-14T12:01:00+00:00"},
+			},
+		})
+	})
+	org := "org-b"
+	resp, err := c.ProxyLLM(context.Background(), LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("hi")}, Credential: &org})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotCredential != "org-b" || resp.Meta.CredentialName != "org-b" {
+		t.Errorf("sent %v, meta %q", gotCredential, resp.Meta.CredentialName)
+	}
+	if rl := resp.Meta.UpstreamRateLimit; rl == nil || rl.Remaining != 3 || rl.ResetAt.Minute() != 1 {
+		t.Errorf("UpstreamRateLimit = %+v", rl)
+	}
+	// Without a pin the field is left out and the proxy rotates
+	if _, err := c.ProxyLLM(context.Background(), LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("hi")}}); err != nil {
+		t.Fatal(err)
+	}
+	if gotCredential != nil {
+		t.Errorf("credential sent without a pin: %v", gotCredential)
+	}
+
+	revoked := "revoked"
+	_, err = c.ProxyLLM(context.Background(), LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("hi")}, Credential: &revoked})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeUnknownCredential {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestCredentialAdmin(t *testing.T) {
+	var calls []string
+	var added map[string]interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPut {
+			json.NewDecoder(r.Body).Decode(&added)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"target": "openai",
+				"credentials": []map[string]interface{}{
+					{"name": "org-a", "weight": 2, "source": "config", "status": "cooling_down",
+						"consecutive_failures": 0, "cooldown_until": "2026-10-14T12:01:00+00:00"},
+					{"name": "org-c", "weight": 1, "source": "admin", "status": "active", "consecutive_failures": 0, "cooldown_until": nil},
+				},
+			},
+			"meta": map[string]interface{}{"request_id": "req_cred"},
+		})
+	})
+	ctx := context.Background()
+	creds, err := c.Credentials(ctx, "openai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds) != 2 || creds[0].Status != CredentialCoolingDown || creds[0].CooldownUntil == nil || creds[1].Source != "admin" {
+		t.Errorf("credentials = %+v", creds)
+	}
+	if _, err := c.AddCredential(ctx, "openai", "org-c", "sk-c", 0); err != nil {
+		t.Fatal(err)
+	}
+	if added["api_key"] != "sk-c" || added["weight"] != 1.0 {
+		t.Errorf("added = %v", added)
+	}
+	if _, err := c.DisableCredential(ctx, "openai", "org-a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.EnableCredential(ctx, "openai", "org-a"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"GET /v1/targets/openai/credentials",
+		"PUT /v1/targets/openai/credentials/org-c",
+		"POST /v1/targets/openai/credentials/org-a/disable",
+		"POST /v1/targets/openai/credentials/org-a/enable",
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v", calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %q, want %q", i, calls[i], want[i])
+		}
+	}
+	if _, err := c.DisableCredential(ctx, "openai", ""); err == nil {
+		t.Error("expected an error for an empty credential name")
+	}
+}
@@ -0,0 +1,99 @@
+package reliapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// DecodeOption configures how DecodeInto and DecodeData decode Data.
+type DecodeOption func(*json.Decoder)
+
+// DecodeUseNumber decodes numbers into interface{} values as json.Number
+// rather than float64, so integer IDs above 2^53 keep their precision.
+func DecodeUseNumber() DecodeOption {
+	return func(d *json.Decoder) { d.UseNumber() }
+}
+
+// DecodeDisallowUnknownFields fails decoding into a struct when Data has a
+// field the struct doesn't, e.g. to catch an upstream schema change.
+func DecodeDisallowUnknownFields() DecodeOption {
+	return func(d *json.Decoder) { d.DisallowUnknownFields() }
+}
+
+// DecodeInto decodes Data into v, as json.Unmarshal would, in a single
+// pass over the bytes the proxy sent. A null or empty Data leaves v as it
+// is. The base64 body of a binary /proxy/http response decodes into a
+// []byte field as it is.
+func (r *ReliAPIResponse) DecodeInto(v interface{}, opts ...DecodeOption) error {
+	if len(r.Data) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(r.Data))
+	for _, opt := range opts {
+		opt(dec)
+	}
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("reliapi: decode data: %w", err)
+	}
+	return nil
+}
+
+// DecodeData decodes resp's Data into a T; see DecodeInto.
+//
+//	type Page struct {
+//		Items []struct {
+//			ID int64 `json:"id"`
+//		} `json:"items"`
+//	}
+//	page, err := reliapi.DecodeData[Page](resp)
+func DecodeData[T any](resp *ReliAPIResponse, opts ...DecodeOption) (T, error) {
+	var out T
+	err := resp.DecodeInto(&out, opts...)
+	return out, err
+}
+
+// DataMap returns Data decoded as a map, nil if it is not a JSON object,
+// with numbers as float64. For a binary /proxy/http response (see
+// Meta.ResponseEncoding), "body" holds the decoded []byte; a
+// Meta.RawPassthrough response is the upstream's own JSON object. It
+// decodes Data on every call; DecodeInto a struct is faster and keeps
+// numbers exact.
+func (r *ReliAPIResponse) DataMap() map[string]interface{} {
+	var data map[string]interface{}
+	if json.Unmarshal(r.Data, &data) != nil || data == nil {
+		return nil
+	}
+	if r.Meta.ResponseEncoding == BodyEncodingBase64 && !r.Meta.RawPassthrough {
+		if encoded, ok := data["body"].(string); ok {
+			if raw, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+				data["body"] = raw
+				delete(data, "body_encoding")
+			}
+		}
+	}
+	return data
+}
+
+// RawData returns the upstream body of a Meta.RawPassthrough response as
+// the upstream sent it: Data itself for a JSON body, decoded from base64
+// for others (see Meta.ResponseEncoding). It returns nil for responses
+// without one.
+func (r *ReliAPIResponse) RawData() []byte {
+	if !r.Meta.RawPassthrough {
+		return nil
+	}
+	if r.Meta.ResponseEncoding != BodyEncodingBase64 {
+		return r.Data
+	}
+	var encoded string
+	if json.Unmarshal(r.Data, &encoded) != nil {
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
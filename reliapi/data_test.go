@@ -0,0 +1,157 @@
+package reliapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type userPage struct {
+	Items []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"items"`
+}
+
+func TestDecodeData(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"success": true, "meta": {"request_id": "req_1"},
+			"data": {"items": [{"id": 9007199254740993, "name": "a"}], "next": null}}`)
+	})
+	resp, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: "GET", Path: "/users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := DecodeData[userPage](resp)
+	if err != nil || len(page.Items) != 1 || page.Items[0].ID != 9007199254740993 {
+		t.Fatalf("DecodeData = %+v, %v", page, err)
+	}
+	// Through a float64, the ID above 2^53 would round to ...992
+	var loose map[string][]map[string]interface{}
+	if err := resp.DecodeInto(&loose, DecodeUseNumber()); err != nil {
+		t.Fatal(err)
+	}
+	if id := loose["items"][0]["id"]; id != json.Number("9007199254740993") {
+		t.Errorf("id with DecodeUseNumber = %#v", id)
+	}
+	if _, err := DecodeData[userPage](resp, DecodeDisallowUnknownFields()); err == nil || !strings.Contains(err.Error(), `"next"`) {
+		t.Errorf("DecodeDisallowUnknownFields error = %v", err)
+	}
+	if data := resp.DataMap(); data["next"] != nil || len(data["items"].([]interface{})) != 1 {
+		t.Errorf("DataMap = %v", data)
+	}
+
+	var empty ReliAPIResponse
+	if page, err := DecodeData[userPage](&empty); err != nil || page.Items != nil {
+		t.Errorf("DecodeData of no data = %+v, %v", page, err)
+	}
+	if empty.DataMap() != nil {
+		t.Error("DataMap of no data is not nil")
+	}
+}
+
+func TestDataMapBinaryBody(t *testing.T) {
+	resp := &ReliAPIResponse{
+		Data: json.RawMessage(`{"status_code": 200, "body": "aGVsbG8=", "body_encoding": "base64"}`),
+		Meta: Meta{ResponseEncoding: BodyEncodingBase64},
+	}
+	data := resp.DataMap()
+	if body, ok := data["body"].([]byte); !ok || string(body) != "hello" || data["body_encoding"] != nil {
+		t.Errorf("DataMap = %v", data)
+	}
+	// A []byte field takes the base64 body as it is
+	var typed struct {
+		Body []byte `json:"body"`
+	}
+	if err := resp.DecodeInto(&typed); err != nil || string(typed.Body) != "hello" {
+		t.Errorf("DecodeInto = %q, %v", typed.Body, err)
+	}
+}
+
+func TestRawData(t *testing.T) {
+	const body = `{"b": 1,  "a": [1.0, 2e3]}`
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"success": true, "data": %s, "meta": {"request_id": "req_1", "raw_passthrough": true,
+			"response_encoding": "utf8", "upstream_status": 200}}`, body)
+	})
+	resp, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: "GET", Path: "/users", RawPassthrough: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw := resp.RawData(); string(raw) != body {
+		t.Errorf("RawData = %s, want %s", raw, body)
+	}
+	if data := resp.DataMap(); data["b"] != 1.0 {
+		t.Errorf("DataMap = %v", data)
+	}
+
+	encoded := &ReliAPIResponse{
+		Data: json.RawMessage(`"aWQsbmFtZQo="`),
+		Meta: Meta{RawPassthrough: true, ResponseEncoding: BodyEncodingBase64},
+	}
+	if raw := encoded.RawData(); string(raw) != "id,name\n" {
+		t.Errorf("RawData of a base64 body = %q", raw)
+	}
+	if (&ReliAPIResponse{Data: json.RawMessage(body)}).RawData() != nil {
+		t.Error("RawData without raw passthrough is not nil")
+	}
+}
+
+// largeData is a /proxy/http result with n items.
+func largeData(n int) json.RawMessage {
+	var b bytes.Buffer
+	b.WriteString(`{"status_code": 200, "headers": {}, "body": {"items": [`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"id": %d, "name": "user-%d"}`, 1<<60+i, i)
+	}
+	b.WriteString(`]}}`)
+	return b.Bytes()
+}
+
+type largeResult struct {
+	Body userPage `json:"body"`
+}
+
+// BenchmarkDecodeData decodes Data straight into a struct.
+func BenchmarkDecodeData(b *testing.B) {
+	resp := &ReliAPIResponse{Data: largeData(10000)}
+	b.SetBytes(int64(len(resp.Data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeData[largeResult](resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeDataRemarshal is what typed decoding took when Data was
+// an interface{}: decode into it, marshal it back and decode the struct.
+func BenchmarkDecodeDataRemarshal(b *testing.B) {
+	raw := largeData(10000)
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var data interface{}
+		if err := json.Unmarshal(raw, &data); err != nil {
+			b.Fatal(err)
+		}
+		again, err := json.Marshal(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var out largeResult
+		if err := json.Unmarshal(again, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
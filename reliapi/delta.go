@@ -0,0 +1,190 @@
+package reliapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultDeltaBaseTTL is how long WithDeltaResponses keeps the last full
+// response of a request to have the next one sent as a patch of it.
+const DefaultDeltaBaseTTL = 24 * time.Hour
+
+// Formats of a delta response, DeltaMeta.Format.
+const (
+	// DeltaJSONPatch is an RFC 6902 JSON Patch, a list of operations.
+	DeltaJSONPatch = "json_patch"
+	// DeltaMergePatch is an RFC 7386 JSON Merge Patch.
+	DeltaMergePatch = "merge_patch"
+)
+
+// ErrDeltaMismatch is returned when a proxy answers a request for the full
+// response with a patch, after the patch of the client's base failed to
+// apply or to match its hash.
+var ErrDeltaMismatch = errors.New("reliapi: delta response does not apply to its base")
+
+// DeltaMeta describes a response a proxy sent as a patch of an earlier
+// one, for requests under WithDeltaResponses.
+type DeltaMeta struct {
+	// Format is DeltaJSONPatch or DeltaMergePatch.
+	Format string `json:"format"`
+	// BaseVersion is the Meta.DataVersion of the response patched.
+	BaseVersion string `json:"base_version"`
+	// SHA256 is the hex SHA-256 of the patched Data, serialized as the
+	// proxy serializes cache documents (core/cache_key.py canonical_json).
+	SHA256 string `json:"sha256"`
+	// PatchBytes is the size of the patch received and BytesSaved how much
+	// smaller it was than the Data rebuilt from it.
+	PatchBytes int `json:"patch_bytes,omitempty"`
+	BytesSaved int `json:"bytes_saved,omitempty"`
+}
+
+// WithDeltaResponses has GET and HEAD ProxyHTTP calls of large, mostly
+// unchanged JSON documents fetch only what changed, from proxies that
+// support it. The client keeps the last full response of each request in
+// the WithLocalCache store, for DefaultDeltaBaseTTL, and sends its
+// Meta.DataVersion, or its ETag, as HTTPRequest.DeltaBase with PreferDelta
+// set. A proxy holding that version may answer with a DeltaJSONPatch or
+// DeltaMergePatch of it in Data and a Meta.Delta; the client applies the
+// patch, checks the result against Meta.Delta.SHA256, and returns the
+// current document with Meta.Delta.BytesSaved set.
+//
+// Proxies without delta support, or without the base version any more,
+// answer in full, as does a patch that fails to apply: the client then
+// drops its base and sends the request again without one. Requests the
+// local cache bypasses, and RawPassthrough ones, never ask for deltas. It
+// does nothing without WithLocalCache.
+func WithDeltaResponses() Option {
+	return func(c *Client) {
+		c.deltas = true
+	}
+}
+
+// deltaBase is the stored response a delta applies to.
+type deltaBase struct {
+	Version string          `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// withDeltaBase sends req with fetch, asking for a patch of the stored
+// response to it under WithDeltaResponses, and returns the response
+// rebuilt in full. key is its request key; cacheable is false for
+// requests the proxy does not cache.
+func (c *Client) withDeltaBase(ctx context.Context, key string, cacheable bool, req HTTPRequest, fetch func(context.Context, HTTPRequest) (*ReliAPIResponse, error)) (*ReliAPIResponse, error) {
+	if !c.deltas || c.localCache == nil || !cacheable || req.RawPassthrough || req.IdempotencyKey != nil || c.idempotency == idempotencyRandom {
+		return fetch(ctx, req)
+	}
+	key = "delta:" + c.localKey(ctx, key)
+	base := c.deltaBase(key)
+	if base != nil {
+		req.PreferDelta = true
+		req.DeltaBase = base.Version
+	}
+	resp, err := fetch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Meta.Delta != nil {
+		if err := applyDeltaResponse(resp, base); err != nil {
+			// Start over from the full document
+			_ = c.localCache.Delete(key)
+			req.PreferDelta, req.DeltaBase = false, ""
+			if resp, err = fetch(ctx, req); err != nil {
+				return nil, err
+			}
+			if resp.Meta.Delta != nil {
+				return nil, ErrDeltaMismatch
+			}
+		}
+	}
+	c.storeDeltaBase(key, resp)
+	return resp, nil
+}
+
+// deltaBase returns the stored response under key, or nil.
+func (c *Client) deltaBase(key string) *deltaBase {
+	raw, ok, err := c.localCache.Get(key)
+	if err != nil || !ok {
+		return nil
+	}
+	var base deltaBase
+	if err := json.Unmarshal(raw, &base); err != nil || base.Version == "" {
+		_ = c.localCache.Delete(key)
+		return nil
+	}
+	return &base
+}
+
+// storeDeltaBase keeps resp under key as the base of the next delta, if
+// it has a version and is the whole document.
+func (c *Client) storeDeltaBase(key string, resp *ReliAPIResponse) {
+	m := resp.Meta
+	version := m.DataVersion
+	if version == "" {
+		version = resp.UpstreamHeader("ETag")
+	}
+	if version == "" || m.Stale || m.Truncated || m.DryRun || m.NotModified {
+		return
+	}
+	raw, err := json.Marshal(deltaBase{Version: version, Data: resp.Data})
+	if err != nil {
+		return
+	}
+	_ = c.localCache.Set(key, raw, DefaultDeltaBaseTTL)
+}
+
+// applyDeltaResponse replaces the patch in resp.Data with the document it
+// makes of base.
+func applyDeltaResponse(resp *ReliAPIResponse, base *deltaBase) error {
+	delta := *resp.Meta.Delta
+	if base == nil || delta.BaseVersion != base.Version {
+		return fmt.Errorf("%w: patch of version %q", ErrDeltaMismatch, delta.BaseVersion)
+	}
+	data, err := applyDelta(base.Data, resp.Data, delta)
+	if err != nil {
+		return err
+	}
+	delta.PatchBytes = len(resp.Data)
+	delta.BytesSaved = len(data) - len(resp.Data)
+	resp.Data = data
+	resp.Meta.Delta = &delta
+	return nil
+}
+
+// applyDelta applies patch, in delta's format, to base and checks the
+// result against delta's hash.
+func applyDelta(base, patch []byte, delta DeltaMeta) ([]byte, error) {
+	doc, err := decodeNumbers(base)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeltaMismatch, err)
+	}
+	switch delta.Format {
+	case DeltaJSONPatch:
+		doc, err = applyJSONPatch(doc, patch)
+	case DeltaMergePatch:
+		var p interface{}
+		if p, err = decodeNumbers(patch); err == nil {
+			doc = applyMergePatch(doc, p)
+		}
+	default:
+		err = fmt.Errorf("unknown delta format %q", delta.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeltaMismatch, err)
+	}
+
+	var b strings.Builder
+	if err := writeCanonical(&b, doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeltaMismatch, err)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), delta.SHA256) {
+		return nil, fmt.Errorf("%w: hash mismatch", ErrDeltaMismatch)
+	}
+	return json.Marshal(doc)
+}
@@ -0,0 +1,202 @@
+package reliapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// deltaHash is the DeltaMeta.SHA256 of the JSON document doc.
+func deltaHash(t *testing.T, doc string) string {
+	t.Helper()
+	v, err := decodeNumbers([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := writeCanonical(&b, v); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// deltaReply is one answer of a deltaServer.
+type deltaReply struct {
+	data    string
+	version string
+	delta   *DeltaMeta
+	headers map[string][]string
+}
+
+// deltaServer answers ProxyHTTP calls with replies in turn and records the
+// requests it got.
+type deltaServer struct {
+	mu       sync.Mutex
+	replies  []deltaReply
+	requests []HTTPRequest
+}
+
+func (s *deltaServer) handle(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req HTTPRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		reply := s.replies[0]
+		s.replies = s.replies[1:]
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    json.RawMessage(reply.data),
+			"meta": map[string]interface{}{
+				"request_id": "req_1", "cache_key": "k", "data_version": reply.version,
+				"delta": reply.delta, "upstream_headers": reply.headers,
+			},
+		})
+	}
+}
+
+var deltaRequest = HTTPRequest{Target: "catalog", Method: http.MethodGet, Path: "/products", Cache: new(int)}
+
+const (
+	catalogV1 = `{"status_code": 200, "headers": {}, "body": {"products": [{"id": 1, "price": 10}, {"id": 2, "price": 20}], "updated": "mon"}}`
+	catalogV2 = `{"status_code": 200, "headers": {}, "body": {"products": [{"id": 1, "price": 12}, {"id": 2, "price": 20}, {"id": 3, "price": 5}], "updated": "tue"}}`
+	catalogV3 = `{"status_code": 200, "headers": {}, "body": {"products": [{"id": 1, "price": 12}, {"id": 3, "price": 5}], "updated": "wed"}}`
+)
+
+func TestDeltaResponses(t *testing.T) {
+	srv := &deltaServer{replies: []deltaReply{
+		{data: catalogV1, version: "v1"},
+		{data: `[{"op": "replace", "path": "/body/products/0/price", "value": 12},
+			{"op": "add", "path": "/body/products/-", "value": {"id": 3, "price": 5}},
+			{"op": "replace", "path": "/body/updated", "value": "tue"}]`,
+			version: "v2", delta: &DeltaMeta{Format: DeltaJSONPatch, BaseVersion: "v1", SHA256: deltaHash(t, catalogV2)}},
+		{data: `{"body": {"products": [{"id": 1, "price": 12}, {"id": 3, "price": 5}], "updated": "wed"}}`,
+			version: "v3", delta: &DeltaMeta{Format: DeltaMergePatch, BaseVersion: "v2", SHA256: deltaHash(t, catalogV3)}},
+	}}
+	c := newTestClient(t, srv.handle(t), WithLocalCache(NewMemoryCache(0)), WithDeltaResponses())
+	ctx := context.Background()
+
+	for i, want := range []string{catalogV1, catalogV2, catalogV3} {
+		resp, err := c.ProxyHTTP(ctx, deltaRequest)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		got, _ := decodeNumbers(resp.Data)
+		if wantDoc, _ := decodeNumbers([]byte(want)); !jsonEqual(got, wantDoc) {
+			t.Errorf("request %d: data %s", i, resp.Data)
+		}
+		if delta := resp.Meta.Delta; (delta != nil) != (i > 0) || delta != nil && (delta.PatchBytes == 0 || delta.BytesSaved != len(resp.Data)-delta.PatchBytes) {
+			t.Errorf("request %d: Delta = %+v", i, delta)
+		}
+	}
+
+	for i, base := range []string{"", "v1", "v2"} {
+		if req := srv.requests[i]; req.PreferDelta != (base != "") || req.DeltaBase != base {
+			t.Errorf("request %d: prefer_delta %v, delta_base %q", i, req.PreferDelta, req.DeltaBase)
+		}
+	}
+}
+
+func TestDeltaResponsesFallBack(t *testing.T) {
+	// The proxy ignores prefer_delta, or has lost the base version
+	srv := &deltaServer{replies: []deltaReply{
+		{data: catalogV1, version: "v1"},
+		{data: catalogV2, version: "v2"},
+		// An ETag stands in for a version
+		{data: catalogV3, headers: map[string][]string{"etag": {`"abc"`}}},
+		{data: catalogV3},
+		{data: catalogV3},
+	}}
+	c := newTestClient(t, srv.handle(t), WithLocalCache(NewMemoryCache(0)), WithDeltaResponses())
+	for i := 0; i < 5; i++ {
+		resp, err := c.ProxyHTTP(context.Background(), deltaRequest)
+		if err != nil || resp.Meta.Delta != nil {
+			t.Fatalf("request %d: %+v, %v", i, resp, err)
+		}
+	}
+	for i, base := range []string{"", "v1", "v2", `"abc"`, `"abc"`} {
+		if req := srv.requests[i]; req.DeltaBase != base {
+			t.Errorf("request %d: delta_base %q, want %q", i, req.DeltaBase, base)
+		}
+	}
+}
+
+func TestDeltaResponsesRefetchFull(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		patch deltaReply
+	}{
+		{"hash mismatch", deltaReply{data: `[{"op": "replace", "path": "/body/updated", "value": "tue"}]`,
+			delta: &DeltaMeta{Format: DeltaJSONPatch, BaseVersion: "v1", SHA256: deltaHash(t, catalogV2)}}},
+		{"bad patch", deltaReply{data: `[{"op": "remove", "path": "/body/products/5"}]`,
+			delta: &DeltaMeta{Format: DeltaJSONPatch, BaseVersion: "v1", SHA256: deltaHash(t, catalogV2)}}},
+		{"other base", deltaReply{data: `{"body": {"updated": "tue"}}`,
+			delta: &DeltaMeta{Format: DeltaMergePatch, BaseVersion: "v0", SHA256: deltaHash(t, catalogV2)}}},
+		{"unknown format", deltaReply{data: `"..."`,
+			delta: &DeltaMeta{Format: "bsdiff", BaseVersion: "v1", SHA256: deltaHash(t, catalogV2)}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &deltaServer{replies: []deltaReply{{data: catalogV1, version: "v1"}, tt.patch, {data: catalogV2, version: "v2"}}}
+			c := newTestClient(t, srv.handle(t), WithLocalCache(NewMemoryCache(0)), WithDeltaResponses())
+			ctx := context.Background()
+			if _, err := c.ProxyHTTP(ctx, deltaRequest); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := c.ProxyHTTP(ctx, deltaRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := decodeNumbers(resp.Data)
+			if want, _ := decodeNumbers([]byte(catalogV2)); !jsonEqual(got, want) || resp.Meta.Delta != nil {
+				t.Errorf("data %s, Delta %+v", resp.Data, resp.Meta.Delta)
+			}
+			if len(srv.requests) != 3 || srv.requests[2].PreferDelta || srv.requests[2].DeltaBase != "" {
+				t.Errorf("requests = %+v", srv.requests)
+			}
+		})
+	}
+
+	// A proxy that keeps sending patches fails the call
+	srv := &deltaServer{replies: []deltaReply{
+		{data: `{"body": {}}`, delta: &DeltaMeta{Format: DeltaMergePatch, BaseVersion: "v1"}},
+		{data: `{"body": {}}`, delta: &DeltaMeta{Format: DeltaMergePatch, BaseVersion: "v1"}},
+	}}
+	c := newTestClient(t, srv.handle(t), WithLocalCache(NewMemoryCache(0)), WithDeltaResponses())
+	if _, err := c.ProxyHTTP(context.Background(), deltaRequest); !errors.Is(err, ErrDeltaMismatch) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestDeltaResponsesBypassed(t *testing.T) {
+	srv := &deltaServer{}
+	for i := 0; i < 4; i++ {
+		srv.replies = append(srv.replies, deltaReply{data: catalogV1, version: "v1"})
+	}
+	ctx := context.Background()
+	// Without a local cache there is nowhere to keep bases
+	c := newTestClient(t, srv.handle(t), WithDeltaResponses())
+	c.ProxyHTTP(ctx, deltaRequest)
+	c.ProxyHTTP(ctx, deltaRequest)
+
+	c = newTestClient(t, srv.handle(t), WithLocalCache(NewMemoryCache(0)), WithDeltaResponses())
+	key := "key-1"
+	withKey := deltaRequest
+	withKey.IdempotencyKey = &key
+	c.ProxyHTTP(ctx, withKey)
+	c.ProxyHTTP(ctx, withKey)
+	for i, req := range srv.requests {
+		if req.PreferDelta || req.DeltaBase != "" {
+			t.Errorf("request %d asked for a delta", i)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package reliapi
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// HeaderCompressionDictionary names the zstd dictionary a request body is
+// compressed with (see WithCompressionDictionary).
+const HeaderCompressionDictionary = "X-ReliAPI-Zstd-Dictionary"
+
+// WithCompressionDictionary zstd-compresses request bodies with dict, a
+// dictionary the proxy knows as id (its compression.dictionaries config),
+// such as one made by TrainDictionary from recorded requests. Prompts
+// sharing schemas and few-shot examples then shrink far more than gzip
+// takes them, which only sees one body at a time.
+//
+// It applies to the bodies WithCompression compresses, at its threshold,
+// or at DefaultCompressionThreshold without it. A proxy that rejects the
+// dictionary with 415 or 428, one without zstd or that doesn't know id,
+// gets the request again gzipped, and gzip for the rest of the client's
+// life. NewClient fails if dict is not a zstd dictionary.
+func WithCompressionDictionary(id string, dict []byte) Option {
+	return func(c *Client) {
+		c.compressDict = &compressionDictionary{id: id, dict: dict}
+	}
+}
+
+// compressionDictionary is the state of WithCompressionDictionary.
+type compressionDictionary struct {
+	id   string
+	dict []byte
+	// enc is safe for concurrent EncodeAll calls.
+	enc *zstd.Encoder
+	// rejected is set once the proxy turned the dictionary down.
+	rejected atomic.Bool
+}
+
+// init makes the encoder of d, and turns compression on for the client.
+func (d *compressionDictionary) init(c *Client) error {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderDict(d.dict), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return fmt.Errorf("reliapi: compression dictionary %q: %w", d.id, err)
+	}
+	d.enc = enc
+	if c.compressThreshold == 0 {
+		c.compressThreshold = DefaultCompressionThreshold
+	}
+	return nil
+}
+
+// zstdPayload is a request body compressed by compress with the client's
+// dictionary.
+type zstdPayload []byte
+
+func (p zstdPayload) open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(p)), nil
+}
+
+// dictionaryRejected reports whether resp turns down the dictionary a
+// zstdPayload was sent with, and if so stops the client using it.
+func (c *Client) dictionaryRejected(p payload, resp *http.Response) bool {
+	if _, ok := p.(zstdPayload); !ok || resp == nil {
+		return false
+	}
+	if resp.StatusCode != http.StatusUnsupportedMediaType && resp.StatusCode != http.StatusPreconditionRequired {
+		return false
+	}
+	c.compressDict.rejected.Store(true)
+	return true
+}
+
+// Bounds of the segments TrainDictionary picks: the length of the
+// substrings it counts across samples, the length of a segment and the step
+// between candidate segments.
+const (
+	trainKmer    = 8
+	trainSegment = 256
+	trainStep    = 32
+	// trainTables is room left in maxSize for the entropy tables BuildDict
+	// adds to the history.
+	trainTables = 2 << 10
+)
+
+// TrainDictionary builds a zstd dictionary of at most maxSize bytes from
+// samples, typically request bodies recorded with a cassette, for
+// WithCompressionDictionary. Its content is the segments of the samples
+// whose substrings recur across the most samples, picked greedily; a few
+// dozen samples of the kind of request the dictionary is for are enough. It
+// fails if the samples share too little to build one from.
+func TrainDictionary(samples [][]byte, maxSize int) ([]byte, error) {
+	if maxSize < trainTables+trainSegment {
+		return nil, fmt.Errorf("reliapi: dictionary size %d, at least %d is needed", maxSize, trainTables+trainSegment)
+	}
+	history := trainHistory(samples, maxSize-trainTables)
+	if len(history) < trainSegment {
+		return nil, errors.New("reliapi: samples share too little content for a dictionary")
+	}
+	sum := sha256.Sum256(history)
+	// IDs below 32768 are reserved by the zstd format
+	id := 32768 + binary.BigEndian.Uint32(sum[:4])%(1<<31-32768)
+	for {
+		dict, err := zstd.BuildDict(zstd.BuildDictOptions{
+			ID:       id,
+			Contents: samples,
+			History:  history,
+			Offsets:  [3]int{1, 4, 8},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reliapi: build dictionary: %w", err)
+		}
+		if len(dict) <= maxSize {
+			return dict, nil
+		}
+		// The tables took more than trainTables; the history's start is
+		// its least useful part
+		history = history[len(dict)-maxSize:]
+	}
+}
+
+// trainHistory concatenates the segments of samples with the most k-mers
+// shared by other samples, up to size bytes. The best segments come last,
+// closest to the data, where zstd reaches them with the shortest offsets.
+func trainHistory(samples [][]byte, size int) []byte {
+	// kmers[i][j] is the k-mer at samples[i][j:]; freq counts, per k-mer,
+	// the samples it appears in
+	kmers := make([][]uint64, len(samples))
+	freq := make(map[uint64]int)
+	for i, s := range samples {
+		seen := make(map[uint64]bool)
+		for j := 0; j+trainKmer <= len(s); j++ {
+			k := binary.LittleEndian.Uint64(s[j:])
+			kmers[i] = append(kmers[i], k)
+			if !seen[k] {
+				seen[k] = true
+				freq[k]++
+			}
+		}
+	}
+	// A segment's score is the sum of the frequencies of the distinct
+	// shared k-mers starting in it; seen marks those counted in the current
+	// scoring, by its number.
+	seen := make(map[uint64]int)
+	scored := 0
+	score := func(seg segment) int {
+		scored++
+		total := 0
+		for _, k := range kmers[seg.sample][seg.start:min(seg.end, len(kmers[seg.sample]))] {
+			if n := freq[k]; n > 1 && seen[k] != scored {
+				seen[k] = scored
+				total += n
+			}
+		}
+		return total
+	}
+
+	var candidates segmentHeap
+	for si, s := range samples {
+		for start := 0; start+trainKmer <= len(s); start += trainStep {
+			seg := segment{sample: si, start: start, end: min(start+trainSegment, len(s))}
+			if seg.score = score(seg); seg.score > 0 {
+				candidates = append(candidates, seg)
+			}
+		}
+	}
+	heap.Init(&candidates)
+
+	// Lazy greedy: scores only fall as segments are picked, so a candidate
+	// whose fresh score still beats the next one's stale score is the best
+	var picked [][]byte
+	total := 0
+	for candidates.Len() > 0 && total < size {
+		best := candidates[0]
+		if sc := score(best); sc != best.score {
+			if sc == 0 {
+				heap.Pop(&candidates)
+			} else {
+				candidates[0].score = sc
+				heap.Fix(&candidates, 0)
+			}
+			continue
+		}
+		heap.Pop(&candidates)
+		seg := samples[best.sample][best.start:best.end]
+		if len(seg) > size-total {
+			seg = seg[len(seg)-(size-total):]
+		}
+		picked = append(picked, seg)
+		total += len(seg)
+		// What the segment covers is in the dictionary now
+		for _, k := range kmers[best.sample][best.start:min(best.end, len(kmers[best.sample]))] {
+			delete(freq, k)
+		}
+	}
+	history := make([]byte, 0, total)
+	for i := len(picked) - 1; i >= 0; i-- {
+		history = append(history, picked[i]...)
+	}
+	return history
+}
+
+// segment is a candidate of trainHistory: samples[sample][start:end].
+type segment struct {
+	sample, start, end, score int
+}
+
+// segmentHeap is a max-heap of segments by score.
+type segmentHeap []segment
+
+func (h segmentHeap) Len() int            { return len(h) }
+func (h segmentHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h segmentHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *segmentHeap) Push(x interface{}) { *h = append(*h, x.(segment)) }
+func (h *segmentHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,226 @@
+package reliapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// extractionPrompt is a system prompt of the kind dictionaries are for:
+// a schema and few-shot examples repeated in every request.
+var extractionPrompt = func() string {
+	var b strings.Builder
+	b.WriteString(`You extract invoices. Reply with JSON matching this schema: {"type": "object", "properties": {`)
+	for _, field := range []string{"vendor", "invoice_number", "issue_date", "due_date", "currency", "subtotal", "tax", "total", "iban", "notes"} {
+		fmt.Fprintf(&b, `"%s": {"type": "string", "description": "The %s as printed on the invoice, or null if absent"}, `, field, strings.ReplaceAll(field, "_", " "))
+	}
+	b.WriteString(`}}. Examples:`)
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&b, "\nInvoice: ACME GmbH, Nr. 2024-%03d, dated 2024-03-%02d, total EUR %d.00 incl. 19%% VAT.\n"+
+			`Answer: {"vendor": "ACME GmbH", "invoice_number": "2024-%03d", "issue_date": "2024-03-%02d", "currency": "EUR", "total": "%d.00"}`,
+			i, i+1, 100*i+42, i, i+1, 100*i+42)
+	}
+	return b.String()
+}()
+
+// promptSamples returns n request bodies sharing extractionPrompt, each
+// with its own invoice.
+func promptSamples(n int) [][]byte {
+	samples := make([][]byte, n)
+	for i := range samples {
+		req := LLMRequest{
+			Target: "openai",
+			Model:  "gpt-4o-mini",
+			Messages: []ChatMessage{
+				SystemMessage(extractionPrompt),
+				UserMessage(fmt.Sprintf("Invoice: Vendor %d Ltd, No. INV-%05d, dated 2025-%02d-%02d, total GBP %d.%02d.", i*7, i*31, i%12+1, i%28+1, i*13, i%100)),
+			},
+		}
+		samples[i], _ = json.Marshal(req)
+	}
+	return samples
+}
+
+func TestTrainDictionary(t *testing.T) {
+	samples := promptSamples(40)
+	dict, err := TrainDictionary(samples, 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dict) > 16<<10 {
+		t.Errorf("dictionary of %d bytes", len(dict))
+	}
+
+	fresh := promptSamples(41)[40]
+	enc, _ := zstd.NewWriter(nil, zstd.WithEncoderDict(dict))
+	plain, _ := zstd.NewWriter(nil)
+	withDict, without := enc.EncodeAll(fresh, nil), plain.EncodeAll(fresh, nil)
+	if len(withDict)*3 > len(without) {
+		t.Errorf("%d bytes with the dictionary, %d without", len(withDict), len(without))
+	}
+	dec, _ := zstd.NewReader(nil, zstd.WithDecoderDicts(dict))
+	if got, err := dec.DecodeAll(withDict, nil); err != nil || !bytes.Equal(got, fresh) {
+		t.Errorf("round trip: %v", err)
+	}
+
+	if _, err := TrainDictionary([][]byte{[]byte("a"), []byte("b")}, 16<<10); err == nil {
+		t.Error("trained on samples sharing nothing")
+	}
+	if _, err := TrainDictionary(samples, 100); err == nil {
+		t.Error("trained a 100-byte dictionary")
+	}
+}
+
+// dictionaryProxy decodes request bodies like a proxy configured with
+// dictionaries, and rejects others with 415.
+type dictionaryProxy struct {
+	dicts map[string][]byte
+
+	mu        sync.Mutex
+	encodings []string
+	bodies    [][]byte
+}
+
+func (p *dictionaryProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+	encoding := r.Header.Get("Content-Encoding")
+	switch encoding {
+	case "zstd":
+		dict, ok := p.dicts[r.Header.Get(HeaderCompressionDictionary)]
+		if !ok {
+			writeJSON(w, http.StatusUnsupportedMediaType, map[string]interface{}{
+				"success": false,
+				"error":   map[string]interface{}{"type": "client_error", "code": "BAD_REQUEST", "message": "unknown dictionary"},
+			})
+			p.record(encoding, nil)
+			return
+		}
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderDicts(dict))
+		raw, _ = dec.DecodeAll(raw, nil)
+	case "gzip":
+		zr, _ := gzip.NewReader(bytes.NewReader(raw))
+		raw, _ = io.ReadAll(zr)
+	}
+	p.record(encoding, raw)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"content": "ok"}, "meta": map[string]interface{}{}})
+}
+
+func (p *dictionaryProxy) record(encoding string, body []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.encodings = append(p.encodings, encoding)
+	p.bodies = append(p.bodies, body)
+}
+
+func TestCompressionDictionary(t *testing.T) {
+	dict, err := TrainDictionary(promptSamples(40), 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &dictionaryProxy{dicts: map[string][]byte{"invoices-v1": dict}}
+	c := newTestClient(t, p.ServeHTTP, WithCompressionDictionary("invoices-v1", dict))
+
+	req := llmReq("x")
+	req.Messages = []ChatMessage{SystemMessage(extractionPrompt), UserMessage("Invoice: Foo AG")}
+	if _, err := c.ProxyLLM(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	var sent LLMRequest
+	if err := json.Unmarshal(p.bodies[0], &sent); err != nil || sent.Messages[1].Content != "Invoice: Foo AG" {
+		t.Fatalf("proxy decoded %q: %v", p.bodies[0], err)
+	}
+	if p.encodings[0] != "zstd" {
+		t.Errorf("Content-Encoding = %q", p.encodings[0])
+	}
+	// Small bodies and other endpoints aren't compressed
+	if _, err := c.ProxyLLM(context.Background(), llmReq("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if p.encodings[1] != "" {
+		t.Errorf("small body Content-Encoding = %q", p.encodings[1])
+	}
+}
+
+func TestCompressionDictionaryFallback(t *testing.T) {
+	dict, err := TrainDictionary(promptSamples(40), 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &dictionaryProxy{}
+	c := newTestClient(t, p.ServeHTTP, WithCompressionDictionary("invoices-v1", dict))
+	req := llmReq("x")
+	req.Messages = []ChatMessage{SystemMessage(extractionPrompt)}
+	for i := 0; i < 2; i++ {
+		resp, err := c.ProxyLLM(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text, _ := resp.CompletionText(); text != "ok" {
+			t.Errorf("content = %q", text)
+		}
+	}
+	// Rejected once, then gzip
+	if got := strings.Join(p.encodings, ","); got != "zstd,gzip,gzip" {
+		t.Errorf("encodings = %s", got)
+	}
+	if !bytes.Contains(p.bodies[1], []byte("You extract invoices")) {
+		t.Errorf("fallback body = %q", p.bodies[1])
+	}
+}
+
+func TestCompressionDictionaryInvalid(t *testing.T) {
+	if _, err := NewClient("", "k", WithCompressionDictionary("x", []byte("not a dictionary"))); err == nil {
+		t.Error("NewClient accepted an invalid dictionary")
+	}
+}
+
+// benchmarkRequestBytes reports the bytes compress sends for each of a set
+// of fresh requests sharing extractionPrompt, as wire-bytes/op next to
+// json-bytes/op.
+func benchmarkRequestBytes(b *testing.B, opts ...Option) {
+	c, err := NewClient("", "k", opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	bodies := promptSamples(1040)[1000:]
+	var wire, raw int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		body := bodies[i%len(bodies)]
+		p, err := c.compress(llmProxyPath, bytesPayload(body))
+		if err != nil {
+			b.Fatal(err)
+		}
+		r, _ := p.open()
+		n, _ := io.Copy(io.Discard, r)
+		wire += int(n)
+		raw += len(body)
+	}
+	b.ReportMetric(float64(wire)/float64(b.N), "wire-bytes/op")
+	b.ReportMetric(float64(raw)/float64(b.N), "json-bytes/op")
+}
+
+// BenchmarkCompressionDictionary compresses with a dictionary trained on
+// other requests with the same prompt.
+func BenchmarkCompressionDictionary(b *testing.B) {
+	dict, err := TrainDictionary(promptSamples(200), 32<<10)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkRequestBytes(b, WithCompressionDictionary("invoices-v1", dict))
+}
+
+// BenchmarkCompressionGzip is what the same requests took with plain
+// WithCompression.
+func BenchmarkCompressionGzip(b *testing.B) {
+	benchmarkRequestBytes(b, WithCompression(0))
+}
@@ -0,0 +1,172 @@
+package reliapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrReplayDivergence is matched by a *ReplayDivergence.
+var ErrReplayDivergence = errors.New("reliapi: idempotent replay diverged")
+
+// ReplayDivergence.Reason values.
+const (
+	// DivergenceNotReplayed means the proxy ran a request again although
+	// its idempotency key was answered before within the key's window,
+	// because the proxy lost the key or expired it early.
+	DivergenceNotReplayed = "not_replayed"
+	// DivergenceBody means the proxy replayed the key with a body other
+	// than the one it first answered with.
+	DivergenceBody = "body_mismatch"
+)
+
+// replayMemorySize bounds the idempotency keys a client remembers the
+// responses of for WithReplayDivergenceHandler and WithStrictIdempotency.
+const replayMemorySize = 10000
+
+// ReplayDivergence reports that a request sent again with an idempotency
+// key got an answer other than its first: see
+// WithReplayDivergenceHandler. It matches ErrReplayDivergence, which
+// WithStrictIdempotency fails such calls with.
+type ReplayDivergence struct {
+	// IdempotencyKey is the key both responses were for.
+	IdempotencyKey string
+	// Reason is DivergenceNotReplayed or DivergenceBody.
+	Reason string
+	// FirstRequestID and FirstHash are the request ID and the SHA-256 of
+	// the data of the response the key was first answered with, and
+	// RequestID and Hash those of the one that diverged from it.
+	FirstRequestID string
+	FirstHash      string
+	RequestID      string
+	Hash           string
+	// Window is how long the proxy said it honors the key, and ExpiresAt
+	// when it stops; zero when it didn't say.
+	Window    time.Duration
+	ExpiresAt time.Time
+}
+
+func (d *ReplayDivergence) Error() string {
+	what := "ran again"
+	if d.Reason == DivergenceBody {
+		what = "replayed another body"
+	}
+	return fmt.Sprintf("%v: key %s %s (request %s, first answered by %s)", ErrReplayDivergence, d.IdempotencyKey, what, d.RequestID, d.FirstRequestID)
+}
+
+// Is reports whether target is ErrReplayDivergence.
+func (d *ReplayDivergence) Is(target error) bool { return target == ErrReplayDivergence }
+
+// ReplayDivergenceHandler receives the divergences WithReplayDivergenceHandler
+// detects, with the context of the call that saw them.
+type ReplayDivergenceHandler func(ctx context.Context, d *ReplayDivergence)
+
+// WithReplayDivergenceHandler makes the client check the answers to
+// ProxyLLM and ProxyHTTP calls sent with an idempotency key, given or
+// generated, against the first answer it got for the key: a later answer
+// must be a replay (Meta.IdempotentHit or Meta.CacheHit) of the same data.
+// One that isn't is passed to h as a *ReplayDivergence, and becomes the
+// answer later ones are checked against.
+//
+// The client remembers the hash of the first answer for the key's window,
+// up to Meta.IdempotencyExpiresAt or else WithDefaultIdempotencyTTL, and
+// for at most 10000 keys at once, forgetting the least recently used
+// first. Answers with no window known aren't remembered, as anything can
+// follow them. Streams and batches aren't checked.
+func WithReplayDivergenceHandler(h ReplayDivergenceHandler) Option {
+	return func(c *Client) {
+		c.onReplayDivergence = h
+		c.replays = NewMemoryCache(replayMemorySize)
+	}
+}
+
+// WithStrictIdempotency fails the calls WithReplayDivergenceHandler would
+// report a divergence for with the *ReplayDivergence, after passing it to
+// the handler if there is one.
+func WithStrictIdempotency() Option {
+	return func(c *Client) {
+		c.strictIdempotency = true
+		c.replays = NewMemoryCache(replayMemorySize)
+	}
+}
+
+// replayRecord is what the client remembers of the first answer for an
+// idempotency key.
+type replayRecord struct {
+	RequestID string `json:"request_id"`
+	Hash      string `json:"hash"`
+}
+
+// checkReplay compares resp, the answer to a call sent with idempotency
+// key, with the one remembered for key, reports a divergence, and
+// remembers resp if it is the first known for key or diverged.
+func (c *Client) checkReplay(ctx context.Context, key string, resp *ReliAPIResponse, err error) (*ReliAPIResponse, error) {
+	if c.replays == nil || key == "" || err != nil || resp == nil {
+		return resp, err
+	}
+	hash := replayHash(resp.Data)
+	var d *ReplayDivergence
+	if raw, ok, _ := c.replays.Get(key); ok {
+		var first replayRecord
+		if json.Unmarshal(raw, &first) == nil {
+			d = &ReplayDivergence{
+				IdempotencyKey: key,
+				FirstRequestID: first.RequestID,
+				FirstHash:      first.Hash,
+				RequestID:      resp.Meta.RequestID,
+				Hash:           hash,
+				Window:         time.Duration(resp.Meta.IdempotencyTTLSeconds) * time.Second,
+				ExpiresAt:      resp.Meta.IdempotencyExpiresAt,
+			}
+			switch {
+			case !resp.Meta.IdempotentHit && !resp.Meta.CacheHit:
+				d.Reason = DivergenceNotReplayed
+			case hash != first.Hash:
+				d.Reason = DivergenceBody
+			default:
+				return resp, nil
+			}
+		}
+	}
+
+	ttl := c.idempotencyTTL
+	if !resp.Meta.IdempotencyExpiresAt.IsZero() {
+		ttl = resp.Meta.IdempotencyExpiresAt.Sub(c.now())
+	} else if resp.Meta.IdempotencyTTLSeconds > 0 {
+		ttl = time.Duration(resp.Meta.IdempotencyTTLSeconds) * time.Second
+	}
+	if ttl > 0 {
+		record, _ := json.Marshal(replayRecord{RequestID: resp.Meta.RequestID, Hash: hash})
+		_ = c.replays.Set(key, record, ttl)
+	}
+
+	if d == nil {
+		return resp, nil
+	}
+	if c.onReplayDivergence != nil {
+		c.onReplayDivergence(ctx, d)
+	}
+	if c.strictIdempotency {
+		return nil, d
+	}
+	return resp, nil
+}
+
+// replayHash is the SHA-256 of data in canonical form, so replays that
+// only differ in whitespace or key order match.
+func replayHash(data json.RawMessage) string {
+	canonical := []byte(data)
+	if v, err := decodeNumbers(data); err == nil {
+		var b strings.Builder
+		if writeCanonical(&b, v) == nil {
+			canonical = []byte(b.String())
+		}
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
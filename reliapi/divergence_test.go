@@ -0,0 +1,105 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rerunningProxy answers every request as run anew, with a body of its
+// own, and the meta fields set.
+func rerunningProxy(meta map[string]interface{}) http.HandlerFunc {
+	var calls atomic.Int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		m := map[string]interface{}{"request_id": fmt.Sprintf("req_%d", n)}
+		for k, v := range meta {
+			m[k] = v
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": fmt.Sprintf("answer %d", n)},
+			"meta":    m,
+		})
+	}
+}
+
+func TestReplayDivergenceWindow(t *testing.T) {
+	ctx := context.Background()
+	key := "k1"
+	req := HTTPRequest{Target: "api", Method: http.MethodPost, Path: "/charge", IdempotencyKey: &key}
+
+	for _, tt := range []struct {
+		name string
+		meta map[string]interface{}
+		opts []Option
+		want int
+	}{
+		// Anything may follow an answer with no window
+		{"no window", nil, nil, 0},
+		{"client TTL", nil, []Option{WithDefaultIdempotencyTTL(time.Hour)}, 2},
+		{"proxy TTL", map[string]interface{}{"idempotency_ttl_s": 60}, nil, 2},
+		{"window over", map[string]interface{}{"idempotency_expires_at": time.Now().Add(-time.Second)}, []Option{WithDefaultIdempotencyTTL(time.Hour)}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen []*ReplayDivergence
+			c := newTestClient(t, rerunningProxy(tt.meta), append(tt.opts, WithReplayDivergenceHandler(func(_ context.Context, d *ReplayDivergence) {
+				seen = append(seen, d)
+			}))...)
+			for i := 0; i < 3; i++ {
+				if _, err := c.ProxyHTTP(ctx, req); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(seen) != tt.want {
+				t.Fatalf("%d divergences, want %d", len(seen), tt.want)
+			}
+			for i, d := range seen {
+				if d.Reason != DivergenceNotReplayed || d.RequestID != fmt.Sprintf("req_%d", i+2) || d.FirstRequestID != fmt.Sprintf("req_%d", i+1) {
+					t.Errorf("divergence %d = %+v", i, d)
+				}
+			}
+		})
+	}
+
+	// Requests without a key aren't checked
+	var seen int
+	c := newTestClient(t, rerunningProxy(nil), WithDefaultIdempotencyTTL(time.Hour), WithReplayDivergenceHandler(func(context.Context, *ReplayDivergence) { seen++ }))
+	get := HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/items"}
+	for i := 0; i < 2; i++ {
+		if _, err := c.ProxyHTTP(ctx, get); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if seen != 0 || c.replays.Len() != 0 {
+		t.Errorf("%d divergences, %d keys remembered", seen, c.replays.Len())
+	}
+}
+
+func TestStrictIdempotency(t *testing.T) {
+	var hooked error
+	c := newTestClient(t, rerunningProxy(map[string]interface{}{"idempotency_ttl_s": 60}), WithStrictIdempotency(),
+		WithResponseHook(func(_ context.Context, _ *Request, _ *ReliAPIResponse, err error) { hooked = err }))
+	ctx := context.Background()
+	key := "k1"
+	req := LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("hi")}, IdempotencyKey: &key}
+	if _, err := c.ProxyLLM(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.ProxyLLM(ctx, req)
+	var d *ReplayDivergence
+	if resp != nil || !errors.As(err, &d) || d.Window != time.Minute || IdempotencyKeyOf(err) != key {
+		t.Fatalf("resp %v, err %v", resp, err)
+	}
+	if !errors.Is(hooked, ErrReplayDivergence) {
+		t.Errorf("response hook saw %v", hooked)
+	}
+	if IsRetriable(err) {
+		t.Error("a divergence is retriable")
+	}
+}
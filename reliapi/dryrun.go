@@ -0,0 +1,27 @@
+package reliapi
+
+import "context"
+
+// Validate sends req as a dry run (see LLMRequest.DryRun) and returns the
+// meta the proxy would answer it with: the resolved target version, cache
+// key, whether a cache entry exists and the cost estimate. Validation and
+// budget failures come back as the errors ProxyLLM would return, but
+// nothing is sent upstream, charged or cached.
+func (c *Client) Validate(ctx context.Context, req LLMRequest) (*Meta, error) {
+	req.DryRun = true
+	resp, err := c.ProxyLLM(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Meta, nil
+}
+
+// ValidateHTTP is Validate for an HTTPRequest.
+func (c *Client) ValidateHTTP(ctx context.Context, req HTTPRequest) (*Meta, error) {
+	req.DryRun = true
+	resp, err := c.ProxyHTTP(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Meta, nil
+}
@@ -0,0 +1,80 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var body map[string]interface{}
+		raw, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &body)
+		if body["dry_run"] != true {
+			t.Errorf("dry_run = %v", body["dry_run"])
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    nil,
+			"meta": map[string]interface{}{
+				"request_id": "req_1", "target": "openai", "dry_run": true, "cache_key": "abc",
+				"cache_entry_exists": true, "cost_estimate_usd": 0.002, "target_version": 3,
+			},
+		})
+	}, WithCoalescing(ShareLeaderError))
+
+	meta, err := c.Validate(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !meta.DryRun || meta.CacheKey != "abc" || !meta.CacheEntryExists || *meta.CostEstimateUSD != 0.002 || meta.TargetVersion != 3 {
+		t.Errorf("meta = %+v", meta)
+	}
+
+	meta, err = c.ValidateHTTP(context.Background(), HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/users"})
+	if err != nil || !meta.DryRun {
+		t.Errorf("ValidateHTTP = %+v, %v", meta, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
+
+func TestValidateHTTPUpstreamRequest(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    nil,
+			"meta": map[string]interface{}{
+				"request_id": "req_1", "target": "api", "dry_run": true,
+				"upstream_request": map[string]interface{}{
+					"method": "POST", "url": "https://api.example.com/v2/users",
+					"headers": map[string]interface{}{"X-Org": "acme"}, "query": nil, "body": `{"input": {"name": "Ada"}}`,
+				},
+				"transformations_applied": []string{"header:X-Org", "path_rule:0", "request_body"},
+			},
+		})
+	})
+
+	meta, err := c.ValidateHTTP(context.Background(), HTTPRequest{Target: "api", Method: http.MethodPost, Path: "/users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := meta.UpstreamRequest
+	if up == nil || up.Method != "POST" || up.URL != "https://api.example.com/v2/users" || up.Headers["X-Org"] != "acme" ||
+		up.Body != `{"input": {"name": "Ada"}}` {
+		t.Errorf("UpstreamRequest = %+v", up)
+	}
+	if len(meta.TransformationsApplied) != 3 || meta.TransformationsApplied[2] != "request_body" {
+		t.Errorf("TransformationsApplied = %v", meta.TransformationsApplied)
+	}
+	if len(meta.Extra) != 0 {
+		t.Errorf("Extra = %v", meta.Extra)
+	}
+}
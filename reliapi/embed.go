@@ -0,0 +1,347 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrInputTooLong is matched by an InputTooLongError.
+var ErrInputTooLong = errors.New("reliapi: embeddings input exceeds the token limit")
+
+// InputTooLongError is returned by Embed, under OverLimitError, for an
+// input with more tokens than the model accepts. It matches
+// ErrInputTooLong.
+type InputTooLongError struct {
+	// Index is the position of the input.
+	Index int
+	// Tokens is its size as CountTokens estimates it, and Limit the
+	// options' MaxInputTokens.
+	Tokens int
+	Limit  int
+}
+
+func (e *InputTooLongError) Error() string {
+	return fmt.Sprintf("%v: input %d has about %d tokens, over %d", ErrInputTooLong, e.Index, e.Tokens, e.Limit)
+}
+
+// Is reports whether target is ErrInputTooLong.
+func (e *InputTooLongError) Is(target error) bool { return target == ErrInputTooLong }
+
+// OverLimitPolicy decides what Embed does with an input over
+// EmbeddingsOptions.MaxInputTokens, which the provider would reject.
+type OverLimitPolicy int
+
+const (
+	// OverLimitError fails the call with an *InputTooLongError before
+	// anything is sent.
+	OverLimitError OverLimitPolicy = iota
+	// OverLimitTruncate embeds the start of the input, up to the limit.
+	OverLimitTruncate
+	// OverLimitChunk splits the input into chunks within the limit,
+	// embeds each, and returns their mean weighted by the chunks' tokens.
+	OverLimitChunk
+)
+
+// EmbeddingsOptions configures Embed.
+type EmbeddingsOptions struct {
+	// Model defaults to the target's embedding_model.
+	Model string
+	// Dimensions truncates the vectors to their first Dimensions
+	// components, which keeps their meaning for models trained to allow
+	// it (Matryoshka embeddings, such as OpenAI's text-embedding-3).
+	// Together with Normalize, the result is what the dimensions parameter
+	// of such a model returns, and the proxy caches the full vectors once
+	// for every size. Vectors shorter than Dimensions fail the call. Zero
+	// keeps the vectors whole; EmbeddingsRequest.Dimensions asks the
+	// provider instead.
+	Dimensions int
+	// Normalize scales every vector to unit length, after truncation and
+	// chunk averaging, so that dot products are cosine similarities.
+	Normalize bool
+	// InputType is sent as EmbeddingsRequest.InputType.
+	InputType string
+	// MaxInputTokens is the most tokens an input may have, counted with
+	// the CountTokens heuristic, so set it with a margin when inputs are
+	// close to the provider's limit. It defaults to 8192 for mistral-embed
+	// models and to 8191, the limit of OpenAI's, for the others and an
+	// empty Model.
+	MaxInputTokens int
+	// OverLimit is what becomes of inputs over MaxInputTokens.
+	OverLimit OverLimitPolicy
+	// BatchSize is the most inputs, or chunks of inputs, sent per proxy
+	// request; 100 when zero.
+	BatchSize int
+	// MaxParallel caps the proxy requests in flight at once; 4 when zero.
+	MaxParallel int
+
+	Cache *int
+	// Retry overrides the target's upstream retry policy for the requests.
+	Retry *RetryPolicy
+	// TenantID selects the API key the requests authenticate with, via
+	// WithTenantKeyProvider.
+	TenantID string
+}
+
+// Defaults of EmbeddingsOptions.
+const (
+	embedBatchSize   = 100
+	embedMaxParallel = 4
+	embedTokenLimit  = 8191
+)
+
+// embedPiece is an input, or a chunk of one, as sent to the proxy.
+type embedPiece struct {
+	text   string
+	tokens int
+}
+
+// Embed embeds any number of inputs through target, in batches of
+// opts.BatchSize sent by up to opts.MaxParallel concurrent ProxyEmbeddings
+// calls, and applies the options to the vectors. The response holds a
+// vector per input in input order, whatever order the batches complete
+// in; PromptTokens and Meta.CostUSD are the totals of the batches, and the
+// rest of Meta is that of the first. An input split under OverLimitChunk
+// is a cache hit when all of its chunks are.
+//
+// The first batch to fail cancels the others and fails the call with its
+// error.
+func (c *Client) Embed(ctx context.Context, target string, inputs []string, opts EmbeddingsOptions) (*EmbeddingsResponse, error) {
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("reliapi: embeddings input is empty")
+	}
+	if opts.Dimensions < 0 {
+		return nil, fmt.Errorf("reliapi: embeddings dimensions must be positive, got %d", opts.Dimensions)
+	}
+	limit := opts.MaxInputTokens
+	if limit <= 0 {
+		limit = embedTokenLimit
+		if strings.HasPrefix(opts.Model, "mistral-embed") {
+			limit = 8192
+		}
+	}
+	nonASCII := nonASCIICharsPerToken(opts.Model)
+
+	// pieces[spans[i]:spans[i+1]] are the pieces of input i
+	var pieces []embedPiece
+	spans := make([]int, 1, len(inputs)+1)
+	for i, text := range inputs {
+		chunks := splitTokens(text, limit, nonASCII)
+		if len(chunks) > 1 {
+			switch opts.OverLimit {
+			case OverLimitTruncate:
+				chunks = chunks[:1]
+			case OverLimitChunk:
+			default:
+				tokens := 0
+				for _, p := range chunks {
+					tokens += p.tokens
+				}
+				return nil, &InputTooLongError{Index: i, Tokens: tokens, Limit: limit}
+			}
+		}
+		pieces = append(pieces, chunks...)
+		spans = append(spans, len(pieces))
+	}
+
+	batches, err := c.embedPieces(ctx, target, pieces, opts)
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, 0, len(pieces))
+	hits := make([]bool, 0, len(pieces))
+	out := &EmbeddingsResponse{Meta: batches[0].Meta, IdempotencyKey: batches[0].IdempotencyKey}
+	cost, costed := 0.0, false
+	for _, b := range batches {
+		vectors = append(vectors, b.Embeddings...)
+		hits = append(hits, b.CacheHits...)
+		out.PromptTokens += b.PromptTokens
+		if b.Meta.CostUSD != nil {
+			cost, costed = cost+*b.Meta.CostUSD, true
+		}
+	}
+	if costed {
+		out.Meta.CostUSD = &cost
+	}
+
+	out.Embeddings = make([][]float32, len(inputs))
+	out.CacheHits = make([]bool, len(inputs))
+	for i := range inputs {
+		first, end := spans[i], spans[i+1]
+		v, err := meanVector(vectors[first:end], pieces[first:end])
+		if err != nil {
+			return nil, fmt.Errorf("reliapi: embeddings input %d: %w", i, err)
+		}
+		if opts.Dimensions > 0 {
+			if len(v) < opts.Dimensions {
+				return nil, fmt.Errorf("reliapi: embeddings input %d: vector has %d dimensions, %d requested", i, len(v), opts.Dimensions)
+			}
+			v = v[:opts.Dimensions:opts.Dimensions]
+		}
+		if opts.Normalize {
+			normalize(v)
+		}
+		out.Embeddings[i] = v
+		out.CacheHits[i] = true
+		for _, hit := range hits[first:end] {
+			out.CacheHits[i] = out.CacheHits[i] && hit
+		}
+	}
+	return out, nil
+}
+
+// embedPieces sends pieces in batches, concurrently, and returns the
+// responses in the order of the batches.
+func (c *Client) embedPieces(ctx context.Context, target string, pieces []embedPiece, opts EmbeddingsOptions) ([]*EmbeddingsResponse, error) {
+	size := opts.BatchSize
+	if size <= 0 {
+		size = embedBatchSize
+	}
+	parallel := opts.MaxParallel
+	if parallel <= 0 {
+		parallel = embedMaxParallel
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make([]*EmbeddingsResponse, (len(pieces)+size-1)/size)
+	sem := make(chan struct{}, parallel)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+	for b := range batches {
+		batch := pieces[b*size : min((b+1)*size, len(pieces))]
+		texts := make([]string, len(batch))
+		for i, p := range batch {
+			texts[i] = p.text
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				fail(ctx.Err())
+				return
+			}
+			resp, err := c.ProxyEmbeddings(ctx, EmbeddingsRequest{
+				Target:    target,
+				Model:     opts.Model,
+				Input:     texts,
+				InputType: opts.InputType,
+				Cache:     opts.Cache,
+				Retry:     opts.Retry,
+				TenantID:  opts.TenantID,
+			})
+			if err == nil && len(resp.Embeddings) != len(texts) {
+				err = fmt.Errorf("reliapi: embeddings response has %d vectors for %d inputs", len(resp.Embeddings), len(texts))
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+			if len(resp.CacheHits) != len(texts) {
+				resp.CacheHits = make([]bool, len(texts))
+			}
+			batches[b] = resp
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return batches, nil
+}
+
+// splitTokens splits text into pieces of at most limit tokens, as
+// textTokens counts them, cutting between runs of letters, digits and
+// symbols, and within runs longer than limit. A text within the limit is a
+// single piece.
+func splitTokens(text string, limit, nonASCIIPerToken int) []embedPiece {
+	var pieces []embedPiece
+	// text[start:pos] is the current piece, of n tokens
+	start, pos, n := 0, 0, 0
+	for pos < len(text) {
+		run := nextRun(text[pos:], nonASCIIPerToken)
+		for run.tokens() > limit {
+			if pos > start {
+				pieces = append(pieces, embedPiece{text[start:pos], n})
+			}
+			// Cut after the characters of limit tokens
+			cut, chars := 0, limit*run.perToken
+			for ; chars > 0; chars-- {
+				_, size := utf8.DecodeRuneInString(run.text[cut:])
+				cut += size
+			}
+			pieces = append(pieces, embedPiece{text[pos : pos+cut], limit})
+			pos += cut
+			start, n = pos, 0
+			run = nextRun(text[pos:], nonASCIIPerToken)
+		}
+		if tokens := run.tokens(); n+tokens > limit {
+			pieces = append(pieces, embedPiece{text[start:pos], n})
+			start, n = pos, 0
+		}
+		n += run.tokens()
+		pos += run.size
+	}
+	if pos > start || len(pieces) == 0 {
+		pieces = append(pieces, embedPiece{text[start:], n})
+	}
+	return pieces
+}
+
+// meanVector returns the mean of vectors weighted by the tokens of their
+// pieces, as a new slice.
+func meanVector(vectors [][]float32, pieces []embedPiece) ([]float32, error) {
+	if len(vectors) == 1 {
+		return append([]float32(nil), vectors[0]...), nil
+	}
+	sum := make([]float64, len(vectors[0]))
+	weights := 0.0
+	for i, v := range vectors {
+		if len(v) != len(sum) {
+			return nil, fmt.Errorf("chunks have vectors of %d and %d dimensions", len(sum), len(v))
+		}
+		w := float64(max(pieces[i].tokens, 1))
+		for j, x := range v {
+			sum[j] += w * float64(x)
+		}
+		weights += w
+	}
+	mean := make([]float32, len(sum))
+	for j, x := range sum {
+		mean[j] = float32(x / weights)
+	}
+	return mean, nil
+}
+
+// normalize scales v to unit length; a zero vector is left as it is.
+func normalize(v []float32) {
+	var sq float64
+	for _, x := range v {
+		sq += float64(x) * float64(x)
+	}
+	if sq == 0 {
+		return
+	}
+	norm := math.Sqrt(sq)
+	for i, x := range v {
+		v[i] = float32(float64(x) / norm)
+	}
+}
@@ -0,0 +1,236 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// embeddingsProxy answers embeddings requests with vector(text) for every
+// input, a token per input, and a cost of 0.5 per request.
+func embeddingsProxy(t *testing.T, vector func(text string) []float32, seen func(body EmbeddingsRequest)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body EmbeddingsRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		var inputs []string
+		for _, in := range body.Input.([]interface{}) {
+			inputs = append(inputs, in.(string))
+		}
+		if seen != nil {
+			body.Input = inputs
+			seen(body)
+		}
+		vectors := make([][]float32, len(inputs))
+		hits := make([]bool, len(inputs))
+		for i, in := range inputs {
+			vectors[i] = vector(in)
+			hits[i] = strings.HasPrefix(in, "cached")
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"embeddings": vectors, "cache_hits": hits, "prompt_tokens": len(inputs)},
+			"meta":    map[string]interface{}{"request_id": "req_" + inputs[0], "cost_usd": 0.5},
+		})
+	}
+}
+
+func TestEmbedOrder(t *testing.T) {
+	// The first batches answer last
+	var batches atomic.Int32
+	var mu sync.Mutex
+	var inputTypes []string
+	c := newTestClient(t, embeddingsProxy(t, func(text string) []float32 {
+		var n float32
+		fmt.Sscanf(text[strings.LastIndex(text, " ")+1:], "%g", &n)
+		return []float32{n, 1}
+	}, func(body EmbeddingsRequest) {
+		mu.Lock()
+		inputTypes = append(inputTypes, body.InputType)
+		mu.Unlock()
+		time.Sleep(time.Duration(10-batches.Add(1)) * 5 * time.Millisecond)
+	}))
+	var inputs []string
+	for i := 0; i < 20; i++ {
+		prefix := "doc"
+		if i%2 == 0 {
+			prefix = "cached doc"
+		}
+		inputs = append(inputs, fmt.Sprintf("%s %d", prefix, i))
+	}
+
+	resp, err := c.Embed(context.Background(), "openai", inputs, EmbeddingsOptions{BatchSize: 2, MaxParallel: 10, InputType: InputTypeDocument})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Embeddings) != len(inputs) {
+		t.Fatalf("%d vectors", len(resp.Embeddings))
+	}
+	for i, v := range resp.Embeddings {
+		if v[0] != float32(i) || resp.CacheHits[i] != (i%2 == 0) {
+			t.Errorf("input %d: vector %v, cache hit %v", i, v, resp.CacheHits[i])
+		}
+	}
+	if resp.PromptTokens != 20 || *resp.Meta.CostUSD != 5 || resp.Meta.RequestID != "req_cached doc 0" {
+		t.Errorf("resp = %+v, meta %+v", resp, resp.Meta)
+	}
+	if len(inputTypes) != 10 || inputTypes[0] != InputTypeDocument {
+		t.Errorf("input types = %q", inputTypes)
+	}
+}
+
+func TestEmbedFailure(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]interface{}{"type": "client_error", "code": "BAD_REQUEST", "message": "bad input"},
+			})
+			return
+		}
+		embeddingsProxy(t, func(string) []float32 { return []float32{1} }, nil)(w, r)
+	})
+	_, err := c.Embed(context.Background(), "openai", []string{"a", "b", "c"}, EmbeddingsOptions{BatchSize: 1, MaxParallel: 1})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeBadRequest {
+		t.Fatalf("err = %v", err)
+	}
+	// The whole call fails with the first error, and the rest is canceled
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d requests", n)
+	}
+	if _, err := c.Embed(context.Background(), "openai", nil, EmbeddingsOptions{}); err == nil {
+		t.Error("no inputs: no error")
+	}
+}
+
+func TestEmbedDimensions(t *testing.T) {
+	c := newTestClient(t, embeddingsProxy(t, func(string) []float32 { return []float32{3, 4, 12, 99} }, nil))
+	ctx := context.Background()
+
+	resp, err := c.Embed(ctx, "openai", []string{"a"}, EmbeddingsOptions{Dimensions: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := resp.Embeddings[0]; len(v) != 3 || cap(v) != 3 || v[0] != 3 || v[2] != 12 {
+		t.Errorf("truncated = %v", v)
+	}
+	resp, err = c.Embed(ctx, "openai", []string{"a"}, EmbeddingsOptions{Dimensions: 3, Normalize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := resp.Embeddings[0]; v[0] != 3.0/13 || v[1] != 4.0/13 || v[2] != 12.0/13 {
+		t.Errorf("normalized = %v", v)
+	}
+	if _, err := c.Embed(ctx, "openai", []string{"a"}, EmbeddingsOptions{Dimensions: 5}); err == nil || !strings.Contains(err.Error(), "vector has 4 dimensions, 5 requested") {
+		t.Errorf("too many dimensions: %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, v := range [][]float32{{1, 1, 1, 1}, {-2, 0.5, 1e-3}, {1e20, 1e20}, {1e-20, 3e-20}} {
+		normalize(v)
+		var sq float64
+		for _, x := range v {
+			sq += float64(x) * float64(x)
+		}
+		if math.Abs(sq-1) > 1e-6 {
+			t.Errorf("%v has a squared norm of %g", v, sq)
+		}
+	}
+	zero := []float32{0, 0}
+	normalize(zero)
+	if zero[0] != 0 || zero[1] != 0 {
+		t.Errorf("zero vector = %v", zero)
+	}
+}
+
+func TestEmbedOverLimit(t *testing.T) {
+	var sent [][]string
+	vectors := map[string][]float32{"short": {1, 0}, "one two three four ": {0, 3}, "five six": {6, 0}}
+	c := newTestClient(t, embeddingsProxy(t, func(text string) []float32 { return vectors[text] }, func(body EmbeddingsRequest) {
+		sent = append(sent, body.Input.([]string))
+	}))
+	ctx := context.Background()
+	inputs := []string{"short", "one two three four five six"}
+
+	_, err := c.Embed(ctx, "openai", inputs, EmbeddingsOptions{MaxInputTokens: 4})
+	var tooLong *InputTooLongError
+	if !errors.As(err, &tooLong) || !errors.Is(err, ErrInputTooLong) || *tooLong != (InputTooLongError{Index: 1, Tokens: 6, Limit: 4}) {
+		t.Fatalf("err = %v", err)
+	}
+	if len(sent) != 0 {
+		t.Errorf("sent %q", sent)
+	}
+
+	resp, err := c.Embed(ctx, "openai", inputs, EmbeddingsOptions{MaxInputTokens: 4, OverLimit: OverLimitTruncate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sent[0], "|"); got != "short|one two three four " {
+		t.Errorf("truncated inputs = %q", got)
+	}
+	if v := resp.Embeddings[1]; v[0] != 0 || v[1] != 3 {
+		t.Errorf("truncated vector = %v", v)
+	}
+
+	// Chunk vectors are averaged by their tokens, 4 and 2, then normalized
+	resp, err = c.Embed(ctx, "openai", inputs, EmbeddingsOptions{MaxInputTokens: 4, OverLimit: OverLimitChunk, Normalize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sent[1], "|"); got != "short|one two three four |five six" {
+		t.Errorf("chunked inputs = %q", got)
+	}
+	if v := resp.Embeddings[1]; v[0] != float32(math.Sqrt(0.5)) || v[1] != float32(math.Sqrt(0.5)) {
+		t.Errorf("chunked vector = %v", v)
+	}
+	if v := resp.Embeddings[0]; v[0] != 1 || v[1] != 0 || len(resp.CacheHits) != 2 {
+		t.Errorf("short vector = %v, cache hits %v", v, resp.CacheHits)
+	}
+}
+
+func TestSplitTokens(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	pieces := splitTokens(long, 4, 3)
+	if len(pieces) != 4 || pieces[0].text != long[:32] || pieces[3].text != long[96:] || pieces[3].tokens != 1 {
+		t.Errorf("pieces = %+v", pieces)
+	}
+
+	for _, text := range []string{
+		"",
+		"within",
+		strings.Repeat("héllo wörld 12345678 !!?  ", 40),
+		strings.Repeat("日本語のテキスト", 30) + strings.Repeat("Ω", 50),
+		strings.Repeat(" ", 20) + strings.Repeat("x", 200),
+	} {
+		for _, limit := range []int{1, 3, 7, 50} {
+			pieces := splitTokens(text, limit, 3)
+			var joined strings.Builder
+			total := 0
+			for _, p := range pieces {
+				if n := textTokens(p.text, 3); n != p.tokens || n > limit {
+					t.Errorf("limit %d: piece %q has %d tokens, counted %d", limit, p.text, n, p.tokens)
+				}
+				joined.WriteString(p.text)
+				total += p.tokens
+			}
+			if joined.String() != text || total != textTokens(text, 3) {
+				t.Errorf("limit %d: pieces of %q don't add up: %d tokens", limit, text, total)
+			}
+			if within := textTokens(text, 3) <= limit; within != (len(pieces) == 1) {
+				t.Errorf("limit %d: %q split in %d", limit, text, len(pieces))
+			}
+		}
+	}
+}
@@ -0,0 +1,486 @@
+// Package embedded runs a ReliAPI proxy in-process, for developing against
+// real upstreams without the hosted service or a Redis-backed deployment,
+// and for integration tests of code that uses the client.
+//
+// The server answers POST /v1/proxy/llm and /v1/proxy/http, and GET
+// /readyz, for the targets of its Config. Like the proxy it caches
+// responses under the same keys (see reliapi.CanonicalCacheKey), replays
+// idempotency keys, enforces per-request and total budget caps and checks
+// requests against reliapi.BundledModels, with its state in a Store, in
+// memory by default:
+//
+//	srv, err := embedded.Start(embedded.Config{
+//		Targets: map[string]embedded.Target{
+//			"openai": {
+//				BaseURL: "https://api.openai.com/v1",
+//				LLM:     &embedded.LLM{APIKey: os.Getenv("OPENAI_API_KEY"), DefaultModel: "gpt-4o-mini"},
+//			},
+//		},
+//	})
+//	if err != nil { ... }
+//	defer srv.Close()
+//	client, err := reliapi.NewClient(srv.URL, "")
+//
+// It is a subset of the proxy: LLM targets speak the OpenAI chat
+// completions API, and streaming, templates, fallbacks, hedging, batches,
+// async jobs and the other endpoints are not served. Requests using them
+// fail with a BAD_REQUEST or STREAMING_UNSUPPORTED error.
+package embedded
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+const (
+	llmProxyPath  = "/v1/proxy/llm"
+	httpProxyPath = "/v1/proxy/http"
+	readyzPath    = "/readyz"
+
+	defaultAddr = "127.0.0.1:0"
+
+	// DefaultCacheTTL is how long responses are cached when neither the
+	// request nor its Target says.
+	DefaultCacheTTL = time.Hour
+
+	spentKey = "budget:spent"
+)
+
+// Config configures a Server.
+type Config struct {
+	// Addr is the address to listen on; empty means a free port of
+	// 127.0.0.1.
+	Addr string
+	// APIKey, when set, must be sent by clients (the X-API-Key header);
+	// requests without it fail with UNAUTHORIZED.
+	APIKey string
+	// Targets are the upstreams the server proxies to, by name.
+	Targets map[string]Target
+	// Store keeps the cache, idempotency records and spend; nil means a
+	// new MemoryStore.
+	Store Store
+	// BudgetCapUSD caps what the server's LLM requests may cost in total;
+	// a request whose estimate doesn't fit in what is left fails with
+	// BUDGET_EXCEEDED. Zero means no cap.
+	BudgetCapUSD float64
+	// HTTPClient makes the upstream calls; nil means a client with the
+	// default transport.
+	HTTPClient *http.Client
+}
+
+// Target is an upstream of a Server.
+type Target struct {
+	// BaseURL is where the target's paths are resolved, e.g.
+	// "https://api.openai.com/v1".
+	BaseURL string
+	// Headers are sent with every upstream request, such as an
+	// Authorization header of an HTTP target.
+	Headers map[string]string
+	// CacheTTL is how long responses are cached unless the request says
+	// (its Cache field); zero means DefaultCacheTTL. NoCache turns caching
+	// off for the target.
+	CacheTTL time.Duration
+	NoCache  bool
+	// MaxAttempts is the number of upstream calls a request may make when
+	// the upstream answers 429 or 5xx or can't be reached, unless the
+	// request's Retry says; zero means 3.
+	MaxAttempts int
+	// LLM makes the target serve /v1/proxy/llm; nil targets only serve
+	// /v1/proxy/http.
+	LLM *LLM
+}
+
+// LLM configures a Target that serves /v1/proxy/llm through an
+// OpenAI-compatible chat completions API at BaseURL + "/chat/completions".
+type LLM struct {
+	// APIKey is sent as a bearer token.
+	APIKey string
+	// DefaultModel is used for requests that name no model.
+	DefaultModel string
+	// InputUSDPerMTok and OutputUSDPerMTok are the prices of a million
+	// prompt and completion tokens, for Meta.CostUSD and the budget caps.
+	// Zero prices make every request free.
+	InputUSDPerMTok  float64
+	OutputUSDPerMTok float64
+}
+
+// Server is a running embedded proxy. It is safe for concurrent use.
+type Server struct {
+	// URL is the base URL clients use, e.g. "http://127.0.0.1:54321".
+	URL string
+
+	cfg      Config
+	store    Store
+	client   *http.Client
+	srv      *http.Server
+	done     chan struct{}
+	requests atomic.Int64
+	locks    keyLocks
+}
+
+// Start validates cfg and starts serving it on cfg.Addr in the
+// background. Stop the server with Close.
+func Start(cfg Config) (*Server, error) {
+	if len(cfg.Targets) == 0 {
+		return nil, errors.New("embedded: no targets configured")
+	}
+	for name, target := range cfg.Targets {
+		if target.BaseURL == "" {
+			return nil, fmt.Errorf("embedded: target %q has no BaseURL", name)
+		}
+	}
+	s := &Server{cfg: cfg, store: cfg.Store, client: cfg.HTTPClient, done: make(chan struct{})}
+	if s.store == nil {
+		s.store = NewMemoryStore()
+	}
+	if s.client == nil {
+		s.client = &http.Client{}
+	}
+	addr := cfg.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("embedded: listen: %w", err)
+	}
+	s.URL = "http://" + ln.Addr().String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+llmProxyPath, s.serveLLM)
+	mux.HandleFunc("POST "+httpProxyPath, s.serveHTTP)
+	mux.HandleFunc("GET "+readyzPath, s.serveReadyz)
+	s.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		defer close(s.done)
+		_ = s.srv.Serve(ln)
+	}()
+	return s, nil
+}
+
+// Close stops the server and waits for it to exit. Requests in flight are
+// cut off.
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	<-s.done
+	return err
+}
+
+// Client returns a Client of the server, configured with opts.
+func (s *Server) Client(opts ...reliapi.Option) (*reliapi.Client, error) {
+	return reliapi.NewClient(s.URL, s.cfg.APIKey, opts...)
+}
+
+func (s *Server) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, reliapi.Health{
+		Status: reliapi.HealthReady,
+		Components: map[string]reliapi.ComponentStatus{
+			"cache":  {Status: "ok", Detail: fmt.Sprintf("%T", s.store)},
+			"config": {Status: "ok", Detail: fmt.Sprintf("%d targets", len(s.cfg.Targets))},
+		},
+	})
+}
+
+// exchange is the state of one request while it is served.
+type exchange struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	id      string
+	started time.Time
+}
+
+// begin authenticates a request and decodes its body into v.
+func (s *Server) begin(w http.ResponseWriter, r *http.Request, v interface{}) (*exchange, bool) {
+	x := &exchange{w: w, r: r, id: fmt.Sprintf("req_embedded_%d", s.requests.Add(1)), started: time.Now()}
+	if s.cfg.APIKey != "" && r.Header.Get("X-API-Key") != s.cfg.APIKey {
+		x.fail(&reliapi.APIError{
+			StatusCode: http.StatusUnauthorized, Type: "client_error", Code: reliapi.CodeUnauthorized, Message: "Invalid API key",
+		})
+		return nil, false
+	}
+	body := io.Reader(r.Body)
+	switch encoding := strings.ToLower(r.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+	case "gzip":
+		// As on the proxy, for clients using WithCompression
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			x.fail(badRequest("Request body is not valid gzip: " + err.Error()))
+			return nil, false
+		}
+		body = zr
+	default:
+		x.fail(badRequest(fmt.Sprintf("Unsupported Content-Encoding '%s'; use gzip", encoding)))
+		return nil, false
+	}
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		x.fail(badRequest("invalid request body: " + err.Error()))
+		return nil, false
+	}
+	return x, true
+}
+
+func (x *exchange) stamp(meta *reliapi.Meta) {
+	meta.RequestID = x.id
+	meta.DurationMs = int(time.Since(x.started) / time.Millisecond)
+}
+
+func (x *exchange) succeed(data json.RawMessage, meta reliapi.Meta) {
+	x.stamp(&meta)
+	x.w.Header().Set("X-Request-ID", x.id)
+	x.w.Header().Set("X-Cache-Hit", strconv.FormatBool(meta.CacheHit))
+	writeJSON(x.w, http.StatusOK, map[string]interface{}{"success": true, "data": data, "meta": meta})
+}
+
+func (x *exchange) fail(err *reliapi.APIError) {
+	e := *err
+	if e.StatusCode == 0 {
+		e.StatusCode = http.StatusBadGateway
+	}
+	if e.RequestID == "" {
+		e.RequestID = x.id
+	}
+	x.w.Header().Set("X-Request-ID", x.id)
+	if e.RetryAfter > 0 {
+		x.w.Header().Set("Retry-After", strconv.Itoa(int((e.RetryAfter+time.Second-1)/time.Second)))
+	}
+	writeJSON(x.w, e.StatusCode, errorEnvelope(&e, time.Since(x.started)))
+}
+
+// call is a proxied request, as both routes serve it.
+type call struct {
+	// requestHash tells requests sent with the same idempotency key apart.
+	requestHash string
+	// cacheKey is empty for requests that are not cached.
+	cacheKey string
+	cacheTTL time.Duration
+
+	idempotencyKey *string
+	idempotencyTTL *int
+
+	// upstream makes the call. Its meta is returned as it is, stamped with
+	// the request ID and duration; with Truncated or an UpstreamStatus of
+	// 400 or more, the response is not cached.
+	upstream func(ctx context.Context) (json.RawMessage, reliapi.Meta, *reliapi.APIError)
+}
+
+// record is an answer kept in the Store, for the cache or an idempotency
+// key.
+type record struct {
+	RequestHash string          `json:"request_hash"`
+	RequestID   string          `json:"request_id"`
+	Data        json.RawMessage `json:"data"`
+	Meta        reliapi.Meta    `json:"meta"`
+	FirstSeenAt time.Time       `json:"first_seen_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+	Replays     int             `json:"replays"`
+}
+
+// serve answers c from the cache or its idempotency key's record, or else
+// calls the upstream and keeps a successful answer for both.
+func (s *Server) serve(x *exchange, c call) {
+	if c.cacheKey != "" {
+		if rec, ok := s.load("cache:" + c.cacheKey); ok {
+			meta := rec.Meta
+			meta.CacheHit = true
+			meta.IdempotentHit = false
+			zero := 0.0
+			meta.CostUSD = &zero
+			x.succeed(rec.Data, meta)
+			return
+		}
+	}
+	if c.idempotencyKey != nil {
+		// Identical requests in flight wait for the first one's record
+		unlock := s.locks.lock(*c.idempotencyKey)
+		defer unlock()
+		if s.replay(x, c) {
+			return
+		}
+	}
+
+	data, meta, apiErr := c.upstream(x.r.Context())
+	if apiErr != nil {
+		x.fail(apiErr)
+		return
+	}
+	x.stamp(&meta)
+	now := time.Now().UTC()
+	if c.cacheKey != "" && !meta.Truncated && meta.UpstreamStatus < 400 {
+		rec := record{RequestHash: c.requestHash, RequestID: x.id, Data: data, Meta: meta, FirstSeenAt: now}
+		s.save("cache:"+c.cacheKey, rec, c.cacheTTL)
+	}
+	if c.idempotencyKey != nil {
+		// As on the proxy, the key is kept for its TTL, or else as long as
+		// the cache entry
+		lifetime := c.cacheTTL
+		if c.idempotencyTTL != nil {
+			lifetime = time.Duration(*c.idempotencyTTL) * time.Second
+		}
+		if lifetime <= 0 {
+			lifetime = DefaultCacheTTL
+		}
+		meta.IdempotencyTTLSeconds = int(lifetime / time.Second)
+		meta.IdempotencyExpiresAt = now.Add(lifetime)
+		rec := record{
+			RequestHash: c.requestHash, RequestID: x.id, Data: data, Meta: meta,
+			FirstSeenAt: now, ExpiresAt: meta.IdempotencyExpiresAt,
+		}
+		s.save("idempotency:"+*c.idempotencyKey, rec, lifetime)
+	}
+	x.succeed(data, meta)
+}
+
+// replay answers c with the record of its idempotency key, or an
+// IDEMPOTENCY_CONFLICT if the key was used for another request, and
+// reports whether it did.
+func (s *Server) replay(x *exchange, c call) bool {
+	key := "idempotency:" + *c.idempotencyKey
+	rec, ok := s.load(key)
+	if !ok {
+		return false
+	}
+	if rec.RequestHash != c.requestHash {
+		x.fail(&reliapi.APIError{
+			StatusCode: http.StatusConflict,
+			Type:       "idempotency_conflict",
+			Code:       reliapi.CodeIdempotencyConflict,
+			Message:    fmt.Sprintf("Idempotency key '%s' used with different request", *c.idempotencyKey),
+			Details:    map[string]interface{}{"existing_request_id": rec.RequestID},
+		})
+		return true
+	}
+	rec.Replays++
+	if remaining := time.Until(rec.ExpiresAt); remaining > 0 {
+		s.save(key, rec, remaining)
+	}
+	meta := rec.Meta
+	meta.IdempotentHit = true
+	meta.IdempotencyFirstSeenAt = rec.FirstSeenAt
+	meta.IdempotencyReplayCount = rec.Replays
+	x.succeed(rec.Data, meta)
+	return true
+}
+
+// load returns the record under key. A Store that fails is treated as a
+// miss, as the proxy does when Redis is down.
+func (s *Server) load(key string) (record, bool) {
+	raw, ok, err := s.store.Get(key)
+	if err != nil || !ok {
+		return record{}, false
+	}
+	var rec record
+	if json.Unmarshal(raw, &rec) != nil {
+		return record{}, false
+	}
+	return rec, true
+}
+
+func (s *Server) save(key string, rec record, ttl time.Duration) {
+	raw, err := json.Marshal(rec)
+	if err == nil {
+		_ = s.store.Set(key, raw, ttl)
+	}
+}
+
+// cacheTTL is how long a response of target is cached: the request's
+// cache (seconds), or else the target's TTL. Zero means not at all.
+func cacheTTL(target Target, requested *int) time.Duration {
+	if target.NoCache {
+		return 0
+	}
+	if requested != nil {
+		return time.Duration(*requested) * time.Second
+	}
+	if target.CacheTTL > 0 {
+		return target.CacheTTL
+	}
+	return DefaultCacheTTL
+}
+
+// keyLocks serializes requests sent with the same idempotency key.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks key and returns the function that unlocks it.
+func (l *keyLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*keyLock)
+	}
+	kl := l.locks[key]
+	if kl == nil {
+		kl = &keyLock{}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+
+	kl.Lock()
+	return func() {
+		kl.Unlock()
+		l.mu.Lock()
+		if kl.refs--; kl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+func badRequest(message string) *reliapi.APIError {
+	return &reliapi.APIError{StatusCode: http.StatusBadRequest, Type: "client_error", Code: reliapi.CodeBadRequest, Message: message}
+}
+
+func errorEnvelope(err *reliapi.APIError, elapsed time.Duration) map[string]interface{} {
+	detail := map[string]interface{}{
+		"type":        err.Type,
+		"code":        err.Code,
+		"message":     err.Message,
+		"retryable":   err.Retryable,
+		"status_code": err.StatusCode,
+	}
+	if err.Target != "" {
+		detail["target"] = err.Target
+	}
+	if err.Details != nil {
+		detail["details"] = err.Details
+	}
+	if err.RetryAfter > 0 {
+		detail["retry_after_s"] = err.RetryAfter.Seconds()
+	}
+	return map[string]interface{}{
+		"success": false,
+		"error":   detail,
+		"meta": map[string]interface{}{
+			"request_id":  err.RequestID,
+			"target":      err.Target,
+			"duration_ms": int(elapsed / time.Millisecond),
+		},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
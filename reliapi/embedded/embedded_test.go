@@ -0,0 +1,329 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+// upstream is a fake OpenAI-compatible API and HTTP service.
+type upstream struct {
+	*httptest.Server
+	calls    atomic.Int32
+	failures atomic.Int32
+}
+
+func newUpstream(t *testing.T) *upstream {
+	t.Helper()
+	u := &upstream{}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.calls.Add(1)
+		if u.failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			if r.Header.Get("Authorization") != "Bearer sk-test" {
+				t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+			}
+			var body chatRequest
+			raw, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(raw, &body)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"model": body.Model,
+				"choices": []interface{}{map[string]interface{}{
+					"index":         0,
+					"message":       map[string]interface{}{"role": "assistant", "content": "Paris."},
+					"finish_reason": "stop",
+				}},
+				"usage": map[string]interface{}{"prompt_tokens": 10, "completion_tokens": 2, "total_tokens": 12},
+			})
+		case "/items":
+			_, _ = w.Write([]byte(`{"items": [1, 2], "page": "` + r.URL.Query().Get("page") + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(u.Close)
+	u.failures.Store(0)
+	return u
+}
+
+func start(t *testing.T, u *upstream, cfg Config, opts ...reliapi.Option) *reliapi.Client {
+	t.Helper()
+	cfg.Targets = map[string]Target{
+		"openai": {
+			BaseURL: u.URL + "/v1",
+			LLM: &LLM{
+				APIKey: "sk-test", DefaultModel: "gpt-4o-mini",
+				InputUSDPerMTok: 1000, OutputUSDPerMTok: 2000,
+			},
+		},
+		"api": {BaseURL: u.URL, MaxAttempts: 1},
+	}
+	srv, err := Start(cfg)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	client, err := srv.Client(append([]reliapi.Option{reliapi.WithRetry(1, 0)}, opts...)...)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	return client
+}
+
+func question(content string) reliapi.LLMRequest {
+	return reliapi.LLMRequest{Target: "openai", Messages: []reliapi.ChatMessage{reliapi.UserMessage(content)}}
+}
+
+func TestLLMCacheHit(t *testing.T) {
+	u := newUpstream(t)
+	client := start(t, u, Config{})
+	ctx := context.Background()
+
+	first, err := client.ProxyLLM(ctx, question("capital of France?"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if text, _ := first.CompletionText(); text != "Paris." || first.Meta.CacheHit {
+		t.Fatalf("first = %q, meta = %+v", text, first.Meta)
+	}
+	if first.Meta.CostUSD == nil || *first.Meta.CostUSD != 0.014 {
+		t.Errorf("cost = %v", first.Meta.CostUSD)
+	}
+
+	second, err := client.ProxyLLM(ctx, question("capital of France?"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if !second.Meta.CacheHit || *second.Meta.CostUSD != 0 || u.calls.Load() != 1 {
+		t.Errorf("second meta = %+v, upstream calls = %d", second.Meta, u.calls.Load())
+	}
+	req := question("capital of France?")
+	req.Model = "gpt-4o-mini"
+	if key, _ := reliapi.CanonicalCacheKey(req); second.Meta.CacheKey != key {
+		t.Errorf("cache key = %q, want the canonical %q", second.Meta.CacheKey, key)
+	}
+}
+
+func TestLLMIdempotentHit(t *testing.T) {
+	u := newUpstream(t)
+	client := start(t, u, Config{})
+	ctx := context.Background()
+	noCache, key := 0, "order-1"
+	req := question("capital of France?")
+	req.Cache = &noCache
+	req.IdempotencyKey = &key
+
+	if _, err := client.ProxyLLM(ctx, req); err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	replay, err := client.ProxyLLM(ctx, req)
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if !replay.Meta.IdempotentHit || replay.Meta.IdempotencyReplayCount != 1 || u.calls.Load() != 1 {
+		t.Errorf("replay meta = %+v, upstream calls = %d", replay.Meta, u.calls.Load())
+	}
+
+	other := question("capital of Spain?")
+	other.Cache, other.IdempotencyKey = &noCache, &key
+	if _, err := client.ProxyLLM(ctx, other); !reliapi.IsIdempotencyConflict(err) {
+		t.Errorf("err = %v, want an idempotency conflict", err)
+	}
+}
+
+func TestLLMRetriesUpstream(t *testing.T) {
+	u := newUpstream(t)
+	client := start(t, u, Config{})
+	u.failures.Store(2)
+
+	resp, err := client.ProxyLLM(context.Background(), question("hi"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if resp.Meta.Retries != 2 || u.calls.Load() != 3 {
+		t.Errorf("retries = %d, upstream calls = %d", resp.Meta.Retries, u.calls.Load())
+	}
+}
+
+func TestBudgetCap(t *testing.T) {
+	u := newUpstream(t)
+	client := start(t, u, Config{BudgetCapUSD: 0.02})
+	ctx := context.Background()
+
+	if _, err := client.ProxyLLM(ctx, question("first")); err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	// A cache hit is free
+	if _, err := client.ProxyLLM(ctx, question("first")); err != nil {
+		t.Fatalf("cache hit: %v", err)
+	}
+	_, err := client.ProxyLLM(ctx, question("second"))
+	if !reliapi.IsBudgetExceeded(err) {
+		t.Fatalf("err = %v, want BUDGET_EXCEEDED", err)
+	}
+	if u.calls.Load() != 1 {
+		t.Errorf("upstream calls = %d", u.calls.Load())
+	}
+
+	ceiling := 0.000001
+	req := question("third")
+	req.MaxCostUSD = &ceiling
+	if _, err := client.ProxyLLM(ctx, req); !reliapi.IsBudgetExceeded(err) {
+		t.Errorf("err = %v, want BUDGET_EXCEEDED for max_cost_usd", err)
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	u := newUpstream(t)
+	client := start(t, u, Config{})
+	ctx := context.Background()
+	get := reliapi.HTTPRequest{Target: "api", Method: "GET", Path: "/items", Query: map[string]interface{}{"page": 2}}
+
+	first, err := client.ProxyHTTP(ctx, get)
+	if err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	var data struct {
+		StatusCode int `json:"status_code"`
+		Body       struct {
+			Items []int  `json:"items"`
+			Page  string `json:"page"`
+		} `json:"body"`
+	}
+	if err := first.DecodeInto(&data); err != nil {
+		t.Fatal(err)
+	}
+	if data.StatusCode != 200 || len(data.Body.Items) != 2 || data.Body.Page != "2" {
+		t.Errorf("data = %+v", data)
+	}
+	second, err := client.ProxyHTTP(ctx, get)
+	if err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	if !second.Meta.CacheHit || u.calls.Load() != 1 {
+		t.Errorf("second meta = %+v, upstream calls = %d", second.Meta, u.calls.Load())
+	}
+
+	// Other methods and error answers are not cached
+	post := reliapi.HTTPRequest{Target: "api", Method: "POST", Path: "/items"}
+	missing := reliapi.HTTPRequest{Target: "api", Method: "GET", Path: "/missing"}
+	for _, req := range []reliapi.HTTPRequest{post, post, missing, missing} {
+		resp, err := client.ProxyHTTP(ctx, req)
+		if err != nil {
+			t.Fatalf("ProxyHTTP %s %s: %v", req.Method, req.Path, err)
+		}
+		if resp.Meta.CacheHit {
+			t.Errorf("%s %s served from the cache", req.Method, req.Path)
+		}
+	}
+	if resp, _ := client.ProxyHTTP(ctx, missing); resp.Meta.UpstreamStatus != http.StatusNotFound {
+		t.Errorf("upstream status = %d", resp.Meta.UpstreamStatus)
+	}
+
+	u.failures.Store(1)
+	_, err = client.ProxyHTTP(ctx, reliapi.HTTPRequest{Target: "api", Method: "GET", Path: "/items", Query: map[string]interface{}{"page": 3}})
+	var apiErr *reliapi.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != reliapi.CodeServerError {
+		t.Errorf("err = %v, want SERVER_ERROR", err)
+	}
+}
+
+func TestModelLimits(t *testing.T) {
+	u := newUpstream(t)
+	client := start(t, u, Config{})
+
+	req := question("capital of France?")
+	maxTokens := 100000
+	req.MaxTokens = &maxTokens
+	_, err := client.ProxyLLM(context.Background(), req)
+	failure, ok := reliapi.AsModelLimitsExceeded(err)
+	if !ok || failure.Model != "gpt-4o-mini" || len(failure.Issues) != 1 || *failure.Issues[0].Max != 16384 {
+		t.Fatalf("failure = %+v, err = %v", failure, err)
+	}
+	if u.calls.Load() != 0 {
+		t.Errorf("upstream calls = %d", u.calls.Load())
+	}
+}
+
+func TestRejectedRequests(t *testing.T) {
+	u := newUpstream(t)
+	srv, err := Start(Config{APIKey: "key", Targets: map[string]Target{"api": {BaseURL: u.URL}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	ctx := context.Background()
+
+	for name, tc := range map[string]struct {
+		apiKey string
+		req    reliapi.LLMRequest
+		code   string
+	}{
+		"wrong key":      {"other", question("hi"), reliapi.CodeUnauthorized},
+		"not an LLM":     {"key", reliapi.LLMRequest{Target: "api", Messages: question("hi").Messages}, reliapi.CodeInvalidTarget},
+		"unknown target": {"key", reliapi.LLMRequest{Target: "nope", Messages: question("hi").Messages}, reliapi.CodeInvalidTarget},
+	} {
+		client, _ := reliapi.NewClient(srv.URL, tc.apiKey, reliapi.WithRetry(1, 0))
+		_, err := client.ProxyLLM(ctx, tc.req)
+		var apiErr *reliapi.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != tc.code {
+			t.Errorf("%s: err = %v, want %s", name, err, tc.code)
+		}
+	}
+	if _, err := Start(Config{}); err == nil {
+		t.Error("Start without targets succeeded")
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	u := newUpstream(t)
+	client := start(t, u, Config{})
+	health, err := client.Health(context.Background())
+	if err != nil || !health.Ready() {
+		t.Errorf("health = %+v, err = %v", health, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	_ = store.Set("a", []byte("1"), time.Minute)
+	_ = store.Set("b", []byte("2"), 0)
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := store.Get("a"); ok {
+		t.Error("expired entry returned")
+	}
+	if v, ok, _ := store.Get("b"); !ok || string(v) != "2" {
+		t.Errorf("b = %q, %v", v, ok)
+	}
+	_, _ = store.Add("n", 0.25)
+	if sum, _ := store.Add("n", 0.5); sum != 0.75 {
+		t.Errorf("sum = %v", sum)
+	}
+}
+
+func TestCompressedRequests(t *testing.T) {
+	client := start(t, newUpstream(t), Config{}, reliapi.WithCompression(1))
+	resp, err := client.ProxyLLM(context.Background(), question("capital of France?"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if text, _ := resp.CompletionText(); text != "Paris." {
+		t.Errorf("content = %q", text)
+	}
+}
@@ -0,0 +1,211 @@
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var req reliapi.HTTPRequest
+	x, ok := s.begin(w, r, &req)
+	if !ok {
+		return
+	}
+	if unsupported := unsupportedHTTPFields(req); unsupported != "" {
+		x.fail(badRequest(unsupported + " is not supported by the embedded proxy."))
+		return
+	}
+	target, ok := s.cfg.Targets[req.Target]
+	if !ok {
+		x.fail(&reliapi.APIError{
+			StatusCode: http.StatusBadRequest, Type: "client_error", Code: reliapi.CodeInvalidTarget,
+			Message: fmt.Sprintf("Target '%s' not found", req.Target), Target: req.Target,
+		})
+		return
+	}
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		x.fail(badRequest("invalid body_base64: " + err.Error()))
+		return
+	}
+	upstreamURL, err := resolveURL(target.BaseURL, req.Path, req.Query)
+	if err != nil {
+		x.fail(badRequest(err.Error()))
+		return
+	}
+
+	requestHash := hashRequest(req)
+	ttl := cacheTTL(target, req.Cache)
+	cacheKey := ""
+	if ttl > 0 && (method == http.MethodGet || method == http.MethodHead) {
+		cacheKey = requestHash
+		if req.CacheKey != nil {
+			cacheKey = hashRequest([]string{req.Target, method, *req.CacheKey})
+		}
+	}
+	if req.DryRun {
+		s.dryRun(x, cacheKey, reliapi.Meta{Target: req.Target})
+		return
+	}
+
+	s.serve(x, call{
+		requestHash:    requestHash,
+		cacheKey:       cacheKey,
+		cacheTTL:       ttl,
+		idempotencyKey: req.IdempotencyKey,
+		idempotencyTTL: req.IdempotencyTTL,
+		upstream: func(ctx context.Context) (json.RawMessage, reliapi.Meta, *reliapi.APIError) {
+			ctx, cancel := timeoutContext(ctx, req.TimeoutMs)
+			defer cancel()
+			meta := reliapi.Meta{Target: req.Target, CacheKey: cacheKey}
+			answer, retries, apiErr := s.send(ctx, req.Target, planRetries(target, req.Retry), func(ctx context.Context) (*http.Request, error) {
+				var reader io.Reader
+				if body != nil {
+					reader = bytes.NewReader(body)
+				}
+				upstream, err := http.NewRequestWithContext(ctx, method, upstreamURL, reader)
+				if err != nil {
+					return nil, err
+				}
+				for name, value := range target.Headers {
+					upstream.Header.Set(name, value)
+				}
+				for name, value := range req.Headers {
+					upstream.Header.Set(name, value)
+				}
+				return upstream, nil
+			})
+			meta.Retries = retries
+			if apiErr != nil {
+				return nil, meta, apiErr
+			}
+			// As on the proxy, 429 and 5xx answers that outlast the
+			// retries fail the request; other statuses are returned
+			if answer.status == http.StatusTooManyRequests || answer.status >= 500 {
+				return nil, meta, statusError(req.Target, answer.status)
+			}
+			meta.UpstreamStatus = answer.status
+			data, encoding := responseData(answer)
+			meta.ResponseEncoding = encoding
+			raw, err := json.Marshal(data)
+			if err != nil {
+				return nil, meta, badRequest(err.Error())
+			}
+			return raw, meta, nil
+		},
+	})
+}
+
+// unsupportedHTTPFields names the first field of req the embedded proxy
+// does not implement, or returns "".
+func unsupportedHTTPFields(req reliapi.HTTPRequest) string {
+	switch {
+	case req.Multipart != nil:
+		return "multipart"
+	case req.StreamResponse:
+		return "stream_response"
+	case req.ResponseFilter != nil:
+		return "response_filter"
+	case req.RawPassthrough:
+		return "raw_passthrough"
+	case req.IfNoneMatch != "":
+		return "if_none_match"
+	}
+	return ""
+}
+
+func requestBody(req reliapi.HTTPRequest) ([]byte, error) {
+	switch {
+	case req.BodyBase64 != nil:
+		return base64.StdEncoding.DecodeString(*req.BodyBase64)
+	case req.Body == nil:
+		return nil, nil
+	case req.BodyEncoding == reliapi.BodyEncodingBase64:
+		return base64.StdEncoding.DecodeString(*req.Body)
+	}
+	return []byte(*req.Body), nil
+}
+
+// resolveURL joins a target's base URL, a request path and its query.
+// Slice values of query repeat the parameter.
+func resolveURL(baseURL, path string, query map[string]interface{}) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+	values := u.Query()
+	for name, value := range query {
+		switch v := value.(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range v {
+				values.Add(name, fmt.Sprint(item))
+			}
+		default:
+			values.Add(name, fmt.Sprint(v))
+		}
+	}
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
+
+// responseData builds the {status_code, headers, body} data of an answer:
+// JSON bodies are decoded, other text is wrapped as {"raw": text} and
+// binary bodies are sent as base64.
+func responseData(answer *attempt) (map[string]interface{}, string) {
+	headers := make(map[string]string, len(answer.header))
+	for name := range answer.header {
+		headers[strings.ToLower(name)] = answer.header.Get(name)
+	}
+	data := map[string]interface{}{"status_code": answer.status, "headers": headers}
+	switch {
+	case len(answer.body) == 0:
+		data["body"] = map[string]interface{}{}
+	case isBinary(answer.header.Get("Content-Type"), answer.body):
+		data["body"] = base64.StdEncoding.EncodeToString(answer.body)
+		data["body_encoding"] = reliapi.BodyEncodingBase64
+		return data, reliapi.BodyEncodingBase64
+	default:
+		var decoded interface{}
+		if json.Unmarshal(answer.body, &decoded) == nil {
+			data["body"] = decoded
+		} else {
+			data["body"] = map[string]interface{}{"raw": string(answer.body)}
+		}
+	}
+	return data, reliapi.BodyEncodingUTF8
+}
+
+// isBinary reports whether a body must be base64-encoded to survive JSON:
+// it has a content type that is not text, or is not UTF-8.
+func isBinary(contentType string, body []byte) bool {
+	if contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		textual := strings.HasPrefix(mediaType, "text/") ||
+			strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+		switch mediaType {
+		case "application/json", "application/xml", "application/javascript", "application/x-www-form-urlencoded",
+			"application/x-ndjson", "application/graphql", "application/yaml":
+			textual = true
+		}
+		if !textual {
+			return true
+		}
+	}
+	return !utf8.Valid(body)
+}
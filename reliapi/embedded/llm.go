@@ -0,0 +1,293 @@
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+// provider is reported in Meta.Provider of every LLM response.
+const provider = "openai"
+
+// chatRequest is the body of an OpenAI chat completions call.
+type chatRequest struct {
+	Model          string                   `json:"model"`
+	Messages       []reliapi.ChatMessage    `json:"messages"`
+	MaxTokens      *int                     `json:"max_tokens,omitempty"`
+	Temperature    *float64                 `json:"temperature,omitempty"`
+	TopP           *float64                 `json:"top_p,omitempty"`
+	Stop           []string                 `json:"stop,omitempty"`
+	Tools          []reliapi.ToolDefinition `json:"tools,omitempty"`
+	ToolChoice     interface{}              `json:"tool_choice,omitempty"`
+	ResponseFormat *reliapi.ResponseFormat  `json:"response_format,omitempty"`
+}
+
+// llmData is the normalized /v1/proxy/llm payload.
+type llmData struct {
+	Content      string             `json:"content"`
+	Role         string             `json:"role"`
+	FinishReason string             `json:"finish_reason"`
+	Usage        reliapi.Usage      `json:"usage"`
+	ToolCalls    []reliapi.ToolCall `json:"tool_calls,omitempty"`
+	Model        string             `json:"model,omitempty"`
+}
+
+func (s *Server) serveLLM(w http.ResponseWriter, r *http.Request) {
+	var req reliapi.LLMRequest
+	x, ok := s.begin(w, r, &req)
+	if !ok {
+		return
+	}
+	if req.Stream != nil && *req.Stream {
+		x.fail(&reliapi.APIError{
+			StatusCode: http.StatusBadRequest, Type: "client_error", Code: reliapi.CodeStreamingUnsupported,
+			Message: "Streaming is not supported by the embedded proxy.",
+		})
+		return
+	}
+	if unsupported := unsupportedLLMFields(req); unsupported != "" {
+		x.fail(badRequest(unsupported + " is not supported by the embedded proxy."))
+		return
+	}
+	target, ok := s.cfg.Targets[req.Target]
+	if !ok || target.LLM == nil {
+		x.fail(&reliapi.APIError{
+			StatusCode: http.StatusBadRequest, Type: "client_error", Code: reliapi.CodeInvalidTarget,
+			Message: fmt.Sprintf("LLM target '%s' not found", req.Target), Target: req.Target,
+		})
+		return
+	}
+	if len(req.Messages) == 0 {
+		x.fail(badRequest("messages must not be empty"))
+		return
+	}
+	if req.Model == "" {
+		req.Model = target.LLM.DefaultModel
+	}
+	if req.Model == "" {
+		x.fail(badRequest(fmt.Sprintf("target '%s' has no default model; set model", req.Target)))
+		return
+	}
+	// Checked against the bundled capability table, as the proxy does
+	if issues := reliapi.BundledModels().Validate(req); len(issues) > 0 {
+		x.fail(modelLimitsExceeded(req, issues))
+		return
+	}
+
+	ttl := cacheTTL(target, req.Cache)
+	cacheKey := ""
+	if ttl > 0 {
+		// The key the proxy caches under, so clients can compute it
+		cacheKey, _ = reliapi.CanonicalCacheKey(req)
+	}
+	estimate := target.LLM.estimate(req)
+	meta := reliapi.Meta{Target: req.Target, Provider: provider, Model: req.Model, CostEstimateUSD: &estimate}
+	if req.DryRun {
+		s.dryRun(x, cacheKey, meta)
+		return
+	}
+	s.serve(x, call{
+		requestHash:    hashRequest(req),
+		cacheKey:       cacheKey,
+		cacheTTL:       ttl,
+		idempotencyKey: req.IdempotencyKey,
+		idempotencyTTL: req.IdempotencyTTL,
+		upstream: func(ctx context.Context) (json.RawMessage, reliapi.Meta, *reliapi.APIError) {
+			// Cache and idempotency hits are free, so only calls are capped
+			if apiErr := s.checkBudget(req, estimate); apiErr != nil {
+				return nil, meta, apiErr
+			}
+			return s.complete(ctx, target, req, cacheKey, meta)
+		},
+	})
+}
+
+// unsupportedLLMFields names the first field of req the embedded proxy
+// does not implement, or returns "".
+func unsupportedLLMFields(req reliapi.LLMRequest) string {
+	switch {
+	case req.Template != nil:
+		return "template"
+	case len(req.Fallbacks) > 0:
+		return "fallbacks"
+	case req.Hedge != nil:
+		return "hedge"
+	case req.Compare != nil:
+		return "compare"
+	case req.ResponseFilter != nil:
+		return "response_filter"
+	case req.RawPassthrough:
+		return "raw_passthrough"
+	case req.Strict != nil && !*req.Strict:
+		return "strict=false"
+	case req.ConversationID != nil:
+		return "conversation_id"
+	}
+	return ""
+}
+
+// modelLimitsExceeded is the MODEL_LIMITS_EXCEEDED error of req, listing
+// issues as the proxy does.
+func modelLimitsExceeded(req reliapi.LLMRequest, issues []reliapi.ValidationIssue) *reliapi.APIError {
+	messages := make([]string, len(issues))
+	for i, issue := range issues {
+		messages[i] = issue.Message
+	}
+	var details map[string]interface{}
+	raw, _ := json.Marshal(reliapi.ModelLimitsFailure{Model: req.Model, Issues: issues})
+	_ = json.Unmarshal(raw, &details)
+	return &reliapi.APIError{
+		StatusCode: http.StatusBadRequest, Type: "client_error", Code: reliapi.CodeModelLimitsExceeded,
+		Message: fmt.Sprintf("Request outside what %s accepts: %s", req.Model, strings.Join(messages, "; ")),
+		Target:  req.Target, Details: details,
+	}
+}
+
+// complete calls the target's chat completions API and normalizes its
+// answer.
+func (s *Server) complete(ctx context.Context, target Target, req reliapi.LLMRequest, cacheKey string, meta reliapi.Meta) (json.RawMessage, reliapi.Meta, *reliapi.APIError) {
+	ctx, cancel := timeoutContext(ctx, req.TimeoutMs)
+	defer cancel()
+	body, err := json.Marshal(chatRequest{
+		Model: req.Model, Messages: req.Messages, MaxTokens: req.MaxTokens, Temperature: req.Temperature,
+		TopP: req.TopP, Stop: req.Stop, Tools: req.Tools, ToolChoice: req.ToolChoice, ResponseFormat: req.ResponseFormat,
+	})
+	if err != nil {
+		return nil, meta, badRequest(err.Error())
+	}
+	url := strings.TrimSuffix(target.BaseURL, "/") + "/chat/completions"
+	answer, retries, apiErr := s.send(ctx, req.Target, planRetries(target, req.Retry), func(ctx context.Context) (*http.Request, error) {
+		upstream, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range target.Headers {
+			upstream.Header.Set(name, value)
+		}
+		upstream.Header.Set("Content-Type", "application/json")
+		if target.LLM.APIKey != "" {
+			upstream.Header.Set("Authorization", "Bearer "+target.LLM.APIKey)
+		}
+		return upstream, nil
+	})
+	meta.Retries = retries
+	if apiErr != nil {
+		return nil, meta, apiErr
+	}
+	if answer.status >= 300 {
+		return nil, meta, statusError(req.Target, answer.status)
+	}
+	completion, err := (&reliapi.ReliAPIResponse{Data: answer.body}).Completion()
+	if err != nil || len(completion.Choices) == 0 {
+		return nil, meta, &reliapi.APIError{
+			StatusCode: http.StatusBadGateway, Type: "upstream_error", Code: reliapi.CodeProviderError,
+			Message: "Upstream returned no completion", Target: req.Target,
+		}
+	}
+
+	choice := completion.Choices[0]
+	data := llmData{
+		Content:      choice.Message.Content,
+		Role:         "assistant",
+		FinishReason: choice.FinishReason,
+		Usage:        completion.Usage,
+		ToolCalls:    choice.ToolCalls,
+		Model:        completion.Model,
+	}
+	if data.FinishReason == "" {
+		data.FinishReason = completion.FinishReason
+	}
+	cost := target.LLM.cost(completion.Usage.PromptTokens, completion.Usage.CompletionTokens)
+	if cost > 0 {
+		_, _ = s.store.Add(spentKey, cost)
+	}
+	if completion.Model != "" {
+		meta.Model = completion.Model
+	}
+	meta.ServedBy = req.Target
+	meta.CostUSD = &cost
+	meta.CacheKey = cacheKey
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, meta, badRequest(err.Error())
+	}
+	return raw, meta, nil
+}
+
+// checkBudget rejects a request whose estimate exceeds its MaxCostUSD or
+// what is left of Config.BudgetCapUSD.
+func (s *Server) checkBudget(req reliapi.LLMRequest, estimate float64) *reliapi.APIError {
+	budgetError := func(message string, details map[string]interface{}) *reliapi.APIError {
+		details["cost_estimate_usd"] = estimate
+		details["model"] = req.Model
+		return &reliapi.APIError{
+			StatusCode: http.StatusBadRequest, Type: "budget_error", Code: reliapi.CodeBudgetExceeded,
+			Message: message, Target: req.Target, Details: details,
+		}
+	}
+	if req.MaxCostUSD != nil && estimate > *req.MaxCostUSD {
+		return budgetError(
+			fmt.Sprintf("Estimated cost $%.6f exceeds max_cost_usd $%.6f", estimate, *req.MaxCostUSD),
+			map[string]interface{}{"max_cost_usd": *req.MaxCostUSD},
+		)
+	}
+	if s.cfg.BudgetCapUSD > 0 {
+		spent, _ := s.store.Add(spentKey, 0)
+		if spent+estimate > s.cfg.BudgetCapUSD {
+			return budgetError(
+				fmt.Sprintf("Estimated cost $%.6f exceeds the remaining budget $%.6f", estimate, max(s.cfg.BudgetCapUSD-spent, 0)),
+				map[string]interface{}{"budget_cap_usd": s.cfg.BudgetCapUSD, "spent_usd": spent},
+			)
+		}
+	}
+	return nil
+}
+
+// dryRun answers a dry run with the meta the request would get up to the
+// upstream call.
+func (s *Server) dryRun(x *exchange, cacheKey string, meta reliapi.Meta) {
+	meta.DryRun = true
+	if cacheKey != "" {
+		meta.CacheKey = cacheKey
+		_, meta.CacheEntryExists = s.load("cache:" + cacheKey)
+	}
+	x.succeed(json.RawMessage("null"), meta)
+}
+
+// estimate is the most req can cost: its prompt, and MaxTokens of
+// completion.
+func (l *LLM) estimate(req reliapi.LLMRequest) float64 {
+	prompt, _ := reliapi.CountTokens(req.Model, req.Messages)
+	completion := 0
+	if req.MaxTokens != nil {
+		completion = *req.MaxTokens
+	}
+	return l.cost(prompt, completion)
+}
+
+func (l *LLM) cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*l.InputUSDPerMTok + float64(completionTokens)*l.OutputUSDPerMTok) / 1e6
+}
+
+// hashRequest tells requests sent with one idempotency key apart. The key
+// itself, its TTL and the timeout, which differ between retries of one
+// call, are left out.
+func hashRequest(req interface{}) string {
+	raw, _ := json.Marshal(req)
+	var fields map[string]interface{}
+	if json.Unmarshal(raw, &fields) == nil {
+		delete(fields, "idempotency_key")
+		delete(fields, "idempotency_ttl_s")
+		delete(fields, "timeout_ms")
+		raw, _ = json.Marshal(fields)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,82 @@
+package embedded
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store keeps the state of a Server: cached responses, idempotency
+// records and the spend counted against Config.BudgetCapUSD. Values are
+// opaque bytes under keys the Server namespaces, so a Store is a small
+// key-value table; implementations backed by SQLite or a file plug in
+// through Config.Store. They must be safe for concurrent use.
+type Store interface {
+	// Get returns the value under key, and false if there is none or it
+	// has expired.
+	Get(key string) ([]byte, bool, error)
+	// Set stores value under key for ttl; zero keeps it until the Store
+	// is dropped.
+	Set(key string, value []byte, ttl time.Duration) error
+	// Add adds delta to the number under key, zero if unset, and returns
+	// the sum.
+	Add(key string, delta float64) (float64, error)
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// MemoryStore is a Store that holds its state in memory: nothing outlives
+// the process. The zero value is not usable; call NewMemoryStore.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expiresAt.IsZero() && !s.now().Before(entry.expiresAt) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+// Set implements Store.
+func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expiresAt = s.now().Add(ttl)
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+// Add implements Store.
+func (s *MemoryStore) Add(key string, delta float64) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sum float64
+	if entry, ok := s.entries[key]; ok {
+		sum, _ = strconv.ParseFloat(string(entry.value), 64)
+	}
+	sum += delta
+	s.entries[key] = memoryEntry{value: []byte(strconv.FormatFloat(sum, 'g', -1, 64))}
+	return sum, nil
+}
@@ -0,0 +1,155 @@
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBackoff     = 100 * time.Millisecond
+	maxBackoff         = 5 * time.Second
+)
+
+// attempt is an upstream answer, with its body read.
+type attempt struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// retryPlan is how often and on what a request retries its upstream call.
+type retryPlan struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	retryOn    map[int]bool
+}
+
+// planRetries applies a request's Retry to the target's MaxAttempts. By
+// default 429 and 5xx answers are retried, as well as failed connections.
+func planRetries(target Target, policy *reliapi.RetryPolicy) retryPlan {
+	plan := retryPlan{attempts: target.MaxAttempts, backoff: defaultBackoff, maxBackoff: maxBackoff}
+	if plan.attempts <= 0 {
+		plan.attempts = defaultMaxAttempts
+	}
+	if policy != nil {
+		if policy.MaxAttempts > 0 {
+			plan.attempts = policy.MaxAttempts
+		}
+		if policy.BackoffMs > 0 {
+			plan.backoff = time.Duration(policy.BackoffMs) * time.Millisecond
+		}
+		if policy.MaxBackoffMs > 0 {
+			plan.maxBackoff = time.Duration(policy.MaxBackoffMs) * time.Millisecond
+		}
+		if len(policy.RetryOn) > 0 {
+			plan.retryOn = make(map[int]bool, len(policy.RetryOn))
+			for _, status := range policy.RetryOn {
+				plan.retryOn[status] = true
+			}
+		}
+	}
+	return plan
+}
+
+func (p retryPlan) retries(status int) bool {
+	if p.retryOn != nil {
+		return p.retryOn[status]
+	}
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// send makes the upstream call newRequest builds, retrying as plan says.
+// It returns the last answer, whatever its status, and the number of
+// retries made; a call that never got an answer fails with a
+// NETWORK_ERROR, or UPSTREAM_TIMEOUT once ctx is done.
+func (s *Server) send(ctx context.Context, targetName string, plan retryPlan, newRequest func(context.Context) (*http.Request, error)) (*attempt, int, *reliapi.APIError) {
+	backoff := plan.backoff
+	for retries := 0; ; retries++ {
+		answer, err := s.try(ctx, newRequest)
+		last := retries+1 >= plan.attempts
+		if err == nil && (last || !plan.retries(answer.status)) {
+			return answer, retries, nil
+		}
+		if err != nil && (last || ctx.Err() != nil) {
+			return nil, retries, networkError(targetName, err, ctx.Err() != nil)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if answer != nil {
+				return answer, retries, nil
+			}
+			return nil, retries, networkError(targetName, ctx.Err(), true)
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, plan.maxBackoff)
+	}
+}
+
+func (s *Server) try(ctx context.Context, newRequest func(context.Context) (*http.Request, error)) (*attempt, error) {
+	req, err := newRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &attempt{status: resp.StatusCode, header: resp.Header, body: body}, nil
+}
+
+func networkError(targetName string, err error, timedOut bool) *reliapi.APIError {
+	if timedOut || errors.Is(err, context.DeadlineExceeded) {
+		return &reliapi.APIError{
+			StatusCode: http.StatusGatewayTimeout, Type: "upstream_error", Code: reliapi.CodeUpstreamTimeout,
+			Message: "Upstream request timed out", Retryable: true, Target: targetName,
+		}
+	}
+	return &reliapi.APIError{
+		StatusCode: http.StatusBadGateway, Type: "upstream_error", Code: reliapi.CodeNetworkError,
+		Message: fmt.Sprintf("Upstream request failed: %v", err), Retryable: true, Target: targetName,
+	}
+}
+
+// statusError is the error of an upstream answer the proxy fails on: a
+// 5xx is reported as a 502 SERVER_ERROR, a 4xx with its own status.
+func statusError(targetName string, status int) *reliapi.APIError {
+	e := &reliapi.APIError{
+		StatusCode: status, Type: "upstream_error", Code: reliapi.CodeClientError,
+		Message:   fmt.Sprintf("Upstream answered %d", status),
+		Retryable: status == http.StatusTooManyRequests || status >= 500,
+		Target:    targetName,
+		Details:   map[string]interface{}{"upstream_status": status},
+	}
+	switch {
+	case status >= 500:
+		e.StatusCode, e.Code = http.StatusBadGateway, reliapi.CodeServerError
+	case status == http.StatusUnauthorized:
+		e.Code = reliapi.CodeUnauthorized
+	case status == http.StatusNotFound:
+		e.Code = reliapi.CodeNotFound
+	}
+	return e
+}
+
+// timeoutContext bounds ctx by a request's TimeoutMs, if it has one.
+func timeoutContext(ctx context.Context, timeoutMs *int) (context.Context, context.CancelFunc) {
+	if timeoutMs == nil || *timeoutMs <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(*timeoutMs)*time.Millisecond)
+}
@@ -0,0 +1,112 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const embeddingsProxyPath = "/v1/proxy/embeddings"
+
+// Values of EmbeddingsRequest.InputType.
+const (
+	InputTypeQuery    = "query"
+	InputTypeDocument = "document"
+)
+
+// EmbeddingsRequest is the body of a POST /v1/proxy/embeddings call.
+//
+// The proxy caches every input on its own, keyed by target, model,
+// dimensions, input type and text, and sends only the inputs it has no
+// vector for upstream. Embed builds on it for batches of any size.
+type EmbeddingsRequest struct {
+	Target string `json:"target"`
+	// Model defaults to the target's embedding_model.
+	Model string `json:"model,omitempty"`
+	// Input is the text to embed: a string or a []string.
+	Input interface{} `json:"input"`
+	// Dimensions sets the size of the vectors, for models that support it.
+	Dimensions *int `json:"dimensions,omitempty"`
+	// InputType is InputTypeQuery or InputTypeDocument, for models that
+	// embed search queries and the documents searched differently; the
+	// others ignore it.
+	InputType      string  `json:"input_type,omitempty"`
+	Cache          *int    `json:"cache,omitempty"`
+	IdempotencyKey *string `json:"idempotency_key,omitempty"`
+
+	// Retry overrides the target's upstream retry policy for this request.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// TenantID selects the API key the request authenticates with, via
+	// WithTenantKeyProvider. It is not sent to the proxy.
+	TenantID string `json:"-"`
+}
+
+// EmbeddingsResponse is the result of ProxyEmbeddings and Embed.
+type EmbeddingsResponse struct {
+	// Embeddings holds a vector per input, in input order.
+	Embeddings [][]float32 `json:"embeddings"`
+	// CacheHits reports, per input, whether its vector came from the cache.
+	CacheHits []bool `json:"cache_hits"`
+	// PromptTokens counts the tokens sent upstream, so none for inputs
+	// served from the cache.
+	PromptTokens int `json:"prompt_tokens"`
+	// Meta.CostUSD is the cost of the inputs sent upstream; cached inputs
+	// are free.
+	Meta Meta `json:"-"`
+	// IdempotencyKey is the key the request was sent with, if any.
+	IdempotencyKey string `json:"-"`
+}
+
+// ProxyEmbeddings embeds one text or a batch through an LLM target.
+//
+// Like LLM calls, a request is resent after a retryable failure only when
+// it has an IdempotencyKey.
+func (c *Client) ProxyEmbeddings(ctx context.Context, req EmbeddingsRequest) (out *EmbeddingsResponse, err error) {
+	ctx, in := c.instrument(ctx, OpProxyEmbeddings, req.Target)
+	var meta *Meta
+	defer func() { in.end(meta, err) }()
+	switch input := req.Input.(type) {
+	case string:
+	case []string:
+		if len(input) == 0 {
+			return nil, fmt.Errorf("reliapi: embeddings input is empty")
+		}
+	default:
+		return nil, fmt.Errorf("reliapi: embeddings input must be a string or []string, got %T", req.Input)
+	}
+	ctx, err = c.tenantContext(ctx, req.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.applyIdempotency(&req.IdempotencyKey, req, allowsResend(req.Retry))
+	if err != nil {
+		return nil, err
+	}
+	hr, err := c.startHooks(ctx, OpProxyEmbeddings, req.Target, &req.IdempotencyKey, req)
+	if err != nil {
+		return nil, err
+	}
+	if hr != nil {
+		key = hr.IdempotencyKey
+	}
+	resp, err := c.post(withHookRequest(ctx, hr), embeddingsProxyPath, req, req.IdempotencyKey != nil && allowsResend(req.Retry))
+	if resp != nil {
+		meta = &resp.Meta
+		resp.IdempotencyKey = key
+		if out, err = decodeEmbeddings(resp); err != nil {
+			resp = nil
+		}
+	}
+	return out, withIdempotencyKey(c.endHooks(ctx, hr, resp, err), key)
+}
+
+func decodeEmbeddings(resp *ReliAPIResponse) (*EmbeddingsResponse, error) {
+	var out EmbeddingsResponse
+	if err := json.Unmarshal(resp.Data, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode embeddings: %w", err)
+	}
+	out.Meta = resp.Meta
+	out.IdempotencyKey = resp.IdempotencyKey
+	return &out, nil
+}
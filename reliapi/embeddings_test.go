@@ -0,0 +1,82 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestProxyEmbeddings(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != embeddingsProxyPath {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body["dimensions"] != float64(2) || len(body["input"].([]interface{})) != 2 {
+			t.Errorf("body = %v", body)
+		}
+		if _, ok := body["model"]; ok {
+			t.Error("empty Model was sent")
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"embeddings":    [][]float64{{0.25, -1}, {0.5, 1}},
+				"cache_hits":    []bool{true, false},
+				"prompt_tokens": 3,
+			},
+			"meta": map[string]interface{}{"request_id": "req_e", "cost_usd": 0.00006},
+		})
+	})
+
+	dims := 2
+	resp, err := c.ProxyEmbeddings(context.Background(), EmbeddingsRequest{
+		Target:     "openai",
+		Input:      []string{"cached", "new"},
+		Dimensions: &dims,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Embeddings) != 2 || resp.Embeddings[0][0] != 0.25 || resp.Embeddings[1][1] != 1 {
+		t.Errorf("Embeddings = %v", resp.Embeddings)
+	}
+	if !resp.CacheHits[0] || resp.CacheHits[1] || resp.PromptTokens != 3 {
+		t.Errorf("resp = %+v", resp)
+	}
+	if resp.Meta.RequestID != "req_e" || resp.Meta.CostUSD == nil || *resp.Meta.CostUSD != 0.00006 {
+		t.Errorf("Meta = %+v", resp.Meta)
+	}
+}
+
+func TestProxyEmbeddingsInput(t *testing.T) {
+	var input interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		input = body["input"]
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"embeddings": [][]float64{{1}}, "cache_hits": []bool{false}},
+			"meta":    map[string]interface{}{},
+		})
+	})
+
+	if _, err := c.ProxyEmbeddings(context.Background(), EmbeddingsRequest{Target: "openai", Input: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	if input != "one" {
+		t.Errorf("input = %v", input)
+	}
+	for _, bad := range []interface{}{nil, []string{}, 42} {
+		if _, err := c.ProxyEmbeddings(context.Background(), EmbeddingsRequest{Target: "openai", Input: bad}); err == nil {
+			t.Errorf("Input %#v: want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package reliapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBufferBytes caps the buffers kept for reuse; a larger one is
+// left to the garbage collector so a single huge response doesn't stay
+// pinned in the pool.
+const maxPooledBufferBytes = 64 << 20
+
+var responseBuffers = sync.Pool{New: func() interface{} { return new(responseBuffer) }}
+
+// responseBuffer holds the body of a proxy response whose Data points into
+// it. gen counts its trips through the pool, so a response released twice,
+// or copied and released once per copy, returns it only once.
+type responseBuffer struct {
+	bytes.Buffer
+	gen atomic.Uint64
+}
+
+// heldBuffer is a response's claim on the responseBuffer its Data is in.
+type heldBuffer struct {
+	buf *responseBuffer
+	gen uint64
+}
+
+func (h *heldBuffer) release() {
+	if h.buf == nil {
+		return
+	}
+	buf := h.buf
+	h.buf = nil
+	if !buf.gen.CompareAndSwap(h.gen, h.gen+1) || buf.Cap() > maxPooledBufferBytes {
+		return
+	}
+	responseBuffers.Put(buf)
+}
+
+// readPooled is readBody into a pooled buffer. sizeHint is the length of
+// the body, or -1 when it isn't known.
+func (c *Client) readPooled(body io.Reader, sizeHint int64) (heldBuffer, error) {
+	buf := responseBuffers.Get().(*responseBuffer)
+	buf.Reset()
+	held := heldBuffer{buf: buf, gen: buf.gen.Load()}
+	if sizeHint > 0 && (c.maxResponseBytes <= 0 || sizeHint <= c.maxResponseBytes) {
+		// With MinRead to spare ReadFrom never grows it again
+		buf.Grow(int(sizeHint) + bytes.MinRead)
+	}
+	if c.maxResponseBytes > 0 {
+		body = io.LimitReader(body, c.maxResponseBytes+1)
+	}
+	if _, err := buf.ReadFrom(body); err != nil {
+		held.release()
+		return heldBuffer{}, fmt.Errorf("reliapi: read response: %w", err)
+	}
+	if c.maxResponseBytes > 0 && int64(buf.Len()) > c.maxResponseBytes {
+		held.release()
+		return heldBuffer{}, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, c.maxResponseBytes)
+	}
+	return held, nil
+}
+
+// DataReader returns a reader over Data, for streaming it into a decoder
+// or a file without another copy.
+func (r *ReliAPIResponse) DataReader() io.Reader {
+	return bytes.NewReader(r.Data)
+}
+
+// Release hands the buffer Data was read into back to the client for
+// reuse by later responses and sets Data to nil. Neither r's Data nor
+// anything read from DataReader may be used after it, in r or in copies
+// of it. Calling it is optional, a response that is never released is
+// garbage collected as any other, and calling it again, on a copy of r
+// too, does nothing. It matters for large Data, where reusing the buffer
+// saves allocating one per response.
+func (r *ReliAPIResponse) Release() {
+	r.held.release()
+	r.Data = nil
+}
+
+// detach copies Data out of r's pooled buffer, which it releases, for a
+// response that is shared or kept beyond its caller's Release.
+func (r *ReliAPIResponse) detach() {
+	if r.held.buf == nil {
+		return
+	}
+	r.Data = bytes.Clone(r.Data)
+	r.held.release()
+}
+
+// decodeEnvelope decodes the proxy envelope in raw into out, as
+// json.Unmarshal would, except that Data is left in raw rather than
+// copied: only success and meta are decoded, and the scan for them skips
+// over data.
+func decodeEnvelope(raw []byte, out *ReliAPIResponse) error {
+	i := skipSpace(raw, 0)
+	if !json.Valid(raw) || raw[i] != '{' {
+		// Unmarshal reports the error, or leaves out as it is for null
+		return json.Unmarshal(raw, &struct{}{})
+	}
+	for i++; ; {
+		i = skipSpace(raw, i)
+		if raw[i] == ',' {
+			i = skipSpace(raw, i+1)
+		}
+		if raw[i] == '}' {
+			return nil
+		}
+		end := skipString(raw, i)
+		key := raw[i+1 : end-1]
+		if bytes.IndexByte(key, '\\') >= 0 {
+			var unquoted string
+			_ = json.Unmarshal(raw[i:end], &unquoted)
+			key = []byte(unquoted)
+		}
+		i = skipSpace(raw, skipSpace(raw, end)+1)
+		end = skipValue(raw, i)
+		value := raw[i:end:end]
+		i = end
+
+		// Keys match case-insensitively, as in json.Unmarshal
+		var err error
+		switch {
+		case bytes.EqualFold(key, []byte("success")):
+			err = json.Unmarshal(value, &out.Success)
+		case bytes.EqualFold(key, []byte("data")):
+			out.Data = value
+		case bytes.EqualFold(key, []byte("meta")):
+			err = json.Unmarshal(value, &out.Meta)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// The skip functions take valid JSON and the index of a token in it and
+// return the index past that token's end.
+
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\n' || b[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+func skipString(b []byte, i int) int {
+	for i++; b[i] != '"'; i++ {
+		if b[i] == '\\' {
+			i++
+		}
+	}
+	return i + 1
+}
+
+func skipValue(b []byte, i int) int {
+	switch b[i] {
+	case '"':
+		return skipString(b, i)
+	case '{', '[':
+		depth := 0
+		for ; ; i++ {
+			switch b[i] {
+			case '"':
+				i = skipString(b, i) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+	}
+	for i < len(b) && bytes.IndexByte([]byte(",}] \t\r\n"), b[i]) < 0 {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,188 @@
+package reliapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDecodeEnvelopeMatchesUnmarshal(t *testing.T) {
+	for _, raw := range []string{
+		`{"success": true, "data": {"a": [1, "}\"]", {"b": null}]}, "meta": {"request_id": "req_1"}}`,
+		` { "meta" : {"cache_hit": true} , "data" : "x\\\"y" , "success" : true } `,
+		`{"Success": true, "DATA": [], "extra": {"data": 1}, "meta": {}}`,
+		`{"succ\u0065ss": true, "data": null}`,
+		`{"success": false, "data": 12.5e3}`,
+		`{"data": true, "data": false}`,
+		`{}`,
+		`null`,
+	} {
+		var want ReliAPIResponse
+		if err := json.Unmarshal([]byte(raw), &want); err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		var got ReliAPIResponse
+		if err := decodeEnvelope([]byte(raw), &got); err != nil {
+			t.Errorf("%s: %v", raw, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", raw, got, want)
+		}
+	}
+
+	for _, raw := range []string{``, `{"success": true`, `[true]`, `{"success": "yes"}`} {
+		if err := decodeEnvelope([]byte(raw), &ReliAPIResponse{}); err == nil {
+			t.Errorf("%q decoded", raw)
+		}
+	}
+}
+
+func TestReleaseReturnsBufferOnce(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "hi"},
+			"meta":    map[string]interface{}{"request_id": "req_1"},
+		})
+	})
+	resp, err := c.ProxyLLM(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.DataReader())
+	if string(data) != `{"content":"hi"}` {
+		t.Errorf("DataReader read %s", data)
+	}
+
+	buf := resp.held.buf
+	copied := *resp
+	resp.Release()
+	resp.Release()
+	copied.Release()
+	if resp.Data != nil || copied.Data != nil {
+		t.Error("Data kept after Release")
+	}
+	// Released three times, the buffer must be handed out only once
+	var got []*responseBuffer
+	for i := 0; i < 3; i++ {
+		got = append(got, responseBuffers.Get().(*responseBuffer))
+	}
+	n := 0
+	for _, b := range got {
+		if b == buf {
+			n++
+		}
+	}
+	if n > 1 {
+		t.Errorf("buffer pooled %d times", n)
+	}
+}
+
+func TestCoalescedResponsesOutliveLeaderRelease(t *testing.T) {
+	c := &Client{}
+	g := &coalescer{flights: make(map[string]*flight)}
+	f := &flight{done: make(chan struct{})}
+	leader, err := g.lead(context.Background(), "k", f, func(context.Context) (*ReliAPIResponse, error) {
+		held, err := c.readPooled(strings.NewReader(`{"success": true, "data": "shared"}`), -1)
+		out := &ReliAPIResponse{held: held}
+		if err == nil {
+			err = decodeEnvelope(held.buf.Bytes(), out)
+		}
+		return out, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leader.Release()
+	// Whatever reuses the leader's buffer must not show in the followers
+	held, _ := c.readPooled(strings.NewReader(`{"success": true, "data": "reused"}`), -1)
+	defer held.release()
+	if string(f.resp.Data) != `"shared"` {
+		t.Errorf("follower Data = %s", f.resp.Data)
+	}
+}
+
+// largeEnvelope is a proxy response whose data holds about size bytes.
+func largeEnvelope(size int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"success": true, "data": {"status_code": 200, "headers": {}, "body": {"items": [`)
+	for i := 0; b.Len() < size; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"id": %d, "name": "user-%d", "note": "a \"quoted\" {note}"}`, i, i)
+	}
+	b.WriteString(`]}}, "meta": {"target": "users", "request_id": "req_1", "duration_ms": 12}}`)
+	return b.Bytes()
+}
+
+var envelopeSizes = []int{1 << 20, 10 << 20, 50 << 20}
+
+// benchmarkEnvelope runs read, which reads a response from body and
+// returns a function releasing it, over envelopes of envelopeSizes. It
+// reports the peak of the heap above what it was before, with the
+// response still held, as peak-heap-MB.
+func benchmarkEnvelope(b *testing.B, read func(body io.Reader, size int64) (release func())) {
+	for _, size := range envelopeSizes {
+		raw := largeEnvelope(size)
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			var ms runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&ms)
+			base, peak := ms.HeapAlloc, uint64(0)
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				release := read(bytes.NewReader(raw), int64(len(raw)))
+				b.StopTimer()
+				runtime.ReadMemStats(&ms)
+				peak = max(peak, ms.HeapAlloc-min(base, ms.HeapAlloc))
+				b.StartTimer()
+				release()
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+		})
+	}
+}
+
+// BenchmarkReadEnvelope is how post reads a response: into a pooled
+// buffer, leaving Data in it.
+func BenchmarkReadEnvelope(b *testing.B) {
+	c := &Client{}
+	benchmarkEnvelope(b, func(body io.Reader, size int64) func() {
+		held, err := c.readPooled(body, size)
+		if err != nil {
+			b.Fatal(err)
+		}
+		out := &ReliAPIResponse{held: held}
+		if err := decodeEnvelope(held.buf.Bytes(), out); err != nil {
+			b.Fatal(err)
+		}
+		return out.Release
+	})
+}
+
+// BenchmarkReadEnvelopeUnmarshal is how post read a response before the
+// pooled buffers: io.ReadAll, then json.Unmarshal copying Data out.
+func BenchmarkReadEnvelopeUnmarshal(b *testing.B) {
+	c := &Client{}
+	benchmarkEnvelope(b, func(body io.Reader, size int64) func() {
+		raw, err := c.readBody(body)
+		if err != nil {
+			b.Fatal(err)
+		}
+		out := new(ReliAPIResponse)
+		if err := json.Unmarshal(raw, out); err != nil {
+			b.Fatal(err)
+		}
+		return func() { runtime.KeepAlive(out) }
+	})
+}
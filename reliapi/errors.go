@@ -0,0 +1,280 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error codes returned by the proxy (core/errors.py ErrorCode).
+const (
+	CodeUnauthorized           = "UNAUTHORIZED"
+	CodeForbidden              = "FORBIDDEN"
+	CodeNotAllowed             = "NOT_ALLOWED"
+	CodeBadRequest             = "BAD_REQUEST"
+	CodeNotFound               = "NOT_FOUND"
+	CodeIdempotencyConflict    = "IDEMPOTENCY_CONFLICT"
+	CodeRateLimited            = "RATE_LIMIT_RELIAPI"
+	CodeQueueFull              = "QUEUE_FULL"
+	CodeConcurrencyLimit       = "CONCURRENCY_LIMIT"
+	CodeBatchAborted           = "BATCH_ABORTED"
+	CodeContextLengthExceeded  = "CONTEXT_LENGTH_EXCEEDED"
+	CodeInvalidTemplateVars    = "INVALID_TEMPLATE_VARIABLES"
+	CodeUnknownCredential      = "UNKNOWN_CREDENTIAL"
+	CodeDeadlineTooShort       = "DEADLINE_TOO_SHORT"
+	CodeUnsupportedParameter   = "UNSUPPORTED_PARAMETER"
+	CodeModelLimitsExceeded    = "MODEL_LIMITS_EXCEEDED"
+	CodeConversationConflict   = "CONVERSATION_CONFLICT"
+	CodeReplayUnavailable      = "REPLAY_UNAVAILABLE"
+	CodeCacheMiss              = "CACHE_MISS"
+	CodeServerError            = "SERVER_ERROR"
+	CodeClientError            = "CLIENT_ERROR"
+	CodeNetworkError           = "NETWORK_ERROR"
+	CodeUpstreamTimeout        = "UPSTREAM_TIMEOUT"
+	CodeProviderError          = "PROVIDER_ERROR"
+	CodeStreamInterrupted      = "UPSTREAM_STREAM_INTERRUPTED"
+	CodeResponseTooLarge       = "RESPONSE_TOO_LARGE"
+	CodeCircuitOpen            = "CIRCUIT_OPEN"
+	CodeBudgetExceeded         = "BUDGET_EXCEEDED"
+	CodeKeyBudgetExceeded      = "KEY_BUDGET_EXCEEDED"
+	CodeInvalidTarget          = "INVALID_TARGET"
+	CodeUnknownProvider        = "UNKNOWN_PROVIDER"
+	CodeAdapterNotFound        = "ADAPTER_NOT_FOUND"
+	CodeStreamingUnsupported   = "STREAMING_UNSUPPORTED"
+	CodeStreamInProgress       = "STREAM_ALREADY_IN_PROGRESS"
+	CodeStreamAlreadyComplete  = "STREAM_ALREADY_COMPLETED"
+	CodeInternalError          = "INTERNAL_ERROR"
+	CodeMaintenance            = "MAINTENANCE"
+	CodeOutputValidationFailed = "OUTPUT_VALIDATION_FAILED"
+)
+
+// APIError is returned by Client methods when the proxy answers with a
+// non-2xx status or with an envelope whose success flag is false.
+//
+// Use errors.As to inspect it, or the IsBudgetExceeded, IsCircuitOpen and
+// IsRetriable helpers.
+type APIError struct {
+	// StatusCode is the HTTP status returned by the proxy. For errors
+	// delivered mid-stream it is the upstream status from the error event.
+	StatusCode int
+	// Type is the error category (e.g. "upstream_error", "budget_error").
+	Type string
+	// Code is the ReliAPI error code, one of the Code* constants.
+	Code string
+	// Message is the human-readable description from the proxy.
+	Message string
+	// Retryable reports whether the proxy considers the failure retryable.
+	Retryable bool
+	// Target is the target the error relates to, if any.
+	Target string
+	// RequestID is the proxy request ID, when one was assigned.
+	RequestID string
+	// RetryAfter is the wait suggested by a Retry-After header or the
+	// envelope's retry_after_s field; zero if none was given.
+	RetryAfter time.Duration
+	// Hint is an optional debugging hint from the proxy.
+	Hint string
+	// Source is where the error arose: "reliapi" for the proxy itself,
+	// "upstream" for the target's service; empty when not reported.
+	Source string
+	// ProviderKeyStatus is the state of the upstream credential the error
+	// relates to, when the proxy reports one.
+	ProviderKeyStatus string
+	// IdempotencyKey is the idempotency key the request was sent with,
+	// including one the client generated; see IdempotencyKeyOf.
+	IdempotencyKey string
+	// Details carries code-specific context, e.g. cost_estimate_usd and
+	// hard_cost_cap_usd for BUDGET_EXCEEDED (see AsBudgetExceeded).
+	Details map[string]interface{}
+	// Body is the raw response body, kept for diagnostics.
+	Body []byte
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	s := fmt.Sprintf("reliapi: %d", e.StatusCode)
+	if e.Code != "" {
+		s += " " + e.Code
+	}
+	s += ": " + msg
+	if e.RequestID != "" {
+		s += " (request_id=" + e.RequestID + ")"
+	}
+	return s
+}
+
+// IsBudgetExceeded reports whether err is a proxy rejection because the
+// estimated cost exceeded the target's hard cost cap, the request's
+// MaxCostUSD or the remaining monthly budget. AsBudgetExceeded returns the
+// details.
+func IsBudgetExceeded(err error) bool {
+	return hasCode(err, CodeBudgetExceeded)
+}
+
+// IsKeyBudgetExceeded reports whether err is a proxy rejection because the
+// estimated cost exceeded the rest of the API key's own monthly budget, as
+// opposed to the tenant's. AsBudgetExceeded returns the details, with the
+// key's configured name in APIKeyName.
+func IsKeyBudgetExceeded(err error) bool {
+	return hasCode(err, CodeKeyBudgetExceeded)
+}
+
+// IsContextLengthExceeded reports whether err is a proxy rejection because
+// the prompt didn't fit LLMRequest.ContextPolicy. Details holds the
+// prompt_tokens and max_prompt_tokens.
+func IsContextLengthExceeded(err error) bool {
+	return hasCode(err, CodeContextLengthExceeded)
+}
+
+// IsConcurrencyLimit reports whether err is a proxy rejection because no
+// slot freed up under the target's max concurrency within the request's
+// LLMRequest.MaxWaitMs. The request was not sent upstream, so it is
+// retriable.
+func IsConcurrencyLimit(err error) bool {
+	return hasCode(err, CodeConcurrencyLimit)
+}
+
+// IsCircuitOpen reports whether err means the proxy's circuit breaker for
+// the target is open.
+func IsCircuitOpen(err error) bool {
+	return hasCode(err, CodeCircuitOpen)
+}
+
+// IsRetriable reports whether retrying the same request later may succeed:
+// proxy errors flagged retryable, QUEUE_FULL or carrying 429/502/503/504,
+// transport failures, interrupted or gapped streams, and a full
+// WithRateLimitQueueing queue. Context cancellation is not retriable.
+func IsRetriable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Retryable || strings.EqualFold(apiErr.Code, CodeQueueFull) {
+			return true
+		}
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrStreamInterrupted) || errors.Is(err, ErrStreamGap) || errors.Is(err, ErrRateLimitQueueFull) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func hasCode(err error, code string) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && strings.EqualFold(apiErr.Code, code)
+}
+
+// newAPIError builds an APIError from a proxy response. Bodies that are not a
+// recognizable JSON envelope still produce an error carrying the status code
+// and the raw body.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-ID"),
+		Body:       body,
+	}
+	if ra, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		e.RetryAfter = ra
+	}
+
+	var env errorEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		e.Message = truncate(string(body), 512)
+		return e
+	}
+	if env.Meta != nil && env.Meta.RequestID != "" {
+		e.RequestID = env.Meta.RequestID
+	}
+
+	detail := env.Error
+	if detail == nil && env.Detail != nil {
+		detail = detailFromFastAPI(env.Detail)
+	}
+	if detail == nil {
+		e.Message = truncate(string(body), 512)
+		return e
+	}
+	e.applyDetail(detail)
+	return e
+}
+
+// UnmarshalJSON decodes an error detail object such as the proxy's
+// meta.revalidation_error.
+func (e *APIError) UnmarshalJSON(data []byte) error {
+	var detail errorDetail
+	if err := json.Unmarshal(data, &detail); err != nil {
+		return err
+	}
+	*e = APIError{}
+	if detail.StatusCode != nil {
+		e.StatusCode = *detail.StatusCode
+	}
+	e.applyDetail(&detail)
+	return nil
+}
+
+// applyDetail copies the fields of an error envelope's detail into e.
+func (e *APIError) applyDetail(detail *errorDetail) {
+	e.Type = detail.Type
+	e.Code = detail.Code
+	e.Message = detail.Message
+	e.Retryable = detail.Retryable
+	e.Target = detail.Target
+	e.Hint = detail.Hint
+	e.Source = detail.Source
+	e.ProviderKeyStatus = detail.KeyStatus
+	e.Details = detail.Details
+	if e.RetryAfter == 0 && detail.RetryAfterS != nil && *detail.RetryAfterS > 0 {
+		e.RetryAfter = time.Duration(*detail.RetryAfterS * float64(time.Second))
+	}
+}
+
+// detailFromFastAPI extracts error fields from FastAPI's HTTPException body.
+// The detail is either a plain string, a {type, code, message} object, or
+// (for auth failures) a nested {"success": false, "error": {...}} envelope.
+func detailFromFastAPI(v interface{}) *errorDetail {
+	switch d := v.(type) {
+	case string:
+		return &errorDetail{Message: d}
+	case map[string]interface{}:
+		if nested, ok := d["error"].(map[string]interface{}); ok {
+			d = nested
+		}
+		raw, err := json.Marshal(d)
+		if err != nil {
+			return nil
+		}
+		var out errorDetail
+		if err := json.Unmarshal(raw, &out); err != nil {
+			return nil
+		}
+		return &out
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
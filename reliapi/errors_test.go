@@ -0,0 +1,122 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func apiErrorFrom(t *testing.T, status int, header http.Header, body string) *APIError {
+	t.Helper()
+	resp := &http.Response{StatusCode: status, Header: header}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	return newAPIError(resp, []byte(body))
+}
+
+func TestNewAPIErrorParsesEnvelope(t *testing.T) {
+	e := apiErrorFrom(t, http.StatusBadRequest, nil, `{
+		"success": false,
+		"error": {
+			"type": "budget_error",
+			"code": "BUDGET_EXCEEDED",
+			"message": "Estimated cost $0.2000 exceeds hard cap $0.1000",
+			"retryable": false,
+			"target": "openai",
+			"source": "reliapi",
+			"provider_key_status": "active",
+			"details": {"cost_estimate_usd": 0.2, "hard_cost_cap_usd": 0.1}
+		},
+		"meta": {"request_id": "req_budget", "duration_ms": 3}
+	}`)
+
+	if e.Code != CodeBudgetExceeded || e.Target != "openai" || e.RequestID != "req_budget" ||
+		e.Source != "reliapi" || e.ProviderKeyStatus != "active" {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if e.Details["hard_cost_cap_usd"] != 0.1 {
+		t.Errorf("details = %v", e.Details)
+	}
+	if !IsBudgetExceeded(e) || IsCircuitOpen(e) || IsRetriable(e) {
+		t.Errorf("helpers misclassified %v", e)
+	}
+}
+
+func TestNewAPIErrorRetryAfter(t *testing.T) {
+	fromHeader := apiErrorFrom(t, http.StatusTooManyRequests, http.Header{"Retry-After": {"7"}}, `{"detail": "Rate limit exceeded"}`)
+	if fromHeader.RetryAfter != 7*time.Second || fromHeader.Message != "Rate limit exceeded" {
+		t.Errorf("unexpected error %+v", fromHeader)
+	}
+
+	fromBody := apiErrorFrom(t, http.StatusTooManyRequests, nil, `{
+		"success": false,
+		"error": {"type": "rate_limit", "code": "RATE_LIMIT_RELIAPI", "message": "slow down", "retryable": true, "retry_after_s": 1.5},
+		"meta": {"request_id": "req_rl", "duration_ms": 0}
+	}`)
+	if fromBody.RetryAfter != 1500*time.Millisecond {
+		t.Errorf("RetryAfter = %v", fromBody.RetryAfter)
+	}
+}
+
+func TestNewAPIErrorNonJSON(t *testing.T) {
+	e := apiErrorFrom(t, http.StatusBadGateway, http.Header{"X-Request-Id": {"req_gw"}}, "upstream connect error")
+	if e.Code != "" || e.Message != "upstream connect error" || e.RequestID != "req_gw" {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if !strings.Contains(e.Error(), "502") {
+		t.Errorf("Error() = %q", e.Error())
+	}
+}
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+var _ net.Error = timeoutErr{}
+
+func TestErrorHelpers(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		budget    bool
+		circuit   bool
+		retriable bool
+	}{
+		{"nil", nil, false, false, false},
+		{"budget", &APIError{StatusCode: 400, Code: CodeBudgetExceeded}, true, false, false},
+		{"budget lowercase", &APIError{StatusCode: 400, Code: "budget_exceeded"}, true, false, false},
+		{"circuit open", &APIError{StatusCode: 503, Code: CodeCircuitOpen, Retryable: true}, false, true, true},
+		{"wrapped circuit open", fmt.Errorf("calling llm: %w", &APIError{StatusCode: 503, Code: CodeCircuitOpen}), false, true, true},
+		{"retryable flag", &APIError{StatusCode: 500, Code: CodeInternalError, Retryable: true}, false, false, true},
+		{"429 status", &APIError{StatusCode: 429}, false, false, true},
+		{"queue full", &APIError{Code: CodeQueueFull}, false, false, true},
+		{"bad request", &APIError{StatusCode: 400, Code: CodeBadRequest}, false, false, false},
+		{"unauthorized", &APIError{StatusCode: 401, Code: CodeUnauthorized}, false, false, false},
+		{"network", &net.OpError{Op: "dial", Err: timeoutErr{}}, false, false, true},
+		{"interrupted stream", ErrStreamInterrupted, false, false, true},
+		{"stream gap", &StreamGapError{From: 3, To: 4}, false, false, true},
+		{"canceled", fmt.Errorf("%w: %w", context.Canceled, &net.OpError{Op: "read", Err: timeoutErr{}}), false, false, false},
+		{"plain", errors.New("boom"), false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsBudgetExceeded(tt.err); got != tt.budget {
+				t.Errorf("IsBudgetExceeded = %v", got)
+			}
+			if got := IsCircuitOpen(tt.err); got != tt.circuit {
+				t.Errorf("IsCircuitOpen = %v", got)
+			}
+			if got := IsRetriable(tt.err); got != tt.retriable {
+				t.Errorf("IsRetriable = %v", got)
+			}
+		})
+	}
+}
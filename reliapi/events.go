@@ -0,0 +1,233 @@
+package reliapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const eventsPath = "/v1/events"
+
+// Event types only Subscribe receives, Event.Type. A Subscribe stream
+// also carries EventBudgetThresholdReached and EventCircuitOpened.
+const (
+	EventCircuitClosed = "circuit.closed"
+	EventTargetChanged = "target.changed"
+	// EventsGap means the proxy no longer had the events between the last
+	// one received and the next; Data holds their ids, {"from_id", "to_id"}.
+	EventsGap = "events.gap"
+)
+
+// Reconnection delays of Subscribe: the proxy's SSE retry to start with,
+// doubled per failed attempt up to subscribeMaxBackoff.
+var (
+	subscribeMinBackoff = time.Second
+	subscribeMaxBackoff = 30 * time.Second
+)
+
+// Event is one event pushed by the proxy to Subscribe.
+type Event struct {
+	// ID orders the events of a proxy instance; 0 for EventsGap.
+	ID        int64
+	Type      string
+	CreatedAt time.Time
+	// Data is the raw payload: the same as the webhook's for
+	// EventBudgetThresholdReached and EventCircuitOpened, and the target
+	// and circuit key, or the target and its version, for the others.
+	Data json.RawMessage
+}
+
+// eventFrame is the data of an SSE event of GET /v1/events.
+type eventFrame struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt float64         `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Subscribe streams the events of the client's API key and tenant: budget
+// thresholds crossed, circuits opening and closing and targets changing.
+// When the connection drops it reconnects with the id of the last event
+// received as Last-Event-ID, so the proxy resumes right after it; events
+// it no longer has are reported by an EventsGap event.
+//
+// The error is that of the first connection. The channel is closed once
+// ctx is done, or when the proxy refuses a reconnection with a 4xx other
+// than 429, as for a revoked key. Receive from it promptly: events are not
+// read from the connection while the last one is still waiting.
+func (c *Client) Subscribe(ctx context.Context) (<-chan Event, error) {
+	body, err := c.openEvents(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event)
+	go c.subscription(ctx, body, events)
+	return events, nil
+}
+
+// subscription reads the stream of body into events, reconnecting until
+// ctx is done.
+func (c *Client) subscription(ctx context.Context, body io.ReadCloser, events chan<- Event) {
+	defer close(events)
+	var lastID string
+	retry := subscribeMinBackoff
+	for failures := 0; ; {
+		if body != nil {
+			delivered, r, err := c.readEvents(ctx, body, &lastID, events)
+			body.Close()
+			if r > 0 {
+				retry = r
+			}
+			if delivered {
+				failures = 0
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				c.logEvents(ctx, "reliapi event stream interrupted", err)
+			}
+		}
+		delay := min(time.Duration(float64(retry)*math.Pow(2, float64(failures))), subscribeMaxBackoff)
+		if err := c.sleep(ctx, delay); err != nil {
+			return
+		}
+		var err error
+		if body, err = c.openEvents(ctx, lastID); err != nil {
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests {
+				c.logEvents(ctx, "reliapi event stream refused", err)
+				return
+			}
+			failures++
+		}
+	}
+}
+
+// openEvents connects to GET /v1/events, resuming after lastID if set.
+func (c *Client) openEvents(ctx context.Context, lastID string) (io.ReadCloser, error) {
+	httpReq, err := c.newRequest(ctx, http.MethodGet, eventsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		httpReq.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		defer drainAndClose(resp.Body)
+		raw, _ := c.readBody(resp.Body)
+		return nil, newAPIError(resp, raw)
+	}
+	// Closing the body unblocks a pending read once ctx is done, even with
+	// transports that don't watch the request context.
+	stop := context.AfterFunc(ctx, func() { resp.Body.Close() })
+	return &eventsBody{ReadCloser: resp.Body, stop: stop}, nil
+}
+
+type eventsBody struct {
+	io.ReadCloser
+	stop func() bool
+}
+
+func (b *eventsBody) Close() error {
+	b.stop()
+	return b.ReadCloser.Close()
+}
+
+// readEvents sends the events read from body to events until the stream
+// ends, keeping *lastID at the last id received. It reports whether any
+// event was delivered and the reconnection delay the proxy asked for. An
+// event that doesn't decode is logged and skipped rather than read again
+// on every reconnection.
+func (c *Client) readEvents(ctx context.Context, body io.Reader, lastID *string, events chan<- Event) (delivered bool, retry time.Duration, err error) {
+	reader := bufio.NewReader(body)
+	var eventType, id string
+	var data strings.Builder
+	haveID := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// An event without its trailing blank line is incomplete
+			return delivered, retry, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				eventType = value
+			case "id":
+				id, haveID = value, true
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			case "retry":
+				if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+					retry = time.Duration(ms) * time.Millisecond
+				}
+			}
+			continue
+		}
+
+		if eventType != "" || data.Len() > 0 {
+			ev, err := decodeEvent(eventType, data.String())
+			if err != nil {
+				c.logEvents(ctx, "reliapi event skipped", err)
+			} else {
+				select {
+				case events <- ev:
+					delivered = true
+				case <-ctx.Done():
+					return delivered, retry, ctx.Err()
+				}
+			}
+		}
+		// An id moves the cursor once its event is delivered; a frame of
+		// just an id skips events of other keys and tenants.
+		if haveID {
+			*lastID = id
+		}
+		eventType, id, haveID = "", "", false
+		data.Reset()
+	}
+}
+
+func decodeEvent(eventType, data string) (Event, error) {
+	if eventType == EventsGap {
+		return Event{Type: EventsGap, Data: json.RawMessage(data)}, nil
+	}
+	var frame eventFrame
+	if err := json.Unmarshal([]byte(data), &frame); err != nil {
+		return Event{}, fmt.Errorf("reliapi: decode event: %w", err)
+	}
+	sec, frac := math.Modf(frame.CreatedAt)
+	return Event{
+		ID:        frame.ID,
+		Type:      frame.Type,
+		CreatedAt: time.Unix(int64(sec), int64(frac*1e9)),
+		Data:      frame.Data,
+	}, nil
+}
+
+func (c *Client) logEvents(ctx context.Context, msg string, err error) {
+	if c.logger != nil {
+		c.logger.LogAttrs(ctx, slog.LevelWarn, msg, slog.String("error", err.Error()))
+	}
+}
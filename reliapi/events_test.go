@@ -0,0 +1,216 @@
+package reliapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventLog serves GET /v1/events from a numbered sequence of events,
+// resuming after Last-Event-ID like the proxy, and breaks connections
+// as told.
+type eventLog struct {
+	mu      sync.Mutex
+	events  []string // event i+1 is events[i]; "" for another tenant's
+	added   chan struct{}
+	conns   int
+	lastIDs []string
+	// cut returns how many events connection n sends before it is killed
+	// mid-frame, or -1 to keep it open; refuse reports whether it is
+	// answered with a 503 instead.
+	cut    func(n int) int
+	refuse func(n int) bool
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{added: make(chan struct{}, 1), cut: func(int) int { return -1 }, refuse: func(int) bool { return false }}
+}
+
+func (l *eventLog) publish(eventType string) {
+	l.mu.Lock()
+	l.events = append(l.events, eventType)
+	l.mu.Unlock()
+	select {
+	case l.added <- struct{}{}:
+	default:
+	}
+}
+
+func (l *eventLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	l.conns++
+	n := l.conns
+	l.lastIDs = append(l.lastIDs, r.Header.Get("Last-Event-ID"))
+	l.mu.Unlock()
+	if r.Header.Get("X-API-Key") != "test-key" || r.Header.Get("Accept") != "text/event-stream" {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"detail": "bad request"})
+		return
+	}
+	if l.refuse(n) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"detail": "unavailable"})
+		return
+	}
+	next, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprint(w, "retry: 1\n\n")
+	w.(http.Flusher).Flush()
+	budget := l.cut(n)
+	for {
+		l.mu.Lock()
+		pending := l.events[next:]
+		l.mu.Unlock()
+		for _, eventType := range pending {
+			next++
+			if eventType == "" {
+				fmt.Fprintf(w, "id: %d\n\n", next)
+				continue
+			}
+			if budget == 0 {
+				// Half a frame, then the connection goes away
+				fmt.Fprintf(w, "id: %d\nevent: %s\n", next, eventType)
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			budget--
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: {\"id\": %d, \"type\": %q, \"created_at\": 1760000000.5, \"data\": {\"n\": %d}}\n\n", next, eventType, next, eventType, next)
+		}
+		fmt.Fprint(w, ": heartbeat\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-l.added:
+		case <-time.After(10 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func TestSubscribeSoak(t *testing.T) {
+	const total = 200
+	log := newEventLog()
+	// Every third connection is refused; the others are killed after a few
+	// events, until the tenth stays up.
+	log.refuse = func(n int) bool { return n > 1 && n < 10 && n%3 == 0 }
+	log.cut = func(n int) int {
+		if n >= 10 {
+			return -1
+		}
+		return n * 3
+	}
+	c := newTestClient(t, log.ServeHTTP)
+	var mu sync.Mutex
+	var delays []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		mu.Lock()
+		delays = append(delays, d)
+		mu.Unlock()
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events, err := c.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for i := 1; i <= total; i++ {
+			// Some events are another tenant's: the stream only moves
+			// past them
+			if i%7 == 0 {
+				log.publish("")
+			}
+			log.publish(EventCircuitOpened)
+			if i%20 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	var got []int64
+	for len(got) < total {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("stream closed after %d events", len(got))
+			}
+			if ev.Type != EventCircuitOpened || ev.CreatedAt.UnixMilli() != 1760000000500 {
+				t.Fatalf("event = %+v", ev)
+			}
+			got = append(got, ev.ID)
+		case <-ctx.Done():
+			t.Fatalf("%d of %d events received", len(got), total)
+		}
+	}
+	cancel()
+	for range events {
+	}
+
+	// Exactly once and in order: the ids of the tenant's events
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	var want []int64
+	for i, eventType := range log.events {
+		if eventType != "" {
+			want = append(want, int64(i+1))
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("ids = %v, want %v", got, want)
+	}
+	if log.conns < 10 {
+		t.Errorf("%d connections, want the stream cut at least 9 times", log.conns)
+	}
+	if log.lastIDs[0] != "" {
+		t.Errorf("first Last-Event-ID = %q", log.lastIDs[0])
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// The proxy's retry of 1ms, doubled after a refusal until events
+	// arrive again
+	if !slices.Equal(delays[:4], []time.Duration{time.Millisecond, time.Millisecond, 2 * time.Millisecond, time.Millisecond}) {
+		t.Errorf("delays = %v", delays[:4])
+	}
+}
+
+func TestSubscribeStopsWhenRefused(t *testing.T) {
+	log := newEventLog()
+	log.cut = func(n int) int { return 0 }
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Last-Event-ID") != "" {
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"detail": "revoked"})
+			return
+		}
+		log.ServeHTTP(w, r)
+	})
+	c.sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	// The first connection moves past an event of another tenant, then
+	// drops; reconnecting after it is refused
+	log.publish("")
+	log.publish(EventTargetChanged)
+
+	events, err := c.Subscribe(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev, ok := <-events:
+		if ok {
+			t.Fatalf("event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not closed")
+	}
+
+	bad := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"detail": "invalid key"})
+	})
+	if _, err := bad.Subscribe(context.Background()); err == nil {
+		t.Fatal("expected the first connection's error")
+	}
+}
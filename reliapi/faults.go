@@ -0,0 +1,237 @@
+package reliapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FaultHeader asks the proxy to inject faults into a request, to test how
+// callers cope with failures. Its value is a fault spec, a comma-separated
+// list of Faults such as "latency=2000;p=0.5, error=CIRCUIT_OPEN". The
+// proxy rejects it with FORBIDDEN for production keys.
+const FaultHeader = "X-ReliAPI-Fault"
+
+// FaultInjectedHeader names the faults injected into a response, as
+// Meta.FaultInjected does.
+const FaultInjectedHeader = "X-ReliAPI-Fault-Injected"
+
+// Fault kinds.
+const (
+	FaultLatency  = "latency"
+	FaultError    = "error"
+	FaultTruncate = "truncate"
+	FaultCorrupt  = "corrupt"
+)
+
+// faultErrors are the error codes a FaultError can inject, with the status,
+// type and retryability the proxy reports them with.
+var faultErrors = map[string]struct {
+	status    int
+	errType   string
+	retryable bool
+}{
+	CodeBudgetExceeded:        {http.StatusBadRequest, "budget_error", false},
+	CodeKeyBudgetExceeded:     {http.StatusBadRequest, "budget_error", false},
+	CodeContextLengthExceeded: {http.StatusBadRequest, "client_error", false},
+	CodeRateLimited:           {http.StatusTooManyRequests, "rate_limit", true},
+	CodeQueueFull:             {http.StatusTooManyRequests, "rate_limit", true},
+	CodeConcurrencyLimit:      {http.StatusTooManyRequests, "concurrency_limit", true},
+	CodeCircuitOpen:           {http.StatusServiceUnavailable, "upstream_error", true},
+	CodeServerError:           {http.StatusBadGateway, "upstream_error", true},
+	CodeNetworkError:          {http.StatusBadGateway, "upstream_error", true},
+	CodeProviderError:         {http.StatusBadGateway, "upstream_error", false},
+	CodeUpstreamTimeout:       {http.StatusGatewayTimeout, "upstream_error", true},
+	CodeInternalError:         {http.StatusInternalServerError, "internal_error", false},
+}
+
+// maxFaultLatency is the longest latency the proxy injects.
+const maxFaultLatency = time.Minute
+
+// Fault is a failure injected into a request:
+//
+//   - FaultLatency delays the response by Latency;
+//   - FaultError answers with the error ErrorCode, without calling the
+//     upstream;
+//   - FaultTruncate ends a stream after AfterChunks chunks, without its
+//     done event;
+//   - FaultCorrupt makes the JSON body of a response invalid.
+//
+// A fault fires with Probability, or always when it is 0. Requests a fault
+// fired for report it in Meta.FaultInjected, and are left out of usage and
+// cost reporting.
+type Fault struct {
+	Kind        string
+	Probability float64
+	Latency     time.Duration
+	ErrorCode   string
+	AfterChunks int
+}
+
+// LatencyFault delays responses by d, in whole milliseconds.
+func LatencyFault(d time.Duration) Fault { return Fault{Kind: FaultLatency, Latency: d} }
+
+// ErrorFault answers with the error code, e.g. CodeCircuitOpen.
+func ErrorFault(code string) Fault { return Fault{Kind: FaultError, ErrorCode: code} }
+
+// TruncateFault ends streams after n chunks.
+func TruncateFault(n int) Fault { return Fault{Kind: FaultTruncate, AfterChunks: n} }
+
+// CorruptFault makes JSON response bodies invalid.
+func CorruptFault() Fault { return Fault{Kind: FaultCorrupt} }
+
+// WithProbability returns f firing with probability p.
+func (f Fault) WithProbability(p float64) Fault {
+	f.Probability = p
+	return f
+}
+
+// String formats f as in a fault spec, e.g. "latency=2000;p=0.5".
+func (f Fault) String() string {
+	var s string
+	switch f.Kind {
+	case FaultLatency:
+		s = "latency=" + strconv.FormatInt(f.Latency.Milliseconds(), 10)
+	case FaultError:
+		s = "error=" + f.ErrorCode
+	case FaultTruncate:
+		s = "truncate=" + strconv.Itoa(f.AfterChunks)
+	default:
+		s = f.Kind
+	}
+	if f.Probability > 0 && f.Probability < 1 {
+		s += ";p=" + strconv.FormatFloat(f.Probability, 'g', -1, 64)
+	}
+	return s
+}
+
+// Label is how Meta.FaultInjected names f, e.g. "latency_2000ms".
+func (f Fault) Label() string {
+	switch f.Kind {
+	case FaultLatency:
+		return fmt.Sprintf("latency_%dms", f.Latency.Milliseconds())
+	case FaultError:
+		return "error_" + f.ErrorCode
+	case FaultTruncate:
+		return fmt.Sprintf("truncate_after_%d_chunks", f.AfterChunks)
+	}
+	return "corrupt_json"
+}
+
+// Err is the error a FaultError answers with, as the proxy reports it; nil
+// for other kinds.
+func (f Fault) Err() *APIError {
+	e, ok := faultErrors[f.ErrorCode]
+	if f.Kind != FaultError || !ok {
+		return nil
+	}
+	err := &APIError{
+		StatusCode: e.status, Type: e.errType, Code: f.ErrorCode,
+		Message: "Injected fault: " + f.ErrorCode, Retryable: e.retryable,
+	}
+	if e.status == http.StatusTooManyRequests {
+		err.RetryAfter = time.Second
+	}
+	return err
+}
+
+func (f Fault) validate() error {
+	switch {
+	case f.Probability < 0 || f.Probability > 1:
+		return fmt.Errorf("reliapi: fault %s: probability %v is not between 0 and 1", f.Kind, f.Probability)
+	case f.Kind == FaultLatency && (f.Latency < time.Millisecond || f.Latency > maxFaultLatency):
+		return fmt.Errorf("reliapi: latency fault of %v is not between 1ms and %v", f.Latency, maxFaultLatency)
+	case f.Kind == FaultError:
+		if _, ok := faultErrors[f.ErrorCode]; !ok {
+			return fmt.Errorf("reliapi: error code %q can't be injected", f.ErrorCode)
+		}
+	case f.Kind == FaultTruncate && f.AfterChunks < 0:
+		return fmt.Errorf("reliapi: truncate fault after %d chunks", f.AfterChunks)
+	case f.Kind != FaultLatency && f.Kind != FaultTruncate && f.Kind != FaultCorrupt:
+		return fmt.Errorf("reliapi: unknown fault %q", f.Kind)
+	}
+	return nil
+}
+
+// ParseFaults parses a fault spec, the value of FaultHeader.
+func ParseFaults(spec string) ([]Fault, error) {
+	var faults []Fault
+	for _, item := range strings.Split(spec, ",") {
+		parts := strings.Split(item, ";")
+		kind, arg, _ := strings.Cut(strings.TrimSpace(parts[0]), "=")
+		f := Fault{Kind: strings.TrimSpace(kind)}
+		arg = strings.TrimSpace(arg)
+		var err error
+		switch f.Kind {
+		case FaultLatency:
+			var ms int
+			ms, err = strconv.Atoi(strings.TrimSuffix(arg, "ms"))
+			f.Latency = time.Duration(ms) * time.Millisecond
+		case FaultError:
+			f.ErrorCode = arg
+		case FaultTruncate:
+			f.AfterChunks, err = strconv.Atoi(arg)
+		case FaultCorrupt:
+			if arg != "" {
+				err = fmt.Errorf("takes no value")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reliapi: fault %q: %w", strings.TrimSpace(item), err)
+		}
+		for _, option := range parts[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+			if strings.TrimSpace(name) != "p" {
+				return nil, fmt.Errorf("reliapi: fault %q: unknown option %q", strings.TrimSpace(item), name)
+			}
+			if f.Probability, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil || f.Probability == 0 {
+				return nil, fmt.Errorf("reliapi: fault %q: p must be above 0 and at most 1", strings.TrimSpace(item))
+			}
+		}
+		if err := f.validate(); err != nil {
+			return nil, err
+		}
+		faults = append(faults, f)
+	}
+	return faults, nil
+}
+
+// formatFaults formats faults as a fault spec.
+func formatFaults(faults []Fault) string {
+	specs := make([]string, len(faults))
+	for i, f := range faults {
+		specs[i] = f.String()
+	}
+	return strings.Join(specs, ", ")
+}
+
+type faultsContextKey struct{}
+
+// WithFaults returns a copy of ctx under which requests ask the proxy to
+// inject faults, instead of those of WithFaultInjection.
+func WithFaults(ctx context.Context, faults ...Fault) context.Context {
+	return context.WithValue(ctx, faultsContextKey{}, faults)
+}
+
+// WithFaultInjection makes every request ask the proxy to inject faults.
+// Use it against test keys and non-production deployments only.
+func WithFaultInjection(faults ...Fault) Option {
+	return func(c *Client) {
+		c.faults = faults
+	}
+}
+
+// setFaultHeader sets FaultHeader on req from the faults of ctx or the
+// client, if any.
+func (c *Client) setFaultHeader(ctx context.Context, req *http.Request) {
+	faults, ok := ctx.Value(faultsContextKey{}).([]Fault)
+	if !ok {
+		faults = c.faults
+	}
+	if len(faults) > 0 {
+		req.Header.Set(FaultHeader, formatFaults(faults))
+	}
+}
@@ -0,0 +1,89 @@
+package reliapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseFaults(t *testing.T) {
+	spec := "latency=2000;p=0.5, error=CIRCUIT_OPEN, truncate=3, corrupt;p=0.1"
+	faults, err := ParseFaults(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Fault{
+		LatencyFault(2 * time.Second).WithProbability(0.5),
+		ErrorFault(CodeCircuitOpen),
+		TruncateFault(3),
+		CorruptFault().WithProbability(0.1),
+	}
+	if len(faults) != len(want) {
+		t.Fatalf("faults = %+v", faults)
+	}
+	for i := range want {
+		if faults[i] != want[i] {
+			t.Errorf("faults[%d] = %+v, want %+v", i, faults[i], want[i])
+		}
+	}
+	if got := formatFaults(faults); got != spec {
+		t.Errorf("formatFaults = %q, want %q", got, spec)
+	}
+	labels := []string{"latency_2000ms", "error_CIRCUIT_OPEN", "truncate_after_3_chunks", "corrupt_json"}
+	for i, f := range faults {
+		if f.Label() != labels[i] {
+			t.Errorf("Label = %q, want %q", f.Label(), labels[i])
+		}
+	}
+
+	for _, bad := range []string{"", "explode", "latency=soon", "latency=999999", "error=TEAPOT", "truncate=-1", "corrupt=1", "latency=10;p=2", "latency=10;q=1", "latency=10,"} {
+		if _, err := ParseFaults(bad); err == nil {
+			t.Errorf("ParseFaults(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestFaultErr(t *testing.T) {
+	err := ErrorFault(CodeRateLimited).Err()
+	if err.StatusCode != http.StatusTooManyRequests || !err.Retryable || err.RetryAfter != time.Second {
+		t.Errorf("err = %+v", err)
+	}
+	if !IsBudgetExceeded(ErrorFault(CodeBudgetExceeded).Err()) {
+		t.Error("BUDGET_EXCEEDED fault is not a budget error")
+	}
+	if LatencyFault(time.Second).Err() != nil {
+		t.Error("latency fault has an error")
+	}
+}
+
+func TestFaultHeader(t *testing.T) {
+	var sent []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get(FaultHeader))
+		w.Header().Set(FaultInjectedHeader, "latency_100ms")
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true, "data": map[string]interface{}{"content": "hi"},
+			"meta": map[string]interface{}{"fault_injected": "latency_100ms"},
+		})
+	}, WithFaultInjection(ErrorFault(CodeServerError).WithProbability(0.25)))
+
+	ctx := context.Background()
+	resp, err := c.ProxyLLM(ctx, llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ProxyLLM(WithFaults(ctx, LatencyFault(100*time.Millisecond)), llmReq("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ProxyLLM(WithFaults(ctx), llmReq("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"error=SERVER_ERROR;p=0.25", "latency=100", ""}; len(sent) != 3 || sent[0] != want[0] || sent[1] != want[1] || sent[2] != want[2] {
+		t.Errorf("%s = %q, want %q", FaultHeader, sent, want)
+	}
+	if resp.Meta.FaultInjected != "latency_100ms" {
+		t.Errorf("FaultInjected = %q", resp.Meta.FaultInjected)
+	}
+}
@@ -0,0 +1,25 @@
+package reliapi
+
+import "strings"
+
+// SelectFields returns r with a ResponseFilter selecting paths of Data,
+// e.g. req.SelectFields("content", "usage"). No paths clears the filter.
+func (r LLMRequest) SelectFields(paths ...string) LLMRequest {
+	r.ResponseFilter = joinFields(paths)
+	return r
+}
+
+// SelectFields returns r with a ResponseFilter selecting paths of the
+// upstream body, as LLMRequest.SelectFields does.
+func (r HTTPRequest) SelectFields(paths ...string) HTTPRequest {
+	r.ResponseFilter = joinFields(paths)
+	return r
+}
+
+func joinFields(paths []string) *string {
+	if len(paths) == 0 {
+		return nil
+	}
+	filter := strings.Join(paths, ", ")
+	return &filter
+}
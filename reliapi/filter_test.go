@@ -0,0 +1,70 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestSelectFields(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		raw, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &body)
+		if body["response_filter"] != "content, usage.total_tokens" || body["filter_before_cache"] != true {
+			t.Errorf("body = %v", body)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "hi", "usage": map[string]interface{}{"total_tokens": 3}},
+			"meta": map[string]interface{}{
+				"request_id": "req_1", "target": "openai", "original_bytes": 412, "filtered_bytes": 44,
+			},
+		})
+	})
+
+	req := llmReq("hi").SelectFields("content", "usage.total_tokens")
+	req.FilterBeforeCache = true
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if resp.Meta.OriginalBytes != 412 || resp.Meta.FilteredBytes != 44 {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+	if req.SelectFields().ResponseFilter != nil {
+		t.Error("SelectFields() kept the filter")
+	}
+}
+
+func TestResponseFilterKeys(t *testing.T) {
+	c, err := NewClient("", "k", WithCoalescing(ShareLeaderError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := llmReq("q")
+	plain.Model = "gpt-4o-mini"
+	filtered := plain.SelectFields("usage")
+
+	keyA, _ := c.llmCoalesceKey(plain)
+	if keyB, _ := c.llmCoalesceKey(filtered); keyA == keyB {
+		t.Error("filtered requests coalesced with unfiltered ones")
+	}
+	get := HTTPRequest{Target: "api", Method: "GET", Path: "/a"}
+	k1, _ := c.httpCoalesceKey(get)
+	if k2, _ := c.httpCoalesceKey(get.SelectFields("id")); k1 == k2 {
+		t.Error("filtered HTTP requests coalesced with unfiltered ones")
+	}
+
+	// The proxy only caches responses filtered under a key of their own.
+	want, _ := CanonicalCacheKey(plain)
+	if got, _ := CanonicalCacheKey(filtered); got != want {
+		t.Errorf("filter without FilterBeforeCache changed the cache key")
+	}
+	filtered.FilterBeforeCache = true
+	if got, _ := CanonicalCacheKey(filtered); got == want {
+		t.Errorf("FilterBeforeCache shares the unfiltered cache key")
+	}
+}
@@ -0,0 +1,123 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const graphqlProxyPath = "/v1/proxy/graphql"
+
+// GraphQLRequest is the body of a POST /v1/proxy/graphql call.
+//
+// The proxy caches queries under a key derived from the normalized Query
+// (whitespace, comments and the order of selections don't matter) and the
+// canonical Variables, so equivalent queries share an entry. Mutations are
+// never cached; give them an IdempotencyKey to make them safe to resend.
+type GraphQLRequest struct {
+	Target string `json:"target"`
+	Query  string `json:"query"`
+	// OperationName selects the operation to execute; it is required when
+	// Query holds more than one.
+	OperationName string                 `json:"operation_name,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	// Path is the target's GraphQL endpoint; empty means "/graphql".
+	Path           string            `json:"path,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	IdempotencyKey *string           `json:"idempotency_key,omitempty"`
+	// Cache overrides the target's cache TTL in seconds. Only queries are
+	// cached.
+	Cache *int `json:"cache,omitempty"`
+
+	// Retry overrides the target's upstream retry policy for this request.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// TenantID selects the API key the request authenticates with, via
+	// WithTenantKeyProvider. It is not sent to the proxy.
+	TenantID string `json:"-"`
+}
+
+// GraphQLError is an entry of a GraphQL result's errors.
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLLocation is a position in a GraphQL document.
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return "graphql: " + e.Message
+	}
+	parts := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		parts[i] = fmt.Sprint(p)
+	}
+	return fmt.Sprintf("graphql: %s (at %s)", e.Message, strings.Join(parts, "."))
+}
+
+// GraphQLErrors are the errors a GraphQL upstream reported for a request.
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ProxyGraphQL sends a GraphQL operation through the proxy's GraphQL
+// endpoint. Data holds the GraphQL result, {data, errors, extensions}.
+//
+// Errors the upstream reports do not fail the call: a result with partial
+// data is returned with its errors in ReliAPIResponse.GraphQLErrors, and so
+// is one without data. The returned error covers failures to get a
+// GraphQL result at all, such as an invalid document or an upstream that
+// is down.
+func (c *Client) ProxyGraphQL(ctx context.Context, req GraphQLRequest) (resp *ReliAPIResponse, err error) {
+	ctx, in := c.instrument(ctx, OpProxyGraphQL, req.Target)
+	defer in.endResponse(&resp, &err)
+	ctx, err = c.tenantContext(ctx, req.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.applyIdempotency(&req.IdempotencyKey, req, allowsResend(req.Retry))
+	if err != nil {
+		return nil, err
+	}
+	hr, err := c.startHooks(ctx, OpProxyGraphQL, req.Target, &req.IdempotencyKey, req)
+	if err != nil {
+		return nil, err
+	}
+	if hr != nil {
+		key = hr.IdempotencyKey
+	}
+	resp, err = c.post(withHookRequest(ctx, hr), graphqlProxyPath, req, req.IdempotencyKey != nil && allowsResend(req.Retry))
+	if resp != nil {
+		resp.IdempotencyKey = key
+		if derr := decodeGraphQLErrors(resp); derr != nil && err == nil {
+			resp, err = nil, derr
+		}
+	}
+	return resp, withIdempotencyKey(c.endHooks(ctx, hr, resp, err), key)
+}
+
+// decodeGraphQLErrors fills resp.GraphQLErrors from the result's errors.
+func decodeGraphQLErrors(resp *ReliAPIResponse) error {
+	var data map[string]json.RawMessage
+	if json.Unmarshal(resp.Data, &data) != nil || data["errors"] == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data["errors"], &resp.GraphQLErrors); err != nil {
+		return fmt.Errorf("reliapi: decode GraphQL errors: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestProxyGraphQLPartialErrors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != graphqlProxyPath {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body["operation_name"] != "User" || body["variables"].(map[string]interface{})["id"] != "1" {
+			t.Errorf("body = %v", body)
+		}
+		if _, ok := body["path"]; ok {
+			t.Error("empty Path was sent")
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"data": map[string]interface{}{"user": map[string]interface{}{"name": "Ada", "avatar": nil}},
+				"errors": []interface{}{map[string]interface{}{
+					"message":   "avatar unavailable",
+					"locations": []interface{}{map[string]interface{}{"line": 1, "column": 30}},
+					"path":      []interface{}{"user", "avatar"},
+				}},
+			},
+			"meta": map[string]interface{}{"request_id": "req_g", "upstream_status": 200},
+		})
+	})
+
+	resp, err := c.ProxyGraphQL(context.Background(), GraphQLRequest{
+		Target:        "gql",
+		Query:         "query User($id: ID!) { user(id: $id) { name avatar } }",
+		OperationName: "User",
+		Variables:     map[string]interface{}{"id": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GraphQLErrors) != 1 {
+		t.Fatalf("GraphQLErrors = %v", resp.GraphQLErrors)
+	}
+	gerr := resp.GraphQLErrors[0]
+	if gerr.Message != "avatar unavailable" || gerr.Locations[0] != (GraphQLLocation{Line: 1, Column: 30}) {
+		t.Errorf("error = %+v", gerr)
+	}
+	if got := resp.GraphQLErrors.Error(); got != "graphql: avatar unavailable (at user.avatar)" {
+		t.Errorf("Error() = %q", got)
+	}
+	user := resp.DataMap()["data"].(map[string]interface{})["user"].(map[string]interface{})
+	if user["name"] != "Ada" {
+		t.Errorf("data = %v", resp.Data)
+	}
+}
+
+func TestProxyGraphQLResendsWithIdempotencyKey(t *testing.T) {
+	var calls int32
+	var keys []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			IdempotencyKey string `json:"idempotency_key"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		keys = append(keys, body.IdempotencyKey)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			writeJSON(w, http.StatusBadGateway, map[string]interface{}{"detail": "bad gateway"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"data": map[string]interface{}{"set": true}},
+			"meta":    map[string]interface{}{"request_id": "req_m"},
+		})
+	}, WithRetry(2, 0))
+
+	// Without a key the mutation gets one, so the resend can't run it twice
+	mutation := GraphQLRequest{Target: "gql", Query: "mutation { set(v: 1) }"}
+	resp, err := c.ProxyGraphQL(context.Background(), mutation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[1] != keys[0] || resp.IdempotencyKey != keys[0] {
+		t.Errorf("keys = %q, resp key = %q", keys, resp.IdempotencyKey)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	keys = nil
+	key := "set-1"
+	mutation.IdempotencyKey = &key
+	resp, err = c.ProxyGraphQL(context.Background(), mutation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.IdempotencyKey != key || resp.GraphQLErrors != nil || keys[1] != key {
+		t.Errorf("resp = %+v", resp)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
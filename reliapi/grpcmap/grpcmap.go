@@ -0,0 +1,281 @@
+// Package grpcmap translates between the errors of the reliapi client and
+// gRPC statuses, for services that call ReliAPI behind a gRPC API:
+//
+//	resp, err := client.ProxyLLM(ctx, req)
+//	if err != nil {
+//		return nil, grpcmap.ToStatus(err).Err()
+//	}
+//
+// ToStatus maps each ReliAPI error code onto the canonical gRPC code its
+// callers should act on (a budget rejection is ResourceExhausted, an open
+// circuit Unavailable, an invalid request InvalidArgument, an upstream
+// timeout DeadlineExceeded), and carries the error itself in the status
+// details: an ErrorInfo of Domain with the code as its reason and the
+// request ID, HTTP status and error details as metadata, a RetryInfo with
+// the wait the proxy asked for, and a QuotaFailure for budget rejections.
+// FromStatus, on the other side of the hop, rebuilds the *reliapi.APIError,
+// so reliapi.IsRetriable, reliapi.IsCircuitOpen, reliapi.AsBudgetExceeded
+// and the like give the same answers there.
+//
+// The package is a module of its own, so the reliapi client doesn't depend
+// on gRPC.
+package grpcmap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Domain is the ErrorInfo domain of the statuses ToStatus makes.
+const Domain = "reliapi.kikuai.dev"
+
+// ErrorInfo metadata keys of the APIError fields carried across.
+const (
+	MetaRequestID      = "request_id"
+	MetaStatusCode     = "status_code"
+	MetaType           = "type"
+	MetaTarget         = "target"
+	MetaRetryable      = "retryable"
+	MetaSource         = "source"
+	MetaIdempotencyKey = "idempotency_key"
+	// MetaDetails is the APIError's Details as JSON.
+	MetaDetails = "details"
+)
+
+// codeByError is the gRPC code of each ReliAPI error code. Codes not
+// listed map by the error's HTTP status.
+var codeByError = map[string]codes.Code{
+	reliapi.CodeUnauthorized:           codes.Unauthenticated,
+	reliapi.CodeForbidden:              codes.PermissionDenied,
+	reliapi.CodeNotAllowed:             codes.PermissionDenied,
+	reliapi.CodeBadRequest:             codes.InvalidArgument,
+	reliapi.CodeNotFound:               codes.NotFound,
+	reliapi.CodeIdempotencyConflict:    codes.Aborted,
+	reliapi.CodeRateLimited:            codes.ResourceExhausted,
+	reliapi.CodeQueueFull:              codes.ResourceExhausted,
+	reliapi.CodeConcurrencyLimit:       codes.ResourceExhausted,
+	reliapi.CodeBatchAborted:           codes.Aborted,
+	reliapi.CodeContextLengthExceeded:  codes.InvalidArgument,
+	reliapi.CodeInvalidTemplateVars:    codes.InvalidArgument,
+	reliapi.CodeUnknownCredential:      codes.NotFound,
+	reliapi.CodeDeadlineTooShort:       codes.DeadlineExceeded,
+	reliapi.CodeUnsupportedParameter:   codes.InvalidArgument,
+	reliapi.CodeModelLimitsExceeded:    codes.InvalidArgument,
+	reliapi.CodeConversationConflict:   codes.Aborted,
+	reliapi.CodeReplayUnavailable:      codes.FailedPrecondition,
+	reliapi.CodeNetworkError:           codes.Unavailable,
+	reliapi.CodeUpstreamTimeout:        codes.DeadlineExceeded,
+	reliapi.CodeStreamInterrupted:      codes.Unavailable,
+	reliapi.CodeResponseTooLarge:       codes.ResourceExhausted,
+	reliapi.CodeCircuitOpen:            codes.Unavailable,
+	reliapi.CodeBudgetExceeded:         codes.ResourceExhausted,
+	reliapi.CodeKeyBudgetExceeded:      codes.ResourceExhausted,
+	reliapi.CodeInvalidTarget:          codes.InvalidArgument,
+	reliapi.CodeUnknownProvider:        codes.InvalidArgument,
+	reliapi.CodeAdapterNotFound:        codes.InvalidArgument,
+	reliapi.CodeStreamingUnsupported:   codes.InvalidArgument,
+	reliapi.CodeStreamInProgress:       codes.Aborted,
+	reliapi.CodeStreamAlreadyComplete:  codes.FailedPrecondition,
+	reliapi.CodeInternalError:          codes.Internal,
+	reliapi.CodeOutputValidationFailed: codes.Internal,
+	reliapi.CodeMaintenance:            codes.Unavailable,
+}
+
+// codeByHTTP is the gRPC code of an HTTP status, as in the gRPC HTTP
+// mapping.
+func codeByHTTP(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if statusCode >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// ToStatus returns the gRPC status of err, nil for a nil err. A
+// *reliapi.APIError maps by its code and carries its fields in the
+// details; errors of the client itself map to Canceled, DeadlineExceeded,
+// Unavailable (failed connections and interrupted streams), Unimplemented
+// (reliapi.ErrNotSupported) or ResourceExhausted
+// (reliapi.ErrBudgetGuardRejected), and others to Unknown. A status error
+// from a gRPC call is returned as it is.
+func ToStatus(err error) *status.Status {
+	if err == nil {
+		return nil
+	}
+	var apiErr *reliapi.APIError
+	if errors.As(err, &apiErr) {
+		return apiStatus(apiErr)
+	}
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, reliapi.ErrNotSupported):
+		return status.New(codes.Unimplemented, err.Error())
+	case errors.Is(err, reliapi.ErrBudgetGuardRejected):
+		return status.New(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, reliapi.ErrStreamInterrupted), errors.Is(err, reliapi.ErrStreamGap), errors.As(err, &netErr):
+		return status.New(codes.Unavailable, err.Error())
+	}
+	return status.New(codes.Unknown, err.Error())
+}
+
+func apiStatus(e *reliapi.APIError) *status.Status {
+	code, ok := codeByError[strings.ToUpper(e.Code)]
+	if !ok {
+		code = codeByHTTP(e.StatusCode)
+	}
+	msg := e.Message
+	if msg == "" {
+		msg = e.Error()
+	}
+	st := status.New(code, msg)
+
+	meta := map[string]string{
+		MetaStatusCode: strconv.Itoa(e.StatusCode),
+		MetaRetryable:  strconv.FormatBool(e.Retryable),
+	}
+	for key, value := range map[string]string{
+		MetaRequestID:      e.RequestID,
+		MetaType:           e.Type,
+		MetaTarget:         e.Target,
+		MetaSource:         e.Source,
+		MetaIdempotencyKey: e.IdempotencyKey,
+	} {
+		if value != "" {
+			meta[key] = value
+		}
+	}
+	if len(e.Details) > 0 {
+		if raw, err := json.Marshal(e.Details); err == nil {
+			meta[MetaDetails] = string(raw)
+		}
+	}
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: e.Code, Domain: Domain, Metadata: meta}}
+	if e.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(e.RetryAfter)})
+	}
+	if reliapi.IsBudgetExceeded(e) || reliapi.IsKeyBudgetExceeded(e) {
+		details = append(details, &errdetails.QuotaFailure{
+			Violations: []*errdetails.QuotaFailure_Violation{{Subject: "budget", Description: msg}},
+		})
+	}
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// FromStatus returns the error st stands for, nil for a nil or OK status.
+// A status made by ToStatus from a *reliapi.APIError gives back that
+// error, with its code, request ID, HTTP status, details and RetryAfter;
+// Canceled and DeadlineExceeded without one are context.Canceled and
+// context.DeadlineExceeded. Others become a *reliapi.APIError of the
+// nearest ReliAPI code, with RetryAfter from a RetryInfo in the details,
+// so retry decisions carry over.
+func FromStatus(st *status.Status) error {
+	if st == nil || st.Code() == codes.OK {
+		return nil
+	}
+	e := &reliapi.APIError{Message: st.Message()}
+	var info *errdetails.ErrorInfo
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			if d.GetDomain() == Domain {
+				info = d
+			}
+		case *errdetails.RetryInfo:
+			e.RetryAfter = d.GetRetryDelay().AsDuration()
+		}
+	}
+	if info == nil {
+		switch st.Code() {
+		case codes.Canceled:
+			return context.Canceled
+		case codes.DeadlineExceeded:
+			if e.RetryAfter == 0 {
+				return context.DeadlineExceeded
+			}
+		}
+		e.Code, e.StatusCode, e.Retryable = foreignCode(st.Code())
+		return e
+	}
+
+	meta := info.GetMetadata()
+	e.Code = info.GetReason()
+	e.StatusCode, _ = strconv.Atoi(meta[MetaStatusCode])
+	e.Retryable, _ = strconv.ParseBool(meta[MetaRetryable])
+	e.RequestID = meta[MetaRequestID]
+	e.Type = meta[MetaType]
+	e.Target = meta[MetaTarget]
+	e.Source = meta[MetaSource]
+	e.IdempotencyKey = meta[MetaIdempotencyKey]
+	if raw := meta[MetaDetails]; raw != "" {
+		_ = json.Unmarshal([]byte(raw), &e.Details)
+	}
+	return e
+}
+
+// foreignCode is the ReliAPI code, HTTP status and retryability of a gRPC
+// code of a status that didn't come from ToStatus.
+func foreignCode(code codes.Code) (string, int, bool) {
+	switch code {
+	case codes.InvalidArgument, codes.OutOfRange:
+		return reliapi.CodeBadRequest, http.StatusBadRequest, false
+	case codes.Unauthenticated:
+		return reliapi.CodeUnauthorized, http.StatusUnauthorized, false
+	case codes.PermissionDenied:
+		return reliapi.CodeForbidden, http.StatusForbidden, false
+	case codes.NotFound:
+		return reliapi.CodeNotFound, http.StatusNotFound, false
+	case codes.ResourceExhausted:
+		return reliapi.CodeRateLimited, http.StatusTooManyRequests, true
+	case codes.Unavailable:
+		return reliapi.CodeServerError, http.StatusServiceUnavailable, true
+	case codes.DeadlineExceeded:
+		return reliapi.CodeUpstreamTimeout, http.StatusGatewayTimeout, true
+	case codes.Aborted, codes.AlreadyExists:
+		return reliapi.CodeClientError, http.StatusConflict, false
+	case codes.Unimplemented:
+		return reliapi.CodeClientError, http.StatusNotImplemented, false
+	}
+	return reliapi.CodeInternalError, http.StatusInternalServerError, false
+}
@@ -0,0 +1,157 @@
+package grpcmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		err  *reliapi.APIError
+		code codes.Code
+	}{
+		{&reliapi.APIError{StatusCode: 402, Type: "budget_error", Code: reliapi.CodeBudgetExceeded, Message: "over the cap",
+			Details: map[string]interface{}{"cost_estimate_usd": 0.5, "hard_cost_cap_usd": 0.1}}, codes.ResourceExhausted},
+		{&reliapi.APIError{StatusCode: 402, Code: reliapi.CodeKeyBudgetExceeded, Message: "key over budget"}, codes.ResourceExhausted},
+		{&reliapi.APIError{StatusCode: 503, Type: "upstream_error", Code: reliapi.CodeCircuitOpen, Message: "circuit open",
+			Retryable: true, Target: "openai", RetryAfter: 42 * time.Second}, codes.Unavailable},
+		{&reliapi.APIError{StatusCode: 503, Code: reliapi.CodeMaintenance, Retryable: true, RetryAfter: 1500 * time.Millisecond,
+			Details: map[string]interface{}{"read_only": true}}, codes.Unavailable},
+		{&reliapi.APIError{StatusCode: 400, Type: "client_error", Code: reliapi.CodeBadRequest, Message: "messages is required"}, codes.InvalidArgument},
+		{&reliapi.APIError{StatusCode: 400, Code: reliapi.CodeUnsupportedParameter}, codes.InvalidArgument},
+		{&reliapi.APIError{StatusCode: 400, Code: reliapi.CodeContextLengthExceeded}, codes.InvalidArgument},
+		{&reliapi.APIError{StatusCode: 504, Type: "upstream_error", Code: reliapi.CodeUpstreamTimeout, Retryable: true,
+			Details: map[string]interface{}{"timeout_ms": float64(5000), "attempts_completed": float64(2)}}, codes.DeadlineExceeded},
+		{&reliapi.APIError{StatusCode: 429, Code: reliapi.CodeRateLimited, Retryable: true, RetryAfter: time.Second}, codes.ResourceExhausted},
+		{&reliapi.APIError{StatusCode: 429, Code: reliapi.CodeQueueFull}, codes.ResourceExhausted},
+		{&reliapi.APIError{StatusCode: 401, Code: reliapi.CodeUnauthorized}, codes.Unauthenticated},
+		{&reliapi.APIError{StatusCode: 403, Code: reliapi.CodeForbidden}, codes.PermissionDenied},
+		{&reliapi.APIError{StatusCode: 404, Code: reliapi.CodeNotFound}, codes.NotFound},
+		{&reliapi.APIError{StatusCode: 409, Code: reliapi.CodeIdempotencyConflict, IdempotencyKey: "key-1"}, codes.Aborted},
+		{&reliapi.APIError{StatusCode: 502, Type: "upstream_error", Code: reliapi.CodeServerError, Retryable: true, Source: "upstream"}, codes.Unavailable},
+		{&reliapi.APIError{StatusCode: 500, Code: reliapi.CodeInternalError}, codes.Internal},
+		{&reliapi.APIError{StatusCode: 418, Message: "teapot"}, codes.Unknown},
+	} {
+		t.Run(tt.err.Code, func(t *testing.T) {
+			tt.err.RequestID = "req_123"
+			st := ToStatus(fmt.Errorf("calling the proxy: %w", tt.err))
+			if st.Code() != tt.code {
+				t.Errorf("code = %v, want %v", st.Code(), tt.code)
+			}
+			// Across the wire
+			wire, _ := status.FromError(st.Err())
+			var got *reliapi.APIError
+			if !errors.As(FromStatus(wire), &got) {
+				t.Fatalf("FromStatus = %v", FromStatus(wire))
+			}
+			want := *tt.err
+			if want.Message == "" {
+				want.Message = tt.err.Error()
+			}
+			if !reflect.DeepEqual(got, &want) {
+				t.Errorf("round trip:\n got %+v\nwant %+v", got, &want)
+			}
+			if reliapi.IsRetriable(got) != reliapi.IsRetriable(tt.err) {
+				t.Errorf("retriable = %v", reliapi.IsRetriable(got))
+			}
+		})
+	}
+}
+
+func TestRetryInfo(t *testing.T) {
+	st := ToStatus(&reliapi.APIError{StatusCode: 503, Code: reliapi.CodeCircuitOpen, RetryAfter: 90 * time.Second})
+	var retry *errdetails.RetryInfo
+	var info *errdetails.ErrorInfo
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.RetryInfo:
+			retry = d
+		case *errdetails.ErrorInfo:
+			info = d
+		}
+	}
+	if retry == nil || retry.GetRetryDelay().AsDuration() != 90*time.Second {
+		t.Errorf("RetryInfo = %v", retry)
+	}
+	if info == nil || info.GetReason() != reliapi.CodeCircuitOpen || info.GetDomain() != Domain {
+		t.Errorf("ErrorInfo = %v", info)
+	}
+
+	// Without a RetryAfter, none
+	for _, d := range ToStatus(&reliapi.APIError{StatusCode: 400, Code: reliapi.CodeBadRequest}).Details() {
+		if _, ok := d.(*errdetails.RetryInfo); ok {
+			t.Error("RetryInfo without a RetryAfter")
+		}
+	}
+}
+
+func TestBudgetQuotaFailure(t *testing.T) {
+	err := &reliapi.APIError{StatusCode: 402, Code: reliapi.CodeBudgetExceeded, Message: "over budget",
+		Details: map[string]interface{}{"cost_estimate_usd": 0.5, "hard_cost_cap_usd": 0.1}}
+	st := ToStatus(err)
+	found := false
+	for _, d := range st.Details() {
+		if q, ok := d.(*errdetails.QuotaFailure); ok {
+			found = len(q.GetViolations()) == 1 && q.GetViolations()[0].GetSubject() == "budget"
+		}
+	}
+	if !found {
+		t.Errorf("details = %v", st.Details())
+	}
+	rejection, ok := reliapi.AsBudgetExceeded(FromStatus(st))
+	if !ok || rejection.CostEstimateUSD != 0.5 {
+		t.Errorf("AsBudgetExceeded = %+v, %v", rejection, ok)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{context.Canceled, codes.Canceled},
+		{fmt.Errorf("wait: %w", context.DeadlineExceeded), codes.DeadlineExceeded},
+		{reliapi.ErrStreamInterrupted, codes.Unavailable},
+		{&reliapi.NotSupportedError{Feature: reliapi.FeatureAsyncJobs, MinVersion: "1.0.7", ServerVersion: "1.0.5"}, codes.Unimplemented},
+		{&reliapi.BudgetGuardRejectedError{Model: "gpt-4o"}, codes.ResourceExhausted},
+		{status.Error(codes.NotFound, "from another service"), codes.NotFound},
+		{errors.New("something else"), codes.Unknown},
+	} {
+		if got := ToStatus(tt.err).Code(); got != tt.code {
+			t.Errorf("ToStatus(%v) = %v, want %v", tt.err, got, tt.code)
+		}
+	}
+	if ToStatus(nil) != nil || FromStatus(nil) != nil || FromStatus(status.New(codes.OK, "")) != nil {
+		t.Error("nil error or OK status mapped")
+	}
+}
+
+func TestFromForeignStatus(t *testing.T) {
+	if err := FromStatus(status.New(codes.Canceled, "canceled")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Canceled = %v", err)
+	}
+	if err := FromStatus(status.New(codes.DeadlineExceeded, "late")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DeadlineExceeded = %v", err)
+	}
+
+	st, _ := status.New(codes.Unavailable, "overloaded").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(5 * time.Second)})
+	var apiErr *reliapi.APIError
+	if err := FromStatus(st); !errors.As(err, &apiErr) || !reliapi.IsRetriable(err) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.RetryAfter != 5*time.Second {
+		t.Errorf("Unavailable = %v", err)
+	}
+	st = status.New(codes.InvalidArgument, "bad field")
+	if err := FromStatus(st); !errors.As(err, &apiErr) || apiErr.Code != reliapi.CodeBadRequest || reliapi.IsRetriable(err) {
+		t.Errorf("InvalidArgument = %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const readyzPath = "/readyz"
+
+// Readiness states reported by Health.Status.
+const (
+	HealthReady    = "ready"
+	HealthNotReady = "not_ready"
+)
+
+// Health is the readiness of the proxy instance that answered.
+type Health struct {
+	// Status is HealthReady when every component is "ok".
+	Status string `json:"status"`
+	// Components holds the status of each dependency: "cache", the Redis
+	// store behind the cache, and "config", the loaded configuration.
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Ready reports whether the proxy is ready to serve requests.
+func (h *Health) Ready() bool { return h.Status == HealthReady }
+
+// ComponentStatus is the status of one of the proxy's dependencies.
+type ComponentStatus struct {
+	// Status is "ok" or "error".
+	Status    string `json:"status"`
+	LatencyMs *int   `json:"latency_ms"`
+	// Detail describes an error, or what was found, e.g. "3 targets".
+	Detail string `json:"detail"`
+}
+
+// Health checks the proxy's readiness at /readyz. A proxy that is not
+// ready answers 503; Health returns its report without an error, so
+// callers see which component failed. It is not retried.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var h Health
+	_, raw, err := c.do(ctx, http.MethodGet, readyzPath, nil, false)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable {
+		raw, err = apiErr.Body, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	return &h, nil
+}
@@ -0,0 +1,48 @@
+package reliapi
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	var calls int32
+	ready := true
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Method != http.MethodGet || r.URL.Path != "/readyz" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		status, cache := http.StatusOK, map[string]interface{}{"status": "ok", "latency_ms": 1, "detail": nil}
+		if !ready {
+			status, cache = http.StatusServiceUnavailable, map[string]interface{}{"status": "error", "detail": "Redis is unreachable"}
+		}
+		writeJSON(w, status, map[string]interface{}{
+			"status":     map[bool]string{true: "ready", false: "not_ready"}[ready],
+			"components": map[string]interface{}{"cache": cache, "config": map[string]interface{}{"status": "ok", "detail": "2 targets"}},
+		})
+	})
+
+	h, err := c.Health(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Ready() || h.Components["cache"].LatencyMs == nil || h.Components["config"].Detail != "2 targets" {
+		t.Errorf("health = %+v", h)
+	}
+
+	ready = false
+	h, err = c.Health(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Ready() || h.Status != HealthNotReady || h.Components["cache"].Detail != "Redis is unreachable" {
+		t.Errorf("health = %+v", h)
+	}
+	// A 503 is a report, not a failure to retry
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
@@ -0,0 +1,53 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestProxyLLMHedge(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var sent struct {
+			Hedge map[string]int `json:"hedge"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		if sent.Hedge["delay_ms"] != 300 || sent.Hedge["max_hedges"] != 2 {
+			t.Errorf("hedge = %v", sent.Hedge)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "hi"},
+			"meta":    map[string]interface{}{"cost_usd": 0.002, "hedged": true, "hedge_winner": 1, "hedge_cost_usd": 0.001},
+		})
+	})
+
+	req := llmReq("hi")
+	key := "order-1"
+	req.IdempotencyKey = &key
+	req.Hedge = &HedgePolicy{DelayMs: 300, MaxHedges: 2}
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Meta.Hedged || resp.Meta.HedgeWinner != 1 || resp.Meta.HedgeCostUSD != 0.001 {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+}
+
+func TestProxyLLMOmitsUnsetHedge(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["hedge"]; ok {
+			t.Error("hedge sent for a request without a policy")
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"content": "hi"}})
+	})
+	if _, err := c.ProxyLLM(context.Background(), llmReq("hi")); err != nil {
+		t.Fatal(err)
+	}
+}
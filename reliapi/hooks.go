@@ -0,0 +1,218 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// Request.Op values: the client method behind a logical call.
+const (
+	OpProxyHTTP       = "proxy_http"
+	OpProxyHTTPStream = "proxy_http_stream"
+	OpProxyGraphQL    = "proxy_graphql"
+	OpProxyEmbeddings = "proxy_embeddings"
+	OpProxyLLM        = "proxy_llm"
+	OpProxyLLMStream  = "proxy_llm_stream"
+	OpProxyLLMBatch   = "proxy_llm_batch"
+	OpSubmitLLM       = "submit_llm"
+)
+
+// Request describes a logical proxy call to hooks.
+type Request struct {
+	// Op is the client method making the call, one of the Op* constants.
+	Op string
+	// Target is the requested target.
+	Target string
+	// Header holds extra headers sent with every attempt of the call. A
+	// request hook may add to it; the client's own auth, content and trace
+	// headers take precedence.
+	Header http.Header
+	// IdempotencyKey is the key the call will send, empty for none. A
+	// request hook may set, replace or clear it; retries under WithRetry
+	// follow the final value.
+	IdempotencyKey string
+	// Body is the request as passed by the caller: an HTTPRequest or an
+	// LLMRequest, or the []LLMRequest for the attempts of a batch. Hooks
+	// must treat it as read-only; changing the slices and maps it shares
+	// with the caller is a data race.
+	Body interface{}
+	// Guard is how WithBudgetGuard rewrote Body, nil if it didn't.
+	Guard *GuardRewrite
+}
+
+// RequestHook runs before a call is sent.
+type RequestHook func(ctx context.Context, req *Request)
+
+// ResponseHook runs once a call has finished, with the call's result.
+type ResponseHook func(ctx context.Context, req *Request, resp *ReliAPIResponse, err error)
+
+// AttemptHook runs after every HTTP request sent for a call, before the
+// client decides whether to retry it. resp is nil on a transport error. The
+// hook must not read or close resp.Body.
+type AttemptHook func(ctx context.Context, req *Request, attempt int, resp *http.Response, err error)
+
+// WithRequestHook adds a hook that runs before every logical call, after
+// the client assigned its idempotency key. Hooks run in registration order
+// and exactly once per call, however many attempts WithRetry makes.
+//
+// Each item of a ProxyLLMBatch is a call of its own; the headers its hooks
+// add are merged onto the batch's single HTTP request. A call coalesced into
+// another's (WithCoalescing) sends nothing and runs no hooks; the ResponseHook
+// of the call it joined sees the shared response.
+func WithRequestHook(h RequestHook) Option {
+	return func(c *Client) {
+		if h != nil {
+			c.requestHooks = append(c.requestHooks, h)
+		}
+	}
+}
+
+// WithResponseHook adds a hook that runs once every logical call has
+// finished, in registration order. For a stream, it runs when Recv returns
+// the final error (a nil err for io.EOF) or the stream is closed early, with
+// a response that carries only Meta and IdempotencyKey.
+func WithResponseHook(h ResponseHook) Option {
+	return func(c *Client) {
+		if h != nil {
+			c.responseHooks = append(c.responseHooks, h)
+		}
+	}
+}
+
+// WithAttemptHook adds a hook that runs after every HTTP request the
+// client sends for a call, retries included.
+func WithAttemptHook(h AttemptHook) Option {
+	return func(c *Client) {
+		if h != nil {
+			c.attemptHooks = append(c.attemptHooks, h)
+		}
+	}
+}
+
+// HookPanicError is returned by a call when one of its hooks panicked. The
+// client recovers the panic after releasing the connection, so it stays
+// usable:
+//
+//   - a panicking request hook fails the call before anything is sent;
+//   - a panicking attempt hook fails the call without further retries;
+//   - a panicking response hook leaves the call's response in place and
+//     becomes its error, joined with the call's own error if it had one.
+//     The remaining response hooks still run.
+type HookPanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (e *HookPanicError) Error() string {
+	return fmt.Sprintf("reliapi: hook panicked: %v", e.Value)
+}
+
+type hookRequestKey struct{}
+
+func (c *Client) hooked() bool {
+	return len(c.requestHooks) > 0 || len(c.responseHooks) > 0 || len(c.attemptHooks) > 0
+}
+
+// startHooks runs the request hooks of a call and applies the idempotency
+// key they leave to *key. It returns a nil Request when the client has no
+// hooks.
+func (c *Client) startHooks(ctx context.Context, op, target string, key **string, body interface{}) (*Request, error) {
+	if !c.hooked() {
+		return nil, nil
+	}
+	r := &Request{Op: op, Target: target, Header: make(http.Header), Body: body, Guard: guardRewriteFrom(ctx)}
+	if *key != nil {
+		r.IdempotencyKey = **key
+	}
+	for _, h := range c.requestHooks {
+		if err := recoverHook(func() { h(ctx, r) }); err != nil {
+			return nil, err
+		}
+	}
+	if r.IdempotencyKey == "" {
+		*key = nil
+	} else {
+		k := r.IdempotencyKey
+		*key = &k
+	}
+	return r, nil
+}
+
+// withHookRequest makes the headers of r part of every attempt sent with
+// ctx, and r the Request attempt hooks see.
+func withHookRequest(ctx context.Context, r *Request) context.Context {
+	if r == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, hookRequestKey{}, r)
+}
+
+func (c *Client) hookRequest(ctx context.Context) *Request {
+	if !c.hooked() {
+		return nil
+	}
+	r, _ := ctx.Value(hookRequestKey{}).(*Request)
+	return r
+}
+
+// runAttemptHooks runs the attempt hooks for one HTTP request. On a panic it
+// closes resp's body and returns the panic as an error.
+func (c *Client) runAttemptHooks(ctx context.Context, r *Request, attempt int, resp *http.Response, err error) error {
+	for _, h := range c.attemptHooks {
+		if herr := recoverHook(func() { h(ctx, r, attempt, resp, err) }); herr != nil {
+			if resp != nil {
+				drainAndClose(resp.Body)
+			}
+			return herr
+		}
+	}
+	return nil
+}
+
+// endHooks runs the response hooks of a call and returns err, joined with
+// the first hook panic if any.
+func (c *Client) endHooks(ctx context.Context, r *Request, resp *ReliAPIResponse, err error) error {
+	return joinHookPanic(err, c.runResponseHooks(ctx, r, resp, err))
+}
+
+// runResponseHooks runs the response hooks of a call and returns the first
+// hook panic.
+func (c *Client) runResponseHooks(ctx context.Context, r *Request, resp *ReliAPIResponse, err error) error {
+	if r == nil {
+		return nil
+	}
+	var panicErr error
+	for _, h := range c.responseHooks {
+		if herr := recoverHook(func() { h(ctx, r, resp, err) }); herr != nil && panicErr == nil {
+			panicErr = herr
+		}
+	}
+	return panicErr
+}
+
+func joinHookPanic(err, panicErr error) error {
+	if panicErr == nil {
+		return err
+	}
+	if err == nil {
+		return panicErr
+	}
+	return errors.Join(err, panicErr)
+}
+
+// recoverHook calls f, turning a panic into a *HookPanicError.
+func recoverHook(f func()) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &HookPanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	f()
+	return nil
+}
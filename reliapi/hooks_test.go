@@ -0,0 +1,296 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// closeTracker counts the response bodies its transport hands out and how
+// many of them were closed.
+type closeTracker struct {
+	opened, closed atomic.Int32
+}
+
+func (t *closeTracker) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err == nil {
+		t.opened.Add(1)
+		resp.Body = &trackedBody{ReadCloser: resp.Body, closed: &t.closed}
+	}
+	return resp, err
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	closed *atomic.Int32
+	once   atomic.Bool
+}
+
+func (b *trackedBody) Close() error {
+	if b.once.CompareAndSwap(false, true) {
+		b.closed.Add(1)
+	}
+	return b.ReadCloser.Close()
+}
+
+func TestHooksRunOncePerCall(t *testing.T) {
+	var calls int32
+	var keys, correlation []string
+	flaky := flakyHandler(1, http.StatusServiceUnavailable, &calls)
+
+	var order []string
+	var attempts []int
+	var statuses []int
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			IdempotencyKey string `json:"idempotency_key"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		keys = append(keys, body.IdempotencyKey)
+		correlation = append(correlation, r.Header.Get("X-Correlation-ID"))
+		flaky(w, r)
+	},
+		WithRetry(3, time.Millisecond),
+		WithAutoIdempotency(),
+		WithRequestHook(func(ctx context.Context, req *Request) {
+			order = append(order, "first")
+			if req.Op != OpProxyLLM || req.Target != "openai" || req.IdempotencyKey == "" {
+				t.Errorf("request = %+v", req)
+			}
+			if llm, ok := req.Body.(LLMRequest); !ok || llm.Messages[0].Content != "hi" {
+				t.Errorf("body = %#v", req.Body)
+			}
+			req.Header.Set("X-Correlation-ID", "corr-1")
+		}),
+		WithRequestHook(func(ctx context.Context, req *Request) {
+			order = append(order, "second")
+			req.IdempotencyKey = "custom-key"
+		}),
+		WithAttemptHook(func(ctx context.Context, req *Request, attempt int, resp *http.Response, err error) {
+			attempts = append(attempts, attempt)
+			statuses = append(statuses, resp.StatusCode)
+		}),
+		WithResponseHook(func(ctx context.Context, req *Request, resp *ReliAPIResponse, err error) {
+			order = append(order, "response")
+			if err != nil || resp.IdempotencyKey != "custom-key" {
+				t.Errorf("response hook got %+v, %v", resp, err)
+			}
+		}),
+	)
+	recordSleeps(c)
+
+	resp, err := c.ProxyLLM(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.IdempotencyKey != "custom-key" {
+		t.Errorf("IdempotencyKey = %q", resp.IdempotencyKey)
+	}
+	if want := []string{"first", "second", "response"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("hooks ran %v, want %v", order, want)
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2}) || !reflect.DeepEqual(statuses, []int{503, 200}) {
+		t.Errorf("attempt hook saw %v / %v", attempts, statuses)
+	}
+	if want := []string{"custom-key", "custom-key"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys sent = %v, want %v", keys, want)
+	}
+	if want := []string{"corr-1", "corr-1"}; !reflect.DeepEqual(correlation, want) {
+		t.Errorf("X-Correlation-ID = %v, want %v", correlation, want)
+	}
+}
+
+func TestRequestHookClearsIdempotencyKey(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, flakyHandler(1, http.StatusServiceUnavailable, &calls),
+		WithRetry(3, time.Millisecond),
+		WithAutoIdempotency(),
+		WithRequestHook(func(ctx context.Context, req *Request) { req.IdempotencyKey = "" }),
+	)
+	recordSleeps(c)
+
+	if _, err := c.ProxyLLM(context.Background(), llmReq("hi")); err == nil {
+		t.Fatal("expected the 503")
+	}
+	if calls != 1 {
+		t.Errorf("attempts = %d; a call without a key must not be resent", calls)
+	}
+}
+
+func TestRequestHookPanic(t *testing.T) {
+	var calls atomic.Int32
+	panicking := true
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		okLLMResponse(w)
+	}, WithRequestHook(func(ctx context.Context, req *Request) {
+		if panicking {
+			panic("boom")
+		}
+	}))
+
+	_, err := c.ProxyLLM(context.Background(), llmReq("hi"))
+	var hookErr *HookPanicError
+	if !errors.As(err, &hookErr) || hookErr.Value != "boom" || len(hookErr.Stack) == 0 {
+		t.Fatalf("err = %v, want a HookPanicError", err)
+	}
+	if calls.Load() != 0 {
+		t.Error("request sent after its hook panicked")
+	}
+
+	panicking = false
+	if _, err := c.ProxyLLM(context.Background(), llmReq("hi")); err != nil {
+		t.Fatalf("client unusable after a hook panic: %v", err)
+	}
+}
+
+func TestAttemptHookPanicClosesBody(t *testing.T) {
+	var calls int32
+	tracker := &closeTracker{}
+	c := newTestClient(t, flakyHandler(1, http.StatusServiceUnavailable, &calls),
+		WithHTTPClient(&http.Client{Transport: tracker}),
+		WithRetry(3, time.Millisecond),
+		WithAutoIdempotency(),
+		WithAttemptHook(func(ctx context.Context, req *Request, attempt int, resp *http.Response, err error) {
+			panic("attempt hook")
+		}),
+	)
+	recordSleeps(c)
+
+	_, err := c.ProxyLLM(context.Background(), llmReq("hi"))
+	var hookErr *HookPanicError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("err = %v, want a HookPanicError", err)
+	}
+	if calls != 1 {
+		t.Errorf("attempts = %d, want 1", calls)
+	}
+	if opened, closed := tracker.opened.Load(), tracker.closed.Load(); opened != 1 || closed != 1 {
+		t.Errorf("bodies opened %d, closed %d", opened, closed)
+	}
+}
+
+func TestResponseHookPanic(t *testing.T) {
+	tracker := &closeTracker{}
+	var later bool
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) { okLLMResponse(w) },
+		WithHTTPClient(&http.Client{Transport: tracker}),
+		WithResponseHook(func(ctx context.Context, req *Request, resp *ReliAPIResponse, err error) {
+			panic(errors.New("billing down"))
+		}),
+		WithResponseHook(func(ctx context.Context, req *Request, resp *ReliAPIResponse, err error) {
+			later = true
+		}),
+	)
+
+	resp, err := c.ProxyLLM(context.Background(), llmReq("hi"))
+	var hookErr *HookPanicError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("err = %v, want a HookPanicError", err)
+	}
+	if resp == nil || resp.Meta.RequestID != "req_leader" {
+		t.Errorf("response = %+v, want it kept", resp)
+	}
+	if !later {
+		t.Error("hooks after the panicking one did not run")
+	}
+	if opened, closed := tracker.opened.Load(), tracker.closed.Load(); opened != closed {
+		t.Errorf("bodies opened %d, closed %d", opened, closed)
+	}
+}
+
+func TestStreamResponseHook(t *testing.T) {
+	events := []string{
+		"event: meta\ndata: {\"target\": \"openai\", \"request_id\": \"req_stream\"}\n\n",
+		"event: chunk\ndata: {\"delta\": \"Hi\"}\n\n",
+		"event: done\ndata: {\"finish_reason\": \"stop\", \"cost_usd\": 0.001}\n\n",
+	}
+	var seen []*ReliAPIResponse
+	fail := false
+	c := newTestClient(t, sseHandler(t, events, false),
+		WithResponseHook(func(ctx context.Context, req *Request, resp *ReliAPIResponse, err error) {
+			if req.Op != OpProxyLLMStream || err != nil {
+				t.Errorf("hook got %+v, %v", req, err)
+			}
+			seen = append(seen, resp)
+			if fail {
+				panic("boom")
+			}
+		}),
+	)
+
+	s, err := c.ProxyLLMStream(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collect(t, s); !errors.Is(err, io.EOF) {
+		t.Fatal(err)
+	}
+	s.Close()
+	if len(seen) != 1 || seen[0].Meta.RequestID != "req_stream" || *seen[0].Meta.CostUSD != 0.001 {
+		t.Fatalf("hook saw %+v", seen)
+	}
+
+	fail = true
+	s, err = c.ProxyLLMStream(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_, err = collect(t, s)
+	var hookErr *HookPanicError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("err = %v, want the hook panic in place of io.EOF", err)
+	}
+	if len(seen) != 2 {
+		t.Errorf("hook ran %d times, want 2", len(seen))
+	}
+}
+
+func TestBatchHooks(t *testing.T) {
+	var header []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Values("X-Tenant-Tag")
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"results": []map[string]interface{}{
+				{"index": 0, "success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{"request_id": "r0"}},
+				{"index": 1, "success": false, "error": map[string]interface{}{"code": "UPSTREAM_ERROR", "message": "boom"}, "meta": map[string]interface{}{}},
+			},
+			"meta": map[string]interface{}{"total": 2},
+		})
+	},
+		WithRequestHook(func(ctx context.Context, req *Request) {
+			req.Header.Add("X-Tenant-Tag", req.Body.(LLMRequest).Messages[0].Content)
+			req.Header.Add("X-Tenant-Tag", "shared")
+		}),
+		WithResponseHook(func(ctx context.Context, req *Request, resp *ReliAPIResponse, err error) {
+			switch req.Body.(LLMRequest).Messages[0].Content {
+			case "a":
+				if err != nil || resp.Meta.RequestID != "r0" {
+					t.Errorf("item a: %+v, %v", resp, err)
+				}
+			case "b":
+				if !hasCode(err, "UPSTREAM_ERROR") {
+					t.Errorf("item b: err = %v", err)
+				}
+			}
+		}),
+	)
+
+	if _, err := c.ProxyLLMBatch(context.Background(), []LLMRequest{llmReq("a"), llmReq("b")}, BatchOptions{}); !hasCode(err, "UPSTREAM_ERROR") {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "shared", "b"}; !reflect.DeepEqual(header, want) {
+		t.Errorf("X-Tenant-Tag = %v, want %v", header, want)
+	}
+}
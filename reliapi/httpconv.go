@@ -0,0 +1,303 @@
+package reliapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrBinaryBody was returned by FromHTTPRequest for a body that is not
+// valid UTF-8.
+//
+// Deprecated: FromHTTPRequest now carries such bodies in BodyBytes.
+var ErrBinaryBody = errors.New("reliapi: request body is not valid UTF-8")
+
+// hopByHopHeaders only apply to a single connection and are never carried
+// across the proxy. Content-Length is derived from the body.
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+	"Content-Length",
+}
+
+// ToHTTPRequest builds the *http.Request that hr describes when sent to a
+// target at base. hr.Path is joined to base's path; hr.Query is added to
+// base's query, encoded as the proxy would (see HTTPRequest.QueryArrayFormat). The returned
+// request has no context; use WithContext to attach one. A Multipart body
+// is encoded with a boundary of its own and its Content-Type set.
+//
+// Target, TenantID and the idempotency and cache fields have no net/http
+// counterpart and are dropped.
+func ToHTTPRequest(hr HTTPRequest, base *url.URL) (*http.Request, error) {
+	if base == nil {
+		return nil, errors.New("reliapi: ToHTTPRequest: nil base URL")
+	}
+	ref, err := url.Parse(hr.Path)
+	if err != nil {
+		return nil, fmt.Errorf("reliapi: parse path %q: %w", hr.Path, err)
+	}
+	u := *base
+	u.Path = joinURLPath(base.Path, ref.Path)
+	u.RawPath = ""
+	if base.RawPath != "" || ref.RawPath != "" {
+		u.RawPath = joinURLPath(base.EscapedPath(), ref.EscapedPath())
+	}
+	q := base.Query()
+	for name, v := range ref.Query() {
+		q[name] = append(q[name], v...)
+	}
+	query, err := normalizeQuery(hr.Query, hr.QueryArrayFormat)
+	if err != nil {
+		return nil, err
+	}
+	addQuery(q, query)
+	u.RawQuery = q.Encode()
+
+	raw, err := requestBody(hr)
+	if err != nil {
+		return nil, err
+	}
+	contentType := ""
+	if hr.Multipart != nil {
+		if raw, contentType, err = hr.Multipart.encode(); err != nil {
+			return nil, err
+		}
+	}
+	var body io.Reader = http.NoBody
+	if raw != nil {
+		body = bytes.NewReader(raw)
+	}
+	method := hr.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("reliapi: build request: %w", err)
+	}
+	for name, v := range hr.Headers {
+		req.Header.Set(name, v)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	removeHopByHop(req.Header)
+	return req, nil
+}
+
+// FromHTTPRequest describes r as a /proxy/http call to target. Path is r's
+// full escaped path; strip the target's base path first if it has one.
+// Repeated query parameters become []string values and repeated headers are
+// joined with ", " ("; " for Cookie). Hop-by-hop headers and r.Host are
+// dropped; the proxy addresses the target's own host.
+//
+// r.Body is read and replaced, so r can still be sent afterwards. A body
+// that is not valid UTF-8 goes into BodyBytes, others into Body.
+func FromHTTPRequest(r *http.Request, target string) (HTTPRequest, error) {
+	hr := HTTPRequest{Target: target, Method: r.Method, Path: r.URL.EscapedPath()}
+	if hr.Method == "" {
+		hr.Method = http.MethodGet
+	}
+	if hr.Path == "" {
+		hr.Path = "/"
+	}
+	if q := r.URL.Query(); len(q) > 0 {
+		hr.Query = make(map[string]interface{}, len(q))
+		for name, v := range q {
+			if len(v) == 1 {
+				hr.Query[name] = v[0]
+			} else {
+				hr.Query[name] = v
+			}
+		}
+	}
+
+	h := r.Header.Clone()
+	removeHopByHop(h)
+	if len(h) > 0 {
+		hr.Headers = make(map[string]string, len(h))
+		for name, v := range h {
+			sep := ", "
+			if name == "Cookie" {
+				sep = "; "
+			}
+			hr.Headers[name] = strings.Join(v, sep)
+		}
+	}
+
+	if r.Body != nil && r.Body != http.NoBody {
+		raw, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return HTTPRequest{}, fmt.Errorf("reliapi: read request body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(raw))
+		if len(raw) > 0 {
+			if utf8.Valid(raw) {
+				body := string(raw)
+				hr.Body = &body
+			} else {
+				hr.BodyBytes = raw
+			}
+		}
+	}
+	return hr, nil
+}
+
+// ToHTTPResponse rebuilds the upstream response from the {status_code,
+// headers, body} data of a /proxy/http result.
+//
+// The proxy decodes upstream bodies: a JSON body is re-encoded, so its
+// bytes (key order, whitespace) may differ from what the upstream sent, and
+// a non-JSON body comes back as its text. Binary bodies (see
+// Meta.ResponseEncoding) are passed through byte for byte. Content-Length and
+// Content-Encoding no longer describe the rebuilt body and are dropped
+// along with the hop-by-hop headers. A Meta.NotModified result becomes an
+// empty 304 with the headers in Meta.UpstreamHeaders.
+//
+// A Meta.RawPassthrough result keeps the body's bytes exactly, with
+// Meta.UpstreamStatus and the headers in Meta.UpstreamHeaders: send the
+// request with ResponseHeaders ["*"] to rebuild them all.
+func ToHTTPResponse(resp *ReliAPIResponse) (*http.Response, error) {
+	if resp == nil {
+		return nil, errors.New("reliapi: ToHTTPResponse: nil response")
+	}
+	if resp.Meta.NotModified {
+		out := &http.Response{
+			Status:     fmt.Sprintf("%d %s", http.StatusNotModified, http.StatusText(http.StatusNotModified)),
+			StatusCode: http.StatusNotModified,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header, len(resp.Meta.UpstreamHeaders)),
+			Body:       http.NoBody,
+		}
+		for name, v := range resp.Meta.UpstreamHeaders {
+			out.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), v...)
+		}
+		removeHopByHop(out.Header)
+		return out, nil
+	}
+	if resp.Meta.RawPassthrough {
+		return rawHTTPResponse(resp)
+	}
+	var data struct {
+		StatusCode *int              `json:"status_code"`
+		Headers    map[string]string `json:"headers"`
+		Body       json.RawMessage   `json:"body"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil || data.StatusCode == nil {
+		return nil, errors.New("reliapi: data is not a /proxy/http result")
+	}
+
+	body := httpResponseBody(data.Body)
+	if resp.Meta.ResponseEncoding == BodyEncodingBase64 {
+		// Data["body"] is the proxy's base64 string
+		var encoded string
+		if err := json.Unmarshal(data.Body, &encoded); err != nil {
+			return nil, errors.New("reliapi: binary body is not a base64 string")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("reliapi: decode base64 body: %w", err)
+		}
+		body = decoded
+	}
+	out := &http.Response{
+		Status:        fmt.Sprintf("%d %s", *data.StatusCode, http.StatusText(*data.StatusCode)),
+		StatusCode:    *data.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header, len(data.Headers)),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	for name, v := range data.Headers {
+		out.Header.Set(name, v)
+	}
+	removeHopByHop(out.Header)
+	out.Header.Del("Content-Encoding")
+	return out, nil
+}
+
+// rawHTTPResponse is ToHTTPResponse for a Meta.RawPassthrough result.
+func rawHTTPResponse(resp *ReliAPIResponse) (*http.Response, error) {
+	status := resp.Meta.UpstreamStatus
+	if status == 0 {
+		return nil, errors.New("reliapi: data is not a /proxy/http result")
+	}
+	body := resp.RawData()
+	if body == nil {
+		return nil, errors.New("reliapi: binary body is not a base64 string")
+	}
+	out := &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header, len(resp.Meta.UpstreamHeaders)),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	for name, v := range resp.Meta.UpstreamHeaders {
+		out.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), v...)
+	}
+	removeHopByHop(out.Header)
+	out.Header.Del("Content-Length")
+	out.Header.Del("Content-Encoding")
+	return out, nil
+}
+
+// httpResponseBody returns the bytes of a /proxy/http body: the text of the
+// proxy's {"raw": "..."} wrapper for non-JSON responses, an empty body for
+// the {} it reports for empty ones, and the JSON itself otherwise.
+func httpResponseBody(raw json.RawMessage) []byte {
+	var wrapper map[string]json.RawMessage
+	if json.Unmarshal(raw, &wrapper) == nil {
+		if len(wrapper) == 0 {
+			return nil
+		}
+		var text string
+		if v, ok := wrapper["raw"]; ok && len(wrapper) == 1 && json.Unmarshal(v, &text) == nil {
+			return []byte(text)
+		}
+	}
+	if isNull(raw) {
+		return nil
+	}
+	return raw
+}
+
+// removeHopByHop deletes hop-by-hop headers, including those listed in
+// Connection.
+func removeHopByHop(h http.Header) {
+	for _, v := range h["Connection"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+func joinURLPath(base, p string) string {
+	if base == "" || base == "/" {
+		if p == "" || p[0] != '/' {
+			return "/" + p
+		}
+		return p
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(p, "/")
+}
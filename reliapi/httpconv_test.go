@@ -0,0 +1,300 @@
+package reliapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// randomHTTPRequest generates an HTTPRequest in the canonical form
+// FromHTTPRequest produces: canonical header names, string or []string query
+// values, and a nil rather than empty body.
+func randomHTTPRequest(rng *rand.Rand) HTTPRequest {
+	methods := []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"}
+	words := []string{"users", "a b", "ü", "x%2Fy", "50%", "{id}", "v1", "+", "&", "="}
+	word := func() string { return words[rng.Intn(len(words))] }
+
+	hr := HTTPRequest{Target: "api", Method: methods[rng.Intn(len(methods))]}
+	var segs []string
+	for i := rng.Intn(4); i >= 0; i-- {
+		segs = append(segs, url.PathEscape(word()))
+	}
+	hr.Path = "/" + strings.Join(segs, "/")
+
+	if n := rng.Intn(4); n > 0 {
+		hr.Query = map[string]interface{}{}
+		for i := 0; i < n; i++ {
+			name := fmt.Sprintf("%s%d", word(), i)
+			if rng.Intn(2) == 0 {
+				hr.Query[name] = word()
+			} else {
+				hr.Query[name] = []string{word(), word()}
+			}
+		}
+	}
+	if n := rng.Intn(4); n > 0 {
+		hr.Headers = map[string]string{}
+		for i := 0; i < n; i++ {
+			hr.Headers[fmt.Sprintf("X-Test-%d", i)] = strings.TrimSpace(word() + " " + word())
+		}
+	}
+	if rng.Intn(2) == 0 {
+		body := fmt.Sprintf(`{"name":%q}`, word())
+		hr.Body = &body
+	}
+	return hr
+}
+
+func TestHTTPRequestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base, _ := url.Parse("https://api.example.com")
+	for i := 0; i < 500; i++ {
+		want := randomHTTPRequest(rng)
+		req, err := ToHTTPRequest(want, base)
+		if err != nil {
+			t.Fatalf("ToHTTPRequest(%+v): %v", want, err)
+		}
+		if req.URL.Host != "api.example.com" {
+			t.Fatalf("host = %q", req.URL.Host)
+		}
+		got, err := FromHTTPRequest(req, "api")
+		if err != nil {
+			t.Fatalf("FromHTTPRequest: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("round trip changed the request:\n got %#v\nwant %#v", got, want)
+		}
+	}
+}
+
+func TestNetHTTPRequestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	base, _ := url.Parse("https://api.example.com")
+	for i := 0; i < 500; i++ {
+		hr := randomHTTPRequest(rng)
+		want, err := ToHTTPRequest(hr, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantBody := ""
+		if hr.Body != nil {
+			wantBody = *hr.Body
+		}
+		// Hop-by-hop headers are documented exclusions.
+		want.Header.Set("Connection", "keep-alive, X-Hop")
+		want.Header.Set("X-Hop", "1")
+
+		mid, err := FromHTTPRequest(want, "api")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ToHTTPRequest(mid, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Method != want.Method || got.URL.String() != want.URL.String() {
+			t.Fatalf("got %s %s, want %s %s", got.Method, got.URL, want.Method, want.URL)
+		}
+		want.Header.Del("Connection")
+		want.Header.Del("X-Hop")
+		if !reflect.DeepEqual(got.Header, want.Header) {
+			t.Fatalf("headers = %v, want %v", got.Header, want.Header)
+		}
+		gotBody, _ := io.ReadAll(got.Body)
+		if string(gotBody) != wantBody {
+			t.Fatalf("body = %q, want %q", gotBody, wantBody)
+		}
+		// FromHTTPRequest leaves the original body readable.
+		if again, _ := io.ReadAll(want.Body); string(again) != wantBody {
+			t.Fatalf("original body = %q, want %q", again, wantBody)
+		}
+	}
+}
+
+func TestToHTTPRequestBasePath(t *testing.T) {
+	base, _ := url.Parse("https://api.example.com/v2/?key=k")
+	req, err := ToHTTPRequest(HTTPRequest{
+		Method: "GET",
+		Path:   "/items/a%2Fb",
+		Query:  map[string]interface{}{"limit": float64(10), "all": true, "tag": []interface{}{"x", "y"}},
+	}, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "https://api.example.com/v2/items/a%2Fb?all=true&key=k&limit=10&tag=x&tag=y"
+	if req.URL.String() != want {
+		t.Errorf("URL = %s, want %s", req.URL, want)
+	}
+}
+
+func TestFromHTTPRequestBinaryBody(t *testing.T) {
+	req, _ := http.NewRequest("POST", "https://api.example.com/upload", strings.NewReader("\xff\xfe"))
+	hr, err := FromHTTPRequest(req, "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hr.Body != nil || !bytes.Equal(hr.BodyBytes, []byte("\xff\xfe")) {
+		t.Fatalf("Body = %v, BodyBytes = %q", hr.Body, hr.BodyBytes)
+	}
+
+	back, err := ToHTTPRequest(hr, &url.URL{Scheme: "https", Host: "api.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(back.Body); !bytes.Equal(got, []byte("\xff\xfe")) {
+		t.Errorf("rebuilt body = %q", got)
+	}
+}
+
+func TestFromHTTPRequestMultiValueHeaders(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://api.example.com/", nil)
+	req.Header.Add("Accept", "text/html")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Cookie", "a=1")
+	req.Header.Add("Cookie", "b=2")
+	req.Header.Set("Transfer-Encoding", "chunked")
+	hr, err := FromHTTPRequest(req, "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"Accept": "text/html, application/json", "Cookie": "a=1; b=2"}
+	if !reflect.DeepEqual(hr.Headers, want) {
+		t.Errorf("headers = %v, want %v", hr.Headers, want)
+	}
+}
+
+func TestToHTTPResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     interface{}
+		wantCode int
+		wantBody string
+		wantErr  bool
+	}{
+		{
+			name: "json body",
+			data: map[string]interface{}{
+				"status_code": 201,
+				"headers": map[string]interface{}{
+					"content-type":     "application/json",
+					"content-length":   "999",
+					"content-encoding": "gzip",
+					"connection":       "keep-alive",
+					"x-request-id":     "r1",
+				},
+				"body": map[string]interface{}{"id": 7},
+			},
+			wantCode: 201,
+			wantBody: `{"id":7}`,
+		},
+		{
+			name: "text body",
+			data: map[string]interface{}{
+				"status_code": 503,
+				"headers":     map[string]interface{}{"content-type": "text/plain"},
+				"body":        map[string]interface{}{"raw": "upstream down"},
+			},
+			wantCode: 503,
+			wantBody: "upstream down",
+		},
+		{
+			name:     "empty body",
+			data:     map[string]interface{}{"status_code": 204, "headers": map[string]interface{}{}, "body": map[string]interface{}{}},
+			wantCode: 204,
+		},
+		{
+			name:    "llm data",
+			data:    map[string]interface{}{"content": "hi", "finish_reason": "stop"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := ToHTTPResponse(&ReliAPIResponse{Success: true, Data: rawData(t, tt.data)})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantCode || !strings.HasPrefix(resp.Status, fmt.Sprint(tt.wantCode)) {
+				t.Errorf("status = %d %q, want %d", resp.StatusCode, resp.Status, tt.wantCode)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.wantBody || resp.ContentLength != int64(len(tt.wantBody)) {
+				t.Errorf("body = %q (length %d), want %q", body, resp.ContentLength, tt.wantBody)
+			}
+			for _, name := range []string{"Content-Length", "Content-Encoding", "Connection"} {
+				if v := resp.Header.Get(name); v != "" {
+					t.Errorf("%s = %q, want dropped", name, v)
+				}
+			}
+		})
+	}
+
+	resp, err := ToHTTPResponse(&ReliAPIResponse{Data: json.RawMessage(`{"status_code": 200, "headers": {"x-request-id": "r1"}, "body": {}}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("X-Request-Id"); got != "r1" {
+		t.Errorf("X-Request-Id = %q, want r1", got)
+	}
+}
+
+func TestToHTTPResponseNotModified(t *testing.T) {
+	resp, err := ToHTTPResponse(&ReliAPIResponse{
+		Success: true,
+		Data:    json.RawMessage(`{}`),
+		Meta: Meta{
+			NotModified:     true,
+			UpstreamStatus:  http.StatusNotModified,
+			UpstreamHeaders: map[string][]string{"etag": {`W/"v1"`}, "connection": {"close"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotModified || resp.Header.Get("ETag") != `W/"v1"` || resp.Header.Get("Connection") != "" {
+		t.Errorf("response = %d %v", resp.StatusCode, resp.Header)
+	}
+	if body, _ := io.ReadAll(resp.Body); len(body) != 0 {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestToHTTPResponseRaw(t *testing.T) {
+	resp, err := ToHTTPResponse(&ReliAPIResponse{
+		Success: true,
+		Data:    json.RawMessage(`"PHA+aGk8L3A+"`),
+		Meta: Meta{
+			RawPassthrough:   true,
+			ResponseEncoding: BodyEncodingBase64,
+			UpstreamStatus:   http.StatusCreated,
+			UpstreamHeaders:  map[string][]string{"content-type": {"text/html"}, "content-length": {"99"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Content-Type") != "text/html" || resp.Header.Get("Content-Length") != "" {
+		t.Errorf("response = %d %v", resp.StatusCode, resp.Header)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "<p>hi</p>" || resp.ContentLength != 9 {
+		t.Errorf("body = %q (%d)", body, resp.ContentLength)
+	}
+
+	// An LLM response has no upstream status
+	if _, err := ToHTTPResponse(&ReliAPIResponse{Data: json.RawMessage(`{}`), Meta: Meta{RawPassthrough: true}}); err == nil {
+		t.Error("raw response without an upstream status converted")
+	}
+}
@@ -0,0 +1,208 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stream_response metadata headers, set by the proxy instead of a meta
+// envelope.
+const (
+	headerStreamRequestID     = "X-ReliAPI-Request-ID"
+	headerStreamTarget        = "X-ReliAPI-Target"
+	headerStreamCacheHit      = "X-ReliAPI-Cache-Hit"
+	headerStreamRetries       = "X-ReliAPI-Retries"
+	headerStreamDurationMs    = "X-ReliAPI-Duration-Ms"
+	headerStreamTargetVersion = "X-ReliAPI-Target-Version"
+	headerStreamCredential    = "X-ReliAPI-Credential"
+	headerStreamTransforms    = "X-ReliAPI-Transformations"
+
+	headerStreamRateLimitRemaining = "X-ReliAPI-Upstream-RateLimit-Remaining"
+	headerStreamRateLimitReset     = "X-ReliAPI-Upstream-RateLimit-Reset"
+)
+
+// ProxyHTTPStream sends req with StreamResponse set and returns the
+// upstream body as the proxy relays it, so downloads of any size are read
+// without being held in memory. The returned Meta comes from the proxy's
+// X-ReliAPI-* headers and carries the upstream's status and headers in
+// UpstreamStatus and UpstreamHeaders.
+//
+// Retries cover the request up to the upstream's headers; a connection
+// that drops mid-body fails Read with ErrStreamInterrupted. The caller
+// must Close the body. Failures before the upstream answers are returned
+// as *APIError, as from ProxyHTTP.
+//
+// The proxy caches streamed GET/HEAD responses only when the target sets
+// cache.stream_max_bytes and the whole body fits in it. IdempotencyKey and
+// CacheMode are not supported.
+func (c *Client) ProxyHTTPStream(ctx context.Context, req HTTPRequest) (body io.ReadCloser, meta *Meta, err error) {
+	ctx, in := c.instrument(ctx, OpProxyHTTPStream, req.Target)
+	var hr *Request
+	defer func() {
+		if err != nil {
+			err = c.endHooks(ctx, hr, nil, err)
+			in.end(nil, err)
+		}
+	}()
+	if err = c.requireFeature(FeatureHTTPStream); err != nil {
+		return nil, nil, err
+	}
+	ctx, err = c.tenantContext(ctx, req.TenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.Tags, err = c.withTags(req.Tags); err != nil {
+		return nil, nil, err
+	}
+	req, err = withEncodedBody(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = normalizeQuery(req.Query, req.QueryArrayFormat); err != nil {
+		return nil, nil, err
+	}
+	if req.IdempotencyKey != nil || req.CacheMode != "" {
+		return nil, nil, errors.New("reliapi: ProxyHTTPStream does not support IdempotencyKey or CacheMode")
+	}
+	req.StreamResponse = true
+	req.TimeoutMs = contextTimeoutMs(ctx, req.TimeoutMs)
+	if hr, err = c.startHooks(ctx, OpProxyHTTPStream, req.Target, &req.IdempotencyKey, req); err != nil {
+		return nil, nil, err
+	}
+
+	payload, err := req.encodePayload()
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.send(withHookRequest(ctx, hr), http.MethodPost, httpProxyPath, payload, "*/*", isIdempotentHTTP(req))
+	if err != nil {
+		return nil, nil, contextError(ctx, err)
+	}
+	if resp.Header.Get(headerStreamRequestID) == "" {
+		// Without its metadata headers the response is the proxy's own JSON
+		// envelope, produced before the upstream answered.
+		defer drainAndClose(resp.Body)
+		raw, _ := c.readBody(resp.Body)
+		err = newAPIError(resp, raw)
+		if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			// A proxy without stream_response answers with the envelope
+			err = c.unsupported(ctx, FeatureHTTPStream, err)
+		}
+		return nil, nil, err
+	}
+
+	s := &httpStream{
+		ctx:        ctx,
+		body:       resp.Body,
+		meta:       streamedMeta(resp),
+		client:     c,
+		hookReq:    hr,
+		instrument: in,
+	}
+	// As with Stream, closing the body on cancellation unblocks a pending
+	// Read immediately.
+	s.stopCancel = context.AfterFunc(ctx, func() { s.body.Close() })
+	return s, s.meta, nil
+}
+
+// streamedMeta reads the metadata of a stream_response reply.
+func streamedMeta(resp *http.Response) *Meta {
+	h := resp.Header
+	meta := &Meta{
+		RequestID:       h.Get(headerStreamRequestID),
+		Target:          h.Get(headerStreamTarget),
+		CacheHit:        h.Get(headerStreamCacheHit) == "true",
+		CredentialName:  h.Get(headerStreamCredential),
+		FaultInjected:   h.Get(FaultInjectedHeader),
+		UpstreamStatus:  resp.StatusCode,
+		UpstreamHeaders: make(map[string][]string, len(h)),
+	}
+	meta.Retries, _ = strconv.Atoi(h.Get(headerStreamRetries))
+	meta.DurationMs, _ = strconv.Atoi(h.Get(headerStreamDurationMs))
+	meta.TargetVersion, _ = strconv.Atoi(h.Get(headerStreamTargetVersion))
+	if applied := h.Get(headerStreamTransforms); applied != "" {
+		meta.TransformationsApplied = strings.Split(applied, ",")
+	}
+	if remaining, err := strconv.Atoi(h.Get(headerStreamRateLimitRemaining)); err == nil {
+		resetAt, _ := time.Parse(time.RFC3339, h.Get(headerStreamRateLimitReset))
+		meta.UpstreamRateLimit = &UpstreamRateLimit{Remaining: remaining, ResetAt: resetAt}
+	}
+	for k, v := range h {
+		if !strings.HasPrefix(k, "X-Reliapi-") {
+			meta.UpstreamHeaders[strings.ToLower(k)] = v
+		}
+	}
+	return meta
+}
+
+// httpStream is the body returned by ProxyHTTPStream. It ends the call's
+// hooks, metrics and span when the body is exhausted, fails or is closed.
+type httpStream struct {
+	ctx        context.Context
+	body       io.ReadCloser
+	stopCancel func() bool
+	meta       *Meta
+
+	client     *Client
+	hookReq    *Request
+	instrument *callInstrument
+	closer     sync.Once
+	finisher   sync.Once
+}
+
+func (s *httpStream) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF):
+		if panicErr := s.finish(nil); panicErr != nil {
+			return n, panicErr
+		}
+	default:
+		if ctxErr := s.ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		} else {
+			err = fmt.Errorf("%w: %w", ErrStreamInterrupted, err)
+		}
+		if panicErr := s.finish(err); panicErr != nil {
+			err = errors.Join(err, panicErr)
+		}
+	}
+	return n, err
+}
+
+// Close releases the underlying connection. It is safe to call more than
+// once.
+func (s *httpStream) Close() error {
+	var err error
+	s.closer.Do(func() {
+		s.stopCancel()
+		err = s.body.Close()
+	})
+	if panicErr := s.finish(context.Canceled); panicErr != nil && err == nil {
+		err = panicErr
+	}
+	return err
+}
+
+// finish runs the call's response hooks and ends its metrics and span,
+// once, with the outcome err. It returns the error of a panicking response
+// hook.
+func (s *httpStream) finish(err error) error {
+	var panicErr error
+	s.finisher.Do(func() {
+		if s.hookReq != nil {
+			resp := &ReliAPIResponse{Success: err == nil, Meta: *s.meta}
+			panicErr = s.client.runResponseHooks(s.ctx, s.hookReq, resp, err)
+		}
+		s.instrument.end(s.meta, joinHookPanic(err, panicErr))
+	})
+	return panicErr
+}
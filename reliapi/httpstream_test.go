@@ -0,0 +1,140 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"runtime"
+	"testing"
+)
+
+func TestProxyHTTPStreamLargeBody(t *testing.T) {
+	const size = 100 << 20
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body["stream_response"] != true {
+			t.Errorf("stream_response = %v", body["stream_response"])
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-ReliAPI-Request-ID", "req_big")
+		w.Header().Set("X-ReliAPI-Target", "files")
+		w.Header().Set("X-ReliAPI-Cache-Hit", "false")
+		w.Header().Set("X-ReliAPI-Retries", "1")
+		w.Header().Set("X-ReliAPI-Duration-Ms", "42")
+		w.Header().Set("X-ReliAPI-Target-Version", "3")
+		w.Header().Set("X-ReliAPI-Credential", "org-a")
+		w.Header().Set("X-ReliAPI-Transformations", "header:X-Org,path_prefix")
+		w.Header().Set("X-ReliAPI-Upstream-RateLimit-Remaining", "7")
+		w.Header().Set("X-ReliAPI-Upstream-RateLimit-Reset", "2026-10-14T12:01:00.500000+00:00")
+		w.WriteHeader(http.StatusPartialContent)
+		chunk := make([]byte, 64<<10)
+		for sent := 0; sent < size; sent += len(chunk) {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	})
+
+	body, meta, err := c.ProxyHTTPStream(context.Background(), HTTPRequest{Target: "files", Method: "GET", Path: "/dump"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if meta.RequestID != "req_big" || meta.Target != "files" || meta.CacheHit || meta.Retries != 1 ||
+		meta.DurationMs != 42 || meta.TargetVersion != 3 || meta.UpstreamStatus != http.StatusPartialContent ||
+		meta.CredentialName != "org-a" || len(meta.TransformationsApplied) != 2 ||
+		meta.TransformationsApplied[1] != "path_prefix" {
+		t.Errorf("meta = %+v", meta)
+	}
+	if rl := meta.UpstreamRateLimit; rl == nil || rl.Remaining != 7 || rl.ResetAt.Nanosecond() != 5e8 {
+		t.Errorf("UpstreamRateLimit = %+v", rl)
+	}
+	if ct := meta.UpstreamHeaders["content-type"]; len(ct) != 1 || ct[0] != "application/octet-stream" {
+		t.Errorf("upstream Content-Type = %q", ct)
+	}
+	if _, ok := meta.UpstreamHeaders["x-reliapi-request-id"]; ok {
+		t.Error("proxy metadata headers leaked into UpstreamHeader")
+	}
+
+	// The heap must stay near its starting size while the body streams
+	// through, rather than grow with it.
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	base := stats.HeapAlloc
+	var read, peak uint64
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := body.Read(buf)
+		read += uint64(n)
+		if read%(8<<20) < uint64(n) {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > peak {
+				peak = stats.HeapAlloc
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if read != size {
+		t.Fatalf("read %d bytes, want %d", read, size)
+	}
+	if peak > base+16<<20 {
+		t.Errorf("heap grew from %d to %d bytes while streaming", base, peak)
+	}
+}
+
+func TestProxyHTTPStreamError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"type": "upstream_error", "code": "SERVER_ERROR", "status_code": 503,
+				"message": "Upstream returned 503", "retryable": true,
+			},
+			"meta": map[string]interface{}{"request_id": "req_err"},
+		})
+	}, WithRetry(1, 0))
+
+	_, _, err := c.ProxyHTTPStream(context.Background(), HTTPRequest{Target: "files", Method: "GET", Path: "/"})
+	if !hasCode(err, CodeServerError) {
+		t.Fatalf("err = %v", err)
+	}
+
+	_, _, err = c.ProxyHTTPStream(context.Background(), HTTPRequest{Target: "files", Method: "GET", Path: "/", CacheMode: CacheStaleIfError})
+	if err == nil {
+		t.Error("expected an error for a CacheMode")
+	}
+}
+
+func TestProxyHTTPStreamHooks(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-ReliAPI-Request-ID", "req_h")
+		_, _ = w.Write([]byte("partial"))
+	}, WithResponseHook(func(ctx context.Context, req *Request, resp *ReliAPIResponse, err error) {
+		if req.Op != OpProxyHTTPStream || resp.Meta.RequestID != "req_h" || err != nil {
+			t.Errorf("op %s, meta %+v, err %v", req.Op, resp.Meta, err)
+		}
+	}))
+
+	body, _, err := c.ProxyHTTPStream(context.Background(), HTTPRequest{Target: "files", Method: "GET", Path: "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(body)
+	if err != nil || string(got) != "partial" {
+		t.Fatalf("body %q, err %v", got, err)
+	}
+	if err := body.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
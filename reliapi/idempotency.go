@@ -0,0 +1,187 @@
+package reliapi
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type idempotencyMode int
+
+const (
+	idempotencyManual idempotencyMode = iota
+	idempotencyRandom
+	idempotencyDeterministic
+)
+
+// WithAutoIdempotency makes the client attach a random UUIDv4 idempotency
+// key to every request that does not already carry one.
+func WithAutoIdempotency() Option {
+	return func(c *Client) {
+		c.idempotency = idempotencyRandom
+	}
+}
+
+// WithDeterministicIdempotency makes the client derive missing idempotency
+// keys from a SHA-256 hash of the request body, so identical requests share
+// a key even across process restarts.
+func WithDeterministicIdempotency() Option {
+	return func(c *Client) {
+		c.idempotency = idempotencyDeterministic
+	}
+}
+
+// WithIdempotencyKeyHook registers fn to be called with every generated
+// idempotency key before the request is sent, so callers can persist it for
+// retries. fn is not called for keys set explicitly on the request.
+func WithIdempotencyKeyHook(fn func(key string)) Option {
+	return func(c *Client) {
+		c.onIdempotencyKey = fn
+	}
+}
+
+// WithDefaultIdempotencyTTL sets the IdempotencyTTL of requests that
+// carry an idempotency key but no IdempotencyTTL, rounded up to whole
+// seconds. Without it the proxy keeps keys as long as the response's cache
+// entry.
+func WithDefaultIdempotencyTTL(d time.Duration) Option {
+	return func(c *Client) {
+		c.idempotencyTTL = d
+	}
+}
+
+// IdempotencyConflict is the detail of an IDEMPOTENCY_CONFLICT error: the
+// request reused an idempotency key with a different body. The proxy
+// compares JSON bodies in canonical form, so whitespace and key order
+// never conflict.
+type IdempotencyConflict struct {
+	// ExistingRequestID is the request the key was first used with.
+	ExistingRequestID string `json:"existing_request_id"`
+}
+
+// IsIdempotencyConflict reports whether err is a proxy rejection of an
+// idempotency key reused with a different request. Such requests are
+// never answered with the earlier response.
+func IsIdempotencyConflict(err error) bool {
+	return hasCode(err, CodeIdempotencyConflict)
+}
+
+// AsIdempotencyConflict returns the details of an IDEMPOTENCY_CONFLICT
+// error. It reports false for other errors.
+func AsIdempotencyConflict(err error) (*IdempotencyConflict, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !IsIdempotencyConflict(apiErr) {
+		return nil, false
+	}
+	raw, _ := json.Marshal(apiErr.Details)
+	var c IdempotencyConflict
+	_ = json.Unmarshal(raw, &c)
+	return &c, true
+}
+
+// applyIdempotency fills *key according to the client's idempotency mode and
+// returns the key that will be sent ("" if none). body is the request as it
+// will be encoded, without the key. resend reports whether WithRetry could
+// send the request again if it had a key; it then gets a random one in any
+// mode, before its first attempt, so every attempt carries the same key
+// and a retry of a request that already ran is answered with its response
+// instead of running, and being charged for, twice.
+func (c *Client) applyIdempotency(key **string, body interface{}, resend bool) (string, error) {
+	return c.applyIdempotencyMode(c.idempotency, key, body, resend)
+}
+
+func (c *Client) applyIdempotencyMode(mode idempotencyMode, key **string, body interface{}, resend bool) (string, error) {
+	if *key != nil {
+		return **key, nil
+	}
+
+	var generated string
+	switch {
+	case mode == idempotencyDeterministic:
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return "", fmt.Errorf("reliapi: encode request: %w", err)
+		}
+		sum := sha256.Sum256(payload)
+		generated = "sha256-" + hex.EncodeToString(sum[:])
+	case mode == idempotencyRandom || resend && (c.retry.maxAttempts > 1 || c.rateQueue != nil):
+		id, err := newUUIDv4()
+		if err != nil {
+			return "", err
+		}
+		generated = id
+	default:
+		return "", nil
+	}
+
+	*key = &generated
+	if c.onIdempotencyKey != nil {
+		c.onIdempotencyKey(generated)
+	}
+	return generated, nil
+}
+
+// IdempotencyKeyOf returns the idempotency key a failed request was sent
+// with, including one the client generated, or "" if it had none. Sending
+// the request again with it has the proxy answer with the response of an
+// attempt that reached the upstream rather than run it again.
+func IdempotencyKeyOf(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.IdempotencyKey != "" {
+		return apiErr.IdempotencyKey
+	}
+	var keyed *idempotentError
+	if errors.As(err, &keyed) {
+		return keyed.key
+	}
+	return ""
+}
+
+// idempotentError is a failure that came with no *APIError, such as a
+// timeout, of a request sent with an idempotency key.
+type idempotentError struct {
+	err error
+	key string
+}
+
+func (e *idempotentError) Error() string { return e.err.Error() }
+func (e *idempotentError) Unwrap() error { return e.err }
+
+// withIdempotencyKey records key, the idempotency key of the request that
+// failed with err, for IdempotencyKeyOf.
+func withIdempotencyKey(err error, key string) error {
+	if err == nil || key == "" {
+		return err
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		apiErr.IdempotencyKey = key
+		return err
+	}
+	return &idempotentError{err: err, key: key}
+}
+
+// idempotencyTTLSeconds returns ttl, or the client's default TTL when ttl
+// is nil and the request sends an idempotency key.
+func (c *Client) idempotencyTTLSeconds(key string, ttl *int) *int {
+	if ttl != nil || key == "" || c.idempotencyTTL <= 0 {
+		return ttl
+	}
+	s := int((c.idempotencyTTL + time.Second - 1) / time.Second)
+	return &s
+}
+
+// newUUIDv4 returns a random RFC 4122 version 4 UUID.
+func newUUIDv4() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("reliapi: generate idempotency key: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
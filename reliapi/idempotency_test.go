@@ -0,0 +1,287 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// keyRecorder is a handler that records the idempotency_key of each request.
+type keyRecorder struct {
+	mu   sync.Mutex
+	keys []interface{}
+}
+
+func (k *keyRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	k.mu.Lock()
+	k.keys = append(k.keys, body["idempotency_key"])
+	k.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{}})
+}
+
+func llmReq(content string) LLMRequest {
+	return LLMRequest{Target: "openai", Model: "gpt-4o-mini", Messages: []ChatMessage{UserMessage(content)}}
+}
+
+func TestAutoIdempotencyGeneratesUniqueKeys(t *testing.T) {
+	rec := &keyRecorder{}
+	c := newTestClient(t, rec.ServeHTTP, WithAutoIdempotency())
+
+	r1, err := c.ProxyLLM(context.Background(), llmReq("same"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := c.ProxyLLM(context.Background(), llmReq("same"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !uuidV4.MatchString(r1.IdempotencyKey) {
+		t.Errorf("key %q is not a UUIDv4", r1.IdempotencyKey)
+	}
+	if r1.IdempotencyKey == r2.IdempotencyKey {
+		t.Errorf("random keys collided: %q", r1.IdempotencyKey)
+	}
+	if rec.keys[0] != r1.IdempotencyKey || rec.keys[1] != r2.IdempotencyKey {
+		t.Errorf("sent keys %v do not match returned keys", rec.keys)
+	}
+}
+
+func TestDeterministicIdempotency(t *testing.T) {
+	rec := &keyRecorder{}
+	var hooked []string
+	c := newTestClient(t, rec.ServeHTTP,
+		WithDeterministicIdempotency(),
+		WithIdempotencyKeyHook(func(key string) { hooked = append(hooked, key) }),
+	)
+	ctx := context.Background()
+
+	a, _ := c.ProxyLLM(ctx, llmReq("same"))
+	b, _ := c.ProxyLLM(ctx, llmReq("same"))
+	d, _ := c.ProxyLLM(ctx, llmReq("different"))
+	h, _ := c.ProxyHTTP(ctx, HTTPRequest{Target: "payments", Method: "POST", Path: "/charges"})
+
+	if a.IdempotencyKey == "" || a.IdempotencyKey != b.IdempotencyKey {
+		t.Errorf("identical bodies produced keys %q and %q", a.IdempotencyKey, b.IdempotencyKey)
+	}
+	if a.IdempotencyKey == d.IdempotencyKey {
+		t.Errorf("different bodies produced the same key %q", a.IdempotencyKey)
+	}
+	if h.IdempotencyKey == "" {
+		t.Error("HTTP request did not get a key")
+	}
+	if len(hooked) != 4 || hooked[0] != a.IdempotencyKey {
+		t.Errorf("hook saw %v", hooked)
+	}
+}
+
+func TestExplicitIdempotencyKeyWins(t *testing.T) {
+	rec := &keyRecorder{}
+	hookCalled := false
+	c := newTestClient(t, rec.ServeHTTP,
+		WithAutoIdempotency(),
+		WithIdempotencyKeyHook(func(string) { hookCalled = true }),
+	)
+
+	key := "order-42"
+	req := llmReq("hi")
+	req.IdempotencyKey = &key
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.IdempotencyKey != key || rec.keys[0] != key {
+		t.Errorf("explicit key replaced: resp=%q sent=%v", resp.IdempotencyKey, rec.keys[0])
+	}
+	if hookCalled {
+		t.Error("hook called for an explicit key")
+	}
+}
+
+func TestDefaultIdempotencyTTL(t *testing.T) {
+	var sent []interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		sent = append(sent, body["idempotency_ttl_s"])
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{}})
+	}, WithDefaultIdempotencyTTL(10*time.Minute))
+
+	key := "chat-1"
+	req := llmReq("hi")
+	req.IdempotencyKey = &key
+	week := 7 * 24 * 3600
+	payment := HTTPRequest{Target: "payments", Method: http.MethodPost, Path: "/charges", IdempotencyKey: &key, IdempotencyTTL: &week}
+	for _, call := range []func() error{
+		func() error { _, err := c.ProxyLLM(context.Background(), req); return err },
+		func() error { _, err := c.ProxyHTTP(context.Background(), payment); return err },
+		func() error { _, err := c.ProxyLLM(context.Background(), llmReq("no key")); return err },
+	} {
+		if err := call(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The default applies to keyed requests without their own TTL only
+	if len(sent) != 3 || sent[0] != float64(600) || sent[1] != float64(week) || sent[2] != nil {
+		t.Errorf("idempotency_ttl_s sent = %v", sent)
+	}
+}
+
+func TestNoIdempotencyByDefault(t *testing.T) {
+	rec := &keyRecorder{}
+	c := newTestClient(t, rec.ServeHTTP)
+
+	resp, err := c.ProxyLLM(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.IdempotencyKey != "" || rec.keys[0] != nil {
+		t.Errorf("unexpected key: resp=%q sent=%v", resp.IdempotencyKey, rec.keys[0])
+	}
+}
+
+func TestIdempotencyConflictAndReplayMeta(t *testing.T) {
+	conflict := true
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if conflict {
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"success": false,
+				"error": map[string]interface{}{
+					"type": "idempotency_conflict", "code": CodeIdempotencyConflict, "status_code": 409,
+					"message": "Idempotency key 'k' used with different request",
+					"details": map[string]interface{}{"existing_request_id": "req_first"},
+				},
+				"meta": map[string]interface{}{"request_id": "req_second"},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "hi"},
+			"meta": map[string]interface{}{
+				"request_id": "req_third", "idempotent_hit": true,
+				"idempotency_first_seen_at": "2026-10-14T09:30:00.25Z", "idempotency_replay_count": 4,
+			},
+		})
+	})
+	key := "k"
+	req := llmReq("hello")
+	req.IdempotencyKey = &key
+
+	_, err := c.ProxyLLM(context.Background(), req)
+	got, ok := AsIdempotencyConflict(err)
+	if !ok || got.ExistingRequestID != "req_first" || !IsIdempotencyConflict(err) {
+		t.Fatalf("AsIdempotencyConflict(%v) = %+v, %v", err, got, ok)
+	}
+	if _, ok := AsIdempotencyConflict(errors.New("other")); ok {
+		t.Error("AsIdempotencyConflict matched a plain error")
+	}
+
+	conflict = false
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2026, 10, 14, 9, 30, 0, 250e6, time.UTC)
+	if !resp.Meta.IdempotencyFirstSeenAt.Equal(want) || resp.Meta.IdempotencyReplayCount != 4 {
+		t.Errorf("meta = %v, %d", resp.Meta.IdempotencyFirstSeenAt, resp.Meta.IdempotencyReplayCount)
+	}
+}
+
+// TestRetryAfterTimeoutIsNotChargedTwice simulates a proxy whose upstream
+// call succeeded but whose answer never reached the client before its
+// timeout: the retry must carry the first attempt's key and be answered
+// from the proxy's idempotency store.
+func TestRetryAfterTimeoutIsNotChargedTwice(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		executed  int
+		attempts  int
+		responses = map[string]map[string]interface{}{}
+	)
+	var hooked []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			IdempotencyKey *string `json:"idempotency_key"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.IdempotencyKey == nil {
+			t.Error("request sent without an idempotency key")
+			return
+		}
+		mu.Lock()
+		attempts++
+		stored, hit := responses[*body.IdempotencyKey]
+		if !hit {
+			executed++
+			stored = map[string]interface{}{"content": "charged once"}
+			responses[*body.IdempotencyKey] = stored
+		}
+		mu.Unlock()
+		if !hit {
+			// The upstream ran; the answer is lost to the client's timeout
+			<-r.Context().Done()
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    stored,
+			"meta":    map[string]interface{}{"request_id": "req_2", "idempotent_hit": true},
+		})
+	}, WithHTTPClient(&http.Client{Timeout: 50 * time.Millisecond}), WithRetry(3, time.Millisecond),
+		WithIdempotencyKeyHook(func(key string) { hooked = append(hooked, key) }))
+	recordSleeps(c)
+
+	resp, err := c.ProxyLLM(context.Background(), llmReq("charge me"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Meta.IdempotentHit || resp.DataMap()["content"] != "charged once" {
+		t.Errorf("resp = %+v", resp)
+	}
+	if executed != 1 || attempts != 2 {
+		t.Errorf("upstream executions = %d over %d attempts, want 1 over 2", executed, attempts)
+	}
+	if !uuidV4.MatchString(resp.IdempotencyKey) || len(hooked) != 1 || hooked[0] != resp.IdempotencyKey {
+		t.Errorf("IdempotencyKey = %q, hooked %q", resp.IdempotencyKey, hooked)
+	}
+}
+
+func TestIdempotencyKeyOfError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// Read, so the server notices the client hanging up
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}, WithHTTPClient(&http.Client{Timeout: 20 * time.Millisecond}), WithRetry(2, time.Millisecond))
+	recordSleeps(c)
+	_, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: http.MethodPost, Path: "/charges"})
+	if err == nil || !uuidV4.MatchString(IdempotencyKeyOf(err)) {
+		t.Fatalf("err = %v, key = %q", err, IdempotencyKeyOf(err))
+	}
+
+	api := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"success": false, "error": map[string]interface{}{
+			"type": "client_error", "code": "INVALID_REQUEST", "message": "no", "status_code": 400,
+		}})
+	})
+	key := "charge-1"
+	req := llmReq("hi")
+	req.IdempotencyKey = &key
+	_, err = api.ProxyLLM(context.Background(), req)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.IdempotencyKey != key || IdempotencyKeyOf(err) != key {
+		t.Errorf("err = %#v", err)
+	}
+	if IdempotencyKeyOf(errors.New("other")) != "" {
+		t.Error("key of an unrelated error")
+	}
+}
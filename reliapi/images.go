@@ -0,0 +1,106 @@
+package reliapi
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxImageBytes is the default limit on the decoded size of a base64
+// image, Anthropic's per-image limit.
+const DefaultMaxImageBytes = 5 << 20
+
+// ErrImageTooLarge is returned for an LLMRequest holding a base64 image
+// larger than the client's limit (see WithMaxImageBytes).
+var ErrImageTooLarge = errors.New("reliapi: image too large")
+
+// WithMaxImageBytes sets the largest decoded size of a base64 image the
+// client sends; requests with a larger one fail with ErrImageTooLarge before
+// anything is sent. The default is DefaultMaxImageBytes, and 0 or less
+// removes the limit. Images referenced by URL are not checked.
+func WithMaxImageBytes(n int) Option {
+	return func(c *Client) {
+		c.maxImageBytes = n
+	}
+}
+
+// ImageBase64Part returns an image content part holding data, an image of
+// mediaType such as "image/png", as a base64 data URL.
+func ImageBase64Part(mediaType string, data []byte) ContentPart {
+	return ImageURLPart("data:"+mediaType+";base64,"+base64.StdEncoding.EncodeToString(data), "")
+}
+
+// decodeDataURL returns the media type and bytes of a base64 data URL. ok
+// is false for other URLs. Padding is optional, so encodings that differ
+// only in padding decode to the same bytes.
+func decodeDataURL(url string) (mediaType string, data []byte, ok bool, err error) {
+	rest := strings.TrimPrefix(url, "data:")
+	if len(rest) == len(url) {
+		return "", nil, false, nil
+	}
+	i := strings.Index(rest, ";base64,")
+	if i < 0 {
+		return "", nil, false, nil
+	}
+	encoded := strings.TrimRight(rest[i+len(";base64,"):], "=")
+	data, err = base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, true, fmt.Errorf("reliapi: invalid base64 image: %w", err)
+	}
+	return rest[:i], data, true, nil
+}
+
+// checkImages rejects messages holding an invalid base64 image or one
+// larger than the client's limit.
+func (c *Client) checkImages(messages []ChatMessage) error {
+	for i, m := range messages {
+		for j, p := range m.Parts {
+			if p.ImageURL == nil {
+				continue
+			}
+			_, data, ok, err := decodeDataURL(p.ImageURL.URL)
+			if err != nil {
+				return fmt.Errorf("reliapi: messages[%d] part %d: %w", i, j, err)
+			}
+			if ok && c.maxImageBytes > 0 && len(data) > c.maxImageBytes {
+				return fmt.Errorf("%w: messages[%d] part %d is %d bytes, the limit is %d",
+					ErrImageTooLarge, i, j, len(data), c.maxImageBytes)
+			}
+		}
+	}
+	return nil
+}
+
+// cacheMessages returns messages with each base64 image replaced by a hash
+// of its bytes, as the proxy does when deriving cache keys, so encodings of
+// the same image share a key. messages is not modified.
+func cacheMessages(messages []ChatMessage) []ChatMessage {
+	out, cloned := messages, false
+	for i, m := range messages {
+		copied := false
+		for j, p := range m.Parts {
+			if p.ImageURL == nil {
+				continue
+			}
+			mediaType, data, ok, err := decodeDataURL(p.ImageURL.URL)
+			if !ok || err != nil {
+				continue
+			}
+			if !copied {
+				if !cloned {
+					out, cloned = append([]ChatMessage(nil), messages...), true
+				}
+				out[i].Parts = append([]ContentPart(nil), m.Parts...)
+				copied = true
+			}
+			sum := sha256.Sum256(data)
+			image := *p.ImageURL
+			image.URL = "data:" + mediaType + ";sha256:" + hex.EncodeToString(sum[:])
+			out[i].Parts[j].ImageURL = &image
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pngHeader is the first 13 bytes of a PNG; its base64 ends in "==".
+var pngHeader = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0x0d, 'I'}
+
+func multimodalRequest(image ContentPart) LLMRequest {
+	return LLMRequest{
+		Target: "openai",
+		Model:  "gpt-4o-mini",
+		Messages: []ChatMessage{{Role: RoleUser, Parts: []ContentPart{
+			TextPart("Which of these is the logo?"),
+			ImageURLPart("https://example.com/logo.png", "low"),
+			image,
+		}}},
+	}
+}
+
+func TestProxyLLMSendsImageParts(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "multimodal_request.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		assertSameJSON(t, got, want)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"content": "the second"}})
+	})
+
+	if _, err := c.ProxyLLM(context.Background(), multimodalRequest(ImageBase64Part("image/png", pngHeader))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImageSizeLimit(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request with an oversized image was sent")
+	}, WithMaxImageBytes(len(pngHeader)-1))
+
+	req := multimodalRequest(ImageBase64Part("image/png", pngHeader))
+	_, err := c.ProxyLLM(context.Background(), req)
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("ProxyLLM err = %v, want ErrImageTooLarge", err)
+	}
+	if _, err := c.ProxyLLMStream(context.Background(), req); !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("ProxyLLMStream err = %v, want ErrImageTooLarge", err)
+	}
+	if _, err := c.ProxyLLMBatch(context.Background(), []LLMRequest{req}, BatchOptions{}); !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("ProxyLLMBatch err = %v, want ErrImageTooLarge", err)
+	}
+
+	req.Messages[0].Parts[2].ImageURL.URL = "data:image/png;base64,not base64!"
+	if _, err := c.ProxyLLM(context.Background(), req); err == nil || errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("invalid base64: err = %v", err)
+	}
+}
+
+func TestCoalesceKeyHashesImageBytes(t *testing.T) {
+	c, err := NewClient("", "k", WithCoalescing(ShareLeaderError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded := multimodalRequest(ImageBase64Part("image/png", pngHeader))
+	unpadded := multimodalRequest(ImageURLPart("data:image/png;base64,iVBORw0KGgoAAAANSQ", ""))
+	other := multimodalRequest(ImageBase64Part("image/png", pngHeader[:12]))
+
+	keyPadded, _ := c.llmCoalesceKey(padded)
+	keyUnpadded, _ := c.llmCoalesceKey(unpadded)
+	keyOther, _ := c.llmCoalesceKey(other)
+	if keyPadded != keyUnpadded {
+		t.Error("encodings differing only in padding have different keys")
+	}
+	if keyPadded == keyOther {
+		t.Error("different images share a key")
+	}
+	if got := padded.Messages[0].Parts[2].ImageURL.URL; got != "data:image/png;base64,iVBORw0KGgoAAAANSQ==" {
+		t.Errorf("request modified: %s", got)
+	}
+}
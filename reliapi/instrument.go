@@ -0,0 +1,148 @@
+package reliapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// callInstrument follows one logical proxy call for WithMetrics,
+// WithTracing and WithLogger. It is nil when none is configured; its
+// methods do nothing then, so uninstrumented clients pay for a nil check
+// only.
+type callInstrument struct {
+	c      *Client
+	ctx    context.Context
+	target string
+	method string
+	start  time.Time
+	span   trace.Span
+
+	// For WithLogger: HTTP requests sent, and the messages of an LLM call
+	// under WithLogPrompts
+	attempts int
+	messages []ChatMessage
+}
+
+type callInstrumentKey struct{}
+
+// instrument starts following a call of method to target. The returned
+// context carries the call's span and lets send record its attempts.
+func (c *Client) instrument(ctx context.Context, method, target string) (context.Context, *callInstrument) {
+	if !c.instrumented() {
+		return ctx, nil
+	}
+	in := &callInstrument{c: c, target: target, method: method, start: time.Now()}
+	if c.tracer != nil {
+		ctx, in.span = c.startSpan(ctx, method, target)
+	}
+	in.ctx = context.WithValue(ctx, callInstrumentKey{}, in)
+	return in.ctx, in
+}
+
+func (c *Client) instrumented() bool {
+	return c.metrics != nil || c.tracer != nil || c.logger != nil
+}
+
+// instrumentFrom returns the call ctx belongs to. Requests outside the
+// proxy endpoints (cache, budget, circuit) have none.
+func (c *Client) instrumentFrom(ctx context.Context) *callInstrument {
+	if !c.instrumented() {
+		return nil
+	}
+	in, _ := ctx.Value(callInstrumentKey{}).(*callInstrument)
+	return in
+}
+
+// attempt records the n-th HTTP request sent for the call.
+func (in *callInstrument) attempt(n int, resp *http.Response, err error) {
+	if in == nil {
+		return
+	}
+	if in.c.metrics != nil {
+		in.c.metrics.attempt(in.target, in.method, resp, err)
+	}
+	if in.span != nil {
+		attemptEvent(in.span, n, resp, err)
+	}
+	if in.c.logger != nil {
+		in.attempts++
+		in.logAttempt(n, resp, err)
+	}
+}
+
+// end records the outcome of the call. meta is nil when the call produced
+// no response.
+func (in *callInstrument) end(meta *Meta, err error) {
+	if in == nil {
+		return
+	}
+	if in.c.metrics != nil {
+		in.c.metrics.observe(in.target, in.method, in.start, meta, err)
+	}
+	if in.span != nil {
+		endSpan(in.span, meta, err)
+	}
+	if in.c.logger != nil {
+		in.logRequest(in.target, meta, err)
+	}
+}
+
+// endResponse is end for the named results of a proxy method, for use in a
+// defer.
+func (in *callInstrument) endResponse(resp **ReliAPIResponse, err *error) {
+	if in == nil {
+		return
+	}
+	var meta *Meta
+	if *resp != nil {
+		meta = &(*resp).Meta
+	}
+	in.end(meta, *err)
+}
+
+// endBatch records a batch call. Metrics count every item as a request of
+// its own target, sharing the duration of the call, or the call's error
+// when there are no results; the span describes the call as a whole.
+func (in *callInstrument) endBatch(reqs []LLMRequest, results *[]BatchResult, err *error) {
+	if in == nil {
+		return
+	}
+	if in.c.metrics != nil {
+		for i, req := range reqs {
+			if *results == nil {
+				in.c.metrics.observe(req.Target, in.method, in.start, nil, *err)
+				continue
+			}
+			res := (*results)[i]
+			var meta *Meta
+			if res.Response != nil {
+				meta = &res.Response.Meta
+			}
+			in.c.metrics.observe(req.Target, in.method, in.start, meta, res.Err)
+		}
+	}
+	if in.c.logger != nil {
+		for i, req := range reqs {
+			if *results == nil {
+				in.logRequest(req.Target, nil, *err)
+				continue
+			}
+			res := (*results)[i]
+			var meta *Meta
+			if res.Response != nil {
+				meta = &res.Response.Meta
+			}
+			in.logRequest(req.Target, meta, res.Err)
+		}
+	}
+	if in.span != nil {
+		var batch *BatchMeta
+		if len(*results) > 0 {
+			batch = (*results)[0].Batch
+		}
+		endBatchSpan(in.span, len(reqs), batch, *err)
+	}
+}
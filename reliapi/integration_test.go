@@ -0,0 +1,106 @@
+package reliapi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"github.com/KikuAI-Lab/reliapi/reliapi/embedded"
+)
+
+// startEmbedded runs the client against an embedded proxy whose "openai"
+// target answers every completion with "Paris.", and counts the calls
+// that reach it.
+func startEmbedded(t *testing.T, opts ...reliapi.Option) (*reliapi.Client, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"model": "gpt-4o-mini", "choices": [{"index": 0,
+			"message": {"role": "assistant", "content": "Paris."}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 8, "completion_tokens": 2, "total_tokens": 10}}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	srv, err := embedded.Start(embedded.Config{
+		APIKey: "dev-key",
+		Targets: map[string]embedded.Target{
+			"openai": {BaseURL: upstream.URL, LLM: &embedded.LLM{DefaultModel: "gpt-4o-mini"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("embedded.Start: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	client, err := reliapi.NewClient(srv.URL, "dev-key", opts...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client, &calls
+}
+
+func capitalQuestion() reliapi.LLMRequest {
+	return reliapi.LLMRequest{
+		Target:   "openai",
+		Model:    "gpt-4o-mini",
+		Messages: []reliapi.ChatMessage{reliapi.UserMessage("What is the capital of France?")},
+	}
+}
+
+func TestIntegrationCacheHit(t *testing.T) {
+	client, calls := startEmbedded(t)
+	ctx := context.Background()
+	req := capitalQuestion()
+
+	meta, err := client.Validate(ctx, req)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if meta.CacheEntryExists {
+		t.Error("cache entry exists before the first call")
+	}
+	if _, err := client.ProxyLLM(ctx, req); err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	resp, err := client.ProxyLLM(ctx, req)
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if text, _ := resp.CompletionText(); text != "Paris." || !resp.Meta.CacheHit || calls.Load() != 1 {
+		t.Errorf("content = %q, meta = %+v, upstream calls = %d", text, resp.Meta, calls.Load())
+	}
+	key, err := reliapi.CanonicalCacheKey(req)
+	if err != nil || resp.Meta.CacheKey != key {
+		t.Errorf("cache key = %q, CanonicalCacheKey = %q (%v)", resp.Meta.CacheKey, key, err)
+	}
+	if meta, _ := client.Validate(ctx, req); !meta.CacheEntryExists {
+		t.Error("Validate does not see the cache entry")
+	}
+}
+
+func TestIntegrationIdempotentHit(t *testing.T) {
+	client, calls := startEmbedded(t, reliapi.WithDeterministicIdempotency())
+	ctx := context.Background()
+	req := capitalQuestion()
+	noCache := 0
+	req.Cache = &noCache
+
+	first, err := client.ProxyLLM(ctx, req)
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	replay, err := client.ProxyLLM(ctx, req)
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if replay.IdempotencyKey == "" || replay.IdempotencyKey != first.IdempotencyKey {
+		t.Errorf("keys = %q, %q", first.IdempotencyKey, replay.IdempotencyKey)
+	}
+	if !replay.Meta.IdempotentHit || replay.Meta.CacheHit || calls.Load() != 1 {
+		t.Errorf("replay meta = %+v, upstream calls = %d", replay.Meta, calls.Load())
+	}
+}
@@ -0,0 +1,283 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const jobsPath = "/v1/jobs"
+
+// JobID identifies an async job submitted with SubmitLLM, or a cache
+// warming job queued with WarmCache.
+type JobID string
+
+// Job statuses reported by the proxy.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// ErrJobPending is returned by JobResult while the job is queued or running.
+var ErrJobPending = errors.New("reliapi: job has not finished")
+
+// defaultPollInterval is WaitForJob's interval when it is given none.
+const defaultPollInterval = time.Second
+
+// Job is an async job submitted with SubmitLLM, as the proxy reports it.
+type Job struct {
+	ID     JobID
+	Status string
+	// CreatedAt is when the job was submitted; CompletedAt when it
+	// finished, zero while it is queued or running.
+	CreatedAt   time.Time
+	CompletedAt time.Time
+	CallbackURL string
+	// CallbackDelivered reports whether CallbackURL accepted the
+	// job.completed event; nil until delivery was attempted.
+	CallbackDelivered *bool
+	// Result is the ReliAPIResponse envelope of a finished job; Response
+	// decodes it.
+	Result json.RawMessage
+}
+
+// UnmarshalJSON decodes a job of a GET /v1/jobs response, whose times are
+// Unix seconds.
+func (j *Job) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		JobID             JobID           `json:"job_id"`
+		Status            string          `json:"status"`
+		CreatedAt         float64         `json:"created_at"`
+		CompletedAt       *float64        `json:"completed_at"`
+		CallbackURL       string          `json:"callback_url"`
+		CallbackDelivered *bool           `json:"callback_delivered"`
+		Result            json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*j = Job{
+		ID: raw.JobID, Status: raw.Status, CreatedAt: unixSeconds(raw.CreatedAt),
+		CallbackURL: raw.CallbackURL, CallbackDelivered: raw.CallbackDelivered, Result: raw.Result,
+	}
+	if raw.CompletedAt != nil {
+		j.CompletedAt = unixSeconds(*raw.CompletedAt)
+	}
+	return nil
+}
+
+func unixSeconds(s float64) time.Time {
+	if s == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(int64(s * 1e6))
+}
+
+// Response returns the result of the job as JobResult does: the response
+// ProxyLLM would have returned, its error as an *APIError, or
+// ErrJobPending while the job is queued or running.
+func (j *Job) Response() (*ReliAPIResponse, error) {
+	if j.Status != JobSucceeded && j.Status != JobFailed {
+		return nil, ErrJobPending
+	}
+	return decodeJobResult(j.Result)
+}
+
+// JobsQuery selects the jobs of Jobs.
+type JobsQuery struct {
+	// Status keeps the jobs in one status, e.g. JobFailed.
+	Status string
+	// Limit is the number of jobs per page; the proxy defaults to 100 and
+	// allows at most 1000.
+	Limit int
+	// Cursor resumes a listing from a Pager's Cursor. It is only valid
+	// with the Status it was issued for; others fail with CodeBadRequest.
+	Cursor string
+}
+
+// SubmitLLM queues req as an async job and returns its ID without waiting
+// for the completion, for generations that outlast a gateway's timeout.
+// Collect the result with JobResult or WaitForJob, or set req.CallbackURL
+// to have the proxy POST it there as a signed job.completed event when it
+// finishes (see NewCallbackHandler).
+//
+// Resubmitting an IdempotencyKey returns the job it was first submitted
+// with instead of running the request again, so submissions with a key are
+// retried under WithRetry. ctx bounds the submission only: req.TimeoutMs is
+// not derived from its deadline. Streaming is not supported.
+func (c *Client) SubmitLLM(ctx context.Context, req LLMRequest) (id JobID, err error) {
+	var resp *ReliAPIResponse
+	ctx, in := c.instrument(ctx, OpSubmitLLM, req.Target)
+	defer in.endResponse(&resp, &err)
+	if err = c.requireFeature(FeatureAsyncJobs); err != nil {
+		return "", err
+	}
+	req, err = withPromptMessages(req)
+	if err != nil {
+		return "", err
+	}
+	in.logPrompts(req.Messages)
+	if err = c.checkImages(req.Messages); err != nil {
+		return "", err
+	}
+	ctx, err = c.tenantContext(ctx, req.TenantID)
+	if err != nil {
+		return "", err
+	}
+	if ctx, req, err = c.guardLLM(ctx, req); err != nil {
+		return "", err
+	}
+	if req.Tags, err = c.withTags(req.Tags); err != nil {
+		return "", err
+	}
+	req, _ = c.redact(req)
+	req.Stream = nil
+	key, err := c.applyIdempotency(&req.IdempotencyKey, req, allowsResend(req.Retry))
+	if err != nil {
+		return "", err
+	}
+	req.IdempotencyTTL = c.idempotencyTTLSeconds(key, req.IdempotencyTTL)
+	hr, err := c.startHooks(ctx, OpSubmitLLM, req.Target, &req.IdempotencyKey, req)
+	if err != nil {
+		return "", err
+	}
+	if hr != nil {
+		key = hr.IdempotencyKey
+	}
+	resp, err = c.post(withHookRequest(ctx, hr), llmProxyPath+"?mode=async", req, req.IdempotencyKey != nil && allowsResend(req.Retry))
+	if resp != nil {
+		resp.IdempotencyKey = key
+	}
+	if err = c.endHooks(ctx, hr, resp, err); err != nil {
+		return "", withIdempotencyKey(err, key)
+	}
+	var data struct {
+		JobID string `json:"job_id"`
+	}
+	err = resp.DecodeInto(&data)
+	resp.Release()
+	if err != nil || data.JobID == "" {
+		// A proxy without async jobs runs the request instead
+		return "", c.unsupported(ctx, FeatureAsyncJobs, errors.New("reliapi: async submission returned no job_id"))
+	}
+	return JobID(data.JobID), nil
+}
+
+// JobResult returns the result of a job submitted with SubmitLLM: the
+// response ProxyLLM would have returned, or its error as an *APIError.
+// It returns ErrJobPending while the job is queued or running. Jobs are
+// kept for 24 hours and are only visible to the tenant that submitted
+// them; others fail with NOT_FOUND.
+func (c *Client) JobResult(ctx context.Context, id JobID) (*ReliAPIResponse, error) {
+	if err := c.requireFeature(FeatureAsyncJobs); err != nil {
+		return nil, err
+	}
+	resp, raw, err := c.do(ctx, http.MethodGet, jobsPath+"/"+url.PathEscape(string(id)), nil, true)
+	if err != nil {
+		return nil, c.routeError(ctx, FeatureAsyncJobs, err)
+	}
+	var out struct {
+		Success bool `json:"success"`
+		Data    Job  `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return out.Data.Response()
+}
+
+// Jobs lists the async jobs of the caller's tenant submitted in the last
+// 24 hours, oldest first, a page per request as the Pager is walked:
+//
+//	err := c.Jobs(ctx, reliapi.JobsQuery{Status: reliapi.JobFailed}).Pages(func(page []reliapi.Job) error {
+//		for _, job := range page {
+//			// ...
+//		}
+//		return nil
+//	})
+//
+// Cache warming jobs are not listed.
+func (c *Client) Jobs(ctx context.Context, q JobsQuery) *Pager[Job] {
+	return newPager(ctx, q.Cursor, func(ctx context.Context, cursor string) ([]Job, string, error) {
+		params := url.Values{}
+		if q.Status != "" {
+			params.Set("status", q.Status)
+		}
+		if q.Limit > 0 {
+			params.Set("limit", strconv.Itoa(q.Limit))
+		}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		path := jobsPath
+		if len(params) > 0 {
+			path += "?" + params.Encode()
+		}
+		var page struct {
+			Jobs       []Job  `json:"jobs"`
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := c.requireFeature(FeatureAsyncJobs); err != nil {
+			return nil, "", err
+		}
+		if err := c.getData(ctx, path, &page); err != nil {
+			return nil, "", c.routeError(ctx, FeatureAsyncJobs, err)
+		}
+		return page.Jobs, page.NextCursor, nil
+	})
+}
+
+// decodeJobResult decodes the ReliAPIResponse envelope of a finished job,
+// returning a failed one as an *APIError.
+func decodeJobResult(raw json.RawMessage) (*ReliAPIResponse, error) {
+	var result struct {
+		ReliAPIResponse
+		Error *APIError `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("reliapi: decode job result: %w", err)
+	}
+	if !result.Success {
+		apiErr := result.Error
+		if apiErr == nil {
+			apiErr = &APIError{Message: "job failed"}
+		}
+		apiErr.RequestID = result.Meta.RequestID
+		apiErr.Body = raw
+		return nil, apiErr
+	}
+	return &result.ReliAPIResponse, nil
+}
+
+// WaitForJob polls JobResult every pollInterval (one second if zero) until
+// the job finishes, and returns its result. It gives up with ctx's error
+// when ctx is done first; the job keeps running and can be polled again.
+func (c *Client) WaitForJob(ctx context.Context, id JobID, pollInterval time.Duration) (*ReliAPIResponse, error) {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		resp, err := c.JobResult(ctx, id)
+		if !errors.Is(err, ErrJobPending) {
+			return resp, err
+		}
+		timer.Reset(pollInterval)
+	}
+}
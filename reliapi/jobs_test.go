@@ -0,0 +1,248 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jobServer is a proxy that queues async submissions, keeps one job per
+// idempotency key, and finishes each job after pending polls.
+type jobServer struct {
+	mu       sync.Mutex
+	pending  int
+	result   map[string]interface{}
+	byKey    map[string]string
+	polls    map[string]int
+	submits  int
+	lastBody map[string]interface{}
+}
+
+func newJobServer(pending int, result map[string]interface{}) *jobServer {
+	return &jobServer{pending: pending, result: result, byKey: map[string]string{}, polls: map[string]int{}}
+}
+
+func (s *jobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == llmProxyPath:
+		if r.URL.Query().Get("mode") != "async" {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"detail": "mode=async expected"})
+			return
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		s.lastBody = body
+		key, _ := body["idempotency_key"].(string)
+		id, existing := s.byKey[key]
+		if !existing || key == "" {
+			s.submits++
+			id = fmt.Sprintf("job_%c", 'a'+s.submits-1)
+			s.byKey[key] = id
+		}
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"job_id": id, "status": JobQueued},
+			"meta":    map[string]interface{}{"idempotent_hit": existing},
+		})
+	case r.Method == http.MethodGet && r.URL.Path == jobsPath+"/job_a":
+		s.polls["job_a"]++
+		data := map[string]interface{}{"job_id": "job_a", "status": JobRunning, "result": nil}
+		if s.polls["job_a"] > s.pending {
+			data["status"] = JobSucceeded
+			if success, _ := s.result["success"].(bool); !success {
+				data["status"] = JobFailed
+			}
+			data["result"] = s.result
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": data})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"detail": map[string]interface{}{
+				"success": false,
+				"error":   map[string]interface{}{"type": "client_error", "code": CodeNotFound, "message": "Job not found", "status_code": 404},
+			},
+		})
+	}
+}
+
+var completedJob = map[string]interface{}{
+	"success": true,
+	"data":    map[string]interface{}{"content": "42"},
+	"meta":    map[string]interface{}{"request_id": "req_job", "cost_usd": 0.5},
+}
+
+func TestSubmitLLMResubmitReturnsJob(t *testing.T) {
+	srv := newJobServer(0, completedJob)
+	c := newTestClient(t, srv.ServeHTTP)
+
+	req := llmReq("think")
+	key := "report-1"
+	req.IdempotencyKey = &key
+	req.CallbackURL = "https://hooks.example.com/reliapi"
+	first, err := c.SubmitLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.SubmitLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != "job_a" || again != first || srv.submits != 1 {
+		t.Errorf("jobs %q, %q after %d submits", first, again, srv.submits)
+	}
+	if srv.lastBody["callback_url"] != req.CallbackURL {
+		t.Errorf("callback_url = %v", srv.lastBody["callback_url"])
+	}
+	if _, ok := srv.lastBody["timeout_ms"]; ok {
+		t.Error("timeout_ms derived for an async submission")
+	}
+}
+
+func TestJobResult(t *testing.T) {
+	c := newTestClient(t, newJobServer(1, completedJob).ServeHTTP)
+
+	if _, err := c.JobResult(context.Background(), "job_a"); !errors.Is(err, ErrJobPending) {
+		t.Fatalf("first poll: err = %v, want ErrJobPending", err)
+	}
+	resp, err := c.JobResult(context.Background(), "job_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := resp.DataMap()["content"].(string); text != "42" || resp.Meta.RequestID != "req_job" {
+		t.Errorf("result = %+v", resp)
+	}
+
+	_, err = c.JobResult(context.Background(), "job_missing")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeNotFound {
+		t.Errorf("unknown job: err = %v", err)
+	}
+}
+
+func TestJobResultFailedJob(t *testing.T) {
+	c := newTestClient(t, newJobServer(0, map[string]interface{}{
+		"success": false,
+		"error": map[string]interface{}{
+			"type": "budget_error", "code": CodeBudgetExceeded, "message": "over budget", "status_code": 402,
+		},
+		"meta": map[string]interface{}{"request_id": "req_job"},
+	}).ServeHTTP)
+
+	_, err := c.JobResult(context.Background(), "job_a")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.Code != CodeBudgetExceeded || apiErr.StatusCode != 402 || apiErr.RequestID != "req_job" {
+		t.Errorf("err = %+v", apiErr)
+	}
+}
+
+func TestWaitForJob(t *testing.T) {
+	srv := newJobServer(2, completedJob)
+	c := newTestClient(t, srv.ServeHTTP)
+
+	resp, err := c.WaitForJob(context.Background(), "job_a", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta.CostUSD == nil || srv.polls["job_a"] != 3 {
+		t.Errorf("resp = %+v after %d polls", resp, srv.polls["job_a"])
+	}
+}
+
+func TestWaitForJobHonorsDeadline(t *testing.T) {
+	c := newTestClient(t, newJobServer(1000, completedJob).ServeHTTP)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.WaitForJob(ctx, "job_a", 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %v", elapsed)
+	}
+}
+
+// jobPages serves GET /v1/jobs pages keyed by cursor, checking the status
+// filter.
+func jobPages(t *testing.T, status string, pages map[string][]map[string]interface{}, next map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != jobsPath || q.Get("status") != status || q.Get("limit") != "2" {
+			t.Errorf("request = %s", r.URL)
+		}
+		jobs, ok := pages[q.Get("cursor")]
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"detail": map[string]interface{}{
+					"success": false,
+					"error":   map[string]interface{}{"type": "client_error", "code": CodeBadRequest, "message": "cursor belongs to a different query", "status_code": 400},
+				},
+			})
+			return
+		}
+		var cursor interface{}
+		if n := next[q.Get("cursor")]; n != "" {
+			cursor = n
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"status": status, "jobs": jobs, "next_cursor": cursor},
+		})
+	}
+}
+
+func TestJobs(t *testing.T) {
+	c := newTestClient(t, jobPages(t, JobSucceeded, map[string][]map[string]interface{}{
+		"": {
+			{"job_id": "job_a", "status": JobSucceeded, "created_at": 1791979200.25, "completed_at": 1791979201.5, "result": completedJob, "callback_delivered": true},
+			{"job_id": "job_b", "status": JobSucceeded, "created_at": 1791979202, "completed_at": 1791979203, "result": completedJob},
+		},
+		"c2": {{"job_id": "job_c", "status": JobSucceeded, "created_at": 1791979204, "completed_at": 1791979205, "result": completedJob}},
+	}, map[string]string{"": "c2"}))
+
+	var ids []JobID
+	err := c.Jobs(context.Background(), JobsQuery{Status: JobSucceeded, Limit: 2}).Pages(func(page []Job) error {
+		for _, job := range page {
+			ids = append(ids, job.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != "job_a" || ids[2] != "job_c" {
+		t.Errorf("ids = %v", ids)
+	}
+
+	jobs, err := c.Jobs(context.Background(), JobsQuery{Status: JobSucceeded, Limit: 2}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := jobs[0]
+	if !first.CreatedAt.Equal(time.Unix(1791979200, 250e6)) || first.CompletedAt.Sub(first.CreatedAt) != 1250*time.Millisecond {
+		t.Errorf("times = %v, %v", first.CreatedAt, first.CompletedAt)
+	}
+	if first.CallbackDelivered == nil || !*first.CallbackDelivered || jobs[1].CallbackDelivered != nil {
+		t.Errorf("CallbackDelivered = %v, %v", first.CallbackDelivered, jobs[1].CallbackDelivered)
+	}
+	if resp, err := first.Response(); err != nil || resp.Meta.RequestID != "req_job" {
+		t.Errorf("Response = %+v, %v", resp, err)
+	}
+
+	err = c.Jobs(context.Background(), JobsQuery{Status: JobSucceeded, Limit: 2, Cursor: "stale"}).Pages(func([]Job) error { return nil })
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeBadRequest {
+		t.Errorf("stale cursor: err = %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package reliapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// applyJSONPatch applies patch, an RFC 6902 JSON Patch, to doc, decoded
+// with UseNumber, and returns the patched document. doc is modified in
+// place and is not to be used after an error.
+func applyJSONPatch(doc interface{}, patch []byte) (interface{}, error) {
+	var ops []struct {
+		Op    string          `json:"op"`
+		Path  *string         `json:"path"`
+		From  *string         `json:"from"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("json patch: %w", err)
+	}
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, fmt.Errorf("json patch: operation %d has no path", i)
+		}
+		path, err := parsePointer(*op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("json patch: operation %d: %w", i, err)
+		}
+		var from []string
+		switch op.Op {
+		case "move", "copy":
+			if op.From == nil {
+				return nil, fmt.Errorf("json patch: %s operation %d has no from", op.Op, i)
+			}
+			if from, err = parsePointer(*op.From); err != nil {
+				return nil, fmt.Errorf("json patch: operation %d: %w", i, err)
+			}
+		}
+		var value interface{}
+		switch op.Op {
+		case "add", "replace", "test":
+			// A null value is a value, a missing one is not
+			if op.Value == nil {
+				return nil, fmt.Errorf("json patch: %s operation %d has no value", op.Op, i)
+			}
+			if value, err = decodeNumbers(op.Value); err != nil {
+				return nil, fmt.Errorf("json patch: operation %d: %w", i, err)
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			doc, err = pointerAdd(doc, path, value)
+		case "remove":
+			doc, _, err = pointerRemove(doc, path)
+		case "replace":
+			doc, err = pointerReplace(doc, path, value)
+		case "move":
+			if *op.Path == *op.From {
+				continue
+			}
+			if strings.HasPrefix(*op.Path, *op.From+"/") {
+				err = errors.New("cannot move a value into itself")
+				break
+			}
+			var moved interface{}
+			if doc, moved, err = pointerRemove(doc, from); err == nil {
+				doc, err = pointerAdd(doc, path, moved)
+			}
+		case "copy":
+			var copied interface{}
+			if copied, err = pointerGet(doc, from); err == nil {
+				doc, err = pointerAdd(doc, path, deepCopyJSON(copied))
+			}
+		case "test":
+			var have interface{}
+			if have, err = pointerGet(doc, path); err == nil && !jsonEqual(have, value) {
+				err = fmt.Errorf("test of %q failed", *op.Path)
+			}
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("json patch: operation %d: %w", i, err)
+		}
+	}
+	return doc, nil
+}
+
+// applyMergePatch applies patch, an RFC 7386 JSON Merge Patch, to doc:
+// members of an object patch replace or, when null, remove those of doc,
+// recursively; any other patch replaces doc entirely.
+func applyMergePatch(doc, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	target, ok := doc.(map[string]interface{})
+	if !ok {
+		target = make(map[string]interface{}, len(members))
+	}
+	for k, v := range members {
+		if v == nil {
+			delete(target, k)
+		} else {
+			target[k] = applyMergePatch(target[k], v)
+		}
+	}
+	return target
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped
+// reference tokens; "" is the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("pointer %q does not start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, fmt.Errorf("pointer %q has an invalid escape", pointer)
+			}
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses token as an index of an array of length n. end allows
+// n itself, or "-", as where add appends.
+func arrayIndex(token string, n int, end bool) (int, error) {
+	if token == "-" && end {
+		return n, nil
+	}
+	// Digits only, without leading zeros or a sign
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.Trim(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i > n || (i == n && !end) {
+		return 0, fmt.Errorf("array index %s out of range", token)
+	}
+	return i, nil
+}
+
+// pointerUpdate walks node along tokens and replaces the container holding
+// the last one with what leaf makes of it.
+func pointerUpdate(node interface{}, tokens []string, leaf func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return leaf(node, tokens[0])
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", tokens[0])
+		}
+		updated, err := pointerUpdate(child, tokens[1:], leaf)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = updated
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(tokens[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := pointerUpdate(n[i], tokens[1:], leaf)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("%q is not in an object or array", tokens[0])
+	}
+}
+
+func pointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch n := doc.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			doc = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = n[i]
+		default:
+			return nil, fmt.Errorf("%q is not in an object or array", token)
+		}
+	}
+	return doc, nil
+}
+
+func pointerAdd(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			n[token] = value
+			return n, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		default:
+			return nil, fmt.Errorf("%q is not in an object or array", token)
+		}
+	})
+}
+
+func pointerRemove(doc interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed interface{}
+	doc, err := pointerUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			v, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			removed = v
+			delete(n, token)
+			return n, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = n[i]
+			return append(n[:i], n[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%q is not in an object or array", token)
+		}
+	})
+	return doc, removed, err
+}
+
+func pointerReplace(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := n[token]; !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			n[token] = value
+			return n, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			n[i] = value
+			return n, nil
+		default:
+			return nil, fmt.Errorf("%q is not in an object or array", token)
+		}
+	})
+}
+
+// decodeNumbers decodes raw keeping numbers as json.Number, so they are
+// encoded again as they were.
+func decodeNumbers(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func deepCopyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = deepCopyJSON(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = deepCopyJSON(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// jsonEqual compares decoded JSON values as RFC 6902's test does, numbers
+// by value, so 1 equals 1.0.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, item := range a {
+			other, ok := b[k]
+			if !ok || !jsonEqual(item, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := canonicalNumber(a)
+		y, errB := canonicalNumber(b)
+		return errA == nil && errB == nil && x == y
+	default:
+		return a == b
+	}
+}
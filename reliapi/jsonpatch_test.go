@@ -0,0 +1,137 @@
+package reliapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	for _, tt := range []struct {
+		name, doc, patch, want string
+	}{
+		// RFC 6902, Appendix A
+		{"add member", `{"foo": "bar"}`, `[{"op": "add", "path": "/baz", "value": "qux"}]`, `{"baz": "qux", "foo": "bar"}`},
+		{"insert into array", `{"foo": ["bar", "baz"]}`, `[{"op": "add", "path": "/foo/1", "value": "qux"}]`, `{"foo": ["bar", "qux", "baz"]}`},
+		{"remove member", `{"baz": "qux", "foo": "bar"}`, `[{"op": "remove", "path": "/baz"}]`, `{"foo": "bar"}`},
+		{"remove element", `{"foo": ["bar", "qux", "baz"]}`, `[{"op": "remove", "path": "/foo/1"}]`, `{"foo": ["bar", "baz"]}`},
+		{"replace", `{"baz": "qux", "foo": "bar"}`, `[{"op": "replace", "path": "/baz", "value": "boo"}]`, `{"baz": "boo", "foo": "bar"}`},
+		{"move member", `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			`[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			`{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`},
+		{"move element", `{"foo": ["all", "grass", "cows", "eat"]}`, `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			`{"foo": ["all", "cows", "eat", "grass"]}`},
+		{"test", `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			`[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`, `{"baz": "qux", "foo": ["a", 2, "c"]}`},
+		{"add nested", `{"foo": "bar"}`, `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`, `{"foo": "bar", "child": {"grandchild": {}}}`},
+		{"append", `{"foo": ["bar"]}`, `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`, `{"foo": ["bar", ["abc", "def"]]}`},
+		{"null value", `{"foo": null}`, `[{"op": "test", "path": "/foo", "value": null}, {"op": "replace", "path": "/foo", "value": null}]`, `{"foo": null}`},
+		{"escapes", `{"/": 9, "~1": 10}`, `[{"op": "test", "path": "/~01", "value": 10}, {"op": "replace", "path": "/~1", "value": 11}]`, `{"/": 11, "~1": 10}`},
+
+		// Array indexes
+		{"add at the end", `[1, 2]`, `[{"op": "add", "path": "/2", "value": 3}]`, `[1, 2, 3]`},
+		{"add at the start", `[1, 2]`, `[{"op": "add", "path": "/0", "value": 0}]`, `[0, 1, 2]`},
+		{"add to empty", `[]`, `[{"op": "add", "path": "/0", "value": 1}, {"op": "add", "path": "/-", "value": 2}]`, `[1, 2]`},
+		{"remove last", `[1, 2, 3]`, `[{"op": "remove", "path": "/2"}]`, `[1, 2]`},
+		{"remove all", `[1, 2]`, `[{"op": "remove", "path": "/0"}, {"op": "remove", "path": "/0"}]`, `[]`},
+		{"nested index", `{"a": [[1], [2, 3]]}`, `[{"op": "replace", "path": "/a/1/0", "value": 4}]`, `{"a": [[1], [4, 3]]}`},
+		{"member named like an index", `{"0": "a", "-": "b"}`, `[{"op": "replace", "path": "/0", "value": "c"}, {"op": "remove", "path": "/-"}]`, `{"0": "c"}`},
+
+		{"whole document", `{"a": 1}`, `[{"op": "replace", "path": "", "value": [1]}]`, `[1]`},
+		{"copy", `{"a": {"b": [1]}}`, `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "add", "path": "/c/b/-", "value": 2}]`,
+			`{"a": {"b": [1]}, "c": {"b": [1, 2]}}`},
+		{"move to itself", `{"a": 1}`, `[{"op": "move", "from": "/a", "path": "/a"}]`, `{"a": 1}`},
+		{"numbers by value", `{"n": 1.0, "big": 12345678901234567890}`,
+			`[{"op": "test", "path": "/n", "value": 1}, {"op": "test", "path": "/big", "value": 12345678901234567890}]`,
+			`{"n": 1.0, "big": 12345678901234567890}`},
+		{"no operations", `{"a": 1}`, `[]`, `{"a": 1}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := decodeNumbers([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyJSONPatch(doc, []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := decodeNumbers([]byte(tt.want))
+			if !jsonEqual(got, want) {
+				raw, _ := json.Marshal(got)
+				t.Errorf("got %s, want %s", raw, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, doc, patch string
+	}{
+		{"missing member", `{"foo": "bar"}`, `[{"op": "remove", "path": "/baz"}]`},
+		{"missing parent", `{"foo": "bar"}`, `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`},
+		{"replace missing", `{"foo": "bar"}`, `[{"op": "replace", "path": "/baz", "value": 1}]`},
+		{"index past the end", `{"foo": ["bar", "baz"]}`, `[{"op": "add", "path": "/foo/3", "value": "qux"}]`},
+		{"replace past the end", `[1, 2]`, `[{"op": "replace", "path": "/2", "value": 3}]`},
+		{"remove past the end", `[1, 2]`, `[{"op": "remove", "path": "/2"}]`},
+		{"remove the end marker", `[1, 2]`, `[{"op": "remove", "path": "/-"}]`},
+		{"leading zero", `[1, 2]`, `[{"op": "replace", "path": "/01", "value": 3}]`},
+		{"negative index", `[1, 2]`, `[{"op": "remove", "path": "/-1"}]`},
+		{"signed index", `[1, 2]`, `[{"op": "remove", "path": "/+1"}]`},
+		{"not an index", `[1, 2]`, `[{"op": "add", "path": "/a", "value": 3}]`},
+		{"huge index", `[1, 2]`, `[{"op": "remove", "path": "/99999999999999999999"}]`},
+		{"into a scalar", `{"a": 1}`, `[{"op": "add", "path": "/a/b", "value": 2}]`},
+		{"test fails", `{"baz": "qux"}`, `[{"op": "test", "path": "/baz", "value": "bar"}]`},
+		{"test of a type", `{"n": "1"}`, `[{"op": "test", "path": "/n", "value": 1}]`},
+		{"no value", `{"a": 1}`, `[{"op": "add", "path": "/b"}]`},
+		{"no path", `{"a": 1}`, `[{"op": "remove"}]`},
+		{"no from", `{"a": 1}`, `[{"op": "copy", "path": "/b"}]`},
+		{"unknown op", `{"a": 1}`, `[{"op": "merge", "path": "/a", "value": 1}]`},
+		{"relative pointer", `{"a": 1}`, `[{"op": "remove", "path": "a"}]`},
+		{"bad escape", `{"a~2": 1}`, `[{"op": "remove", "path": "/a~2"}]`},
+		{"move into its child", `{"a": {"b": 1}}`, `[{"op": "move", "from": "/a", "path": "/a/c"}]`},
+		{"remove the document", `{"a": 1}`, `[{"op": "remove", "path": ""}]`},
+		{"not a list", `{"a": 1}`, `{"op": "remove", "path": "/a"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := decodeNumbers([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := applyJSONPatch(doc, []byte(tt.patch)); err == nil {
+				raw, _ := json.Marshal(got)
+				t.Errorf("applied: %s", raw)
+			}
+		})
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	// RFC 7386, Appendix A
+	for _, tt := range []struct {
+		doc, patch, want string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+	} {
+		doc, _ := decodeNumbers([]byte(tt.doc))
+		patch, _ := decodeNumbers([]byte(tt.patch))
+		want, _ := decodeNumbers([]byte(tt.want))
+		if got := applyMergePatch(doc, patch); !jsonEqual(got, want) {
+			raw, _ := json.Marshal(got)
+			t.Errorf("%s + %s = %s, want %s", tt.doc, tt.patch, raw, tt.want)
+		}
+	}
+}
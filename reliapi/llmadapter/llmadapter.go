@@ -0,0 +1,372 @@
+// Package llmadapter implements langchaingo's llms.Model on top of a
+// ReliAPI target, so chains, agents and other code that takes an
+// llms.Model get the proxy's retries, caching and budget caps by swapping
+// the model they are built with:
+//
+//	llm := llmadapter.New(client, "openai", llmadapter.WithModel("gpt-4o-mini"))
+//	answer, err := llms.GenerateFromSinglePrompt(ctx, llm, "Hello!",
+//		llmadapter.WithCache(time.Hour))
+//
+// Calls with a streaming function are sent with ProxyLLMStream, others
+// with ProxyLLM. Each choice's GenerationInfo holds the token counts under
+// the keys langchaingo's OpenAI model uses (PromptTokens, CompletionTokens,
+// TotalTokens) and the proxy's reliapi.Meta under MetaKey.
+package llmadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+// MetaKey is the GenerationInfo key of the proxy's reliapi.Meta.
+const MetaKey = "ReliAPIMeta"
+
+// Metadata keys of the proxy options WithCache and WithIdempotencyKey set
+// in llms.CallOptions.Metadata, for code that builds CallOptions itself.
+const (
+	MetadataCacheTTL       = "reliapi.cache_ttl_s"
+	MetadataIdempotencyKey = "reliapi.idempotency_key"
+)
+
+// ErrMultipleCandidates is returned for calls asking for more than one
+// candidate, which the proxy does not support.
+var ErrMultipleCandidates = errors.New("llmadapter: more than one candidate is not supported")
+
+// LLM is an llms.Model backed by a ReliAPI target.
+type LLM struct {
+	client *reliapi.Client
+	target string
+	model  string
+}
+
+var _ llms.Model = (*LLM)(nil)
+
+// Option configures New.
+type Option func(*LLM)
+
+// WithModel sets the model used by calls that don't pick one with
+// llms.WithModel. Without it they use the target's default model.
+func WithModel(model string) Option {
+	return func(l *LLM) { l.model = model }
+}
+
+// New returns an LLM that sends its calls to target with client.
+func New(client *reliapi.Client, target string, opts ...Option) *LLM {
+	l := &LLM{client: client, target: target}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithCache caches the call's response for ttl; a zero ttl bypasses the
+// cache. Without it the target's cache settings apply.
+func WithCache(ttl time.Duration) llms.CallOption {
+	return withMetadata(MetadataCacheTTL, int(ttl/time.Second))
+}
+
+// WithIdempotencyKey sends the call with key, so that retries of it are
+// answered once.
+func WithIdempotencyKey(key string) llms.CallOption {
+	return withMetadata(MetadataIdempotencyKey, key)
+}
+
+func withMetadata(key string, value interface{}) llms.CallOption {
+	return func(o *llms.CallOptions) {
+		// Copied, as WithOptions may have shared the map with other calls
+		metadata := make(map[string]interface{}, len(o.Metadata)+1)
+		for k, v := range o.Metadata {
+			metadata[k] = v
+		}
+		metadata[key] = value
+		o.Metadata = metadata
+	}
+}
+
+// Call implements llms.Model for a single text prompt.
+func (l *LLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, l, prompt, options...)
+}
+
+// GenerateContent implements llms.Model. Text, image URL and image
+// binary parts, tool calls and tool call responses are translated; other
+// binary parts fail. A zero Temperature, TopP or MaxTokens leaves the
+// target's default, as CallOptions can't tell them from unset.
+func (l *LLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	opts := llms.CallOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	req, err := l.request(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.StreamingFunc != nil && len(req.Tools) == 0 {
+		return l.stream(ctx, req, opts.StreamingFunc)
+	}
+
+	resp, err := l.client.ProxyLLM(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	completion, err := resp.Completion()
+	if err != nil {
+		return nil, err
+	}
+	out := &llms.ContentResponse{}
+	for _, choice := range completion.Choices {
+		c := &llms.ContentChoice{
+			Content:        choice.Message.Content,
+			StopReason:     choice.FinishReason,
+			GenerationInfo: generationInfo(completion.Usage, resp.Meta),
+		}
+		for _, call := range choice.ToolCalls {
+			c.ToolCalls = append(c.ToolCalls, llms.ToolCall{
+				ID:           call.ID,
+				Type:         call.Type,
+				FunctionCall: &llms.FunctionCall{Name: call.Function.Name, Arguments: call.Function.Arguments},
+			})
+		}
+		if len(c.ToolCalls) > 0 {
+			c.FuncCall = c.ToolCalls[0].FunctionCall
+		}
+		out.Choices = append(out.Choices, c)
+	}
+	// A streaming function still sees the content, in one chunk, when
+	// tools kept the call from being streamed
+	if opts.StreamingFunc != nil && len(out.Choices) > 0 && out.Choices[0].Content != "" {
+		if err := opts.StreamingFunc(ctx, []byte(out.Choices[0].Content)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (l *LLM) stream(ctx context.Context, req reliapi.LLMRequest, fn func(context.Context, []byte) error) (*llms.ContentResponse, error) {
+	stream, err := l.client.ProxyLLMStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	var stopReason string
+	for {
+		chunk, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if chunk.FinishReason != "" {
+			stopReason = chunk.FinishReason
+		}
+		if chunk.Delta == "" {
+			continue
+		}
+		content.WriteString(chunk.Delta)
+		if err := fn(ctx, []byte(chunk.Delta)); err != nil {
+			return nil, err
+		}
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content:        content.String(),
+		StopReason:     stopReason,
+		GenerationInfo: generationInfo(stream.Usage(), stream.Meta()),
+	}}}, nil
+}
+
+func generationInfo(usage reliapi.Usage, meta reliapi.Meta) map[string]any {
+	return map[string]any{
+		"PromptTokens":     usage.PromptTokens,
+		"CompletionTokens": usage.CompletionTokens,
+		"TotalTokens":      usage.TotalTokens,
+		MetaKey:            meta,
+	}
+}
+
+// request translates a GenerateContent call into an LLMRequest.
+func (l *LLM) request(messages []llms.MessageContent, opts llms.CallOptions) (reliapi.LLMRequest, error) {
+	if opts.CandidateCount > 1 || opts.N > 1 {
+		return reliapi.LLMRequest{}, ErrMultipleCandidates
+	}
+	req := reliapi.LLMRequest{Target: l.target, Model: l.model, Stop: opts.StopWords}
+	if opts.Model != "" {
+		req.Model = opts.Model
+	}
+	if opts.MaxTokens > 0 {
+		req.MaxTokens = &opts.MaxTokens
+	}
+	if opts.Temperature != 0 {
+		req.Temperature = &opts.Temperature
+	}
+	if opts.TopP != 0 {
+		req.TopP = &opts.TopP
+	}
+	if opts.JSONMode || opts.ResponseMIMEType == "application/json" {
+		req.ResponseFormat = &reliapi.ResponseFormat{Type: "json_object"}
+	}
+	if err := metadataOptions(&req, opts.Metadata); err != nil {
+		return reliapi.LLMRequest{}, err
+	}
+
+	for _, tool := range opts.Tools {
+		if tool.Function == nil {
+			return reliapi.LLMRequest{}, fmt.Errorf("llmadapter: tool of type %q has no function", tool.Type)
+		}
+		def, err := toolDefinition(*tool.Function)
+		if err != nil {
+			return reliapi.LLMRequest{}, err
+		}
+		req.Tools = append(req.Tools, def)
+	}
+	for _, fn := range opts.Functions {
+		def, err := toolDefinition(fn)
+		if err != nil {
+			return reliapi.LLMRequest{}, err
+		}
+		req.Tools = append(req.Tools, def)
+	}
+	req.ToolChoice = toolChoice(opts)
+
+	for _, m := range messages {
+		converted, err := chatMessages(m)
+		if err != nil {
+			return reliapi.LLMRequest{}, err
+		}
+		req.Messages = append(req.Messages, converted...)
+	}
+	return req, nil
+}
+
+func metadataOptions(req *reliapi.LLMRequest, metadata map[string]interface{}) error {
+	if v, ok := metadata[MetadataCacheTTL]; ok {
+		ttl, ok := v.(int)
+		if !ok {
+			return fmt.Errorf("llmadapter: %s is a %T, not an int", MetadataCacheTTL, v)
+		}
+		req.Cache = &ttl
+	}
+	if v, ok := metadata[MetadataIdempotencyKey]; ok {
+		key, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("llmadapter: %s is a %T, not a string", MetadataIdempotencyKey, v)
+		}
+		req.IdempotencyKey = &key
+	}
+	return nil
+}
+
+func toolDefinition(fn llms.FunctionDefinition) (reliapi.ToolDefinition, error) {
+	var params json.RawMessage
+	switch p := fn.Parameters.(type) {
+	case nil:
+	case json.RawMessage:
+		params = p
+	case []byte:
+		params = p
+	case string:
+		params = json.RawMessage(p)
+	default:
+		raw, err := json.Marshal(p)
+		if err != nil {
+			return reliapi.ToolDefinition{}, fmt.Errorf("llmadapter: parameters of tool %q: %w", fn.Name, err)
+		}
+		params = raw
+	}
+	return reliapi.FunctionTool(fn.Name, fn.Description, params), nil
+}
+
+func toolChoice(opts llms.CallOptions) interface{} {
+	switch choice := opts.ToolChoice.(type) {
+	case nil:
+	case llms.ToolChoice:
+		if choice.Function != nil {
+			return reliapi.ForceTool(choice.Function.Name)
+		}
+		return choice.Type
+	case *llms.ToolChoice:
+		if choice != nil {
+			return toolChoice(llms.CallOptions{ToolChoice: *choice})
+		}
+	default:
+		return choice
+	}
+	switch behavior := opts.FunctionCallBehavior; behavior {
+	case llms.FunctionCallBehaviorAuto, llms.FunctionCallBehaviorNone:
+		return string(behavior)
+	case "":
+		return nil
+	default:
+		// The deprecated behavior names the function to call
+		return reliapi.ForceTool(string(behavior))
+	}
+}
+
+// chatMessages translates m; a message of tool call responses becomes one
+// tool message per response.
+func chatMessages(m llms.MessageContent) ([]reliapi.ChatMessage, error) {
+	msg := reliapi.ChatMessage{}
+	switch m.Role {
+	case llms.ChatMessageTypeSystem:
+		msg.Role = reliapi.RoleSystem
+	case llms.ChatMessageTypeHuman, llms.ChatMessageTypeGeneric:
+		msg.Role = reliapi.RoleUser
+	case llms.ChatMessageTypeAI:
+		msg.Role = reliapi.RoleAssistant
+	case llms.ChatMessageTypeTool, llms.ChatMessageTypeFunction:
+		msg.Role = reliapi.RoleTool
+	default:
+		return nil, fmt.Errorf("llmadapter: %w %q", llms.ErrUnexpectedChatMessageType, m.Role)
+	}
+
+	var out []reliapi.ChatMessage
+	var parts []reliapi.ContentPart
+	for _, part := range m.Parts {
+		switch p := part.(type) {
+		case llms.TextContent:
+			parts = append(parts, reliapi.TextPart(p.Text))
+		case llms.ImageURLContent:
+			parts = append(parts, reliapi.ImageURLPart(p.URL, p.Detail))
+		case llms.BinaryContent:
+			if !strings.HasPrefix(p.MIMEType, "image/") {
+				return nil, fmt.Errorf("llmadapter: binary content of type %q is not supported", p.MIMEType)
+			}
+			parts = append(parts, reliapi.ImageURLPart(p.String(), ""))
+		case llms.ToolCall:
+			call := reliapi.ToolCall{ID: p.ID, Type: p.Type}
+			if call.Type == "" {
+				call.Type = "function"
+			}
+			if p.FunctionCall != nil {
+				call.Function = reliapi.FunctionCall{Name: p.FunctionCall.Name, Arguments: p.FunctionCall.Arguments}
+			}
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		case llms.ToolCallResponse:
+			out = append(out, reliapi.ChatMessage{Role: reliapi.RoleTool, Content: p.Content, Name: p.Name, ToolCallID: p.ToolCallID})
+		default:
+			return nil, fmt.Errorf("llmadapter: content part %T is not supported", part)
+		}
+	}
+	if len(out) > 0 && len(parts) == 0 && len(msg.ToolCalls) == 0 {
+		return out, nil
+	}
+
+	// A single text part stays a plain string, which every provider accepts
+	if len(parts) == 1 && parts[0].Type == "text" {
+		msg.Content = parts[0].Text
+	} else {
+		msg.Parts = parts
+	}
+	return append([]reliapi.ChatMessage{msg}, out...), nil
+}
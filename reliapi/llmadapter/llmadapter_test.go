@@ -0,0 +1,159 @@
+package llmadapter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"github.com/KikuAI-Lab/reliapi/reliapi/reliapitest"
+)
+
+func TestGenerateContent(t *testing.T) {
+	srv := reliapitest.NewMockServer(t)
+	var got reliapi.LLMRequest
+	srv.HandleLLM(func(req reliapi.LLMRequest) reliapitest.LLMReply {
+		got = req
+		return reliapitest.LLMReply{Content: "Paris.", PromptTokens: 9, CompletionTokens: 2}
+	})
+	llm := New(srv.Client(), "openai", WithModel("gpt-4o-mini"))
+
+	resp, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "Be brief."),
+		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{
+			llms.TextPart("Which city is this?"),
+			llms.ImageURLWithDetailPart("https://example.com/paris.png", "low"),
+		}},
+	}, llms.WithMaxTokens(20), llms.WithTemperature(0.3), llms.WithStopWords([]string{"\n"}),
+		WithCache(time.Hour), WithIdempotencyKey("city-1"))
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if got.Target != "openai" || got.Model != "gpt-4o-mini" || *got.MaxTokens != 20 || *got.Temperature != 0.3 || got.TopP != nil || len(got.Stop) != 1 {
+		t.Errorf("request = %+v", got)
+	}
+	if *got.Cache != 3600 || *got.IdempotencyKey != "city-1" {
+		t.Errorf("cache = %v, idempotency key = %v", *got.Cache, *got.IdempotencyKey)
+	}
+	if len(got.Messages) != 2 || got.Messages[0].Role != "system" || got.Messages[0].Content != "Be brief." {
+		t.Fatalf("messages = %+v", got.Messages)
+	}
+	if parts := got.Messages[1].Parts; got.Messages[1].Role != "user" || len(parts) != 2 || parts[1].ImageURL.Detail != "low" {
+		t.Errorf("user message = %+v", got.Messages[1])
+	}
+
+	choice := resp.Choices[0]
+	if choice.Content != "Paris." || choice.StopReason != "stop" {
+		t.Errorf("choice = %+v", choice)
+	}
+	info := choice.GenerationInfo
+	if info["PromptTokens"] != 9 || info["CompletionTokens"] != 2 || info["TotalTokens"] != 11 {
+		t.Errorf("generation info = %v", info)
+	}
+	if meta, _ := info[MetaKey].(reliapi.Meta); meta.RequestID != "req_mock_1" {
+		t.Errorf("meta = %+v", info[MetaKey])
+	}
+
+	answer, err := llm.Call(context.Background(), "Capital of France?", llms.WithModel("gpt-4o"))
+	if err != nil || answer != "Paris." || got.Model != "gpt-4o" || got.Messages[0].Content != "Capital of France?" {
+		t.Errorf("Call = %q, %v; request = %+v", answer, err, got)
+	}
+
+	if _, err := llm.Call(context.Background(), "hi", llms.WithN(2)); !errors.Is(err, ErrMultipleCandidates) {
+		t.Errorf("n=2 err = %v", err)
+	}
+}
+
+func TestGenerateContentTools(t *testing.T) {
+	srv := reliapitest.NewMockServer(t)
+	var got reliapi.LLMRequest
+	srv.HandleLLM(func(req reliapi.LLMRequest) reliapitest.LLMReply {
+		got = req
+		if len(req.Messages) > 2 {
+			return reliapitest.LLMReply{Content: "It is 18°C in Paris."}
+		}
+		return reliapitest.LLMReply{FinishReason: "tool_calls", ToolCalls: []reliapi.ToolCall{{
+			ID: "call_1", Type: "function", Function: reliapi.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`},
+		}}}
+	})
+	llm := New(srv.Client(), "openai")
+	tools := []llms.Tool{{Type: "function", Function: &llms.FunctionDefinition{
+		Name:        "weather",
+		Description: "Current weather in a city",
+		Parameters:  map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+	}}}
+
+	history := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "Weather in Paris?")}
+	resp, err := llm.GenerateContent(context.Background(), history, llms.WithTools(tools), llms.WithToolChoice("required"))
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Function.Name != "weather" || !strings.Contains(string(got.Tools[0].Function.Parameters), `"city"`) || got.ToolChoice != "required" {
+		t.Errorf("tools = %+v, choice = %v", got.Tools, got.ToolChoice)
+	}
+	choice := resp.Choices[0]
+	if len(choice.ToolCalls) != 1 || choice.FuncCall == nil || choice.FuncCall.Arguments != `{"city":"Paris"}` || choice.StopReason != "tool_calls" {
+		t.Fatalf("choice = %+v", choice)
+	}
+
+	call := choice.ToolCalls[0]
+	history = append(history,
+		llms.MessageContent{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{call}},
+		llms.MessageContent{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{
+			llms.ToolCallResponse{ToolCallID: call.ID, Name: "weather", Content: `{"temp_c":18}`},
+		}},
+	)
+	resp, err = llm.GenerateContent(context.Background(), history, llms.WithTools(tools),
+		llms.WithToolChoice(llms.ToolChoice{Type: "function", Function: &llms.FunctionReference{Name: "weather"}}))
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if resp.Choices[0].Content != "It is 18°C in Paris." {
+		t.Errorf("choice = %+v", resp.Choices[0])
+	}
+	if m := got.Messages; len(m) != 3 || len(m[1].ToolCalls) != 1 || m[1].ToolCalls[0].ID != "call_1" || m[2].Role != "tool" || m[2].ToolCallID != "call_1" {
+		t.Errorf("messages = %+v", got.Messages)
+	}
+	if choice, _ := got.ToolChoice.(map[string]interface{}); choice["type"] != "function" {
+		t.Errorf("tool choice = %v", got.ToolChoice)
+	}
+}
+
+func TestGenerateContentStreaming(t *testing.T) {
+	srv := reliapitest.NewMockServer(t)
+	srv.HandleLLM(func(reliapi.LLMRequest) reliapitest.LLMReply {
+		return reliapitest.LLMReply{Content: "The capital is Paris."}
+	})
+	llm := New(srv.Client(), "openai")
+
+	var streamed strings.Builder
+	resp, err := llm.GenerateContent(context.Background(),
+		[]llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "Capital of France?")},
+		llms.WithStreamingFunc(func(_ context.Context, chunk []byte) error {
+			streamed.Write(chunk)
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	choice := resp.Choices[0]
+	if streamed.String() != "The capital is Paris." || choice.Content != streamed.String() || choice.GenerationInfo["CompletionTokens"] != 4 {
+		t.Errorf("streamed %q, choice = %+v", streamed.String(), choice)
+	}
+	if calls := srv.Requests(); len(calls) != 1 || !strings.Contains(string(calls[0].Body), `"stream":true`) {
+		t.Errorf("requests = %+v", calls)
+	}
+
+	// Stopping the stream fails the call with the function's error
+	stop := errors.New("enough")
+	_, err = llm.GenerateContent(context.Background(),
+		[]llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "Again?")},
+		llms.WithStreamingFunc(func(context.Context, []byte) error { return stop }))
+	if !errors.Is(err, stop) {
+		t.Errorf("err = %v", err)
+	}
+}
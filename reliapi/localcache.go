@@ -0,0 +1,310 @@
+package reliapi
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultLocalCacheTTL is how long WithLocalCache keeps a response whose
+// request sets no Cache TTL.
+const DefaultLocalCacheTTL = 5 * time.Minute
+
+// CacheStore is the storage of a client-side response cache (see
+// WithLocalCache). Implementations must be safe for concurrent use; an
+// entry past its TTL must read as missing.
+type CacheStore interface {
+	Get(key string) (value []byte, ok bool, err error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// WithLocalCache makes the client answer repeated cacheable requests from
+// store without calling the proxy. A response is stored only when the
+// proxy reported it cacheable (it carries a Meta.CacheKey and is neither
+// stale, truncated nor a dry run), for the request's Cache TTL or else
+// DefaultLocalCacheTTL; requests with a Cache of 0 are not stored. Hits
+// have Meta.CacheHit and Meta.LocalCacheHit set.
+//
+// Cacheable requests are those WithCoalescing coalesces, keyed the same
+// way and scoped to the proxy URL and API key, so one store can be shared
+// across clients. Requests carrying an IdempotencyKey, or every request
+// under WithAutoIdempotency, ask for a fresh execution and bypass the
+// store. Store errors are treated as misses.
+func WithLocalCache(store CacheStore) Option {
+	return func(c *Client) {
+		c.localCache = store
+	}
+}
+
+// localCacheScope is who a request's cached responses belong to: the API
+// key it sends, or for a request signed with WithHMACAuth the key ID it is
+// signed under, so clients sharing a store never share entries across
+// credentials.
+func (c *Client) localCacheScope(ctx context.Context) string {
+	apiKey := c.apiKeyFor(ctx)
+	if c.hmacKeyID != "" && apiKey == c.apiKey {
+		return "hmac:" + c.hmacKeyID
+	}
+	return apiKey
+}
+
+// withLocalCache answers a request whose request key is key from the local
+// cache, or calls fetch and stores its response. cacheable is false for
+// requests the proxy does not cache.
+func (c *Client) withLocalCache(ctx context.Context, key string, cacheable bool, idempotencyKey *string, cacheTTL *int, fetch func() (*ReliAPIResponse, error)) (*ReliAPIResponse, error) {
+	if c.localCache == nil || !cacheable || idempotencyKey != nil || c.idempotency == idempotencyRandom {
+		return fetch()
+	}
+	key = c.localKey(ctx, key)
+	if resp := c.localGet(key); resp != nil {
+		return resp, nil
+	}
+	resp, err := fetch()
+	if err == nil {
+		c.localSet(key, cacheTTL, resp)
+	}
+	return resp, err
+}
+
+// localKey is the store key of the request key key, scoped to the proxy
+// URL and the caller's credentials.
+func (c *Client) localKey(ctx context.Context, key string) string {
+	sum := sha256.Sum256([]byte(c.baseURL.String() + "\n" + c.localCacheScope(ctx) + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// localGet returns the stored response for key, or nil.
+func (c *Client) localGet(key string) *ReliAPIResponse {
+	raw, ok, err := c.localCache.Get(key)
+	if err != nil || !ok {
+		return nil
+	}
+	var resp ReliAPIResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		_ = c.localCache.Delete(key)
+		return nil
+	}
+	resp.Meta.CacheHit = true
+	resp.Meta.LocalCacheHit = true
+	return &resp
+}
+
+// localSet stores resp under key if the proxy marked it cacheable.
+func (c *Client) localSet(key string, cacheTTL *int, resp *ReliAPIResponse) {
+	if raw, ttl, ok := localEntry(cacheTTL, resp); ok {
+		_ = c.localCache.Set(key, raw, ttl)
+	}
+}
+
+// localEntry returns what the local cache stores of resp and for how long,
+// or false if resp is not to be stored.
+func localEntry(cacheTTL *int, resp *ReliAPIResponse) ([]byte, time.Duration, bool) {
+	m := resp.Meta
+	if m.CacheKey == "" || m.Stale || m.Truncated || m.DryRun {
+		return nil, 0, false
+	}
+	ttl := DefaultLocalCacheTTL
+	if cacheTTL != nil {
+		ttl = time.Duration(*cacheTTL) * time.Second
+	}
+	if ttl <= 0 {
+		return nil, 0, false
+	}
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return nil, 0, false
+	}
+	return raw, ttl, true
+}
+
+// MemoryCache is an in-memory CacheStore that evicts the least recently
+// used entry beyond its size bound.
+type MemoryCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List // of *memoryEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryCache returns a MemoryCache holding at most maxEntries entries;
+// maxEntries <= 0 means no bound.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{maxEntries: maxEntries, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get implements CacheStore.
+func (m *MemoryCache) Get(key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*memoryEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		m.order.Remove(el)
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+// Set implements CacheStore.
+func (m *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := &memoryEntry{key: key, value: append([]byte(nil), value...), expiresAt: time.Now().Add(ttl)}
+	if el, ok := m.entries[key]; ok {
+		el.Value = entry
+		m.order.MoveToFront(el)
+		return nil
+	}
+	m.entries[key] = m.order.PushFront(entry)
+	for m.maxEntries > 0 && m.order.Len() > m.maxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// Delete implements CacheStore.
+func (m *MemoryCache) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.order.Remove(el)
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// Len returns the number of entries, expired ones included until they are
+// next read.
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// FileCache is a CacheStore keeping one file per entry in a directory, so
+// cached responses survive restarts of CLI tools and test runs. Writes
+// replace files atomically, so concurrent readers, including other
+// processes sharing the directory, never see a partial entry.
+type FileCache struct {
+	dir string
+}
+
+// NewFileCache returns a FileCache in dir, creating it if needed.
+func NewFileCache(dir string) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("reliapi: create cache directory: %w", err)
+	}
+	return &FileCache{dir: dir}, nil
+}
+
+func (f *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:])+".entry")
+}
+
+// Get implements CacheStore.
+func (f *FileCache) Get(key string) ([]byte, bool, error) {
+	raw, err := os.ReadFile(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("reliapi: read cache entry: %w", err)
+	}
+	expiresAt, value, ok := parseFileEntry(raw)
+	if !ok || !time.Now().Before(expiresAt) {
+		// Left for Set to replace or Prune to remove: deleting it here
+		// could remove an entry another writer has just stored
+		return nil, false, nil
+	}
+	return value, true, nil
+}
+
+// parseFileEntry splits a FileCache entry, its expiry in Unix nanoseconds
+// followed by the value.
+func parseFileEntry(raw []byte) (time.Time, []byte, bool) {
+	if len(raw) < 8 {
+		return time.Time{}, nil, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(raw))), raw[8:], true
+}
+
+// Set implements CacheStore.
+func (f *FileCache) Set(key string, value []byte, ttl time.Duration) error {
+	tmp, err := os.CreateTemp(f.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("reliapi: write cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	var expiry [8]byte
+	binary.BigEndian.PutUint64(expiry[:], uint64(time.Now().Add(ttl).UnixNano()))
+	_, err = tmp.Write(append(expiry[:], value...))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path(key))
+	}
+	if err != nil {
+		return fmt.Errorf("reliapi: write cache entry: %w", err)
+	}
+	return nil
+}
+
+// Prune removes the expired and unreadable entries.
+func (f *FileCache) Prune() error {
+	names, err := filepath.Glob(filepath.Join(f.dir, "*.entry"))
+	if err != nil {
+		return fmt.Errorf("reliapi: list cache entries: %w", err)
+	}
+	now := time.Now()
+	for _, name := range names {
+		raw, err := os.ReadFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reliapi: read cache entry: %w", err)
+		}
+		if expiresAt, _, ok := parseFileEntry(raw); ok && now.Before(expiresAt) {
+			continue
+		}
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("reliapi: delete cache entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// Delete implements CacheStore.
+func (f *FileCache) Delete(key string) error {
+	if err := os.Remove(f.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("reliapi: delete cache entry: %w", err)
+	}
+	return nil
+}
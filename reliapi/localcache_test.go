@@ -0,0 +1,223 @@
+package reliapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLocalCache(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		meta := map[string]interface{}{"request_id": fmt.Sprintf("req_%d", n), "cache_key": "abc"}
+		data := map[string]interface{}{"content": "hi"}
+		if strings.HasSuffix(r.URL.Path, "/http") {
+			// "hello" in base64
+			data = map[string]interface{}{"status_code": 200, "body": "aGVsbG8="}
+			meta["response_encoding"] = BodyEncodingBase64
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": data, "meta": meta})
+	}, WithLocalCache(NewMemoryCache(10)))
+	ctx := context.Background()
+
+	first, err := c.ProxyLLM(ctx, llmReq("q"))
+	if err != nil || first.Meta.CacheHit || first.Meta.LocalCacheHit {
+		t.Fatalf("first = %+v, %v", first, err)
+	}
+	second, err := c.ProxyLLM(ctx, llmReq("q"))
+	if err != nil || !second.Meta.CacheHit || !second.Meta.LocalCacheHit || second.Meta.RequestID != "req_1" {
+		t.Fatalf("second = %+v, %v", second, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("calls = %d, want 1", n)
+	}
+
+	// A fresh idempotency key, or a zero Cache TTL, goes to the proxy
+	withKey := llmReq("q")
+	key := "fresh"
+	withKey.IdempotencyKey = &key
+	if resp, err := c.ProxyLLM(ctx, withKey); err != nil || resp.Meta.LocalCacheHit {
+		t.Errorf("with idempotency key = %+v, %v", resp, err)
+	}
+	noCache := llmReq("other")
+	zero := 0
+	noCache.Cache = &zero
+	for i := 0; i < 2; i++ {
+		if resp, err := c.ProxyLLM(ctx, noCache); err != nil || resp.Meta.LocalCacheHit {
+			t.Errorf("cache 0 = %+v, %v", resp, err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 4 {
+		t.Errorf("calls = %d, want 4", n)
+	}
+
+	// Binary bodies are decoded again on a hit
+	get := HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/img"}
+	for i := 0; i < 2; i++ {
+		resp, err := c.ProxyHTTP(ctx, get)
+		if err != nil {
+			t.Fatalf("ProxyHTTP: %v", err)
+		}
+		if body, _ := resp.DataMap()["body"].([]byte); !bytes.Equal(body, []byte("hello")) || resp.Meta.LocalCacheHit != (i == 1) {
+			t.Errorf("response %d = %+v", i, resp)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 5 {
+		t.Errorf("calls = %d, want 5", n)
+	}
+}
+
+func TestLocalCacheOnlyStoresCacheable(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{"request_id": "req_1"}})
+	}, WithLocalCache(NewMemoryCache(10)))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.ProxyLLM(context.Background(), llmReq("q")); err != nil {
+			t.Fatalf("ProxyLLM: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls = %d, want 2 (responses without a cache key are not stored)", n)
+	}
+}
+
+func TestLocalCacheScopedBySigningKey(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": r.Header.Get(HeaderKeyID)},
+			"meta":    map[string]interface{}{"cache_key": "abc"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	store := NewMemoryCache(10)
+	for i, keyID := range []string{"team-a", "team-b", "team-a"} {
+		c, err := NewClient(srv.URL, "", WithHMACAuth(keyID, "secret-"+keyID), WithLocalCache(store))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.ProxyLLM(context.Background(), llmReq("q"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text, _ := resp.CompletionText(); text != keyID || resp.Meta.LocalCacheHit != (i == 2) {
+			t.Errorf("%s: content %q, local hit %v", keyID, text, resp.Meta.LocalCacheHit)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	m := NewMemoryCache(2)
+	_ = m.Set("a", []byte("1"), time.Hour)
+	_ = m.Set("b", []byte("2"), time.Hour)
+	if _, ok, _ := m.Get("a"); !ok {
+		t.Fatal("a missing")
+	}
+	// b is now the least recently used
+	_ = m.Set("c", []byte("3"), time.Hour)
+	if _, ok, _ := m.Get("b"); ok {
+		t.Error("b not evicted")
+	}
+	if v, ok, _ := m.Get("a"); !ok || string(v) != "1" || m.Len() != 2 {
+		t.Errorf("a = %q, %v; len %d", v, ok, m.Len())
+	}
+
+	_ = m.Set("short", []byte("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := m.Get("short"); ok {
+		t.Error("expired entry returned")
+	}
+	_ = m.Delete("a")
+	if _, ok, _ := m.Get("a"); ok {
+		t.Error("deleted entry returned")
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewFileCache(dir)
+	if err != nil {
+		t.Fatalf("NewFileCache: %v", err)
+	}
+	if err := f.Set("k", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	_ = f.Set("short", []byte("x"), time.Millisecond)
+
+	// A new store over the same directory sees the entries
+	reopened, _ := NewFileCache(dir)
+	if v, ok, err := reopened.Get("k"); err != nil || !ok || string(v) != "value" {
+		t.Errorf("Get = %q, %v, %v", v, ok, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := reopened.Get("short"); ok {
+		t.Error("expired entry returned")
+	}
+	if err := reopened.Prune(); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("entries after Prune = %v, %v", entries, err)
+	}
+	if err := reopened.Delete("k"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := reopened.Delete("k"); err != nil {
+		t.Errorf("Delete of a missing entry: %v", err)
+	}
+	if _, ok, _ := f.Get("k"); ok {
+		t.Error("deleted entry returned")
+	}
+}
+
+func TestCacheStoreConcurrentAccess(t *testing.T) {
+	files, err := NewFileCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]CacheStore{"memory": NewMemoryCache(4), "file": files} {
+		t.Run(name, func(t *testing.T) {
+			values := map[string]bool{}
+			for i := 0; i < 8; i++ {
+				values[strings.Repeat(string(rune('a'+i)), 512)] = true
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(v string) {
+					defer wg.Done()
+					for j := 0; j < 50; j++ {
+						if err := store.Set("same", []byte(v), time.Hour); err != nil {
+							t.Errorf("Set: %v", err)
+							return
+						}
+						got, ok, err := store.Get("same")
+						// Every read sees one whole value, never a mix
+						if err != nil || !ok || !values[string(got)] {
+							t.Errorf("Get = %.20q, %v, %v", got, ok, err)
+							return
+						}
+					}
+				}(strings.Repeat(string(rune('a'+i)), 512))
+			}
+			wg.Wait()
+		})
+	}
+}
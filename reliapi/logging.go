@@ -0,0 +1,162 @@
+package reliapi
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// WithLogger logs every proxy call to l, one record per logical request:
+// "reliapi request" at Info when it succeeded and at Error when it failed.
+// Records carry the attributes
+//
+//	op, target, model, request_id, duration_ms, cache_hit, attempts, cost_usd
+//
+// and, for failures, error, error_code and status_code. duration_ms is the
+// time the client spent on the call; attempts counts the HTTP requests sent
+// to the proxy, so WithRetry resends show. Every attempt is also logged, as
+// "reliapi attempt" at Debug with op, target, attempt and status_code or
+// error. Batch items are logged as requests of their own target. A
+// Subscribe stream that drops or is refused on reconnection is logged as
+// "reliapi event stream interrupted" or "reliapi event stream refused" at
+// Warn, with error, as is "reliapi event skipped" for an event that
+// doesn't decode.
+//
+// Message content is never logged unless WithLogPrompts asks for it. l is
+// called synchronously, from the goroutine making the call.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// WithLogPrompts adds the messages of LLM requests to their records, as a
+// prompt attribute of "role: content" lines cut to maxChars characters.
+// The text goes through the WithRedactor Redactor, if any, first. It only
+// applies with WithLogger.
+func WithLogPrompts(maxChars int) Option {
+	return func(c *Client) {
+		c.logPromptChars = maxChars
+	}
+}
+
+// logAttempt logs the n-th HTTP request sent for the call.
+func (in *callInstrument) logAttempt(n int, resp *http.Response, err error) {
+	l := in.c.logger
+	if !l.Enabled(in.ctx, slog.LevelDebug) {
+		return
+	}
+	outcome := slog.Int("status_code", 0)
+	if err != nil {
+		outcome = slog.String("error", err.Error())
+	} else if resp != nil {
+		outcome = slog.Int("status_code", resp.StatusCode)
+	}
+	l.LogAttrs(in.ctx, slog.LevelDebug, "reliapi attempt",
+		slog.String("op", in.method),
+		slog.String("target", in.target),
+		slog.Int("attempt", n),
+		outcome,
+	)
+}
+
+// logRequest logs the outcome of a logical request to target. meta is nil
+// when it produced no response.
+func (in *callInstrument) logRequest(target string, meta *Meta, err error) {
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+	}
+	l := in.c.logger
+	if !l.Enabled(in.ctx, level) {
+		return
+	}
+	var model, requestID string
+	var cacheHit bool
+	var cost float64
+	if meta != nil {
+		model, requestID, cacheHit = meta.Model, meta.RequestID, meta.CacheHit
+		if meta.CostUSD != nil {
+			cost = *meta.CostUSD
+		}
+	}
+	var apiErr *APIError
+	if err != nil && errors.As(err, &apiErr) && requestID == "" {
+		requestID = apiErr.RequestID
+	}
+	// A fixed array keeps the attributes off the heap
+	attrs := [12]slog.Attr{
+		slog.String("op", in.method),
+		slog.String("target", target),
+		slog.String("model", model),
+		slog.String("request_id", requestID),
+		slog.Int64("duration_ms", time.Since(in.start).Milliseconds()),
+		slog.Bool("cache_hit", cacheHit),
+		slog.Int("attempts", in.attempts),
+		slog.Float64("cost_usd", cost),
+	}
+	n := 8
+	if err != nil {
+		if apiErr != nil {
+			attrs[n] = slog.String("error_code", apiErr.Code)
+			attrs[n+1] = slog.Int("status_code", apiErr.StatusCode)
+			n += 2
+		}
+		attrs[n] = slog.String("error", err.Error())
+		n++
+	}
+	if in.c.logPromptChars > 0 && in.messages != nil {
+		attrs[n] = slog.String("prompt", in.c.logPrompt(in.messages))
+		n++
+	}
+	l.LogAttrs(in.ctx, level, "reliapi request", attrs[:n]...)
+}
+
+// logPrompt formats messages for the prompt attribute.
+func (c *Client) logPrompt(messages []ChatMessage) string {
+	var sb strings.Builder
+	for i, m := range messages {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(m.Role)
+		sb.WriteString(": ")
+		sb.WriteString(m.Content)
+		for _, part := range m.Parts {
+			sb.WriteString(part.Text)
+		}
+		if sb.Len() >= c.logPromptChars*utf8.UTFMax {
+			break
+		}
+	}
+	text := sb.String()
+	if c.redactor != nil {
+		text = c.redactor.Redact(text, newRedactionVault())
+	}
+	return truncateChars(text, c.logPromptChars)
+}
+
+// truncateChars cuts s to n characters, marking the cut with "…".
+func truncateChars(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	i := 0
+	for j := range s {
+		if i == n {
+			return s[:j] + "…"
+		}
+		i++
+	}
+	return s
+}
+
+// logPrompts keeps the messages of an LLM call for its record.
+func (in *callInstrument) logPrompts(messages []ChatMessage) {
+	if in != nil && in.c.logger != nil && in.c.logPromptChars > 0 {
+		in.messages = messages
+	}
+}
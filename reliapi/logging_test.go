@@ -0,0 +1,130 @@
+package reliapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logRecords decodes the JSON records written to buf.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("record %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestLoggerRecordsRequests(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls == 1 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"detail": "unavailable"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true, "data": map[string]interface{}{"content": "secret answer"},
+			"meta": map[string]interface{}{"request_id": "req_1", "model": "gpt-4o-mini", "cache_hit": true, "cost_usd": 0.002},
+		})
+	}, WithLogger(logger), WithRetry(2, time.Millisecond))
+	recordSleeps(c)
+
+	// Keyed, so the 503 is retried
+	req, key := llmReq("my secret prompt"), "k1"
+	req.IdempotencyKey = &key
+	if _, err := c.ProxyLLM(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	records := logRecords(t, &buf)
+	if len(records) != 3 {
+		t.Fatalf("records = %v", records)
+	}
+	for i, status := range []float64{503, 200} {
+		if r := records[i]; r["msg"] != "reliapi attempt" || r["level"] != "DEBUG" || r["attempt"] != float64(i+1) || r["status_code"] != status {
+			t.Errorf("attempt record %d = %v", i, r)
+		}
+	}
+	want := map[string]interface{}{
+		"level": "INFO", "msg": "reliapi request", "op": OpProxyLLM, "target": "openai", "model": "gpt-4o-mini",
+		"request_id": "req_1", "cache_hit": true, "attempts": float64(2), "cost_usd": 0.002,
+	}
+	request := records[2]
+	for k, v := range want {
+		if request[k] != v {
+			t.Errorf("%s = %v, want %v", k, request[k], v)
+		}
+	}
+	if _, ok := request["duration_ms"]; !ok {
+		t.Error("no duration_ms")
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("message content logged: %s", buf.String())
+	}
+}
+
+func TestLoggerRecordsFailures(t *testing.T) {
+	var buf bytes.Buffer
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "req_2")
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]interface{}{"type": "budget_error", "code": CodeBudgetExceeded, "message": "over budget"},
+		})
+	}, WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+
+	if _, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/"}); err == nil {
+		t.Fatal("no error")
+	}
+	records := logRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("records = %v", records)
+	}
+	r := records[0]
+	if r["level"] != "ERROR" || r["op"] != OpProxyHTTP || r["error_code"] != CodeBudgetExceeded || r["status_code"] != float64(400) || r["request_id"] != "req_2" {
+		t.Errorf("record = %v", r)
+	}
+	if msg, _ := r["error"].(string); !strings.Contains(msg, "over budget") {
+		t.Errorf("error = %q", msg)
+	}
+}
+
+func TestLogPrompts(t *testing.T) {
+	var buf bytes.Buffer
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{}})
+	}, WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))), WithLogPrompts(30), WithRedactor(NewPatternRedactor(EmailPattern)))
+
+	req := llmReq("mail ana@example.com about the long overdue invoice")
+	if _, err := c.ProxyLLM(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	prompt, _ := logRecords(t, &buf)[0]["prompt"].(string)
+	if prompt != "user: mail [EMAIL_1] about the…" {
+		t.Errorf("prompt = %q", prompt)
+	}
+}
+
+// BenchmarkLogRequest is the cost of the record of one request.
+func BenchmarkLogRequest(b *testing.B) {
+	c := &Client{logger: slog.New(slog.NewJSONHandler(io.Discard, nil))}
+	cost := 0.002
+	meta := &Meta{RequestID: "req_1", Model: "gpt-4o-mini", CostUSD: &cost}
+	in := &callInstrument{c: c, ctx: context.Background(), target: "openai", method: OpProxyLLM, start: time.Now(), attempts: 1}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		in.logRequest(in.target, meta, nil)
+	}
+}
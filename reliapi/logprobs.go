@@ -0,0 +1,85 @@
+package reliapi
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+)
+
+// MaxTopLogprobs is the most alternatives LLMRequest.TopLogprobs may ask
+// for per token.
+const MaxTopLogprobs = 20
+
+// TokenLogprob is the log probability of one generated token. With
+// LLMRequest.TopLogprobs, TopAlternatives are the likeliest tokens at its
+// position, the generated one among them, most likely first.
+type TokenLogprob struct {
+	Token           string         `json:"token"`
+	Logprob         float64        `json:"logprob"`
+	TopAlternatives []TokenLogprob `json:"top_logprobs,omitempty"`
+}
+
+// Probability is exp(Logprob).
+func (t TokenLogprob) Probability() float64 {
+	return math.Exp(t.Logprob)
+}
+
+// tokenLogprobs decodes the logprobs of a choice, an OpenAI
+// {"content": [...]} object or the proxy's normalized list.
+type tokenLogprobs []TokenLogprob
+
+func (l *tokenLogprobs) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		var obj struct {
+			Content []TokenLogprob `json:"content"`
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		*l = obj.Content
+		return nil
+	}
+	return json.Unmarshal(data, (*[]TokenLogprob)(l))
+}
+
+// ChoiceConfidence is the mean probability of the choice's tokens, the
+// exp of each Logprob averaged, from 0 to 1. It reports false for a choice
+// without Logprobs, as when the request didn't set LLMRequest.Logprobs.
+func (ch Choice) ChoiceConfidence() (float64, bool) {
+	if len(ch.Logprobs) == 0 {
+		return 0, false
+	}
+	var sum float64
+	for _, t := range ch.Logprobs {
+		sum += t.Probability()
+	}
+	return sum / float64(len(ch.Logprobs)), true
+}
+
+// LabelProbability is the probability that the model answered label, for a
+// classification prompt whose answer is a single token: the probability
+// mass of the first token's alternatives that are label up to case and
+// surrounding whitespace, so "Yes", " yes" and "YES" all count for "yes".
+// Without TopAlternatives only the generated token counts. It reports false
+// for a choice without Logprobs.
+func (ch Choice) LabelProbability(label string) (float64, bool) {
+	if len(ch.Logprobs) == 0 {
+		return 0, false
+	}
+	first := ch.Logprobs[0]
+	candidates := first.TopAlternatives
+	if len(candidates) == 0 {
+		candidates = []TokenLogprob{first}
+	}
+	label = strings.TrimSpace(label)
+	seen := make(map[string]bool, len(candidates))
+	var p float64
+	for _, t := range candidates {
+		if seen[t.Token] || !strings.EqualFold(strings.TrimSpace(t.Token), label) {
+			continue
+		}
+		seen[t.Token] = true
+		p += t.Probability()
+	}
+	return math.Min(p, 1), true
+}
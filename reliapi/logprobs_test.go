@@ -0,0 +1,147 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func approxEqual(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+var logprobsOn = func() *bool { on := true; return &on }()
+
+func TestLogprobsOpenAI(t *testing.T) {
+	resp := &ReliAPIResponse{Data: rawData(t, loadFixture(t, "openai_logprobs.json"))}
+	c, err := resp.Completion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := c.Choices[0]
+	if len(choice.Logprobs) != 1 || choice.Logprobs[0].Token != "Positive" || len(choice.Logprobs[0].TopAlternatives) != 5 {
+		t.Fatalf("Logprobs = %+v", choice.Logprobs)
+	}
+
+	confidence, ok := choice.ChoiceConfidence()
+	if !ok || !approxEqual(confidence, math.Exp(-0.0512)) {
+		t.Errorf("ChoiceConfidence = %v, %v", confidence, ok)
+	}
+	// "Positive", "positive" and " Positive" are all the label
+	for label, want := range map[string]float64{
+		"positive":   math.Exp(-0.0512) + math.Exp(-3.4021) + math.Exp(-5.1187),
+		" POSITIVE ": math.Exp(-0.0512) + math.Exp(-3.4021) + math.Exp(-5.1187),
+		"negative":   math.Exp(-5.9343),
+		"mixed":      0,
+	} {
+		if got, ok := choice.LabelProbability(label); !ok || !approxEqual(got, want) {
+			t.Errorf("LabelProbability(%q) = %v, %v, want %v", label, got, ok, want)
+		}
+	}
+}
+
+func TestLogprobsNormalized(t *testing.T) {
+	resp := &ReliAPIResponse{Data: []byte(`{"content": "Yes it is", "finish_reason": "stop", "logprobs": [
+		{"token": "Yes", "logprob": -0.1},
+		{"token": " it", "logprob": -0.5},
+		{"token": " is", "logprob": -0.2}
+	]}`)}
+	c, err := resp.Completion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := c.Choices[0]
+	confidence, ok := choice.ChoiceConfidence()
+	if want := (math.Exp(-0.1) + math.Exp(-0.5) + math.Exp(-0.2)) / 3; !ok || !approxEqual(confidence, want) {
+		t.Errorf("ChoiceConfidence = %v, want %v", confidence, want)
+	}
+	// Without alternatives, only the generated token counts
+	if p, ok := choice.LabelProbability("yes"); !ok || !approxEqual(p, math.Exp(-0.1)) {
+		t.Errorf("LabelProbability = %v, %v", p, ok)
+	}
+	if p, _ := choice.LabelProbability("no"); p != 0 {
+		t.Errorf("LabelProbability(no) = %v", p)
+	}
+
+	// Not asked for
+	plain := Choice{Message: AssistantMessage("Yes")}
+	if _, ok := plain.ChoiceConfidence(); ok {
+		t.Error("ChoiceConfidence without logprobs")
+	}
+	if _, ok := plain.LabelProbability("yes"); ok {
+		t.Error("LabelProbability without logprobs")
+	}
+}
+
+func TestLogprobsStream(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		events []string
+	}{
+		{"proxy", []string{
+			"event: chunk\ndata: {\"index\": 0, \"delta\": \"Hi\", \"logprobs\": [{\"token\": \"Hi\", \"logprob\": -0.25}]}\n\n",
+			"event: chunk\ndata: {\"index\": 1, \"delta\": \" there\", \"logprobs\": [{\"token\": \" there\", \"logprob\": -0.75, \"top_logprobs\": [{\"token\": \" there\", \"logprob\": -0.75}]}]}\n\n",
+			"event: done\ndata: {\"finish_reason\": \"stop\", \"usage\": {\"prompt_tokens\": 3, \"completion_tokens\": 2}}\n\n",
+		}},
+		{"openai", []string{
+			"data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"},\"logprobs\":{\"content\":[{\"token\":\"Hi\",\"logprob\":-0.25,\"bytes\":[72,105],\"top_logprobs\":[]}]},\"finish_reason\":null}]}\n\n",
+			"data: {\"choices\":[{\"delta\":{\"content\":\" there\"},\"logprobs\":{\"content\":[{\"token\":\" there\",\"logprob\":-0.75,\"top_logprobs\":[{\"token\":\" there\",\"logprob\":-0.75}]}]},\"finish_reason\":\"stop\"}]}\n\n",
+			"data: [DONE]\n\n",
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, sseHandler(t, tt.events, false))
+			s, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai", Logprobs: logprobsOn})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			chunk, err := s.Recv()
+			if err != nil || len(chunk.Logprobs) != 1 || chunk.Logprobs[0].Token != "Hi" {
+				t.Fatalf("first chunk = %+v, %v", chunk, err)
+			}
+			if _, err := collect(t, s); !errors.Is(err, io.EOF) {
+				t.Fatalf("err = %v", err)
+			}
+			logprobs := s.Logprobs()
+			if len(logprobs) != 2 || logprobs[1].Token != " there" || len(logprobs[1].TopAlternatives) != 1 {
+				t.Fatalf("Logprobs = %+v", logprobs)
+			}
+			confidence, _ := Choice{Logprobs: logprobs}.ChoiceConfidence()
+			if want := (math.Exp(-0.25) + math.Exp(-0.75)) / 2; !approxEqual(confidence, want) {
+				t.Errorf("confidence = %v, want %v", confidence, want)
+			}
+		})
+	}
+}
+
+func TestValidateLogprobs(t *testing.T) {
+	table := BundledModels()
+	top := func(n int) *int { return &n }
+	for _, tt := range []struct {
+		name  string
+		req   LLMRequest
+		field string
+	}{
+		{"supported", LLMRequest{Model: "gpt-4o-mini", Logprobs: logprobsOn, TopLogprobs: top(5)}, ""},
+		{"anthropic", LLMRequest{Model: "claude-3-5-haiku", Logprobs: logprobsOn}, "logprobs"},
+		{"reasoning", LLMRequest{Model: "o3-mini", TopLogprobs: top(1)}, "logprobs"},
+		{"without logprobs", LLMRequest{Model: "gpt-4o", TopLogprobs: top(3)}, "top_logprobs"},
+		{"too many", LLMRequest{Model: "gpt-4o", Logprobs: logprobsOn, TopLogprobs: top(25)}, "top_logprobs"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Messages = []ChatMessage{UserMessage("Classify: great product")}
+			issues := table.Validate(tt.req)
+			if tt.field == "" {
+				if len(issues) != 0 {
+					t.Errorf("issues = %+v", issues)
+				}
+				return
+			}
+			if len(issues) != 1 || issues[0].Field != tt.field {
+				t.Errorf("issues = %+v, want one for %s", issues, tt.field)
+			}
+		})
+	}
+}
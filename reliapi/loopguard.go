@@ -0,0 +1,261 @@
+package reliapi
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrLoopDetected is matched by a LoopDetectedError.
+var ErrLoopDetected = errors.New("reliapi: request loop detected")
+
+// LoopDetectedError is returned under WithLoopGuard for an LLM request
+// sent more often than the guard allows. It matches ErrLoopDetected, and
+// is not retriable: the same request sent again fails the same way until
+// the window has passed.
+type LoopDetectedError struct {
+	// Hash is the request's LoopHash.
+	Hash string
+	// Count is how many times the request was sent in the last Window,
+	// this one included; an estimate, never below the true count.
+	Count  int
+	Window time.Duration
+	// FirstRequestID and LastRequestID are the request IDs of the first
+	// and latest of its answers in the window, empty when the guard no
+	// longer knows them.
+	FirstRequestID string
+	LastRequestID  string
+}
+
+func (e *LoopDetectedError) Error() string {
+	return fmt.Sprintf("%v: request %.12s sent %d times in %v", ErrLoopDetected, e.Hash, e.Count, e.Window)
+}
+
+// Is reports whether target is ErrLoopDetected.
+func (e *LoopDetectedError) Is(target error) bool { return target == ErrLoopDetected }
+
+// LoopGuard configures WithLoopGuard.
+type LoopGuard struct {
+	// Threshold is how many times a request may be sent per Window; the
+	// ones beyond it fail with a *LoopDetectedError.
+	Threshold int
+	Window    time.Duration
+	// Allow lists the LoopHash of requests never limited, such as
+	// health-check prompts.
+	Allow []string
+	// OnLoop is called when a request first trips the guard, and again
+	// when it trips it after a Window without doing so, with the error
+	// the call fails with.
+	OnLoop func(ctx context.Context, err *LoopDetectedError)
+	// Width is the number of counters per row of the guard's sketch,
+	// 1024 when zero; see WithLoopGuard.
+	Width int
+}
+
+// Sizes of a loop guard: the rows of its sketch, the sub-windows its
+// window slides by, and the requests it remembers the request IDs of.
+const (
+	loopSketchDepth   = 4
+	loopSketchBuckets = 8
+	loopGuardDefaultW = 1024
+	loopGuardMaxIDs   = 1024
+)
+
+// WithLoopGuard throttles identical LLM requests, as an agent stuck in a
+// loop sends them: ProxyLLM and ProxyLLMStream calls with a request sent
+// more than g.Threshold times in the last g.Window fail with a
+// *LoopDetectedError, independently of rate limits. Requests are identical
+// when their LoopHash is; requests in g.Allow, and those with
+// LLMRequest.AllowRepeats, are not limited nor counted.
+//
+// Counts are kept in a count-min sketch of four rows of g.Width counters
+// per eighth of the window, so memory doesn't grow with the number of
+// distinct requests (128 KiB with the default width) and the window
+// slides by eighths. The sketch never undercounts, so a loop is always
+// caught, but it may overcount: of the N requests sent in a window, one
+// sent c times is rejected with probability at most
+// (N / (g.Width × (g.Threshold − c)))⁴, e.g. about one in 700 for 10⁴
+// requests, a Threshold of 100 and c = 50, and one in 10⁶ with a Width of
+// 8192. The request IDs of a LoopDetectedError are known for the 1024
+// requests sent most recently.
+func WithLoopGuard(g LoopGuard) Option {
+	return func(c *Client) {
+		if g.Threshold < 1 || g.Window <= 0 {
+			c.loopGuard = nil
+			return
+		}
+		if g.Width <= 0 {
+			g.Width = loopGuardDefaultW
+		}
+		c.loopGuard = newLoopGuard(g)
+	}
+}
+
+// LoopHash returns the hash WithLoopGuard counts req by: its canonical
+// form as for CanonicalCacheKey, but of the request itself even when a
+// CacheKey or CacheVary is set.
+func LoopHash(req LLMRequest) (string, error) {
+	req, err := withPromptMessages(req)
+	if err != nil {
+		return "", err
+	}
+	return canonicalLLMKey(req, false)
+}
+
+type loopGuard struct {
+	LoopGuard
+	allow map[string]bool
+	now   func() time.Time
+
+	mu sync.Mutex
+	// counts[b][r] are the counters of row r of the sketch for sub-window
+	// epochs[b]
+	counts [loopSketchBuckets][loopSketchDepth][]uint32
+	epochs [loopSketchBuckets]int64
+	ids    *list.List // of *loopRequests, most recent first
+	byHash map[string]*list.Element
+}
+
+// loopRequests is what a loopGuard knows of the answers to a request.
+type loopRequests struct {
+	hash        string
+	first, last string
+	firstAt     time.Time
+	trippedAt   time.Time // zero until it trips the guard
+}
+
+func newLoopGuard(g LoopGuard) *loopGuard {
+	l := &loopGuard{LoopGuard: g, allow: make(map[string]bool), now: time.Now, ids: list.New(), byHash: make(map[string]*list.Element)}
+	for _, h := range g.Allow {
+		l.allow[h] = true
+	}
+	for b := range l.counts {
+		for r := range l.counts[b] {
+			l.counts[b][r] = make([]uint32, g.Width)
+		}
+		l.epochs[b] = -1
+	}
+	return l
+}
+
+// admitLoop runs req past the WithLoopGuard guard, returning its hash for
+// recording its answer.
+func (c *Client) admitLoop(ctx context.Context, req LLMRequest) (string, error) {
+	if c.loopGuard == nil {
+		return "", nil
+	}
+	return c.loopGuard.admit(ctx, req)
+}
+
+// admit counts req and fails it if it is sent too often, returning its
+// hash for record ("" when it isn't counted).
+func (l *loopGuard) admit(ctx context.Context, req LLMRequest) (string, error) {
+	if req.AllowRepeats {
+		return "", nil
+	}
+	hash, err := canonicalLLMKey(req, false)
+	if err != nil || l.allow[hash] {
+		return "", err
+	}
+	digest, _ := hex.DecodeString(hash)
+	now := l.now()
+
+	l.mu.Lock()
+	count := l.add(digest, now)
+	if count <= l.Threshold {
+		l.mu.Unlock()
+		return hash, nil
+	}
+	loop := &LoopDetectedError{Hash: hash, Count: count, Window: l.Window}
+	notify := true
+	if el, ok := l.byHash[hash]; ok {
+		r := el.Value.(*loopRequests)
+		if now.Sub(r.firstAt) < l.Window {
+			loop.FirstRequestID, loop.LastRequestID = r.first, r.last
+		}
+		notify = r.trippedAt.IsZero() || now.Sub(r.trippedAt) >= l.Window
+		r.trippedAt = now
+		l.ids.MoveToFront(el)
+	} else {
+		l.remember(&loopRequests{hash: hash, firstAt: now, trippedAt: now})
+	}
+	l.mu.Unlock()
+	if notify && l.OnLoop != nil {
+		l.OnLoop(ctx, loop)
+	}
+	return "", loop
+}
+
+// add counts digest in the current sub-window and returns its estimated
+// count over the window. l.mu is held.
+func (l *loopGuard) add(digest []byte, now time.Time) int {
+	span := l.Window / loopSketchBuckets
+	if span <= 0 {
+		span = 1
+	}
+	epoch := now.UnixNano() / int64(span)
+	current := int(epoch % loopSketchBuckets)
+	if l.epochs[current] != epoch {
+		for r := range l.counts[current] {
+			clear(l.counts[current][r])
+		}
+		l.epochs[current] = epoch
+	}
+	var cells [loopSketchDepth]int
+	for r := range cells {
+		cells[r] = int(binary.BigEndian.Uint64(digest[8*r:]) % uint64(l.Width))
+		l.counts[current][r][cells[r]]++
+	}
+
+	// The sum of each sub-window's minimum bounds the count from above
+	// more tightly than the minimum of the sums
+	total := 0
+	for b := range l.counts {
+		if epoch-l.epochs[b] >= loopSketchBuckets {
+			continue
+		}
+		least := l.counts[b][0][cells[0]]
+		for r := 1; r < loopSketchDepth; r++ {
+			least = min(least, l.counts[b][r][cells[r]])
+		}
+		total += int(least)
+	}
+	return total
+}
+
+// record notes requestID as the latest answer to the request of hash.
+func (l *loopGuard) record(hash, requestID string) {
+	if hash == "" || requestID == "" {
+		return
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.byHash[hash]
+	if !ok {
+		l.remember(&loopRequests{hash: hash, first: requestID, last: requestID, firstAt: now})
+		return
+	}
+	r := el.Value.(*loopRequests)
+	if r.first == "" || now.Sub(r.firstAt) >= l.Window {
+		r.first, r.firstAt = requestID, now
+	}
+	r.last = requestID
+	l.ids.MoveToFront(el)
+}
+
+// remember adds r, forgetting the least recent request beyond
+// loopGuardMaxIDs. l.mu is held.
+func (l *loopGuard) remember(r *loopRequests) {
+	l.byHash[r.hash] = l.ids.PushFront(r)
+	if l.ids.Len() > loopGuardMaxIDs {
+		oldest := l.ids.Back()
+		l.ids.Remove(oldest)
+		delete(l.byHash, oldest.Value.(*loopRequests).hash)
+	}
+}
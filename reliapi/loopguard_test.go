@@ -0,0 +1,131 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoopGuard(t *testing.T) {
+	var calls atomic.Int32
+	var loops []*LoopDetectedError
+	health := LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("ping")}}
+	healthHash, err := LoopHash(health)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "again"},
+			"meta":    map[string]interface{}{"request_id": fmt.Sprintf("req_%d", calls.Add(1))},
+		})
+	}, WithLoopGuard(LoopGuard{Threshold: 3, Window: time.Minute, Allow: []string{healthHash}, OnLoop: func(_ context.Context, err *LoopDetectedError) {
+		loops = append(loops, err)
+	}}))
+	now := time.Now()
+	c.loopGuard.now = func() time.Time { return now }
+	ctx := context.Background()
+	req := LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("what next?")}}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.ProxyLLM(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = c.ProxyLLM(ctx, req)
+	var loop *LoopDetectedError
+	hash, _ := LoopHash(req)
+	if !errors.As(err, &loop) || !errors.Is(err, ErrLoopDetected) || IsRetriable(err) {
+		t.Fatalf("err = %v", err)
+	}
+	if loop.Hash != hash || loop.Count != 4 || loop.Window != time.Minute || loop.FirstRequestID != "req_1" || loop.LastRequestID != "req_3" {
+		t.Errorf("loop = %+v", loop)
+	}
+	// Streams count too, and the event fires once
+	if _, err := c.ProxyLLMStream(ctx, req); !errors.Is(err, ErrLoopDetected) {
+		t.Errorf("stream err = %v", err)
+	}
+	if len(loops) != 1 || loops[0] != loop || calls.Load() != 3 {
+		t.Errorf("%d events, %d calls", len(loops), calls.Load())
+	}
+
+	// Other requests, allowed ones and overrides go through
+	other := req
+	other.Messages = []ChatMessage{UserMessage("what now?")}
+	repeated := req
+	repeated.AllowRepeats = true
+	for _, r := range []LLMRequest{other, health, health, health, health, repeated} {
+		if _, err := c.ProxyLLM(ctx, r); err != nil {
+			t.Errorf("%+v: %v", r.Messages, err)
+		}
+	}
+	// Reusing the cache key of a request doesn't make another the same
+	key := "shared"
+	other.CacheKey, req.CacheKey = &key, &key
+	if h, _ := LoopHash(other); h == hash {
+		t.Error("CacheKey is part of LoopHash")
+	}
+
+	// Once the window has passed, the request is let through again, and
+	// trips the guard anew
+	now = now.Add(time.Minute)
+	req.CacheKey = nil
+	for i := 0; i < 3; i++ {
+		if _, err := c.ProxyLLM(ctx, req); err != nil {
+			t.Fatalf("after the window: %v", err)
+		}
+	}
+	if _, err := c.ProxyLLM(ctx, req); !errors.As(err, &loop) || loop.Count != 4 || loop.FirstRequestID != "req_10" || len(loops) != 2 {
+		t.Errorf("err = %v, %d events", err, len(loops))
+	}
+	// An eighth of a window later, all of them still count
+	now = now.Add(time.Minute / 8)
+	if _, err := c.ProxyLLM(ctx, req); !errors.As(err, &loop) || loop.Count != 5 || len(loops) != 2 {
+		t.Errorf("err = %v, %d events", err, len(loops))
+	}
+}
+
+func TestLoopGuardFalsePositives(t *testing.T) {
+	// 5000 distinct requests, each sent 4 times, and one in a loop
+	const (
+		distinct  = 5000
+		repeats   = 4
+		threshold = 20
+		width     = 4096
+	)
+	g := newLoopGuard(LoopGuard{Threshold: threshold, Window: time.Hour, Width: width})
+	ctx := context.Background()
+	request := func(i int) LLMRequest {
+		return LLMRequest{Target: "openai", Model: "gpt-4o-mini", Messages: []ChatMessage{UserMessage(fmt.Sprintf("prompt %d", i))}}
+	}
+	rejected := 0
+	for r := 0; r < repeats; r++ {
+		for i := 0; i < distinct; i++ {
+			if _, err := g.admit(ctx, request(i)); err != nil {
+				rejected++
+			}
+		}
+	}
+	n := float64(distinct * repeats)
+	bound := math.Pow(n/(width*float64(threshold-repeats)), 4)
+	if rate := float64(rejected) / n; rate > bound {
+		t.Errorf("false positive rate %g over the bound %g", rate, bound)
+	}
+	t.Logf("%d of %g rejected, bound %g", rejected, n, bound*n)
+
+	// The loop is never missed, though an overcount may trip it early
+	loop := request(-1)
+	var err error
+	for i := 0; i <= threshold; i++ {
+		_, err = g.admit(ctx, loop)
+	}
+	if !errors.Is(err, ErrLoopDetected) {
+		t.Errorf("request sent %d times: %v", threshold+1, err)
+	}
+}
@@ -0,0 +1,60 @@
+package reliapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maintenanceHeader is the mode of a proxy in maintenance, "read_only" or
+// "full", set on its MAINTENANCE responses.
+const maintenanceHeader = "X-ReliAPI-Maintenance"
+
+// ErrMaintenance matches, with errors.Is, the *APIError of a proxy in
+// maintenance mode, as during an upgrade. AsMaintenance returns when to
+// retry and whether reads are still served.
+var ErrMaintenance = errors.New("reliapi: proxy in maintenance")
+
+// Maintenance is the detail of a MAINTENANCE error.
+type Maintenance struct {
+	// RetryAfter is when the proxy expects to be back.
+	RetryAfter time.Duration
+	// ReadOnly is set when the proxy still serves GET requests, such as
+	// JobResult, Budget and CacheStats, and refuses only the others.
+	ReadOnly bool
+	// Message is the operator's message.
+	Message string
+}
+
+// Is reports whether target is ErrMaintenance and e a MAINTENANCE error.
+func (e *APIError) Is(target error) bool {
+	return target == ErrMaintenance && strings.EqualFold(e.Code, CodeMaintenance)
+}
+
+// IsMaintenance reports whether err is a refusal by a proxy in maintenance
+// mode.
+func IsMaintenance(err error) bool {
+	return errors.Is(err, ErrMaintenance)
+}
+
+// AsMaintenance returns the details of a MAINTENANCE error. It reports
+// false for other errors.
+func AsMaintenance(err error) (*Maintenance, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !IsMaintenance(apiErr) {
+		return nil, false
+	}
+	readOnly, _ := apiErr.Details["read_only"].(bool)
+	return &Maintenance{RetryAfter: apiErr.RetryAfter, ReadOnly: readOnly, Message: apiErr.Message}, true
+}
+
+// refusedUntilMaintenanceEnds reports whether resp is a read-only
+// maintenance refusal of a request other than a GET, which every retry
+// would get too until maintenance ends.
+func refusedUntilMaintenanceEnds(method string, resp *http.Response) bool {
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		return false
+	}
+	return resp.Header.Get(maintenanceHeader) == "read_only" && method != http.MethodGet
+}
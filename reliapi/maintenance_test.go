@@ -0,0 +1,39 @@
+package reliapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReadOnlyMaintenanceRetriesGets(t *testing.T) {
+	calls := map[string]int{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls[r.Method]++
+		w.Header().Set(maintenanceHeader, "read_only")
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"type": "maintenance_error", "code": CodeMaintenance, "message": "upgrading",
+				"retryable": true, "retry_after_s": 30, "details": map[string]interface{}{"read_only": true},
+			},
+		})
+	}, WithRetry(3, time.Millisecond))
+	c.sleep = func(context.Context, time.Duration) error { return nil }
+
+	_, err := c.Budget(context.Background())
+	if m, ok := AsMaintenance(err); !ok || !m.ReadOnly || m.RetryAfter != 30*time.Second || m.Message != "upgrading" {
+		t.Fatalf("err = %v", err)
+	}
+	_, err = c.InvalidateTarget(context.Background(), "openai")
+	if !IsMaintenance(err) {
+		t.Fatalf("err = %v", err)
+	}
+	if calls[http.MethodGet] != 3 || calls[http.MethodDelete] != 1 {
+		t.Errorf("attempts by method = %v", calls)
+	}
+	if IsMaintenance(&APIError{StatusCode: http.StatusServiceUnavailable, Code: CodeServerError}) {
+		t.Error("SERVER_ERROR taken for maintenance")
+	}
+}
@@ -0,0 +1,179 @@
+package reliapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Message roles understood by the proxy's LLM adapters.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// ChatMessage is a single entry of LLMRequest.Messages.
+//
+// Content carries plain text. When Parts is non-empty the message is encoded
+// with an array "content" (OpenAI's multimodal format) and Content is ignored;
+// build the parts with TextPart, ImageURLPart and ImageBase64Part. The proxy
+// translates them for the target's provider, e.g. to Anthropic image blocks.
+//
+// An assistant message that called tools holds the calls in ToolCalls; each
+// result goes back in a ToolMessage answering the call's ID.
+type ChatMessage struct {
+	Role       string
+	Content    string
+	Parts      []ContentPart
+	Name       string
+	ToolCalls  []ToolCall
+	ToolCallID string
+}
+
+// ContentPart is one element of a multimodal message content array.
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL references an image for a ContentPart of type "image_url". URL
+// is an http(s) URL or a base64 data URL.
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// TextPart returns a text content part.
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+// ImageURLPart returns an image content part fetched from url by the
+// provider. detail is "low", "high", "auto" or empty; providers other than
+// OpenAI ignore it.
+func ImageURLPart(url, detail string) ContentPart {
+	return ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url, Detail: detail}}
+}
+
+// SystemMessage returns a system-role message.
+func SystemMessage(content string) ChatMessage {
+	return ChatMessage{Role: RoleSystem, Content: content}
+}
+
+// UserMessage returns a user-role message.
+func UserMessage(content string) ChatMessage {
+	return ChatMessage{Role: RoleUser, Content: content}
+}
+
+// AssistantMessage returns an assistant-role message.
+func AssistantMessage(content string) ChatMessage {
+	return ChatMessage{Role: RoleAssistant, Content: content}
+}
+
+// ToolMessage returns the result of the tool call callID.
+func ToolMessage(callID, content string) ChatMessage {
+	return ChatMessage{Role: RoleTool, Content: content, ToolCallID: callID}
+}
+
+// ErrPromptAndMessages is returned for an LLMRequest that sets both Prompt
+// and Messages.
+var ErrPromptAndMessages = errors.New("reliapi: LLMRequest sets both Prompt and Messages")
+
+// ErrTemplateAndMessages is returned for an LLMRequest that sets Template
+// together with Messages or Prompt.
+var ErrTemplateAndMessages = errors.New("reliapi: LLMRequest sets Template with Messages or Prompt")
+
+// ErrConversationAndMessages is returned for an LLMRequest that sets
+// ConversationID together with Messages, Prompt or Template, or
+// AppendMessages without ConversationID.
+var ErrConversationAndMessages = errors.New("reliapi: LLMRequest sets ConversationID with Messages, Prompt or Template")
+
+// withPromptMessages returns req with its Prompt converted to a single user
+// message. The converted request is indistinguishable from one written with
+// that message, so both share cache, coalescing and idempotency keys.
+func withPromptMessages(req LLMRequest) (LLMRequest, error) {
+	if req.Template != nil && (req.Prompt != nil || len(req.Messages) > 0) {
+		return req, ErrTemplateAndMessages
+	}
+	if (req.ConversationID != nil) != (len(req.AppendMessages) > 0) ||
+		req.ConversationID != nil && (req.Template != nil || req.Prompt != nil || len(req.Messages) > 0) {
+		return req, ErrConversationAndMessages
+	}
+	if req.Prompt == nil {
+		return req, nil
+	}
+	if len(req.Messages) > 0 {
+		return req, ErrPromptAndMessages
+	}
+	req.Messages = []ChatMessage{UserMessage(*req.Prompt)}
+	req.Prompt = nil
+	return req, nil
+}
+
+// sentMessages returns the messages req sends: the AppendMessages of a
+// conversation turn, else Messages.
+func (r LLMRequest) sentMessages() []ChatMessage {
+	if r.ConversationID != nil {
+		return r.AppendMessages
+	}
+	return r.Messages
+}
+
+// wireMessage is the JSON shape of a ChatMessage. Content is either a string
+// or a []ContentPart.
+type wireMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	Name       string          `json:"name,omitempty"`
+	ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+// MarshalJSON encodes the message in the {"role", "content", ...} map format
+// the proxy accepts.
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	var (
+		content []byte
+		err     error
+	)
+	if len(m.Parts) > 0 {
+		content, err = json.Marshal(m.Parts)
+	} else {
+		content, err = json.Marshal(m.Content)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(wireMessage{
+		Role:       m.Role,
+		Content:    content,
+		Name:       m.Name,
+		ToolCalls:  m.ToolCalls,
+		ToolCallID: m.ToolCallID,
+	})
+}
+
+// UnmarshalJSON accepts both string and array content.
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	var w wireMessage
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	*m = ChatMessage{Role: w.Role, Name: w.Name, ToolCalls: w.ToolCalls, ToolCallID: w.ToolCallID}
+
+	content := bytes.TrimSpace(w.Content)
+	switch {
+	case len(content) == 0 || bytes.Equal(content, []byte("null")):
+	case content[0] == '"':
+		return json.Unmarshal(content, &m.Content)
+	case content[0] == '[':
+		return json.Unmarshal(content, &m.Parts)
+	default:
+		return fmt.Errorf("reliapi: message content must be a string or array, got %s", content)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package reliapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestChatMessageMatchesMapWireFormat(t *testing.T) {
+	typed, err := json.Marshal([]ChatMessage{
+		SystemMessage("be terse"),
+		UserMessage("hello"),
+		{Role: RoleTool, Content: "42", ToolCallID: "call_1", Name: "lookup"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := json.Marshal([]map[string]interface{}{
+		{"role": "system", "content": "be terse"},
+		{"role": "user", "content": "hello"},
+		{"role": "tool", "content": "42", "tool_call_id": "call_1", "name": "lookup"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameJSON(t, typed, legacy)
+}
+
+func TestChatMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want ChatMessage
+	}{
+		{
+			name: "text",
+			json: `{"role":"assistant","content":"hi"}`,
+			want: AssistantMessage("hi"),
+		},
+		{
+			name: "multimodal",
+			json: `{"role":"user","content":[{"type":"text","text":"what is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png","detail":"low"}}]}`,
+			want: ChatMessage{Role: RoleUser, Parts: []ContentPart{
+				{Type: "text", Text: "what is this?"},
+				{Type: "image_url", ImageURL: &ImageURL{URL: "https://example.com/cat.png", Detail: "low"}},
+			}},
+		},
+		{
+			name: "null content",
+			json: `{"role":"assistant","content":null}`,
+			want: ChatMessage{Role: RoleAssistant},
+		},
+		{
+			name: "tool calls",
+			json: `{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Berlin\"}"}}]}`,
+			want: ChatMessage{Role: RoleAssistant, ToolCalls: []ToolCall{
+				{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Berlin"}`}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ChatMessage
+			if err := json.Unmarshal([]byte(tt.json), &got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			out, err := json.Marshal(got)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if tt.want.Content == "" && len(tt.want.Parts) == 0 {
+				return // null content re-encodes as "".
+			}
+			assertSameJSON(t, out, []byte(tt.json))
+		})
+	}
+}
+
+func TestChatMessageRejectsObjectContent(t *testing.T) {
+	var m ChatMessage
+	if err := json.Unmarshal([]byte(`{"role":"user","content":{"x":1}}`), &m); err == nil {
+		t.Fatal("expected error for object content")
+	}
+}
+
+func assertSameJSON(t *testing.T, got, want []byte) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatalf("invalid JSON %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Fatalf("JSON mismatch:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestPromptSentAsUserMessage(t *testing.T) {
+	var bodies [][]byte
+	var mu sync.Mutex
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, raw)
+		mu.Unlock()
+		okLLMResponse(w)
+	}, WithDeterministicIdempotency(), WithCoalescing(ShareLeaderError))
+	ctx := context.Background()
+
+	prompt := "Summarize: retries need idempotency."
+	fromPrompt := LLMRequest{Target: "openai", Prompt: &prompt}
+	handWritten := LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage(prompt)}}
+
+	a, err := c.ProxyLLM(ctx, fromPrompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.ProxyLLM(ctx, handWritten)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || !bytes.Equal(bodies[0], bodies[1]) {
+		t.Fatalf("bodies differ:\n%s\n%s", bodies[0], bodies[1])
+	}
+	var sent map[string]interface{}
+	if err := json.Unmarshal(bodies[0], &sent); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sent["prompt"]; ok {
+		t.Errorf("prompt sent to the proxy: %s", bodies[0])
+	}
+	if a.IdempotencyKey != b.IdempotencyKey {
+		t.Errorf("idempotency keys differ: %q vs %q", a.IdempotencyKey, b.IdempotencyKey)
+	}
+
+	converted, err := withPromptMessages(fromPrompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1, _ := c.llmCoalesceKey(converted)
+	k2, _ := c.llmCoalesceKey(handWritten)
+	if k1 != k2 {
+		t.Errorf("coalescing keys differ: %q vs %q", k1, k2)
+	}
+}
+
+func TestPromptAndMessagesRejected(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request sent for an invalid LLMRequest")
+		http.Error(w, "unexpected", http.StatusInternalServerError)
+	})
+	ctx := context.Background()
+	prompt := "hi"
+	req := llmReq("hello")
+	req.Prompt = &prompt
+
+	if _, err := c.ProxyLLM(ctx, req); !errors.Is(err, ErrPromptAndMessages) {
+		t.Errorf("ProxyLLM err = %v", err)
+	}
+	if _, err := c.ProxyLLMStream(ctx, req); !errors.Is(err, ErrPromptAndMessages) {
+		t.Errorf("ProxyLLMStream err = %v", err)
+	}
+	if _, err := c.ProxyLLMBatch(ctx, []LLMRequest{req}, BatchOptions{}); !errors.Is(err, ErrPromptAndMessages) {
+		t.Errorf("ProxyLLMBatch err = %v", err)
+	}
+	if err := c.InvalidateCache(ctx, CacheRef{LLM: &req}); !errors.Is(err, ErrPromptAndMessages) {
+		t.Errorf("InvalidateCache err = %v", err)
+	}
+}
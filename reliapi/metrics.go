@@ -0,0 +1,194 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// durationBuckets cover cached hits in milliseconds up to long completions.
+var durationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// WithMetrics registers the client's Prometheus metrics with reg:
+//
+//	reliapi_client_requests_total{target,method,status}
+//	reliapi_client_attempts_total{target,method,status}
+//	reliapi_client_cache_hits_total{target}
+//	reliapi_client_idempotent_hits_total{target}
+//	reliapi_client_cost_usd_total{target}
+//	reliapi_client_request_duration_seconds{target,method}
+//	reliapi_client_budget_remaining_usd
+//	reliapi_client_rate_limit_remaining
+//	reliapi_client_rate_limit_queue_depth
+//	reliapi_client_rate_limit_queue_wait_seconds
+//
+// The method label is the call's Op (see Request). requests_total counts
+// logical calls once, whatever WithRetry resent; its status is "ok", the
+// APIError Code (or HTTP status when the proxy sent no code), "canceled", or
+// "error". attempts_total counts every HTTP request
+// sent to the proxy, by HTTP status or "error" for transport failures.
+// Batch items count as requests of their own target; the batch call's
+// attempts carry an empty target. A stream is counted when Recv returns its
+// final error (io.EOF counts as "ok") or when it is closed early
+// ("canceled").
+//
+// cost_usd_total sums Meta.CostUSD of responses that reached an upstream:
+// cache hits, idempotent replays and coalesced followers are not charged
+// again. The remaining gauges are set from the last response that reported
+// Meta.BudgetRemainingUSD or Meta.RateLimitRemaining, the quota of the
+// client's API key. The queue metrics are those of WithRateLimitQueueing:
+// how many requests are parked, and how long each waited before it was
+// sent again. Clients sharing reg share the collectors. NewClient fails if reg
+// already holds different collectors under these names.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(c *Client) {
+		c.metricsRegisterer = reg
+	}
+}
+
+type clientMetrics struct {
+	requests      *prometheus.CounterVec
+	attempts      *prometheus.CounterVec
+	cacheHits     *prometheus.CounterVec
+	idempotentHit *prometheus.CounterVec
+	cost          *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	budgetLeft    prometheus.Gauge
+	rateLimitLeft prometheus.Gauge
+	queueDepth    prometheus.Gauge
+	queueWait     prometheus.Histogram
+}
+
+func newClientMetrics(reg prometheus.Registerer) (*clientMetrics, error) {
+	counter := func(name, help string, labels ...string) (*prometheus.CounterVec, error) {
+		return register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "reliapi_client",
+			Name:      name,
+			Help:      help,
+		}, labels))
+	}
+	m := &clientMetrics{}
+	var err error
+	if m.requests, err = counter("requests_total", "Logical ReliAPI calls by outcome.", "target", "method", "status"); err != nil {
+		return nil, err
+	}
+	if m.attempts, err = counter("attempts_total", "HTTP requests sent to the proxy, including retries.", "target", "method", "status"); err != nil {
+		return nil, err
+	}
+	if m.cacheHits, err = counter("cache_hits_total", "Responses served from the proxy cache.", "target"); err != nil {
+		return nil, err
+	}
+	if m.idempotentHit, err = counter("idempotent_hits_total", "Responses replayed for a reused idempotency key.", "target"); err != nil {
+		return nil, err
+	}
+	if m.cost, err = counter("cost_usd_total", "Upstream cost reported by the proxy, in USD.", "target"); err != nil {
+		return nil, err
+	}
+	if m.duration, err = register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "reliapi_client",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of logical ReliAPI calls as seen by the client, retries included.",
+		Buckets:   durationBuckets,
+	}, []string{"target", "method"})); err != nil {
+		return nil, err
+	}
+	gauge := func(name, help string) (prometheus.Gauge, error) {
+		return register(reg, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "reliapi_client",
+			Name:      name,
+			Help:      help,
+		}))
+	}
+	if m.budgetLeft, err = gauge("budget_remaining_usd", "Rest of the API key's monthly budget reported by the proxy, in USD."); err != nil {
+		return nil, err
+	}
+	if m.rateLimitLeft, err = gauge("rate_limit_remaining", "Requests the API key may still make this minute, as reported by the proxy."); err != nil {
+		return nil, err
+	}
+	if m.queueDepth, err = gauge("rate_limit_queue_depth", "Rate-limited requests parked until their wait elapses."); err != nil {
+		return nil, err
+	}
+	if m.queueWait, err = register(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "reliapi_client",
+		Name:      "rate_limit_queue_wait_seconds",
+		Help:      "Time rate-limited requests spent parked before they were sent again.",
+		Buckets:   durationBuckets,
+	})); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// register registers col with reg, or returns the equivalent collector
+// another client already registered.
+func register[T prometheus.Collector](reg prometheus.Registerer, col T) (T, error) {
+	err := reg.Register(col)
+	if err == nil {
+		return col, nil
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing, nil
+		}
+	}
+	return col, fmt.Errorf("reliapi: register metrics: %w", err)
+}
+
+// attempt counts one HTTP request sent to the proxy.
+func (m *clientMetrics) attempt(target, method string, resp *http.Response, err error) {
+	status := "error"
+	if err == nil && resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	m.attempts.WithLabelValues(target, method, status).Inc()
+}
+
+// observe records the outcome of a logical call that started at start.
+// meta is nil when the call produced no response.
+func (m *clientMetrics) observe(target, method string, start time.Time, meta *Meta, err error) {
+	m.duration.WithLabelValues(target, method).Observe(time.Since(start).Seconds())
+	m.requests.WithLabelValues(target, method, metricsStatus(err)).Inc()
+	if meta == nil {
+		return
+	}
+	if meta.CacheHit {
+		m.cacheHits.WithLabelValues(target).Inc()
+	}
+	if meta.IdempotentHit {
+		m.idempotentHit.WithLabelValues(target).Inc()
+	}
+	if meta.CostUSD != nil && *meta.CostUSD > 0 && !meta.CacheHit && !meta.IdempotentHit && !meta.Coalesced {
+		m.cost.WithLabelValues(target).Add(*meta.CostUSD)
+	}
+	if meta.BudgetRemainingUSD != nil {
+		m.budgetLeft.Set(*meta.BudgetRemainingUSD)
+	}
+	if meta.RateLimitRemaining != nil {
+		m.rateLimitLeft.Set(float64(*meta.RateLimitRemaining))
+	}
+}
+
+func metricsStatus(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return "canceled"
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Code != "" {
+			return apiErr.Code
+		}
+		if apiErr.StatusCode != 0 {
+			return strconv.Itoa(apiErr.StatusCode)
+		}
+	}
+	return "error"
+}
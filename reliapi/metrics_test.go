@@ -0,0 +1,253 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// scriptedResponse is one reply of scriptedHandler.
+type scriptedResponse struct {
+	status int
+	body   map[string]interface{}
+}
+
+// scriptedHandler answers the n-th request with script[n].
+func scriptedHandler(t *testing.T, script []scriptedResponse) http.HandlerFunc {
+	var n atomic.Int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		i := int(n.Add(1)) - 1
+		if i >= len(script) {
+			t.Errorf("unexpected request %d", i+1)
+			http.Error(w, "script exhausted", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, script[i].status, script[i].body)
+	}
+}
+
+func okWithMeta(meta map[string]interface{}) scriptedResponse {
+	return scriptedResponse{http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"content": "ok"}, "meta": meta}}
+}
+
+// histogramCount returns the number of observations of the duration
+// histogram for target and method.
+func histogramCount(t *testing.T, reg *prometheus.Registry, target, method string) uint64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "reliapi_client_request_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["target"] == target && labels["method"] == method {
+				return m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := newTestClient(t, scriptedHandler(t, []scriptedResponse{
+		// A retried call: one logical request, two attempts.
+		{http.StatusServiceUnavailable, map[string]interface{}{"detail": "unavailable"}},
+		okWithMeta(map[string]interface{}{"request_id": "r1", "cost_usd": 0.002}),
+		okWithMeta(map[string]interface{}{"request_id": "r2", "cache_hit": true, "cost_usd": 0.002}),
+		okWithMeta(map[string]interface{}{"request_id": "r3", "idempotent_hit": true, "cost_usd": 0.002}),
+		{http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]interface{}{"type": "budget_error", "code": "BUDGET_EXCEEDED", "message": "over budget"},
+		}},
+		okWithMeta(map[string]interface{}{"request_id": "r5", "cost_usd": 0.0005}),
+		{http.StatusBadGateway, map[string]interface{}{"detail": "bad gateway"}},
+		{http.StatusBadGateway, map[string]interface{}{"detail": "bad gateway"}},
+	}), WithMetrics(reg), WithAutoIdempotency(), WithRetry(2, time.Millisecond))
+	recordSleeps(c)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.ProxyLLM(ctx, llmReq("hi")); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if _, err := c.ProxyLLM(ctx, llmReq("hi")); !IsBudgetExceeded(err) {
+		t.Fatalf("err = %v, want BUDGET_EXCEEDED", err)
+	}
+	if _, err := c.ProxyHTTP(ctx, HTTPRequest{Target: "api", Method: "POST", Path: "/"}); err != nil {
+		t.Fatal(err)
+	}
+	// Retried once, then given up on: one failed request, two attempts.
+	if _, err := c.ProxyHTTP(ctx, HTTPRequest{Target: "api", Method: "POST", Path: "/"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	counters := []struct {
+		name string
+		c    prometheus.Collector
+		want float64
+	}{
+		{"requests ok", c.metrics.requests.WithLabelValues("openai", OpProxyLLM, "ok"), 3},
+		{"requests budget", c.metrics.requests.WithLabelValues("openai", OpProxyLLM, CodeBudgetExceeded), 1},
+		{"requests http ok", c.metrics.requests.WithLabelValues("api", OpProxyHTTP, "ok"), 1},
+		{"requests http 502", c.metrics.requests.WithLabelValues("api", OpProxyHTTP, "502"), 1},
+		{"attempts 503", c.metrics.attempts.WithLabelValues("openai", OpProxyLLM, "503"), 1},
+		{"attempts 200", c.metrics.attempts.WithLabelValues("openai", OpProxyLLM, "200"), 3},
+		{"attempts 400", c.metrics.attempts.WithLabelValues("openai", OpProxyLLM, "400"), 1},
+		{"attempts http 502", c.metrics.attempts.WithLabelValues("api", OpProxyHTTP, "502"), 2},
+		{"cache hits", c.metrics.cacheHits.WithLabelValues("openai"), 1},
+		{"idempotent hits", c.metrics.idempotentHit.WithLabelValues("openai"), 1},
+		{"cost", c.metrics.cost.WithLabelValues("openai"), 0.002},
+		{"http cost", c.metrics.cost.WithLabelValues("api"), 0.0005},
+	}
+	for _, tt := range counters {
+		if got := testutil.ToFloat64(tt.c); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := histogramCount(t, reg, "openai", OpProxyLLM); got != 4 {
+		t.Errorf("openai duration observations = %d, want 4", got)
+	}
+	if got := histogramCount(t, reg, "api", OpProxyHTTP); got != 2 {
+		t.Errorf("api duration observations = %d, want 2", got)
+	}
+}
+
+func TestMetricsStream(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	events := []string{
+		"event: meta\ndata: {\"target\": \"openai\", \"request_id\": \"req_stream\"}\n\n",
+		"event: chunk\ndata: {\"delta\": \"Hi\"}\n\n",
+		"event: done\ndata: {\"finish_reason\": \"stop\", \"cost_usd\": 0.001}\n\n",
+	}
+	c := newTestClient(t, sseHandler(t, events, false), WithMetrics(reg))
+
+	s, err := c.ProxyLLMStream(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collect(t, s); !errors.Is(err, io.EOF) {
+		t.Fatalf("err = %v, want io.EOF", err)
+	}
+	s.Close()
+	// Recv after the end and a second stream closed early.
+	s.Recv()
+	early, err := c.ProxyLLMStream(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	early.Close()
+
+	if got := testutil.ToFloat64(c.metrics.requests.WithLabelValues("openai", OpProxyLLMStream, "ok")); got != 1 {
+		t.Errorf("ok streams = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(c.metrics.requests.WithLabelValues("openai", OpProxyLLMStream, "canceled")); got != 1 {
+		t.Errorf("canceled streams = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(c.metrics.cost.WithLabelValues("openai")); got != 0.001 {
+		t.Errorf("cost = %v, want 0.001", got)
+	}
+}
+
+func TestMetricsBatch(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"results": []map[string]interface{}{
+				{"index": 0, "success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{"cost_usd": 0.001}},
+				{"index": 1, "success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{"cache_hit": true, "cost_usd": 0.001}},
+				{"index": 2, "success": false, "error": map[string]interface{}{"code": "UPSTREAM_ERROR", "message": "boom"}, "meta": map[string]interface{}{}},
+			},
+			"meta": map[string]interface{}{"total": 3},
+		})
+	}, WithMetrics(reg))
+
+	other := llmReq("c")
+	other.Target = "anthropic"
+	if _, err := c.ProxyLLMBatch(context.Background(), []LLMRequest{llmReq("a"), llmReq("b"), other}, BatchOptions{}); !hasCode(err, "UPSTREAM_ERROR") {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(c.metrics.requests.WithLabelValues("openai", OpProxyLLMBatch, "ok")); got != 2 {
+		t.Errorf("ok items = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(c.metrics.requests.WithLabelValues("anthropic", OpProxyLLMBatch, "UPSTREAM_ERROR")); got != 1 {
+		t.Errorf("failed items = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(c.metrics.attempts.WithLabelValues("", OpProxyLLMBatch, "200")); got != 1 {
+		t.Errorf("batch attempts = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(c.metrics.cost.WithLabelValues("openai")); got != 0.001 {
+		t.Errorf("cost = %v, want 0.001", got)
+	}
+}
+
+func TestMetricsKeyQuota(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := newTestClient(t, scriptedHandler(t, []scriptedResponse{
+		okWithMeta(map[string]interface{}{"request_id": "r1", "budget_remaining_usd": 12.5, "rate_limit_remaining": 59}),
+		okWithMeta(map[string]interface{}{"request_id": "r2", "budget_remaining_usd": 12.25, "rate_limit_remaining": 58}),
+		// No limits reported: the gauges keep their last values.
+		okWithMeta(map[string]interface{}{"request_id": "r3"}),
+	}), WithMetrics(reg))
+
+	var last *ReliAPIResponse
+	for i := 0; i < 3; i++ {
+		resp, err := c.ProxyLLM(context.Background(), llmReq("hi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			last = resp
+		}
+	}
+	if last.Meta.BudgetRemainingUSD == nil || *last.Meta.BudgetRemainingUSD != 12.25 || last.Meta.RateLimitRemaining == nil || *last.Meta.RateLimitRemaining != 58 {
+		t.Errorf("meta = %+v", last.Meta)
+	}
+	if got := testutil.ToFloat64(c.metrics.budgetLeft); got != 12.25 {
+		t.Errorf("budget_remaining_usd = %v, want 12.25", got)
+	}
+	if got := testutil.ToFloat64(c.metrics.rateLimitLeft); got != 58 {
+		t.Errorf("rate_limit_remaining = %v, want 58", got)
+	}
+}
+
+func TestMetricsSharedRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	a, err := NewClient("", "k", WithMetrics(reg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewClient("", "k", WithMetrics(reg))
+	if err != nil {
+		t.Fatalf("second client: %v", err)
+	}
+	if a.metrics.requests != b.metrics.requests {
+		t.Error("clients sharing a registry registered separate collectors")
+	}
+
+	clash := prometheus.NewRegistry()
+	clash.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "reliapi_client_requests_total"}))
+	if _, err := NewClient("", "k", WithMetrics(clash)); err == nil {
+		t.Error("expected an error for a conflicting collector")
+	}
+
+	if c, _ := NewClient("", "k"); c.metrics != nil {
+		t.Error("metrics enabled without WithMetrics")
+	}
+}
@@ -0,0 +1,366 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// SamplingParameters are the LLMRequest sampling fields a model may not
+// accept, as ModelCapabilities.Parameters names them.
+var SamplingParameters = []string{"temperature", "top_p", "stop"}
+
+// ModelCapabilities is what a model accepts, which the proxy checks LLM
+// requests against before sending them (see LLMRequest.Strict).
+type ModelCapabilities struct {
+	// ContextWindow is the most prompt plus output tokens; nil if unknown.
+	ContextWindow *int `json:"context_window"`
+	// MaxOutputTokens is the most tokens the model generates; nil if
+	// unknown.
+	MaxOutputTokens    *int `json:"max_output_tokens"`
+	SupportsTools      bool `json:"supports_tools"`
+	SupportsVision     bool `json:"supports_vision"`
+	SupportsJSONSchema bool `json:"supports_json_schema"`
+	// SupportsLogprobs is whether the model returns token logprobs
+	// (LLMRequest.Logprobs).
+	SupportsLogprobs bool `json:"supports_logprobs"`
+	// Parameters are the SamplingParameters the model accepts.
+	Parameters     []string `json:"parameters"`
+	MaxTemperature float64  `json:"max_temperature"`
+}
+
+// ModelTable is the capability table of GET /v1/models.
+type ModelTable struct {
+	// Models are the capabilities of known models, which match model
+	// names by their longest prefix: "gpt-4o-2024-08-06" is "gpt-4o".
+	Models map[string]ModelCapabilities `json:"models"`
+	// Targets holds, for targets with llm.models, the capabilities of the
+	// models they override or add, by exact name. They take precedence
+	// for requests to those targets.
+	Targets map[string]map[string]ModelCapabilities `json:"targets,omitempty"`
+}
+
+// Lookup returns the capabilities of model for requests to target, and
+// false for a model the table lacks, which is not checked.
+func (t *ModelTable) Lookup(target, model string) (ModelCapabilities, bool) {
+	if caps, ok := t.Targets[target][model]; ok {
+		return caps, true
+	}
+	prefix := ""
+	for name := range t.Models {
+		if strings.HasPrefix(model, name) && len(name) > len(prefix) {
+			prefix = name
+		}
+	}
+	if prefix == "" {
+		return ModelCapabilities{}, false
+	}
+	return t.Models[prefix], true
+}
+
+// BundledModels returns the capability table the client ships with, the
+// one the proxy bundles (core/model_capabilities.py) as of this release.
+// ValidateRequest uses it until RefreshModels fetches the proxy's.
+func BundledModels() *ModelTable {
+	return &ModelTable{Models: bundledModels()}
+}
+
+func bundledModels() map[string]ModelCapabilities {
+	return map[string]ModelCapabilities{
+		// OpenAI: logprobs on the gpt models only
+		"gpt-4o":            caps(128000, 16384).vision().logprobs(),
+		"gpt-4o-2024-05-13": caps(128000, 4096).vision().noJSONSchema().logprobs(),
+		"gpt-4o-mini":       caps(128000, 16384).vision().logprobs(),
+		"gpt-4.1":           caps(1047576, 32768).vision().logprobs(),
+		"gpt-4-turbo":       caps(128000, 4096).vision().noJSONSchema().logprobs(),
+		"gpt-4":             caps(8192, 8192).noJSONSchema().logprobs(),
+		"gpt-3.5-turbo":     caps(16385, 4096).noJSONSchema().logprobs(),
+		"o1":                caps(200000, 100000).vision().reasoning(),
+		"o1-mini":           caps(128000, 65536).noTools().noJSONSchema().reasoning(),
+		"o1-preview":        caps(128000, 32768).noTools().noJSONSchema().reasoning(),
+		"o3":                caps(200000, 100000).vision().reasoning(),
+		"o3-mini":           caps(200000, 100000).reasoning(),
+		"o4-mini":           caps(200000, 100000).vision().reasoning(),
+		// Anthropic: no structured outputs, temperatures up to 1
+		"claude-3-haiku":    caps(200000, 4096).vision().noJSONSchema().temperatureUpTo(1),
+		"claude-3-sonnet":   caps(200000, 4096).vision().noJSONSchema().temperatureUpTo(1),
+		"claude-3-opus":     caps(200000, 4096).vision().noJSONSchema().temperatureUpTo(1),
+		"claude-3-5-haiku":  caps(200000, 8192).noJSONSchema().temperatureUpTo(1),
+		"claude-3-5-sonnet": caps(200000, 8192).vision().noJSONSchema().temperatureUpTo(1),
+		"claude-3-7-sonnet": caps(200000, 64000).vision().noJSONSchema().temperatureUpTo(1),
+		"claude-sonnet-4":   caps(200000, 64000).vision().noJSONSchema().temperatureUpTo(1),
+		"claude-opus-4":     caps(200000, 32000).vision().noJSONSchema().temperatureUpTo(1),
+		// Mistral: temperatures up to 1.5
+		"mistral-large": caps(128000, 0).temperatureUpTo(1.5),
+		"mistral-small": caps(32000, 0).temperatureUpTo(1.5),
+		"pixtral":       caps(128000, 0).vision().temperatureUpTo(1.5),
+		// Gemini
+		"gemini-1.5-flash": caps(1048576, 8192).vision(),
+		"gemini-1.5-pro":   caps(2097152, 8192).vision(),
+		"gemini-2.0-flash": caps(1048576, 8192).vision(),
+		"gemini-2.5-flash": caps(1048576, 65536).vision(),
+		"gemini-2.5-pro":   caps(1048576, 65536).vision(),
+	}
+}
+
+// caps returns the capabilities of a model with tools, json_schema and
+// every sampling parameter, and temperatures up to 2. A maxOutputTokens of
+// 0 is unknown.
+func caps(contextWindow, maxOutputTokens int) ModelCapabilities {
+	c := ModelCapabilities{
+		ContextWindow:      &contextWindow,
+		SupportsTools:      true,
+		SupportsJSONSchema: true,
+		Parameters:         slices.Clone(SamplingParameters),
+		MaxTemperature:     2,
+	}
+	if maxOutputTokens > 0 {
+		c.MaxOutputTokens = &maxOutputTokens
+	}
+	return c
+}
+
+func (c ModelCapabilities) vision() ModelCapabilities       { c.SupportsVision = true; return c }
+func (c ModelCapabilities) noTools() ModelCapabilities      { c.SupportsTools = false; return c }
+func (c ModelCapabilities) noJSONSchema() ModelCapabilities { c.SupportsJSONSchema = false; return c }
+func (c ModelCapabilities) logprobs() ModelCapabilities     { c.SupportsLogprobs = true; return c }
+
+// reasoning is for the o-series models, which take none of the sampling
+// parameters.
+func (c ModelCapabilities) reasoning() ModelCapabilities { c.Parameters = []string{}; return c }
+
+func (c ModelCapabilities) temperatureUpTo(t float64) ModelCapabilities {
+	c.MaxTemperature = t
+	return c
+}
+
+// Models returns the proxy's model capability table, with the overrides of
+// its targets' llm.models.
+func (c *Client) Models(ctx context.Context) (*ModelTable, error) {
+	resp, raw, err := c.do(ctx, http.MethodGet, "/v1/models", nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool       `json:"success"`
+		Data    ModelTable `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return &out.Data, nil
+}
+
+// RefreshModels replaces the table ValidateRequest checks requests against,
+// BundledModels until then, with the proxy's (see Models).
+func (c *Client) RefreshModels(ctx context.Context) error {
+	table, err := c.Models(ctx)
+	if err != nil {
+		return err
+	}
+	c.models.Store(table)
+	return nil
+}
+
+func (c *Client) modelTable() *ModelTable {
+	if table := c.models.Load(); table != nil {
+		return table
+	}
+	return BundledModels()
+}
+
+// ValidationIssue is one way an LLM request exceeds what its model
+// accepts, as ValidateRequest reports it and the proxy lists them in a
+// CodeModelLimitsExceeded error (see AsModelLimitsExceeded).
+type ValidationIssue struct {
+	// Field is the offending request field, e.g. "max_tokens", or
+	// "messages" for a prompt over the context window or with images for a
+	// model without vision.
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Min and Max are the allowed range of a numeric field.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// ModelLimitsFailure is the detail of a MODEL_LIMITS_EXCEEDED error.
+type ModelLimitsFailure struct {
+	Model  string            `json:"model"`
+	Issues []ValidationIssue `json:"issues"`
+}
+
+// IsModelLimitsExceeded reports whether err means the proxy rejected the
+// request as outside what its model accepts.
+func IsModelLimitsExceeded(err error) bool {
+	return hasCode(err, CodeModelLimitsExceeded)
+}
+
+// AsModelLimitsExceeded returns the details of a MODEL_LIMITS_EXCEEDED
+// error. It reports false for other errors.
+func AsModelLimitsExceeded(err error) (*ModelLimitsFailure, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !IsModelLimitsExceeded(apiErr) {
+		return nil, false
+	}
+	raw, _ := json.Marshal(apiErr.Details)
+	var f ModelLimitsFailure
+	_ = json.Unmarshal(raw, &f)
+	return &f, true
+}
+
+// Adjustment is a change the proxy made to fit a request with Strict false
+// to its model, reported in Meta.Adjustments.
+type Adjustment struct {
+	Field string `json:"field"`
+	// Action is AdjustmentClamped or AdjustmentDropped.
+	Action string `json:"action"`
+	// From is the requested value and To, for a clamped field, the one
+	// sent.
+	From   interface{} `json:"from"`
+	To     interface{} `json:"to,omitempty"`
+	Reason string      `json:"reason"`
+}
+
+// Adjustment actions.
+const (
+	AdjustmentClamped = "clamped"
+	AdjustmentDropped = "dropped"
+)
+
+// ValidateRequest checks req against its model's capabilities without
+// network access, as the proxy does before sending it (see
+// ModelTable.Validate). The table is BundledModels, or the proxy's after
+// RefreshModels.
+func (c *Client) ValidateRequest(req LLMRequest) []ValidationIssue {
+	return c.modelTable().Validate(req)
+}
+
+// Validate checks req against the capabilities of its model in t: a
+// prompt over the context window, a MaxTokens over the output limit or
+// what the window leaves, a Temperature over the model's range, sampling
+// parameters, Tools, images or Logprobs the model doesn't take. It returns nil for a
+// valid request, and for one without Model or for a model the table
+// lacks, which only the proxy's target configuration can tell. Prompt
+// tokens are CountTokens' estimate of the text, of Prompt too.
+func (t *ModelTable) Validate(req LLMRequest) []ValidationIssue {
+	if req.Model == "" {
+		return nil
+	}
+	if withPrompt, err := withPromptMessages(req); err == nil {
+		req = withPrompt
+	}
+	caps, ok := t.Lookup(req.Target, req.Model)
+	if !ok {
+		return nil
+	}
+	return checkRequest(caps, req, promptTokens(req))
+}
+
+// checkRequest is core/model_capabilities.py check_request.
+func checkRequest(caps ModelCapabilities, req LLMRequest, promptTokens int) []ValidationIssue {
+	var issues []ValidationIssue
+	model := req.Model
+	window := caps.ContextWindow
+	if window != nil && promptTokens >= *window {
+		issues = append(issues, ValidationIssue{
+			Field:   "messages",
+			Message: fmt.Sprintf("Prompt is about %d tokens, over the %d of %s", promptTokens, *window, model),
+			Max:     floatPtr(*window),
+		})
+	}
+
+	if req.MaxTokens != nil {
+		limit := caps.MaxOutputTokens
+		if window != nil && promptTokens < *window {
+			room := *window - promptTokens
+			if limit == nil || room < *limit {
+				limit = &room
+			}
+		}
+		if limit != nil && *req.MaxTokens > *limit {
+			issues = append(issues, ValidationIssue{
+				Field:   "max_tokens",
+				Message: fmt.Sprintf("max_tokens %d is over the %d %s can generate for this prompt", *req.MaxTokens, *limit, model),
+				Min:     floatPtr(1),
+				Max:     floatPtr(*limit),
+			})
+		}
+	}
+
+	set := map[string]bool{"temperature": req.Temperature != nil, "top_p": req.TopP != nil, "stop": req.Stop != nil}
+	for _, name := range SamplingParameters {
+		if set[name] && !slices.Contains(caps.Parameters, name) {
+			issues = append(issues, ValidationIssue{Field: name, Message: fmt.Sprintf("%s does not accept %s", model, name)})
+		}
+	}
+	if req.Temperature != nil && slices.Contains(caps.Parameters, "temperature") && *req.Temperature > caps.MaxTemperature {
+		issues = append(issues, ValidationIssue{
+			Field:   "temperature",
+			Message: fmt.Sprintf("temperature %g is over the %g of %s", *req.Temperature, caps.MaxTemperature, model),
+			Min:     floatPtr(0),
+			Max:     &caps.MaxTemperature,
+		})
+	}
+
+	if len(req.Tools) > 0 && !caps.SupportsTools {
+		issues = append(issues, ValidationIssue{Field: "tools", Message: model + " does not support tools"})
+	}
+	if hasImages(req.Messages) && !caps.SupportsVision {
+		issues = append(issues, ValidationIssue{Field: "messages", Message: model + " does not accept images"})
+	}
+	wantLogprobs := req.Logprobs != nil && *req.Logprobs
+	if (wantLogprobs || req.TopLogprobs != nil) && !caps.SupportsLogprobs {
+		issues = append(issues, ValidationIssue{Field: "logprobs", Message: model + " does not return logprobs"})
+	} else if req.TopLogprobs != nil && !wantLogprobs {
+		issues = append(issues, ValidationIssue{Field: "top_logprobs", Message: "top_logprobs needs logprobs"})
+	} else if req.TopLogprobs != nil && (*req.TopLogprobs < 0 || *req.TopLogprobs > MaxTopLogprobs) {
+		issues = append(issues, ValidationIssue{
+			Field:   "top_logprobs",
+			Message: fmt.Sprintf("top_logprobs %d is outside 0 to %d", *req.TopLogprobs, MaxTopLogprobs),
+			Min:     floatPtr(0),
+			Max:     floatPtr(MaxTopLogprobs),
+		})
+	}
+	return issues
+}
+
+// promptTokens is CountTokens of req's messages, counting text only.
+func promptTokens(req LLMRequest) int {
+	messages := make([]ChatMessage, len(req.Messages))
+	for i, m := range req.Messages {
+		messages[i] = m
+		if len(m.Parts) > 0 {
+			messages[i].Parts = nil
+			for _, part := range m.Parts {
+				if part.Type == "text" {
+					messages[i].Parts = append(messages[i].Parts, part)
+				}
+			}
+		}
+	}
+	tokens, _ := CountTokens(req.Model, messages)
+	return tokens
+}
+
+func hasImages(messages []ChatMessage) bool {
+	for _, m := range messages {
+		for _, part := range m.Parts {
+			if part.Type == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func floatPtr(n int) *float64 {
+	f := float64(n)
+	return &f
+}
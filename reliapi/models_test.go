@@ -0,0 +1,178 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestModelTableLookup(t *testing.T) {
+	table := BundledModels()
+	for model, want := range map[string]string{
+		"gpt-4o-2024-08-06":        "gpt-4o",
+		"gpt-4o-mini-2024-07-18":   "gpt-4o-mini",
+		"o3-mini-2025-01-31":       "o3-mini",
+		"claude-3-5-sonnet-latest": "claude-3-5-sonnet",
+	} {
+		caps, ok := table.Lookup("openai", model)
+		if !ok || *caps.MaxOutputTokens != *table.Models[want].MaxOutputTokens || caps.SupportsVision != table.Models[want].SupportsVision {
+			t.Errorf("Lookup(%q) = %+v, %v; want %s", model, caps, ok, want)
+		}
+	}
+	if _, ok := table.Lookup("openai", "my-finetune"); ok {
+		t.Error("found a model the table lacks")
+	}
+
+	window := 8192
+	table.Targets = map[string]map[string]ModelCapabilities{"local": {"gpt-4o": {ContextWindow: &window}}}
+	if caps, _ := table.Lookup("local", "gpt-4o"); caps.ContextWindow == nil || *caps.ContextWindow != 8192 {
+		t.Errorf("target override = %+v", caps)
+	}
+	if caps, _ := table.Lookup("openai", "gpt-4o"); *caps.ContextWindow != 128000 {
+		t.Errorf("other target = %+v", caps)
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {})
+	maxTokens, temperature := 10000, 1.5
+	req := LLMRequest{
+		Target: "anthropic", Model: "claude-3-5-sonnet-20241022", MaxTokens: &maxTokens, Temperature: &temperature,
+		Messages: []ChatMessage{UserMessage("Hi")},
+	}
+	issues := c.ValidateRequest(req)
+	if len(issues) != 2 || issues[0].Field != "max_tokens" || *issues[0].Max != 8192 || *issues[0].Min != 1 ||
+		issues[1].Field != "temperature" || *issues[1].Max != 1 {
+		t.Fatalf("issues = %+v", issues)
+	}
+
+	// o-series models take no sampling parameters, o1-mini no tools or images
+	req = LLMRequest{
+		Target: "openai", Model: "o1-mini", Temperature: &temperature, Stop: []string{"\n"},
+		Tools:    []ToolDefinition{{Type: "function", Function: FunctionDefinition{Name: "f"}}},
+		Messages: []ChatMessage{{Role: "user", Parts: []ContentPart{TextPart("What is it?"), ImageURLPart("https://example.com/a.png", "")}}},
+	}
+	var fields []string
+	for _, issue := range c.ValidateRequest(req) {
+		fields = append(fields, issue.Field)
+	}
+	if got := len(fields); got != 4 || fields[0] != "temperature" || fields[1] != "stop" || fields[2] != "tools" || fields[3] != "messages" {
+		t.Errorf("fields = %v", fields)
+	}
+
+	// What the prompt leaves of the context window limits max_tokens
+	prompt := make([]byte, 0, 40000)
+	for len(prompt) < 39990 {
+		prompt = append(prompt, "word "...)
+	}
+	maxTokens, text := 1000, string(prompt)
+	req = LLMRequest{Target: "openai", Model: "gpt-4", MaxTokens: &maxTokens, Prompt: &text}
+	if issues := c.ValidateRequest(req); len(issues) != 1 || issues[0].Field != "max_tokens" || *issues[0].Max >= 1000 {
+		t.Errorf("issues = %+v", issues)
+	}
+
+	for _, req := range []LLMRequest{llmReq("Hi"), {Target: "openai", Messages: []ChatMessage{UserMessage("Hi")}}, {Target: "openai", Model: "my-finetune", MaxTokens: &maxTokens}} {
+		if issues := c.ValidateRequest(req); issues != nil {
+			t.Errorf("ValidateRequest(%+v) = %+v", req, issues)
+		}
+	}
+}
+
+func TestRefreshModels(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/models" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"models": map[string]interface{}{
+					"gpt-4o": map[string]interface{}{
+						"context_window": 128000, "max_output_tokens": 16384, "supports_tools": true,
+						"supports_vision": true, "supports_json_schema": true,
+						"parameters": []string{"temperature", "top_p", "stop"}, "max_temperature": 2.0,
+					},
+				},
+				"targets": map[string]interface{}{
+					"local": map[string]interface{}{
+						"llama-3-70b": map[string]interface{}{
+							"context_window": 8192, "max_output_tokens": 2048, "supports_tools": true,
+							"supports_vision": false, "supports_json_schema": true,
+							"parameters": []string{"temperature"}, "max_temperature": 2.0,
+						},
+					},
+				},
+			},
+		})
+	})
+	maxTokens := 4096
+	req := LLMRequest{Target: "local", Model: "llama-3-70b", MaxTokens: &maxTokens, Messages: []ChatMessage{UserMessage("Hi")}}
+	if issues := c.ValidateRequest(req); issues != nil {
+		t.Fatalf("bundled table checked %+v", issues)
+	}
+
+	if err := c.RefreshModels(context.Background()); err != nil {
+		t.Fatalf("RefreshModels: %v", err)
+	}
+	if issues := c.ValidateRequest(req); len(issues) != 1 || *issues[0].Max != 2048 {
+		t.Errorf("issues = %+v", issues)
+	}
+	// Models the proxy's table lacks are no longer checked
+	maxTokens = 40000
+	if issues := c.ValidateRequest(LLMRequest{Target: "openai", Model: "gpt-4", MaxTokens: &maxTokens}); issues != nil {
+		t.Errorf("issues = %+v", issues)
+	}
+}
+
+func TestModelLimitsExceeded(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"success": false, "error": map[string]interface{}{
+			"type": "client_error", "code": CodeModelLimitsExceeded, "status_code": 400,
+			"message": "Request outside what o1-mini accepts: max_tokens 100000 is over the 65536 o1-mini can generate for this prompt",
+			"details": map[string]interface{}{"model": "o1-mini", "issues": []map[string]interface{}{
+				{"field": "max_tokens", "message": "max_tokens 100000 is over the 65536 o1-mini can generate for this prompt", "min": 1, "max": 65536},
+			}},
+		}})
+	})
+	_, err := c.ProxyLLM(context.Background(), llmReq("Hi"))
+	failure, ok := AsModelLimitsExceeded(err)
+	if !ok || !IsModelLimitsExceeded(err) || failure.Model != "o1-mini" || len(failure.Issues) != 1 || *failure.Issues[0].Max != 65536 {
+		t.Fatalf("failure = %+v, err = %v", failure, err)
+	}
+	if _, ok := AsModelLimitsExceeded(errors.New("other")); ok {
+		t.Error("matched another error")
+	}
+}
+
+func TestMetaAdjustments(t *testing.T) {
+	var strict interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		strict = body["strict"]
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "Hello"},
+			"meta": map[string]interface{}{"adjustments": []map[string]interface{}{
+				{"field": "max_tokens", "action": AdjustmentClamped, "from": 100000, "to": 65536, "reason": "over the limit"},
+				{"field": "temperature", "action": AdjustmentDropped, "from": 0.5, "reason": "not accepted"},
+			}},
+		})
+	})
+	req := llmReq("Hi")
+	notStrict := false
+	req.Strict = &notStrict
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strict != false {
+		t.Errorf("strict sent = %v", strict)
+	}
+	adj := resp.Meta.Adjustments
+	if len(adj) != 2 || adj[0].Action != AdjustmentClamped || adj[0].To != 65536.0 || adj[1].Action != AdjustmentDropped || adj[1].To != nil {
+		t.Errorf("adjustments = %+v", adj)
+	}
+}
@@ -0,0 +1,144 @@
+package reliapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotCompleted matches, under errors.Is, the error of an item of a
+// MultiError that had not completed when the call's context ended. The
+// same error also matches the context's error.
+var ErrNotCompleted = errors.New("reliapi: item not completed")
+
+// MultiError is the error of a call fanning out to several items, such as
+// ProxyLLMBatch, ProxyHTTPAllPages and WaitForCacheWarm, when some of them
+// failed; the items that succeeded are returned alongside it.
+//
+// errors.Is and errors.As look through the failed items in order, so
+// errors.As(err, &apiErr) finds the *APIError of the first failure, with
+// its Code and RequestID. Failed lists every failure with its item's
+// index, and %+v prints them one per line.
+type MultiError struct {
+	// Errs holds the error of every item, in the order of the items, and
+	// nil for the items that succeeded.
+	Errs []error
+}
+
+// newMultiError returns a *MultiError of errs, or nil when none is set.
+func newMultiError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return &MultiError{Errs: errs}
+		}
+	}
+	return nil
+}
+
+func (e *MultiError) Error() string {
+	failures := e.Failures()
+	if len(failures) == 0 {
+		return fmt.Sprintf("reliapi: %d items, none failed", len(e.Errs))
+	}
+	first := failures[0]
+	return fmt.Sprintf("reliapi: %d of %d items failed; item %d: %v", len(failures), len(e.Errs), first, e.Errs[first])
+}
+
+// Format formats e as Error does, and with %+v lists the error of every
+// failed item on a line of its own:
+//
+//	reliapi: 2 of 4 items failed
+//	  item 2: reliapi: 402 BUDGET_EXCEEDED ...
+//	  item 3: reliapi: item not completed: context canceled
+func (e *MultiError) Format(s fmt.State, verb rune) {
+	if verb != 'v' || !s.Flag('+') {
+		fmt.Fprintf(s, fmt.FormatString(s, verb), e.Error())
+		return
+	}
+	failed := e.Failed()
+	fmt.Fprintf(s, "reliapi: %d of %d items failed", len(failed), len(e.Errs))
+	for _, item := range failed {
+		fmt.Fprintf(s, "\n  item %d: %v", item.Index, item.Err)
+	}
+}
+
+func (e *MultiError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Errs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Err returns the error of item i, nil when it succeeded or i is out of
+// range.
+func (e *MultiError) Err(i int) error {
+	if i < 0 || i >= len(e.Errs) {
+		return nil
+	}
+	return e.Errs[i]
+}
+
+// ItemError is the error of a failed item of a MultiError, with the
+// item's index.
+type ItemError struct {
+	Index int
+	Err   error
+}
+
+func (e ItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e ItemError) Unwrap() error { return e.Err }
+
+// Failed returns the errors of the items that failed, in order.
+func (e *MultiError) Failed() []ItemError {
+	var out []ItemError
+	for i, err := range e.Errs {
+		if err != nil {
+			out = append(out, ItemError{Index: i, Err: err})
+		}
+	}
+	return out
+}
+
+// Succeeded returns how many items succeeded.
+func (e *MultiError) Succeeded() int {
+	return len(e.Errs) - len(e.Failures())
+}
+
+// Successes returns the indexes of the items that succeeded, in order.
+func (e *MultiError) Successes() []int {
+	return e.indexes(false)
+}
+
+// Failures returns the indexes of the items that failed, in order.
+func (e *MultiError) Failures() []int {
+	return e.indexes(true)
+}
+
+func (e *MultiError) indexes(failed bool) []int {
+	var out []int
+	for i, err := range e.Errs {
+		if (err != nil) == failed {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// notCompletedError marks an item cut short by the end of the call's
+// context, cause.
+type notCompletedError struct {
+	cause error
+}
+
+func (e *notCompletedError) Error() string {
+	return fmt.Sprintf("reliapi: item not completed: %v", e.cause)
+}
+
+func (e *notCompletedError) Unwrap() []error {
+	return []error{ErrNotCompleted, e.cause}
+}
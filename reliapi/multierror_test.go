@@ -0,0 +1,208 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMultiError(t *testing.T) {
+	budget := &APIError{StatusCode: 402, Code: CodeBudgetExceeded, RequestID: "req_2"}
+	notRun := &notCompletedError{cause: context.Canceled}
+	var err error = &MultiError{Errs: []error{nil, nil, budget, notRun}}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeBudgetExceeded || apiErr.RequestID != "req_2" {
+		t.Errorf("errors.As = %+v", apiErr)
+	}
+	if !IsBudgetExceeded(err) || !errors.Is(err, ErrNotCompleted) || !errors.Is(err, context.Canceled) {
+		t.Errorf("errors.Is(%v) misses an item", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Error("matches an error no item has")
+	}
+
+	var multi *MultiError
+	if !errors.As(err, &multi) {
+		t.Fatal("not a *MultiError")
+	}
+	if multi.Err(2) != budget || multi.Err(0) != nil || multi.Err(9) != nil || multi.Err(-1) != nil {
+		t.Errorf("Err = %v, %v", multi.Err(2), multi.Err(0))
+	}
+	if !slices.Equal(multi.Successes(), []int{0, 1}) || !slices.Equal(multi.Failures(), []int{2, 3}) {
+		t.Errorf("successes %v, failures %v", multi.Successes(), multi.Failures())
+	}
+	if want := "reliapi: 2 of 4 items failed; item 2: " + budget.Error(); err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+
+	if failed := multi.Failed(); len(failed) != 2 || failed[0] != (ItemError{2, budget}) || failed[1].Index != 3 || multi.Succeeded() != 2 {
+		t.Errorf("Failed() = %v, Succeeded() = %d", failed, multi.Succeeded())
+	}
+	if failed := multi.Failed()[1]; !errors.Is(failed, ErrNotCompleted) || failed.Error() != "item 3: "+notRun.Error() {
+		t.Errorf("ItemError %q", failed)
+	}
+	if got := fmt.Sprintf("%v|%s", err, err); got != err.Error()+"|"+err.Error() {
+		t.Errorf("%%v|%%s = %q", got)
+	}
+	wantVerbose := "reliapi: 2 of 4 items failed\n  item 2: " + budget.Error() + "\n  item 3: " + notRun.Error()
+	if got := fmt.Sprintf("%+v", err); got != wantVerbose {
+		t.Errorf("%%+v = %q, want %q", got, wantVerbose)
+	}
+	if got := fmt.Errorf("batch: %w", err); !IsBudgetExceeded(got) || got.Error() != "batch: "+err.Error() {
+		t.Errorf("wrapped = %q", got)
+	}
+
+	allFailed := &MultiError{Errs: []error{budget, budget}}
+	if allFailed.Succeeded() != 0 || len(allFailed.Failed()) != 2 || len(allFailed.Successes()) != 0 {
+		t.Errorf("all failed: %+v", allFailed)
+	}
+	empty := &MultiError{}
+	if empty.Succeeded() != 0 || empty.Failed() != nil || empty.Error() != "reliapi: 0 items, none failed" || fmt.Sprintf("%+v", empty) != "reliapi: 0 of 0 items failed" {
+		t.Errorf("empty: %+v", empty)
+	}
+
+	if newMultiError([]error{nil, nil}) != nil {
+		t.Error("newMultiError without failures is not nil")
+	}
+}
+
+func TestProxyLLMBatchCanceled(t *testing.T) {
+	reached, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		close(reached)
+		<-release
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-reached
+		cancel()
+	}()
+
+	done := make(chan struct{})
+	var results []BatchResult
+	var err error
+	go func() {
+		defer close(done)
+		results, err = c.ProxyLLMBatch(ctx, []LLMRequest{llmReq("a"), llmReq("b")}, BatchOptions{})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProxyLLMBatch did not return after cancel")
+	}
+
+	var multi *MultiError
+	if !errors.As(err, &multi) || !slices.Equal(multi.Failures(), []int{0, 1}) || multi.Succeeded() != 0 || len(multi.Failed()) != 2 {
+		t.Fatalf("err = %v", err)
+	}
+	if len(results) != 2 || !errors.Is(results[1].Err, ErrNotCompleted) || !errors.Is(results[1].Err, context.Canceled) {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestProxyHTTPAllPages(t *testing.T) {
+	up := &pagedUpstream{}
+	c := newTestClient(t, up.ServeHTTP)
+	req := HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/users"}
+
+	pages, err := c.ProxyHTTPAllPages(context.Background(), req, PaginationConfig{Strategy: PaginateCursor, CursorPath: "next"})
+	if err != nil || len(pages) != 5 {
+		t.Fatalf("%d pages, err = %v", len(pages), err)
+	}
+
+	pages, err = c.ProxyHTTPAllPages(context.Background(), req, PaginationConfig{Strategy: PaginateCursor, CursorPath: "next", MaxPages: 2})
+	var multi *MultiError
+	if !errors.As(err, &multi) || len(pages) != 2 || !slices.Equal(multi.Failures(), []int{2}) || multi.Succeeded() != 2 || !errors.Is(err, ErrMaxPages) {
+		t.Errorf("%d pages, err = %v", len(pages), err)
+	}
+
+	// A page failing keeps its APIError and request id
+	failing := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if len(up.requests) == 2 {
+			writeJSON(w, http.StatusBadGateway, map[string]interface{}{"success": false, "error": map[string]interface{}{
+				"type": "upstream_error", "code": CodeServerError, "message": "boom", "status_code": 502,
+			}, "meta": map[string]interface{}{"request_id": "req_3"}})
+			return
+		}
+		up.ServeHTTP(w, r)
+	})
+	up.requests = nil
+	pages, err = failing.ProxyHTTPAllPages(context.Background(), req, PaginationConfig{Strategy: PaginateCursor, CursorPath: "next"})
+	var apiErr *APIError
+	if !errors.As(err, &multi) || len(pages) != 2 || !errors.As(multi.Err(2), &apiErr) || apiErr.RequestID != "req_3" {
+		t.Errorf("%d pages, err = %v", len(pages), err)
+	}
+
+	// Canceling keeps the pages received and marks the next not completed
+	ctx, cancel := context.WithCancel(context.Background())
+	canceling := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if len(up.requests) == 3 {
+			_, _ = io.Copy(io.Discard, r.Body)
+			cancel()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		up.ServeHTTP(w, r)
+	})
+	up.requests = nil
+	pages, err = canceling.ProxyHTTPAllPages(ctx, req, PaginationConfig{Strategy: PaginateCursor, CursorPath: "next"})
+	if !errors.As(err, &multi) || len(pages) != 3 || !errors.Is(multi.Err(3), ErrNotCompleted) || !errors.Is(err, context.Canceled) {
+		t.Errorf("%d pages, err = %v", len(pages), err)
+	}
+}
+
+func TestWaitForCacheWarmCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	polls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// The second poll is cut short by ctx
+		if polls++; polls == 2 {
+			cancel()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"job_id": "job_w",
+				"status": JobRunning,
+				"items": []map[string]interface{}{
+					{"index": 0, "kind": "http", "target": "api", "status": WarmWarmed},
+					{"index": 1, "kind": "llm", "target": "openai", "status": WarmAborted},
+					{"index": 2, "kind": "llm", "target": "openai", "status": WarmPending},
+				},
+			},
+		})
+	})
+
+	job, err := c.WaitForCacheWarm(ctx, "job_w", time.Millisecond)
+	var multi *MultiError
+	if job == nil || !errors.As(err, &multi) {
+		t.Fatalf("job = %+v, err = %v", job, err)
+	}
+	if multi.Err(0) != nil || !errors.Is(multi.Err(1), ErrWarmAborted) || !errors.Is(multi.Err(2), ErrNotCompleted) || !errors.Is(err, context.Canceled) {
+		t.Errorf("errs = %v", multi.Errs)
+	}
+	if failed := multi.Failed(); multi.Succeeded() != 1 || len(failed) != 2 || failed[0].Index != 1 || !errors.Is(failed[0], ErrWarmAborted) {
+		t.Errorf("Failed() = %v", failed)
+	}
+
+	// Canceled before the first poll there is no job
+	if job, err := c.WaitForCacheWarm(ctx, "job_w", time.Hour); job != nil || !errors.Is(err, context.Canceled) {
+		t.Errorf("job = %+v, err = %v", job, err)
+	}
+}
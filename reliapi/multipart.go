@@ -0,0 +1,269 @@
+package reliapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MaxMultipartBytes is the largest MultipartBody, its parts' decoded
+// contents summed, that the proxy accepts.
+const MaxMultipartBytes = 64 << 20
+
+// MultipartBody is a multipart/form-data request body. The proxy encodes it
+// for the upstream, choosing the boundary and setting the Content-Type
+// header; requests carrying one are never cached.
+type MultipartBody struct {
+	// Parts are sent in order.
+	Parts []MultipartPart `json:"parts"`
+}
+
+// MultipartPart is a form field of a MultipartBody: a text Value, or a
+// file's Data with, usually, a Filename and ContentType.
+type MultipartPart struct {
+	Name        string
+	Filename    string
+	ContentType string
+	Value       *string
+	Data        []byte
+
+	// path is a file read for Data when the part is sent, set by
+	// NewMultipartFromFiles. streamToken stands in for its contents while
+	// a request is encoded for streaming.
+	path        string
+	streamToken string
+}
+
+type multipartPartJSON struct {
+	Name        string  `json:"name"`
+	Filename    string  `json:"filename,omitempty"`
+	ContentType string  `json:"content_type,omitempty"`
+	Value       *string `json:"value,omitempty"`
+	DataBase64  *string `json:"data_base64,omitempty"`
+}
+
+// MarshalJSON encodes the part as the proxy expects it, reading a part
+// backed by a file into memory.
+func (p MultipartPart) MarshalJSON() ([]byte, error) {
+	out := multipartPartJSON{Name: p.Name, Filename: p.Filename, ContentType: p.ContentType, Value: p.Value}
+	if p.Value == nil {
+		var data string
+		switch {
+		case p.streamToken != "":
+			data = p.streamToken
+		case p.path != "":
+			raw, err := os.ReadFile(p.path)
+			if err != nil {
+				return nil, fmt.Errorf("reliapi: read multipart file: %w", err)
+			}
+			data = base64.StdEncoding.EncodeToString(raw)
+		default:
+			data = base64.StdEncoding.EncodeToString(p.Data)
+		}
+		out.DataBase64 = &data
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a part encoded by MarshalJSON.
+func (p *MultipartPart) UnmarshalJSON(raw []byte) error {
+	var in multipartPartJSON
+	if err := json.Unmarshal(raw, &in); err != nil {
+		return err
+	}
+	*p = MultipartPart{Name: in.Name, Filename: in.Filename, ContentType: in.ContentType, Value: in.Value}
+	if in.DataBase64 != nil {
+		data, err := base64.StdEncoding.DecodeString(*in.DataBase64)
+		if err != nil {
+			return fmt.Errorf("reliapi: decode multipart data: %w", err)
+		}
+		p.Data = data
+	}
+	return nil
+}
+
+// NewMultipartFromFiles returns a MultipartBody with a file part per entry
+// of files, which maps form field names to file paths, in field name
+// order. Each part's Filename is the file's base name and its ContentType
+// is guessed from the extension. The files are read when the request is
+// sent: ProxyHTTP and ProxyHTTPStream stream them to the proxy instead of
+// loading them into memory, and read them again for a retry.
+func NewMultipartFromFiles(files map[string]string) (*MultipartBody, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	body := &MultipartBody{Parts: make([]MultipartPart, 0, len(names))}
+	for _, name := range names {
+		path := files[name]
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("reliapi: multipart file: %w", err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("reliapi: multipart file %s is not a regular file", path)
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(path))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		body.Parts = append(body.Parts, MultipartPart{
+			Name: name, Filename: filepath.Base(path), ContentType: contentType, path: path,
+		})
+	}
+	return body, nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// encode returns m as a multipart/form-data body, as the proxy sends it
+// upstream, and its Content-Type.
+func (m *MultipartBody) encode() ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, p := range m.Parts {
+		header := make(textproto.MIMEHeader)
+		disposition := fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(p.Name))
+		if p.Filename != "" {
+			disposition += fmt.Sprintf(`; filename="%s"`, quoteEscaper.Replace(p.Filename))
+		}
+		header.Set("Content-Disposition", disposition)
+		if p.ContentType != "" {
+			header.Set("Content-Type", p.ContentType)
+		}
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		switch {
+		case p.Value != nil:
+			_, err = io.WriteString(part, *p.Value)
+		case p.path != "":
+			var f *os.File
+			if f, err = os.Open(p.path); err == nil {
+				_, err = io.Copy(part, f)
+				f.Close()
+			}
+		default:
+			_, err = part.Write(p.Data)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("reliapi: encode multipart: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+// encodePayload encodes r as JSON. File parts of a Multipart body are
+// streamed from their files, base64-encoded as they are read, rather than
+// held in memory.
+func (r HTTPRequest) encodePayload() (payload, error) {
+	var files []string
+	if r.Multipart != nil {
+		parts := append([]MultipartPart(nil), r.Multipart.Parts...)
+		for i := range parts {
+			if parts[i].path == "" || parts[i].Value != nil {
+				continue
+			}
+			token, err := newStreamToken()
+			if err != nil {
+				return nil, err
+			}
+			parts[i].streamToken = token
+			files = append(files, parts[i].path)
+		}
+		r.Multipart = &MultipartBody{Parts: parts}
+	}
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("reliapi: encode request: %w", err)
+	}
+	if len(files) == 0 {
+		return bytesPayload(raw), nil
+	}
+	p := &filePayload{files: files}
+	for _, part := range r.Multipart.Parts {
+		if part.streamToken == "" {
+			continue
+		}
+		before, after, _ := bytes.Cut(raw, []byte(part.streamToken))
+		p.segments = append(p.segments, before)
+		raw = after
+	}
+	p.segments = append(p.segments, raw)
+	return p, nil
+}
+
+func newStreamToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("reliapi: generate multipart token: %w", err)
+	}
+	return "reliapi-file-" + hex.EncodeToString(b[:]), nil
+}
+
+// filePayload is a JSON request with the base64 contents of files spliced
+// in between its segments.
+type filePayload struct {
+	segments [][]byte
+	files    []string
+}
+
+func (p *filePayload) open() (io.ReadCloser, error) {
+	rc := &multiReadCloser{}
+	readers := make([]io.Reader, 0, len(p.segments)+len(p.files))
+	for i, segment := range p.segments {
+		readers = append(readers, bytes.NewReader(segment))
+		if i == len(p.files) {
+			break
+		}
+		f, err := os.Open(p.files[i])
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("reliapi: open multipart file: %w", err)
+		}
+		pr, pw := io.Pipe()
+		go func() {
+			enc := base64.NewEncoder(base64.StdEncoding, pw)
+			_, err := io.Copy(enc, f)
+			if err == nil {
+				err = enc.Close()
+			}
+			f.Close()
+			pw.CloseWithError(err)
+		}()
+		readers = append(readers, pr)
+		rc.closers = append(rc.closers, pr)
+	}
+	rc.Reader = io.MultiReader(readers...)
+	return rc, nil
+}
+
+// multiReadCloser reads a MultiReader and closes the pipes feeding it, which
+// stops their encoding goroutines when a request ends early.
+type multiReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiReadCloser) Close() error {
+	for _, c := range m.closers {
+		c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package reliapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMultipartRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	scan := make([]byte, 10<<20)
+	if _, err := rand.Read(scan); err != nil {
+		t.Fatal(err)
+	}
+	scanPath := filepath.Join(dir, "scan.png")
+	notesPath := filepath.Join(dir, "notes")
+	if err := os.WriteFile(scanPath, scan, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(notesPath, []byte("page 1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("ParseMultipartForm: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f, header, err := r.FormFile("image")
+		if err != nil {
+			t.Errorf("FormFile: %v", err)
+			return
+		}
+		defer f.Close()
+		got, _ := io.ReadAll(f)
+		if !bytes.Equal(got, scan) || header.Filename != "scan.png" || header.Header.Get("Content-Type") != "image/png" {
+			t.Errorf("image = %d bytes, %q, %q", len(got), header.Filename, header.Header.Get("Content-Type"))
+		}
+		if notes := r.MultipartForm.File["notes"]; len(notes) != 1 || notes[0].Header.Get("Content-Type") != "application/octet-stream" {
+			t.Errorf("notes = %+v", notes)
+		}
+		if lang := r.FormValue("language"); lang != "en" {
+			t.Errorf("language = %q", lang)
+		}
+		_, _ = io.WriteString(w, `{"text":"hello"}`)
+	}))
+	t.Cleanup(upstream.Close)
+	base, _ := url.Parse(upstream.URL)
+
+	// The fake proxy fails the first attempt, so the client reads the
+	// files again for the retry
+	var attempts int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != -1 {
+			t.Errorf("Content-Length = %d, want a streamed body", r.ContentLength)
+		}
+		var req HTTPRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode: %v", err)
+			return
+		}
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if req.IdempotencyKey == nil || *req.IdempotencyKey != "upload-1" || req.Multipart == nil || len(req.Multipart.Parts) != 3 {
+			t.Errorf("request = %+v", req)
+			return
+		}
+		upReq, err := ToHTTPRequest(req, base)
+		if err != nil {
+			t.Errorf("ToHTTPRequest: %v", err)
+			return
+		}
+		upResp, err := http.DefaultClient.Do(upReq)
+		if err != nil {
+			t.Errorf("upstream: %v", err)
+			return
+		}
+		defer upResp.Body.Close()
+		body, _ := io.ReadAll(upResp.Body)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"status_code": upResp.StatusCode, "body": string(body)},
+			"meta":    map[string]interface{}{"request_id": "req_1"},
+		})
+	}, WithRetry(2, time.Millisecond))
+
+	form, err := NewMultipartFromFiles(map[string]string{"notes": notesPath, "image": scanPath})
+	if err != nil {
+		t.Fatalf("NewMultipartFromFiles: %v", err)
+	}
+	if form.Parts[0].Name != "image" || form.Parts[1].Name != "notes" {
+		t.Errorf("parts = %+v", form.Parts)
+	}
+	lang := "en"
+	form.Parts = append(form.Parts, MultipartPart{Name: "language", Value: &lang})
+	key := "upload-1"
+	resp, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "ocr", Method: http.MethodPost, Path: "/scan", Multipart: form, IdempotencyKey: &key})
+	if err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	if data := resp.DataMap(); data["status_code"] != 200.0 || data["body"] != `{"text":"hello"}` {
+		t.Errorf("data = %v", data)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("attempts = %d, want 2", n)
+	}
+}
+
+func TestMultipartJSON(t *testing.T) {
+	lang := "en"
+	req := HTTPRequest{Target: "ocr", Method: http.MethodPost, Path: "/scan", Multipart: &MultipartBody{Parts: []MultipartPart{
+		{Name: "language", Value: &lang},
+		{Name: "file", Filename: "a.txt", ContentType: "text/plain", Data: []byte("hi")},
+		{Name: "empty", Data: nil},
+	}}}
+	raw, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"parts":[{"name":"language","value":"en"},{"name":"file","filename":"a.txt","content_type":"text/plain","data_base64":"aGk="},{"name":"empty","data_base64":""}]`; !strings.Contains(string(raw), want) {
+		t.Errorf("json = %s", raw)
+	}
+	var back HTTPRequest
+	if err := json.Unmarshal(raw, &back); err != nil || string(back.Multipart.Parts[1].Data) != "hi" {
+		t.Errorf("round trip = %+v, %v", back.Multipart, err)
+	}
+
+	body := "{}"
+	req.Body = &body
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request sent")
+	})
+	if _, err := c.ProxyHTTP(context.Background(), req); !errors.Is(err, ErrConflictingBody) {
+		t.Errorf("err = %v, want ErrConflictingBody", err)
+	}
+	if _, err := NewMultipartFromFiles(map[string]string{"f": t.TempDir()}); err == nil {
+		t.Error("NewMultipartFromFiles accepted a directory")
+	}
+}
@@ -0,0 +1,506 @@
+package reliapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrQueued matches, under errors.Is, the *QueuedError of a request that
+// WithOfflineQueue queued for replay.
+var ErrQueued = errors.New("reliapi: request queued offline")
+
+// ErrOfflineQueueFull is the error of a request the proxy could not be
+// reached for when the offline queue had no room left for it. The request
+// was neither sent nor queued.
+var ErrOfflineQueueFull = errors.New("reliapi: offline queue is full")
+
+// QueuedError is the error of a ProxyLLM or ProxyHTTP call WithOfflineQueue
+// queued instead of failing. Its outcome reaches the
+// WithOfflineReplayHandler handler under Ref once the request is replayed.
+type QueuedError struct {
+	// Ref identifies the queued request.
+	Ref string
+	// Err is the connection error that queued the request; nil when it was
+	// queued behind an earlier request of the same IdempotencyKey.
+	Err error
+}
+
+func (e *QueuedError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("reliapi: request queued offline as %s", e.Ref)
+	}
+	return fmt.Sprintf("reliapi: proxy unreachable, request queued offline as %s: %v", e.Ref, e.Err)
+}
+
+func (e *QueuedError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrQueued}
+	}
+	return []error{ErrQueued, e.Err}
+}
+
+// OfflineReplayHandler receives the outcome of a request replayed from the
+// offline queue: its response, or the error it finally failed with.
+type OfflineReplayHandler func(ref string, resp *ReliAPIResponse, err error)
+
+// Bounds of the delay between replays while the proxy stays unreachable;
+// variables for tests.
+var (
+	offlineMinBackoff = time.Second
+	offlineMaxBackoff = time.Minute
+)
+
+const offlineLogName = "queue.log"
+
+// WithOfflineQueue keeps ProxyLLM and ProxyHTTP requests carrying an
+// IdempotencyKey when the proxy can't be reached: instead of failing, the
+// request is appended to a log in dir and the call returns a *QueuedError
+// (ErrQueued). A goroutine replays queued requests in the order they were
+// queued, backing off while the proxy stays unreachable, and passes each
+// outcome to the WithOfflineReplayHandler handler. The IdempotencyKey makes
+// the replay safe when a request reached the proxy after all.
+//
+// A request with the IdempotencyKey of one still queued is queued behind
+// it without being sent, so each key's requests reach the proxy in order.
+// The log survives restarts: a client opened on dir replays what an
+// earlier one left. At most maxBytes of requests are queued; past that a
+// request fails with ErrOfflineQueueFull, nothing queued is dropped.
+//
+// Multipart requests are never queued. Only one client at a time may use
+// dir; Close stops the replay.
+func WithOfflineQueue(dir string, maxBytes int64) Option {
+	return func(c *Client) {
+		c.offlineDir, c.offlineMaxBytes = dir, maxBytes
+	}
+}
+
+// WithOfflineReplayHandler sets the handler of replayed offline requests.
+// It is called from the replay goroutine, one request at a time.
+func WithOfflineReplayHandler(h OfflineReplayHandler) Option {
+	return func(c *Client) {
+		c.offlineHandler = h
+	}
+}
+
+// Close stops replaying the offline queue of WithOfflineQueue and closes
+// its log; queued requests are replayed by the next client opened on its
+// directory. Requests parked under WithRateLimitQueueing fail with
+// ErrClientClosed, and a WithCacheBackfill run still going is stopped. It
+// is a no-op without any of them.
+func (c *Client) Close() error {
+	c.backfill.stop()
+	if c.rateQueue != nil {
+		c.rateQueue.close()
+	}
+	if c.offline == nil {
+		return nil
+	}
+	return c.offline.close()
+}
+
+// Kinds of queued requests.
+const (
+	queuedLLM  = "llm"
+	queuedHTTP = "http"
+)
+
+// queuedRequest is a log record: a queued request, or with Done the
+// completion of the one of Ref.
+type queuedRequest struct {
+	Ref      string          `json:"ref"`
+	Done     bool            `json:"done,omitempty"`
+	Kind     string          `json:"kind,omitempty"`
+	Key      string          `json:"key,omitempty"`
+	Tenant   string          `json:"tenant,omitempty"`
+	QueuedAt *time.Time      `json:"queued_at,omitempty"`
+	Request  json.RawMessage `json:"request,omitempty"`
+
+	size int64
+}
+
+type offlineQueue struct {
+	c          *Client
+	path       string
+	maxBytes   int64
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	file    *os.File
+	pending []*queuedRequest
+	bytes   int64 // of the pending records
+	logSize int64
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// openOfflineQueue loads the log in dir; start replays it.
+func openOfflineQueue(c *Client, dir string, maxBytes int64) (*offlineQueue, error) {
+	if maxBytes <= 0 {
+		return nil, errors.New("reliapi: offline queue size must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("reliapi: create offline queue directory: %w", err)
+	}
+	q := &offlineQueue{
+		c:          c,
+		path:       filepath.Join(dir, offlineLogName),
+		maxBytes:   maxBytes,
+		minBackoff: offlineMinBackoff,
+		maxBackoff: offlineMaxBackoff,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	// Rewritten, which also drops a record torn by a crash
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// start starts the replay goroutine.
+func (q *offlineQueue) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	go q.run(ctx)
+	q.signal()
+}
+
+// load reads the pending requests of the log.
+func (q *offlineQueue) load() error {
+	f, err := os.Open(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reliapi: open offline queue: %w", err)
+	}
+	defer f.Close()
+	byRef := make(map[string]*queuedRequest)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, int(min(q.maxBytes, 1<<30))+1)
+	for scanner.Scan() {
+		var rec queuedRequest
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.Ref == "" {
+			continue
+		}
+		if rec.Done {
+			delete(byRef, rec.Ref)
+			continue
+		}
+		rec.size = int64(len(scanner.Bytes()) + 1)
+		byRef[rec.Ref] = &rec
+		q.pending = append(q.pending, &rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reliapi: read offline queue: %w", err)
+	}
+	kept := q.pending[:0]
+	for _, rec := range q.pending {
+		if byRef[rec.Ref] == rec {
+			kept = append(kept, rec)
+			q.bytes += rec.size
+		}
+	}
+	q.pending = kept
+	return nil
+}
+
+// compact rewrites the log with only the pending requests, replacing it
+// atomically. It is called with mu held, or before the queue is shared.
+func (q *offlineQueue) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("reliapi: write offline queue: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, rec := range q.pending {
+		line, err := json.Marshal(rec)
+		if err == nil {
+			_, err = w.Write(append(line, '\n'))
+		}
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("reliapi: write offline queue: %w", err)
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), q.path)
+	}
+	if err != nil {
+		return fmt.Errorf("reliapi: write offline queue: %w", err)
+	}
+	if q.file != nil {
+		q.file.Close()
+	}
+	q.file, err = os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("reliapi: open offline queue: %w", err)
+	}
+	q.logSize = q.bytes
+	return nil
+}
+
+// appendRecord writes rec to the log and syncs it. It is called with mu held.
+func (q *offlineQueue) appendRecord(rec *queuedRequest) (int64, error) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return 0, fmt.Errorf("reliapi: encode queued request: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := q.file.Write(line); err != nil {
+		return 0, fmt.Errorf("reliapi: write offline queue: %w", err)
+	}
+	if err := q.file.Sync(); err != nil {
+		return 0, fmt.Errorf("reliapi: write offline queue: %w", err)
+	}
+	q.logSize += int64(len(line))
+	return int64(len(line)), nil
+}
+
+// do runs call for a request of kind with idempotency key key, queueing
+// req when the proxy can't be reached or an earlier request of key is
+// still queued.
+func (q *offlineQueue) do(ctx context.Context, kind, key, tenant string, req interface{}, call func() (*ReliAPIResponse, error)) (*ReliAPIResponse, error) {
+	if q.queued(key) {
+		return nil, q.enqueue(kind, key, tenant, req, nil)
+	}
+	resp, err := call()
+	if err == nil || !unreachable(ctx, err) {
+		return resp, err
+	}
+	return nil, q.enqueue(kind, key, tenant, req, err)
+}
+
+// queued reports whether a request of idempotency key key is pending.
+func (q *offlineQueue) queued(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, rec := range q.pending {
+		if rec.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue appends req to the queue, returning the *QueuedError of the
+// call; cause is the error that queued it.
+func (q *offlineQueue) enqueue(kind, key, tenant string, req interface{}, cause error) error {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("reliapi: encode queued request: %w", err)
+	}
+	now := q.c.now().UTC()
+	rec := &queuedRequest{Ref: newQueueRef(), Kind: kind, Key: key, Tenant: tenant, QueuedAt: &now, Request: raw}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return errors.New("reliapi: client is closed")
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("reliapi: encode queued request: %w", err)
+	}
+	if size := int64(len(line) + 1); q.bytes+size > q.maxBytes {
+		if cause == nil {
+			return ErrOfflineQueueFull
+		}
+		return fmt.Errorf("%w: %w", ErrOfflineQueueFull, cause)
+	}
+	if rec.size, err = q.appendRecord(rec); err != nil {
+		return err
+	}
+	q.pending = append(q.pending, rec)
+	q.bytes += rec.size
+	q.signal()
+	return &QueuedError{Ref: rec.Ref, Err: cause}
+}
+
+func newQueueRef() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return "queued_" + hex.EncodeToString(b[:])
+}
+
+// signal wakes the replay goroutine.
+func (q *offlineQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// front returns the oldest pending request, nil if none.
+func (q *offlineQueue) front() *queuedRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return nil
+	}
+	return q.pending[0]
+}
+
+// complete records that rec, the oldest pending request, was replayed,
+// compacting the log once it is mostly completed records.
+func (q *offlineQueue) complete(rec *queuedRequest) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = q.pending[1:]
+	q.bytes -= rec.size
+	if q.file == nil {
+		return nil
+	}
+	if _, err := q.appendRecord(&queuedRequest{Ref: rec.Ref, Done: true}); err != nil {
+		return err
+	}
+	if len(q.pending) == 0 || q.logSize > 2*q.maxBytes {
+		return q.compact()
+	}
+	return nil
+}
+
+// run replays the queue until ctx is done.
+func (q *offlineQueue) run(ctx context.Context) {
+	defer close(q.done)
+	backoff := q.minBackoff
+	for {
+		rec := q.front()
+		if rec == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			}
+			continue
+		}
+		resp, err := q.replay(ctx, rec)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && unreachable(ctx, err) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, q.maxBackoff)
+			continue
+		}
+		backoff = q.minBackoff
+		// A completion the log missed replays the request after a restart,
+		// which its idempotency key covers
+		_ = q.complete(rec)
+		if h := q.c.offlineHandler; h != nil {
+			h(rec.Ref, resp, err)
+		}
+	}
+}
+
+// replay sends rec to the proxy, bypassing the queue.
+func (q *offlineQueue) replay(ctx context.Context, rec *queuedRequest) (*ReliAPIResponse, error) {
+	ctx = context.WithValue(ctx, offlineBypassKey{}, true)
+	switch rec.Kind {
+	case queuedLLM:
+		var req LLMRequest
+		if err := json.Unmarshal(rec.Request, &req); err != nil {
+			return nil, fmt.Errorf("reliapi: decode queued request: %w", err)
+		}
+		req.TenantID = rec.Tenant
+		return q.c.ProxyLLM(ctx, req)
+	case queuedHTTP:
+		var req HTTPRequest
+		if err := json.Unmarshal(rec.Request, &req); err != nil {
+			return nil, fmt.Errorf("reliapi: decode queued request: %w", err)
+		}
+		req.TenantID = rec.Tenant
+		return q.c.ProxyHTTP(ctx, req)
+	}
+	return nil, fmt.Errorf("reliapi: queued request of unknown kind %q", rec.Kind)
+}
+
+func (q *offlineQueue) close() error {
+	q.cancel()
+	<-q.done
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
+
+// offlineBypassKey marks the context of calls made by the queue itself.
+type offlineBypassKey struct{}
+
+// offlineQueueFor returns the queue a call with ctx and idempotency key
+// goes through, nil for calls that are not queued.
+func (c *Client) offlineQueueFor(ctx context.Context, key *string) *offlineQueue {
+	if c.offline == nil || key == nil || ctx.Value(offlineBypassKey{}) != nil {
+		return nil
+	}
+	return c.offline
+}
+
+// proxyLLM is ProxyLLM through the queue.
+func (q *offlineQueue) proxyLLM(ctx context.Context, req LLMRequest) (*ReliAPIResponse, error) {
+	ctx = context.WithValue(ctx, offlineBypassKey{}, true)
+	queued, err := withPromptMessages(req)
+	if err != nil {
+		return q.c.ProxyLLM(ctx, req)
+	}
+	return q.do(ctx, queuedLLM, *req.IdempotencyKey, req.TenantID, queued, func() (*ReliAPIResponse, error) {
+		return q.c.ProxyLLM(ctx, req)
+	})
+}
+
+// proxyHTTP is ProxyHTTP through the queue.
+func (q *offlineQueue) proxyHTTP(ctx context.Context, req HTTPRequest) (*ReliAPIResponse, error) {
+	ctx = context.WithValue(ctx, offlineBypassKey{}, true)
+	queued, err := withEncodedBody(req)
+	if err != nil || req.Multipart != nil {
+		return q.c.ProxyHTTP(ctx, req)
+	}
+	return q.do(ctx, queuedHTTP, *req.IdempotencyKey, req.TenantID, queued, func() (*ReliAPIResponse, error) {
+		return q.c.ProxyHTTP(ctx, req)
+	})
+}
+
+// unreachable reports whether err means the proxy could not be reached,
+// rather than that it answered or ctx ended the call.
+func unreachable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,172 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// downTransport fails every request with a dial error while down is set.
+type downTransport struct {
+	down atomic.Bool
+}
+
+func (d *downTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if d.down.Load() {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+type replayed struct {
+	ref  string
+	resp *ReliAPIResponse
+	err  error
+}
+
+// offlineClient is a client queueing in dir whose replays go to the
+// returned channel; the handler answers with the request's prompt.
+func offlineClient(t *testing.T, dir string, maxBytes int64, transport *downTransport, sent chan<- string) (*Client, <-chan replayed) {
+	t.Helper()
+	minBackoff, maxBackoff := offlineMinBackoff, offlineMaxBackoff
+	offlineMinBackoff, offlineMaxBackoff = 5*time.Millisecond, 20*time.Millisecond
+	t.Cleanup(func() { offlineMinBackoff, offlineMaxBackoff = minBackoff, maxBackoff })
+
+	results := make(chan replayed, 10)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req LLMRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		sent <- *req.IdempotencyKey + ":" + req.Messages[0].Content
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true, "data": map[string]interface{}{"content": req.Messages[0].Content}, "meta": map[string]interface{}{},
+		})
+	}, WithHTTPClient(&http.Client{Transport: transport}), WithOfflineQueue(dir, maxBytes),
+		WithOfflineReplayHandler(func(ref string, resp *ReliAPIResponse, err error) {
+			results <- replayed{ref, resp, err}
+		}))
+	t.Cleanup(func() { c.Close() })
+	return c, results
+}
+
+func keyedReq(key, prompt string) LLMRequest {
+	req := llmReq(prompt)
+	req.IdempotencyKey = &key
+	return req
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+		panic("unreachable")
+	}
+}
+
+func TestOfflineQueue(t *testing.T) {
+	transport := &downTransport{}
+	transport.down.Store(true)
+	sent := make(chan string, 10)
+	c, results := offlineClient(t, t.TempDir(), 1<<20, transport, sent)
+	ctx := context.Background()
+
+	var refs []string
+	for _, req := range []LLMRequest{keyedReq("k1", "first"), keyedReq("k1", "second"), keyedReq("k2", "third")} {
+		_, err := c.ProxyLLM(ctx, req)
+		var queued *QueuedError
+		if !errors.Is(err, ErrQueued) || !errors.As(err, &queued) {
+			t.Fatalf("err = %v, want ErrQueued", err)
+		}
+		refs = append(refs, queued.Ref)
+		if behind := len(refs) == 2; behind != (queued.Err == nil) {
+			t.Errorf("request %d: Err = %v", len(refs), queued.Err)
+		}
+	}
+	if _, err := c.ProxyLLM(ctx, llmReq("unkeyed")); err == nil || errors.Is(err, ErrQueued) {
+		t.Errorf("unkeyed err = %v, want the connection error", err)
+	}
+
+	transport.down.Store(false)
+	for i, want := range []string{"k1:first", "k1:second", "k2:third"} {
+		if got := receive(t, sent); got != want {
+			t.Errorf("replay %d = %q, want %q", i, got, want)
+		}
+		r := receive(t, results)
+		if r.ref != refs[i] || r.err != nil || r.resp == nil {
+			t.Errorf("result %d = %+v", i, r)
+		}
+	}
+
+	if _, err := c.ProxyLLM(ctx, keyedReq("k1", "live")); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, sent); got != "k1:live" {
+		t.Errorf("sent %q", got)
+	}
+}
+
+func TestOfflineQueueSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	transport := &downTransport{}
+	transport.down.Store(true)
+	sent := make(chan string, 10)
+	c, _ := offlineClient(t, dir, 1<<20, transport, sent)
+	for _, req := range []LLMRequest{keyedReq("k1", "first"), keyedReq("k2", "second")} {
+		if _, err := c.ProxyLLM(context.Background(), req); !errors.Is(err, ErrQueued) {
+			t.Fatalf("err = %v", err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// A torn record of a crash is dropped
+	f, err := os.OpenFile(filepath.Join(dir, offlineLogName), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"ref":"queued_torn","kind":"llm","requ`)
+	f.Close()
+
+	_, results := offlineClient(t, dir, 1<<20, &downTransport{}, sent)
+	for i, want := range []string{"k1:first", "k2:second"} {
+		if got := receive(t, sent); got != want {
+			t.Errorf("replay %d = %q, want %q", i, got, want)
+		}
+		if r := receive(t, results); r.err != nil {
+			t.Errorf("result %d: %v", i, r.err)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, offlineLogName))
+	if err != nil || info.Size() != 0 {
+		t.Errorf("log after replay: %v, %v", info, err)
+	}
+}
+
+func TestOfflineQueueFull(t *testing.T) {
+	transport := &downTransport{}
+	transport.down.Store(true)
+	c, _ := offlineClient(t, t.TempDir(), 400, transport, make(chan string, 10))
+
+	if _, err := c.ProxyLLM(context.Background(), keyedReq("k1", "fits")); !errors.Is(err, ErrQueued) {
+		t.Fatalf("err = %v", err)
+	}
+	_, err := c.ProxyLLM(context.Background(), keyedReq("k2", "does not fit"))
+	var netErr net.Error
+	if !errors.Is(err, ErrOfflineQueueFull) || !errors.As(err, &netErr) || errors.Is(err, ErrQueued) {
+		t.Fatalf("err = %v, want ErrOfflineQueueFull", err)
+	}
+	if !c.offline.queued("k1") {
+		t.Error("the queued request was evicted")
+	}
+}
@@ -0,0 +1,373 @@
+// Package openaicompat is a chat completions client with the shape of the
+// official OpenAI Go SDK, backed by a ReliAPI target. Code written against
+// client.Chat.Completions moves to ReliAPI by swapping the constructor:
+//
+//	client, err := openaicompat.NewClient("https://reliapi.kikuai.dev", apiKey, "openai")
+//	completion, err := client.Chat.Completions.New(ctx, openaicompat.ChatCompletionNewParams{
+//		Model:    "gpt-4o-mini",
+//		Messages: []openaicompat.Message{openaicompat.UserMessage("Hello!")},
+//	})
+//	fmt.Println(completion.Choices[0].Message.Content)
+//
+// Requests and responses use OpenAI's field names, in Go and in JSON.
+// Responses carry the proxy's Meta in the "reliapi" extension field, and
+// calls made with a context from ContextWithMeta record it there for
+// MetaFromContext, which middleware that only sees the context can use.
+package openaicompat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+// Message is a chat message, in a request or a response. It is encoded
+// like OpenAI's message objects.
+type Message = reliapi.ChatMessage
+
+// Tool is a function the model may call; reliapi.FunctionTool builds one.
+type Tool = reliapi.ToolDefinition
+
+// ToolCall is a function call made by the model.
+type ToolCall = reliapi.ToolCall
+
+// ResponseFormat selects the output format, e.g. {Type: "json_object"}.
+type ResponseFormat = reliapi.ResponseFormat
+
+// SystemMessage returns a system message.
+func SystemMessage(content string) Message { return reliapi.SystemMessage(content) }
+
+// UserMessage returns a user message.
+func UserMessage(content string) Message { return reliapi.UserMessage(content) }
+
+// AssistantMessage returns an assistant message.
+func AssistantMessage(content string) Message { return reliapi.AssistantMessage(content) }
+
+// ToolMessage returns the result of the tool call callID.
+func ToolMessage(content, callID string) Message { return reliapi.ToolMessage(callID, content) }
+
+// Int returns a pointer to v, for the optional fields of the params.
+func Int(v int) *int { return &v }
+
+// Float returns a pointer to v, for the optional fields of the params.
+func Float(v float64) *float64 { return &v }
+
+// ErrMultipleChoices is returned for requests with N above 1, which the
+// proxy does not support.
+var ErrMultipleChoices = errors.New("openaicompat: n > 1 is not supported")
+
+// Client is a ReliAPI client for one target.
+type Client struct {
+	Chat ChatService
+}
+
+// ChatService groups the chat endpoints, as in the OpenAI SDK.
+type ChatService struct {
+	Completions *ChatCompletionService
+}
+
+// ChatCompletionService creates chat completions.
+type ChatCompletionService struct {
+	client *reliapi.Client
+	target string
+}
+
+// NewClient returns a Client for target on the deployment at baseURL.
+func NewClient(baseURL, apiKey, target string, opts ...reliapi.Option) (*Client, error) {
+	c, err := reliapi.NewClient(baseURL, apiKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(c, target), nil
+}
+
+// Wrap returns a Client for target that sends its requests with c.
+func Wrap(c *reliapi.Client, target string) *Client {
+	return &Client{Chat: ChatService{Completions: &ChatCompletionService{client: c, target: target}}}
+}
+
+// ChatCompletionNewParams is the body of a chat completion request. It
+// holds the OpenAI parameters the proxy supports.
+type ChatCompletionNewParams struct {
+	// Model is the model to use; empty selects the target's default.
+	Model    string    `json:"model,omitempty"`
+	Messages []Message `json:"messages"`
+	// MaxCompletionTokens and its older name MaxTokens limit the
+	// completion; when both are set MaxCompletionTokens wins.
+	MaxCompletionTokens *int            `json:"max_completion_tokens,omitempty"`
+	MaxTokens           *int            `json:"max_tokens,omitempty"`
+	Temperature         *float64        `json:"temperature,omitempty"`
+	TopP                *float64        `json:"top_p,omitempty"`
+	Stop                []string        `json:"stop,omitempty"`
+	N                   *int            `json:"n,omitempty"`
+	Tools               []Tool          `json:"tools,omitempty"`
+	ToolChoice          interface{}     `json:"tool_choice,omitempty"`
+	ResponseFormat      *ResponseFormat `json:"response_format,omitempty"`
+	StreamOptions       *StreamOptions  `json:"stream_options,omitempty"`
+
+	// ReliAPI holds the proxy's own request options, such as cache TTL
+	// and idempotency key. Its Target, Messages, Model and sampling fields
+	// are ignored in favor of the ones above.
+	ReliAPI *reliapi.LLMRequest `json:"-"`
+}
+
+// StreamOptions configures NewStreaming.
+type StreamOptions struct {
+	// IncludeUsage adds a final chunk with no choices and the token usage.
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
+// ChatCompletion is a chat completion, as OpenAI returns it.
+type ChatCompletion struct {
+	// ID is "chatcmpl-" followed by the proxy's request ID.
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   CompletionUsage        `json:"usage"`
+	// ReliAPI is the proxy's metadata for the response: cost, cache hit,
+	// request ID and so on.
+	ReliAPI *reliapi.Meta `json:"reliapi,omitempty"`
+}
+
+// ChatCompletionChoice is one choice of a ChatCompletion.
+type ChatCompletionChoice struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+}
+
+// CompletionUsage is the token usage of a completion.
+type CompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// request translates params into an LLMRequest for target.
+func (params ChatCompletionNewParams) request(target string) (reliapi.LLMRequest, error) {
+	if params.N != nil && *params.N > 1 {
+		return reliapi.LLMRequest{}, ErrMultipleChoices
+	}
+	var req reliapi.LLMRequest
+	if params.ReliAPI != nil {
+		req = *params.ReliAPI
+	}
+	req.Target = target
+	req.Messages = params.Messages
+	req.Model = params.Model
+	req.MaxTokens = params.MaxTokens
+	if params.MaxCompletionTokens != nil {
+		req.MaxTokens = params.MaxCompletionTokens
+	}
+	req.Temperature = params.Temperature
+	req.TopP = params.TopP
+	req.Stop = params.Stop
+	req.Tools = params.Tools
+	req.ToolChoice = params.ToolChoice
+	req.ResponseFormat = params.ResponseFormat
+	return req, nil
+}
+
+// New creates a chat completion.
+func (s *ChatCompletionService) New(ctx context.Context, params ChatCompletionNewParams) (*ChatCompletion, error) {
+	req, err := params.request(s.target)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.ProxyLLM(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	recordMeta(ctx, resp.Meta)
+	c, err := resp.Completion()
+	if err != nil {
+		return nil, err
+	}
+	meta := resp.Meta
+	out := &ChatCompletion{
+		ID:      completionID(meta.RequestID),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   c.Model,
+		Usage:   CompletionUsage(c.Usage),
+		ReliAPI: &meta,
+	}
+	for _, choice := range c.Choices {
+		msg := choice.Message
+		if msg.Role == "" {
+			msg.Role = reliapi.RoleAssistant
+		}
+		out.Choices = append(out.Choices, ChatCompletionChoice{Index: choice.Index, Message: msg, FinishReason: choice.FinishReason})
+	}
+	return out, nil
+}
+
+func completionID(requestID string) string {
+	return "chatcmpl-" + requestID
+}
+
+// ChatCompletionChunk is a streamed piece of a chat completion.
+type ChatCompletionChunk struct {
+	ID      string                      `json:"id"`
+	Object  string                      `json:"object"`
+	Created int64                       `json:"created"`
+	Model   string                      `json:"model"`
+	Choices []ChatCompletionChunkChoice `json:"choices"`
+	// Usage is only set on the final chunk of a stream with
+	// StreamOptions.IncludeUsage, which has no choices.
+	Usage *CompletionUsage `json:"usage,omitempty"`
+}
+
+// ChatCompletionChunkChoice is the change a chunk makes to a choice.
+type ChatCompletionChunkChoice struct {
+	Index int                      `json:"index"`
+	Delta ChatCompletionChunkDelta `json:"delta"`
+	// FinishReason is set on the choice's last chunk.
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// ChatCompletionChunkDelta is the text a chunk appends. Role is only set
+// on the first chunk.
+type ChatCompletionChunkDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+// ChatCompletionStream iterates over the chunks of a streamed completion:
+//
+//	stream := client.Chat.Completions.NewStreaming(ctx, params)
+//	defer stream.Close()
+//	for stream.Next() {
+//		fmt.Print(stream.Current().Choices[0].Delta.Content)
+//	}
+//	if err := stream.Err(); err != nil { ... }
+type ChatCompletionStream struct {
+	ctx          context.Context
+	stream       *reliapi.Stream
+	includeUsage bool
+	created      int64
+
+	current ChatCompletionChunk
+	started bool
+	done    bool
+	err     error
+}
+
+// NewStreaming creates a streamed chat completion. Errors, including
+// those of the request itself, are reported by Err once Next returns false.
+// Tools can't be streamed.
+func (s *ChatCompletionService) NewStreaming(ctx context.Context, params ChatCompletionNewParams) *ChatCompletionStream {
+	out := &ChatCompletionStream{ctx: ctx, created: time.Now().Unix()}
+	req, err := params.request(s.target)
+	if err != nil {
+		out.err = err
+		return out
+	}
+	out.includeUsage = params.StreamOptions != nil && params.StreamOptions.IncludeUsage
+	out.stream, out.err = s.client.ProxyLLMStream(ctx, req)
+	return out
+}
+
+// Next advances to the next chunk and reports whether there is one.
+func (s *ChatCompletionStream) Next() bool {
+	if s.err != nil || s.done {
+		return false
+	}
+	chunk, err := s.stream.Recv()
+	meta := s.stream.Meta()
+	s.current = ChatCompletionChunk{ID: completionID(meta.RequestID), Object: "chat.completion.chunk", Created: s.created, Model: meta.Model}
+	if errors.Is(err, io.EOF) {
+		s.done = true
+		recordMeta(s.ctx, meta)
+		if !s.includeUsage {
+			return false
+		}
+		usage := CompletionUsage(s.stream.Usage())
+		s.current.Choices = []ChatCompletionChunkChoice{}
+		s.current.Usage = &usage
+		return true
+	}
+	if err != nil {
+		s.err = err
+		return false
+	}
+	choice := ChatCompletionChunkChoice{Delta: ChatCompletionChunkDelta{Content: chunk.Delta}, FinishReason: chunk.FinishReason}
+	if !s.started {
+		choice.Delta.Role = reliapi.RoleAssistant
+		s.started = true
+	}
+	s.current.Choices = []ChatCompletionChunkChoice{choice}
+	return true
+}
+
+// Current returns the chunk Next advanced to.
+func (s *ChatCompletionStream) Current() ChatCompletionChunk {
+	return s.current
+}
+
+// Err returns the error that ended the stream, if any.
+func (s *ChatCompletionStream) Err() error {
+	return s.err
+}
+
+// Meta returns the proxy's metadata for the stream; cost and usage are
+// filled in once Next has returned false.
+func (s *ChatCompletionStream) Meta() reliapi.Meta {
+	if s.stream == nil {
+		return reliapi.Meta{}
+	}
+	return s.stream.Meta()
+}
+
+// Close releases the stream. It is safe to call more than once.
+func (s *ChatCompletionStream) Close() error {
+	if s.stream == nil {
+		return nil
+	}
+	return s.stream.Close()
+}
+
+type metaKey struct{}
+
+type metaSlot struct {
+	mu   sync.Mutex
+	meta *reliapi.Meta
+}
+
+// ContextWithMeta returns a context in which calls record the proxy's
+// Meta for MetaFromContext. A call made with a context derived from it
+// replaces what an earlier one recorded.
+func ContextWithMeta(ctx context.Context) context.Context {
+	return context.WithValue(ctx, metaKey{}, &metaSlot{})
+}
+
+// MetaFromContext returns the Meta recorded in ctx, which must come from
+// ContextWithMeta, by the last call that succeeded; a stream records it
+// when it ends.
+func MetaFromContext(ctx context.Context) (*reliapi.Meta, bool) {
+	slot, ok := ctx.Value(metaKey{}).(*metaSlot)
+	if !ok {
+		return nil, false
+	}
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	if slot.meta == nil {
+		return nil, false
+	}
+	meta := *slot.meta
+	return &meta, true
+}
+
+func recordMeta(ctx context.Context, meta reliapi.Meta) {
+	if slot, ok := ctx.Value(metaKey{}).(*metaSlot); ok {
+		slot.mu.Lock()
+		slot.meta = &meta
+		slot.mu.Unlock()
+	}
+}
@@ -0,0 +1,141 @@
+package openaicompat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"github.com/KikuAI-Lab/reliapi/reliapi/reliapitest"
+)
+
+func TestNew(t *testing.T) {
+	srv := reliapitest.NewMockServer(t)
+	var got reliapi.LLMRequest
+	srv.HandleLLM(func(req reliapi.LLMRequest) reliapitest.LLMReply {
+		got = req
+		return reliapitest.LLMReply{Content: "Paris.", PromptTokens: 12, CompletionTokens: 2, CostUSD: 0.0004}
+	})
+	client, err := NewClient(srv.URL, reliapitest.APIKey, "openai")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parameters as OpenAI's JSON spells them
+	var params ChatCompletionNewParams
+	body := `{"model": "gpt-4o-mini", "messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "Capital of France?"}],
+		"max_completion_tokens": 20, "temperature": 0.2, "stop": ["\n"]}`
+	if err := json.Unmarshal([]byte(body), &params); err != nil {
+		t.Fatal(err)
+	}
+	cache := 60
+	params.ReliAPI = &reliapi.LLMRequest{Cache: &cache}
+
+	ctx := ContextWithMeta(context.Background())
+	completion, err := client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got.Target != "openai" || got.Model != "gpt-4o-mini" || len(got.Messages) != 2 || *got.MaxTokens != 20 || *got.Temperature != 0.2 || *got.Cache != 60 {
+		t.Errorf("request = %+v", got)
+	}
+	if len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "Paris." || completion.Choices[0].Message.Role != "assistant" {
+		t.Fatalf("choices = %+v", completion.Choices)
+	}
+	if completion.ID != "chatcmpl-req_mock_1" || completion.Object != "chat.completion" || completion.Model != "gpt-4o-mini" {
+		t.Errorf("completion = %+v", completion)
+	}
+	if completion.Usage != (CompletionUsage{PromptTokens: 12, CompletionTokens: 2, TotalTokens: 14}) {
+		t.Errorf("usage = %+v", completion.Usage)
+	}
+
+	raw, _ := json.Marshal(completion)
+	var decoded map[string]interface{}
+	_ = json.Unmarshal(raw, &decoded)
+	choice := decoded["choices"].([]interface{})[0].(map[string]interface{})
+	if choice["message"].(map[string]interface{})["content"] != "Paris." || choice["finish_reason"] != "stop" {
+		t.Errorf("encoded = %s", raw)
+	}
+	if ext := decoded["reliapi"].(map[string]interface{}); ext["request_id"] != "req_mock_1" || ext["cost_usd"] != 0.0004 {
+		t.Errorf("reliapi extension = %v", ext)
+	}
+
+	meta, ok := MetaFromContext(ctx)
+	if !ok || meta.RequestID != "req_mock_1" || meta.CacheHit {
+		t.Fatalf("MetaFromContext = %+v, %v", meta, ok)
+	}
+	if _, err := client.Chat.Completions.New(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := MetaFromContext(ctx); !meta.CacheHit {
+		t.Errorf("second call meta = %+v, want a cache hit", meta)
+	}
+	if _, ok := MetaFromContext(context.Background()); ok {
+		t.Error("MetaFromContext found meta in a plain context")
+	}
+}
+
+func TestNewStreaming(t *testing.T) {
+	srv := reliapitest.NewMockServer(t)
+	srv.HandleLLM(func(reliapi.LLMRequest) reliapitest.LLMReply {
+		return reliapitest.LLMReply{Content: "The capital is Paris."}
+	})
+	client := Wrap(srv.Client(), "openai")
+
+	ctx := ContextWithMeta(context.Background())
+	stream := client.Chat.Completions.NewStreaming(ctx, ChatCompletionNewParams{
+		Messages:      []Message{UserMessage("Capital of France?")},
+		StreamOptions: &StreamOptions{IncludeUsage: true},
+	})
+	defer stream.Close()
+	var text strings.Builder
+	var chunks int
+	var usage *CompletionUsage
+	for stream.Next() {
+		chunk := stream.Current()
+		chunks++
+		if chunk.Object != "chat.completion.chunk" || chunk.ID != "chatcmpl-req_mock_1" {
+			t.Errorf("chunk = %+v", chunk)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+			continue
+		}
+		if chunks == 1 && chunk.Choices[0].Delta.Role != "assistant" {
+			t.Errorf("first delta = %+v", chunk.Choices[0].Delta)
+		}
+		text.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if text.String() != "The capital is Paris." || usage == nil || usage.CompletionTokens != 4 {
+		t.Errorf("text = %q, usage = %+v", text.String(), usage)
+	}
+	if meta, ok := MetaFromContext(ctx); !ok || meta.Provider != reliapitest.Provider {
+		t.Errorf("MetaFromContext = %+v, %v", meta, ok)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv := reliapitest.NewMockServer(t)
+	srv.FailNext(2, &reliapi.APIError{StatusCode: 402, Type: "budget_error", Code: reliapi.CodeBudgetExceeded, Message: "over budget"})
+	client := Wrap(srv.Client(), "openai")
+	params := ChatCompletionNewParams{Messages: []Message{UserMessage("hi")}}
+
+	if _, err := client.Chat.Completions.New(context.Background(), params); !reliapi.IsBudgetExceeded(err) {
+		t.Errorf("New err = %v", err)
+	}
+	stream := client.Chat.Completions.NewStreaming(context.Background(), params)
+	if stream.Next() || !reliapi.IsBudgetExceeded(stream.Err()) {
+		t.Errorf("stream err = %v", stream.Err())
+	}
+	stream.Close()
+
+	params.N = Int(2)
+	if _, err := client.Chat.Completions.New(context.Background(), params); !errors.Is(err, ErrMultipleChoices) {
+		t.Errorf("n=2 err = %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package reliapi
+
+import "context"
+
+// Pager walks the pages of a listing of the proxy, such as Jobs,
+// AuditRecords and UsageRows, passing each page's cursor to the next
+// request. Listings are ordered by creation time and ID, so pages don't
+// shift when items are added or expire while they are walked.
+type Pager[T any] struct {
+	ctx    context.Context
+	cursor string
+	fetch  func(ctx context.Context, cursor string) ([]T, string, error)
+}
+
+func newPager[T any](ctx context.Context, cursor string, fetch func(context.Context, string) ([]T, string, error)) *Pager[T] {
+	return &Pager[T]{ctx: ctx, cursor: cursor, fetch: fetch}
+}
+
+// Pages calls fn with the items of each page in turn, until the last page,
+// an error fetching one, or fn returning an error, which Pages returns.
+// It stops with ctx's error when ctx is done between pages. After an
+// error, Cursor resumes from the page that failed, or that fn failed on.
+func (p *Pager[T]) Pages(fn func(page []T) error) error {
+	for {
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+		items, next, err := p.fetch(p.ctx, p.cursor)
+		if err != nil {
+			return err
+		}
+		if err := fn(items); err != nil {
+			return err
+		}
+		if next == "" {
+			p.cursor = ""
+			return nil
+		}
+		p.cursor = next
+	}
+}
+
+// All returns the items of every page.
+func (p *Pager[T]) All() ([]T, error) {
+	var all []T
+	err := p.Pages(func(page []T) error {
+		all = append(all, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// Cursor is the cursor of the next page Pages would fetch, for resuming
+// elsewhere with the query's Cursor; empty once the last page was passed.
+func (p *Pager[T]) Cursor() string { return p.cursor }
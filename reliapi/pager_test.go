@@ -0,0 +1,63 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// countingPager serves pages of one item each, cursors "1" to "n-1".
+func countingPager(ctx context.Context, n int, fetched *[]string) *Pager[int] {
+	return newPager(ctx, "", func(ctx context.Context, cursor string) ([]int, string, error) {
+		*fetched = append(*fetched, cursor)
+		var i int
+		fmt.Sscan(cursor, &i)
+		next := ""
+		if i+1 < n {
+			next = fmt.Sprint(i + 1)
+		}
+		return []int{i}, next, nil
+	})
+}
+
+func TestPagerStopsBetweenPages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var fetched []string
+	p := countingPager(ctx, 5, &fetched)
+
+	err := p.Pages(func(page []int) error {
+		if page[0] == 1 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || len(fetched) != 2 {
+		t.Fatalf("err = %v after fetching %q", err, fetched)
+	}
+	if p.Cursor() != "2" {
+		t.Errorf("Cursor = %q, want the page not fetched", p.Cursor())
+	}
+}
+
+func TestPagerStopsOnCallbackError(t *testing.T) {
+	var fetched []string
+	p := countingPager(context.Background(), 5, &fetched)
+	stop := errors.New("stop")
+
+	err := p.Pages(func(page []int) error {
+		if page[0] == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || p.Cursor() != "2" {
+		t.Errorf("err = %v, Cursor = %q", err, p.Cursor())
+	}
+
+	// Walking again resumes from the page the callback failed on
+	all, err := p.All()
+	if err != nil || len(all) != 3 || all[0] != 2 || p.Cursor() != "" {
+		t.Errorf("All = %v, %v; Cursor = %q", all, err, p.Cursor())
+	}
+}
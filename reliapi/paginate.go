@@ -0,0 +1,336 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxPages is the PaginationConfig.MaxPages used when it is zero.
+const DefaultMaxPages = 100
+
+// ErrMaxPages is yielded by ProxyHTTPPaged when the upstream still has
+// pages after PaginationConfig.MaxPages.
+var ErrMaxPages = errors.New("reliapi: pagination stopped at MaxPages")
+
+// PaginationStrategy selects how ProxyHTTPPaged finds the next page.
+type PaginationStrategy int
+
+const (
+	// PaginateLinkHeader follows the upstream's RFC 5988 Link header
+	// rel="next" URL until a page has none.
+	PaginateLinkHeader PaginationStrategy = iota
+	// PaginateCursor sends the cursor found at PaginationConfig.CursorPath
+	// in each page's body as the CursorParam query parameter of the next,
+	// until a page has no cursor.
+	PaginateCursor
+	// PaginatePageNumber sends PageParam = StartPage, StartPage+1, ...
+	// until a page has no items at ItemsPath.
+	PaginatePageNumber
+)
+
+// PaginationConfig configures ProxyHTTPPaged.
+type PaginationConfig struct {
+	Strategy PaginationStrategy
+	// CursorPath locates the next cursor in a page's JSON body,
+	// JSONPath-style ("$.meta.next_cursor"; the leading "$." is optional).
+	// A missing, null or empty cursor ends the pages. CursorParam is the
+	// query parameter it is sent as, "cursor" if empty.
+	CursorPath  string
+	CursorParam string
+	// PageParam is the page-number query parameter, "page" if empty, and
+	// StartPage the first page requested; 0 means 1.
+	PageParam string
+	StartPage int
+	// ItemsPath locates the array of a page's items in its JSON body, in
+	// the syntax of CursorPath; empty means the body is the array. A page
+	// whose array is missing or empty ends the pages and is not yielded.
+	ItemsPath string
+	// MaxPages bounds the pages requested, DefaultMaxPages if zero.
+	MaxPages int
+}
+
+// ProxyHTTPPaged sends req through ProxyHTTP and keeps requesting the next
+// page as cfg describes, yielding each page's response. Every page is its
+// own request, so GET pages are cached and coalesced independently; an
+// IdempotencyKey gets a ":page-N" suffix per page after the first.
+//
+// Iteration stops after the first error, which is yielded with a nil
+// response: a failed page, ctx ending between pages, or ErrMaxPages.
+// ProxyHTTPAllPages collects the pages, with a *MultiError on failure.
+// PaginateLinkHeader adds "Link" to req.ResponseHeaders and requests each
+// next URL's path and query on the same target, less the prefix its path
+// has in front of req.Path (the target's base URL path).
+func (c *Client) ProxyHTTPPaged(ctx context.Context, req HTTPRequest, cfg PaginationConfig) iter.Seq2[*ReliAPIResponse, error] {
+	return func(yield func(*ReliAPIResponse, error) bool) {
+		maxPages := cfg.MaxPages
+		if maxPages <= 0 {
+			maxPages = DefaultMaxPages
+		}
+		idempotencyKey := req.IdempotencyKey
+		page := cfg.StartPage
+		if page == 0 {
+			page = 1
+		}
+		switch cfg.Strategy {
+		case PaginateLinkHeader:
+			req.ResponseHeaders = withLinkHeader(req.ResponseHeaders)
+		case PaginatePageNumber:
+			req.Query = withQueryParam(req.Query, defaultString(cfg.PageParam, "page"), strconv.Itoa(page))
+		case PaginateCursor:
+			if cfg.CursorPath == "" {
+				yield(nil, errors.New("reliapi: PaginateCursor requires CursorPath"))
+				return
+			}
+		default:
+			yield(nil, fmt.Errorf("reliapi: unknown PaginationStrategy %d", cfg.Strategy))
+			return
+		}
+		linkPrefix := ""
+		for n := 1; ; n++ {
+			if n > maxPages {
+				yield(nil, ErrMaxPages)
+				return
+			}
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			if n > 1 && idempotencyKey != nil {
+				key := fmt.Sprintf("%s:page-%d", *idempotencyKey, n)
+				req.IdempotencyKey = &key
+			}
+			resp, err := c.ProxyHTTP(ctx, req)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			more := false
+			switch cfg.Strategy {
+			case PaginateLinkHeader:
+				var next *url.URL
+				if next, more = nextLink(resp); more {
+					path := next.EscapedPath()
+					if n == 1 {
+						linkPrefix = basePathPrefix(path, req.Path)
+					}
+					req.Path = strings.TrimPrefix(path, linkPrefix)
+					req.Query = queryOf(next.Query())
+					req.QueryArrayFormat = QueryArrayRepeat
+				}
+			case PaginateCursor:
+				var cursor string
+				if cursor, more = pageCursor(resp, cfg.CursorPath); more {
+					req.Query = withQueryParam(req.Query, defaultString(cfg.CursorParam, "cursor"), cursor)
+				}
+			case PaginatePageNumber:
+				if items, _ := jsonPathLookup(responseJSON(resp), cfg.ItemsPath); isEmptyPage(items) {
+					return
+				}
+				page++
+				req.Query = withQueryParam(req.Query, defaultString(cfg.PageParam, "page"), strconv.Itoa(page))
+				more = true
+			}
+			if !yield(resp, nil) || !more {
+				return
+			}
+		}
+	}
+}
+
+// ProxyHTTPAllPages collects the pages of ProxyHTTPPaged. When a page fails
+// it returns the pages before it with a *MultiError whose Errs has one more
+// item than there are pages: the failed page's error, ErrNotCompleted when
+// ctx ended first, or ErrMaxPages.
+func (c *Client) ProxyHTTPAllPages(ctx context.Context, req HTTPRequest, cfg PaginationConfig) ([]*ReliAPIResponse, error) {
+	var pages []*ReliAPIResponse
+	for resp, err := range c.ProxyHTTPPaged(ctx, req, cfg) {
+		if err != nil {
+			if ctx.Err() != nil {
+				err = &notCompletedError{cause: err}
+			}
+			return pages, &MultiError{Errs: append(make([]error, len(pages)), err)}
+		}
+		pages = append(pages, resp)
+	}
+	return pages, nil
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// withLinkHeader returns names with "Link" added unless it already asks
+// for it or for every header.
+func withLinkHeader(names []string) []string {
+	for _, name := range names {
+		if name == "*" || strings.EqualFold(name, "Link") {
+			return names
+		}
+	}
+	return append(append([]string(nil), names...), "Link")
+}
+
+// withQueryParam returns a copy of query with name set to value.
+func withQueryParam(query map[string]interface{}, name, value string) map[string]interface{} {
+	out := make(map[string]interface{}, len(query)+1)
+	for k, v := range query {
+		out[k] = v
+	}
+	out[name] = value
+	return out
+}
+
+func queryOf(values url.Values) map[string]interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make(map[string]interface{}, len(values))
+	for name, v := range values {
+		if len(v) == 1 {
+			out[name] = v[0]
+		} else {
+			out[name] = v
+		}
+	}
+	return out
+}
+
+// nextLink returns the rel="next" URL of resp's Link header.
+func nextLink(resp *ReliAPIResponse) (*url.URL, bool) {
+	for name, values := range resp.Meta.UpstreamHeaders {
+		if !strings.EqualFold(name, "Link") {
+			continue
+		}
+		for _, header := range values {
+			for _, link := range strings.Split(header, ",") {
+				target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+				target = strings.TrimSpace(target)
+				if !ok || !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") || !isNextRel(params) {
+					continue
+				}
+				u, err := url.Parse(target[1 : len(target)-1])
+				if err == nil {
+					return u, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// isNextRel reports whether a link's parameters include rel="next", which
+// may be one of several space-separated relation types.
+func isNextRel(params string) bool {
+	for _, param := range strings.Split(params, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+			continue
+		}
+		for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+			if strings.EqualFold(rel, "next") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// basePathPrefix returns what linkPath has in front of reqPath, the path
+// of the first page, or "" if it does not end with it.
+func basePathPrefix(linkPath, reqPath string) string {
+	reqPath = "/" + strings.TrimPrefix(reqPath, "/")
+	if strings.HasSuffix(linkPath, reqPath) {
+		return strings.TrimSuffix(linkPath, reqPath)
+	}
+	return ""
+}
+
+// responseJSON returns the upstream body of a ProxyHTTP response, decoded
+// if it came as a JSON string.
+func responseJSON(resp *ReliAPIResponse) interface{} {
+	if resp.Meta.RawPassthrough {
+		var decoded interface{}
+		_ = json.Unmarshal(resp.RawData(), &decoded)
+		return decoded
+	}
+	body := resp.DataMap()["body"]
+	if s, ok := body.(string); ok {
+		var decoded interface{}
+		if json.Unmarshal([]byte(s), &decoded) == nil {
+			return decoded
+		}
+	}
+	return body
+}
+
+func pageCursor(resp *ReliAPIResponse, path string) (string, bool) {
+	v, ok := jsonPathLookup(responseJSON(resp), path)
+	if !ok || v == nil {
+		return "", false
+	}
+	var cursor string
+	switch v := v.(type) {
+	case string:
+		cursor = v
+	case float64:
+		cursor = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		raw, _ := json.Marshal(v)
+		cursor = string(raw)
+	}
+	return cursor, cursor != ""
+}
+
+func isEmptyPage(items interface{}) bool {
+	switch items := items.(type) {
+	case []interface{}:
+		return len(items) == 0
+	case map[string]interface{}:
+		return len(items) == 0
+	default:
+		return items == nil
+	}
+}
+
+// jsonPathLookup returns the value at path in v, a decoded JSON document.
+// path is a dotted JSONPath subset: "$.items[0].id", with "$" or "" for
+// v itself.
+func jsonPathLookup(v interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return v, true
+	}
+	for _, segment := range strings.Split(path, ".") {
+		name, rest, _ := strings.Cut(segment, "[")
+		if name != "" {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[name]; !ok {
+				return nil, false
+			}
+		}
+		for rest != "" {
+			index, tail, ok := strings.Cut(rest, "]")
+			i, err := strconv.Atoi(index)
+			arr, isArr := v.([]interface{})
+			if !ok || err != nil || !isArr || i < 0 || i >= len(arr) {
+				return nil, false
+			}
+			v = arr[i]
+			rest = strings.TrimPrefix(tail, "[")
+		}
+	}
+	return v, true
+}
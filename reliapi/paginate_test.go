@@ -0,0 +1,155 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// pagedUpstream answers /v1/proxy/http like the proxy in front of an
+// upstream with five pages of two items each, at base URL path /api.
+type pagedUpstream struct {
+	mu       sync.Mutex
+	requests []HTTPRequest
+}
+
+func (u *pagedUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+	var req HTTPRequest
+	_ = json.Unmarshal(raw, &req)
+	u.mu.Lock()
+	u.requests = append(u.requests, req)
+	u.mu.Unlock()
+
+	page := 1
+	for _, name := range []string{"page", "cursor"} {
+		if v, ok := req.Query[name].(string); ok {
+			page, _ = strconv.Atoi(v)
+		}
+	}
+	items := []interface{}{}
+	if page <= 5 {
+		items = []interface{}{fmt.Sprintf("item-%d-a", page), fmt.Sprintf("item-%d-b", page)}
+	}
+	body := map[string]interface{}{"items": items, "next": nil}
+	meta := map[string]interface{}{"request_id": fmt.Sprintf("req_%d", page), "cache_key": fmt.Sprintf("key-%d", page)}
+	if page < 5 {
+		body["next"] = strconv.Itoa(page + 1)
+		link := fmt.Sprintf(`<https://upstream.example/api%s?page=%d&per_page=2>; rel="next", <https://upstream.example/api%s?page=5>; rel="last"`, req.Path, page+1, req.Path)
+		meta["upstream_headers"] = map[string][]string{"link": {link}}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    map[string]interface{}{"status_code": 200, "body": body},
+		"meta":    meta,
+	})
+}
+
+func collectPages(t *testing.T, pages func(func(*ReliAPIResponse, error) bool)) ([]string, error) {
+	t.Helper()
+	var items []string
+	for resp, err := range pages {
+		if err != nil {
+			return items, err
+		}
+		for _, item := range responseJSON(resp).(map[string]interface{})["items"].([]interface{}) {
+			items = append(items, item.(string))
+		}
+	}
+	return items, nil
+}
+
+func TestProxyHTTPPaged(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      PaginationConfig
+		requests int
+	}{
+		{"link header", PaginationConfig{Strategy: PaginateLinkHeader}, 5},
+		{"cursor", PaginationConfig{Strategy: PaginateCursor, CursorPath: "$.next"}, 5},
+		// The empty sixth page ends the pages
+		{"page number", PaginationConfig{Strategy: PaginatePageNumber, ItemsPath: "$.items"}, 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			up := &pagedUpstream{}
+			c := newTestClient(t, up.ServeHTTP)
+			key := "list-users"
+			req := HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/users", IdempotencyKey: &key}
+
+			items, err := collectPages(t, c.ProxyHTTPPaged(context.Background(), req, tc.cfg))
+			if err != nil {
+				t.Fatalf("pages: %v", err)
+			}
+			if len(items) != 10 || items[0] != "item-1-a" || items[9] != "item-5-b" {
+				t.Errorf("items = %v", items)
+			}
+			if len(up.requests) != tc.requests {
+				t.Fatalf("requests = %d, want %d", len(up.requests), tc.requests)
+			}
+			second := up.requests[1]
+			if second.Path != "/users" || *second.IdempotencyKey != "list-users:page-2" {
+				t.Errorf("second request = %+v", second)
+			}
+			if tc.cfg.Strategy == PaginateLinkHeader && (len(second.ResponseHeaders) != 1 || second.Query["per_page"] != "2") {
+				t.Errorf("second request = %+v", second)
+			}
+		})
+	}
+}
+
+func TestProxyHTTPPagedLimits(t *testing.T) {
+	up := &pagedUpstream{}
+	c := newTestClient(t, up.ServeHTTP)
+	req := HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/users"}
+
+	items, err := collectPages(t, c.ProxyHTTPPaged(context.Background(), req, PaginationConfig{Strategy: PaginateCursor, CursorPath: "next", MaxPages: 3}))
+	if !errors.Is(err, ErrMaxPages) || len(items) != 6 {
+		t.Errorf("items = %v, err = %v; want 3 pages and ErrMaxPages", items, err)
+	}
+
+	// Canceling between pages stops the iteration with the context's error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	up.requests = nil
+	pages := 0
+	for resp, err := range c.ProxyHTTPPaged(ctx, req, PaginationConfig{}) {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("err = %v", err)
+			}
+			break
+		}
+		pages++
+		if resp.Meta.RequestID == "req_2" {
+			cancel()
+		}
+	}
+	if pages != 2 || len(up.requests) != 2 {
+		t.Errorf("pages = %d, requests = %d; want 2", pages, len(up.requests))
+	}
+
+	// Breaking out of the loop requests no further page
+	up.requests = nil
+	for range c.ProxyHTTPPaged(context.Background(), req, PaginationConfig{Strategy: PaginatePageNumber, ItemsPath: "items"}) {
+		break
+	}
+	if len(up.requests) != 1 {
+		t.Errorf("requests = %d after break, want 1", len(up.requests))
+	}
+}
+
+func TestJSONPathLookup(t *testing.T) {
+	var doc interface{}
+	_ = json.Unmarshal([]byte(`{"meta":{"pages":[{"next":"abc"}]},"n":2}`), &doc)
+	for path, want := range map[string]interface{}{"$.meta.pages[0].next": "abc", "n": 2.0, "$.missing": nil, "meta.pages[3]": nil} {
+		if got, _ := jsonPathLookup(doc, path); got != want {
+			t.Errorf("jsonPathLookup(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
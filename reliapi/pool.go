@@ -0,0 +1,102 @@
+package reliapi
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultMaxIdleConnsPerHost is how many idle connections to the proxy
+	// the shared transport keeps. A client talks to one host, so this is
+	// raised from net/http's 2 to roughly the concurrency of a busy
+	// service; calls beyond it still run, on connections closed afterwards.
+	DefaultMaxIdleConnsPerHost = 64
+	// DefaultIdleConnTimeout is how long an idle connection is kept open
+	// (see WithIdleConnTimeout).
+	DefaultIdleConnTimeout = 90 * time.Second
+
+	// maxDrainBytes bounds what is read from a body only to reuse its
+	// connection; past it, closing the connection is cheaper.
+	maxDrainBytes = 256 << 10
+)
+
+// sharedTransport pools the connections of every Client built without
+// WithHTTPClient or WithTransport, so clients created per call still reuse
+// the connections (and TLS sessions) of the ones before them.
+var sharedTransport = newTransport()
+
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = 2 * DefaultMaxIdleConnsPerHost
+	t.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	t.IdleConnTimeout = DefaultIdleConnTimeout
+	t.ForceAttemptHTTP2 = true
+	return t
+}
+
+// WithTransport sets the transport requests are sent with, instead of the
+// transport shared by the package's clients. WithMaxConnsPerHost and
+// WithIdleConnTimeout apply to a copy of it. It has no effect together
+// with WithHTTPClient; configure that client's Transport instead.
+func WithTransport(t *http.Transport) Option {
+	return func(c *Client) {
+		c.transport = t
+	}
+}
+
+// WithMaxConnsPerHost caps the connections to the proxy, idle or in use,
+// at n; calls beyond it wait for a connection. It also keeps up to n idle.
+// The default has no cap. Like WithIdleConnTimeout, it gives the client a
+// transport of its own.
+func WithMaxConnsPerHost(n int) Option {
+	return func(c *Client) {
+		c.maxConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection to the proxy is kept
+// open for reuse; the default is DefaultIdleConnTimeout. Keep it below the
+// idle timeout of load balancers in front of the proxy, so the client never
+// reuses a connection they have dropped.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.idleConnTimeout = d
+	}
+}
+
+// clientTransport returns the transport of a client configured with opts'
+// pooling options.
+func (c *Client) clientTransport() *http.Transport {
+	t := c.transport
+	if t == nil {
+		t = sharedTransport
+	}
+	if c.maxConnsPerHost <= 0 && c.idleConnTimeout <= 0 {
+		return t
+	}
+	t = t.Clone()
+	if c.maxConnsPerHost > 0 {
+		t.MaxConnsPerHost = c.maxConnsPerHost
+		t.MaxIdleConnsPerHost = c.maxConnsPerHost
+	}
+	if c.idleConnTimeout > 0 {
+		t.IdleConnTimeout = c.idleConnTimeout
+	}
+	return t
+}
+
+// CloseIdleConnections closes the client's idle connections to the proxy,
+// e.g. after a burst of calls or before the proxy is redeployed. Clients on
+// the shared transport share their idle connections, so it closes those of
+// the others too. Connections in use are not affected.
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// drainAndClose reads what is left of a response body, up to a bound, and
+// closes it, so its connection goes back to the pool.
+func drainAndClose(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes))
+	body.Close()
+}
@@ -0,0 +1,140 @@
+package reliapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingServer serves the proxy's LLM success envelope, or a 500 with a
+// large body to cache invalidations, and counts the connections made to it.
+func countingServer(tb testing.TB, tls bool) (*httptest.Server, *int64) {
+	var conns int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/cache") {
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"success": false,
+				"error":   map[string]interface{}{"code": "INTERNAL_ERROR", "message": strings.Repeat("x", 100<<10)},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "hi"},
+			"meta":    map[string]interface{}{"request_id": "req_1"},
+		})
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	if tls {
+		srv.StartTLS()
+	} else {
+		srv.Start()
+	}
+	tb.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+var poolRequest = LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("hi")}}
+
+func TestClientsShareConnections(t *testing.T) {
+	srv, conns := countingServer(t, false)
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		// A client per call, as services often do, still reuses the pool
+		c, err := NewClient(srv.URL, "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.ProxyLLM(ctx, poolRequest); err != nil {
+			t.Fatal(err)
+		}
+		// Error bodies are drained, leaving the connection reusable
+		if err := c.InvalidateCache(ctx, CacheRef{Key: "k"}); err == nil {
+			t.Fatal("expected the 500 to fail")
+		}
+	}
+	if n := atomic.LoadInt64(conns); n != 1 {
+		t.Errorf("%d connections, want 1", n)
+	}
+
+	c, _ := NewClient(srv.URL, "k")
+	c.CloseIdleConnections()
+	if _, err := c.ProxyLLM(ctx, poolRequest); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(conns); n != 2 {
+		t.Errorf("%d connections after CloseIdleConnections, want 2", n)
+	}
+}
+
+func TestClientTransportOptions(t *testing.T) {
+	c, _ := NewClient("http://proxy", "k")
+	if c.httpClient.Transport != sharedTransport {
+		t.Error("default client doesn't use the shared transport")
+	}
+	own := &http.Transport{MaxIdleConnsPerHost: 3}
+	c, _ = NewClient("http://proxy", "k", WithTransport(own))
+	if c.httpClient.Transport != own {
+		t.Error("WithTransport not used as is")
+	}
+	c, _ = NewClient("http://proxy", "k", WithTransport(own), WithMaxConnsPerHost(8), WithIdleConnTimeout(time.Second))
+	tr := c.httpClient.Transport.(*http.Transport)
+	if tr == own || tr.MaxConnsPerHost != 8 || tr.MaxIdleConnsPerHost != 8 || tr.IdleConnTimeout != time.Second {
+		t.Errorf("transport = %+v", tr)
+	}
+	if own.MaxConnsPerHost != 0 || sharedTransport.MaxConnsPerHost != 0 {
+		t.Error("pooling options changed a shared transport")
+	}
+	hc := &http.Client{}
+	c, _ = NewClient("http://proxy", "k", WithHTTPClient(hc), WithMaxConnsPerHost(8))
+	if c.httpClient != hc || hc.Transport != nil {
+		t.Error("pooling options applied to WithHTTPClient's client")
+	}
+}
+
+// benchmarkSequentialCalls makes b.N calls to a TLS proxy, one after the
+// other, with the clients newClient returns, and reports the TLS
+// connections (so handshakes) per call. Run with -benchtime 10000x.
+func benchmarkSequentialCalls(b *testing.B, newClient func(*httptest.Server) *Client) {
+	srv, conns := countingServer(b, true)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := newClient(srv).ProxyLLM(ctx, poolRequest); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(conns))/float64(b.N), "handshakes/op")
+}
+
+// BenchmarkSequentialCallsPooled shares one client and its transport.
+func BenchmarkSequentialCallsPooled(b *testing.B) {
+	var c *Client
+	benchmarkSequentialCalls(b, func(srv *httptest.Server) *Client {
+		if c == nil {
+			c, _ = NewClient(srv.URL, "k", WithTransport(srv.Client().Transport.(*http.Transport)))
+		}
+		return c
+	})
+}
+
+// BenchmarkSequentialCallsPerCallClient builds a client with a new
+// http.Client and transport per call, as services building one per call
+// did before the shared transport.
+func BenchmarkSequentialCallsPerCallClient(b *testing.B) {
+	benchmarkSequentialCalls(b, func(srv *httptest.Server) *Client {
+		tr := srv.Client().Transport.(*http.Transport).Clone()
+		c, _ := NewClient(srv.URL, "k", WithHTTPClient(&http.Client{Transport: tr}))
+		b.Cleanup(tr.CloseIdleConnections)
+		return c
+	})
+}
@@ -0,0 +1,119 @@
+package reliapi
+
+import (
+	"encoding/json"
+)
+
+// ProviderMeta is the provider-specific metadata of a completion. Fields are
+// set when the provider reports them. Decoding it never fails a response: a
+// block whose shape a provider changed is kept in Raw instead.
+type ProviderMeta struct {
+	// ID is the provider's response ID (chatcmpl-..., msg_...).
+	ID string
+	// Model is the model snapshot that served the request, such as
+	// gpt-4o-mini-2024-07-18 for a request for gpt-4o-mini.
+	Model string
+	// SystemFingerprint identifies the OpenAI backend configuration; a
+	// change explains output differences between identical requests.
+	SystemFingerprint string
+	// StopSequence is the Anthropic stop sequence that ended generation.
+	StopSequence string
+	// SafetyRatings are Gemini's ratings of the first candidate.
+	SafetyRatings []SafetyRating
+	// CitationMetadata is Gemini's citation block of the first candidate,
+	// undecoded because its shape differs between API versions.
+	CitationMetadata json.RawMessage
+	// Raw holds metadata fields that are not decoded above, including
+	// known fields whose value did not have the expected type.
+	Raw map[string]json.RawMessage
+}
+
+// SafetyRating is a Gemini safety rating.
+type SafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+// completionFields are the top-level fields of raw provider bodies that
+// make up the completion itself rather than its metadata.
+var completionFields = map[string]bool{
+	"choices": true, "usage": true, "content": true, "role": true, "type": true,
+	"finish_reason": true, "stop_reason": true, "candidates": true,
+	"usageMetadata": true, "object": true, "created": true,
+	// ReliAPI normalized payload
+	"provider_meta": true,
+}
+
+// metaStringFields maps provider metadata keys to ProviderMeta fields.
+var metaStringFields = map[string]func(*ProviderMeta) *string{
+	"id":                 func(m *ProviderMeta) *string { return &m.ID },
+	"responseId":         func(m *ProviderMeta) *string { return &m.ID },
+	"model":              func(m *ProviderMeta) *string { return &m.Model },
+	"modelVersion":       func(m *ProviderMeta) *string { return &m.Model },
+	"system_fingerprint": func(m *ProviderMeta) *string { return &m.SystemFingerprint },
+	"stop_sequence":      func(m *ProviderMeta) *string { return &m.StopSequence },
+}
+
+// decodeProviderMeta extracts ProviderMeta from a completion body: the
+// proxy's normalized provider_meta block, or the top-level metadata of a raw
+// OpenAI, Anthropic or Gemini response.
+func decodeProviderMeta(raw []byte) ProviderMeta {
+	var meta ProviderMeta
+	var top map[string]json.RawMessage
+	if json.Unmarshal(raw, &top) != nil {
+		return meta
+	}
+
+	fields := top
+	if block, ok := top["provider_meta"]; ok {
+		fields = nil
+		if json.Unmarshal(block, &fields) != nil {
+			meta.addRaw("provider_meta", block)
+			return meta
+		}
+	}
+	for name, value := range fields {
+		if isNull(value) {
+			continue
+		}
+		if field, ok := metaStringFields[name]; ok {
+			if json.Unmarshal(value, field(&meta)) != nil {
+				meta.addRaw(name, value)
+			}
+			continue
+		}
+		if !completionFields[name] && name != "safetyRatings" && name != "citationMetadata" {
+			meta.addRaw(name, value)
+		}
+	}
+
+	// The proxy normalizes a Gemini response's first candidate blocks into
+	// provider_meta; a raw response has them in the candidate
+	candidate := fields
+	var candidates []map[string]json.RawMessage
+	if c, ok := top["candidates"]; ok && json.Unmarshal(c, &candidates) == nil && len(candidates) > 0 {
+		candidate = candidates[0]
+	}
+	if ratings, ok := candidate["safetyRatings"]; ok && !isNull(ratings) {
+		if json.Unmarshal(ratings, &meta.SafetyRatings) != nil {
+			meta.SafetyRatings = nil
+			meta.addRaw("safetyRatings", ratings)
+		}
+	}
+	if citations, ok := candidate["citationMetadata"]; ok && !isNull(citations) {
+		meta.CitationMetadata = citations
+	}
+	return meta
+}
+
+func (m *ProviderMeta) addRaw(name string, value json.RawMessage) {
+	if m.Raw == nil {
+		m.Raw = make(map[string]json.RawMessage)
+	}
+	m.Raw[name] = value
+}
+
+func isNull(v json.RawMessage) bool {
+	return len(v) == 0 || string(v) == "null"
+}
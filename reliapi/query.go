@@ -0,0 +1,146 @@
+package reliapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// QueryArrayFormat selects how HTTPRequest.Query sends slice values.
+type QueryArrayFormat string
+
+const (
+	// QueryArrayRepeat repeats the parameter: tag=a&tag=b. It is the
+	// default.
+	QueryArrayRepeat QueryArrayFormat = "repeat"
+	// QueryArrayComma joins the values: tag=a,b.
+	QueryArrayComma QueryArrayFormat = "comma"
+	// QueryArrayBracket repeats the parameter with a [] suffix:
+	// tag[]=a&tag[]=b.
+	QueryArrayBracket QueryArrayFormat = "bracket"
+)
+
+// ErrInvalidQuery is returned for an HTTPRequest whose Query holds a value
+// with no defined encoding: a map, a struct, a slice of slices, or a NaN or
+// infinite number.
+var ErrInvalidQuery = errors.New("reliapi: invalid query parameter")
+
+// normalizeQuery returns query with every value in the canonical form the
+// proxy gives it (core/query.py): a string, or a []string for a parameter
+// sent more than once. Strings are kept as is, to be escaped once when the
+// URL is built; booleans are "true" or "false", nil is empty, and numbers
+// are written in full without exponent, so 10 and 10.0 are both "10".
+// Slices follow format, and empty ones send no parameter.
+func normalizeQuery(query map[string]interface{}, format QueryArrayFormat) (map[string]interface{}, error) {
+	if query == nil {
+		return nil, nil
+	}
+	switch format {
+	case "", QueryArrayRepeat, QueryArrayComma, QueryArrayBracket:
+	default:
+		return nil, fmt.Errorf("%w: unknown QueryArrayFormat %q", ErrInvalidQuery, format)
+	}
+	out := make(map[string]interface{}, len(query))
+	for name, v := range query {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			s, err := queryScalar(name, v)
+			if err != nil {
+				return nil, err
+			}
+			out[name] = s
+			continue
+		}
+		items := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			item := rv.Index(i).Interface()
+			if k := reflect.ValueOf(item).Kind(); k == reflect.Slice || k == reflect.Array {
+				return nil, fmt.Errorf("%w: %q nests a slice; only flat slices are supported", ErrInvalidQuery, name)
+			}
+			s, err := queryScalar(name, item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, s)
+		}
+		switch {
+		case len(items) == 0:
+		case format == QueryArrayComma:
+			out[name] = strings.Join(items, ",")
+		case format == QueryArrayBracket:
+			out[name+"[]"] = items
+		default:
+			out[name] = items
+		}
+	}
+	return out, nil
+}
+
+// queryScalar returns the canonical form of a single query value.
+func queryScalar(name string, v interface{}) (string, error) {
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return "", fmt.Errorf("%w: %q is not a number: %v", ErrInvalidQuery, name, err)
+		}
+		return queryFloat(name, f, 64)
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return "", nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return "", nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		return queryFloat(name, rv.Float(), 32)
+	case reflect.Float64:
+		return queryFloat(name, rv.Float(), 64)
+	case reflect.Map:
+		return "", fmt.Errorf("%w: %q is a map; nested query values are not supported", ErrInvalidQuery, name)
+	default:
+		return "", fmt.Errorf("%w: %q has unsupported type %T", ErrInvalidQuery, name, v)
+	}
+}
+
+func queryFloat(name string, f float64, bitSize int) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("%w: %q must be a finite number", ErrInvalidQuery, name)
+	}
+	if f == 0 {
+		// Covers -0, which the proxy also writes as "0".
+		return "0", nil
+	}
+	return strconv.FormatFloat(f, 'f', -1, bitSize), nil
+}
+
+// addQuery adds a normalized query to q.
+func addQuery(q url.Values, query map[string]interface{}) {
+	for name, v := range query {
+		switch v := v.(type) {
+		case string:
+			q.Add(name, v)
+		case []string:
+			q[name] = append(q[name], v...)
+		}
+	}
+}
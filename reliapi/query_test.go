@@ -0,0 +1,119 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	f32 := float32(0.1)
+	query := map[string]interface{}{
+		"i":    10,
+		"f":    10.0,
+		"tiny": 1.5e-7,
+		"big":  1e21,
+		"f32":  &f32,
+		"num":  json.Number("2.50"),
+		"on":   true,
+		"nil":  nil,
+		"tag":  []string{"a", "b"},
+		"mix":  []interface{}{"x", 2, false},
+		"none": []string{},
+	}
+	tests := []struct {
+		format QueryArrayFormat
+		want   map[string]interface{}
+	}{
+		{"", map[string]interface{}{
+			"i": "10", "f": "10", "tiny": "0.00000015", "big": "1000000000000000000000", "f32": "0.1",
+			"num": "2.5", "on": "true", "nil": "", "tag": []string{"a", "b"}, "mix": []string{"x", "2", "false"},
+		}},
+		{QueryArrayComma, map[string]interface{}{
+			"i": "10", "f": "10", "tiny": "0.00000015", "big": "1000000000000000000000", "f32": "0.1",
+			"num": "2.5", "on": "true", "nil": "", "tag": "a,b", "mix": "x,2,false",
+		}},
+		{QueryArrayBracket, map[string]interface{}{
+			"i": "10", "f": "10", "tiny": "0.00000015", "big": "1000000000000000000000", "f32": "0.1",
+			"num": "2.5", "on": "true", "nil": "", "tag[]": []string{"a", "b"}, "mix[]": []string{"x", "2", "false"},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := normalizeQuery(query, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeQueryRejects(t *testing.T) {
+	for name, query := range map[string]map[string]interface{}{
+		"map":    {"filter": map[string]interface{}{"a": 1}},
+		"nested": {"tag": [][]string{{"a"}}},
+		"struct": {"s": struct{}{}},
+		"nan":    {"n": math.NaN()},
+		"inf":    {"n": []float64{math.Inf(1)}},
+	} {
+		if _, err := normalizeQuery(query, ""); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+	if _, err := normalizeQuery(map[string]interface{}{"a": "b"}, "csv"); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("unknown format: err = %v", err)
+	}
+}
+
+func TestProxyHTTPInvalidQuery(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request with an invalid query was sent")
+	})
+	_, err := c.ProxyHTTP(context.Background(), HTTPRequest{
+		Target: "api", Method: "GET", Path: "/",
+		Query: map[string]interface{}{"filter": map[string]string{"status": "open"}},
+	})
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestToHTTPRequestQueryEscaping(t *testing.T) {
+	base, _ := url.Parse("https://api.example.com")
+	req, err := ToHTTPRequest(HTTPRequest{
+		Method: "GET",
+		Path:   "/search?q=a%20b",
+		Query: map[string]interface{}{
+			"name":  "héllo wörld",
+			"empty": "",
+			"pct":   "100%25",
+			"tag":   []string{"a,b", "c"},
+		},
+		QueryArrayFormat: QueryArrayBracket,
+	}, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Values are escaped exactly once: the path's encoded query is kept as
+	// sent, and a literal "%25" in a value reaches the upstream unchanged.
+	q := req.URL.Query()
+	want := url.Values{
+		"q":     {"a b"},
+		"name":  {"héllo wörld"},
+		"empty": {""},
+		"pct":   {"100%25"},
+		"tag[]": {"a,b", "c"},
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("query = %v, want %v", q, want)
+	}
+	if raw := req.URL.RawQuery; raw != "empty=&name=h%C3%A9llo+w%C3%B6rld&pct=100%2525&q=a+b&tag%5B%5D=a%2Cb&tag%5B%5D=c" {
+		t.Errorf("RawQuery = %s", raw)
+	}
+}
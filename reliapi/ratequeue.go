@@ -0,0 +1,350 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRateLimitQueueFull is matched by a RateLimitQueueFullError.
+	ErrRateLimitQueueFull = errors.New("reliapi: rate limit queue full")
+	// ErrClientClosed is returned for requests parked under
+	// WithRateLimitQueueing when the client is closed, and for those
+	// rate-limited after it.
+	ErrClientClosed = errors.New("reliapi: client closed")
+)
+
+// RateLimitQueueFullError is returned under WithRateLimitQueueing for a
+// rate-limited request that found the queue full, or that a request of a
+// higher priority displaced from it. It matches ErrRateLimitQueueFull and
+// is retriable.
+type RateLimitQueueFullError struct {
+	// Queued is how many requests were parked.
+	Queued int
+	// RetryAfter is the wait the proxy asked for.
+	RetryAfter time.Duration
+	// Displaced reports that the request was parked until one of a higher
+	// priority took its place.
+	Displaced bool
+}
+
+func (e *RateLimitQueueFullError) Error() string {
+	if e.Displaced {
+		return fmt.Sprintf("%v: displaced by a request of higher priority (%d queued)", ErrRateLimitQueueFull, e.Queued)
+	}
+	return fmt.Sprintf("%v: %d requests queued, retry after %v", ErrRateLimitQueueFull, e.Queued, e.RetryAfter)
+}
+
+// Is reports whether target is ErrRateLimitQueueFull.
+func (e *RateLimitQueueFullError) Is(target error) bool { return target == ErrRateLimitQueueFull }
+
+// RateLimitQueueStats is a snapshot of the queue of WithRateLimitQueueing.
+type RateLimitQueueStats struct {
+	// Queued is how many requests are parked, and InFlight how many sent
+	// again from the queue await their answer.
+	Queued   int
+	InFlight int
+	// Window is how many requests the queue may have in flight at once.
+	Window int
+	// Parked counts the requests parked so far, Rejected those that failed
+	// with ErrRateLimitQueueFull, and Expired those whose context ended
+	// while they were parked.
+	Parked   int64
+	Rejected int64
+	Expired  int64
+	// TotalWait is the time the requests dispatched spent parked.
+	TotalWait time.Duration
+}
+
+// WithRateLimitQueueing makes requests rate-limited by the proxy (a 429)
+// wait their turn instead of failing: each is parked in a delay queue for
+// the wait the proxy asked for in Retry-After, or else the WithRetry
+// backoff, and sent again when it elapses, as often as it is rate-limited
+// again. Parking doesn't use up WithRetry's attempts. A request fails with
+// the 429 once its waits would add up to more than maxWait, or run past
+// its context's deadline; a parked request whose context ends leaves the
+// queue with the context's error, and Close fails those parked with
+// ErrClientClosed.
+//
+// Requests due are dispatched by priority (LLMRequest.Priority, with other
+// requests as PriorityDefault), then in the order they came due, and no
+// more at once than the queue's window allows: one after a 429, doubling
+// with each answer that isn't one, so a limit that was just refilled isn't
+// emptied again by a burst. With maxQueued requests parked, a request of a
+// higher priority displaces the lowest-priority one due last; otherwise it
+// fails with a RateLimitQueueFullError.
+//
+// Only requests that WithRetry would resend are parked; LLM calls are
+// given an idempotency key for it as under WithRetry. RateLimitQueueStats
+// reports the queue, and WithMetrics exports
+// reliapi_client_rate_limit_queue_depth and
+// reliapi_client_rate_limit_queue_wait_seconds.
+func WithRateLimitQueueing(maxWait time.Duration, maxQueued int) Option {
+	return func(c *Client) {
+		if maxQueued < 1 {
+			maxQueued = 1
+		}
+		if c.retry.baseDelay <= 0 {
+			c.retry.baseDelay = 100 * time.Millisecond
+			c.retry.maxDelay = defaultMaxRetryDelay
+		}
+		c.rateQueue = newRateQueue(maxWait, maxQueued)
+	}
+}
+
+// RateLimitQueueStats reports the queue of WithRateLimitQueueing; zero
+// without it.
+func (c *Client) RateLimitQueueStats() RateLimitQueueStats {
+	if c.rateQueue == nil {
+		return RateLimitQueueStats{}
+	}
+	return c.rateQueue.snapshot()
+}
+
+type queuePriorityKey struct{}
+
+// withQueuePriority records the LLMRequest.Priority of the request sent
+// with ctx, for the rate limit queue.
+func withQueuePriority(ctx context.Context, priority string) context.Context {
+	if priority == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, queuePriorityKey{}, priority)
+}
+
+// queueRank orders the priority of the request sent with ctx, the highest
+// first.
+func queueRank(ctx context.Context) int {
+	switch p, _ := ctx.Value(queuePriorityKey{}).(string); p {
+	case PriorityInteractive:
+		return 0
+	case PriorityBatch:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// queueClock is the time of a rateQueue, faked in tests.
+type queueClock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+// parkedRequest is a request waiting in a rateQueue. ready receives nil
+// when it is dispatched, or the error it leaves the queue with.
+type parkedRequest struct {
+	rank     int
+	due      time.Time
+	parkedAt time.Time
+	seq      uint64
+	ready    chan error
+}
+
+// before reports whether p is dispatched before q once both are due.
+func (p *parkedRequest) before(q *parkedRequest) bool {
+	if p.rank != q.rank {
+		return p.rank < q.rank
+	}
+	if !p.due.Equal(q.due) {
+		return p.due.Before(q.due)
+	}
+	return p.seq < q.seq
+}
+
+type rateQueue struct {
+	maxWait   time.Duration
+	maxQueued int
+	clock     queueClock
+	metrics   *clientMetrics
+
+	mu       sync.Mutex
+	parked   []*parkedRequest
+	seq      uint64
+	inFlight int
+	window   int
+	closed   bool
+	stop     func() bool // of the timer for the next due request
+	stats    RateLimitQueueStats
+}
+
+func newRateQueue(maxWait time.Duration, maxQueued int) *rateQueue {
+	return &rateQueue{maxWait: maxWait, maxQueued: maxQueued, clock: realClock{}, window: 1}
+}
+
+// park queues a rate-limited request for wait and blocks until it is
+// dispatched, returning the func to call with whether its next attempt
+// was rate-limited again.
+func (q *rateQueue) park(ctx context.Context, rank int, wait time.Duration) (func(limited bool), error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	if len(q.parked) >= q.maxQueued {
+		last := q.parked[0]
+		for _, p := range q.parked[1:] {
+			if last.before(p) {
+				last = p
+			}
+		}
+		if last.rank <= rank {
+			q.stats.Rejected++
+			q.mu.Unlock()
+			return nil, &RateLimitQueueFullError{Queued: q.maxQueued, RetryAfter: wait}
+		}
+		q.remove(last)
+		q.stats.Rejected++
+		last.ready <- &RateLimitQueueFullError{Queued: q.maxQueued, RetryAfter: last.due.Sub(q.clock.Now()), Displaced: true}
+	}
+	now := q.clock.Now()
+	q.seq++
+	p := &parkedRequest{rank: rank, due: now.Add(wait), parkedAt: now, seq: q.seq, ready: make(chan error, 1)}
+	q.parked = append(q.parked, p)
+	q.stats.Parked++
+	q.dispatch()
+	q.mu.Unlock()
+
+	select {
+	case err := <-p.ready:
+		if err != nil {
+			return nil, err
+		}
+		return q.done, nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if !q.remove(p) {
+			// Dispatched or displaced meanwhile
+			if err := <-p.ready; err == nil {
+				q.finish(false)
+			}
+			return nil, ctx.Err()
+		}
+		q.stats.Expired++
+		q.observeDepth()
+		return nil, ctx.Err()
+	}
+}
+
+// done ends the attempt of a dispatched request and dispatches more.
+func (q *rateQueue) done(limited bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.finish(limited)
+}
+
+func (q *rateQueue) finish(limited bool) {
+	q.inFlight--
+	if limited {
+		q.window = 1
+	} else if q.window < q.maxQueued {
+		q.window *= 2
+	}
+	q.dispatch()
+}
+
+// dispatch sends out the requests due, as many as the window allows, and
+// arms the timer for the next one to come due. q.mu is held.
+func (q *rateQueue) dispatch() {
+	now := q.clock.Now()
+	for q.inFlight < q.window {
+		var next *parkedRequest
+		for _, p := range q.parked {
+			if !p.due.After(now) && (next == nil || p.before(next)) {
+				next = p
+			}
+		}
+		if next == nil {
+			break
+		}
+		q.remove(next)
+		q.inFlight++
+		waited := now.Sub(next.parkedAt)
+		q.stats.TotalWait += waited
+		if q.metrics != nil {
+			q.metrics.queueWait.Observe(waited.Seconds())
+		}
+		next.ready <- nil
+	}
+	q.observeDepth()
+
+	if q.stop != nil {
+		q.stop()
+		q.stop = nil
+	}
+	var soonest time.Time
+	for _, p := range q.parked {
+		if p.due.After(now) && (soonest.IsZero() || p.due.Before(soonest)) {
+			soonest = p.due
+		}
+	}
+	if !soonest.IsZero() {
+		q.stop = q.clock.AfterFunc(soonest.Sub(now), func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.dispatch()
+		})
+	}
+}
+
+// remove takes p out of the queue, reporting whether it was in it.
+func (q *rateQueue) remove(p *parkedRequest) bool {
+	for i, other := range q.parked {
+		if other == p {
+			q.parked = append(q.parked[:i], q.parked[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *rateQueue) observeDepth() {
+	if q.metrics != nil {
+		q.metrics.queueDepth.Set(float64(len(q.parked)))
+	}
+}
+
+// close fails the parked requests and any parked later with
+// ErrClientClosed.
+func (q *rateQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	for _, p := range q.parked {
+		p.ready <- ErrClientClosed
+	}
+	q.parked = nil
+	if q.stop != nil {
+		q.stop()
+		q.stop = nil
+	}
+	q.observeDepth()
+}
+
+func (q *rateQueue) snapshot() RateLimitQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := q.stats
+	s.Queued = len(q.parked)
+	s.InFlight = q.inFlight
+	s.Window = q.window
+	return s
+}
+
+// rateLimited reports whether resp is a 429 worth parking for.
+func rateLimited(resp *http.Response, err error) bool {
+	return err == nil && resp.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,335 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeClock is a queueClock that only moves on Advance.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		stopped := !t.stopped
+		t.stopped = true
+		return stopped
+	}
+}
+
+// Advance moves the clock by d and runs the timers that came due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []func()
+	for _, t := range c.timers {
+		if !t.stopped && !t.at.After(c.now) {
+			t.stopped = true
+			due = append(due, t.f)
+		}
+	}
+	c.mu.Unlock()
+	for _, f := range due {
+		f()
+	}
+}
+
+// burstLimiter is a proxy that lets burst LLM calls through per second of
+// its clock and answers the rest with a 429 and Retry-After: 1. It records
+// the targets of the calls it let through.
+type burstLimiter struct {
+	clock *fakeClock
+	burst int
+
+	mu     sync.Mutex
+	second time.Time
+	used   int
+	served []string
+}
+
+func (l *burstLimiter) handle(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req LLMRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		l.mu.Lock()
+		if now := l.clock.Now().Truncate(time.Second); !now.Equal(l.second) {
+			l.second, l.used = now, 0
+		}
+		limited := l.used >= l.burst
+		if !limited {
+			l.used++
+			l.served = append(l.served, req.Target)
+		}
+		l.mu.Unlock()
+		if limited {
+			w.Header().Set("Retry-After", "1")
+			writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{"detail": "rate limited"})
+			return
+		}
+		okLLMResponse(w)
+	}
+}
+
+func (l *burstLimiter) servedTargets() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.served...)
+}
+
+func newQueueingClient(t *testing.T, burst, maxQueued int, opts ...Option) (*Client, *fakeClock, *burstLimiter) {
+	t.Helper()
+	clock := &fakeClock{now: time.Now()}
+	limiter := &burstLimiter{clock: clock, burst: burst}
+	c := newTestClient(t, limiter.handle(t), append(opts, WithRateLimitQueueing(time.Minute, maxQueued))...)
+	c.rateQueue.clock = clock
+	return c, clock, limiter
+}
+
+// waitForQueue blocks until the queue holds queued requests and none is
+// in flight.
+func waitForQueue(t *testing.T, c *Client, queued int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if s := c.RateLimitQueueStats(); s.Queued == queued && s.InFlight == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued requests: %+v", queued, c.RateLimitQueueStats())
+}
+
+func isStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// queuedCall is a ProxyLLM call running in the background.
+type queuedCall struct {
+	done chan struct{}
+	err  error
+}
+
+func startCall(ctx context.Context, c *Client, target, priority string) *queuedCall {
+	call := &queuedCall{done: make(chan struct{})}
+	go func() {
+		defer close(call.done)
+		_, call.err = c.ProxyLLM(ctx, LLMRequest{Target: target, Priority: priority, Messages: []ChatMessage{{Role: "user", Content: "hi"}}})
+	}()
+	return call
+}
+
+func (call *queuedCall) wait(t *testing.T) error {
+	t.Helper()
+	select {
+	case <-call.done:
+		return call.err
+	case <-time.After(5 * time.Second):
+		t.Fatal("call did not return")
+		return nil
+	}
+}
+
+func TestRateLimitQueueingOrdersByPriority(t *testing.T) {
+	c, clock, limiter := newQueueingClient(t, 1, 10)
+	ctx := context.Background()
+
+	// The first call uses up the second's burst
+	if err := startCall(ctx, c, "first", "").wait(t); err != nil {
+		t.Fatal(err)
+	}
+	var calls []*queuedCall
+	for i, call := range []struct{ target, priority string }{
+		{"batch-1", PriorityBatch},
+		{"batch-2", PriorityBatch},
+		{"default", ""},
+		{"interactive", PriorityInteractive},
+	} {
+		calls = append(calls, startCall(ctx, c, call.target, call.priority))
+		waitForQueue(t, c, i+1)
+	}
+
+	// Second 1 serves the interactive call; the window it opens sends two
+	// more, which are rate-limited again
+	clock.Advance(time.Second)
+	waitForQueue(t, c, 3)
+	// Second 2 serves the default call, whose wait elapsed with the
+	// batch call left waiting since second 1
+	clock.Advance(time.Second)
+	waitForQueue(t, c, 2)
+	clock.Advance(time.Second)
+	waitForQueue(t, c, 1)
+	clock.Advance(time.Second)
+	for _, call := range calls {
+		if err := call.wait(t); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	served := limiter.servedTargets()
+	if len(served) != 5 || served[1] != "interactive" || served[2] != "default" {
+		t.Fatalf("served %v", served)
+	}
+	batches := served[3:]
+	sort.Strings(batches)
+	if batches[0] != "batch-1" || batches[1] != "batch-2" {
+		t.Errorf("served %v", served)
+	}
+
+	s := c.RateLimitQueueStats()
+	if s.Queued != 0 || s.InFlight != 0 || s.Parked < 4 || s.Rejected != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+	// interactive 1s, default 2s, the batch calls 3s and 4s
+	if s.TotalWait < 10*time.Second {
+		t.Errorf("TotalWait = %v", s.TotalWait)
+	}
+}
+
+func TestRateLimitQueueingDeadline(t *testing.T) {
+	c, clock, _ := newQueueingClient(t, 1, 10)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Hour))
+	defer cancel()
+	clock.Advance(time.Hour - 500*time.Millisecond)
+	if err := startCall(context.Background(), c, "first", "").wait(t); err != nil {
+		t.Fatal(err)
+	}
+
+	// A wait past the deadline is not queued
+	if err := startCall(ctx, c, "short", "").wait(t); !isStatus(err, http.StatusTooManyRequests) {
+		t.Errorf("err = %v", err)
+	}
+
+	// A context ending in the queue takes the call out of it
+	ctx, cancel = context.WithCancel(context.Background())
+	call := startCall(ctx, c, "canceled", "")
+	waitForQueue(t, c, 1)
+	cancel()
+	if err := call.wait(t); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v", err)
+	}
+	if s := c.RateLimitQueueStats(); s.Queued != 0 || s.Expired != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+
+	// So does Close, and later calls are not queued
+	call = startCall(context.Background(), c, "closed", "")
+	waitForQueue(t, c, 1)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := call.wait(t); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("err = %v", err)
+	}
+	if err := startCall(context.Background(), c, "after", "").wait(t); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestRateLimitQueueingMaxWait(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := &burstLimiter{clock: clock}
+	c := newTestClient(t, limiter.handle(t), WithRateLimitQueueing(2*time.Second, 10))
+	c.rateQueue.clock = clock
+
+	call := startCall(context.Background(), c, "never", "")
+	for i := 0; i < 2; i++ {
+		waitForQueue(t, c, 1)
+		clock.Advance(time.Second)
+	}
+	if err := call.wait(t); !isStatus(err, http.StatusTooManyRequests) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestRateLimitQueueFull(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c, clock, limiter := newQueueingClient(t, 1, 2, WithMetrics(reg))
+	ctx := context.Background()
+	if err := startCall(ctx, c, "first", "").wait(t); err != nil {
+		t.Fatal(err)
+	}
+	batch := startCall(ctx, c, "batch", PriorityBatch)
+	waitForQueue(t, c, 1)
+	def := startCall(ctx, c, "default", "")
+	waitForQueue(t, c, 2)
+	if got := testutil.ToFloat64(c.metrics.queueDepth); got != 2 {
+		t.Errorf("queue depth = %v", got)
+	}
+
+	// No higher priority than any queued: refused
+	err := startCall(ctx, c, "batch-2", PriorityBatch).wait(t)
+	var full *RateLimitQueueFullError
+	if !errors.As(err, &full) || !errors.Is(err, ErrRateLimitQueueFull) || full.Displaced || full.Queued != 2 || full.RetryAfter != time.Second || !IsRetriable(err) {
+		t.Fatalf("err = %v", err)
+	}
+
+	// An interactive call displaces the batch one
+	interactive := startCall(ctx, c, "interactive", PriorityInteractive)
+	if err := batch.wait(t); !errors.As(err, &full) || !full.Displaced {
+		t.Fatalf("err = %v", err)
+	}
+	waitForQueue(t, c, 2)
+
+	clock.Advance(time.Second)
+	waitForQueue(t, c, 1)
+	clock.Advance(time.Second)
+	for _, call := range []*queuedCall{interactive, def} {
+		if err := call.wait(t); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if served := limiter.servedTargets(); len(served) != 3 || served[1] != "interactive" || served[2] != "default" {
+		t.Errorf("served %v", served)
+	}
+	if s := c.RateLimitQueueStats(); s.Rejected != 2 {
+		t.Errorf("stats = %+v", s)
+	}
+	if n := testutil.CollectAndCount(c.metrics.queueWait); n != 1 {
+		t.Errorf("wait histogram series = %d", n)
+	}
+}
+
+func TestRateLimitQueueingSkipsUnsafeRequests(t *testing.T) {
+	// A request its retry policy sends only once is not parked
+	c, _, _ := newQueueingClient(t, 0, 10)
+	post := HTTPRequest{Target: "t", Method: http.MethodPost, Path: "/", Retry: &RetryPolicy{MaxAttempts: 1}}
+	if _, err := c.ProxyHTTP(context.Background(), post); !isStatus(err, http.StatusTooManyRequests) {
+		t.Errorf("err = %v", err)
+	}
+	if s := c.RateLimitQueueStats(); s.Parked != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+}
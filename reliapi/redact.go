@@ -0,0 +1,301 @@
+package reliapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Redactor replaces sensitive values in the text of outgoing prompts with
+// placeholders before a request leaves the process (see WithRedactor).
+// Redact returns text with each value it wants hidden swapped for
+// vault.Token(kind, value).
+type Redactor interface {
+	Redact(text string, vault *RedactionVault) string
+}
+
+// WithRedactor runs the text of every message and content part of an LLM
+// request through r before it is sent, so the values it hides never reach
+// the proxy, its cache or the provider. Placeholders the model echoes back
+// are replaced with the original values in the response data and in
+// streamed deltas; Meta.RedactionsApplied counts the values hidden, along
+// with any the proxy's target redaction config hid.
+//
+// Placeholders are numbered per request in order of appearance, so two
+// requests differing only in a redacted value are identical on the wire and
+// share cache, coalescing and local cache entries; each gets its own values
+// restored. Async jobs (SubmitLLM) are redacted too, but their results come
+// back with the placeholders in them.
+func WithRedactor(r Redactor) Option {
+	return func(c *Client) {
+		c.redactor = r
+	}
+}
+
+// RedactionVault holds the placeholders of one request and the values they
+// stand for.
+type RedactionVault struct {
+	values  map[string]string // placeholder -> value
+	tokens  map[string]string // kind + value -> placeholder
+	counts  map[string]int    // kind -> placeholders issued
+	applied int
+}
+
+func newRedactionVault() *RedactionVault {
+	return &RedactionVault{values: map[string]string{}, tokens: map[string]string{}, counts: map[string]int{}}
+}
+
+// maxPlaceholderLen bounds the placeholders Token issues, so a streamed
+// delta ending in an unclosed "[" is only held back while it could still
+// turn out to be one.
+const maxPlaceholderLen = 64
+
+// Token returns the placeholder for value, such as "[EMAIL_1]" for the
+// first email. The same value of a kind always gets the same placeholder
+// within a request. kind is upper-cased, with characters other than
+// letters and digits turned into underscores.
+func (v *RedactionVault) Token(kind, value string) string {
+	v.applied++
+	kind = strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(kind))
+	if len(kind) > maxPlaceholderLen-16 {
+		kind = kind[:maxPlaceholderLen-16]
+	}
+	if tok, ok := v.tokens[kind+"\x00"+value]; ok {
+		return tok
+	}
+	v.counts[kind]++
+	tok := fmt.Sprintf("[%s_%d]", kind, v.counts[kind])
+	v.tokens[kind+"\x00"+value] = tok
+	v.values[tok] = value
+	return tok
+}
+
+// Applied reports how many values were replaced, repeats included.
+func (v *RedactionVault) Applied() int {
+	return v.applied
+}
+
+var placeholderRe = regexp.MustCompile(`\[[A-Z0-9_]+_[0-9]+\]`)
+
+// Restore replaces the placeholders in s with the values they stand for.
+// Placeholders of other requests are left as they are.
+func (v *RedactionVault) Restore(s string) string {
+	if len(v.values) == 0 || !strings.Contains(s, "[") {
+		return s
+	}
+	return placeholderRe.ReplaceAllStringFunc(s, func(tok string) string {
+		if value, ok := v.values[tok]; ok {
+			return value
+		}
+		return tok
+	})
+}
+
+// restoreValue returns a copy of a decoded JSON value with every string in
+// it restored.
+func (v *RedactionVault) restoreValue(x interface{}) interface{} {
+	switch x := x.(type) {
+	case string:
+		return v.Restore(x)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			out[k] = v.restoreValue(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, e := range x {
+			out[i] = v.restoreValue(e)
+		}
+		return out
+	}
+	return x
+}
+
+// heldSuffix returns the index from which s ends in what may be the start
+// of a placeholder, len(s) if it doesn't.
+func heldSuffix(s string) int {
+	i := strings.LastIndexByte(s, '[')
+	if i < 0 || len(s)-i >= maxPlaceholderLen || strings.ContainsRune(s[i:], ']') {
+		return len(s)
+	}
+	return i
+}
+
+// RedactionPattern is a kind of value a PatternRedactor hides. Valid, if
+// set, vets each match, e.g. with a checksum; matches it rejects are kept.
+type RedactionPattern struct {
+	Kind   string
+	Regexp *regexp.Regexp
+	Valid  func(match string) bool
+}
+
+// Built-in patterns for NewPatternRedactor. Customer IDs and other
+// values specific to an application need a pattern of their own, e.g.
+// RedactionPattern{Kind: "CUSTOMER_ID", Regexp: regexp.MustCompile(`\bcus_[0-9A-Za-z]{14}\b`)}.
+var (
+	EmailPattern = RedactionPattern{
+		Kind:   "EMAIL",
+		Regexp: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+	// PhonePattern matches international (+44 20 7946 0958) and North
+	// American ((555) 123-4567) numbers written with separators.
+	PhonePattern = RedactionPattern{
+		Kind:   "PHONE",
+		Regexp: regexp.MustCompile(`(?:\+[1-9]\d{0,2}[ .-]?)?(?:\(\d{2,4}\)|\b\d{2,4})[ .-]\d{3,4}[ .-]\d{3,4}\b`),
+	}
+	// CreditCardPattern matches 13 to 19 digit card numbers, optionally
+	// grouped with spaces or dashes, that pass the Luhn check.
+	CreditCardPattern = RedactionPattern{
+		Kind:   "CREDIT_CARD",
+		Regexp: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Valid:  luhnValid,
+	}
+)
+
+// luhnValid reports whether the digits of s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		d := s[i]
+		if d < '0' || d > '9' {
+			continue
+		}
+		n := int(d - '0')
+		if double {
+			if n *= 2; n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+type patternRedactor []RedactionPattern
+
+// NewPatternRedactor returns a Redactor hiding matches of patterns, applied
+// in order; with none it uses EmailPattern, CreditCardPattern and
+// PhonePattern.
+func NewPatternRedactor(patterns ...RedactionPattern) Redactor {
+	if len(patterns) == 0 {
+		patterns = []RedactionPattern{EmailPattern, CreditCardPattern, PhonePattern}
+	}
+	return patternRedactor(patterns)
+}
+
+func (p patternRedactor) Redact(text string, vault *RedactionVault) string {
+	for _, pat := range p {
+		text = pat.Regexp.ReplaceAllStringFunc(text, func(m string) string {
+			if pat.Valid != nil && !pat.Valid(m) {
+				return m
+			}
+			return vault.Token(pat.Kind, m)
+		})
+	}
+	return text
+}
+
+// redact returns req with the text of its messages, and of a
+// conversation turn's AppendMessages, run through the client's Redactor,
+// and the vault to restore the response with; nil without a Redactor.
+// The caller's messages are not modified.
+func (c *Client) redact(req LLMRequest) (LLMRequest, *RedactionVault) {
+	if c.redactor == nil {
+		return req, nil
+	}
+	vault := newRedactionVault()
+	req.Messages = c.redactMessages(req.Messages, vault)
+	req.AppendMessages = c.redactMessages(req.AppendMessages, vault)
+	return req, vault
+}
+
+// redactMessages returns a copy of messages with their text redacted; nil
+// stays nil, so unset fields are still left out of the request.
+func (c *Client) redactMessages(messages []ChatMessage, vault *RedactionVault) []ChatMessage {
+	if messages == nil {
+		return nil
+	}
+	msgs := make([]ChatMessage, len(messages))
+	for i, m := range messages {
+		if m.Content != "" {
+			m.Content = c.redactor.Redact(m.Content, vault)
+		}
+		if len(m.Parts) > 0 {
+			parts := make([]ContentPart, len(m.Parts))
+			for j, part := range m.Parts {
+				if part.Type == "text" {
+					part.Text = c.redactor.Redact(part.Text, vault)
+				}
+				parts[j] = part
+			}
+			m.Parts = parts
+		}
+		msgs[i] = m
+	}
+	return msgs
+}
+
+// restoreResponse returns a copy of resp with the vault's values restored
+// in its data and its redactions counted in the meta. A nil vault or
+// response is returned as is; resp itself may be shared by coalesced calls
+// and is not modified.
+func (v *RedactionVault) restoreResponse(resp *ReliAPIResponse) *ReliAPIResponse {
+	if v == nil || resp == nil {
+		return resp
+	}
+	out := *resp
+	if v.applied > 0 && resp.Meta.RawPassthrough {
+		out.Data = v.restoreRaw(resp)
+	} else if v.applied > 0 {
+		// UseNumber so the round trip leaves numbers as they were sent
+		var data interface{}
+		dec := json.NewDecoder(bytes.NewReader(resp.Data))
+		dec.UseNumber()
+		if dec.Decode(&data) == nil {
+			if raw, err := json.Marshal(v.restoreValue(data)); err == nil {
+				out.Data = raw
+			}
+		}
+	}
+	out.Meta.RedactionsApplied += v.applied
+	return &out
+}
+
+// restoreRaw returns the Data of a Meta.RawPassthrough response with the
+// placeholders in it restored and every other byte as it was. In a JSON
+// body the values are restored JSON-escaped, as they sit in its strings.
+func (v *RedactionVault) restoreRaw(resp *ReliAPIResponse) json.RawMessage {
+	if resp.Meta.ResponseEncoding == BodyEncodingBase64 {
+		raw := resp.RawData()
+		if raw == nil {
+			return resp.Data
+		}
+		restored := placeholderRe.ReplaceAllFunc(raw, func(tok []byte) []byte {
+			if value, ok := v.values[string(tok)]; ok {
+				return []byte(value)
+			}
+			return tok
+		})
+		data, _ := json.Marshal(base64.StdEncoding.EncodeToString(restored))
+		return data
+	}
+	return placeholderRe.ReplaceAllFunc(resp.Data, func(tok []byte) []byte {
+		value, ok := v.values[string(tok)]
+		if !ok {
+			return tok
+		}
+		quoted, _ := json.Marshal(value)
+		return quoted[1 : len(quoted)-1]
+	})
+}
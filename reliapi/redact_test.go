@@ -0,0 +1,156 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	var bodies []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(raw))
+		var req LLMRequest
+		_ = json.Unmarshal(raw, &req)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "Sent to " + req.Messages[0].Content + ".", "tool_calls": []interface{}{map[string]interface{}{"arguments": `{"to":"[EMAIL_1]"}`}}},
+			"meta":    map[string]interface{}{"request_id": "req_1", "redactions_applied": 1},
+		})
+	}, WithRedactor(NewPatternRedactor()))
+
+	req := llmReq("ada@example.com [EMAIL_2] 4111 1111 1111 1111")
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if strings.Contains(bodies[0], "ada@example.com") || strings.Contains(bodies[0], "4111") || !strings.Contains(bodies[0], "[EMAIL_1] [EMAIL_2] [CREDIT_CARD_1]") {
+		t.Errorf("sent %s", bodies[0])
+	}
+	if req.Messages[0].Content != "ada@example.com [EMAIL_2] 4111 1111 1111 1111" {
+		t.Errorf("caller's message modified: %q", req.Messages[0].Content)
+	}
+	data := resp.DataMap()
+	if data["content"] != "Sent to ada@example.com [EMAIL_2] 4111 1111 1111 1111." {
+		t.Errorf("content = %q", data["content"])
+	}
+	if args := data["tool_calls"].([]interface{})[0].(map[string]interface{})["arguments"]; args != `{"to":"ada@example.com"}` {
+		t.Errorf("arguments = %q", args)
+	}
+	if resp.Meta.RedactionsApplied != 3 {
+		t.Errorf("RedactionsApplied = %d, want 3", resp.Meta.RedactionsApplied)
+	}
+
+	// Requests differing only in the redacted value look the same on the wire
+	resp, err = c.ProxyLLM(context.Background(), llmReq("bob@example.com [EMAIL_2] 5500 0000 0000 0004"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if bodies[1] != bodies[0] {
+		t.Errorf("bodies differ:\n%s\n%s", bodies[0], bodies[1])
+	}
+	if content := resp.DataMap()["content"]; content != "Sent to bob@example.com [EMAIL_2] 5500 0000 0000 0004." {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestRedactorRawPassthrough(t *testing.T) {
+	const body = `{"id":"chatcmpl-1",  "choices":[{"message":{"content":"Hi \"[NAME_1]\" [EMAIL_1]"}}]}`
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"success":true,"data":`+body+`,"meta":{"request_id":"req_1","raw_passthrough":true}}`)
+	}, WithRedactor(NewPatternRedactor(RedactionPattern{Kind: "NAME", Regexp: regexp.MustCompile(`Ada "Lovelace"`)}, EmailPattern)))
+
+	req := llmReq(`Ada "Lovelace" ada@example.com`)
+	req.RawPassthrough = true
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	// Only the placeholders change, restored JSON-escaped
+	want := strings.Replace(body, `[NAME_1]`, `Ada \"Lovelace\"`, 1)
+	want = strings.Replace(want, `[EMAIL_1]`, `ada@example.com`, 1)
+	if string(resp.RawData()) != want {
+		t.Errorf("RawData = %s, want %s", resp.RawData(), want)
+	}
+	if c, err := resp.Completion(); err != nil || c.Choices[0].Message.Content != `Hi "Ada "Lovelace"" ada@example.com` {
+		t.Errorf("Completion = %+v, %v", c, err)
+	}
+}
+
+func TestPatternRedactor(t *testing.T) {
+	custom := RedactionPattern{Kind: "customer-id", Regexp: regexp.MustCompile(`\bcus_[0-9]{4}\b`)}
+	tests := []struct {
+		name, in, want string
+		patterns       []RedactionPattern
+	}{
+		{"email", "mail a.b+c@mail.example.org now", "mail [EMAIL_1] now", nil},
+		{"repeated", "x@y.io, z@y.io, x@y.io", "[EMAIL_1], [EMAIL_2], [EMAIL_1]", nil},
+		{"phone", "call +44 20 7946 0958 or (555) 123-4567", "call [PHONE_1] or [PHONE_2]", nil},
+		{"card", "card 4111-1111-1111-1111", "card [CREDIT_CARD_1]", nil},
+		{"not luhn", "order 4111 1111 1111 1112", "order 4111 1111 1111 1112", []RedactionPattern{CreditCardPattern}},
+		{"plain numbers", "in 2024 we sold 1500 units", "in 2024 we sold 1500 units", nil},
+		{"custom", "cus_1234 wrote from a@b.co", "[CUSTOMER_ID_1] wrote from a@b.co", []RedactionPattern{custom}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := newRedactionVault()
+			got := NewPatternRedactor(tt.patterns...).Redact(tt.in, vault)
+			if got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if back := vault.Restore(got); back != tt.in {
+				t.Errorf("Restore(%q) = %q", got, back)
+			}
+		})
+	}
+}
+
+func TestRedactorStream(t *testing.T) {
+	var body string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		body = string(raw)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range []string{
+			"event: meta\ndata: {\"target\": \"openai\", \"redactions_applied\": 0}\n\n",
+			"event: chunk\ndata: {\"delta\": \"Hi [EMA\"}\n\n",
+			"event: chunk\ndata: {\"delta\": \"IL_1], [\"}\n\n",
+			"event: chunk\ndata: {\"delta\": \"sic] [EMAIL_1\"}\n\n",
+			"event: done\ndata: {\"finish_reason\": \"stop\"}\n\n",
+		} {
+			io.WriteString(w, ev)
+		}
+	}, WithRedactor(NewPatternRedactor(EmailPattern)))
+
+	s, err := c.ProxyLLMStream(context.Background(), llmReq("I am ada@example.com"))
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+	if strings.Contains(body, "ada@") {
+		t.Errorf("sent %s", body)
+	}
+	var got []string
+	for {
+		chunk, err := s.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		got = append(got, chunk.Delta)
+	}
+	if want := []string{"Hi ", "ada@example.com, ", "[sic] ", "[EMAIL_1"}; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("deltas = %q, want %q", got, want)
+	}
+	if s.Meta().RedactionsApplied != 1 {
+		t.Errorf("RedactionsApplied = %d", s.Meta().RedactionsApplied)
+	}
+}
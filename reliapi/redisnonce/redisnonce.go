@@ -0,0 +1,59 @@
+// Package redisnonce is a reliapi.NonceStore in Redis, for the replicas
+// behind one job callback URL to share, so a callback redelivered to
+// another replica isn't handled twice:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	h := reliapi.NewCallbackHandler(secret, handle, reliapi.CallbackOptions{
+//		Nonces: redisnonce.New(rdb, ""),
+//	})
+//
+// A nonce is a key set with SET NX and the nonce's ttl, so Redis expires
+// it. The package is a module of its own, so the reliapi client doesn't
+// depend on a Redis client.
+package redisnonce
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultPrefix is the prefix of the keys of a Store given none.
+const DefaultPrefix = "reliapi:callback-nonce:"
+
+// Store is a reliapi.NonceStore in Redis.
+type Store struct {
+	client redis.Cmdable
+	prefix string
+}
+
+var _ reliapi.NonceStore = (*Store)(nil)
+
+// New returns a Store keeping nonces in client under keys of prefix,
+// DefaultPrefix when empty.
+func New(client redis.Cmdable, prefix string) *Store {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &Store{client: client, prefix: prefix}
+}
+
+// Claim implements reliapi.NonceStore.
+func (s *Store) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	ok, err := s.client.SetNX(ctx, s.prefix+nonce, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("redisnonce: claim: %w", err)
+	}
+	return ok, nil
+}
+
+// Release implements reliapi.NonceStore.
+func (s *Store) Release(ctx context.Context, nonce string) error {
+	if err := s.client.Del(ctx, s.prefix+nonce).Err(); err != nil {
+		return fmt.Errorf("redisnonce: release: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package redisnonce
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+	"github.com/KikuAI-Lab/reliapi/reliapi/reliapitest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return New(rdb, ""), mr
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newStore(t)
+	if ok, err := s.Claim(ctx, "evt_1", time.Minute); !ok || err != nil {
+		t.Fatalf("first claim = %v, %v", ok, err)
+	}
+	if ok, _ := s.Claim(ctx, "evt_1", time.Minute); ok {
+		t.Error("second claim accepted")
+	}
+	if ttl := mr.TTL(DefaultPrefix + "evt_1"); ttl != time.Minute {
+		t.Errorf("ttl = %v", ttl)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if ok, _ := s.Claim(ctx, "evt_1", time.Minute); !ok {
+		t.Error("expired nonce refused")
+	}
+	if err := s.Release(ctx, "evt_1"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.Claim(ctx, "evt_1", time.Minute); !ok {
+		t.Error("released nonce refused")
+	}
+
+	mr.Close()
+	if _, err := s.Claim(ctx, "evt_2", time.Minute); err == nil {
+		t.Error("claim without Redis succeeded")
+	}
+}
+
+func TestSharedBetweenReplicas(t *testing.T) {
+	const secret = "whsec_test"
+	s, _ := newStore(t)
+	handled := 0
+	handler := func(ctx context.Context, job *reliapi.JobCompletedEvent) error {
+		handled++
+		return nil
+	}
+	replicas := []http.Handler{
+		reliapi.NewCallbackHandler(secret, handler, reliapi.CallbackOptions{Nonces: s}),
+		reliapi.NewCallbackHandler(secret, handler, reliapi.CallbackOptions{Nonces: s}),
+	}
+	for _, h := range replicas {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, reliapitest.NewCallbackRequest(secret, reliapitest.Callback{ID: "evt_1", JobID: "job_1"}))
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("status %d", rec.Code)
+		}
+	}
+	if handled != 1 {
+		t.Errorf("handled %d times", handled)
+	}
+}
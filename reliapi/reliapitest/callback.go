@@ -0,0 +1,87 @@
+package reliapitest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+// Callback is a job.completed callback forged by NewCallbackRequest.
+type Callback struct {
+	// ID is the event ID, the nonce of reliapi.NewCallbackHandler; a
+	// random one when empty. Forge a redelivery by reusing it.
+	ID    string
+	JobID reliapi.JobID
+	// Content is the completion the job succeeded with, unless Err fails
+	// it; Err's StatusCode defaults to 502.
+	Content string
+	Err     *reliapi.APIError
+	// SignedAt is the time of the signature, now when zero. Move it
+	// outside the handler's tolerance for a stale callback.
+	SignedAt time.Time
+}
+
+// NewCallbackRequest forges the POST with which the proxy delivers cb to
+// a job's CallbackURL, signed with secret as the proxy signs it, for tests
+// of a reliapi.NewCallbackHandler:
+//
+//	h := reliapi.NewCallbackHandler(secret, handle, reliapi.CallbackOptions{})
+//	rec := httptest.NewRecorder()
+//	h.ServeHTTP(rec, reliapitest.NewCallbackRequest(secret, reliapitest.Callback{JobID: "job_1", Content: "Paris."}))
+func NewCallbackRequest(secret string, cb Callback) *http.Request {
+	if cb.ID == "" {
+		cb.ID = fmt.Sprintf("evt_%016x", rand.Uint64())
+	}
+	if cb.SignedAt.IsZero() {
+		cb.SignedAt = time.Now()
+	}
+	requestID := "req_mock_" + string(cb.JobID)
+	status := reliapi.JobSucceeded
+	var result interface{} = map[string]interface{}{
+		"success": true,
+		"data":    map[string]interface{}{"content": cb.Content, "role": "assistant", "finish_reason": "stop"},
+		"meta":    reliapi.Meta{RequestID: requestID, Provider: Provider, Model: DefaultModel},
+	}
+	if cb.Err != nil {
+		e := *cb.Err
+		if e.StatusCode == 0 {
+			e.StatusCode = http.StatusBadGateway
+		}
+		status = reliapi.JobFailed
+		result = errorEnvelope(&e, requestID)
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":         cb.ID,
+		"type":       reliapi.EventJobCompleted,
+		"created_at": cb.SignedAt.Unix(),
+		"data":       map[string]interface{}{"job_id": cb.JobID, "status": status, "result": result},
+	})
+	if err != nil {
+		panic("reliapitest: encode callback: " + err.Error())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(reliapi.WebhookSignatureHeader, SignWebhook(secret, payload, cb.SignedAt))
+	return req
+}
+
+// SignWebhook returns the reliapi.WebhookSignatureHeader value the proxy
+// sends with payload at time at, for forging deliveries of any event.
+func SignWebhook(secret string, payload []byte, at time.Time) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
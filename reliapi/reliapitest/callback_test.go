@@ -0,0 +1,47 @@
+package reliapitest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+func TestNewCallbackRequest(t *testing.T) {
+	const secret = "whsec_test"
+	var jobs []*reliapi.JobCompletedEvent
+	h := reliapi.NewCallbackHandler(secret, func(ctx context.Context, job *reliapi.JobCompletedEvent) error {
+		jobs = append(jobs, job)
+		return nil
+	}, reliapi.CallbackOptions{})
+	serve := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(NewCallbackRequest(secret, Callback{ID: "evt_1", JobID: "job_1", Content: "Paris."})); code != http.StatusNoContent {
+		t.Fatalf("status %d", code)
+	}
+	if text, _ := jobs[0].Response.CompletionText(); jobs[0].JobID != "job_1" || jobs[0].Status != reliapi.JobSucceeded || text != "Paris." {
+		t.Errorf("job = %+v, content %q", jobs[0], text)
+	}
+	if code := serve(NewCallbackRequest(secret, Callback{ID: "evt_1", JobID: "job_1"})); code != http.StatusNoContent || len(jobs) != 1 {
+		t.Errorf("redelivery: status %d, %d jobs", code, len(jobs))
+	}
+
+	serve(NewCallbackRequest(secret, Callback{JobID: "job_2", Err: &reliapi.APIError{Code: reliapi.CodeBudgetExceeded, StatusCode: 402}}))
+	if len(jobs) != 2 || jobs[1].Status != reliapi.JobFailed || !reliapi.IsBudgetExceeded(jobs[1].Err) {
+		t.Fatalf("failed job = %+v", jobs[len(jobs)-1])
+	}
+
+	if code := serve(NewCallbackRequest("whsec_other", Callback{JobID: "job_3"})); code != http.StatusBadRequest {
+		t.Errorf("wrong secret: status %d", code)
+	}
+	if code := serve(NewCallbackRequest(secret, Callback{JobID: "job_3", SignedAt: time.Now().Add(-time.Hour)})); code != http.StatusBadRequest {
+		t.Errorf("stale: status %d", code)
+	}
+}
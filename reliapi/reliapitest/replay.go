@@ -0,0 +1,246 @@
+package reliapitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+// RecordEnv is the environment variable that switches NewReplayClient to
+// recording when set to "1".
+const RecordEnv = "RELIAPI_RECORD"
+
+// redacted replaces the API key wherever it appears in a golden file.
+const redacted = "REDACTED"
+
+// Interaction is a recorded request and the proxy's response to it.
+type Interaction struct {
+	Method string `json:"method"`
+	// Path includes the query string.
+	Path string `json:"path"`
+	// Request is the JSON body without the fields that differ between
+	// identical calls (see normalizeBody).
+	Request json.RawMessage `json:"request,omitempty"`
+
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	// Response holds JSON bodies and ResponseText any others, such as
+	// event streams.
+	Response     json.RawMessage `json:"response,omitempty"`
+	ResponseText string          `json:"response_text,omitempty"`
+}
+
+type goldenFile struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// NewReplayClient returns a Client that replays the interactions recorded
+// in the golden file, so tests run offline and deterministically.
+//
+// With RELIAPI_RECORD=1 it instead sends the requests to the deployment at
+// baseURL with apiKey and, if the test passes, writes what was exchanged
+// to golden. Request headers are not recorded, and the API key is replaced
+// with REDACTED wherever it appears. baseURL and apiKey are unused when
+// replaying.
+//
+// Requests are matched by method, path and body, ignoring idempotency keys
+// and timeouts derived from deadlines; repeats of one request replay its
+// recordings in order. A request with no recording left fails the test.
+func NewReplayClient(t testing.TB, golden, baseURL, apiKey string, opts ...reliapi.Option) *reliapi.Client {
+	t.Helper()
+	var handler http.Handler
+	if os.Getenv(RecordEnv) == "1" {
+		handler = newRecorder(t, golden, baseURL, apiKey)
+	} else {
+		handler = newReplayer(t, golden)
+		apiKey = APIKey
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c, err := reliapi.NewClient(srv.URL, apiKey, opts...)
+	if err != nil {
+		t.Fatalf("reliapitest: NewClient: %v", err)
+	}
+	return c
+}
+
+type replayer struct {
+	t            testing.TB
+	golden       string
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+func newReplayer(t testing.TB, golden string) *replayer {
+	t.Helper()
+	raw, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("reliapitest: %v (record it with %s=1)", err, RecordEnv)
+	}
+	var file goldenFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		t.Fatalf("reliapitest: %s: %v", golden, err)
+	}
+	return &replayer{t: t, golden: golden, interactions: file.Interactions, used: make([]bool, len(file.Interactions))}
+}
+
+func (p *replayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	request := compactJSON(normalizeBody(body))
+
+	p.mu.Lock()
+	found := -1
+	for i, in := range p.interactions {
+		if !p.used[i] && in.Method == r.Method && in.Path == r.URL.RequestURI() && bytes.Equal(compactJSON(in.Request), request) {
+			p.used[i] = true
+			found = i
+			break
+		}
+	}
+	p.mu.Unlock()
+	if found < 0 {
+		p.t.Errorf("reliapitest: %s has no recording left for %s %s %s", p.golden, r.Method, r.URL.RequestURI(), request)
+		http.Error(w, "reliapitest: no recorded interaction", http.StatusNotImplemented)
+		return
+	}
+
+	in := p.interactions[found]
+	for name, value := range in.Header {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(in.Status)
+	if in.Response != nil {
+		_, _ = w.Write(in.Response)
+	} else {
+		_, _ = io.WriteString(w, in.ResponseText)
+	}
+}
+
+type recorder struct {
+	t       testing.TB
+	golden  string
+	target  *url.URL
+	apiKey  string
+	mu      sync.Mutex
+	entries []Interaction
+}
+
+func newRecorder(t testing.TB, golden, baseURL, apiKey string) *recorder {
+	t.Helper()
+	if baseURL == "" {
+		baseURL = reliapi.DefaultBaseURL
+	}
+	target, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		t.Fatalf("reliapitest: invalid base URL: %v", err)
+	}
+	rec := &recorder{t: t, golden: golden, target: target, apiKey: apiKey}
+	t.Cleanup(rec.save)
+	return rec
+}
+
+func (p *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	out, err := http.NewRequestWithContext(r.Context(), r.Method, p.target.String()+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	out.Header = r.Header.Clone()
+	// The client only adds this for RapidAPI hosts, and it talks to us
+	if strings.Contains(strings.ToLower(p.target.Host), "rapidapi") {
+		out.Header.Set("X-RapidAPI-Key", p.apiKey)
+	}
+	resp, err := http.DefaultClient.Do(out)
+	if err != nil {
+		p.t.Errorf("reliapitest: record %s %s: %v", r.Method, r.URL.RequestURI(), err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		p.t.Errorf("reliapitest: record %s %s: %v", r.Method, r.URL.RequestURI(), err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	in := Interaction{Method: r.Method, Path: r.URL.RequestURI(), Status: resp.StatusCode, Header: map[string]string{}}
+	if len(body) > 0 {
+		in.Request = p.scrub(normalizeBody(body))
+	}
+	for name := range resp.Header {
+		if recordedHeader(name) {
+			in.Header[name] = string(p.scrub([]byte(resp.Header.Get(name))))
+		}
+	}
+	if json.Valid(respBody) {
+		in.Response = p.scrub(respBody)
+	} else {
+		in.ResponseText = string(p.scrub(respBody))
+	}
+	p.mu.Lock()
+	p.entries = append(p.entries, in)
+	p.mu.Unlock()
+
+	for name, value := range in.Header {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(respBody)
+}
+
+// recordedHeader reports whether a response header is worth keeping:
+// the content type and the proxy's own headers, not cookies or dates.
+func recordedHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	return name == "Content-Type" || name == "Retry-After" || strings.HasPrefix(name, "X-")
+}
+
+func (p *recorder) scrub(data []byte) []byte {
+	if p.apiKey == "" {
+		return data
+	}
+	return bytes.ReplaceAll(data, []byte(p.apiKey), []byte(redacted))
+}
+
+func (p *recorder) save() {
+	if p.t.Failed() {
+		p.t.Logf("reliapitest: test failed, not writing %s", p.golden)
+		return
+	}
+	p.mu.Lock()
+	file := goldenFile{Interactions: p.entries}
+	p.mu.Unlock()
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(p.golden), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(p.golden, append(raw, '\n'), 0o644)
+	}
+	if err != nil {
+		p.t.Errorf("reliapitest: write %s: %v", p.golden, err)
+	}
+}
+
+// compactJSON strips insignificant whitespace so recordings edited by
+// hand still match.
+func compactJSON(data []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,79 @@
+package reliapitest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "testdata", "llm.json")
+	srv := NewMockServer(t)
+	srv.HandleLLM(func(req reliapi.LLMRequest) LLMReply { return LLMReply{Content: "Paris."} })
+
+	t.Run("record", func(t *testing.T) {
+		t.Setenv(RecordEnv, "1")
+		client := NewReplayClient(t, golden, srv.URL, APIKey, reliapi.WithAutoIdempotency())
+		resp, err := client.ProxyLLM(context.Background(), question("capital? key "+APIKey))
+		if err != nil {
+			t.Fatalf("ProxyLLM: %v", err)
+		}
+		if text, _ := resp.CompletionText(); text != "Paris." {
+			t.Errorf("content = %q", text)
+		}
+	})
+
+	raw, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("golden file not written: %v", err)
+	}
+	if strings.Contains(string(raw), APIKey) || !strings.Contains(string(raw), "REDACTED") {
+		t.Errorf("API key not scrubbed:\n%s", raw)
+	}
+	if strings.Contains(string(raw), "idempotency_key") {
+		t.Errorf("generated idempotency key recorded:\n%s", raw)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		t.Setenv(RecordEnv, "")
+		srv.HandleLLM(func(reliapi.LLMRequest) LLMReply {
+			t.Error("replay reached the server")
+			return LLMReply{}
+		})
+		client := NewReplayClient(t, golden, "", "", reliapi.WithAutoIdempotency())
+		resp, err := client.ProxyLLM(context.Background(), question("capital? key REDACTED"))
+		if err != nil {
+			t.Fatalf("ProxyLLM: %v", err)
+		}
+		if text, _ := resp.CompletionText(); text != "Paris." || resp.Meta.RequestID != "req_mock_1" {
+			t.Errorf("content = %q, meta = %+v", text, resp.Meta)
+		}
+	})
+}
+
+func TestReplayUnmatchedRequest(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "empty.json")
+	if err := os.WriteFile(golden, []byte(`{"interactions": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ft := &fakeT{TB: t}
+	client := NewReplayClient(ft, golden, "", "")
+	if _, err := client.ProxyLLM(context.Background(), question("hi")); err == nil {
+		t.Fatal("unrecorded request succeeded")
+	}
+	if !ft.failed {
+		t.Error("unrecorded request did not fail the test")
+	}
+}
+
+// fakeT records failures instead of failing the enclosing test.
+type fakeT struct {
+	testing.TB
+	failed bool
+}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) { f.failed = true }
@@ -0,0 +1,981 @@
+// Package reliapitest runs ReliAPI test doubles in-process, so code that
+// calls the proxy can be tested without network access or provider bills.
+//
+// NewMockServer is a programmable fake of /v1/proxy/llm and
+// /v1/proxy/http that behaves like the proxy where tests notice it: the
+// second identical request is a cache hit, streamed or not, reusing an
+// idempotency key replays the first answer, and latency, errors and
+// faults (see InjectFaults) can be injected. SetMaintenance and SetVersion
+// make it a proxy being upgraded or an old one, and ExpireIdempotencyKeys
+// and DivergeReplays one whose idempotent replays go wrong. Requests with a
+// ConversationID keep their history, as GetConversation reports it:
+//
+//	srv := reliapitest.NewMockServer(t)
+//	srv.HandleLLM(func(req reliapi.LLMRequest) reliapitest.LLMReply {
+//		return reliapitest.LLMReply{Content: "Paris."}
+//	})
+//	client := srv.Client()
+//
+// NewReplayClient instead replays responses recorded from a real
+// deployment into golden files; see its documentation.
+//
+// NewCallbackRequest forges the signed job callbacks the proxy delivers,
+// for tests of a reliapi.NewCallbackHandler.
+package reliapitest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+const (
+	llmProxyPath      = "/v1/proxy/llm"
+	httpProxyPath     = "/v1/proxy/http"
+	healthPath        = "/health"
+	conversationsPath = "/v1/conversations/"
+
+	// Version is the proxy version a MockServer reports until SetVersion.
+	Version = "1.0.7"
+
+	// APIKey is the key clients of a MockServer authenticate with.
+	APIKey = "reliapitest-key"
+
+	// DefaultModel is reported for LLM requests that name no model.
+	DefaultModel = "mock-model"
+	// Provider is the provider reported for every LLM response.
+	Provider = "mock"
+
+	defaultCacheTTL = time.Hour
+)
+
+// LLMReply is a programmed answer to a /v1/proxy/llm request.
+type LLMReply struct {
+	Content      string
+	ToolCalls    []reliapi.ToolCall
+	FinishReason string // "stop" when empty
+	// PromptTokens and CompletionTokens default to reliapi.CountTokens of
+	// the request's messages and the number of words in Content.
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+	// Err fails the request with this error instead; its StatusCode
+	// defaults to 502.
+	Err *reliapi.APIError
+	// Latency delays this reply, on top of SetLatency.
+	Latency time.Duration
+}
+
+// HTTPReply is a programmed answer to a /v1/proxy/http request.
+type HTTPReply struct {
+	StatusCode int // 200 when zero
+	Headers    map[string]string
+	// Body is the upstream body: a string, or a value encoded as JSON.
+	Body interface{}
+	// Err and Latency are as for LLMReply.
+	Err     *reliapi.APIError
+	Latency time.Duration
+}
+
+// Request is a request the MockServer received.
+type Request struct {
+	Method string
+	Path   string
+	Body   json.RawMessage
+	// Meta is what the server answered with; nil for errors.
+	Meta *reliapi.Meta
+}
+
+type cacheEntry struct {
+	data      interface{}
+	meta      reliapi.Meta
+	expiresAt time.Time
+}
+
+// conversation is the history of a ConversationID.
+type conversation struct {
+	messages  []reliapi.ChatMessage
+	turns     int
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+type idempotencyEntry struct {
+	requestHash string
+	data        interface{}
+	meta        reliapi.Meta
+	requestID   string
+	firstSeenAt time.Time
+	expiresAt   time.Time
+	replays     int
+}
+
+// MockServer is an in-process fake ReliAPI proxy. It is safe for
+// concurrent use.
+type MockServer struct {
+	// URL is the base URL of the server.
+	URL string
+
+	t   testing.TB
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	llm           func(reliapi.LLMRequest) LLMReply
+	http          func(reliapi.HTTPRequest) HTTPReply
+	latency       time.Duration
+	failures      []*reliapi.APIError
+	faults        []reliapi.Fault
+	cache         map[string]cacheEntry
+	idempotency   map[string]idempotencyEntry
+	divergent     int
+	conversations map[string]conversation
+	requests      []Request
+	upstream      int
+	maintenance   *reliapi.Maintenance
+	version       string
+	features      []string
+}
+
+// NewMockServer starts a MockServer that is closed when the test ends.
+// Until told otherwise with HandleLLM and HandleHTTP, it answers LLM
+// requests with "This is a mock response." and HTTP requests with an
+// empty JSON object.
+func NewMockServer(t testing.TB) *MockServer {
+	t.Helper()
+	s := newMockServer()
+	s.t = t
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+// StartMockServer starts a MockServer outside of a test, for demos and
+// offline use; Close stops it.
+func StartMockServer() *MockServer {
+	return newMockServer()
+}
+
+// Close stops a server of StartMockServer; those of NewMockServer stop
+// when their test ends.
+func (s *MockServer) Close() {
+	s.srv.Close()
+}
+
+func newMockServer() *MockServer {
+	s := &MockServer{
+		llm:           func(reliapi.LLMRequest) LLMReply { return LLMReply{Content: "This is a mock response."} },
+		http:          func(reliapi.HTTPRequest) HTTPReply { return HTTPReply{Body: map[string]interface{}{}} },
+		cache:         make(map[string]cacheEntry),
+		idempotency:   make(map[string]idempotencyEntry),
+		conversations: make(map[string]conversation),
+		version:       Version,
+		// Async jobs, target purges and raw streams aren't served
+		features: []string{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(llmProxyPath, s.serveLLM)
+	mux.HandleFunc(httpProxyPath, s.serveHTTP)
+	mux.HandleFunc(healthPath, s.serveHealth)
+	mux.HandleFunc(conversationsPath, s.serveConversation)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Client returns a Client of the server, configured with opts. It panics
+// on invalid opts for a server of StartMockServer, and fails the test for
+// one of NewMockServer.
+func (s *MockServer) Client(opts ...reliapi.Option) *reliapi.Client {
+	c, err := reliapi.NewClient(s.URL, APIKey, opts...)
+	if err != nil {
+		if s.t == nil {
+			panic("reliapitest: NewClient: " + err.Error())
+		}
+		s.t.Helper()
+		s.t.Fatalf("reliapitest: NewClient: %v", err)
+	}
+	return c
+}
+
+// HandleLLM makes fn answer the LLM requests that miss the cache and
+// idempotency store.
+func (s *MockServer) HandleLLM(fn func(reliapi.LLMRequest) LLMReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.llm = fn
+}
+
+// HandleHTTP makes fn answer the HTTP requests that miss the cache and
+// idempotency store.
+func (s *MockServer) HandleHTTP(fn func(reliapi.HTTPRequest) HTTPReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.http = fn
+}
+
+// SetLatency delays every response by d.
+func (s *MockServer) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// FailNext fails the next n requests that would reach the upstream with
+// err, as the proxy reports upstream failures. Cache and idempotency hits
+// are served as usual.
+func (s *MockServer) FailNext(n int, err *reliapi.APIError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, err)
+	}
+}
+
+// InjectFaults injects faults into every request, as the proxy does for
+// test keys; requests sent with reliapi.FaultHeader get theirs instead.
+// Each fires with its Probability, and the response reports the ones that
+// did in Meta.FaultInjected. Calling it with no faults stops injection.
+func (s *MockServer) InjectFaults(faults ...reliapi.Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = faults
+}
+
+// SetMaintenance puts the server in maintenance mode, as a proxy being
+// upgraded: every request fails with a 503 MAINTENANCE error carrying m,
+// which reliapi.AsMaintenance returns. nil ends maintenance.
+func (s *MockServer) SetMaintenance(m *reliapi.Maintenance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maintenance = m
+}
+
+// SetVersion makes /health report version and features, the proxy's
+// reliapi.Capabilities. A nil features is the report of proxies that
+// predate the features list.
+func (s *MockServer) SetVersion(version string, features []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version, s.features = version, features
+}
+
+// ExpireIdempotencyKeys forgets every idempotency key before its TTL is
+// up, as a proxy that lost its idempotency store would: requests sent
+// with one of them again run as new.
+func (s *MockServer) ExpireIdempotencyKeys() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.idempotency)
+}
+
+// DivergeReplays makes the next n idempotency hits run the request again
+// and answer with that fresh response, still reported as a hit, as a
+// faulty proxy might. The key keeps its first response.
+func (s *MockServer) DivergeReplays(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.divergent = n
+}
+
+// Requests returns the requests received so far, in order.
+func (s *MockServer) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// UpstreamCalls returns how many requests reached a handler or an
+// injected failure, that is, were not served from the cache or by
+// idempotency.
+func (s *MockServer) UpstreamCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.upstream
+}
+
+// exchange is the state of one request while it is served.
+type exchange struct {
+	s       *MockServer
+	w       http.ResponseWriter
+	r       *http.Request
+	index   int
+	id      string
+	started time.Time
+	fault   faultPlan
+	// divergent is the idempotency hit the exchange answers with a fresh
+	// response, under DivergeReplays
+	divergent *idempotencyEntry
+}
+
+// faultPlan is the faults that fired for a request.
+type faultPlan struct {
+	labels   []string
+	truncate *int
+	corrupt  bool
+}
+
+func (p faultPlan) label() string { return strings.Join(p.labels, ",") }
+
+// injectFaults draws the request's faults and waits out their latency. It
+// reports false if it answered the request: with an injected error, or
+// because the fault header did not parse.
+func (x *exchange) injectFaults(stream bool) bool {
+	x.s.mu.Lock()
+	faults := x.s.faults
+	x.s.mu.Unlock()
+	if spec := x.r.Header.Get(reliapi.FaultHeader); spec != "" {
+		var err error
+		if faults, err = reliapi.ParseFaults(spec); err != nil {
+			x.fail(&reliapi.APIError{StatusCode: http.StatusBadRequest, Type: "client_error", Code: reliapi.CodeBadRequest, Message: err.Error()})
+			return false
+		}
+	}
+	var latency time.Duration
+	var injected *reliapi.APIError
+	for _, f := range faults {
+		if f.Kind == reliapi.FaultTruncate && !stream || f.Kind == reliapi.FaultCorrupt && stream {
+			continue
+		}
+		if f.Probability > 0 && rand.Float64() >= f.Probability {
+			continue
+		}
+		switch f.Kind {
+		case reliapi.FaultLatency:
+			latency += f.Latency
+		case reliapi.FaultError:
+			if injected != nil {
+				continue
+			}
+			injected = f.Err()
+		case reliapi.FaultTruncate:
+			if x.fault.truncate != nil {
+				continue
+			}
+			n := f.AfterChunks
+			x.fault.truncate = &n
+		case reliapi.FaultCorrupt:
+			x.fault.corrupt = true
+		}
+		x.fault.labels = append(x.fault.labels, f.Label())
+	}
+	if !x.sleep(latency) {
+		return false
+	}
+	if injected == nil {
+		return true
+	}
+	// Nothing is sent that could be truncated or corrupted
+	labels := x.fault.labels[:0]
+	for _, label := range x.fault.labels {
+		if !strings.HasPrefix(label, "truncate_") && !strings.HasPrefix(label, "corrupt_") {
+			labels = append(labels, label)
+		}
+	}
+	x.fault = faultPlan{labels: labels}
+	x.fail(injected)
+	return false
+}
+
+func (s *MockServer) begin(w http.ResponseWriter, r *http.Request) (*exchange, []byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || r.Method != http.MethodPost {
+		http.Error(w, "reliapitest: expected a POST with a body", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if r.Header.Get("X-API-Key") != APIKey {
+		writeJSON(w, http.StatusUnauthorized, errorEnvelope(&reliapi.APIError{
+			StatusCode: http.StatusUnauthorized, Type: "client_error", Code: reliapi.CodeUnauthorized, Message: "Invalid API key",
+		}, ""))
+		return nil, nil, false
+	}
+	s.mu.Lock()
+	index := len(s.requests)
+	x := &exchange{s: s, w: w, r: r, index: index, id: fmt.Sprintf("req_mock_%d", index+1), started: time.Now()}
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Body: body})
+	latency, maintenance := s.latency, s.maintenance
+	s.mu.Unlock()
+	if !x.sleep(latency) {
+		return nil, nil, false
+	}
+	if maintenance != nil {
+		x.maintenance(maintenance)
+		return nil, nil, false
+	}
+	return x, body, true
+}
+
+// maintenance fails the request as the proxy does in maintenance mode.
+// Only POSTs reach it, which read-only maintenance refuses too.
+func (x *exchange) maintenance(m *reliapi.Maintenance) {
+	mode := "full"
+	if m.ReadOnly {
+		mode = "read_only"
+	}
+	x.w.Header().Set("X-ReliAPI-Maintenance", mode)
+	x.fail(&reliapi.APIError{
+		StatusCode: http.StatusServiceUnavailable,
+		Type:       "maintenance_error",
+		Code:       reliapi.CodeMaintenance,
+		Message:    m.Message,
+		Retryable:  true,
+		RetryAfter: m.RetryAfter,
+		Details:    map[string]interface{}{"read_only": m.ReadOnly},
+	})
+}
+
+func (s *MockServer) serveHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	health := map[string]interface{}{"status": "ok", "version": s.version}
+	if s.features != nil {
+		health["features"] = s.features
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, health)
+}
+
+// sleep waits d unless the client goes away first.
+func (x *exchange) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-x.r.Context().Done():
+		return false
+	}
+}
+
+// lookup serves a cache or idempotency hit and reports whether it did.
+func (x *exchange) lookup(cacheKey string, idempotencyKey *string, requestHash string) bool {
+	s := x.s
+	s.mu.Lock()
+	if entry, ok := s.cache[cacheKey]; ok && time.Now().Before(entry.expiresAt) {
+		s.mu.Unlock()
+		meta := entry.meta
+		meta.CacheHit = true
+		x.succeed(entry.data, meta)
+		return true
+	}
+	if idempotencyKey == nil {
+		s.mu.Unlock()
+		return false
+	}
+	entry, ok := s.idempotency[*idempotencyKey]
+	if ok && !time.Now().Before(entry.expiresAt) {
+		// An expired key runs the request again
+		delete(s.idempotency, *idempotencyKey)
+		ok = false
+	}
+	if ok && entry.requestHash == requestHash {
+		entry.replays++
+		s.idempotency[*idempotencyKey] = entry
+		if s.divergent > 0 {
+			s.divergent--
+			x.divergent = &entry
+			s.mu.Unlock()
+			return false
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if entry.requestHash != requestHash {
+		x.fail(&reliapi.APIError{
+			StatusCode: http.StatusConflict,
+			Type:       "idempotency_conflict",
+			Code:       reliapi.CodeIdempotencyConflict,
+			Message:    fmt.Sprintf("Idempotency key '%s' used with different request", *idempotencyKey),
+			Details:    map[string]interface{}{"existing_request_id": entry.requestID},
+		})
+		return true
+	}
+	meta := entry.meta
+	meta.IdempotentHit = true
+	meta.IdempotencyFirstSeenAt = entry.firstSeenAt
+	meta.IdempotencyReplayCount = entry.replays
+	x.succeed(entry.data, meta)
+	return true
+}
+
+// dryRun answers a dry-run request: the meta the real request would get
+// up to the upstream call, with null data. Nothing is called or stored.
+func (x *exchange) dryRun(cacheKey, requestHash string, meta reliapi.Meta) {
+	meta.DryRun = true
+	if cacheKey != "" {
+		meta.CacheKey = requestHash
+		x.s.mu.Lock()
+		entry, ok := x.s.cache[cacheKey]
+		x.s.mu.Unlock()
+		meta.CacheEntryExists = ok && time.Now().Before(entry.expiresAt)
+	}
+	x.succeed(nil, meta)
+}
+
+// reachUpstream counts an upstream call and returns the injected failure
+// it should end with, if any.
+func (x *exchange) reachUpstream() *reliapi.APIError {
+	s := x.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upstream++
+	if len(s.failures) == 0 {
+		return nil
+	}
+	err := s.failures[0]
+	s.failures = s.failures[1:]
+	return err
+}
+
+// store keeps a fresh answer for the cache (when cacheKey is set) and the
+// idempotency key, and stamps meta with the key's TTL and expiry. As on
+// the proxy, the key is kept for idempotencyTTL seconds, or else as long
+// as the cache entry.
+func (x *exchange) store(cacheKey string, ttl *int, idempotencyKey *string, idempotencyTTL *int, requestHash string, data interface{}, meta *reliapi.Meta) {
+	s := x.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	if cacheKey != "" {
+		lifetime := defaultCacheTTL
+		if ttl != nil {
+			lifetime = time.Duration(*ttl) * time.Second
+		}
+		s.cache[cacheKey] = cacheEntry{data: data, meta: *meta, expiresAt: now.Add(lifetime)}
+	}
+	if idempotencyKey != nil && x.divergent == nil {
+		lifetime := defaultCacheTTL
+		if idempotencyTTL != nil {
+			lifetime = time.Duration(*idempotencyTTL) * time.Second
+		} else if ttl != nil && *ttl > 0 {
+			lifetime = time.Duration(*ttl) * time.Second
+		}
+		meta.IdempotencyTTLSeconds = int(lifetime / time.Second)
+		meta.IdempotencyExpiresAt = now.Add(lifetime)
+		s.idempotency[*idempotencyKey] = idempotencyEntry{
+			requestHash: requestHash, data: data, meta: *meta, requestID: x.id,
+			firstSeenAt: now, expiresAt: meta.IdempotencyExpiresAt,
+		}
+	}
+}
+
+func (x *exchange) stamp(meta *reliapi.Meta) {
+	meta.RequestID = x.id
+	if label := x.fault.label(); label != "" {
+		meta.FaultInjected = label
+		x.w.Header().Set(reliapi.FaultInjectedHeader, label)
+	}
+	meta.DurationMs = int(time.Since(x.started) / time.Millisecond)
+	x.s.mu.Lock()
+	x.s.requests[x.index].Meta = meta
+	x.s.mu.Unlock()
+}
+
+func (x *exchange) succeed(data interface{}, meta reliapi.Meta) {
+	if r := x.divergent; r != nil {
+		meta.IdempotentHit = true
+		meta.IdempotencyFirstSeenAt = r.firstSeenAt
+		meta.IdempotencyReplayCount = r.replays
+		meta.IdempotencyTTLSeconds = r.meta.IdempotencyTTLSeconds
+		meta.IdempotencyExpiresAt = r.expiresAt
+	}
+	x.stamp(&meta)
+	x.w.Header().Set("X-Request-ID", x.id)
+	envelope := map[string]interface{}{"success": true, "data": data, "meta": meta}
+	if x.fault.corrupt {
+		// Cut mid-token, as the proxy does
+		raw, _ := json.Marshal(envelope)
+		x.w.Header().Set("Content-Type", "application/json")
+		x.w.WriteHeader(http.StatusOK)
+		_, _ = x.w.Write(raw[:len(raw)/2])
+		return
+	}
+	writeJSON(x.w, http.StatusOK, envelope)
+}
+
+func (x *exchange) fail(err *reliapi.APIError) {
+	e := *err
+	if e.StatusCode == 0 {
+		e.StatusCode = http.StatusBadGateway
+	}
+	x.w.Header().Set("X-Request-ID", x.id)
+	if label := x.fault.label(); label != "" {
+		x.w.Header().Set(reliapi.FaultInjectedHeader, label)
+	}
+	if e.RetryAfter > 0 {
+		x.w.Header().Set("Retry-After", strconv.Itoa(int((e.RetryAfter+time.Second-1)/time.Second)))
+	}
+	writeJSON(x.w, e.StatusCode, errorEnvelope(&e, x.id))
+}
+
+func (s *MockServer) serveLLM(w http.ResponseWriter, r *http.Request) {
+	x, body, ok := s.begin(w, r)
+	if !ok {
+		return
+	}
+	var req reliapi.LLMRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		x.fail(&reliapi.APIError{StatusCode: http.StatusUnprocessableEntity, Type: "client_error", Code: reliapi.CodeBadRequest, Message: err.Error()})
+		return
+	}
+	stream := req.Stream != nil && *req.Stream
+	requestHash := hashBody(body)
+	// Streamed and plain requests share entries, as on the proxy
+	cacheKey := llmProxyPath + ":" + requestHash
+	model := req.Model
+	if model == "" {
+		model = DefaultModel
+	}
+	if req.DryRun {
+		x.dryRun(llmProxyPath+":"+requestHash, requestHash, reliapi.Meta{Target: req.Target, Provider: Provider, Model: model})
+		return
+	}
+	if req.ConversationID != nil {
+		if stream {
+			x.fail(&reliapi.APIError{StatusCode: http.StatusUnprocessableEntity, Type: "client_error", Code: reliapi.CodeBadRequest, Message: "conversation_id is not supported for streaming requests"})
+			return
+		}
+		s.mu.Lock()
+		history := s.conversations[*req.ConversationID].messages
+		s.mu.Unlock()
+		req.Messages = append(append([]reliapi.ChatMessage(nil), history...), req.AppendMessages...)
+		// The body doesn't show the history a turn follows
+		cacheKey = ""
+	}
+	if !x.injectFaults(stream) {
+		return
+	}
+	if stream && x.replay(cacheKey) {
+		return
+	}
+	if !stream && x.lookup(cacheKey, req.IdempotencyKey, requestHash) {
+		return
+	}
+
+	if err := x.reachUpstream(); err != nil {
+		x.fail(err)
+		return
+	}
+	s.mu.Lock()
+	handler := s.llm
+	s.mu.Unlock()
+	reply := handler(req)
+	if !x.sleep(reply.Latency) {
+		return
+	}
+	if reply.Err != nil {
+		x.fail(reply.Err)
+		return
+	}
+
+	usage := reliapi.Usage{PromptTokens: reply.PromptTokens, CompletionTokens: reply.CompletionTokens}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens, _ = reliapi.CountTokens(model, req.Messages)
+	}
+	if usage.CompletionTokens == 0 {
+		usage.CompletionTokens = len(strings.Fields(reply.Content))
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	finish := reply.FinishReason
+	if finish == "" {
+		finish = "stop"
+	}
+	cost := reply.CostUSD
+	meta := reliapi.Meta{Target: req.Target, Provider: Provider, Model: model, ServedBy: req.Target, CostUSD: &cost}
+
+	data := map[string]interface{}{
+		"content":       reply.Content,
+		"role":          "assistant",
+		"finish_reason": finish,
+		"usage":         usage,
+	}
+	if len(reply.ToolCalls) > 0 {
+		data["tool_calls"] = reply.ToolCalls
+	}
+	meta.CacheKey = requestHash
+	if stream {
+		x.store(cacheKey, req.Cache, nil, nil, requestHash, data, &meta)
+		x.stream(reply.Content, finish, usage, meta)
+		return
+	}
+	if req.ConversationID != nil {
+		meta.ConversationTokens = s.addTurn(*req.ConversationID, model, append(req.Messages, reliapi.ChatMessage{Role: "assistant", Content: reply.Content}))
+	}
+	x.store(cacheKey, req.Cache, req.IdempotencyKey, req.IdempotencyTTL, requestHash, data, &meta)
+	x.succeed(data, meta)
+}
+
+// addTurn stores messages as the history of the conversation id after a
+// turn, and returns its size in tokens.
+func (s *MockServer) addTurn(id, model string, messages []reliapi.ChatMessage) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	conv, ok := s.conversations[id]
+	if !ok {
+		conv.createdAt = now
+	}
+	conv.messages, conv.updatedAt = messages, now
+	conv.turns++
+	s.conversations[id] = conv
+	tokens, _ := reliapi.CountTokens(model, messages)
+	return tokens
+}
+
+// serveConversation answers GET and DELETE /v1/conversations/{id}.
+func (s *MockServer) serveConversation(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-API-Key") != APIKey {
+		writeJSON(w, http.StatusUnauthorized, errorEnvelope(&reliapi.APIError{
+			StatusCode: http.StatusUnauthorized, Type: "client_error", Code: reliapi.CodeUnauthorized, Message: "Invalid API key",
+		}, ""))
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		http.Error(w, "reliapitest: expected GET or DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, conversationsPath)
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path})
+	conv, ok := s.conversations[id]
+	if ok && r.Method == http.MethodDelete {
+		delete(s.conversations, id)
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorEnvelope(&reliapi.APIError{
+			StatusCode: http.StatusNotFound, Type: "client_error", Code: reliapi.CodeNotFound, Message: fmt.Sprintf("Conversation '%s' not found", id),
+		}, ""))
+		return
+	}
+	if r.Method == http.MethodGet {
+		tokens, _ := reliapi.CountTokens("", conv.messages)
+		unix := func(t time.Time) float64 { return float64(t.UnixNano()) / 1e9 }
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{
+			"conversation_id": id, "messages": conv.messages, "turns": conv.turns, "dropped_turns": 0, "tokens": tokens,
+			"created_at": unix(conv.createdAt), "updated_at": unix(conv.updatedAt), "expires_at": unix(conv.updatedAt.Add(24 * time.Hour)),
+		}})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"conversation_id": id, "deleted": true}})
+}
+
+// replay streams a cached LLM answer, at no cost, and reports whether
+// there was one.
+func (x *exchange) replay(cacheKey string) bool {
+	s := x.s
+	s.mu.Lock()
+	entry, ok := s.cache[cacheKey]
+	s.mu.Unlock()
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return false
+	}
+	data, _ := entry.data.(map[string]interface{})
+	content, _ := data["content"].(string)
+	finish, _ := data["finish_reason"].(string)
+	usage, _ := data["usage"].(reliapi.Usage)
+	meta := entry.meta
+	meta.CacheHit = true
+	cost := 0.0
+	meta.CostUSD = &cost
+	x.stream(content, finish, usage, meta)
+	return true
+}
+
+// stream answers a streaming LLM request with a chunk per word.
+func (x *exchange) stream(content, finish string, usage reliapi.Usage, meta reliapi.Meta) {
+	x.stamp(&meta)
+	w := x.w
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Request-ID", x.id)
+	flusher, _ := w.(http.Flusher)
+	send := func(event string, data interface{}) {
+		raw, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, raw)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	send("meta", map[string]interface{}{
+		"target": meta.Target, "provider": meta.Provider, "model": meta.Model, "request_id": x.id,
+		"cache_key": meta.CacheKey, "fault_injected": meta.FaultInjected,
+	})
+	words := strings.SplitAfter(content, " ")
+	for i, word := range words {
+		if x.fault.truncate != nil && i == *x.fault.truncate {
+			return
+		}
+		chunk := map[string]interface{}{"delta": word, "index": i}
+		if i == len(words)-1 {
+			chunk["finish_reason"] = finish
+		}
+		send("chunk", chunk)
+	}
+	send("done", map[string]interface{}{"finish_reason": finish, "usage": usage, "cost_usd": meta.CostUSD, "cache_hit": meta.CacheHit})
+}
+
+func (s *MockServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	x, body, ok := s.begin(w, r)
+	if !ok {
+		return
+	}
+	var req reliapi.HTTPRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		x.fail(&reliapi.APIError{StatusCode: http.StatusUnprocessableEntity, Type: "client_error", Code: reliapi.CodeBadRequest, Message: err.Error()})
+		return
+	}
+	requestHash := hashBody(body)
+	cacheKey := ""
+	if method := strings.ToUpper(req.Method); method == http.MethodGet || method == http.MethodHead {
+		cacheKey = httpProxyPath + ":" + requestHash
+	}
+	if req.DryRun {
+		x.dryRun(cacheKey, requestHash, reliapi.Meta{Target: req.Target})
+		return
+	}
+	if !x.injectFaults(false) {
+		return
+	}
+	if x.lookup(cacheKey, req.IdempotencyKey, requestHash) {
+		return
+	}
+
+	if err := x.reachUpstream(); err != nil {
+		x.fail(err)
+		return
+	}
+	s.mu.Lock()
+	handler := s.http
+	s.mu.Unlock()
+	reply := handler(req)
+	if !x.sleep(reply.Latency) {
+		return
+	}
+	if reply.Err != nil {
+		x.fail(reply.Err)
+		return
+	}
+
+	status := reply.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	headers := reply.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	data := map[string]interface{}{"status_code": status, "headers": headers, "body": reply.Body}
+	meta := reliapi.Meta{Target: req.Target, ResponseEncoding: reliapi.BodyEncodingUTF8}
+	if req.MaxResponseBytes != nil {
+		raw, isText := reply.Body.(string)
+		if !isText {
+			encoded, _ := json.Marshal(reply.Body)
+			raw = string(encoded)
+		}
+		if limit := *req.MaxResponseBytes; len(raw) > limit {
+			if !req.TruncateResponse {
+				x.fail(&reliapi.APIError{
+					StatusCode: http.StatusBadGateway,
+					Type:       "response_too_large",
+					Code:       reliapi.CodeResponseTooLarge,
+					Message:    fmt.Sprintf("Upstream response is larger than max_response_bytes %d", limit),
+					Details:    map[string]interface{}{"max_response_bytes": limit, "content_length": len(raw), "upstream_status": status},
+				})
+				return
+			}
+			// As on the proxy, a cut JSON body is no longer JSON, and a
+			// truncated response is never cached
+			if isText {
+				data["body"] = raw[:limit]
+			} else {
+				data["body"] = map[string]interface{}{"raw": raw[:limit]}
+			}
+			meta.Truncated = true
+			meta.OriginalContentLength = int64(len(raw))
+			cacheKey = ""
+		}
+	}
+	if cacheKey != "" {
+		meta.CacheKey = requestHash
+	}
+	x.store(cacheKey, req.Cache, req.IdempotencyKey, req.IdempotencyTTL, requestHash, data, &meta)
+	x.succeed(data, meta)
+}
+
+// normalizeBody drops the request fields that differ between identical
+// calls: generated idempotency keys, their TTLs, deadlines derived from
+// contexts and the dry-run flag, so a dry run reports the real request's
+// cache key.
+// A JSON upstream body is decoded, so that, as for the proxy, whitespace
+// and key order don't tell requests apart.
+func normalizeBody(body []byte) []byte {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	delete(fields, "idempotency_key")
+	delete(fields, "idempotency_ttl_s")
+	delete(fields, "timeout_ms")
+	delete(fields, "dry_run")
+	delete(fields, "stream")
+	if upstream, ok := fields["body"].(string); ok {
+		var decoded interface{}
+		if json.Unmarshal([]byte(upstream), &decoded) == nil {
+			fields["body"] = decoded
+		}
+	}
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return normalized
+}
+
+func hashBody(body []byte) string {
+	sum := sha256.Sum256(normalizeBody(body))
+	return hex.EncodeToString(sum[:])
+}
+
+func errorEnvelope(err *reliapi.APIError, requestID string) map[string]interface{} {
+	detail := map[string]interface{}{
+		"type":        err.Type,
+		"code":        err.Code,
+		"message":     err.Message,
+		"retryable":   err.Retryable,
+		"status_code": err.StatusCode,
+	}
+	if err.Target != "" {
+		detail["target"] = err.Target
+	}
+	if err.Details != nil {
+		detail["details"] = err.Details
+	}
+	if err.RetryAfter > 0 {
+		detail["retry_after_s"] = err.RetryAfter.Seconds()
+	}
+	return map[string]interface{}{
+		"success": false,
+		"error":   detail,
+		"meta":    map[string]interface{}{"request_id": requestID, "duration_ms": 0},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
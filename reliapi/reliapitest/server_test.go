@@ -0,0 +1,651 @@
+package reliapitest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi"
+)
+
+func question(content string) reliapi.LLMRequest {
+	return reliapi.LLMRequest{
+		Target:   "openai",
+		Messages: []reliapi.ChatMessage{{Role: "user", Content: content}},
+	}
+}
+
+func code(err error) string {
+	var apiErr *reliapi.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+func TestMockServerLLMCache(t *testing.T) {
+	srv := NewMockServer(t)
+	srv.HandleLLM(func(req reliapi.LLMRequest) LLMReply {
+		return LLMReply{Content: "Echo: " + req.Messages[0].Content, CostUSD: 0.001}
+	})
+	client := srv.Client()
+	ctx := context.Background()
+
+	first, err := client.ProxyLLM(ctx, question("hi"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if text, _ := first.CompletionText(); text != "Echo: hi" {
+		t.Errorf("content = %q", text)
+	}
+	if first.Meta.CacheHit || first.Meta.Model != DefaultModel || first.Meta.Provider != Provider {
+		t.Errorf("first meta = %+v", first.Meta)
+	}
+	if first.Meta.RequestID != "req_mock_1" || first.Meta.CostUSD == nil || *first.Meta.CostUSD != 0.001 {
+		t.Errorf("first meta = %+v", first.Meta)
+	}
+
+	second, err := client.ProxyLLM(ctx, question("hi"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if !second.Meta.CacheHit || second.Meta.CacheKey != first.Meta.CacheKey {
+		t.Errorf("second meta = %+v, want a cache hit on %q", second.Meta, first.Meta.CacheKey)
+	}
+	if _, err := client.ProxyLLM(ctx, question("bye")); err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if got := srv.UpstreamCalls(); got != 2 {
+		t.Errorf("UpstreamCalls = %d, want 2", got)
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 3 || reqs[0].Path != "/v1/proxy/llm" || reqs[1].Meta == nil || !reqs[1].Meta.CacheHit {
+		t.Errorf("Requests = %+v", reqs)
+	}
+}
+
+func TestMockServerIdempotency(t *testing.T) {
+	srv := NewMockServer(t)
+	client := srv.Client()
+	ctx := context.Background()
+	key := "order-1"
+	noCache := 0
+
+	req := question("charge")
+	req.IdempotencyKey = &key
+	req.Cache = &noCache
+	if _, err := client.ProxyLLM(ctx, req); err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	again, err := client.ProxyLLM(ctx, req)
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if !again.Meta.IdempotentHit || srv.UpstreamCalls() != 1 {
+		t.Errorf("meta = %+v, upstream calls = %d", again.Meta, srv.UpstreamCalls())
+	}
+	if again.Meta.IdempotencyReplayCount != 1 || time.Since(again.Meta.IdempotencyFirstSeenAt) > time.Minute {
+		t.Errorf("replay meta = %d, %v", again.Meta.IdempotencyReplayCount, again.Meta.IdempotencyFirstSeenAt)
+	}
+	if third, _ := client.ProxyLLM(ctx, req); third == nil || third.Meta.IdempotencyReplayCount != 2 {
+		t.Errorf("third replay = %+v", third)
+	}
+
+	other := question("refund")
+	other.IdempotencyKey = &key
+	_, err = client.ProxyLLM(ctx, other)
+	conflict, ok := reliapi.AsIdempotencyConflict(err)
+	if !ok || conflict.ExistingRequestID != "req_mock_1" {
+		t.Fatalf("err = %v, want an idempotency conflict with req_mock_1", err)
+	}
+
+	// Reformatted JSON is the same request
+	bodyKey := "create-1"
+	create := reliapi.HTTPRequest{Target: "api", Method: http.MethodPost, Path: "/items", IdempotencyKey: &bodyKey}
+	body := `{"name":"ada","tags":["a"]}`
+	create.Body = &body
+	if _, err := client.ProxyHTTP(ctx, create); err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	body = "{\n  \"tags\": [\"a\"],\n  \"name\": \"ada\"\n}"
+	replay, err := client.ProxyHTTP(ctx, create)
+	if err != nil || !replay.Meta.IdempotentHit {
+		t.Errorf("reformatted body = %v, %v", replay, err)
+	}
+	body = `{"name":"bob","tags":["a"]}`
+	if _, err := client.ProxyHTTP(ctx, create); !reliapi.IsIdempotencyConflict(err) {
+		t.Errorf("changed body err = %v", err)
+	}
+
+	// An expired key runs the request again
+	ttl := 1
+	payKey := "pay-1"
+	pay := reliapi.HTTPRequest{Target: "api", Method: http.MethodPost, Path: "/payments", IdempotencyKey: &payKey, IdempotencyTTL: &ttl}
+	first, err := client.ProxyHTTP(ctx, pay)
+	if err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	if first.Meta.IdempotencyTTLSeconds != 1 || !first.Meta.IdempotencyExpiresAt.After(time.Now()) {
+		t.Errorf("ttl meta = %d, %v", first.Meta.IdempotencyTTLSeconds, first.Meta.IdempotencyExpiresAt)
+	}
+	if replay, _ := client.ProxyHTTP(ctx, pay); replay == nil || !replay.Meta.IdempotentHit || !replay.Meta.IdempotencyExpiresAt.Equal(first.Meta.IdempotencyExpiresAt) {
+		t.Errorf("replay = %+v", replay)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	calls := srv.UpstreamCalls()
+	if rerun, err := client.ProxyHTTP(ctx, pay); err != nil || rerun.Meta.IdempotentHit || srv.UpstreamCalls() != calls+1 {
+		t.Errorf("after expiry = %+v, %v", rerun, err)
+	}
+}
+
+func TestMockServerReplayDivergence(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		srv := NewMockServer(t)
+		answers := 0
+		srv.HandleLLM(func(reliapi.LLMRequest) LLMReply {
+			answers++
+			return LLMReply{Content: fmt.Sprintf("answer %d", answers)}
+		})
+		var seen []*reliapi.ReplayDivergence
+		opts := []reliapi.Option{reliapi.WithReplayDivergenceHandler(func(ctx context.Context, d *reliapi.ReplayDivergence) {
+			seen = append(seen, d)
+		})}
+		if strict {
+			opts = append(opts, reliapi.WithStrictIdempotency())
+		}
+		client := srv.Client(opts...)
+		ctx := context.Background()
+		key := "order-1"
+		noCache := 0
+		req := question("charge")
+		req.IdempotencyKey = &key
+		req.Cache = &noCache
+
+		first, err := client.ProxyLLM(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.ProxyLLM(ctx, req); err != nil || len(seen) != 0 {
+			t.Fatalf("strict %v: a faithful replay = %v, %+v", strict, err, seen)
+		}
+
+		// A replay with another body
+		srv.DivergeReplays(1)
+		resp, err := client.ProxyLLM(ctx, req)
+		if len(seen) != 1 {
+			t.Fatalf("strict %v: divergences %+v", strict, seen)
+		}
+		d := seen[0]
+		if d.Reason != reliapi.DivergenceBody || d.IdempotencyKey != key || d.FirstRequestID != first.Meta.RequestID || d.RequestID != "req_mock_3" ||
+			d.FirstHash == d.Hash || d.Window != time.Hour || !d.ExpiresAt.Equal(first.Meta.IdempotencyExpiresAt) {
+			t.Errorf("strict %v: divergence %+v", strict, d)
+		}
+		var got *reliapi.ReplayDivergence
+		if strict && (resp != nil || !errors.As(err, &got) || got != d || !errors.Is(err, reliapi.ErrReplayDivergence)) || !strict && (err != nil || resp == nil) {
+			t.Errorf("strict %v: resp %v, err %v", strict, resp, err)
+		}
+
+		// The proxy's window ending early: the key runs again. The
+		// divergent answer is the one compared with now
+		srv.ExpireIdempotencyKeys()
+		resp, err = client.ProxyLLM(ctx, req)
+		if len(seen) != 2 || seen[1].Reason != reliapi.DivergenceNotReplayed || seen[1].FirstRequestID != "req_mock_3" || seen[1].RequestID != "req_mock_4" {
+			t.Fatalf("strict %v: divergences %+v", strict, seen)
+		}
+		if strict != (err != nil) || strict && !errors.Is(err, reliapi.ErrReplayDivergence) {
+			t.Errorf("strict %v: resp %v, err %v", strict, resp, err)
+		}
+		if reliapi.IdempotencyKeyOf(err) != key && strict {
+			t.Errorf("IdempotencyKeyOf(%v) = %q", err, reliapi.IdempotencyKeyOf(err))
+		}
+
+		// Once the proxy keeps the key again, its replays are consistent
+		if _, err := client.ProxyLLM(ctx, req); err != nil || len(seen) != 2 {
+			t.Errorf("strict %v: after the rerun = %v, %d divergences", strict, err, len(seen))
+		}
+	}
+}
+
+func TestMockServerMaxResponseBytes(t *testing.T) {
+	srv := NewMockServer(t)
+	srv.HandleHTTP(func(reliapi.HTTPRequest) HTTPReply {
+		return HTTPReply{Body: strings.Repeat("x", 100)}
+	})
+	client := srv.Client()
+	ctx := context.Background()
+	limit := 10
+	req := reliapi.HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/page", MaxResponseBytes: &limit}
+
+	_, err := client.ProxyHTTP(ctx, req)
+	if got, ok := reliapi.AsResponseTooLarge(err); !ok || got.ContentLength != 100 {
+		t.Fatalf("err = %v, want RESPONSE_TOO_LARGE", err)
+	}
+
+	req.TruncateResponse = true
+	for i := 0; i < 2; i++ {
+		resp, err := client.ProxyHTTP(ctx, req)
+		if err != nil {
+			t.Fatalf("ProxyHTTP: %v", err)
+		}
+		if !resp.Meta.Truncated || resp.Meta.OriginalContentLength != 100 || resp.Meta.CacheHit {
+			t.Errorf("meta = %+v", resp.Meta)
+		}
+		if body := resp.DataMap()["body"]; body != strings.Repeat("x", 10) {
+			t.Errorf("body = %v", body)
+		}
+	}
+	if n := srv.UpstreamCalls(); n != 3 {
+		t.Errorf("upstream calls = %d, want 3 (truncated responses are not cached)", n)
+	}
+}
+
+func TestMockServerDryRun(t *testing.T) {
+	srv := NewMockServer(t)
+	client := srv.Client()
+	ctx := context.Background()
+
+	meta, err := client.Validate(ctx, question("hi"))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !meta.DryRun || meta.CacheEntryExists || meta.CacheKey == "" || meta.Model != DefaultModel {
+		t.Errorf("meta = %+v", meta)
+	}
+	if n := srv.UpstreamCalls(); n != 0 {
+		t.Fatalf("upstream calls = %d after a dry run", n)
+	}
+
+	resp, err := client.ProxyLLM(ctx, question("hi"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if resp.Meta.CacheHit || resp.Meta.CacheKey != meta.CacheKey {
+		t.Errorf("meta = %+v, want the dry run's cache key %s", resp.Meta, meta.CacheKey)
+	}
+	if meta, err = client.Validate(ctx, question("hi")); err != nil || !meta.CacheEntryExists {
+		t.Errorf("Validate after caching = %+v, %v", meta, err)
+	}
+	if n := srv.UpstreamCalls(); n != 1 {
+		t.Errorf("upstream calls = %d, want 1", n)
+	}
+}
+
+func TestMockServerFailNext(t *testing.T) {
+	srv := NewMockServer(t)
+	srv.FailNext(2, &reliapi.APIError{Type: "upstream_error", Code: reliapi.CodeProviderError, Message: "boom", Retryable: true})
+	client := srv.Client(reliapi.WithAutoIdempotency(), reliapi.WithRetry(3, time.Millisecond))
+
+	resp, err := client.ProxyLLM(context.Background(), question("hi"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if !resp.Success || srv.UpstreamCalls() != 3 {
+		t.Errorf("success = %v, upstream calls = %d", resp.Success, srv.UpstreamCalls())
+	}
+	reqs := srv.Requests()
+	if len(reqs) != 3 || reqs[0].Meta != nil || reqs[2].Meta == nil {
+		t.Errorf("Requests = %+v", reqs)
+	}
+
+	srv.HandleLLM(func(reliapi.LLMRequest) LLMReply {
+		return LLMReply{Err: &reliapi.APIError{StatusCode: http.StatusPaymentRequired, Type: "budget_error", Code: reliapi.CodeBudgetExceeded, Message: "over budget"}}
+	})
+	_, err = client.ProxyLLM(context.Background(), question("again"))
+	if !reliapi.IsBudgetExceeded(err) || code(err) != reliapi.CodeBudgetExceeded {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestMockServerLatency(t *testing.T) {
+	srv := NewMockServer(t)
+	srv.SetLatency(time.Second)
+	client := srv.Client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ProxyLLM(ctx, question("hi")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the deadline to pass", err)
+	}
+
+	srv.SetLatency(20 * time.Millisecond)
+	resp, err := client.ProxyLLM(context.Background(), question("hi"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if resp.Meta.DurationMs < 20 {
+		t.Errorf("duration_ms = %d, want at least 20", resp.Meta.DurationMs)
+	}
+}
+
+func TestMockServerStream(t *testing.T) {
+	srv := NewMockServer(t)
+	srv.HandleLLM(func(reliapi.LLMRequest) LLMReply { return LLMReply{Content: "The capital is Paris."} })
+
+	s, err := srv.Client().ProxyLLMStream(context.Background(), question("capital?"))
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+	var sb strings.Builder
+	for {
+		chunk, err := s.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		sb.WriteString(chunk.Delta)
+	}
+	if sb.String() != "The capital is Paris." {
+		t.Errorf("streamed %q", sb.String())
+	}
+	if s.Meta().Provider != Provider || s.Usage().CompletionTokens != 4 {
+		t.Errorf("meta = %+v, usage = %+v", s.Meta(), s.Usage())
+	}
+}
+
+func TestMockServerStreamSharesCache(t *testing.T) {
+	srv := NewMockServer(t)
+	srv.HandleLLM(func(reliapi.LLMRequest) LLMReply { return LLMReply{Content: "Paris.", CostUSD: 0.001} })
+	client := srv.Client()
+	ctx := context.Background()
+
+	stream := func() *reliapi.Stream {
+		t.Helper()
+		s, err := client.ProxyLLMStream(ctx, question("capital?"))
+		if err != nil {
+			t.Fatalf("ProxyLLMStream: %v", err)
+		}
+		defer s.Close()
+		for {
+			if _, err := s.Recv(); err == io.EOF {
+				return s
+			} else if err != nil {
+				t.Fatalf("Recv: %v", err)
+			}
+		}
+	}
+
+	if first := stream(); first.Meta().CacheHit {
+		t.Errorf("first stream meta = %+v", first.Meta())
+	}
+	plain, err := client.ProxyLLM(ctx, question("capital?"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if text, _ := plain.CompletionText(); !plain.Meta.CacheHit || text != "Paris." {
+		t.Errorf("plain answer %q, meta = %+v", text, plain.Meta)
+	}
+	replayed := stream()
+	if meta := replayed.Meta(); !meta.CacheHit || meta.CostUSD == nil || *meta.CostUSD != 0 {
+		t.Errorf("replayed stream meta = %+v", meta)
+	}
+	if got := srv.UpstreamCalls(); got != 1 {
+		t.Errorf("UpstreamCalls = %d, want 1", got)
+	}
+}
+
+func TestMockServerHTTP(t *testing.T) {
+	srv := NewMockServer(t)
+	srv.HandleHTTP(func(req reliapi.HTTPRequest) HTTPReply {
+		return HTTPReply{Headers: map[string]string{"X-Upstream": "yes"}, Body: map[string]string{"path": req.Path}}
+	})
+	client := srv.Client()
+	ctx := context.Background()
+
+	get := reliapi.HTTPRequest{Target: "users", Method: "GET", Path: "/users/1"}
+	resp, err := client.ProxyHTTP(ctx, get)
+	if err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	data := resp.DataMap()
+	if data["status_code"] != float64(200) || data["body"].(map[string]interface{})["path"] != "/users/1" {
+		t.Errorf("data = %v", data)
+	}
+	if headers := data["headers"].(map[string]interface{}); headers["X-Upstream"] != "yes" {
+		t.Errorf("headers = %v", headers)
+	}
+	if resp, _ = client.ProxyHTTP(ctx, get); !resp.Meta.CacheHit {
+		t.Errorf("repeated GET meta = %+v, want a cache hit", resp.Meta)
+	}
+
+	post := reliapi.HTTPRequest{Target: "users", Method: "POST", Path: "/users"}
+	for i := 0; i < 2; i++ {
+		if resp, _ = client.ProxyHTTP(ctx, post); resp.Meta.CacheHit {
+			t.Errorf("POST %d was served from the cache", i+1)
+		}
+	}
+}
+
+func TestMockServerRejectsOtherKeys(t *testing.T) {
+	srv := NewMockServer(t)
+	client, err := reliapi.NewClient(srv.URL, "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ProxyLLM(context.Background(), question("hi")); code(err) != reliapi.CodeUnauthorized {
+		t.Fatalf("err = %v, want unauthorized", err)
+	}
+}
+
+func TestMockServerFaults(t *testing.T) {
+	srv := NewMockServer(t)
+	srv.HandleLLM(func(reliapi.LLMRequest) LLMReply { return LLMReply{Content: "The capital is Paris."} })
+	client := srv.Client()
+	ctx := context.Background()
+
+	srv.InjectFaults(reliapi.ErrorFault(reliapi.CodeCircuitOpen))
+	if _, err := client.ProxyLLM(ctx, question("hi")); !reliapi.IsCircuitOpen(err) {
+		t.Errorf("err = %v, want CIRCUIT_OPEN", err)
+	}
+	if srv.UpstreamCalls() != 0 {
+		t.Errorf("upstream calls = %d, want the error injected before the upstream", srv.UpstreamCalls())
+	}
+
+	srv.InjectFaults(reliapi.LatencyFault(20*time.Millisecond), reliapi.ErrorFault(reliapi.CodeServerError).WithProbability(0.000001))
+	resp, err := client.ProxyLLM(ctx, question("hi"))
+	if err != nil {
+		t.Fatalf("ProxyLLM: %v", err)
+	}
+	if resp.Meta.FaultInjected != "latency_20ms" || resp.Meta.DurationMs < 20 {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+
+	srv.InjectFaults(reliapi.CorruptFault())
+	if _, err := client.ProxyLLM(ctx, question("corrupt")); err == nil {
+		t.Error("corrupt body decoded")
+	}
+
+	// The header replaces the server's faults
+	s, err := client.ProxyLLMStream(reliapi.WithFaults(ctx, reliapi.TruncateFault(2)), question("truncate"))
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+	chunks := 0
+	for {
+		_, err = s.Recv()
+		if err != nil {
+			break
+		}
+		chunks++
+	}
+	if chunks != 2 || !errors.Is(err, reliapi.ErrStreamInterrupted) {
+		t.Errorf("chunks = %d, err = %v, want the stream cut after 2", chunks, err)
+	}
+	if s.Meta().FaultInjected != "truncate_after_2_chunks" {
+		t.Errorf("stream meta = %+v", s.Meta())
+	}
+
+	srv.InjectFaults()
+	if resp, err := client.ProxyLLM(ctx, question("fine")); err != nil || resp.Meta.FaultInjected != "" {
+		t.Errorf("meta = %+v, err = %v after InjectFaults()", resp.Meta, err)
+	}
+}
+
+func TestMockServerMaintenance(t *testing.T) {
+	srv := NewMockServer(t)
+	srv.SetMaintenance(&reliapi.Maintenance{RetryAfter: 2 * time.Minute, Message: "upgrading"})
+	_, err := srv.Client().ProxyLLM(context.Background(), question("hi"))
+	m, ok := reliapi.AsMaintenance(err)
+	if !errors.Is(err, reliapi.ErrMaintenance) || !ok {
+		t.Fatalf("err = %v", err)
+	}
+	if m.ReadOnly || m.Message != "upgrading" || m.RetryAfter != 2*time.Minute {
+		t.Errorf("maintenance = %+v", m)
+	}
+
+	// Retried: maintenance may end before the next attempt
+	srv.SetMaintenance(&reliapi.Maintenance{Message: "upgrading"})
+	client := srv.Client(reliapi.WithRetry(3, time.Millisecond))
+	if _, err := client.ProxyLLM(context.Background(), question("hi")); !reliapi.IsMaintenance(err) {
+		t.Fatalf("err = %v", err)
+	}
+	if n := len(srv.Requests()); n != 4 {
+		t.Errorf("%d attempts", n-1)
+	}
+
+	// Read-only maintenance refuses POSTs until it ends
+	srv.SetMaintenance(&reliapi.Maintenance{ReadOnly: true})
+	_, err = client.ProxyLLM(context.Background(), question("hi"))
+	if m, ok := reliapi.AsMaintenance(err); !ok || !m.ReadOnly {
+		t.Fatalf("err = %v", err)
+	}
+	if n := len(srv.Requests()); n != 5 {
+		t.Errorf("%d attempts in read-only maintenance", n-4)
+	}
+
+	srv.SetMaintenance(nil)
+	if _, err := client.ProxyLLM(context.Background(), question("hi")); err != nil {
+		t.Errorf("after maintenance: %v", err)
+	}
+}
+
+func TestMockServerOldVersion(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name     string
+		features []string
+	}{
+		{"features", []string{}},
+		{"version", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewMockServer(t)
+			srv.SetVersion("1.0.5", tt.features)
+			client := srv.Client()
+
+			check := func(op string, err error, feature string) {
+				t.Helper()
+				var ns *reliapi.NotSupportedError
+				if !errors.Is(err, reliapi.ErrNotSupported) || !errors.As(err, &ns) {
+					t.Fatalf("%s: err = %v", op, err)
+				}
+				if ns.Feature != feature || ns.MinVersion != "1.0.7" || ns.ServerVersion != "1.0.5" {
+					t.Errorf("%s: %+v", op, ns)
+				}
+			}
+			// Each feature as first found missing, before the capabilities
+			// are known
+			_, err := client.JobResult(ctx, "job_1")
+			check("JobResult", err, reliapi.FeatureAsyncJobs)
+			_, err = srv.Client().SubmitLLM(ctx, question("hi"))
+			check("SubmitLLM", err, reliapi.FeatureAsyncJobs)
+			_, err = srv.Client().InvalidateTarget(ctx, "openai")
+			check("InvalidateTarget", err, reliapi.FeatureTargetPurge)
+			_, _, err = srv.Client().ProxyHTTPStream(ctx, reliapi.HTTPRequest{Target: "api", Method: "GET", Path: "/file"})
+			check("ProxyHTTPStream", err, reliapi.FeatureHTTPStream)
+
+			// Then without sending
+			sent := len(srv.Requests())
+			err = client.Jobs(ctx, reliapi.JobsQuery{}).Pages(func([]reliapi.Job) error { return nil })
+			check("Jobs", err, reliapi.FeatureAsyncJobs)
+			_, err = client.SubmitLLM(ctx, question("hi"))
+			check("SubmitLLM", err, reliapi.FeatureAsyncJobs)
+			if n := len(srv.Requests()); n != sent {
+				t.Errorf("%d requests sent", n-sent)
+			}
+		})
+	}
+}
+
+func TestMockServerCapabilities(t *testing.T) {
+	srv := NewMockServer(t)
+	caps, err := srv.Client().ServerCapabilities(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Version != Version || caps.Features == nil || caps.Supports(reliapi.FeatureAsyncJobs) {
+		t.Errorf("capabilities = %+v", caps)
+	}
+}
+
+func TestMockServerConversations(t *testing.T) {
+	srv := NewMockServer(t)
+	var seen [][]reliapi.ChatMessage
+	srv.HandleLLM(func(req reliapi.LLMRequest) LLMReply {
+		seen = append(seen, req.Messages)
+		return LLMReply{Content: "reply " + req.Messages[len(req.Messages)-1].Content}
+	})
+	client := srv.Client()
+	ctx := context.Background()
+	id := "conv-1"
+	turn := func(content string) reliapi.LLMRequest {
+		return reliapi.LLMRequest{Target: "openai", ConversationID: &id, AppendMessages: []reliapi.ChatMessage{{Role: "user", Content: content}}}
+	}
+
+	for _, content := range []string{"one", "two", "two"} {
+		resp, err := client.ProxyLLM(ctx, turn(content))
+		if err != nil {
+			t.Fatalf("ProxyLLM: %v", err)
+		}
+		if resp.Meta.ConversationTokens == 0 {
+			t.Errorf("meta = %+v", resp.Meta)
+		}
+	}
+	// The repeated turn followed a longer history, so it was not a cache hit
+	if len(seen) != 3 || len(seen[1]) != 3 || len(seen[2]) != 5 || seen[1][1].Content != "reply one" {
+		t.Fatalf("handler saw %+v", seen)
+	}
+
+	conv, err := client.GetConversation(ctx, id)
+	if err != nil {
+		t.Fatalf("GetConversation: %v", err)
+	}
+	if conv.Turns != 3 || len(conv.Messages) != 6 || conv.Messages[5].Content != "reply two" || conv.UpdatedAt.IsZero() {
+		t.Errorf("conversation = %+v", conv)
+	}
+
+	stream := true
+	streamed := turn("three")
+	streamed.Stream = &stream
+	if _, err := client.ProxyLLMStream(ctx, streamed); code(err) != reliapi.CodeBadRequest {
+		t.Errorf("streamed turn: %v", err)
+	}
+
+	if err := client.DeleteConversation(ctx, id); err != nil {
+		t.Fatalf("DeleteConversation: %v", err)
+	}
+	if _, err := client.GetConversation(ctx, id); code(err) != reliapi.CodeNotFound {
+		t.Errorf("GetConversation after delete: %v", err)
+	}
+}
+
+func TestStartMockServer(t *testing.T) {
+	srv := StartMockServer()
+	resp, err := srv.Client().ProxyLLM(context.Background(), question("hi"))
+	if err != nil || resp.Meta.RequestID == "" {
+		t.Fatalf("ProxyLLM: %+v, %v", resp, err)
+	}
+	srv.Close()
+	if _, err := srv.Client().ProxyLLM(context.Background(), question("hi")); err == nil {
+		t.Error("served after Close")
+	}
+}
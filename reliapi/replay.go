@@ -0,0 +1,49 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+const replayPath = "/v1/replay"
+
+// ReplayOverrides changes what a Replay sends; its zero value replays the
+// request as it was.
+type ReplayOverrides struct {
+	// Model and Temperature replace those of a replayed ProxyLLM request.
+	// A ProxyHTTP request fails with CodeBadRequest if either is set.
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	// Target sends the replay to another target.
+	Target string `json:"target,omitempty"`
+	// AllowCache lets a cached response answer the replay. By default a
+	// replay always goes upstream.
+	AllowCache bool `json:"allow_cache,omitempty"`
+}
+
+// Replay runs the request whose response had Meta.RequestID requestID
+// again, as the proxy recorded it in its audit log, and returns the new
+// response with Meta.ReplayOf set to requestID. It needs the proxy's admin
+// key (RELIAPI_ADMIN_KEY).
+//
+// A replay is billed and budgeted as a request of the original tenant. It
+// never uses the original's idempotency key, so it really is sent again,
+// and it is never retried under WithRetry. A request the proxy has no
+// record of is a 404 *APIError with CodeNotFound; one it can't replay
+// fails with CodeReplayUnavailable (see IsReplayUnavailable).
+func (c *Client) Replay(ctx context.Context, requestID string, overrides ReplayOverrides) (*ReliAPIResponse, error) {
+	if requestID == "" {
+		return nil, errors.New("reliapi: request ID is required")
+	}
+	return c.post(ctx, replayPath+"/"+url.PathEscape(requestID), overrides, false)
+}
+
+// IsReplayUnavailable reports whether err is a proxy refusal to Replay a
+// request. Only requests to targets with AuditCaptureFull are kept
+// whole enough to be replayed. Conversation turns can't be replayed, and
+// neither can ProxyHTTP requests whose recorded body had redacted values,
+// since the replay would not send what the original did.
+func IsReplayUnavailable(err error) bool {
+	return hasCode(err, CodeReplayUnavailable)
+}
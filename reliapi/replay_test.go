@@ -0,0 +1,59 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != replayPath+"/req_1" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		_ = json.Unmarshal(raw, &body)
+		if len(body) != 2 || body["model"] != "gpt-4o" || body["temperature"] != 0.0 {
+			t.Errorf("body = %s", raw)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "hi"},
+			"meta":    map[string]interface{}{"request_id": "req_2", "replay_of": "req_1", "model": "gpt-4o"},
+		})
+	})
+
+	zero := 0.0
+	resp, err := c.Replay(context.Background(), "req_1", ReplayOverrides{Model: "gpt-4o", Temperature: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta.ReplayOf != "req_1" || resp.Meta.RequestID != "req_2" {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+}
+
+func TestReplayUnavailable(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"detail": map[string]interface{}{
+				"success": false,
+				"error": map[string]interface{}{
+					"type": "client_error", "code": CodeReplayUnavailable, "status_code": 409,
+					"message": "Request 'req_1' can't be replayed: conversation turns can't be replayed",
+				},
+			},
+		})
+	})
+
+	_, err := c.Replay(context.Background(), "req_1", ReplayOverrides{})
+	if !IsReplayUnavailable(err) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := c.Replay(context.Background(), "", ReplayOverrides{}); err == nil {
+		t.Error("empty request ID accepted")
+	}
+}
@@ -0,0 +1,76 @@
+package reliapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxResponseBytes is the default limit on the size of a proxy
+// response the client reads (see WithMaxResponseBytes).
+const DefaultMaxResponseBytes = 64 << 20
+
+// ErrResponseTooLarge is returned when a proxy response is larger than the
+// client's limit. The response is not decoded.
+var ErrResponseTooLarge = errors.New("reliapi: response too large")
+
+// WithMaxResponseBytes sets the largest proxy response the client reads
+// before decoding it; larger ones fail with ErrResponseTooLarge, so a
+// misbehaving proxy can't exhaust the caller's memory. The default is
+// DefaultMaxResponseBytes, and 0 or less removes the limit. To bound what
+// the proxy returns for an upstream body, set HTTPRequest.MaxResponseBytes.
+func WithMaxResponseBytes(n int64) Option {
+	return func(c *Client) {
+		c.maxResponseBytes = n
+	}
+}
+
+// ResponseTooLarge is the detail of a RESPONSE_TOO_LARGE error.
+type ResponseTooLarge struct {
+	// MaxResponseBytes is the limit the upstream body went over.
+	MaxResponseBytes int `json:"max_response_bytes"`
+	// ContentLength is the size the upstream declared, 0 if none.
+	ContentLength int64 `json:"content_length,omitempty"`
+	// UpstreamStatus is the status code of the upstream response.
+	UpstreamStatus int `json:"upstream_status,omitempty"`
+}
+
+// IsResponseTooLarge reports whether err means a response was over a size
+// limit: the proxy's HTTPRequest.MaxResponseBytes (RESPONSE_TOO_LARGE) or
+// the client's own (ErrResponseTooLarge).
+func IsResponseTooLarge(err error) bool {
+	return errors.Is(err, ErrResponseTooLarge) || hasCode(err, CodeResponseTooLarge)
+}
+
+// AsResponseTooLarge returns the details of a RESPONSE_TOO_LARGE error. It
+// reports false for other errors, ErrResponseTooLarge included.
+func AsResponseTooLarge(err error) (*ResponseTooLarge, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !hasCode(apiErr, CodeResponseTooLarge) {
+		return nil, false
+	}
+	raw, _ := json.Marshal(apiErr.Details)
+	var r ResponseTooLarge
+	_ = json.Unmarshal(raw, &r)
+	return &r, true
+}
+
+// readBody reads a proxy response body up to the client's limit.
+func (c *Client) readBody(body io.Reader) ([]byte, error) {
+	if c.maxResponseBytes <= 0 {
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("reliapi: read response: %w", err)
+		}
+		return raw, nil
+	}
+	raw, err := io.ReadAll(io.LimitReader(body, c.maxResponseBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reliapi: read response: %w", err)
+	}
+	if int64(len(raw)) > c.maxResponseBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, c.maxResponseBytes)
+	}
+	return raw, nil
+}
@@ -0,0 +1,55 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMaxResponseBytes(t *testing.T) {
+	big := strings.Repeat("x", 4096)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"status_code": 200, "body": map[string]interface{}{"raw": big}},
+			"meta":    map[string]interface{}{"request_id": "req_1"},
+		})
+	}, WithMaxResponseBytes(1024))
+
+	_, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/big"})
+	if !errors.Is(err, ErrResponseTooLarge) || !IsResponseTooLarge(err) {
+		t.Fatalf("err = %v, want ErrResponseTooLarge", err)
+	}
+	if _, ok := AsResponseTooLarge(err); ok {
+		t.Error("AsResponseTooLarge matched the client's own limit")
+	}
+
+	c = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"raw": big}, "meta": map[string]interface{}{}})
+	}, WithMaxResponseBytes(0))
+	if _, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/big"}); err != nil {
+		t.Errorf("unlimited: %v", err)
+	}
+}
+
+func TestResponseTooLargeError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"type": "response_too_large", "code": CodeResponseTooLarge, "status_code": 502,
+				"message": "Upstream response is larger than max_response_bytes 1000",
+				"details": map[string]interface{}{"max_response_bytes": 1000, "content_length": 3000000, "upstream_status": 500},
+			},
+			"meta": map[string]interface{}{"request_id": "req_1"},
+		})
+	})
+	limit := 1000
+	_, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/", MaxResponseBytes: &limit})
+	got, ok := AsResponseTooLarge(err)
+	if !ok || !IsResponseTooLarge(err) || got.MaxResponseBytes != 1000 || got.ContentLength != 3000000 || got.UpstreamStatus != 500 {
+		t.Fatalf("AsResponseTooLarge(%v) = %+v, %v", err, got, ok)
+	}
+}
@@ -0,0 +1,236 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultMaxRetryDelay = 30 * time.Second
+
+// retryConfig controls retries of the client-to-proxy hop. The proxy's own
+// upstream retries (core/retry.py) are configured per target.
+type retryConfig struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// WithRetry retries requests that fail with a connection error or a 429,
+// 502, 503 or 504 from the proxy, up to maxAttempts total attempts.
+//
+// Only requests that are safe to resend are retried: HTTP proxy calls with an
+// idempotent method (GET, HEAD, OPTIONS, PUT, DELETE) and any request that
+// carries an idempotency key. Other requests, such as LLM calls and POSTs
+// through the HTTP proxy, are given a random key before their first
+// attempt when they have none, so a retry of one whose upstream call
+// already ran is answered from the proxy's idempotency store (with
+// Meta.IdempotentHit set) instead of being run, and charged, twice. The
+// key is in ReliAPIResponse.IdempotencyKey, or IdempotencyKeyOf the error,
+// and is passed to the WithIdempotencyKeyHook hook before the request is
+// sent. A RetryPolicy with MaxAttempts 1 opts a request out of both.
+// Delays grow exponentially from baseDelay with
+// jitter, a Retry-After header takes precedence, and no retry is scheduled
+// past the context deadline. A Retry-After longer than 30s is not waited
+// out: the response is returned, and its APIError carries RetryAfter.
+// A proxy in read-only maintenance (ErrMaintenance) refuses everything but
+// GETs until it ends, so only GETs are retried through it.
+func WithRetry(maxAttempts int, baseDelay time.Duration) Option {
+	return func(c *Client) {
+		if maxAttempts < 1 {
+			maxAttempts = 1
+		}
+		if baseDelay <= 0 {
+			baseDelay = 100 * time.Millisecond
+		}
+		c.retry = retryConfig{
+			maxAttempts: maxAttempts,
+			baseDelay:   baseDelay,
+			maxDelay:    defaultMaxRetryDelay,
+		}
+	}
+}
+
+// send sends payload to path with method and returns the first response that
+// is not retried. The caller owns the returned response body.
+func (c *Client) send(ctx context.Context, method, path string, payload payload, accept string, retryable bool) (*http.Response, error) {
+	attempts := 1
+	if retryable {
+		attempts = c.retry.maxAttempts
+	}
+
+	raw := payload
+	payload, err := c.compress(path, payload)
+	if err != nil {
+		return nil, err
+	}
+	in := c.instrumentFrom(ctx)
+	hr := c.hookRequest(ctx)
+	var (
+		dispatched func(limited bool) // by the rate limit queue
+		queued     time.Duration
+	)
+	for attempt := 1; ; attempt++ {
+		httpReq, err := c.newRequest(ctx, method, path, payload)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Accept", accept)
+		c.setAcceptEncoding(httpReq, accept)
+
+		resp, err := c.httpClient.Do(httpReq)
+		if dispatched != nil {
+			dispatched(rateLimited(resp, err))
+			dispatched = nil
+		}
+		in.attempt(attempt, resp, err)
+		if hr != nil && len(c.attemptHooks) > 0 {
+			if herr := c.runAttemptHooks(ctx, hr, attempt, resp, err); herr != nil {
+				return nil, herr
+			}
+		}
+		if c.dictionaryRejected(payload, resp) {
+			// Resent gzipped, as the same attempt
+			drainAndClose(resp.Body)
+			if payload, err = c.compress(path, raw); err != nil {
+				return nil, err
+			}
+			attempt--
+			continue
+		}
+		if q := c.rateQueue; q != nil && retryable && rateLimited(resp, err) && ctx.Err() == nil {
+			wait := c.retry.backoff(attempt)
+			if ra, ok := parseRetryAfter(resp.Header.Get("Retry-After"), q.clock.Now()); ok {
+				wait = ra
+			}
+			queued += wait
+			if deadline, ok := ctx.Deadline(); queued > q.maxWait || ok && q.clock.Now().Add(wait).After(deadline) {
+				return resp, err
+			}
+			drainAndClose(resp.Body)
+			if dispatched, err = q.park(ctx, queueRank(ctx), wait); err != nil {
+				return nil, err
+			}
+			// Parking is not an attempt
+			attempts++
+			continue
+		}
+		if attempt >= attempts || !shouldRetry(ctx, resp, err) || refusedUntilMaintenanceEnds(method, resp) {
+			return resp, err
+		}
+
+		delay := c.retry.backoff(attempt)
+		if resp != nil {
+			if ra, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				// A wait past maxDelay is the caller's call to make;
+				// hand back the response (and its RetryAfter) instead.
+				if ra > c.retry.maxDelay {
+					return resp, err
+				}
+				delay = ra
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		if resp != nil {
+			drainAndClose(resp.Body)
+		}
+		if err := c.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the delay before attempt+1: exponential with equal
+// jitter, so successive delays never shrink.
+func (r retryConfig) backoff(attempt int) time.Duration {
+	d := r.baseDelay << (attempt - 1)
+	if d <= 0 || d > r.maxDelay {
+		d = r.maxDelay
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		// Transport failures (refused, reset, timeouts) are worth another try,
+		// an http.Client Timeout included: ctx, the caller's own deadline,
+		// has not passed. A resent request with side effects carries the
+		// key it was first sent with, so a timed-out one that ran is not
+		// run again.
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// allowsResend reports whether a request with retry policy p may be sent to
+// the proxy more than once.
+func allowsResend(p *RetryPolicy) bool {
+	return p == nil || p.MaxAttempts != 1
+}
+
+// isIdempotentHTTP reports whether an HTTP proxy call may be resent.
+func isIdempotentHTTP(req HTTPRequest) bool {
+	if !allowsResend(req.Retry) {
+		return false
+	}
+	if req.IdempotencyKey != nil {
+		return true
+	}
+	switch strings.ToUpper(req.Method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After value in either delay-seconds or
+// HTTP-date form.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,315 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordSleeps replaces the client's sleep so tests run instantly and can
+// inspect the scheduled delays.
+func recordSleeps(c *Client) *[]time.Duration {
+	var delays []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	return &delays
+}
+
+func flakyHandler(failures int, status int, calls *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		if int(n) <= failures {
+			writeJSON(w, status, map[string]interface{}{"detail": "unavailable"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{"request_id": "req_ok"}})
+	}
+}
+
+func TestRetryRecoversFromTransient503(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, flakyHandler(2, http.StatusServiceUnavailable, &calls), WithRetry(3, 100*time.Millisecond))
+	delays := recordSleeps(c)
+
+	resp, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/"})
+	if err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	if resp.Meta.RequestID != "req_ok" {
+		t.Errorf("request_id = %q", resp.Meta.RequestID)
+	}
+	if calls != 3 {
+		t.Fatalf("attempts = %d, want 3", calls)
+	}
+	if len(*delays) != 2 {
+		t.Fatalf("delays = %v", *delays)
+	}
+	d1, d2 := (*delays)[0], (*delays)[1]
+	if d1 < 50*time.Millisecond || d1 > 100*time.Millisecond {
+		t.Errorf("first delay %v outside [50ms, 100ms]", d1)
+	}
+	if d2 < d1 || d2 < 100*time.Millisecond {
+		t.Errorf("second delay %v did not grow from %v", d2, d1)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, flakyHandler(10, http.StatusBadGateway, &calls), WithRetry(3, time.Millisecond))
+	recordSleeps(c)
+
+	_, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 502 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("attempts = %d, want 3", calls)
+	}
+}
+
+func TestRetrySkipsNonRetriableStatus(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized} {
+		var calls int32
+		c := newTestClient(t, flakyHandler(10, status, &calls), WithRetry(3, time.Millisecond))
+		recordSleeps(c)
+
+		if _, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/"}); err == nil {
+			t.Fatalf("status %d: expected error", status)
+		}
+		if calls != 1 {
+			t.Errorf("status %d: attempts = %d, want 1", status, calls)
+		}
+	}
+}
+
+func TestRetryOnlyResendsSafeRequests(t *testing.T) {
+	var calls int32
+	var keys []string
+	flaky := flakyHandler(10, http.StatusServiceUnavailable, &calls)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			IdempotencyKey string `json:"idempotency_key"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		keys = append(keys, body.IdempotencyKey)
+		flaky(w, r)
+	}, WithRetry(3, time.Millisecond))
+	recordSleeps(c)
+
+	// An LLM call without an idempotency key is given one to be resent
+	// with, the same on every attempt.
+	_, err := c.ProxyLLM(context.Background(), llmReq("hi"))
+	if calls != 3 || keys[0] == "" || keys[1] != keys[0] || keys[2] != keys[0] {
+		t.Fatalf("unkeyed LLM attempts = %d, keys = %q", calls, keys)
+	}
+	if got := IdempotencyKeyOf(err); got != keys[0] {
+		t.Errorf("IdempotencyKeyOf = %q, want %q", got, keys[0])
+	}
+
+	// With a key it is sent as is.
+	calls, keys = 0, nil
+	key := "k1"
+	req := llmReq("hi")
+	req.IdempotencyKey = &key
+	_, _ = c.ProxyLLM(context.Background(), req)
+	if calls != 3 || keys[2] != key {
+		t.Fatalf("keyed LLM attempts = %d, keys = %q", calls, keys)
+	}
+
+	// POST through the HTTP proxy is not idempotent, so it gets a key too;
+	// a GET needs none.
+	calls, keys = 0, nil
+	_, _ = c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "POST", Path: "/charges"})
+	if calls != 3 || keys[0] == "" || keys[2] != keys[0] {
+		t.Fatalf("POST attempts = %d, keys = %q", calls, keys)
+	}
+	calls, keys = 0, nil
+	_, _ = c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/charges"})
+	if calls != 3 || keys[0] != "" {
+		t.Fatalf("GET attempts = %d, keys = %q", calls, keys)
+	}
+
+	// A client without retries leaves unkeyed requests alone.
+	calls, keys = 0, nil
+	once := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["idempotency_key"]; ok {
+			t.Errorf("idempotency_key sent without retries: %v", body)
+		}
+		flaky(w, r)
+	})
+	_, _ = once.ProxyLLM(context.Background(), llmReq("hi"))
+	if calls != 1 {
+		t.Fatalf("attempts without retries = %d", calls)
+	}
+}
+
+func TestRetryPolicySingleAttemptIsNeverResent(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, flakyHandler(10, http.StatusServiceUnavailable, &calls), WithRetry(3, time.Millisecond))
+	recordSleeps(c)
+	once := &RetryPolicy{MaxAttempts: 1}
+
+	key := "k1"
+	req := llmReq("hi")
+	req.IdempotencyKey = &key
+	req.Retry = once
+	_, _ = c.ProxyLLM(context.Background(), req)
+	if calls != 1 {
+		t.Fatalf("LLM attempts = %d, want 1", calls)
+	}
+
+	calls = 0
+	_, _ = c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/x", Retry: once})
+	if calls != 1 {
+		t.Fatalf("GET attempts = %d, want 1", calls)
+	}
+
+	// Other policies leave client retries alone.
+	calls = 0
+	req.Retry = &RetryPolicy{MaxAttempts: 5}
+	_, _ = c.ProxyLLM(context.Background(), req)
+	if calls != 3 {
+		t.Fatalf("LLM attempts = %d, want 3", calls)
+	}
+}
+
+func TestRetryPolicyWireFormat(t *testing.T) {
+	var sent map[string]interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("decode: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "ok"},
+			"meta":    map[string]interface{}{"request_id": "r1", "retries": 2, "attempts": 3, "retry_delays_ms": []int{1000, 2000}},
+		})
+	})
+	req := llmReq("hi")
+	req.Retry = &RetryPolicy{MaxAttempts: 3, BackoffMs: 1000, RetryOn: []int{503}}
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"max_attempts": float64(3), "backoff_ms": float64(1000), "retry_on": []interface{}{float64(503)}}
+	if !reflect.DeepEqual(sent["retry"], want) {
+		t.Errorf("retry = %v, want %v", sent["retry"], want)
+	}
+	if resp.Meta.Attempts != 3 || !reflect.DeepEqual(resp.Meta.RetryDelaysMs, []int{1000, 2000}) {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "2")
+			writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{"detail": "slow down"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{}, "meta": map[string]interface{}{}})
+	}, WithRetry(2, time.Millisecond))
+	delays := recordSleeps(c)
+
+	if _, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/"}); err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	if len(*delays) != 1 || (*delays)[0] != 2*time.Second {
+		t.Errorf("delays = %v, want [2s]", *delays)
+	}
+}
+
+func TestRetryDoesNotWaitOutLongRetryAfter(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "3600")
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{"detail": "come back later"})
+	}, WithRetry(5, time.Millisecond))
+	delays := recordSleeps(c)
+
+	_, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != time.Hour {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if calls != 1 || len(*delays) != 0 {
+		t.Errorf("attempts = %d, delays = %v; want one attempt and no sleep", calls, *delays)
+	}
+}
+
+func TestRetryStopsAtContextDeadline(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "60")
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"detail": "down"})
+	}, WithRetry(5, time.Millisecond))
+	recordSleeps(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := c.ProxyHTTP(ctx, HTTPRequest{Target: "t", Method: "GET", Path: "/"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 503 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("attempts = %d, want 1 (retry would overrun the deadline)", calls)
+	}
+}
+
+func TestRetryOnConnectionError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close() // nothing listens here any more
+
+	c, err := NewClient(url, "k", WithRetry(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	delays := recordSleeps(c)
+
+	if _, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "t", Method: "GET", Path: "/"}); err == nil {
+		t.Fatal("expected connection error")
+	}
+	if len(*delays) != 2 {
+		t.Errorf("delays = %v, want 2 retries", *delays)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"0.5", 500 * time.Millisecond, true},
+		{"-1", 0, false},
+		{"Mon, 01 Jan 2024 00:00:10 GMT", 10 * time.Second, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.in, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package reliapi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Headers of a signed request; see WithHMACAuth.
+const (
+	HeaderKeyID     = "X-ReliAPI-Key-Id"
+	HeaderTimestamp = "X-ReliAPI-Timestamp"
+	HeaderNonce     = "X-ReliAPI-Nonce"
+	HeaderSignature = "X-ReliAPI-Signature"
+)
+
+// WithHMACAuth signs requests with HMAC-SHA256 under secret, a key the
+// proxy knows as keyID (its request_signing config), instead of sending an
+// API key. The signature covers the method, path and query, a SHA-256 of
+// the body as sent, a Unix timestamp and a random nonce, so the proxy
+// rejects requests replayed, altered in transit or signed with a clock
+// more than its max_skew_s off. Every attempt, retries included, is signed
+// afresh.
+//
+// The client's own API key may then be empty. A key set for one call with
+// WithRequestAPIKey or a TenantKeyProvider is still sent as X-API-Key,
+// unsigned. Multipart file bodies are read twice: once to hash them.
+func WithHMACAuth(keyID, secret string) Option {
+	return func(c *Client) {
+		c.hmacKeyID = keyID
+		c.hmacSecret = []byte(secret)
+	}
+}
+
+// signRequest adds the signature headers of req, whose body p is, at time
+// ts. The nonce is 16 random bytes.
+func (c *Client) signRequest(req *http.Request, p payload, ts int64) error {
+	bodyHash := sha256.New()
+	if p != nil {
+		r, err := p.open()
+		if err != nil {
+			return fmt.Errorf("reliapi: sign request: %w", err)
+		}
+		_, err = io.Copy(bodyHash, r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("reliapi: sign request: %w", err)
+		}
+	}
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return fmt.Errorf("reliapi: sign request: %w", err)
+	}
+	timestamp := strconv.FormatInt(ts, 10)
+	nonceHex := hex.EncodeToString(nonce[:])
+
+	req.Header.Set(HeaderKeyID, c.hmacKeyID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonceHex)
+	sum := hex.EncodeToString(bodyHash.Sum(nil))
+	req.Header.Set(HeaderSignature, signature(c.hmacSecret, req.Method, requestTarget(req), sum, timestamp, nonceHex))
+	return nil
+}
+
+// requestTarget is the escaped path of req, with its query if it has one.
+func requestTarget(req *http.Request) string {
+	target := req.URL.EscapedPath()
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	return target
+}
+
+// signature is the hex HMAC-SHA256 of the canonical request: its method,
+// target, body hash, timestamp and nonce joined by newlines.
+func signature(secret []byte, method, target, bodyHash, timestamp, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	io.WriteString(mac, method+"\n"+target+"\n"+bodyHash+"\n"+timestamp+"\n"+nonce)
+	return hex.EncodeToString(mac.Sum(nil))
+}
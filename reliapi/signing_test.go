@@ -0,0 +1,71 @@
+package reliapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkSignature verifies a signed request the way the proxy does, against
+// body as received.
+func checkSignature(r *http.Request, body []byte, secret string) bool {
+	sum := sha256.Sum256(body)
+	want := signature([]byte(secret), r.Method, requestTarget(r), hex.EncodeToString(sum[:]),
+		r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderNonce))
+	return r.Header.Get(HeaderSignature) == want
+}
+
+func TestHMACAuth(t *testing.T) {
+	var nonces []string
+	var apiKeys []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		apiKeys = append(apiKeys, r.Header.Get("X-API-Key"))
+		if r.Header.Get(HeaderSignature) == "" {
+			writeJSON(w, 200, map[string]interface{}{"success": true, "meta": map[string]interface{}{}})
+			return
+		}
+		if r.Header.Get(HeaderKeyID) != "ci" || r.Header.Get(HeaderTimestamp) != "1792000000" {
+			t.Errorf("key id %q, timestamp %q", r.Header.Get(HeaderKeyID), r.Header.Get(HeaderTimestamp))
+		}
+		if !checkSignature(r, body, "s3cret") {
+			t.Errorf("signature does not verify")
+		}
+		// A body changed after signing no longer verifies
+		if checkSignature(r, append(body, ' '), "s3cret") || checkSignature(r, body, "other") {
+			t.Errorf("signature verifies a mutated body or another secret")
+		}
+		nonces = append(nonces, r.Header.Get(HeaderNonce))
+		if len(nonces) == 1 {
+			writeJSON(w, 503, map[string]interface{}{"success": false, "error": map[string]interface{}{"code": "UPSTREAM_5XX"}})
+			return
+		}
+		writeJSON(w, 200, map[string]interface{}{"success": true, "meta": map[string]interface{}{}})
+	}, WithHMACAuth("ci", "s3cret"), WithRetry(2, time.Millisecond), WithCompression(1))
+	recordSleeps(c)
+	c.now = func() time.Time { return time.Unix(1792000000, 0) }
+
+	key := "k1"
+	req := HTTPRequest{Target: "t", Method: "GET", Path: "/", IdempotencyKey: &key}
+	if _, err := c.ProxyHTTP(context.Background(), req); err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	// The retry is signed afresh, so the proxy's nonce cache accepts it
+	if len(nonces) != 2 || nonces[0] == nonces[1] || len(nonces[0]) != 32 {
+		t.Fatalf("nonces = %q", nonces)
+	}
+
+	// A key set for the call is sent as is, unsigned
+	ctx := WithRequestAPIKey(context.Background(), "tenant-key")
+	if _, err := c.ProxyHTTP(ctx, HTTPRequest{Target: "t", Method: "GET", Path: "/"}); err != nil {
+		t.Fatalf("ProxyHTTP: %v", err)
+	}
+	if got := strings.Join(apiKeys, ","); got != ",,tenant-key" {
+		t.Errorf("X-API-Key headers = %q", got)
+	}
+}
@@ -0,0 +1,652 @@
+package reliapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStreamInterrupted is returned by Stream.Recv when the connection ends
+// before the proxy sent its terminal "done" event.
+var ErrStreamInterrupted = errors.New("reliapi: stream interrupted before completion")
+
+// ErrStreamGap matches a *StreamGapError with errors.Is.
+var ErrStreamGap = errors.New("reliapi: stream is missing chunks")
+
+// StreamGapError is returned by Stream.Recv when indexed chunks are missing
+// and did not arrive within the reorder window (see WithStreamReorderWindow).
+// From and To are the missing indices, inclusive.
+type StreamGapError struct {
+	From, To int
+}
+
+func (e *StreamGapError) Error() string {
+	if e.From == e.To {
+		return fmt.Sprintf("%v: chunk %d", ErrStreamGap, e.From)
+	}
+	return fmt.Sprintf("%v: chunks %d-%d", ErrStreamGap, e.From, e.To)
+}
+
+// Is reports whether target is ErrStreamGap.
+func (e *StreamGapError) Is(target error) bool {
+	return target == ErrStreamGap
+}
+
+// defaultStreamReorderWindow is how many chunks a Stream buffers while
+// waiting for a missing one.
+const defaultStreamReorderWindow = 2
+
+// WithStreamReorderWindow sets how many out-of-order chunks a Stream buffers
+// while waiting for a missing one before Recv fails with a StreamGapError.
+// The default is 2; 0 fails on the first out-of-order chunk.
+//
+// Ordering applies to chunks the proxy numbers (SSE id or "index"). Some
+// intermediaries duplicate or shuffle SSE events; duplicates of a received
+// index are always dropped.
+func WithStreamReorderWindow(n int) Option {
+	return func(c *Client) {
+		if n < 0 {
+			n = 0
+		}
+		c.streamReorderWindow = n
+	}
+}
+
+// StreamStats counts the repairs a Stream made to its chunk sequence.
+type StreamStats struct {
+	// DuplicatesDropped is the number of chunks dropped because their
+	// index was already received.
+	DuplicatesDropped int
+	// Reordered is the number of chunks that arrived early and were held
+	// back until the chunks before them arrived.
+	Reordered int
+}
+
+// ChatCompletionChunk is one incremental piece of a streamed completion.
+type ChatCompletionChunk struct {
+	// Delta is the text appended by this chunk.
+	Delta string `json:"delta"`
+	// FinishReason is set on the final content chunk when the provider
+	// reports one.
+	FinishReason string `json:"finish_reason,omitempty"`
+	// Logprobs are those of the chunk's tokens, when the request set
+	// LLMRequest.Logprobs; Stream.Logprobs accumulates them.
+	Logprobs []TokenLogprob `json:"logprobs,omitempty"`
+}
+
+// Stream reads Server-Sent Events from a streaming /proxy/llm call.
+//
+// Callers loop on Recv until it returns io.EOF and must call Close when done.
+// Stream is not safe for concurrent use.
+type Stream struct {
+	ctx        context.Context
+	body       io.ReadCloser
+	reader     *bufio.Reader
+	stopCancel func() bool
+
+	meta   Meta
+	usage  Usage
+	key    string
+	done   bool
+	err    error
+	closer sync.Once
+
+	// For the usage of an aborted stream: the estimated prompt tokens and
+	// the text received so far.
+	promptTokens int
+	received     strings.Builder
+	// The logprobs of the chunks returned so far
+	logprobs []TokenLogprob
+
+	// Chunk sequencing: eventID is the SSE id of the event being handled,
+	// next the index expected next, pending the early chunks by index, and
+	// ready the chunks released from pending but not yet returned.
+	eventID string
+	window  int
+	next    int
+	pending map[int]*ChatCompletionChunk
+	ready   []*ChatCompletionChunk
+	stats   StreamStats
+
+	// Under WithRedactor: the request's placeholders, and the end of the
+	// text so far that may be a placeholder split across chunks.
+	vault *RedactionVault
+	held  string
+
+	client     *Client
+	hookReq    *Request
+	instrument *callInstrument
+	finished   bool
+}
+
+// streamMetaEvent is the payload of the "meta" event sent before content.
+type streamMetaEvent struct {
+	Target            string   `json:"target"`
+	Provider          string   `json:"provider"`
+	Model             string   `json:"model"`
+	RequestID         string   `json:"request_id"`
+	CostEstimateUSD   *float64 `json:"cost_estimate_usd"`
+	CostPolicyApplied string   `json:"cost_policy_applied"`
+	MaxTokensReduced  *bool    `json:"max_tokens_reduced"`
+	OriginalMaxTokens *int     `json:"original_max_tokens"`
+	TargetVersion     int      `json:"target_version"`
+	// Set under a ContextPolicy
+	TrimmedMessages       int `json:"trimmed_messages"`
+	PromptTokensAfterTrim int `json:"prompt_tokens_after_trim"`
+	RedactionsApplied     int `json:"redactions_applied"`
+	QueueWaitMs           int `json:"queue_wait_ms"`
+	ConcurrencyWaitMs     int `json:"concurrency_wait_ms"`
+	// Set when a model alias resolved the request
+	ResolvedTarget string `json:"resolved_target"`
+	ResolvedModel  string `json:"resolved_model"`
+	// Set for a request rendered from a template
+	TemplateName    string `json:"template_name"`
+	TemplateVersion int    `json:"template_version"`
+	// Set when a cached completion is replayed
+	CacheKey string `json:"cache_key"`
+	// Set when faults were injected
+	FaultInjected string `json:"fault_injected"`
+}
+
+// streamDoneEvent is the payload of the terminal "done" event.
+type streamDoneEvent struct {
+	FinishReason string   `json:"finish_reason"`
+	Usage        Usage    `json:"usage"`
+	CostUSD      *float64 `json:"cost_usd"`
+	CacheHit     bool     `json:"cache_hit"`
+	CacheStored  bool     `json:"cache_stored"`
+	// Set when the provider sent no usage
+	CostEstimated bool `json:"cost_estimated"`
+}
+
+// streamErrorEvent is the payload of an "error" event.
+type streamErrorEvent struct {
+	Code           string                 `json:"code"`
+	Message        string                 `json:"message"`
+	UpstreamStatus int                    `json:"upstream_status"`
+	RetryAfterS    float64                `json:"retry_after_s"`
+	Details        map[string]interface{} `json:"details"`
+}
+
+// openAIStreamChunk covers raw OpenAI-style "data:" events that carry no
+// event name.
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string       `json:"finish_reason"`
+		Logprobs     tokenLogprobs `json:"logprobs"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// ProxyLLMStream sends req with stream=true and returns a Stream over the
+// proxy's SSE response. Note that an http.Client Timeout bounds the whole
+// stream, not just the time to first byte.
+func (c *Client) ProxyLLMStream(ctx context.Context, req LLMRequest) (s *Stream, err error) {
+	ctx, in := c.instrument(ctx, OpProxyLLMStream, req.Target)
+	var hr *Request
+	defer func() {
+		if err != nil {
+			err = c.endHooks(ctx, hr, nil, err)
+			in.end(nil, err)
+		}
+	}()
+	req, err = withPromptMessages(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.admitLoop(ctx, req); err != nil {
+		return nil, err
+	}
+	in.logPrompts(req.Messages)
+	if err = c.checkImages(req.Messages); err != nil {
+		return nil, err
+	}
+	ctx, err = c.tenantContext(ctx, req.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if ctx, req, err = c.guardLLM(ctx, req); err != nil {
+		return nil, err
+	}
+	if req.Tags, err = c.withTags(req.Tags); err != nil {
+		return nil, err
+	}
+	req, vault := c.redact(req)
+	stream := true
+	req.Stream = &stream
+	key, err := c.applyIdempotency(&req.IdempotencyKey, req, allowsResend(req.Retry))
+	if err != nil {
+		return nil, err
+	}
+	req.IdempotencyTTL = c.idempotencyTTLSeconds(key, req.IdempotencyTTL)
+	req.TimeoutMs = contextTimeoutMs(ctx, req.TimeoutMs)
+	if hr, err = c.startHooks(ctx, OpProxyLLMStream, req.Target, &req.IdempotencyKey, req); err != nil {
+		return nil, err
+	}
+	if hr != nil {
+		key = hr.IdempotencyKey
+	}
+
+	payload, err := encodePayload(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retries only cover failures before the first event; once the stream
+	// is open, interruptions surface from Recv.
+	resp, err := c.send(withHookRequest(withQueuePriority(ctx, req.Priority), hr), http.MethodPost, llmProxyPath, payload, "text/event-stream", req.IdempotencyKey != nil && allowsResend(req.Retry))
+	if err != nil {
+		return nil, withIdempotencyKey(contextError(ctx, err), key)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer drainAndClose(resp.Body)
+		raw, _ := c.readBody(resp.Body)
+		return nil, withIdempotencyKey(newAPIError(resp, raw), key)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		// The proxy answered with a regular JSON envelope (e.g. an error
+		// produced before the stream started).
+		defer drainAndClose(resp.Body)
+		raw, _ := c.readBody(resp.Body)
+		return nil, withIdempotencyKey(newAPIError(resp, raw), key)
+	}
+
+	promptTokens, _ := CountTokens(req.Model, req.Messages)
+	s = &Stream{
+		ctx:    ctx,
+		body:   resp.Body,
+		reader: bufio.NewReader(resp.Body),
+		meta:   Meta{RequestID: resp.Header.Get("X-Request-ID"), FaultInjected: resp.Header.Get(FaultInjectedHeader)},
+		key:    key,
+		window: c.streamReorderWindow,
+		vault:  vault,
+
+		promptTokens: promptTokens,
+
+		client:     c,
+		hookReq:    hr,
+		instrument: in,
+	}
+	// Closing the body on cancellation unblocks a pending Recv immediately,
+	// even with transports that don't watch the request context.
+	s.stopCancel = context.AfterFunc(ctx, func() { s.body.Close() })
+	return s, nil
+}
+
+// Recv returns the next content chunk. It returns io.EOF once the proxy has
+// sent its "done" event, an *APIError for an "error" event, and
+// ErrStreamInterrupted if the connection drops first. Duplicated chunks are
+// dropped and shuffled ones returned in order; a *StreamGapError reports
+// chunks that never arrived. Under WithRedactor placeholders are restored
+// in each Delta, and text that may be the start of one is held back until
+// the next chunk shows whether it is.
+func (s *Stream) Recv() (*ChatCompletionChunk, error) {
+	chunk, err := s.recv()
+	if chunk != nil {
+		s.received.WriteString(chunk.Delta)
+		s.logprobs = append(s.logprobs, chunk.Logprobs...)
+	}
+	if s.vault == nil {
+		return chunk, err
+	}
+	if err != nil {
+		if err == io.EOF && s.held != "" {
+			// Recv returns io.EOF again on the next call
+			chunk, s.held = &ChatCompletionChunk{Delta: s.vault.Restore(s.held)}, ""
+			return chunk, nil
+		}
+		return nil, err
+	}
+	text := s.held + chunk.Delta
+	cut := len(text)
+	if chunk.FinishReason == "" {
+		cut = heldSuffix(text)
+	}
+	out := *chunk
+	out.Delta, s.held = s.vault.Restore(text[:cut]), text[cut:]
+	return &out, nil
+}
+
+func (s *Stream) recv() (*ChatCompletionChunk, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if len(s.ready) > 0 {
+		chunk := s.ready[0]
+		s.ready = s.ready[1:]
+		return chunk, nil
+	}
+	for {
+		event, data, err := s.readEvent()
+		if err != nil {
+			if s.done {
+				return nil, s.fail(io.EOF)
+			}
+			if ctxErr := s.ctx.Err(); ctxErr != nil {
+				s.abort()
+				return nil, s.fail(ctxErr)
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, s.fail(ErrStreamInterrupted)
+			}
+			return nil, s.fail(fmt.Errorf("%w: %w", ErrStreamInterrupted, err))
+		}
+
+		chunk, err := s.handle(event, data)
+		if err != nil {
+			return nil, s.fail(err)
+		}
+		if s.done {
+			return nil, s.fail(io.EOF)
+		}
+		if chunk != nil {
+			return chunk, nil
+		}
+	}
+}
+
+// Meta returns the request metadata gathered so far. After Recv returns
+// io.EOF it also carries CostUSD, computed from the provider's usage, and
+// CacheHit and CacheStored from the trailing "done" event; a completion
+// replayed from the cache costs nothing. After an abort Aborted is set instead.
+func (s *Stream) Meta() Meta {
+	return s.meta
+}
+
+// IdempotencyKey returns the key sent with the request, if any.
+func (s *Stream) IdempotencyKey() string {
+	return s.key
+}
+
+// Stats reports the duplicates dropped and chunks reordered so far.
+func (s *Stream) Stats() StreamStats {
+	return s.stats
+}
+
+// Logprobs returns the logprobs of the chunks received so far, in order;
+// after io.EOF, those of the whole completion. Wrap them in a Choice for
+// ChoiceConfidence and LabelProbability.
+func (s *Stream) Logprobs() []TokenLogprob {
+	return s.logprobs
+}
+
+// Usage returns the token usage reported in the "done" event. It is the
+// provider's count, so duplicated chunks never inflate it, unless
+// Meta.CostEstimated is set. Once the stream is aborted it is an estimate
+// of the prompt and the text received.
+func (s *Stream) Usage() Usage {
+	return s.usage
+}
+
+// Close releases the underlying connection. It is safe to call more than
+// once.
+func (s *Stream) Close() error {
+	var err error
+	s.abort()
+	s.closer.Do(func() {
+		s.stopCancel()
+		err = s.body.Close()
+	})
+	if panicErr := s.finish(context.Canceled); panicErr != nil && err == nil {
+		err = panicErr
+	}
+	return err
+}
+
+// abort marks a stream given up before its "done" event, estimating the
+// usage so far. Streams that already ended are left as they are.
+func (s *Stream) abort() {
+	if s.done || s.err != nil || s.meta.Aborted {
+		return
+	}
+	s.meta.Aborted = true
+	s.meta.CostEstimated = true
+	completion := textTokens(s.received.String(), nonASCIICharsPerToken(s.meta.Model))
+	s.usage = Usage{PromptTokens: s.promptTokens, CompletionTokens: completion, TotalTokens: s.promptTokens + completion}
+}
+
+func (s *Stream) fail(err error) error {
+	outcome := err
+	if err == io.EOF {
+		outcome = nil
+	}
+	if panicErr := s.finish(outcome); panicErr != nil {
+		if err == io.EOF {
+			err = panicErr
+		} else {
+			err = errors.Join(err, panicErr)
+		}
+	}
+	s.err = err
+	return err
+}
+
+// finish runs the stream's response hooks and ends its metrics and span,
+// once, with the outcome err. It returns the error of a panicking response
+// hook.
+func (s *Stream) finish(err error) error {
+	if s.finished {
+		return nil
+	}
+	s.finished = true
+	var panicErr error
+	if s.hookReq != nil {
+		resp := &ReliAPIResponse{Success: err == nil, Meta: s.meta, IdempotencyKey: s.key}
+		panicErr = s.client.runResponseHooks(s.ctx, s.hookReq, resp, err)
+	}
+	s.instrument.end(&s.meta, joinHookPanic(err, panicErr))
+	return panicErr
+}
+
+// handle applies one SSE event. It returns a chunk for content events and
+// nil for metadata events.
+func (s *Stream) handle(event string, data []byte) (*ChatCompletionChunk, error) {
+	if bytes.Equal(data, []byte("[DONE]")) {
+		s.done = true
+		return nil, s.checkGap()
+	}
+
+	switch event {
+	case "meta":
+		var m streamMetaEvent
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("reliapi: decode meta event: %w", err)
+		}
+		s.meta.Target = m.Target
+		s.meta.Provider = m.Provider
+		s.meta.Model = m.Model
+		if m.RequestID != "" {
+			s.meta.RequestID = m.RequestID
+		}
+		s.meta.CostEstimateUSD = m.CostEstimateUSD
+		s.meta.CostPolicyApplied = m.CostPolicyApplied
+		s.meta.MaxTokensReduced = m.MaxTokensReduced != nil && *m.MaxTokensReduced
+		s.meta.OriginalMaxTokens = m.OriginalMaxTokens
+		s.meta.TargetVersion = m.TargetVersion
+		s.meta.TrimmedMessages = m.TrimmedMessages
+		s.meta.PromptTokensAfterTrim = m.PromptTokensAfterTrim
+		s.meta.RedactionsApplied = m.RedactionsApplied
+		s.meta.QueueWaitMs = m.QueueWaitMs
+		s.meta.ConcurrencyWaitMs = m.ConcurrencyWaitMs
+		s.meta.ResolvedTarget = m.ResolvedTarget
+		s.meta.ResolvedModel = m.ResolvedModel
+		s.meta.TemplateName = m.TemplateName
+		s.meta.TemplateVersion = m.TemplateVersion
+		s.meta.CacheKey = m.CacheKey
+		if m.FaultInjected != "" {
+			s.meta.FaultInjected = m.FaultInjected
+		}
+		if s.vault != nil {
+			s.meta.RedactionsApplied += s.vault.applied
+		}
+		return nil, nil
+
+	case "chunk":
+		var chunk struct {
+			ChatCompletionChunk
+			Index *int `json:"index"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return nil, fmt.Errorf("reliapi: decode chunk event: %w", err)
+		}
+		index := chunk.Index
+		if n, err := strconv.Atoi(s.eventID); index == nil && err == nil {
+			index = &n
+		}
+		if index == nil {
+			return &chunk.ChatCompletionChunk, nil
+		}
+		return s.sequence(*index, &chunk.ChatCompletionChunk)
+
+	case "done":
+		var d streamDoneEvent
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, fmt.Errorf("reliapi: decode done event: %w", err)
+		}
+		s.usage = d.Usage
+		s.meta.CostUSD = d.CostUSD
+		s.meta.CacheHit = d.CacheHit
+		s.meta.CacheStored = d.CacheStored
+		s.meta.CostEstimated = d.CostEstimated
+		s.done = true
+		return nil, s.checkGap()
+
+	case "error":
+		var e streamErrorEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, &APIError{Message: string(data), RequestID: s.meta.RequestID, Body: data}
+		}
+		return nil, &APIError{
+			StatusCode: e.UpstreamStatus,
+			Code:       e.Code,
+			Message:    e.Message,
+			RequestID:  s.meta.RequestID,
+			RetryAfter: time.Duration(e.RetryAfterS * float64(time.Second)),
+			Details:    e.Details,
+			Body:       data,
+		}
+
+	case "", "message":
+		var oc openAIStreamChunk
+		if err := json.Unmarshal(data, &oc); err != nil {
+			return nil, fmt.Errorf("reliapi: decode stream data: %w", err)
+		}
+		if oc.Usage != nil {
+			s.usage = *oc.Usage
+		}
+		if len(oc.Choices) == 0 {
+			return nil, nil
+		}
+		chunk := &ChatCompletionChunk{Delta: oc.Choices[0].Delta.Content, Logprobs: oc.Choices[0].Logprobs}
+		if fr := oc.Choices[0].FinishReason; fr != nil {
+			chunk.FinishReason = *fr
+		}
+		return chunk, nil
+	}
+	// Unknown event types are ignored for forward compatibility.
+	return nil, nil
+}
+
+// sequence places the chunk numbered index in the stream. It returns the
+// chunk when it is next in line, and nil when it is a duplicate or early.
+func (s *Stream) sequence(index int, chunk *ChatCompletionChunk) (*ChatCompletionChunk, error) {
+	if _, seen := s.pending[index]; seen || index < s.next {
+		s.stats.DuplicatesDropped++
+		return nil, nil
+	}
+	if index > s.next {
+		if s.pending == nil {
+			s.pending = make(map[int]*ChatCompletionChunk)
+		}
+		s.pending[index] = chunk
+		if len(s.pending) > s.window {
+			return nil, s.checkGap()
+		}
+		return nil, nil
+	}
+	s.next++
+	for {
+		early, ok := s.pending[s.next]
+		if !ok {
+			break
+		}
+		delete(s.pending, s.next)
+		s.ready = append(s.ready, early)
+		s.stats.Reordered++
+		s.next++
+	}
+	return chunk, nil
+}
+
+// checkGap returns a *StreamGapError if chunks are still awaited.
+func (s *Stream) checkGap() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	first := -1
+	for index := range s.pending {
+		if first < 0 || index < first {
+			first = index
+		}
+	}
+	return &StreamGapError{From: s.next, To: first - 1}
+}
+
+// readEvent reads one SSE event, joining multi-line data fields. The event's
+// id field is left in s.eventID.
+func (s *Stream) readEvent() (event string, data []byte, err error) {
+	var buf bytes.Buffer
+	haveData := false
+	s.eventID = ""
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if haveData || event != "" {
+				return event, buf.Bytes(), nil
+			}
+			if err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			// Comment line (": keep-alive").
+		case "event":
+			event = value
+		case "id":
+			s.eventID = value
+		case "data":
+			if haveData {
+				buf.WriteByte('\n')
+			}
+			buf.WriteString(value)
+			haveData = true
+		}
+
+		if err != nil {
+			// EOF without a trailing blank line: the event is incomplete.
+			return "", nil, err
+		}
+	}
+}
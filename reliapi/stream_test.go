@@ -0,0 +1,434 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sseHandler(t *testing.T, events []string, abort bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		if body["stream"] != true {
+			t.Errorf("stream flag not set: %v", body)
+		}
+		if got := r.Header.Get("Accept"); got != "text/event-stream" {
+			t.Errorf("Accept = %q", got)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("X-Request-ID", "req_stream")
+		flusher := w.(http.Flusher)
+		for _, ev := range events {
+			_, _ = io.WriteString(w, ev)
+			flusher.Flush()
+		}
+		if abort {
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+func collect(t *testing.T, s *Stream) (string, error) {
+	t.Helper()
+	var sb strings.Builder
+	for {
+		chunk, err := s.Recv()
+		if err != nil {
+			return sb.String(), err
+		}
+		sb.WriteString(chunk.Delta)
+	}
+}
+
+func TestProxyLLMStream(t *testing.T) {
+	events := []string{
+		"event: meta\ndata: {\"target\": \"openai\", \"provider\": \"openai\", \"model\": \"gpt-4o-mini\", \"request_id\": \"req_stream\", \"cost_estimate_usd\": 0.0001}\n\n",
+		": keep-alive\n\n",
+		"event: chunk\ndata: {\"delta\": \"Hel\", \"finish_reason\": null}\n\n",
+		"event: chunk\ndata: {\"delta\": \"lo\", \"finish_reason\": null}\n\n",
+		"event: done\ndata: {\"finish_reason\": \"stop\", \"usage\": {\"prompt_tokens\": 3, \"completion_tokens\": 2, \"total_tokens\": 5}, \"cost_usd\": 0.00002, \"cache_stored\": true}\n\n",
+	}
+	c := newTestClient(t, sseHandler(t, events, false))
+
+	s, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("hi")}})
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+
+	text, err := collect(t, s)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("err = %v, want io.EOF", err)
+	}
+	if text != "Hello" {
+		t.Errorf("text = %q", text)
+	}
+	meta := s.Meta()
+	if meta.Model != "gpt-4o-mini" || meta.RequestID != "req_stream" || !meta.CacheStored {
+		t.Errorf("meta = %+v", meta)
+	}
+	if meta.CostUSD == nil || *meta.CostUSD != 0.00002 {
+		t.Errorf("cost_usd = %v", meta.CostUSD)
+	}
+	if s.Usage().TotalTokens != 5 {
+		t.Errorf("usage = %+v", s.Usage())
+	}
+	if _, err := s.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("Recv after EOF = %v", err)
+	}
+}
+
+func TestProxyLLMStreamOpenAIFormat(t *testing.T) {
+	events := []string{
+		"data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"},\"finish_reason\":null}]}\n\n",
+		"data: {\"choices\":[{\"delta\":{\"content\":\" there\"},\"finish_reason\":\"stop\"}]}\n\n",
+		"data: [DONE]\n\n",
+	}
+	c := newTestClient(t, sseHandler(t, events, false))
+
+	s, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai"})
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+
+	text, err := collect(t, s)
+	if !errors.Is(err, io.EOF) || text != "Hi there" {
+		t.Fatalf("text = %q, err = %v", text, err)
+	}
+}
+
+func TestProxyLLMStreamSequencing(t *testing.T) {
+	chunk := func(index int, delta string) string {
+		return fmt.Sprintf("event: chunk\ndata: {\"index\": %d, \"delta\": %q}\n\n", index, delta)
+	}
+	// idChunk numbers the chunk only through the SSE id field.
+	idChunk := func(index int, delta string) string {
+		return fmt.Sprintf("id: %d\nevent: chunk\ndata: {\"delta\": %q}\n\n", index, delta)
+	}
+	done := "event: done\ndata: {\"finish_reason\": \"stop\", \"usage\": {\"prompt_tokens\": 3, \"completion_tokens\": 4, \"total_tokens\": 7}}\n\n"
+
+	tests := []struct {
+		name      string
+		events    []string
+		window    *int
+		wantText  string
+		wantStats StreamStats
+		wantGap   *StreamGapError
+	}{
+		{
+			name:     "in order",
+			events:   []string{chunk(0, "a"), chunk(1, "b"), chunk(2, "c"), done},
+			wantText: "abc",
+		},
+		{
+			name:      "duplicates",
+			events:    []string{chunk(0, "a"), chunk(0, "a"), chunk(1, "b"), chunk(1, "b"), chunk(0, "a"), chunk(2, "c"), done},
+			wantText:  "abc",
+			wantStats: StreamStats{DuplicatesDropped: 3},
+		},
+		{
+			name:      "swapped",
+			events:    []string{chunk(0, "a"), chunk(2, "c"), chunk(1, "b"), chunk(3, "d"), done},
+			wantText:  "abcd",
+			wantStats: StreamStats{Reordered: 1},
+		},
+		{
+			name:      "reordered within window",
+			events:    []string{chunk(2, "c"), chunk(1, "b"), chunk(0, "a"), done},
+			wantText:  "abc",
+			wantStats: StreamStats{Reordered: 2},
+		},
+		{
+			name:      "duplicate of a buffered chunk",
+			events:    []string{chunk(0, "a"), chunk(2, "c"), chunk(2, "c"), chunk(1, "b"), done},
+			wantText:  "abc",
+			wantStats: StreamStats{DuplicatesDropped: 1, Reordered: 1},
+		},
+		{
+			name:      "sse ids",
+			events:    []string{idChunk(0, "a"), idChunk(2, "c"), idChunk(1, "b"), idChunk(1, "b"), done},
+			wantText:  "abc",
+			wantStats: StreamStats{DuplicatesDropped: 1, Reordered: 1},
+		},
+		{
+			name:     "gap beyond window",
+			events:   []string{chunk(0, "a"), chunk(3, "d"), chunk(4, "e"), chunk(5, "f"), done},
+			wantText: "a",
+			wantGap:  &StreamGapError{From: 1, To: 2},
+		},
+		{
+			name:     "gap at end of stream",
+			events:   []string{chunk(0, "a"), chunk(2, "c"), done},
+			wantText: "a",
+			wantGap:  &StreamGapError{From: 1, To: 1},
+		},
+		{
+			name:     "window zero",
+			events:   []string{chunk(0, "a"), chunk(2, "c"), chunk(1, "b"), done},
+			window:   new(int),
+			wantText: "a",
+			wantGap:  &StreamGapError{From: 1, To: 1},
+		},
+		{
+			name:     "unnumbered chunks pass through",
+			events:   []string{"event: chunk\ndata: {\"delta\": \"x\"}\n\n", "event: chunk\ndata: {\"delta\": \"x\"}\n\n", done},
+			wantText: "xx",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.window != nil {
+				opts = append(opts, WithStreamReorderWindow(*tt.window))
+			}
+			c := newTestClient(t, sseHandler(t, tt.events, false), opts...)
+			s, err := c.ProxyLLMStream(context.Background(), llmReq("hi"))
+			if err != nil {
+				t.Fatalf("ProxyLLMStream: %v", err)
+			}
+			defer s.Close()
+
+			text, err := collect(t, s)
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+			if tt.wantGap != nil {
+				var gap *StreamGapError
+				if !errors.As(err, &gap) || !errors.Is(err, ErrStreamGap) || *gap != *tt.wantGap {
+					t.Fatalf("err = %v, want %v", err, tt.wantGap)
+				}
+				return
+			}
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("err = %v, want io.EOF", err)
+			}
+			if s.Stats() != tt.wantStats {
+				t.Errorf("stats = %+v, want %+v", s.Stats(), tt.wantStats)
+			}
+			// Usage comes from the done event, duplicates or not.
+			if s.Usage().CompletionTokens != 4 {
+				t.Errorf("usage = %+v", s.Usage())
+			}
+		})
+	}
+}
+
+func TestProxyLLMStreamErrorEvent(t *testing.T) {
+	events := []string{
+		"event: meta\ndata: {\"request_id\": \"req_stream\"}\n\n",
+		"event: chunk\ndata: {\"delta\": \"partial\"}\n\n",
+		"event: error\ndata: {\"code\": \"UPSTREAM_STREAM_INTERRUPTED\", \"message\": \"upstream closed\", \"upstream_status\": 502}\n\n",
+	}
+	c := newTestClient(t, sseHandler(t, events, false))
+
+	s, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai"})
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+
+	text, err := collect(t, s)
+	if text != "partial" {
+		t.Errorf("text = %q", text)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *APIError, got %v", err)
+	}
+	if apiErr.Code != "UPSTREAM_STREAM_INTERRUPTED" || apiErr.StatusCode != 502 || apiErr.RequestID != "req_stream" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestProxyLLMStreamQueueFull(t *testing.T) {
+	events := []string{
+		"event: error\ndata: {\"code\": \"QUEUE_FULL\", \"message\": \"No turn within 500 ms\", \"upstream_status\": 429, \"retry_after_s\": 0.25}\n\n",
+	}
+	c := newTestClient(t, sseHandler(t, events, false))
+
+	s, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai", Priority: PriorityBatch, QueueTimeoutMs: 500})
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+
+	_, err = collect(t, s)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeQueueFull || apiErr.RetryAfter != 250*time.Millisecond || !IsRetriable(err) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestProxyLLMStreamCacheReplay(t *testing.T) {
+	events := []string{
+		"event: meta\ndata: {\"target\": \"openai\", \"model\": \"gpt-4o-mini\", \"request_id\": \"req_stream\", \"cache_key\": \"abc\"}\n\n",
+		"id: 0\nevent: chunk\ndata: {\"index\": 0, \"delta\": \"one two\", \"finish_reason\": null}\n\n",
+		"id: 1\nevent: chunk\ndata: {\"index\": 1, \"delta\": \" three\", \"finish_reason\": null}\n\n",
+		"event: done\ndata: {\"finish_reason\": \"stop\", \"usage\": {\"prompt_tokens\": 3, \"completion_tokens\": 3, \"total_tokens\": 6}, \"cost_usd\": 0.0, \"cache_hit\": true}\n\n",
+	}
+	c := newTestClient(t, sseHandler(t, events, false))
+
+	s, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("hi")}})
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+
+	text, err := collect(t, s)
+	if !errors.Is(err, io.EOF) || text != "one two three" {
+		t.Fatalf("text = %q, err = %v", text, err)
+	}
+	meta := s.Meta()
+	if !meta.CacheHit || meta.CacheKey != "abc" || meta.CostUSD == nil || *meta.CostUSD != 0 {
+		t.Errorf("meta = %+v", meta)
+	}
+	if s.Usage().TotalTokens != 6 {
+		t.Errorf("usage = %+v", s.Usage())
+	}
+}
+
+func TestProxyLLMStreamCostEstimated(t *testing.T) {
+	events := []string{
+		"event: meta\ndata: {\"target\": \"openai\", \"model\": \"gpt-4o-mini\"}\n\n",
+		"event: chunk\ndata: {\"delta\": \"Hi\", \"finish_reason\": null}\n\n",
+		"event: done\ndata: {\"finish_reason\": \"stop\", \"usage\": {\"prompt_tokens\": 8, \"completion_tokens\": 1, \"total_tokens\": 9}, \"cost_usd\": 0.00001, \"cost_estimated\": true}\n\n",
+	}
+	c := newTestClient(t, sseHandler(t, events, false))
+
+	s, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("hi")}})
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := collect(t, s); !errors.Is(err, io.EOF) {
+		t.Fatalf("err = %v, want io.EOF", err)
+	}
+	if meta := s.Meta(); !meta.CostEstimated || meta.Aborted || meta.CostUSD == nil {
+		t.Errorf("meta = %+v", meta)
+	}
+	if s.Usage().TotalTokens != 9 {
+		t.Errorf("usage = %+v", s.Usage())
+	}
+}
+
+func TestProxyLLMStreamAborted(t *testing.T) {
+	events := []string{
+		"event: meta\ndata: {\"target\": \"openai\", \"model\": \"gpt-4o-mini\"}\n\n",
+		"event: chunk\ndata: {\"delta\": \"The capital is\", \"finish_reason\": null}\n\n",
+	}
+	c := newTestClient(t, sseHandler(t, events, false))
+	messages := []ChatMessage{UserMessage("What is the capital of France?")}
+
+	s, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai", Messages: messages})
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	if _, err := s.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if meta := s.Meta(); !meta.Aborted || !meta.CostEstimated {
+		t.Errorf("meta = %+v", meta)
+	}
+	prompt, _ := CountTokens("", messages)
+	if u := s.Usage(); u.PromptTokens != prompt || u.CompletionTokens != 3 || u.TotalTokens != prompt+3 {
+		t.Errorf("usage = %+v, want %d prompt and 3 completion tokens", u, prompt)
+	}
+}
+
+func TestProxyLLMStreamConnectionDrop(t *testing.T) {
+	events := []string{
+		"event: chunk\ndata: {\"delta\": \"one\"}\n\n",
+		"event: chunk\ndata: {\"delta\": \"tw",
+	}
+	c := newTestClient(t, sseHandler(t, events, true))
+
+	s, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai"})
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+
+	text, err := collect(t, s)
+	if text != "one" {
+		t.Errorf("text = %q", text)
+	}
+	if !errors.Is(err, ErrStreamInterrupted) {
+		t.Fatalf("err = %v, want ErrStreamInterrupted", err)
+	}
+}
+
+func TestProxyLLMStreamRejectedBeforeStart(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"detail": map[string]interface{}{
+				"type":    "free_tier_restriction",
+				"code":    "FEATURE_NOT_AVAILABLE",
+				"message": "SSE streaming not available for Free tier.",
+			},
+		})
+	})
+
+	_, err := c.ProxyLLMStream(context.Background(), LLMRequest{Target: "openai"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 403 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !strings.Contains(apiErr.Error(), fmt.Sprint(403)) {
+		t.Errorf("Error() = %q", apiErr.Error())
+	}
+}
+
+func TestProxyLLMStreamStopsOnCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "event: chunk\ndata: {\"delta\": \"first\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-release // never send the next chunk
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := c.ProxyLLMStream(ctx, LLMRequest{Target: "openai"})
+	if err != nil {
+		t.Fatalf("ProxyLLMStream: %v", err)
+	}
+	defer s.Close()
+
+	if chunk, err := s.Recv(); err != nil || chunk.Delta != "first" {
+		t.Fatalf("first Recv = %v, %v", chunk, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Recv()
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Recv did not return after cancel")
+	}
+}
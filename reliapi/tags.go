@@ -0,0 +1,55 @@
+package reliapi
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Bounds of a request's tags, as the proxy enforces them.
+const (
+	MaxTags           = 10
+	maxTagKeyLen      = 64
+	maxTagValueLength = 128
+)
+
+// WithTags sets tags every LLM and HTTP request is attributed to, such as
+// the service making them. A request's own Tags win over them key by key.
+func WithTags(tags map[string]string) Option {
+	return func(c *Client) {
+		c.tags = maps.Clone(tags)
+	}
+}
+
+// withTags returns tags merged over the client's WithTags, checked against
+// the proxy's bounds.
+func (c *Client) withTags(tags map[string]string) (map[string]string, error) {
+	if len(c.tags) > 0 {
+		merged := maps.Clone(c.tags)
+		maps.Copy(merged, tags)
+		tags = merged
+	}
+	if len(tags) > MaxTags {
+		return nil, fmt.Errorf("reliapi: %d tags, at most %d are allowed", len(tags), MaxTags)
+	}
+	for key, value := range tags {
+		if !validTagKey(key) {
+			return nil, fmt.Errorf("reliapi: tag key %q must be 1 to %d letters, digits, '_' or '-'", key, maxTagKeyLen)
+		}
+		if value == "" || len([]rune(value)) > maxTagValueLength {
+			return nil, fmt.Errorf("reliapi: tag %q must have a value of 1 to %d characters", key, maxTagValueLength)
+		}
+	}
+	return tags, nil
+}
+
+func validTagKey(key string) bool {
+	if key == "" || len(key) > maxTagKeyLen {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
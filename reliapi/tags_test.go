@@ -0,0 +1,90 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	var sent []map[string]string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Tags map[string]string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		sent = append(sent, body.Tags)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true, "data": map[string]interface{}{},
+			"meta": map[string]interface{}{"tags": body.Tags},
+		})
+	}, WithTags(map[string]string{"service": "web", "feature": "default"}))
+
+	ctx := context.Background()
+	req := llmReq("hi")
+	req.Tags = map[string]string{"feature": "search"}
+	resp, err := c.ProxyLLM(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta.Tags["service"] != "web" || resp.Meta.Tags["feature"] != "search" {
+		t.Errorf("Meta.Tags = %v", resp.Meta.Tags)
+	}
+	if req.Tags["service"] != "" {
+		t.Error("the caller's tags were changed")
+	}
+	if _, err := c.ProxyHTTP(ctx, HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 || len(sent[1]) != 2 || sent[1]["feature"] != "default" {
+		t.Errorf("sent tags = %v", sent)
+	}
+
+	tooMany := map[string]string{}
+	for _, k := range strings.Split("a b c d e f g h i", " ") {
+		tooMany[k] = "x"
+	}
+	for _, bad := range []map[string]string{
+		tooMany,
+		{"has space": "x"},
+		{strings.Repeat("k", 65): "x"},
+		{"empty": ""},
+		{"long": strings.Repeat("é", 129)},
+	} {
+		req := llmReq("hi")
+		req.Tags = bad
+		if _, err := c.ProxyLLM(ctx, req); err == nil {
+			t.Errorf("tags %v accepted", bad)
+		}
+	}
+	if len(sent) != 2 {
+		t.Errorf("invalid tags were sent: %v", sent[2:])
+	}
+}
+
+func TestUsageByTag(t *testing.T) {
+	c := newTestClient(t, usagePages(t, map[string]map[string]interface{}{
+		"": usagePage(nil,
+			map[string]interface{}{"tag.feature": "search", "tag.team": nil, "requests": 2},
+			map[string]interface{}{"tag.feature": nil, "tag.team": nil, "requests": 1},
+		),
+	}))
+
+	got, err := c.Usage(context.Background(), UsageQuery{GroupBy: []string{UsageByTag("feature"), UsageByTag("team")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Rows) != 2 {
+		t.Fatalf("rows = %+v", got.Rows)
+	}
+	if tags := got.Rows[0].Tags; len(tags) != 1 || tags["feature"] != "search" || got.Rows[0].Requests != 2 {
+		t.Errorf("row 0 = %+v", got.Rows[0])
+	}
+	if got.Rows[1].Tags != nil {
+		t.Errorf("row 1 tags = %v", got.Rows[1].Tags)
+	}
+}
@@ -0,0 +1,441 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const targetsPath = "/v1/targets"
+
+// TargetConfig is the configuration of an upstream target
+// (config/schema.py TargetConfig). Zero fields take the proxy's defaults.
+type TargetConfig struct {
+	BaseURL   string `json:"base_url"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+	// MaxTimeoutMs is the largest LLMRequest.TimeoutMs or
+	// HTTPRequest.TimeoutMs the proxy accepts for the target; 0 means
+	// MaxTimeoutMs (300000).
+	MaxTimeoutMs int `json:"max_timeout_ms,omitempty"`
+	// IdempotencyMaxTTLSeconds is the largest IdempotencyTTL the proxy
+	// accepts for the target; 0 means 7 days.
+	IdempotencyMaxTTLSeconds int `json:"idempotency_max_ttl_s,omitempty"`
+	// MaxResponseBytes is the default HTTPRequest.MaxResponseBytes; 0
+	// means unlimited.
+	MaxResponseBytes int            `json:"max_response_bytes,omitempty"`
+	Circuit          *TargetCircuit `json:"circuit,omitempty"`
+	Cache            *TargetCache   `json:"cache,omitempty"`
+	LLM              *TargetLLM     `json:"llm,omitempty"`
+	Auth             *TargetAuth    `json:"auth,omitempty"`
+	// RetryMatrix holds the retry policy per error class ("429", "5xx",
+	// "net", ...).
+	RetryMatrix         map[string]TargetRetryPolicy `json:"retry_matrix,omitempty"`
+	ForwardTraceContext bool                         `json:"forward_trace_context,omitempty"`
+	// AllowedMethods restricts the methods ProxyHTTP may use against the
+	// target; nil allows any. Other calls fail with CodeNotAllowed.
+	AllowedMethods []string `json:"allowed_methods,omitempty"`
+	// AllowedPaths restricts the paths ProxyHTTP may call to those matching
+	// one of these shell patterns ("/v1/*"); nil allows any.
+	AllowedPaths []string `json:"allowed_paths,omitempty"`
+	// AllowPrivateNetwork lets BaseURL resolve to a private, loopback or
+	// link-local address, which UpsertTarget otherwise rejects.
+	AllowPrivateNetwork bool `json:"allow_private_network,omitempty"`
+	// FollowRedirects makes ProxyHTTP follow upstream redirects, up to
+	// MaxRedirects (default 5). The target's auth header is not sent to
+	// another origin, and redirects into a private network are only
+	// followed with AllowPrivateNetwork.
+	FollowRedirects bool `json:"follow_redirects,omitempty"`
+	MaxRedirects    *int `json:"max_redirects,omitempty"`
+	// Redaction hides sensitive values in prompts sent to the target.
+	Redaction *TargetRedaction `json:"redaction,omitempty"`
+	// Audit sets what the proxy records of requests to the target (see
+	// AuditRecord).
+	Audit *TargetAudit `json:"audit,omitempty"`
+	// Queue gives the target a rate budget for LLM requests, queueing
+	// those over it by LLMRequest.Priority.
+	Queue *TargetQueue `json:"queue,omitempty"`
+	// MaxConcurrency caps the LLM requests in flight to the target at once;
+	// 0 means unlimited. Requests over it wait up to ConcurrencyWaitMs
+	// (default 10000), or their LLMRequest.MaxWaitMs, for a slot.
+	MaxConcurrency    int `json:"max_concurrency,omitempty"`
+	ConcurrencyWaitMs int `json:"concurrency_wait_ms,omitempty"`
+	// ModelAliases maps model names callers may use as LLMRequest.Model
+	// to the target and model that serve them.
+	ModelAliases map[string]ModelAlias `json:"model_aliases,omitempty"`
+
+	// Credentials are named API keys the proxy rotates across by weight,
+	// in place of Auth's key; see TargetCredential.
+	Credentials []TargetCredential `json:"credentials,omitempty"`
+}
+
+// ModelAlias is where the proxy sends requests for a model alias: to Model
+// on Target (empty for the target defining the alias), or split between
+// variants by percentage for a gradual rollout. A request's variant is
+// picked from its IdempotencyKey, so retries land on the same one.
+type ModelAlias struct {
+	Target string `json:"target,omitempty"`
+	Model  string `json:"model,omitempty"`
+	// Split's weights must add up to 100.
+	Split []ModelAliasVariant `json:"split,omitempty"`
+}
+
+// ModelAliasVariant is a share of a ModelAlias's requests. An empty
+// Target is the alias's.
+type ModelAliasVariant struct {
+	Target string  `json:"target,omitempty"`
+	Model  string  `json:"model"`
+	Weight float64 `json:"weight"`
+}
+
+// TargetCircuit configures a target's circuit breaker.
+type TargetCircuit struct {
+	ErrorThreshold  int `json:"error_threshold,omitempty"`
+	CooldownSeconds int `json:"cooldown_s,omitempty"`
+	// Scope is what failures are counted per: CircuitScopeTarget, the
+	// default, CircuitScopeModel or CircuitScopeCredential.
+	Scope string `json:"scope,omitempty"`
+}
+
+// TargetCache configures how a target's responses are cached.
+type TargetCache struct {
+	// Enabled defaults to true.
+	Enabled         *bool `json:"enabled,omitempty"`
+	TTLSeconds      int   `json:"ttl_s,omitempty"`
+	StaleTTLSeconds int   `json:"stale_ttl_s,omitempty"`
+}
+
+// ProviderAzureOpenAI is the TargetLLM.Provider of an Azure OpenAI
+// resource; see TargetAzureOpenAI.
+const ProviderAzureOpenAI = "azure_openai"
+
+// TargetLLM configures an LLM target.
+type TargetLLM struct {
+	Provider       string   `json:"provider,omitempty"`
+	DefaultModel   string   `json:"default_model,omitempty"`
+	MaxTokens      int      `json:"max_tokens,omitempty"`
+	Temperature    *float64 `json:"temperature,omitempty"`
+	SoftCostCapUSD *float64 `json:"soft_cost_cap_usd,omitempty"`
+	HardCostCapUSD *float64 `json:"hard_cost_cap_usd,omitempty"`
+	// Azure is required with ProviderAzureOpenAI.
+	Azure *TargetAzureOpenAI `json:"azure,omitempty"`
+}
+
+// TargetAzureOpenAI configures a ProviderAzureOpenAI target, whose
+// BaseURL is the resource endpoint, e.g. "https://myres.openai.azure.com".
+// Requests use LLMRequest.Model as usual; the proxy sends them to the
+// model's deployment, with APIVersion as the api-version parameter.
+// A model without a deployment fails with CodeBadRequest, the error's
+// Details listing the models that have one. Unless its TargetAuth names
+// another header, the key is sent as Azure's api-key header.
+type TargetAzureOpenAI struct {
+	APIVersion string `json:"api_version"`
+	// Deployments maps model names to their deployment's name.
+	Deployments map[string]string `json:"deployments"`
+}
+
+// TargetRedaction configures the redaction of prompts sent to a target:
+// matches are replaced with placeholders such as "[EMAIL_1]" before the
+// prompt is cached or sent, and stay in the response. Use WithRedactor to
+// have the values restored instead.
+type TargetRedaction struct {
+	// Enabled defaults to true.
+	Enabled *bool `json:"enabled,omitempty"`
+	// Patterns lists the built-in patterns to apply, of "email", "phone"
+	// and "credit_card"; nil applies all three.
+	Patterns []string `json:"patterns,omitempty"`
+	// CustomPatterns are extra regular expressions by placeholder kind.
+	CustomPatterns map[string]string `json:"custom_patterns,omitempty"`
+	// ShareCacheEntries lets requests differing only in redacted values
+	// share a cache entry.
+	ShareCacheEntries bool `json:"share_cache_entries,omitempty"`
+}
+
+// Audit capture levels of TargetAudit.Capture.
+const (
+	AuditCaptureOff      = "off"
+	AuditCaptureMetadata = "metadata"
+	AuditCaptureFull     = "full"
+)
+
+// TargetAudit configures the audit records of a target's requests.
+type TargetAudit struct {
+	// Capture is AuditCaptureOff (the default), AuditCaptureMetadata or
+	// AuditCaptureFull, which also keeps the bodies of every attempt.
+	Capture string `json:"capture,omitempty"`
+	// MaxBodyBytes caps each body kept under AuditCaptureFull; 0 means
+	// 64 KiB.
+	MaxBodyBytes int `json:"max_body_bytes,omitempty"`
+}
+
+// TargetQueue configures a target's rate budget and the queue of LLM
+// requests waiting for it.
+type TargetQueue struct {
+	// MaxQPS is how many LLM requests per second the proxy sends to the
+	// target; up to a second's worth may go at once.
+	MaxQPS float64 `json:"max_qps"`
+	// MaxQueue is the most requests waiting; 0 means 100.
+	MaxQueue int `json:"max_queue,omitempty"`
+	// TimeoutMs is how long a request waits unless it sets
+	// LLMRequest.QueueTimeoutMs; 0 means 10000.
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+}
+
+// TargetAuth is the template of the auth header the proxy adds to a
+// target's requests: Header is set to Prefix followed by the value of the
+// proxy's EnvVar environment variable. The key itself never leaves the proxy.
+type TargetAuth struct {
+	// Type is "bearer_env" or "api_key".
+	Type   string `json:"type"`
+	EnvVar string `json:"env_var,omitempty"`
+	Header string `json:"header,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// TargetRetryPolicy is the retry policy of one error class.
+type TargetRetryPolicy struct {
+	Attempts    int     `json:"attempts,omitempty"`
+	Backoff     string  `json:"backoff,omitempty"`
+	BaseSeconds float64 `json:"base_s,omitempty"`
+	MaxSeconds  float64 `json:"max_s,omitempty"`
+}
+
+// Target is a target registered with the proxy.
+type Target struct {
+	Name string `json:"name"`
+	// Version starts at 1 and grows with every UpsertTarget of the target.
+	// Meta.TargetVersion reports the version a request ran with.
+	Version int          `json:"version"`
+	Config  TargetConfig `json:"config"`
+}
+
+// ListTargets returns the proxy's targets, sorted by name. Like
+// UpsertTarget and DeleteTarget, it requires the proxy's admin key
+// (RELIAPI_ADMIN_KEY); other keys get a 403 *APIError with CodeForbidden.
+func (c *Client) ListTargets(ctx context.Context) ([]Target, error) {
+	var out struct {
+		Targets []Target `json:"targets"`
+	}
+	if err := c.targets(ctx, http.MethodGet, targetsPath, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Targets, nil
+}
+
+// UpsertTarget registers a target, or replaces the whole config of an
+// existing one, and returns it with its new version. The proxy rejects a
+// BaseURL on a private network unless cfg.AllowPrivateNetwork is set, with
+// a 400 *APIError with CodeInvalidTarget.
+//
+// Requests already in flight finish with the config they started with.
+// Changes live in the proxy's memory and are lost when it restarts.
+func (c *Client) UpsertTarget(ctx context.Context, name string, cfg TargetConfig) (*Target, error) {
+	if name == "" {
+		return nil, errors.New("reliapi: target name is required")
+	}
+	if cfg.BaseURL == "" {
+		return nil, errors.New("reliapi: target base URL is required")
+	}
+	var out Target
+	if err := c.targets(ctx, http.MethodPut, targetPath(name), cfg, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteTarget removes a target. New requests for it fail with
+// CodeNotFound; requests already in flight finish normally. Deleting an
+// unknown target is a 404 *APIError with CodeNotFound.
+func (c *Client) DeleteTarget(ctx context.Context, name string) error {
+	if name == "" {
+		return errors.New("reliapi: target name is required")
+	}
+	return c.targets(ctx, http.MethodDelete, targetPath(name), nil, nil)
+}
+
+// TargetStats is a snapshot of the LLM requests to a target on the proxy
+// instance that answered.
+type TargetStats struct {
+	Target string `json:"target"`
+	// MaxConcurrency is the target's limit, nil when unlimited.
+	MaxConcurrency *int `json:"max_concurrency"`
+	// InFlight counts the requests being sent or streamed now.
+	InFlight int `json:"in_flight"`
+	// Waiting counts the requests waiting for a slot, Queued those waiting
+	// for a turn under the target's rate budget.
+	Waiting int `json:"waiting"`
+	Queued  int `json:"queued"`
+	// Rejected counts the requests that failed with CONCURRENCY_LIMIT
+	// since the proxy started.
+	Rejected int `json:"rejected"`
+}
+
+// TargetStats returns the requests in flight to target and waiting for it.
+// Any API key may read them; an unknown target is a 404 *APIError with
+// CodeNotFound.
+func (c *Client) TargetStats(ctx context.Context, target string) (*TargetStats, error) {
+	if target == "" {
+		return nil, errors.New("reliapi: target is required")
+	}
+	var out TargetStats
+	if err := c.targets(ctx, http.MethodGet, targetPath(target)+"/stats", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LatencyRouteStats is the latency table of a latency route on the proxy
+// instance that answered.
+type LatencyRouteStats struct {
+	Route string `json:"route"`
+	// Metric is the latency candidates are weighted by, "p50" or "p95".
+	Metric string `json:"metric"`
+	// Exploration is the fraction of requests sent to a random healthy
+	// candidate, so a recovered one is noticed.
+	Exploration float64                 `json:"exploration"`
+	Candidates  []LatencyRouteCandidate `json:"candidates"`
+}
+
+// LatencyRouteCandidate is a target of a latency route and how it fares.
+type LatencyRouteCandidate struct {
+	Target string `json:"target"`
+	// Model is sent to the target instead of the request's; empty if not.
+	Model string `json:"model"`
+	// Healthy reports that the target exists and its circuit is closed.
+	Healthy bool `json:"healthy"`
+	// Samples counts the latest upstream attempts measured, of which P50Ms
+	// and P95Ms are the percentiles; nil while there are too few.
+	Samples int      `json:"samples"`
+	P50Ms   *float64 `json:"p50_ms"`
+	P95Ms   *float64 `json:"p95_ms"`
+	// Share is the fraction of the route's requests the candidate gets as
+	// things stand, Routed the requests it got since the proxy started.
+	Share  float64 `json:"share"`
+	Routed int     `json:"routed"`
+}
+
+// LatencyRouteStats returns the latency table of route, with or without
+// LatencyRoutePrefix. Any API key may read it; an unknown route is a 404
+// *APIError with CodeNotFound.
+func (c *Client) LatencyRouteStats(ctx context.Context, route string) (*LatencyRouteStats, error) {
+	route = strings.TrimPrefix(route, LatencyRoutePrefix)
+	if route == "" {
+		return nil, errors.New("reliapi: route is required")
+	}
+	var out LatencyRouteStats
+	if err := c.targets(ctx, http.MethodGet, targetPath(LatencyRoutePrefix+route)+"/stats", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Target check statuses reported by TargetCheck.Status.
+const (
+	CheckOK          = "ok"
+	CheckAuthFailed  = "auth_failed"
+	CheckDegraded    = "degraded"
+	CheckUnreachable = "unreachable"
+)
+
+// TargetCheck is the result of probing a target's upstream with its
+// credentials: GET /models for LLM targets, HEAD on the base URL otherwise.
+type TargetCheck struct {
+	Target string `json:"target"`
+	// Status is one of the Check* constants: CheckAuthFailed for a 401 or
+	// 403, CheckDegraded for a 5xx.
+	Status     string `json:"status"`
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	StatusCode *int   `json:"status_code"`
+	LatencyMs  *int   `json:"latency_ms"`
+	// TLSExpiresAt is when the upstream's certificate expires; nil for
+	// plain HTTP targets or when the TLS check failed (see Error).
+	TLSExpiresAt     *time.Time `json:"tls_expires_at"`
+	TLSDaysRemaining *int       `json:"tls_days_remaining"`
+	Error            string     `json:"error"`
+	CheckedAt        time.Time  `json:"checked_at"`
+	// Cached reports that the proxy reused its last probe of the target,
+	// made less than 30 seconds before.
+	Cached bool `json:"cached"`
+}
+
+// CheckTarget probes target's upstream from the proxy. The probe bypasses
+// the cache, budgets and usage, and does not affect the circuit breaker.
+// Any API key may check a target; an unknown target is a 404 *APIError
+// with CodeNotFound.
+func (c *Client) CheckTarget(ctx context.Context, target string) (*TargetCheck, error) {
+	if target == "" {
+		return nil, errors.New("reliapi: target is required")
+	}
+	var out TargetCheck
+	if err := c.targets(ctx, http.MethodGet, targetPath(target)+"/check", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TargetRateLimit is the rate limit target's upstream last reported to one
+// of its credentials.
+type TargetRateLimit struct {
+	// Credential names the target's named credential or key pool key the
+	// limit applies to; empty when the target authenticates otherwise.
+	Credential string `json:"credential"`
+	// Limit is the requests allowed per window, nil if not reported.
+	Limit     *int      `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RateLimit returns the rate limits target's upstream last reported, one
+// per credential, as the proxy paces requests by them; empty until the
+// upstream has answered with rate limit headers. Limits are per proxy
+// instance. Any API key may read them; an unknown target is a 404
+// *APIError with CodeNotFound.
+func (c *Client) RateLimit(ctx context.Context, target string) ([]TargetRateLimit, error) {
+	if target == "" {
+		return nil, errors.New("reliapi: target is required")
+	}
+	var out struct {
+		Limits []TargetRateLimit `json:"limits"`
+	}
+	if err := c.targets(ctx, http.MethodGet, targetPath(target)+"/ratelimit", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Limits, nil
+}
+
+func targetPath(name string) string {
+	return targetsPath + "/" + url.PathEscape(name)
+}
+
+// targets sends a target management request and decodes its data into out.
+// Listing, replacing and deleting a target are all idempotent, so they may
+// be retried.
+func (c *Client) targets(ctx context.Context, method, path string, body, out interface{}) error {
+	resp, raw, err := c.do(ctx, method, path, body, true)
+	if err != nil {
+		return err
+	}
+	var envelope struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !envelope.Success {
+		return newAPIError(resp, raw)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	return nil
+}
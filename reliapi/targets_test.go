@@ -0,0 +1,279 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUpsertTarget(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.EscapedPath() != "/v1/targets/my%20api" {
+			t.Errorf("%s %s", r.Method, r.URL.EscapedPath())
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{
+			"base_url":        "https://api.example.com",
+			"cache":           map[string]interface{}{"ttl_s": 60.0},
+			"allowed_methods": []interface{}{"GET"},
+		}
+		if !reflect.DeepEqual(body, want) {
+			t.Errorf("body = %v, want %v", body, want)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"name": "my api", "version": 2, "created": false,
+				"config": map[string]interface{}{"base_url": "https://api.example.com", "cache": map[string]interface{}{"enabled": true, "ttl_s": 60}},
+			},
+			"meta": map[string]interface{}{"request_id": "req_t", "target_version": 2},
+		})
+	})
+
+	got, err := c.UpsertTarget(context.Background(), "my api", TargetConfig{
+		BaseURL:        "https://api.example.com",
+		Cache:          &TargetCache{TTLSeconds: 60},
+		AllowedMethods: []string{"GET"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "my api" || got.Version != 2 || got.Config.Cache.TTLSeconds != 60 || !*got.Config.Cache.Enabled {
+		t.Errorf("target = %+v", got)
+	}
+	if _, err := c.UpsertTarget(context.Background(), "x", TargetConfig{}); err == nil {
+		t.Error("expected an error for a config without a base URL")
+	}
+}
+
+func TestUpsertTargetRejected(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"detail": map[string]interface{}{
+				"success": false,
+				"error": map[string]interface{}{
+					"type": "client_error", "code": "INVALID_TARGET", "status_code": 400,
+					"message": "base_url host '10.0.0.5' resolves to private address 10.0.0.5",
+				},
+			},
+		})
+	})
+	_, err := c.UpsertTarget(context.Background(), "internal", TargetConfig{BaseURL: "http://10.0.0.5"})
+	if !hasCode(err, CodeInvalidTarget) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestListAndDeleteTargets(t *testing.T) {
+	var deleted string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Path != "/v1/targets" {
+				t.Errorf("GET %s", r.URL.Path)
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"success": true,
+				"data": map[string]interface{}{"targets": []map[string]interface{}{
+					{"name": "a", "version": 1, "config": map[string]interface{}{"base_url": "https://a.example.com"}},
+					{"name": "b", "version": 3, "config": map[string]interface{}{"base_url": "https://b.example.com", "allow_private_network": true}},
+				}},
+				"meta": map[string]interface{}{"request_id": "req_l"},
+			})
+		case http.MethodDelete:
+			deleted = r.URL.Path
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"success": true,
+				"data":    map[string]interface{}{"name": "a", "version": 1, "deleted": true},
+				"meta":    map[string]interface{}{"request_id": "req_d"},
+			})
+		}
+	})
+
+	targets, err := c.ListTargets(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || targets[1].Name != "b" || targets[1].Version != 3 || !targets[1].Config.AllowPrivateNetwork {
+		t.Errorf("targets = %+v", targets)
+	}
+	if err := c.DeleteTarget(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if deleted != "/v1/targets/a" {
+		t.Errorf("DELETE %s", deleted)
+	}
+	if err := c.DeleteTarget(context.Background(), ""); err == nil {
+		t.Error("expected an error for an empty name")
+	}
+}
+
+func TestMetaTargetVersion(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"status_code": 200},
+			"meta":    map[string]interface{}{"request_id": "req_v", "target_version": 4},
+		})
+	})
+	resp, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: "GET", Path: "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta.TargetVersion != 4 {
+		t.Errorf("TargetVersion = %d", resp.Meta.TargetVersion)
+	}
+
+	c = newTestClient(t, sseHandler(t, []string{
+		"event: meta\ndata: {\"target\": \"openai\", \"request_id\": \"req_s\", \"target_version\": 7}\n\n",
+		"event: done\ndata: {\"finish_reason\": \"stop\"}\n\n",
+	}, false))
+	s, err := c.ProxyLLMStream(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := collect(t, s); !errors.Is(err, io.EOF) {
+		t.Fatal(err)
+	}
+	if s.Meta().TargetVersion != 7 {
+		t.Errorf("stream TargetVersion = %d", s.Meta().TargetVersion)
+	}
+}
+
+func TestTargetStats(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/targets/openai/stats" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"target": "openai", "max_concurrency": 8, "in_flight": 8, "waiting": 3, "queued": 0, "rejected": 2,
+			},
+			"meta": map[string]interface{}{"request_id": "req_st", "target": "openai"},
+		})
+	})
+	stats, err := c.TargetStats(context.Background(), "openai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.MaxConcurrency == nil || *stats.MaxConcurrency != 8 || stats.InFlight != 8 || stats.Waiting != 3 || stats.Rejected != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if _, err := c.TargetStats(context.Background(), ""); err == nil {
+		t.Error("expected an error for an empty target")
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/targets/openai/check" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"target": "openai", "status": "auth_failed", "method": "GET", "url": "https://api.openai.com/v1/models",
+				"status_code": 401, "latency_ms": 84, "tls_expires_at": "2027-01-15T23:59:59+00:00", "tls_days_remaining": 93,
+				"error": nil, "checked_at": "2026-10-14T12:00:00+00:00", "cached": true,
+			},
+			"meta": map[string]interface{}{"request_id": "req_chk", "target": "openai"},
+		})
+	})
+	check, err := c.CheckTarget(context.Background(), "openai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Status != CheckAuthFailed || check.StatusCode == nil || *check.StatusCode != 401 || !check.Cached {
+		t.Errorf("check = %+v", check)
+	}
+	if check.TLSExpiresAt == nil || check.TLSExpiresAt.Year() != 2027 || *check.TLSDaysRemaining != 93 {
+		t.Errorf("TLS = %v, %v", check.TLSExpiresAt, check.TLSDaysRemaining)
+	}
+	if _, err := c.CheckTarget(context.Background(), ""); err == nil {
+		t.Error("expected an error for an empty target")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/targets/openai/ratelimit" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"target": "openai",
+				"limits": []map[string]interface{}{{
+					"credential": "org-a", "limit": 10, "remaining": 0,
+					"reset_at": "2026-10-14T12:01:00+00:00", "updated_at": "2026-10-14T12:00:00.250000+00:00",
+				}},
+			},
+			"meta": map[string]interface{}{"request_id": "req_rl", "target": "openai"},
+		})
+	})
+	limits, err := c.RateLimit(context.Background(), "openai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limits) != 1 || limits[0].Credential != "org-a" || limits[0].Limit == nil || *limits[0].Limit != 10 ||
+		limits[0].Remaining != 0 || limits[0].ResetAt.Sub(limits[0].UpdatedAt) != 59750*time.Millisecond {
+		t.Errorf("limits = %+v", limits)
+	}
+	if _, err := c.RateLimit(context.Background(), ""); err == nil {
+		t.Error("expected an error for an empty target")
+	}
+}
+
+func TestLatencyRouteStats(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/targets/auto:gpt-4o-mini/stats" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"route": "auto:gpt-4o-mini", "metric": "p50", "exploration": 0.05,
+				"candidates": []interface{}{
+					map[string]interface{}{
+						"target": "openai", "model": nil, "healthy": true, "samples": 100,
+						"p50_ms": 420.5, "p95_ms": 910.0, "share": 0.6833, "routed": 812,
+					},
+					map[string]interface{}{
+						"target": "azure", "model": "gpt-4o-mini-eu", "healthy": false, "samples": 3,
+						"p50_ms": nil, "p95_ms": nil, "share": 0, "routed": 40,
+					},
+				},
+			},
+			"meta": map[string]interface{}{"request_id": "req_rs", "target": "auto:gpt-4o-mini"},
+		})
+	})
+	for _, route := range []string{"auto:gpt-4o-mini", "gpt-4o-mini"} {
+		stats, err := c.LatencyRouteStats(context.Background(), route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats.Candidates) != 2 || stats.Metric != "p50" {
+			t.Fatalf("stats = %+v", stats)
+		}
+		fast, down := stats.Candidates[0], stats.Candidates[1]
+		if fast.P50Ms == nil || *fast.P50Ms != 420.5 || fast.Model != "" || !fast.Healthy || fast.Routed != 812 {
+			t.Errorf("openai = %+v", fast)
+		}
+		if down.P95Ms != nil || down.Healthy || down.Model != "gpt-4o-mini-eu" || down.Share != 0 {
+			t.Errorf("azure = %+v", down)
+		}
+	}
+	if _, err := c.LatencyRouteStats(context.Background(), LatencyRoutePrefix); err == nil {
+		t.Error("expected an error for an empty route")
+	}
+}
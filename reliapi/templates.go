@@ -0,0 +1,108 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const templatesPath = "/v1/templates"
+
+// TemplateRef names the prompt template an LLMRequest is rendered from.
+// Variables must set exactly the template's placeholders: the proxy rejects
+// missing and unknown ones with a 400 *APIError with
+// CodeInvalidTemplateVars, whose Details list them under "missing" and
+// "unexpected".
+type TemplateRef struct {
+	Name string `json:"name"`
+	// Version pins a version of the template; 0 is the latest.
+	Version   int               `json:"version,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// TemplateMessage is a message of a prompt template. Content may hold
+// {{variable}} placeholders.
+type TemplateMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Template is a version of a prompt template stored on the proxy.
+type Template struct {
+	Name        string            `json:"name"`
+	Version     int               `json:"version"`
+	Description string            `json:"description"`
+	Messages    []TemplateMessage `json:"messages"`
+	// Variables are the placeholder names of Messages, in order of first
+	// use.
+	Variables []string  `json:"variables"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UpsertTemplate stores messages as the next version of the prompt
+// template name, starting at 1, and returns it. Earlier versions stay
+// available for requests that pin one. It requires the proxy's admin key
+// (RELIAPI_ADMIN_KEY); other keys get a 403 *APIError with CodeForbidden.
+// Templates live in the proxy's memory and are lost when it restarts.
+func (c *Client) UpsertTemplate(ctx context.Context, name string, messages []TemplateMessage, description string) (*Template, error) {
+	if name == "" {
+		return nil, errors.New("reliapi: template name is required")
+	}
+	if len(messages) == 0 {
+		return nil, errors.New("reliapi: template messages are required")
+	}
+	body := struct {
+		Messages    []TemplateMessage `json:"messages"`
+		Description string            `json:"description,omitempty"`
+	}{messages, description}
+	// Every PUT stores a new version, so it is not retried
+	return c.template(ctx, http.MethodPut, templatePath(name), body, false)
+}
+
+// GetTemplate returns the given version of the prompt template name, or
+// its latest for version 0. An unknown template or version is a 404
+// *APIError with CodeNotFound.
+func (c *Client) GetTemplate(ctx context.Context, name string, version int) (*Template, error) {
+	if name == "" {
+		return nil, errors.New("reliapi: template name is required")
+	}
+	path := templatePath(name)
+	if version > 0 {
+		path += "?" + url.Values{"version": {strconv.Itoa(version)}}.Encode()
+	}
+	return c.template(ctx, http.MethodGet, path, nil, true)
+}
+
+// ProxyLLMTemplate is ProxyLLM for a request to target whose messages are
+// rendered from tmpl.
+func (c *Client) ProxyLLMTemplate(ctx context.Context, target string, tmpl TemplateRef) (*ReliAPIResponse, error) {
+	return c.ProxyLLM(ctx, LLMRequest{Target: target, Template: &tmpl})
+}
+
+func templatePath(name string) string {
+	return templatesPath + "/" + url.PathEscape(name)
+}
+
+// template sends a template request and decodes the template it returns.
+func (c *Client) template(ctx context.Context, method, path string, body interface{}, idempotent bool) (*Template, error) {
+	resp, raw, err := c.do(ctx, method, path, body, idempotent)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool     `json:"success"`
+		Data    Template `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return &out.Data, nil
+}
@@ -0,0 +1,133 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestUpsertAndGetTemplate(t *testing.T) {
+	template := map[string]interface{}{
+		"name": "support", "version": 2, "description": "Support answers",
+		"messages": []interface{}{
+			map[string]interface{}{"role": "system", "content": "You help {{product}} users."},
+			map[string]interface{}{"role": "user", "content": "{{question}}"},
+		},
+		"variables":  []interface{}{"product", "question"},
+		"created_at": "2026-10-14T09:00:00+00:00",
+	}
+	var put map[string]interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/templates/support" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		switch r.Method {
+		case http.MethodPut:
+			_ = json.NewDecoder(r.Body).Decode(&put)
+		case http.MethodGet:
+			if r.URL.Query().Get("version") == "7" {
+				writeJSON(w, http.StatusNotFound, map[string]interface{}{
+					"detail": map[string]interface{}{
+						"success": false,
+						"error":   map[string]interface{}{"type": "client_error", "code": CodeNotFound, "message": "Version 7 of template 'support' not found", "status_code": 404},
+					},
+				})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    template,
+			"meta":    map[string]interface{}{"request_id": "req_t", "template_name": "support", "template_version": 2},
+		})
+	})
+
+	messages := []TemplateMessage{
+		{Role: RoleSystem, Content: "You help {{product}} users."},
+		{Role: RoleUser, Content: "{{question}}"},
+	}
+	stored, err := c.UpsertTemplate(context.Background(), "support", messages, "Support answers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if put["description"] != "Support answers" || len(put["messages"].([]interface{})) != 2 {
+		t.Errorf("PUT body = %v", put)
+	}
+	if stored.Version != 2 || !reflect.DeepEqual(stored.Variables, []string{"product", "question"}) || stored.CreatedAt.IsZero() {
+		t.Errorf("template = %+v", stored)
+	}
+
+	got, err := c.GetTemplate(context.Background(), "support", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Messages, messages) {
+		t.Errorf("messages = %+v", got.Messages)
+	}
+	_, err = c.GetTemplate(context.Background(), "support", 7)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeNotFound {
+		t.Errorf("unknown version: err = %v", err)
+	}
+	if _, err := c.UpsertTemplate(context.Background(), "support", nil, ""); err == nil {
+		t.Error("expected an error without messages")
+	}
+}
+
+func TestProxyLLMTemplate(t *testing.T) {
+	var body map[string]interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		tmpl := body["template"].(map[string]interface{})
+		if _, ok := tmpl["variables"].(map[string]interface{})["extra"]; ok {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"detail": map[string]interface{}{
+					"success": false,
+					"error": map[string]interface{}{
+						"type": "client_error", "code": CodeInvalidTemplateVars, "status_code": 400,
+						"message": "Template missing variables: question; unknown variables: extra",
+						"details": map[string]interface{}{"missing": []interface{}{"question"}, "unexpected": []interface{}{"extra"}},
+					},
+				},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "Hi"},
+			"meta":    map[string]interface{}{"request_id": "req_pt", "template_name": "support", "template_version": 2},
+		})
+	})
+
+	resp, err := c.ProxyLLMTemplate(context.Background(), "openai", TemplateRef{
+		Name: "support", Variables: map[string]string{"product": "ReliAPI", "question": "How?"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body["messages"] != nil || body["target"] != "openai" {
+		t.Errorf("body = %v", body)
+	}
+	if resp.Meta.TemplateName != "support" || resp.Meta.TemplateVersion != 2 {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+
+	_, err = c.ProxyLLMTemplate(context.Background(), "openai", TemplateRef{
+		Name: "support", Variables: map[string]string{"product": "ReliAPI", "extra": "x"},
+	})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeInvalidTemplateVars || apiErr.Details["missing"] == nil {
+		t.Errorf("invalid variables: err = %v", err)
+	}
+
+	_, err = c.ProxyLLM(context.Background(), LLMRequest{
+		Target: "openai", Template: &TemplateRef{Name: "support"}, Messages: []ChatMessage{UserMessage("hi")},
+	})
+	if !errors.Is(err, ErrTemplateAndMessages) {
+		t.Errorf("template and messages: err = %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package reliapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrTenantKeyUnavailable is returned when no API key can be found for a
+// request's TenantID. The underlying provider error, if any, is wrapped.
+var ErrTenantKeyUnavailable = errors.New("reliapi: tenant API key unavailable")
+
+// TenantKeyProvider returns the proxy API key of a tenant. It is called for
+// every request that carries a TenantID, possibly from many goroutines at
+// once, so it should cache expensive lookups.
+type TenantKeyProvider func(tenantID string) (string, error)
+
+// WithTenantKeyProvider makes requests with a TenantID authenticate with the
+// key p returns for it instead of the client's key. All tenants share the
+// client's transport and connection pool.
+func WithTenantKeyProvider(p TenantKeyProvider) Option {
+	return func(c *Client) {
+		c.tenantKeys = p
+	}
+}
+
+type apiKeyContextKey struct{}
+
+// WithRequestAPIKey returns a copy of ctx under which requests authenticate
+// with key instead of the client's key. It takes precedence over the
+// request's TenantID.
+func WithRequestAPIKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// apiKeyFor returns the key a request sent with ctx authenticates with.
+func (c *Client) apiKeyFor(ctx context.Context) string {
+	if key, ok := ctx.Value(apiKeyContextKey{}).(string); ok {
+		return key
+	}
+	return c.apiKey
+}
+
+// tenantContext resolves tenantID's key through the TenantKeyProvider and
+// attaches it to ctx. ctx is returned unchanged when tenantID is empty or a
+// key was already set with WithRequestAPIKey.
+func (c *Client) tenantContext(ctx context.Context, tenantID string) (context.Context, error) {
+	if tenantID == "" {
+		return ctx, nil
+	}
+	if _, ok := ctx.Value(apiKeyContextKey{}).(string); ok {
+		return ctx, nil
+	}
+	if c.tenantKeys == nil {
+		return nil, fmt.Errorf("%w: tenant %q: no TenantKeyProvider configured", ErrTenantKeyUnavailable, tenantID)
+	}
+	key, err := c.tenantKeys(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: tenant %q: %w", ErrTenantKeyUnavailable, tenantID, err)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("%w: tenant %q: empty key", ErrTenantKeyUnavailable, tenantID)
+	}
+	return WithRequestAPIKey(ctx, key), nil
+}
+
+// credentialScope prefixes coalescing keys of requests that do not use the
+// client's own key, so callers with different credentials (and so different
+// proxy tenants) never share a response.
+func (c *Client) credentialScope(ctx context.Context) string {
+	key := c.apiKeyFor(ctx)
+	if key == c.apiKey {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8]) + ":"
+}
@@ -0,0 +1,133 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// tenantEchoHandler checks that each request's X-API-Key matches the tenant
+// named in its first message ("tenant-N" must use "key-N").
+func tenantEchoHandler(t *testing.T, mismatches *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]string `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var n int
+		fmt.Sscanf(body.Messages[0]["content"], "tenant-%d", &n)
+		if got, want := r.Header.Get("X-API-Key"), fmt.Sprintf("key-%d", n); got != want {
+			atomic.AddInt32(mismatches, 1)
+		}
+		okLLMResponse(w)
+	}
+}
+
+func TestTenantKeysDoNotLeakAcrossConcurrentRequests(t *testing.T) {
+	var mismatches int32
+	c := newTestClient(t, tenantEchoHandler(t, &mismatches),
+		WithTenantKeyProvider(func(tenantID string) (string, error) {
+			var n int
+			fmt.Sscanf(tenantID, "tenant-%d", &n)
+			return fmt.Sprintf("key-%d", n), nil
+		}),
+		// Identical requests of different tenants must not be shared.
+		WithCoalescing(ShareLeaderError),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tenant := fmt.Sprintf("tenant-%d", i%7)
+			req := llmReq(tenant)
+			req.TenantID = tenant
+			if _, err := c.ProxyLLM(context.Background(), req); err != nil {
+				t.Errorf("ProxyLLM(%s): %v", tenant, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if mismatches != 0 {
+		t.Fatalf("%d requests carried another tenant's key", mismatches)
+	}
+}
+
+func TestTenantCoalescingIsPerCredential(t *testing.T) {
+	c, err := NewClient("", "client-key", WithCoalescing(ShareLeaderError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := c.llmCoalesceKey(llmReq("q"))
+	a := c.credentialScope(WithRequestAPIKey(context.Background(), "key-a")) + key
+	b := c.credentialScope(WithRequestAPIKey(context.Background(), "key-b")) + key
+	own := c.credentialScope(context.Background()) + key
+	if a == b || a == own {
+		t.Errorf("coalescing keys shared across credentials: %q %q %q", a, b, own)
+	}
+}
+
+func TestRequestAPIKeyOverridesTenantAndClientKey(t *testing.T) {
+	var got []string
+	var mu sync.Mutex
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.Header.Get("X-API-Key"))
+		mu.Unlock()
+		okLLMResponse(w)
+	}, WithTenantKeyProvider(func(string) (string, error) { return "tenant-key", nil }))
+
+	ctx := context.Background()
+	req := llmReq("hi")
+	if _, err := c.ProxyLLM(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	req.TenantID = "acme"
+	if _, err := c.ProxyLLM(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ProxyLLM(WithRequestAPIKey(ctx, "explicit"), req); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"test-key", "tenant-key", "explicit"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("X-API-Key sequence = %v, want %v", got, want)
+	}
+}
+
+func TestTenantKeyProviderError(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		okLLMResponse(w)
+	}, WithTenantKeyProvider(func(string) (string, error) { return "", errors.New("vault sealed") }))
+
+	req := llmReq("hi")
+	req.TenantID = "acme"
+	_, err := c.ProxyLLM(context.Background(), req)
+	if !errors.Is(err, ErrTenantKeyUnavailable) {
+		t.Fatalf("err = %v, want ErrTenantKeyUnavailable", err)
+	}
+	if _, err := c.ProxyLLMBatch(context.Background(), []LLMRequest{req}, BatchOptions{TenantID: "acme"}); !errors.Is(err, ErrTenantKeyUnavailable) {
+		t.Fatalf("batch err = %v, want ErrTenantKeyUnavailable", err)
+	}
+	if calls != 0 {
+		t.Fatalf("%d requests sent without a tenant key", calls)
+	}
+
+	// Without a provider, a TenantID cannot be honored either.
+	plain := newTestClient(t, func(w http.ResponseWriter, r *http.Request) { okLLMResponse(w) })
+	if _, err := plain.ProxyLLM(context.Background(), req); !errors.Is(err, ErrTenantKeyUnavailable) {
+		t.Fatalf("err = %v, want ErrTenantKeyUnavailable", err)
+	}
+}
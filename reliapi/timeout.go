@@ -0,0 +1,110 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MaxTimeoutMs is the largest TimeoutMs the proxy accepts; targets may set
+// a lower TargetConfig.MaxTimeoutMs.
+const MaxTimeoutMs = 300000
+
+// UpstreamTimeout is the detail of an UPSTREAM_TIMEOUT error.
+type UpstreamTimeout struct {
+	// TimeoutMs is the request's timeout.
+	TimeoutMs int `json:"timeout_ms"`
+	// AttemptsCompleted is the number of upstream calls that had failed
+	// when the timeout passed; the one in flight is not counted.
+	AttemptsCompleted int `json:"attempts_completed"`
+}
+
+// IsUpstreamTimeout reports whether err means the request's TimeoutMs
+// passed before the upstream answered.
+func IsUpstreamTimeout(err error) bool {
+	return hasCode(err, CodeUpstreamTimeout)
+}
+
+// AsUpstreamTimeout returns the details of an UPSTREAM_TIMEOUT error. It
+// reports false for other errors.
+func AsUpstreamTimeout(err error) (*UpstreamTimeout, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !IsUpstreamTimeout(apiErr) {
+		return nil, false
+	}
+	raw, _ := json.Marshal(apiErr.Details)
+	var t UpstreamTimeout
+	_ = json.Unmarshal(raw, &t)
+	return &t, true
+}
+
+// DeadlineHeader carries the time left until a request's ctx deadline, in
+// milliseconds. The proxy shortens the request's timeout to it, so its
+// retries stop in time (see Meta.AttemptsSkippedForDeadline); it is sent
+// on every attempt whenever ctx has a deadline, and recomputed each time.
+const DeadlineHeader = "X-ReliAPI-Deadline-Ms"
+
+// DeadlineTooShort is the detail of a DEADLINE_TOO_SHORT error: the request
+// had less time left than the target's upstream usually takes to answer,
+// so the proxy failed it without calling the upstream.
+type DeadlineTooShort struct {
+	// DeadlineMs is the time the request had.
+	DeadlineMs int `json:"deadline_ms"`
+	// P50LatencyMs is the target's median observed upstream latency.
+	P50LatencyMs int `json:"p50_latency_ms"`
+}
+
+// IsDeadlineTooShort reports whether err means the request's deadline was
+// too short for the proxy to try the upstream at all.
+func IsDeadlineTooShort(err error) bool {
+	return hasCode(err, CodeDeadlineTooShort)
+}
+
+// AsDeadlineTooShort returns the details of a DEADLINE_TOO_SHORT error. It
+// reports false for other errors.
+func AsDeadlineTooShort(err error) (*DeadlineTooShort, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !IsDeadlineTooShort(apiErr) {
+		return nil, false
+	}
+	raw, _ := json.Marshal(apiErr.Details)
+	var d DeadlineTooShort
+	_ = json.Unmarshal(raw, &d)
+	return &d, true
+}
+
+// setDeadlineHeader sets DeadlineHeader on req from ctx's deadline, if any.
+func setDeadlineHeader(ctx context.Context, req *http.Request) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	ms := int64(time.Until(deadline) / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	req.Header.Set(DeadlineHeader, strconv.FormatInt(ms, 10))
+}
+
+// contextTimeoutMs returns timeoutMs if it is set, and otherwise the time
+// left until ctx's deadline, between 1ms and MaxTimeoutMs. It returns nil
+// when ctx has no deadline.
+func contextTimeoutMs(ctx context.Context, timeoutMs *int) *int {
+	if timeoutMs != nil {
+		return timeoutMs
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	ms := int(time.Until(deadline) / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	} else if ms > MaxTimeoutMs {
+		ms = MaxTimeoutMs
+	}
+	return &ms
+}
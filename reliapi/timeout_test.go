@@ -0,0 +1,177 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMsFromContext(t *testing.T) {
+	var sent []*int
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			TimeoutMs *int `json:"timeout_ms"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		sent = append(sent, body.TimeoutMs)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"content": "hi"}})
+	})
+
+	if _, err := c.ProxyLLM(context.Background(), llmReq("no deadline")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := c.ProxyLLM(ctx, llmReq("deadline")); err != nil {
+		t.Fatal(err)
+	}
+	explicit := llmReq("explicit")
+	timeout := 120000
+	explicit.TimeoutMs = &timeout
+	if _, err := c.ProxyLLM(ctx, explicit); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent[0] != nil {
+		t.Errorf("timeout_ms = %d without a deadline", *sent[0])
+	}
+	if sent[1] == nil || *sent[1] <= 9000 || *sent[1] > 10000 {
+		t.Errorf("timeout_ms = %v, want the ~10s left on ctx", sent[1])
+	}
+	if sent[2] == nil || *sent[2] != timeout {
+		t.Errorf("timeout_ms = %v, want the explicit %d", sent[2], timeout)
+	}
+}
+
+func TestContextTimeoutMsClamped(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	if got := contextTimeoutMs(ctx, nil); *got != MaxTimeoutMs {
+		t.Errorf("an hour left: %d, want MaxTimeoutMs", *got)
+	}
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if got := contextTimeoutMs(ctx, nil); *got != 1 {
+		t.Errorf("deadline passed: %d, want 1", *got)
+	}
+}
+
+func TestDeterministicKeyIgnoresDeadline(t *testing.T) {
+	var keys []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			IdempotencyKey string `json:"idempotency_key"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		keys = append(keys, body.IdempotencyKey)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"status_code": 200}})
+	}, WithDeterministicIdempotency())
+
+	for _, d := range []time.Duration{time.Second, time.Minute} {
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		_, err := c.ProxyHTTP(ctx, HTTPRequest{Target: "api", Method: http.MethodPost, Path: "/orders"})
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("keys = %q, want one key for both deadlines", keys)
+	}
+}
+
+func TestAsUpstreamTimeout(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusGatewayTimeout, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"type":      "upstream_error",
+				"code":      CodeUpstreamTimeout,
+				"message":   "Upstream did not answer within 10000 ms",
+				"retryable": true,
+				"details":   map[string]interface{}{"timeout_ms": 10000, "attempts_completed": 2},
+			},
+			"meta": map[string]interface{}{"duration_ms": 10003},
+		})
+	})
+
+	timeout := 10000
+	req := llmReq("hi")
+	req.TimeoutMs = &timeout
+	_, err := c.ProxyLLM(context.Background(), req)
+	got, ok := AsUpstreamTimeout(err)
+	if !ok {
+		t.Fatalf("AsUpstreamTimeout(%v) = false", err)
+	}
+	if *got != (UpstreamTimeout{TimeoutMs: 10000, AttemptsCompleted: 2}) {
+		t.Errorf("timeout = %+v", *got)
+	}
+	if _, ok := AsUpstreamTimeout(&APIError{Code: CodeNetworkError}); ok {
+		t.Error("AsUpstreamTimeout(NETWORK_ERROR) = true")
+	}
+}
+
+func TestDeadlineHeader(t *testing.T) {
+	var sent []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get(DeadlineHeader))
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true, "data": map[string]interface{}{"status_code": 503},
+			"meta": map[string]interface{}{"attempts": 1, "attempts_skipped_for_deadline": 2},
+		})
+	})
+
+	if _, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/a"}); err != nil {
+		t.Fatal(err)
+	}
+	// The header is sent even with an explicit TimeoutMs
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	timeout := 60000
+	resp, err := c.ProxyHTTP(ctx, HTTPRequest{Target: "api", Method: http.MethodGet, Path: "/a", TimeoutMs: &timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent[0] != "" {
+		t.Errorf("%s = %q without a deadline", DeadlineHeader, sent[0])
+	}
+	if ms, err := strconv.Atoi(sent[1]); err != nil || ms <= 4000 || ms > 5000 {
+		t.Errorf("%s = %q, want the ~5s left on ctx", DeadlineHeader, sent[1])
+	}
+	if resp.Meta.AttemptsSkippedForDeadline != 2 {
+		t.Errorf("AttemptsSkippedForDeadline = %d", resp.Meta.AttemptsSkippedForDeadline)
+	}
+}
+
+func TestAsDeadlineTooShort(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"type":      "client_error",
+				"code":      CodeDeadlineTooShort,
+				"message":   "Deadline of 80 ms is shorter than the target's P50 latency of 900 ms",
+				"retryable": false,
+				"details":   map[string]interface{}{"deadline_ms": 80, "p50_latency_ms": 900},
+			},
+		})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 80*time.Millisecond)
+	defer cancel()
+	_, err := c.ProxyLLM(ctx, llmReq("hi"))
+	got, ok := AsDeadlineTooShort(err)
+	if !ok {
+		t.Fatalf("AsDeadlineTooShort(%v) = false", err)
+	}
+	if *got != (DeadlineTooShort{DeadlineMs: 80, P50LatencyMs: 900}) {
+		t.Errorf("detail = %+v", *got)
+	}
+	if IsUpstreamTimeout(err) {
+		t.Error("DEADLINE_TOO_SHORT is an UPSTREAM_TIMEOUT")
+	}
+}
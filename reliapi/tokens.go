@@ -0,0 +1,145 @@
+package reliapi
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// o200kPrefixes are models whose tokenizer encodes non-English text more
+// compactly.
+var o200kPrefixes = []string{"gpt-4o", "gpt-4.1", "gpt-5", "o1", "o3", "o4", "chatgpt-4o"}
+
+// CountTokens approximates the prompt tokens messages use with model,
+// without network access.
+//
+// It is best-effort: a heuristic over runs of letters, digits and symbols
+// plus OpenAI's chat framing (3 tokens per message, 3 to prime the reply),
+// not the provider's tokenizer. For English prose it is typically within
+// 15% of the provider's count; code, non-Latin scripts and unusual
+// formatting can be further off. The proxy's EstimateCost uses the same
+// approximation. Image parts cannot be counted and yield an error.
+func CountTokens(model string, messages []ChatMessage) (int, error) {
+	nonASCII := nonASCIICharsPerToken(model)
+	tokens := 3
+	for i, m := range messages {
+		tokens += 3 + textTokens(m.Role, nonASCII)
+		if m.Name != "" {
+			tokens += 1 + textTokens(m.Name, nonASCII)
+		}
+		if len(m.Parts) == 0 {
+			tokens += textTokens(m.Content, nonASCII)
+			continue
+		}
+		for _, part := range m.Parts {
+			if part.Type != "text" {
+				return 0, fmt.Errorf("reliapi: CountTokens: message %d: cannot count %q content", i, part.Type)
+			}
+			tokens += textTokens(part.Text, nonASCII)
+		}
+	}
+	return tokens, nil
+}
+
+func nonASCIICharsPerToken(model string) int {
+	for _, p := range o200kPrefixes {
+		if strings.HasPrefix(model, p) {
+			return 4
+		}
+	}
+	return 3
+}
+
+type charClass int
+
+const (
+	classLetter charClass = iota
+	classDigit
+	classCJK
+	classSpace
+	classOther
+)
+
+func classify(r rune) charClass {
+	switch {
+	case r >= 0x3040 && r <= 0x30FF, r >= 0x3400 && r <= 0x4DBF, r >= 0x4E00 && r <= 0x9FFF,
+		r >= 0xAC00 && r <= 0xD7AF, r >= 0xF900 && r <= 0xFAFF, r >= 0x20000 && r <= 0x2FFFF:
+		return classCJK
+	case unicode.IsSpace(r):
+		return classSpace
+	case unicode.IsDigit(r):
+		return classDigit
+	case unicode.IsLetter(r):
+		return classLetter
+	}
+	return classOther
+}
+
+// textTokens approximates the tokens of s from its runs of letters, digits
+// and symbols. It matches _text_tokens in core/cost_estimator.py.
+func textTokens(s string, nonASCIIPerToken int) int {
+	tokens := 0
+	for s != "" {
+		run := nextRun(s, nonASCIIPerToken)
+		tokens += run.tokens()
+		s = s[run.size:]
+	}
+	return tokens
+}
+
+// textRun is a run of characters of the same class, counted as a whole by
+// textTokens: the tokens of a text are the sum of those of its runs.
+type textRun struct {
+	text  string
+	size  int // bytes
+	chars int
+	// perToken is how many of its characters make a token; 0 for a run
+	// of spaces, which is a token unless it is a single space
+	perToken int
+}
+
+// nextRun returns the run s starts with, which is not empty.
+func nextRun(s string, nonASCIIPerToken int) textRun {
+	r, size := utf8.DecodeRuneInString(s)
+	class := classify(r)
+	n, end, ascii := 1, size, r < utf8.RuneSelf
+	for end < len(s) {
+		r, size := utf8.DecodeRuneInString(s[end:])
+		if classify(r) != class {
+			break
+		}
+		n, end = n+1, end+size
+		ascii = ascii && r < utf8.RuneSelf
+	}
+	run := textRun{text: s[:end], size: end, chars: n}
+	switch class {
+	case classLetter:
+		run.perToken = nonASCIIPerToken
+		if ascii {
+			run.perToken = 8
+		}
+	case classDigit:
+		run.perToken = 3
+	case classCJK:
+		run.perToken = 1
+	case classOther:
+		run.perToken = 2
+	}
+	return run
+}
+
+func (r textRun) tokens() int {
+	if r.perToken > 0 {
+		return ceilDiv(r.chars, r.perToken)
+	}
+	// A single space is part of the next word's token.
+	if r.text != " " {
+		return 1
+	}
+	return 0
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,80 @@
+package reliapi
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// costSample is a recorded request, the proxy's response to it and its
+// /estimate result. The proxy's tests check the estimate against its own.
+type costSample struct {
+	Name     string     `json:"name"`
+	Request  LLMRequest `json:"request"`
+	Response struct {
+		Data struct {
+			Usage Usage `json:"usage"`
+		} `json:"data"`
+		Meta Meta `json:"meta"`
+	} `json:"response"`
+	Estimate json.RawMessage `json:"estimate"`
+}
+
+func loadCostSamples(t *testing.T) []costSample {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "cost_samples.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []costSample
+	if err := json.Unmarshal(raw, &samples); err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+func TestCountTokensRecordedSamples(t *testing.T) {
+	samples := loadCostSamples(t)
+	for _, s := range samples {
+		t.Run(s.Name, func(t *testing.T) {
+			got, err := CountTokens(s.Request.Model, s.Request.Messages)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := s.Response.Data.Usage.PromptTokens
+			if math.Abs(float64(got-want)) > 0.2*float64(want) {
+				t.Errorf("CountTokens = %d, recorded prompt_tokens %d", got, want)
+			}
+		})
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	// Expected values match CostEstimator.count_tokens in the proxy.
+	tests := []struct {
+		model    string
+		messages []ChatMessage
+		want     int
+	}{
+		{"gpt-4o-mini", []ChatMessage{UserMessage("Hello, world!")}, 11},
+		{"gpt-4", []ChatMessage{UserMessage("Привет, как дела?")}, 14},
+		{"gpt-4o", []ChatMessage{UserMessage("Привет, как дела?")}, 13},
+		{"gpt-4o", []ChatMessage{UserMessage("東京は日本の首都です。")}, 18},
+		{"gpt-4o-mini", []ChatMessage{UserMessage("order_id=12345678\n\n  done...")}, 18},
+		{"x", []ChatMessage{UserMessage("")}, 7},
+		{"gpt-4o", []ChatMessage{{Role: RoleUser, Name: "alice", Parts: []ContentPart{{Type: "text", Text: "Look at"}, {Type: "text", Text: " this"}}}}, 12},
+	}
+	for _, tt := range tests {
+		got, err := CountTokens(tt.model, tt.messages)
+		if err != nil || got != tt.want {
+			t.Errorf("CountTokens(%q, %+v) = %d, %v, want %d", tt.model, tt.messages, got, err, tt.want)
+		}
+	}
+
+	image := ChatMessage{Role: RoleUser, Parts: []ContentPart{{Type: "image_url", ImageURL: &ImageURL{URL: "https://example.com/a.png"}}}}
+	if _, err := CountTokens("gpt-4o", []ChatMessage{image}); err == nil {
+		t.Error("expected an error for an image part")
+	}
+}
@@ -0,0 +1,59 @@
+package reliapi
+
+import "encoding/json"
+
+// LLMRequest.ToolChoice values.
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
+// ToolDefinition is a tool offered to the model. Functions are the only
+// tools; FunctionTool builds one.
+type ToolDefinition struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition describes a function the model may call.
+type FunctionDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON Schema of the function's arguments.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// FunctionTool returns a function tool. parameters is a JSON Schema and may
+// be nil for a function without arguments.
+func FunctionTool(name, description string, parameters json.RawMessage) ToolDefinition {
+	return ToolDefinition{
+		Type:     "function",
+		Function: FunctionDefinition{Name: name, Description: description, Parameters: parameters},
+	}
+}
+
+// ForceTool is a ToolChoice that makes the model call the function name,
+// which must be one of the request's Tools.
+func ForceTool(name string) interface{} {
+	return map[string]interface{}{"type": "function", "function": map[string]string{"name": name}}
+}
+
+// ResponseFormat is the output format requested from the model, in
+// OpenAI's format. Type is "text", "json_object" or "json_schema".
+type ResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// ResponseFormatFallbackJSONMode is the LLMRequest.ResponseFormatFallback
+// asking models without structured outputs for JSON mode instead.
+const ResponseFormatFallbackJSONMode = "json_mode"
+
+// JSONSchemaFormat is the schema of a "json_schema" ResponseFormat. With
+// Strict, OpenAI rejects schemas outside the subset it can enforce.
+type JSONSchemaFormat struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict,omitempty"`
+}
@@ -0,0 +1,137 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestProxyLLMSendsTools(t *testing.T) {
+	var sent struct {
+		Tools          json.RawMessage `json:"tools"`
+		ToolChoice     json.RawMessage `json:"tool_choice"`
+		ResponseFormat json.RawMessage `json:"response_format"`
+	}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(raw, &sent); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    loadFixture(t, "reliapi_llm_tool_calls.json").(map[string]interface{})["data"],
+			"meta":    map[string]interface{}{"request_id": "req_tools"},
+		})
+	})
+
+	resp, err := c.ProxyLLM(context.Background(), LLMRequest{
+		Target:   "openai",
+		Messages: []ChatMessage{UserMessage("Weather in Berlin and Paris?")},
+		Tools: []ToolDefinition{FunctionTool("get_weather", "Current weather for a city",
+			json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`))},
+		ToolChoice: ForceTool("get_weather"),
+		ResponseFormat: &ResponseFormat{Type: "json_schema", JSONSchema: &JSONSchemaFormat{
+			Name: "weather", Schema: json.RawMessage(`{"type":"object"}`), Strict: true,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameJSON(t, sent.Tools, []byte(`[{"type":"function","function":{
+		"name":"get_weather","description":"Current weather for a city",
+		"parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}]`))
+	assertSameJSON(t, sent.ToolChoice, []byte(`{"type":"function","function":{"name":"get_weather"}}`))
+	assertSameJSON(t, sent.ResponseFormat, []byte(`{"type":"json_schema",
+		"json_schema":{"name":"weather","schema":{"type":"object"},"strict":true}}`))
+
+	c2, err := resp.Completion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := c2.Choices[0].ToolCalls; len(calls) != 2 || calls[1].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("ToolCalls = %+v", calls)
+	}
+}
+
+func TestProxyLLMOmitsUnsetTools(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		for _, k := range []string{"tools", "tool_choice", "response_format"} {
+			if _, ok := body[k]; ok {
+				t.Errorf("%s was sent: %v", k, body)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"content": "hi"}})
+	})
+
+	if _, err := c.ProxyLLM(context.Background(), LLMRequest{Target: "openai", Messages: []ChatMessage{UserMessage("hi")}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProxyLLMStructuredOutput(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		if body["response_format_fallback"] != ResponseFormatFallbackJSONMode {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error": map[string]interface{}{
+					"type":      "client_error",
+					"code":      CodeUnsupportedParameter,
+					"message":   "response_format: gpt-4-turbo has no structured outputs for a json_schema response_format",
+					"retryable": false,
+					"details":   map[string]interface{}{"field": "response_format", "model": "gpt-4-turbo"},
+				},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": `{"city": "Berlin", "celsius": 12}`, "finish_reason": "stop"},
+		})
+	})
+	req := LLMRequest{
+		Target:   "openai",
+		Model:    "gpt-4-turbo",
+		Messages: []ChatMessage{UserMessage("Weather in Berlin?")},
+		ResponseFormat: &ResponseFormat{Type: "json_schema", JSONSchema: &JSONSchemaFormat{
+			Name: "weather", Schema: json.RawMessage(`{"type":"object"}`),
+		}},
+	}
+
+	_, err := c.ProxyLLM(context.Background(), req)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeUnsupportedParameter || apiErr.Details["model"] != "gpt-4-turbo" {
+		t.Fatalf("err = %v", err)
+	}
+
+	req.ResponseFormatFallback = ResponseFormatFallbackJSONMode
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completion, err := resp.Completion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var weather struct {
+		City    string
+		Celsius int
+	}
+	if err := completion.Choices[0].DecodeJSON(&weather); err != nil || weather.City != "Berlin" || weather.Celsius != 12 {
+		t.Errorf("DecodeJSON = %+v, %v", weather, err)
+	}
+	truncated := Choice{Message: AssistantMessage(`{"city": "Ber`), FinishReason: "length"}
+	if err := truncated.DecodeJSON(&weather); err == nil {
+		t.Error("truncated output decoded")
+	}
+}
@@ -0,0 +1,106 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/KikuAI-Lab/reliapi/reliapi"
+
+// traceContext writes W3C traceparent and tracestate headers. The proxy
+// forwards them to targets that set forward_trace_context.
+var traceContext = propagation.TraceContext{}
+
+// WithTracing creates an OpenTelemetry client span, named "reliapi <op>"
+// after the call's Op (see Request), for every proxy call, as a child of the
+// span in the call's context. Every request to the proxy carries the W3C
+// trace context of the call.
+//
+// Spans record the reliapi.target, reliapi.request_id, reliapi.cache_hit,
+// reliapi.cost_usd and reliapi.duration_ms (the proxy's own timing)
+// attributes, and a reliapi.attempt event per HTTP request sent, so
+// WithRetry resends stay visible. Failed calls set the span status to Error
+// and record reliapi.error_code from the APIError. A stream's span ends
+// when Recv returns its final error or the stream is closed.
+func WithTracing(tp trace.TracerProvider) Option {
+	return func(c *Client) {
+		if tp != nil {
+			c.tracer = tp.Tracer(tracerName)
+		}
+	}
+}
+
+func (c *Client) startSpan(ctx context.Context, op, target string) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, "reliapi "+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("reliapi.target", target)),
+	)
+}
+
+// injectTraceContext adds the trace context of req's context to its headers.
+func (c *Client) injectTraceContext(req *http.Request) {
+	if c.tracer != nil {
+		traceContext.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	}
+}
+
+func attemptEvent(span trace.Span, n int, resp *http.Response, err error) {
+	attrs := []attribute.KeyValue{attribute.Int("reliapi.attempt", n)}
+	if err == nil && resp != nil {
+		attrs = append(attrs, attribute.Int("http.response.status_code", resp.StatusCode))
+	} else if err != nil {
+		attrs = append(attrs, attribute.String("error.message", err.Error()))
+	}
+	span.AddEvent("reliapi.attempt", trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, meta *Meta, err error) {
+	if meta != nil {
+		span.SetAttributes(
+			attribute.Bool("reliapi.cache_hit", meta.CacheHit),
+			attribute.Int("reliapi.duration_ms", meta.DurationMs),
+		)
+		if meta.RequestID != "" {
+			span.SetAttributes(attribute.String("reliapi.request_id", meta.RequestID))
+		}
+		if meta.CostUSD != nil {
+			span.SetAttributes(attribute.Float64("reliapi.cost_usd", *meta.CostUSD))
+		}
+	}
+	finishSpan(span, err)
+}
+
+func endBatchSpan(span trace.Span, size int, meta *BatchMeta, err error) {
+	span.SetAttributes(attribute.Int("reliapi.batch_size", size))
+	if meta != nil {
+		span.SetAttributes(
+			attribute.String("reliapi.request_id", meta.RequestID),
+			attribute.Int("reliapi.duration_ms", meta.DurationMs),
+			attribute.Int("reliapi.cache_hits", meta.CacheHits),
+			attribute.Float64("reliapi.cost_usd", meta.CostUSD),
+		)
+	}
+	finishSpan(span, err)
+}
+
+// finishSpan sets the span status from err and ends it.
+func finishSpan(span trace.Span, err error) {
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			if apiErr.RequestID != "" {
+				span.SetAttributes(attribute.String("reliapi.request_id", apiErr.RequestID))
+			}
+			span.SetAttributes(attribute.String("reliapi.error_code", metricsStatus(err)))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,169 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTracerProvider(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return tp, exp
+}
+
+func spanAttrs(s tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value, len(s.Attributes))
+	for _, kv := range s.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracingSpanPerCall(t *testing.T) {
+	tp, exp := newTracerProvider(t)
+	var traceparents []string
+	script := scriptedHandler(t, []scriptedResponse{
+		{http.StatusServiceUnavailable, map[string]interface{}{"detail": "unavailable"}},
+		okWithMeta(map[string]interface{}{"request_id": "req_1", "cache_hit": true, "cost_usd": 0.002, "duration_ms": 42}),
+	})
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("Traceparent"))
+		script(w, r)
+	}, WithTracing(tp), WithAutoIdempotency(), WithRetry(2, time.Millisecond))
+	recordSleeps(c)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := c.ProxyLLM(ctx, llmReq("hi")); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+	call := spans[0]
+	if call.Name != "reliapi proxy_llm" || call.SpanKind != trace.SpanKindClient {
+		t.Errorf("span = %q (%v)", call.Name, call.SpanKind)
+	}
+	if call.Parent.SpanID() != parent.SpanContext().SpanID() || call.SpanContext.TraceID() != parent.SpanContext().TraceID() {
+		t.Errorf("call span is not a child of the caller's span")
+	}
+	want := map[attribute.Key]attribute.Value{
+		"reliapi.target":      attribute.StringValue("openai"),
+		"reliapi.request_id":  attribute.StringValue("req_1"),
+		"reliapi.cache_hit":   attribute.BoolValue(true),
+		"reliapi.cost_usd":    attribute.Float64Value(0.002),
+		"reliapi.duration_ms": attribute.IntValue(42),
+	}
+	got := spanAttrs(call)
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k].Emit(), v.Emit())
+		}
+	}
+	if call.Status.Code != codes.Unset {
+		t.Errorf("status = %v", call.Status)
+	}
+	if len(call.Events) != 2 || call.Events[0].Name != "reliapi.attempt" {
+		t.Errorf("events = %+v, want two attempts", call.Events)
+	}
+
+	// Both attempts carry the call span's context, so the proxy and the
+	// upstreams it forwards to join the trace under it.
+	wantHeader := "00-" + call.SpanContext.TraceID().String() + "-" + call.SpanContext.SpanID().String() + "-01"
+	if len(traceparents) != 2 || traceparents[0] != wantHeader || traceparents[1] != wantHeader {
+		t.Errorf("traceparent = %q, want %q twice", traceparents, wantHeader)
+	}
+}
+
+func TestTracingError(t *testing.T) {
+	tp, exp := newTracerProvider(t)
+	c := newTestClient(t, scriptedHandler(t, []scriptedResponse{
+		{http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]interface{}{"type": "budget_error", "code": "BUDGET_EXCEEDED", "message": "over budget"},
+			"meta":    map[string]interface{}{"request_id": "req_budget"},
+		}},
+	}), WithTracing(tp))
+
+	if _, err := c.ProxyHTTP(context.Background(), HTTPRequest{Target: "api", Method: "GET", Path: "/"}); !IsBudgetExceeded(err) {
+		t.Fatalf("err = %v", err)
+	}
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("spans = %d, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Parent.IsValid() {
+		t.Error("span without a caller span has a parent")
+	}
+	if span.Status.Code != codes.Error || !strings.Contains(span.Status.Description, "over budget") {
+		t.Errorf("status = %+v", span.Status)
+	}
+	if got := spanAttrs(span)["reliapi.error_code"]; got.AsString() != CodeBudgetExceeded {
+		t.Errorf("error_code = %q", got.AsString())
+	}
+	if len(span.Events) != 2 || span.Events[1].Name != "exception" {
+		t.Errorf("events = %+v, want an attempt and the recorded error", span.Events)
+	}
+}
+
+func TestTracingStream(t *testing.T) {
+	tp, exp := newTracerProvider(t)
+	events := []string{
+		"event: meta\ndata: {\"target\": \"openai\", \"request_id\": \"req_stream\"}\n\n",
+		"event: chunk\ndata: {\"delta\": \"Hi\"}\n\n",
+		"event: done\ndata: {\"finish_reason\": \"stop\", \"cost_usd\": 0.001}\n\n",
+	}
+	c := newTestClient(t, sseHandler(t, events, false), WithTracing(tp))
+
+	s, err := c.ProxyLLMStream(context.Background(), llmReq("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(exp.GetSpans()); n != 0 {
+		t.Fatalf("span ended before the stream: %d", n)
+	}
+	if _, err := collect(t, s); !errors.Is(err, io.EOF) {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "reliapi proxy_llm_stream" {
+		t.Fatalf("spans = %+v", spans)
+	}
+	got := spanAttrs(spans[0])
+	if got["reliapi.request_id"].AsString() != "req_stream" || got["reliapi.cost_usd"].AsFloat64() != 0.001 {
+		t.Errorf("attributes = %v", spans[0].Attributes)
+	}
+}
+
+func TestNoTracingHeaders(t *testing.T) {
+	tp, _ := newTracerProvider(t)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Traceparent"); got != "" {
+			t.Errorf("traceparent = %q without WithTracing", got)
+		}
+		okLLMResponse(w)
+	})
+	ctx, span := tp.Tracer("test").Start(context.Background(), "parent")
+	defer span.End()
+	if _, err := c.ProxyLLM(ctx, llmReq("hi")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,193 @@
+package reliapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultIdempotencyHeader is the request header NewTransport takes
+// idempotency keys from unless WithTransportIdempotencyHeader says
+// otherwise.
+const DefaultIdempotencyHeader = "Idempotency-Key"
+
+// TransportOption configures NewTransport.
+type TransportOption func(*transport)
+
+type transport struct {
+	client            *Client
+	target            string
+	cacheTTL          map[string]time.Duration
+	idempotencyHeader string
+	stripPrefix       string
+	passthrough       []string
+	base              http.RoundTripper
+}
+
+// WithTransportCacheTTL caches the responses to requests with method for
+// ttl, e.g. WithTransportCacheTTL(http.MethodGet, 5*time.Minute). A zero
+// ttl bypasses the cache. Methods without a TTL use the target's cache
+// settings.
+func WithTransportCacheTTL(method string, ttl time.Duration) TransportOption {
+	return func(t *transport) { t.cacheTTL[strings.ToUpper(method)] = ttl }
+}
+
+// WithTransportIdempotencyHeader sets the request header whose value
+// becomes the proxy's idempotency key; "" turns the derivation off. The
+// header is still sent upstream. The default is DefaultIdempotencyHeader.
+func WithTransportIdempotencyHeader(name string) TransportOption {
+	return func(t *transport) { t.idempotencyHeader = name }
+}
+
+// WithTransportStripPrefix removes prefix from request paths before they
+// are sent to the target, for targets whose base URL has a path: with a
+// base URL of https://api.example.com/v2, a client built for that URL
+// requests /v2/users, which the target knows as /users.
+func WithTransportStripPrefix(prefix string) TransportOption {
+	return func(t *transport) { t.stripPrefix = strings.TrimSuffix(prefix, "/") }
+}
+
+// WithTransportPassthrough sends requests whose path matches one of the
+// shell patterns (see path.Match, e.g. "/uploads/*") directly, bypassing
+// the proxy, with the transport set by WithTransportBase.
+func WithTransportPassthrough(patterns ...string) TransportOption {
+	return func(t *transport) { t.passthrough = append(t.passthrough, patterns...) }
+}
+
+// WithTransportBase sets the transport passthrough requests are sent with;
+// the default is http.DefaultTransport.
+func WithTransportBase(rt http.RoundTripper) TransportOption {
+	return func(t *transport) {
+		if rt != nil {
+			t.base = rt
+		}
+	}
+}
+
+// NewTransport returns an http.RoundTripper that sends requests through
+// client's /proxy/http endpoint to target instead of to the host in their
+// URL, so an existing *http.Client gains the proxy's retries, caching and
+// circuit breaking without changes to the code that builds its requests:
+//
+//	hc := &http.Client{Transport: reliapi.NewTransport(client, "github",
+//		reliapi.WithTransportCacheTTL(http.MethodGet, 5*time.Minute))}
+//
+// Requests are translated with FromHTTPRequest and responses rebuilt with
+// ToHTTPResponse, with every upstream header, repeated ones such as Link
+// included. Bodies are read into memory, so any io.Reader will do.
+// Upstream 4xx and 5xx answers, which the proxy reports as errors, become
+// responses with that status and an empty body, as the proxy does not
+// return the upstream's error body. Other proxy failures, such as an open
+// circuit or a budget cap, are returned as the *APIError.
+func NewTransport(client *Client, target string, opts ...TransportOption) http.RoundTripper {
+	t := &transport{
+		client:            client,
+		target:            target,
+		cacheTTL:          make(map[string]time.Duration),
+		idempotencyHeader: DefaultIdempotencyHeader,
+		base:              http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.passes(req.URL.Path) {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request; FromHTTPRequest replaces
+	// the body of the clone and closes the original
+	clone := req.Clone(req.Context())
+	if p := clone.URL.Path; t.stripPrefix != "" && (p == t.stripPrefix || strings.HasPrefix(p, t.stripPrefix+"/")) {
+		clone.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(p, t.stripPrefix), "/")
+		clone.URL.RawPath = ""
+	}
+	hr, err := FromHTTPRequest(clone, t.target)
+	if err != nil {
+		return nil, err
+	}
+	hr.ResponseHeaders = []string{"*"}
+	if ttl, ok := t.cacheTTL[hr.Method]; ok {
+		seconds := int(ttl / time.Second)
+		hr.Cache = &seconds
+	}
+	if t.idempotencyHeader != "" {
+		if key := req.Header.Get(t.idempotencyHeader); key != "" {
+			hr.IdempotencyKey = &key
+		}
+	}
+
+	resp, err := t.client.ProxyHTTP(req.Context(), hr)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && isUpstreamStatus(apiErr) {
+			return upstreamErrorResponse(req, apiErr), nil
+		}
+		return nil, err
+	}
+	out, err := ToHTTPResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Meta.UpstreamHeaders) > 0 {
+		// The data's headers keep one value per name; these keep them all
+		for name, v := range resp.Meta.UpstreamHeaders {
+			out.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), v...)
+		}
+		removeHopByHop(out.Header)
+		out.Header.Del("Content-Encoding")
+	}
+	if status := resp.Meta.UpstreamStatus; status != 0 && status != out.StatusCode {
+		out.StatusCode = status
+		out.Status = statusLine(status)
+	}
+	out.Request = req
+	return out, nil
+}
+
+func (t *transport) passes(p string) bool {
+	for _, pattern := range t.passthrough {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isUpstreamStatus reports whether err is the proxy relaying an upstream
+// 4xx or 5xx answer (services.py's HTTPStatusError handling) rather than
+// a failure of its own.
+func isUpstreamStatus(err *APIError) bool {
+	if err.Type != "upstream_error" || err.StatusCode < 400 || err.StatusCode > 599 {
+		return false
+	}
+	switch err.Code {
+	case CodeServerError, CodeClientError, CodeUnauthorized, CodeNotFound, CodeIdempotencyConflict:
+		return true
+	}
+	return false
+}
+
+func upstreamErrorResponse(req *http.Request, err *APIError) *http.Response {
+	return &http.Response{
+		Status:     statusLine(err.StatusCode),
+		StatusCode: err.StatusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+func statusLine(code int) string {
+	return fmt.Sprintf("%d %s", code, http.StatusText(code))
+}
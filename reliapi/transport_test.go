@@ -0,0 +1,129 @@
+package reliapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransport(t *testing.T) {
+	var got map[string]interface{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/proxy/http" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		got = nil
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"status_code": 200,
+				"headers":     map[string]string{"Content-Type": "application/json", "Link": `<https://api.example.com/users?page=3>; rel="last"`},
+				"body":        []map[string]interface{}{{"id": 1}},
+			},
+			"meta": map[string]interface{}{
+				"request_id":      "req_rt",
+				"upstream_status": 200,
+				"upstream_headers": map[string][]string{
+					"link":          {`<https://api.example.com/users?page=2>; rel="next"`, `<https://api.example.com/users?page=3>; rel="last"`},
+					"x-total-count": {"42"},
+				},
+			},
+		})
+	})
+	hc := &http.Client{Transport: NewTransport(c, "users",
+		WithTransportCacheTTL(http.MethodGet, 5*time.Minute),
+		WithTransportStripPrefix("/v2"),
+	)}
+
+	resp, err := hc.Get("https://api.example.com/v2/users?page=1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != `[{"id":1}]` {
+		t.Errorf("response = %d %s", resp.StatusCode, body)
+	}
+	if links := resp.Header.Values("Link"); len(links) != 2 || resp.Header.Get("X-Total-Count") != "42" {
+		t.Errorf("headers = %v", resp.Header)
+	}
+	if got["target"] != "users" || got["method"] != "GET" || got["path"] != "/users" || got["cache"] != float64(300) {
+		t.Errorf("request = %v", got)
+	}
+	if q, _ := got["query"].(map[string]interface{}); q["page"] != "1" {
+		t.Errorf("query = %v", got["query"])
+	}
+	if h, _ := got["response_headers"].([]interface{}); len(h) != 1 || h[0] != "*" {
+		t.Errorf("response_headers = %v", got["response_headers"])
+	}
+
+	// A body that can't be rewound, with an idempotency key in its header
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/v2/users", io.NopCloser(strings.NewReader(`{"name":"ada"}`)))
+	req.Header.Set("Idempotency-Key", "create-ada")
+	resp, err = hc.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if got["body"] != `{"name":"ada"}` || got["idempotency_key"] != "create-ada" || got["cache"] != nil {
+		t.Errorf("request = %v", got)
+	}
+	if headers, _ := got["headers"].(map[string]interface{}); headers["Idempotency-Key"] != "create-ada" {
+		t.Errorf("headers = %v", got["headers"])
+	}
+}
+
+func TestTransportUpstreamError(t *testing.T) {
+	status := http.StatusNotFound
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, status, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"type": "upstream_error", "code": map[int]string{404: CodeNotFound, 503: CodeCircuitOpen}[status],
+				"message": "Upstream returned 404", "status_code": status,
+			},
+			"meta": map[string]interface{}{"request_id": "req_err"},
+		})
+	})
+	hc := &http.Client{Transport: NewTransport(c, "users")}
+
+	resp, err := hc.Get("https://api.example.com/users/9")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || resp.Status != "404 Not Found" {
+		t.Errorf("status = %q", resp.Status)
+	}
+
+	// The proxy's own failures are errors, not upstream answers
+	status = http.StatusServiceUnavailable
+	if _, err := hc.Get("https://api.example.com/users/9"); !IsCircuitOpen(err) {
+		t.Errorf("err = %v, want an open circuit", err)
+	}
+}
+
+func TestTransportPassthrough(t *testing.T) {
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "direct "+r.URL.Path)
+	}))
+	defer direct.Close()
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("passthrough request reached the proxy: %s", r.URL)
+	})
+	hc := &http.Client{Transport: NewTransport(c, "files", WithTransportPassthrough("/uploads/*"))}
+
+	resp, err := hc.Get(direct.URL + "/uploads/a.bin")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "direct /uploads/a.bin" {
+		t.Errorf("body = %q", body)
+	}
+}
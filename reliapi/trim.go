@@ -0,0 +1,73 @@
+package reliapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Strategies of a ContextPolicy.
+const (
+	ContextStrategyError          = "error"
+	ContextStrategyTruncateOldest = "truncate_oldest"
+	ContextStrategyTruncateMiddle = "truncate_middle"
+)
+
+// ErrContextTooLong is returned by TrimMessages when the messages it may
+// not drop alone exceed the token budget.
+var ErrContextTooLong = errors.New("reliapi: prompt exceeds the token budget")
+
+// replyPrimingTokens is what CountTokens adds once per prompt.
+const replyPrimingTokens = 3
+
+// TrimMessages drops the oldest messages until the prompt fits maxTokens,
+// as the proxy does for a ContextPolicy with ContextStrategyTruncateOldest,
+// so callers can see the prompt that would be sent.
+//
+// System messages and the last user message, with any messages after it,
+// are never dropped, and tool results go together with the message before
+// them. Tokens are counted with CountTokens, whose errors are returned; a
+// prompt that can't be made to fit fails with ErrContextTooLong.
+func TrimMessages(model string, messages []ChatMessage, maxTokens int) ([]ChatMessage, error) {
+	sizes := make([]int, len(messages))
+	total := replyPrimingTokens
+	for i, m := range messages {
+		n, err := CountTokens(model, []ChatMessage{m})
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = n - replyPrimingTokens
+		total += sizes[i]
+	}
+
+	lastUser := len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			lastUser = i
+			break
+		}
+	}
+	dropped := make([]bool, len(messages))
+	for i := 0; i < lastUser && total > maxTokens; {
+		if messages[i].Role == "system" {
+			i++
+			continue
+		}
+		// Drop the message and the tool results that follow it
+		for first := true; i < lastUser && (first || messages[i].Role == "tool"); i++ {
+			first = false
+			dropped[i] = true
+			total -= sizes[i]
+		}
+	}
+	if total > maxTokens {
+		return nil, fmt.Errorf("%w: %d tokens, limit %d", ErrContextTooLong, total, maxTokens)
+	}
+
+	kept := make([]ChatMessage, 0, len(messages))
+	for i, m := range messages {
+		if !dropped[i] {
+			kept = append(kept, m)
+		}
+	}
+	return kept, nil
+}
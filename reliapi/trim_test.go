@@ -0,0 +1,121 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var trimHistory = []ChatMessage{
+	SystemMessage("Be brief."),
+	UserMessage(strings.Repeat("one ", 50)),
+	AssistantMessage(strings.Repeat("two ", 50)),
+	UserMessage(strings.Repeat("three ", 50)),
+	{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function"}}},
+	{Role: "tool", ToolCallID: "call_1", Content: strings.Repeat("result ", 40)},
+	UserMessage("And now?"),
+}
+
+func firstWords(messages []ChatMessage) []string {
+	words := make([]string, len(messages))
+	for i, m := range messages {
+		words[i] = strings.SplitN(m.Content, " ", 2)[0]
+	}
+	return words
+}
+
+func TestTrimMessages(t *testing.T) {
+	total, err := CountTokens("gpt-4o", trimHistory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := TrimMessages("gpt-4o", trimHistory, total); err != nil || len(got) != len(trimHistory) {
+		t.Fatalf("fitting prompt: %d messages, %v", len(got), err)
+	}
+
+	got, err := TrimMessages("gpt-4o", trimHistory, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words := strings.Join(firstWords(got), ","); words != "Be,three,,result,And" {
+		t.Errorf("kept %q", words)
+	}
+	if n, _ := CountTokens("gpt-4o", got); n > 120 {
+		t.Errorf("trimmed prompt is %d tokens", n)
+	}
+
+	// The tool call goes with its result
+	got, err = TrimMessages("gpt-4o", trimHistory, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words := strings.Join(firstWords(got), ","); words != "Be,And" {
+		t.Errorf("kept %q", words)
+	}
+}
+
+func TestTrimMessagesOversizedMessage(t *testing.T) {
+	huge := strings.Repeat("word ", 5000)
+	got, err := TrimMessages("gpt-4o", []ChatMessage{
+		SystemMessage("Be brief."), AssistantMessage(huge), UserMessage("Summarize."),
+	}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1].Content != "Summarize." {
+		t.Errorf("got %v", firstWords(got))
+	}
+
+	// The last user message is never dropped
+	_, err = TrimMessages("gpt-4o", []ChatMessage{SystemMessage("Be brief."), UserMessage(huge)}, 100)
+	if !errors.Is(err, ErrContextTooLong) {
+		t.Errorf("err = %v, want ErrContextTooLong", err)
+	}
+}
+
+func TestProxyLLMContextPolicy(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var sent struct {
+			ContextPolicy map[string]interface{} `json:"context_policy"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		if sent.ContextPolicy["max_prompt_tokens"] != float64(100) {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"success": false,
+				"error": map[string]interface{}{
+					"type": "client_error", "code": CodeContextLengthExceeded, "message": "Prompt is 130 tokens, over the limit of 50",
+					"status_code": 400, "details": map[string]interface{}{"prompt_tokens": 130, "max_prompt_tokens": 50},
+				},
+			})
+			return
+		}
+		if sent.ContextPolicy["strategy"] != ContextStrategyTruncateMiddle {
+			t.Errorf("context_policy = %v", sent.ContextPolicy)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "hi"},
+			"meta":    map[string]interface{}{"trimmed_messages": 3, "prompt_tokens_after_trim": 88},
+		})
+	})
+
+	req := llmReq("hi")
+	req.ContextPolicy = &ContextPolicy{MaxPromptTokens: 100, Strategy: ContextStrategyTruncateMiddle}
+	resp, err := c.ProxyLLM(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta.TrimmedMessages != 3 || resp.Meta.PromptTokensAfterTrim != 88 {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+
+	req.ContextPolicy = &ContextPolicy{MaxPromptTokens: 50}
+	if _, err := c.ProxyLLM(context.Background(), req); !IsContextLengthExceeded(err) {
+		t.Errorf("err = %v, want CONTEXT_LENGTH_EXCEEDED", err)
+	}
+}
@@ -0,0 +1,822 @@
+package reliapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi/wire"
+)
+
+// LLMRequest is the body of a POST /v1/proxy/llm call.
+//
+// Field names mirror app/schemas.py LLMProxyRequest. Optional fields are
+// pointers so that "unset" and the zero value stay distinguishable on the wire.
+type LLMRequest struct {
+	// Target names the target, or with LatencyRoutePrefix a latency route.
+	Target   string        `json:"target"`
+	Messages []ChatMessage `json:"messages"`
+	// Prompt is a completion-style prompt, sent as a single user message.
+	// Setting it together with Messages fails with ErrPromptAndMessages.
+	Prompt *string `json:"-"`
+	// Template renders the messages on the proxy from a stored prompt
+	// template (see UpsertTemplate) instead of Messages or Prompt, which
+	// must be left empty (ErrTemplateAndMessages).
+	Template *TemplateRef `json:"template,omitempty"`
+	// ConversationID continues a conversation whose history the proxy
+	// keeps (see GetConversation): AppendMessages are sent after it and,
+	// with the reply, stored as its next turn once the request succeeds.
+	// An unknown ID starts a conversation. Messages, Prompt and Template
+	// must be left empty (ErrConversationAndMessages). A request while
+	// another turn of the conversation runs fails with
+	// CodeConversationConflict (IsConversationConflict); such requests are
+	// never coalesced or cached locally. Meta.ConversationTokens reports
+	// the history's size.
+	ConversationID *string       `json:"conversation_id,omitempty"`
+	AppendMessages []ChatMessage `json:"append_messages,omitempty"`
+	// Model is the model to use, the target's default if empty. A name of
+	// one of the target's TargetConfig.ModelAliases, or AliasPrefix and
+	// the name, is resolved by the proxy; see Meta.ResolvedModel.
+	Model          string   `json:"model,omitempty"`
+	MaxTokens      *int     `json:"max_tokens,omitempty"`
+	Temperature    *float64 `json:"temperature,omitempty"`
+	TopP           *float64 `json:"top_p,omitempty"`
+	Stop           []string `json:"stop,omitempty"`
+	Stream         *bool    `json:"stream,omitempty"`
+	IdempotencyKey *string  `json:"idempotency_key,omitempty"`
+	// IdempotencyTTL is how many seconds the proxy honors IdempotencyKey,
+	// up to the target's IdempotencyMaxTTLSeconds; nil means the client's
+	// WithDefaultIdempotencyTTL, or else the response's cache TTL. A
+	// request replayed after that runs again.
+	IdempotencyTTL *int `json:"idempotency_ttl_s,omitempty"`
+	Cache          *int `json:"cache,omitempty"`
+
+	// CacheKey pins an explicit cache key in place of the one derived from
+	// the request body. Target and model still participate, so changing
+	// either always misses.
+	CacheKey *string `json:"cache_key,omitempty"`
+	// CacheVary restricts which fields are hashed into the cache key, e.g.
+	// []string{"messages"} to ignore temperature jitter. Allowed: messages,
+	// max_tokens, temperature, top_p, stop. Ignored when CacheKey is set.
+	CacheVary []string `json:"cache_vary,omitempty"`
+	// CacheMode selects how expired cache entries are treated; empty means
+	// CacheStandard. Ignored for streaming requests.
+	CacheMode CacheMode `json:"cache_mode,omitempty"`
+
+	// Fallbacks are tried in order when Target fails with a retryable
+	// upstream error (429, 5xx, open circuit); 4xx errors never fall
+	// through. The idempotency key covers the whole chain, and Meta.ServedBy
+	// reports which target answered. Ignored for streaming requests.
+	Fallbacks []FallbackTarget `json:"fallbacks,omitempty"`
+	// Fallback is a static completion the proxy returns when Target and
+	// every fallback fail with a retryable error, in place of the target's
+	// configured fallback_response. Ignored for streaming requests.
+	Fallback *FallbackResponse `json:"fallback_response,omitempty"`
+
+	// Credential pins one of the target's named credentials instead of
+	// the proxy's weighted rotation; a name the target lacks or has
+	// disabled fails with CodeUnknownCredential. Fallback targets without
+	// it rotate as usual. Meta.CredentialName reports the one used.
+	Credential *string `json:"credential,omitempty"`
+
+	// Retry overrides the target's upstream retry policy for this request,
+	// including each fallback. Ignored for streaming requests.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// MaxCostUSD makes the proxy reject the request before calling the
+	// upstream if its estimated cost for Model and MaxTokens exceeds it. The
+	// rejection is a BUDGET_EXCEEDED *APIError; AsBudgetExceeded returns the
+	// estimate. An estimate equal to MaxCostUSD is allowed, and models the
+	// proxy has no pricing for are never rejected.
+	MaxCostUSD *float64 `json:"max_cost_usd,omitempty"`
+
+	// Tools are the functions the model may call, in OpenAI's format; the
+	// proxy translates them for Anthropic targets. The calls come back in
+	// Choice.ToolCalls. Tools can't be combined with Stream.
+	Tools []ToolDefinition `json:"tools,omitempty"`
+	// ToolChoice is ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired or
+	// ForceTool(name); nil leaves the choice to the provider.
+	ToolChoice interface{} `json:"tool_choice,omitempty"`
+	// ResponseFormat asks for JSON output; Choice.DecodeJSON decodes it. A
+	// "json_schema" format constrains models with structured outputs to
+	// the schema. For other models, such as Anthropic's, the proxy fails
+	// with CodeUnsupportedParameter naming the model, unless
+	// ResponseFormatFallback is ResponseFormatFallbackJSONMode.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	// ResponseFormatFallback is ResponseFormatFallbackJSONMode to have the
+	// proxy ask models without structured outputs for a "json_object" with
+	// the schema in the system prompt. The output is then not guaranteed to
+	// match the schema; ValidateOutput with it as OutputSchema checks it.
+	ResponseFormatFallback string `json:"response_format_fallback,omitempty"`
+	// Logprobs asks for the log probability of each generated token, in
+	// Choice.Logprobs, or ChatCompletionChunk.Logprobs and Stream.Logprobs
+	// when streaming. Only models whose ModelCapabilities.SupportsLogprobs
+	// is set return them; others fail with CodeModelLimitsExceeded.
+	// TopLogprobs, up to MaxTopLogprobs, adds the likeliest alternatives at
+	// each position, as LabelProbability needs.
+	Logprobs    *bool `json:"logprobs,omitempty"`
+	TopLogprobs *int  `json:"top_logprobs,omitempty"`
+	// OutputSchema is a JSON Schema the completion's content must satisfy
+	// when ValidateOutput is set; it is ignored otherwise.
+	OutputSchema json.RawMessage `json:"output_schema,omitempty"`
+	// ValidateOutput makes the proxy parse the content as JSON and check it
+	// against OutputSchema. Output that fails is never cached, and the call
+	// fails with OUTPUT_VALIDATION_FAILED (see AsOutputValidationFailed).
+	// It can't be combined with Stream or Tools.
+	ValidateOutput bool `json:"validate_output,omitempty"`
+	// RepairAttempts is how many times the proxy re-prompts the model with
+	// the violations before failing, at most 3. Every attempt is billed.
+	RepairAttempts int `json:"repair_attempts,omitempty"`
+
+	// TimeoutMs bounds the proxy's upstream call in milliseconds, including
+	// its retries and their backoff, up to the target's MaxTimeoutMs. When
+	// it passes the call fails with UPSTREAM_TIMEOUT (see AsUpstreamTimeout).
+	// For streams it bounds each wait for the next chunk. When nil,
+	// ProxyLLM and ProxyLLMStream send the time left until ctx's deadline;
+	// ProxyLLMBatch does not, as queued items may start late.
+	TimeoutMs *int `json:"timeout_ms,omitempty"`
+	// Priority is the request's class in the queue of a target with a rate
+	// budget: PriorityInteractive, PriorityDefault (the default) or
+	// PriorityBatch. Over the budget, higher classes go first and a full
+	// queue turns away the lowest; see Meta.QueueWaitMs.
+	Priority string `json:"priority,omitempty"`
+	// QueueTimeoutMs is how long the request may wait in the target's
+	// queue, instead of the target's queue timeout. Requests that find the
+	// queue full or don't get their turn in time fail with QUEUE_FULL,
+	// which IsRetriable reports, with a RetryAfter.
+	QueueTimeoutMs int `json:"queue_timeout_ms,omitempty"`
+	// MaxWaitMs is how long the request may wait for a slot under the
+	// target's TargetConfig.MaxConcurrency, instead of its
+	// ConcurrencyWaitMs. Requests that get none in time fail with
+	// CONCURRENCY_LIMIT (see IsConcurrencyLimit) and are not sent.
+	MaxWaitMs int `json:"max_wait_ms,omitempty"`
+	// Hedge makes the proxy send backup requests while the first has not
+	// answered, returning whichever answers first. It needs IdempotencyKey
+	// or a target with caching, and can't be combined with Stream. Canceled
+	// requests may still be billed; see Meta.HedgeCostUSD.
+	Hedge *HedgePolicy `json:"hedge,omitempty"`
+	// CacheSemantic makes the proxy answer an exact cache miss with the
+	// cached response whose final user message means about the same; see
+	// Meta.SemanticCacheHit. Only responses of the same target, model,
+	// system prompt, Temperature and Tools are candidates. It can't be
+	// combined with Stream.
+	CacheSemantic *SemanticCacheConfig `json:"cache_semantic,omitempty"`
+	// ContextPolicy makes the proxy fit Messages to a prompt token budget
+	// before calling the upstream, instead of sending a prompt the
+	// provider will reject. Meta.TrimmedMessages reports what it dropped;
+	// TrimMessages previews the result locally.
+	ContextPolicy *ContextPolicy `json:"context_policy,omitempty"`
+	// Strict false makes the proxy fit a request outside what its model
+	// accepts, instead of failing it with CodeModelLimitsExceeded (see
+	// AsModelLimitsExceeded): MaxTokens and Temperature are clamped to the
+	// model's limits and sampling parameters it doesn't take are dropped,
+	// as Meta.Adjustments reports. A prompt over the context window, or
+	// Tools or images the model lacks, still fail. nil means true;
+	// ValidateRequest runs the same checks locally.
+	Strict *bool `json:"strict,omitempty"`
+	// DryRun makes the proxy validate and price the request without calling
+	// the upstream: the response has null Data and Meta.DryRun set, with
+	// the cache key, cost estimate and target version the request would
+	// get. Nothing is charged, cached or recorded. See Client.Validate.
+	DryRun bool `json:"dry_run,omitempty"`
+	// IncludeRaw makes the proxy return the provider's response as it was,
+	// before it was normalized to the OpenAI-like shape Data has, in
+	// Meta.RawProviderResponse; e.g. for fields of Anthropic or Gemini
+	// responses the normalized shape lacks. Cache hits have none.
+	IncludeRaw bool `json:"include_raw,omitempty"`
+	// ResponseFilter makes the proxy return only the fields of Data it
+	// selects: comma-separated paths of field names, [n] for an array
+	// element (negative from the end) and [*] for every element, as in
+	// "content, usage.total_tokens". Data keeps its shape, so it decodes
+	// into the same types, and Meta.OriginalBytes and Meta.FilteredBytes
+	// report the sizes. A filter that doesn't parse is a 400 *APIError
+	// with CodeBadRequest naming the position. It can't be combined with
+	// Stream; see SelectFields.
+	ResponseFilter *string `json:"response_filter,omitempty"`
+	// FilterBeforeCache caches the filtered response instead of the whole
+	// one, under a key of its own, so cache hits are small too.
+	FilterBeforeCache bool `json:"filter_before_cache,omitempty"`
+	// RawPassthrough makes Data the provider's response body as it sent
+	// it, byte for byte, instead of the normalized completion; see
+	// ReliAPIResponse.RawData. Completion still decodes it. Cached and
+	// replayed responses keep the bytes too. It can't be combined with
+	// Stream, ResponseFilter, Compare, SubmitLLM or ProxyLLMBatch.
+	RawPassthrough bool `json:"raw_passthrough,omitempty"`
+	// Compare also runs a variant of the request, at batch priority, and
+	// reports its completion, cost, latency and similarity to this one in
+	// Meta.Comparison; Data is this request's. Both legs are charged. It
+	// can't be combined with Stream, SubmitLLM or ProxyLLMBatch, and the
+	// client neither coalesces nor locally caches such requests.
+	Compare *CompareConfig `json:"compare,omitempty"`
+	// CompareSampleRate is the fraction of requests, in (0, 1], Compare
+	// runs for; zero means all of them.
+	CompareSampleRate float64 `json:"compare_sample_rate,omitempty"`
+	// CallbackURL receives a signed job.completed event with the result
+	// of a request sent with SubmitLLM; verify it with VerifyWebhook. It
+	// must be a public http(s) URL, and the proxy needs
+	// RELIAPI_WEBHOOK_SECRET set; other methods reject it.
+	CallbackURL string `json:"callback_url,omitempty"`
+
+	// Tags attribute the request's usage and cost to e.g. a product
+	// feature, {"feature": "search"}; UsageByTag groups a usage report by
+	// them. They are merged over the WithTags defaults. At most MaxTags,
+	// with keys of letters, digits, '_' and '-'.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// TenantID selects the API key the request authenticates with, via
+	// WithTenantKeyProvider. It is not sent to the proxy, and it is ignored
+	// for items of ProxyLLMBatch; use BatchOptions.TenantID instead.
+	TenantID string `json:"-"`
+
+	// AllowRepeats exempts the request from WithLoopGuard, for workloads
+	// that legitimately send it over and over. It is not sent to the
+	// proxy.
+	AllowRepeats bool `json:"-"`
+}
+
+// AliasPrefix marks an LLMRequest.Model as a model alias of the target. An
+// alias named with it that the target doesn't define is a 400 *APIError
+// with CodeBadRequest, where a bare unknown name is sent on as a model.
+const AliasPrefix = "alias:"
+
+// LatencyRoutePrefix marks an LLMRequest.Target as a latency route, a
+// virtual target of the proxy (latency_routes) that sends each request to
+// the fastest of its candidate targets whose circuit is closed, reported
+// as Meta.RoutedTo. An unknown route is a 400 *APIError with
+// CodeBadRequest.
+const LatencyRoutePrefix = "auto:"
+
+// Priority classes of LLMRequest.Priority, highest first.
+const (
+	PriorityInteractive = "interactive"
+	PriorityDefault     = "default"
+	PriorityBatch       = "batch"
+)
+
+// HedgePolicy configures LLMRequest.Hedge.
+type HedgePolicy struct {
+	// DelayMs is how long to wait for an answer before each backup
+	// request, 1 to 60000.
+	DelayMs int `json:"delay_ms"`
+	// MaxHedges is the most backup requests to send, 1 to 3; 0 means 1.
+	MaxHedges int `json:"max_hedges,omitempty"`
+}
+
+// SemanticCacheConfig configures LLMRequest.CacheSemantic.
+type SemanticCacheConfig struct {
+	// Threshold is the cosine similarity, between 0 and 1 exclusive, a
+	// cached prompt's embedding must exceed to be served.
+	Threshold float64 `json:"threshold"`
+	// EmbeddingModel embeds the prompts on the request's target; empty
+	// uses the target's embedding model. Embeddings are billed like
+	// ProxyEmbeddings calls.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+}
+
+// ContextPolicy configures LLMRequest.ContextPolicy.
+type ContextPolicy struct {
+	// MaxPromptTokens is the most prompt tokens to send, as the proxy
+	// counts them for the target's model (see CountTokens).
+	MaxPromptTokens int `json:"max_prompt_tokens"`
+	// Strategy is ContextStrategyError, which fails an oversized prompt
+	// with CONTEXT_LENGTH_EXCEEDED (see IsContextLengthExceeded), or
+	// ContextStrategyTruncateOldest or ContextStrategyTruncateMiddle, which
+	// drop the oldest messages or those nearest the middle first. System
+	// messages and the last user message are never dropped; a prompt they
+	// alone overflow fails the same way. Empty means ContextStrategyError.
+	Strategy string `json:"strategy,omitempty"`
+}
+
+// FallbackTarget names a target, and optionally a model on it, to fall back
+// to from an LLMRequest. An empty Model uses the target's default.
+type FallbackTarget struct {
+	Target string `json:"target"`
+	Model  string `json:"model,omitempty"`
+}
+
+// FallbackResponse is a static completion served when the upstream fails.
+// The response reads like any other, with Meta.FallbackServed set, zero
+// cost and the failure in Meta.UpstreamError. The proxy never caches it.
+type FallbackResponse struct {
+	Content string `json:"content"`
+	// FinishReason defaults to "stop".
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// HTTPRequest is the body of a POST /v1/proxy/http call.
+type HTTPRequest struct {
+	Target         string                 `json:"target"`
+	Method         string                 `json:"method"`
+	Path           string                 `json:"path"`
+	Headers        map[string]string      `json:"headers,omitempty"`
+	Query          map[string]interface{} `json:"query,omitempty"`
+	Body           *string                `json:"body,omitempty"`
+	IdempotencyKey *string                `json:"idempotency_key,omitempty"`
+	// IdempotencyTTL is how many seconds the proxy honors IdempotencyKey;
+	// see LLMRequest.IdempotencyTTL.
+	IdempotencyTTL *int `json:"idempotency_ttl_s,omitempty"`
+	Cache          *int `json:"cache,omitempty"`
+
+	// QueryArrayFormat is how slice values in Query are sent; empty means
+	// QueryArrayRepeat. Query values are strings, numbers, booleans, nil or
+	// flat slices of those; other values fail with ErrInvalidQuery before
+	// the request is sent.
+	QueryArrayFormat QueryArrayFormat `json:"query_array_format,omitempty"`
+
+	// BodyEncoding is how Body is encoded: BodyEncodingUTF8 (the default)
+	// or BodyEncodingBase64.
+	BodyEncoding string `json:"body_encoding,omitempty"`
+	// BodyBase64 is a binary body as base64, in place of Body.
+	BodyBase64 *string `json:"body_base64,omitempty"`
+	// BodyBytes is a binary body, such as a PDF or image upload, in place of
+	// Body. The client sends it as BodyBase64.
+	BodyBytes []byte `json:"-"`
+
+	// CacheKey pins an explicit cache key for GET/HEAD caching. Target and
+	// method still participate.
+	CacheKey *string `json:"cache_key,omitempty"`
+	// CacheVary restricts which fields are hashed into the cache key.
+	// Allowed: path, query, headers, body. Ignored when CacheKey is set.
+	CacheVary []string `json:"cache_vary,omitempty"`
+	// CacheMode selects how expired cache entries are treated; empty means
+	// CacheStandard. Only applies to GET/HEAD.
+	CacheMode CacheMode `json:"cache_mode,omitempty"`
+
+	// Retry overrides the target's upstream retry policy for this request.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// IfNoneMatch holds the ETag(s) the caller already has, as in an
+	// If-None-Match header. When the response's ETag matches (weak
+	// comparison, so W/"x" matches "x"), the proxy answers with empty Data
+	// and Meta.NotModified set, from its cache or the upstream's 304.
+	IfNoneMatch string `json:"if_none_match,omitempty"`
+	// PreferDelta asks for the response as a patch of the one whose
+	// Meta.DataVersion is DeltaBase, from proxies that support it; see
+	// WithDeltaResponses, which sets both. Without it, Data is the patch.
+	PreferDelta bool   `json:"prefer_delta,omitempty"`
+	DeltaBase   string `json:"delta_base,omitempty"`
+	// ResponseHeaders names the upstream response headers to return in
+	// Meta.UpstreamHeaders, such as "ETag" or "Link"; ["*"] returns all of
+	// them. Hop-by-hop headers are never returned.
+	ResponseHeaders []string `json:"response_headers,omitempty"`
+
+	// FollowRedirects overrides the target's TargetConfig.FollowRedirects.
+	// An unfollowed redirect is returned like any other response: Data
+	// holds its 3xx status_code and its Location header.
+	FollowRedirects *bool `json:"follow_redirects,omitempty"`
+	// MaxRedirects overrides the target's TargetConfig.MaxRedirects. When
+	// the limit is reached the last 3xx is returned as it is.
+	MaxRedirects *int `json:"max_redirects,omitempty"`
+	// TimeoutMs bounds the upstream call, retries included, and is derived
+	// from ctx's deadline when nil, as for LLMRequest.TimeoutMs. For
+	// ProxyHTTPStream it bounds the wait for the upstream's headers.
+	TimeoutMs *int `json:"timeout_ms,omitempty"`
+	// MaxResponseBytes overrides the target's TargetConfig.MaxResponseBytes:
+	// larger upstream bodies fail with a RESPONSE_TOO_LARGE error (see
+	// IsResponseTooLarge), or with TruncateResponse come back cut to that
+	// size with Meta.Truncated set. Truncated responses are never cached.
+	MaxResponseBytes *int `json:"max_response_bytes,omitempty"`
+	TruncateResponse bool `json:"truncate_response,omitempty"`
+	// Multipart sends a multipart/form-data body built by the proxy, in
+	// place of Body; see NewMultipartFromFiles. It requires a POST, PUT or
+	// PATCH, and such requests are never cached or coalesced.
+	Multipart *MultipartBody `json:"multipart,omitempty"`
+	// DryRun validates the request without calling the upstream; see
+	// LLMRequest.DryRun and Client.ValidateHTTP.
+	DryRun bool `json:"dry_run,omitempty"`
+	// ResponseFilter and FilterBeforeCache select the fields of a JSON
+	// upstream body kept in Data, as for LLMRequest; paths start at the
+	// body. Binary bodies are returned whole. They can't be combined with
+	// StreamResponse.
+	ResponseFilter    *string `json:"response_filter,omitempty"`
+	FilterBeforeCache bool    `json:"filter_before_cache,omitempty"`
+	// RawPassthrough makes Data the upstream body as it sent it, byte for
+	// byte, instead of {status_code, headers, body}; see
+	// ReliAPIResponse.RawData. The status is in Meta.UpstreamStatus and the
+	// headers named in ResponseHeaders in Meta.UpstreamHeaders. It can't be
+	// combined with ResponseFilter or StreamResponse.
+	RawPassthrough bool `json:"raw_passthrough,omitempty"`
+
+	// StreamResponse asks the proxy to relay the upstream body as it
+	// arrives instead of buffering it into Data. ProxyHTTPStream sets it;
+	// it can't be combined with IdempotencyKey or a CacheMode.
+	StreamResponse bool `json:"stream_response,omitempty"`
+
+	// Credential pins one of the target's named credentials; see
+	// LLMRequest.Credential.
+	Credential *string `json:"credential,omitempty"`
+
+	// Tags attribute the request's usage; see LLMRequest.Tags.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// TenantID selects the API key the request authenticates with, via
+	// WithTenantKeyProvider. It is not sent to the proxy.
+	TenantID string `json:"-"`
+}
+
+// RetryPolicy is how the proxy retries the upstream call of one request,
+// replacing the target's retry_matrix. Zero fields other than MaxAttempts
+// use the proxy's defaults: 1000ms backoff doubling up to 60000ms, retrying
+// 429, 500, 502, 503 and 504. Network errors and timeouts are always
+// retried while attempts remain.
+//
+// MaxAttempts 1 calls the upstream at most once, even on a timeout: the
+// proxy skips retries and key-pool switches, and the client does not resend
+// the request under WithRetry.
+type RetryPolicy struct {
+	// MaxAttempts is the number of upstream calls, including the first
+	// (1-10).
+	MaxAttempts  int   `json:"max_attempts"`
+	BackoffMs    int   `json:"backoff_ms,omitempty"`
+	MaxBackoffMs int   `json:"max_backoff_ms,omitempty"`
+	RetryOn      []int `json:"retry_on,omitempty"`
+}
+
+// CacheMode controls whether the proxy may answer from an expired cache
+// entry. In the stale modes the proxy keeps entries for a while past their
+// TTL (the target's cache.stale_ttl_s); entries written by standard-mode
+// requests are not kept.
+type CacheMode string
+
+const (
+	// CacheStandard treats expired entries as misses.
+	CacheStandard CacheMode = "standard"
+	// CacheStaleWhileRevalidate serves an expired entry immediately, with
+	// Meta.Stale set, and refreshes it in the background. Concurrent hits on
+	// the same entry trigger a single refresh.
+	CacheStaleWhileRevalidate CacheMode = "stale_while_revalidate"
+	// CacheStaleIfError calls the upstream and serves an expired entry only
+	// if the call fails with a retryable error after retries. The failure is
+	// reported in Meta.RevalidationError.
+	CacheStaleIfError CacheMode = "stale_if_error"
+	// CacheOnlyIfCached serves a fresh entry and fails anything else with a
+	// 404 *APIError with CodeCacheMiss, so the upstream is never called.
+	CacheOnlyIfCached CacheMode = "only_if_cached"
+)
+
+// Meta carries the proxy's per-request metadata (app/schemas.py MetaResponse).
+type Meta struct {
+	Target            string   `json:"target,omitempty"`
+	Provider          string   `json:"provider,omitempty"`
+	Model             string   `json:"model,omitempty"`
+	CacheHit          bool     `json:"cache_hit"`
+	IdempotentHit     bool     `json:"idempotent_hit"`
+	Retries           int      `json:"retries"`
+	DurationMs        int      `json:"duration_ms"`
+	RequestID         string   `json:"request_id"`
+	TraceID           string   `json:"trace_id,omitempty"`
+	CostUSD           *float64 `json:"cost_usd,omitempty"`
+	CostEstimateUSD   *float64 `json:"cost_estimate_usd,omitempty"`
+	CostPolicyApplied string   `json:"cost_policy_applied,omitempty"`
+	MaxTokensReduced  bool     `json:"max_tokens_reduced"`
+	OriginalMaxTokens *int     `json:"original_max_tokens,omitempty"`
+	FallbackUsed      bool     `json:"fallback_used"`
+	FallbackTarget    string   `json:"fallback_target,omitempty"`
+	// Adjustments are the changes that fitted a request with Strict false
+	// to its model.
+	Adjustments []Adjustment `json:"adjustments,omitempty"`
+	// ConversationTokens is the estimated prompt size of the conversation
+	// history after this turn, for requests with LLMRequest.ConversationID.
+	ConversationTokens int `json:"conversation_tokens,omitempty"`
+	// ServedBy is the target that produced the response: the requested
+	// target, or the fallback that took over from it.
+	ServedBy string `json:"served_by,omitempty"`
+	// CredentialName is the target's named credential the upstream call
+	// was made with: the pinned one, else the one rotation picked, which
+	// stays the same for every attempt under one idempotency key. Empty
+	// for targets without named credentials and for cache hits.
+	CredentialName string `json:"credential_name,omitempty"`
+	// UpstreamRateLimit is the rate limit the upstream reported to that
+	// credential (or key pool key) with its answer; nil if it reported
+	// none. The proxy holds requests while none remain, so callers rarely
+	// see the upstream's 429s; RateLimit reports the limits of a target.
+	UpstreamRateLimit *UpstreamRateLimit `json:"upstream_rate_limit,omitempty"`
+	// RawProviderResponse is the provider's response before normalization,
+	// for LLM requests sent with IncludeRaw.
+	RawProviderResponse json.RawMessage `json:"raw_provider_response,omitempty"`
+	// CacheKey is the resolved cache key hash; compare it across requests
+	// to debug unexpected cache misses.
+	CacheKey string `json:"cache_key,omitempty"`
+	// CacheStored reports that the response was admitted to the proxy's
+	// cache. A response too large for every cache tier (see CacheStats) is
+	// not stored, whatever its CacheTTL; it is also false when the response
+	// was not offered to the cache at all, as for a hit.
+	CacheStored bool `json:"cache_stored,omitempty"`
+	// Stale reports that the response is a cached entry past its TTL,
+	// served under CacheStaleWhileRevalidate or CacheStaleIfError.
+	Stale bool `json:"stale"`
+	// CacheAgeSeconds is how old the cached response is. It is only
+	// reported by cache hits under the stale cache modes.
+	CacheAgeSeconds int `json:"cache_age_s,omitempty"`
+	// RevalidationError is the upstream failure that made the proxy serve
+	// a stale entry under CacheStaleIfError.
+	RevalidationError *APIError `json:"revalidation_error,omitempty"`
+	// FallbackServed reports that the response is the static
+	// FallbackResponse, served because the upstream failed with
+	// UpstreamError.
+	FallbackServed bool      `json:"fallback_served,omitempty"`
+	UpstreamError  *APIError `json:"upstream_error,omitempty"`
+	// Attempts is the number of upstream calls the proxy made, including
+	// retries; 0 when the response did not come from the upstream.
+	Attempts int `json:"attempts,omitempty"`
+	// RetryDelaysMs holds the delay before each retry, in milliseconds.
+	RetryDelaysMs []int `json:"retry_delays_ms,omitempty"`
+	// AttemptsSkippedForDeadline is the number of retries the proxy did
+	// not make because they couldn't finish before the request's deadline:
+	// its TimeoutMs, or the time left on the caller's ctx.
+	AttemptsSkippedForDeadline int `json:"attempts_skipped_for_deadline,omitempty"`
+	// ValidationAttempts is the number of completions checked against
+	// LLMRequest.OutputSchema, 1 plus any repairs; 0 without ValidateOutput.
+	ValidationAttempts int `json:"validation_attempts,omitempty"`
+	// OutputValid reports whether the content satisfied the schema; nil
+	// without ValidateOutput.
+	OutputValid *bool `json:"output_valid,omitempty"`
+	// Hedged reports that the proxy sent a backup request under
+	// LLMRequest.Hedge.
+	Hedged bool `json:"hedged,omitempty"`
+	// HedgeWinner is which request answered: 0 for the first, n for the
+	// nth backup.
+	HedgeWinner int `json:"hedge_winner,omitempty"`
+	// HedgeCostUSD is the estimated cost of the canceled requests, which
+	// the provider bills. It is included in CostUSD.
+	HedgeCostUSD float64 `json:"hedge_cost_usd,omitempty"`
+	// SemanticCacheHit reports that the cached response was found by
+	// prompt similarity under LLMRequest.CacheSemantic; CacheHit is also
+	// set, and CacheKey names the entry served.
+	SemanticCacheHit bool `json:"semantic_cache_hit,omitempty"`
+	// SemanticSimilarity is the cosine similarity of the served entry's
+	// prompt to the request's.
+	SemanticSimilarity float64 `json:"semantic_similarity,omitempty"`
+	// TrimmedMessages is how many messages the proxy dropped under
+	// LLMRequest.ContextPolicy.
+	TrimmedMessages int `json:"trimmed_messages,omitempty"`
+	// PromptTokensAfterTrim is the estimated prompt size of the messages
+	// sent under LLMRequest.ContextPolicy; 0 without one.
+	PromptTokensAfterTrim int `json:"prompt_tokens_after_trim,omitempty"`
+	// CircuitState is the target's circuit breaker state (CircuitOpen)
+	// when the proxy rejected the request because its circuit is open.
+	CircuitState string `json:"circuit_state,omitempty"`
+	// CircuitKey names the circuit breaker that governed the request: the
+	// target, or "<target>:model=<model>" and "<target>:credential=<name>"
+	// under CircuitScopeModel and CircuitScopeCredential.
+	CircuitKey string `json:"circuit_key,omitempty"`
+	// ResponseEncoding is how a ProxyHTTP result's body was encoded by the
+	// proxy: BodyEncodingUTF8, or BodyEncodingBase64 when the upstream sent a
+	// binary content type or bytes that are not UTF-8. ProxyHTTP decodes
+	// base64 bodies, leaving their bytes as a []byte in Data["body"]. For
+	// a RawPassthrough response it is how Data itself is encoded.
+	ResponseEncoding string `json:"response_encoding,omitempty"`
+	// RawPassthrough reports that Data is the upstream body as it was
+	// sent, for requests with RawPassthrough. It is unset when the proxy
+	// had no such body to return, e.g. for a static fallback response.
+	RawPassthrough bool `json:"raw_passthrough,omitempty"`
+	// BudgetRemainingUSD is what is left of the API key's monthly budget
+	// after this request, and of the tenant's once 80% of it is spent; the
+	// smaller of the two when both apply. It is nil when neither does.
+	// Past it, requests fail with KEY_BUDGET_EXCEEDED or BUDGET_EXCEEDED.
+	BudgetRemainingUSD *float64 `json:"budget_remaining_usd,omitempty"`
+	// RateLimitRemaining is how many more requests the API key may make in
+	// the current minute; nil when the proxy has no rate limit for the key.
+	// Past it, requests fail with RATE_LIMIT_RELIAPI and a RetryAfter.
+	RateLimitRemaining *int `json:"rate_limit_remaining,omitempty"`
+	// TargetVersion is the version of the target config the request ran
+	// with (see Target.Version); it changes whenever UpsertTarget replaces
+	// the target.
+	TargetVersion int `json:"target_version,omitempty"`
+	// Coalesced reports that the response was shared from a concurrent
+	// identical request under WithCoalescing instead of fetched by this call.
+	Coalesced bool `json:"-"`
+	// LocalCacheHit reports that the response came from the client's
+	// WithLocalCache store without a proxy call; CacheHit is set as well.
+	LocalCacheHit bool `json:"-"`
+	// CompressedBytes and UncompressedBytes are the size of the response
+	// body as sent and once decompressed, when the proxy gzipped it (see
+	// WithCompression); both are 0 otherwise.
+	CompressedBytes   int64 `json:"-"`
+	UncompressedBytes int64 `json:"-"`
+	// RedactionsApplied is the number of values replaced with placeholders
+	// before the prompt was sent on: by the target's redaction config on
+	// the proxy, plus by the client's WithRedactor.
+	RedactionsApplied int `json:"redactions_applied,omitempty"`
+	// QueueWaitMs is how long the request waited in its target's queue for
+	// the rate budget (see LLMRequest.Priority).
+	QueueWaitMs int `json:"queue_wait_ms,omitempty"`
+	// ConcurrencyWaitMs is how long the request waited for a slot under
+	// its target's max concurrency (see LLMRequest.MaxWaitMs).
+	ConcurrencyWaitMs int `json:"concurrency_wait_ms,omitempty"`
+	// ResolvedTarget and ResolvedModel are where a model alias sent the
+	// request (see LLMRequest.Model); both are empty without one.
+	ResolvedTarget string `json:"resolved_target,omitempty"`
+	ResolvedModel  string `json:"resolved_model,omitempty"`
+	// RoutedTo is the candidate target a latency route sent the request to
+	// (see LatencyRoutePrefix); empty for other targets.
+	RoutedTo string `json:"routed_to,omitempty"`
+	// TemplateName and TemplateVersion are the prompt template the
+	// messages were rendered from (see LLMRequest.Template).
+	TemplateName    string `json:"template_name,omitempty"`
+	TemplateVersion int    `json:"template_version,omitempty"`
+	// CostEstimated reports that the provider sent no usage for a stream,
+	// so Stream.Usage and CostUSD are estimated from its text.
+	CostEstimated bool `json:"cost_estimated,omitempty"`
+	// Aborted reports that a Stream was closed or canceled before the
+	// proxy's "done" event. Stream.Usage then estimates the tokens received
+	// so far; the proxy charges what the provider generated until then.
+	Aborted bool `json:"-"`
+	// Revalidated reports that the proxy's cached response had expired and
+	// was reused after a conditional upstream request (ETag or
+	// Last-Modified) answered 304.
+	Revalidated bool `json:"revalidated"`
+	// NotModified reports that the response matched HTTPRequest.IfNoneMatch;
+	// Data is then empty and UpstreamStatus is 304.
+	NotModified bool `json:"not_modified"`
+	// UpstreamStatus is the status code of the upstream's response to a
+	// ProxyHTTP or ProxyHTTPStream call.
+	UpstreamStatus int `json:"upstream_status,omitempty"`
+	// UpstreamHeaders holds the upstream response headers named in
+	// HTTPRequest.ResponseHeaders, keyed by lower-case name with every value
+	// of a repeated header. Cache hits return them too. ProxyHTTPStream
+	// fills it with all the upstream's headers.
+	UpstreamHeaders map[string][]string `json:"upstream_headers,omitempty"`
+	// DataVersion identifies Data, full or patched, as the base of a
+	// delta (see WithDeltaResponses); set by proxies supporting deltas.
+	DataVersion string `json:"data_version,omitempty"`
+	// Delta describes a response sent as a patch under WithDeltaResponses,
+	// which rebuilt Data from it; nil for full responses.
+	Delta *DeltaMeta `json:"delta,omitempty"`
+	// RedirectChain lists the URLs the proxy requested when it followed
+	// upstream redirects: the original URL, then each redirect. It is empty
+	// when no redirect was followed.
+	RedirectChain []string `json:"redirect_chain,omitempty"`
+	// Truncated reports that the upstream body was cut to the request's
+	// MaxResponseBytes; OriginalContentLength is the Content-Length the
+	// upstream declared for it, 0 if none.
+	Truncated             bool  `json:"truncated,omitempty"`
+	OriginalContentLength int64 `json:"original_content_length,omitempty"`
+	// OriginalBytes and FilteredBytes are the sizes, as compact JSON, of
+	// the data a ResponseFilter was applied to and of what it kept.
+	OriginalBytes int64 `json:"original_bytes,omitempty"`
+	FilteredBytes int64 `json:"filtered_bytes,omitempty"`
+	// Comparison is the variant leg of a request sent with
+	// LLMRequest.Compare; see ReliAPIResponse.Comparison.
+	Comparison *Comparison `json:"comparison,omitempty"`
+	// FaultInjected names the faults injected into the request, e.g.
+	// "latency_2000ms", comma-separated; see FaultHeader.
+	FaultInjected string `json:"fault_injected,omitempty"`
+	// Tags are the tags the request's usage was counted under. A value
+	// past the proxy's distinct-value limit for its key reads "~0" to
+	// "~f", the hashed bucket it was folded into.
+	Tags map[string]string `json:"tags,omitempty"`
+	// DryRun reports a response to a dry-run request, which has no Data;
+	// CacheEntryExists whether the request would have been a cache hit.
+	DryRun           bool `json:"dry_run,omitempty"`
+	CacheEntryExists bool `json:"cache_entry_exists,omitempty"`
+	// UpstreamRequest is the request a ProxyHTTP dry run would have sent
+	// upstream, once the target's transformation rules rewrote it.
+	UpstreamRequest *UpstreamRequest `json:"upstream_request,omitempty"`
+	// TransformationsApplied names the target's transformation rules that
+	// rewrote a ProxyHTTP request or its response: "header:<name>",
+	// "path_rule:<index>", "path_prefix", "request_body" and
+	// "response_extract".
+	TransformationsApplied []string `json:"transformations_applied,omitempty"`
+	// ReplayOf is the RequestID of the request a Replay response re-ran.
+	ReplayOf string `json:"replay_of,omitempty"`
+	// Deployment is the Azure OpenAI deployment that served Model, on a
+	// target whose provider is ProviderAzureOpenAI.
+	Deployment string `json:"deployment,omitempty"`
+	// IdempotencyFirstSeenAt is when the request's idempotency key was
+	// first used, and IdempotencyReplayCount how many times it has been
+	// replayed since, this replay included. Both are only set on
+	// idempotent hits; a count that keeps growing is a retry loop.
+	IdempotencyFirstSeenAt time.Time `json:"idempotency_first_seen_at,omitempty"`
+	IdempotencyReplayCount int       `json:"idempotency_replay_count,omitempty"`
+	// IdempotencyTTLSeconds is how long the request's idempotency key is
+	// honored from its first use, and IdempotencyExpiresAt when it stops
+	// being; both are set on the first response and on replays.
+	IdempotencyTTLSeconds int       `json:"idempotency_ttl_s,omitempty"`
+	IdempotencyExpiresAt  time.Time `json:"idempotency_expires_at,omitempty"`
+	// RouteLLMDecisionID and RouteLLMRouteName identify the RouteLLM
+	// decision the request was routed by, and RouteLLMProviderOverride and
+	// RouteLLMModelOverride are what it changed; all are empty without one.
+	RouteLLMDecisionID       string `json:"routellm_decision_id,omitempty"`
+	RouteLLMRouteName        string `json:"routellm_route_name,omitempty"`
+	RouteLLMProviderOverride string `json:"routellm_provider_override,omitempty"`
+	RouteLLMModelOverride    string `json:"routellm_model_override,omitempty"`
+	// Extra holds the members of the proxy's meta that Meta has no field
+	// for, such as ones a newer server added, undecoded.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// metaFields are the JSON names of Meta's fields.
+var metaFields = jsonFieldNames(reflect.TypeOf(Meta{}))
+
+// UnmarshalJSON decodes the meta of a proxy response, keeping the members
+// Meta has no field for in Extra.
+func (m *Meta) UnmarshalJSON(data []byte) error {
+	type fields Meta
+	if err := json.Unmarshal(data, (*fields)(m)); err != nil {
+		return err
+	}
+	m.Extra = wire.UnknownFields(data, metaFields)
+	return nil
+}
+
+// jsonFieldNames returns the names t's fields are encoded under by
+// encoding/json, counting those of embedded structs.
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-" || !f.IsExported() && !f.Anonymous:
+		case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+			names = append(names, jsonFieldNames(f.Type)...)
+		case name == "":
+			names = append(names, f.Name)
+		default:
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// UpstreamRequest is a request as the proxy sends it upstream, without the
+// target's credentials.
+type UpstreamRequest struct {
+	Method  string                 `json:"method"`
+	URL     string                 `json:"url"`
+	Headers map[string]string      `json:"headers,omitempty"`
+	Query   map[string]interface{} `json:"query,omitempty"`
+	Body    string                 `json:"body,omitempty"`
+}
+
+// UpstreamRateLimit is what a credential has left of its upstream rate
+// limit, as the upstream's X-RateLimit or equivalent headers reported it.
+type UpstreamRateLimit struct {
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// ReliAPIResponse is the success envelope returned by the proxy endpoints.
+//
+// Data is the JSON the proxy returned, undecoded: decode it with
+// DecodeInto or DecodeData, or read it as a map with DataMap. For
+// /proxy/http it holds {status_code, headers, body}, with body base64 for
+// binary responses (see Meta.ResponseEncoding); for /proxy/llm it holds the
+// normalized completion {content, role, finish_reason, usage}; for
+// /proxy/graphql it holds the GraphQL result {data, errors, extensions}.
+// With RawPassthrough it is the upstream body itself; see RawData.
+//
+// Data is read into a buffer the client pools; call Release once done with
+// a large response to let a later one reuse it.
+type ReliAPIResponse struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Meta    Meta            `json:"meta"`
+
+	// IdempotencyKey is the key sent with the request, including keys
+	// generated by WithAutoIdempotency or WithDeterministicIdempotency.
+	IdempotencyKey string `json:"-"`
+	// GraphQLErrors holds the errors of a ProxyGraphQL result, which come
+	// with partial (or no) data instead of failing the call.
+	GraphQLErrors GraphQLErrors `json:"-"`
+
+	held heldBuffer
+}
+
+// UpstreamHeader returns the first value of the upstream response header
+// name, matched case-insensitively, or "" if it was not captured (see
+// HTTPRequest.ResponseHeaders).
+func (r *ReliAPIResponse) UpstreamHeader(name string) string {
+	for k, v := range r.Meta.UpstreamHeaders {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// errorEnvelope is the shape of a failed proxy response (app/schemas.py
+// ErrorResponse) as well as FastAPI's {"detail": ...} wrapper used by
+// HTTPException-raised errors.
+type errorEnvelope struct {
+	Success *bool        `json:"success"`
+	Error   *errorDetail `json:"error"`
+	Meta    *Meta        `json:"meta"`
+	Detail  interface{}  `json:"detail"`
+}
+
+type errorDetail struct {
+	Type        string                 `json:"type"`
+	Code        string                 `json:"code"`
+	Message     string                 `json:"message"`
+	Retryable   bool                   `json:"retryable"`
+	Target      string                 `json:"target,omitempty"`
+	StatusCode  *int                   `json:"status_code,omitempty"`
+	RetryAfterS *float64               `json:"retry_after_s,omitempty"`
+	Hint        string                 `json:"hint,omitempty"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	Source      string                 `json:"source,omitempty"`
+	KeyStatus   string                 `json:"provider_key_status,omitempty"`
+}
@@ -0,0 +1,179 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usagePath = "/v1/usage"
+
+// Dimensions a usage report can be grouped by, UsageQuery.GroupBy.
+const (
+	UsageByTarget       = "target"
+	UsageByModel        = "model"
+	UsageByAPIKeyPrefix = "api_key_prefix"
+	UsageByKind         = "kind"
+)
+
+// UsageByTag is the dimension of the tag key of LLMRequest.Tags and
+// HTTPRequest.Tags, such as UsageByTag("feature").
+func UsageByTag(key string) string { return usageTagPrefix + key }
+
+const usageTagPrefix = "tag."
+
+// UsageQuery selects a usage report.
+type UsageQuery struct {
+	// From and To bound the report, widened by the proxy to whole hours.
+	// A zero From is the start of the current calendar month (UTC) and a
+	// zero To is now.
+	From time.Time
+	To   time.Time
+	// GroupBy lists the dimensions rows are split by; without any the
+	// report is a single row.
+	GroupBy []string
+	// Limit is the number of rows per page; the proxy defaults to 100 and
+	// allows at most 1000.
+	Limit int
+	// Cursor is a previous page's NextCursor or a Pager's Cursor. It is
+	// only valid with the query it was issued for; others fail with
+	// CodeBadRequest.
+	Cursor string
+}
+
+// UsageRow is a row of a usage report. Only the dimensions the report is
+// grouped by are set; they are nil for requests the dimension doesn't
+// apply to, such as Model for HTTP requests.
+type UsageRow struct {
+	Target       *string `json:"target,omitempty"`
+	Model        *string `json:"model,omitempty"`
+	APIKeyPrefix *string `json:"api_key_prefix,omitempty"`
+	// Kind is the proxy route: "llm", "http", "graphql" or "embeddings".
+	Kind *string `json:"kind,omitempty"`
+	// Tags holds the UsageByTag dimensions by tag key. A key is missing
+	// for requests without that tag.
+	Tags map[string]string `json:"-"`
+
+	Requests int `json:"requests"`
+	// BillableRequests are the requests that reached an upstream. Cache
+	// and idempotency hits are not billable and carry no tokens or cost.
+	BillableRequests int `json:"billable_requests"`
+	CacheHits        int `json:"cache_hits"`
+	IdempotentHits   int `json:"idempotent_hits"`
+	Errors           int `json:"errors"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	// EmbeddingTokens are the tokens of embeddings requests, which
+	// PromptTokens doesn't count.
+	EmbeddingTokens int     `json:"embedding_tokens"`
+	CostUSD         float64 `json:"cost_usd"`
+}
+
+// UnmarshalJSON reads the "tag.<key>" dimensions into Tags.
+func (r *UsageRow) UnmarshalJSON(data []byte) error {
+	type row UsageRow
+	if err := json.Unmarshal(data, (*row)(r)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for name, raw := range fields {
+		key, ok := strings.CutPrefix(name, usageTagPrefix)
+		if !ok {
+			continue
+		}
+		var value *string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if value == nil {
+			continue
+		}
+		if r.Tags == nil {
+			r.Tags = make(map[string]string)
+		}
+		r.Tags[key] = *value
+	}
+	return nil
+}
+
+// UsageReport is a page of the caller's usage. The proxy tracks usage per
+// instance, so behind a load balancer each report covers the instance
+// that answered.
+type UsageReport struct {
+	// Tenant is the caller's tenant; empty outside multi-tenant mode.
+	Tenant  string     `json:"tenant"`
+	From    time.Time  `json:"from"`
+	To      time.Time  `json:"to"`
+	GroupBy []string   `json:"group_by"`
+	Rows    []UsageRow `json:"rows"`
+	// NextCursor fetches the next page as UsageQuery.Cursor; empty on the
+	// last page.
+	NextCursor string `json:"next_cursor"`
+}
+
+// Usage returns a page of the requests, tokens and cost of the caller's
+// tenant. Use UsageRows or AllUsage for every page.
+func (c *Client) Usage(ctx context.Context, q UsageQuery) (*UsageReport, error) {
+	params := url.Values{}
+	if !q.From.IsZero() {
+		params.Set("from", q.From.UTC().Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		params.Set("to", q.To.UTC().Format(time.RFC3339))
+	}
+	if len(q.GroupBy) > 0 {
+		params.Set("group_by", strings.Join(q.GroupBy, ","))
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Cursor != "" {
+		params.Set("cursor", q.Cursor)
+	}
+	path := usagePath
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	resp, raw, err := c.do(ctx, http.MethodGet, path, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool        `json:"success"`
+		Data    UsageReport `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return &out.Data, nil
+}
+
+// UsageRows walks every page of the Usage report of q.
+func (c *Client) UsageRows(ctx context.Context, q UsageQuery) *Pager[UsageRow] {
+	return newPager(ctx, q.Cursor, func(ctx context.Context, cursor string) ([]UsageRow, string, error) {
+		q.Cursor = cursor
+		report, err := c.Usage(ctx, q)
+		if err != nil {
+			return nil, "", err
+		}
+		return report.Rows, report.NextCursor, nil
+	})
+}
+
+// AllUsage follows the report's cursors from q and returns the rows of
+// every page.
+func (c *Client) AllUsage(ctx context.Context, q UsageQuery) ([]UsageRow, error) {
+	return c.UsageRows(ctx, q).All()
+}
@@ -0,0 +1,111 @@
+package reliapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// usagePages answers /v1/usage with one page per cursor: "" is the first.
+func usagePages(t *testing.T, pages map[string]map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != usagePath {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		page, ok := pages[r.URL.Query().Get("cursor")]
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"detail": map[string]interface{}{
+					"success": false,
+					"error":   map[string]interface{}{"type": "client_error", "code": CodeBadRequest, "message": "cursor is not valid", "status_code": 400},
+				},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    page,
+			"meta":    map[string]interface{}{"request_id": "req_usage", "duration_ms": 1},
+		})
+	}
+}
+
+func usagePage(next interface{}, rows ...map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"tenant":      "acme",
+		"from":        "2026-10-01T00:00:00+00:00",
+		"to":          "2026-10-14T13:00:00+00:00",
+		"group_by":    []string{"target"},
+		"rows":        rows,
+		"next_cursor": next,
+	}
+}
+
+func TestUsage(t *testing.T) {
+	var query map[string]string
+	pages := usagePages(t, map[string]map[string]interface{}{
+		"": usagePage(nil,
+			map[string]interface{}{"target": "openai", "model": nil, "requests": 3, "billable_requests": 2, "cache_hits": 1, "prompt_tokens": 40, "cost_usd": 0.12},
+		),
+	})
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		query = map[string]string{}
+		for k := range r.URL.Query() {
+			query[k] = r.URL.Query().Get(k)
+		}
+		pages(w, r)
+	})
+
+	from := time.Date(2026, 10, 1, 2, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	got, err := c.Usage(context.Background(), UsageQuery{From: from, GroupBy: []string{UsageByTarget, UsageByModel}, Limit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"from": "2026-10-01T00:00:00Z", "group_by": "target,model", "limit": "50"}
+	if len(query) != len(want) {
+		t.Errorf("query = %v, want %v", query, want)
+	}
+	for k, v := range want {
+		if query[k] != v {
+			t.Errorf("%s = %q, want %q", k, query[k], v)
+		}
+	}
+
+	if got.Tenant != "acme" || got.NextCursor != "" || len(got.Rows) != 1 {
+		t.Fatalf("report = %+v", got)
+	}
+	row := got.Rows[0]
+	if row.Target == nil || *row.Target != "openai" || row.Model != nil || row.Kind != nil {
+		t.Errorf("row dimensions = %+v", row)
+	}
+	if row.Requests != 3 || row.BillableRequests != 2 || row.CacheHits != 1 || row.PromptTokens != 40 || row.CostUSD != 0.12 {
+		t.Errorf("row = %+v", row)
+	}
+	if !got.To.Equal(time.Date(2026, 10, 14, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("To = %v", got.To)
+	}
+}
+
+func TestAllUsage(t *testing.T) {
+	c := newTestClient(t, usagePages(t, map[string]map[string]interface{}{
+		"":   usagePage("p2", map[string]interface{}{"target": "anthropic", "requests": 1}),
+		"p2": usagePage("p3", map[string]interface{}{"target": "mistral", "requests": 2}),
+		"p3": usagePage(nil, map[string]interface{}{"target": "openai", "requests": 3}),
+	}))
+
+	rows, err := c.AllUsage(context.Background(), UsageQuery{GroupBy: []string{UsageByTarget}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || *rows[0].Target != "anthropic" || *rows[2].Target != "openai" || rows[1].Requests != 2 {
+		t.Errorf("rows = %+v", rows)
+	}
+
+	_, err = c.Usage(context.Background(), UsageQuery{Cursor: "stale"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeBadRequest {
+		t.Errorf("stale cursor: err = %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package reliapi
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// SchemaViolation is one way an LLM completion failed LLMRequest.OutputSchema.
+type SchemaViolation struct {
+	// Path locates the offending value, JSONPath-style ("$.items[0].name");
+	// "$" for the whole document, including content that is not JSON.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// OutputValidationFailure is the detail of an OUTPUT_VALIDATION_FAILED
+// error.
+type OutputValidationFailure struct {
+	// Attempts is the number of completions checked, 1 plus the repairs.
+	Attempts int `json:"attempts"`
+	// Errors are the violations of the last completion.
+	Errors []SchemaViolation `json:"errors"`
+	// Content is the last completion's content.
+	Content string `json:"content"`
+}
+
+// IsOutputValidationFailed reports whether err means the completion did not
+// satisfy LLMRequest.OutputSchema, after any repair attempts.
+func IsOutputValidationFailed(err error) bool {
+	return hasCode(err, CodeOutputValidationFailed)
+}
+
+// AsOutputValidationFailed returns the details of an
+// OUTPUT_VALIDATION_FAILED error. It reports false for other errors.
+func AsOutputValidationFailed(err error) (*OutputValidationFailure, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !IsOutputValidationFailed(apiErr) {
+		return nil, false
+	}
+	raw, _ := json.Marshal(apiErr.Details)
+	var f OutputValidationFailure
+	_ = json.Unmarshal(raw, &f)
+	return &f, true
+}
@@ -0,0 +1,132 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const weatherSchema = `{"type":"object","properties":{"city":{"type":"string"},"celsius":{"type":"number"}},"required":["city","celsius"]}`
+
+func validatedReq() LLMRequest {
+	req := llmReq("Weather in Berlin as JSON")
+	req.OutputSchema = json.RawMessage(weatherSchema)
+	req.ValidateOutput = true
+	req.RepairAttempts = 1
+	return req
+}
+
+func TestProxyLLMValidatedOutput(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var sent struct {
+			OutputSchema   json.RawMessage `json:"output_schema"`
+			ValidateOutput bool            `json:"validate_output"`
+			RepairAttempts int             `json:"repair_attempts"`
+		}
+		raw, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(raw, &sent); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		assertSameJSON(t, sent.OutputSchema, []byte(weatherSchema))
+		if !sent.ValidateOutput || sent.RepairAttempts != 1 {
+			t.Errorf("validate_output = %v, repair_attempts = %d", sent.ValidateOutput, sent.RepairAttempts)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": `{"city":"Berlin","celsius":12}`},
+			"meta":    map[string]interface{}{"validation_attempts": 2, "output_valid": true},
+		})
+	})
+
+	resp, err := c.ProxyLLM(context.Background(), validatedReq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta.ValidationAttempts != 2 || resp.Meta.OutputValid == nil || !*resp.Meta.OutputValid {
+		t.Errorf("ValidationAttempts = %d, OutputValid = %v", resp.Meta.ValidationAttempts, resp.Meta.OutputValid)
+	}
+}
+
+func TestProxyLLMOmitsUnsetValidation(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		for _, k := range []string{"output_schema", "validate_output", "repair_attempts"} {
+			if _, ok := body[k]; ok {
+				t.Errorf("%s sent for a request without validation", k)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": map[string]interface{}{"content": "hi"}})
+	})
+	if _, err := c.ProxyLLM(context.Background(), llmReq("hi")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsOutputValidationFailed(t *testing.T) {
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"type":      "output_validation_error",
+				"code":      CodeOutputValidationFailed,
+				"message":   "LLM output does not match output_schema after 2 attempts",
+				"retryable": false,
+				"details": map[string]interface{}{
+					"attempts": 2,
+					"errors":   []map[string]string{{"path": "$", "message": "missing required property 'celsius'"}},
+					"content":  `{"city":"Berlin"}`,
+				},
+			},
+			"meta": map[string]interface{}{"validation_attempts": 2, "output_valid": false},
+		})
+	})
+
+	_, err := c.ProxyLLM(context.Background(), validatedReq())
+	got, ok := AsOutputValidationFailed(err)
+	if !ok {
+		t.Fatalf("AsOutputValidationFailed(%v) = false", err)
+	}
+	want := OutputValidationFailure{
+		Attempts: 2,
+		Errors:   []SchemaViolation{{Path: "$", Message: "missing required property 'celsius'"}},
+		Content:  `{"city":"Berlin"}`,
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("failure = %+v, want %+v", *got, want)
+	}
+	if IsRetriable(err) || calls != 1 {
+		t.Errorf("IsRetriable = %v after %d calls", IsRetriable(err), calls)
+	}
+	if _, ok := AsOutputValidationFailed(&APIError{Code: CodeBudgetExceeded}); ok {
+		t.Error("AsOutputValidationFailed(BUDGET_EXCEEDED) = true")
+	}
+}
+
+func TestCoalesceKeyScopesOutputSchema(t *testing.T) {
+	c, err := NewClient("", "k", WithCoalescing(ShareLeaderError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	validated := validatedReq()
+	other := validatedReq()
+	other.OutputSchema = json.RawMessage(`{"type":"object"}`)
+	unchecked := validatedReq()
+	unchecked.ValidateOutput = false
+
+	keys := map[string]bool{}
+	for _, req := range []LLMRequest{validated, other, unchecked, llmReq("Weather in Berlin as JSON")} {
+		key, _ := c.llmCoalesceKey(req)
+		keys[key] = true
+	}
+	// A schema without ValidateOutput is ignored by the proxy, so that
+	// request shares a key with the plain one.
+	if len(keys) != 3 {
+		t.Errorf("got %d distinct keys, want 3", len(keys))
+	}
+}
@@ -0,0 +1,229 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const cacheWarmPath = cachePath + "/warm"
+
+// Statuses of the items of a cache warming job.
+const (
+	// WarmPending items have not run yet.
+	WarmPending = "pending"
+	// WarmWarmed items were sent upstream and their responses cached.
+	WarmWarmed = "warmed"
+	// WarmCached items were already cached and were skipped.
+	WarmCached = "cached"
+	// WarmFailed items failed; WarmItem.Error says why.
+	WarmFailed = "failed"
+	// WarmAborted items never ran, as WarmOptions.MaxCostUSD was spent.
+	WarmAborted = "aborted"
+)
+
+// ErrWarmAborted is the error in WaitForCacheWarm's *MultiError of a
+// WarmAborted item.
+var ErrWarmAborted = errors.New("reliapi: warm item aborted, MaxCostUSD spent")
+
+// WarmOptions configures a cache warming job.
+type WarmOptions struct {
+	// MaxParallel is how many items run at once; zero leaves the proxy's
+	// default of 4.
+	MaxParallel int
+	// MaxCostUSD caps the job's spend. An LLM item may cost at most what is
+	// left of it when it starts, and once it is spent the items not started
+	// are aborted. Zero means no ceiling; the budget caps of normal traffic
+	// apply either way.
+	MaxCostUSD float64
+}
+
+// CacheWarmJob is the progress of a cache warming job.
+type CacheWarmJob struct {
+	JobID  JobID  `json:"job_id"`
+	Status string `json:"status"`
+	// CostUSD is what the items run so far cost; skipped items cost nothing.
+	CostUSD float64 `json:"cost_usd"`
+	// Counts is the number of items in each Warm* status.
+	Counts map[string]int `json:"counts"`
+	Items  []WarmItem     `json:"items"`
+}
+
+// Finished reports whether every item of the job has run or been aborted.
+func (j *CacheWarmJob) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// WarmItem is the outcome of one item of a cache warming job, in the order
+// the items were given.
+type WarmItem struct {
+	Index  int    `json:"index"`
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	// Status is one of the Warm* statuses.
+	Status string `json:"status"`
+	// CacheKey is the key the response is cached under, once it has run.
+	CacheKey string  `json:"cache_key"`
+	CostUSD  float64 `json:"cost_usd"`
+	// Error is why a WarmFailed item failed.
+	Error *APIError `json:"error"`
+}
+
+type cacheWarmItem struct {
+	HTTP *HTTPRequest `json:"http,omitempty"`
+	LLM  *LLMRequest  `json:"llm,omitempty"`
+}
+
+type cacheWarmRequest struct {
+	Items       []cacheWarmItem `json:"items"`
+	MaxParallel int             `json:"max_parallel,omitempty"`
+	MaxCostUSD  float64         `json:"max_cost_usd,omitempty"`
+}
+
+// WarmCache queues a job that sends items through the proxy in the
+// background, at batch priority, so their responses are cached before
+// traffic asks for them. Each item is an HTTPRequest (GET or HEAD) or an
+// LLMRequest, or a pointer to one; streaming and dry runs can't be warmed.
+// Items already cached are skipped. The items count against the API key's
+// rate limit and budget caps as the same calls would, and run as the
+// client's tenant: their TenantID is not used.
+//
+// It returns the job's ID; follow its progress with CacheWarmStatus or
+// WaitForCacheWarm, which reports failed items as a *MultiError. A submission is not retried, so a failed one may still
+// have queued the job.
+func (c *Client) WarmCache(ctx context.Context, items []any, opts WarmOptions) (JobID, error) {
+	body := cacheWarmRequest{
+		Items:       make([]cacheWarmItem, len(items)),
+		MaxParallel: opts.MaxParallel,
+		MaxCostUSD:  opts.MaxCostUSD,
+	}
+	for i, item := range items {
+		switch req := item.(type) {
+		case HTTPRequest:
+			body.Items[i].HTTP = &req
+		case *HTTPRequest:
+			body.Items[i].HTTP = req
+		case LLMRequest:
+			body.Items[i].LLM = &req
+		case *LLMRequest:
+			body.Items[i].LLM = req
+		default:
+			return "", fmt.Errorf("reliapi: items[%d]: want an HTTPRequest or LLMRequest, got %T", i, item)
+		}
+		if llm := body.Items[i].LLM; llm != nil {
+			req, err := withPromptMessages(*llm)
+			if err != nil {
+				return "", fmt.Errorf("reliapi: items[%d]: %w", i, err)
+			}
+			if err := c.checkImages(req.Messages); err != nil {
+				return "", fmt.Errorf("reliapi: items[%d]: %w", i, err)
+			}
+			// Entries are keyed by the redacted prompt
+			req, _ = c.redact(req)
+			body.Items[i].LLM = &req
+		}
+	}
+	resp, err := c.post(ctx, cacheWarmPath, body, false)
+	if err != nil {
+		return "", err
+	}
+	var data struct {
+		JobID string `json:"job_id"`
+	}
+	err = resp.DecodeInto(&data)
+	resp.Release()
+	if err != nil || data.JobID == "" {
+		return "", errors.New("reliapi: cache warming returned no job_id")
+	}
+	return JobID(data.JobID), nil
+}
+
+// CacheWarmStatus returns the progress of a job queued with WarmCache. Jobs
+// are kept for 24 hours and are only visible to the tenant that submitted
+// them; others fail with NOT_FOUND.
+func (c *Client) CacheWarmStatus(ctx context.Context, id JobID) (*CacheWarmJob, error) {
+	resp, raw, err := c.do(ctx, http.MethodGet, cacheWarmPath+"/"+url.PathEscape(string(id)), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Success bool         `json:"success"`
+		Data    CacheWarmJob `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("reliapi: decode response: %w", err)
+	}
+	if !out.Success {
+		return nil, newAPIError(resp, raw)
+	}
+	return &out.Data, nil
+}
+
+// WaitForCacheWarm polls CacheWarmStatus every pollInterval (one second if
+// zero) until the job finishes, and returns it. When items failed or were
+// aborted the job is returned with a *MultiError indexed like its items:
+// a failed item's *APIError, or ErrWarmAborted.
+//
+// When ctx is done first it returns the job as last polled, with the items
+// still pending marked ErrNotCompleted; they keep running on the proxy.
+// Without a poll yet it returns ctx's error alone.
+func (c *Client) WaitForCacheWarm(ctx context.Context, id JobID, pollInterval time.Duration) (*CacheWarmJob, error) {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var last *CacheWarmJob
+	for {
+		select {
+		case <-ctx.Done():
+			return last.outcome(ctx.Err())
+		case <-timer.C:
+		}
+		job, err := c.CacheWarmStatus(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return last.outcome(err)
+			}
+			return nil, err
+		}
+		if job.Finished() {
+			return job.outcome(nil)
+		}
+		last = job
+		timer.Reset(pollInterval)
+	}
+}
+
+// outcome returns the job with the *MultiError of its items, those still
+// pending failing with canceled. Without a job it returns canceled alone.
+func (j *CacheWarmJob) outcome(canceled error) (*CacheWarmJob, error) {
+	if j == nil {
+		return nil, canceled
+	}
+	errs := make([]error, len(j.Items))
+	for i, item := range j.Items {
+		switch item.Status {
+		case WarmFailed:
+			if item.Error != nil {
+				errs[i] = item.Error
+			} else {
+				errs[i] = &APIError{StatusCode: http.StatusInternalServerError, Message: "warm item failed without error detail"}
+			}
+		case WarmAborted:
+			errs[i] = ErrWarmAborted
+		case WarmPending:
+			if canceled != nil {
+				errs[i] = &notCompletedError{cause: canceled}
+			}
+		}
+	}
+	if err := newMultiError(errs); err != nil {
+		return j, err
+	}
+	return j, canceled
+}
@@ -0,0 +1,86 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarmCache(t *testing.T) {
+	var body map[string]interface{}
+	polls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == cacheWarmPath:
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			writeJSON(w, http.StatusAccepted, map[string]interface{}{
+				"success": true,
+				"data":    map[string]interface{}{"job_id": "job_w", "status": JobQueued},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == cacheWarmPath+"/job_w":
+			polls++
+			status := JobRunning
+			if polls > 1 {
+				status = JobFailed
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"success": true,
+				"data": map[string]interface{}{
+					"job_id":   "job_w",
+					"status":   status,
+					"cost_usd": 0.25,
+					"counts":   map[string]int{WarmCached: 1, WarmFailed: 1},
+					"items": []map[string]interface{}{
+						{"index": 0, "kind": "http", "target": "api", "status": WarmCached, "cache_key": "k0", "cost_usd": 0},
+						{"index": 1, "kind": "llm", "target": "openai", "status": WarmFailed, "cost_usd": 0.25,
+							"error": map[string]interface{}{"type": "budget_error", "code": CodeBudgetExceeded, "message": "over"}},
+					},
+				},
+			})
+		}
+	})
+	ctx := context.Background()
+
+	llm := llmReq("hi")
+	id, err := c.WarmCache(ctx, []any{HTTPRequest{Target: "api", Method: "GET", Path: "/users"}, &llm},
+		WarmOptions{MaxParallel: 2, MaxCostUSD: 1.5})
+	if err != nil || id != "job_w" {
+		t.Fatalf("WarmCache = %q, %v", id, err)
+	}
+	items, _ := body["items"].([]interface{})
+	if len(items) != 2 || items[0].(map[string]interface{})["http"] == nil || items[1].(map[string]interface{})["llm"] == nil {
+		t.Errorf("items = %v", body["items"])
+	}
+	if body["max_parallel"] != 2.0 || body["max_cost_usd"] != 1.5 {
+		t.Errorf("body = %v", body)
+	}
+
+	job, err := c.WaitForCacheWarm(ctx, id, time.Millisecond)
+	var multi *MultiError
+	if !errors.As(err, &multi) || multi.Err(0) != nil || !IsBudgetExceeded(multi.Err(1)) {
+		t.Fatalf("err = %v, want item 1 over budget", err)
+	}
+	if polls != 2 || !job.Finished() || job.CostUSD != 0.25 || job.Counts[WarmCached] != 1 {
+		t.Errorf("job after %d polls = %+v", polls, job)
+	}
+	if item := job.Items[1]; item.Status != WarmFailed || item.Error == nil || item.Error.Code != CodeBudgetExceeded {
+		t.Errorf("failed item = %+v", item)
+	}
+	if job.Items[0].CacheKey != "k0" {
+		t.Errorf("cached item = %+v", job.Items[0])
+	}
+}
+
+func TestWarmCacheRejectsOtherItems(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request")
+	})
+	_, err := c.WarmCache(context.Background(), []any{llmReq("hi"), "GET /users"}, WarmOptions{})
+	if err == nil || !strings.Contains(err.Error(), "items[1]") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package reliapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookSignatureHeader carries the signature of a webhook delivery:
+// "t=<unix seconds>,v1=<hex>", where v1 is the HMAC-SHA256 of
+// "<t>." + body keyed with the proxy's RELIAPI_WEBHOOK_SECRET. It may hold
+// several v1 values while the secret is rotated.
+const WebhookSignatureHeader = "X-ReliAPI-Signature"
+
+// DefaultWebhookTolerance is how far a delivery's timestamp may be from
+// the current time before VerifyWebhook rejects it as a replay.
+const DefaultWebhookTolerance = 5 * time.Minute
+
+// maxWebhookBody caps the body WebhookHandler and NewCallbackHandler
+// read; job results carry a full completion.
+const maxWebhookBody = 10 << 20
+
+// Webhook event types, WebhookEvent.Type. Subscribe receives them too,
+// as Event.Type.
+const (
+	EventJobCompleted           = "job.completed"
+	EventBudgetThresholdReached = "budget.threshold_reached"
+	EventCircuitOpened          = "circuit.opened"
+)
+
+var (
+	// ErrWebhookSignature means the signature header is missing, malformed
+	// or does not match the payload.
+	ErrWebhookSignature = errors.New("reliapi: invalid webhook signature")
+	// ErrWebhookTimestamp means the signature's timestamp is outside the
+	// tolerance, as with a replayed delivery.
+	ErrWebhookTimestamp = errors.New("reliapi: webhook timestamp outside tolerance")
+	// ErrUnknownWebhookEvent means the event verified but its type is not
+	// one this package decodes. VerifyWebhook still returns the event.
+	ErrUnknownWebhookEvent = errors.New("reliapi: unknown webhook event type")
+)
+
+// WebhookEvent is a verified webhook delivery. Exactly one of the typed
+// payloads is set, per Type; none for an unknown type.
+type WebhookEvent struct {
+	ID        string
+	Type      string
+	CreatedAt time.Time
+	// Data is the raw payload.
+	Data json.RawMessage
+
+	JobCompleted           *JobCompletedEvent
+	BudgetThresholdReached *BudgetThresholdEvent
+	CircuitOpened          *CircuitOpenedEvent
+}
+
+// JobCompletedEvent reports that a job submitted with SubmitLLM and a
+// CallbackURL finished. Exactly one of Response and Err is set, as JobResult
+// would return them.
+type JobCompletedEvent struct {
+	JobID    JobID
+	Status   string
+	Response *ReliAPIResponse
+	Err      error
+}
+
+// BudgetThresholdEvent reports that a tenant's or an API key's spend this
+// month crossed a fraction of its monthly_budget_usd. Each threshold fires
+// once per month. BudgetAlerts lists the alerts that fired.
+type BudgetThresholdEvent struct {
+	Tenant   string  `json:"tenant"`
+	SpentUSD float64 `json:"spent_usd"`
+	CapUSD   float64 `json:"cap_usd"`
+	// Threshold is the crossed fraction of CapUSD, e.g. 0.8.
+	Threshold   float64   `json:"threshold"`
+	PeriodStart time.Time `json:"period_start"`
+	ResetAt     time.Time `json:"reset_at"`
+
+	// APIKey is the name of the API key whose budget crossed Threshold;
+	// empty for the tenant's budget.
+	APIKey string `json:"api_key"`
+	// ProjectedUSD is the spend expected by ResetAt at RunRateUSDPerDay,
+	// the average daily spend of the trailing seven days.
+	ProjectedUSD     float64   `json:"projected_usd"`
+	RunRateUSDPerDay float64   `json:"run_rate_usd_per_day"`
+	FiredAt          time.Time `json:"fired_at"`
+}
+
+// CircuitOpenedEvent reports that a target's circuit breaker opened; the
+// proxy rejects requests to it until NextProbeTime.
+type CircuitOpenedEvent struct {
+	Target         string     `json:"target"`
+	FailureCount   int        `json:"failure_count"`
+	FailuresToOpen int        `json:"failures_to_open"`
+	NextProbeTime  *time.Time `json:"next_probe_at"`
+}
+
+// WebhookOption configures VerifyWebhook and WebhookHandler.
+type WebhookOption func(*webhookConfig)
+
+type webhookConfig struct {
+	tolerance time.Duration
+}
+
+// WithWebhookTolerance sets how old, or how far in the future, a
+// delivery's timestamp may be. The default is DefaultWebhookTolerance.
+func WithWebhookTolerance(d time.Duration) WebhookOption {
+	return func(cfg *webhookConfig) { cfg.tolerance = d }
+}
+
+// VerifyWebhook checks the signature of a webhook delivery against secret
+// and decodes the event. payload must be the raw request body, unmodified.
+// It fails with ErrWebhookSignature or ErrWebhookTimestamp before decoding
+// anything, and returns the event together with ErrUnknownWebhookEvent for
+// types added after this version of the package.
+func VerifyWebhook(payload []byte, headers http.Header, secret string, opts ...WebhookOption) (*WebhookEvent, error) {
+	cfg := webhookConfig{tolerance: DefaultWebhookTolerance}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := verifySignature(payload, headers.Get(WebhookSignatureHeader), secret, cfg.tolerance, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var env struct {
+		ID        string          `json:"id"`
+		Type      string          `json:"type"`
+		CreatedAt int64           `json:"created_at"`
+		Data      json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &env); err != nil {
+		return nil, fmt.Errorf("reliapi: decode webhook: %w", err)
+	}
+	ev := &WebhookEvent{ID: env.ID, Type: env.Type, CreatedAt: time.Unix(env.CreatedAt, 0), Data: env.Data}
+
+	var err error
+	switch env.Type {
+	case EventJobCompleted:
+		var data struct {
+			JobID  JobID           `json:"job_id"`
+			Status string          `json:"status"`
+			Result json.RawMessage `json:"result"`
+		}
+		if err = json.Unmarshal(env.Data, &data); err == nil {
+			ev.JobCompleted = &JobCompletedEvent{JobID: data.JobID, Status: data.Status}
+			ev.JobCompleted.Response, ev.JobCompleted.Err = decodeJobResult(data.Result)
+		}
+	case EventBudgetThresholdReached:
+		ev.BudgetThresholdReached = new(BudgetThresholdEvent)
+		err = json.Unmarshal(env.Data, ev.BudgetThresholdReached)
+	case EventCircuitOpened:
+		ev.CircuitOpened = new(CircuitOpenedEvent)
+		err = json.Unmarshal(env.Data, ev.CircuitOpened)
+	default:
+		return ev, fmt.Errorf("%w %q", ErrUnknownWebhookEvent, env.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reliapi: decode %s webhook: %w", env.Type, err)
+	}
+	return ev, nil
+}
+
+// verifySignature checks header, a WebhookSignatureHeader value, against
+// payload at now.
+func verifySignature(payload []byte, header, secret string, tolerance time.Duration, now time.Time) error {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			if sig, err := hex.DecodeString(v); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrWebhookSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	valid := false
+	for _, sig := range signatures {
+		// Check every value so the time taken doesn't reveal which matched
+		if hmac.Equal(sig, expected) {
+			valid = true
+		}
+	}
+	if !valid {
+		return ErrWebhookSignature
+	}
+	if skew := now.Sub(time.Unix(sent, 0)); skew > tolerance || skew < -tolerance {
+		return ErrWebhookTimestamp
+	}
+	return nil
+}
+
+// WebhookHandler returns an http.Handler that verifies deliveries with
+// VerifyWebhook and passes the events to fn with the request's context.
+// It answers 400 to deliveries that fail verification and 500 when fn
+// returns an error, which makes the proxy retry; events of unknown types
+// get 204 without calling fn, like handled ones.
+func WebhookHandler(secret string, fn func(ctx context.Context, ev *WebhookEvent) error, opts ...WebhookOption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := readWebhook(w, r)
+		if !ok {
+			return
+		}
+		ev, err := VerifyWebhook(payload, r.Header, secret, opts...)
+		switch {
+		case errors.Is(err, ErrUnknownWebhookEvent):
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := fn(r.Context(), ev); err != nil {
+			http.Error(w, "webhook handler failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,193 @@
+package reliapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const webhookSecret = "whsec_test"
+
+// fixtureSignature is the proxy's signature of webhook_job_completed.json,
+// made by core/webhooks.py sign_payload at t=1700000000 with webhookSecret.
+const fixtureSignature = "t=1700000000,v1=b54c5a4b2ebe153c9179a4f88ef60d2f1ba7a1f4d42b9dee6edb1eefbee7c072"
+
+func signedHeader(payload []byte, secret string, at time.Time) http.Header {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return signatureHeader("t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil)))
+}
+
+func signatureHeader(value string) http.Header {
+	h := http.Header{}
+	h.Set(WebhookSignatureHeader, value)
+	return h
+}
+
+func webhookPayload(typ, data string) []byte {
+	return []byte(fmt.Sprintf(`{"id": "evt_1", "type": %q, "created_at": 1700000000, "data": %s}`, typ, data))
+}
+
+func TestVerifyWebhookProxyFixture(t *testing.T) {
+	payload, err := os.ReadFile(filepath.Join("testdata", "webhook_job_completed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySignature(payload, fixtureSignature, webhookSecret, DefaultWebhookTolerance, time.Unix(1700000060, 0)); err != nil {
+		t.Fatalf("proxy signature rejected: %v", err)
+	}
+
+	ev, err := VerifyWebhook(payload, signedHeader(payload, webhookSecret, time.Now()), webhookSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := ev.JobCompleted
+	if ev.Type != EventJobCompleted || job == nil || job.Err != nil {
+		t.Fatalf("event = %+v", ev)
+	}
+	if text, _ := job.Response.CompletionText(); text != "The answer is 42." || job.Status != JobSucceeded {
+		t.Errorf("job = %+v, content %q", job, text)
+	}
+}
+
+func TestVerifyWebhookTyped(t *testing.T) {
+	cases := []struct {
+		typ, data string
+		check     func(*WebhookEvent) bool
+	}{
+		{EventJobCompleted, `{"job_id": "job_a", "status": "failed", "result": {"success": false, "error": {"code": "BUDGET_EXCEEDED", "message": "over", "status_code": 402}, "meta": {"request_id": "req_1"}}}`,
+			func(ev *WebhookEvent) bool {
+				var apiErr *APIError
+				return ev.JobCompleted.Response == nil && errors.As(ev.JobCompleted.Err, &apiErr) && apiErr.Code == CodeBudgetExceeded
+			}},
+		{EventBudgetThresholdReached, `{"tenant": "acme", "spent_usd": 80.5, "cap_usd": 100, "threshold": 0.8, "period_start": "2026-10-01T00:00:00Z", "reset_at": "2026-11-01T00:00:00Z"}`,
+			func(ev *WebhookEvent) bool {
+				b := ev.BudgetThresholdReached
+				return b != nil && b.Tenant == "acme" && b.Threshold == 0.8 && b.ResetAt.Month() == time.November
+			}},
+		{EventCircuitOpened, `{"target": "openai", "failure_count": 5, "failures_to_open": 5, "next_probe_at": "2026-10-14T12:00:00Z"}`,
+			func(ev *WebhookEvent) bool {
+				c := ev.CircuitOpened
+				return c != nil && c.Target == "openai" && c.NextProbeTime != nil && ev.JobCompleted == nil
+			}},
+	}
+	for _, tc := range cases {
+		payload := webhookPayload(tc.typ, tc.data)
+		ev, err := VerifyWebhook(payload, signedHeader(payload, webhookSecret, time.Now()), webhookSecret)
+		if err != nil {
+			t.Errorf("%s: %v", tc.typ, err)
+			continue
+		}
+		if !tc.check(ev) {
+			t.Errorf("%s: event = %+v", tc.typ, ev)
+		}
+	}
+}
+
+func TestVerifyWebhookRejectsTampering(t *testing.T) {
+	payload := webhookPayload(EventCircuitOpened, `{"target": "openai"}`)
+	header := signedHeader(payload, webhookSecret, time.Now())
+	tampered := []byte(strings.Replace(string(payload), "openai", "mistral", 1))
+
+	for name, tc := range map[string]struct {
+		payload []byte
+		header  http.Header
+		secret  string
+	}{
+		"body":       {tampered, header, webhookSecret},
+		"secret":     {payload, header, "whsec_other"},
+		"no header":  {payload, http.Header{}, webhookSecret},
+		"no v1":      {payload, signatureHeader("t=" + strconv.FormatInt(time.Now().Unix(), 10)), webhookSecret},
+		"bad v1 hex": {payload, signatureHeader("t=1,v1=zz"), webhookSecret},
+	} {
+		if _, err := VerifyWebhook(tc.payload, tc.header, tc.secret); !errors.Is(err, ErrWebhookSignature) {
+			t.Errorf("%s: err = %v, want ErrWebhookSignature", name, err)
+		}
+	}
+}
+
+func TestVerifyWebhookRotatedSecret(t *testing.T) {
+	payload := webhookPayload(EventCircuitOpened, `{"target": "openai"}`)
+	now := time.Now()
+	old := signedHeader(payload, "whsec_old", now).Get(WebhookSignatureHeader)
+	current := signedHeader(payload, webhookSecret, now).Get(WebhookSignatureHeader)
+	header := signatureHeader(old + "," + current[strings.Index(current, "v1="):])
+	if _, err := VerifyWebhook(payload, header, webhookSecret); err != nil {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestVerifyWebhookSkewedTimestamp(t *testing.T) {
+	payload := webhookPayload(EventCircuitOpened, `{"target": "openai"}`)
+	for _, skew := range []time.Duration{-10 * time.Minute, 10 * time.Minute} {
+		header := signedHeader(payload, webhookSecret, time.Now().Add(skew))
+		if _, err := VerifyWebhook(payload, header, webhookSecret); !errors.Is(err, ErrWebhookTimestamp) {
+			t.Errorf("skew %v: err = %v, want ErrWebhookTimestamp", skew, err)
+		}
+		if _, err := VerifyWebhook(payload, header, webhookSecret, WithWebhookTolerance(time.Hour)); err != nil {
+			t.Errorf("skew %v within tolerance: %v", skew, err)
+		}
+	}
+}
+
+func TestVerifyWebhookUnknownType(t *testing.T) {
+	payload := webhookPayload("key.rotated", `{"key": "k1"}`)
+	ev, err := VerifyWebhook(payload, signedHeader(payload, webhookSecret, time.Now()), webhookSecret)
+	if !errors.Is(err, ErrUnknownWebhookEvent) {
+		t.Fatalf("err = %v, want ErrUnknownWebhookEvent", err)
+	}
+	if ev == nil || ev.Type != "key.rotated" || string(ev.Data) != `{"key": "k1"}` {
+		t.Errorf("event = %+v", ev)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	var got []*WebhookEvent
+	fail := false
+	h := WebhookHandler(webhookSecret, func(ctx context.Context, ev *WebhookEvent) error {
+		got = append(got, ev)
+		if fail {
+			return errors.New("database down")
+		}
+		return nil
+	})
+	deliver := func(payload []byte, header http.Header) int {
+		req := httptest.NewRequest(http.MethodPost, "/hooks/reliapi", strings.NewReader(string(payload)))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	payload := webhookPayload(EventCircuitOpened, `{"target": "openai"}`)
+	header := signedHeader(payload, webhookSecret, time.Now())
+	if code := deliver(payload, header); code != http.StatusNoContent || len(got) != 1 {
+		t.Errorf("valid delivery: status %d, %d events", code, len(got))
+	}
+	if code := deliver([]byte(strings.Replace(string(payload), "openai", "mistral", 1)), header); code != http.StatusBadRequest {
+		t.Errorf("tampered delivery: status %d", code)
+	}
+	unknown := webhookPayload("key.rotated", `{}`)
+	if code := deliver(unknown, signedHeader(unknown, webhookSecret, time.Now())); code != http.StatusNoContent || len(got) != 1 {
+		t.Errorf("unknown type: status %d, %d events", code, len(got))
+	}
+	fail = true
+	if code := deliver(payload, header); code != http.StatusInternalServerError {
+		t.Errorf("failing handler: status %d", code)
+	}
+}
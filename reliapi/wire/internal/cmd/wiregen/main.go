@@ -0,0 +1,39 @@
+// Command wiregen writes the Go types of package wire from the proxy's
+// OpenAPI document. It is run by go generate in reliapi/wire:
+//
+//	wiregen -spec ../../openapi/openapi.yaml -out types_gen.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi/wire/internal/wiregen"
+)
+
+func main() {
+	spec := flag.String("spec", "", "OpenAPI 3.1 document to generate from")
+	out := flag.String("out", "", "Go file to write")
+	flag.Parse()
+	if *spec == "" || *out == "" {
+		fmt.Fprintln(os.Stderr, "usage: wiregen -spec openapi.yaml -out types_gen.go")
+		os.Exit(2)
+	}
+	if err := run(*spec, *out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(spec, out string) error {
+	doc, err := os.ReadFile(spec)
+	if err != nil {
+		return err
+	}
+	src, err := wiregen.Generate(doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
@@ -0,0 +1,298 @@
+// Package wiregen generates the Go types of package wire from the
+// component schemas of an OpenAPI 3.1 document.
+//
+// Each object schema becomes a struct with a field per property and an
+// Extra map for the members it has no field for; each string enum becomes
+// a named string type with a constant per value. Properties the schema
+// does not require, and nullable ones, are pointers unless their Go type
+// is already nilable (slices, maps and json.RawMessage). Shapes Go cannot
+// express directly, such as a union of two non-null types or an empty
+// schema, are json.RawMessage.
+package wiregen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Header starts every generated file.
+const Header = "// Code generated by wiregen from openapi/openapi.yaml. DO NOT EDIT."
+
+// commentWidth is where descriptions are wrapped.
+const commentWidth = 76
+
+// initialisms are the words of property names spelled in capitals in Go
+// names, as in RequestID and CostUSD.
+var initialisms = map[string]bool{
+	"api": true, "http": true, "id": true, "ip": true, "json": true, "llm": true,
+	"sse": true, "tls": true, "ttl": true, "uri": true, "url": true, "usd": true,
+}
+
+type document struct {
+	OpenAPI    string `yaml:"openapi"`
+	Components struct {
+		Schemas namedSchemas `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+type schema struct {
+	Type                 string       `yaml:"type"`
+	Description          string       `yaml:"description"`
+	Ref                  string       `yaml:"$ref"`
+	Enum                 []string     `yaml:"enum"`
+	Properties           namedSchemas `yaml:"properties"`
+	Required             []string     `yaml:"required"`
+	Items                *schema      `yaml:"items"`
+	AdditionalProperties *additional  `yaml:"additionalProperties"`
+	AnyOf                []*schema    `yaml:"anyOf"`
+}
+
+type namedSchema struct {
+	Name   string
+	Schema *schema
+}
+
+// namedSchemas keeps the order of a mapping of schemas, so fields come in
+// the order the spec lists properties.
+type namedSchemas []namedSchema
+
+func (n *namedSchemas) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping of schemas", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var s schema
+		if err := node.Content[i+1].Decode(&s); err != nil {
+			return err
+		}
+		*n = append(*n, namedSchema{Name: node.Content[i].Value, Schema: &s})
+	}
+	return nil
+}
+
+// additional is an additionalProperties value: true, or a schema.
+type additional struct {
+	Schema *schema
+}
+
+func (a *additional) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return nil
+	}
+	a.Schema = new(schema)
+	return node.Decode(a.Schema)
+}
+
+// Generate returns the gofmt-ed source of package wire for the OpenAPI
+// document spec, in YAML or JSON.
+func Generate(spec []byte) ([]byte, error) {
+	var doc document
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("wiregen: parse spec: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.1") {
+		return nil, fmt.Errorf("wiregen: spec is OpenAPI %q, want 3.1", doc.OpenAPI)
+	}
+	if len(doc.Components.Schemas) == 0 {
+		return nil, errors.New("wiregen: spec has no component schemas")
+	}
+	schemas := append(namedSchemas(nil), doc.Components.Schemas...)
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Name < schemas[j].Name })
+
+	g := &generator{enums: map[string]bool{}}
+	for _, s := range schemas {
+		if s.Schema.Type == "string" && len(s.Schema.Enum) > 0 {
+			g.enums[s.Name] = true
+		}
+	}
+	g.printf("%s\n\npackage wire\n\nimport \"encoding/json\"\n", Header)
+	for _, s := range schemas {
+		var err error
+		switch {
+		case g.enums[s.Name]:
+			g.enum(s.Name, s.Schema)
+		case s.Schema.Type == "object" || len(s.Schema.Properties) > 0:
+			err = g.object(s.Name, s.Schema)
+		default:
+			err = fmt.Errorf("schema %s is neither an object nor a string enum", s.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("wiregen: %w", err)
+		}
+	}
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("wiregen: format: %w", err)
+	}
+	return src, nil
+}
+
+type generator struct {
+	buf   bytes.Buffer
+	enums map[string]bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) comment(indent, name, description string) {
+	if description == "" {
+		return
+	}
+	g.printf("%s", wrap(indent, name+" "+description))
+}
+
+func (g *generator) enum(name string, s *schema) {
+	g.printf("\n")
+	g.comment("", name, s.Description)
+	g.printf("type %s string\n\nconst (\n", name)
+	for _, v := range s.Enum {
+		g.printf("\t%s%s %s = %q\n", name, goName(v), name, v)
+	}
+	g.printf(")\n")
+}
+
+func (g *generator) object(name string, s *schema) error {
+	required := map[string]bool{}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	g.printf("\n")
+	g.comment("", name, s.Description)
+	g.printf("type %s struct {\n", name)
+	fields := make([]string, 0, len(s.Properties))
+	for _, p := range s.Properties {
+		typ, nilable, nullable, err := g.goType(p.Schema)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", name, p.Name, err)
+		}
+		if !nilable && (nullable || !required[p.Name]) {
+			typ = "*" + typ
+		}
+		tag := p.Name
+		if !required[p.Name] {
+			tag += ",omitempty"
+		}
+		field := goName(p.Name)
+		g.comment("\t", field, p.Schema.Description)
+		g.printf("\t%s %s `json:%q`\n", field, typ, tag)
+		fields = append(fields, fmt.Sprintf("%q", p.Name))
+	}
+	g.printf("\n\t// Extra holds the members without a field, such as ones a newer\n")
+	g.printf("\t// server added. They are encoded back with the fields.\n")
+	g.printf("\tExtra map[string]json.RawMessage `json:\"-\"`\n}\n")
+
+	known := lowerFirst(name) + "Fields"
+	g.printf("\nvar %s = []string{%s}\n", known, strings.Join(fields, ", "))
+	g.printf("\n// UnmarshalJSON decodes v, keeping unknown members in v.Extra.\n")
+	g.printf("func (v *%s) UnmarshalJSON(data []byte) error {\n\ttype plain %s\n", name, name)
+	g.printf("\treturn unmarshalExtra(data, (*plain)(v), &v.Extra, %s)\n}\n", known)
+	g.printf("\n// MarshalJSON encodes v with the members of v.Extra.\n")
+	g.printf("func (v %s) MarshalJSON() ([]byte, error) {\n\ttype plain %s\n", name, name)
+	g.printf("\treturn marshalExtra(plain(v), v.Extra, %s)\n}\n", known)
+	return nil
+}
+
+// goType returns the Go type of s, whether it can hold nil, and whether
+// s allows null.
+func (g *generator) goType(s *schema) (typ string, nilable, nullable bool, err error) {
+	if len(s.AnyOf) > 0 {
+		var rest []*schema
+		for _, alt := range s.AnyOf {
+			if alt.Type == "null" {
+				nullable = true
+			} else {
+				rest = append(rest, alt)
+			}
+		}
+		if len(rest) != 1 {
+			return "json.RawMessage", true, nullable, nil
+		}
+		typ, nilable, _, err = g.goType(rest[0])
+		return typ, nilable, nullable, err
+	}
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		if name == s.Ref {
+			return "", false, false, fmt.Errorf("unsupported $ref %q", s.Ref)
+		}
+		return name, false, false, nil
+	}
+	switch s.Type {
+	case "string":
+		return "string", false, false, nil
+	case "integer":
+		return "int", false, false, nil
+	case "number":
+		return "float64", false, false, nil
+	case "boolean":
+		return "bool", false, false, nil
+	case "array":
+		if s.Items == nil {
+			return "[]json.RawMessage", true, false, nil
+		}
+		elem, _, _, err := g.goType(s.Items)
+		return "[]" + elem, true, false, err
+	case "object":
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+			elem, _, _, err := g.goType(s.AdditionalProperties.Schema)
+			return "map[string]" + elem, true, false, err
+		}
+		return "map[string]interface{}", true, false, nil
+	case "":
+		return "json.RawMessage", true, false, nil
+	}
+	return "", false, false, fmt.Errorf("unsupported type %q", s.Type)
+}
+
+// goName turns a snake_case name into an exported Go name.
+func goName(s string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(s, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+		} else {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// wrap formats text as a comment indented by indent, a paragraph per
+// blank-line-separated block, wrapped at commentWidth.
+func wrap(indent, text string) string {
+	var b strings.Builder
+	for i, para := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		if i > 0 {
+			b.WriteString(indent + "//\n")
+		}
+		line := ""
+		for _, word := range strings.Fields(para) {
+			if line != "" && len(line)+1+len(word) > commentWidth {
+				b.WriteString(indent + "// " + line + "\n")
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		if line != "" {
+			b.WriteString(indent + "// " + line + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package wiregen
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSpec = `
+openapi: 3.1.0
+components:
+  schemas:
+    Widget:
+      type: object
+      description: A widget.
+      required: [widget_id, size]
+      properties:
+        widget_id:
+          type: string
+        size:
+          anyOf:
+          - type: integer
+          - type: 'null'
+        label:
+          type: string
+          description: Shown to users
+        mode:
+          $ref: '#/components/schemas/Mode'
+        tags:
+          type: array
+          items:
+            type: string
+        limits:
+          type: object
+          additionalProperties:
+            type: number
+        value:
+          anyOf:
+          - type: string
+          - type: integer
+    Mode:
+      type: string
+      enum: [fast, stale_ok]
+`
+
+func TestGenerate(t *testing.T) {
+	src, err := Generate([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Compared with gofmt's alignment collapsed
+	out := strings.Join(strings.FieldsFunc(string(src), func(r rune) bool { return r == ' ' || r == '\t' }), " ")
+	for _, want := range []string{
+		Header,
+		"type Mode string",
+		`ModeStaleOk Mode = "stale_ok"`,
+		"// Widget A widget.\ntype Widget struct {",
+		"WidgetID string `json:\"widget_id\"`",
+		"Size *int `json:\"size\"`",
+		"// Label Shown to users\n Label *string `json:\"label,omitempty\"`",
+		"Mode *Mode `json:\"mode,omitempty\"`",
+		"Tags []string `json:\"tags,omitempty\"`",
+		"Limits map[string]float64 `json:\"limits,omitempty\"`",
+		"Value json.RawMessage `json:\"value,omitempty\"`",
+		"Extra map[string]json.RawMessage `json:\"-\"`",
+		`var widgetFields = []string{"widget_id", "size", "label", "mode", "tags", "limits", "value"}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated source lacks %q:\n%s", want, out)
+		}
+	}
+	// Schemas are sorted by name
+	if strings.Index(out, "type Mode") > strings.Index(out, "type Widget") {
+		t.Error("Mode generated after Widget")
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, spec := range []string{
+		"openapi: 3.0.3\ncomponents: {schemas: {A: {type: object}}}",
+		"openapi: 3.1.0\ncomponents: {}",
+		"openapi: 3.1.0\ncomponents: {schemas: {A: {type: integer}}}",
+		"openapi: 3.1.0\ncomponents: {schemas: {A: {type: object, properties: {b: {$ref: 'other.yaml#/B'}}}}}",
+	} {
+		if _, err := Generate([]byte(spec)); err == nil {
+			t.Errorf("Generate(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	got := wrap("\t", "Name "+strings.Repeat("word ", 20)+"\n\nSecond paragraph.")
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != 4 || lines[2] != "\t//" || lines[3] != "\t// Second paragraph." {
+		t.Errorf("wrap = %q", got)
+	}
+	for _, line := range lines {
+		if len(line) > commentWidth+4 {
+			t.Errorf("line too long: %q", line)
+		}
+	}
+}
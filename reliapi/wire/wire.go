@@ -0,0 +1,96 @@
+// Package wire holds the JSON types of the ReliAPI proxy's HTTP API, as
+// its OpenAPI document (openapi/openapi.yaml, served at GET /openapi.json)
+// defines them. The types are generated: edit the spec and run go
+// generate, and TestGeneratedTypesUpToDate fails until they are.
+//
+// Package reliapi's hand-written types are the ones to program against;
+// wire is the layer under them, for callers that need the exact request
+// and response shapes, and the record reliapi's types are checked against.
+//
+// Each struct keeps the members of a decoded object it has no field for
+// in Extra, and encodes them back, so data from a newer server survives a
+// decode and re-encode by an older client.
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+//go:generate go run ./internal/cmd/wiregen -spec ../../openapi/openapi.yaml -out types_gen.go
+
+// UnknownFields returns the members of the JSON object data whose names
+// are not among known, or nil if there are none or data is not an object.
+func UnknownFields(data []byte, known []string) map[string]json.RawMessage {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil
+	}
+	for _, name := range known {
+		delete(members, name)
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return members
+}
+
+// unmarshalExtra decodes data into v, a generated struct's plain form, and
+// sets *extra to the members it has no field for.
+func unmarshalExtra(data []byte, v interface{}, extra *map[string]json.RawMessage, known []string) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	*extra = UnknownFields(data, known)
+	return nil
+}
+
+// marshalExtra encodes v, a generated struct's plain form, and appends the
+// members of extra in name order. Members named like a field are dropped:
+// the field is what the caller set.
+func marshalExtra(v interface{}, extra map[string]json.RawMessage, known []string) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		if !contains(known, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return data, nil
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	for i, name := range names {
+		if i > 0 || len(data) > 2 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value := extra[name]
+		if len(value) == 0 {
+			value = json.RawMessage("null")
+		}
+		if err := json.Compact(&buf, value); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi/wire/internal/wiregen"
+)
+
+// TestGeneratedTypesUpToDate fails when openapi/openapi.yaml changed
+// without types_gen.go being regenerated.
+func TestGeneratedTypesUpToDate(t *testing.T) {
+	spec, err := os.ReadFile("../../openapi/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := wiregen.Generate(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("types_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("types_gen.go is stale: run go generate ./reliapi/wire")
+	}
+}
+
+func TestExtraRoundTrip(t *testing.T) {
+	data := []byte(`{"success":true,"data":{"content":"Hi","model":"gpt-4o-mini","reasoning":"short"},` +
+		`"meta":{"request_id":"req_1","duration_ms":3,"region":"eu","shard":{"id":7}}}`)
+	var resp LLMSuccessResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Content != "Hi" || string(resp.Data.Extra["reasoning"]) != `"short"` {
+		t.Errorf("data = %+v", resp.Data)
+	}
+	if resp.Meta.RequestID != "req_1" || len(resp.Meta.Extra) != 2 || string(resp.Meta.Extra["shard"]) != `{"id":7}` {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+	if resp.Extra != nil {
+		t.Errorf("extra = %v", resp.Extra)
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back struct {
+		Data, Meta map[string]interface{}
+	}
+	if err := json.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Data["reasoning"] != "short" || back.Meta["region"] != "eu" || back.Meta["request_id"] != "req_1" {
+		t.Errorf("re-encoded = %s", out)
+	}
+
+	// A field wins over an Extra member of the same name
+	usage := TokenUsage{TotalTokens: 3, Extra: map[string]json.RawMessage{"total_tokens": json.RawMessage(`9`)}}
+	if out, _ := json.Marshal(usage); string(out) != `{"prompt_tokens":0,"completion_tokens":0,"total_tokens":3}` {
+		t.Errorf("usage = %s", out)
+	}
+	empty := ErrorDetail{}
+	empty.Extra = map[string]json.RawMessage{"trace": json.RawMessage(`[1, 2]`)}
+	if out, _ := json.Marshal(empty); !bytes.HasSuffix(out, []byte(`,"trace":[1,2]}`)) {
+		t.Errorf("detail = %s", out)
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	if got := UnknownFields([]byte(`{"a":1,"b":2}`), []string{"a", "b"}); got != nil {
+		t.Errorf("UnknownFields = %v", got)
+	}
+	if got := UnknownFields([]byte(`[1]`), nil); got != nil {
+		t.Errorf("UnknownFields(array) = %v", got)
+	}
+	if got := UnknownFields([]byte(`{"a":1,"c":true}`), []string{"a"}); len(got) != 1 || string(got["c"]) != "true" {
+		t.Errorf("UnknownFields = %v", got)
+	}
+}
@@ -0,0 +1,86 @@
+package reliapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/KikuAI-Lab/reliapi/reliapi/wire"
+)
+
+// TestWireCoverage fails when the spec has a field the hand-written type
+// of the same object cannot send or decode, so drift between them shows
+// up as soon as wire is regenerated.
+func TestWireCoverage(t *testing.T) {
+	for _, tc := range []struct {
+		hand, wire interface{}
+	}{
+		{LLMRequest{}, wire.LLMProxyRequest{}},
+		{HTTPRequest{}, wire.HTTPProxyRequest{}},
+		{GraphQLRequest{}, wire.GraphQLProxyRequest{}},
+		{EmbeddingsRequest{}, wire.EmbeddingsRequest{}},
+		{Meta{}, wire.MetaResponse{}},
+		{errorDetail{}, wire.ErrorDetail{}},
+		{RetryPolicy{}, wire.RetryPolicy{}},
+		{HedgePolicy{}, wire.HedgePolicy{}},
+		{SemanticCacheConfig{}, wire.SemanticCacheConfig{}},
+		{ContextPolicy{}, wire.ContextPolicy{}},
+		{FallbackTarget{}, wire.FallbackTarget{}},
+		{FallbackResponse{}, wire.FallbackResponse{}},
+		{TemplateRef{}, wire.TemplateRef{}},
+		{CompareConfig{}, wire.CompareConfig{}},
+		{ReplayOverrides{}, wire.ReplayRequest{}},
+		{Comparison{}, wire.ComparisonMeta{}},
+		{ToolDefinition{}, wire.ToolDefinition{}},
+		{ResponseFormat{}, wire.ResponseFormat{}},
+		{MultipartBody{}, wire.MultipartBody{}},
+		// MultipartPart is encoded through multipartPartJSON
+		{multipartPartJSON{}, wire.MultipartPart{}},
+	} {
+		have := map[string]bool{}
+		for _, name := range jsonFieldNames(reflect.TypeOf(tc.hand)) {
+			have[name] = true
+		}
+		var missing []string
+		for _, name := range jsonFieldNames(reflect.TypeOf(tc.wire)) {
+			if !have[name] {
+				missing = append(missing, name)
+			}
+		}
+		sort.Strings(missing)
+		if len(missing) > 0 {
+			t.Errorf("%T lacks fields of %T: %v", tc.hand, tc.wire, missing)
+		}
+	}
+}
+
+func TestMetaExtra(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"content": "Hi"},
+			"meta": map[string]interface{}{
+				"request_id": "req_1", "routellm_route_name": "cheap",
+				"region": "eu-west", "shard": map[string]interface{}{"id": 7},
+			},
+		})
+	})
+	resp, err := c.ProxyLLM(context.Background(), llmReq("Hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Meta.RequestID != "req_1" || resp.Meta.RouteLLMRouteName != "cheap" {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+	if len(resp.Meta.Extra) != 2 || string(resp.Meta.Extra["region"]) != `"eu-west"` || string(resp.Meta.Extra["shard"]) != `{"id":7}` {
+		t.Errorf("Extra = %v", resp.Meta.Extra)
+	}
+
+	var meta Meta
+	if err := json.Unmarshal([]byte(`{"request_id":"req_2"}`), &meta); err != nil || meta.Extra != nil {
+		t.Errorf("meta = %+v, %v", meta, err)
+	}
+}
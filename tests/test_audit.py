@@ -0,0 +1,160 @@
+"""Tests for audit capture of upstream attempts and the audit records."""
+from datetime import datetime, timedelta, timezone
+
+import pytest
+
+from reliapi.app import services
+from reliapi.app.schemas import ErrorDetail, ErrorResponse, MetaResponse, SuccessResponse
+from reliapi.app.services import audit_record, audit_search, record_audit
+from reliapi.core.audit import AuditLog, capture_attempts, final_attempt, record_attempt
+
+# Records are kept for 7 days from when they are stored
+NOW = datetime.now(timezone.utc)
+
+
+@pytest.fixture(autouse=True)
+def fresh_audit_log():
+    """Isolate the process-wide audit log between tests."""
+    services._audit_log.reset()
+    yield
+    services._audit_log.reset()
+
+
+def _attempt(status_code=200, error=None, request_body=b'{"q": 1}', response_body=b'{"ok": true}'):
+    record_attempt("POST", "https://api.example.com/v1/x", NOW, 12, status_code, error, request_body, response_body)
+
+
+def test_capture_off_records_nothing():
+    with capture_attempts(None) as attempts:
+        _attempt()
+    assert attempts is None
+    with capture_attempts({"capture": "off"}) as attempts:
+        _attempt()
+    assert attempts is None
+
+
+def test_capture_metadata_keeps_no_bodies():
+    with capture_attempts({"capture": "metadata"}) as attempts:
+        _attempt(503, "Server error: 503")
+        _attempt()
+    # Attempts outside the block are not captured
+    _attempt()
+    assert [a["attempt"] for a in attempts] == [1, 2]
+    assert attempts[0]["status_code"] == 503 and attempts[0]["error"] == "Server error: 503"
+    assert "request" not in attempts[1] and "response" not in attempts[1]
+    assert final_attempt(attempts) == 2
+
+
+def test_capture_full_cuts_bodies():
+    with capture_attempts({"capture": "full", "max_body_bytes": 4}) as attempts:
+        _attempt(request_body=None, response_body=b"abcdefgh")
+    assert attempts[0]["request"] == {"body": None, "body_bytes": 0, "body_truncated": False}
+    assert attempts[0]["response"] == {"body": "abcd", "body_bytes": 8, "body_truncated": True}
+
+
+def test_final_attempt_without_a_response():
+    with capture_attempts({"capture": "metadata"}) as attempts:
+        _attempt(None, "ConnectError")
+        _attempt(None, "ConnectError")
+    assert final_attempt(attempts) == 2
+    assert final_attempt([]) is None
+
+
+def test_audit_log_drops_old_and_excess_records():
+    log = AuditLog(max_records=2)
+    old = (NOW - timedelta(days=8)).isoformat()
+    log.store({"request_id": "req_old", "created_at": old, "tenant": "a", "target": "x"}, now=NOW)
+    assert log.get("req_old") is None
+    for i in range(3):
+        log.store({"request_id": f"req_{i}", "created_at": NOW.isoformat(), "tenant": "a", "target": "x"}, now=NOW)
+    assert log.get("req_0") is None and log.get("req_2") is not None
+
+
+def test_audit_log_search():
+    log = AuditLog()
+    for i, (tenant, target, served_by) in enumerate([("a", "x", "x"), ("a", "y", "x"), ("b", "x", "x"), ("a", "y", "y")]):
+        created = (NOW + timedelta(minutes=i)).isoformat()
+        log.store({"request_id": f"req_{i}", "created_at": created, "tenant": tenant, "target": target, "served_by": served_by}, now=NOW)
+    end = NOW + timedelta(hours=1)
+    assert [r["request_id"] for r in log.search("a", NOW, end)] == ["req_0", "req_1", "req_3"]
+    assert [r["request_id"] for r in log.search("a", NOW, end, target="x")] == ["req_0", "req_1"]
+    assert [r["request_id"] for r in log.search(None, NOW, end, all_tenants=True)] == ["req_0", "req_1", "req_2", "req_3"]
+    assert log.search("a", NOW + timedelta(minutes=1), NOW + timedelta(minutes=3)) == [log.get("req_1")]
+
+
+TARGETS = {
+    "billing": {
+        "base_url": "https://billing.example.com",
+        "audit": {"capture": "full", "max_body_bytes": 1024},
+        "redaction": {"enabled": True, "patterns": ["email"]},
+    },
+}
+
+
+def _record(request_id, tenant, success=True):
+    meta = MetaResponse(target="billing", duration_ms=20, request_id=request_id)
+    if success:
+        result = SuccessResponse(success=True, data={"status_code": 200}, meta=meta)
+    else:
+        error = ErrorDetail(type="upstream_error", code="UPSTREAM_5XX", message="Bad gateway", retryable=True)
+        result = ErrorResponse(success=False, error=error, meta=meta)
+    with capture_attempts(TARGETS["billing"]["audit"]) as attempts:
+        _attempt(502, "Server error: 502", b'{"email": "ada@example.com"}', b"bad gateway")
+        _attempt(200, None, b'{"email": "ada@example.com"}', b'{"to": "ada@example.com"}')
+    record_audit(result, "http", "billing", TARGETS, tenant, "sk_live_abcdef123456", attempts, NOW, "POST", "/charge")
+
+
+def test_record_redacts_bodies_with_target_patterns():
+    _record("req_1", "acme")
+    record = audit_record("req_1", None, admin=True)
+    assert record["final_attempt"] == 2 and len(record["attempts"]) == 2
+    assert record["attempts"][1]["request"]["body"] == '{"email": "[EMAIL_1]"}'
+    assert record["attempts"][1]["response"]["body"] == '{"to": "[EMAIL_1]"}'
+    assert record["method"] == "POST" and record["path"] == "/charge" and record["tenant"] == "acme"
+
+
+def test_record_bodies_are_for_the_admin_key_only():
+    _record("req_1", "acme", success=False)
+    record = audit_record("req_1", "acme")
+    assert record["bodies_omitted"] is True
+    assert record["error_code"] == "UPSTREAM_5XX" and record["success"] is False
+    assert all("request" not in a and "response" not in a for a in record["attempts"])
+    assert audit_record("req_1", "other") is None
+    assert audit_record("req_missing", "acme") is None
+
+
+def test_records_of_targets_without_audit_are_not_kept():
+    meta = MetaResponse(target="billing", duration_ms=20, request_id="req_unaudited")
+    with capture_attempts(None) as attempts:
+        _attempt()
+    record_audit(SuccessResponse(success=True, data={}, meta=meta), "http", "billing", {}, "acme", None, attempts, NOW)
+    assert audit_record("req_unaudited", "acme") is None
+
+
+def test_audit_search_pages_through_a_tenant():
+    for i in range(3):
+        _record(f"req_{i}", "acme")
+    _record("req_other", "other")
+    end = NOW + timedelta(hours=1)
+    page = audit_search("acme", NOW, end, limit=2)
+    assert [r["request_id"] for r in page["records"]] == ["req_0", "req_1"]
+    page = audit_search("acme", NOW, end, limit=2, cursor=page["next_cursor"])
+    assert [r["request_id"] for r in page["records"]] == ["req_2"] and page["next_cursor"] is None
+    assert len(audit_search(None, NOW, end, admin=True)["records"]) == 4
+
+    cursor = audit_search("acme", NOW, end, limit=1)["next_cursor"]
+    with pytest.raises(ValueError):
+        audit_search("acme", NOW, end, target="billing", cursor=cursor)
+
+
+def test_audit_cursor_survives_dropped_records():
+    for i in range(4):
+        _record(f"req_{i}", "acme")
+    end = NOW + timedelta(hours=1)
+    cursor = audit_search("acme", NOW, end, limit=2)["next_cursor"]
+
+    # The record the cursor points at, and the one before it, are dropped
+    del services._audit_log._records["req_0"], services._audit_log._records["req_1"]
+    page = audit_search("acme", NOW, end, limit=2, cursor=cursor)
+    assert [r["request_id"] for r in page["records"]] == ["req_2", "req_3"]
+    assert page["next_cursor"] is None
@@ -0,0 +1,170 @@
+"""Tests for Azure OpenAI targets: deployment routing, auth and pricing."""
+import json
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+from pydantic import ValidationError
+
+from reliapi.adapters.llm.azure_openai import AzureOpenAIAdapter
+from reliapi.adapters.llm.factory import detect_provider
+from reliapi.app import services
+from reliapi.app.services import handle_llm_proxy, handle_llm_stream_generator
+from reliapi.config.schema import LLMConfig
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+
+LLM_CONFIG = {
+    "provider": "azure_openai",
+    "default_model": "gpt-4o",
+    "azure": {"api_version": "2024-10-21", "deployments": {"gpt-4o": "prod-gpt4o", "gpt-4o-mini": "prod mini"}},
+}
+CHAT_PATH = "/openai/deployments/prod-gpt4o/chat/completions?api-version=2024-10-21"
+TARGETS = {
+    "azure": {
+        "base_url": "https://myres.openai.azure.com",
+        "cache": {"enabled": False},
+        "auth": {"type": "bearer_env", "env_var": "AZURE_OPENAI_KEY"},
+        "llm": LLM_CONFIG,
+    }
+}
+USER = {"role": "user", "content": "Hi"}
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers(monkeypatch):
+    """Isolate the process-wide circuit breakers between tests."""
+    monkeypatch.setenv("AZURE_OPENAI_KEY", "az-secret")
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+def test_deployment_paths():
+    assert detect_provider("https://myres.openai.azure.com") == "azure_openai"
+    assert detect_provider("https://api.openai.com/v1") == "openai"
+    assert services._llm_api_path("azure_openai", "gpt-4o", LLM_CONFIG) == CHAT_PATH
+    assert services._llm_api_path("azure_openai", "gpt-4o-mini", LLM_CONFIG).startswith(
+        "/openai/deployments/prod%20mini/chat/completions?"
+    )
+
+
+def test_auth_header():
+    """Test that Azure keys go in api-key unless the target's auth names another header."""
+    assert services._auth_header(TARGETS["azure"], {}) == ("api-key", "")
+    assert services._auth_header(TARGETS["azure"], {"header": "Authorization"}) == ("Authorization", "Bearer ")
+    assert services._auth_header({"llm": {"provider": "openai"}}, {}) == ("Authorization", "Bearer ")
+
+
+def test_pricing():
+    adapter = AzureOpenAIAdapter()
+    assert adapter.get_cost_usd("gpt-4o", 1_000_000, 1_000_000) == pytest.approx(12.5)
+    assert adapter.get_cost_usd("gpt-35-turbo", 1_000_000, 0) == pytest.approx(0.5)
+
+
+def test_config_needs_deployments():
+    with pytest.raises(ValidationError, match="needs azure"):
+        LLMConfig(provider="azure_openai")
+    with pytest.raises(ValidationError):
+        LLMConfig(provider="azure_openai", azure={"api_version": "2024-10-21", "deployments": {}})
+
+
+async def _call(model, body=None):
+    upstream = AsyncMock(return_value=httpx.Response(
+        200, request=httpx.Request("POST", "https://myres.openai.azure.com" + CHAT_PATH), json=body or {},
+    ))
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_llm_proxy(
+            target_name="azure",
+            messages=[USER],
+            model=model,
+            max_tokens=64,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=TARGETS,
+            cache=cache,
+            idempotency=Mock(spec=IdempotencyManager),
+            request_id="req_azure",
+        )
+    return result, upstream
+
+
+@pytest.mark.asyncio
+async def test_request_routed_to_deployment():
+    """Test that a request goes to its model's deployment and is billed at Azure's prices."""
+    result, upstream = await _call("gpt-4o", {
+        "id": "chatcmpl-1",
+        "model": "gpt-4o-2024-08-06",
+        "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Hello"}}],
+        "usage": {"prompt_tokens": 400, "completion_tokens": 100, "total_tokens": 500},
+    })
+
+    kwargs = upstream.call_args.kwargs
+    assert kwargs["url"] == "https://myres.openai.azure.com" + CHAT_PATH
+    assert kwargs["headers"]["api-key"] == "az-secret"
+    assert "model" not in json.loads(kwargs["content"])
+    assert result.success
+    assert result.data["content"] == "Hello"
+    assert result.meta.deployment == "prod-gpt4o"
+    assert result.meta.model == "gpt-4o"
+    assert result.meta.cost_usd == pytest.approx(400 / 1e6 * 2.5 + 100 / 1e6 * 10)
+
+
+@pytest.mark.asyncio
+async def test_unmapped_model_lists_deployments():
+    result, upstream = await _call("gpt-4")
+
+    assert not result.success
+    assert result.error.code == "BAD_REQUEST"
+    assert result.error.status_code == 400
+    assert result.error.details == {"field": "model", "model": "gpt-4", "deployments": ["gpt-4o", "gpt-4o-mini"]}
+    assert "gpt-4o, gpt-4o-mini" in result.error.message
+    upstream.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_stream_routed_to_deployment():
+    """Test that a stream goes to the deployment and reports it in its meta event."""
+    seen = {}
+
+    async def stream_chat(self, client, base_url, api_path, payload, headers):
+        seen.update(api_path=api_path, headers=headers, payload=payload)
+        yield {"choices": [], "prompt_filter_results": []}
+        yield {"choices": [{"delta": {"content": "Hello"}, "finish_reason": "stop"}]}
+        yield {"_usage_only": True, "usage": {"prompt_tokens": 400, "completion_tokens": 100}}
+
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    events = []
+    with patch.object(AzureOpenAIAdapter, "stream_chat", stream_chat):
+        async for event in handle_llm_stream_generator(
+            target_name="azure",
+            messages=[USER],
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=TARGETS,
+            cache=cache,
+            idempotency=Mock(spec=IdempotencyManager),
+            request_id="req_azure_stream",
+        ):
+            name = event.split("event: ")[1].split("\n")[0]
+            events.append((name, json.loads(event.split("data: ")[1])))
+
+    assert seen["api_path"] == CHAT_PATH
+    assert seen["headers"]["api-key"] == "az-secret"
+    assert "model" not in seen["payload"]
+    assert events[0] == ("meta", events[0][1]) and events[0][1]["deployment"] == "prod-gpt4o"
+    assert "".join(data["delta"] for name, data in events if name == "chunk") == "Hello"
+    assert events[-1][0] == "done"
+    assert events[-1][1]["cost_usd"] == pytest.approx(400 / 1e6 * 2.5 + 100 / 1e6 * 10)
@@ -0,0 +1,93 @@
+"""Tests for budget alerts and run-rate projections."""
+from datetime import datetime, timezone
+from unittest.mock import patch
+
+import pytest
+from pydantic import ValidationError
+
+from reliapi.app import services
+from reliapi.config.schema import BudgetAlertsConfig
+from reliapi.core.budget import BudgetLedger
+from reliapi.core.budget_alerts import BudgetAlertConfig, BudgetAlertLog
+from reliapi.core.key_limits import KeyLimits
+
+TEAM_A = KeyLimits(name="team-a", monthly_budget_usd=10.0, alert_thresholds=(0.5,))
+
+
+@pytest.fixture(autouse=True)
+def fresh_ledgers():
+    """Isolate the process-wide ledgers and alerts between tests."""
+    for ledger in (services._budget_ledger, services._key_budget_ledger, services._budget_alerts):
+        ledger.reset()
+    yield
+    for ledger in (services._budget_ledger, services._key_budget_ledger, services._budget_alerts):
+        ledger.reset()
+
+
+def _at(day, hour=12):
+    return datetime(2026, 10, day, hour, tzinfo=timezone.utc)
+
+
+def test_run_rate_averages_the_trailing_week():
+    ledger = BudgetLedger()
+    assert ledger.run_rate("acme", _at(10)) == 0.0
+    # A ledger younger than a week averages over the days it has seen
+    ledger.record("acme", 2.0, _at(10))
+    ledger.record("acme", 4.0, _at(11))
+    assert ledger.run_rate("acme", _at(11)) == 3.0
+    # Spend older than seven days drops out of the average
+    ledger.record("acme", 7.0, _at(20))
+    assert ledger.run_rate("acme", _at(20)) == 1.0
+    # Projection: spend so far plus the run rate over the rest of October
+    assert ledger.projected("acme", _at(20, 0)) == pytest.approx(13.0 + 12 * 1.0)
+
+
+def test_thresholds_fire_once_per_month():
+    log = BudgetAlertLog()
+    fired = log.check("acme", None, 9.6, 10.0, 12.0, 0.5, (0.5, 0.8, 0.95), _at(14))
+    assert [a["threshold"] for a in fired] == [0.5, 0.8, 0.95]
+    assert fired[0]["projected_usd"] == 12.0 and fired[0]["reset_at"].startswith("2026-11-01")
+    assert log.check("acme", None, 9.9, 10.0, 12.0, 0.5, (0.5, 0.8, 0.95), _at(15)) == []
+    # Keys and tenants alert separately
+    assert len(log.check("acme", "team-a", 6.0, 10.0, 8.0, 0.2, (0.5,), _at(15))) == 1
+    assert len(log.list("acme", now=_at(15))) == 3
+    assert len(log.list("acme", "team-a", now=_at(15))) == 4
+    # A new month starts over
+    november = datetime(2026, 11, 2, tzinfo=timezone.utc)
+    assert log.list("acme", now=november) == []
+    assert len(log.check("acme", None, 6.0, 10.0, 8.0, 0.2, (0.5,), november)) == 1
+
+
+def test_spend_fires_tenant_and_key_alerts():
+    services._budget_ledger.record("acme", 8.5)
+    services._key_budget_ledger.record("team-a", 5.0)
+    config = BudgetAlertConfig(webhook_url="https://hooks.example.com/budget", webhook_secret="s3cret")
+    with patch.object(services, "deliver_webhook") as deliver, patch.object(services.asyncio, "create_task") as create:
+        fired = services.check_budget_alerts("acme", 10.0, TEAM_A, config)
+    # The tenant uses the configured thresholds, the key its own
+    assert [(a["api_key"], a["threshold"]) for a in fired] == [(None, 0.5), (None, 0.8), ("team-a", 0.5)]
+    assert create.call_count == 3
+    event = deliver.call_args_list[0].args[1]
+    assert event["type"] == "budget.threshold_reached" and event["data"]["cap_usd"] == 10.0
+    assert services.check_budget_alerts("acme", 10.0, TEAM_A, config) == []
+    assert len(services.budget_alerts("acme", TEAM_A)) == 3
+
+
+def test_remaining_budget_reported_from_80_percent():
+    services._budget_ledger.record("acme", 7.0)
+    assert services.budget_remaining("acme", 10.0, None) is None
+    services._budget_ledger.record("acme", 1.5)
+    assert services.budget_remaining("acme", 10.0, None) == pytest.approx(1.5)
+    # With a key budget the smaller remainder is reported
+    assert services.budget_remaining("acme", 10.0, TEAM_A) == pytest.approx(1.5)
+    services._key_budget_ledger.record("team-a", 9.0)
+    assert services.budget_remaining("acme", 10.0, TEAM_A) == pytest.approx(1.0)
+
+
+def test_alert_thresholds_validation():
+    assert BudgetAlertsConfig().thresholds == [0.5, 0.8, 0.95]
+    assert BudgetAlertsConfig(thresholds=[0.9, 0.5, 0.9]).thresholds == [0.5, 0.9]
+    with pytest.raises(ValidationError):
+        BudgetAlertsConfig(thresholds=[80])
+    with pytest.raises(ValidationError):
+        BudgetAlertsConfig(thresholds=[])
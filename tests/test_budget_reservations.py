@@ -0,0 +1,206 @@
+"""Tests for budget reservations of LLM requests in flight."""
+import asyncio
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.adapters.llm.openai import OpenAIAdapter
+from reliapi.app import services
+from reliapi.app.services import budget_status, handle_llm_proxy, record_usage
+from reliapi.core.budget import BudgetHolds, BudgetLedger
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.key_limits import KeyLimits
+
+TEAM_A = KeyLimits(name="team-a", monthly_budget_usd=1.0)
+
+
+@pytest.fixture(autouse=True)
+def fresh_ledgers():
+    """Isolate the process-wide ledgers and limiters between tests."""
+    for ledger in (services._budget_ledger, services._key_budget_ledger, services._target_concurrency):
+        ledger.reset()
+    services._circuit_breakers.clear()
+    yield
+    for ledger in (services._budget_ledger, services._key_budget_ledger, services._target_concurrency):
+        ledger.reset()
+    services._circuit_breakers.clear()
+
+
+def test_reservations_count_against_the_cap():
+    ledger = BudgetLedger()
+    ledger.record("acme", 0.5)
+    first = ledger.reserve("acme", 0.3, 1.0)
+    assert first is not None and ledger.reserved("acme") == 0.3
+    # 0.5 spent and 0.3 held leave 0.2: an estimate equal to it passes
+    second = ledger.reserve("acme", 0.2, 1.0)
+    assert second is not None
+    assert ledger.reserve("acme", 0.01, 1.0) is None
+    assert ledger.reserved("acme") == pytest.approx(0.5)
+    # Other tenants hold their own
+    assert ledger.reserve("other", 1.0, 1.0) is not None
+
+    ledger.release(first)
+    assert ledger.reserve("acme", 0.3, 1.0) is not None
+
+
+def test_release_counts_overshoots():
+    ledger = BudgetLedger()
+    reservation = ledger.reserve(None, 0.1, 1.0)
+    ledger.record(None, 0.08)
+    ledger.release(reservation, 0.08)
+    assert ledger.overshoot(None) == (0, 0.0)
+
+    reservation = ledger.reserve(None, 0.1, 1.0)
+    ledger.record(None, 0.15)
+    ledger.release(reservation, 0.15)
+    count, usd = ledger.overshoot(None)
+    assert count == 1 and usd == pytest.approx(0.05)
+    # A failed request releases without a cost
+    ledger.release(ledger.reserve(None, 0.1, 1.0))
+    assert ledger.reserved(None) == 0.0 and ledger.overshoot(None)[0] == 1
+
+
+def test_rejection_reports_reserved_and_spent():
+    services._budget_ledger.record("acme", 0.5)
+    holds = BudgetHolds()
+    assert services._budget_rejection(0.3, None, 1.0, "acme", None, holds) is None
+    assert budget_status("acme", 1.0)["reserved_usd"] == 0.3
+
+    policy, message, details = services._budget_rejection(0.3, None, 1.0, "acme")
+    assert policy == "budget_rejected"
+    assert details["spent_usd"] == 0.5 and details["reserved_usd"] == 0.3
+    assert "$0.200000" in message and "reserved by requests in flight" in message
+
+    # A rejection by the key's budget gives back the tenant's hold
+    services._key_budget_ledger.record("team-a", 0.9)
+    policy, _, details = services._budget_rejection(0.15, None, 10.0, "acme", TEAM_A, BudgetHolds())
+    assert policy == "key_budget_rejected"
+    assert details["spent_usd"] == 0.9 and details["reserved_usd"] == 0.0
+    assert budget_status("acme", 1.0)["reserved_usd"] == 0.3
+
+    holds.release()
+    assert budget_status("acme", 1.0)["reserved_usd"] == 0.0
+
+
+TARGETS = {
+    "openai": {
+        "base_url": "https://api.openai.com/v1",
+        "cache": {"enabled": False},
+        "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+    }
+}
+
+ESTIMATE = 0.1
+# What the requests cost, in turn: up to 50% off their estimate either way
+ACTUALS = [0.05, 0.12, 0.15, 0.08, 0.1]
+
+
+def _completion():
+    return httpx.Response(
+        200,
+        request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"),
+        json={
+            "choices": [{"message": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"}],
+            "usage": {"prompt_tokens": 10, "completion_tokens": 2},
+        },
+    )
+
+
+async def _call(i, **kwargs):
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    return await handle_llm_proxy(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Hi"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        stream=False,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=TARGETS,
+        cache=cache,
+        idempotency=Mock(spec=IdempotencyManager),
+        request_id=f"req_{i}",
+        tenant="acme",
+        **kwargs,
+    )
+
+
+async def _slow_completion(*args, **kwargs):
+    await asyncio.sleep(0.05)
+    return _completion()
+
+
+async def _slow_rejection(*args, **kwargs):
+    await asyncio.sleep(0.05)
+    return httpx.Response(
+        400,
+        request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"),
+        json={"error": {"message": "bad request"}},
+    )
+
+
+async def _run_parallel(n, call=_call, upstream=_slow_completion, **kwargs):
+    """Send n requests at once to upstream, each estimated at ESTIMATE and
+    costing the next of ACTUALS."""
+    costs = iter(ACTUALS * n)
+    with patch("reliapi.app.services.CostEstimator") as estimator, \
+            patch.object(httpx.AsyncClient, "request", new=AsyncMock(side_effect=upstream)), \
+            patch.object(OpenAIAdapter, "get_cost_usd", side_effect=lambda *a, **kw: next(costs)):
+        estimator.estimate_from_messages.return_value = ESTIMATE
+        return await asyncio.gather(*(call(i, **kwargs) for i in range(n)))
+
+
+@pytest.mark.asyncio
+async def test_parallel_requests_stay_under_the_tenant_cap():
+    results = await _run_parallel(50, budget_cap_usd=1.0)
+
+    sent = [r for r in results if r.success]
+    rejected = [r for r in results if not r.success]
+    assert len(sent) == 10
+    assert all(r.error.code == "BUDGET_EXCEEDED" for r in rejected)
+    assert all(r.error.details["reserved_usd"] + r.error.details["spent_usd"] > 1.0 - ESTIMATE for r in rejected)
+    # Over by at most the largest miss of a single estimate
+    spent = services._budget_ledger.spent("acme")
+    assert spent <= 1.0 + max(ACTUALS) - ESTIMATE
+
+    status = budget_status("acme", 1.0)
+    assert status["reserved_usd"] == 0.0
+    assert status["overshoots"] == 4
+    assert status["overshoot_usd"] == pytest.approx(2 * (0.02 + 0.05))
+
+
+@pytest.mark.asyncio
+async def test_parallel_requests_stay_under_the_key_budget():
+    async def call_and_record(i):
+        result = await _call(i, key_limits=TEAM_A)
+        record_usage(result, "llm", "acme", "sk-team-a", TEAM_A)
+        return result
+
+    results = await _run_parallel(50, call=call_and_record)
+
+    assert sum(r.success for r in results) == 10
+    assert sum(not r.success and r.error.code == "KEY_BUDGET_EXCEEDED" for r in results) == 40
+    assert services._key_budget_ledger.spent("team-a") <= 1.0 + max(ACTUALS) - ESTIMATE
+    assert services._key_budget_ledger.reserved("team-a") == 0.0
+
+
+@pytest.mark.asyncio
+async def test_failed_requests_release_their_reservations():
+    results = await _run_parallel(20, upstream=_slow_rejection, budget_cap_usd=1.0)
+
+    assert not any(r.success for r in results)
+    # Only ten fit at once, and none of them spent anything
+    assert sum(r.error.code == "BUDGET_EXCEEDED" for r in results) == 10
+    status = budget_status("acme", 1.0)
+    assert status["spent_usd"] == 0.0 and status["reserved_usd"] == 0.0 and status["overshoots"] == 0
+
+    # With the holds given back, the budget is there again
+    results = await _run_parallel(5, budget_cap_usd=1.0)
+    assert all(r.success for r in results)
@@ -1,9 +1,23 @@
 """Tests for core/cache.py."""
 import json
+import time
 import pytest
-from unittest.mock import Mock, patch
+from unittest.mock import AsyncMock, Mock, patch
 
-from reliapi.core.cache import Cache
+from reliapi.core.cache import (
+    EVICTED_MAX_BYTES,
+    EVICTED_MAX_ENTRIES,
+    EVICTED_TARGET_MAX_ENTRIES,
+    HOT_KEYS_MAX,
+    HOT_TIER,
+    LARGE_TIER,
+    REJECTED_TOO_LARGE,
+    Cache,
+    CacheTier,
+    make_cache_key_hash,
+)
+from reliapi.app.schemas import ErrorDetail, ErrorResponse, MetaResponse, SuccessResponse
+from reliapi.app.services import _cache_key_override, handle_with_cache_mode
 
 
 @patch('reliapi.core.cache.redis')
@@ -57,3 +71,455 @@ def test_cache_post_not_cached(mock_redis_module, mock_redis):
     # Should not call Redis
     mock_redis.setex.assert_not_called()
 
+
+def test_cache_key_override():
+    """Test explicit cache keys and cache_vary replace the request-derived key."""
+    url = "https://api.openai.com/v1/chat/completions"
+    scope = {"target": "openai", "model": "gpt-4o-mini"}
+    hot = {"messages": [{"role": "user", "content": "hi"}], "temperature": 0.9}
+    cold = {"messages": [{"role": "user", "content": "hi"}], "temperature": 0.1}
+
+    # cache_vary without temperature ignores temperature jitter
+    vary_hot = _cache_key_override(scope, hot, None, ["messages"])
+    vary_cold = _cache_key_override(scope, cold, None, ["messages"])
+    assert make_cache_key_hash("POST", url, None, b"a", None, vary_hot) == \
+        make_cache_key_hash("POST", url, None, b"b", None, vary_cold)
+
+    # An explicit key ignores the body entirely...
+    pinned = _cache_key_override(scope, hot, "summary-v1", None)
+    assert make_cache_key_hash("POST", url, None, b"a", None, pinned) == \
+        make_cache_key_hash("POST", url, None, b"b", None, pinned)
+
+    # ...but a different model still busts the cache
+    other_model = _cache_key_override({**scope, "model": "gpt-4o"}, hot, "summary-v1", None)
+    assert make_cache_key_hash("POST", url, None, b"a", None, pinned) != \
+        make_cache_key_hash("POST", url, None, b"a", None, other_model)
+
+    # Without overrides the default key is unchanged
+    assert _cache_key_override(scope, hot, None, None) is None
+
+
+@patch('reliapi.core.cache.redis')
+def test_cache_invalidate_target(mock_redis_module, mock_redis):
+    """Test that entries written with a target can be purged together."""
+    mock_redis_module.from_url.return_value = mock_redis
+    cache = Cache("redis://localhost:6379/0")
+
+    index_key = "reliapi:cache_index:example"
+    cache.set("GET", "https://example.com/a", None, None, {"data": 1}, ttl_s=60, target="example")
+    key = mock_redis.setex.call_args[0][0]
+    indexed = mock_redis.zadd.call_args[0]
+    assert indexed[0] == index_key and key in indexed[1]
+    # Expired members are pruned and the index never outlives its entries
+    mock_redis.zremrangebyscore.assert_called_once()
+    mock_redis.expire.assert_any_call(index_key, 60, gt=True)
+
+    mock_redis.zrange.side_effect = [[key], []]
+    mock_redis.delete.return_value = 1
+    assert cache.invalidate_target("example") == 1
+    mock_redis.delete.assert_called_once_with(key)
+    # Only the deleted members are unindexed; the index key itself stays
+    mock_redis.zrem.assert_called_once_with(index_key, key)
+
+
+@patch('reliapi.core.cache.redis')
+def test_cache_invalidate_target_in_batches(mock_redis_module, mock_redis):
+    """Test that large targets are purged in bounded DELETE batches."""
+    from reliapi.core.cache import INVALIDATE_BATCH_SIZE
+
+    mock_redis_module.from_url.return_value = mock_redis
+    cache = Cache("redis://localhost:6379/0")
+
+    first = [f"k{i}" for i in range(INVALIDATE_BATCH_SIZE)]
+    mock_redis.zrange.side_effect = [first, ["last"], []]
+    mock_redis.delete.side_effect = lambda *keys: len(keys)
+
+    assert cache.invalidate_target("example") == INVALIDATE_BATCH_SIZE + 1
+    assert [len(c[0]) for c in mock_redis.delete.call_args_list] == [INVALIDATE_BATCH_SIZE, 1]
+
+
+@patch('reliapi.core.cache.redis')
+def test_cache_delete_key(mock_redis_module, mock_redis):
+    """Test deleting a single entry by the hash echoed in meta.cache_key."""
+    mock_redis_module.from_url.return_value = mock_redis
+    cache = Cache("redis://localhost:6379/0")
+
+    key_hash = make_cache_key_hash("GET", "https://example.com/a")
+    assert cache.delete_key(key_hash, tenant="acme") == 1
+    mock_redis.delete.assert_called_once_with(f"reliapi:tenant:acme:cache:{key_hash}")
+
+
+@patch('reliapi.core.cache.redis')
+def test_cache_legacy_key_window(mock_redis_module, mock_redis):
+    """Test that a miss under the canonical key reads the legacy key only during the window."""
+    mock_redis_module.from_url.return_value = mock_redis
+    entries = {"reliapi:cache:old": json.dumps({"body": "cached"})}
+    mock_redis.get.side_effect = entries.get
+
+    cache = Cache("redis://localhost:6379/0", legacy_keys_until=time.time() + 60)
+    assert cache.get("POST", "https://x", None, None, None, allow_post=True, cache_key_hash="new") is None
+    found = cache.get(
+        "POST", "https://x", None, None, None, allow_post=True, cache_key_hash="new", legacy_key_hash="old"
+    )
+    assert found == {"body": "cached"}
+    assert cache.get_entry("new", legacy_key_hash="old")["value"] == {"body": "cached"}
+    cache.delete_key("new", legacy_key_hash="old")
+    mock_redis.delete.assert_called_once_with("reliapi:cache:new", "reliapi:cache:old")
+
+    cache.legacy_keys_until = time.time() - 1
+    assert cache.get(
+        "POST", "https://x", None, None, None, allow_post=True, cache_key_hash="new", legacy_key_hash="old"
+    ) is None
+    assert cache.get_entry("new", legacy_key_hash="old") is None
+
+
+
+@patch('reliapi.core.cache.redis')
+def test_cache_stale_entry(mock_redis_module, mock_redis):
+    """Test that entries past their TTL are misses for get() but visible to get_entry()."""
+    mock_redis_module.from_url.return_value = mock_redis
+    cache = Cache("redis://localhost:6379/0")
+
+    cache.set("GET", "https://example.com", None, None, {"data": "test"}, ttl_s=60, stale_ttl_s=600)
+    assert mock_redis.setex.call_args[0][1] == 660
+
+    mock_redis.get.return_value = json.dumps({"data": "test", "_cached_at": time.time() - 120, "_ttl_s": 60})
+    assert cache.get("GET", "https://example.com", None, None, None) is None
+
+    entry = cache.get_entry(make_cache_key_hash("GET", "https://example.com"))
+    assert entry["value"] == {"data": "test"}
+    assert entry["stale"] is True
+    assert entry["age_s"] >= 120
+
+
+class _FakeRedis:
+    """The subset of Redis the cache tiers use, in memory, without expiry."""
+
+    def __init__(self):
+        self.values, self.zsets, self.hashes = {}, {}, {}
+
+    def ping(self):
+        return True
+
+    def pipeline(self):
+        return _FakePipeline(self)
+
+    def get(self, key):
+        return self.values.get(key)
+
+    def setex(self, key, ttl, value):
+        self.values[key] = value
+
+    def delete(self, *keys):
+        return sum(self.values.pop(k, None) is not None for k in keys)
+
+    def exists(self, key):
+        return int(key in self.values)
+
+    def expire(self, *args, **kwargs):
+        return True
+
+    def zadd(self, key, mapping, xx=False):
+        zset = self.zsets.setdefault(key, {})
+        for member, score in mapping.items():
+            if not xx or member in zset:
+                zset[member] = score
+
+    def zrem(self, key, *members):
+        for member in members:
+            self.zsets.get(key, {}).pop(member, None)
+
+    def zincrby(self, key, n, member):
+        zset = self.zsets.setdefault(key, {})
+        zset[member] = zset.get(member, 0) + n
+        return zset[member]
+
+    def zrevrange(self, key, start, end, withscores=False):
+        ordered = sorted(self.zsets.get(key, {}).items(), key=lambda kv: -kv[1])[start:end + 1]
+        return ordered if withscores else [member for member, _ in ordered]
+
+    def zcard(self, key):
+        return len(self.zsets.get(key, {}))
+
+    def zrange(self, key, start, end):
+        ordered = sorted(self.zsets.get(key, {}).items(), key=lambda kv: kv[1])
+        return [member for member, _ in ordered[start:end + 1 if end >= 0 else None]]
+
+    def zrangebyscore(self, key, low, high):
+        return [m for m, score in self.zsets.get(key, {}).items() if score <= high]
+
+    def zremrangebyscore(self, key, low, high):
+        for member in self.zrangebyscore(key, low, high):
+            self.zrem(key, member)
+
+    def hset(self, key, field, value):
+        self.hashes.setdefault(key, {})[field] = str(value)
+
+    def hincrby(self, key, field, n):
+        fields = self.hashes.setdefault(key, {})
+        fields[field] = str(int(fields.get(field, 0)) + n)
+        return int(fields[field])
+
+    def hmget(self, key, fields):
+        return [self.hashes.get(key, {}).get(f) for f in fields]
+
+    def hdel(self, key, *fields):
+        for field in fields:
+            self.hashes.get(key, {}).pop(field, None)
+
+    def hgetall(self, key):
+        return dict(self.hashes.get(key, {}))
+
+
+class _FakePipeline:
+    def __init__(self, redis_client):
+        self.redis_client, self.calls = redis_client, []
+
+    def __getattr__(self, name):
+        return lambda *args, **kwargs: self.calls.append(getattr(self.redis_client, name)(*args, **kwargs))
+
+    def execute(self):
+        calls, self.calls = self.calls, []
+        return calls
+
+
+def _tiered_cache(mock_redis_module, **tiers):
+    mock_redis_module.from_url.return_value = _FakeRedis()
+    return Cache("redis://localhost:6379/0", **tiers)
+
+
+def _llm_entry(n, size=100):
+    return "POST", f"https://api.example.com/{n}", None, None, {"body": "x" * size}
+
+
+@patch('reliapi.core.cache.redis')
+def test_large_entry_does_not_evict_the_hot_set(mock_redis_module):
+    """Test that entries over the hot tier's limit go to the large tier and only evict there."""
+    cache = _tiered_cache(
+        mock_redis_module,
+        hot_tier=CacheTier(max_entry_bytes=1024, max_entries=3),
+        large_tier=CacheTier(max_entry_bytes=8 * 1024 * 1024, max_entries=1),
+    )
+    for n in range(3):
+        assert cache.set(*_llm_entry(n), ttl_s=60, allow_post=True) is True
+    for n in range(3, 5):
+        assert cache.set(*_llm_entry(n, size=4 * 1024 * 1024), ttl_s=300, allow_post=True) is True
+
+    # The large entries only evicted each other
+    stats = cache.stats()
+    assert stats["tiers"][HOT_TIER]["entries"] == 3
+    assert stats["tiers"][HOT_TIER]["evictions"][EVICTED_MAX_ENTRIES] == 0
+    assert stats["tiers"][LARGE_TIER]["entries"] == 1
+    assert stats["tiers"][LARGE_TIER]["bytes"] > 4 * 1024 * 1024
+    assert stats["tiers"][LARGE_TIER]["evictions"][EVICTED_MAX_ENTRIES] == 1
+    assert cache.get(*_llm_entry(3)[:4], allow_post=True) is None
+
+    # A hit makes entry 0 the most recently used, so a fourth small entry
+    # evicts entry 1
+    assert cache.get(*_llm_entry(0)[:4], allow_post=True) == {"body": "x" * 100}
+    cache.set(*_llm_entry(5), ttl_s=60, allow_post=True)
+    assert cache.get(*_llm_entry(1)[:4], allow_post=True) is None
+    assert cache.get(*_llm_entry(0)[:4], allow_post=True) is not None
+    assert cache.stats()["evictions"][EVICTED_MAX_ENTRIES] == 2
+
+
+@patch('reliapi.core.cache.redis')
+def test_entries_too_large_for_every_tier_are_rejected(mock_redis_module):
+    """Test that without a large tier big entries are refused rather than cached."""
+    cache = _tiered_cache(mock_redis_module, hot_tier=CacheTier(max_entry_bytes=1024, max_bytes=4096))
+    assert cache.set(*_llm_entry(0, size=2048), ttl_s=60, allow_post=True) is False
+    assert cache.get(*_llm_entry(0)[:4], allow_post=True) is None
+    # The byte budget evicts the oldest entries to fit a new one
+    for n in range(1, 6):
+        assert cache.set(*_llm_entry(n, size=900), ttl_s=60, allow_post=True) is True
+    stats = cache.stats()
+    assert stats["rejected"][REJECTED_TOO_LARGE] == 1
+    assert stats["tiers"][HOT_TIER]["bytes"] <= 4096
+    assert stats["tiers"][HOT_TIER]["evictions"][EVICTED_MAX_BYTES] >= 1
+
+
+@patch('reliapi.core.cache.redis')
+def test_target_max_entries(mock_redis_module):
+    """Test that a target's max_entries evicts its entries closest to expiring."""
+    cache = _tiered_cache(mock_redis_module)
+    cache.set(*_llm_entry(0), ttl_s=30, allow_post=True, target="openai", max_entries=2)
+    cache.set(*_llm_entry(1), ttl_s=60, allow_post=True, target="openai", max_entries=2)
+    cache.set(*_llm_entry(2), ttl_s=10, allow_post=True, target="openai", max_entries=2)
+    assert cache.get(*_llm_entry(0)[:4], allow_post=True) is None
+    assert cache.get(*_llm_entry(2)[:4], allow_post=True) is not None
+    stats = cache.stats()
+    assert stats["tiers"][HOT_TIER]["entries"] == 2
+    assert stats["evictions"][EVICTED_TARGET_MAX_ENTRIES] == 1
+
+    # Deleting an entry is not an eviction
+    cache.delete_key(make_cache_key_hash("POST", "https://api.example.com/1"))
+    assert cache.stats()["tiers"][HOT_TIER]["entries"] == 1
+
+
+def _stale_if_error_call(cache, handler):
+    return handle_with_cache_mode(
+        handler,
+        kind="http",
+        cache_mode="stale_if_error",
+        target_name="example",
+        method="GET",
+        path="/items",
+        headers=None,
+        query=None,
+        body=None,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets={"example": {"base_url": "https://example.com", "cache": {"enabled": True}}},
+        cache=cache,
+        idempotency=None,
+        request_id="req_stale",
+    )
+
+
+def _upstream_error(status_code, code):
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="upstream_error",
+            code=code,
+            message="upstream failed",
+            retryable=status_code >= 500,
+            target="example",
+            status_code=status_code,
+        ),
+        meta=MetaResponse(target="example", duration_ms=1, request_id="req_stale"),
+    )
+
+
+@pytest.mark.asyncio
+async def test_stale_if_error_serves_expired_entry():
+    """Test that stale_if_error serves an expired entry when the upstream fails."""
+    cache = Mock(spec=Cache)
+    cache.get_entry.return_value = {
+        "value": {"status_code": 200, "headers": {}, "body": {"items": [1]}},
+        "age_s": 90,
+        "stale": True,
+    }
+
+    handler = AsyncMock(return_value=_upstream_error(503, "SERVER_ERROR"))
+    result = await _stale_if_error_call(cache, handler)
+    assert result.success is True
+    assert result.data["body"] == {"items": [1]}
+    assert result.meta.stale is True
+    assert result.meta.cache_age_s == 90
+    assert result.meta.revalidation_error.code == "SERVER_ERROR"
+    assert handler.await_args.kwargs["stale_ttl_s"] == 86400
+
+    # Non-retryable failures are returned as-is
+    handler = AsyncMock(return_value=_upstream_error(404, "CLIENT_ERROR"))
+    result = await _stale_if_error_call(cache, handler)
+    assert result.success is False
+    assert result.error.code == "CLIENT_ERROR"
+
+
+@pytest.mark.asyncio
+async def test_cache_mode_fresh_entry_goes_through_handler():
+    """Test that stale modes leave fresh entries to the handler's own cache lookup."""
+    cache = Mock(spec=Cache)
+    cache.get_entry.return_value = {
+        "value": {"status_code": 200, "headers": {}, "body": {"items": [1]}},
+        "age_s": 5,
+        "stale": False,
+    }
+    served = SuccessResponse(
+        success=True,
+        data={"status_code": 200, "headers": {}, "body": {"items": [1]}},
+        meta=MetaResponse(target="example", cache_hit=True, duration_ms=1, request_id="req_stale"),
+    )
+
+    handler = AsyncMock(return_value=served)
+    result = await _stale_if_error_call(cache, handler)
+    assert result is served
+    handler.assert_awaited_once()
+    cache.acquire_refresh_lock.assert_not_called()
+
+
+
+@patch('reliapi.core.cache.redis')
+def test_hot_keys(mock_redis_module):
+    """Test that hot keys are listed by uses, per tenant, without entries no longer cached."""
+    cache = _tiered_cache(mock_redis_module)
+    keys = []
+    for n in range(3):
+        cache.set(*_llm_entry(n), ttl_s=60, allow_post=True, tenant="acme")
+        keys.append(make_cache_key_hash("POST", f"https://api.example.com/{n}"))
+        for _ in range(n + 1):
+            cache.record_use(keys[n], "http", {"target": "example", "path": f"/{n}"}, tenant="acme")
+
+    hot = cache.hot_keys(2, tenant="acme")
+    assert [item["cache_key"] for item in hot] == [keys[2], keys[1]]
+    assert hot[0]["uses"] == 3
+    assert hot[0]["kind"] == "http"
+    assert hot[0]["request"] == {"target": "example", "path": "/2"}
+    assert hot[0]["size_bytes"] > 100
+    assert cache.hot_keys(10) == []
+
+    # A deleted entry is left out, and forgotten
+    cache.delete_key(keys[2], tenant="acme")
+    assert [item["cache_key"] for item in cache.hot_keys(2, tenant="acme")] == [keys[1], keys[0]]
+    assert cache.hot_keys(10, tenant="acme")[-1]["cache_key"] == keys[0]
+    assert len(cache.client.zsets[f"{cache.key_prefix}:tenant:acme:cache_hot"]) == 2
+
+
+@patch('reliapi.core.cache.redis')
+def test_hot_keys_are_bounded(mock_redis_module):
+    """Test that only the HOT_KEYS_MAX most used keys are counted."""
+    cache = _tiered_cache(mock_redis_module)
+    cache.record_use("busy", "llm", {}, tenant="acme")
+    cache.record_use("busy", "llm", {}, tenant="acme")
+    for n in range(HOT_KEYS_MAX):
+        cache.record_use(f"key{n}", "llm", {}, tenant="acme")
+    by_uses = cache.client.zsets[f"{cache.key_prefix}:tenant:acme:cache_hot"]
+    assert len(by_uses) == HOT_KEYS_MAX
+    assert "busy" in by_uses
+    assert len(cache.client.hashes[f"{cache.key_prefix}:tenant:acme:cache_hot:requests"]) == HOT_KEYS_MAX
+
+
+def _only_if_cached_call(cache, handler):
+    return handle_with_cache_mode(
+        handler,
+        kind="http",
+        cache_mode="only_if_cached",
+        target_name="example",
+        method="GET",
+        path="/items",
+        headers=None,
+        query=None,
+        body=None,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets={"example": {"base_url": "https://example.com", "cache": {"enabled": True}}},
+        cache=cache,
+        idempotency=None,
+        request_id="req_only",
+    )
+
+
+@pytest.mark.asyncio
+async def test_only_if_cached_never_calls_the_upstream():
+    """Test that only_if_cached serves fresh entries and fails everything else with CACHE_MISS."""
+    cache = Mock(spec=Cache)
+    handler = AsyncMock()
+    cache.get_entry.return_value = {
+        "value": {"status_code": 200, "headers": {}, "body": {"items": [1]}},
+        "age_s": 5,
+        "stale": False,
+    }
+    result = await _only_if_cached_call(cache, handler)
+    assert result.success is True
+    assert result.data["body"] == {"items": [1]}
+    assert result.meta.cache_hit is True
+
+    for entry in (None, dict(cache.get_entry.return_value, stale=True)):
+        cache.get_entry.return_value = entry
+        result = await _only_if_cached_call(cache, handler)
+        assert result.success is False
+        assert result.error.code == "CACHE_MISS"
+        assert result.error.status_code == 404
+        assert result.error.retryable is False
+    handler.assert_not_awaited()
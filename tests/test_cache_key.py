@@ -0,0 +1,42 @@
+"""Tests for canonical LLM cache keys."""
+import pytest
+
+from reliapi.core.cache_key import canonical_cache_key, canonical_json, llm_cache_document
+
+MESSAGES = [
+    {"role": "system", "content": "Be brief."},
+    {"role": "user", "content": "Capital of France? é \U0001F600"},
+]
+
+
+def test_canonical_json():
+    assert canonical_json({"b": 1.0, "a": [None, True], "c": None}) == '{"a":[null,true],"b":1}'
+    assert canonical_json("é\n") == '"\\u00e9\\n"'
+    for value, want in [(1e16, "1e+16"), (1.5e-05, "1.5e-05"), (-0.0, "0"), (0.0001, "0.0001"), (2.5, "2.5")]:
+        assert canonical_json(value) == want
+    with pytest.raises(ValueError):
+        canonical_json(float("nan"))
+
+
+def test_serialization_does_not_change_the_key():
+    one = llm_cache_document("openai", "gpt-4o-mini", MESSAGES, max_tokens=64, temperature=1)
+    other = llm_cache_document("openai", "gpt-4o-mini", [dict(reversed(m.items())) for m in MESSAGES],
+                               max_tokens=64, temperature=1.0, stop=None)
+    assert canonical_cache_key(one) == canonical_cache_key(other)
+    warmer = llm_cache_document("openai", "gpt-4o-mini", MESSAGES, max_tokens=64, temperature=1.1)
+    assert canonical_cache_key(one) != canonical_cache_key(warmer)
+
+
+def test_matches_go_client():
+    # The same request hashed by reliapi.CanonicalCacheKey (cachekey_test.go)
+    document = llm_cache_document(
+        "openai", "gpt-4o-mini", MESSAGES, max_tokens=64, temperature=1.0, top_p=0.0001, stop=["\n"]
+    )
+    assert canonical_cache_key(document) == "ecf924a2b39ba69c0989dce316e3d70f8491443e51bd232183afce2df0f6e574"
+
+
+def test_cache_key_and_cache_vary():
+    pinned = llm_cache_document("openai", "gpt-4o-mini", MESSAGES, temperature=0.2, cache_key="daily")
+    assert "messages" not in pinned and pinned["cache_key"] == "daily"
+    vary = llm_cache_document("openai", "gpt-4o-mini", MESSAGES, temperature=0.2, cache_vary=["temperature"] * 2)
+    assert vary["cache_vary"] == ["temperature"] and "messages" not in vary
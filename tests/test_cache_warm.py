@@ -0,0 +1,131 @@
+"""Tests for cache warming jobs."""
+import asyncio
+from unittest.mock import AsyncMock, patch
+
+import pytest
+
+from reliapi.app import services
+from reliapi.app.schemas import ErrorDetail, ErrorResponse, MetaResponse, SuccessResponse
+from reliapi.app.services import run_cache_warm, submit_cache_warm
+from reliapi.core.jobs import JobStore, public_warm_job
+
+
+def _llm_item(prompt, max_cost_usd=None):
+    return {
+        "kind": "llm",
+        "target": "openai",
+        "credential": None,
+        "args": {
+            "target_name": "openai",
+            "messages": [{"role": "user", "content": prompt}],
+            "max_cost_usd": max_cost_usd,
+            "targets": {},
+        },
+    }
+
+
+def _answer(cost_usd=0.0, cache_hit=False, error=None):
+    """A warmed item's response: cost_usd for a miss, free for a hit, or an error."""
+    async def handle(handler, kind, **kwargs):
+        meta = MetaResponse(
+            target=kwargs["target_name"],
+            cache_hit=cache_hit,
+            cache_key=f"key_{kwargs['request_id']}",
+            cost_usd=cost_usd,
+            duration_ms=1,
+            request_id=kwargs["request_id"],
+        )
+        if error:
+            return ErrorResponse(
+                success=False,
+                error=ErrorDetail(type="upstream_error", code=error, message="boom", retryable=True),
+                meta=meta,
+            )
+        return SuccessResponse(success=True, data={"content": "ok"}, meta=meta)
+
+    return handle
+
+
+def _job(jobs, items):
+    job, _ = jobs.create("acme", "hash")
+    return jobs.update(
+        job,
+        kind="cache_warm",
+        max_cost_usd=None,
+        cost_usd=0.0,
+        items=[
+            {"index": i, "status": "pending", "cache_key": None, "cost_usd": None, "error": None}
+            for i in range(len(items))
+        ],
+    )
+
+
+@pytest.mark.asyncio
+async def test_cached_items_skipped():
+    jobs = JobStore()
+    items = [_llm_item("a"), _llm_item("b")]
+    job = _job(jobs, items)
+    answers = [_answer(cache_hit=True, cost_usd=0.02), _answer(cost_usd=0.01)]
+
+    async def handle(handler, kind, **kwargs):
+        return await answers.pop(0)(handler, kind, **kwargs)
+
+    with patch.object(services, "handle_with_cache_mode", new=handle):
+        job = await run_cache_warm(jobs, job, items, max_parallel=1, tenant="acme")
+
+    report = public_warm_job(jobs.get(job["job_id"], "acme"))
+    assert report["status"] == "succeeded"
+    assert [item["status"] for item in report["items"]] == ["cached", "warmed"]
+    assert report["items"][0]["cost_usd"] == 0.0
+    assert report["items"][1]["cache_key"] == f"key_{job['job_id']}_1"
+    assert report["cost_usd"] == 0.01
+    assert report["counts"]["cached"] == 1 and report["counts"]["warmed"] == 1
+    assert report["completed_at"] is not None
+
+
+@pytest.mark.asyncio
+async def test_cost_ceiling_aborts_remaining_items():
+    """Test that items get what is left of the ceiling, and none start once it is spent."""
+    jobs = JobStore()
+    items = [_llm_item("a"), _llm_item("b", max_cost_usd=5.0), _llm_item("c")]
+    job = _job(jobs, items)
+    handle = AsyncMock(side_effect=_answer(cost_usd=0.6))
+
+    with patch.object(services, "handle_with_cache_mode", new=handle):
+        job = await run_cache_warm(jobs, job, items, max_parallel=1, max_cost_usd=1.0, tenant="acme")
+
+    assert handle.await_count == 2
+    assert handle.await_args_list[0].kwargs["max_cost_usd"] == 1.0
+    assert handle.await_args_list[1].kwargs["max_cost_usd"] == pytest.approx(0.4)
+    assert [item["status"] for item in job["items"]] == ["warmed", "warmed", "aborted"]
+    assert job["status"] == "failed"
+    assert job["cost_usd"] == 1.2
+
+
+@pytest.mark.asyncio
+async def test_failed_item_reports_error():
+    jobs = JobStore()
+    items = [_llm_item("a")]
+    job = _job(jobs, items)
+    handle = AsyncMock(side_effect=_answer(error="BUDGET_EXCEEDED"))
+
+    with patch.object(services, "handle_with_cache_mode", new=handle):
+        job = await run_cache_warm(jobs, job, items, max_parallel=4, tenant="acme")
+
+    assert job["status"] == "failed"
+    assert job["items"][0]["status"] == "failed"
+    assert job["items"][0]["error"]["code"] == "BUDGET_EXCEEDED"
+
+
+@pytest.mark.asyncio
+async def test_submit_records_pending_items():
+    jobs = JobStore()
+    handle = AsyncMock(side_effect=_answer())
+
+    with patch.object(services, "handle_with_cache_mode", new=handle):
+        job = submit_cache_warm(jobs, "hash", [_llm_item("a")], max_parallel=2, tenant="acme")
+        assert job["kind"] == "cache_warm"
+        assert job["items"][0]["status"] == "pending"
+        await asyncio.gather(*services._running_jobs)
+
+    assert jobs.get(job["job_id"], "acme")["items"][0]["status"] == "warmed"
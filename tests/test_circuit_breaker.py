@@ -55,3 +55,17 @@ def test_circuit_breaker_success_resets():
     assert cb.get_state("upstream1") == "closed"
     assert cb.is_open("upstream1") is False
 
+
+
+@pytest.mark.asyncio
+async def test_upstream_client_raises_circuit_open_error():
+    """Test UpstreamHTTPClient fails fast with CircuitOpenError when open."""
+    from reliapi.core.http_client import CircuitOpenError, UpstreamHTTPClient
+
+    cb = CircuitBreaker(failures_to_open=1, open_ttl_s=60)
+    client = UpstreamHTTPClient(base_url="https://upstream.example", circuit_breaker=cb)
+    cb.record_failure("https://upstream.example")
+
+    with pytest.raises(CircuitOpenError):
+        await client.request("GET", "/health")
+    await client.close()
@@ -0,0 +1,133 @@
+"""Tests for compare mode: running a variant of an LLM request beside it."""
+import pytest
+from fastapi import HTTPException
+
+from reliapi.app.routes.proxy import _compare_args
+from reliapi.app.schemas import ErrorDetail, ErrorResponse, LLMProxyRequest, MetaResponse, SuccessResponse
+from reliapi.app.services import comparison_meta
+from reliapi.core.compare import token_similarity
+
+TARGETS = {
+    "openai": {"base_url": "https://api.openai.com/v1", "llm": {"default_model": "gpt-4o-mini"}},
+    "anthropic": {"base_url": "https://api.anthropic.com/v1", "llm": {"default_model": "claude-3-haiku"}},
+}
+
+
+@pytest.mark.parametrize("a,b,expected", [
+    ("Retries back off.", "retries back off.", 1.0),
+    ("", "", 1.0),
+    ("Paris", "", 0.0),
+    ("The capital is Paris.", "The capital is Lyon.", 0.8),
+    ("a b c d", "d c b a", 0.25),
+])
+def test_token_similarity(a, b, expected):
+    assert token_similarity(a, b) == expected
+
+
+def _success(content, cache_hit=False, cost_usd=0.002, **meta):
+    return SuccessResponse(
+        success=True,
+        data={"content": content, "finish_reason": "stop", "usage": {"prompt_tokens": 4, "completion_tokens": 2}},
+        meta=MetaResponse(
+            duration_ms=120, request_id="req_1", cache_hit=cache_hit, cost_usd=0.0 if cache_hit else cost_usd, **meta
+        ),
+    )
+
+
+def test_comparison_reports_variant_leg():
+    primary = _success("The capital is Paris.", cache_hit=True)
+    variant = _success("The capital is Lyon.", target="anthropic", model="claude-3-haiku", cache_key="k2")
+
+    comparison = comparison_meta(primary, variant, {"name": "geo", "version": 2})
+
+    assert comparison.success
+    assert comparison.target == "anthropic"
+    assert comparison.model == "claude-3-haiku"
+    assert (comparison.template_name, comparison.template_version) == ("geo", 2)
+    assert comparison.content == "The capital is Lyon."
+    assert comparison.usage == {"prompt_tokens": 4, "completion_tokens": 2}
+    assert comparison.cost_usd == 0.002
+    assert comparison.duration_ms == 120
+    # Caching is per leg: the primary's hit says nothing about the variant
+    assert not comparison.cache_hit
+    assert comparison.cache_key == "k2"
+    assert comparison.similarity == 0.8
+
+
+def test_failed_variant_has_no_similarity():
+    error = ErrorDetail(type="upstream_error", code="UPSTREAM_TIMEOUT", message="boom", retryable=True)
+    variant = ErrorResponse(error=error, meta=MetaResponse(duration_ms=30, request_id="req_1", target="anthropic"))
+
+    comparison = comparison_meta(_success("Paris"), variant)
+
+    assert not comparison.success
+    assert comparison.error == error
+    assert comparison.content is None
+    assert comparison.similarity is None
+
+
+def _call_args(request):
+    return dict(
+        target_name=request.target,
+        model=request.model,
+        messages=request.messages,
+        fallbacks=[{"target": "anthropic"}],
+        fallback_response=None,
+        priority="interactive",
+        idempotency_key=request.idempotency_key,
+        cached_filter="usage",
+        include_raw=True,
+        request_id="req_1",
+    )
+
+
+def _request(**compare):
+    return LLMProxyRequest(
+        target="openai",
+        model="gpt-4o",
+        messages=[{"role": "user", "content": "hi"}],
+        idempotency_key="idem-1",
+        compare=compare,
+    )
+
+
+def test_variant_of_another_model():
+    request = _request(model="gpt-4o-mini")
+    args, template = _compare_args(request, _call_args(request), TARGETS)
+
+    assert (args["target_name"], args["model"]) == ("openai", "gpt-4o-mini")
+    assert args["messages"] == request.messages
+    assert args["priority"] == "batch"
+    assert args["fallbacks"] == []
+    assert args["idempotency_key"] == "idem-1:compare"
+    assert args["cached_filter"] is None
+    assert not args["include_raw"]
+    assert template is None
+
+
+def test_variant_of_another_target_takes_its_default_model():
+    request = _request(target="anthropic")
+    args, _ = _compare_args(request, _call_args(request), TARGETS)
+    assert (args["target_name"], args["model"]) == ("anthropic", None)
+
+
+def test_variant_of_unknown_target_rejected():
+    request = _request(target="mistral")
+    with pytest.raises(HTTPException) as excinfo:
+        _compare_args(request, _call_args(request), TARGETS)
+    assert excinfo.value.status_code == 400
+
+
+def test_compare_needs_a_variant():
+    with pytest.raises(ValueError):
+        _request()
+
+
+def test_compare_rejected_for_streams():
+    with pytest.raises(ValueError):
+        LLMProxyRequest(
+            target="openai",
+            messages=[{"role": "user", "content": "hi"}],
+            stream=True,
+            compare={"model": "gpt-4o-mini"},
+        )
@@ -0,0 +1,149 @@
+"""Tests for core/compression.py CompressionMiddleware."""
+import gzip
+import json
+
+import pytest
+
+from reliapi.core.compression import MIN_RESPONSE_BYTES, CompressionMiddleware
+
+
+def _echo_app(response_body=None, content_type=b"application/json", chunks=1):
+    """An ASGI app answering with the request body it received, or response_body."""
+    seen = {}
+
+    async def app(scope, receive, send):
+        message = await receive()
+        seen["body"] = message["body"]
+        seen["headers"] = dict(scope["headers"])
+        body = response_body if response_body is not None else message["body"]
+        await send({"type": "http.response.start", "status": 200, "headers": [(b"content-type", content_type)]})
+        for i in range(chunks):
+            await send({"type": "http.response.body", "body": body, "more_body": i < chunks - 1})
+
+    return app, seen
+
+
+async def _call(app, path="/v1/proxy/llm", body=b"", headers=(), dictionaries=None):
+    scope = {"type": "http", "path": path, "headers": [(k.encode(), v.encode()) for k, v in headers]}
+    messages = [{"type": "http.request", "body": body, "more_body": False}]
+    sent = []
+
+    async def receive():
+        return messages.pop(0) if messages else {"type": "http.disconnect"}
+
+    async def send(message):
+        sent.append(message)
+
+    await CompressionMiddleware(app, get_dictionaries=lambda: dictionaries or {})(scope, receive, send)
+    start = sent[0]
+    return start["status"], dict(start["headers"]), b"".join(m.get("body", b"") for m in sent[1:])
+
+
+@pytest.mark.asyncio
+async def test_gzip_request_body_decoded():
+    """Test that a gzip request body reaches the route decoded."""
+    payload = json.dumps({"target": "openai", "messages": [{"role": "user", "content": "x" * 5000}]}).encode()
+    app, seen = _echo_app(response_body=b"{}")
+    status, _, _ = await _call(app, body=gzip.compress(payload), headers=[("content-encoding", "gzip")])
+
+    assert status == 200
+    assert seen["body"] == payload
+    assert b"content-encoding" not in seen["headers"]
+    assert seen["headers"][b"content-length"] == str(len(payload)).encode()
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("body", [b"not gzip at all", gzip.compress(b'{"a": 1}')[:-6]])
+async def test_corrupt_gzip_rejected(body):
+    """Test that corrupt or truncated gzip is a 400, not a hang or a 500."""
+    app, seen = _echo_app()
+    status, _, raw = await _call(app, body=body, headers=[("content-encoding", "gzip")])
+
+    assert status == 400
+    error = json.loads(raw)["error"]
+    assert error["code"] == "BAD_REQUEST"
+    assert "gzip" in error["message"]
+    assert seen == {}
+
+
+@pytest.mark.asyncio
+async def test_unknown_encoding_rejected():
+    """Test that an unsupported Content-Encoding is rejected."""
+    app, _ = _echo_app()
+    status, _, raw = await _call(app, body=b"x", headers=[("content-encoding", "br")])
+    assert status == 400
+    assert "Unsupported Content-Encoding" in json.loads(raw)["error"]["message"]
+
+
+@pytest.mark.asyncio
+async def test_zstd_dictionary_body_decoded():
+    """Test that a zstd body compressed with a configured dictionary is decoded."""
+    zstandard = pytest.importorskip("zstandard")
+    samples = [json.dumps({"target": "openai", "system": "Extract invoices as JSON", "n": i}).encode() for i in range(200)]
+    dictionary = zstandard.train_dictionary(4096, samples)
+    payload = samples[7]
+    body = zstandard.ZstdCompressor(dict_data=dictionary).compress(payload)
+    app, seen = _echo_app(response_body=b"{}")
+    status, _, _ = await _call(
+        app,
+        body=body,
+        headers=[("content-encoding", "zstd"), ("x-reliapi-zstd-dictionary", "invoices-v1")],
+        dictionaries={"invoices-v1": dictionary.as_bytes()},
+    )
+    assert status == 200
+    assert seen["body"] == payload
+
+
+@pytest.mark.asyncio
+async def test_unknown_zstd_dictionary_rejected():
+    """Test that a body naming a dictionary the proxy lacks is a 415, for clients to fall back to gzip."""
+    app, seen = _echo_app()
+    status, _, raw = await _call(
+        app, body=b"x", headers=[("content-encoding", "zstd"), ("x-reliapi-zstd-dictionary", "invoices-v1")]
+    )
+    assert status == 415
+    error = json.loads(raw)["error"]
+    assert error["status_code"] == 415
+    assert "invoices-v1" in error["message"]
+    assert seen == {}
+
+
+@pytest.mark.asyncio
+async def test_response_gzipped_when_accepted():
+    """Test that large JSON responses are gzipped for clients accepting it."""
+    body = json.dumps({"data": "y" * MIN_RESPONSE_BYTES}).encode()
+    app, _ = _echo_app(response_body=body)
+    status, headers, raw = await _call(app, headers=[("accept-encoding", "gzip, deflate")])
+
+    assert status == 200
+    assert headers[b"content-encoding"] == b"gzip"
+    assert gzip.decompress(raw) == body
+
+    # Small bodies and clients refusing gzip get the identity encoding
+    app, _ = _echo_app(response_body=b"{}")
+    _, headers, raw = await _call(app, headers=[("accept-encoding", "gzip")])
+    assert b"content-encoding" not in headers and raw == b"{}"
+    app, _ = _echo_app(response_body=body)
+    _, headers, _ = await _call(app, headers=[("accept-encoding", "gzip;q=0")])
+    assert b"content-encoding" not in headers
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("content_type,chunks", [(b"text/event-stream", 1), (b"application/octet-stream", 3)])
+async def test_streamed_responses_not_compressed(content_type, chunks):
+    """Test that SSE and multi-chunk responses pass through uncompressed."""
+    app, _ = _echo_app(response_body=b"z" * 2 * MIN_RESPONSE_BYTES, content_type=content_type, chunks=chunks)
+    _, headers, raw = await _call(app, headers=[("accept-encoding", "gzip")])
+
+    assert b"content-encoding" not in headers
+    assert raw == b"z" * 2 * MIN_RESPONSE_BYTES * chunks
+
+
+@pytest.mark.asyncio
+async def test_compressed_body_only_decoded_on_proxy_paths():
+    """Test that other endpoints receive their bodies untouched."""
+    app, seen = _echo_app(response_body=b"{}")
+    body = gzip.compress(b"{}")
+    status, _, _ = await _call(app, path="/v1/targets", body=body, headers=[("content-encoding", "gzip")])
+    assert status == 200
+    assert seen["body"] == body
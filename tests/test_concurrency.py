@@ -0,0 +1,165 @@
+"""Tests for per-target concurrency limits of LLM requests."""
+import asyncio
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.app import services
+from reliapi.app.services import handle_llm_proxy, target_stats
+from reliapi.core.cache import Cache
+from reliapi.core.concurrency import ConcurrencyLimitError, ConcurrencyLimiter, TargetConcurrency
+from reliapi.core.idempotency import IdempotencyManager
+
+
+@pytest.fixture(autouse=True)
+def fresh_limiters():
+    """Isolate the process-wide concurrency limiters between tests."""
+    services._target_concurrency.reset()
+    services._circuit_breakers.clear()
+    yield
+    services._target_concurrency.reset()
+    services._circuit_breakers.clear()
+
+
+@pytest.mark.asyncio
+async def test_unlimited_target_only_counts():
+    limiter = ConcurrencyLimiter()
+    for _ in range(50):
+        assert await limiter.acquire(0.01) == 0.0
+    assert limiter.snapshot() == {"max_concurrency": None, "in_flight": 50, "waiting": 0, "rejected": 0}
+    limiter.release()
+    assert limiter.in_flight == 49
+
+
+@pytest.mark.asyncio
+async def test_slots_go_to_waiters_in_order():
+    limiter = ConcurrencyLimiter(1)
+    await limiter.acquire(1.0)
+    order = []
+
+    async def request(name):
+        await limiter.acquire(1.0)
+        order.append(name)
+        await asyncio.sleep(0.01)
+        limiter.release()
+
+    tasks = [asyncio.create_task(request(i)) for i in range(3)]
+    await asyncio.sleep(0)
+    assert limiter.waiting == 3
+    limiter.release()
+    await asyncio.gather(*tasks)
+    assert order == [0, 1, 2]
+    assert limiter.in_flight == 0
+
+
+@pytest.mark.asyncio
+async def test_wait_past_max_fails():
+    limiter = ConcurrencyLimiter(1)
+    await limiter.acquire(1.0)
+    with pytest.raises(ConcurrencyLimitError) as exc:
+        await limiter.acquire(0.05)
+    assert "50 ms" in str(exc.value)
+    assert limiter.snapshot() == {"max_concurrency": 1, "in_flight": 1, "waiting": 0, "rejected": 1}
+
+
+@pytest.mark.asyncio
+async def test_raised_limit_lets_waiters_through():
+    limiters = TargetConcurrency()
+    limiter = limiters.get("openai", 1)
+    await limiter.acquire(1.0)
+    waiter = asyncio.create_task(limiter.acquire(5.0))
+    await asyncio.sleep(0)
+    assert limiters.get("openai", 2) is limiter
+    assert await waiter < 1.0
+    assert limiter.in_flight == 2
+
+
+@pytest.mark.asyncio
+async def test_canceled_waiter_gives_back_its_slot():
+    limiter = ConcurrencyLimiter(1)
+    await limiter.acquire(1.0)
+    waiter = asyncio.create_task(limiter.acquire(5.0))
+    await asyncio.sleep(0)
+    waiter.cancel()
+    with pytest.raises(asyncio.CancelledError):
+        await waiter
+    limiter.release()
+    assert limiter.in_flight == 0 and limiter.waiting == 0
+
+
+def _completion():
+    return httpx.Response(
+        200,
+        request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"),
+        json={
+            "choices": [{"message": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"}],
+            "usage": {"prompt_tokens": 10, "completion_tokens": 2},
+        },
+    )
+
+
+TARGETS = {
+    "openai": {
+        "base_url": "https://api.openai.com/v1",
+        "cache": {"enabled": False},
+        "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+        "max_concurrency": 1,
+        "concurrency_wait_ms": 5000,
+    }
+}
+
+
+async def _call(**kwargs):
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    return await handle_llm_proxy(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Hi"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        stream=False,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=TARGETS,
+        cache=cache,
+        idempotency=Mock(spec=IdempotencyManager),
+        request_id="req_concurrency",
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_llm_proxy_waits_for_a_slot_or_fails():
+    in_flight = []
+
+    async def slow_upstream(*args, **kwargs):
+        in_flight.append(target_stats("openai", TARGETS["openai"])["in_flight"])
+        await asyncio.sleep(0.2)
+        return _completion()
+
+    upstream = AsyncMock(side_effect=slow_upstream)
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        first, second, third = await asyncio.gather(_call(), _call(), _call(max_wait_ms=50))
+
+    assert first.success and first.meta.concurrency_wait_ms == 0
+    assert second.success and second.meta.concurrency_wait_ms >= 150
+    assert not third.success
+    assert third.error.code == "CONCURRENCY_LIMIT" and third.error.type == "concurrency_limit"
+    assert third.error.status_code == 429 and third.error.retryable
+    # Never more than one request at the upstream at once
+    assert in_flight == [1, 1] and upstream.call_count == 2
+
+    stats = target_stats("openai", TARGETS["openai"])
+    assert stats == {
+        "target": "openai",
+        "max_concurrency": 1,
+        "in_flight": 0,
+        "waiting": 0,
+        "rejected": 1,
+        "queued": 0,
+    }
@@ -0,0 +1,108 @@
+"""Tests for trimming message histories under a context_policy."""
+from unittest.mock import Mock
+
+import pytest
+
+from reliapi.app.services import handle_llm_proxy
+from reliapi.core.cache import Cache
+from reliapi.core.context import ContextTooLongError, trim_messages
+from reliapi.core.cost_estimator import CostEstimator
+from reliapi.core.idempotency import IdempotencyManager
+
+HISTORY = [
+    {"role": "system", "content": "Be brief."},
+    {"role": "user", "content": "one " * 50},
+    {"role": "assistant", "content": "two " * 50},
+    {"role": "user", "content": "three " * 50},
+    {"role": "assistant", "content": "", "tool_calls": [{"id": "call_1", "type": "function"}]},
+    {"role": "tool", "tool_call_id": "call_1", "content": "result " * 40},
+    {"role": "user", "content": "And now?"},
+]
+
+
+def _contents(messages):
+    return [m["content"].split(" ")[0] for m in messages]
+
+
+def test_fitting_prompt_is_kept():
+    limit = CostEstimator.count_tokens(HISTORY, "gpt-4o")
+    result = trim_messages(HISTORY, "gpt-4o", limit, "error")
+    assert result.messages == HISTORY
+    assert result.trimmed_messages == 0
+    assert result.prompt_tokens == limit
+
+
+def test_truncate_oldest():
+    result = trim_messages(HISTORY, "gpt-4o", 120, "truncate_oldest")
+    assert _contents(result.messages) == ["Be", "three", "", "result", "And"]
+    assert result.trimmed_messages == 2
+    assert result.prompt_tokens == CostEstimator.count_tokens(result.messages, "gpt-4o") <= 120
+
+
+def test_truncate_middle_keeps_opening_turn():
+    result = trim_messages(HISTORY, "gpt-4o", 120, "truncate_middle")
+    assert _contents(result.messages) == ["Be", "one", "", "result", "And"]
+    assert result.trimmed_messages == 2
+
+
+def test_tool_results_are_dropped_with_their_call():
+    result = trim_messages(HISTORY, "gpt-4o", 40, "truncate_oldest")
+    assert _contents(result.messages) == ["Be", "And"]
+    assert result.trimmed_messages == 5
+
+
+def test_single_oversized_message():
+    huge = {"role": "assistant", "content": "word " * 5000}
+    messages = [HISTORY[0], HISTORY[1], huge, {"role": "user", "content": "Summarize."}]
+
+    # A droppable message that alone exceeds the limit goes, however new
+    for strategy in ("truncate_oldest", "truncate_middle"):
+        result = trim_messages(messages, "gpt-4o", 100, strategy)
+        assert huge not in result.messages
+        assert result.messages[-1]["content"] == "Summarize."
+
+    # The last user message is never dropped, so it can't be made to fit
+    with pytest.raises(ContextTooLongError) as exc_info:
+        trim_messages([HISTORY[0], {"role": "user", "content": "word " * 5000}], "gpt-4o", 100, "truncate_oldest")
+    assert exc_info.value.max_prompt_tokens == 100
+    assert exc_info.value.prompt_tokens > 5000
+
+    with pytest.raises(ContextTooLongError):
+        trim_messages(messages, "gpt-4o", 100, "error")
+
+
+@pytest.mark.asyncio
+async def test_llm_proxy_rejects_prompt_over_budget():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    targets = {
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+        }
+    }
+
+    result = await handle_llm_proxy(
+        target_name="openai",
+        messages=[{"role": "user", "content": "word " * 500}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        stream=False,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=Mock(spec=IdempotencyManager),
+        request_id="req_ctx",
+        context_policy={"max_prompt_tokens": 100, "strategy": "truncate_oldest"},
+    )
+
+    assert not result.success
+    assert result.error.code == "CONTEXT_LENGTH_EXCEEDED"
+    assert result.error.status_code == 400
+    assert result.error.details["max_prompt_tokens"] == 100
+    cache.get.assert_not_called()
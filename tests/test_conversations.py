@@ -0,0 +1,159 @@
+"""Tests for server-side conversation histories."""
+import pytest
+from fastapi import HTTPException
+
+from reliapi.app.dependencies import app_state
+from reliapi.app.routes.conversations import begin_conversation, conversation_messages, finish_conversation
+from reliapi.app.schemas import LLMProxyRequest, MetaResponse, SuccessResponse
+from reliapi.core.conversations import (
+    ConversationConflictError,
+    ConversationStore,
+    bounded_turns,
+    public_conversation,
+)
+
+SYSTEM = {"role": "system", "content": "Be brief."}
+
+
+def _turn(n):
+    return [{"role": "user", "content": f"Q{n}"}, {"role": "assistant", "content": f"A{n}"}]
+
+
+def test_turns_append_to_history():
+    store = ConversationStore()
+    turn = store.begin("chat-1", None)
+    assert turn.messages == []
+    store.commit(turn, [SYSTEM] + _turn(1), tokens=20)
+    store.release(turn)
+
+    turn = store.begin("chat-1", None)
+    assert turn.messages == [SYSTEM] + _turn(1)
+    record = store.commit(turn, _turn(2), tokens=30)
+    store.release(turn)
+    view = public_conversation(record, store.ttl_s)
+    assert view["messages"] == [SYSTEM] + _turn(1) + _turn(2)
+    assert (view["turns"], view["dropped_turns"], view["tokens"]) == (2, 0, 30)
+    assert view["expires_at"] == record["updated_at"] + store.ttl_s
+
+
+def test_conversations_scoped_to_tenant():
+    store = ConversationStore()
+    turn = store.begin("chat-1", "acme")
+    store.commit(turn, _turn(1), tokens=10)
+    store.release(turn)
+    assert store.get("chat-1", "acme") is not None
+    assert store.get("chat-1", "other") is None
+    assert not store.delete("chat-1", "other")
+    assert store.delete("chat-1", "acme")
+    assert store.get("chat-1", "acme") is None
+
+
+def test_concurrent_turn_conflicts():
+    store = ConversationStore()
+    turn = store.begin("chat-1", None)
+    with pytest.raises(ConversationConflictError):
+        store.begin("chat-1", None)
+    # Other conversations are not held
+    store.release(store.begin("chat-2", None))
+    store.release(turn)
+    store.release(store.begin("chat-1", None))
+
+
+def test_deleted_during_turn_stays_deleted():
+    store = ConversationStore()
+    first = store.begin("chat-1", None)
+    store.commit(first, _turn(1), tokens=10)
+    store.release(first)
+
+    turn = store.begin("chat-1", None)
+    store.delete("chat-1", None)
+    assert store.commit(turn, _turn(2), tokens=20) is None
+    assert store.get("chat-1", None) is None
+
+
+def test_max_turns_keeps_system_messages():
+    turns = [[SYSTEM] + _turn(1), _turn(2), _turn(3)]
+    assert bounded_turns(turns, 3) == turns
+    assert bounded_turns(turns, 2) == [[SYSTEM] + _turn(2), _turn(3)]
+
+    store = ConversationStore(max_turns=2)
+    for n, messages in enumerate(turns):
+        turn = store.begin("chat-1", None)
+        record = store.commit(turn, messages, tokens=n)
+        store.release(turn)
+    view = public_conversation(record, store.ttl_s)
+    assert view["messages"] == [SYSTEM] + _turn(2) + _turn(3)
+    assert (view["turns"], view["dropped_turns"]) == (2, 1)
+
+
+def test_expired_conversation_forgotten():
+    store = ConversationStore(ttl_s=-1)
+    turn = store.begin("chat-1", None)
+    store.commit(turn, _turn(1), tokens=10)
+    store.release(turn)
+    assert store.get("chat-1", None) is None
+
+
+@pytest.fixture
+def conversations():
+    app_state.conversations = ConversationStore()
+    yield app_state.conversations
+    app_state.conversations = None
+
+
+def _request(content: str, **kwargs) -> LLMProxyRequest:
+    return LLMProxyRequest(
+        target="openai", conversation_id="chat-1", append_messages=[{"role": "user", "content": content}], **kwargs
+    )
+
+
+def _reply(content: str) -> SuccessResponse:
+    return SuccessResponse(
+        data={"content": content, "model": "gpt-4o-mini"}, meta=MetaResponse(request_id="req_1", duration_ms=1)
+    )
+
+
+def test_proxy_turns_stored_redacted(conversations):
+    """Test that each successful turn is sent after the history and stored under the redaction rules."""
+    target = {"llm": {"default_model": "gpt-4o-mini"}, "redaction": {"patterns": ["email"]}}
+    request = _request("Mail me at jane@example.com")
+    turn = begin_conversation(request, None)
+    assert request.messages == [{"role": "user", "content": "Mail me at jane@example.com"}]
+    with pytest.raises(HTTPException) as exc:
+        begin_conversation(_request("Again"), None)
+    assert exc.value.status_code == 409
+    assert exc.value.detail["error"]["code"] == "CONVERSATION_CONFLICT"
+
+    result = _reply("Will do, jane@example.com")
+    finish_conversation(turn, request, result, target, None)
+    assert result.meta.conversation_tokens > 0
+    stored = conversations.get("chat-1", None)
+    assert public_conversation(stored, 0)["messages"] == [
+        {"role": "user", "content": "Mail me at [EMAIL_1]"},
+        {"role": "assistant", "content": "Will do, [EMAIL_1]"},
+    ]
+
+    request = _request("Thanks")
+    turn = begin_conversation(request, None)
+    assert [m["content"] for m in request.messages] == ["Mail me at [EMAIL_1]", "Will do, [EMAIL_1]", "Thanks"]
+    # A failed turn leaves the history as it was, and the conversation free
+    finish_conversation(turn, request, None, target, None)
+    assert len(public_conversation(conversations.get("chat-1", None), 0)["messages"]) == 2
+
+    estimate = _request("Thanks")
+    conversation_messages(estimate, None)
+    assert len(estimate.messages) == 3
+    assert conversations.get("chat-1", None)["turn_count"] == 1
+
+
+def test_conversation_request_validation():
+    with pytest.raises(ValueError):
+        LLMProxyRequest(target="openai", conversation_id="chat-1")
+    with pytest.raises(ValueError):
+        LLMProxyRequest(target="openai", append_messages=[{"role": "user", "content": "Hi"}])
+    with pytest.raises(ValueError):
+        _request("Hi", messages=[{"role": "user", "content": "Hi"}])
+    with pytest.raises(ValueError):
+        _request("Hi", stream=True)
+    with pytest.raises(ValueError):
+        LLMProxyRequest(target="openai", conversation_id="no spaces", append_messages=[{"role": "user", "content": "Hi"}])
@@ -0,0 +1,131 @@
+"""Tests for named upstream credentials and their rotation."""
+from unittest.mock import patch
+
+import pytest
+
+from reliapi.app import services
+from reliapi.core.credentials import (
+    COOLDOWN_S,
+    CredentialError,
+    CredentialRegistry,
+    select_credentials,
+)
+
+TARGET = {
+    "base_url": "https://api.openai.com/v1",
+    "credentials": [
+        {"name": "org-a", "api_key": "sk-a", "weight": 3.0},
+        {"name": "org-b", "api_key": "sk-b", "weight": 1.0},
+        {"name": "org-c", "api_key": "sk-c", "disabled": True},
+    ],
+}
+
+
+@pytest.fixture(autouse=True)
+def fresh_credentials():
+    """Isolate the process-wide credential registry between tests."""
+    services._credentials.reset()
+    yield
+    services._credentials.reset()
+
+
+def test_weighted_pick_skips_disabled():
+    registry = CredentialRegistry()
+    with patch("reliapi.core.credentials.random.choices", side_effect=lambda ready, weights: [ready[0]]) as choices:
+        with select_credentials(None) as choice:
+            assert registry.choose("openai", TARGET, now=0)["api_key"] == "sk-a"
+    assert choice.used == "org-a"
+    ready = choices.call_args.args[0]
+    assert [c["name"] for c in ready] == ["org-a", "org-b"]
+    assert choices.call_args.kwargs["weights"] == [3.0, 1.0]
+
+
+def test_cooldown_after_repeated_rejections():
+    registry = CredentialRegistry()
+    for status_code in (429, 401):
+        registry.record("openai", "org-a", status_code, now=0)
+    # A success in between starts the count over
+    registry.record("openai", "org-a", 200, now=0)
+    assert registry.status("openai", TARGET, now=0)[0]["consecutive_failures"] == 0
+    for _ in range(3):
+        registry.record("openai", "org-a", 429, now=0)
+    status = registry.status("openai", TARGET, now=1)
+    assert status[0]["status"] == "cooling_down" and status[0]["cooldown_until"] == COOLDOWN_S
+    assert status[2]["status"] == "disabled"
+    for _ in range(5):
+        assert registry.choose("openai", TARGET, now=1)["name"] == "org-b"
+    # Once all are cooling down, the one recovering first is used
+    for _ in range(3):
+        registry.record("openai", "org-b", 429, now=10)
+    assert registry.choose("openai", TARGET, now=11)["name"] == "org-a"
+    assert registry.status("openai", TARGET, now=COOLDOWN_S + 1)[0]["status"] == "active"
+
+
+def test_pin_and_sticky_idempotency_key():
+    registry = CredentialRegistry()
+    with select_credentials("org-b") as choice:
+        assert registry.choose("openai", TARGET)["name"] == "org-b"
+    assert choice.used == "org-b"
+    with patch("reliapi.core.credentials.random.choices", side_effect=lambda ready, weights: [ready[-1]]):
+        with select_credentials(None, "idem-1", "acme"):
+            first = registry.choose("openai", TARGET)["name"]
+    # Retries under the same key reuse it; other tenants pick afresh
+    with patch("reliapi.core.credentials.random.choices", side_effect=lambda ready, weights: [ready[0]]):
+        with select_credentials(None, "idem-1", "acme"):
+            assert registry.choose("openai", TARGET)["name"] == first == "org-b"
+        with select_credentials(None, "idem-1", "other"):
+            assert registry.choose("openai", TARGET)["name"] == "org-a"
+
+
+def test_check_pin():
+    registry = CredentialRegistry()
+    registry.check_pin("openai", TARGET, "org-a")
+    with pytest.raises(CredentialError, match="is disabled"):
+        registry.check_pin("openai", TARGET, "org-c")
+    with pytest.raises(CredentialError, match="has no credential 'org-z'"):
+        registry.check_pin("openai", TARGET, "org-z")
+    registry.set_disabled("openai", "org-c", False)
+    registry.check_pin("openai", TARGET, "org-c")
+
+
+def test_added_credentials_replace_configured_ones():
+    registry = CredentialRegistry()
+    registry.set_disabled("openai", "org-b", True)
+    registry.add("openai", "org-b", "sk-b2", weight=2.0)
+    registry.add("openai", "org-d", "sk-d")
+    status = {c["name"]: c for c in registry.status("openai", TARGET)}
+    assert status["org-b"]["source"] == "admin" and status["org-b"]["weight"] == 2.0
+    assert status["org-b"]["status"] == "active"
+    assert status["org-d"]["source"] == "admin"
+    assert "api_key" not in status["org-a"]
+    with select_credentials("org-b"):
+        assert registry.choose("openai", TARGET)["api_key"] == "sk-b2"
+
+
+def test_env_keys_and_targets_without_credentials(monkeypatch):
+    registry = CredentialRegistry()
+    target = {"credentials": [{"name": "org-a", "api_key": "env:ORG_A_KEY"}]}
+    assert registry.choose("openai", target) is None
+    monkeypatch.setenv("ORG_A_KEY", "sk-from-env")
+    assert registry.choose("openai", target)["api_key"] == "sk-from-env"
+    assert registry.choose("openai", {"base_url": "https://api.openai.com/v1"}) is None
+
+
+def test_http_client_authenticates_with_credential():
+    target = {**TARGET, "auth": {"type": "api_key", "header": "x-api-key"}}
+    with select_credentials("org-a") as choice:
+        client, selected_key, auth_source = services.create_http_client(target, "openai")
+    assert auth_source == "credential" and selected_key is None
+    assert client.auth == {"type": "api_key", "header": "x-api-key", "prefix": "", "api_key": "sk-a"}
+    assert choice.used == "org-a"
+    for _ in range(3):
+        client.on_status(429)
+    statuses = {c["name"]: c["status"] for c in services.credential_status("openai", target)}
+    assert statuses["org-a"] == "cooling_down"
+
+
+def test_http_client_without_credentials_uses_target_auth():
+    target = {"base_url": "https://api.example.com", "auth": {"type": "api_key", "api_key": "sk-plain"}}
+    client, _, auth_source = services.create_http_client(target, "api")
+    assert auth_source != "credential"
+    assert client.on_status is None
@@ -0,0 +1,121 @@
+"""Tests for dry_run requests to /proxy/http and /proxy/llm."""
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.app import services
+from reliapi.app.services import handle_http_proxy, handle_llm_proxy, record_usage
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_targets():
+    return {
+        "api": {"base_url": "https://api.example.com", "cache": {"enabled": True, "ttl_s": 60}},
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "llm": {"provider": "openai", "default_model": "gpt-4o-mini", "hard_cost_cap_usd": 0.01},
+        },
+    }
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.get_entry.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+def _llm(targets, cache, idempotency, **kwargs):
+    return handle_llm_proxy(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Hi"}],
+        model=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        stream=False,
+        idempotency_key="run-1",
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=idempotency,
+        request_id="req_dry",
+        dry_run=True,
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_llm_dry_run(mock_targets, mock_cache):
+    """Test that a dry run is priced and keyed without calling the upstream."""
+    idempotency = Mock(spec=IdempotencyManager)
+    mock_cache.get.return_value = {"body": {"content": "cached"}}
+    upstream = AsyncMock()
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await _llm(mock_targets, mock_cache, idempotency, max_tokens=10)
+
+    assert result.success and result.data is None
+    assert result.meta.dry_run is True
+    assert result.meta.cache_entry_exists is True
+    assert result.meta.cache_hit is False
+    assert result.meta.cache_key
+    assert result.meta.model == "gpt-4o-mini"
+    assert result.meta.cost_estimate_usd > 0
+    upstream.assert_not_called()
+    idempotency.register_request.assert_not_called()
+    mock_cache.set.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_llm_dry_run_runs_budget_checks(mock_targets, mock_cache):
+    """Test that a dry run over the target's hard cost cap is rejected as usual."""
+    mock_targets["openai"]["llm"]["default_model"] = "gpt-4o"
+    result = await _llm(mock_targets, mock_cache, Mock(spec=IdempotencyManager), max_tokens=10000)
+
+    assert result.error.code == "BUDGET_EXCEEDED"
+
+
+@pytest.mark.asyncio
+async def test_http_dry_run(mock_targets, mock_cache):
+    """Test that an HTTP dry run resolves the cache key and is not counted."""
+    upstream = AsyncMock()
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_http_proxy(
+            target_name="api",
+            method="GET",
+            path="/items",
+            headers=None,
+            query={"page": "2"},
+            body=None,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=mock_targets,
+            cache=mock_cache,
+            idempotency=Mock(spec=IdempotencyManager),
+            request_id="req_dry_http",
+            dry_run=True,
+        )
+
+    assert result.data is None
+    assert result.meta.dry_run is True
+    assert result.meta.cache_entry_exists is False
+    assert result.meta.cache_key
+    upstream.assert_not_called()
+
+    ledger = Mock()
+    with patch.object(services, "_usage_ledger", ledger):
+        record_usage(result, "http", "acme", "key")
+    ledger.record.assert_not_called()
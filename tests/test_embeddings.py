@@ -0,0 +1,164 @@
+"""Tests for app/services.py handle_embeddings_proxy."""
+import json
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.app import services
+from reliapi.app.services import handle_embeddings_proxy
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_targets():
+    return {
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "llm": {"provider": "openai", "embedding_model": "text-embedding-3-small"},
+            "cache": {"enabled": True, "ttl_s": 60},
+        },
+        "mistral": {
+            "base_url": "https://api.mistral.ai/v1",
+            "llm": {"provider": "mistral", "embedding_model": "mistral-embed"},
+        },
+    }
+
+
+@pytest.fixture
+def mock_cache():
+    """A cache holding vectors for the texts in its store."""
+    cache = Mock(spec=Cache)
+    store = {}
+    cache.get.side_effect = lambda *args, **kwargs: store.get(kwargs["key_override"]["embedding"])
+    cache.set.side_effect = lambda *args, **kwargs: store.__setitem__(kwargs["key_override"]["embedding"], args[4])
+    cache.store = store
+    return cache
+
+
+@pytest.fixture
+def mock_idempotency():
+    return Mock(spec=IdempotencyManager)
+
+
+def _upstream(texts, tokens_per_text=5):
+    return httpx.Response(200, json={
+        "data": [{"index": i, "embedding": [float(i), 0.5]} for i in reversed(range(len(texts)))],
+        "usage": {"prompt_tokens": tokens_per_text * len(texts)},
+    })
+
+
+async def _embed(targets, cache, idempotency, inputs, target="openai", **kwargs):
+    return await handle_embeddings_proxy(
+        target_name=target,
+        inputs=inputs,
+        model=kwargs.pop("model", None),
+        dimensions=kwargs.pop("dimensions", None),
+        idempotency_key=kwargs.pop("idempotency_key", None),
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=idempotency,
+        request_id="req_emb",
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_only_cache_misses_are_sent_and_billed(mock_targets, mock_cache, mock_idempotency):
+    """Test that a batch with 90 cached inputs bills for the other 10."""
+    texts = [f"text {i}" for i in range(100)]
+    for text in texts[:90]:
+        mock_cache.store[text] = {"embedding": [9.0, 9.0]}
+    misses = texts[90:]
+    upstream = AsyncMock(return_value=_upstream(misses, tokens_per_text=100))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _embed(mock_targets, mock_cache, mock_idempotency, texts)
+
+    sent = json.loads(upstream.call_args.kwargs["content"])
+    assert sent == {"model": "text-embedding-3-small", "input": misses, "encoding_format": "float"}
+    assert result.success
+    assert result.data["cache_hits"] == [True] * 90 + [False] * 10
+    assert result.data["embeddings"][0] == [9.0, 9.0]
+    # Vectors come back in input order even when the provider reorders them
+    assert result.data["embeddings"][90:92] == [[0.0, 0.5], [1.0, 0.5]]
+    assert result.data["prompt_tokens"] == 1000
+    assert result.meta.cost_usd == pytest.approx(1000 / 1_000_000 * 0.02)
+    assert result.meta.cache_hit is False
+    assert mock_cache.store[misses[0]] == {"embedding": [0.0, 0.5]}
+
+
+@pytest.mark.asyncio
+async def test_fully_cached_batch_is_free(mock_targets, mock_cache, mock_idempotency):
+    """Test that a batch served from the cache makes no upstream call."""
+    mock_cache.store["a"] = {"embedding": [1.0]}
+    upstream = AsyncMock()
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _embed(mock_targets, mock_cache, mock_idempotency, ["a", "a"], idempotency_key="k")
+
+    upstream.assert_not_called()
+    mock_idempotency.register_request.assert_not_called()
+    assert result.data == {"embeddings": [[1.0], [1.0]], "cache_hits": [True, True], "prompt_tokens": 0}
+    assert result.meta.cache_hit is True
+    assert result.meta.cost_usd == 0.0
+
+
+@pytest.mark.asyncio
+async def test_repeated_inputs_sent_once(mock_targets, mock_cache, mock_idempotency):
+    """Test that duplicate inputs in a batch are embedded once."""
+    upstream = AsyncMock(return_value=_upstream(["a", "b"]))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _embed(mock_targets, mock_cache, mock_idempotency, ["a", "b", "a"])
+
+    assert json.loads(upstream.call_args.kwargs["content"])["input"] == ["a", "b"]
+    assert result.data["embeddings"] == [[0.0, 0.5], [1.0, 0.5], [0.0, 0.5]]
+    assert result.data["cache_hits"] == [False, False, False]
+
+
+@pytest.mark.asyncio
+async def test_dimensions_unsupported_rejected(mock_targets, mock_cache, mock_idempotency):
+    """Test that options the provider lacks fail before the upstream."""
+    upstream = AsyncMock()
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _embed(mock_targets, mock_cache, mock_idempotency, ["a"], target="mistral", dimensions=256)
+
+    assert result.error.code == "BAD_REQUEST"
+    upstream.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_upstream_error(mock_targets, mock_cache, mock_idempotency):
+    """Test that an upstream error is returned and nothing is cached."""
+    upstream = AsyncMock(return_value=httpx.Response(400, json={"error": {"message": "bad model"}}))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _embed(mock_targets, mock_cache, mock_idempotency, ["a"], model="nope")
+
+    assert not result.success
+    assert result.error.status_code == 400
+    mock_cache.set.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_input_type_keys_the_cache(mock_targets, mock_cache, mock_idempotency):
+    """Test that inputs embedded with an input_type are cached apart."""
+    upstream = AsyncMock(return_value=_upstream(["a"]))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        await _embed(mock_targets, mock_cache, mock_idempotency, ["a"], input_type="query")
+
+    assert mock_cache.get.call_args.kwargs["key_override"]["input_type"] == "query"
+    assert "input_type" not in json.loads(upstream.call_args.kwargs["content"])
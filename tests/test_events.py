@@ -0,0 +1,109 @@
+"""Tests for the event bus and the GET /events stream."""
+import asyncio
+
+import pytest
+
+from reliapi.app import services
+from reliapi.app.routes import events as events_route
+from reliapi.core.events import CIRCUIT_CLOSED, CIRCUIT_OPENED, EVENTS_GAP, EventBus
+
+
+@pytest.fixture(autouse=True)
+def fresh_breakers():
+    """Isolate the process-wide circuit breakers and events between tests."""
+    services._circuit_breakers.clear()
+    services.get_event_bus().clear()
+    yield
+    services._circuit_breakers.clear()
+    services.get_event_bus().clear()
+
+
+class _Request:
+    """Stands in for a request that disconnects after a number of checks."""
+
+    def __init__(self, checks):
+        self.checks = checks
+
+    async def is_disconnected(self):
+        self.checks -= 1
+        return self.checks < 0
+
+
+def test_events_are_scoped_to_tenant_and_key():
+    bus = EventBus()
+    bus.publish("circuit.opened", {"target": "openai"})
+    bus.publish("budget.threshold_reached", {"threshold": 0.5}, tenant="acme")
+    bus.publish("budget.threshold_reached", {"threshold": 0.5}, tenant="acme", api_key="team-a")
+    bus.publish("budget.threshold_reached", {"threshold": 0.5}, tenant="globex")
+
+    events, gap, newest = bus.since(0, "acme", None)
+    assert [e["id"] for e in events] == [1, 2] and gap is None and newest == 4
+    events, _, _ = bus.since(1, "acme", "team-a")
+    assert [e["id"] for e in events] == [2, 3]
+
+
+def test_subscribers_far_behind_get_a_gap():
+    bus = EventBus(max_events=2)
+    for n in range(5):
+        bus.publish("target.changed", {"n": n})
+    events, gap, _ = bus.since(1, None, None)
+    assert [e["id"] for e in events] == [4, 5] and gap == (2, 3)
+    # An id from before a restart replays everything retained
+    events, gap, _ = bus.since(99, None, None)
+    assert [e["id"] for e in events] == [4, 5] and gap is None
+
+
+@pytest.mark.asyncio
+async def test_wait_wakes_on_publish():
+    bus = EventBus()
+    waiter = asyncio.create_task(bus.wait(0, 5.0))
+    await asyncio.sleep(0)
+    bus.publish("target.changed", {})
+    await asyncio.wait_for(waiter, 1.0)
+    # Nothing newer: the wait times out
+    await bus.wait(1, 0.01)
+
+
+def test_circuit_transitions_are_published():
+    bus = services.get_event_bus()
+    start = bus.last_id
+    breaker = services.get_circuit_breaker("openai", {"error_threshold": 2, "cooldown_s": 60})
+    breaker.record_failure("https://api.openai.com")
+    breaker.record_failure("https://api.openai.com")
+    breaker.record_failure("https://api.openai.com")
+    breaker.record_success("https://api.openai.com")
+    events, _, _ = bus.since(start, "acme", None)
+    assert [e["type"] for e in events] == [CIRCUIT_OPENED, CIRCUIT_CLOSED]
+    assert events[0]["data"]["target"] == "openai"
+
+
+@pytest.mark.asyncio
+async def test_stream_resumes_after_the_last_event(monkeypatch):
+    monkeypatch.setattr(events_route, "HEARTBEAT_S", 0.01)
+    bus = services.get_event_bus()
+    first = bus.publish("target.changed", {"target": "a"})
+    bus.publish("budget.threshold_reached", {}, tenant="globex")
+    second = bus.publish("target.changed", {"target": "b"})
+
+    frames = [f async for f in events_route._stream(_Request(1), first["id"], "acme", None)]
+    assert frames[0] == "retry: 1000\n\n"
+    assert frames[1].startswith(f"id: {second['id']}\nevent: target.changed\n")
+    assert '"target": "b"' in frames[1]
+    assert frames[-1] == ": heartbeat\n\n"
+
+    # Skipped events of another tenant still move the cursor
+    bus.publish("budget.threshold_reached", {}, tenant="globex")
+    frames = [f async for f in events_route._stream(_Request(1), second["id"], "acme", None)]
+    assert frames[1] == f"id: {bus.last_id}\n\n"
+
+
+@pytest.mark.asyncio
+async def test_stream_reports_a_gap(monkeypatch):
+    monkeypatch.setattr(events_route, "HEARTBEAT_S", 0.01)
+    monkeypatch.setattr(services, "_events", EventBus(max_events=1))
+    bus = services.get_event_bus()
+    for _ in range(3):
+        bus.publish("target.changed", {})
+    frames = [f async for f in events_route._stream(_Request(1), 1, "acme", None)]
+    assert frames[1].startswith(f"event: {EVENTS_GAP}\n") and '"to_id": 2' in frames[1]
+    assert frames[2].startswith("id: 3\n")
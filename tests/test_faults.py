@@ -0,0 +1,163 @@
+"""Tests for fault injection into proxy requests."""
+import json
+from types import SimpleNamespace
+
+import pytest
+from fastapi import HTTPException
+
+from reliapi.app.routes.proxy import _faulted_stream, _inject_faults, _proxy_response
+from reliapi.app.schemas import MetaResponse, SuccessResponse
+from reliapi.app.services import injected_error
+from reliapi.config.schema import ApiKeyConfig
+from reliapi.core.faults import Fault, FaultSpecError, parse_faults, roll
+from reliapi.core.key_limits import KeyLimits
+
+
+def test_parse_faults():
+    faults = parse_faults("latency=2000;p=0.5, error=CIRCUIT_OPEN, truncate=3, corrupt;p=0.1")
+
+    assert faults == [
+        Fault("latency", 0.5, latency_ms=2000),
+        Fault("error", error_code="CIRCUIT_OPEN"),
+        Fault("truncate", after_chunks=3),
+        Fault("corrupt", 0.1),
+    ]
+    assert [f.label for f in faults] == [
+        "latency_2000ms", "error_CIRCUIT_OPEN", "truncate_after_3_chunks", "corrupt_json",
+    ]
+
+
+@pytest.mark.parametrize("spec", [
+    "",
+    "explode",
+    "latency",
+    "latency=soon",
+    "latency=999999",
+    "error=TEAPOT",
+    "truncate=-1",
+    "corrupt=1",
+    "latency=10;p=2",
+    "latency=10;q=0.5",
+    "latency=10,",
+])
+def test_parse_faults_rejects(spec):
+    with pytest.raises(FaultSpecError):
+        parse_faults(spec)
+
+
+def test_roll_draws_per_fault():
+    faults = parse_faults("latency=100;p=0.5, latency=50, error=UPSTREAM_TIMEOUT;p=0.2")
+
+    plan = roll(faults, rand=iter([0.9, 0.0, 0.1]).__next__)
+
+    assert plan.latency_ms == 50
+    assert plan.error.error_code == "UPSTREAM_TIMEOUT"
+    assert plan.label == "latency_50ms,error_UPSTREAM_TIMEOUT"
+    assert roll(parse_faults("latency=100;p=0.5"), rand=lambda: 0.99) is None
+
+
+def test_roll_matches_faults_to_the_response():
+    faults = parse_faults("truncate=2, corrupt")
+
+    assert roll(faults, stream=True).label == "truncate_after_2_chunks"
+    assert roll(faults, stream=False).label == "corrupt_json"
+    # An error leaves nothing to truncate or corrupt
+    assert roll(parse_faults("corrupt, error=QUEUE_FULL")).label == "error_QUEUE_FULL"
+
+
+def test_injected_error_matches_reliapi_errors():
+    result = injected_error(Fault("error", error_code="RATE_LIMIT_RELIAPI"), "openai", "req_1")
+
+    assert result.error.status_code == 429
+    assert result.error.type == "rate_limit"
+    assert result.error.retryable
+    assert result.error.source == "reliapi"
+    budget = injected_error(Fault("error", error_code="BUDGET_EXCEEDED"), "openai", "req_1")
+    assert (budget.error.status_code, budget.error.type, budget.error.retryable) == (400, "budget_error", False)
+
+
+def _http_request(**headers):
+    return SimpleNamespace(headers=headers)
+
+
+@pytest.mark.asyncio
+async def test_header_is_rejected_for_production_keys(monkeypatch):
+    monkeypatch.setenv("ENVIRONMENT", "production")
+    request = _http_request(**{"X-ReliAPI-Fault": "error=CIRCUIT_OPEN"})
+
+    with pytest.raises(HTTPException) as exc:
+        await _inject_faults(request, KeyLimits(name="prod"))
+    assert exc.value.status_code == 403
+    assert exc.value.detail["code"] == "FORBIDDEN"
+
+    plan = await _inject_faults(request, KeyLimits(name="ci", test=True))
+    assert plan.error.error_code == "CIRCUIT_OPEN"
+
+
+@pytest.mark.asyncio
+async def test_header_outside_production(monkeypatch):
+    monkeypatch.delenv("ENVIRONMENT", raising=False)
+
+    plan = await _inject_faults(_http_request(**{"X-ReliAPI-Fault": "corrupt"}), None)
+    assert plan.corrupt
+
+    with pytest.raises(HTTPException) as exc:
+        await _inject_faults(_http_request(**{"X-ReliAPI-Fault": "latency=forever"}), None)
+    assert exc.value.status_code == 400
+
+
+@pytest.mark.asyncio
+async def test_key_faults_apply_to_test_keys(monkeypatch):
+    monkeypatch.setenv("ENVIRONMENT", "production")
+    key = KeyLimits(name="ci", test=True, faults="error=SERVER_ERROR")
+
+    assert (await _inject_faults(_http_request(), key)).label == "error_SERVER_ERROR"
+    assert await _inject_faults(_http_request(), KeyLimits(name="prod", faults="error=SERVER_ERROR")) is None
+
+
+def test_key_faults_require_test_keys():
+    assert ApiKeyConfig(api_key="k", test=True, faults="latency=100").faults == "latency=100"
+    with pytest.raises(ValueError):
+        ApiKeyConfig(api_key="k", faults="latency=100")
+    with pytest.raises(ValueError):
+        ApiKeyConfig(api_key="k", test=True, faults="latency=never")
+
+
+def test_corrupt_response():
+    result = SuccessResponse(success=True, data={"content": "Paris"}, meta=MetaResponse(duration_ms=1, request_id="req_1"))
+
+    response = _proxy_response(result, 200, {}, roll(parse_faults("corrupt")))
+
+    assert response.headers["X-ReliAPI-Fault-Injected"] == "corrupt_json"
+    with pytest.raises(ValueError):
+        json.loads(response.body)
+    assert json.loads(_proxy_response(result, 200, {}).body)["data"] == {"content": "Paris"}
+
+
+async def _events():
+    yield 'event: meta\ndata: {"target": "openai"}\n\n'
+    for i in range(4):
+        yield f'id: {i}\nevent: chunk\ndata: {{"delta": "{i}"}}\n\n'
+    yield 'event: done\ndata: {"cost_usd": 0.001}\n\n'
+
+
+@pytest.mark.asyncio
+async def test_truncated_stream():
+    plan = roll(parse_faults("truncate=2"), stream=True)
+
+    events = [event async for event in _faulted_stream(_events(), plan, "openai", "req_1")]
+
+    assert len(events) == 3
+    assert json.loads(events[0].split("data: ", 1)[1])["fault_injected"] == "truncate_after_2_chunks"
+    assert not any(event.startswith("event: done") for event in events)
+
+
+@pytest.mark.asyncio
+async def test_error_stream():
+    plan = roll(parse_faults("error=UPSTREAM_TIMEOUT"), stream=True)
+
+    events = [event async for event in _faulted_stream(_events(), plan, "openai", "req_1")]
+
+    assert len(events) == 1 and events[0].startswith("event: error\n")
+    data = json.loads(events[0].split("data: ", 1)[1])
+    assert (data["code"], data["upstream_status"]) == ("UPSTREAM_TIMEOUT", 504)
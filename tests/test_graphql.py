@@ -0,0 +1,195 @@
+"""Tests for core/graphql.py and app/services.py handle_graphql_proxy."""
+import json
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.app import services
+from reliapi.app.services import handle_graphql_proxy
+from reliapi.core.cache import Cache
+from reliapi.core.graphql import GraphQLSyntaxError, parse_operation
+from reliapi.core.idempotency import IdempotencyManager
+
+
+class TestParseOperation:
+    """Test operation detection and document normalization."""
+
+    def test_formatting_and_order_insensitive(self):
+        """Test that whitespace, commas, comments and selection order don't matter."""
+        a = parse_operation("{ user(id: 1) { name email ...F } } fragment F on User { id }")
+        b = parse_operation(
+            """
+            fragment F on User { id }
+            query {
+              user(id: 1) {  # contact details
+                ...F, email
+                name
+              }
+            }
+            """
+        )
+        assert a == b
+        assert a[0] == "query"
+
+    def test_arguments_and_strings_are_significant(self):
+        """Test that different arguments or string contents give different keys."""
+        assert parse_operation("{ user(id: 1) { name } }")[1] != parse_operation("{ user(id: 2) { name } }")[1]
+        assert parse_operation('{ s(q: "a  b") }')[1] != parse_operation('{ s(q: "a b") }')[1]
+
+    def test_operation_selected_by_name(self):
+        """Test that operation_name picks the operation type."""
+        document = "query Get { a } mutation Set($v: Int) { set(v: $v) { a } }"
+        assert parse_operation(document, "Set")[0] == "mutation"
+        assert parse_operation(document, "Get")[0] == "query"
+
+    @pytest.mark.parametrize("document, operation_name", [
+        ("query A { a } query B { b }", None),
+        ("query A { a }", "B"),
+        ("{ a ", None),
+        ("{ }", None),
+        ("type T { a: Int }", None),
+        ("fragment F on T { a }", None),
+    ])
+    def test_invalid_documents(self, document, operation_name):
+        """Test that invalid or ambiguous documents are rejected."""
+        with pytest.raises(GraphQLSyntaxError):
+            parse_operation(document, operation_name)
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_targets():
+    return {"gql": {"base_url": "https://api.example.com", "cache": {"enabled": True, "ttl_s": 60}}}
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.get_entry.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+@pytest.fixture
+def mock_idempotency():
+    return Mock(spec=IdempotencyManager)
+
+
+async def _graphql(targets, cache, idempotency, query, **kwargs):
+    return await handle_graphql_proxy(
+        target_name="gql",
+        query=query,
+        operation_name=kwargs.pop("operation_name", None),
+        variables=kwargs.pop("variables", None),
+        path="/graphql",
+        headers=None,
+        idempotency_key=kwargs.pop("idempotency_key", None),
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=idempotency,
+        request_id="req_gql",
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_query_cached_by_normalized_key(mock_targets, mock_cache, mock_idempotency):
+    """Test that a query is posted upstream and cached under its normalized key."""
+    upstream = AsyncMock(return_value=httpx.Response(200, json={"data": {"user": {"name": "Ada"}}}))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _graphql(
+            mock_targets, mock_cache, mock_idempotency,
+            "query($id: ID!) { user(id: $id) { name } }", variables={"id": "1", "locale": "en"},
+        )
+
+    sent = json.loads(upstream.call_args.kwargs["content"])
+    assert sent == {"query": "query($id: ID!) { user(id: $id) { name } }", "variables": {"id": "1", "locale": "en"}}
+    assert result.success
+    assert result.data == {"data": {"user": {"name": "Ada"}}}
+    stored = mock_cache.set.call_args
+    assert stored.kwargs["allow_post"] is True
+    assert stored.args[4]["result"] == result.data
+
+    # Same query, reformatted and with variables in another order
+    mock_cache.get.return_value = stored.args[4]
+    hit = await _graphql(
+        mock_targets, mock_cache, mock_idempotency,
+        "query ($id: ID!) {\n  user(id: $id) {\n    name\n  }\n}", variables={"locale": "en", "id": "1"},
+    )
+    assert hit.meta.cache_hit is True
+    assert hit.data == result.data
+    assert hit.meta.cache_key == result.meta.cache_key
+
+
+@pytest.mark.asyncio
+async def test_mutation_not_cached(mock_targets, mock_cache, mock_idempotency):
+    """Test that mutations skip the cache but keep their idempotency key."""
+    mock_idempotency.register_request.return_value = (True, None, None)
+    upstream = AsyncMock(return_value=httpx.Response(200, json={"data": {"set": True}}))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _graphql(
+            mock_targets, mock_cache, mock_idempotency,
+            "mutation { set(v: 1) }", idempotency_key="idem-1",
+        )
+
+    assert result.data == {"data": {"set": True}}
+    assert result.meta.cache_key is None
+    mock_cache.get.assert_not_called()
+    mock_cache.set.assert_not_called()
+    assert mock_idempotency.register_request.call_args.args[0] == "idem-1"
+    mock_idempotency.store_result.assert_called_once()
+
+
+@pytest.mark.asyncio
+async def test_partial_errors_returned_not_cached(mock_targets, mock_cache, mock_idempotency):
+    """Test that errors next to data are returned in data.errors and not cached."""
+    body = {
+        "data": {"user": {"name": "Ada", "avatar": None}},
+        "errors": [{"message": "avatar unavailable", "path": ["user", "avatar"]}],
+    }
+    upstream = AsyncMock(return_value=httpx.Response(200, json=body))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _graphql(mock_targets, mock_cache, mock_idempotency, "{ user { name avatar } }")
+
+    assert result.success
+    assert result.data == body
+    mock_cache.set.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_invalid_document_rejected(mock_targets, mock_cache, mock_idempotency):
+    """Test that ambiguous documents and subscriptions fail before the upstream."""
+    upstream = AsyncMock()
+
+    with patch("httpx.AsyncClient.request", upstream):
+        ambiguous = await _graphql(mock_targets, mock_cache, mock_idempotency, "query A { a } query B { b }")
+        subscription = await _graphql(mock_targets, mock_cache, mock_idempotency, "subscription { ticks }")
+
+    assert ambiguous.error.code == "BAD_REQUEST"
+    assert subscription.error.status_code == 400
+    upstream.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_non_graphql_response_is_error(mock_targets, mock_cache, mock_idempotency):
+    """Test that an upstream answer without data or errors is an upstream error."""
+    upstream = AsyncMock(return_value=httpx.Response(404, text="not found"))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _graphql(mock_targets, mock_cache, mock_idempotency, "{ a }")
+
+    assert not result.success
+    assert result.error.status_code == 502
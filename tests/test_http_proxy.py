@@ -0,0 +1,417 @@
+"""Tests for app/services.py handle_http_proxy."""
+import base64
+import json
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.app import services
+from reliapi.app.services import handle_http_proxy
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_targets():
+    return {
+        "api": {
+            "base_url": "https://api.example.com",
+            "cache": {"enabled": True, "ttl_s": 60, "stale_ttl_s": 3600},
+        }
+    }
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.get_entry.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+@pytest.fixture
+def mock_idempotency():
+    return Mock(spec=IdempotencyManager)
+
+
+def _cached(etag='W/"v1"'):
+    return {
+        "status_code": 200,
+        "headers": {"content-type": "application/json", "etag": etag},
+        "body": {"items": [1, 2]},
+    }
+
+
+async def _get(targets, cache, idempotency, **kwargs):
+    return await handle_http_proxy(
+        target_name="api",
+        method="GET",
+        path="/items",
+        headers=kwargs.pop("headers", None),
+        query=None,
+        body=None,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=idempotency,
+        request_id="req_cond",
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_expired_entry_revalidated_with_weak_etag(mock_targets, mock_cache, mock_idempotency):
+    """Test that a 304 to a weak ETag reuses the cached body and refreshes it."""
+    mock_cache.get_entry.return_value = {"value": _cached(), "age_s": 120, "stale": True}
+    upstream = AsyncMock(return_value=httpx.Response(304, headers={"etag": 'W/"v1"'}))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _get(mock_targets, mock_cache, mock_idempotency)
+
+    assert upstream.call_args.kwargs["headers"]["If-None-Match"] == 'W/"v1"'
+    assert result.success
+    assert result.data["body"] == {"items": [1, 2]}
+    assert result.meta.revalidated is True
+    assert result.meta.cache_hit is True
+    stored = mock_cache.set.call_args
+    assert stored.args[4] == _cached()
+    assert stored.kwargs["ttl_s"] == 60
+
+
+@pytest.mark.asyncio
+async def test_expired_entry_replaced_on_200(mock_targets, mock_cache, mock_idempotency):
+    """Test that a changed resource replaces the revalidated entry."""
+    mock_cache.get_entry.return_value = {"value": _cached(), "age_s": 120, "stale": True}
+    upstream = AsyncMock(return_value=httpx.Response(
+        200, json={"items": [3]}, headers={"etag": '"v2"'}
+    ))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _get(mock_targets, mock_cache, mock_idempotency)
+
+    assert result.data["body"] == {"items": [3]}
+    assert result.meta.revalidated is False
+    assert result.meta.cache_hit is False
+    assert mock_cache.set.call_args.args[4]["body"] == {"items": [3]}
+    # Validated entries outlive their TTL so they can be revalidated later
+    assert mock_cache.set.call_args.kwargs["stale_ttl_s"] == 3600
+
+
+@pytest.mark.asyncio
+async def test_if_none_match_against_fresh_entry(mock_targets, mock_cache, mock_idempotency):
+    """Test that the caller's weak ETag matching a cached entry is not modified."""
+    mock_cache.get.return_value = _cached(etag='W/"v1"')
+
+    result = await _get(mock_targets, mock_cache, mock_idempotency, if_none_match='"v1"')
+
+    assert result.data == {}
+    assert result.meta.not_modified is True
+    assert result.meta.upstream_status == 304
+    assert result.meta.cache_hit is True
+
+
+@pytest.mark.asyncio
+async def test_if_none_match_passed_upstream(mock_targets, mock_cache, mock_idempotency):
+    """Test that the caller's condition reaches the upstream and its 304 is not an error."""
+    upstream = AsyncMock(return_value=httpx.Response(304, headers={"etag": 'W/"v9"'}))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _get(
+            mock_targets, mock_cache, mock_idempotency,
+            if_none_match='W/"v9"', response_headers=["etag"],
+        )
+
+    assert upstream.call_args.kwargs["headers"]["If-None-Match"] == 'W/"v9"'
+    assert result.success
+    assert result.data == {}
+    assert result.meta.not_modified is True
+    assert result.meta.revalidated is False
+    assert result.meta.upstream_headers == {"etag": ['W/"v9"']}
+    mock_cache.set.assert_not_called()
+
+
+
+@pytest.mark.asyncio
+async def test_response_headers_from_upstream(mock_targets, mock_cache, mock_idempotency):
+    """Test that only the requested upstream headers are returned in meta."""
+    upstream = AsyncMock(return_value=httpx.Response(
+        200, json={}, headers={"etag": '"v3"', "x-internal": "1"}
+    ))
+
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _get(mock_targets, mock_cache, mock_idempotency, response_headers=["etag"])
+
+    assert result.meta.upstream_headers == {"etag": ['"v3"']}
+
+
+@pytest.fixture
+def redirect_targets():
+    return {
+        "api": {
+            "base_url": "https://api.example.com",
+            "auth": {"type": "api_key", "header": "X-Api-Key", "api_key": "secret"},
+            "cache": {"enabled": True, "ttl_s": 60},
+        }
+    }
+
+
+def _redirect(location, status=302):
+    return httpx.Response(status, headers={"location": location})
+
+
+@pytest.mark.asyncio
+async def test_redirect_returned_when_not_followed(redirect_targets, mock_cache, mock_idempotency):
+    """Test that by default a 3xx is returned to the caller with its Location."""
+    transport = AsyncMock(return_value=_redirect("/v2/items"))
+
+    with patch("httpx.AsyncHTTPTransport.handle_async_request", transport):
+        result = await _get(redirect_targets, mock_cache, mock_idempotency)
+
+    assert transport.call_count == 1
+    assert result.success
+    assert result.data["status_code"] == 302
+    assert result.data["headers"]["location"] == "/v2/items"
+    assert result.meta.redirect_chain is None
+
+
+@pytest.mark.asyncio
+async def test_cross_origin_redirect_drops_target_auth(redirect_targets, mock_cache, mock_idempotency):
+    """Test that a followed cross-origin redirect does not carry the target's key."""
+    transport = AsyncMock(side_effect=[
+        _redirect("https://cdn.example.com/items"),
+        httpx.Response(200, json={"items": [1]}),
+    ])
+
+    with patch("httpx.AsyncHTTPTransport.handle_async_request", transport), \
+            patch("reliapi.core.http_client.check_base_url", AsyncMock(return_value=None)):
+        result = await _get(redirect_targets, mock_cache, mock_idempotency, follow_redirects=True)
+
+    first, second = (call.args[0] for call in transport.call_args_list)
+    assert first.headers["x-api-key"] == "secret"
+    assert "x-api-key" not in second.headers
+    assert result.data["body"] == {"items": [1]}
+    assert "redirect_chain" not in result.data
+    assert result.meta.redirect_chain == [
+        "https://api.example.com/items",
+        "https://cdn.example.com/items",
+    ]
+    # Not the target's own policy, so neither served from nor stored in the cache
+    mock_cache.get.assert_not_called()
+    mock_cache.set.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_redirects_stop_at_max_redirects(redirect_targets, mock_cache, mock_idempotency):
+    """Test that same-origin hops keep auth and the last hop past the limit is returned."""
+    redirect_targets["api"].update(follow_redirects=True, max_redirects=1)
+    transport = AsyncMock(side_effect=[_redirect("/a", 301), _redirect("/b", 307)])
+
+    with patch("httpx.AsyncHTTPTransport.handle_async_request", transport):
+        result = await _get(redirect_targets, mock_cache, mock_idempotency)
+
+    assert transport.call_args_list[1].args[0].headers["x-api-key"] == "secret"
+    assert result.data["status_code"] == 307
+    assert result.meta.redirect_chain == ["https://api.example.com/items", "https://api.example.com/a"]
+    # The target's own policy: the result is cached
+    mock_cache.set.assert_called_once()
+
+
+@pytest.mark.asyncio
+async def test_redirect_to_private_network_not_followed(redirect_targets, mock_cache, mock_idempotency):
+    """Test that an upstream cannot redirect the proxy into a private network."""
+    transport = AsyncMock(return_value=_redirect("http://10.0.0.1/admin"))
+
+    with patch("httpx.AsyncHTTPTransport.handle_async_request", transport):
+        result = await _get(redirect_targets, mock_cache, mock_idempotency, follow_redirects=True)
+
+    assert transport.call_count == 1
+    assert result.data["status_code"] == 302
+    assert result.meta.redirect_chain is None
+
+
+def _large(size, content_length=True):
+    """Patch the upstream transport to answer with a size-byte text body."""
+
+    async def body():
+        for _ in range(size // 1000):
+            yield b"x" * 1000
+
+    async def send(self, request, **kwargs):
+        headers = {"content-type": "text/plain"}
+        if content_length:
+            headers["content-length"] = str(size)
+        return httpx.Response(200, headers=headers, content=body(), request=request)
+
+    return patch.object(httpx.AsyncClient, "send", new=send)
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("content_length", [True, False])
+async def test_response_over_max_response_bytes_rejected(mock_targets, mock_cache, mock_idempotency, content_length):
+    """Test that a body over max_response_bytes fails, with or without a Content-Length."""
+    with _large(10000, content_length):
+        result = await _get(mock_targets, mock_cache, mock_idempotency, max_response_bytes=2500)
+
+    assert result.error.code == "RESPONSE_TOO_LARGE"
+    assert result.error.status_code == 502
+    assert result.error.details["max_response_bytes"] == 2500
+    assert result.error.details.get("content_length") == (10000 if content_length else None)
+    mock_cache.set.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_truncated_response_not_cached(mock_targets, mock_cache, mock_idempotency):
+    """Test that truncate_response returns the first bytes and skips the cache."""
+    mock_targets["api"]["max_response_bytes"] = 2500
+    with _large(10000):
+        result = await _get(mock_targets, mock_cache, mock_idempotency, truncate_response=True)
+
+    assert result.success
+    assert result.data["body"] == {"raw": "x" * 2500}
+    assert result.meta.truncated is True
+    assert result.meta.original_content_length == 10000
+    assert "truncated" not in result.data
+    mock_cache.set.assert_not_called()
+
+    # Bodies within the limit are returned and cached as usual
+    with _large(2000):
+        result = await _get(mock_targets, mock_cache, mock_idempotency, truncate_response=True)
+    assert result.meta.truncated is None
+    mock_cache.set.assert_called_once()
+
+
+def test_multipart_body_encoded():
+    """Test that multipart parts are encoded into the body with a stable boundary."""
+    from email.parser import BytesParser
+    from email.policy import HTTP
+
+    from reliapi.app.schemas import HTTPProxyRequest
+
+    def build():
+        return HTTPProxyRequest(
+            target="api",
+            method="POST",
+            path="/ocr",
+            headers={"content-type": "application/json", "X-Trace": "1"},
+            idempotency_key="upload-1",
+            multipart={
+                "parts": [
+                    {"name": "language", "value": "en"},
+                    {
+                        "name": "file",
+                        "filename": 'scan "1".png',
+                        "content_type": "image/png",
+                        "data_base64": base64.b64encode(b"\x89PNG\r\n--data").decode(),
+                    },
+                ]
+            },
+        )
+
+    request = build()
+    assert request.body_encoding == "base64"
+    assert request.headers["X-Trace"] == "1"
+    assert "content-type" not in request.headers
+    content_type = request.headers["Content-Type"]
+    assert content_type.startswith("multipart/form-data; boundary=reliapi-")
+    # The same parts encode identically, so idempotent replays match
+    assert build().body == request.body
+
+    body = base64.b64decode(request.body)
+    message = BytesParser(policy=HTTP).parsebytes(f"Content-Type: {content_type}\r\n\r\n".encode() + body)
+    parts = list(message.iter_parts())
+    assert [p.get_param("name", header="content-disposition") for p in parts] == ["language", "file"]
+    assert parts[0].get_payload(decode=True) == b"en"
+    assert parts[1].get_filename() == 'scan "1".png'
+    assert parts[1].get_content_type() == "image/png"
+    assert parts[1].get_payload(decode=True) == b"\x89PNG\r\n--data"
+
+
+@pytest.mark.parametrize(
+    "fields,error",
+    [
+        ({"method": "GET"}, "multipart requires method"),
+        ({"body": "{}"}, "Set body or multipart"),
+        ({"multipart": {"parts": [{"name": "f", "value": "a", "data_base64": "YQ=="}]}}, "exactly one of"),
+    ],
+)
+def test_multipart_rejected(fields, error):
+    """Test that invalid multipart requests fail validation."""
+    from pydantic import ValidationError
+
+    from reliapi.app.schemas import HTTPProxyRequest
+
+    request = {"target": "api", "method": "POST", "path": "/ocr", "multipart": {"parts": [{"name": "f", "value": "a"}]}}
+    with pytest.raises(ValidationError, match=error):
+        HTTPProxyRequest(**{**request, **fields})
+
+
+@pytest.mark.asyncio
+async def test_multipart_not_cached(mock_targets, mock_cache, mock_idempotency):
+    """Test that multipart uploads skip the cache even when the method would allow it."""
+    upstream = AsyncMock(return_value=httpx.Response(200, json={"text": "hello"}))
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _get(mock_targets, mock_cache, mock_idempotency, multipart=True)
+
+    assert result.success
+    assert result.meta.cache_key is None
+    mock_cache.get_entry.assert_not_called()
+    mock_cache.set.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_raw_passthrough_keeps_the_upstream_bytes(mock_targets, mock_cache, mock_idempotency):
+    """Test that raw_passthrough returns and caches the body byte for byte."""
+    body = b'{"b": 1,  "a": [1.0, 2e3]}'
+    upstream = AsyncMock(
+        side_effect=lambda *args, **kwargs: httpx.Response(200, content=body, headers={"content-type": "application/json"})
+    )
+    with patch("httpx.AsyncClient.request", upstream):
+        plain = await _get(mock_targets, mock_cache, mock_idempotency)
+        result = await _get(mock_targets, mock_cache, mock_idempotency, raw_passthrough=True)
+
+    assert mock_cache.set.call_args.args[4]["body"] == body.decode()
+    assert mock_cache.set.call_args.args[4]["body_encoding"] == "raw"
+    assert result.meta.cache_key != plain.meta.cache_key
+    assert services.raw_response_body(result, True, "http") == body
+    assert result.meta.raw_passthrough is True
+    assert result.meta.response_encoding == "utf8"
+    assert result.meta.upstream_status == 200
+    # Usage and audit see the parsed body
+    assert result.data["body"] == {"b": 1, "a": [1.0, 2000.0]}
+    assert services.raw_response_body(plain, True, "http") is None
+
+
+@pytest.mark.parametrize("content, content_type", [
+    (b"id,name\n1,Ada\n", "text/csv"),
+    (b"\x89PNG\r\n", "image/png"),
+    (b"", "application/json"),
+])
+def test_raw_passthrough_of_non_json_bodies(content, content_type):
+    """Test that bodies that are not JSON come back base64-encoded."""
+    from reliapi.app.schemas import MetaResponse, SuccessResponse
+
+    data = services._http_response_data(200, {"content-type": content_type}, content, raw=True)
+    result = SuccessResponse(success=True, data=data, meta=MetaResponse(duration_ms=1, request_id="req_1"))
+
+    raw = services.raw_response_body(result, True, "http")
+
+    assert base64.b64decode(json.loads(raw)) == content
+    assert result.meta.response_encoding == "base64"
+
+
+def test_raw_passthrough_rejects_filters():
+    from reliapi.app.schemas import HTTPProxyRequest
+
+    with pytest.raises(ValueError):
+        HTTPProxyRequest(target="api", method="GET", path="/", raw_passthrough=True, response_filter="id")
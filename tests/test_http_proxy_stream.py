@@ -0,0 +1,167 @@
+"""Tests for app/services.py handle_http_proxy_stream (stream_response)."""
+import base64
+import tracemalloc
+from unittest.mock import Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.app import services
+from reliapi.app.schemas import ErrorResponse, HTTPProxyRequest
+from reliapi.app.services import HTTPStreamResult, handle_http_proxy_stream
+from reliapi.core.cache import Cache
+
+MB = 1024 * 1024
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+def _targets(**cache_config):
+    return {
+        "files": {
+            "base_url": "https://files.example.com",
+            "cache": {"enabled": True, "ttl_s": 60, **cache_config},
+        }
+    }
+
+
+def _upstream(status=200, chunks=(b"hello",), headers=None):
+    """Patch the upstream transport to answer with chunks, lazily generated."""
+
+    async def body():
+        for chunk in chunks:
+            yield chunk
+
+    async def send(self, request, **kwargs):
+        return httpx.Response(
+            status,
+            headers={"content-type": "application/octet-stream", **(headers or {})},
+            content=body(),
+            request=request,
+        )
+
+    return patch.object(httpx.AsyncClient, "send", new=send)
+
+
+def _stream(targets, cache, **kwargs):
+    return handle_http_proxy_stream(
+        target_name="files",
+        method=kwargs.pop("method", "GET"),
+        path="/blob",
+        headers=None,
+        query=None,
+        body=None,
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        request_id="req_stream",
+        **kwargs,
+    )
+
+
+async def _drain(result: HTTPStreamResult) -> int:
+    size = 0
+    async for chunk in result.chunks:
+        size += len(chunk)
+    return size
+
+
+@pytest.mark.asyncio
+async def test_stream_relays_large_body_without_buffering(mock_cache):
+    """Test that 100 MB pass through while memory stays at a few chunks."""
+    chunk = b"\x00" * MB
+
+    def chunks():
+        for _ in range(100):
+            yield chunk
+
+    with _upstream(chunks=chunks(), headers={"content-length": str(100 * MB), "x-reliapi-cache-hit": "true"}):
+        tracemalloc.start()
+        try:
+            result = await _stream(_targets(), mock_cache)
+            size = await _drain(result)
+            _, peak = tracemalloc.get_traced_memory()
+        finally:
+            tracemalloc.stop()
+
+    assert isinstance(result, HTTPStreamResult)
+    assert size == 100 * MB
+    assert peak < 16 * MB
+    assert result.status_code == 200
+    assert result.meta.cache_hit is False
+    assert result.meta.attempts == 1
+    # Hop-level and spoofed metadata headers are not relayed
+    assert "content-length" not in result.headers
+    assert "x-reliapi-cache-hit" not in result.headers
+    assert result.headers["content-type"] == "application/octet-stream"
+    mock_cache.set.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_stream_caches_bodies_within_limit(mock_cache):
+    """Test that streamed GETs are cached only when they fit stream_max_bytes."""
+    with _upstream(chunks=(b"\xff\x00", b"abc")):
+        result = await _stream(_targets(stream_max_bytes=16), mock_cache)
+        await _drain(result)
+
+    stored = mock_cache.set.call_args
+    assert stored.kwargs["key_override"]["stream_response"] is True
+    value = stored.args[4]
+    assert value["body_encoding"] == "base64"
+    assert base64.b64decode(value["body"]) == b"\xff\x00abc"
+
+    mock_cache.reset_mock()
+    with _upstream(chunks=(b"x" * 10, b"y" * 10)):
+        await _drain(await _stream(_targets(stream_max_bytes=16), mock_cache))
+    mock_cache.set.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_stream_serves_cached_body(mock_cache):
+    """Test that a cached streamed body is replayed byte for byte."""
+    mock_cache.get.return_value = {
+        "status_code": 200,
+        "headers": {"content-type": "application/pdf"},
+        "body": base64.b64encode(b"%PDF-1.7").decode(),
+        "body_encoding": "base64",
+    }
+
+    result = await _stream(_targets(stream_max_bytes=1024), mock_cache)
+
+    assert result.meta.cache_hit is True
+    assert result.headers == {"content-type": "application/pdf"}
+    assert [c async for c in result.chunks] == [b"%PDF-1.7"]
+
+
+@pytest.mark.asyncio
+async def test_stream_upstream_error_is_enveloped(mock_cache):
+    """Test that a failing upstream yields the JSON error, not a stream."""
+    with _upstream(status=503, chunks=(b"unavailable",)):
+        result = await _stream(_targets(), mock_cache, retry={"max_attempts": 1})
+
+    assert isinstance(result, ErrorResponse)
+    assert result.error.code == "SERVER_ERROR"
+    assert result.error.status_code == 503
+    assert result.meta.attempts == 1
+
+
+def test_stream_response_rejects_idempotency_key():
+    """Test that stream_response can't be combined with a replayable key."""
+    with pytest.raises(ValueError):
+        HTTPProxyRequest(target="files", method="POST", path="/", stream_response=True, idempotency_key="k")
+    with pytest.raises(ValueError):
+        HTTPProxyRequest(target="files", method="GET", path="/", stream_response=True, cache_mode="stale_if_error")
@@ -2,8 +2,12 @@
 import json
 import pytest
 import asyncio
-from unittest.mock import Mock, patch
+from unittest.mock import AsyncMock, Mock, patch
 
+import httpx
+
+from reliapi.app.services import handle_http_proxy
+from reliapi.core.cache import Cache
 from reliapi.core.idempotency import IdempotencyManager
 
 
@@ -100,3 +104,99 @@ def test_idempotency_disabled():
     assert is_new is True
     assert existing_id is None
 
+
+
+def test_request_hash_ignores_json_formatting():
+    """JSON bodies differing only in whitespace or key order hash alike."""
+    manager = IdempotencyManager("redis://invalid:6379/0")
+
+    compact = manager.make_request_hash("POST", "https://example.com", None, b'{"a":1,"b":[1,2]}')
+    spaced = manager.make_request_hash("POST", "https://example.com", None, b'{ "b": [1, 2],\n  "a": 1 }')
+    changed = manager.make_request_hash("POST", "https://example.com", None, b'{"a":2,"b":[1,2]}')
+
+    assert compact == spaced
+    assert compact != changed
+    # Non-JSON bodies are hashed as they are
+    assert manager.make_request_hash("POST", "https://example.com", None, b"a=1") != manager.make_request_hash(
+        "POST", "https://example.com", None, b"a=1 "
+    )
+
+
+@patch('reliapi.core.idempotency.redis')
+def test_idempotency_record_replay(mock_redis_module, mock_redis):
+    """Replays report when the key was first seen and how often it was replayed."""
+    mock_redis_module.from_url.return_value = mock_redis
+    manager = IdempotencyManager("redis://localhost:6379/0")
+
+    mock_redis.incr.return_value = 3
+    mock_redis.ttl.return_value = 1200
+    mock_redis.get.return_value = json.dumps({"request_id": "req-1", "request_hash": "h", "created_at": 1700000000})
+
+    meta = manager.record_replay("key-123", tenant="acme")
+
+    # Records written before ttl_s was stored were kept for 3600s
+    assert meta == {
+        "idempotency_replay_count": 3,
+        "idempotency_first_seen_at": "2023-11-14T22:13:20Z",
+        "idempotency_ttl_s": 3600,
+        "idempotency_expires_at": "2023-11-14T23:13:20Z",
+    }
+    mock_redis.incr.assert_called_once_with("reliapi:tenant:acme:idempotency_replays:key-123")
+    mock_redis.expire.assert_called_once_with("reliapi:tenant:acme:idempotency_replays:key-123", 1200)
+
+
+@patch('reliapi.core.idempotency.redis')
+def test_idempotency_ttl(mock_redis_module, mock_redis):
+    """A key registered with ttl_s expires then and reports its expiry."""
+    mock_redis_module.from_url.return_value = mock_redis
+    manager = IdempotencyManager("redis://localhost:6379/0")
+    mock_redis.get.return_value = None
+    mock_redis.set.return_value = True
+
+    with patch('reliapi.core.idempotency.time.time', return_value=1700000000):
+        is_new, _, _ = manager.register_request(
+            "key-123", "POST", "https://example.com", None, b"body", "req-1", ttl_s=86400
+        )
+
+    assert is_new is True
+    args, kwargs = mock_redis.set.call_args
+    assert kwargs == {"nx": True, "ex": 86400}
+    assert json.loads(args[1])["ttl_s"] == 86400
+
+    mock_redis.get.return_value = args[1]
+    assert manager.expiry_meta("key-123") == {
+        "idempotency_ttl_s": 86400,
+        "idempotency_expires_at": "2023-11-15T22:13:20Z",
+    }
+    mock_redis.get.return_value = None
+    assert manager.expiry_meta("unknown") == {}
+
+
+@pytest.mark.asyncio
+async def test_idempotency_ttl_above_target_max_rejected():
+    """An idempotency_ttl_s above the target's idempotency_max_ttl_s is a BAD_REQUEST."""
+    targets = {"api": {"base_url": "https://api.example.com", "idempotency_max_ttl_s": 3600}}
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    upstream = AsyncMock()
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_http_proxy(
+            target_name="api",
+            method="POST",
+            path="/charges",
+            headers=None,
+            query=None,
+            body='{"amount": 100}',
+            idempotency_key="charge-1",
+            idempotency_ttl_s=7200,
+            cache_ttl=None,
+            targets=targets,
+            cache=cache,
+            idempotency=Mock(spec=IdempotencyManager),
+            request_id="req_ttl",
+        )
+
+    assert result.error.code == "BAD_REQUEST"
+    assert result.error.details == {"idempotency_ttl_s": 7200, "idempotency_max_ttl_s": 3600}
+    upstream.assert_not_called()
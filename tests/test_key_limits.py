@@ -0,0 +1,159 @@
+"""Tests for per-API-key budgets and rate limits."""
+import pytest
+from fastapi import HTTPException
+from unittest.mock import Mock, patch
+
+from reliapi.app import services
+from reliapi.app.routes.proxy import _check_key_rate_limit, _rate_limit_headers, _stamp_key_quota
+from reliapi.app.schemas import ErrorResponse, MetaResponse, SuccessResponse
+from reliapi.app.services import handle_llm_proxy, key_budget_remaining, record_usage
+from reliapi.config.loader import ConfigLoader
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.key_limits import KeyLimits, KeyRateLimiter
+
+TEAM_A = KeyLimits(name="team-a", monthly_budget_usd=1.0, rate_limit_rpm=2)
+
+
+@pytest.fixture(autouse=True)
+def fresh_key_limits():
+    """Isolate the process-wide key ledgers between tests."""
+    services._key_budget_ledger.reset()
+    services._key_rate_limiter.reset()
+    services._budget_ledger.reset()
+    yield
+    services._key_budget_ledger.reset()
+    services._key_rate_limiter.reset()
+    services._budget_ledger.reset()
+
+
+def _llm_result(cost_usd, cache_hit=False):
+    return SuccessResponse(
+        success=True,
+        data={"content": "Hi"},
+        meta=MetaResponse(target="openai", cost_usd=cost_usd, cache_hit=cache_hit, duration_ms=1, request_id="req_1"),
+    )
+
+
+def test_rate_limiter_windows():
+    limiter = KeyRateLimiter()
+    first = limiter.hit("team-a", 2, now=120.5)
+    assert (first.allowed, first.remaining, first.reset_at) == (True, 1, 180)
+    assert limiter.hit("team-a", 2, now=130).remaining == 0
+    assert not limiter.hit("team-a", 2, now=179.9).allowed
+    # Keys are limited separately, and the window resets each minute
+    assert limiter.hit("team-b", 2, now=150).allowed
+    assert limiter.hit("team-a", 2, now=180).remaining == 1
+    # A batch must fit whole
+    assert not limiter.hit("team-a", 2, requests=2, now=181).allowed
+    assert limiter.hit("team-a", 2, requests=1, now=181).allowed
+
+
+def test_config_finds_key_limits(monkeypatch):
+    monkeypatch.setenv("TEAM_B_KEY", "sk-team-b")
+    loader = ConfigLoader("unused.yaml")
+    loader.config = {
+        "api_keys": {
+            "team-a": {"api_key": "sk-team-a", "monthly_budget_usd": 50.0},
+            "team-b": {"api_key": "env:TEAM_B_KEY", "rate_limit_rpm": 60},
+            "team-c": {"api_key": "env:TEAM_C_KEY_UNSET"},
+        }
+    }
+    assert loader.get_api_key_limits("sk-team-a") == ("team-a", {"api_key": "sk-team-a", "monthly_budget_usd": 50.0})
+    assert loader.get_api_key_limits("sk-team-b")[0] == "team-b"
+    assert loader.get_api_key_limits("") is None
+    assert loader.get_api_key_limits("sk-other") is None
+
+
+def test_key_rate_limit_rejection():
+    rate = _check_key_rate_limit(TEAM_A)
+    assert _rate_limit_headers(rate) == {
+        "X-RateLimit-Limit": "2",
+        "X-RateLimit-Remaining": "1",
+        "X-RateLimit-Reset": str(rate.reset_at),
+    }
+    _check_key_rate_limit(TEAM_A)
+    with pytest.raises(HTTPException) as exc_info:
+        _check_key_rate_limit(TEAM_A)
+    exc = exc_info.value
+    assert exc.status_code == 429
+    assert exc.detail["error"]["code"] == "RATE_LIMIT_RELIAPI"
+    assert exc.detail["error"]["details"]["api_key_name"] == "team-a"
+    assert exc.headers["X-RateLimit-Remaining"] == "0"
+    assert int(exc.headers["Retry-After"]) >= 1
+
+    # Keys without limits are never counted
+    assert _check_key_rate_limit(None) is None
+    assert _check_key_rate_limit(KeyLimits(name="open")) is None
+
+
+def test_key_spend_and_remaining_quota():
+    record_usage(_llm_result(0.25), "llm", "acme", "sk-team-a", TEAM_A)
+    # Cache hits and non-LLM kinds are not charged
+    record_usage(_llm_result(0.25, cache_hit=True), "llm", "acme", "sk-team-a", TEAM_A)
+    record_usage(_llm_result(0.25), "embeddings", "acme", "sk-team-a", TEAM_A)
+    assert key_budget_remaining(TEAM_A) == 0.75
+    assert key_budget_remaining(KeyLimits(name="open")) is None
+
+    result = _llm_result(0.0)
+    _stamp_key_quota(result.meta, TEAM_A, _check_key_rate_limit(TEAM_A))
+    assert result.meta.budget_remaining_usd == 0.75
+    assert result.meta.rate_limit_remaining == 1
+
+
+def test_key_budget_rejection_is_distinct():
+    services._key_budget_ledger.record("team-a", 0.9)
+    assert services._budget_rejection(0.1, None, None, "acme", TEAM_A) is None
+    policy, message, details = services._budget_rejection(0.2, None, None, "acme", TEAM_A)
+    assert policy == "key_budget_rejected"
+    assert services._budget_error_code(policy).value == "KEY_BUDGET_EXCEEDED"
+    assert "team-a" in message
+    assert details["api_key_name"] == "team-a"
+    assert details["key_budget_cap_usd"] == 1.0
+    assert details["spent_usd"] == pytest.approx(0.9)
+
+    # The tenant's budget is checked first and keeps its own code
+    policy, _, _ = services._budget_rejection(0.2, None, 0.1, "acme", TEAM_A)
+    assert services._budget_error_code(policy).value == "BUDGET_EXCEEDED"
+
+
+@pytest.mark.asyncio
+async def test_llm_proxy_rejects_over_key_budget():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    idempotency = Mock(spec=IdempotencyManager)
+    targets = {
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "llm": {"provider": "openai", "default_model": "gpt-4o-mini", "max_tokens": 1024},
+            "auth": {"type": "bearer_env", "env_var": "OPENAI_API_KEY"},
+        }
+    }
+    services._key_budget_ledger.record("team-a", 0.99)
+
+    with patch("reliapi.app.services.CostEstimator") as mock_cost:
+        mock_cost.estimate_from_messages.return_value = 0.02
+        result = await handle_llm_proxy(
+            target_name="openai",
+            messages=[{"role": "user", "content": "Hello"}],
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=targets,
+            cache=cache,
+            idempotency=idempotency,
+            request_id="test-123",
+            tenant="acme",
+            key_limits=TEAM_A,
+        )
+
+    assert isinstance(result, ErrorResponse)
+    assert result.error.code == "KEY_BUDGET_EXCEEDED"
+    assert result.error.details["api_key_name"] == "team-a"
+    assert result.meta.cost_policy_applied == "key_budget_rejected"
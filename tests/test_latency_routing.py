@@ -0,0 +1,136 @@
+"""Tests for latency routing of auto:<name> targets."""
+import pytest
+from pydantic import ValidationError
+
+from reliapi.config.schema import LatencyRouteConfig
+from reliapi.core.latency import LatencyTracker
+from reliapi.core.latency_routing import LatencyRouter, RouteChoice, route_name
+
+ROUTE = {
+    "candidates": [{"target": "openai"}, {"target": "azure", "model": "gpt-4o-mini-eu"}],
+    "metric": "p50",
+    "exploration": 0.1,
+}
+
+
+def _all_healthy(target, model):
+    return True
+
+
+def _tracker(**latencies_s):
+    tracker = LatencyTracker(min_samples=3)
+    for target, latency_s in latencies_s.items():
+        for _ in range(3):
+            tracker.observe(target, latency_s)
+    return tracker
+
+
+def _sequence(*points):
+    """An rng returning points in turn."""
+    points = list(points)
+    return lambda: points.pop(0)
+
+
+def test_route_name():
+    assert route_name("auto:gpt-4o-mini") == "gpt-4o-mini"
+    assert route_name("openai") is None
+
+
+def test_shares_weighted_by_latency_with_exploration():
+    router = LatencyRouter(_tracker(openai=0.2, azure=0.8))
+    openai, azure = router.shares(ROUTE, _all_healthy)
+    # 1/0.2 against 1/0.8 of 90%, and half of the 10% explored each
+    assert openai == pytest.approx(0.9 * 0.8 + 0.05)
+    assert azure == pytest.approx(0.9 * 0.2 + 0.05)
+
+
+def test_p95_metric():
+    tracker = LatencyTracker(min_samples=3)
+    for latency_s in (0.1, 0.1, 2.0):
+        tracker.observe("openai", latency_s)
+    for latency_s in (0.3, 0.3, 0.3):
+        tracker.observe("azure", latency_s)
+    router = LatencyRouter(tracker)
+    assert router.shares(ROUTE, _all_healthy)[0] > 0.5
+    assert router.shares({**ROUTE, "metric": "p95"}, _all_healthy)[0] < 0.5
+
+
+def test_unmeasured_candidates_are_measured_first():
+    router = LatencyRouter(_tracker(openai=0.2))
+    assert router.shares(ROUTE, _all_healthy) == [0.0, 1.0]
+
+
+def test_open_circuits_are_skipped():
+    router = LatencyRouter(_tracker(openai=0.2, azure=0.8), rng=lambda: 0.0)
+    assert router.shares(ROUTE, lambda target, model: target == "azure") == [0.0, 1.0]
+    assert router.choose("mini", ROUTE, lambda target, model: target == "azure").target == "azure"
+    # With every circuit open the first candidate fails fast
+    assert router.choose("mini", ROUTE, lambda target, model: False).target == "openai"
+
+
+def test_choice_carries_the_candidate_model():
+    router = LatencyRouter(_tracker(openai=0.2, azure=0.8), rng=lambda: 0.99)
+    assert router.choose("mini", ROUTE, _all_healthy) == RouteChoice(
+        route="mini", target="azure", model="gpt-4o-mini-eu"
+    )
+
+
+def test_idempotency_key_sticks_while_healthy():
+    tracker = _tracker(openai=0.2, azure=0.8)
+    router = LatencyRouter(tracker, rng=_sequence(0.99, 0.0, 0.0))
+    first = router.choose("mini", ROUTE, _all_healthy, idempotency_key="k1", tenant="acme")
+    assert first.target == "azure"
+    # The retry goes to azure although openai would be picked now
+    assert router.choose("mini", ROUTE, _all_healthy, idempotency_key="k1", tenant="acme") == first
+    # Keys are per tenant
+    assert router.choose("mini", ROUTE, _all_healthy, idempotency_key="k1", tenant="other").target == "openai"
+    # Once azure is unhealthy the retry moves, and sticks to its new candidate
+    moved = router.choose("mini", ROUTE, lambda target, model: target != "azure", idempotency_key="k1", tenant="acme")
+    assert moved.target == "openai"
+    assert router.choose("mini", ROUTE, _all_healthy, idempotency_key="k1", tenant="acme").target == "openai"
+
+
+def test_sticky_choices_are_bounded():
+    router = LatencyRouter(_tracker(openai=0.2, azure=0.8), max_sticky=2, rng=_sequence(0.99, 0.99, 0.99, 0.0))
+    for key in ("k1", "k2", "k3"):
+        router.choose("mini", ROUTE, _all_healthy, idempotency_key=key)
+    # k1 was forgotten, so it is routed afresh
+    assert router.choose("mini", ROUTE, _all_healthy, idempotency_key="k1").target == "openai"
+
+
+def test_stats_table():
+    router = LatencyRouter(_tracker(openai=0.2, azure=0.8), rng=lambda: 0.0)
+    router.choose("mini", ROUTE, _all_healthy)
+    stats = router.stats("mini", ROUTE, lambda target, model: target == "openai")
+
+    assert stats["route"] == "auto:mini"
+    assert stats["metric"] == "p50"
+    openai, azure = stats["candidates"]
+    assert openai == {
+        "target": "openai", "model": None, "healthy": True, "samples": 3,
+        "p50_ms": 200.0, "p95_ms": 200.0, "share": 1.0, "routed": 1,
+    }
+    assert azure["healthy"] is False
+    assert azure["share"] == 0.0
+    assert azure["routed"] == 0
+
+
+def test_latency_tracker_percentile():
+    tracker = LatencyTracker(min_samples=2)
+    tracker.observe("openai", 1.0)
+    assert tracker.percentile("openai", 0.5) is None
+    for latency_s in (2.0, 3.0, 4.0, 5.0):
+        tracker.observe("openai", latency_s)
+    assert tracker.percentile("openai", 0.5) == tracker.p50("openai") == 3.0
+    assert tracker.percentile("openai", 0.95) == pytest.approx(4.8)
+    assert tracker.count("openai") == 5
+
+
+def test_route_config_validation():
+    LatencyRouteConfig(candidates=[{"target": "openai"}, {"target": "azure"}])
+    with pytest.raises(ValidationError):
+        LatencyRouteConfig(candidates=[])
+    with pytest.raises(ValidationError):
+        LatencyRouteConfig(candidates=[{"target": "openai"}, {"target": "openai", "model": "gpt-4o"}])
+    with pytest.raises(ValidationError):
+        LatencyRouteConfig(candidates=[{"target": "openai"}], exploration=0.9)
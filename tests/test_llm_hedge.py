@@ -0,0 +1,173 @@
+"""Tests for hedged (backup) LLM requests."""
+import asyncio
+import random
+import time
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.adapters.llm.openai import OpenAIAdapter
+from reliapi.app import services
+from reliapi.app.schemas import LLMProxyRequest
+from reliapi.app.services import handle_llm_proxy
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+
+HEDGE = {"delay_ms": 50, "max_hedges": 1}
+
+
+def _completion(content):
+    return httpx.Response(
+        200,
+        request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"),
+        json={
+            "choices": [{"message": {"role": "assistant", "content": content}, "finish_reason": "stop"}],
+            "usage": {"prompt_tokens": 1000, "completion_tokens": 100},
+        },
+    )
+
+
+def _upstream(delays):
+    """Upstream answering call n after delays[n] seconds, naming the call."""
+    calls = 0
+
+    async def request(*args, **kwargs):
+        nonlocal calls
+        n, calls = calls, calls + 1
+        await asyncio.sleep(delays(n) if callable(delays) else delays[n])
+        return _completion(f"call {n}")
+
+    return AsyncMock(side_effect=request)
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_targets():
+    return {
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "cache": {"enabled": True, "ttl_s": 3600},
+            "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+        }
+    }
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+async def _call(targets, cache, **kwargs):
+    return await handle_llm_proxy(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Hi"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        stream=False,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=Mock(spec=IdempotencyManager),
+        request_id="req_hedge",
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_backup_wins_slow_first_request(mock_targets, mock_cache):
+    upstream = _upstream([2.0, 0.01])
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await _call(mock_targets, mock_cache, hedge=HEDGE)
+
+    assert result.data["content"] == "call 1"
+    assert upstream.call_count == 2
+    assert result.meta.hedged is True
+    assert result.meta.hedge_winner == 1
+    # The canceled first request is billed, estimated at the winner's cost
+    winner_cost = OpenAIAdapter().get_cost_usd("gpt-4o-mini", 1000, 100)
+    assert result.meta.hedge_cost_usd == pytest.approx(winner_cost)
+    assert result.meta.cost_usd == pytest.approx(2 * winner_cost)
+    assert result.meta.duration_ms < 1000
+
+
+@pytest.mark.asyncio
+async def test_fast_answer_sends_no_backup(mock_targets, mock_cache):
+    upstream = _upstream([0.01])
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await _call(mock_targets, mock_cache, hedge=HEDGE)
+
+    assert upstream.call_count == 1
+    assert result.meta.hedged is False
+    assert result.meta.hedge_winner == 0
+    assert result.meta.hedge_cost_usd == 0
+
+
+@pytest.mark.asyncio
+async def test_canceled_request_not_billed_when_provider_stops(mock_targets, mock_cache):
+    upstream = _upstream([2.0, 0.01])
+    with patch.object(OpenAIAdapter, "BILLS_CANCELED_REQUESTS", False):
+        with patch.object(httpx.AsyncClient, "request", new=upstream):
+            result = await _call(mock_targets, mock_cache, hedge=HEDGE)
+
+    assert result.meta.hedged is True
+    assert result.meta.hedge_cost_usd == 0
+    assert result.meta.cost_usd == pytest.approx(OpenAIAdapter().get_cost_usd("gpt-4o-mini", 1000, 100))
+
+
+@pytest.mark.asyncio
+async def test_requires_reusable_answer(mock_targets, mock_cache):
+    mock_targets["openai"]["cache"]["enabled"] = False
+    upstream = _upstream([0.01])
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await _call(mock_targets, mock_cache, hedge=HEDGE)
+
+    assert result.error.code == "BAD_REQUEST"
+    upstream.assert_not_called()
+
+
+def test_schema_rejects_streaming():
+    with pytest.raises(ValueError):
+        LLMProxyRequest(target="openai", messages=[{"role": "user", "content": "Hi"}], stream=True, hedge=HEDGE)
+
+
+@pytest.mark.asyncio
+async def test_p99_with_slow_tail(mock_targets, mock_cache):
+    """Load fixture: one upstream call in twenty takes 500 ms instead of 20 ms.
+
+    Without hedging the slow calls set the P99; with a 50 ms hedge delay a
+    slow call only costs the delay plus a fast backup, unless both are slow.
+    """
+    async def p99(hedge):
+        tail = random.Random(7)
+        upstream = _upstream(lambda n: 0.5 if tail.random() < 0.05 else 0.02)
+
+        async def timed():
+            started = time.monotonic()
+            result = await _call(mock_targets, mock_cache, hedge=hedge)
+            assert result.success
+            return time.monotonic() - started
+
+        with patch.object(httpx.AsyncClient, "request", new=upstream):
+            latencies = sorted(await asyncio.gather(*(timed() for _ in range(200))))
+        return latencies[int(len(latencies) * 0.99) - 1]
+
+    baseline = await p99(None)
+    hedged = await p99(HEDGE)
+
+    assert baseline >= 0.5
+    assert hedged < baseline / 2
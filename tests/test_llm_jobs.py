@@ -0,0 +1,240 @@
+"""Tests for async LLM jobs and their signed webhook delivery."""
+import asyncio
+import hashlib
+import hmac
+import json
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.app import services
+from reliapi.app.schemas import LLMProxyRequest
+from reliapi.app.services import job_search, run_llm_job, submit_llm_job
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.jobs import JobStore
+from reliapi.core.webhooks import SIGNATURE_HEADER, deliver_webhook, make_event, sign_payload
+
+CALLBACK_URL = "https://hooks.example.com/reliapi"
+SECRET = "whsec_test"
+
+
+def _completion(request):
+    return httpx.Response(
+        200,
+        request=request,
+        json={
+            "choices": [{"message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}],
+            "usage": {"prompt_tokens": 10, "completion_tokens": 2},
+        },
+    )
+
+
+class Upstream:
+    """Answers LLM calls with a completion and webhooks with hook_status."""
+
+    def __init__(self, hook_status=(200,)):
+        self.hook_status = list(hook_status)
+        self.llm_calls = 0
+        self.hooks = []
+        self.mock = AsyncMock(side_effect=self.request)
+
+    async def request(self, method, url, **kwargs):
+        request = httpx.Request(method, str(url))
+        if str(url).startswith(CALLBACK_URL):
+            self.hooks.append(kwargs)
+            return httpx.Response(self.hook_status.pop(0), request=request)
+        self.llm_calls += 1
+        return _completion(request)
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def call_args():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    idempotency = Mock(spec=IdempotencyManager)
+    idempotency.register_request.return_value = (True, None, None)
+    idempotency.get_result.return_value = None
+    return dict(
+        fallbacks=[],
+        target_name="openai",
+        messages=[{"role": "user", "content": "Think hard"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        stream=False,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets={
+            "openai": {
+                "base_url": "https://api.openai.com/v1",
+                "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+            }
+        },
+        cache=cache,
+        idempotency=idempotency,
+        request_id="req_job",
+        tenant="acme",
+    )
+
+
+class TestJobStore:
+    """Test job records without Redis."""
+
+    def test_tenant_scoped(self):
+        jobs = JobStore()
+        job, created = jobs.create("acme", "hash")
+
+        assert created
+        assert jobs.get(job["job_id"], "acme")["status"] == "queued"
+        assert jobs.get(job["job_id"], "other") is None
+        assert jobs.get(job["job_id"], None) is None
+
+    def test_idempotency_key_returns_existing_job(self):
+        jobs = JobStore()
+        first, _ = jobs.create("acme", "hash", idempotency_key="report-1")
+        again, created = jobs.create("acme", "other-hash", idempotency_key="report-1")
+        elsewhere, elsewhere_created = jobs.create("globex", "hash", idempotency_key="report-1")
+
+        assert not created
+        assert again["job_id"] == first["job_id"]
+        assert again["request_hash"] == "hash"
+        assert elsewhere_created and elsewhere["job_id"] != first["job_id"]
+
+    def test_expired(self):
+        jobs = JobStore(ttl_s=0)
+        job, _ = jobs.create("acme", "hash")
+        assert jobs.get(job["job_id"], "acme") is None
+
+
+def test_signature():
+    payload = b'{"type": "job.completed"}'
+    expected = hmac.new(SECRET.encode(), b"1700000000." + payload, hashlib.sha256).hexdigest()
+    assert sign_payload(SECRET, payload, timestamp=1700000000) == f"t=1700000000,v1={expected}"
+
+
+@pytest.mark.asyncio
+async def test_job_result_delivered_signed(call_args):
+    jobs = JobStore()
+    job, _ = jobs.create("acme", "hash", callback_url=CALLBACK_URL)
+    upstream = Upstream()
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream.mock):
+        job = await run_llm_job(jobs, job, SECRET, **call_args)
+
+    stored = jobs.get(job["job_id"], "acme")
+    assert stored["status"] == "succeeded"
+    assert stored["result"]["data"]["content"] == "Hello"
+    assert stored["callback_delivered"] is True
+
+    hook = upstream.hooks[0]
+    timestamp = hook["headers"][SIGNATURE_HEADER].split(",")[0][2:]
+    assert hook["headers"][SIGNATURE_HEADER] == sign_payload(SECRET, hook["content"], int(timestamp))
+    event = json.loads(hook["content"])
+    assert event["type"] == "job.completed"
+    assert event["data"]["job_id"] == job["job_id"]
+    assert event["data"]["result"] == stored["result"]
+
+
+@pytest.mark.asyncio
+async def test_failed_job(call_args):
+    jobs = JobStore()
+    job, _ = jobs.create("acme", "hash")
+    call_args["target_name"] = "missing"
+
+    job = await run_llm_job(jobs, job, None, **call_args)
+
+    assert job["status"] == "failed"
+    assert job["result"]["error"]["code"] == "NOT_FOUND"
+    assert job["callback_delivered"] is None
+
+
+@pytest.mark.asyncio
+async def test_resubmission_runs_once(call_args):
+    jobs = JobStore()
+    call_args["idempotency_key"] = "report-1"
+    upstream = Upstream()
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream.mock):
+        first, created = submit_llm_job(jobs, "hash", None, None, **call_args)
+        again, created_again = submit_llm_job(jobs, "hash", None, None, **call_args)
+        await asyncio.gather(*services._running_jobs)
+
+    assert created and not created_again
+    assert again["job_id"] == first["job_id"]
+    assert upstream.llm_calls == 1
+    assert jobs.get(first["job_id"], "acme")["status"] == "succeeded"
+
+
+@pytest.mark.asyncio
+async def test_delivery_retries_server_errors():
+    upstream = Upstream(hook_status=(503, 200))
+    with patch.object(httpx.AsyncClient, "request", new=upstream.mock):
+        delivered = await deliver_webhook(CALLBACK_URL, make_event("job.completed", {}), SECRET, backoff_s=0)
+    assert delivered
+    assert len(upstream.hooks) == 2
+
+
+@pytest.mark.asyncio
+async def test_delivery_gives_up_on_client_errors():
+    upstream = Upstream(hook_status=(410, 200))
+    with patch.object(httpx.AsyncClient, "request", new=upstream.mock):
+        delivered = await deliver_webhook(CALLBACK_URL, make_event("job.completed", {}), SECRET, backoff_s=0)
+    assert not delivered
+    assert len(upstream.hooks) == 1
+
+
+def test_job_search_pages_through_a_tenant():
+    jobs = JobStore()
+    ids = [jobs.create("acme", "hash")[0]["job_id"] for _ in range(5)]
+    jobs.create("other", "hash")
+    warm, _ = jobs.create("acme", "hash")
+    jobs.update(warm, kind="cache_warm")
+    done, _ = jobs.create("acme", "hash")
+    jobs.update(done, status="succeeded")
+    ids.append(done["job_id"])
+
+    page = job_search(jobs, "acme", limit=2)
+    assert [j["job_id"] for j in page["jobs"]] == ids[:2]
+    # A cursor whose job expired since still continues after it
+    del jobs._memory[jobs._job_key(ids[1])]
+    page = job_search(jobs, "acme", limit=3, cursor=page["next_cursor"])
+    assert [j["job_id"] for j in page["jobs"]] == ids[2:5]
+    page = job_search(jobs, "acme", limit=3, cursor=page["next_cursor"])
+    assert [j["job_id"] for j in page["jobs"]] == ids[5:] and page["next_cursor"] is None
+
+    succeeded = job_search(jobs, "acme", status="succeeded")
+    assert [j["job_id"] for j in succeeded["jobs"]] == [done["job_id"]]
+
+
+def test_job_search_rejects_cursor_of_another_filter():
+    jobs = JobStore()
+    for _ in range(2):
+        jobs.create("acme", "hash")
+    cursor = job_search(jobs, "acme", limit=1)["next_cursor"]
+
+    with pytest.raises(ValueError):
+        job_search(jobs, "acme", status="queued", cursor=cursor)
+    with pytest.raises(ValueError):
+        job_search(jobs, "other", cursor=cursor)
+    with pytest.raises(ValueError):
+        job_search(jobs, "acme", cursor="not-a-cursor")
+
+
+def test_schema_rejects_streaming_callback():
+    with pytest.raises(ValueError):
+        LLMProxyRequest(
+            target="openai", messages=[{"role": "user", "content": "Hi"}], stream=True, callback_url=CALLBACK_URL
+        )
@@ -0,0 +1,147 @@
+"""Tests for image content parts in the LLM adapters, schema and cache keys."""
+import json
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.adapters.llm.anthropic import AnthropicAdapter
+from reliapi.adapters.llm.mistral import MistralAdapter
+from reliapi.adapters.llm.openai import OpenAIAdapter
+from reliapi.app import services
+from reliapi.app.schemas import LLMProxyRequest
+from reliapi.app.services import handle_llm_proxy, resolve_llm_cache_key
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+
+# The first 13 bytes of a PNG, with and without base64 padding
+PNG_PADDED = "data:image/png;base64,iVBORw0KGgoAAAANSQ=="
+PNG_UNPADDED = "data:image/png;base64,iVBORw0KGgoAAAANSQ"
+
+
+def _messages(image_url=PNG_PADDED):
+    return [{
+        "role": "user",
+        "content": [
+            {"type": "text", "text": "Which of these is the logo?"},
+            {"type": "image_url", "image_url": {"url": "https://example.com/logo.png", "detail": "low"}},
+            {"type": "image_url", "image_url": {"url": image_url}},
+        ],
+    }]
+
+
+class TestAdapters:
+    """Golden payloads for each provider's image format."""
+
+    def test_openai(self):
+        payload = OpenAIAdapter().prepare_request(messages=_messages(), model="gpt-4o-mini")
+        assert payload == {"model": "gpt-4o-mini", "messages": _messages()}
+
+    def test_anthropic(self):
+        payload = AnthropicAdapter().prepare_request(messages=_messages(), model="claude-3-haiku-20240307")
+        assert payload["messages"] == [{
+            "role": "user",
+            "content": [
+                {"type": "text", "text": "Which of these is the logo?"},
+                {"type": "image", "source": {"type": "url", "url": "https://example.com/logo.png"}},
+                {"type": "image", "source": {
+                    "type": "base64", "media_type": "image/png", "data": "iVBORw0KGgoAAAANSQ==",
+                }},
+            ],
+        }]
+
+    def test_mistral(self):
+        payload = MistralAdapter().prepare_request(messages=_messages(), model="pixtral-12b-2409")
+        assert payload["messages"][0]["content"][1:] == [
+            {"type": "image_url", "image_url": "https://example.com/logo.png"},
+            {"type": "image_url", "image_url": PNG_PADDED},
+        ]
+
+
+class TestSchema:
+    """Test LLMProxyRequest validation of content parts."""
+
+    def test_accepts_parts(self):
+        request = LLMProxyRequest(target="openai", messages=_messages())
+        assert request.messages == _messages()
+
+    @pytest.mark.parametrize("content", [
+        [],
+        [{"type": "audio", "audio": "x"}],
+        [{"type": "text", "text": 1}],
+        [{"type": "image_url", "image_url": {"url": "file:///etc/passwd"}}],
+        [{"type": "image_url", "image_url": {"url": "data:image/png,rawbytes"}}],
+        [{"type": "image_url", "image_url": {"url": PNG_PADDED, "detail": "max"}}],
+    ])
+    def test_rejects_invalid_parts(self, content):
+        with pytest.raises(ValueError):
+            LLMProxyRequest(target="openai", messages=[{"role": "user", "content": content}])
+
+    def test_parts_only_for_user_messages(self):
+        with pytest.raises(ValueError):
+            LLMProxyRequest(target="openai", messages=[{"role": "system", "content": _messages()[0]["content"]}])
+
+
+@pytest.mark.parametrize("provider", ["openai", "anthropic", "mistral"])
+@pytest.mark.parametrize("extra", [{}, {"cache_vary": ["messages"]}])
+def test_cache_key_hashes_image_bytes(provider, extra):
+    """Test that padding doesn't change the key, and the image does."""
+    targets = {"t": {"base_url": "https://llm.example.com", "llm": {"provider": provider, "default_model": "m"}}}
+
+    def key(image_url):
+        return resolve_llm_cache_key(
+            target_name="t",
+            messages=_messages(image_url),
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            targets=targets,
+            **extra,
+        )
+
+    assert key(PNG_PADDED) == key(PNG_UNPADDED)
+    assert key(PNG_PADDED) != key("data:image/png;base64,iVBORw0KGgoAAAAN")
+
+
+@pytest.mark.asyncio
+async def test_upstream_receives_image_data():
+    """Test that only the cache key hashes images, not the upstream body."""
+    services._circuit_breakers.clear()
+    targets = {"openai": {
+        "base_url": "https://api.openai.com/v1",
+        "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+    }}
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    upstream = AsyncMock(return_value=httpx.Response(
+        200, request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"), json={
+            "choices": [{"message": {"role": "assistant", "content": "The first"}, "finish_reason": "stop"}],
+            "usage": {"prompt_tokens": 90, "completion_tokens": 2},
+        },
+    ))
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_llm_proxy(
+            target_name="openai",
+            messages=_messages(),
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=targets,
+            cache=cache,
+            idempotency=Mock(spec=IdempotencyManager),
+            request_id="req_image",
+        )
+    services._circuit_breakers.clear()
+
+    assert result.success
+    assert json.loads(upstream.call_args.kwargs["content"])["messages"] == _messages()
+    assert PNG_PADDED not in cache.set.call_args.args[3].decode()
@@ -0,0 +1,215 @@
+"""Tests for validate_output: JSON Schema checks and repair of LLM completions."""
+import json
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.app import services
+from reliapi.app.schemas import LLMProxyRequest
+from reliapi.app.services import handle_llm_proxy, resolve_llm_cache_key
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.json_schema import validate_json_output
+
+WEATHER_SCHEMA = {
+    "type": "object",
+    "properties": {
+        "city": {"type": "string"},
+        "celsius": {"type": "number"},
+        "conditions": {"type": "array", "items": {"enum": ["sun", "rain", "snow"]}},
+    },
+    "required": ["city", "celsius"],
+    "additionalProperties": False,
+}
+
+
+def _completion(content, prompt_tokens=50, completion_tokens=10):
+    return httpx.Response(
+        200,
+        request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"),
+        json={
+            "choices": [{"message": {"role": "assistant", "content": content}, "finish_reason": "stop"}],
+            "usage": {"prompt_tokens": prompt_tokens, "completion_tokens": completion_tokens},
+        },
+    )
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_targets():
+    return {
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "cache": {"enabled": True, "ttl_s": 3600},
+            "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+        }
+    }
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+async def _call(targets, cache, responses, **kwargs):
+    upstream = AsyncMock(side_effect=responses)
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_llm_proxy(
+            target_name="openai",
+            messages=[{"role": "user", "content": "Weather in Berlin as JSON"}],
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=targets,
+            cache=cache,
+            idempotency=Mock(spec=IdempotencyManager),
+            request_id="req_validate",
+            output_schema=WEATHER_SCHEMA,
+            **kwargs,
+        )
+    return result, [json.loads(call.kwargs["content"]) for call in upstream.call_args_list]
+
+
+class TestJSONSchema:
+    """Test the validator on the keywords structured output uses."""
+
+    def test_valid(self):
+        value, errors = validate_json_output('{"city": "Berlin", "celsius": 12.5, "conditions": ["sun"]}', WEATHER_SCHEMA)
+        assert errors == []
+        assert value["celsius"] == 12.5
+
+    def test_violations_have_paths(self):
+        _, errors = validate_json_output('{"city": 1, "conditions": ["fog"], "wind": 3}', WEATHER_SCHEMA)
+        assert {e["path"] for e in errors} == {"$", "$.city", "$.conditions[0]", "$.wind"}
+
+    def test_not_json(self):
+        _, errors = validate_json_output("```json\n{}\n```", WEATHER_SCHEMA)
+        assert errors[0]["path"] == "$" and "not valid JSON" in errors[0]["message"]
+
+    def test_ref_and_combinators(self):
+        schema = {
+            "$defs": {"id": {"type": "integer", "minimum": 1}},
+            "type": "array",
+            "items": {"anyOf": [{"$ref": "#/$defs/id"}, {"type": "null"}]},
+        }
+        assert validate_json_output("[1, null]", schema)[1] == []
+        assert validate_json_output("[0, true]", schema)[1] != []
+
+
+class TestSchema:
+    """Test LLMProxyRequest validation of the output fields."""
+
+    def test_requires_schema(self):
+        with pytest.raises(ValueError):
+            LLMProxyRequest(target="openai", messages=[{"role": "user", "content": "Hi"}], validate_output=True)
+
+    @pytest.mark.parametrize("schema", [{"type": "str"}, {"$ref": "#/$defs/missing"}, {"pattern": "("}])
+    def test_rejects_unusable_schema(self, schema):
+        with pytest.raises(ValueError):
+            LLMProxyRequest(
+                target="openai", messages=[{"role": "user", "content": "Hi"}],
+                output_schema=schema, validate_output=True,
+            )
+
+    def test_schema_ignored_without_validate_output(self):
+        request = LLMProxyRequest(
+            target="openai", messages=[{"role": "user", "content": "Hi"}], output_schema=WEATHER_SCHEMA
+        )
+        assert request.output_args() == {"output_schema": None, "repair_attempts": 0}
+
+
+@pytest.mark.asyncio
+async def test_valid_output_cached(mock_targets, mock_cache):
+    result, sent = await _call(mock_targets, mock_cache, [_completion('{"city": "Berlin", "celsius": 12}')])
+
+    assert result.success
+    assert len(sent) == 1
+    assert result.meta.validation_attempts == 1
+    assert result.meta.output_valid is True
+    mock_cache.set.assert_called_once()
+
+
+@pytest.mark.asyncio
+async def test_invalid_output_fails_uncached(mock_targets, mock_cache):
+    result, _ = await _call(mock_targets, mock_cache, [_completion('{"city": "Berlin"}')])
+
+    assert not result.success
+    assert result.error.code == "OUTPUT_VALIDATION_FAILED"
+    assert result.error.status_code == 422
+    assert result.error.details["errors"] == [{"path": "$", "message": "missing required property 'celsius'"}]
+    assert result.error.details["content"] == '{"city": "Berlin"}'
+    assert result.meta.validation_attempts == 1
+    assert result.meta.output_valid is False
+    assert result.meta.cost_usd > 0
+    mock_cache.set.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_repair(mock_targets, mock_cache):
+    """Test that the model is re-prompted with the violations and every attempt is billed."""
+    result, sent = await _call(
+        mock_targets,
+        mock_cache,
+        [_completion("Sure! It's 12C."), _completion('{"city": "Berlin", "celsius": 12}', prompt_tokens=70)],
+        repair_attempts=2,
+    )
+
+    assert result.success
+    assert len(sent) == 2
+    repair = sent[1]["messages"]
+    assert repair[1] == {"role": "assistant", "content": "Sure! It's 12C."}
+    assert "not valid JSON" in repair[2]["content"]
+    assert result.data["content"] == '{"city": "Berlin", "celsius": 12}'
+    assert result.data["usage"]["prompt_tokens"] == 120
+    assert result.meta.validation_attempts == 2
+    assert mock_cache.set.call_args.args[4]["body"]["content"] == result.data["content"]
+
+
+@pytest.mark.asyncio
+async def test_repair_attempts_exhausted(mock_targets, mock_cache):
+    result, sent = await _call(
+        mock_targets, mock_cache, [_completion("no"), _completion('{"city": 1, "celsius": 2}')], repair_attempts=1
+    )
+
+    assert len(sent) == 2
+    assert result.error.code == "OUTPUT_VALIDATION_FAILED"
+    assert result.error.details["attempts"] == 2
+    assert result.error.details["errors"][0]["path"] == "$.city"
+    mock_cache.set.assert_not_called()
+
+
+def test_schema_in_cache_key(mock_targets):
+    """Test that validated output is never served to a request with another schema, or none."""
+    request = dict(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Weather in Berlin as JSON"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        targets=mock_targets,
+        cache_key="weather",
+    )
+    keys = {
+        resolve_llm_cache_key(**request),
+        resolve_llm_cache_key(**request, output_schema=WEATHER_SCHEMA),
+        resolve_llm_cache_key(**request, output_schema={"type": "object"}),
+    }
+    assert len(keys) == 3
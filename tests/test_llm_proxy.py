@@ -1,9 +1,18 @@
 """Tests for app/services.py handle_llm_proxy."""
+import json
+
+import httpx
 import pytest
 from unittest.mock import Mock, AsyncMock, patch
 
-from reliapi.app.services import handle_llm_proxy
-from reliapi.app.schemas import SuccessResponse, ErrorResponse
+from reliapi.app import services
+from reliapi.app.services import (
+    handle_llm_batch,
+    handle_llm_proxy,
+    handle_llm_proxy_with_fallbacks,
+    resolve_llm_cache_key,
+)
+from reliapi.app.schemas import ErrorDetail, ErrorResponse, MetaResponse, SuccessResponse
 from reliapi.core.cache import Cache
 from reliapi.core.idempotency import IdempotencyManager
 
@@ -80,6 +89,72 @@ async def test_llm_proxy_budget_cap_rejection(mock_targets, mock_cache, mock_ide
         assert result.meta.cost_policy_applied == "hard_cap_rejected"
 
 
+@pytest.mark.asyncio
+async def test_llm_proxy_max_cost_rejection(mock_targets, mock_cache, mock_idempotency):
+    """Test that an estimate above max_cost_usd is rejected with the estimate."""
+    with patch("reliapi.app.services.CostEstimator") as mock_cost:
+        mock_cost.estimate_from_messages.return_value = 0.02
+
+        result = await handle_llm_proxy(
+            target_name="openai",
+            messages=[{"role": "user", "content": "Hello"}],
+            model=None,
+            max_tokens=500,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=mock_targets,
+            cache=mock_cache,
+            idempotency=mock_idempotency,
+            request_id="test-123",
+            tenant=None,
+            max_cost_usd=0.019,
+        )
+
+        assert isinstance(result, ErrorResponse)
+        assert result.error.code == "BUDGET_EXCEEDED"
+        assert result.error.details["cost_estimate_usd"] == 0.02
+        assert result.error.details["max_cost_usd"] == 0.019
+        assert result.error.details["max_tokens"] == 500
+        assert result.meta.cost_policy_applied == "max_cost_rejected"
+
+
+def test_budget_rejection_boundaries():
+    """Test that an estimate exactly at a ceiling passes and just above it fails."""
+    services._budget_ledger.reset()
+    try:
+        assert services._budget_rejection(0.02, 0.02, None, None) is None
+        assert services._budget_rejection(0.020001, 0.02, None, None)[0] == "max_cost_rejected"
+        assert services._budget_rejection(None, 0.0, 0.0, None) is None
+
+        services._budget_ledger.record("acme", 0.75)
+        assert services._budget_rejection(0.25, None, 1.0, "acme") is None
+        policy, _, details = services._budget_rejection(0.26, None, 1.0, "acme")
+        assert policy == "budget_rejected"
+        assert details["spent_usd"] == 0.75
+        assert details["cost_estimate_usd"] == 0.26
+        # Spend is tracked per tenant
+        assert services._budget_rejection(0.26, None, 1.0, "other") is None
+    finally:
+        services._budget_ledger.reset()
+
+
+def test_budget_ledger_resets_monthly():
+    """Test that spend resets at the start of the next month (UTC)."""
+    from datetime import datetime, timezone
+
+    from reliapi.core.budget import BudgetLedger, month_bounds
+
+    ledger = BudgetLedger()
+    ledger.record(None, 1.5, datetime(2026, 12, 31, 23, 59, tzinfo=timezone.utc))
+    assert ledger.spent(None, datetime(2026, 12, 31, 23, 59, 59, tzinfo=timezone.utc)) == 1.5
+    assert ledger.spent(None, datetime(2027, 1, 1, tzinfo=timezone.utc)) == 0.0
+    assert month_bounds(datetime(2026, 12, 5, tzinfo=timezone.utc))[1] == datetime(2027, 1, 1, tzinfo=timezone.utc)
+
+
 @pytest.mark.asyncio
 async def test_llm_proxy_target_not_found(mock_cache, mock_idempotency):
     """Test error when target is not found."""
@@ -104,3 +179,742 @@ async def test_llm_proxy_target_not_found(mock_cache, mock_idempotency):
     assert isinstance(result, ErrorResponse)
     assert result.error.code == "NOT_FOUND"
 
+
+
+@pytest.fixture
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+def _call_llm(targets, cache, idempotency, target_name="openai", model=None):
+    return handle_llm_proxy(
+        target_name=target_name,
+        messages=[{"role": "user", "content": "Hello"}],
+        model=model,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        stream=False,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=idempotency,
+        request_id="test-123",
+        tenant=None,
+    )
+
+
+@pytest.mark.asyncio
+async def test_llm_proxy_circuit_opens_across_requests(
+    mock_targets, mock_cache, mock_idempotency, fresh_circuit_breakers, monkeypatch
+):
+    """Test that upstream failures of separate requests open the target's circuit."""
+    monkeypatch.setenv("OPENAI_API_KEY", "sk-test")
+    mock_targets["openai"]["circuit"] = {"error_threshold": 2, "cooldown_s": 60}
+    upstream = AsyncMock(
+        return_value=httpx.Response(
+            503,
+            request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"),
+            json={"error": {"message": "overloaded"}},
+        )
+    )
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        first = await _call_llm(mock_targets, mock_cache, mock_idempotency)
+        second = await _call_llm(mock_targets, mock_cache, mock_idempotency)
+        third = await _call_llm(mock_targets, mock_cache, mock_idempotency)
+
+    assert not first.success and not second.success
+    assert first.error.code != "CIRCUIT_OPEN"
+    assert isinstance(third, ErrorResponse)
+    assert third.error.code == "CIRCUIT_OPEN"
+    assert third.error.status_code == 503
+    # The open circuit fails fast without reaching the upstream
+    assert upstream.await_count == 2
+
+
+@pytest.mark.asyncio
+async def test_model_scoped_circuit_opens_only_for_the_failing_model(
+    mock_targets, mock_cache, mock_idempotency, fresh_circuit_breakers, monkeypatch
+):
+    """Test that failures of one model open its breaker while another model keeps working."""
+    monkeypatch.setenv("OPENAI_API_KEY", "sk-test")
+    mock_targets["openai"]["circuit"] = {"error_threshold": 2, "cooldown_s": 60, "scope": "model"}
+    calls = []
+
+    async def upstream(**kwargs):
+        model = json.loads(kwargs["content"])["model"]
+        calls.append(model)
+        request = httpx.Request("POST", "https://api.openai.com/v1/chat/completions")
+        if model == "gpt-4o":
+            return httpx.Response(503, request=request, json={"error": {"message": "overloaded"}})
+        return httpx.Response(
+            200,
+            request=request,
+            json={
+                "choices": [{"message": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"}],
+                "usage": {"prompt_tokens": 10, "completion_tokens": 2},
+            },
+        )
+
+    with patch.object(httpx.AsyncClient, "request", new=AsyncMock(side_effect=upstream)):
+        failing = [await _call_llm(mock_targets, mock_cache, mock_idempotency, model="gpt-4o") for _ in range(3)]
+        working = [await _call_llm(mock_targets, mock_cache, mock_idempotency, model="gpt-4o-mini") for _ in range(2)]
+
+    assert failing[2].error.code == "CIRCUIT_OPEN"
+    assert failing[2].meta.circuit_key == "openai:model=gpt-4o"
+    assert all(result.success for result in working)
+    assert working[0].meta.circuit_key == "openai:model=gpt-4o-mini"
+    assert calls == ["gpt-4o", "gpt-4o", "gpt-4o-mini", "gpt-4o-mini"]
+
+    status = services.circuit_status("openai", mock_targets["openai"])
+    assert status["state"] == "open" and status["scope"] == "model"
+    breakers = {b["key"]: b["state"] for b in status["breakers"]}
+    assert breakers == {"openai": "closed", "openai:model=gpt-4o": "open", "openai:model=gpt-4o-mini": "closed"}
+
+    services.reset_circuit("openai", mock_targets["openai"])
+    assert services.circuit_status("openai", mock_targets["openai"])["state"] == "closed"
+
+
+def test_credential_scoped_circuit_is_open_when_every_credential_is(mock_targets, fresh_circuit_breakers):
+    """Test that a credential scope keeps a target usable while one credential works."""
+    target = {
+        **mock_targets["openai"],
+        "circuit": {"error_threshold": 1, "cooldown_s": 60, "scope": "credential"},
+        "credentials": [{"name": "primary", "api_key": "sk-1"}, {"name": "backup", "api_key": "sk-2"}],
+    }
+    breaker = services.get_circuit_breaker("openai", target["circuit"])
+    breaker.record_failure("https://api.openai.com/v1#credential=primary")
+    assert not services.circuit_open("openai", target)
+
+    breaker.record_failure("https://api.openai.com/v1#credential=backup")
+    assert services.circuit_open("openai", target)
+
+
+@pytest.mark.asyncio
+async def test_fallback_skips_a_leg_whose_model_circuit_is_open(
+    mock_targets, mock_cache, mock_idempotency, fresh_circuit_breakers
+):
+    """Test that a fallback leg is skipped while the breaker of its model is open."""
+    mock_targets["anthropic"] = {
+        "base_url": "https://api.anthropic.com/v1",
+        "circuit": {"error_threshold": 1, "cooldown_s": 60, "scope": "model"},
+        "llm": {"provider": "anthropic", "default_model": "claude-3-haiku"},
+    }
+    breaker = services.get_circuit_breaker("anthropic", mock_targets["anthropic"]["circuit"])
+    breaker.record_failure("https://api.anthropic.com/v1#model=claude-3-opus")
+    served = []
+
+    async def handle(**kwargs):
+        served.append((kwargs["target_name"], kwargs["model"]))
+        if kwargs["target_name"] == "openai":
+            return _llm_error("openai", 503, "UPSTREAM_5XX")
+        return _llm_success(kwargs["target_name"])
+
+    with patch("reliapi.app.services.handle_llm_proxy", side_effect=handle):
+        result = await handle_llm_proxy_with_fallbacks(
+            fallbacks=[
+                {"target": "anthropic", "model": "claude-3-opus"},
+                {"target": "anthropic", "model": None},
+            ],
+            target_name="openai",
+            messages=[{"role": "user", "content": "Hello"}],
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=mock_targets,
+            cache=mock_cache,
+            idempotency=mock_idempotency,
+            request_id="test-123",
+            tenant=None,
+            tier="developer",
+        )
+
+    # claude-3-opus is skipped; the target's default model still serves
+    assert served == [("openai", None), ("anthropic", None)]
+    assert result.meta.served_by == "anthropic"
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize(
+    "extra",
+    [
+        {},
+        {"cache_vary": ["messages"]},
+        {"requested_target": "anthropic", "cache_key": "greeting"},
+        {"raw_passthrough": True},
+    ],
+)
+async def test_resolve_llm_cache_key_matches_proxy(
+    extra, mock_targets, mock_cache, mock_idempotency, fresh_circuit_breakers, monkeypatch
+):
+    """Test that the cache key resolver agrees with a real handle_llm_proxy run."""
+    monkeypatch.setenv("OPENAI_API_KEY", "sk-test")
+    # Soft cap throttling changes the upstream payload and so the key
+    mock_targets["openai"]["llm"]["soft_cost_cap_usd"] = 1e-9
+    upstream = AsyncMock(
+        return_value=httpx.Response(
+            200,
+            request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"),
+            json={
+                "choices": [{"message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}],
+                "usage": {"prompt_tokens": 3, "completion_tokens": 1},
+            },
+        )
+    )
+    request = dict(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Hello"}],
+        model=None,
+        max_tokens=512,
+        temperature=0.2,
+        top_p=None,
+        stop=None,
+    )
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_llm_proxy(
+            **request,
+            **extra,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=mock_targets,
+            cache=mock_cache,
+            idempotency=mock_idempotency,
+            request_id="test-123",
+            tenant=None,
+        )
+
+    assert isinstance(result, SuccessResponse)
+    assert result.meta.cost_policy_applied == "soft_cap_throttled"
+    assert result.meta.cache_key
+    assert resolve_llm_cache_key(**request, **extra, targets=mock_targets) == result.meta.cache_key
+
+
+def _llm_error(target, status_code, code):
+    return ErrorResponse(
+        success=False,
+        error=ErrorDetail(
+            type="upstream_error",
+            code=code,
+            message="failed",
+            retryable=status_code >= 500 or status_code == 429,
+            target=target,
+            status_code=status_code,
+        ),
+        meta=MetaResponse(target=target, duration_ms=1, request_id="test-123"),
+    )
+
+
+def _llm_success(target):
+    return SuccessResponse(
+        success=True,
+        data={"content": "hi", "role": "assistant", "finish_reason": "stop"},
+        meta=MetaResponse(target=target, duration_ms=1, request_id="test-123", cost_usd=0.001),
+    )
+
+
+@pytest.mark.asyncio
+async def test_llm_proxy_fallback_on_circuit_open(mock_cache, mock_idempotency):
+    """Test that a client fallback serves the request when the primary is unavailable."""
+    calls = []
+
+    async def fake_handle(**kwargs):
+        calls.append(kwargs)
+        if kwargs["target_name"] == "openai":
+            return _llm_error("openai", 503, "CIRCUIT_OPEN")
+        return _llm_success(kwargs["target_name"])
+
+    with patch("reliapi.app.services.handle_llm_proxy", side_effect=fake_handle):
+        result = await handle_llm_proxy_with_fallbacks(
+            fallbacks=[{"target": "anthropic", "model": "claude-3-haiku"}],
+            target_name="openai",
+            model=None,
+            idempotency_key="key-1",
+            cache_ttl=None,
+            cache=mock_cache,
+            idempotency=mock_idempotency,
+            tenant=None,
+            tier="developer",
+        )
+
+    assert isinstance(result, SuccessResponse)
+    assert result.meta.served_by == "anthropic"
+    assert result.meta.fallback_used is True
+    assert calls[1]["model"] == "claude-3-haiku"
+    assert calls[1]["idempotency_key"] == "key-1:fallback:anthropic"
+    assert calls[1]["requested_target"] == "openai"
+    # The fallback answer is replayed for retries of the original key
+    stored_key, stored = mock_idempotency.store_result.call_args[0]
+    assert stored_key == "key-1"
+    assert stored["served_by"] == "anthropic"
+
+
+@pytest.mark.asyncio
+async def test_llm_proxy_fallback_on_real_open_circuit(
+    mock_targets, mock_cache, mock_idempotency, fresh_circuit_breakers, monkeypatch
+):
+    """Test that the primary's own CIRCUIT_OPEN answer triggers the fallback."""
+    monkeypatch.setenv("OPENAI_API_KEY", "sk-test")
+    breaker = services.get_circuit_breaker("openai", mock_targets["openai"]["circuit"])
+    for _ in range(breaker.failures_to_open):
+        breaker.record_failure(mock_targets["openai"]["base_url"])
+
+    real_handle = services.handle_llm_proxy
+    served = []
+
+    async def primary_real_fallback_stub(**kwargs):
+        served.append(kwargs["target_name"])
+        if kwargs["target_name"] == "openai":
+            return await real_handle(**kwargs)
+        return _llm_success(kwargs["target_name"])
+
+    upstream = AsyncMock()
+    with patch.object(httpx.AsyncClient, "request", new=upstream), patch(
+        "reliapi.app.services.handle_llm_proxy", side_effect=primary_real_fallback_stub
+    ):
+        result = await handle_llm_proxy_with_fallbacks(
+            fallbacks=[{"target": "anthropic", "model": "claude-3-haiku"}],
+            target_name="openai",
+            messages=[{"role": "user", "content": "Hello"}],
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=mock_targets,
+            cache=mock_cache,
+            idempotency=mock_idempotency,
+            request_id="test-123",
+            tenant=None,
+            tier="developer",
+        )
+
+    assert served == ["openai", "anthropic"]
+    upstream.assert_not_awaited()
+    assert isinstance(result, SuccessResponse)
+    assert result.meta.served_by == "anthropic"
+    assert result.meta.fallback_used is True
+
+
+@pytest.mark.asyncio
+async def test_llm_proxy_fallback_skipped_on_client_error(mock_cache, mock_idempotency):
+    """Test that 4xx errors such as budget rejections never fall through."""
+    calls = []
+
+    async def fake_handle(**kwargs):
+        calls.append(kwargs)
+        return _llm_error(kwargs["target_name"], 400, "BUDGET_EXCEEDED")
+
+    with patch("reliapi.app.services.handle_llm_proxy", side_effect=fake_handle):
+        result = await handle_llm_proxy_with_fallbacks(
+            fallbacks=[{"target": "anthropic", "model": None}],
+            target_name="openai",
+            idempotency_key=None,
+            idempotency=mock_idempotency,
+            tier="developer",
+        )
+
+    assert isinstance(result, ErrorResponse)
+    assert result.error.code == "BUDGET_EXCEEDED"
+    assert len(calls) == 1
+
+
+@pytest.mark.asyncio
+async def test_static_fallback_after_the_chain_fails(mock_cache, mock_idempotency):
+    """Test that a fallback_response stands in for a chain that failed, at no cost."""
+    calls = []
+
+    async def fake_handle(**kwargs):
+        calls.append(kwargs["target_name"])
+        return _llm_error(kwargs["target_name"], 503, "CIRCUIT_OPEN")
+
+    targets = {"openai": {"fallback_response": {"content": "The assistant is busy.", "finish_reason": "stop"}}}
+    with patch("reliapi.app.services.handle_llm_proxy", side_effect=fake_handle):
+        result = await handle_llm_proxy_with_fallbacks(
+            fallbacks=[{"target": "anthropic", "model": None}],
+            target_name="openai",
+            idempotency_key="key-1",
+            targets=targets,
+            cache=mock_cache,
+            idempotency=mock_idempotency,
+            tier="developer",
+        )
+        # A request's own fallback_response wins over the target's
+        overridden = await handle_llm_proxy_with_fallbacks(
+            fallbacks=None,
+            fallback_response={"content": "Try again later."},
+            target_name="openai",
+            targets=targets,
+            idempotency=mock_idempotency,
+        )
+
+    assert calls == ["openai", "anthropic", "openai"]
+    assert isinstance(result, SuccessResponse)
+    assert result.data["content"] == "The assistant is busy."
+    assert result.data["usage"]["total_tokens"] == 0
+    assert result.meta.fallback_served is True
+    assert result.meta.cost_usd == 0.0
+    assert result.meta.upstream_error.code == "CIRCUIT_OPEN"
+    assert result.meta.upstream_error.target == "anthropic"
+    # Neither cached nor replayed for the idempotency key
+    mock_cache.set.assert_not_called()
+    mock_idempotency.store_result.assert_not_called()
+    assert overridden.data["content"] == "Try again later."
+    assert overridden.data["finish_reason"] == "stop"
+
+
+@pytest.mark.asyncio
+async def test_static_fallback_not_served_for_client_errors(mock_idempotency):
+    """Test that 4xx errors are returned as they are, not masked by the fallback_response."""
+
+    async def fake_handle(**kwargs):
+        return _llm_error(kwargs["target_name"], 400, "BUDGET_EXCEEDED")
+
+    with patch("reliapi.app.services.handle_llm_proxy", side_effect=fake_handle):
+        result = await handle_llm_proxy_with_fallbacks(
+            fallbacks=None,
+            fallback_response={"content": "The assistant is busy."},
+            target_name="openai",
+            idempotency=mock_idempotency,
+        )
+
+    assert isinstance(result, ErrorResponse)
+    assert result.error.code == "BUDGET_EXCEEDED"
+
+
+@pytest.mark.asyncio
+async def test_llm_batch_preserves_order_and_aggregates_cost():
+    """Test that batch results keep request order and report per-item and total cost."""
+
+    async def fake_handle(**kwargs):
+        if kwargs["target_name"] == "broken":
+            return _llm_error("broken", 503, "SERVER_ERROR")
+        return _llm_success(kwargs["target_name"])
+
+    items = [{"target_name": name, "fallbacks": []} for name in ("openai", "broken", "anthropic")]
+    with patch("reliapi.app.services.handle_llm_proxy_with_fallbacks", side_effect=fake_handle):
+        batch = await handle_llm_batch(
+            items=items, max_parallel=2, fail_fast=False, request_id="req_batch"
+        )
+
+    assert [r.index for r in batch.results] == [0, 1, 2]
+    assert [r.success for r in batch.results] == [True, False, True]
+    assert batch.results[1].error.code == "SERVER_ERROR"
+    assert batch.meta.succeeded == 2 and batch.meta.failed == 1
+    assert batch.meta.cost_usd == pytest.approx(0.002)
+    assert batch.success is False
+
+
+@pytest.mark.asyncio
+async def test_llm_batch_fail_fast_aborts_pending_items():
+    """Test that fail_fast skips items that had not started."""
+    calls = []
+
+    async def fake_handle(**kwargs):
+        calls.append(kwargs["target_name"])
+        return _llm_error(kwargs["target_name"], 503, "SERVER_ERROR")
+
+    items = [{"target_name": f"t{i}", "fallbacks": []} for i in range(3)]
+    with patch("reliapi.app.services.handle_llm_proxy_with_fallbacks", side_effect=fake_handle):
+        batch = await handle_llm_batch(
+            items=items, max_parallel=1, fail_fast=True, request_id="req_batch"
+        )
+
+    assert calls == ["t0"]
+    assert [r.error.code for r in batch.results] == ["SERVER_ERROR", "BATCH_ABORTED", "BATCH_ABORTED"]
+    assert batch.meta.aborted == 2
+
+
+def test_estimate_llm_cost_matches_recorded_costs():
+    """Test that estimates bracket the actual cost of recorded responses."""
+    import json
+    import os
+
+    from reliapi.app.services import estimate_llm_cost
+
+    targets = {
+        "openai": {"base_url": "https://api.openai.com/v1", "llm": {"provider": "openai"}},
+        "mistral": {"base_url": "https://api.mistral.ai/v1", "llm": {"provider": "mistral"}},
+    }
+    # Shared with the Go client's tests, which replay sample["estimate"]
+    path = os.path.join(os.path.dirname(__file__), "..", "reliapi", "testdata", "cost_samples.json")
+    with open(path) as f:
+        samples = json.load(f)
+
+    for sample in samples:
+        request = sample["request"]
+        usage = sample["response"]["data"]["usage"]
+        actual_cost = sample["response"]["meta"]["cost_usd"]
+
+        estimate = estimate_llm_cost(
+            request["target"], targets[request["target"]], request["messages"], request["model"], request["max_tokens"]
+        )
+
+        assert estimate == pytest.approx(sample["estimate"]), sample["name"]
+        assert abs(estimate["prompt_tokens"] - usage["prompt_tokens"]) <= 0.2 * usage["prompt_tokens"], sample["name"]
+        assert estimate["cost_min_usd"] * 0.8 <= actual_cost <= estimate["cost_max_usd"], sample["name"]
+
+
+def test_estimate_llm_cost_without_pricing():
+    """Test that a model without pricing has no cost range."""
+    from reliapi.app.services import estimate_llm_cost
+
+    target = {"base_url": "https://api.openai.com/v1", "llm": {"provider": "openai", "max_tokens": 256}}
+    estimate = estimate_llm_cost("openai", target, [{"role": "user", "content": "Hi"}], "unpriced-model", None)
+
+    assert estimate["max_completion_tokens"] == 256
+    assert estimate["prompt_tokens"] > 0
+    assert estimate["cost_min_usd"] is None
+    assert estimate["cost_max_usd"] is None
+
+
+def test_replay_chunks_join_to_the_completion():
+    """Test that replay chunks hold chunk_tokens words and join back to the content."""
+    from reliapi.app.services import _replay_chunks
+
+    assert _replay_chunks("one two three\n", 2) == ["one two", " three\n"]
+    assert _replay_chunks("one two three", 0) == ["one two three"]
+    assert _replay_chunks("", 2) == []
+
+
+@pytest.mark.asyncio
+async def test_stream_replays_entry_of_plain_request(mock_targets, mock_cache, mock_idempotency):
+    """Test that a stream is served from the entry a plain request would use, at no cost."""
+    import json
+    from reliapi.app.services import handle_llm_stream_generator
+
+    mock_targets["openai"]["cache"]["stream_replay_chunk_tokens"] = 2
+    mock_cache.get.return_value = {
+        "body": {
+            "content": "one two three",
+            "role": "assistant",
+            "finish_reason": "stop",
+            "usage": {"prompt_tokens": 3, "completion_tokens": 3, "total_tokens": 6},
+        },
+        "cost_usd": 0.01,
+    }
+    request = dict(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Hello"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+    )
+
+    events = []
+    async for event in handle_llm_stream_generator(
+        **request,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=mock_targets,
+        cache=mock_cache,
+        idempotency=mock_idempotency,
+        request_id="test-123",
+    ):
+        name = event.split("event: ")[1].split("\n")[0]
+        events.append((name, json.loads(event.split("data: ")[1])))
+
+    assert [name for name, _ in events] == ["meta", "chunk", "chunk", "done"]
+    assert events[0][1]["cache_key"] == resolve_llm_cache_key(**request, targets=mock_targets)
+    assert "".join(data["delta"] for name, data in events if name == "chunk") == "one two three"
+    assert events[-1][1]["cache_hit"] is True
+    assert events[-1][1]["cost_usd"] == 0.0
+    assert events[-1][1]["usage"]["total_tokens"] == 6
+    mock_idempotency.mark_in_progress.assert_not_called()
+
+
+def _streaming_adapter(chunks):
+    """An OpenAI adapter whose upstream stream yields chunks."""
+    from reliapi.adapters.llm.openai import OpenAIAdapter
+
+    adapter = OpenAIAdapter()
+
+    async def stream_chat(*args, **kwargs):
+        for chunk in chunks:
+            yield chunk
+
+    adapter.stream_chat = stream_chat
+    return adapter
+
+
+def _content_chunk(text):
+    return {"choices": [{"delta": {"content": text}, "finish_reason": None}]}
+
+
+async def _stream_events(mock_targets, mock_cache, mock_idempotency, adapter, **kwargs):
+    import json
+    from reliapi.app.services import handle_llm_stream_generator
+
+    events = []
+    with patch("reliapi.app.services.get_adapter", return_value=adapter):
+        async for event in handle_llm_stream_generator(
+            target_name="openai",
+            messages=[{"role": "user", "content": "Hello"}],
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=mock_targets,
+            cache=mock_cache,
+            idempotency=mock_idempotency,
+            request_id="test-123",
+            **kwargs,
+        ):
+            name = event.split("event: ")[1].split("\n")[0]
+            events.append((name, json.loads(event.split("data: ")[1])))
+    return events
+
+
+@pytest.mark.asyncio
+async def test_stream_cost_from_usage_frame(mock_targets, mock_cache, mock_idempotency):
+    """Test that the done event bills the provider's usage frame."""
+    adapter = _streaming_adapter([
+        _content_chunk("Hi there"),
+        {"_usage_only": True, "usage": {"prompt_tokens": 12, "completion_tokens": 2}},
+    ])
+
+    events = await _stream_events(mock_targets, mock_cache, mock_idempotency, adapter)
+
+    done = events[-1][1]
+    assert events[-1][0] == "done"
+    assert done["usage"] == {"prompt_tokens": 12, "completion_tokens": 2, "total_tokens": 14}
+    assert done["cost_usd"] == adapter.get_cost_usd("gpt-4o-mini", 12, 2)
+    assert done["cost_estimated"] is False
+
+
+@pytest.mark.asyncio
+async def test_stream_cost_estimated_without_usage(mock_targets, mock_cache, mock_idempotency):
+    """Test that a stream without usage frames is billed from estimated counts."""
+    from reliapi.core.cost_estimator import CostEstimator
+
+    adapter = _streaming_adapter([_content_chunk("Hi there")])
+
+    events = await _stream_events(mock_targets, mock_cache, mock_idempotency, adapter)
+
+    done = events[-1][1]
+    assert done["cost_estimated"] is True
+    assert done["usage"]["prompt_tokens"] == CostEstimator.count_tokens([{"role": "user", "content": "Hello"}], "gpt-4o-mini")
+    assert done["usage"]["completion_tokens"] == CostEstimator.count_text_tokens("Hi there", "gpt-4o-mini")
+    assert done["cost_usd"] > 0
+
+
+@pytest.mark.asyncio
+async def test_aborted_stream_charges_tokens_generated(mock_targets, mock_cache, mock_idempotency):
+    """Test that a stream the client abandons is recorded with the tokens streamed so far."""
+    from reliapi.app.services import handle_llm_stream_generator
+
+    adapter = _streaming_adapter([
+        {"_usage_only": True, "usage": {"prompt_tokens": 12}},
+        _content_chunk("Hi there"),
+        _content_chunk(" and more"),
+    ])
+    with patch("reliapi.app.services.get_adapter", return_value=adapter), patch(
+        "reliapi.app.services._record_stream_usage"
+    ) as record:
+        events = handle_llm_stream_generator(
+            target_name="openai",
+            messages=[{"role": "user", "content": "Hello"}],
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=mock_targets,
+            cache=mock_cache,
+            idempotency=mock_idempotency,
+            request_id="test-123",
+            api_key="sk-test",
+        )
+        async for event in events:
+            if event.startswith("id: 0\n"):
+                break
+        await events.aclose()
+
+    data = record.call_args.args[0]
+    assert data["aborted"] is True
+    assert data["cost_estimated"] is True
+    assert data["usage"]["prompt_tokens"] == 12
+    assert data["usage"]["completion_tokens"] > 0
+    assert record.call_args.args[4] == "sk-test"
+
+
+@pytest.mark.asyncio
+async def test_meta_reports_whether_the_response_was_cached(mock_targets, mock_cache, mock_idempotency, monkeypatch):
+    """Test that meta.cache_stored tells whether the cache admitted the response."""
+    monkeypatch.setenv("OPENAI_API_KEY", "sk-test")
+    mock_targets["openai"]["cache"]["max_entries"] = 500
+    upstream = AsyncMock(
+        return_value=httpx.Response(
+            200,
+            request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"),
+            json={
+                "choices": [{"message": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"}],
+                "usage": {"prompt_tokens": 10, "completion_tokens": 2},
+            },
+        )
+    )
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        mock_cache.set.return_value = True
+        stored = await _call_llm(mock_targets, mock_cache, mock_idempotency)
+        # Too large for every cache tier
+        mock_cache.set.return_value = False
+        refused = await _call_llm(mock_targets, mock_cache, mock_idempotency)
+
+    assert stored.meta.cache_stored is True
+    assert refused.meta.cache_stored is False
+    assert mock_cache.set.call_args.kwargs["max_entries"] == 500
+
+
+@pytest.mark.asyncio
+async def test_raw_passthrough_keeps_the_provider_body(mock_targets, mock_cache, mock_idempotency, monkeypatch):
+    """Test that raw_passthrough caches the provider's bytes under a key of their own."""
+    monkeypatch.setenv("OPENAI_API_KEY", "sk-test")
+    body = (
+        b'{"id": "chatcmpl-9",  "choices": [{"message": {"role": "assistant", "content": "Hi"}, '
+        b'"finish_reason": "stop", "logprobs": null}], "usage": {"prompt_tokens": 10, "completion_tokens": 2}}'
+    )
+    upstream = AsyncMock(return_value=httpx.Response(
+        200, request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"), content=body
+    ))
+    request = dict(
+        target_name="openai", messages=[{"role": "user", "content": "Hello"}],
+        model=None, max_tokens=None, temperature=None, top_p=None, stop=None,
+    )
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_llm_proxy(
+            **request, stream=False, idempotency_key=None, cache_ttl=None, targets=mock_targets,
+            cache=mock_cache, idempotency=mock_idempotency, request_id="test-123", raw_passthrough=True,
+        )
+
+    assert mock_cache.set.call_args.args[4]["body"]["raw_body"] == body.decode()
+    assert result.meta.cache_key != resolve_llm_cache_key(**request, targets=mock_targets)
+    assert services.raw_response_body(result, True, "llm") == body
+    assert result.meta.raw_passthrough is True
+    assert result.meta.response_encoding == "utf8"
+    # Usage and filters see the normalized completion
+    assert "raw_body" not in result.data
+    assert result.data["content"] == "Hi"
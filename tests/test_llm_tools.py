@@ -0,0 +1,367 @@
+"""Tests for tool calling and response_format in the LLM adapters and handle_llm_proxy."""
+import json
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.adapters.llm.anthropic import AnthropicAdapter
+from reliapi.adapters.llm.base import json_mode_shim
+from reliapi.adapters.llm.mistral import MistralAdapter
+from reliapi.adapters.llm.openai import OpenAIAdapter
+from reliapi.app import services
+from reliapi.app.schemas import LLMProxyRequest
+from reliapi.app.services import handle_llm_proxy, resolve_llm_cache_key
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+
+WEATHER_TOOL = {
+    "type": "function",
+    "function": {
+        "name": "get_weather",
+        "description": "Current weather for a city",
+        "parameters": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]},
+    },
+}
+
+WEATHER_FORMAT = {"type": "json_schema", "json_schema": {
+    "name": "weather", "strict": True, "schema": WEATHER_TOOL["function"]["parameters"],
+}}
+
+# The model answered two questions with one parallel call each
+PARALLEL_TOOL_CALLS = {
+    "id": "chatcmpl-tools",
+    "model": "gpt-4o-mini-2024-07-18",
+    "choices": [{
+        "index": 0,
+        "message": {
+            "role": "assistant",
+            "content": None,
+            "tool_calls": [
+                {"id": "call_1", "type": "function",
+                 "function": {"name": "get_weather", "arguments": "{\"city\":\"Berlin\"}"}},
+                {"id": "call_2", "type": "function",
+                 "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}},
+            ],
+        },
+        "finish_reason": "tool_calls",
+    }],
+    "usage": {"prompt_tokens": 80, "completion_tokens": 40},
+}
+
+# The model was offered a tool and answered in text instead
+TOOL_REFUSAL = {
+    "id": "chatcmpl-refusal",
+    "model": "gpt-4o-mini-2024-07-18",
+    "choices": [{
+        "index": 0,
+        "message": {"role": "assistant", "content": "I can't check the weather for a fictional city."},
+        "finish_reason": "stop",
+    }],
+    "usage": {"prompt_tokens": 80, "completion_tokens": 12},
+}
+
+
+class TestAdapters:
+    """Test that tools serialize to each provider's schema."""
+
+    def test_openai_passes_tools_through(self):
+        payload = OpenAIAdapter().prepare_request(
+            messages=[{"role": "user", "content": "Weather?"}],
+            model="gpt-4o-mini",
+            tools=[WEATHER_TOOL],
+            tool_choice="required",
+            response_format={"type": "json_object"},
+        )
+        assert payload["tools"] == [WEATHER_TOOL]
+        assert payload["tool_choice"] == "required"
+        assert payload["response_format"] == {"type": "json_object"}
+
+    def test_plain_request_unchanged(self):
+        """Test that requests without tools keep their payload, and so their cache keys."""
+        payload = OpenAIAdapter().prepare_request(messages=[{"role": "user", "content": "Hi"}], model="gpt-4o-mini")
+        assert payload == {"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "Hi"}]}
+
+    def test_mistral_required_is_any(self):
+        payload = MistralAdapter().prepare_request(
+            messages=[{"role": "user", "content": "Weather?"}],
+            model="mistral-small-latest",
+            tools=[WEATHER_TOOL],
+            tool_choice="required",
+        )
+        assert payload["tool_choice"] == "any"
+
+    def test_anthropic_translation(self):
+        payload = AnthropicAdapter().prepare_request(
+            messages=[
+                {"role": "user", "content": "Weather in Berlin and Paris?"},
+                PARALLEL_TOOL_CALLS["choices"][0]["message"],
+                {"role": "tool", "tool_call_id": "call_1", "content": "12C"},
+                {"role": "tool", "tool_call_id": "call_2", "content": "15C"},
+            ],
+            model="claude-3-haiku-20240307",
+            tools=[WEATHER_TOOL],
+            tool_choice={"type": "function", "function": {"name": "get_weather"}},
+            response_format={"type": "json_schema", "json_schema": {"name": "w", "schema": {"type": "object"}}},
+        )
+        assert payload["tools"] == [{
+            "name": "get_weather",
+            "description": "Current weather for a city",
+            "input_schema": WEATHER_TOOL["function"]["parameters"],
+        }]
+        assert payload["tool_choice"] == {"type": "tool", "name": "get_weather"}
+        assert payload["messages"][1]["content"] == [
+            {"type": "tool_use", "id": "call_1", "name": "get_weather", "input": {"city": "Berlin"}},
+            {"type": "tool_use", "id": "call_2", "name": "get_weather", "input": {"city": "Paris"}},
+        ]
+        # Parallel results share one user message
+        assert len(payload["messages"]) == 3
+        assert [b["tool_use_id"] for b in payload["messages"][2]["content"]] == ["call_1", "call_2"]
+        assert '{"type": "object"}' in payload["system"]
+
+    @pytest.mark.parametrize("model,supported", [
+        ("gpt-4o-mini", True),
+        ("gpt-4o-2024-08-06", True),
+        ("gpt-4.1", True),
+        ("o3-mini", True),
+        ("my-finetune", True),
+        ("gpt-4", False),
+        ("gpt-4-turbo", False),
+        ("gpt-3.5-turbo", False),
+        ("gpt-4o-2024-05-13", False),
+        ("o1-mini", False),
+    ])
+    def test_openai_structured_output_models(self, model, supported):
+        assert OpenAIAdapter().supports_json_schema(model) is supported
+        assert not AnthropicAdapter().supports_json_schema("claude-3-5-sonnet-latest")
+
+    def test_json_mode_shim(self):
+        messages, response_format = json_mode_shim(
+            [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "Weather?"}],
+            WEATHER_FORMAT,
+        )
+        assert response_format == {"type": "json_object"}
+        assert [m["role"] for m in messages] == ["system", "system", "user"]
+        assert '{"properties": {"city"' in messages[1]["content"]
+
+    def test_parse_parallel_tool_calls(self):
+        parsed = OpenAIAdapter().parse_response(PARALLEL_TOOL_CALLS)
+        assert parsed["content"] == ""
+        assert parsed["finish_reason"] == "tool_calls"
+        assert [c["function"]["arguments"] for c in parsed["tool_calls"]] == ['{"city":"Berlin"}', '{"city":"Paris"}']
+
+    def test_parse_refusal_has_no_tool_calls(self):
+        parsed = OpenAIAdapter().parse_response(TOOL_REFUSAL)
+        assert "tool_calls" not in parsed
+        assert parsed["content"].startswith("I can't")
+
+    def test_parse_anthropic_tool_use(self):
+        parsed = AnthropicAdapter().parse_response({
+            "content": [
+                {"type": "text", "text": "Checking."},
+                {"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Berlin"}},
+            ],
+            "stop_reason": "tool_use",
+        })
+        assert parsed["content"] == "Checking."
+        assert parsed["tool_calls"] == [{
+            "id": "toolu_1", "type": "function",
+            "function": {"name": "get_weather", "arguments": '{"city": "Berlin"}'},
+        }]
+
+
+class TestSchema:
+    """Test LLMProxyRequest validation of tool fields."""
+
+    def test_forced_function_must_be_offered(self):
+        with pytest.raises(ValueError):
+            LLMProxyRequest(
+                target="openai",
+                messages=[{"role": "user", "content": "Hi"}],
+                tool_choice={"type": "function", "function": {"name": "missing"}},
+            )
+
+    def test_tools_not_streamed(self):
+        with pytest.raises(ValueError):
+            LLMProxyRequest(
+                target="openai", messages=[{"role": "user", "content": "Hi"}], tools=[WEATHER_TOOL], stream=True
+            )
+
+    def test_object_content_rejected(self):
+        with pytest.raises(ValueError):
+            LLMProxyRequest(target="openai", messages=[{"role": "user", "content": {"type": "text", "text": "Hi"}}])
+
+    def test_tool_args(self):
+        request = LLMProxyRequest(
+            target="openai", messages=[{"role": "user", "content": "Hi"}], tools=[WEATHER_TOOL], tool_choice="auto"
+        )
+        assert request.tool_args() == {
+            "tools": [WEATHER_TOOL], "tool_choice": "auto", "response_format": None, "response_format_fallback": "error",
+        }
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_targets():
+    return {
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "cache": {"enabled": True, "ttl_s": 3600},
+            "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+        }
+    }
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+async def _call(targets, cache, body, **kwargs):
+    upstream = AsyncMock(return_value=httpx.Response(
+        200, request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"), json=body,
+    ))
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_llm_proxy(
+            target_name="openai",
+            messages=[{"role": "user", "content": "Weather in Berlin and Paris?"}],
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=targets,
+            cache=cache,
+            idempotency=Mock(spec=IdempotencyManager),
+            request_id="req_tools",
+            **kwargs,
+        )
+    return result, json.loads(upstream.call_args.kwargs["content"]) if upstream.call_args else None
+
+
+@pytest.mark.asyncio
+async def test_tool_calls_returned_and_cached(mock_targets, mock_cache):
+    """Test that parallel tool calls reach data.tool_calls and the cache."""
+    result, sent = await _call(mock_targets, mock_cache, PARALLEL_TOOL_CALLS, tools=[WEATHER_TOOL])
+
+    assert sent["tools"] == [WEATHER_TOOL]
+    assert result.success
+    assert [c["id"] for c in result.data["tool_calls"]] == ["call_1", "call_2"]
+    assert result.data["finish_reason"] == "tool_calls"
+    assert mock_cache.set.call_args.args[4]["body"]["tool_calls"] == result.data["tool_calls"]
+
+
+@pytest.mark.asyncio
+async def test_refusal_has_no_tool_calls(mock_targets, mock_cache):
+    """Test that a text answer to a tool request carries no tool_calls."""
+    result, _ = await _call(mock_targets, mock_cache, TOOL_REFUSAL, tools=[WEATHER_TOOL], tool_choice="auto")
+
+    assert result.success
+    assert "tool_calls" not in result.data
+    assert result.data["content"].startswith("I can't")
+
+
+@pytest.mark.parametrize("extra", [{}, {"cache_key": "weather"}, {"cache_vary": ["messages"]}])
+def test_tools_in_cache_key(mock_targets, extra):
+    """Test that tools change the cache key, even with an explicit key or cache_vary."""
+    request = dict(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Weather in Berlin?"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        targets=mock_targets,
+        **extra,
+    )
+    plain = resolve_llm_cache_key(**request)
+    with_tools = resolve_llm_cache_key(**request, tools=[WEATHER_TOOL])
+    forced = resolve_llm_cache_key(**request, tools=[WEATHER_TOOL], tool_choice="required")
+
+    assert len({plain, with_tools, forced}) == 3
+    assert resolve_llm_cache_key(**request, tools=[WEATHER_TOOL]) == with_tools
+
+
+@pytest.mark.asyncio
+async def test_json_schema_sent_to_structured_output_model(mock_targets, mock_cache):
+    """Test that a json_schema response_format reaches a model that has structured outputs."""
+    result, sent = await _call(mock_targets, mock_cache, TOOL_REFUSAL, response_format=WEATHER_FORMAT)
+
+    assert result.success
+    assert sent["response_format"] == WEATHER_FORMAT
+    assert sent["messages"] == [{"role": "user", "content": "Weather in Berlin and Paris?"}]
+
+
+@pytest.mark.asyncio
+async def test_json_schema_rejected_for_model_without_structured_outputs(mock_targets, mock_cache):
+    """Test that a json_schema response_format fails naming a model without structured outputs."""
+    result, sent = await _call(
+        mock_targets, mock_cache, TOOL_REFUSAL, model="gpt-4-turbo", response_format=WEATHER_FORMAT
+    )
+
+    assert sent is None
+    assert not result.success
+    assert result.error.code == "UNSUPPORTED_PARAMETER"
+    assert result.error.status_code == 400
+    assert result.error.details == {"field": "response_format", "model": "gpt-4-turbo"}
+    assert "gpt-4-turbo" in result.error.message
+
+
+@pytest.mark.asyncio
+async def test_json_schema_downgraded_to_json_mode(mock_targets, mock_cache):
+    """Test that response_format_fallback json_mode asks for the schema in the prompt instead."""
+    result, sent = await _call(
+        mock_targets, mock_cache, TOOL_REFUSAL, model="gpt-4-turbo",
+        response_format=WEATHER_FORMAT, response_format_fallback="json_mode",
+    )
+
+    assert result.success
+    assert sent["response_format"] == {"type": "json_object"}
+    assert sent["messages"][0]["role"] == "system"
+    assert json.dumps(WEATHER_TOOL["function"]["parameters"], sort_keys=True) in sent["messages"][0]["content"]
+
+
+@pytest.mark.asyncio
+async def test_target_declares_structured_outputs(mock_targets, mock_cache):
+    """Test that the target's llm.structured_outputs overrides what the adapter knows of a model."""
+    mock_targets["openai"]["llm"]["structured_outputs"] = True
+    result, sent = await _call(
+        mock_targets, mock_cache, TOOL_REFUSAL, model="gpt-4-turbo", response_format=WEATHER_FORMAT
+    )
+
+    assert result.success
+    assert sent["response_format"] == WEATHER_FORMAT
+
+
+def test_json_schema_in_cache_key(mock_targets):
+    """Test that the schema of a json_schema response_format is part of the cache key."""
+    request = dict(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Weather in Berlin?"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        targets=mock_targets,
+        cache_key="weather",
+    )
+    other = {"type": "json_schema", "json_schema": {"name": "weather", "schema": {"type": "object"}}}
+
+    assert resolve_llm_cache_key(**request, response_format=WEATHER_FORMAT) != resolve_llm_cache_key(
+        **request, response_format=other
+    )
@@ -0,0 +1,173 @@
+"""Golden tests for translating LLM requests and responses to and from the Anthropic, Gemini and Azure OpenAI formats."""
+import json
+from pathlib import Path
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.adapters.llm.base import TranslationError
+from reliapi.adapters.llm.factory import detect_provider, get_adapter
+from reliapi.app import services
+from reliapi.app.services import handle_llm_proxy
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+
+GOLDEN_DIR = Path(__file__).parent / "testdata" / "llm_translation"
+GOLDEN_FILES = sorted(GOLDEN_DIR.glob("*.json"))
+
+WEATHER_TOOL = {
+    "type": "function",
+    "function": {"name": "get_weather", "parameters": {"type": "object", "properties": {}}},
+}
+USER = {"role": "user", "content": "Hi"}
+
+
+def _golden(path: Path):
+    case = json.loads(path.read_text())
+    return get_adapter(case["provider"]), case
+
+
+@pytest.mark.parametrize("path", GOLDEN_FILES, ids=[p.stem for p in GOLDEN_FILES])
+def test_golden_request(path):
+    adapter, case = _golden(path)
+    assert adapter.prepare_request(**case["request"]) == case["payload"]
+
+
+@pytest.mark.parametrize("path", GOLDEN_FILES, ids=[p.stem for p in GOLDEN_FILES])
+def test_golden_response(path):
+    adapter, case = _golden(path)
+    assert adapter.parse_response(case["response"]) == case["normalized"]
+    assert adapter.parse_usage(case["response"]) == case["usage"]
+
+
+@pytest.mark.parametrize("provider,request_args,field", [
+    ("anthropic", {"messages": [{"role": "assistant", "content": "Hi"}, USER]}, "messages[0]"),
+    ("anthropic", {"messages": [{"role": "system", "content": "Be brief."}]}, "messages"),
+    ("anthropic", {"messages": [USER], "tool_choice": "auto"}, "tool_choice"),
+    ("anthropic", {"messages": [USER], "tools": [WEATHER_TOOL], "tool_choice": "sometimes"}, "tool_choice"),
+    (
+        "anthropic",
+        {"messages": [USER], "tools": [WEATHER_TOOL],
+         "tool_choice": {"type": "function", "function": {"name": "missing"}}},
+        "tool_choice.function.name",
+    ),
+    (
+        "anthropic",
+        {"messages": [
+            {"role": "system", "content": [{"type": "image_url", "image_url": {"url": "data:image/png;base64,AA=="}}]},
+            USER,
+        ]},
+        "messages[0].content",
+    ),
+    ("gemini", {"messages": [USER], "stop": ["a", "b", "c", "d", "e", "f"]}, "stop"),
+    ("gemini", {"messages": [USER], "tool_choice": "required"}, "tool_choice"),
+    (
+        "gemini",
+        {"messages": [USER, {"role": "user", "content": [
+            {"type": "image_url", "image_url": {"url": "https://example.com/cat.png"}},
+        ]}]},
+        "messages[1].content[0].image_url.url",
+    ),
+    ("gemini", {"messages": [USER, {"role": "tool", "tool_call_id": "call_9", "content": "12C"}]},
+     "messages[1].tool_call_id"),
+])
+def test_unsupported_requests_name_the_field(provider, request_args, field):
+    with pytest.raises(TranslationError) as excinfo:
+        get_adapter(provider).prepare_request(model="m", **request_args)
+    assert excinfo.value.field == field
+    assert str(excinfo.value).startswith(f"{field}: ")
+
+
+def test_gemini_endpoint():
+    assert detect_provider("https://generativelanguage.googleapis.com/v1beta") == "gemini"
+    assert services._llm_api_path("gemini", "gemini-1.5-flash") == "/models/gemini-1.5-flash:generateContent"
+    assert services._llm_api_path("anthropic", "claude-3-haiku-20240307") == "/messages"
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_targets():
+    return {
+        "claude": {
+            "base_url": "https://api.anthropic.com/v1",
+            "cache": {"enabled": False},
+            "llm": {"provider": "anthropic", "default_model": "claude-3-5-sonnet-20241022"},
+        }
+    }
+
+
+async def _call(targets, body, messages, **kwargs):
+    upstream = AsyncMock(return_value=httpx.Response(
+        200, request=httpx.Request("POST", "https://api.anthropic.com/v1/messages"), json=body,
+    ))
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_llm_proxy(
+            target_name="claude",
+            messages=messages,
+            model=None,
+            max_tokens=256,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=targets,
+            cache=cache,
+            idempotency=Mock(spec=IdempotencyManager),
+            request_id="req_translate",
+            **kwargs,
+        )
+    return result, upstream
+
+
+@pytest.mark.asyncio
+async def test_anthropic_target_round_trip(mock_targets):
+    """Test that an Anthropic target gets its own format and answers in the normalized one."""
+    _, case = _golden(GOLDEN_DIR / "anthropic_chat.json")
+    result, upstream = await _call(mock_targets, case["response"], case["request"]["messages"], include_raw=True)
+
+    sent = json.loads(upstream.call_args.kwargs["content"])
+    assert upstream.call_args.kwargs["url"].endswith("/messages")
+    assert sent["system"] == "You are terse.\n\nAnswer in English."
+    assert [m["role"] for m in sent["messages"]] == ["user", "assistant", "user"]
+    assert result.success
+    assert result.data["content"] == "Madrid."
+    assert result.data["finish_reason"] == "stop"
+    assert result.data["usage"] == {"prompt_tokens": 31, "completion_tokens": 4, "total_tokens": 35}
+    assert result.meta.raw_provider_response == case["response"]
+
+
+@pytest.mark.asyncio
+async def test_raw_response_only_on_request(mock_targets):
+    _, case = _golden(GOLDEN_DIR / "anthropic_chat.json")
+    result, _ = await _call(mock_targets, case["response"], case["request"]["messages"])
+
+    assert result.success
+    assert result.meta.raw_provider_response is None
+
+
+@pytest.mark.asyncio
+async def test_untranslatable_request_rejected(mock_targets):
+    """Test that a tool_choice Anthropic lacks fails before the upstream is called."""
+    result, upstream = await _call(
+        mock_targets, {}, [USER], tools=[WEATHER_TOOL], tool_choice="sometimes"
+    )
+
+    assert not result.success
+    assert result.error.code == "BAD_REQUEST"
+    assert result.error.status_code == 400
+    assert result.error.details == {"field": "tool_choice"}
+    assert "tool_choice" in result.error.message
+    upstream.assert_not_called()
@@ -0,0 +1,157 @@
+"""Tests for token logprobs of LLM requests."""
+import json
+import os
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+from pydantic import ValidationError
+
+from reliapi.adapters.llm.openai import OpenAIAdapter
+from reliapi.app import services
+from reliapi.app.schemas import LLMProxyRequest
+from reliapi.app.services import _replay_cached_stream, _sse_chunk_event, handle_llm_proxy, resolve_llm_cache_key
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.model_capabilities import MODEL_CAPABILITIES, check_request
+
+FIXTURE = os.path.join(os.path.dirname(__file__), "..", "reliapi", "testdata", "openai_logprobs.json")
+
+TARGETS = {
+    "openai": {
+        "base_url": "https://api.openai.com/v1",
+        "cache": {"enabled": False},
+        "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+    },
+    "anthropic": {
+        "base_url": "https://api.anthropic.com",
+        "llm": {"provider": "anthropic", "default_model": "claude-3-5-haiku"},
+    },
+}
+
+
+def _recorded():
+    with open(FIXTURE) as f:
+        return json.load(f)
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+def test_check_request():
+    values = {"logprobs": True, "top_logprobs": 5}
+    assert check_request(MODEL_CAPABILITIES["gpt-4o-mini"], "gpt-4o-mini", 10, values) == []
+    (issue,) = check_request(MODEL_CAPABILITIES["claude-3-5-haiku"], "claude-3-5-haiku", 10, values)
+    assert issue.field == "logprobs" and not issue.fixable
+    (issue,) = check_request(MODEL_CAPABILITIES["o3-mini"], "o3-mini", 10, {"logprobs": True})
+    assert issue.message == "o3-mini does not return logprobs"
+
+
+def test_schema():
+    request = LLMProxyRequest(target="openai", messages=[{"role": "user", "content": "Hi"}], logprobs=True, top_logprobs=3)
+    assert request.logprobs_args() == {"logprobs": True, "top_logprobs": 3}
+    with pytest.raises(ValidationError, match="top_logprobs requires logprobs"):
+        LLMProxyRequest(target="openai", messages=[{"role": "user", "content": "Hi"}], top_logprobs=3)
+    with pytest.raises(ValidationError):
+        LLMProxyRequest(target="openai", messages=[{"role": "user", "content": "Hi"}], logprobs=True, top_logprobs=21)
+
+
+def test_openai_adapter():
+    adapter = OpenAIAdapter()
+    payload = adapter.prepare_request([{"role": "user", "content": "Hi"}], "gpt-4o", logprobs=True, top_logprobs=5)
+    assert payload["logprobs"] is True and payload["top_logprobs"] == 5
+    assert "logprobs" not in adapter.prepare_request([{"role": "user", "content": "Hi"}], "gpt-4o", logprobs=False)
+
+    (token,) = adapter.parse_response(_recorded())["logprobs"]
+    # The tokens' bytes are left out
+    assert token["token"] == "Positive" and token["logprob"] == -0.0512 and "bytes" not in token
+    assert [t["token"] for t in token["top_logprobs"]] == ["Positive", "positive", " Positive", "Negative", "Neutral"]
+
+
+async def _call(target="openai", **kwargs):
+    upstream = AsyncMock(return_value=httpx.Response(
+        200, request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"), json=_recorded(),
+    ))
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_llm_proxy(
+            target_name=target,
+            messages=[{"role": "user", "content": "Classify the sentiment: great product"}],
+            model=None,
+            max_tokens=1,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=TARGETS,
+            cache=cache,
+            idempotency=Mock(spec=IdempotencyManager),
+            request_id="req_logprobs",
+            **kwargs,
+        )
+    return result, json.loads(upstream.call_args.kwargs["content"]) if upstream.call_args else None
+
+
+@pytest.mark.asyncio
+async def test_proxy_returns_logprobs():
+    result, sent = await _call(logprobs=True, top_logprobs=5)
+    assert result.success
+    assert sent["logprobs"] is True and sent["top_logprobs"] == 5
+    assert result.data["logprobs"][0]["token"] == "Positive"
+    assert len(result.data["logprobs"][0]["top_logprobs"]) == 5
+
+    result, sent = await _call()
+    assert "logprobs" not in sent and "logprobs" not in result.data
+
+
+@pytest.mark.asyncio
+async def test_unsupported_model_rejected():
+    result, sent = await _call(target="anthropic", logprobs=True)
+    assert sent is None
+    assert result.error.code == "MODEL_LIMITS_EXCEEDED"
+    assert result.error.details["issues"][0]["field"] == "logprobs"
+
+
+def test_logprobs_scope_the_cache_key():
+    request = dict(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Hi"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        targets=TARGETS,
+    )
+    plain = resolve_llm_cache_key(**request)
+    with_logprobs = resolve_llm_cache_key(**request, logprobs=True)
+    with_top = resolve_llm_cache_key(**request, logprobs=True, top_logprobs=5)
+    assert len({plain, with_logprobs, with_top}) == 3
+    # Even under a cache_key of the client's own
+    assert resolve_llm_cache_key(**request, cache_key="k") != resolve_llm_cache_key(**request, cache_key="k", logprobs=True)
+
+
+def test_chunk_events_carry_logprobs():
+    logprobs = [{"token": "Hi", "logprob": -0.25}]
+    event = _sse_chunk_event(0, "Hi", logprobs)
+    assert json.loads(event.split("data: ", 1)[1]) == {"index": 0, "delta": "Hi", "finish_reason": None, "logprobs": logprobs}
+    assert "logprobs" not in _sse_chunk_event(0, "Hi")
+
+
+@pytest.mark.asyncio
+async def test_replay_sends_logprobs_with_the_last_chunk():
+    logprobs = [{"token": "Hi", "logprob": -0.25}, {"token": " there", "logprob": -0.75}]
+    cached = {"body": {"content": "Hi there", "finish_reason": "stop", "logprobs": logprobs}}
+    events = [e async for e in _replay_cached_stream(cached, {}, {"stream_replay_chunk_tokens": 1})]
+    chunks = [json.loads(e.split("data: ", 1)[1]) for e in events if "event: chunk" in e]
+    assert [c["delta"] for c in chunks] == ["Hi", " there"]
+    assert "logprobs" not in chunks[0] and chunks[1]["logprobs"] == logprobs
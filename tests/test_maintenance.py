@@ -0,0 +1,71 @@
+"""Tests for core/maintenance.py MaintenanceMiddleware."""
+import json
+
+import pytest
+
+from reliapi.core.maintenance import MaintenanceMiddleware, MaintenanceMode
+
+
+async def _call(mode, method="POST", path="/v1/proxy/llm"):
+    reached = []
+
+    async def app(scope, receive, send):
+        reached.append(scope["path"])
+        await send({"type": "http.response.start", "status": 200, "headers": []})
+        await send({"type": "http.response.body", "body": b"{}"})
+
+    sent = []
+
+    async def receive():
+        return {"type": "http.request", "body": b"", "more_body": False}
+
+    async def send(message):
+        sent.append(message)
+
+    scope = {"type": "http", "method": method, "path": path, "headers": []}
+    await MaintenanceMiddleware(app, get_mode=lambda: mode)(scope, receive, send)
+    return sent[0]["status"], dict(sent[0]["headers"]), sent[1]["body"], reached
+
+
+@pytest.mark.asyncio
+async def test_requests_served_outside_maintenance():
+    """Test that requests reach the app without maintenance mode."""
+    status, _, _, reached = await _call(None)
+    assert status == 200
+    assert reached == ["/v1/proxy/llm"]
+
+
+@pytest.mark.asyncio
+async def test_maintenance_refuses_requests():
+    """Test that maintenance answers 503 MAINTENANCE with when to retry."""
+    status, headers, body, reached = await _call(MaintenanceMode(retry_after_s=120, message="Upgrading"))
+    assert status == 503
+    assert reached == []
+    assert headers[b"retry-after"] == b"120"
+    assert headers[b"x-reliapi-maintenance"] == b"full"
+    error = json.loads(body)["error"]
+    assert error["code"] == "MAINTENANCE"
+    assert error["retryable"] is True
+    assert error["retry_after_s"] == 120
+    assert error["details"] == {"read_only": False}
+    assert error["message"] == "Upgrading"
+
+
+@pytest.mark.asyncio
+async def test_read_only_maintenance_serves_gets():
+    """Test that read-only maintenance refuses only requests other than GET."""
+    mode = MaintenanceMode(read_only=True)
+    status, _, _, _ = await _call(mode, method="GET", path="/v1/jobs/job_1")
+    assert status == 200
+
+    status, headers, body, _ = await _call(mode)
+    assert status == 503
+    assert headers[b"x-reliapi-maintenance"] == b"read_only"
+    assert json.loads(body)["error"]["details"] == {"read_only": True}
+
+
+@pytest.mark.asyncio
+async def test_health_served_during_maintenance():
+    """Test that health checks are answered during maintenance."""
+    status, _, _, _ = await _call(MaintenanceMode(), method="GET", path="/readyz")
+    assert status == 200
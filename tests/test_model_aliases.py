@@ -0,0 +1,62 @@
+"""Tests for model alias resolution."""
+import pytest
+from pydantic import ValidationError
+
+from reliapi.config.schema import ModelAlias
+from reliapi.core.model_aliases import AliasResolution, UnknownAliasError, resolve_alias
+
+TARGETS = {
+    "openai": {
+        "base_url": "https://api.openai.com/v1",
+        "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+        "model_aliases": {
+            "default-small": {"model": "gpt-4o-mini"},
+            "claude": {"target": "anthropic", "model": "claude-3-5-haiku"},
+            "rollout": {
+                "split": [
+                    {"model": "gpt-4o-mini", "weight": 90},
+                    {"model": "gpt-4.1-mini", "weight": 10},
+                ]
+            },
+        },
+    },
+    "anthropic": {"base_url": "https://api.anthropic.com/v1", "llm": {"provider": "anthropic"}},
+}
+
+
+def test_alias_by_name_or_prefix():
+    expected = AliasResolution(alias="default-small", target="openai", model="gpt-4o-mini")
+    assert resolve_alias("openai", "default-small", TARGETS) == expected
+    assert resolve_alias("openai", "alias:default-small", TARGETS) == expected
+    assert resolve_alias("openai", "alias:claude", TARGETS).target == "anthropic"
+
+
+def test_models_that_are_no_alias_pass_through():
+    assert resolve_alias("openai", None, TARGETS) is None
+    assert resolve_alias("openai", "gpt-4o", TARGETS) is None
+    # Aliases are those of the requested target
+    assert resolve_alias("anthropic", "default-small", TARGETS) is None
+
+
+def test_unknown_prefixed_alias_fails():
+    with pytest.raises(UnknownAliasError):
+        resolve_alias("openai", "alias:nope", TARGETS)
+
+
+def test_split_is_deterministic_per_idempotency_key():
+    for i in range(5):
+        first = resolve_alias("openai", "rollout", TARGETS, f"key-{i}")
+        assert first.model in ("gpt-4o-mini", "gpt-4.1-mini")
+        assert all(resolve_alias("openai", "rollout", TARGETS, f"key-{i}") == first for _ in range(10))
+
+    picked = [resolve_alias("openai", "rollout", TARGETS, f"key-{i}").model for i in range(2000)]
+    share = picked.count("gpt-4.1-mini") / len(picked)
+    assert 0.07 < share < 0.13
+
+
+def test_alias_config_validation():
+    ModelAlias(split=[{"model": "a", "weight": 50}, {"model": "b", "weight": 50}])
+    with pytest.raises(ValidationError):
+        ModelAlias()
+    with pytest.raises(ValidationError):
+        ModelAlias(split=[{"model": "a", "weight": 90}, {"model": "b", "weight": 20}])
@@ -0,0 +1,205 @@
+"""Tests for checking LLM requests against model capabilities."""
+import json
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+from pydantic import ValidationError
+
+from reliapi.app import services
+from reliapi.app.services import handle_llm_proxy, resolve_llm_cache_key
+from reliapi.config.schema import ModelCapabilityConfig
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.model_capabilities import MODEL_CAPABILITIES, check_request, fit_request, lookup, table
+
+COMPLETION = {
+    "choices": [{"message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}],
+    "usage": {"prompt_tokens": 5, "completion_tokens": 1},
+}
+
+
+def test_lookup_by_longest_prefix():
+    assert lookup("gpt-4o-2024-08-06") == MODEL_CAPABILITIES["gpt-4o"]
+    assert lookup("gpt-4o-mini-2024-07-18") == MODEL_CAPABILITIES["gpt-4o-mini"]
+    assert lookup("o3-mini-2025-01-31") == MODEL_CAPABILITIES["o3-mini"]
+    assert lookup("my-finetune") is None
+
+
+def test_lookup_overrides():
+    overrides = {
+        "gpt-4o": {"max_output_tokens": 4096, "supports_vision": None},
+        "llama-3-70b": {"context_window": 8192, "parameters": ["temperature"]},
+    }
+    gpt = lookup("gpt-4o", overrides)
+    assert gpt.max_output_tokens == 4096
+    assert gpt.context_window == 128000 and gpt.supports_vision
+    # Other gpt-4o versions keep the table's entry
+    assert lookup("gpt-4o-2024-08-06", overrides).max_output_tokens == 16384
+
+    llama = lookup("llama-3-70b", overrides)
+    assert llama.context_window == 8192 and llama.max_output_tokens is None
+    assert llama.parameters == ("temperature",)
+    assert set(table(overrides)) == {"gpt-4o", "llama-3-70b"}
+    assert table(overrides)["llama-3-70b"]["parameters"] == ["temperature"]
+
+
+def test_check_request():
+    caps = MODEL_CAPABILITIES["claude-3-5-sonnet"]
+    issues = check_request(caps, "claude-3-5-sonnet", 100, {"max_tokens": 10000, "temperature": 1.5})
+    assert [issue.to_dict() for issue in issues] == [
+        {"field": "max_tokens", "message": "max_tokens 10000 is over the 8192 claude-3-5-sonnet can generate for this prompt",
+         "min": 1, "max": 8192},
+        {"field": "temperature", "message": "temperature 1.5 is over the 1.0 of claude-3-5-sonnet", "min": 0, "max": 1.0},
+    ]
+    assert check_request(caps, "claude-3-5-sonnet", 100, {"max_tokens": 8192, "temperature": 1.0}) == []
+
+
+def test_max_tokens_limited_by_context_left():
+    caps = MODEL_CAPABILITIES["gpt-4"]
+    (issue,) = check_request(caps, "gpt-4", 8000, {"max_tokens": 1000})
+    assert issue.field == "max_tokens" and issue.max == 192
+
+    (issue,) = check_request(caps, "gpt-4", 9000, {"max_tokens": 10})
+    assert issue.field == "messages" and issue.max == 8192 and not issue.fixable
+
+
+def test_unsupported_parameters_and_features():
+    caps = MODEL_CAPABILITIES["o1-mini"]
+    issues = check_request(caps, "o1-mini", 10, {"temperature": 0.2, "stop": ["\n"], "tools": [{}]}, has_images=True)
+    assert [(issue.field, issue.fixable) for issue in issues] == [
+        ("temperature", True), ("stop", True), ("tools", False), ("messages", False),
+    ]
+
+
+def test_fit_request_clamps_and_drops():
+    caps = MODEL_CAPABILITIES["o3-mini"]
+    values = {"max_tokens": 200000, "temperature": 0.7, "top_p": None, "stop": None, "tools": None}
+
+    strict = fit_request(caps, "o3-mini", 10, values)
+    assert strict.values == values and strict.adjustments == []
+    assert [issue.field for issue in strict.issues] == ["max_tokens", "temperature"]
+
+    fitted = fit_request(caps, "o3-mini", 10, values, strict=False)
+    assert fitted.issues == []
+    assert fitted.values["max_tokens"] == 100000 and fitted.values["temperature"] is None
+    assert [(a["field"], a["action"], a["from"], a.get("to")) for a in fitted.adjustments] == [
+        ("max_tokens", "clamped", 200000, 100000),
+        ("temperature", "dropped", 0.7, None),
+    ]
+
+
+def test_config_rejects_unknown_parameters():
+    assert ModelCapabilityConfig(parameters=["temperature", "stop"]).parameters == ["temperature", "stop"]
+    with pytest.raises(ValidationError):
+        ModelCapabilityConfig(parameters=["frequency_penalty"])
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_targets():
+    return {
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+        }
+    }
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.get_entry.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+async def _call(targets, cache, **kwargs):
+    upstream = AsyncMock(return_value=httpx.Response(
+        200, request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"), json=COMPLETION,
+    ))
+    request = dict(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Hi"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        stream=False,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=Mock(spec=IdempotencyManager),
+        request_id="req_caps",
+    )
+    request.update(kwargs)
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await handle_llm_proxy(**request)
+    return result, json.loads(upstream.call_args.kwargs["content"]) if upstream.call_args else None
+
+
+@pytest.mark.asyncio
+async def test_request_over_model_limits_rejected(mock_targets, mock_cache):
+    """Test that a request outside its model's limits fails before it is sent, listing each field."""
+    result, sent = await _call(mock_targets, mock_cache, model="o1-mini", max_tokens=100000, temperature=0.5)
+
+    assert sent is None
+    assert result.error.code == "MODEL_LIMITS_EXCEEDED"
+    assert result.error.status_code == 400
+    assert result.error.details["model"] == "o1-mini"
+    assert [(issue["field"], issue.get("max")) for issue in result.error.details["issues"]] == [
+        ("max_tokens", 65536), ("temperature", None),
+    ]
+
+
+@pytest.mark.asyncio
+async def test_non_strict_request_fitted_to_model(mock_targets, mock_cache):
+    """Test that strict=false clamps max_tokens, drops unsupported parameters and reports both."""
+    result, sent = await _call(
+        mock_targets, mock_cache, model="o1-mini", max_tokens=100000, temperature=0.5, strict=False
+    )
+
+    assert result.success
+    assert sent["max_tokens"] == 65536
+    assert "temperature" not in sent
+    assert [(a["field"], a["action"]) for a in result.meta.adjustments] == [
+        ("max_tokens", "clamped"), ("temperature", "dropped"),
+    ]
+
+
+@pytest.mark.asyncio
+async def test_target_models_override(mock_targets, mock_cache):
+    """Test that a target's llm.models describes a self-hosted model the table lacks."""
+    mock_targets["openai"]["llm"]["models"] = {"llama-3-70b": {"context_window": 8192, "max_output_tokens": 2048}}
+    result, sent = await _call(mock_targets, mock_cache, model="llama-3-70b", max_tokens=4096)
+    assert result.error.details["issues"][0]["max"] == 2048
+
+    result, sent = await _call(mock_targets, mock_cache, model="llama-3-70b", max_tokens=1024)
+    assert result.success and sent["max_tokens"] == 1024
+
+
+def test_cache_key_of_fitted_request(mock_targets):
+    """Test that a non-strict request is keyed by the values it asked for."""
+    request = dict(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Hi"}],
+        model="gpt-4o-mini",
+        max_tokens=50000,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        targets=mock_targets,
+    )
+    assert resolve_llm_cache_key(**request) is None
+    fitted = resolve_llm_cache_key(**request, strict=False)
+    assert fitted and fitted != resolve_llm_cache_key(**{**request, "max_tokens": 16384})
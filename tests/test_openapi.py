@@ -0,0 +1,56 @@
+"""Tests that the published OpenAPI document matches the API models.
+
+The Go wire types are generated from openapi/openapi.yaml, so a field
+added to a request or response model must be added there too.
+"""
+import pytest
+from fastapi.testclient import TestClient
+from pydantic import BaseModel
+
+from reliapi.app import schemas
+from reliapi.app.main import app, load_openapi_spec
+
+SPEC = load_openapi_spec()
+MODELS = [
+    name
+    for name, schema in SPEC["components"]["schemas"].items()
+    if "properties" in schema and isinstance(getattr(schemas, name, None), type)
+]
+
+
+def test_spec_is_openapi_3_1():
+    assert SPEC["openapi"].startswith("3.1")
+    assert len(MODELS) >= 20
+
+
+@pytest.mark.parametrize("name", MODELS)
+def test_spec_matches_model(name):
+    model = getattr(schemas, name)
+    assert issubclass(model, BaseModel)
+    schema = SPEC["components"]["schemas"][name]
+    assert list(schema["properties"]) == list(model.model_fields)
+    required = [field for field, info in model.model_fields.items() if info.is_required()]
+    assert schema.get("required", []) == required
+
+
+def test_spec_refs_resolve():
+    names = set(SPEC["components"]["schemas"])
+
+    def refs(node):
+        if isinstance(node, dict):
+            for key, value in node.items():
+                if key == "$ref":
+                    yield value.rsplit("/", 1)[-1]
+                else:
+                    yield from refs(value)
+        elif isinstance(node, list):
+            for value in node:
+                yield from refs(value)
+
+    assert set(refs(SPEC)) <= names
+
+
+def test_openapi_json_serves_spec():
+    response = TestClient(app).get("/openapi.json")
+    assert response.status_code == 200
+    assert response.json() == SPEC
@@ -0,0 +1,181 @@
+"""Tests for priority queueing of LLM requests over a target's rate budget."""
+import asyncio
+import time
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.app import services
+from reliapi.app.services import handle_llm_proxy
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.priority_queue import QueueFullError, TargetQueue, TargetQueues
+
+
+@pytest.fixture(autouse=True)
+def fresh_queues():
+    """Isolate the process-wide target queues between tests."""
+    services._target_queues.reset()
+    services._circuit_breakers.clear()
+    yield
+    services._target_queues.reset()
+    services._circuit_breakers.clear()
+
+
+@pytest.mark.asyncio
+async def test_requests_within_budget_do_not_wait():
+    queue = TargetQueue(max_qps=5)
+    waits = [await queue.admit("batch", 1.0) for _ in range(5)]
+    assert waits == [0.0] * 5
+
+
+@pytest.mark.asyncio
+async def test_queue_lets_higher_priority_go_first():
+    queue = TargetQueue(max_qps=20)
+    for _ in range(20):
+        await queue.admit("default", 1.0)
+
+    order = []
+
+    async def request(name, priority):
+        await queue.admit(priority, 5.0)
+        order.append(name)
+
+    tasks = [asyncio.create_task(request(f"batch-{i}", "batch")) for i in range(3)]
+    await asyncio.sleep(0)
+    tasks += [
+        asyncio.create_task(request("default", "default")),
+        asyncio.create_task(request("interactive", "interactive")),
+    ]
+    await asyncio.gather(*tasks)
+    assert order == ["interactive", "default", "batch-0", "batch-1", "batch-2"]
+
+
+@pytest.mark.asyncio
+async def test_full_queue_turns_away_lowest_priority_first():
+    queue = TargetQueue(max_qps=1, max_queue=2)
+    await queue.admit("default", 1.0)
+    batch = [asyncio.create_task(queue.admit("batch", 5.0)) for _ in range(2)]
+    await asyncio.sleep(0)
+
+    # A batch request finds no room
+    with pytest.raises(QueueFullError) as exc:
+        await queue.admit("batch", 5.0)
+    assert exc.value.retry_after_s > 0
+
+    # An interactive one takes the place of the newest batch request
+    interactive = asyncio.create_task(queue.admit("interactive", 5.0))
+    await asyncio.sleep(0)
+    with pytest.raises(QueueFullError):
+        await batch[1]
+    assert await interactive < 1.5
+    await batch[0]
+
+
+@pytest.mark.asyncio
+async def test_wait_past_timeout_fails():
+    queue = TargetQueue(max_qps=1)
+    await queue.admit("default", 1.0)
+    with pytest.raises(QueueFullError) as exc:
+        await queue.admit("batch", 0.05)
+    assert "50 ms" in str(exc.value)
+    assert queue.waiting == 0
+
+
+def test_changed_config_starts_a_new_queue():
+    queues = TargetQueues()
+    assert queues.get("openai", None) is None
+    first = queues.get("openai", {"max_qps": 5})
+    assert queues.get("openai", {"max_qps": 5}) is first
+    assert queues.get("openai", {"max_qps": 10}) is not first
+
+
+@pytest.mark.asyncio
+async def test_interactive_latency_stays_flat_under_batch_load():
+    """Load test: a flood of batch requests is throttled to the budget while
+    interactive requests keep waiting at most about one refill interval."""
+    queue = TargetQueue(max_qps=50, max_queue=100)
+    waits = {"interactive": [], "batch": []}
+    rejected = 0
+
+    async def request(priority):
+        nonlocal rejected
+        try:
+            waits[priority].append(await queue.admit(priority, 10.0))
+        except QueueFullError:
+            rejected += 1
+
+    async def interactive_user():
+        for _ in range(20):
+            await request("interactive")
+            await asyncio.sleep(0.05)
+
+    started = time.monotonic()
+    await asyncio.gather(interactive_user(), *(request("batch") for _ in range(300)))
+    elapsed = time.monotonic() - started
+
+    interactive = sorted(waits["interactive"])
+    p95 = interactive[int(len(interactive) * 0.95) - 1]
+    assert len(interactive) == 20
+    assert p95 < 0.1, f"interactive P95 wait {p95:.3f}s"
+    # Batch traffic is held to the budget and the rest is shed
+    assert rejected > 0
+    assert len(waits["batch"]) + len(interactive) <= 50 * elapsed + 50 + 1
+
+
+def _completion():
+    return httpx.Response(
+        200,
+        request=httpx.Request("POST", "https://api.openai.com/v1/chat/completions"),
+        json={
+            "choices": [{"message": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"}],
+            "usage": {"prompt_tokens": 10, "completion_tokens": 2},
+        },
+    )
+
+
+async def _call(targets, **kwargs):
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.set.return_value = True
+    return await handle_llm_proxy(
+        target_name="openai",
+        messages=[{"role": "user", "content": "Hi"}],
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        stream=False,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=Mock(spec=IdempotencyManager),
+        request_id="req_queue",
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_llm_proxy_reports_queue_wait_and_queue_full():
+    targets = {
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "cache": {"enabled": False},
+            "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+            "queue": {"max_qps": 1, "max_queue": 1, "timeout_ms": 5000},
+        }
+    }
+    upstream = AsyncMock(return_value=_completion())
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        first = await _call(targets)
+        second, third = await asyncio.gather(_call(targets), _call(targets, priority="batch"))
+
+    assert first.success and first.meta.queue_wait_ms == 0
+    assert second.success and second.meta.queue_wait_ms >= 500
+    assert not third.success
+    assert third.error.code == "QUEUE_FULL" and third.error.status_code == 429
+    assert third.error.retry_after_s > 0
+    assert upstream.call_count == 2
@@ -4,6 +4,7 @@ import json
 import time
 from concurrent.futures import ThreadPoolExecutor
 from typing import List
+from unittest.mock import Mock
 
 import pytest
 import redis
@@ -97,6 +98,82 @@ class TestCacheRaceConditions:
         assert cached is not None
 
 
+    def test_concurrent_refresh_lock(self, cache):
+        """Test that only one caller wins the refresh lock of a stale entry.
+
+        Edge case: Many requests see the same expired entry at once.
+        Expected: Exactly one of them refreshes it.
+        """
+        with ThreadPoolExecutor(max_workers=10) as executor:
+            futures = [executor.submit(cache.acquire_refresh_lock, "hash", "acme") for _ in range(10)]
+            acquired = [future.result() for future in futures]
+
+        assert acquired.count(True) == 1
+
+        # Released lock can be taken again
+        cache.release_refresh_lock("hash", "acme")
+        assert cache.acquire_refresh_lock("hash", "acme") is True
+
+    @pytest.mark.asyncio
+    async def test_concurrent_stale_while_revalidate(self, cache, redis_client):
+        """Test two clients hitting an expired entry under stale_while_revalidate.
+
+        Expected: Both get the stale response immediately, one background
+        refresh runs.
+        """
+        from reliapi.app import services
+
+        targets = {"example": {"base_url": "http://example.com", "cache": {"enabled": True, "ttl_s": 60}}}
+        key_hash = services.resolve_http_cache_key("example", "GET", "/test", None, None, None, targets)
+        redis_client.setex(
+            cache._hash_key(key_hash),
+            3600,
+            json.dumps({
+                "status_code": 200,
+                "headers": {},
+                "body": {"value": "old"},
+                "_cached_at": time.time() - 120,
+                "_ttl_s": 60,
+            }),
+        )
+
+        refreshes = []
+
+        async def handler(**kwargs):
+            refreshes.append(kwargs["request_id"])
+            await asyncio.sleep(0.05)
+            return Mock(success=True)
+
+        def serve(request_id):
+            return services.handle_with_cache_mode(
+                handler,
+                kind="http",
+                cache_mode="stale_while_revalidate",
+                target_name="example",
+                method="GET",
+                path="/test",
+                headers=None,
+                query=None,
+                body=None,
+                idempotency_key=None,
+                cache_ttl=None,
+                targets=targets,
+                cache=cache,
+                idempotency=None,
+                request_id=request_id,
+            )
+
+        results = await asyncio.gather(serve("req_a"), serve("req_b"))
+        await asyncio.gather(*list(services._background_refreshes))
+
+        assert len(refreshes) == 1
+        assert refreshes[0] in ("req_a_refresh", "req_b_refresh")
+        for result in results:
+            assert result.meta.stale is True
+            assert result.meta.cache_age_s >= 120
+            assert result.data["body"] == {"value": "old"}
+
+
 class TestIdempotencyRaceConditions:
     """Test race conditions in idempotency operations."""
     
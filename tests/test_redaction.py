@@ -0,0 +1,76 @@
+"""Tests for redacting sensitive values from LLM prompts."""
+import pytest
+
+from reliapi.app.services import resolve_llm_cache_key
+from reliapi.core.redaction import redact_messages
+
+ALL = {"enabled": True}
+
+
+@pytest.mark.parametrize(
+    "text,expected",
+    [
+        ("mail a.b+c@mail.example.org now", "mail [EMAIL_1] now"),
+        ("x@y.io, z@y.io, x@y.io", "[EMAIL_1], [EMAIL_2], [EMAIL_1]"),
+        ("call +44 20 7946 0958 or (555) 123-4567", "call [PHONE_1] or [PHONE_2]"),
+        ("card 4111-1111-1111-1111", "card [CREDIT_CARD_1]"),
+        ("in 2024 we sold 1500 units", "in 2024 we sold 1500 units"),
+    ],
+)
+def test_builtin_patterns(text, expected):
+    result = redact_messages([{"role": "user", "content": text}], ALL)
+    assert result.messages[0]["content"] == expected
+    assert result.applied == expected.count("[") - text.count("[")
+
+
+def test_card_numbers_must_pass_luhn():
+    result = redact_messages([{"role": "user", "content": "order 4111 1111 1111 1112"}], {"patterns": ["credit_card"]})
+    assert result.messages[0]["content"] == "order 4111 1111 1111 1112"
+    assert result.applied == 0 and result.digest is None
+
+
+def test_custom_patterns_and_parts():
+    messages = [
+        {"role": "system", "content": "Customer cus_1234 (ada@example.com)"},
+        {"role": "user", "content": [
+            {"type": "text", "text": "Refund cus_1234, copy ada@example.com"},
+            {"type": "image_url", "image_url": {"url": "https://example.com/cus_1234.png"}},
+        ]},
+    ]
+    result = redact_messages(messages, {"patterns": ["email"], "custom_patterns": {"customer-id": r"\bcus_[0-9]{4}\b"}})
+    assert result.messages[0]["content"] == "Customer [CUSTOMER_ID_1] ([EMAIL_1])"
+    assert result.messages[1]["content"][0]["text"] == "Refund [CUSTOMER_ID_1], copy [EMAIL_1]"
+    assert result.messages[1]["content"][1] == messages[1]["content"][1]
+    assert result.applied == 4
+    assert messages[0]["content"] == "Customer cus_1234 (ada@example.com)"
+
+
+def test_disabled_config_is_a_no_op():
+    messages = [{"role": "user", "content": "ada@example.com"}]
+    assert redact_messages(messages, None).messages is messages
+    assert redact_messages(messages, {"enabled": False}).applied == 0
+
+
+def _cache_key(redaction, content):
+    targets = {
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+            "redaction": redaction,
+        }
+    }
+    return resolve_llm_cache_key(
+        "openai", [{"role": "user", "content": content}], None, None, None, None, None, targets
+    )
+
+
+def test_cache_key_is_per_value_by_default():
+    assert _cache_key(ALL, "Write to ada@example.com") != _cache_key(ALL, "Write to bob@example.com")
+    assert _cache_key(ALL, "Write to ada@example.com") == _cache_key(ALL, "Write to ada@example.com")
+
+
+def test_cache_key_shared_across_values_when_configured():
+    shared = {"enabled": True, "share_cache_entries": True}
+    assert _cache_key(shared, "Write to ada@example.com") == _cache_key(shared, "Write to bob@example.com")
+    # The key is that of the redacted prompt
+    assert _cache_key(shared, "Write to ada@example.com") == _cache_key(None, "Write to [EMAIL_1]")
@@ -0,0 +1,154 @@
+"""Tests for replays of audited requests."""
+from datetime import datetime, timezone
+from unittest.mock import AsyncMock, MagicMock, patch
+
+import pytest
+from fastapi import FastAPI
+from fastapi.responses import JSONResponse
+from fastapi.testclient import TestClient
+
+from reliapi.app import services
+from reliapi.app.routes.replay import router
+from reliapi.app.schemas import MetaResponse, SuccessResponse
+from reliapi.app.services import audit_record, record_audit
+from reliapi.core.cache import Cache, skip_cache_reads
+from reliapi.core.redaction import Redactor
+from reliapi.core.replay import ReplayUnavailable, current_replay, replay_body, replay_section
+
+NOW = datetime.now(timezone.utc)
+TARGETS = {
+    "openai": {"audit": {"capture": "full"}, "redaction": {"enabled": True}},
+    "billing": {"audit": {"capture": "full"}, "redaction": {"enabled": True}},
+    "search": {"audit": {"capture": "metadata"}},
+}
+LLM_REQUEST = {
+    "target": "openai",
+    "messages": [{"role": "user", "content": "Write to ada@example.com"}],
+    "model": "gpt-4o-mini",
+    "idempotency_key": "order-1",
+    "cache": 600,
+}
+
+
+@pytest.fixture(autouse=True)
+def fresh_audit_log():
+    """Isolate the process-wide audit log between tests."""
+    services._audit_log.reset()
+    yield
+    services._audit_log.reset()
+
+
+def _record(request_id, kind, target, request, tenant="acme"):
+    meta = MetaResponse(target=target, duration_ms=20, request_id=request_id)
+    record_audit(
+        SuccessResponse(success=True, data={}, meta=meta), kind, target, TARGETS, tenant, "sk_live_abcdef123456",
+        [], NOW, request=request,
+    )
+
+
+def test_llm_prompts_kept_redacted():
+    """Test that LLM messages are stored as the provider saw them, placeholders included."""
+    section = replay_section("llm", LLM_REQUEST, Redactor({}), 64 * 1024)
+
+    assert section["unavailable"] is None
+    assert section["request"]["messages"] == [{"role": "user", "content": "Write to [EMAIL_1]"}]
+    assert LLM_REQUEST["messages"][0]["content"] == "Write to ada@example.com"
+
+
+@pytest.mark.parametrize("kind,request_body,reason", [
+    ("http", {"target": "billing", "method": "POST", "path": "/charge", "body": '{"email": "ada@example.com"}'},
+     "redaction replaced"),
+    ("llm", {"target": "openai", "conversation_id": "c1", "append_messages": []}, "conversation turns"),
+    ("llm", {**LLM_REQUEST, "messages": [{"role": "user", "content": "x" * 100}]}, "more than the 64 captured"),
+    ("graphql", {"target": "api"}, "graphql requests"),
+])
+def test_unreplayable_requests(kind, request_body, reason):
+    section = replay_section(kind, request_body, Redactor({}), 64)
+    assert section["request"] is None
+    assert reason in section["unavailable"]
+
+
+def test_replay_body_drops_idempotency_and_applies_overrides():
+    _record("req_1", "llm", "openai", LLM_REQUEST)
+    record = audit_record("req_1", None, admin=True)
+
+    body = replay_body(record, model="gpt-4o", temperature=0.2, target="anthropic")
+
+    assert "idempotency_key" not in body
+    assert body["model"] == "gpt-4o" and body["temperature"] == 0.2 and body["target"] == "anthropic"
+    assert body["stream"] is False and body["dry_run"] is False and body["cache"] == 600
+
+
+def test_replay_body_without_capture():
+    _record("req_meta", "llm", "search", LLM_REQUEST)
+    with pytest.raises(ReplayUnavailable, match="was not 'full'"):
+        replay_body(audit_record("req_meta", None, admin=True))
+
+
+def test_replay_body_rejects_llm_overrides_for_http():
+    _record("req_http", "http", "billing", {"target": "billing", "method": "GET", "path": "/invoices"})
+    with pytest.raises(ValueError, match="only apply"):
+        replay_body(audit_record("req_http", None, admin=True), model="gpt-4o")
+
+
+def test_stored_request_is_for_the_admin_key_only():
+    _record("req_1", "llm", "openai", LLM_REQUEST)
+    assert audit_record("req_1", "acme")["replay"] is None
+    assert audit_record("req_1", None, admin=True)["replay"]["request"]["model"] == "gpt-4o-mini"
+
+
+def test_skip_cache_reads():
+    """Test that lookups miss inside skip_cache_reads and hit outside it."""
+    cache = Cache.__new__(Cache)
+    cache.enabled, cache.client = True, MagicMock()
+    cache.client.get.return_value = '{"value": 1}'
+    with skip_cache_reads():
+        assert cache.get_entry("abc") is None
+        assert cache.semantic_candidates("scope") == []
+    cache.client.get.assert_not_called()
+
+
+class TestReplayRoute:
+    """Tests for POST /replay/{request_id}."""
+
+    @staticmethod
+    def _client():
+        app = FastAPI()
+        app.include_router(router)
+        return TestClient(app)
+
+    def test_rejects_non_admin_key(self, monkeypatch):
+        monkeypatch.setenv("RELIAPI_ADMIN_KEY", "admin-secret")
+        response = self._client().post("/replay/req_1", headers={"X-API-Key": "reliapi_regular_key"})
+        assert response.status_code == 403
+
+    def test_replays_through_the_proxy_route(self, monkeypatch):
+        """Test that the replay runs for the original tenant without its idempotency key or cache hits."""
+        monkeypatch.setenv("RELIAPI_ADMIN_KEY", "admin-secret")
+        _record("req_1", "llm", "openai", LLM_REQUEST)
+        seen = {}
+
+        async def proxy_llm(request, http_request, mode):
+            seen["request"], seen["replay"] = request, current_replay()
+            seen["cached"] = Cache.get(MagicMock(enabled=True, client=MagicMock()), "POST", "https://x", allow_post=True)
+            return JSONResponse({"success": True})
+
+        with patch("reliapi.app.routes.replay.proxy_llm", AsyncMock(side_effect=proxy_llm)):
+            response = self._client().post(
+                "/replay/req_1", json={"temperature": 0.5}, headers={"X-API-Key": "admin-secret"}
+            )
+
+        assert response.status_code == 200
+        assert seen["request"].idempotency_key is None and seen["request"].temperature == 0.5
+        assert seen["replay"].request_id == "req_1" and seen["replay"].tenant == "acme"
+        assert seen["cached"] is None
+
+    def test_unavailable_replay(self, monkeypatch):
+        monkeypatch.setenv("RELIAPI_ADMIN_KEY", "admin-secret")
+        _record("req_http", "http", "billing", {"target": "billing", "method": "POST", "path": "/x", "body": "ada@example.com"})
+
+        response = self._client().post("/replay/req_http", headers={"X-API-Key": "admin-secret"})
+
+        assert response.status_code == 409
+        assert response.json()["detail"]["error"]["code"] == "REPLAY_UNAVAILABLE"
+        assert self._client().post("/replay/req_none", headers={"X-API-Key": "admin-secret"}).status_code == 404
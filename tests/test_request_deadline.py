@@ -0,0 +1,194 @@
+"""Tests for deadline-aware retries and the forwarded X-ReliAPI-Deadline-Ms."""
+import asyncio
+import time
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+from fastapi import HTTPException
+
+from reliapi.app import services
+from reliapi.app.routes.proxy import _deadline_timeout_ms
+from reliapi.app.services import handle_http_proxy
+from reliapi.core.cache import Cache
+from reliapi.core.http_client import DeadlineTooShortError, UpstreamHTTPClient
+from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.latency import LatencyTracker
+from reliapi.core.retry import RequestRetryPolicy, RetryStats
+
+
+@pytest.fixture(autouse=True)
+def fresh_state():
+    """Isolate the process-wide circuit breakers and latencies between tests."""
+    services._circuit_breakers.clear()
+    services._latencies.reset()
+    yield
+    services._circuit_breakers.clear()
+    services._latencies.reset()
+
+
+@pytest.fixture
+def mock_targets():
+    return {"api": {"base_url": "https://api.example.com", "max_timeout_ms": 5000}}
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.get_entry.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+def _failing(delay_s=0.0):
+    """Upstream answering every call with a 503 after delay_s, recording
+    when each call was made."""
+    calls = []
+
+    async def request(*args, **kwargs):
+        calls.append(time.monotonic())
+        await asyncio.sleep(delay_s)
+        return httpx.Response(503, request=httpx.Request("GET", "https://api.example.com/items"))
+
+    return AsyncMock(side_effect=request), calls
+
+
+def test_p50():
+    tracker = LatencyTracker(window=4, min_samples=3)
+    tracker.observe("api", 0.1)
+    tracker.observe("api", 0.3)
+    assert tracker.p50("api") is None
+
+    for latency_s in (0.2, 0.9, 0.8):
+        tracker.observe("api", latency_s)
+    # The window holds 0.3, 0.2, 0.9 and 0.8
+    assert tracker.p50("api") == pytest.approx(0.55)
+    assert tracker.p50("other") is None
+
+
+@pytest.mark.asyncio
+async def test_no_call_after_deadline():
+    """Test that retries whose backoff ends past the deadline are skipped."""
+    client = UpstreamHTTPClient("https://api.example.com", deadline_s=0.3)
+    upstream, calls = _failing()
+    stats = RetryStats()
+
+    started = time.monotonic()
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        with pytest.raises(httpx.HTTPStatusError):
+            await client.request(
+                "GET", "/items", retry_policy=RequestRetryPolicy(max_attempts=4, backoff_ms=120), retry_stats=stats
+            )
+    await client.close()
+
+    # Attempts at 0 and after 120ms; the next one would start at 360ms
+    assert len(calls) == 2
+    assert all(at - started < 0.3 for at in calls)
+    assert stats.skipped_for_deadline == 2
+    assert time.monotonic() - started < 0.3
+
+
+@pytest.mark.asyncio
+async def test_retry_needs_time_for_an_attempt():
+    """Test that a retry is skipped when an attempt of the usual length can't finish."""
+    client = UpstreamHTTPClient("https://api.example.com", deadline_s=0.5, expected_attempt_s=0.25)
+    upstream, calls = _failing(delay_s=0.2)
+    stats = RetryStats()
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        with pytest.raises(httpx.HTTPStatusError):
+            await client.request(
+                "GET", "/items", retry_policy=RequestRetryPolicy(max_attempts=3, backoff_ms=100), retry_stats=stats
+            )
+    await client.close()
+
+    assert len(calls) == 1
+    assert stats.skipped_for_deadline == 2
+
+
+@pytest.mark.asyncio
+async def test_deadline_too_short_fails_fast():
+    client = UpstreamHTTPClient("https://api.example.com", deadline_s=0.1, expected_attempt_s=0.4)
+    upstream, calls = _failing()
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        with pytest.raises(DeadlineTooShortError):
+            await client.request("GET", "/items")
+    await client.close()
+
+    assert calls == []
+
+
+async def _get(targets, cache, **kwargs):
+    return await handle_http_proxy(
+        target_name="api",
+        method="GET",
+        path="/items",
+        headers=None,
+        query=None,
+        body=None,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=Mock(spec=IdempotencyManager),
+        request_id="req_deadline",
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_http_deadline_too_short(mock_targets, mock_cache):
+    for _ in range(5):
+        services._latencies.observe("api", 0.5)
+    upstream, calls = _failing()
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await _get(mock_targets, mock_cache, timeout_ms=100)
+
+    assert not result.success
+    assert result.error.code == "DEADLINE_TOO_SHORT"
+    assert result.error.status_code == 400
+    assert not result.error.retryable
+    assert result.error.details == {"deadline_ms": 100, "p50_latency_ms": 500}
+    assert calls == []
+
+
+@pytest.mark.asyncio
+async def test_http_reports_skipped_attempts(mock_targets, mock_cache):
+    upstream, calls = _failing()
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await _get(
+            mock_targets,
+            mock_cache,
+            timeout_ms=300,
+            retry={"max_attempts": 3, "backoff_ms": 1000},
+        )
+
+    assert not result.success
+    assert len(calls) == 1
+    assert result.meta.attempts == 1
+    assert result.meta.attempts_skipped_for_deadline == 2
+    # The attempt is observed for the next requests' deadlines
+    assert services._latencies._samples["api"]
+
+
+@pytest.mark.parametrize("header,timeout_ms,expected", [
+    (None, 2000, 2000),
+    ("1500", None, 1500),
+    ("1500", 800, 800),
+    ("1500", 2000, 1500),
+    ("60000", None, 5000),
+])
+def test_forwarded_deadline(mock_targets, header, timeout_ms, expected):
+    request = Mock(headers={"X-ReliAPI-Deadline-Ms": header} if header else {})
+    assert _deadline_timeout_ms(request, timeout_ms, mock_targets["api"]) == expected
+
+
+@pytest.mark.parametrize("header", ["0", "soon"])
+def test_invalid_forwarded_deadline(mock_targets, header):
+    with pytest.raises(HTTPException) as excinfo:
+        _deadline_timeout_ms(Mock(headers={"X-ReliAPI-Deadline-Ms": header}), None, mock_targets["api"])
+    assert excinfo.value.status_code == 400
@@ -0,0 +1,158 @@
+"""Tests for core/request_signing.py RequestSigningMiddleware."""
+import json
+import time
+
+import pytest
+
+from reliapi.core.request_signing import NonceCache, RequestSigningMiddleware, RequestVerifier, sign
+
+VERIFIER = RequestVerifier({"ci": ("s3cret", "sk-pro-ci")}, max_skew_s=300)
+
+
+def _app():
+    """An ASGI app recording the body and headers it received."""
+    seen = {}
+
+    async def app(scope, receive, send):
+        message = await receive()
+        seen["body"] = message["body"]
+        seen["headers"] = dict(scope["headers"])
+        await send({"type": "http.response.start", "status": 200, "headers": []})
+        await send({"type": "http.response.body", "body": b"{}"})
+
+    return app, seen
+
+
+def _signed(body, nonce="n1", timestamp=None, secret="s3cret", target="/v1/proxy/llm"):
+    timestamp = str(int(time.time())) if timestamp is None else timestamp
+    return [
+        ("x-reliapi-key-id", "ci"),
+        ("x-reliapi-timestamp", timestamp),
+        ("x-reliapi-nonce", nonce),
+        ("x-reliapi-signature", sign(secret, "POST", target, body, timestamp, nonce)),
+    ]
+
+
+async def _call(app, body=b"", headers=(), path="/v1/proxy/llm", query=b"", verifier=VERIFIER):
+    scope = {
+        "type": "http",
+        "method": "POST",
+        "path": path,
+        "query_string": query,
+        "headers": [(k.encode(), v.encode()) for k, v in headers],
+    }
+    messages = [{"type": "http.request", "body": body, "more_body": False}]
+    sent = []
+
+    async def receive():
+        return messages.pop(0) if messages else {"type": "http.disconnect"}
+
+    async def send(message):
+        sent.append(message)
+
+    await RequestSigningMiddleware(app, lambda: verifier)(scope, receive, send)
+    return sent[0]["status"], b"".join(m.get("body", b"") for m in sent[1:])
+
+
+@pytest.fixture(autouse=True)
+def fresh_nonces():
+    VERIFIER.nonces.reset()
+    yield
+    VERIFIER.nonces.reset()
+
+
+@pytest.mark.asyncio
+async def test_signed_request_acts_as_its_api_key():
+    """Test that a verified request reaches the route with the key's API key."""
+    body = b'{"target": "openai"}'
+    app, seen = _app()
+    status, _ = await _call(app, body, _signed(body) + [("x-api-key", "sk-free-spoofed")])
+
+    assert status == 200
+    assert seen["body"] == body
+    assert seen["headers"][b"x-api-key"] == b"sk-pro-ci"
+
+
+@pytest.mark.asyncio
+async def test_unsigned_request_passes_through():
+    """Test that X-API-Key auth keeps working without a signature."""
+    app, seen = _app()
+    status, _ = await _call(app, b"{}", [("x-api-key", "sk-dev-1")], verifier=None)
+    assert status == 200
+    assert seen["headers"][b"x-api-key"] == b"sk-dev-1"
+
+
+@pytest.mark.asyncio
+async def test_replayed_nonce_rejected():
+    """Test that a request can't be sent twice with the same nonce."""
+    body = b"{}"
+    headers = _signed(body)
+    app, _ = _app()
+    assert (await _call(app, body, headers))[0] == 200
+    status, raw = await _call(app, body, headers)
+
+    assert status == 401
+    error = json.loads(raw)["error"]
+    assert error["code"] == "UNAUTHORIZED"
+    assert "nonce" in error["message"]
+    # A fresh nonce is accepted
+    assert (await _call(app, body, _signed(body, nonce="n2")))[0] == 200
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("offset", [-301, 301])
+async def test_skewed_clock_rejected(offset):
+    """Test that timestamps outside max_skew_s are rejected either way."""
+    body = b"{}"
+    app, seen = _app()
+    status, raw = await _call(app, body, _signed(body, timestamp=str(int(time.time()) + offset)))
+    assert status == 401
+    assert "clock" in json.loads(raw)["error"]["message"]
+    assert seen == {}
+    # Within the skew is fine
+    assert (await _call(app, body, _signed(body, timestamp=str(int(time.time()) - 200))))[0] == 200
+
+
+@pytest.mark.asyncio
+async def test_body_mutated_after_signing_rejected():
+    """Test that the signature covers the body, query and secret."""
+    app, seen = _app()
+    headers = _signed(b'{"max_tokens": 10}')
+    status, raw = await _call(app, b'{"max_tokens": 10000}', headers)
+    assert status == 401
+    assert "signature" in json.loads(raw)["error"]["message"]
+
+    status, _ = await _call(app, b"{}", _signed(b"{}", target="/v1/proxy/llm"), query=b"debug=1")
+    assert status == 401
+    status, _ = await _call(app, b"{}", _signed(b"{}", secret="guess"))
+    assert status == 401
+    assert seen == {}
+
+
+@pytest.mark.asyncio
+async def test_unknown_key_and_unconfigured_signing_rejected():
+    """Test that signatures are rejected without a matching key."""
+    app, _ = _app()
+    headers = [(k, "other" if k == "x-reliapi-key-id" else v) for k, v in _signed(b"")]
+    status, raw = await _call(app, b"", headers)
+    assert status == 401
+    assert "Unknown signing key 'other'" in json.loads(raw)["error"]["message"]
+
+    status, raw = await _call(app, b"", _signed(b""), verifier=None)
+    assert status == 401
+    assert "not configured" in json.loads(raw)["error"]["message"]
+
+
+def test_nonce_cache_prunes_expired():
+    """Test that nonces expire after their TTL and are pruned as they do."""
+    nonces = NonceCache()
+    for i in range(20000):
+        assert nonces.add("ci", f"n{i}", 600, now=1000.0 + i / 100)
+    assert len(nonces) == 20000
+    assert not nonces.add("ci", "n0", 600, now=1500.0)
+
+    # At 1700, the 10001 nonces added up to 1100 have expired
+    assert nonces.add("ci", "n0", 600, now=1700.0)
+    assert len(nonces) == 20000 - 10001 + 1
+    assert not nonces.add("ci", "n0", 60, now=1701.0)
+    assert nonces.add("other", "n19999", 600, now=1701.0)
@@ -0,0 +1,154 @@
+"""Tests for the per-request timeout_ms of /proxy/http and /proxy/llm."""
+import asyncio
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+
+from reliapi.app import services
+from reliapi.app.services import handle_http_proxy, handle_llm_proxy
+from reliapi.core.cache import Cache
+from reliapi.core.http_client import UpstreamHTTPClient, UpstreamTimeoutError
+from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.retry import RequestRetryPolicy
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers and latencies between tests."""
+    services._circuit_breakers.clear()
+    services._latencies.reset()
+    yield
+    services._circuit_breakers.clear()
+    services._latencies.reset()
+
+
+@pytest.fixture
+def mock_targets():
+    return {
+        "api": {"base_url": "https://api.example.com", "timeout_ms": 20000, "max_timeout_ms": 5000},
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "llm": {"provider": "openai", "default_model": "gpt-4o-mini"},
+        },
+    }
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.get_entry.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+def _slow(first_error=None):
+    """Upstream whose first call fails with first_error, if given, and whose
+    other calls never answer in time."""
+    calls = 0
+
+    async def request(*args, **kwargs):
+        nonlocal calls
+        calls += 1
+        if calls == 1 and first_error:
+            raise first_error
+        await asyncio.sleep(5)
+
+    return AsyncMock(side_effect=request)
+
+
+async def _get(targets, cache, **kwargs):
+    return await handle_http_proxy(
+        target_name="api",
+        method="GET",
+        path="/items",
+        headers=None,
+        query=None,
+        body=None,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=Mock(spec=IdempotencyManager),
+        request_id="req_timeout",
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_deadline_covers_retries():
+    """Test that the deadline bounds retries and backoff, not each attempt."""
+    client = UpstreamHTTPClient("https://api.example.com", timeout_s=20.0, deadline_s=0.2)
+    upstream = _slow(httpx.ConnectError("connection refused"))
+    policy = RequestRetryPolicy(max_attempts=5, backoff_ms=10)
+
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        with pytest.raises(UpstreamTimeoutError) as info:
+            await client.request("GET", "/items", retry_policy=policy)
+    await client.close()
+
+    assert info.value.attempts_completed == 1
+    assert upstream.call_count == 2
+
+
+@pytest.mark.asyncio
+async def test_http_timeout(mock_targets, mock_cache):
+    with patch.object(httpx.AsyncClient, "request", new=_slow()):
+        result = await _get(mock_targets, mock_cache, timeout_ms=100)
+
+    assert not result.success
+    assert result.error.code == "UPSTREAM_TIMEOUT"
+    assert result.error.status_code == 504
+    assert result.error.retryable
+    assert result.error.details == {"timeout_ms": 100, "attempts_completed": 0}
+    assert 100 <= result.meta.duration_ms < 2000
+
+
+@pytest.mark.asyncio
+async def test_attempt_timeout(mock_targets):
+    """Test that a timeout_ms past the target's timeout_ms lets one call run that long."""
+    longer, _, _ = services.create_http_client(mock_targets["api"], "api", request_timeout_ms=30000)
+    shorter, _, _ = services.create_http_client(mock_targets["api"], "api", request_timeout_ms=100)
+
+    assert (longer.client.timeout.read, longer.deadline_s) == (30.0, 30.0)
+    assert (shorter.client.timeout.read, shorter.deadline_s) == (20.0, 0.1)
+    await longer.close()
+    await shorter.close()
+
+
+@pytest.mark.asyncio
+async def test_timeout_above_target_max_rejected(mock_targets, mock_cache):
+    upstream = AsyncMock()
+    with patch.object(httpx.AsyncClient, "request", new=upstream):
+        result = await _get(mock_targets, mock_cache, timeout_ms=10000)
+
+    assert result.error.code == "BAD_REQUEST"
+    assert result.error.details == {"timeout_ms": 10000, "max_timeout_ms": 5000}
+    upstream.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_llm_timeout(mock_targets, mock_cache):
+    with patch.object(httpx.AsyncClient, "request", new=_slow()):
+        result = await handle_llm_proxy(
+            target_name="openai",
+            messages=[{"role": "user", "content": "Hi"}],
+            model=None,
+            max_tokens=None,
+            temperature=None,
+            top_p=None,
+            stop=None,
+            stream=False,
+            idempotency_key=None,
+            cache_ttl=None,
+            targets=mock_targets,
+            cache=mock_cache,
+            idempotency=Mock(spec=IdempotencyManager),
+            request_id="req_llm_timeout",
+            timeout_ms=100,
+        )
+
+    assert result.error.code == "UPSTREAM_TIMEOUT"
+    assert result.error.details["attempts_completed"] == 0
+    mock_cache.set.assert_not_called()
@@ -0,0 +1,88 @@
+"""Tests for response field filtering."""
+import pytest
+
+from reliapi.app.schemas import MetaResponse, SuccessResponse
+from reliapi.app.services import _filtered_cache_entry, apply_response_filter
+from reliapi.core.response_filter import FilterSyntaxError, parse_response_filter, payload_size
+
+COMPLETION = {
+    "id": "chatcmpl-1",
+    "choices": [
+        {"index": 0, "message": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"},
+        {"index": 1, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"},
+    ],
+    "usage": {"prompt_tokens": 3, "completion_tokens": 1},
+}
+
+
+@pytest.mark.parametrize("expression,expected", [
+    ("usage", {"usage": {"prompt_tokens": 3, "completion_tokens": 1}}),
+    ("choices[0].message.content", {"choices": [{"message": {"content": "Hi"}}]}),
+    ("choices[-1].index", {"choices": [{"index": 1}]}),
+    ("choices[*].finish_reason", {"choices": [{"finish_reason": "stop"}, {"finish_reason": "stop"}]}),
+    ("choices[1].index, choices[0].index", {"choices": [{"index": 0}, {"index": 1}]}),
+    ('"id", usage.prompt_tokens', {"id": "chatcmpl-1", "usage": {"prompt_tokens": 3}}),
+    ("missing, choices[5]", {}),
+])
+def test_filter_keeps_selected_fields(expression, expected):
+    assert parse_response_filter(expression).apply(COMPLETION) == expected
+
+
+def test_filter_is_idempotent():
+    selection = parse_response_filter("choices[-1].message, usage")
+    once = selection.apply(COMPLETION)
+    assert selection.apply(once) == once
+
+
+@pytest.mark.parametrize("expression,position", [
+    ("choices[0].message.content, usage]", 33),
+    ("choices[", 8),
+    ("choices[x]", 8),
+    ("usage.", 6),
+    ('"unterminated', 0),
+    ("", 0),
+])
+def test_syntax_errors_name_the_position(expression, position):
+    with pytest.raises(FilterSyntaxError) as excinfo:
+        parse_response_filter(expression)
+    assert excinfo.value.position == position
+    assert str(excinfo.value).endswith(f"at position {position}")
+
+
+def _result(data):
+    return SuccessResponse(success=True, data=data, meta=MetaResponse(duration_ms=1, request_id="req_1"))
+
+
+def test_apply_to_llm_result_reports_sizes():
+    result = _result(dict(COMPLETION))
+    apply_response_filter(result, "usage", "llm")
+
+    assert result.data == {"usage": COMPLETION["usage"]}
+    assert result.meta.original_bytes == payload_size(COMPLETION)
+    assert result.meta.filtered_bytes == payload_size(result.data)
+    assert result.meta.filtered_bytes < result.meta.original_bytes
+
+
+def test_apply_to_http_result_filters_body_only():
+    result = _result({"status_code": 200, "headers": {}, "body": COMPLETION})
+    apply_response_filter(result, "id", "http")
+
+    assert result.data == {"status_code": 200, "headers": {}, "body": {"id": "chatcmpl-1"}}
+    assert result.meta.original_bytes == payload_size(COMPLETION)
+
+
+def test_binary_http_body_left_alone():
+    data = {"status_code": 200, "body": "AAEC", "body_encoding": "base64"}
+    result = _result(dict(data))
+    apply_response_filter(result, "id", "http")
+
+    assert result.data == data
+    assert result.meta.original_bytes is None
+
+
+def test_cached_entry_filtered_before_cache():
+    entry = {"status_code": 200, "body": COMPLETION}
+    assert _filtered_cache_entry(entry, "usage.completion_tokens", "http")["body"] == {
+        "usage": {"completion_tokens": 1}
+    }
+    assert _filtered_cache_entry(entry, None, "http") is entry
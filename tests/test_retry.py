@@ -1,8 +1,13 @@
 """Tests for retry engine with Retry-After support and key pool fallback."""
 import asyncio
+from unittest.mock import AsyncMock, patch
+
+import httpx
 import pytest
 
-from reliapi.core.retry import RetryEngine, RetryMatrix
+from reliapi.core.circuit_breaker import CircuitBreaker
+from reliapi.core.http_client import UpstreamHTTPClient
+from reliapi.core.retry import RequestRetryPolicy, RetryEngine, RetryMatrix, RetryStats
 
 
 @pytest.mark.asyncio
@@ -169,3 +174,56 @@ async def test_retry_classifies_errors_correctly():
     assert result == "success"
     assert call_count == 2  # Initial + 1 retry (attempts=2)
 
+
+def _upstream_client() -> UpstreamHTTPClient:
+    return UpstreamHTTPClient(
+        base_url="https://api.example.com",
+        circuit_breaker=CircuitBreaker(failures_to_open=100),
+    )
+
+
+def _status_response(status: int) -> httpx.Response:
+    return httpx.Response(status, request=httpx.Request("GET", "https://api.example.com/x"))
+
+
+@pytest.mark.asyncio
+async def test_request_retry_policy_single_attempt_on_timeout():
+    """max_attempts=1 calls the upstream once, even when it times out."""
+    client = _upstream_client()
+    stats = RetryStats()
+    upstream = AsyncMock(side_effect=httpx.ReadTimeout("timed out"))
+    with patch.object(client.client, "request", upstream):
+        with pytest.raises(httpx.ReadTimeout):
+            await client.request(
+                "GET", "/x", retry_policy=RequestRetryPolicy(max_attempts=1), retry_stats=stats
+            )
+    assert upstream.await_count == 1
+    assert stats.attempts == 1
+    assert stats.delays_ms == []
+
+
+@pytest.mark.asyncio
+async def test_request_retry_policy_retries_listed_statuses():
+    """Statuses in retry_on are retried up to max_attempts with recorded delays."""
+    client = _upstream_client()
+    stats = RetryStats()
+    upstream = AsyncMock(side_effect=[_status_response(503), _status_response(503), _status_response(200)])
+    policy = RequestRetryPolicy(max_attempts=5, backoff_ms=10, max_backoff_ms=15)
+    with patch.object(client.client, "request", upstream):
+        response = await client.request("GET", "/x", retry_policy=policy, retry_stats=stats)
+    assert response.status_code == 200
+    assert upstream.await_count == 3
+    assert stats.attempts == 3
+    assert stats.delays_ms == [10, 15]
+
+
+@pytest.mark.asyncio
+async def test_request_retry_policy_skips_unlisted_statuses():
+    """Statuses missing from retry_on fail on the first attempt."""
+    client = _upstream_client()
+    upstream = AsyncMock(return_value=_status_response(503))
+    policy = RequestRetryPolicy(max_attempts=5, backoff_ms=0, retry_on=[429])
+    with patch.object(client.client, "request", upstream):
+        with pytest.raises(httpx.HTTPStatusError):
+            await client.request("GET", "/x", retry_policy=policy)
+    assert upstream.await_count == 1
@@ -6,7 +6,7 @@ This module tests the business route endpoints:
 - Health check endpoints
 """
 import json
-from datetime import datetime
+from datetime import datetime, timezone
 from unittest.mock import AsyncMock, MagicMock, patch
 
 import pytest
@@ -337,6 +337,28 @@ class TestHealthRoutes:
             assert response.status_code == 200
             data = response.json()
             assert data["status"] == "ready"
+            assert data["components"]["cache"]["status"] == "ok"
+
+    def test_readyz_without_cache(self):
+        """Test that /readyz answers 503 with the component that failed."""
+        from reliapi.app.routes.health import router
+        from fastapi import FastAPI
+
+        with patch("reliapi.app.routes.health.get_app_state") as mock_state:
+            mock_state.return_value = MagicMock(rate_limiter=None)
+            mock_state.return_value.cache.ping.return_value = False
+
+            app = FastAPI()
+            app.include_router(router)
+            client = TestClient(app)
+
+            response = client.get("/readyz")
+
+            assert response.status_code == 503
+            data = response.json()
+            assert data["status"] == "not_ready"
+            assert data["components"]["cache"]["status"] == "error"
+            assert data["components"]["config"]["status"] == "ok"
 
     def test_livez_endpoint(self):
         """Test /livez endpoint."""
@@ -397,6 +419,469 @@ class TestProxyRoutes:
         assert isinstance(is_valid, bool)
 
 
+class TestCacheRoutes:
+    """Tests for cache management endpoints."""
+
+    @staticmethod
+    def _client(state):
+        from fastapi import FastAPI
+        from reliapi.app.routes.cache import router
+
+        app = FastAPI()
+        app.include_router(router)
+        return TestClient(app), patch("reliapi.app.routes.cache.get_app_state", return_value=state)
+
+    def test_target_purge_rejects_non_admin_key(self, monkeypatch):
+        """Test that a regular API key cannot purge a target's cache."""
+        monkeypatch.setenv("RELIAPI_ADMIN_KEY", "admin-secret")
+        state = MagicMock()
+        client, state_patch = self._client(state)
+
+        with state_patch:
+            response = client.delete(
+                "/cache/targets/openai",
+                headers={"X-API-Key": "reliapi_regular_key"},
+            )
+
+        assert response.status_code == 403
+        assert response.json()["detail"]["error"]["code"] == "FORBIDDEN"
+        state.cache.invalidate_target.assert_not_called()
+
+    def test_target_purge_with_admin_key(self, monkeypatch):
+        """Test that the admin key purges the target's cache."""
+        monkeypatch.setenv("RELIAPI_ADMIN_KEY", "admin-secret")
+        state = MagicMock()
+        state.cache.invalidate_target.return_value = 3
+        client, state_patch = self._client(state)
+
+        with state_patch:
+            response = client.delete(
+                "/cache/targets/openai",
+                headers={"X-API-Key": "admin-secret"},
+            )
+
+        assert response.status_code == 200
+        assert response.json()["data"]["removed"] == 3
+        state.cache.invalidate_target.assert_called_once_with("openai")
+
+
+class TestCircuitRoutes:
+    """Tests for target circuit breaker endpoints."""
+
+    TARGETS = {
+        "openai": {
+            "base_url": "https://api.openai.com/v1/",
+            "circuit": {"error_threshold": 2, "cooldown_s": 30},
+        }
+    }
+
+    @pytest.fixture(autouse=True)
+    def _reset_breakers(self):
+        from reliapi.app import services
+
+        services._circuit_breakers.clear()
+        yield
+        services._circuit_breakers.clear()
+
+    def _client(self):
+        from fastapi import FastAPI
+        from reliapi.app.routes.targets import router
+
+        app = FastAPI()
+        app.include_router(router)
+        state = MagicMock()
+        state.targets = self.TARGETS
+        return TestClient(app), patch("reliapi.app.routes.targets.get_app_state", return_value=state)
+
+    @staticmethod
+    def _breaker():
+        from reliapi.app.services import get_circuit_breaker
+
+        return get_circuit_breaker("openai", TestCircuitRoutes.TARGETS["openai"]["circuit"])
+
+    def test_unknown_target(self):
+        """Test that an unknown target is a 404."""
+        client, state_patch = self._client()
+
+        with state_patch:
+            response = client.get("/targets/missing/circuit", headers={"X-API-Key": "sk-dev-test"})
+
+        assert response.status_code == 404
+        assert response.json()["detail"]["error"]["code"] == "NOT_FOUND"
+
+    def test_open_circuit_status(self):
+        """Test that an open circuit reports its failures and next probe."""
+        breaker = self._breaker()
+        breaker.record_failure("https://api.openai.com/v1")
+        breaker.record_failure("https://api.openai.com/v1")
+        client, state_patch = self._client()
+
+        with state_patch:
+            response = client.get("/targets/openai/circuit", headers={"X-API-Key": "sk-dev-test"})
+
+        assert response.status_code == 200
+        body = response.json()
+        assert body["meta"]["circuit_state"] == "open"
+        assert body["data"]["state"] == "open"
+        assert body["data"]["failure_count"] == 2
+        assert body["data"]["failures_to_open"] == 2
+        assert body["data"]["open_ttl_s"] == 30
+        assert body["data"]["last_failure_at"] is not None
+        assert body["data"]["next_probe_at"] > body["data"]["last_failure_at"]
+
+    def test_reset_rejects_non_admin_key(self, monkeypatch):
+        """Test that a regular API key cannot reset a circuit."""
+        monkeypatch.setenv("RELIAPI_ADMIN_KEY", "admin-secret")
+        breaker = self._breaker()
+        breaker.record_failure("https://api.openai.com/v1")
+        breaker.record_failure("https://api.openai.com/v1")
+        client, state_patch = self._client()
+
+        with state_patch:
+            response = client.post(
+                "/targets/openai/circuit/reset",
+                headers={"X-API-Key": "reliapi_regular_key"},
+            )
+
+        assert response.status_code == 403
+        assert breaker.is_open("https://api.openai.com/v1")
+
+    def test_reset_with_admin_key(self, monkeypatch):
+        """Test that the admin key closes the circuit."""
+        monkeypatch.setenv("RELIAPI_ADMIN_KEY", "admin-secret")
+        breaker = self._breaker()
+        breaker.record_failure("https://api.openai.com/v1")
+        breaker.record_failure("https://api.openai.com/v1")
+        client, state_patch = self._client()
+
+        with state_patch:
+            response = client.post(
+                "/targets/openai/circuit/reset",
+                headers={"X-API-Key": "admin-secret"},
+            )
+
+        assert response.status_code == 200
+        body = response.json()
+        assert body["data"]["state"] == "closed"
+        assert body["data"]["failure_count"] == 0
+        assert body["data"]["next_probe_at"] is None
+        assert not breaker.is_open("https://api.openai.com/v1")
+
+
+class TestTargetCheckRoutes:
+    """Tests for the target upstream check."""
+
+    TARGETS = {
+        "openai": {
+            "base_url": "https://api.openai.com/v1",
+            "llm": {"provider": "openai"},
+            "auth": {"type": "api_key", "header": "Authorization", "prefix": "Bearer ", "api_key": "sk-up"},
+        },
+        "down": {"base_url": "http://down.example.com"},
+    }
+
+    @pytest.fixture(autouse=True)
+    def _reset_checks(self):
+        from reliapi.app import services
+
+        services._target_checks.clear()
+        yield
+        services._target_checks.clear()
+
+    def _get(self, target, handler):
+        import httpx
+        from fastapi import FastAPI
+        from reliapi.app.routes.targets import router
+
+        app = FastAPI()
+        app.include_router(router)
+        state = MagicMock(key_pool_manager=None)
+        state.targets = self.TARGETS
+        real_client = httpx.AsyncClient
+        expires = datetime(2027, 1, 1, tzinfo=timezone.utc)
+        with patch("reliapi.app.routes.targets.get_app_state", return_value=state), patch(
+            "reliapi.app.services.httpx.AsyncClient",
+            side_effect=lambda **kw: real_client(transport=httpx.MockTransport(handler), **kw),
+        ), patch("reliapi.app.services._tls_expiry", AsyncMock(return_value=expires)):
+            return TestClient(app).get(f"/targets/{target}/check", headers={"X-API-Key": "sk-dev-test"})
+
+    def test_probe_is_authenticated_and_rate_limited(self):
+        """Test that LLM targets are probed at /models with their credentials, once per interval."""
+        import httpx
+
+        seen = []
+
+        def handler(request):
+            seen.append(request)
+            return httpx.Response(200, json={"data": []})
+
+        first = self._get("openai", handler).json()["data"]
+        second = self._get("openai", handler).json()["data"]
+
+        assert len(seen) == 1
+        assert seen[0].method == "GET" and str(seen[0].url) == "https://api.openai.com/v1/models"
+        assert seen[0].headers["Authorization"] == "Bearer sk-up"
+        assert first["status"] == "ok" and first["status_code"] == 200 and not first["cached"]
+        assert first["tls_expires_at"].startswith("2027-01-01")
+        assert second["cached"] is True
+
+    def test_auth_failure_and_unreachable(self):
+        """Test that a 401 and a connection error are reported as statuses."""
+        import httpx
+
+        denied = self._get("openai", lambda request: httpx.Response(401)).json()["data"]
+
+        def refuse(request):
+            raise httpx.ConnectError("connection refused", request=request)
+
+        down = self._get("down", refuse)
+
+        assert denied["status"] == "auth_failed"
+        assert down.status_code == 200
+        assert down.json()["data"]["status"] == "unreachable"
+        assert down.json()["data"]["method"] == "HEAD"
+        assert "refused" in down.json()["data"]["error"]
+
+
+class TestCredentialRoutes:
+    """Tests for target credential endpoints."""
+
+    TARGETS = {
+        "openai": {
+            "base_url": "https://api.openai.com/v1/",
+            "credentials": [{"name": "org-a", "api_key": "sk-a", "weight": 2.0}],
+        }
+    }
+
+    @pytest.fixture(autouse=True)
+    def _reset_credentials(self, monkeypatch):
+        from reliapi.app import services
+
+        monkeypatch.setenv("RELIAPI_ADMIN_KEY", "admin-secret")
+        services._credentials.reset()
+        yield
+        services._credentials.reset()
+
+    def _client(self):
+        from fastapi import FastAPI
+        from reliapi.app.routes.targets import router
+
+        app = FastAPI()
+        app.include_router(router)
+        state = MagicMock()
+        state.targets = self.TARGETS
+        return TestClient(app), patch("reliapi.app.routes.targets.get_app_state", return_value=state)
+
+    def test_list_rejects_non_admin_key(self):
+        """Test that a regular API key cannot list credentials."""
+        client, state_patch = self._client()
+
+        with state_patch:
+            response = client.get("/targets/openai/credentials", headers={"X-API-Key": "reliapi_regular_key"})
+
+        assert response.status_code == 403
+
+    def test_add_disable_and_enable(self):
+        """Test that credentials can be added and taken out of rotation."""
+        client, state_patch = self._client()
+        headers = {"X-API-Key": "admin-secret"}
+
+        with state_patch:
+            added = client.put(
+                "/targets/openai/credentials/org-b", json={"api_key": "sk-b", "weight": 0.5}, headers=headers
+            )
+            disabled = client.post("/targets/openai/credentials/org-a/disable", headers=headers)
+            enabled = client.post("/targets/openai/credentials/org-a/enable", headers=headers)
+
+        assert added.status_code == 200
+        credentials = added.json()["data"]["credentials"]
+        assert [(c["name"], c["source"], c["weight"]) for c in credentials] == [
+            ("org-a", "config", 2.0),
+            ("org-b", "admin", 0.5),
+        ]
+        assert all("api_key" not in c for c in credentials)
+        assert disabled.json()["data"]["credentials"][0]["status"] == "disabled"
+        assert enabled.json()["data"]["credentials"][0]["status"] == "active"
+
+    def test_unknown_credential_and_bad_name(self):
+        """Test that unknown credentials are a 404 and bad names a 400."""
+        client, state_patch = self._client()
+        headers = {"X-API-Key": "admin-secret"}
+
+        with state_patch:
+            missing = client.post("/targets/openai/credentials/org-z/disable", headers=headers)
+            bad_name = client.put("/targets/openai/credentials/org a", json={"api_key": "sk"}, headers=headers)
+
+        assert missing.status_code == 404
+        assert missing.json()["detail"]["error"]["code"] == "NOT_FOUND"
+        assert bad_name.status_code == 400
+
+
+class TestUpstreamRateLimitRoute:
+    """Tests for GET /targets/{target}/ratelimit."""
+
+    @pytest.fixture(autouse=True)
+    def _reset_limits(self):
+        from reliapi.app import services
+
+        services._upstream_limits.reset()
+        yield
+        services._upstream_limits.reset()
+
+    def test_reports_limits_per_credential(self):
+        """Test that the last reported limit of each credential is returned."""
+        from fastapi import FastAPI
+        from reliapi.app import services
+        from reliapi.app.routes.targets import router
+
+        app = FastAPI()
+        app.include_router(router)
+        state = MagicMock()
+        state.targets = {"openai": {"base_url": "https://api.openai.com/v1/"}}
+        services._upstream_limits.observe(
+            "openai", "org-a", 200, {"X-RateLimit-Limit": "10", "X-RateLimit-Remaining": "3", "X-RateLimit-Reset": "60"}
+        )
+
+        with patch("reliapi.app.routes.targets.get_app_state", return_value=state):
+            response = TestClient(app).get("/targets/openai/ratelimit", headers={"X-API-Key": "reliapi_regular_key"})
+            missing = TestClient(app).get("/targets/nope/ratelimit", headers={"X-API-Key": "reliapi_regular_key"})
+
+        assert response.status_code == 200
+        limits = response.json()["data"]["limits"]
+        assert [(l["credential"], l["limit"], l["remaining"]) for l in limits] == [("org-a", 10, 3)]
+        assert limits[0]["reset_at"].endswith("+00:00")
+        assert missing.status_code == 404
+
+
+class TestTargetManagementRoutes:
+    """Tests for the target management endpoints."""
+
+    ADMIN = {"X-API-Key": "admin-secret"}
+
+    @pytest.fixture(autouse=True)
+    def _admin_key(self, monkeypatch):
+        monkeypatch.setenv("RELIAPI_ADMIN_KEY", "admin-secret")
+
+    def _client(self, targets):
+        from fastapi import FastAPI
+        from reliapi.app.routes.targets import router
+        from reliapi.core.target_registry import stamp_versions
+
+        app = FastAPI()
+        app.include_router(router)
+        state = MagicMock()
+        state.targets = stamp_versions(targets)
+        return TestClient(app), state, patch("reliapi.app.routes.targets.get_app_state", return_value=state)
+
+    def test_upsert_bumps_version(self):
+        """Test that creating and replacing a target bumps its version."""
+        client, state, state_patch = self._client({})
+        payload = {
+            "base_url": "https://93.184.216.34/v1",
+            "cache": {"ttl_s": 60},
+            "allowed_methods": ["get"],
+            "allowed_paths": ["/v1/*"],
+        }
+
+        with state_patch:
+            created = client.put("/targets/example", json=payload, headers=self.ADMIN)
+            payload["cache"]["ttl_s"] = 120
+            updated = client.put("/targets/example", json=payload, headers=self.ADMIN)
+
+        assert created.status_code == 200
+        assert created.json()["data"]["created"] is True
+        assert created.json()["data"]["version"] == 1
+        body = updated.json()
+        assert body["data"]["created"] is False
+        assert body["data"]["version"] == 2
+        assert body["meta"]["target_version"] == 2
+        assert body["data"]["config"]["allowed_methods"] == ["GET"]
+        assert state.targets["example"]["cache"]["ttl_s"] == 120
+        assert state.targets["example"]["version"] == 2
+
+    def test_upsert_rejects_private_base_url(self):
+        """Test that a base URL on a private network needs allow_private_network."""
+        client, state, state_patch = self._client({})
+
+        with state_patch:
+            for url in ("http://10.0.0.5", "http://127.0.0.1:8080", "http://[::ffff:192.168.1.1]", "http://169.254.169.254"):
+                response = client.put("/targets/internal", json={"base_url": url}, headers=self.ADMIN)
+                assert response.status_code == 400, url
+                assert response.json()["detail"]["error"]["code"] == "INVALID_TARGET"
+            allowed = client.put(
+                "/targets/internal",
+                json={"base_url": "http://10.0.0.5", "allow_private_network": True},
+                headers=self.ADMIN,
+            )
+
+        assert allowed.status_code == 200
+        assert state.targets["internal"]["version"] == 1
+
+    def test_upsert_rejects_bad_name(self):
+        """Test that target names are restricted to a safe charset."""
+        client, state, state_patch = self._client({})
+
+        with state_patch:
+            response = client.put("/targets/bad name", json={"base_url": "https://93.184.216.34"}, headers=self.ADMIN)
+
+        assert response.status_code == 400
+        assert state.targets == {}
+
+    def test_list_and_delete(self):
+        """Test listing targets and deleting one."""
+        client, state, state_patch = self._client({
+            "b": {"base_url": "https://b.example.com"},
+            "a": {"base_url": "https://a.example.com"},
+        })
+
+        with state_patch:
+            listed = client.get("/targets", headers=self.ADMIN)
+            deleted = client.delete("/targets/a", headers=self.ADMIN)
+            missing = client.delete("/targets/a", headers=self.ADMIN)
+
+        entries = listed.json()["data"]["targets"]
+        assert [e["name"] for e in entries] == ["a", "b"]
+        assert entries[0] == {"name": "a", "version": 1, "config": {"base_url": "https://a.example.com"}}
+        assert deleted.status_code == 200
+        assert deleted.json()["data"]["deleted"] is True
+        assert list(state.targets) == ["b"]
+        assert missing.status_code == 404
+
+    def test_requires_admin_key(self):
+        """Test that a regular API key cannot manage targets."""
+        client, state, state_patch = self._client({"a": {"base_url": "https://a.example.com"}})
+
+        with state_patch:
+            listed = client.get("/targets", headers={"X-API-Key": "reliapi_regular_key"})
+            deleted = client.delete("/targets/a", headers={"X-API-Key": "reliapi_regular_key"})
+
+        assert listed.status_code == 403
+        assert deleted.status_code == 403
+        assert "a" in state.targets
+
+    def test_changes_do_not_touch_in_flight_snapshots(self):
+        """Test that updates publish a new mapping instead of mutating the old one."""
+        from reliapi.core.target_registry import delete_target, stamp_versions, upsert_target
+
+        snapshot = stamp_versions({"a": {"base_url": "https://a.example.com"}})
+        updated, _ = upsert_target(snapshot, "a", {"base_url": "https://b.example.com"})
+        removed = delete_target(updated, "a")
+
+        assert snapshot["a"] == {"base_url": "https://a.example.com", "version": 1}
+        assert updated["a"]["version"] == 2
+        assert removed == {}
+
+    def test_allowed_methods_and_paths(self):
+        """Test that /proxy/http calls outside a target's rules are refused."""
+        from reliapi.app.services import _target_rule_violation
+
+        config = {"allowed_methods": ["GET"], "allowed_paths": ["/v1/*"]}
+        assert _target_rule_violation(config, "get", "/v1/items?page=2") is None
+        assert "Method POST" in _target_rule_violation(config, "POST", "/v1/items")
+        assert "Path /admin" in _target_rule_violation(config, "GET", "/admin?x=/v1/")
+        assert _target_rule_violation({}, "DELETE", "/anything") is None
+
+
 class TestSchemaValidation:
     """Tests for Pydantic schema validation."""
 
@@ -437,6 +922,119 @@ class TestSchemaValidation:
                 path="/users",
             )
 
+    def test_http_proxy_request_body_base64(self):
+        """Test body_base64 is folded into body with body_encoding=base64."""
+        from reliapi.app.schemas import HTTPProxyRequest
+
+        request = HTTPProxyRequest(target="my_api", method="POST", path="/upload", body_base64="AAEC/w==")
+
+        assert request.body == "AAEC/w=="
+        assert request.body_encoding == "base64"
+        assert request.body_base64 is None
+
+    def test_http_proxy_request_body_base64_invalid(self):
+        """Test undecodable base64 and conflicting bodies are rejected."""
+        from reliapi.app.schemas import HTTPProxyRequest
+
+        with pytest.raises(ValueError):
+            HTTPProxyRequest(target="my_api", method="POST", path="/", body="not base64!", body_encoding="base64")
+        with pytest.raises(ValueError):
+            HTTPProxyRequest(target="my_api", method="POST", path="/", body="{}", body_base64="AA==")
+
+    def test_http_response_binary_round_trip(self):
+        """Test a 5 MB binary response survives the JSON envelope byte for byte."""
+        import base64
+        import os
+
+        from reliapi.app.services import _http_response_data, _request_body_bytes
+
+        payload = os.urandom(5 * 1024 * 1024)
+        data = _http_response_data(200, {"Content-Type": "application/octet-stream"}, payload)
+
+        assert data["body_encoding"] == "base64"
+        assert base64.b64decode(data["body"]) == payload
+        assert _request_body_bytes(base64.b64encode(payload).decode(), "base64") == payload
+
+    def test_http_response_text_bodies(self):
+        """Test text responses keep their JSON/raw shape and invalid UTF-8 is base64."""
+        from reliapi.app.services import _http_response_data
+
+        assert _http_response_data(200, {"content-type": "application/json"}, b'{"a": 1}')["body"] == {"a": 1}
+        text = _http_response_data(200, {"content-type": "text/plain; charset=utf-8"}, "héllo".encode())
+        assert text["body"] == {"raw": "héllo"}
+        assert "body_encoding" not in text
+        assert _http_response_data(200, {"content-type": "text/plain"}, b"\xff\xfe")["body_encoding"] == "base64"
+        assert _http_response_data(200, {"content-type": "image/png"}, b"PNG")["body_encoding"] == "base64"
+
+    def test_http_upstream_headers_selection(self):
+        """Test captured headers keep repeated values and drop hop-by-hop ones."""
+        import httpx
+
+        from reliapi.app.services import _upstream_header_lists, _upstream_meta
+
+        headers = httpx.Headers([
+            ("ETag", '"v1"'),
+            ("Link", '<https://api.example.com/items?page=2>; rel="next"'),
+            ("Link", '<https://api.example.com/items?page=9>; rel="last"'),
+            ("Connection", "keep-alive, X-Hop"),
+            ("X-Hop", "1"),
+            ("Transfer-Encoding", "chunked"),
+        ])
+        data = {"status_code": 200, "headers": dict(headers), "upstream_headers": _upstream_header_lists(headers)}
+
+        assert _upstream_meta(data, None) == {"upstream_status": 200}
+        selected = _upstream_meta(data, ["etag", "link", "x-ratelimit-remaining"])
+        assert selected["upstream_headers"] == {
+            "etag": ['"v1"'],
+            "link": [
+                '<https://api.example.com/items?page=2>; rel="next"',
+                '<https://api.example.com/items?page=9>; rel="last"',
+            ],
+        }
+        assert set(_upstream_meta(data, ["*"])["upstream_headers"]) == {"etag", "link"}
+
+        # Entries cached before upstream_headers was stored fall back to headers
+        legacy = {"status_code": 200, "headers": {"ETag": '"v0"', "Connection": "close"}}
+        assert _upstream_meta(legacy, ["*"])["upstream_headers"] == {"etag": ['"v0"']}
+
+    def test_http_proxy_request_query_canonical(self):
+        """Test query scalars and lists are normalized per query_array_format."""
+        from reliapi.app.schemas import HTTPProxyRequest
+
+        query = {"n": 10.0, "f": 1.5e-7, "on": True, "none": None, "tag": ["a", 2], "skip": []}
+        request = HTTPProxyRequest(target="api", method="GET", path="/", query=query)
+        assert request.query == {"n": "10", "f": "0.00000015", "on": "true", "none": "", "tag": ["a", "2"]}
+
+        comma = HTTPProxyRequest(target="api", method="GET", path="/", query=query, query_array_format="comma")
+        assert comma.query["tag"] == "a,2"
+        bracket = HTTPProxyRequest(target="api", method="GET", path="/", query=query, query_array_format="bracket")
+        assert bracket.query["tag[]"] == ["a", "2"] and "tag" not in bracket.query
+
+    def test_http_proxy_request_query_rejects_nesting(self):
+        """Test nested objects and lists of lists are rejected."""
+        from reliapi.app.schemas import HTTPProxyRequest
+
+        for query in ({"filter": {"a": 1}}, {"tag": [["a"]]}, {"tag": [{"a": 1}]}):
+            with pytest.raises(ValueError):
+                HTTPProxyRequest(target="api", method="GET", path="/", query=query)
+
+    def test_http_proxy_request_query_escaped_once(self):
+        """Test unicode, empty and %-looking values reach the upstream URL escaped once."""
+        import httpx
+
+        from reliapi.app.schemas import HTTPProxyRequest
+
+        request = HTTPProxyRequest(
+            target="api", method="GET", path="/s?q=a%20b",
+            query={"name": "héllo wörld", "empty": "", "pct": "100%25"},
+        )
+        url = httpx.Request("GET", f"https://api.example.com{request.path}", params=request.query).url
+
+        assert url.params["q"] == "a b"
+        assert url.params["name"] == "héllo wörld"
+        assert url.params["empty"] == ""
+        assert url.params["pct"] == "100%25"
+
     def test_llm_proxy_request_valid(self):
         """Test valid LLM proxy request."""
         from reliapi.app.schemas import LLMProxyRequest
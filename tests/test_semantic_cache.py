@@ -0,0 +1,164 @@
+"""Tests for semantic cache lookups of LLM requests."""
+import json
+import time
+from unittest.mock import AsyncMock, Mock, patch
+
+import pytest
+
+from reliapi.app import services
+from reliapi.app.services import (
+    SemanticQuery,
+    _cosine_similarity,
+    _final_user_text,
+    _plan_llm_request,
+    _semantic_cache_match,
+    _semantic_scope,
+    handle_llm_proxy,
+)
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+
+TARGET = {
+    "base_url": "https://api.openai.com/v1",
+    "llm": {"provider": "openai", "default_model": "gpt-4o-mini", "embedding_model": "text-embedding-3-small"},
+}
+MESSAGES = [
+    {"role": "system", "content": "Answer briefly."},
+    {"role": "user", "content": "What is the capital of France?"},
+]
+
+
+def _scope(messages=MESSAGES, temperature=None, tools=None, model=None):
+    plan = _plan_llm_request(
+        "openai", TARGET, messages, model, None, temperature, None, None, tools=tools
+    )
+    return _semantic_scope(plan, messages, "text-embedding-3-small")
+
+
+def test_final_user_text():
+    assert _final_user_text(MESSAGES) == "What is the capital of France?"
+    assert _final_user_text(MESSAGES + [{"role": "assistant", "content": "Paris."}]) == "What is the capital of France?"
+    parts = [{"type": "text", "text": "Describe"}, {"type": "text", "text": "briefly"}]
+    assert _final_user_text([{"role": "user", "content": parts}]) == "Describe\nbriefly"
+    # Images can't be compared by their text
+    image = {"type": "image_url", "image_url": {"url": "https://example.com/a.png"}}
+    assert _final_user_text([{"role": "user", "content": parts + [image]}]) is None
+    assert _final_user_text([{"role": "system", "content": "Hi"}]) is None
+
+
+def test_cosine_similarity():
+    assert _cosine_similarity([1.0, 0.0], [2.0, 0.0]) == pytest.approx(1.0)
+    assert _cosine_similarity([1.0, 0.0], [0.0, 1.0]) == 0.0
+    assert _cosine_similarity([1.0], [1.0, 0.0]) == 0.0
+    assert _cosine_similarity([0.0, 0.0], [1.0, 0.0]) == 0.0
+
+
+def test_scope_separates_sampling_and_tools():
+    base = _scope()
+    # Only the final user message is compared by meaning
+    assert _scope(MESSAGES[:1] + [{"role": "user", "content": "France's capital?"}]) == base
+    assert _scope(temperature=0.7) != base
+    tool = {"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}
+    assert _scope(tools=[tool]) != base
+    assert _scope(model="gpt-4o") != base
+    assert _scope([{"role": "system", "content": "Answer at length."}] + MESSAGES[1:]) != base
+
+
+def test_match_takes_most_similar_fresh_entry():
+    cache = Mock(spec=Cache)
+    cache.semantic_candidates.return_value = [
+        ("older", [0.6, 0.8]),
+        ("stale", [1.0, 0.01]),
+        ("best", [1.0, 0.1]),
+    ]
+    entries = {
+        "stale": {"value": {"body": {"content": "stale"}}, "age_s": 90, "stale": True},
+        "best": {"value": {"body": {"content": "Paris."}}, "age_s": 5, "stale": False},
+    }
+    cache.get_entry.side_effect = lambda key, tenant: entries.get(key)
+    query = SemanticQuery(scope="s", embedding=[1.0, 0.0])
+
+    key, value, similarity = _semantic_cache_match(cache, query, 0.9, "acme")
+    assert key == "best"
+    assert value == {"body": {"content": "Paris."}}
+    assert similarity == pytest.approx(_cosine_similarity([1.0, 0.0], [1.0, 0.1]))
+    cache.semantic_candidates.assert_called_once_with("s", "acme")
+
+    assert _semantic_cache_match(cache, query, 0.999, "acme") is None
+
+
+@patch("reliapi.core.cache.redis")
+def test_index_drops_expired_entries(mock_redis_module, mock_redis):
+    mock_redis_module.from_url.return_value = mock_redis
+    cache = Cache("redis://localhost:6379/0")
+
+    cache.add_semantic_entry("scope", "abc", [0.1, 0.2], ttl_s=60, tenant="acme")
+    index_key, member = mock_redis.lpush.call_args[0]
+    assert index_key == "reliapi:tenant:acme:semantic:scope"
+    assert json.loads(member)["key"] == "abc"
+    mock_redis.ltrim.assert_called_once_with(index_key, 0, 199)
+
+    now = time.time()
+    mock_redis.lrange.return_value = [
+        json.dumps({"key": "fresh", "embedding": [1.0], "expires_at": now + 30}),
+        json.dumps({"key": "expired", "embedding": [1.0], "expires_at": now - 1}),
+        "not json",
+    ]
+    assert cache.semantic_candidates("scope", tenant="acme") == [("fresh", [1.0])]
+
+
+async def _proxy(cache, cache_semantic, **kwargs):
+    return await handle_llm_proxy(
+        target_name="openai",
+        messages=MESSAGES,
+        model=None,
+        max_tokens=None,
+        temperature=None,
+        top_p=None,
+        stop=None,
+        stream=False,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets={"openai": TARGET},
+        cache=cache,
+        idempotency=Mock(spec=IdempotencyManager),
+        request_id="req_sem",
+        tenant="acme",
+        cache_semantic=cache_semantic,
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_semantic_hit_after_exact_miss():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.semantic_candidates.return_value = [("similar", [0.99, 0.1])]
+    cache.get_entry.return_value = {"value": {"body": {"content": "Paris."}, "cost_usd": 0.001}, "stale": False}
+    cache.set.return_value = True
+    query = SemanticQuery(scope="s", embedding=[1.0, 0.0])
+
+    with patch.object(services, "_semantic_query", AsyncMock(return_value=query)) as embed:
+        result = await _proxy(cache, {"threshold": 0.95, "embedding_model": None})
+
+    assert embed.call_args.args[2] is None
+    assert result.success
+    assert result.data == {"content": "Paris."}
+    assert result.meta.cache_hit is True
+    assert result.meta.semantic_cache_hit is True
+    assert result.meta.semantic_similarity == pytest.approx(_cosine_similarity([1.0, 0.0], [0.99, 0.1]))
+    assert result.meta.cache_key == "similar"
+
+
+@pytest.mark.asyncio
+async def test_exact_hit_skips_embedding():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = {"body": {"content": "Paris."}, "cost_usd": 0.001}
+    cache.set.return_value = True
+
+    with patch.object(services, "_semantic_query", AsyncMock()) as embed:
+        result = await _proxy(cache, {"threshold": 0.95, "embedding_model": None})
+
+    embed.assert_not_called()
+    assert result.meta.cache_hit is True
+    assert result.meta.semantic_cache_hit is None
@@ -0,0 +1,49 @@
+"""Tests for the prompt template registry and rendering."""
+import pytest
+
+from reliapi.core.templates import TemplateRegistry, TemplateVariablesError, render, template_variables
+
+MESSAGES = [
+    {"role": "system", "content": "You answer questions about {{ product }}."},
+    {"role": "user", "content": "{{question}} Answer in {{language}}, about {{product}}."},
+]
+
+
+def test_variables_in_order_of_first_use():
+    assert template_variables(MESSAGES) == ["product", "question", "language"]
+    assert template_variables([{"role": "user", "content": "No placeholders, {not one}"}]) == []
+
+
+def test_every_put_is_a_new_version():
+    registry = TemplateRegistry()
+    first = registry.put("support", MESSAGES, "Support answers")
+    second = registry.put("support", MESSAGES[1:])
+    assert (first["version"], second["version"]) == (1, 2)
+    assert registry.get("support") is second
+    assert registry.get("support", 1) is first
+    assert registry.get("support", 3) is None
+    assert registry.get("other") is None
+    assert second["variables"] == ["question", "language", "product"]
+
+
+def test_render_substitutes_every_placeholder():
+    template = TemplateRegistry().put("support", MESSAGES)
+    messages = render(template, {"product": "ReliAPI", "question": "How do retries work?", "language": "French"})
+    assert messages == [
+        {"role": "system", "content": "You answer questions about ReliAPI."},
+        {"role": "user", "content": "How do retries work? Answer in French, about ReliAPI."},
+    ]
+    # Values are inserted as they are, never rendered again
+    messages = render(template, {"product": "{{question}}", "question": "q", "language": "en"})
+    assert messages[0]["content"] == "You answer questions about {{question}}."
+
+
+def test_render_lists_missing_and_unknown_variables():
+    template = TemplateRegistry().put("support", MESSAGES)
+    with pytest.raises(TemplateVariablesError) as exc:
+        render(template, {"product": "ReliAPI", "tone": "friendly", "audience": "devs"})
+    assert exc.value.missing == ["question", "language"]
+    assert exc.value.unexpected == ["audience", "tone"]
+    assert str(exc.value) == (
+        "Template missing variables: question, language; unknown variables: audience, tone"
+    )
@@ -0,0 +1,57 @@
+"""Tests for W3C trace context forwarding."""
+import pytest
+
+from reliapi.core.http_client import UpstreamHTTPClient
+from reliapi.core.tracing import TraceContextMiddleware, parse_trace_headers, trace_headers
+
+TRACEPARENT = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+
+def test_parse_trace_headers():
+    """Only well-formed traceparents are kept, and tracestate needs one."""
+    assert parse_trace_headers({"Traceparent": TRACEPARENT, "tracestate": "vendor=1"}) == {
+        "traceparent": TRACEPARENT,
+        "tracestate": "vendor=1",
+    }
+    assert parse_trace_headers({"tracestate": "vendor=1"}) == {}
+    assert parse_trace_headers({"traceparent": "00-abc-def-01"}) == {}
+    assert parse_trace_headers({"traceparent": "00-" + "0" * 32 + "-00f067aa0ba902b7-01"}) == {}
+    assert parse_trace_headers({"traceparent": "ff" + TRACEPARENT[2:]}) == {}
+
+
+@pytest.mark.asyncio
+async def test_middleware_scopes_trace_context_to_request():
+    """trace_headers() sees the request's headers only while it is handled."""
+    seen = {}
+
+    async def app(scope, receive, send):
+        seen.update(trace_headers())
+
+    middleware = TraceContextMiddleware(app)
+    scope = {"type": "http", "headers": [(b"traceparent", TRACEPARENT.encode()), (b"x-other", b"1")]}
+    await middleware(scope, None, None)
+
+    assert seen == {"traceparent": TRACEPARENT}
+    assert trace_headers() == {}
+
+
+@pytest.mark.asyncio
+async def test_upstream_client_forwards_trace_context_when_enabled():
+    """Targets opt in; explicit request headers take precedence."""
+    captured = {}
+
+    async def app(scope, receive, send):
+        forwarding = UpstreamHTTPClient(base_url="https://example.com", forward_trace_context=True)
+        plain = UpstreamHTTPClient(base_url="https://example.com")
+        captured["forwarding"] = forwarding._prepare_headers({"X-Test": "1"})
+        captured["explicit"] = forwarding._prepare_headers({"TraceParent": "caller-set"})
+        captured["plain"] = plain._prepare_headers({"X-Test": "1"})
+        await forwarding.client.aclose()
+        await plain.client.aclose()
+
+    scope = {"type": "http", "headers": [(b"traceparent", TRACEPARENT.encode()), (b"tracestate", b"vendor=1")]}
+    await TraceContextMiddleware(app)(scope, None, None)
+
+    assert captured["forwarding"] == {"X-Test": "1", "traceparent": TRACEPARENT, "tracestate": "vendor=1"}
+    assert captured["explicit"] == {"TraceParent": "caller-set", "tracestate": "vendor=1"}
+    assert captured["plain"] == {"X-Test": "1"}
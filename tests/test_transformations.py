@@ -0,0 +1,202 @@
+"""Tests for per-target request and response transformations."""
+from unittest.mock import AsyncMock, Mock, patch
+
+import httpx
+import pytest
+from pydantic import ValidationError
+
+from reliapi.app import services
+from reliapi.app.services import handle_http_proxy
+from reliapi.config.schema import TransformationConfig
+from reliapi.core.cache import Cache
+from reliapi.core.idempotency import IdempotencyManager
+from reliapi.core.transformations import (
+    parse_extract_path,
+    track_transformations,
+    transform_request,
+    transform_response,
+)
+
+CONFIG = {
+    "headers": {"X-Org": "acme", "X-Caller": "${key_id}@${tenant}", "X-Trace": "${request_id}"},
+    "path_rules": [
+        {"match": r"/v1/users/(\d+)", "replace": r"/accounts/\1/profile"},
+        {"match": "/v1", "replace": "/legacy"},
+    ],
+    "path_prefix": "/api/v2/",
+    "request_body": '{"input": ${body}, "method": "${method}"}',
+    "response_extract": "$.result.items[0]",
+}
+VARIABLES = {"request_id": "req_1", "key_id": "ci", "tenant": "acme", "target": "api"}
+
+
+@pytest.fixture(autouse=True)
+def fresh_circuit_breakers():
+    """Isolate the process-wide circuit breakers between tests."""
+    services._circuit_breakers.clear()
+    yield
+    services._circuit_breakers.clear()
+
+
+@pytest.fixture
+def mock_targets():
+    return {
+        "api": {
+            "base_url": "https://api.example.com",
+            "cache": {"enabled": True, "ttl_s": 60},
+            "transformation": CONFIG,
+        }
+    }
+
+
+@pytest.fixture
+def mock_cache():
+    cache = Mock(spec=Cache)
+    cache.get.return_value = None
+    cache.get_entry.return_value = None
+    cache.set.return_value = True
+    return cache
+
+
+def test_request_transformed():
+    """Test that headers are templated, the first matching rule applies and the body is wrapped."""
+    request = transform_request(
+        CONFIG, "post", "/v1/users/42/settings?full=1", {"x-org": "other", "Accept": "*/*"}, '{"a": 1}',
+        variables=VARIABLES,
+    )
+
+    assert request.path == "/api/v2/accounts/42/profile/settings?full=1"
+    assert request.headers == {"Accept": "*/*", "X-Org": "acme", "X-Caller": "ci@acme", "X-Trace": "req_1"}
+    assert request.body == '{"input": {"a": 1}, "method": "POST"}'
+    assert request.applied == [
+        "header:X-Org", "header:X-Caller", "header:X-Trace", "path_rule:0", "path_prefix", "request_body",
+    ]
+
+
+def test_request_id_headers_left_out_of_the_key():
+    """Test that a header templated with ${request_id} does not make every cache key unique."""
+    request = transform_request(CONFIG, "GET", "/v1", {"X-Trace": "mine"}, None, variables=VARIABLES)
+
+    assert request.headers["X-Trace"] == "req_1"
+    assert "X-Trace" not in request.key_headers
+    assert request.key_headers["X-Org"] == "acme"
+    assert request.path == "/api/v2/legacy"
+    assert "request_body" not in request.applied
+
+
+def test_request_without_transformation_unchanged():
+    """Test that a target without a transformation section leaves requests alone."""
+    request = transform_request(None, "POST", "/x", {"A": "1"}, "body", variables=VARIABLES)
+
+    assert (request.path, request.headers, request.body, request.applied) == ("/x", {"A": "1"}, "body", [])
+
+
+def test_response_extracted():
+    """Test that JSON bodies are replaced by the value at response_extract, other bodies kept."""
+    data = {"status_code": 200, "body": {"result": {"items": [{"id": 1}, {"id": 2}]}}}
+    assert transform_response(CONFIG, data) is True
+    assert data["body"] == {"id": 1}
+
+    missing = {"status_code": 200, "body": {"result": {}}}
+    assert transform_response(CONFIG, missing) is False
+    assert missing["body"] == {"result": {}}
+
+    binary = {"status_code": 200, "body": "AAEC", "body_encoding": "base64"}
+    assert transform_response(CONFIG, binary) is False
+
+
+@pytest.mark.parametrize("path,steps", [
+    ("$", []),
+    ("$.data", ["data"]),
+    ("$.result.items[-1].user-id", ["result", "items", -1, "user-id"]),
+])
+def test_extract_path(path, steps):
+    assert parse_extract_path(path) == steps
+
+
+@pytest.mark.parametrize("config,error", [
+    ({"headers": {"X-A": "${secret}"}}, "unknown variable"),
+    ({"headers": {"X-A": "${body}"}}, "unknown variable"),
+    ({"path_rules": [{"match": "(", "replace": ""}]}, "not a valid regular expression"),
+    ({"request_body": '{"input": 1}'}, "must use"),
+    ({"response_extract": "data"}, "must start with"),
+    ({"response_extract": "$.items[x]"}, "invalid step"),
+])
+def test_invalid_config_rejected(config, error):
+    with pytest.raises(ValidationError, match=error):
+        TransformationConfig(**config)
+
+
+async def _proxy(targets, cache, method="GET", path="/v1/users/7", body=None, **kwargs):
+    return await handle_http_proxy(
+        target_name="api",
+        method=method,
+        path=path,
+        headers={"Accept": "application/json"},
+        query=None,
+        body=body,
+        idempotency_key=None,
+        cache_ttl=None,
+        targets=targets,
+        cache=cache,
+        idempotency=Mock(spec=IdempotencyManager),
+        request_id="req_tr",
+        tenant="acme",
+        key_id="ci",
+        **kwargs,
+    )
+
+
+@pytest.mark.asyncio
+async def test_proxy_sends_transformed_request(mock_targets, mock_cache):
+    """Test that the upstream, the cache key and the stored entry see the transformed request."""
+    upstream = AsyncMock(return_value=httpx.Response(200, json={"result": {"items": [{"id": 7}]}}))
+    with patch("httpx.AsyncClient.request", upstream), track_transformations() as applied:
+        result = await _proxy(mock_targets, mock_cache)
+
+    sent = upstream.call_args.kwargs
+    assert sent["url"] == "https://api.example.com/api/v2/accounts/7/profile"
+    assert sent["headers"]["X-Caller"] == "ci@acme"
+    assert sent["headers"]["X-Trace"] == "req_tr"
+    assert result.data["body"] == {"id": 7}
+    assert applied.names == [
+        "header:X-Org", "header:X-Caller", "header:X-Trace", "path_rule:0", "path_prefix", "response_extract",
+    ]
+
+    method, url, headers = mock_cache.set.call_args.args[:3]
+    assert url == "https://api.example.com/api/v2/accounts/7/profile"
+    assert "X-Trace" not in headers
+    assert mock_cache.set.call_args.args[4]["body"] == {"id": 7}
+    assert result.meta.cache_key == services.resolve_http_cache_key(
+        "api", "GET", "/v1/users/7", {"Accept": "application/json"}, None, None, mock_targets,
+        key_id="ci", tenant="acme",
+    )
+
+
+@pytest.mark.asyncio
+async def test_cache_hit_reports_response_extract(mock_targets, mock_cache):
+    """Test that an entry stored extracted is reported as such when served from cache."""
+    mock_cache.get.return_value = {"status_code": 200, "headers": {}, "body": {"id": 7}, "response_extracted": True}
+    with track_transformations() as applied:
+        result = await _proxy(mock_targets, mock_cache)
+
+    assert result.meta.cache_hit is True
+    assert result.data == {"status_code": 200, "headers": {}, "body": {"id": 7}}
+    assert "response_extract" in applied.names
+
+
+@pytest.mark.asyncio
+async def test_dry_run_shows_upstream_request(mock_targets, mock_cache):
+    """Test that a dry run returns the request as it would be sent upstream."""
+    upstream = AsyncMock()
+    with patch("httpx.AsyncClient.request", upstream):
+        result = await _proxy(mock_targets, mock_cache, method="POST", path="/v1/jobs", body='{"n": 1}', dry_run=True)
+
+    upstream.assert_not_called()
+    assert result.meta.upstream_request == {
+        "method": "POST",
+        "url": "https://api.example.com/api/v2/legacy/jobs",
+        "headers": {"Accept": "application/json", "X-Org": "acme", "X-Caller": "ci@acme", "X-Trace": "req_tr"},
+        "query": None,
+        "body": '{"input": {"n": 1}, "method": "POST"}',
+    }
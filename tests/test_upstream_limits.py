@@ -0,0 +1,136 @@
+"""Tests for pacing by upstream rate limit headers."""
+import asyncio
+from unittest.mock import patch
+
+import pytest
+
+from reliapi.app import services
+from reliapi.core.upstream_limits import UpstreamRateLimits, parse_rate_limit, track_rate_limit
+
+NOW = 1_760_000_000.0
+
+
+class Clock:
+    """A clock advanced by the pacer's sleeps instead of real time."""
+
+    def __init__(self) -> None:
+        self.now = NOW
+
+    def time(self) -> float:
+        return self.now
+
+    async def sleep(self, seconds: float) -> None:
+        self.now += seconds
+
+
+class FakeUpstream:
+    """An upstream allowing 10 requests a minute, reporting what is left."""
+
+    LIMIT, WINDOW_S = 10, 60.0
+
+    def __init__(self, clock: Clock) -> None:
+        self.clock = clock
+        self.window_start = clock.now
+        self.used = 0
+        self.statuses = []
+
+    def call(self):
+        if self.clock.now >= self.window_start + self.WINDOW_S:
+            self.window_start, self.used = self.clock.now, 0
+        reset_in = self.window_start + self.WINDOW_S - self.clock.now
+        if self.used >= self.LIMIT:
+            status, headers = 429, {"Retry-After": str(int(reset_in) + 1)}
+        else:
+            self.used += 1
+            status = 200
+            headers = {
+                "X-RateLimit-Limit": str(self.LIMIT),
+                "X-RateLimit-Remaining": str(self.LIMIT - self.used),
+                "X-RateLimit-Reset": str(int(self.window_start + self.WINDOW_S)),
+            }
+        self.statuses.append(status)
+        return status, headers
+
+
+@pytest.fixture(autouse=True)
+def fresh_limits():
+    """Isolate the process-wide rate limits between tests."""
+    services._upstream_limits.reset()
+    yield
+    services._upstream_limits.reset()
+
+
+def test_parse_provider_headers():
+    openai = parse_rate_limit(
+        200,
+        {"x-ratelimit-limit-requests": "500", "x-ratelimit-remaining-requests": "499", "x-ratelimit-reset-requests": "1m0.5s"},
+        now=NOW,
+    )
+    assert (openai.limit, openai.remaining, openai.reset_at) == (500, 499, NOW + 60.5)
+    anthropic = parse_rate_limit(
+        200,
+        {"anthropic-ratelimit-requests-remaining": "0", "anthropic-ratelimit-requests-reset": "2025-10-09T09:00:00Z"},
+        now=NOW,
+    )
+    assert anthropic.remaining == 0 and anthropic.reset_at == 1_760_000_400.0
+    # Spent tokens hold requests too, and a 429's Retry-After wins
+    tokens = parse_rate_limit(
+        429,
+        {"x-ratelimit-remaining-requests": "5", "x-ratelimit-remaining-tokens": "0", "x-ratelimit-reset-tokens": "20ms", "Retry-After": "2"},
+        now=NOW,
+    )
+    assert tokens.remaining == 0 and tokens.reset_at == NOW + 2
+    assert parse_rate_limit(200, {"Content-Type": "application/json"}, now=NOW) is None
+
+
+def test_no_429s_reach_the_caller():
+    clock = Clock()
+    upstream = FakeUpstream(clock)
+    limits = UpstreamRateLimits()
+
+    async def run():
+        for _ in range(25):
+            await limits.acquire("openai", "org-a", max_wait_s=60)
+            status, headers = upstream.call()
+            limits.observe("openai", "org-a", status, headers)
+
+    with patch("reliapi.core.upstream_limits.time", clock), patch(
+        "reliapi.core.upstream_limits.asyncio.sleep", clock.sleep
+    ):
+        asyncio.run(run())
+    assert upstream.statuses == [200] * 25
+    # Twice held for a window to reset
+    assert clock.now == NOW + 120
+
+
+def test_long_waits_send_anyway():
+    clock = Clock()
+    limits = UpstreamRateLimits()
+    limits.observe("openai", None, 429, {"Retry-After": "120"}, now=NOW)
+
+    async def run():
+        return await limits.acquire("openai", None, max_wait_s=30)
+
+    with patch("reliapi.core.upstream_limits.time", clock):
+        assert asyncio.run(run()) == 0.0
+        assert limits.status("openai")[0]["remaining"] == 0
+
+
+def test_tracked_limit_and_status():
+    with track_rate_limit() as tracked:
+        services._upstream_limits.observe(
+            "openai", "org-a", 200, {"X-RateLimit-Limit": "10", "X-RateLimit-Remaining": "4", "X-RateLimit-Reset": "30"}
+        )
+    assert tracked.last.remaining == 4
+    status = services.upstream_rate_limits("openai")
+    assert [(s["credential"], s["limit"], s["remaining"]) for s in status] == [("org-a", 10, 4)]
+    assert services.upstream_rate_limits("other") == []
+
+
+def test_http_client_paces_by_credential():
+    target = {"base_url": "https://api.openai.com/v1", "credentials": [{"name": "org-a", "api_key": "sk-a"}]}
+    client, _, _ = services.create_http_client(target, "openai")
+    assert (client.pacer.target, client.pacer.credential, client.pacer.max_wait_s) == ("openai", "org-a", 30.0)
+    target["upstream_rate_limit"] = {"enabled": False}
+    client, _, _ = services.create_http_client(target, "openai")
+    assert client.pacer is None
@@ -0,0 +1,227 @@
+"""Tests for usage recording and the paginated usage report."""
+import asyncio
+import json
+from datetime import datetime, timedelta, timezone
+
+import pytest
+
+from reliapi.app import services
+from reliapi.app.routes.usage import _csv_report
+from reliapi.app.schemas import ErrorResponse, MetaResponse, SuccessResponse
+from reliapi.app.services import metered_stream, record_usage, usage_report, usage_tags
+from reliapi.core.usage import UsageLedger, is_group_by_field, validate_tags
+
+NOW = datetime(2026, 10, 14, 12, 30, tzinfo=timezone.utc)
+DAY = (datetime(2026, 10, 14, tzinfo=timezone.utc), datetime(2026, 10, 15, tzinfo=timezone.utc))
+
+
+def _today():
+    """A range around the current time, for usage recorded by the services."""
+    now = datetime.now(timezone.utc)
+    return now - timedelta(hours=1), now + timedelta(hours=1)
+
+
+@pytest.fixture(autouse=True)
+def fresh_usage():
+    """Isolate the process-wide usage ledger between tests."""
+    services._usage_ledger.reset()
+    yield
+    services._usage_ledger.reset()
+
+
+def _success(**meta):
+    meta = {"target": "openai", "model": "gpt-4o-mini", "duration_ms": 5, "request_id": "req_1", **meta}
+    return SuccessResponse(
+        success=True,
+        data={"content": "Hi", "usage": {"prompt_tokens": 10, "completion_tokens": 2}},
+        meta=MetaResponse(**meta),
+    )
+
+
+def test_hits_are_not_billable():
+    ledger = UsageLedger()
+    ledger.record("acme", "sk-abcde", "openai", "gpt-4o-mini", "llm", prompt_tokens=10, cost_usd=0.01, now=NOW)
+    ledger.record("acme", "sk-abcde", "openai", "gpt-4o-mini", "llm", cache_hit=True, prompt_tokens=10, cost_usd=0.01, now=NOW)
+    ledger.record("acme", "sk-abcde", "openai", "gpt-4o-mini", "llm", idempotent_hit=True, cost_usd=0.01, now=NOW)
+    ledger.record("acme", "sk-abcde", "openai", "gpt-4o-mini", "llm", success=False, now=NOW)
+
+    [row] = ledger.report("acme", *DAY, [])
+    assert row["requests"] == 4
+    assert row["billable_requests"] == 2
+    assert row["cache_hits"] == 1
+    assert row["idempotent_hits"] == 1
+    assert row["errors"] == 1
+    assert row["prompt_tokens"] == 10
+    assert row["cost_usd"] == 0.01
+
+
+def test_report_groups_and_scopes_to_tenant():
+    ledger = UsageLedger()
+    ledger.record("acme", None, "openai", "gpt-4o", "llm", cost_usd=0.2, now=NOW)
+    ledger.record("acme", None, "openai", "gpt-4o-mini", "llm", cost_usd=0.1, now=NOW)
+    ledger.record("acme", None, "anthropic", "claude-3-haiku", "llm", cost_usd=0.3, now=NOW)
+    ledger.record("acme", None, "openai", None, "http", now=NOW - timedelta(days=2))
+    ledger.record("other", None, "openai", "gpt-4o", "llm", cost_usd=5.0, now=NOW)
+
+    rows = ledger.report("acme", *DAY, ["target"])
+    assert [(r["target"], r["requests"], r["cost_usd"]) for r in rows] == [
+        ("anthropic", 1, 0.3),
+        ("openai", 2, 0.3),
+    ]
+    [empty] = ledger.report("nobody", *DAY, [])
+    assert empty["requests"] == 0 and empty["cost_usd"] == 0.0
+    assert ledger.report("nobody", *DAY, ["model"]) == []
+
+
+def test_report_pages_with_cursor():
+    for model in ("a", "b", "c", "d", "e"):
+        services._usage_ledger.record("acme", None, "openai", model, "llm", now=NOW)
+
+    start, end = NOW - timedelta(hours=1), NOW
+    models, cursor = [], None
+    while True:
+        page = usage_report("acme", start, end, ["model"], limit=2, cursor=cursor)
+        models += [r["model"] for r in page["rows"]]
+        cursor = page["next_cursor"]
+        if not cursor:
+            break
+    assert models == ["a", "b", "c", "d", "e"]
+    # The range is widened to whole hours
+    assert page["from"] == "2026-10-14T11:00:00+00:00"
+    assert page["to"] == "2026-10-14T13:00:00+00:00"
+
+    first = usage_report("acme", start, end, ["model"], limit=2)
+    with pytest.raises(ValueError):
+        usage_report("acme", start, end, ["target"], limit=2, cursor=first["next_cursor"])
+    with pytest.raises(ValueError):
+        usage_report("acme", start, end, ["model"], cursor="not-a-cursor")
+
+
+def test_record_usage_uses_served_by_and_tokens():
+    record_usage(_success(served_by="anthropic", cost_usd=0.02), "llm", "acme", "sk-abcdefghij")
+    record_usage(_success(cache_hit=True, cost_usd=0.02), "llm", "acme", "sk-abcdefghij")
+    record_usage(
+        ErrorResponse(
+            success=False,
+            error={"type": "upstream_error", "code": "UPSTREAM_5XX", "message": "boom", "retryable": True},
+            meta=MetaResponse(target="openai", duration_ms=1, request_id="req_2"),
+        ),
+        "http",
+        "acme",
+        None,
+    )
+
+    rows = usage_report("acme", *_today(), ["target", "api_key_prefix", "kind"])["rows"]
+    assert rows == [
+        {
+            "target": "anthropic", "api_key_prefix": "sk-abcde", "kind": "llm",
+            "requests": 1, "billable_requests": 1, "cache_hits": 0, "idempotent_hits": 0, "errors": 0,
+            "prompt_tokens": 10, "completion_tokens": 2, "embedding_tokens": 0, "cost_usd": 0.02,
+        },
+        {
+            "target": "openai", "api_key_prefix": None, "kind": "http",
+            "requests": 1, "billable_requests": 1, "cache_hits": 0, "idempotent_hits": 0, "errors": 1,
+            "prompt_tokens": 0, "completion_tokens": 0, "embedding_tokens": 0, "cost_usd": 0.0,
+        },
+        {
+            "target": "openai", "api_key_prefix": "sk-abcde", "kind": "llm",
+            "requests": 1, "billable_requests": 0, "cache_hits": 1, "idempotent_hits": 0, "errors": 0,
+            "prompt_tokens": 0, "completion_tokens": 0, "embedding_tokens": 0, "cost_usd": 0.0,
+        },
+    ]
+
+
+def test_record_usage_counts_embedding_tokens_apart():
+    embedded = SuccessResponse(
+        success=True,
+        data={"embeddings": [[0.5]], "cache_hits": [False], "prompt_tokens": 12},
+        meta=MetaResponse(target="openai", model="text-embedding-3-small", duration_ms=5, request_id="req_e", cost_usd=0.001),
+    )
+    record_usage(embedded, "embeddings", "acme", None)
+    record_usage(_success(), "llm", "acme", None)
+
+    rows = usage_report("acme", *_today(), ["kind"])["rows"]
+    tokens = {row["kind"]: (row["prompt_tokens"], row["embedding_tokens"]) for row in rows}
+    assert tokens == {"embeddings": (0, 12), "llm": (10, 0)}
+
+
+def test_metered_stream_records_on_done():
+    async def events():
+        yield 'event: meta\ndata: {"target": "openai"}\n\n'
+        yield 'event: chunk\ndata: {"delta": "Hi"}\n\n'
+        done = {"finish_reason": "stop", "usage": {"prompt_tokens": 7, "completion_tokens": 1}, "cost_usd": 0.003}
+        yield f"event: done\ndata: {json.dumps(done)}\n\n"
+
+    async def drain():
+        return [e async for e in metered_stream(events(), "openai", "gpt-4o-mini", "acme", None)]
+
+    relayed = asyncio.run(drain())
+    assert len(relayed) == 3
+
+    [row] = usage_report("acme", *_today(), ["model"])["rows"]
+    assert row["model"] == "gpt-4o-mini"
+    assert (row["requests"], row["prompt_tokens"], row["completion_tokens"], row["cost_usd"]) == (1, 7, 1, 0.003)
+
+
+def test_report_groups_by_tags():
+    record_usage(_success(cost_usd=0.02, tags={"feature": "search", "team": "core"}), "llm", "acme", None)
+    record_usage(_success(cost_usd=0.01, tags={"feature": "search"}), "llm", "acme", None)
+    record_usage(_success(cost_usd=0.04, tags={"feature": "chat"}), "llm", "acme", None)
+    record_usage(_success(cost_usd=0.08), "llm", "acme", None)
+
+    rows = usage_report("acme", *_today(), ["tag.feature"])["rows"]
+    assert [(r["tag.feature"], r["requests"], r["cost_usd"]) for r in rows] == [
+        (None, 1, 0.08), ("chat", 1, 0.04), ("search", 2, 0.03),
+    ]
+    rows = usage_report("acme", *_today(), ["tag.team", "model"])["rows"]
+    assert [(r["tag.team"], r["requests"]) for r in rows] == [(None, 3), ("core", 1)]
+
+
+def test_tag_values_past_the_limit_are_hashed():
+    services._usage_ledger.max_tag_values = 2
+    try:
+        assert usage_tags("acme", {"user": "u1"}) == {"user": "u1"}
+        assert usage_tags("acme", {"user": "u2", "feature": "chat"}) == {"feature": "chat", "user": "u2"}
+        overflow = usage_tags("acme", {"user": "u3"})["user"]
+        assert overflow.startswith("~") and len(overflow) == 2
+        # Values keep their slot, and the hash is stable
+        assert usage_tags("acme", {"user": "u1"}) == {"user": "u1"}
+        assert usage_tags("acme", {"user": "u3"})["user"] == overflow
+        # The limit is per tenant
+        assert usage_tags("other", {"user": "u3"}) == {"user": "u3"}
+        assert usage_tags("acme", None) is None
+    finally:
+        services._usage_ledger.max_tag_values = 100
+
+
+def test_tags_are_bounded():
+    assert validate_tags({"feature": "search"}) == {"feature": "search"}
+    for tags in ({f"k{i}": "v" for i in range(11)}, {"bad key": "v"}, {"k": ""}, {"k": "v" * 129}, {"k" * 65: "v"}):
+        with pytest.raises(ValueError):
+            validate_tags(tags)
+    assert is_group_by_field("tag.feature") and is_group_by_field("model")
+    assert not is_group_by_field("tag.") and not is_group_by_field("tenant")
+
+
+def test_metered_stream_reports_tags():
+    async def events():
+        yield 'event: meta\ndata: {"target": "openai"}\n\n'
+        yield f"event: done\ndata: {json.dumps({'cost_usd': 0.003})}\n\n"
+
+    async def drain():
+        return [e async for e in metered_stream(events(), "openai", "gpt-4o-mini", "acme", None, tags={"feature": "chat"})]
+
+    relayed = asyncio.run(drain())
+    assert json.loads(relayed[0].split("data: ", 1)[1])["tags"] == {"feature": "chat"}
+    [row] = usage_report("acme", *_today(), ["tag.feature"])["rows"]
+    assert (row["tag.feature"], row["cost_usd"]) == ("chat", 0.003)
+
+
+def test_csv_report():
+    services._usage_ledger.record("acme", None, "openai", "gpt-4o", "llm", prompt_tokens=3, cost_usd=0.5, now=NOW)
+
+    lines = _csv_report(usage_report("acme", *DAY, ["target"])).splitlines()
+    assert lines == [
+        "target,requests,billable_requests,cache_hits,idempotent_hits,errors,prompt_tokens,completion_tokens,embedding_tokens,cost_usd",
+        "openai,1,1,0,0,0,3,0,0,0.5",
+    ]